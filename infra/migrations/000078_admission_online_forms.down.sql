@@ -0,0 +1,3 @@
+-- 000078_admission_online_forms.down.sql
+
+DROP TABLE IF EXISTS admission_fee_orders;
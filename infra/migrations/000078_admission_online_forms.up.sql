@@ -0,0 +1,21 @@
+-- 000078_admission_online_forms.up.sql
+-- Online application fee orders for schema-driven public admission forms.
+-- Form schemas themselves live in tenants.config (admissions.forms).
+
+CREATE TABLE IF NOT EXISTS admission_fee_orders (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    application_id UUID NOT NULL REFERENCES admission_applications(id) ON DELETE CASCADE,
+    amount BIGINT NOT NULL CHECK (amount > 0),
+    currency TEXT NOT NULL DEFAULT 'INR',
+    provider TEXT, -- "razorpay", "payu"
+    external_ref TEXT, -- Gateway order id
+    gateway_payment_id TEXT,
+    status TEXT NOT NULL DEFAULT 'created' CHECK (status IN ('created', 'pending', 'paid', 'failed')),
+    paid_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_admission_fee_orders_application ON admission_fee_orders(tenant_id, application_id);
+CREATE INDEX IF NOT EXISTS idx_admission_fee_orders_external_ref ON admission_fee_orders(tenant_id, external_ref);
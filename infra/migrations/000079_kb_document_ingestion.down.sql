@@ -0,0 +1,14 @@
+-- 000079_kb_document_ingestion.down.sql
+
+ALTER TABLE kb_chunks
+    DROP COLUMN IF EXISTS source_anchor,
+    DROP COLUMN IF EXISTS page_number,
+    DROP COLUMN IF EXISTS section_path,
+    DROP COLUMN IF EXISTS block_type;
+
+ALTER TABLE kb_documents
+    DROP COLUMN IF EXISTS ingested_at,
+    DROP COLUMN IF EXISTS source_sha256,
+    DROP COLUMN IF EXISTS source_file_name,
+    DROP COLUMN IF EXISTS source_file_id,
+    DROP COLUMN IF EXISTS source_type;
@@ -0,0 +1,18 @@
+-- 000079_kb_document_ingestion.up.sql
+
+-- Source file tracking for documents ingested from PDF/DOCX/HTML uploads.
+ALTER TABLE kb_documents
+    ADD COLUMN IF NOT EXISTS source_type TEXT NOT NULL DEFAULT 'text'
+        CHECK (source_type IN ('text', 'pdf', 'docx', 'html')),
+    ADD COLUMN IF NOT EXISTS source_file_id UUID REFERENCES files(id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS source_file_name TEXT,
+    ADD COLUMN IF NOT EXISTS source_sha256 TEXT,
+    ADD COLUMN IF NOT EXISTS ingested_at TIMESTAMPTZ;
+
+-- Each chunk remembers where it came from in the source document.
+ALTER TABLE kb_chunks
+    ADD COLUMN IF NOT EXISTS block_type TEXT NOT NULL DEFAULT 'text'
+        CHECK (block_type IN ('text', 'paragraph', 'list', 'table')),
+    ADD COLUMN IF NOT EXISTS section_path TEXT,
+    ADD COLUMN IF NOT EXISTS page_number INT,
+    ADD COLUMN IF NOT EXISTS source_anchor TEXT;
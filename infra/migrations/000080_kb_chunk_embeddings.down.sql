@@ -0,0 +1,3 @@
+-- 000080_kb_chunk_embeddings.down.sql
+
+DROP TABLE IF EXISTS kb_chunk_embeddings;
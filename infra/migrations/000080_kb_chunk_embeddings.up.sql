@@ -0,0 +1,16 @@
+-- 000080_kb_chunk_embeddings.up.sql
+
+-- One embedding per chunk for the configured model. Vectors are stored
+-- L2-normalised so cosine similarity is a plain dot product.
+CREATE TABLE IF NOT EXISTS kb_chunk_embeddings (
+    chunk_id UUID PRIMARY KEY REFERENCES kb_chunks(id) ON DELETE CASCADE,
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    document_id UUID NOT NULL REFERENCES kb_documents(id) ON DELETE CASCADE,
+    model TEXT NOT NULL,
+    dimensions INT NOT NULL CHECK (dimensions > 0),
+    embedding REAL[] NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS kb_chunk_embeddings_tenant_model
+    ON kb_chunk_embeddings (tenant_id, model);
@@ -0,0 +1,3 @@
+-- 000081_ai_helpdesk_answers.down.sql
+
+DROP TABLE IF EXISTS ai_helpdesk_answers;
@@ -0,0 +1,33 @@
+-- 000081_ai_helpdesk_answers.up.sql
+
+-- One row per parent helpdesk answer: which knowledgebase chunks were
+-- retrieved and cited, and whether the question was handed off to staff.
+-- Chunk ids are kept without a foreign key because chunks are rewritten
+-- whenever a document is edited; the log must outlive them.
+CREATE TABLE IF NOT EXISTS ai_helpdesk_answers (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    channel TEXT NOT NULL CHECK (channel IN ('app', 'whatsapp')),
+    user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    external_id TEXT,
+    query TEXT NOT NULL,
+    answer TEXT NOT NULL,
+    confidence DOUBLE PRECISION NOT NULL DEFAULT 0,
+    retrieval TEXT,
+    retrieved_chunk_ids UUID[] NOT NULL DEFAULT '{}',
+    cited_chunk_ids UUID[] NOT NULL DEFAULT '{}',
+    cited_document_ids UUID[] NOT NULL DEFAULT '{}',
+    handoff_reason TEXT,
+    handoff_status TEXT CHECK (handoff_status IN ('open', 'resolved')),
+    resolved_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    resolved_at TIMESTAMPTZ,
+    resolution_note TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS ai_helpdesk_answers_tenant_created
+    ON ai_helpdesk_answers (tenant_id, created_at DESC);
+
+CREATE INDEX IF NOT EXISTS ai_helpdesk_answers_open_handoffs
+    ON ai_helpdesk_answers (tenant_id, created_at)
+    WHERE handoff_status = 'open';
@@ -0,0 +1,3 @@
+-- 000082_ai_helpdesk_tools.down.sql
+
+ALTER TABLE ai_helpdesk_answers DROP COLUMN IF EXISTS tools_used;
@@ -0,0 +1,5 @@
+-- 000082_ai_helpdesk_tools.up.sql
+
+-- Read-only tools the helpdesk model called while answering (fee summary,
+-- attendance, homework, exams). Each invocation is also in audit_logs.
+ALTER TABLE ai_helpdesk_answers ADD COLUMN IF NOT EXISTS tools_used TEXT[] NOT NULL DEFAULT '{}';
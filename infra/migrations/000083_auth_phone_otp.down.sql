@@ -0,0 +1,5 @@
+-- 000083_auth_phone_otp.down.sql
+
+DROP TABLE IF EXISTS auth_trusted_devices;
+DROP TABLE IF EXISTS auth_otp_challenges;
+DROP TABLE IF EXISTS guardian_phone_verifications;
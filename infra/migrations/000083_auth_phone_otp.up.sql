@@ -0,0 +1,53 @@
+-- 000083_auth_phone_otp.up.sql
+
+-- A guardian phone counts as verified only while phone_key still matches the
+-- guardian's current number.
+CREATE TABLE IF NOT EXISTS guardian_phone_verifications (
+    guardian_id UUID PRIMARY KEY REFERENCES guardians(id) ON DELETE CASCADE,
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    phone_key TEXT NOT NULL,
+    verified_via TEXT NOT NULL CHECK (verified_via IN ('otp', 'staff')),
+    verified_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    verified_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_guardian_phone_verifications_phone
+    ON guardian_phone_verifications(tenant_id, phone_key);
+
+CREATE TABLE IF NOT EXISTS auth_otp_challenges (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    guardian_id UUID NOT NULL REFERENCES guardians(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    purpose TEXT NOT NULL CHECK (purpose IN ('login', 'verify_phone')),
+    channel TEXT NOT NULL CHECK (channel IN ('sms', 'whatsapp')),
+    phone_key TEXT NOT NULL,
+    code_hash TEXT NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    max_attempts INT NOT NULL DEFAULT 5,
+    expires_at TIMESTAMPTZ NOT NULL,
+    consumed_at TIMESTAMPTZ,
+    ip_address TEXT,
+    user_agent TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_auth_otp_challenges_phone
+    ON auth_otp_challenges(tenant_id, phone_key, purpose, created_at DESC);
+
+CREATE TABLE IF NOT EXISTS auth_trusted_devices (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token_hash TEXT NOT NULL UNIQUE,
+    label TEXT,
+    ip_address TEXT,
+    user_agent TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_used_at TIMESTAMPTZ,
+    expires_at TIMESTAMPTZ NOT NULL,
+    revoked_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_auth_trusted_devices_user
+    ON auth_trusted_devices(user_id, created_at DESC);
@@ -0,0 +1,5 @@
+-- 000084_auth_sso.down.sql
+
+DROP TABLE IF EXISTS sso_login_requests;
+DROP TABLE IF EXISTS tenant_sso_settings;
+DROP TABLE IF EXISTS tenant_sso_providers;
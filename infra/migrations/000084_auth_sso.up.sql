@@ -0,0 +1,61 @@
+-- 000084_auth_sso.up.sql
+
+-- Per-tenant identity providers for staff single sign-on. Only the fields of the
+-- provider's protocol are populated; the OIDC client secret is stored encrypted.
+CREATE TABLE IF NOT EXISTS tenant_sso_providers (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    protocol TEXT NOT NULL CHECK (protocol IN ('oidc', 'saml')),
+    is_enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    oidc_issuer TEXT,
+    oidc_client_id TEXT,
+    oidc_client_secret_enc TEXT,
+    oidc_scopes TEXT[] NOT NULL DEFAULT ARRAY['openid', 'email', 'profile'],
+    saml_idp_entity_id TEXT,
+    saml_idp_sso_url TEXT,
+    saml_idp_certificate TEXT,
+    allowed_domains TEXT[] NOT NULL DEFAULT '{}',
+    groups_claim TEXT NOT NULL DEFAULT 'groups',
+    -- [{"group": "...", "role": "<role code>"}]
+    role_mappings JSONB NOT NULL DEFAULT '[]'::jsonb,
+    assume_email_verified BOOLEAN NOT NULL DEFAULT FALSE,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (tenant_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS tenant_sso_settings (
+    tenant_id UUID PRIMARY KEY REFERENCES tenants(id) ON DELETE CASCADE,
+    -- When set, staff must sign in through an enabled provider; parents and
+    -- students keep their existing login methods.
+    sso_only BOOLEAN NOT NULL DEFAULT FALSE,
+    updated_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- One row per SSO attempt. state_hash binds the IdP callback to the request and the
+-- ticket is a short-lived, single-use handle the frontend swaps for a session.
+CREATE TABLE IF NOT EXISTS sso_login_requests (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    provider_id UUID NOT NULL REFERENCES tenant_sso_providers(id) ON DELETE CASCADE,
+    state_hash TEXT NOT NULL UNIQUE,
+    nonce TEXT,
+    code_verifier TEXT,
+    saml_request_id TEXT,
+    redirect_path TEXT,
+    expires_at TIMESTAMPTZ NOT NULL,
+    completed_at TIMESTAMPTZ,
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    identity_id UUID REFERENCES user_identities(id) ON DELETE CASCADE,
+    ticket_hash TEXT UNIQUE,
+    ticket_expires_at TIMESTAMPTZ,
+    redeemed_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_sso_login_requests_saml
+    ON sso_login_requests(provider_id, saml_request_id)
+    WHERE saml_request_id IS NOT NULL;
@@ -0,0 +1,5 @@
+-- 000086_tenant_data_keys.down.sql
+
+ALTER TABLE student_health_records DROP COLUMN IF EXISTS encrypted_details;
+DROP TABLE IF EXISTS data_reencryption_jobs;
+DROP TABLE IF EXISTS tenant_data_keys;
@@ -0,0 +1,50 @@
+-- 000086_tenant_data_keys.up.sql
+
+-- Per-tenant data encryption keys. Each key is wrapped (AES-GCM) by a master
+-- key from DATA_ENCRYPTION_KEYS, identified by master_key_id (a prefix of the
+-- SHA-256 fingerprint shown when the master key was generated). Ciphertext
+-- carries the id of the data key that produced it. Destroying a tenant's keys
+-- clears wrapped_key, which makes every value encrypted under them unreadable.
+CREATE TABLE IF NOT EXISTS tenant_data_keys (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    version INTEGER NOT NULL,
+    status TEXT NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'retired', 'destroyed')),
+    master_key_id TEXT,
+    wrapped_key BYTEA,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    retired_at TIMESTAMPTZ,
+    destroyed_at TIMESTAMPTZ,
+    UNIQUE (tenant_id, version),
+    CHECK (status = 'destroyed' OR (wrapped_key IS NOT NULL AND master_key_id IS NOT NULL))
+);
+
+-- The newest active version encrypts. Rotation inserts the new version before
+-- retiring the old one, so two active rows can briefly coexist.
+CREATE INDEX IF NOT EXISTS idx_tenant_data_keys_tenant
+    ON tenant_data_keys(tenant_id, status, version DESC);
+
+-- Re-encryption runs queued by data_encryption secret rotations. A job waits
+-- until the API is deployed with target_master_key_id as its primary key.
+CREATE TABLE IF NOT EXISTS data_reencryption_jobs (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    rotation_request_id UUID REFERENCES platform_action_approvals(id) ON DELETE SET NULL,
+    target_master_key_id TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'waiting' CHECK (status IN ('waiting', 'running', 'completed', 'failed')),
+    keys_rotated INTEGER NOT NULL DEFAULT 0,
+    keys_rewrapped INTEGER NOT NULL DEFAULT 0,
+    values_reencrypted BIGINT NOT NULL DEFAULT 0,
+    failures INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    started_at TIMESTAMPTZ,
+    completed_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_data_reencryption_jobs_status
+    ON data_reencryption_jobs(status, created_at);
+
+-- Allergies, vaccinations and medical conditions move into one encrypted
+-- document; the plaintext columns are cleared as rows are rewritten.
+ALTER TABLE student_health_records ADD COLUMN IF NOT EXISTS encrypted_details TEXT;
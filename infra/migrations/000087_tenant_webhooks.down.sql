@@ -0,0 +1,5 @@
+-- 000087_tenant_webhooks.down.sql
+
+DROP TABLE IF EXISTS tenant_webhook_delivery_attempts;
+DROP TABLE IF EXISTS tenant_webhook_deliveries;
+DROP TABLE IF EXISTS tenant_webhook_subscriptions;
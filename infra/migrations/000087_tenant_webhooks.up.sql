@@ -0,0 +1,71 @@
+-- 000087_tenant_webhooks.up.sql
+
+-- Tenant-managed webhook endpoints subscribed to domain events from the outbox.
+-- The signing secret is stored encrypted with the tenant data key.
+CREATE TABLE IF NOT EXISTS tenant_webhook_subscriptions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    target_url TEXT NOT NULL,
+    secret_enc TEXT NOT NULL,
+    events TEXT[] NOT NULL DEFAULT '{}',
+    status TEXT NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'disabled')),
+    -- Failed attempts since the last success; the endpoint is disabled when it
+    -- reaches the dispatcher's threshold.
+    consecutive_failures INT NOT NULL DEFAULT 0,
+    disabled_reason TEXT,
+    disabled_at TIMESTAMPTZ,
+    last_success_at TIMESTAMPTZ,
+    last_failure_at TIMESTAMPTZ,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (tenant_id, name)
+);
+
+CREATE INDEX IF NOT EXISTS idx_tenant_webhook_subscriptions_active
+    ON tenant_webhook_subscriptions(tenant_id)
+    WHERE status = 'active';
+
+-- One row per event per endpoint. next_attempt_at doubles as the lease of an
+-- in-flight attempt so a crashed worker's delivery is picked up again.
+CREATE TABLE IF NOT EXISTS tenant_webhook_deliveries (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    subscription_id UUID NOT NULL REFERENCES tenant_webhook_subscriptions(id) ON DELETE CASCADE,
+    event_id UUID NOT NULL,
+    event_type TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'succeeded', 'dead')),
+    attempts INT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_response_status INT,
+    last_error TEXT,
+    delivered_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (subscription_id, event_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_tenant_webhook_deliveries_due
+    ON tenant_webhook_deliveries(next_attempt_at)
+    WHERE status = 'pending';
+
+CREATE INDEX IF NOT EXISTS idx_tenant_webhook_deliveries_subscription
+    ON tenant_webhook_deliveries(subscription_id, created_at DESC);
+
+-- Every HTTP attempt, kept for the per-endpoint delivery log.
+CREATE TABLE IF NOT EXISTS tenant_webhook_delivery_attempts (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    delivery_id UUID NOT NULL REFERENCES tenant_webhook_deliveries(id) ON DELETE CASCADE,
+    attempt INT NOT NULL,
+    response_status INT,
+    response_body TEXT,
+    error TEXT,
+    duration_ms INT NOT NULL DEFAULT 0,
+    manual BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_tenant_webhook_delivery_attempts_delivery
+    ON tenant_webhook_delivery_attempts(delivery_id, created_at);
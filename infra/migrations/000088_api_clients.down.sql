@@ -0,0 +1,4 @@
+-- 000088_api_clients.down.sql
+
+DROP TABLE IF EXISTS api_client_tokens;
+DROP TABLE IF EXISTS api_clients;
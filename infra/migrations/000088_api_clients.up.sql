@@ -0,0 +1,40 @@
+-- 000088_api_clients.up.sql
+
+-- Tenant-issued credentials for third-party integrations. Each client acts as
+-- its own service-account user so audit logs name the integration that made a
+-- change. Secrets and access tokens are stored as SHA-256 hashes only.
+CREATE TABLE IF NOT EXISTS api_clients (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    description TEXT,
+    client_id TEXT NOT NULL UNIQUE,
+    secret_hash TEXT NOT NULL,
+    secret_hint TEXT NOT NULL,
+    service_user_id UUID NOT NULL REFERENCES users(id),
+    scopes TEXT[] NOT NULL DEFAULT '{}',
+    rate_limit_per_minute INT NOT NULL DEFAULT 120 CHECK (rate_limit_per_minute > 0),
+    expires_at TIMESTAMPTZ,
+    last_used_at TIMESTAMPTZ,
+    last_used_ip TEXT,
+    revoked_at TIMESTAMPTZ,
+    revoked_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    revoke_reason TEXT,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (tenant_id, name)
+);
+
+-- Short-lived bearer tokens issued through the OAuth2 client-credentials grant.
+CREATE TABLE IF NOT EXISTS api_client_tokens (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    api_client_id UUID NOT NULL REFERENCES api_clients(id) ON DELETE CASCADE,
+    token_hash TEXT NOT NULL UNIQUE,
+    scopes TEXT[] NOT NULL DEFAULT '{}',
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_client_tokens_client
+    ON api_client_tokens(api_client_id, expires_at);
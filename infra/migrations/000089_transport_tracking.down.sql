@@ -0,0 +1,9 @@
+-- 000089_transport_tracking.down.sql
+
+DELETE FROM permissions WHERE code = 'transport:alerts';
+DROP TABLE IF EXISTS transport_trip_alerts;
+DROP TABLE IF EXISTS transport_trip_boardings;
+DROP TABLE IF EXISTS transport_gps_pings;
+DROP TABLE IF EXISTS transport_trip_stops;
+DROP TABLE IF EXISTS transport_trips;
+DROP TABLE IF EXISTS transport_tracking_settings;
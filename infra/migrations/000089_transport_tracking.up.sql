@@ -0,0 +1,114 @@
+-- 000089_transport_tracking.up.sql
+
+-- Per-tenant thresholds for live tracking. A tenant without a row uses the
+-- defaults below.
+CREATE TABLE IF NOT EXISTS transport_tracking_settings (
+    tenant_id UUID PRIMARY KEY REFERENCES tenants(id) ON DELETE CASCADE,
+    speed_limit_kmph INT NOT NULL DEFAULT 50 CHECK (speed_limit_kmph > 0),
+    deviation_threshold_m INT NOT NULL DEFAULT 300 CHECK (deviation_threshold_m > 0),
+    stop_radius_m INT NOT NULL DEFAULT 150 CHECK (stop_radius_m > 0),
+    arrival_notice_minutes INT NOT NULL DEFAULT 5 CHECK (arrival_notice_minutes > 0),
+    default_speed_kmph INT NOT NULL DEFAULT 25 CHECK (default_speed_kmph > 0),
+    alert_cooldown_minutes INT NOT NULL DEFAULT 10 CHECK (alert_cooldown_minutes >= 0),
+    updated_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- A run of a route in one direction. Pickup trips visit stops in sequence
+-- order, drop trips in reverse. The last accepted ping is kept on the trip.
+CREATE TABLE IF NOT EXISTS transport_trips (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    route_id UUID NOT NULL REFERENCES transport_routes(id) ON DELETE CASCADE,
+    vehicle_id UUID NOT NULL REFERENCES transport_vehicles(id),
+    driver_id UUID REFERENCES transport_drivers(id),
+    direction TEXT NOT NULL CHECK (direction IN ('pickup', 'drop')),
+    status TEXT NOT NULL DEFAULT 'in_progress' CHECK (status IN ('in_progress', 'completed', 'cancelled')),
+    started_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    ended_at TIMESTAMPTZ,
+    last_latitude DOUBLE PRECISION,
+    last_longitude DOUBLE PRECISION,
+    last_speed_kmph DOUBLE PRECISION,
+    last_heading DOUBLE PRECISION,
+    last_ping_at TIMESTAMPTZ,
+    started_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS uq_transport_trips_route_active
+    ON transport_trips (route_id) WHERE status = 'in_progress';
+CREATE UNIQUE INDEX IF NOT EXISTS uq_transport_trips_vehicle_active
+    ON transport_trips (vehicle_id) WHERE status = 'in_progress';
+CREATE INDEX IF NOT EXISTS idx_transport_trips_tenant_started
+    ON transport_trips (tenant_id, started_at DESC);
+
+-- Progress of a trip through its stops. Rows are created when the trip starts.
+CREATE TABLE IF NOT EXISTS transport_trip_stops (
+    trip_id UUID NOT NULL REFERENCES transport_trips(id) ON DELETE CASCADE,
+    stop_id UUID NOT NULL REFERENCES transport_route_stops(id) ON DELETE CASCADE,
+    visit_order INT NOT NULL,
+    arrived_at TIMESTAMPTZ,
+    departed_at TIMESTAMPTZ,
+    arrival_notified_at TIMESTAMPTZ,
+    PRIMARY KEY (trip_id, stop_id)
+);
+
+-- Raw positions from driver phones and AIS-140 devices. Pings outside a trip
+-- are kept for the vehicle's history.
+CREATE TABLE IF NOT EXISTS transport_gps_pings (
+    id BIGSERIAL PRIMARY KEY,
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    vehicle_id UUID NOT NULL REFERENCES transport_vehicles(id) ON DELETE CASCADE,
+    trip_id UUID REFERENCES transport_trips(id) ON DELETE SET NULL,
+    recorded_at TIMESTAMPTZ NOT NULL,
+    received_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    latitude DOUBLE PRECISION NOT NULL CHECK (latitude BETWEEN -90 AND 90),
+    longitude DOUBLE PRECISION NOT NULL CHECK (longitude BETWEEN -180 AND 180),
+    speed_kmph DOUBLE PRECISION,
+    heading DOUBLE PRECISION,
+    accuracy_m DOUBLE PRECISION,
+    source TEXT NOT NULL DEFAULT 'phone' CHECK (source IN ('phone', 'ais140'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_transport_gps_pings_trip
+    ON transport_gps_pings (trip_id, recorded_at) WHERE trip_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_transport_gps_pings_vehicle
+    ON transport_gps_pings (vehicle_id, recorded_at DESC);
+
+CREATE TABLE IF NOT EXISTS transport_trip_boardings (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    trip_id UUID NOT NULL REFERENCES transport_trips(id) ON DELETE CASCADE,
+    student_id UUID NOT NULL REFERENCES students(id) ON DELETE CASCADE,
+    stop_id UUID REFERENCES transport_route_stops(id) ON DELETE SET NULL,
+    boarded_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    latitude DOUBLE PRECISION,
+    longitude DOUBLE PRECISION,
+    recorded_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    UNIQUE (trip_id, student_id)
+);
+
+-- Overspeed and route-deviation alerts for the transport manager.
+CREATE TABLE IF NOT EXISTS transport_trip_alerts (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    trip_id UUID NOT NULL REFERENCES transport_trips(id) ON DELETE CASCADE,
+    alert_type TEXT NOT NULL CHECK (alert_type IN ('overspeed', 'route_deviation')),
+    observed_value DOUBLE PRECISION NOT NULL,
+    threshold_value DOUBLE PRECISION NOT NULL,
+    latitude DOUBLE PRECISION NOT NULL,
+    longitude DOUBLE PRECISION NOT NULL,
+    observed_at TIMESTAMPTZ NOT NULL,
+    acknowledged_at TIMESTAMPTZ,
+    acknowledged_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_transport_trip_alerts_trip
+    ON transport_trip_alerts (trip_id, alert_type, observed_at DESC);
+CREATE INDEX IF NOT EXISTS idx_transport_trip_alerts_open
+    ON transport_trip_alerts (tenant_id, created_at DESC) WHERE acknowledged_at IS NULL;
+
+INSERT INTO permissions (code, module, description) VALUES
+    ('transport:alerts', 'transport', 'Receive overspeed and route-deviation alerts')
+ON CONFLICT (code) DO NOTHING;
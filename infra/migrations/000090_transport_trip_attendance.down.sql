@@ -0,0 +1,38 @@
+-- 000090_transport_trip_attendance.down.sql
+
+DROP INDEX IF EXISTS uq_transport_trip_alerts_missed_drop;
+DELETE FROM transport_trip_alerts WHERE alert_type = 'missed_drop';
+ALTER TABLE transport_trip_alerts DROP COLUMN IF EXISTS student_id;
+ALTER TABLE transport_trip_alerts ALTER COLUMN observed_value SET NOT NULL;
+ALTER TABLE transport_trip_alerts ALTER COLUMN threshold_value SET NOT NULL;
+ALTER TABLE transport_trip_alerts ALTER COLUMN latitude SET NOT NULL;
+ALTER TABLE transport_trip_alerts ALTER COLUMN longitude SET NOT NULL;
+ALTER TABLE transport_trip_alerts DROP CONSTRAINT IF EXISTS transport_trip_alerts_alert_type_check;
+ALTER TABLE transport_trip_alerts ADD CONSTRAINT transport_trip_alerts_alert_type_check
+    CHECK (alert_type IN ('overspeed', 'route_deviation'));
+
+DELETE FROM transport_trip_boardings WHERE boarded_at IS NULL;
+ALTER TABLE transport_trip_boardings DROP COLUMN IF EXISTS alight_recorded_by;
+ALTER TABLE transport_trip_boardings DROP COLUMN IF EXISTS alight_method;
+ALTER TABLE transport_trip_boardings DROP COLUMN IF EXISTS alight_longitude;
+ALTER TABLE transport_trip_boardings DROP COLUMN IF EXISTS alight_latitude;
+ALTER TABLE transport_trip_boardings DROP COLUMN IF EXISTS alight_stop_id;
+ALTER TABLE transport_trip_boardings DROP COLUMN IF EXISTS alighted_at;
+ALTER TABLE transport_trip_boardings DROP COLUMN IF EXISTS board_method;
+ALTER TABLE transport_trip_boardings ALTER COLUMN boarded_at SET NOT NULL;
+
+DROP INDEX IF EXISTS uq_transport_vehicles_reader;
+ALTER TABLE transport_vehicles DROP COLUMN IF EXISTS rfid_reader_id;
+
+DROP INDEX IF EXISTS idx_transport_trips_tenant_date;
+DROP INDEX IF EXISTS uq_transport_trips_route_scheduled;
+DELETE FROM transport_trips WHERE status = 'scheduled';
+ALTER TABLE transport_trips DROP COLUMN IF EXISTS attendant_checked_in_at;
+ALTER TABLE transport_trips DROP COLUMN IF EXISTS driver_checked_in_at;
+ALTER TABLE transport_trips DROP COLUMN IF EXISTS attendant_id;
+ALTER TABLE transport_trips DROP CONSTRAINT IF EXISTS transport_trips_status_check;
+ALTER TABLE transport_trips ADD CONSTRAINT transport_trips_status_check
+    CHECK (status IN ('in_progress', 'completed', 'cancelled'));
+ALTER TABLE transport_trips ALTER COLUMN started_at SET DEFAULT NOW();
+ALTER TABLE transport_trips ALTER COLUMN started_at SET NOT NULL;
+ALTER TABLE transport_trips DROP COLUMN IF EXISTS trip_date;
@@ -0,0 +1,54 @@
+-- 000090_transport_trip_attendance.up.sql
+
+-- Trips are scheduled per route, day and direction ahead of time and started
+-- when the bus leaves. A scheduled trip has no start time yet.
+ALTER TABLE transport_trips ADD COLUMN IF NOT EXISTS trip_date DATE;
+UPDATE transport_trips SET trip_date = started_at::date WHERE trip_date IS NULL;
+ALTER TABLE transport_trips ALTER COLUMN trip_date SET DEFAULT CURRENT_DATE;
+ALTER TABLE transport_trips ALTER COLUMN trip_date SET NOT NULL;
+ALTER TABLE transport_trips ALTER COLUMN started_at DROP NOT NULL;
+ALTER TABLE transport_trips ALTER COLUMN started_at DROP DEFAULT;
+ALTER TABLE transport_trips DROP CONSTRAINT IF EXISTS transport_trips_status_check;
+ALTER TABLE transport_trips ADD CONSTRAINT transport_trips_status_check
+    CHECK (status IN ('scheduled', 'in_progress', 'completed', 'cancelled'));
+
+ALTER TABLE transport_trips ADD COLUMN IF NOT EXISTS attendant_id UUID REFERENCES employees(id) ON DELETE SET NULL;
+ALTER TABLE transport_trips ADD COLUMN IF NOT EXISTS driver_checked_in_at TIMESTAMPTZ;
+ALTER TABLE transport_trips ADD COLUMN IF NOT EXISTS attendant_checked_in_at TIMESTAMPTZ;
+
+CREATE UNIQUE INDEX IF NOT EXISTS uq_transport_trips_route_scheduled
+    ON transport_trips (route_id, trip_date, direction) WHERE status = 'scheduled';
+CREATE INDEX IF NOT EXISTS idx_transport_trips_tenant_date
+    ON transport_trips (tenant_id, trip_date, route_id);
+
+-- RFID readers fitted on buses post to the biometric ingest endpoint with
+-- their device id; the id ties the reader to its vehicle.
+ALTER TABLE transport_vehicles ADD COLUMN IF NOT EXISTS rfid_reader_id TEXT;
+CREATE UNIQUE INDEX IF NOT EXISTS uq_transport_vehicles_reader
+    ON transport_vehicles (tenant_id, rfid_reader_id) WHERE rfid_reader_id IS NOT NULL;
+
+-- A boarding row tracks a student through one trip. A student marked only on
+-- the way off has no boarded_at.
+ALTER TABLE transport_trip_boardings ALTER COLUMN boarded_at DROP NOT NULL;
+ALTER TABLE transport_trip_boardings ADD COLUMN IF NOT EXISTS board_method TEXT
+    CHECK (board_method IN ('manual', 'rfid', 'qr'));
+UPDATE transport_trip_boardings SET board_method = 'manual' WHERE board_method IS NULL AND boarded_at IS NOT NULL;
+ALTER TABLE transport_trip_boardings ADD COLUMN IF NOT EXISTS alighted_at TIMESTAMPTZ;
+ALTER TABLE transport_trip_boardings ADD COLUMN IF NOT EXISTS alight_stop_id UUID REFERENCES transport_route_stops(id) ON DELETE SET NULL;
+ALTER TABLE transport_trip_boardings ADD COLUMN IF NOT EXISTS alight_latitude DOUBLE PRECISION;
+ALTER TABLE transport_trip_boardings ADD COLUMN IF NOT EXISTS alight_longitude DOUBLE PRECISION;
+ALTER TABLE transport_trip_boardings ADD COLUMN IF NOT EXISTS alight_method TEXT
+    CHECK (alight_method IN ('manual', 'rfid', 'qr'));
+ALTER TABLE transport_trip_boardings ADD COLUMN IF NOT EXISTS alight_recorded_by UUID REFERENCES users(id) ON DELETE SET NULL;
+
+-- Missed-drop alerts name a student instead of a measurement.
+ALTER TABLE transport_trip_alerts DROP CONSTRAINT IF EXISTS transport_trip_alerts_alert_type_check;
+ALTER TABLE transport_trip_alerts ADD CONSTRAINT transport_trip_alerts_alert_type_check
+    CHECK (alert_type IN ('overspeed', 'route_deviation', 'missed_drop'));
+ALTER TABLE transport_trip_alerts ADD COLUMN IF NOT EXISTS student_id UUID REFERENCES students(id) ON DELETE CASCADE;
+ALTER TABLE transport_trip_alerts ALTER COLUMN observed_value DROP NOT NULL;
+ALTER TABLE transport_trip_alerts ALTER COLUMN threshold_value DROP NOT NULL;
+ALTER TABLE transport_trip_alerts ALTER COLUMN latitude DROP NOT NULL;
+ALTER TABLE transport_trip_alerts ALTER COLUMN longitude DROP NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS uq_transport_trip_alerts_missed_drop
+    ON transport_trip_alerts (trip_id, student_id) WHERE alert_type = 'missed_drop';
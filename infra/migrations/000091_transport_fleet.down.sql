@@ -0,0 +1,5 @@
+-- 000091_transport_fleet.down.sql
+
+DROP TABLE IF EXISTS transport_work_orders;
+DROP TABLE IF EXISTS transport_service_schedules;
+DROP TABLE IF EXISTS transport_compliance_documents;
@@ -0,0 +1,78 @@
+-- 000091_transport_fleet.up.sql
+
+-- Fitness, insurance, PUC and permit certificates of vehicles and driving
+-- licences of drivers. A renewal is a new row; the row with the latest
+-- expiry of a kind is the current one. last_reminder_stage records which
+-- expiry reminder was last sent for the row.
+CREATE TABLE IF NOT EXISTS transport_compliance_documents (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    vehicle_id UUID REFERENCES transport_vehicles(id) ON DELETE CASCADE,
+    driver_id UUID REFERENCES transport_drivers(id) ON DELETE CASCADE,
+    doc_type TEXT NOT NULL CHECK (doc_type IN ('fitness', 'insurance', 'puc', 'permit', 'licence')),
+    document_number TEXT,
+    issuer TEXT,
+    issued_on DATE,
+    expires_on DATE NOT NULL,
+    reminder_days INT NOT NULL DEFAULT 30 CHECK (reminder_days >= 0),
+    last_reminder_stage INT NOT NULL DEFAULT 0,
+    notes TEXT,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK (
+        (vehicle_id IS NOT NULL AND driver_id IS NULL AND doc_type <> 'licence')
+        OR (driver_id IS NOT NULL AND vehicle_id IS NULL AND doc_type = 'licence')
+    )
+);
+
+CREATE INDEX IF NOT EXISTS idx_transport_compliance_documents_vehicle
+    ON transport_compliance_documents (vehicle_id, doc_type, expires_on DESC) WHERE vehicle_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_transport_compliance_documents_driver
+    ON transport_compliance_documents (driver_id, expires_on DESC) WHERE driver_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_transport_compliance_documents_expiry
+    ON transport_compliance_documents (tenant_id, expires_on);
+
+-- Recurring services of a vehicle, due every interval_km kilometres or
+-- interval_days days from the last service, whichever comes first.
+CREATE TABLE IF NOT EXISTS transport_service_schedules (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    vehicle_id UUID NOT NULL REFERENCES transport_vehicles(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    interval_km INT CHECK (interval_km > 0),
+    interval_days INT CHECK (interval_days > 0),
+    last_service_km INT CHECK (last_service_km >= 0),
+    last_service_date DATE,
+    due_soon_km INT NOT NULL DEFAULT 500 CHECK (due_soon_km >= 0),
+    due_soon_days INT NOT NULL DEFAULT 7 CHECK (due_soon_days >= 0),
+    last_reminder_stage INT NOT NULL DEFAULT 0,
+    is_active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK (interval_km IS NOT NULL OR interval_days IS NOT NULL),
+    UNIQUE (vehicle_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS transport_work_orders (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    vehicle_id UUID NOT NULL REFERENCES transport_vehicles(id) ON DELETE CASCADE,
+    schedule_id UUID REFERENCES transport_service_schedules(id) ON DELETE SET NULL,
+    title TEXT NOT NULL,
+    description TEXT,
+    vendor TEXT,
+    status TEXT NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'in_progress', 'completed', 'cancelled')),
+    odometer_km INT CHECK (odometer_km >= 0),
+    labour_cost NUMERIC(12, 2) NOT NULL DEFAULT 0 CHECK (labour_cost >= 0),
+    parts_cost NUMERIC(12, 2) NOT NULL DEFAULT 0 CHECK (parts_cost >= 0),
+    opened_on DATE NOT NULL DEFAULT CURRENT_DATE,
+    completed_on DATE,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    completed_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_transport_work_orders_vehicle
+    ON transport_work_orders (tenant_id, vehicle_id, opened_on DESC);
@@ -0,0 +1,5 @@
+-- 000092_transport_route_planning.down.sql
+
+DROP TABLE IF EXISTS transport_route_plans;
+DROP TABLE IF EXISTS transport_pickup_points;
+DROP TABLE IF EXISTS transport_planning_settings;
@@ -0,0 +1,52 @@
+-- 000092_transport_route_planning.up.sql
+
+-- Where the route planner starts from: the school's location, when buses
+-- must arrive and how long a child may ride.
+CREATE TABLE IF NOT EXISTS transport_planning_settings (
+    tenant_id UUID PRIMARY KEY REFERENCES tenants(id) ON DELETE CASCADE,
+    school_latitude DOUBLE PRECISION CHECK (school_latitude BETWEEN -90 AND 90),
+    school_longitude DOUBLE PRECISION CHECK (school_longitude BETWEEN -180 AND 180),
+    arrive_by TIME NOT NULL DEFAULT '08:00',
+    max_ride_minutes INT NOT NULL DEFAULT 60 CHECK (max_ride_minutes > 0),
+    walk_radius_m INT NOT NULL DEFAULT 300 CHECK (walk_radius_m >= 0),
+    speed_kmph INT NOT NULL DEFAULT 25 CHECK (speed_kmph > 0),
+    updated_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- A student's geocoded pickup point, usually their home.
+CREATE TABLE IF NOT EXISTS transport_pickup_points (
+    student_id UUID PRIMARY KEY REFERENCES students(id) ON DELETE CASCADE,
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    latitude DOUBLE PRECISION NOT NULL CHECK (latitude BETWEEN -90 AND 90),
+    longitude DOUBLE PRECISION NOT NULL CHECK (longitude BETWEEN -180 AND 180),
+    address TEXT,
+    updated_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_transport_pickup_points_tenant
+    ON transport_pickup_points (tenant_id);
+
+-- Proposals from the route planner. A full plan lays out new routes for the
+-- chosen vehicles; a rebalance fits new students into running routes.
+-- Nothing changes until a draft is applied.
+CREATE TABLE IF NOT EXISTS transport_route_plans (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    kind TEXT NOT NULL CHECK (kind IN ('full', 'rebalance')),
+    status TEXT NOT NULL DEFAULT 'draft' CHECK (status IN ('draft', 'applied', 'discarded')),
+    options JSONB NOT NULL,
+    result JSONB NOT NULL,
+    student_count INT NOT NULL DEFAULT 0,
+    route_count INT NOT NULL DEFAULT 0,
+    unplanned_count INT NOT NULL DEFAULT 0,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    effective_date DATE,
+    applied_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    applied_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_transport_route_plans_tenant
+    ON transport_route_plans (tenant_id, created_at DESC);
@@ -0,0 +1,12 @@
+-- 000093_transport_fees.down.sql
+
+DROP TABLE IF EXISTS transport_fee_runs;
+DROP TABLE IF EXISTS transport_fee_terms;
+ALTER TABLE transport_allocations DROP COLUMN IF EXISTS trip_type;
+ALTER TABLE transport_route_stops
+    DROP COLUMN IF EXISTS distance_km,
+    DROP COLUMN IF EXISTS zone_id;
+DROP TABLE IF EXISTS transport_fare_zones;
+DROP TABLE IF EXISTS transport_fare_slabs;
+DROP TABLE IF EXISTS transport_fee_settings;
+DROP TABLE IF EXISTS student_fee_charges;
@@ -0,0 +1,107 @@
+-- 000093_transport_fees.up.sql
+
+-- Charges other modules raise on a student, such as a term's transport
+-- fare. Each is posted to the student's fee ledger as a fee plan of its own,
+-- so dues, reminders and receipts treat it like any other fee. The source
+-- key makes posting idempotent.
+CREATE TABLE IF NOT EXISTS student_fee_charges (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    student_id UUID NOT NULL REFERENCES students(id) ON DELETE CASCADE,
+    source TEXT NOT NULL,
+    source_key TEXT NOT NULL,
+    period TEXT,
+    fee_plan_id UUID NOT NULL REFERENCES fee_plans(id),
+    fee_head_id UUID NOT NULL REFERENCES fee_heads(id),
+    academic_year_id UUID REFERENCES academic_years(id),
+    description TEXT NOT NULL,
+    amount BIGINT NOT NULL CHECK (amount >= 0), -- in paise
+    due_date DATE,
+    status TEXT NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'cancelled')),
+    details JSONB NOT NULL DEFAULT '{}'::jsonb,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (tenant_id, source, source_key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_student_fee_charges_period
+    ON student_fee_charges (tenant_id, source, period);
+CREATE INDEX IF NOT EXISTS idx_student_fee_charges_student
+    ON student_fee_charges (student_id);
+
+-- How transport fares are worked out.
+CREATE TABLE IF NOT EXISTS transport_fee_settings (
+    tenant_id UUID PRIMARY KEY REFERENCES tenants(id) ON DELETE CASCADE,
+    fare_mode TEXT NOT NULL DEFAULT 'slab' CHECK (fare_mode IN ('slab', 'zone')),
+    proration TEXT NOT NULL DEFAULT 'monthly' CHECK (proration IN ('none', 'monthly', 'daily')),
+    fee_head_id UUID REFERENCES fee_heads(id) ON DELETE SET NULL,
+    updated_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Term fares by distance from the school; amounts in paise.
+CREATE TABLE IF NOT EXISTS transport_fare_slabs (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    from_km DOUBLE PRECISION NOT NULL CHECK (from_km >= 0),
+    to_km DOUBLE PRECISION CHECK (to_km > from_km),
+    one_way_amount BIGINT NOT NULL CHECK (one_way_amount >= 0),
+    two_way_amount BIGINT NOT NULL CHECK (two_way_amount >= 0),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_transport_fare_slabs_tenant
+    ON transport_fare_slabs (tenant_id, from_km);
+
+-- Term fares by zone; stops are put in a zone.
+CREATE TABLE IF NOT EXISTS transport_fare_zones (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    one_way_amount BIGINT NOT NULL CHECK (one_way_amount >= 0),
+    two_way_amount BIGINT NOT NULL CHECK (two_way_amount >= 0),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (tenant_id, name)
+);
+
+ALTER TABLE transport_route_stops
+    ADD COLUMN IF NOT EXISTS zone_id UUID REFERENCES transport_fare_zones(id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS distance_km DOUBLE PRECISION CHECK (distance_km >= 0);
+
+-- Whether the student rides both ways or only to or from school.
+ALTER TABLE transport_allocations
+    ADD COLUMN IF NOT EXISTS trip_type TEXT NOT NULL DEFAULT 'two_way'
+        CHECK (trip_type IN ('two_way', 'pickup', 'drop'));
+
+-- The billing terms transport fares are charged for.
+CREATE TABLE IF NOT EXISTS transport_fee_terms (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    academic_year_id UUID NOT NULL REFERENCES academic_years(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    start_date DATE NOT NULL,
+    end_date DATE NOT NULL,
+    due_date DATE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (tenant_id, academic_year_id, name),
+    CHECK (end_date >= start_date)
+);
+
+-- Each fee generation and what it did to each student.
+CREATE TABLE IF NOT EXISTS transport_fee_runs (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    term_id UUID NOT NULL REFERENCES transport_fee_terms(id) ON DELETE CASCADE,
+    created_count INT NOT NULL DEFAULT 0,
+    updated_count INT NOT NULL DEFAULT 0,
+    unchanged_count INT NOT NULL DEFAULT 0,
+    cancelled_count INT NOT NULL DEFAULT 0,
+    skipped_count INT NOT NULL DEFAULT 0,
+    report JSONB NOT NULL DEFAULT '[]'::jsonb,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_transport_fee_runs_term
+    ON transport_fee_runs (tenant_id, term_id, created_at DESC);
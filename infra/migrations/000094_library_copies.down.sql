@@ -0,0 +1,13 @@
+-- 000094_library_copies.down.sql
+
+DROP TABLE IF EXISTS library_reservations;
+DROP INDEX IF EXISTS idx_library_issues_employee;
+DROP INDEX IF EXISTS idx_library_issues_copy;
+ALTER TABLE library_issues
+    DROP COLUMN IF EXISTS last_renewed_at,
+    DROP COLUMN IF EXISTS renewal_count,
+    DROP COLUMN IF EXISTS employee_id,
+    DROP COLUMN IF EXISTS copy_id;
+DROP TABLE IF EXISTS library_member_policies;
+DROP TABLE IF EXISTS library_book_copies;
+DROP TABLE IF EXISTS library_settings;
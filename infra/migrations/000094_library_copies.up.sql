@@ -0,0 +1,133 @@
+-- 000094_library_copies.up.sql
+
+-- Per-school circulation settings. Accession numbers are the prefix
+-- followed by a running number.
+CREATE TABLE IF NOT EXISTS library_settings (
+    tenant_id UUID PRIMARY KEY REFERENCES tenants(id) ON DELETE CASCADE,
+    accession_prefix TEXT NOT NULL DEFAULT 'ACC',
+    next_accession BIGINT NOT NULL DEFAULT 1 CHECK (next_accession > 0),
+    hold_days INTEGER NOT NULL DEFAULT 3 CHECK (hold_days > 0),
+    updated_by UUID REFERENCES users(id),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Physical copies of a title. The counters on library_books are kept in
+-- step with these rows.
+CREATE TABLE IF NOT EXISTS library_book_copies (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    book_id UUID NOT NULL REFERENCES library_books(id) ON DELETE CASCADE,
+    accession_number TEXT NOT NULL,
+    barcode TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'available'
+        CHECK (status IN ('available', 'issued', 'on_hold', 'lost', 'damaged', 'withdrawn')),
+    shelf_location TEXT,
+    acquired_on DATE,
+    notes TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (tenant_id, accession_number),
+    UNIQUE (tenant_id, barcode)
+);
+
+CREATE INDEX IF NOT EXISTS idx_library_book_copies_book
+    ON library_book_copies (book_id, status);
+
+-- Loan length and limits by member type. A student policy may be narrowed
+-- to a class; the class policy wins over the general one.
+CREATE TABLE IF NOT EXISTS library_member_policies (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    member_type TEXT NOT NULL CHECK (member_type IN ('student', 'staff')),
+    class_id UUID REFERENCES classes(id) ON DELETE CASCADE,
+    loan_days INTEGER NOT NULL CHECK (loan_days > 0),
+    max_books INTEGER NOT NULL CHECK (max_books >= 0),
+    max_renewals INTEGER NOT NULL DEFAULT 0 CHECK (max_renewals >= 0),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK (member_type = 'student' OR class_id IS NULL)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_library_member_policies_scope
+    ON library_member_policies (tenant_id, member_type, COALESCE(class_id, '00000000-0000-0000-0000-000000000000'::uuid));
+
+ALTER TABLE library_issues
+    ADD COLUMN IF NOT EXISTS copy_id UUID REFERENCES library_book_copies(id),
+    ADD COLUMN IF NOT EXISTS employee_id UUID REFERENCES employees(id),
+    ADD COLUMN IF NOT EXISTS renewal_count INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS last_renewed_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_library_issues_copy ON library_issues (copy_id);
+CREATE INDEX IF NOT EXISTS idx_library_issues_employee ON library_issues (employee_id);
+
+-- Reservation queue per title. When a copy comes back it is held for the
+-- first waiting member until hold_until.
+CREATE TABLE IF NOT EXISTS library_reservations (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    book_id UUID NOT NULL REFERENCES library_books(id) ON DELETE CASCADE,
+    student_id UUID REFERENCES students(id) ON DELETE CASCADE,
+    employee_id UUID REFERENCES employees(id) ON DELETE CASCADE,
+    status TEXT NOT NULL DEFAULT 'waiting'
+        CHECK (status IN ('waiting', 'ready', 'fulfilled', 'cancelled', 'expired')),
+    copy_id UUID REFERENCES library_book_copies(id),
+    issue_id UUID REFERENCES library_issues(id),
+    ready_at TIMESTAMPTZ,
+    hold_until TIMESTAMPTZ,
+    created_by UUID REFERENCES users(id),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK ((student_id IS NULL) <> (employee_id IS NULL))
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_library_reservations_open
+    ON library_reservations (book_id, COALESCE(student_id, employee_id))
+    WHERE status IN ('waiting', 'ready');
+CREATE INDEX IF NOT EXISTS idx_library_reservations_queue
+    ON library_reservations (book_id, status, created_at);
+CREATE INDEX IF NOT EXISTS idx_library_reservations_hold
+    ON library_reservations (hold_until) WHERE status = 'ready';
+
+-- Give every existing title its copies, carrying the title barcode over to
+-- the first one, and attach open loans to them.
+INSERT INTO library_book_copies (tenant_id, book_id, accession_number, barcode, shelf_location)
+SELECT b.tenant_id, b.id,
+       'ACC' || lpad(row_number() OVER (PARTITION BY b.tenant_id ORDER BY b.created_at, b.id, g.n)::text, 6, '0'),
+       CASE WHEN g.n = 1 AND b.barcode IS NOT NULL THEN b.barcode
+            ELSE 'ACC' || lpad(row_number() OVER (PARTITION BY b.tenant_id ORDER BY b.created_at, b.id, g.n)::text, 6, '0') END,
+       b.shelf_location
+FROM library_books b
+CROSS JOIN LATERAL generate_series(1, GREATEST(b.total_copies, 1)) AS g(n)
+WHERE NOT EXISTS (SELECT 1 FROM library_book_copies c WHERE c.book_id = b.id);
+
+INSERT INTO library_settings (tenant_id, next_accession)
+SELECT tenant_id, COUNT(*) + 1 FROM library_book_copies GROUP BY tenant_id
+ON CONFLICT (tenant_id) DO NOTHING;
+
+WITH open_loans AS (
+    SELECT id, book_id, row_number() OVER (PARTITION BY book_id ORDER BY issue_date, id) AS rn
+    FROM library_issues
+    WHERE copy_id IS NULL AND status IN ('issued', 'overdue')
+), copies AS (
+    SELECT id, book_id, row_number() OVER (PARTITION BY book_id ORDER BY accession_number) AS rn
+    FROM library_book_copies
+)
+UPDATE library_issues i SET copy_id = c.id
+FROM open_loans l JOIN copies c ON c.book_id = l.book_id AND c.rn = l.rn
+WHERE i.id = l.id;
+
+UPDATE library_book_copies c SET status = 'issued'
+WHERE EXISTS (
+    SELECT 1 FROM library_issues i WHERE i.copy_id = c.id AND i.status IN ('issued', 'overdue')
+);
+
+UPDATE library_books b SET
+    total_copies = x.total,
+    available_copies = x.available
+FROM (
+    SELECT book_id,
+           COUNT(*) FILTER (WHERE status <> 'withdrawn') AS total,
+           COUNT(*) FILTER (WHERE status = 'available') AS available
+    FROM library_book_copies GROUP BY book_id
+) x
+WHERE x.book_id = b.id;
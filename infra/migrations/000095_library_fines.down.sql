@@ -0,0 +1,5 @@
+-- 000095_library_fines.down.sql
+
+DROP TABLE IF EXISTS library_fines;
+DROP TABLE IF EXISTS library_fine_policies;
+ALTER TABLE library_settings DROP COLUMN IF EXISTS fine_fee_head_id;
@@ -0,0 +1,69 @@
+-- 000095_library_fines.up.sql
+
+-- Fee head library fines are posted under on the student's fee ledger.
+ALTER TABLE library_settings
+    ADD COLUMN IF NOT EXISTS fine_fee_head_id UUID REFERENCES fee_heads(id) ON DELETE SET NULL;
+
+-- Fine rules by member type, optionally narrowed to a book category.
+-- Amounts are in paise; the lost and damage charges are a share of the
+-- book's price.
+CREATE TABLE IF NOT EXISTS library_fine_policies (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    member_type TEXT NOT NULL CHECK (member_type IN ('student', 'staff')),
+    category_id UUID REFERENCES library_categories(id) ON DELETE CASCADE,
+    per_day BIGINT NOT NULL CHECK (per_day >= 0),
+    grace_days INTEGER NOT NULL DEFAULT 0 CHECK (grace_days >= 0),
+    max_fine BIGINT CHECK (max_fine >= 0),
+    skip_holidays BOOLEAN NOT NULL DEFAULT TRUE,
+    skip_sundays BOOLEAN NOT NULL DEFAULT FALSE,
+    lost_percent INTEGER NOT NULL DEFAULT 100 CHECK (lost_percent >= 0),
+    lost_minimum BIGINT NOT NULL DEFAULT 0 CHECK (lost_minimum >= 0),
+    processing_fee BIGINT NOT NULL DEFAULT 0 CHECK (processing_fee >= 0),
+    damage_percent INTEGER NOT NULL DEFAULT 50 CHECK (damage_percent >= 0),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_library_fine_policies_scope
+    ON library_fine_policies (tenant_id, member_type, COALESCE(category_id, '00000000-0000-0000-0000-000000000000'::uuid));
+
+-- Charges raised on a loan. Student fines are collected by posting them to
+-- the fee ledger; staff fines are collected at the desk.
+CREATE TABLE IF NOT EXISTS library_fines (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    issue_id UUID NOT NULL REFERENCES library_issues(id) ON DELETE CASCADE,
+    student_id UUID REFERENCES students(id) ON DELETE CASCADE,
+    employee_id UUID REFERENCES employees(id) ON DELETE CASCADE,
+    kind TEXT NOT NULL CHECK (kind IN ('overdue', 'lost', 'damaged')),
+    amount BIGINT NOT NULL CHECK (amount > 0),
+    waived_amount BIGINT NOT NULL DEFAULT 0,
+    status TEXT NOT NULL DEFAULT 'open'
+        CHECK (status IN ('open', 'waiver_requested', 'posted', 'paid', 'waived')),
+    details JSONB NOT NULL DEFAULT '{}'::jsonb,
+    waiver_amount BIGINT,
+    waiver_reason TEXT,
+    waiver_request_id UUID REFERENCES approval_requests(id) ON DELETE SET NULL,
+    fee_charge_id UUID REFERENCES student_fee_charges(id) ON DELETE SET NULL,
+    posted_at TIMESTAMPTZ,
+    paid_at TIMESTAMPTZ,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK ((student_id IS NULL) <> (employee_id IS NULL)),
+    CHECK (waived_amount BETWEEN 0 AND amount),
+    UNIQUE (issue_id, kind)
+);
+
+CREATE INDEX IF NOT EXISTS idx_library_fines_status ON library_fines (tenant_id, status);
+CREATE INDEX IF NOT EXISTS idx_library_fines_student ON library_fines (student_id);
+CREATE INDEX IF NOT EXISTS idx_library_fines_employee ON library_fines (employee_id);
+
+-- Carry fines already recorded on returned loans over as open overdue fines.
+INSERT INTO library_fines (tenant_id, issue_id, student_id, employee_id, kind, amount)
+SELECT i.tenant_id, i.id, i.student_id, i.employee_id, 'overdue', ROUND(i.fine_amount * 100)::bigint
+FROM library_issues i
+WHERE i.fine_amount > 0
+  AND (i.student_id IS NULL) <> (i.employee_id IS NULL)
+ON CONFLICT (issue_id, kind) DO NOTHING;
@@ -0,0 +1,5 @@
+-- 000096_library_catalogue.down.sql
+
+DROP INDEX IF EXISTS idx_library_authors_name;
+DROP INDEX IF EXISTS idx_library_books_isbn_digits;
+DROP TABLE IF EXISTS library_isbn_cache;
@@ -0,0 +1,25 @@
+-- 000096_library_catalogue.up.sql
+
+-- Bibliographic records seen by the school, from imports and from
+-- external ISBN lookups, so a title is looked up online at most once.
+CREATE TABLE IF NOT EXISTS library_isbn_cache (
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    isbn TEXT NOT NULL CHECK (isbn ~ '^97[89][0-9]{10}$'),
+    title TEXT NOT NULL,
+    authors TEXT[] NOT NULL DEFAULT '{}',
+    publisher TEXT,
+    published_year INTEGER,
+    language TEXT,
+    subjects TEXT[] NOT NULL DEFAULT '{}',
+    source TEXT NOT NULL,
+    fetched_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (tenant_id, isbn)
+);
+
+-- ISBNs are stored as typed; duplicates are found on the digits alone.
+CREATE INDEX IF NOT EXISTS idx_library_books_isbn_digits
+    ON library_books (tenant_id, (regexp_replace(upper(isbn), '[^0-9X]', '', 'g')))
+    WHERE isbn IS NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_library_authors_name
+    ON library_authors (tenant_id, lower(name));
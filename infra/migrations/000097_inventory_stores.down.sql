@@ -0,0 +1,27 @@
+-- 000097_inventory_stores.down.sql
+
+DROP TABLE IF EXISTS inventory_stock_take_items;
+DROP TABLE IF EXISTS inventory_stock_takes;
+DROP TABLE IF EXISTS inventory_transfer_items;
+DROP TABLE IF EXISTS inventory_transfers;
+DROP TABLE IF EXISTS inventory_cost_layers;
+
+DROP INDEX IF EXISTS idx_inventory_transactions_tenant_date;
+DROP INDEX IF EXISTS idx_inventory_transactions_store;
+DELETE FROM inventory_transactions WHERE type IN ('transfer_out', 'transfer_in') OR reference_type = 'store_migration';
+ALTER TABLE inventory_transactions DROP CONSTRAINT IF EXISTS inventory_transactions_type_check;
+ALTER TABLE inventory_transactions ADD CONSTRAINT inventory_transactions_type_check
+    CHECK (type IN ('in', 'out', 'adjustment'));
+ALTER TABLE inventory_transactions
+    DROP COLUMN IF EXISTS stock_value,
+    DROP COLUMN IF EXISTS stock_delta,
+    DROP COLUMN IF EXISTS store_id;
+
+DROP INDEX IF EXISTS idx_inventory_stocks_store_item;
+ALTER TABLE inventory_stocks
+    DROP COLUMN IF EXISTS stock_value,
+    DROP COLUMN IF EXISTS store_id;
+
+ALTER TABLE inventory_items DROP COLUMN IF EXISTS valuation_method;
+
+DROP TABLE IF EXISTS inventory_stores;
@@ -0,0 +1,208 @@
+-- 000097_inventory_stores.up.sql
+
+-- Stores stock is kept in: the main store, labs, the sports room, stores on
+-- other campuses.
+CREATE TABLE IF NOT EXISTS inventory_stores (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    code TEXT,
+    campus TEXT,
+    description TEXT,
+    in_charge_id UUID REFERENCES users(id),
+    is_default BOOLEAN NOT NULL DEFAULT FALSE,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (tenant_id, name)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_inventory_stores_default
+    ON inventory_stores (tenant_id) WHERE is_default;
+
+-- Every location stock was kept at becomes a store, and every tenant with
+-- items gets a Main Store, which is the default.
+INSERT INTO inventory_stores (tenant_id, name)
+SELECT DISTINCT tenant_id, COALESCE(NULLIF(btrim(location), ''), 'Main Store') FROM inventory_stocks
+UNION
+SELECT DISTINCT tenant_id, 'Main Store' FROM inventory_items
+ON CONFLICT (tenant_id, name) DO NOTHING;
+
+UPDATE inventory_stores SET is_default = TRUE WHERE name = 'Main Store';
+
+-- Items are issued at FIFO or weighted-average cost.
+ALTER TABLE inventory_items
+    ADD COLUMN IF NOT EXISTS valuation_method TEXT NOT NULL DEFAULT 'weighted_average'
+        CHECK (valuation_method IN ('fifo', 'weighted_average'));
+
+-- Stock balances are kept per store, with their value.
+ALTER TABLE inventory_stocks
+    ADD COLUMN IF NOT EXISTS store_id UUID REFERENCES inventory_stores(id),
+    ADD COLUMN IF NOT EXISTS stock_value NUMERIC(14, 2) NOT NULL DEFAULT 0;
+
+UPDATE inventory_stocks s SET store_id = st.id
+FROM inventory_stores st
+WHERE st.tenant_id = s.tenant_id AND st.name = COALESCE(NULLIF(btrim(s.location), ''), 'Main Store');
+
+-- Rows without a location and rows for the Main Store are merged.
+WITH dup AS (
+    SELECT store_id, item_id, SUM(quantity) AS total, (array_agg(id ORDER BY created_at, id))[1] AS keep
+    FROM inventory_stocks GROUP BY store_id, item_id HAVING COUNT(*) > 1
+)
+UPDATE inventory_stocks s SET quantity = dup.total FROM dup WHERE s.id = dup.keep;
+
+WITH dup AS (
+    SELECT store_id, item_id, (array_agg(id ORDER BY created_at, id))[1] AS keep
+    FROM inventory_stocks GROUP BY store_id, item_id HAVING COUNT(*) > 1
+)
+DELETE FROM inventory_stocks s USING dup
+WHERE s.store_id = dup.store_id AND s.item_id = dup.item_id AND s.id <> dup.keep;
+
+UPDATE inventory_stocks s SET location = st.name FROM inventory_stores st WHERE st.id = s.store_id;
+
+ALTER TABLE inventory_stocks ALTER COLUMN store_id SET NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_inventory_stocks_store_item ON inventory_stocks (store_id, item_id);
+
+-- The transaction ledger records the store, the signed change in quantity
+-- and the value that moved, so stock and valuation can be worked out as of
+-- any date.
+ALTER TABLE inventory_transactions DROP CONSTRAINT IF EXISTS inventory_transactions_type_check;
+ALTER TABLE inventory_transactions ADD CONSTRAINT inventory_transactions_type_check
+    CHECK (type IN ('in', 'out', 'adjustment', 'transfer_out', 'transfer_in'));
+
+ALTER TABLE inventory_transactions
+    ADD COLUMN IF NOT EXISTS store_id UUID REFERENCES inventory_stores(id),
+    ADD COLUMN IF NOT EXISTS stock_delta INTEGER,
+    ADD COLUMN IF NOT EXISTS stock_value NUMERIC(14, 2) NOT NULL DEFAULT 0;
+
+-- Earlier transactions did not record where stock went; they are put in
+-- the default store and valued at the item's average purchase price.
+WITH cost AS (
+    SELECT item_id, COALESCE(SUM(quantity * unit_price) / NULLIF(SUM(quantity), 0), 0) AS price
+    FROM inventory_transactions
+    WHERE type IN ('in', 'adjustment') AND unit_price IS NOT NULL
+    GROUP BY item_id
+)
+UPDATE inventory_transactions t SET
+    store_id = (SELECT st.id FROM inventory_stores st WHERE st.tenant_id = t.tenant_id AND st.is_default),
+    stock_delta = CASE WHEN t.type = 'out' THEN -t.quantity ELSE t.quantity END,
+    stock_value = ROUND(CASE
+        WHEN t.type = 'out' THEN -t.quantity * COALESCE((SELECT price FROM cost WHERE cost.item_id = t.item_id), 0)
+        ELSE t.quantity * COALESCE(t.unit_price, (SELECT price FROM cost WHERE cost.item_id = t.item_id), 0)
+    END, 2)
+WHERE t.stock_delta IS NULL;
+
+WITH cost AS (
+    SELECT item_id, COALESCE(SUM(quantity * unit_price) / NULLIF(SUM(quantity), 0), 0) AS price
+    FROM inventory_transactions
+    WHERE type IN ('in', 'adjustment') AND unit_price IS NOT NULL
+    GROUP BY item_id
+)
+UPDATE inventory_stocks s SET stock_value = ROUND(s.quantity * cost.price, 2)
+FROM cost WHERE cost.item_id = s.item_id;
+
+-- Opening entries bring each store's ledger in line with its balance.
+INSERT INTO inventory_transactions (tenant_id, item_id, type, quantity, store_id, stock_delta, stock_value, reference_type, remarks)
+SELECT tenant_id, item_id, 'adjustment', ABS(diff), store_id, diff, value_diff, 'store_migration', 'Opening balance by store'
+FROM (
+    SELECT COALESCE(s.tenant_id, l.tenant_id) AS tenant_id, COALESCE(s.item_id, l.item_id) AS item_id,
+        COALESCE(s.store_id, l.store_id) AS store_id,
+        COALESCE(s.quantity, 0) - COALESCE(l.qty, 0) AS diff,
+        COALESCE(s.stock_value, 0) - COALESCE(l.value, 0) AS value_diff
+    FROM inventory_stocks s
+    FULL JOIN (
+        SELECT tenant_id, item_id, store_id, SUM(stock_delta) AS qty, SUM(stock_value) AS value
+        FROM inventory_transactions GROUP BY tenant_id, item_id, store_id
+    ) l ON l.store_id = s.store_id AND l.item_id = s.item_id
+) r
+WHERE diff <> 0 OR value_diff <> 0;
+
+ALTER TABLE inventory_transactions ALTER COLUMN store_id SET NOT NULL;
+ALTER TABLE inventory_transactions ALTER COLUMN stock_delta SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_inventory_transactions_store ON inventory_transactions (store_id, item_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_inventory_transactions_tenant_date ON inventory_transactions (tenant_id, created_at);
+
+-- Stock received into FIFO items, oldest first, with what is left of it.
+CREATE TABLE IF NOT EXISTS inventory_cost_layers (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    item_id UUID NOT NULL REFERENCES inventory_items(id) ON DELETE CASCADE,
+    store_id UUID NOT NULL REFERENCES inventory_stores(id),
+    transaction_id UUID REFERENCES inventory_transactions(id),
+    received_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    quantity INTEGER NOT NULL CHECK (quantity > 0),
+    remaining INTEGER NOT NULL CHECK (remaining >= 0),
+    unit_cost NUMERIC(12, 2) NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_inventory_cost_layers_open
+    ON inventory_cost_layers (store_id, item_id, received_at) WHERE remaining > 0;
+
+-- Transfers between stores: dispatched from one, received at the other.
+CREATE TABLE IF NOT EXISTS inventory_transfers (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    transfer_number TEXT NOT NULL,
+    from_store_id UUID NOT NULL REFERENCES inventory_stores(id),
+    to_store_id UUID NOT NULL REFERENCES inventory_stores(id),
+    status TEXT NOT NULL DEFAULT 'draft' CHECK (status IN ('draft', 'in_transit', 'received', 'cancelled')),
+    notes TEXT,
+    created_by UUID REFERENCES users(id),
+    dispatched_by UUID REFERENCES users(id),
+    dispatched_at TIMESTAMPTZ,
+    received_by UUID REFERENCES users(id),
+    received_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (tenant_id, transfer_number),
+    CHECK (from_store_id <> to_store_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_inventory_transfers_tenant ON inventory_transfers (tenant_id, status, created_at DESC);
+
+CREATE TABLE IF NOT EXISTS inventory_transfer_items (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    transfer_id UUID NOT NULL REFERENCES inventory_transfers(id) ON DELETE CASCADE,
+    item_id UUID NOT NULL REFERENCES inventory_items(id),
+    quantity INTEGER NOT NULL CHECK (quantity > 0),
+    value NUMERIC(14, 2) NOT NULL DEFAULT 0,
+    cost_layers JSONB NOT NULL DEFAULT '[]',
+    received_quantity INTEGER CHECK (received_quantity >= 0 AND received_quantity <= quantity),
+    received_value NUMERIC(14, 2),
+    remarks TEXT,
+    UNIQUE (transfer_id, item_id)
+);
+
+-- Stock-takes count a store against the balances taken when counting
+-- started; posting adjusts the store by the variances.
+CREATE TABLE IF NOT EXISTS inventory_stock_takes (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    store_id UUID NOT NULL REFERENCES inventory_stores(id),
+    status TEXT NOT NULL DEFAULT 'counting' CHECK (status IN ('counting', 'posted', 'cancelled')),
+    notes TEXT,
+    started_by UUID REFERENCES users(id),
+    posted_by UUID REFERENCES users(id),
+    posted_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_inventory_stock_takes_open
+    ON inventory_stock_takes (store_id) WHERE status = 'counting';
+
+CREATE TABLE IF NOT EXISTS inventory_stock_take_items (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    stock_take_id UUID NOT NULL REFERENCES inventory_stock_takes(id) ON DELETE CASCADE,
+    item_id UUID NOT NULL REFERENCES inventory_items(id),
+    system_quantity INTEGER NOT NULL,
+    system_value NUMERIC(14, 2) NOT NULL DEFAULT 0,
+    counted_quantity INTEGER CHECK (counted_quantity >= 0),
+    variance_value NUMERIC(14, 2),
+    reason TEXT,
+    counted_by UUID REFERENCES users(id),
+    counted_at TIMESTAMPTZ,
+    UNIQUE (stock_take_id, item_id)
+);
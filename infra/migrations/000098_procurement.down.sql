@@ -0,0 +1,27 @@
+-- 000098_procurement.down.sql
+
+DROP TABLE IF EXISTS supplier_invoice_items;
+DROP TABLE IF EXISTS supplier_invoices;
+DROP TABLE IF EXISTS purchase_receipt_items;
+DROP TABLE IF EXISTS purchase_receipts;
+
+ALTER TABLE purchase_order_items
+    DROP COLUMN IF EXISTS rejected_quantity,
+    ALTER COLUMN received_quantity DROP NOT NULL;
+
+ALTER TABLE purchase_orders
+    DROP COLUMN IF EXISTS auto_generated,
+    DROP COLUMN IF EXISTS expected_date,
+    DROP COLUMN IF EXISTS store_id;
+
+UPDATE purchase_orders SET status = 'approved' WHERE status = 'partially_received';
+UPDATE purchase_orders SET status = 'received' WHERE status = 'closed';
+ALTER TABLE purchase_orders DROP CONSTRAINT IF EXISTS purchase_orders_status_check;
+ALTER TABLE purchase_orders ADD CONSTRAINT purchase_orders_status_check
+    CHECK (status IN ('draft', 'submitted', 'approved', 'received', 'cancelled'));
+
+DROP TABLE IF EXISTS procurement_settings;
+
+ALTER TABLE inventory_items
+    DROP COLUMN IF EXISTS preferred_supplier_id,
+    DROP COLUMN IF EXISTS reorder_quantity;
@@ -0,0 +1,102 @@
+-- 000098_procurement.up.sql
+
+-- Items are reordered from their preferred supplier when stock on hand and
+-- on order falls to the reorder level.
+ALTER TABLE inventory_items
+    ADD COLUMN IF NOT EXISTS reorder_quantity INTEGER CHECK (reorder_quantity > 0),
+    ADD COLUMN IF NOT EXISTS preferred_supplier_id UUID REFERENCES inventory_suppliers(id) ON DELETE SET NULL;
+
+-- Per-school purchasing settings: whether reorders are drafted on their own
+-- and how far an invoice may differ from the order and the goods received.
+CREATE TABLE IF NOT EXISTS procurement_settings (
+    tenant_id UUID PRIMARY KEY REFERENCES tenants(id) ON DELETE CASCADE,
+    auto_reorder BOOLEAN NOT NULL DEFAULT FALSE,
+    quantity_tolerance_pct NUMERIC(5, 2) NOT NULL DEFAULT 0 CHECK (quantity_tolerance_pct >= 0),
+    price_tolerance_pct NUMERIC(5, 2) NOT NULL DEFAULT 2 CHECK (price_tolerance_pct >= 0),
+    amount_tolerance NUMERIC(12, 2) NOT NULL DEFAULT 0 CHECK (amount_tolerance >= 0),
+    updated_by UUID REFERENCES users(id),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Orders can be received in parts, and closed short when the rest will not
+-- come.
+ALTER TABLE purchase_orders DROP CONSTRAINT IF EXISTS purchase_orders_status_check;
+ALTER TABLE purchase_orders ADD CONSTRAINT purchase_orders_status_check
+    CHECK (status IN ('draft', 'submitted', 'approved', 'partially_received', 'received', 'closed', 'cancelled'));
+
+ALTER TABLE purchase_orders
+    ADD COLUMN IF NOT EXISTS store_id UUID REFERENCES inventory_stores(id),
+    ADD COLUMN IF NOT EXISTS expected_date DATE,
+    ADD COLUMN IF NOT EXISTS auto_generated BOOLEAN NOT NULL DEFAULT FALSE;
+
+UPDATE purchase_order_items SET received_quantity = 0 WHERE received_quantity IS NULL;
+ALTER TABLE purchase_order_items
+    ALTER COLUMN received_quantity SET NOT NULL,
+    ADD COLUMN IF NOT EXISTS rejected_quantity INTEGER NOT NULL DEFAULT 0 CHECK (rejected_quantity >= 0);
+
+-- Goods receipts: each delivery against an order, with what was accepted
+-- into stock and what was sent back.
+CREATE TABLE IF NOT EXISTS purchase_receipts (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    po_id UUID NOT NULL REFERENCES purchase_orders(id) ON DELETE CASCADE,
+    receipt_number TEXT NOT NULL,
+    store_id UUID NOT NULL REFERENCES inventory_stores(id),
+    notes TEXT,
+    received_by UUID REFERENCES users(id),
+    received_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (tenant_id, receipt_number)
+);
+
+CREATE INDEX IF NOT EXISTS idx_purchase_receipts_po ON purchase_receipts (po_id, received_at);
+
+CREATE TABLE IF NOT EXISTS purchase_receipt_items (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    receipt_id UUID NOT NULL REFERENCES purchase_receipts(id) ON DELETE CASCADE,
+    po_item_id UUID NOT NULL REFERENCES purchase_order_items(id) ON DELETE CASCADE,
+    item_id UUID NOT NULL REFERENCES inventory_items(id),
+    delivered_quantity INTEGER NOT NULL CHECK (delivered_quantity > 0),
+    rejected_quantity INTEGER NOT NULL DEFAULT 0 CHECK (rejected_quantity >= 0 AND rejected_quantity <= delivered_quantity),
+    rejection_reason TEXT,
+    transaction_id UUID REFERENCES inventory_transactions(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_purchase_receipt_items_po_item ON purchase_receipt_items (po_item_id);
+
+-- Supplier invoices, matched against the order and the goods received.
+CREATE TABLE IF NOT EXISTS supplier_invoices (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    supplier_id UUID NOT NULL REFERENCES inventory_suppliers(id),
+    po_id UUID NOT NULL REFERENCES purchase_orders(id),
+    invoice_number TEXT NOT NULL,
+    invoice_date DATE NOT NULL,
+    subtotal NUMERIC(12, 2) NOT NULL DEFAULT 0,
+    tax_amount NUMERIC(12, 2) NOT NULL DEFAULT 0,
+    total_amount NUMERIC(12, 2) NOT NULL DEFAULT 0,
+    status TEXT NOT NULL CHECK (status IN ('matched', 'exception', 'approved', 'rejected')),
+    exceptions JSONB NOT NULL DEFAULT '[]',
+    notes TEXT,
+    created_by UUID REFERENCES users(id),
+    decided_by UUID REFERENCES users(id),
+    decided_at TIMESTAMPTZ,
+    decision_reason TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (tenant_id, supplier_id, invoice_number)
+);
+
+CREATE INDEX IF NOT EXISTS idx_supplier_invoices_po ON supplier_invoices (po_id);
+CREATE INDEX IF NOT EXISTS idx_supplier_invoices_tenant ON supplier_invoices (tenant_id, status, invoice_date DESC);
+
+CREATE TABLE IF NOT EXISTS supplier_invoice_items (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    invoice_id UUID NOT NULL REFERENCES supplier_invoices(id) ON DELETE CASCADE,
+    po_item_id UUID NOT NULL REFERENCES purchase_order_items(id),
+    item_id UUID NOT NULL REFERENCES inventory_items(id),
+    quantity INTEGER NOT NULL CHECK (quantity > 0),
+    unit_price NUMERIC(12, 2) NOT NULL CHECK (unit_price >= 0),
+    UNIQUE (invoice_id, po_item_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_supplier_invoice_items_po_item ON supplier_invoice_items (po_item_id);
@@ -0,0 +1,15 @@
+-- 000099_fixed_assets.down.sql
+
+DROP TABLE IF EXISTS fixed_asset_verification_items;
+DROP TABLE IF EXISTS fixed_asset_verifications;
+DROP TABLE IF EXISTS fixed_asset_disposals;
+DROP TABLE IF EXISTS fixed_asset_depreciation;
+DROP TABLE IF EXISTS fixed_asset_contracts;
+DROP TABLE IF EXISTS fixed_asset_movements;
+DROP TABLE IF EXISTS fixed_assets;
+
+ALTER TABLE inventory_items
+    DROP COLUMN IF EXISTS residual_pct,
+    DROP COLUMN IF EXISTS depreciation_rate_pct,
+    DROP COLUMN IF EXISTS useful_life_months,
+    DROP COLUMN IF EXISTS depreciation_method;
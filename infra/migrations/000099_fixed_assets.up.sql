@@ -0,0 +1,155 @@
+-- 000099_fixed_assets.up.sql
+
+-- Items in asset categories carry the depreciation defaults for the assets
+-- registered against them.
+ALTER TABLE inventory_items
+    ADD COLUMN IF NOT EXISTS depreciation_method TEXT CHECK (depreciation_method IN ('straight_line', 'wdv')),
+    ADD COLUMN IF NOT EXISTS useful_life_months INTEGER CHECK (useful_life_months > 0),
+    ADD COLUMN IF NOT EXISTS depreciation_rate_pct NUMERIC(5, 2) CHECK (depreciation_rate_pct > 0 AND depreciation_rate_pct < 100),
+    ADD COLUMN IF NOT EXISTS residual_pct NUMERIC(5, 2) CHECK (residual_pct >= 0 AND residual_pct < 100);
+
+-- The register: one row per physical asset, tagged, with where it is and
+-- who answers for it.
+CREATE TABLE IF NOT EXISTS fixed_assets (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    item_id UUID NOT NULL REFERENCES inventory_items(id),
+    asset_tag TEXT NOT NULL,
+    name TEXT NOT NULL,
+    serial_number TEXT,
+    description TEXT,
+    room TEXT,
+    custodian_id UUID REFERENCES employees(id),
+    supplier_id UUID REFERENCES inventory_suppliers(id),
+    po_id UUID REFERENCES purchase_orders(id),
+    purchase_date DATE NOT NULL,
+    in_service_date DATE NOT NULL,
+    cost NUMERIC(12, 2) NOT NULL CHECK (cost >= 0),
+    residual_value NUMERIC(12, 2) NOT NULL DEFAULT 0 CHECK (residual_value >= 0 AND residual_value <= cost),
+    depreciation_method TEXT NOT NULL CHECK (depreciation_method IN ('straight_line', 'wdv')),
+    useful_life_months INTEGER CHECK (useful_life_months > 0),
+    depreciation_rate_pct NUMERIC(5, 2) CHECK (depreciation_rate_pct > 0 AND depreciation_rate_pct < 100),
+    accumulated_depreciation NUMERIC(12, 2) NOT NULL DEFAULT 0,
+    status TEXT NOT NULL DEFAULT 'in_use' CHECK (status IN ('in_use', 'in_store', 'under_repair', 'missing', 'disposed')),
+    last_verified_on DATE,
+    disposed_on DATE,
+    created_by UUID REFERENCES users(id),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (tenant_id, asset_tag),
+    CHECK (depreciation_method <> 'straight_line' OR useful_life_months IS NOT NULL),
+    CHECK (depreciation_method <> 'wdv' OR depreciation_rate_pct IS NOT NULL),
+    CHECK (in_service_date >= purchase_date)
+);
+
+CREATE INDEX IF NOT EXISTS idx_fixed_assets_tenant ON fixed_assets (tenant_id, status);
+CREATE INDEX IF NOT EXISTS idx_fixed_assets_item ON fixed_assets (item_id);
+CREATE INDEX IF NOT EXISTS idx_fixed_assets_custodian ON fixed_assets (custodian_id) WHERE custodian_id IS NOT NULL;
+
+-- Every change of room, custodian or status, starting with registration.
+CREATE TABLE IF NOT EXISTS fixed_asset_movements (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    asset_id UUID NOT NULL REFERENCES fixed_assets(id) ON DELETE CASCADE,
+    from_room TEXT,
+    to_room TEXT,
+    from_custodian_id UUID REFERENCES employees(id),
+    to_custodian_id UUID REFERENCES employees(id),
+    from_status TEXT,
+    to_status TEXT NOT NULL,
+    reason TEXT,
+    moved_by UUID REFERENCES users(id),
+    moved_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_fixed_asset_movements_asset ON fixed_asset_movements (asset_id, moved_at);
+
+-- Warranties and annual maintenance contracts.
+CREATE TABLE IF NOT EXISTS fixed_asset_contracts (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    asset_id UUID NOT NULL REFERENCES fixed_assets(id) ON DELETE CASCADE,
+    kind TEXT NOT NULL CHECK (kind IN ('warranty', 'amc')),
+    provider TEXT NOT NULL,
+    reference TEXT,
+    starts_on DATE NOT NULL,
+    ends_on DATE NOT NULL,
+    cost NUMERIC(12, 2) NOT NULL DEFAULT 0 CHECK (cost >= 0),
+    coverage TEXT,
+    created_by UUID REFERENCES users(id),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK (ends_on >= starts_on)
+);
+
+CREATE INDEX IF NOT EXISTS idx_fixed_asset_contracts_asset ON fixed_asset_contracts (asset_id, ends_on);
+CREATE INDEX IF NOT EXISTS idx_fixed_asset_contracts_expiry ON fixed_asset_contracts (tenant_id, ends_on);
+
+-- Depreciation charged per financial year (April to March), identified by
+-- the year it starts in.
+CREATE TABLE IF NOT EXISTS fixed_asset_depreciation (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    asset_id UUID NOT NULL REFERENCES fixed_assets(id) ON DELETE CASCADE,
+    financial_year INTEGER NOT NULL,
+    period_start DATE NOT NULL,
+    period_end DATE NOT NULL,
+    opening_value NUMERIC(12, 2) NOT NULL,
+    amount NUMERIC(12, 2) NOT NULL CHECK (amount >= 0),
+    closing_value NUMERIC(12, 2) NOT NULL,
+    posted_by UUID REFERENCES users(id),
+    posted_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (asset_id, financial_year)
+);
+
+CREATE INDEX IF NOT EXISTS idx_fixed_asset_depreciation_tenant ON fixed_asset_depreciation (tenant_id, financial_year);
+
+-- Disposal and write-off go through the approvals inbox.
+CREATE TABLE IF NOT EXISTS fixed_asset_disposals (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    asset_id UUID NOT NULL REFERENCES fixed_assets(id) ON DELETE CASCADE,
+    method TEXT NOT NULL CHECK (method IN ('sale', 'scrap', 'donation', 'write_off')),
+    disposal_date DATE NOT NULL,
+    proceeds NUMERIC(12, 2) NOT NULL DEFAULT 0 CHECK (proceeds >= 0),
+    book_value NUMERIC(12, 2) NOT NULL,
+    reason TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'approved', 'rejected')),
+    approval_request_id UUID REFERENCES approval_requests(id),
+    requested_by UUID REFERENCES users(id),
+    requested_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    decided_by UUID REFERENCES users(id),
+    decided_at TIMESTAMPTZ,
+    remark TEXT
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS uq_fixed_asset_disposals_pending ON fixed_asset_disposals (asset_id) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_fixed_asset_disposals_tenant ON fixed_asset_disposals (tenant_id, status);
+
+-- Yearly physical verification: every asset on the register when the
+-- round starts is checked off as found, damaged or missing.
+CREATE TABLE IF NOT EXISTS fixed_asset_verifications (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    financial_year INTEGER NOT NULL,
+    title TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'closed')),
+    notes TEXT,
+    started_by UUID REFERENCES users(id),
+    started_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    closed_by UUID REFERENCES users(id),
+    closed_at TIMESTAMPTZ,
+    UNIQUE (tenant_id, financial_year)
+);
+
+CREATE TABLE IF NOT EXISTS fixed_asset_verification_items (
+    verification_id UUID NOT NULL REFERENCES fixed_asset_verifications(id) ON DELETE CASCADE,
+    asset_id UUID NOT NULL REFERENCES fixed_assets(id) ON DELETE CASCADE,
+    expected_room TEXT,
+    expected_custodian_id UUID REFERENCES employees(id),
+    result TEXT NOT NULL DEFAULT 'pending' CHECK (result IN ('pending', 'found', 'damaged', 'missing')),
+    found_room TEXT,
+    remarks TEXT,
+    verified_by UUID REFERENCES users(id),
+    verified_at TIMESTAMPTZ,
+    PRIMARY KEY (verification_id, asset_id)
+);
@@ -0,0 +1,24 @@
+-- 000100_hostel_operations.down.sql
+
+DROP TABLE IF EXISTS hostel_fee_runs;
+DROP TABLE IF EXISTS hostel_fee_terms;
+DROP TABLE IF EXISTS hostel_fee_settings;
+DROP TABLE IF EXISTS hostel_meal_opt_outs;
+DROP TABLE IF EXISTS hostel_mess_menus;
+DROP TABLE IF EXISTS hostel_roll_call_entries;
+DROP TABLE IF EXISTS hostel_roll_calls;
+DROP TABLE IF EXISTS hostel_leave_requests;
+
+DROP INDEX IF EXISTS idx_hostel_allocations_dates;
+DROP INDEX IF EXISTS idx_hostel_allocations_one_per_bed;
+DROP INDEX IF EXISTS idx_hostel_allocations_one_per_student;
+
+ALTER TABLE hostel_allocations
+    DROP COLUMN IF EXISTS allotted_by,
+    DROP COLUMN IF EXISTS bed_id,
+    DROP COLUMN IF EXISTS tenant_id;
+
+DROP TABLE IF EXISTS hostel_beds;
+
+DROP INDEX IF EXISTS idx_hostel_rooms_tenant;
+ALTER TABLE hostel_rooms DROP COLUMN IF EXISTS tenant_id;
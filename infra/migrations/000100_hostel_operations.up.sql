@@ -0,0 +1,205 @@
+-- 000100_hostel_operations.up.sql
+
+-- Rooms and allocations only reached their tenant through the building.
+ALTER TABLE hostel_rooms ADD COLUMN IF NOT EXISTS tenant_id UUID REFERENCES tenants(id) ON DELETE CASCADE;
+UPDATE hostel_rooms r SET tenant_id = b.tenant_id
+FROM hostel_buildings b WHERE b.id = r.building_id AND r.tenant_id IS NULL;
+ALTER TABLE hostel_rooms ALTER COLUMN tenant_id SET NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_hostel_rooms_tenant ON hostel_rooms (tenant_id, building_id);
+
+-- Beds are what a student is allotted; a room's capacity is its bed count.
+CREATE TABLE IF NOT EXISTS hostel_beds (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    room_id UUID NOT NULL REFERENCES hostel_rooms(id) ON DELETE CASCADE,
+    label TEXT NOT NULL,
+    is_active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (room_id, label)
+);
+
+INSERT INTO hostel_beds (tenant_id, room_id, label)
+SELECT r.tenant_id, r.id, 'B' || g
+FROM hostel_rooms r, generate_series(1, GREATEST(r.capacity, 0)) g
+ON CONFLICT (room_id, label) DO NOTHING;
+
+ALTER TABLE hostel_allocations
+    ADD COLUMN IF NOT EXISTS tenant_id UUID REFERENCES tenants(id) ON DELETE CASCADE,
+    ADD COLUMN IF NOT EXISTS bed_id UUID REFERENCES hostel_beds(id),
+    ADD COLUMN IF NOT EXISTS allotted_by UUID REFERENCES users(id) ON DELETE SET NULL;
+UPDATE hostel_allocations a SET tenant_id = r.tenant_id
+FROM hostel_rooms r WHERE r.id = a.room_id AND a.tenant_id IS NULL;
+ALTER TABLE hostel_allocations ALTER COLUMN tenant_id SET NOT NULL;
+
+-- Concurrent allocations could leave a student in two rooms; keep the
+-- latest.
+UPDATE hostel_allocations a
+SET status = 'vacated', vacated_on = CURRENT_DATE,
+    remarks = COALESCE(a.remarks || ' ', '') || '(duplicate allocation closed)'
+WHERE a.status = 'active' AND EXISTS (
+    SELECT 1 FROM hostel_allocations n
+    WHERE n.student_id = a.student_id AND n.status = 'active'
+      AND (n.created_at, n.id) > (a.created_at, a.id)
+);
+
+-- Seat existing residents on the room's beds in allotment order. Rooms that
+-- were overfilled leave the extra residents without a bed.
+WITH residents AS (
+    SELECT id, room_id, row_number() OVER (PARTITION BY room_id ORDER BY allotted_on, created_at, id) AS n
+    FROM hostel_allocations WHERE status = 'active' AND bed_id IS NULL
+), beds AS (
+    SELECT id, room_id, row_number() OVER (PARTITION BY room_id ORDER BY length(label), label) AS n
+    FROM hostel_beds
+)
+UPDATE hostel_allocations a SET bed_id = beds.id
+FROM residents JOIN beds ON beds.room_id = residents.room_id AND beds.n = residents.n
+WHERE a.id = residents.id;
+
+UPDATE hostel_rooms r SET occupancy = (
+    SELECT COUNT(*) FROM hostel_allocations a WHERE a.room_id = r.id AND a.status = 'active'
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_hostel_allocations_one_per_student
+    ON hostel_allocations (tenant_id, student_id) WHERE status = 'active';
+CREATE UNIQUE INDEX IF NOT EXISTS idx_hostel_allocations_one_per_bed
+    ON hostel_allocations (bed_id) WHERE status = 'active';
+CREATE INDEX IF NOT EXISTS idx_hostel_allocations_dates
+    ON hostel_allocations (tenant_id, allotted_on, vacated_on);
+
+-- Leave and outings. An approved request issues a gate pass for the time
+-- the student is away.
+CREATE TABLE IF NOT EXISTS hostel_leave_requests (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    student_id UUID NOT NULL REFERENCES students(id) ON DELETE CASCADE,
+    allocation_id UUID NOT NULL REFERENCES hostel_allocations(id) ON DELETE CASCADE,
+    kind TEXT NOT NULL CHECK (kind IN ('leave', 'outing')),
+    reason TEXT NOT NULL,
+    destination TEXT,
+    escort_name TEXT,
+    escort_phone TEXT,
+    departs_at TIMESTAMPTZ NOT NULL,
+    returns_at TIMESTAMPTZ NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'approved', 'rejected', 'cancelled', 'out', 'returned')),
+    requested_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    decided_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    decided_at TIMESTAMPTZ,
+    decision_remark TEXT,
+    gate_pass_id UUID REFERENCES gate_passes(id) ON DELETE SET NULL,
+    checked_out_at TIMESTAMPTZ,
+    returned_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK (returns_at > departs_at)
+);
+
+CREATE INDEX IF NOT EXISTS idx_hostel_leave_requests_student
+    ON hostel_leave_requests (tenant_id, student_id, departs_at DESC);
+CREATE INDEX IF NOT EXISTS idx_hostel_leave_requests_status
+    ON hostel_leave_requests (tenant_id, status, departs_at);
+
+-- Nightly roll-call, one per building per night.
+CREATE TABLE IF NOT EXISTS hostel_roll_calls (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    building_id UUID NOT NULL REFERENCES hostel_buildings(id) ON DELETE CASCADE,
+    call_date DATE NOT NULL,
+    notes TEXT,
+    taken_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    taken_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (building_id, call_date)
+);
+
+CREATE TABLE IF NOT EXISTS hostel_roll_call_entries (
+    roll_call_id UUID NOT NULL REFERENCES hostel_roll_calls(id) ON DELETE CASCADE,
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    student_id UUID NOT NULL REFERENCES students(id) ON DELETE CASCADE,
+    allocation_id UUID REFERENCES hostel_allocations(id) ON DELETE SET NULL,
+    status TEXT NOT NULL CHECK (status IN ('present', 'absent', 'on_leave')),
+    leave_id UUID REFERENCES hostel_leave_requests(id) ON DELETE SET NULL,
+    remarks TEXT,
+    marked_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (roll_call_id, student_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_hostel_roll_call_entries_student
+    ON hostel_roll_call_entries (tenant_id, student_id);
+
+-- Mess menu by date and meal.
+CREATE TABLE IF NOT EXISTS hostel_mess_menus (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    menu_date DATE NOT NULL,
+    meal TEXT NOT NULL CHECK (meal IN ('breakfast', 'lunch', 'snacks', 'dinner')),
+    items TEXT NOT NULL,
+    notes TEXT,
+    updated_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (tenant_id, menu_date, meal)
+);
+
+-- Meals a resident will not take. Approved leave opts the student out of
+-- the whole days away.
+CREATE TABLE IF NOT EXISTS hostel_meal_opt_outs (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    student_id UUID NOT NULL REFERENCES students(id) ON DELETE CASCADE,
+    from_date DATE NOT NULL,
+    to_date DATE NOT NULL,
+    meals TEXT[] NOT NULL,
+    reason TEXT,
+    leave_id UUID REFERENCES hostel_leave_requests(id) ON DELETE CASCADE,
+    status TEXT NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'cancelled')),
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK (to_date >= from_date),
+    CHECK (cardinality(meals) > 0)
+);
+
+CREATE INDEX IF NOT EXISTS idx_hostel_meal_opt_outs_dates
+    ON hostel_meal_opt_outs (tenant_id, from_date, to_date) WHERE status = 'active';
+
+-- How hostel and mess fees are worked out; amounts in paise.
+CREATE TABLE IF NOT EXISTS hostel_fee_settings (
+    tenant_id UUID PRIMARY KEY REFERENCES tenants(id) ON DELETE CASCADE,
+    fee_head_id UUID REFERENCES fee_heads(id) ON DELETE SET NULL,
+    mess_fee_head_id UUID REFERENCES fee_heads(id) ON DELETE SET NULL,
+    mess_monthly_fee BIGINT NOT NULL DEFAULT 0 CHECK (mess_monthly_fee >= 0),
+    mess_rebate_per_day BIGINT NOT NULL DEFAULT 0 CHECK (mess_rebate_per_day >= 0),
+    mess_rebate_min_days INT NOT NULL DEFAULT 3 CHECK (mess_rebate_min_days >= 1),
+    proration TEXT NOT NULL DEFAULT 'monthly' CHECK (proration IN ('none', 'monthly', 'daily')),
+    updated_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- The billing terms hostel and mess fees are charged for.
+CREATE TABLE IF NOT EXISTS hostel_fee_terms (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    academic_year_id UUID NOT NULL REFERENCES academic_years(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    start_date DATE NOT NULL,
+    end_date DATE NOT NULL,
+    due_date DATE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (tenant_id, academic_year_id, name),
+    CHECK (end_date >= start_date)
+);
+
+CREATE TABLE IF NOT EXISTS hostel_fee_runs (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    term_id UUID NOT NULL REFERENCES hostel_fee_terms(id) ON DELETE CASCADE,
+    created_count INT NOT NULL DEFAULT 0,
+    updated_count INT NOT NULL DEFAULT 0,
+    unchanged_count INT NOT NULL DEFAULT 0,
+    cancelled_count INT NOT NULL DEFAULT 0,
+    skipped_count INT NOT NULL DEFAULT 0,
+    report JSONB NOT NULL DEFAULT '[]'::jsonb,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_hostel_fee_runs_term
+    ON hostel_fee_runs (tenant_id, term_id, created_at DESC);
@@ -0,0 +1,4 @@
+-- 000101_otp_code_delivery.down.sql
+
+ALTER TABLE auth_otp_challenges DROP COLUMN IF EXISTS dispatched_at;
+ALTER TABLE auth_otp_challenges DROP COLUMN IF EXISTS code_ciphertext;
@@ -0,0 +1,11 @@
+-- 000101_otp_code_delivery.up.sql
+
+-- OTP codes are held encrypted on the challenge until the worker has sent them,
+-- instead of travelling in plaintext in the outbox payload.
+ALTER TABLE auth_otp_challenges ADD COLUMN IF NOT EXISTS code_ciphertext TEXT;
+ALTER TABLE auth_otp_challenges ADD COLUMN IF NOT EXISTS dispatched_at TIMESTAMPTZ;
+
+-- Scrub codes already written to the outbox.
+UPDATE outbox
+SET payload = payload - 'message' - 'purpose' - 'expires_at'
+WHERE event_type = 'auth.otp.requested' AND payload ? 'message';
@@ -0,0 +1,4 @@
+-- 000102_sso_second_factor.down.sql
+
+ALTER TABLE mfa_login_sessions DROP COLUMN IF EXISTS identity_id;
+ALTER TABLE sso_login_requests DROP COLUMN IF EXISTS auth_methods;
@@ -0,0 +1,9 @@
+-- 000102_sso_second_factor.up.sql
+
+-- How the IdP authenticated the user (OIDC amr / SAML AuthnContextClassRef),
+-- checked against the phishing-resistant policy when the ticket is exchanged.
+ALTER TABLE sso_login_requests ADD COLUMN IF NOT EXISTS auth_methods TEXT[] NOT NULL DEFAULT '{}';
+
+-- A second-factor challenge started from SSO signs in with the SSO identity
+-- rather than the password one.
+ALTER TABLE mfa_login_sessions ADD COLUMN IF NOT EXISTS identity_id UUID REFERENCES user_identities(id) ON DELETE CASCADE;
@@ -0,0 +1,4 @@
+-- 000103_outbox_webhook_cursor.down.sql
+
+DROP INDEX IF EXISTS idx_outbox_webhook_fanout;
+ALTER TABLE outbox DROP COLUMN IF EXISTS webhooks_enqueued_at;
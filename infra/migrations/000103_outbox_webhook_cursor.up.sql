@@ -0,0 +1,13 @@
+-- 000103_outbox_webhook_cursor.up.sql
+
+-- Tenant webhook fan-out keeps its own cursor on the outbox instead of riding on
+-- status, which the API processor and the worker both move to 'completed'.
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS webhooks_enqueued_at TIMESTAMPTZ;
+
+-- Enqueuing is idempotent per endpoint, so the last day is left for the fan-out
+-- to pick up again; that recovers events the worker completed without it.
+UPDATE outbox SET webhooks_enqueued_at = NOW()
+WHERE webhooks_enqueued_at IS NULL AND created_at < NOW() - INTERVAL '1 day';
+
+CREATE INDEX IF NOT EXISTS idx_outbox_webhook_fanout
+    ON outbox (created_at) WHERE webhooks_enqueued_at IS NULL;
@@ -0,0 +1,3 @@
+-- 000104_kb_embedding_failures.down.sql
+
+DROP TABLE IF EXISTS kb_chunk_embedding_failures;
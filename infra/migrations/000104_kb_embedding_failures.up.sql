@@ -0,0 +1,18 @@
+-- 000104_kb_embedding_failures.up.sql
+
+-- Chunks the embedder returned nothing for. The indexer backs off between
+-- attempts and gives up after a fixed number, so one bad chunk no longer
+-- holds the head of the queue. Rows go away with the chunk, on a successful
+-- embed and on a tenant reindex.
+CREATE TABLE IF NOT EXISTS kb_chunk_embedding_failures (
+    chunk_id UUID PRIMARY KEY REFERENCES kb_chunks(id) ON DELETE CASCADE,
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    model TEXT NOT NULL,
+    attempts INT NOT NULL DEFAULT 1,
+    last_error TEXT NOT NULL DEFAULT '',
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS kb_chunk_embedding_failures_tenant_model
+    ON kb_chunk_embedding_failures (tenant_id, model);
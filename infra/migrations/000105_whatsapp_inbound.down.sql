@@ -0,0 +1,4 @@
+-- 000105_whatsapp_inbound.down.sql
+
+DROP TABLE IF EXISTS whatsapp_inbound_messages;
+DROP INDEX IF EXISTS notification_gateway_whatsapp_number;
@@ -0,0 +1,17 @@
+-- 000105_whatsapp_inbound.up.sql
+
+-- Inbound WhatsApp messages are routed to the tenant whose gateway settings
+-- name the receiving WhatsApp phone-number id, which the gateway signs with
+-- the message. A number can belong to one tenant only.
+CREATE UNIQUE INDEX IF NOT EXISTS notification_gateway_whatsapp_number
+    ON notification_gateway_configs ((settings->>'whatsapp_phone_number_id'))
+    WHERE settings->>'whatsapp_phone_number_id' IS NOT NULL;
+
+-- Provider message ids already answered, so a redelivered or replayed
+-- message is not answered twice.
+CREATE TABLE IF NOT EXISTS whatsapp_inbound_messages (
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    message_id TEXT NOT NULL,
+    received_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (tenant_id, message_id)
+);
@@ -22,12 +22,15 @@ import (
 	"github.com/schoolerp/api/internal/db"
 	"github.com/schoolerp/api/internal/foundation/approvals"
 	"github.com/schoolerp/api/internal/foundation/audit"
+	"github.com/schoolerp/api/internal/foundation/datascope"
 	"github.com/schoolerp/api/internal/foundation/filestore"
 	"github.com/schoolerp/api/internal/foundation/i18n"
+	"github.com/schoolerp/api/internal/foundation/keyring"
 	"github.com/schoolerp/api/internal/foundation/locks"
 	"github.com/schoolerp/api/internal/foundation/outbox"
 	"github.com/schoolerp/api/internal/foundation/policy"
 	"github.com/schoolerp/api/internal/foundation/quota"
+	"github.com/schoolerp/api/internal/foundation/ratelimit"
 	"github.com/schoolerp/api/internal/foundation/sessionstore"
 	aihandler "github.com/schoolerp/api/internal/handler"
 	academic "github.com/schoolerp/api/internal/handler/academics"
@@ -201,6 +204,9 @@ func main() {
 		log.Warn().Msg("Redis session store disabled (REDIS_URL not configured)")
 	}
 	middleware.SetSessionStore(sessionStore)
+	middleware.SetRateLimiter(ratelimit.New(sessionStore, func(ctx context.Context) ([]byte, error) {
+		return querier.GetPlatformSettingValue(ctx, ratelimit.PolicySettingKey)
+	}))
 
 	// Initialize Foundations
 	auditLogger := audit.NewLogger(querier)
@@ -215,6 +221,14 @@ func main() {
 		log.Warn().Err(err).Msg("Failed to load i18n translations, falling back to keys")
 	}
 
+	// Tenant data keys and the re-encryption worker for master key rotations
+	keyringService := keyring.NewService(querier, pool)
+	go keyringService.StartReencryptionWorker(context.Background())
+
+	// Tenant webhook subscriptions and their delivery worker
+	webhookSubscriptions := automationservice.NewSubscriptionService(querier, keyringService, auditLogger)
+	go webhookSubscriptions.StartDeliveryWorker(context.Background())
+
 	// Initialize Outbox Processor
 	webhookSvc := automationservice.NewWebhookService()
 	autoEngine := automationservice.NewEngine(querier, webhookSvc)
@@ -226,47 +240,80 @@ func main() {
 	go autoScheduler.Start(context.Background())
 
 	// Initialize Services
-	studentService := sisservice.NewStudentService(querier, auditLogger, quotaSvc)
-	student360Service := sisservice.NewStudent360Service(pool, auditLogger)
+	dataScope := datascope.NewService(querier)
+	studentService := sisservice.NewStudentService(querier, auditLogger, quotaSvc, dataScope)
+	student360Service := sisservice.NewStudent360Service(pool, auditLogger, keyringService)
 	dashboardService := dashservice.NewDashboardService(pool, auditLogger)
-	biometricService := bioservice.NewBiometricService(pool, auditLogger)
+	trackingService := transportservice.NewTrackingService(querier, auditLogger)
+	biometricService := bioservice.NewBiometricService(pool, auditLogger, trackingService)
 	customFieldService := sisservice.NewCustomFieldService(pool, auditLogger)
-	attendanceService := attendservice.NewService(querier, auditLogger, policyEval, approvalSvc, locksSvc)
+	attendanceService := attendservice.NewService(querier, auditLogger, policyEval, approvalSvc, locksSvc, dataScope)
 	staffAttendService := attendservice.NewStaffAttendanceService(pool, auditLogger)
 	financeService := financeservice.NewService(querier, pool, auditLogger, policyEval, locksSvc, &financeservice.RazorpayProvider{
 		KeyID:     os.Getenv("RAZORPAY_KEY_ID"),
 		KeySecret: os.Getenv("RAZORPAY_KEY_SECRET"),
 	})
 	noticeService := noticeservice.NewService(querier, auditLogger)
-	examService := examservice.NewService(querier, auditLogger)
-	transportService := transportservice.NewTransportService(querier, pool, auditLogger)
-	libraryService := libraryservice.NewLibraryService(querier, pool, auditLogger)
-	inventoryService := inventoryservice.NewInventoryService(querier, pool, auditLogger)
+	examService := examservice.NewService(querier, auditLogger, dataScope)
+	fleetService := transportservice.NewFleetService(querier, auditLogger)
+	go fleetService.StartReminderWorker(context.Background())
+	transportService := transportservice.NewTransportService(querier, pool, auditLogger, fleetService)
+	planningService := transportservice.NewPlanningService(querier, pool, auditLogger, fleetService)
+	feeService := transportservice.NewFeeService(querier, pool, auditLogger)
+	circulationService := libraryservice.NewCirculationService(querier, pool, auditLogger, approvalSvc)
+	go circulationService.StartHoldExpiryWorker(context.Background())
+	catalogueService := libraryservice.NewCatalogueService(querier, pool, auditLogger, circulationService, libraryservice.NewOpenLibrarySource())
+	libraryService := libraryservice.NewLibraryService(querier, pool, auditLogger, circulationService, catalogueService)
+	inventoryStockService := inventoryservice.NewStockService(querier, pool, auditLogger)
+	inventoryService := inventoryservice.NewInventoryService(querier, pool, auditLogger, inventoryStockService)
+	procurementService := inventoryservice.NewProcurementService(querier, pool, auditLogger, inventoryStockService)
+	assetService := inventoryservice.NewAssetService(querier, inventoryStockService, approvalSvc)
+	go procurementService.StartReorderWorker(context.Background())
 	commService := commservice.NewService(querier, auditLogger)
 	admissionService := admissionservice.NewAdmissionService(querier, auditLogger, studentService)
-	hrmsService := hrmsservice.NewService(querier, pool, auditLogger, approvalSvc, quotaSvc)
-	safetyService := safetyservice.NewService(querier, auditLogger)
+	hrmsService := hrmsservice.NewService(querier, pool, auditLogger, approvalSvc, quotaSvc, keyringService)
+	safetyService := safetyservice.NewService(querier, auditLogger, keyringService)
 	portfolioService := portfolioservice.NewService(querier)
 	alumniService := alumniservice.NewService(querier)
-	authService := authservice.NewService(querier, sessionStore)
+	otpErr := authservice.CheckOTPConfig()
+	if otpErr != nil {
+		log.Warn().Err(otpErr).Msg("Phone OTP login disabled: not configured")
+	}
+	authService := authservice.NewService(querier, sessionStore, keyringService)
+	middleware.SetAPIClientAuthenticator(authService.APIClients, authservice.ErrAPICredentialDenied)
 	rolesService := rolesservice.NewService(querier)
 	notificationService := notificationservice.NewService(querier)
 	academicService := academicservice.NewService(querier, auditLogger)
-	tenantService := tenantservice.NewService(querier, pool, sessionStore)
+	tenantService := tenantservice.NewService(querier, pool, sessionStore, keyringService)
 	marketingService := marketingservice.NewService(pool)
 	automationService := automationservice.NewAutomationService(querier)
 	kbService := kbservice.NewService(querier, pool, auditLogger)
+	if embedder, err := kbservice.NewEmbedderFromEnv(); err != nil {
+		log.Warn().Err(err).Msg("KB semantic search disabled")
+	} else if embedder != nil {
+		kbService.SetEmbedder(embedder)
+		go kbservice.NewEmbeddingIndexer(pool, embedder).Start(context.Background())
+	}
 
 	calendarService := academicservice.NewCalendarService(pool, auditLogger)
 	resourceService := academicservice.NewResourceService(pool, auditLogger)
 	idCardService := sisservice.NewIDCardService(pool, auditLogger)
-	hostelService := sisservice.NewHostelService(pool, auditLogger)
+	hostelService := sisservice.NewHostelService(pool, querier, auditLogger)
 	scheduleService := academicservice.NewScheduleService(pool, auditLogger)
 	promotionService := sisservice.NewPromotionService(querier, auditLogger)
 
+	var whatsAppService *aiservice.WhatsAppService
 	aiService, err := aiservice.NewService(querier)
 	if err != nil {
 		log.Warn().Err(err).Msg("AI Service failed to initialize (missing API key?)")
+	} else {
+		aiService.SetKnowledgeBase(kbService, pool)
+		// Helpdesk tools see the signed-in guardian's children in the app and
+		// the sender's children on WhatsApp.
+		parentTools := aiservice.NewParentTools(querier, pool, auditLogger)
+		aiService.SetParentTools(parentTools)
+		whatsAppService = aiservice.NewWhatsAppService(aiService, querier)
+		whatsAppService.SetParentTools(parentTools)
 	}
 
 	// File Service
@@ -281,6 +328,8 @@ func main() {
 
 	store, _ := filestore.NewLocalProvider(fsDir, fsURL)
 	fileService := fileservice.NewFileService(querier, store, quotaSvc)
+	kbService.SetFileService(fileService)
+	onlineAdmissionService := admissionservice.NewOnlineApplicationService(pool, admissionService, fileService, financeService, auditLogger)
 
 	// Initialize Handlers
 	studentHandler := sis.NewHandler(studentService)
@@ -292,11 +341,12 @@ func main() {
 	notificationHandler := notification.NewHandler(notificationService)
 	examHandler := exams.NewHandler(examService)
 	academicHandler := academic.NewHandler(academicService)
-	transportHandler := transport.NewHandler(transportService)
-	libraryHandler := library.NewHandler(libraryService)
-	inventoryHandler := inventory.NewHandler(inventoryService)
+	transportHandler := transport.NewHandler(transportService, trackingService, fleetService, planningService, feeService)
+	libraryHandler := library.NewHandler(libraryService, circulationService, catalogueService)
+	inventoryHandler := inventory.NewHandler(inventoryService, inventoryStockService, procurementService, assetService)
 	commHandler := communication.NewHandler(commService)
 	admissionHandler := admission.NewHandler(admissionService)
+	onlineAdmissionHandler := admission.NewOnlineHandler(admissionService, onlineAdmissionService)
 	hrmsHandler := hrms.NewHandler(hrmsService)
 	safetyHandler := safety.NewHandler(safetyService)
 	portfolioHandler := portfolio.NewHandler(portfolioService)
@@ -306,8 +356,9 @@ func main() {
 	fileHandler := files.NewHandler(fileService)
 	tenantHandler := tenant.NewHandler(tenantService)
 	aiHandler := aihandler.NewAIHandler(aiService, querier)
+	aiHandler.SetWhatsApp(whatsAppService)
 	marketingHandler := marketing.NewHandler(marketingService)
-	automationHandler := automation.NewAutomationHandler(automationService)
+	automationHandler := automation.NewAutomationHandler(automationService, webhookSubscriptions)
 	kbHandler := kbhandler.NewHandler(kbService)
 
 	calendarHandler := academic.NewCalendarHandler(calendarService)
@@ -396,19 +447,25 @@ func main() {
 	r.Route("/v1", func(r chi.Router) {
 		// Public Auth Routes
 		authHandler.RegisterRoutes(r)
-		r.Post("/auth/request-otp", func(w http.ResponseWriter, r *http.Request) {
-			w.Write([]byte(`{"msg": "OTP requested"}`))
-		})
+		if otpErr == nil {
+			authHandler.RegisterOTPRoutes(r)
+		}
+		authHandler.RegisterSSORoutes(r)
+		authHandler.RegisterAPIClientRoutes(r)
+		authHandler.RegisterMFARoutes(r)
 
 		fileHandler.RegisterRoutes(r)
 		marketingHandler.RegisterPublicRoutes(r)
 		admissionHandler.RegisterPublicRoutes(r)
+		onlineAdmissionHandler.RegisterPublicRoutes(r)
+		aiHandler.RegisterWhatsAppRoutes(r)
 
 		r.Get("/tenants/config", tenantHandler.GetConfig)
 
 		// Admin Routes
 		r.Route("/admin", func(r chi.Router) {
 			r.Use(middleware.RoleGuard("super_admin", "tenant_admin"))
+			r.Use(middleware.RateLimitGroup("admin"))
 			studentHandler.RegisterRoutes(r)
 			student360Handler.RegisterRoutes(r)
 			dashboardHandler.RegisterRoutes(r)
@@ -426,6 +483,8 @@ func main() {
 			libraryHandler.RegisterRoutes(r)
 			inventoryHandler.RegisterRoutes(r)
 			admissionHandler.RegisterAdminRoutes(r)
+			onlineAdmissionHandler.RegisterAdminRoutes(r)
+			authHandler.RegisterAdminRoutes(r)
 			calendarHandler.RegisterRoutes(r)
 			resourceHandler.RegisterRoutes(r)
 			idCardHandler.RegisterRoutes(r)
@@ -473,6 +532,7 @@ func main() {
 		// Teacher Routes
 		r.Route("/teacher", func(r chi.Router) {
 			r.Use(middleware.RoleGuard("teacher", "tenant_admin", "super_admin")) // Allow admins to view teacher routes too
+			r.Use(middleware.RateLimitGroup("teacher"))
 			attendanceHandler.RegisterTeacherRoutes(r)
 			staffAttendHandler.RegisterRoutes(r) // Expose period-attendance
 			noticeHandler.RegisterRoutes(r)
@@ -488,23 +548,27 @@ func main() {
 		// Parent Routes
 		r.Route("/parent", func(r chi.Router) {
 			r.Use(middleware.RoleGuard("parent"))
+			r.Use(middleware.RateLimitGroup("parent"))
 			studentHandler.RegisterParentRoutes(r)
 			attendanceHandler.RegisterParentRoutes(r)
 			financeHandler.RegisterParentRoutes(r)
 			noticeHandler.RegisterParentRoutes(r)
 			examHandler.RegisterParentRoutes(r)
 			academicHandler.RegisterStudentRoutes(r)
+			transportHandler.RegisterParentRoutes(r)
 		})
 
 		// Accountant Routes
 		r.Route("/accountant", func(r chi.Router) {
 			r.Use(middleware.RoleGuard("accountant", "tenant_admin", "super_admin"))
+			r.Use(middleware.RateLimitGroup("accountant"))
 			financeHandler.RegisterRoutes(r)
 			studentHandler.RegisterAccountantRoutes(r)
 		})
 
 		// AI Routes
 		r.Route("/ai", func(r chi.Router) {
+			r.Use(middleware.RateLimitGroup("ai"))
 			r.Post("/helpdesk", aiHandler.ParentQuery)
 
 			r.Group(func(r chi.Router) {
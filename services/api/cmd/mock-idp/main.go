@@ -0,0 +1,54 @@
+// Command mock-idp runs a local OpenID provider and SAML IdP that approves every
+// login, for exercising tenant SSO without a real identity provider.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/schoolerp/api/internal/foundation/sso"
+)
+
+func main() {
+	var (
+		addr    string
+		baseURL string
+		email   string
+		name    string
+		groups  string
+	)
+	flag.StringVar(&addr, "addr", ":9090", "listen address")
+	flag.StringVar(&baseURL, "base-url", "http://localhost:9090", "externally reachable URL of this server (OIDC issuer)")
+	flag.StringVar(&email, "email", "teacher@example.edu", "email asserted for the signed-in user")
+	flag.StringVar(&name, "name", "Mock Teacher", "display name asserted for the signed-in user")
+	flag.StringVar(&groups, "groups", "staff", "comma-separated groups asserted for the signed-in user")
+	flag.Parse()
+
+	idp, err := sso.NewMockIdP()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "mock-idp: %v\n", err)
+		os.Exit(1)
+	}
+	idp.BaseURL = strings.TrimRight(baseURL, "/")
+	idp.User = sso.Identity{Subject: "mock-" + email, Email: email, Name: name}
+	for _, g := range strings.Split(groups, ",") {
+		if g = strings.TrimSpace(g); g != "" {
+			idp.User.Groups = append(idp.User.Groups, g)
+		}
+	}
+
+	fmt.Printf("OIDC issuer:        %s\n", idp.BaseURL)
+	fmt.Printf("OIDC client id:     %s\n", idp.ClientID)
+	fmt.Printf("OIDC client secret: %s\n", idp.ClientSecret)
+	fmt.Printf("SAML entity id:     %s\n", idp.EntityID())
+	fmt.Printf("SAML SSO URL:       %s\n", idp.SAMLSSOURL())
+	fmt.Printf("SAML certificate:\n%s\n", idp.CertPEM)
+
+	if err := http.ListenAndServe(addr, idp); err != nil {
+		fmt.Fprintf(os.Stderr, "mock-idp: %v\n", err)
+		os.Exit(1)
+	}
+}
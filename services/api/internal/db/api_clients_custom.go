@@ -0,0 +1,217 @@
+package db
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// APIClient is a tenant-issued integration credential and its service account.
+type APIClient struct {
+	ID                 pgtype.UUID        `json:"id"`
+	TenantID           pgtype.UUID        `json:"tenant_id"`
+	Name               string             `json:"name"`
+	Description        pgtype.Text        `json:"description"`
+	ClientID           string             `json:"client_id"`
+	SecretHash         string             `json:"-"`
+	SecretHint         string             `json:"secret_hint"`
+	ServiceUserID      pgtype.UUID        `json:"service_user_id"`
+	Scopes             []string           `json:"scopes"`
+	RateLimitPerMinute int32              `json:"rate_limit_per_minute"`
+	ExpiresAt          pgtype.Timestamptz `json:"expires_at"`
+	LastUsedAt         pgtype.Timestamptz `json:"last_used_at"`
+	LastUsedIP         pgtype.Text        `json:"last_used_ip"`
+	RevokedAt          pgtype.Timestamptz `json:"revoked_at"`
+	RevokedBy          pgtype.UUID        `json:"revoked_by"`
+	RevokeReason       pgtype.Text        `json:"revoke_reason"`
+	CreatedBy          pgtype.UUID        `json:"created_by"`
+	CreatedAt          pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt          pgtype.Timestamptz `json:"updated_at"`
+}
+
+const apiClientColumns = `
+	c.id, c.tenant_id, c.name, c.description, c.client_id, c.secret_hash, c.secret_hint, c.service_user_id,
+	c.scopes, c.rate_limit_per_minute, c.expires_at, c.last_used_at, c.last_used_ip,
+	c.revoked_at, c.revoked_by, c.revoke_reason, c.created_by, c.created_at, c.updated_at`
+
+func scanAPIClient(row pgx.Row, extra ...any) (APIClient, error) {
+	var c APIClient
+	dest := []any{
+		&c.ID, &c.TenantID, &c.Name, &c.Description, &c.ClientID, &c.SecretHash, &c.SecretHint, &c.ServiceUserID,
+		&c.Scopes, &c.RateLimitPerMinute, &c.ExpiresAt, &c.LastUsedAt, &c.LastUsedIP,
+		&c.RevokedAt, &c.RevokedBy, &c.RevokeReason, &c.CreatedBy, &c.CreatedAt, &c.UpdatedAt,
+	}
+	err := row.Scan(append(dest, extra...)...)
+	return c, err
+}
+
+type CreateAPIClientParams struct {
+	TenantID           pgtype.UUID
+	Name               string
+	Description        pgtype.Text
+	ClientID           string
+	SecretHash         string
+	SecretHint         string
+	Scopes             []string
+	RateLimitPerMinute int32
+	ExpiresAt          pgtype.Timestamptz
+	CreatedBy          pgtype.UUID
+}
+
+// CreateAPIClient creates the client together with its service-account user.
+// The user has no login identity; it exists so audit entries can name the
+// integration.
+func (q *Queries) CreateAPIClient(ctx context.Context, arg CreateAPIClientParams) (APIClient, error) {
+	query := `
+		WITH service_user AS (
+			INSERT INTO users (full_name, is_active)
+			VALUES ('API client: ' || $2, TRUE)
+			RETURNING id
+		), c AS (
+			INSERT INTO api_clients (
+				tenant_id, name, description, client_id, secret_hash, secret_hint, service_user_id,
+				scopes, rate_limit_per_minute, expires_at, created_by
+			)
+			SELECT $1, $2, $3, $4, $5, $6, service_user.id, $7, $8, $9, $10
+			FROM service_user
+			RETURNING *
+		)
+		SELECT ` + apiClientColumns + ` FROM c
+	`
+	return scanAPIClient(q.db.QueryRow(ctx, query,
+		arg.TenantID, arg.Name, arg.Description, arg.ClientID, arg.SecretHash, arg.SecretHint,
+		arg.Scopes, arg.RateLimitPerMinute, arg.ExpiresAt, arg.CreatedBy,
+	))
+}
+
+func (q *Queries) ListAPIClients(ctx context.Context, tenantID pgtype.UUID) ([]APIClient, error) {
+	query := `
+		SELECT ` + apiClientColumns + `
+		FROM api_clients c
+		WHERE c.tenant_id = $1
+		ORDER BY c.revoked_at IS NOT NULL, c.created_at DESC
+	`
+	rows, err := q.db.Query(ctx, query, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []APIClient
+	for rows.Next() {
+		c, err := scanAPIClient(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+func (q *Queries) GetAPIClient(ctx context.Context, tenantID, id pgtype.UUID) (APIClient, error) {
+	query := `SELECT ` + apiClientColumns + ` FROM api_clients c WHERE c.tenant_id = $1 AND c.id = $2`
+	return scanAPIClient(q.db.QueryRow(ctx, query, tenantID, id))
+}
+
+func (q *Queries) GetAPIClientByClientID(ctx context.Context, clientID string) (APIClient, error) {
+	query := `SELECT ` + apiClientColumns + ` FROM api_clients c WHERE c.client_id = $1`
+	return scanAPIClient(q.db.QueryRow(ctx, query, clientID))
+}
+
+type UpdateAPIClientParams struct {
+	TenantID           pgtype.UUID
+	ID                 pgtype.UUID
+	Name               string
+	Description        pgtype.Text
+	Scopes             []string
+	RateLimitPerMinute int32
+	ExpiresAt          pgtype.Timestamptz
+}
+
+// UpdateAPIClient changes the grants of a client that is not revoked.
+func (q *Queries) UpdateAPIClient(ctx context.Context, arg UpdateAPIClientParams) (APIClient, error) {
+	query := `
+		UPDATE api_clients c
+		SET name = $3, description = $4, scopes = $5, rate_limit_per_minute = $6, expires_at = $7, updated_at = NOW()
+		WHERE c.tenant_id = $1 AND c.id = $2 AND c.revoked_at IS NULL
+		RETURNING ` + apiClientColumns
+	return scanAPIClient(q.db.QueryRow(ctx, query,
+		arg.TenantID, arg.ID, arg.Name, arg.Description, arg.Scopes, arg.RateLimitPerMinute, arg.ExpiresAt,
+	))
+}
+
+// UpdateAPIClientSecret replaces the secret of a client that is not revoked
+// and drops the access tokens issued with the old one.
+func (q *Queries) UpdateAPIClientSecret(ctx context.Context, tenantID, id pgtype.UUID, secretHash, secretHint string) (APIClient, error) {
+	query := `
+		WITH c AS (
+			UPDATE api_clients
+			SET secret_hash = $3, secret_hint = $4, updated_at = NOW()
+			WHERE tenant_id = $1 AND id = $2 AND revoked_at IS NULL
+			RETURNING *
+		), dropped AS (
+			DELETE FROM api_client_tokens t USING c WHERE t.api_client_id = c.id
+		)
+		SELECT ` + apiClientColumns + ` FROM c
+	`
+	return scanAPIClient(q.db.QueryRow(ctx, query, tenantID, id, secretHash, secretHint))
+}
+
+// RevokeAPIClient revokes a client for good: its tokens are dropped and its
+// service account is deactivated. The rows stay for the audit trail.
+func (q *Queries) RevokeAPIClient(ctx context.Context, tenantID, id, revokedBy pgtype.UUID, reason string) (APIClient, error) {
+	query := `
+		WITH c AS (
+			UPDATE api_clients
+			SET revoked_at = NOW(), revoked_by = $3, revoke_reason = NULLIF($4, ''), updated_at = NOW()
+			WHERE tenant_id = $1 AND id = $2 AND revoked_at IS NULL
+			RETURNING *
+		), dropped AS (
+			DELETE FROM api_client_tokens t USING c WHERE t.api_client_id = c.id
+		), deactivated AS (
+			UPDATE users u SET is_active = FALSE, updated_at = NOW() FROM c WHERE u.id = c.service_user_id
+		)
+		SELECT ` + apiClientColumns + ` FROM c
+	`
+	return scanAPIClient(q.db.QueryRow(ctx, query, tenantID, id, revokedBy, reason))
+}
+
+// TouchAPIClient records use of a client, at most once a minute.
+func (q *Queries) TouchAPIClient(ctx context.Context, id pgtype.UUID, ip string) error {
+	const query = `
+		UPDATE api_clients
+		SET last_used_at = NOW(), last_used_ip = NULLIF($2, '')
+		WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')
+	`
+	_, err := q.db.Exec(ctx, query, id, ip)
+	return err
+}
+
+// CreateAPIClientToken stores an access token and clears the client's
+// expired ones.
+func (q *Queries) CreateAPIClientToken(ctx context.Context, apiClientID pgtype.UUID, tokenHash string, scopes []string, expiresAt pgtype.Timestamptz) error {
+	const query = `
+		WITH expired AS (
+			DELETE FROM api_client_tokens WHERE api_client_id = $1 AND expires_at <= NOW()
+		)
+		INSERT INTO api_client_tokens (api_client_id, token_hash, scopes, expires_at)
+		VALUES ($1, $2, $3, $4)
+	`
+	_, err := q.db.Exec(ctx, query, apiClientID, tokenHash, scopes, expiresAt)
+	return err
+}
+
+// GetAPIClientByToken returns the client of an unexpired access token and
+// the scopes the token was issued with.
+func (q *Queries) GetAPIClientByToken(ctx context.Context, tokenHash string) (APIClient, []string, error) {
+	query := `
+		SELECT ` + apiClientColumns + `, t.scopes
+		FROM api_client_tokens t
+		JOIN api_clients c ON c.id = t.api_client_id
+		WHERE t.token_hash = $1 AND t.expires_at > NOW()
+	`
+	var scopes []string
+	c, err := scanAPIClient(q.db.QueryRow(ctx, query, tokenHash), &scopes)
+	return c, scopes, err
+}
@@ -0,0 +1,275 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// OTPGuardianRow is a guardian with a linked user account whose phone matches an OTP request.
+type OTPGuardianRow struct {
+	GuardianID    pgtype.UUID
+	UserID        pgtype.UUID
+	FullName      string
+	Phone         string
+	PhoneVerified bool
+}
+
+// ListOTPGuardiansByPhone returns guardians in a tenant whose phone normalises to phoneKey
+// (last 10 digits) and who are linked to a user account.
+func (q *Queries) ListOTPGuardiansByPhone(ctx context.Context, tenantID pgtype.UUID, phoneKey string) ([]OTPGuardianRow, error) {
+	const query = `
+		SELECT g.id, g.user_id, g.full_name, g.phone,
+		       (v.guardian_id IS NOT NULL) AS phone_verified
+		FROM guardians g
+		LEFT JOIN guardian_phone_verifications v
+		       ON v.guardian_id = g.id AND v.phone_key = $2
+		WHERE g.tenant_id = $1
+		  AND g.user_id IS NOT NULL
+		  AND right(regexp_replace(g.phone, '\D', '', 'g'), 10) = $2
+		ORDER BY g.created_at ASC
+	`
+
+	rows, err := q.db.Query(ctx, query, tenantID, phoneKey)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []OTPGuardianRow
+	for rows.Next() {
+		var g OTPGuardianRow
+		if err := rows.Scan(&g.GuardianID, &g.UserID, &g.FullName, &g.Phone, &g.PhoneVerified); err != nil {
+			return nil, err
+		}
+		out = append(out, g)
+	}
+	return out, rows.Err()
+}
+
+// GetGuardianPhone returns a guardian's raw phone within a tenant.
+func (q *Queries) GetGuardianPhone(ctx context.Context, tenantID, guardianID pgtype.UUID) (string, error) {
+	const query = `SELECT phone FROM guardians WHERE id = $1 AND tenant_id = $2`
+	var phone string
+	err := q.db.QueryRow(ctx, query, guardianID, tenantID).Scan(&phone)
+	return phone, err
+}
+
+// UpsertGuardianPhoneVerification records that a guardian's current phone has been verified.
+func (q *Queries) UpsertGuardianPhoneVerification(ctx context.Context, tenantID, guardianID pgtype.UUID, phoneKey, via string, verifiedBy pgtype.UUID) error {
+	const query = `
+		INSERT INTO guardian_phone_verifications (guardian_id, tenant_id, phone_key, verified_via, verified_by, verified_at)
+		VALUES ($1, $2, $3, $4, $5, NOW())
+		ON CONFLICT (guardian_id) DO UPDATE
+		SET phone_key = EXCLUDED.phone_key,
+		    verified_via = EXCLUDED.verified_via,
+		    verified_by = EXCLUDED.verified_by,
+		    verified_at = NOW()
+	`
+	_, err := q.db.Exec(ctx, query, guardianID, tenantID, phoneKey, via, verifiedBy)
+	return err
+}
+
+// OTPIssuanceStats summarises recent challenges for a phone, used for throttling.
+type OTPIssuanceStats struct {
+	Issued   int
+	Locked   int
+	LastSent pgtype.Timestamptz
+}
+
+// GetOTPIssuanceStats counts challenges and lockouts for a phone since the given time.
+func (q *Queries) GetOTPIssuanceStats(ctx context.Context, tenantID pgtype.UUID, phoneKey string, since time.Time) (OTPIssuanceStats, error) {
+	const query = `
+		SELECT count(*)::int,
+		       count(*) FILTER (WHERE consumed_at IS NULL AND attempts >= max_attempts)::int,
+		       max(created_at)
+		FROM auth_otp_challenges
+		WHERE tenant_id = $1 AND phone_key = $2 AND created_at >= $3
+	`
+	var s OTPIssuanceStats
+	err := q.db.QueryRow(ctx, query, tenantID, phoneKey, pgtype.Timestamptz{Time: since, Valid: true}).
+		Scan(&s.Issued, &s.Locked, &s.LastSent)
+	return s, err
+}
+
+// CreateOTPChallengeParams are the params for CreateOTPChallenge.
+type CreateOTPChallengeParams struct {
+	ID         pgtype.UUID
+	TenantID   pgtype.UUID
+	GuardianID pgtype.UUID
+	UserID     pgtype.UUID
+	Purpose    string
+	Channel    string
+	PhoneKey   string
+	CodeHash   string
+	// CodeCiphertext holds the code, encrypted with the data key, until the worker
+	// has delivered it.
+	CodeCiphertext string
+	MaxAttempts    int32
+	ExpiresAt      time.Time
+	IPAddress      string
+	UserAgent      string
+}
+
+// CreateOTPChallenge stores a new hashed OTP and expires any still-open challenge
+// for the same phone and purpose, so only the latest code is accepted.
+func (q *Queries) CreateOTPChallenge(ctx context.Context, arg CreateOTPChallengeParams) error {
+	const supersede = `
+		UPDATE auth_otp_challenges
+		SET expires_at = NOW()
+		WHERE tenant_id = $1 AND phone_key = $2 AND purpose = $3
+		  AND consumed_at IS NULL AND expires_at > NOW()
+	`
+	if _, err := q.db.Exec(ctx, supersede, arg.TenantID, arg.PhoneKey, arg.Purpose); err != nil {
+		return err
+	}
+
+	const query = `
+		INSERT INTO auth_otp_challenges (
+			id, tenant_id, guardian_id, user_id, purpose, channel, phone_key,
+			code_hash, code_ciphertext, max_attempts, expires_at, ip_address, user_agent
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, ''), $10, $11, NULLIF($12, ''), NULLIF($13, ''))
+	`
+	_, err := q.db.Exec(ctx, query,
+		arg.ID, arg.TenantID, arg.GuardianID, arg.UserID, arg.Purpose, arg.Channel, arg.PhoneKey,
+		arg.CodeHash, arg.CodeCiphertext, arg.MaxAttempts, pgtype.Timestamptz{Time: arg.ExpiresAt, Valid: true},
+		arg.IPAddress, arg.UserAgent,
+	)
+	return err
+}
+
+// OTPAttemptRow is the state of a challenge after an attempt has been counted against it.
+type OTPAttemptRow struct {
+	ID          pgtype.UUID
+	GuardianID  pgtype.UUID
+	UserID      pgtype.UUID
+	CodeHash    string
+	Attempts    int32
+	MaxAttempts int32
+}
+
+// RecordOTPAttempt atomically counts an attempt against the latest open challenge for a
+// phone and purpose. It returns pgx.ErrNoRows when there is no challenge that can still
+// be attempted (none issued, expired, consumed or out of attempts).
+func (q *Queries) RecordOTPAttempt(ctx context.Context, tenantID pgtype.UUID, phoneKey, purpose string) (OTPAttemptRow, error) {
+	const query = `
+		UPDATE auth_otp_challenges c
+		SET attempts = c.attempts + 1
+		WHERE c.id = (
+			SELECT id FROM auth_otp_challenges
+			WHERE tenant_id = $1 AND phone_key = $2 AND purpose = $3
+			ORDER BY created_at DESC
+			LIMIT 1
+		)
+		  AND c.consumed_at IS NULL
+		  AND c.expires_at > NOW()
+		  AND c.attempts < c.max_attempts
+		RETURNING c.id, c.guardian_id, c.user_id, c.code_hash, c.attempts, c.max_attempts
+	`
+	var r OTPAttemptRow
+	err := q.db.QueryRow(ctx, query, tenantID, phoneKey, purpose).
+		Scan(&r.ID, &r.GuardianID, &r.UserID, &r.CodeHash, &r.Attempts, &r.MaxAttempts)
+	return r, err
+}
+
+// ConsumeOTPChallenge marks a challenge as used. It reports false when another request
+// consumed it first.
+func (q *Queries) ConsumeOTPChallenge(ctx context.Context, id pgtype.UUID) (bool, error) {
+	const query = `
+		UPDATE auth_otp_challenges
+		SET consumed_at = NOW(), code_ciphertext = NULL
+		WHERE id = $1 AND consumed_at IS NULL
+	`
+	tag, err := q.db.Exec(ctx, query, id)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// UpsertUserIdentity returns the identity for a provider/identifier pair, creating it if needed.
+func (q *Queries) UpsertUserIdentity(ctx context.Context, userID pgtype.UUID, provider, identifier string) (AuthIdentity, error) {
+	const query = `
+		INSERT INTO user_identities (user_id, provider, identifier)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (provider, identifier) DO UPDATE SET user_id = EXCLUDED.user_id
+		RETURNING id, user_id, provider, identifier, credential
+	`
+	var identity AuthIdentity
+	err := q.db.QueryRow(ctx, query, userID, provider, identifier).
+		Scan(&identity.ID, &identity.UserID, &identity.Provider, &identity.Identifier, &identity.Credential)
+	return identity, err
+}
+
+// TrustedDevice is a remembered device that may skip the OTP step.
+type TrustedDevice struct {
+	ID         pgtype.UUID        `json:"id"`
+	Label      pgtype.Text        `json:"label"`
+	IPAddress  pgtype.Text        `json:"ip_address"`
+	UserAgent  pgtype.Text        `json:"user_agent"`
+	CreatedAt  pgtype.Timestamptz `json:"created_at"`
+	LastUsedAt pgtype.Timestamptz `json:"last_used_at"`
+	ExpiresAt  pgtype.Timestamptz `json:"expires_at"`
+}
+
+// CreateTrustedDevice remembers a device by the hash of its token.
+func (q *Queries) CreateTrustedDevice(ctx context.Context, tenantID, userID pgtype.UUID, tokenHash, label, ipAddress, userAgent string, expiresAt time.Time) error {
+	const query = `
+		INSERT INTO auth_trusted_devices (tenant_id, user_id, token_hash, label, ip_address, user_agent, expires_at, last_used_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''), NULLIF($6, ''), $7, NOW())
+	`
+	_, err := q.db.Exec(ctx, query, tenantID, userID, tokenHash, label, ipAddress, userAgent, pgtype.Timestamptz{Time: expiresAt, Valid: true})
+	return err
+}
+
+// TouchTrustedDevice marks an unexpired, unrevoked device as used and reports whether
+// it belongs to the given user.
+func (q *Queries) TouchTrustedDevice(ctx context.Context, tenantID, userID pgtype.UUID, tokenHash string) (bool, error) {
+	const query = `
+		UPDATE auth_trusted_devices
+		SET last_used_at = NOW()
+		WHERE token_hash = $1 AND user_id = $2 AND tenant_id = $3
+		  AND revoked_at IS NULL AND expires_at > NOW()
+	`
+	tag, err := q.db.Exec(ctx, query, tokenHash, userID, tenantID)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// ListTrustedDevices lists a user's active remembered devices.
+func (q *Queries) ListTrustedDevices(ctx context.Context, userID pgtype.UUID) ([]TrustedDevice, error) {
+	const query = `
+		SELECT id, label, ip_address, user_agent, created_at, last_used_at, expires_at
+		FROM auth_trusted_devices
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+		ORDER BY last_used_at DESC NULLS LAST
+	`
+	rows, err := q.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []TrustedDevice
+	for rows.Next() {
+		var d TrustedDevice
+		if err := rows.Scan(&d.ID, &d.Label, &d.IPAddress, &d.UserAgent, &d.CreatedAt, &d.LastUsedAt, &d.ExpiresAt); err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+// RevokeTrustedDevice forgets one of a user's remembered devices.
+func (q *Queries) RevokeTrustedDevice(ctx context.Context, userID, deviceID pgtype.UUID) (bool, error) {
+	const query = `UPDATE auth_trusted_devices SET revoked_at = NOW() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`
+	tag, err := q.db.Exec(ctx, query, deviceID, userID)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
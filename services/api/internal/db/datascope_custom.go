@@ -0,0 +1,137 @@
+package db
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// ListClassTeacherSections returns the sections a user owns as class teacher,
+// either through an active class teacher assignment or a section/class scoped
+// teacher role assignment.
+func (q *Queries) ListClassTeacherSections(ctx context.Context, tenantID, userID pgtype.UUID) ([]pgtype.UUID, error) {
+	const query = `
+		SELECT cta.class_section_id
+		FROM class_teacher_assignments cta
+		WHERE cta.tenant_id = $1 AND cta.teacher_id = $2 AND cta.is_active = true
+		UNION
+		SELECT ra.scope_id
+		FROM role_assignments ra
+		JOIN roles r ON r.id = ra.role_id
+		WHERE ra.tenant_id = $1 AND ra.user_id = $2 AND r.code = 'teacher'
+		  AND ra.scope_type = 'section' AND ra.scope_id IS NOT NULL
+		UNION
+		SELECT sec.id
+		FROM role_assignments ra
+		JOIN roles r ON r.id = ra.role_id
+		JOIN sections sec ON sec.class_id = ra.scope_id AND sec.tenant_id = ra.tenant_id
+		WHERE ra.tenant_id = $1 AND ra.user_id = $2 AND r.code = 'teacher'
+		  AND ra.scope_type = 'class'
+	`
+	return q.listUUIDs(ctx, query, tenantID, userID)
+}
+
+type TeacherSubjectSection struct {
+	SectionID pgtype.UUID
+	SubjectID pgtype.UUID
+}
+
+// ListTeacherSubjectSections returns the section/subject pairs a user teaches
+// according to the timetable.
+func (q *Queries) ListTeacherSubjectSections(ctx context.Context, tenantID, userID pgtype.UUID) ([]TeacherSubjectSection, error) {
+	const query = `
+		SELECT DISTINCT class_section_id, subject_id
+		FROM timetable_entries
+		WHERE tenant_id = $1 AND teacher_id = $2
+	`
+	rows, err := q.db.Query(ctx, query, tenantID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []TeacherSubjectSection
+	for rows.Next() {
+		var s TeacherSubjectSection
+		if err := rows.Scan(&s.SectionID, &s.SubjectID); err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+// ListGuardianStudentIDs returns the students linked to a parent user.
+func (q *Queries) ListGuardianStudentIDs(ctx context.Context, tenantID, userID pgtype.UUID) ([]pgtype.UUID, error) {
+	const query = `
+		SELECT DISTINCT sg.student_id
+		FROM guardians g
+		JOIN student_guardians sg ON sg.guardian_id = g.id
+		WHERE g.tenant_id = $1 AND g.user_id = $2
+	`
+	return q.listUUIDs(ctx, query, tenantID, userID)
+}
+
+// ListWardenBuildings returns the hostel buildings whose warden is the
+// employee record of the user.
+func (q *Queries) ListWardenBuildings(ctx context.Context, tenantID, userID pgtype.UUID) ([]pgtype.UUID, error) {
+	const query = `
+		SELECT hb.id
+		FROM hostel_buildings hb
+		JOIN employees e ON e.id = hb.warden_id AND e.tenant_id = hb.tenant_id
+		WHERE hb.tenant_id = $1 AND e.user_id = $2 AND hb.is_active = true
+	`
+	return q.listUUIDs(ctx, query, tenantID, userID)
+}
+
+type StudentScopeFacts struct {
+	StudentID  pgtype.UUID
+	SectionID  pgtype.UUID
+	BuildingID pgtype.UUID
+}
+
+// ListStudentScopeFacts returns what data scoping needs to know about each
+// student: their section and the building of their active hostel room.
+func (q *Queries) ListStudentScopeFacts(ctx context.Context, tenantID pgtype.UUID, studentIDs []pgtype.UUID) ([]StudentScopeFacts, error) {
+	const query = `
+		SELECT s.id, s.section_id, hb.id
+		FROM students s
+		LEFT JOIN hostel_allocations ha ON ha.student_id = s.id AND ha.status = 'active'
+		LEFT JOIN hostel_rooms hr ON hr.id = ha.room_id
+		LEFT JOIN hostel_buildings hb ON hb.id = hr.building_id AND hb.tenant_id = s.tenant_id
+		WHERE s.tenant_id = $1 AND s.id = ANY($2::uuid[])
+	`
+	rows, err := q.db.Query(ctx, query, tenantID, studentIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []StudentScopeFacts
+	for rows.Next() {
+		var f StudentScopeFacts
+		if err := rows.Scan(&f.StudentID, &f.SectionID, &f.BuildingID); err != nil {
+			return nil, err
+		}
+		out = append(out, f)
+	}
+	return out, rows.Err()
+}
+
+func (q *Queries) listUUIDs(ctx context.Context, query string, args ...any) ([]pgtype.UUID, error) {
+	rows, err := q.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []pgtype.UUID
+	for rows.Next() {
+		var id pgtype.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		out = append(out, id)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,195 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// StudentFeeCharge is a charge another module raised on a student. It is
+// posted to the student's fee ledger as a fee plan with a single item, so
+// the fee summary, reminders and receipts see it like any other fee.
+type StudentFeeCharge struct {
+	ID              pgtype.UUID        `json:"id"`
+	TenantID        pgtype.UUID        `json:"tenant_id"`
+	StudentID       pgtype.UUID        `json:"student_id"`
+	StudentName     string             `json:"student_name"`
+	AdmissionNumber string             `json:"admission_number"`
+	Source          string             `json:"source"`
+	SourceKey       string             `json:"source_key"`
+	Period          pgtype.Text        `json:"period"`
+	FeePlanID       pgtype.UUID        `json:"fee_plan_id"`
+	FeeHeadID       pgtype.UUID        `json:"fee_head_id"`
+	AcademicYearID  pgtype.UUID        `json:"academic_year_id"`
+	Description     string             `json:"description"`
+	Amount          int64              `json:"amount"`
+	DueDate         pgtype.Date        `json:"due_date"`
+	Status          string             `json:"status"`
+	Details         json.RawMessage    `json:"details"`
+	CreatedAt       pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt       pgtype.Timestamptz `json:"updated_at"`
+}
+
+const studentFeeChargeColumns = `
+	c.id, c.tenant_id, c.student_id, s.full_name, s.admission_number, c.source, c.source_key, c.period,
+	c.fee_plan_id, c.fee_head_id, c.academic_year_id, c.description, c.amount, c.due_date, c.status,
+	c.details, c.created_at, c.updated_at`
+
+func scanStudentFeeCharge(row pgx.Row) (StudentFeeCharge, error) {
+	var c StudentFeeCharge
+	err := row.Scan(
+		&c.ID, &c.TenantID, &c.StudentID, &c.StudentName, &c.AdmissionNumber, &c.Source, &c.SourceKey, &c.Period,
+		&c.FeePlanID, &c.FeeHeadID, &c.AcademicYearID, &c.Description, &c.Amount, &c.DueDate, &c.Status,
+		&c.Details, &c.CreatedAt, &c.UpdatedAt,
+	)
+	return c, err
+}
+
+func (q *Queries) getStudentFeeCharge(ctx context.Context, tenantID, id pgtype.UUID) (StudentFeeCharge, error) {
+	query := `SELECT ` + studentFeeChargeColumns + `
+		FROM student_fee_charges c JOIN students s ON s.id = c.student_id
+		WHERE c.tenant_id = $1 AND c.id = $2`
+	return scanStudentFeeCharge(q.db.QueryRow(ctx, query, tenantID, id))
+}
+
+func (q *Queries) GetStudentFeeCharge(ctx context.Context, tenantID, id pgtype.UUID) (StudentFeeCharge, error) {
+	return q.getStudentFeeCharge(ctx, tenantID, id)
+}
+
+// ListStudentFeeCharges returns a source's charges for a period, cancelled
+// ones included.
+func (q *Queries) ListStudentFeeCharges(ctx context.Context, tenantID pgtype.UUID, source, period string) ([]StudentFeeCharge, error) {
+	query := `SELECT ` + studentFeeChargeColumns + `
+		FROM student_fee_charges c JOIN students s ON s.id = c.student_id
+		WHERE c.tenant_id = $1 AND c.source = $2 AND c.period = $3
+		ORDER BY s.full_name, c.source_key`
+	rows, err := q.db.Query(ctx, query, tenantID, source, period)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []StudentFeeCharge
+	for rows.Next() {
+		c, err := scanStudentFeeCharge(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+type PostStudentFeeChargeParams struct {
+	TenantID       pgtype.UUID
+	StudentID      pgtype.UUID
+	Source         string
+	SourceKey      string
+	Period         pgtype.Text
+	FeeHeadID      pgtype.UUID
+	AcademicYearID pgtype.UUID
+	Description    string
+	Amount         int64
+	DueDate        pgtype.Date
+	Details        []byte
+}
+
+// PostStudentFeeCharge raises a charge and posts it to the student's fee
+// ledger. A charge with the same source key must not exist yet.
+func (q *Queries) PostStudentFeeCharge(ctx context.Context, arg PostStudentFeeChargeParams) (StudentFeeCharge, error) {
+	var id pgtype.UUID
+	err := q.db.QueryRow(ctx, `
+		WITH plan AS (
+			INSERT INTO fee_plans (tenant_id, name, academic_year_id, total_amount)
+			VALUES ($1, $8, $7, $9)
+			RETURNING id
+		), item AS (
+			INSERT INTO fee_plan_items (plan_id, head_id, amount, due_date, info)
+			SELECT plan.id, $6, $9, $10, $3 FROM plan
+		), assigned AS (
+			INSERT INTO student_fee_plans (student_id, plan_id)
+			SELECT $2, plan.id FROM plan
+		)
+		INSERT INTO student_fee_charges (
+			tenant_id, student_id, source, source_key, period, fee_plan_id, fee_head_id,
+			academic_year_id, description, amount, due_date, details
+		)
+		SELECT $1, $2, $3, $4, $5, plan.id, $6, $7, $8, $9, $10, COALESCE($11::jsonb, '{}'::jsonb)
+		FROM plan
+		RETURNING id
+	`,
+		arg.TenantID, arg.StudentID, arg.Source, arg.SourceKey, arg.Period, arg.FeeHeadID,
+		arg.AcademicYearID, arg.Description, arg.Amount, arg.DueDate, arg.Details,
+	).Scan(&id)
+	if err != nil {
+		return StudentFeeCharge{}, err
+	}
+	return q.getStudentFeeCharge(ctx, arg.TenantID, id)
+}
+
+type UpdateStudentFeeChargeParams struct {
+	TenantID    pgtype.UUID
+	ID          pgtype.UUID
+	FeeHeadID   pgtype.UUID
+	Description string
+	Amount      int64
+	DueDate     pgtype.Date
+	Details     []byte
+}
+
+// UpdateStudentFeeCharge changes a charge and its ledger entry. A cancelled
+// charge is put back on the student's ledger.
+func (q *Queries) UpdateStudentFeeCharge(ctx context.Context, arg UpdateStudentFeeChargeParams) (StudentFeeCharge, error) {
+	var id pgtype.UUID
+	err := q.db.QueryRow(ctx, `
+		WITH charge AS (
+			UPDATE student_fee_charges
+			SET fee_head_id = $3, description = $4, amount = $5, due_date = $6,
+				details = COALESCE($7::jsonb, details), status = 'active', updated_at = NOW()
+			WHERE tenant_id = $1 AND id = $2
+			RETURNING id, student_id, fee_plan_id, source
+		), plan AS (
+			UPDATE fee_plans p SET name = $4, total_amount = $5
+			FROM charge WHERE p.id = charge.fee_plan_id
+		), other_heads AS (
+			DELETE FROM fee_plan_items i USING charge
+			WHERE i.plan_id = charge.fee_plan_id AND i.head_id <> $3
+		), item AS (
+			INSERT INTO fee_plan_items (plan_id, head_id, amount, due_date, info)
+			SELECT charge.fee_plan_id, $3, $5, $6, charge.source FROM charge
+			ON CONFLICT (plan_id, head_id) DO UPDATE SET amount = EXCLUDED.amount, due_date = EXCLUDED.due_date
+		), assigned AS (
+			INSERT INTO student_fee_plans (student_id, plan_id)
+			SELECT charge.student_id, charge.fee_plan_id FROM charge
+			ON CONFLICT (student_id, plan_id) DO NOTHING
+		)
+		SELECT id FROM charge
+	`, arg.TenantID, arg.ID, arg.FeeHeadID, arg.Description, arg.Amount, arg.DueDate, arg.Details).Scan(&id)
+	if err != nil {
+		return StudentFeeCharge{}, err
+	}
+	return q.getStudentFeeCharge(ctx, arg.TenantID, id)
+}
+
+// CancelStudentFeeCharge takes a charge off the student's ledger. The fee
+// plan is kept for history.
+func (q *Queries) CancelStudentFeeCharge(ctx context.Context, tenantID, id pgtype.UUID) (StudentFeeCharge, error) {
+	var chargeID pgtype.UUID
+	err := q.db.QueryRow(ctx, `
+		WITH charge AS (
+			UPDATE student_fee_charges SET status = 'cancelled', updated_at = NOW()
+			WHERE tenant_id = $1 AND id = $2 AND status = 'active'
+			RETURNING id, student_id, fee_plan_id
+		), unassigned AS (
+			DELETE FROM student_fee_plans sfp USING charge
+			WHERE sfp.student_id = charge.student_id AND sfp.plan_id = charge.fee_plan_id
+		)
+		SELECT id FROM charge
+	`, tenantID, id).Scan(&chargeID)
+	if err != nil {
+		return StudentFeeCharge{}, err
+	}
+	return q.getStudentFeeCharge(ctx, tenantID, chargeID)
+}
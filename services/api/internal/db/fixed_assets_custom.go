@@ -0,0 +1,782 @@
+package db
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Amounts on the asset register are NUMERIC rupees in the database and
+// are read and written here in paise.
+
+// Item asset profiles
+
+type InventoryItemAssetProfile struct {
+	ItemID              pgtype.UUID   `json:"item_id"`
+	ItemName            string        `json:"item_name"`
+	CategoryType        pgtype.Text   `json:"category_type"`
+	DepreciationMethod  pgtype.Text   `json:"depreciation_method"`
+	UsefulLifeMonths    pgtype.Int4   `json:"useful_life_months"`
+	DepreciationRatePct pgtype.Float8 `json:"depreciation_rate_pct"`
+	ResidualPct         pgtype.Float8 `json:"residual_pct"`
+}
+
+func (q *Queries) GetInventoryItemAssetProfile(ctx context.Context, tenantID, itemID pgtype.UUID) (InventoryItemAssetProfile, error) {
+	var p InventoryItemAssetProfile
+	err := q.db.QueryRow(ctx, `
+		SELECT i.id, i.name, c.type, i.depreciation_method, i.useful_life_months,
+			i.depreciation_rate_pct::FLOAT8, i.residual_pct::FLOAT8
+		FROM inventory_items i
+		LEFT JOIN inventory_categories c ON c.id = i.category_id
+		WHERE i.tenant_id = $1 AND i.id = $2
+	`, tenantID, itemID).Scan(
+		&p.ItemID, &p.ItemName, &p.CategoryType, &p.DepreciationMethod, &p.UsefulLifeMonths,
+		&p.DepreciationRatePct, &p.ResidualPct,
+	)
+	return p, err
+}
+
+type SetInventoryItemAssetProfileParams struct {
+	TenantID            pgtype.UUID
+	ItemID              pgtype.UUID
+	DepreciationMethod  string
+	UsefulLifeMonths    pgtype.Int4
+	DepreciationRatePct pgtype.Float8
+	ResidualPct         float64
+}
+
+// SetInventoryItemAssetProfile returns pgx.ErrNoRows when the item is not
+// the tenant's.
+func (q *Queries) SetInventoryItemAssetProfile(ctx context.Context, arg SetInventoryItemAssetProfileParams) error {
+	tag, err := q.db.Exec(ctx, `
+		UPDATE inventory_items
+		SET depreciation_method = $3, useful_life_months = $4, depreciation_rate_pct = $5, residual_pct = $6,
+			updated_at = NOW()
+		WHERE tenant_id = $1 AND id = $2
+	`, arg.TenantID, arg.ItemID, arg.DepreciationMethod, arg.UsefulLifeMonths, arg.DepreciationRatePct, arg.ResidualPct)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// Register
+
+type FixedAsset struct {
+	ID                      pgtype.UUID        `json:"id"`
+	TenantID                pgtype.UUID        `json:"tenant_id"`
+	ItemID                  pgtype.UUID        `json:"item_id"`
+	ItemName                string             `json:"item_name"`
+	AssetTag                string             `json:"asset_tag"`
+	Name                    string             `json:"name"`
+	SerialNumber            pgtype.Text        `json:"serial_number"`
+	Description             pgtype.Text        `json:"description"`
+	Room                    pgtype.Text        `json:"room"`
+	CustodianID             pgtype.UUID        `json:"custodian_id"`
+	CustodianName           pgtype.Text        `json:"custodian_name"`
+	SupplierID              pgtype.UUID        `json:"supplier_id"`
+	PoID                    pgtype.UUID        `json:"po_id"`
+	PurchaseDate            pgtype.Date        `json:"purchase_date"`
+	InServiceDate           pgtype.Date        `json:"in_service_date"`
+	Cost                    int64              `json:"cost"`
+	ResidualValue           int64              `json:"residual_value"`
+	DepreciationMethod      string             `json:"depreciation_method"`
+	UsefulLifeMonths        pgtype.Int4        `json:"useful_life_months"`
+	DepreciationRatePct     pgtype.Float8      `json:"depreciation_rate_pct"`
+	AccumulatedDepreciation int64              `json:"accumulated_depreciation"`
+	Status                  string             `json:"status"`
+	LastVerifiedOn          pgtype.Date        `json:"last_verified_on"`
+	DisposedOn              pgtype.Date        `json:"disposed_on"`
+	WarrantyEndsOn          pgtype.Date        `json:"warranty_ends_on"`
+	AmcEndsOn               pgtype.Date        `json:"amc_ends_on"`
+	CreatedBy               pgtype.UUID        `json:"created_by"`
+	CreatedAt               pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt               pgtype.Timestamptz `json:"updated_at"`
+}
+
+const fixedAssetSelect = `
+	SELECT a.id, a.tenant_id, a.item_id, i.name, a.asset_tag, a.name, a.serial_number, a.description, a.room,
+		a.custodian_id, e.full_name, a.supplier_id, a.po_id, a.purchase_date, a.in_service_date,
+		ROUND(a.cost * 100)::BIGINT, ROUND(a.residual_value * 100)::BIGINT, a.depreciation_method,
+		a.useful_life_months, a.depreciation_rate_pct::FLOAT8, ROUND(a.accumulated_depreciation * 100)::BIGINT,
+		a.status, a.last_verified_on, a.disposed_on,
+		(SELECT MAX(ends_on) FROM fixed_asset_contracts c WHERE c.asset_id = a.id AND c.kind = 'warranty'),
+		(SELECT MAX(ends_on) FROM fixed_asset_contracts c WHERE c.asset_id = a.id AND c.kind = 'amc'),
+		a.created_by, a.created_at, a.updated_at
+	FROM fixed_assets a
+	JOIN inventory_items i ON i.id = a.item_id
+	LEFT JOIN employees e ON e.id = a.custodian_id`
+
+func scanFixedAsset(row pgx.Row) (FixedAsset, error) {
+	var a FixedAsset
+	err := row.Scan(
+		&a.ID, &a.TenantID, &a.ItemID, &a.ItemName, &a.AssetTag, &a.Name, &a.SerialNumber, &a.Description, &a.Room,
+		&a.CustodianID, &a.CustodianName, &a.SupplierID, &a.PoID, &a.PurchaseDate, &a.InServiceDate,
+		&a.Cost, &a.ResidualValue, &a.DepreciationMethod,
+		&a.UsefulLifeMonths, &a.DepreciationRatePct, &a.AccumulatedDepreciation,
+		&a.Status, &a.LastVerifiedOn, &a.DisposedOn, &a.WarrantyEndsOn, &a.AmcEndsOn,
+		&a.CreatedBy, &a.CreatedAt, &a.UpdatedAt,
+	)
+	return a, err
+}
+
+func collectFixedAssets(rows pgx.Rows, err error) ([]FixedAsset, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []FixedAsset
+	for rows.Next() {
+		a, err := scanFixedAsset(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
+
+func (q *Queries) EmployeeExists(ctx context.Context, tenantID, id pgtype.UUID) (bool, error) {
+	var ok bool
+	err := q.db.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM employees WHERE tenant_id = $1 AND id = $2)`, tenantID, id).Scan(&ok)
+	return ok, err
+}
+
+// NextFixedAssetTag serialises tag numbering for the tenant until the
+// transaction ends and returns the next free AST- tag.
+func (q *Queries) NextFixedAssetTag(ctx context.Context, tenantID pgtype.UUID) (string, error) {
+	if _, err := q.db.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext('fixed_asset_tag:' || $1::text))`, tenantID); err != nil {
+		return "", err
+	}
+	var tag string
+	err := q.db.QueryRow(ctx, `
+		SELECT 'AST-' || lpad((COALESCE(MAX(substring(asset_tag FROM 5)::BIGINT), 0) + 1)::text, 6, '0')
+		FROM fixed_assets
+		WHERE tenant_id = $1 AND asset_tag ~ '^AST-[0-9]+$'
+	`, tenantID).Scan(&tag)
+	return tag, err
+}
+
+type CreateFixedAssetParams struct {
+	TenantID            pgtype.UUID
+	ItemID              pgtype.UUID
+	AssetTag            string
+	Name                string
+	SerialNumber        pgtype.Text
+	Description         pgtype.Text
+	Room                pgtype.Text
+	CustodianID         pgtype.UUID
+	SupplierID          pgtype.UUID
+	PoID                pgtype.UUID
+	PurchaseDate        pgtype.Date
+	InServiceDate       pgtype.Date
+	Cost                int64
+	ResidualValue       int64
+	DepreciationMethod  string
+	UsefulLifeMonths    pgtype.Int4
+	DepreciationRatePct pgtype.Float8
+	Status              string
+	CreatedBy           pgtype.UUID
+}
+
+func (q *Queries) CreateFixedAsset(ctx context.Context, arg CreateFixedAssetParams) (pgtype.UUID, error) {
+	var id pgtype.UUID
+	err := q.db.QueryRow(ctx, `
+		INSERT INTO fixed_assets (
+			tenant_id, item_id, asset_tag, name, serial_number, description, room, custodian_id, supplier_id, po_id,
+			purchase_date, in_service_date, cost, residual_value, depreciation_method, useful_life_months,
+			depreciation_rate_pct, status, created_by
+		) VALUES (
+			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10,
+			$11, $12, $13::BIGINT / 100.0, $14::BIGINT / 100.0, $15, $16,
+			$17, $18, $19
+		) RETURNING id
+	`,
+		arg.TenantID, arg.ItemID, arg.AssetTag, arg.Name, arg.SerialNumber, arg.Description, arg.Room, arg.CustodianID,
+		arg.SupplierID, arg.PoID, arg.PurchaseDate, arg.InServiceDate, arg.Cost, arg.ResidualValue,
+		arg.DepreciationMethod, arg.UsefulLifeMonths, arg.DepreciationRatePct, arg.Status, arg.CreatedBy,
+	).Scan(&id)
+	return id, err
+}
+
+func (q *Queries) GetFixedAsset(ctx context.Context, tenantID, id pgtype.UUID) (FixedAsset, error) {
+	return scanFixedAsset(q.db.QueryRow(ctx, fixedAssetSelect+` WHERE a.tenant_id = $1 AND a.id = $2`, tenantID, id))
+}
+
+func (q *Queries) LockFixedAsset(ctx context.Context, tenantID, id pgtype.UUID) (FixedAsset, error) {
+	return scanFixedAsset(q.db.QueryRow(ctx, fixedAssetSelect+` WHERE a.tenant_id = $1 AND a.id = $2 FOR UPDATE OF a`, tenantID, id))
+}
+
+func (q *Queries) GetFixedAssetByTag(ctx context.Context, tenantID pgtype.UUID, tag string) (FixedAsset, error) {
+	return scanFixedAsset(q.db.QueryRow(ctx, fixedAssetSelect+` WHERE a.tenant_id = $1 AND a.asset_tag = $2`, tenantID, tag))
+}
+
+type ListFixedAssetsParams struct {
+	TenantID    pgtype.UUID
+	ItemID      pgtype.UUID
+	CustodianID pgtype.UUID
+	Status      pgtype.Text
+	Room        pgtype.Text
+	Search      pgtype.Text
+	Limit       int32
+	Offset      int32
+}
+
+func (q *Queries) ListFixedAssets(ctx context.Context, arg ListFixedAssetsParams) ([]FixedAsset, error) {
+	return collectFixedAssets(q.db.Query(ctx, fixedAssetSelect+`
+		WHERE a.tenant_id = $1
+			AND ($2::UUID IS NULL OR a.item_id = $2)
+			AND ($3::UUID IS NULL OR a.custodian_id = $3)
+			AND ($4::TEXT IS NULL OR a.status = $4)
+			AND ($5::TEXT IS NULL OR lower(a.room) = lower($5))
+			AND ($6::TEXT IS NULL OR a.asset_tag ILIKE '%' || $6 || '%' OR a.name ILIKE '%' || $6 || '%'
+				OR a.serial_number ILIKE '%' || $6 || '%')
+		ORDER BY a.asset_tag
+		LIMIT $7 OFFSET $8
+	`, arg.TenantID, arg.ItemID, arg.CustodianID, arg.Status, arg.Room, arg.Search, arg.Limit, arg.Offset))
+}
+
+// ListDepreciableFixedAssets returns the assets in service by through that
+// have not been disposed of, locked for posting.
+func (q *Queries) ListDepreciableFixedAssets(ctx context.Context, tenantID pgtype.UUID, through pgtype.Date) ([]FixedAsset, error) {
+	return collectFixedAssets(q.db.Query(ctx, fixedAssetSelect+`
+		WHERE a.tenant_id = $1 AND a.status <> 'disposed' AND a.in_service_date <= $2
+		ORDER BY a.asset_tag
+		FOR UPDATE OF a
+	`, tenantID, through))
+}
+
+func (q *Queries) SetFixedAssetPlacement(ctx context.Context, id pgtype.UUID, room pgtype.Text, custodianID pgtype.UUID, status string) error {
+	_, err := q.db.Exec(ctx, `
+		UPDATE fixed_assets SET room = $2, custodian_id = $3, status = $4, updated_at = NOW() WHERE id = $1
+	`, id, room, custodianID, status)
+	return err
+}
+
+func (q *Queries) SetFixedAssetVerified(ctx context.Context, id pgtype.UUID, on pgtype.Date) error {
+	_, err := q.db.Exec(ctx, `UPDATE fixed_assets SET last_verified_on = $2, updated_at = NOW() WHERE id = $1`, id, on)
+	return err
+}
+
+func (q *Queries) SetFixedAssetDisposed(ctx context.Context, id pgtype.UUID, on pgtype.Date) error {
+	_, err := q.db.Exec(ctx, `
+		UPDATE fixed_assets SET status = 'disposed', disposed_on = $2, updated_at = NOW() WHERE id = $1
+	`, id, on)
+	return err
+}
+
+// Movements
+
+type CreateFixedAssetMovementParams struct {
+	TenantID        pgtype.UUID
+	AssetID         pgtype.UUID
+	FromRoom        pgtype.Text
+	ToRoom          pgtype.Text
+	FromCustodianID pgtype.UUID
+	ToCustodianID   pgtype.UUID
+	FromStatus      pgtype.Text
+	ToStatus        string
+	Reason          pgtype.Text
+	MovedBy         pgtype.UUID
+}
+
+func (q *Queries) CreateFixedAssetMovement(ctx context.Context, arg CreateFixedAssetMovementParams) error {
+	_, err := q.db.Exec(ctx, `
+		INSERT INTO fixed_asset_movements (
+			tenant_id, asset_id, from_room, to_room, from_custodian_id, to_custodian_id, from_status, to_status,
+			reason, moved_by
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	`, arg.TenantID, arg.AssetID, arg.FromRoom, arg.ToRoom, arg.FromCustodianID, arg.ToCustodianID,
+		arg.FromStatus, arg.ToStatus, arg.Reason, arg.MovedBy)
+	return err
+}
+
+type FixedAssetMovement struct {
+	ID                pgtype.UUID        `json:"id"`
+	FromRoom          pgtype.Text        `json:"from_room"`
+	ToRoom            pgtype.Text        `json:"to_room"`
+	FromCustodianID   pgtype.UUID        `json:"from_custodian_id"`
+	FromCustodianName pgtype.Text        `json:"from_custodian_name"`
+	ToCustodianID     pgtype.UUID        `json:"to_custodian_id"`
+	ToCustodianName   pgtype.Text        `json:"to_custodian_name"`
+	FromStatus        pgtype.Text        `json:"from_status"`
+	ToStatus          string             `json:"to_status"`
+	Reason            pgtype.Text        `json:"reason"`
+	MovedBy           pgtype.UUID        `json:"moved_by"`
+	MovedAt           pgtype.Timestamptz `json:"moved_at"`
+}
+
+func (q *Queries) ListFixedAssetMovements(ctx context.Context, assetID pgtype.UUID) ([]FixedAssetMovement, error) {
+	rows, err := q.db.Query(ctx, `
+		SELECT m.id, m.from_room, m.to_room, m.from_custodian_id, fe.full_name, m.to_custodian_id, te.full_name,
+			m.from_status, m.to_status, m.reason, m.moved_by, m.moved_at
+		FROM fixed_asset_movements m
+		LEFT JOIN employees fe ON fe.id = m.from_custodian_id
+		LEFT JOIN employees te ON te.id = m.to_custodian_id
+		WHERE m.asset_id = $1
+		ORDER BY m.moved_at, m.id
+	`, assetID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []FixedAssetMovement
+	for rows.Next() {
+		var m FixedAssetMovement
+		if err := rows.Scan(
+			&m.ID, &m.FromRoom, &m.ToRoom, &m.FromCustodianID, &m.FromCustodianName, &m.ToCustodianID, &m.ToCustodianName,
+			&m.FromStatus, &m.ToStatus, &m.Reason, &m.MovedBy, &m.MovedAt,
+		); err != nil {
+			return nil, err
+		}
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
+
+// Warranties and AMCs
+
+type FixedAssetContract struct {
+	ID        pgtype.UUID        `json:"id"`
+	AssetID   pgtype.UUID        `json:"asset_id"`
+	AssetTag  string             `json:"asset_tag"`
+	AssetName string             `json:"asset_name"`
+	Kind      string             `json:"kind"`
+	Provider  string             `json:"provider"`
+	Reference pgtype.Text        `json:"reference"`
+	StartsOn  pgtype.Date        `json:"starts_on"`
+	EndsOn    pgtype.Date        `json:"ends_on"`
+	Cost      int64              `json:"cost"`
+	Coverage  pgtype.Text        `json:"coverage"`
+	CreatedBy pgtype.UUID        `json:"created_by"`
+	CreatedAt pgtype.Timestamptz `json:"created_at"`
+}
+
+const fixedAssetContractSelect = `
+	SELECT c.id, c.asset_id, a.asset_tag, a.name, c.kind, c.provider, c.reference, c.starts_on, c.ends_on,
+		ROUND(c.cost * 100)::BIGINT, c.coverage, c.created_by, c.created_at
+	FROM fixed_asset_contracts c
+	JOIN fixed_assets a ON a.id = c.asset_id`
+
+func collectFixedAssetContracts(rows pgx.Rows, err error) ([]FixedAssetContract, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []FixedAssetContract
+	for rows.Next() {
+		var c FixedAssetContract
+		if err := rows.Scan(
+			&c.ID, &c.AssetID, &c.AssetTag, &c.AssetName, &c.Kind, &c.Provider, &c.Reference, &c.StartsOn, &c.EndsOn,
+			&c.Cost, &c.Coverage, &c.CreatedBy, &c.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+type CreateFixedAssetContractParams struct {
+	TenantID  pgtype.UUID
+	AssetID   pgtype.UUID
+	Kind      string
+	Provider  string
+	Reference pgtype.Text
+	StartsOn  pgtype.Date
+	EndsOn    pgtype.Date
+	Cost      int64
+	Coverage  pgtype.Text
+	CreatedBy pgtype.UUID
+}
+
+func (q *Queries) CreateFixedAssetContract(ctx context.Context, arg CreateFixedAssetContractParams) (pgtype.UUID, error) {
+	var id pgtype.UUID
+	err := q.db.QueryRow(ctx, `
+		INSERT INTO fixed_asset_contracts (
+			tenant_id, asset_id, kind, provider, reference, starts_on, ends_on, cost, coverage, created_by
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8::BIGINT / 100.0, $9, $10)
+		RETURNING id
+	`, arg.TenantID, arg.AssetID, arg.Kind, arg.Provider, arg.Reference, arg.StartsOn, arg.EndsOn, arg.Cost,
+		arg.Coverage, arg.CreatedBy).Scan(&id)
+	return id, err
+}
+
+func (q *Queries) ListFixedAssetContracts(ctx context.Context, assetID pgtype.UUID) ([]FixedAssetContract, error) {
+	return collectFixedAssetContracts(q.db.Query(ctx, fixedAssetContractSelect+`
+		WHERE c.asset_id = $1 ORDER BY c.ends_on DESC`, assetID))
+}
+
+// ListExpiringFixedAssetContracts returns the warranties and AMCs of assets
+// still held that end between from and to, the latest per asset and kind
+// only, so a renewed contract does not show as expiring.
+func (q *Queries) ListExpiringFixedAssetContracts(ctx context.Context, tenantID pgtype.UUID, from, to pgtype.Date) ([]FixedAssetContract, error) {
+	return collectFixedAssetContracts(q.db.Query(ctx, fixedAssetContractSelect+`
+		WHERE c.tenant_id = $1 AND a.status <> 'disposed' AND c.ends_on BETWEEN $2 AND $3
+			AND NOT EXISTS (
+				SELECT 1 FROM fixed_asset_contracts n
+				WHERE n.asset_id = c.asset_id AND n.kind = c.kind AND n.ends_on > c.ends_on
+			)
+		ORDER BY c.ends_on, a.asset_tag
+	`, tenantID, from, to))
+}
+
+// Depreciation
+
+type FixedAssetDepreciation struct {
+	ID            pgtype.UUID        `json:"id"`
+	AssetID       pgtype.UUID        `json:"asset_id"`
+	AssetTag      string             `json:"asset_tag"`
+	AssetName     string             `json:"asset_name"`
+	FinancialYear int32              `json:"financial_year"`
+	PeriodStart   pgtype.Date        `json:"period_start"`
+	PeriodEnd     pgtype.Date        `json:"period_end"`
+	OpeningValue  int64              `json:"opening_value"`
+	Amount        int64              `json:"amount"`
+	ClosingValue  int64              `json:"closing_value"`
+	PostedBy      pgtype.UUID        `json:"posted_by"`
+	PostedAt      pgtype.Timestamptz `json:"posted_at"`
+}
+
+const fixedAssetDepreciationSelect = `
+	SELECT d.id, d.asset_id, a.asset_tag, a.name, d.financial_year, d.period_start, d.period_end,
+		ROUND(d.opening_value * 100)::BIGINT, ROUND(d.amount * 100)::BIGINT, ROUND(d.closing_value * 100)::BIGINT,
+		d.posted_by, d.posted_at
+	FROM fixed_asset_depreciation d
+	JOIN fixed_assets a ON a.id = d.asset_id`
+
+func collectFixedAssetDepreciation(rows pgx.Rows, err error) ([]FixedAssetDepreciation, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []FixedAssetDepreciation
+	for rows.Next() {
+		var d FixedAssetDepreciation
+		if err := rows.Scan(
+			&d.ID, &d.AssetID, &d.AssetTag, &d.AssetName, &d.FinancialYear, &d.PeriodStart, &d.PeriodEnd,
+			&d.OpeningValue, &d.Amount, &d.ClosingValue, &d.PostedBy, &d.PostedAt,
+		); err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+func (q *Queries) ListFixedAssetDepreciation(ctx context.Context, assetID pgtype.UUID) ([]FixedAssetDepreciation, error) {
+	return collectFixedAssetDepreciation(q.db.Query(ctx, fixedAssetDepreciationSelect+`
+		WHERE d.asset_id = $1 ORDER BY d.financial_year`, assetID))
+}
+
+func (q *Queries) ListFixedAssetDepreciationForYear(ctx context.Context, tenantID pgtype.UUID, financialYear int32) ([]FixedAssetDepreciation, error) {
+	return collectFixedAssetDepreciation(q.db.Query(ctx, fixedAssetDepreciationSelect+`
+		WHERE d.tenant_id = $1 AND d.financial_year = $2 ORDER BY a.asset_tag`, tenantID, financialYear))
+}
+
+type CreateFixedAssetDepreciationParams struct {
+	TenantID      pgtype.UUID
+	AssetID       pgtype.UUID
+	FinancialYear int32
+	PeriodStart   pgtype.Date
+	PeriodEnd     pgtype.Date
+	OpeningValue  int64
+	Amount        int64
+	ClosingValue  int64
+	PostedBy      pgtype.UUID
+}
+
+// CreateFixedAssetDepreciation posts a year's charge and brings the
+// asset's accumulated depreciation in line with it. A year already posted
+// is left as it is and reported as not posted.
+func (q *Queries) CreateFixedAssetDepreciation(ctx context.Context, arg CreateFixedAssetDepreciationParams) (bool, error) {
+	tag, err := q.db.Exec(ctx, `
+		INSERT INTO fixed_asset_depreciation (
+			tenant_id, asset_id, financial_year, period_start, period_end, opening_value, amount, closing_value, posted_by
+		) VALUES ($1, $2, $3, $4, $5, $6::BIGINT / 100.0, $7::BIGINT / 100.0, $8::BIGINT / 100.0, $9)
+		ON CONFLICT (asset_id, financial_year) DO NOTHING
+	`, arg.TenantID, arg.AssetID, arg.FinancialYear, arg.PeriodStart, arg.PeriodEnd, arg.OpeningValue, arg.Amount,
+		arg.ClosingValue, arg.PostedBy)
+	if err != nil || tag.RowsAffected() == 0 {
+		return false, err
+	}
+	_, err = q.db.Exec(ctx, `
+		UPDATE fixed_assets
+		SET accumulated_depreciation = (SELECT COALESCE(SUM(amount), 0) FROM fixed_asset_depreciation WHERE asset_id = $1),
+			updated_at = NOW()
+		WHERE id = $1
+	`, arg.AssetID)
+	return err == nil, err
+}
+
+// Disposals
+
+type FixedAssetDisposal struct {
+	ID                pgtype.UUID        `json:"id"`
+	TenantID          pgtype.UUID        `json:"tenant_id"`
+	AssetID           pgtype.UUID        `json:"asset_id"`
+	AssetTag          string             `json:"asset_tag"`
+	AssetName         string             `json:"asset_name"`
+	Method            string             `json:"method"`
+	DisposalDate      pgtype.Date        `json:"disposal_date"`
+	Proceeds          int64              `json:"proceeds"`
+	BookValue         int64              `json:"book_value"`
+	Reason            string             `json:"reason"`
+	Status            string             `json:"status"`
+	ApprovalRequestID pgtype.UUID        `json:"approval_request_id"`
+	RequestedBy       pgtype.UUID        `json:"requested_by"`
+	RequestedAt       pgtype.Timestamptz `json:"requested_at"`
+	DecidedBy         pgtype.UUID        `json:"decided_by"`
+	DecidedAt         pgtype.Timestamptz `json:"decided_at"`
+	Remark            pgtype.Text        `json:"remark"`
+}
+
+const fixedAssetDisposalSelect = `
+	SELECT d.id, d.tenant_id, d.asset_id, a.asset_tag, a.name, d.method, d.disposal_date,
+		ROUND(d.proceeds * 100)::BIGINT, ROUND(d.book_value * 100)::BIGINT, d.reason, d.status,
+		d.approval_request_id, d.requested_by, d.requested_at, d.decided_by, d.decided_at, d.remark
+	FROM fixed_asset_disposals d
+	JOIN fixed_assets a ON a.id = d.asset_id`
+
+func scanFixedAssetDisposal(row pgx.Row) (FixedAssetDisposal, error) {
+	var d FixedAssetDisposal
+	err := row.Scan(
+		&d.ID, &d.TenantID, &d.AssetID, &d.AssetTag, &d.AssetName, &d.Method, &d.DisposalDate,
+		&d.Proceeds, &d.BookValue, &d.Reason, &d.Status,
+		&d.ApprovalRequestID, &d.RequestedBy, &d.RequestedAt, &d.DecidedBy, &d.DecidedAt, &d.Remark,
+	)
+	return d, err
+}
+
+type CreateFixedAssetDisposalParams struct {
+	TenantID          pgtype.UUID
+	AssetID           pgtype.UUID
+	Method            string
+	DisposalDate      pgtype.Date
+	Proceeds          int64
+	BookValue         int64
+	Reason            string
+	ApprovalRequestID pgtype.UUID
+	RequestedBy       pgtype.UUID
+}
+
+func (q *Queries) CreateFixedAssetDisposal(ctx context.Context, arg CreateFixedAssetDisposalParams) (pgtype.UUID, error) {
+	var id pgtype.UUID
+	err := q.db.QueryRow(ctx, `
+		INSERT INTO fixed_asset_disposals (
+			tenant_id, asset_id, method, disposal_date, proceeds, book_value, reason, approval_request_id, requested_by
+		) VALUES ($1, $2, $3, $4, $5::BIGINT / 100.0, $6::BIGINT / 100.0, $7, $8, $9)
+		RETURNING id
+	`, arg.TenantID, arg.AssetID, arg.Method, arg.DisposalDate, arg.Proceeds, arg.BookValue, arg.Reason,
+		arg.ApprovalRequestID, arg.RequestedBy).Scan(&id)
+	return id, err
+}
+
+func (q *Queries) GetFixedAssetDisposal(ctx context.Context, tenantID, id pgtype.UUID) (FixedAssetDisposal, error) {
+	return scanFixedAssetDisposal(q.db.QueryRow(ctx, fixedAssetDisposalSelect+` WHERE d.tenant_id = $1 AND d.id = $2`, tenantID, id))
+}
+
+func (q *Queries) LockFixedAssetDisposal(ctx context.Context, tenantID, id pgtype.UUID) (FixedAssetDisposal, error) {
+	return scanFixedAssetDisposal(q.db.QueryRow(ctx, fixedAssetDisposalSelect+`
+		WHERE d.tenant_id = $1 AND d.id = $2 FOR UPDATE OF d`, tenantID, id))
+}
+
+func (q *Queries) ListFixedAssetDisposals(ctx context.Context, tenantID pgtype.UUID, status pgtype.Text) ([]FixedAssetDisposal, error) {
+	rows, err := q.db.Query(ctx, fixedAssetDisposalSelect+`
+		WHERE d.tenant_id = $1 AND ($2::TEXT IS NULL OR d.status = $2)
+		ORDER BY d.requested_at DESC
+	`, tenantID, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []FixedAssetDisposal
+	for rows.Next() {
+		d, err := scanFixedAssetDisposal(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+func (q *Queries) SettleFixedAssetDisposal(ctx context.Context, id pgtype.UUID, status string, bookValue int64, by pgtype.UUID, remark pgtype.Text) error {
+	_, err := q.db.Exec(ctx, `
+		UPDATE fixed_asset_disposals
+		SET status = $2, book_value = $3::BIGINT / 100.0, decided_by = $4, decided_at = NOW(), remark = $5
+		WHERE id = $1
+	`, id, status, bookValue, by, remark)
+	return err
+}
+
+// Verification
+
+type FixedAssetVerification struct {
+	ID            pgtype.UUID        `json:"id"`
+	TenantID      pgtype.UUID        `json:"tenant_id"`
+	FinancialYear int32              `json:"financial_year"`
+	Title         string             `json:"title"`
+	Status        string             `json:"status"`
+	Notes         pgtype.Text        `json:"notes"`
+	StartedBy     pgtype.UUID        `json:"started_by"`
+	StartedAt     pgtype.Timestamptz `json:"started_at"`
+	ClosedBy      pgtype.UUID        `json:"closed_by"`
+	ClosedAt      pgtype.Timestamptz `json:"closed_at"`
+	Assets        int64              `json:"assets"`
+	Found         int64              `json:"found"`
+	Damaged       int64              `json:"damaged"`
+	Missing       int64              `json:"missing"`
+	Pending       int64              `json:"pending"`
+}
+
+const fixedAssetVerificationSelect = `
+	SELECT v.id, v.tenant_id, v.financial_year, v.title, v.status, v.notes, v.started_by, v.started_at,
+		v.closed_by, v.closed_at,
+		(SELECT COUNT(*) FROM fixed_asset_verification_items i WHERE i.verification_id = v.id),
+		(SELECT COUNT(*) FROM fixed_asset_verification_items i WHERE i.verification_id = v.id AND i.result = 'found'),
+		(SELECT COUNT(*) FROM fixed_asset_verification_items i WHERE i.verification_id = v.id AND i.result = 'damaged'),
+		(SELECT COUNT(*) FROM fixed_asset_verification_items i WHERE i.verification_id = v.id AND i.result = 'missing'),
+		(SELECT COUNT(*) FROM fixed_asset_verification_items i WHERE i.verification_id = v.id AND i.result = 'pending')
+	FROM fixed_asset_verifications v`
+
+func scanFixedAssetVerification(row pgx.Row) (FixedAssetVerification, error) {
+	var v FixedAssetVerification
+	err := row.Scan(
+		&v.ID, &v.TenantID, &v.FinancialYear, &v.Title, &v.Status, &v.Notes, &v.StartedBy, &v.StartedAt,
+		&v.ClosedBy, &v.ClosedAt, &v.Assets, &v.Found, &v.Damaged, &v.Missing, &v.Pending,
+	)
+	return v, err
+}
+
+// CreateFixedAssetVerification opens a round for the year and lists every
+// asset still held, with where it should be.
+func (q *Queries) CreateFixedAssetVerification(ctx context.Context, tenantID pgtype.UUID, financialYear int32, title string, notes pgtype.Text, by pgtype.UUID) (pgtype.UUID, error) {
+	var id pgtype.UUID
+	err := q.db.QueryRow(ctx, `
+		INSERT INTO fixed_asset_verifications (tenant_id, financial_year, title, notes, started_by)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id
+	`, tenantID, financialYear, title, notes, by).Scan(&id)
+	if err != nil {
+		return id, err
+	}
+	_, err = q.db.Exec(ctx, `
+		INSERT INTO fixed_asset_verification_items (verification_id, asset_id, expected_room, expected_custodian_id)
+		SELECT $1, id, room, custodian_id FROM fixed_assets WHERE tenant_id = $2 AND status <> 'disposed'
+	`, id, tenantID)
+	return id, err
+}
+
+func (q *Queries) GetFixedAssetVerification(ctx context.Context, tenantID, id pgtype.UUID) (FixedAssetVerification, error) {
+	return scanFixedAssetVerification(q.db.QueryRow(ctx, fixedAssetVerificationSelect+`
+		WHERE v.tenant_id = $1 AND v.id = $2`, tenantID, id))
+}
+
+func (q *Queries) LockFixedAssetVerification(ctx context.Context, tenantID, id pgtype.UUID) (FixedAssetVerification, error) {
+	return scanFixedAssetVerification(q.db.QueryRow(ctx, fixedAssetVerificationSelect+`
+		WHERE v.tenant_id = $1 AND v.id = $2 FOR UPDATE OF v`, tenantID, id))
+}
+
+func (q *Queries) ListFixedAssetVerifications(ctx context.Context, tenantID pgtype.UUID) ([]FixedAssetVerification, error) {
+	rows, err := q.db.Query(ctx, fixedAssetVerificationSelect+`
+		WHERE v.tenant_id = $1 ORDER BY v.financial_year DESC`, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []FixedAssetVerification
+	for rows.Next() {
+		v, err := scanFixedAssetVerification(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, rows.Err()
+}
+
+type FixedAssetVerificationItem struct {
+	AssetID               pgtype.UUID        `json:"asset_id"`
+	AssetTag              string             `json:"asset_tag"`
+	AssetName             string             `json:"asset_name"`
+	ExpectedRoom          pgtype.Text        `json:"expected_room"`
+	ExpectedCustodianID   pgtype.UUID        `json:"expected_custodian_id"`
+	ExpectedCustodianName pgtype.Text        `json:"expected_custodian_name"`
+	Result                string             `json:"result"`
+	FoundRoom             pgtype.Text        `json:"found_room"`
+	Remarks               pgtype.Text        `json:"remarks"`
+	VerifiedBy            pgtype.UUID        `json:"verified_by"`
+	VerifiedAt            pgtype.Timestamptz `json:"verified_at"`
+}
+
+func (q *Queries) ListFixedAssetVerificationItems(ctx context.Context, verificationID pgtype.UUID) ([]FixedAssetVerificationItem, error) {
+	rows, err := q.db.Query(ctx, `
+		SELECT i.asset_id, a.asset_tag, a.name, i.expected_room, i.expected_custodian_id, e.full_name,
+			i.result, i.found_room, i.remarks, i.verified_by, i.verified_at
+		FROM fixed_asset_verification_items i
+		JOIN fixed_assets a ON a.id = i.asset_id
+		LEFT JOIN employees e ON e.id = i.expected_custodian_id
+		WHERE i.verification_id = $1
+		ORDER BY i.expected_room NULLS LAST, a.asset_tag
+	`, verificationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []FixedAssetVerificationItem
+	for rows.Next() {
+		var i FixedAssetVerificationItem
+		if err := rows.Scan(
+			&i.AssetID, &i.AssetTag, &i.AssetName, &i.ExpectedRoom, &i.ExpectedCustodianID, &i.ExpectedCustodianName,
+			&i.Result, &i.FoundRoom, &i.Remarks, &i.VerifiedBy, &i.VerifiedAt,
+		); err != nil {
+			return nil, err
+		}
+		out = append(out, i)
+	}
+	return out, rows.Err()
+}
+
+// RecordFixedAssetVerification returns pgx.ErrNoRows when the asset is not
+// in the round.
+func (q *Queries) RecordFixedAssetVerification(ctx context.Context, verificationID, assetID pgtype.UUID, result string, foundRoom, remarks pgtype.Text, by pgtype.UUID) error {
+	tag, err := q.db.Exec(ctx, `
+		UPDATE fixed_asset_verification_items
+		SET result = $3, found_room = $4, remarks = $5, verified_by = $6, verified_at = NOW()
+		WHERE verification_id = $1 AND asset_id = $2
+	`, verificationID, assetID, result, foundRoom, remarks, by)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// CloseFixedAssetVerification marks whatever was not checked as missing
+// and closes the round.
+func (q *Queries) CloseFixedAssetVerification(ctx context.Context, id, by pgtype.UUID) error {
+	if _, err := q.db.Exec(ctx, `
+		UPDATE fixed_asset_verification_items SET result = 'missing', remarks = COALESCE(remarks, 'Not found by the close of verification')
+		WHERE verification_id = $1 AND result = 'pending'
+	`, id); err != nil {
+		return err
+	}
+	_, err := q.db.Exec(ctx, `
+		UPDATE fixed_asset_verifications SET status = 'closed', closed_by = $2, closed_at = NOW() WHERE id = $1
+	`, id, by)
+	return err
+}
@@ -0,0 +1,997 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Rooms and beds
+
+// HostelRoomLock is a room held for update while a bed in it is allotted.
+type HostelRoomLock struct {
+	ID         pgtype.UUID
+	BuildingID pgtype.UUID
+	RoomNumber string
+	Capacity   int32
+	Occupancy  int32
+	Active     bool
+}
+
+// LockHostelRoom locks a room of the tenant so allocations to it happen one
+// at a time. Active is false when the room or its building is closed.
+func (q *Queries) LockHostelRoom(ctx context.Context, tenantID, roomID pgtype.UUID) (HostelRoomLock, error) {
+	var r HostelRoomLock
+	err := q.db.QueryRow(ctx, `
+		SELECT r.id, r.building_id, r.room_number, r.capacity, COALESCE(r.occupancy, 0),
+			COALESCE(r.is_active, TRUE) AND COALESCE(b.is_active, TRUE)
+		FROM hostel_rooms r JOIN hostel_buildings b ON b.id = r.building_id
+		WHERE r.tenant_id = $1 AND r.id = $2
+		FOR UPDATE OF r
+	`, tenantID, roomID).Scan(&r.ID, &r.BuildingID, &r.RoomNumber, &r.Capacity, &r.Occupancy, &r.Active)
+	return r, err
+}
+
+// CreateHostelBeds adds beds labelled B<from> onwards to a room.
+func (q *Queries) CreateHostelBeds(ctx context.Context, tenantID, roomID pgtype.UUID, from, count int32) error {
+	_, err := q.db.Exec(ctx, `
+		INSERT INTO hostel_beds (tenant_id, room_id, label)
+		SELECT $1, $2, 'B' || g FROM generate_series($3::int, $3::int + $4::int - 1) g
+		ON CONFLICT (room_id, label) DO NOTHING
+	`, tenantID, roomID, from, count)
+	return err
+}
+
+type HostelBed struct {
+	ID           pgtype.UUID `json:"id"`
+	RoomID       pgtype.UUID `json:"room_id"`
+	Label        string      `json:"label"`
+	IsActive     bool        `json:"is_active"`
+	AllocationID pgtype.UUID `json:"allocation_id"`
+	StudentID    pgtype.UUID `json:"student_id"`
+	StudentName  pgtype.Text `json:"student_name"`
+}
+
+// ListHostelBeds returns a room's beds with whoever holds them.
+func (q *Queries) ListHostelBeds(ctx context.Context, tenantID, roomID pgtype.UUID) ([]HostelBed, error) {
+	rows, err := q.db.Query(ctx, `
+		SELECT bd.id, bd.room_id, bd.label, bd.is_active, a.id, a.student_id, s.full_name
+		FROM hostel_beds bd
+		LEFT JOIN hostel_allocations a ON a.bed_id = bd.id AND a.status = 'active'
+		LEFT JOIN students s ON s.id = a.student_id
+		WHERE bd.tenant_id = $1 AND bd.room_id = $2
+		ORDER BY length(bd.label), bd.label
+	`, tenantID, roomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []HostelBed
+	for rows.Next() {
+		var b HostelBed
+		if err := rows.Scan(&b.ID, &b.RoomID, &b.Label, &b.IsActive, &b.AllocationID, &b.StudentID, &b.StudentName); err != nil {
+			return nil, err
+		}
+		out = append(out, b)
+	}
+	return out, rows.Err()
+}
+
+// LockFreeHostelBed locks an open bed in the room nobody holds: the one
+// asked for, or else the first by label. ErrNoRows means there is none.
+func (q *Queries) LockFreeHostelBed(ctx context.Context, tenantID, roomID, bedID pgtype.UUID) (HostelBed, error) {
+	var b HostelBed
+	err := q.db.QueryRow(ctx, `
+		SELECT bd.id, bd.room_id, bd.label, bd.is_active
+		FROM hostel_beds bd
+		WHERE bd.tenant_id = $1 AND bd.room_id = $2 AND bd.is_active
+		  AND ($3::uuid IS NULL OR bd.id = $3)
+		  AND NOT EXISTS (
+			SELECT 1 FROM hostel_allocations a WHERE a.bed_id = bd.id AND a.status = 'active'
+		  )
+		ORDER BY length(bd.label), bd.label
+		LIMIT 1
+		FOR UPDATE
+	`, tenantID, roomID, bedID).Scan(&b.ID, &b.RoomID, &b.Label, &b.IsActive)
+	return b, err
+}
+
+// Allocations
+
+// HostelAllocationRecord is an allocation row as the service works with it.
+type HostelAllocationRecord struct {
+	ID         pgtype.UUID
+	RoomID     pgtype.UUID
+	BuildingID pgtype.UUID
+	BedID      pgtype.UUID
+	StudentID  pgtype.UUID
+	Status     string
+	AllottedOn pgtype.Date
+	VacatedOn  pgtype.Date
+}
+
+const hostelAllocationRecordColumns = `
+	a.id, a.room_id, r.building_id, a.bed_id, a.student_id, COALESCE(a.status, 'active'), a.allotted_on, a.vacated_on`
+
+func scanHostelAllocationRecord(row pgx.Row) (HostelAllocationRecord, error) {
+	var a HostelAllocationRecord
+	err := row.Scan(&a.ID, &a.RoomID, &a.BuildingID, &a.BedID, &a.StudentID, &a.Status, &a.AllottedOn, &a.VacatedOn)
+	return a, err
+}
+
+// GetActiveHostelAllocation returns the student's current allocation.
+func (q *Queries) GetActiveHostelAllocation(ctx context.Context, tenantID, studentID pgtype.UUID) (HostelAllocationRecord, error) {
+	query := `SELECT ` + hostelAllocationRecordColumns + `
+		FROM hostel_allocations a JOIN hostel_rooms r ON r.id = a.room_id
+		WHERE a.tenant_id = $1 AND a.student_id = $2 AND a.status = 'active'`
+	return scanHostelAllocationRecord(q.db.QueryRow(ctx, query, tenantID, studentID))
+}
+
+func (q *Queries) LockHostelAllocation(ctx context.Context, tenantID, id pgtype.UUID) (HostelAllocationRecord, error) {
+	query := `SELECT ` + hostelAllocationRecordColumns + `
+		FROM hostel_allocations a JOIN hostel_rooms r ON r.id = a.room_id
+		WHERE a.tenant_id = $1 AND a.id = $2
+		FOR UPDATE OF a`
+	return scanHostelAllocationRecord(q.db.QueryRow(ctx, query, tenantID, id))
+}
+
+type CreateHostelAllocationParams struct {
+	TenantID   pgtype.UUID
+	RoomID     pgtype.UUID
+	BedID      pgtype.UUID
+	StudentID  pgtype.UUID
+	AllottedOn pgtype.Date
+	AllottedBy pgtype.UUID
+	Remarks    pgtype.Text
+}
+
+// CreateHostelAllocation allots a bed and counts the student into the
+// room. It returns ErrNoRows when the student is not the tenant's.
+func (q *Queries) CreateHostelAllocation(ctx context.Context, arg CreateHostelAllocationParams) (pgtype.UUID, error) {
+	var id pgtype.UUID
+	err := q.db.QueryRow(ctx, `
+		WITH a AS (
+			INSERT INTO hostel_allocations (tenant_id, room_id, bed_id, student_id, allotted_on, allotted_by, remarks)
+			SELECT $1, $2, $3, s.id, $5, $6, $7
+			FROM students s WHERE s.tenant_id = $1 AND s.id = $4
+			RETURNING id, room_id
+		), occupancy AS (
+			UPDATE hostel_rooms r SET occupancy = COALESCE(r.occupancy, 0) + 1
+			FROM a WHERE r.id = a.room_id
+		)
+		SELECT id FROM a
+	`, arg.TenantID, arg.RoomID, arg.BedID, arg.StudentID, arg.AllottedOn, arg.AllottedBy, arg.Remarks).Scan(&id)
+	return id, err
+}
+
+// CloseHostelAllocation vacates an active allocation and counts the
+// student out of the room.
+func (q *Queries) CloseHostelAllocation(ctx context.Context, tenantID, id pgtype.UUID, on pgtype.Date, remark pgtype.Text) error {
+	var roomID pgtype.UUID
+	return q.db.QueryRow(ctx, `
+		WITH a AS (
+			UPDATE hostel_allocations
+			SET status = 'vacated', vacated_on = $3, remarks = COALESCE($4, remarks)
+			WHERE tenant_id = $1 AND id = $2 AND status = 'active'
+			RETURNING room_id
+		), occupancy AS (
+			UPDATE hostel_rooms r SET occupancy = GREATEST(COALESCE(r.occupancy, 0) - 1, 0)
+			FROM a WHERE r.id = a.room_id
+		)
+		SELECT room_id FROM a
+	`, tenantID, id, on, remark).Scan(&roomID)
+}
+
+// Roll-call
+
+type HostelRollCall struct {
+	ID         pgtype.UUID        `json:"id"`
+	TenantID   pgtype.UUID        `json:"tenant_id"`
+	BuildingID pgtype.UUID        `json:"building_id"`
+	CallDate   pgtype.Date        `json:"call_date"`
+	Notes      pgtype.Text        `json:"notes"`
+	TakenBy    pgtype.UUID        `json:"taken_by"`
+	TakenAt    pgtype.Timestamptz `json:"taken_at"`
+}
+
+const hostelRollCallColumns = `id, tenant_id, building_id, call_date, notes, taken_by, taken_at`
+
+func scanHostelRollCall(row pgx.Row) (HostelRollCall, error) {
+	var c HostelRollCall
+	err := row.Scan(&c.ID, &c.TenantID, &c.BuildingID, &c.CallDate, &c.Notes, &c.TakenBy, &c.TakenAt)
+	return c, err
+}
+
+func (q *Queries) GetHostelRollCall(ctx context.Context, tenantID, buildingID pgtype.UUID, on pgtype.Date) (HostelRollCall, error) {
+	query := `SELECT ` + hostelRollCallColumns + ` FROM hostel_roll_calls
+		WHERE tenant_id = $1 AND building_id = $2 AND call_date = $3`
+	return scanHostelRollCall(q.db.QueryRow(ctx, query, tenantID, buildingID, on))
+}
+
+// UpsertHostelRollCall opens the night's roll-call for a building, or
+// records who updated it last.
+func (q *Queries) UpsertHostelRollCall(ctx context.Context, arg HostelRollCall) (HostelRollCall, error) {
+	query := `
+		INSERT INTO hostel_roll_calls (tenant_id, building_id, call_date, notes, taken_by)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (building_id, call_date) DO UPDATE
+		SET notes = COALESCE(EXCLUDED.notes, hostel_roll_calls.notes), taken_by = EXCLUDED.taken_by, taken_at = NOW()
+		RETURNING ` + hostelRollCallColumns
+	return scanHostelRollCall(q.db.QueryRow(ctx, query, arg.TenantID, arg.BuildingID, arg.CallDate, arg.Notes, arg.TakenBy))
+}
+
+// HostelRollCallLine is a resident on a night's roll-call, with the leave
+// that has them away at roll-call time and what was marked, if anything.
+type HostelRollCallLine struct {
+	StudentID       pgtype.UUID        `json:"student_id"`
+	AllocationID    pgtype.UUID        `json:"allocation_id"`
+	StudentName     string             `json:"student_name"`
+	AdmissionNumber string             `json:"admission_number"`
+	RoomNumber      string             `json:"room_number"`
+	BedLabel        pgtype.Text        `json:"bed_label"`
+	LeaveID         pgtype.UUID        `json:"leave_id"`
+	LeaveKind       pgtype.Text        `json:"leave_kind"`
+	LeaveReturnsAt  pgtype.Timestamptz `json:"leave_returns_at"`
+	Status          pgtype.Text        `json:"status"`
+	Remarks         pgtype.Text        `json:"remarks"`
+	MarkedAt        pgtype.Timestamptz `json:"marked_at"`
+}
+
+// ListHostelRollCallSheet returns the building's residents on a night. A
+// student counts as away when they have left on a leave or outing by the
+// roll-call time at and are not due back, or back, until after it.
+func (q *Queries) ListHostelRollCallSheet(ctx context.Context, tenantID, buildingID pgtype.UUID, on pgtype.Date, at pgtype.Timestamptz) ([]HostelRollCallLine, error) {
+	rows, err := q.db.Query(ctx, `
+		SELECT a.student_id, a.id, s.full_name, s.admission_number, r.room_number, bd.label,
+			lv.id, lv.kind, lv.returns_at, e.status, e.remarks, e.marked_at
+		FROM hostel_allocations a
+		JOIN hostel_rooms r ON r.id = a.room_id
+		JOIN students s ON s.id = a.student_id
+		LEFT JOIN hostel_beds bd ON bd.id = a.bed_id
+		LEFT JOIN hostel_roll_calls rc ON rc.tenant_id = a.tenant_id AND rc.building_id = r.building_id AND rc.call_date = $3
+		LEFT JOIN hostel_roll_call_entries e ON e.roll_call_id = rc.id AND e.student_id = a.student_id
+		LEFT JOIN LATERAL (
+			SELECT l.id, l.kind, l.returns_at
+			FROM hostel_leave_requests l
+			LEFT JOIN gate_passes gp ON gp.id = l.gate_pass_id
+			WHERE l.tenant_id = a.tenant_id AND l.student_id = a.student_id
+			  AND (l.status IN ('out', 'returned') OR (l.status = 'approved' AND gp.status = 'used'))
+			  AND COALESCE(l.checked_out_at, gp.used_at, l.departs_at) <= $4
+			  AND COALESCE(l.returned_at, l.returns_at) > $4
+			ORDER BY l.departs_at DESC
+			LIMIT 1
+		) lv ON TRUE
+		WHERE a.tenant_id = $1 AND r.building_id = $2 AND a.status IN ('active', 'vacated')
+		  AND a.allotted_on <= $3 AND (a.vacated_on IS NULL OR a.vacated_on > $3)
+		ORDER BY r.room_number, length(bd.label), bd.label, s.full_name
+	`, tenantID, buildingID, on, at)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []HostelRollCallLine
+	for rows.Next() {
+		var l HostelRollCallLine
+		if err := rows.Scan(
+			&l.StudentID, &l.AllocationID, &l.StudentName, &l.AdmissionNumber, &l.RoomNumber, &l.BedLabel,
+			&l.LeaveID, &l.LeaveKind, &l.LeaveReturnsAt, &l.Status, &l.Remarks, &l.MarkedAt,
+		); err != nil {
+			return nil, err
+		}
+		out = append(out, l)
+	}
+	return out, rows.Err()
+}
+
+type UpsertHostelRollCallEntryParams struct {
+	RollCallID   pgtype.UUID
+	TenantID     pgtype.UUID
+	StudentID    pgtype.UUID
+	AllocationID pgtype.UUID
+	Status       string
+	LeaveID      pgtype.UUID
+	Remarks      pgtype.Text
+}
+
+func (q *Queries) UpsertHostelRollCallEntry(ctx context.Context, arg UpsertHostelRollCallEntryParams) error {
+	_, err := q.db.Exec(ctx, `
+		INSERT INTO hostel_roll_call_entries (roll_call_id, tenant_id, student_id, allocation_id, status, leave_id, remarks)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (roll_call_id, student_id) DO UPDATE
+		SET allocation_id = EXCLUDED.allocation_id, status = EXCLUDED.status, leave_id = EXCLUDED.leave_id,
+			remarks = EXCLUDED.remarks, marked_at = NOW()
+	`, arg.RollCallID, arg.TenantID, arg.StudentID, arg.AllocationID, arg.Status, arg.LeaveID, arg.Remarks)
+	return err
+}
+
+// Leave and outings
+
+type HostelLeave struct {
+	ID              pgtype.UUID        `json:"id"`
+	TenantID        pgtype.UUID        `json:"tenant_id"`
+	StudentID       pgtype.UUID        `json:"student_id"`
+	StudentName     string             `json:"student_name"`
+	AdmissionNumber string             `json:"admission_number"`
+	AllocationID    pgtype.UUID        `json:"allocation_id"`
+	BuildingID      pgtype.UUID        `json:"building_id"`
+	BuildingName    string             `json:"building_name"`
+	RoomNumber      string             `json:"room_number"`
+	Kind            string             `json:"kind"`
+	Reason          string             `json:"reason"`
+	Destination     pgtype.Text        `json:"destination"`
+	EscortName      pgtype.Text        `json:"escort_name"`
+	EscortPhone     pgtype.Text        `json:"escort_phone"`
+	DepartsAt       pgtype.Timestamptz `json:"departs_at"`
+	ReturnsAt       pgtype.Timestamptz `json:"returns_at"`
+	Status          string             `json:"status"`
+	RequestedBy     pgtype.UUID        `json:"requested_by"`
+	DecidedBy       pgtype.UUID        `json:"decided_by"`
+	DecidedAt       pgtype.Timestamptz `json:"decided_at"`
+	DecisionRemark  pgtype.Text        `json:"decision_remark"`
+	GatePassID      pgtype.UUID        `json:"gate_pass_id"`
+	GatePassStatus  pgtype.Text        `json:"gate_pass_status"`
+	GatePassUsedAt  pgtype.Timestamptz `json:"gate_pass_used_at"`
+	CheckedOutAt    pgtype.Timestamptz `json:"checked_out_at"`
+	ReturnedAt      pgtype.Timestamptz `json:"returned_at"`
+	CreatedAt       pgtype.Timestamptz `json:"created_at"`
+}
+
+const hostelLeaveSelect = `
+	SELECT l.id, l.tenant_id, l.student_id, s.full_name, s.admission_number, l.allocation_id,
+		r.building_id, b.name, r.room_number, l.kind, l.reason, l.destination, l.escort_name, l.escort_phone,
+		l.departs_at, l.returns_at, l.status, l.requested_by, l.decided_by, l.decided_at, l.decision_remark,
+		l.gate_pass_id, gp.status, gp.used_at, l.checked_out_at, l.returned_at, l.created_at
+	FROM hostel_leave_requests l
+	JOIN students s ON s.id = l.student_id
+	JOIN hostel_allocations a ON a.id = l.allocation_id
+	JOIN hostel_rooms r ON r.id = a.room_id
+	JOIN hostel_buildings b ON b.id = r.building_id
+	LEFT JOIN gate_passes gp ON gp.id = l.gate_pass_id`
+
+func scanHostelLeave(row pgx.Row) (HostelLeave, error) {
+	var l HostelLeave
+	err := row.Scan(
+		&l.ID, &l.TenantID, &l.StudentID, &l.StudentName, &l.AdmissionNumber, &l.AllocationID,
+		&l.BuildingID, &l.BuildingName, &l.RoomNumber, &l.Kind, &l.Reason, &l.Destination, &l.EscortName, &l.EscortPhone,
+		&l.DepartsAt, &l.ReturnsAt, &l.Status, &l.RequestedBy, &l.DecidedBy, &l.DecidedAt, &l.DecisionRemark,
+		&l.GatePassID, &l.GatePassStatus, &l.GatePassUsedAt, &l.CheckedOutAt, &l.ReturnedAt, &l.CreatedAt,
+	)
+	return l, err
+}
+
+func (q *Queries) GetHostelLeave(ctx context.Context, tenantID, id pgtype.UUID) (HostelLeave, error) {
+	return scanHostelLeave(q.db.QueryRow(ctx, hostelLeaveSelect+` WHERE l.tenant_id = $1 AND l.id = $2`, tenantID, id))
+}
+
+func (q *Queries) LockHostelLeave(ctx context.Context, tenantID, id pgtype.UUID) (HostelLeave, error) {
+	return scanHostelLeave(q.db.QueryRow(ctx, hostelLeaveSelect+` WHERE l.tenant_id = $1 AND l.id = $2 FOR UPDATE OF l`, tenantID, id))
+}
+
+type CreateHostelLeaveParams struct {
+	TenantID     pgtype.UUID
+	StudentID    pgtype.UUID
+	AllocationID pgtype.UUID
+	Kind         string
+	Reason       string
+	Destination  pgtype.Text
+	EscortName   pgtype.Text
+	EscortPhone  pgtype.Text
+	DepartsAt    pgtype.Timestamptz
+	ReturnsAt    pgtype.Timestamptz
+	RequestedBy  pgtype.UUID
+}
+
+func (q *Queries) CreateHostelLeave(ctx context.Context, arg CreateHostelLeaveParams) (pgtype.UUID, error) {
+	var id pgtype.UUID
+	err := q.db.QueryRow(ctx, `
+		INSERT INTO hostel_leave_requests (
+			tenant_id, student_id, allocation_id, kind, reason, destination, escort_name, escort_phone,
+			departs_at, returns_at, requested_by
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		RETURNING id
+	`,
+		arg.TenantID, arg.StudentID, arg.AllocationID, arg.Kind, arg.Reason, arg.Destination, arg.EscortName, arg.EscortPhone,
+		arg.DepartsAt, arg.ReturnsAt, arg.RequestedBy,
+	).Scan(&id)
+	return id, err
+}
+
+// HostelLeaveOverlaps reports whether the student has another request
+// still in play for part of the time from to to.
+func (q *Queries) HostelLeaveOverlaps(ctx context.Context, tenantID, studentID pgtype.UUID, from, to pgtype.Timestamptz) (bool, error) {
+	var overlaps bool
+	err := q.db.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM hostel_leave_requests
+			WHERE tenant_id = $1 AND student_id = $2 AND status IN ('pending', 'approved', 'out')
+			  AND departs_at < $4 AND returns_at > $3
+		)
+	`, tenantID, studentID, from, to).Scan(&overlaps)
+	return overlaps, err
+}
+
+type ListHostelLeavesParams struct {
+	TenantID   pgtype.UUID
+	Status     pgtype.Text
+	StudentID  pgtype.UUID
+	BuildingID pgtype.UUID
+	// Overdue keeps students who are out past their return time.
+	Overdue bool
+	Limit   int32
+	Offset  int32
+}
+
+func (q *Queries) ListHostelLeaves(ctx context.Context, arg ListHostelLeavesParams) ([]HostelLeave, error) {
+	rows, err := q.db.Query(ctx, hostelLeaveSelect+`
+		WHERE l.tenant_id = $1
+		  AND ($2::text IS NULL OR l.status = $2)
+		  AND ($3::uuid IS NULL OR l.student_id = $3)
+		  AND ($4::uuid IS NULL OR r.building_id = $4)
+		  AND (NOT $5 OR (l.status = 'out' AND l.returns_at < NOW()))
+		ORDER BY l.departs_at DESC
+		LIMIT $6 OFFSET $7
+	`, arg.TenantID, arg.Status, arg.StudentID, arg.BuildingID, arg.Overdue, arg.Limit, arg.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []HostelLeave
+	for rows.Next() {
+		l, err := scanHostelLeave(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, l)
+	}
+	return out, rows.Err()
+}
+
+// DecideHostelLeave approves or rejects a pending request.
+func (q *Queries) DecideHostelLeave(ctx context.Context, tenantID, id pgtype.UUID, status string, decidedBy pgtype.UUID, remark pgtype.Text, gatePassID pgtype.UUID) error {
+	tag, err := q.db.Exec(ctx, `
+		UPDATE hostel_leave_requests
+		SET status = $3, decided_by = $4, decided_at = NOW(), decision_remark = $5, gate_pass_id = $6, updated_at = NOW()
+		WHERE tenant_id = $1 AND id = $2 AND status = 'pending'
+	`, tenantID, id, status, decidedBy, remark, gatePassID)
+	if err == nil && tag.RowsAffected() == 0 {
+		err = pgx.ErrNoRows
+	}
+	return err
+}
+
+// MarkHostelLeaveOut records the student leaving on an approved request.
+func (q *Queries) MarkHostelLeaveOut(ctx context.Context, tenantID, id pgtype.UUID, at pgtype.Timestamptz) error {
+	tag, err := q.db.Exec(ctx, `
+		UPDATE hostel_leave_requests SET status = 'out', checked_out_at = $3, updated_at = NOW()
+		WHERE tenant_id = $1 AND id = $2 AND status = 'approved'
+	`, tenantID, id, at)
+	if err == nil && tag.RowsAffected() == 0 {
+		err = pgx.ErrNoRows
+	}
+	return err
+}
+
+// MarkHostelLeaveReturned records the student coming back.
+func (q *Queries) MarkHostelLeaveReturned(ctx context.Context, tenantID, id pgtype.UUID, at pgtype.Timestamptz) error {
+	tag, err := q.db.Exec(ctx, `
+		UPDATE hostel_leave_requests SET status = 'returned', returned_at = $3, updated_at = NOW()
+		WHERE tenant_id = $1 AND id = $2 AND status = 'out'
+	`, tenantID, id, at)
+	if err == nil && tag.RowsAffected() == 0 {
+		err = pgx.ErrNoRows
+	}
+	return err
+}
+
+// CancelHostelLeave withdraws a request the student has not left on.
+func (q *Queries) CancelHostelLeave(ctx context.Context, tenantID, id pgtype.UUID, remark pgtype.Text) error {
+	tag, err := q.db.Exec(ctx, `
+		UPDATE hostel_leave_requests
+		SET status = 'cancelled', decision_remark = COALESCE($3, decision_remark), updated_at = NOW()
+		WHERE tenant_id = $1 AND id = $2 AND status IN ('pending', 'approved')
+	`, tenantID, id, remark)
+	if err == nil && tag.RowsAffected() == 0 {
+		err = pgx.ErrNoRows
+	}
+	return err
+}
+
+// CancelGatePass voids a gate pass that has not been used.
+func (q *Queries) CancelGatePass(ctx context.Context, tenantID, id pgtype.UUID) error {
+	_, err := q.db.Exec(ctx, `
+		UPDATE gate_passes SET status = 'cancelled'
+		WHERE tenant_id = $1 AND id = $2 AND status IN ('pending', 'approved')
+	`, tenantID, id)
+	return err
+}
+
+// Mess
+
+type HostelMessMenu struct {
+	ID        pgtype.UUID        `json:"id"`
+	TenantID  pgtype.UUID        `json:"tenant_id"`
+	MenuDate  pgtype.Date        `json:"menu_date"`
+	Meal      string             `json:"meal"`
+	Items     string             `json:"items"`
+	Notes     pgtype.Text        `json:"notes"`
+	UpdatedBy pgtype.UUID        `json:"updated_by"`
+	UpdatedAt pgtype.Timestamptz `json:"updated_at"`
+}
+
+const hostelMessMenuColumns = `id, tenant_id, menu_date, meal, items, notes, updated_by, updated_at`
+
+func scanHostelMessMenu(row pgx.Row) (HostelMessMenu, error) {
+	var m HostelMessMenu
+	err := row.Scan(&m.ID, &m.TenantID, &m.MenuDate, &m.Meal, &m.Items, &m.Notes, &m.UpdatedBy, &m.UpdatedAt)
+	return m, err
+}
+
+func (q *Queries) UpsertHostelMessMenu(ctx context.Context, arg HostelMessMenu) (HostelMessMenu, error) {
+	query := `
+		INSERT INTO hostel_mess_menus (tenant_id, menu_date, meal, items, notes, updated_by)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (tenant_id, menu_date, meal) DO UPDATE
+		SET items = EXCLUDED.items, notes = EXCLUDED.notes, updated_by = EXCLUDED.updated_by, updated_at = NOW()
+		RETURNING ` + hostelMessMenuColumns
+	return scanHostelMessMenu(q.db.QueryRow(ctx, query, arg.TenantID, arg.MenuDate, arg.Meal, arg.Items, arg.Notes, arg.UpdatedBy))
+}
+
+func (q *Queries) DeleteHostelMessMenu(ctx context.Context, tenantID pgtype.UUID, on pgtype.Date, meal string) error {
+	_, err := q.db.Exec(ctx, `DELETE FROM hostel_mess_menus WHERE tenant_id = $1 AND menu_date = $2 AND meal = $3`, tenantID, on, meal)
+	return err
+}
+
+func (q *Queries) ListHostelMessMenus(ctx context.Context, tenantID pgtype.UUID, from, to pgtype.Date) ([]HostelMessMenu, error) {
+	rows, err := q.db.Query(ctx, `
+		SELECT `+hostelMessMenuColumns+` FROM hostel_mess_menus
+		WHERE tenant_id = $1 AND menu_date BETWEEN $2 AND $3
+		ORDER BY menu_date, array_position(ARRAY['breakfast', 'lunch', 'snacks', 'dinner'], meal)
+	`, tenantID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []HostelMessMenu
+	for rows.Next() {
+		m, err := scanHostelMessMenu(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
+
+type HostelMealOptOut struct {
+	ID              pgtype.UUID        `json:"id"`
+	TenantID        pgtype.UUID        `json:"tenant_id"`
+	StudentID       pgtype.UUID        `json:"student_id"`
+	StudentName     string             `json:"student_name"`
+	AdmissionNumber string             `json:"admission_number"`
+	FromDate        pgtype.Date        `json:"from_date"`
+	ToDate          pgtype.Date        `json:"to_date"`
+	Meals           []string           `json:"meals"`
+	Reason          pgtype.Text        `json:"reason"`
+	LeaveID         pgtype.UUID        `json:"leave_id"`
+	Status          string             `json:"status"`
+	CreatedBy       pgtype.UUID        `json:"created_by"`
+	CreatedAt       pgtype.Timestamptz `json:"created_at"`
+}
+
+const hostelMealOptOutSelect = `
+	SELECT o.id, o.tenant_id, o.student_id, s.full_name, s.admission_number, o.from_date, o.to_date, o.meals,
+		o.reason, o.leave_id, o.status, o.created_by, o.created_at
+	FROM hostel_meal_opt_outs o JOIN students s ON s.id = o.student_id`
+
+func scanHostelMealOptOut(row pgx.Row) (HostelMealOptOut, error) {
+	var o HostelMealOptOut
+	err := row.Scan(
+		&o.ID, &o.TenantID, &o.StudentID, &o.StudentName, &o.AdmissionNumber, &o.FromDate, &o.ToDate, &o.Meals,
+		&o.Reason, &o.LeaveID, &o.Status, &o.CreatedBy, &o.CreatedAt,
+	)
+	return o, err
+}
+
+func (q *Queries) CreateHostelMealOptOut(ctx context.Context, arg HostelMealOptOut) (HostelMealOptOut, error) {
+	var id pgtype.UUID
+	err := q.db.QueryRow(ctx, `
+		INSERT INTO hostel_meal_opt_outs (tenant_id, student_id, from_date, to_date, meals, reason, leave_id, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id
+	`, arg.TenantID, arg.StudentID, arg.FromDate, arg.ToDate, arg.Meals, arg.Reason, arg.LeaveID, arg.CreatedBy).Scan(&id)
+	if err != nil {
+		return HostelMealOptOut{}, err
+	}
+	return scanHostelMealOptOut(q.db.QueryRow(ctx, hostelMealOptOutSelect+` WHERE o.id = $1`, id))
+}
+
+func (q *Queries) CancelHostelMealOptOut(ctx context.Context, tenantID, id pgtype.UUID) (HostelMealOptOut, error) {
+	tag, err := q.db.Exec(ctx, `
+		UPDATE hostel_meal_opt_outs SET status = 'cancelled'
+		WHERE tenant_id = $1 AND id = $2 AND status = 'active'
+	`, tenantID, id)
+	if err != nil {
+		return HostelMealOptOut{}, err
+	}
+	if tag.RowsAffected() == 0 {
+		return HostelMealOptOut{}, pgx.ErrNoRows
+	}
+	return scanHostelMealOptOut(q.db.QueryRow(ctx, hostelMealOptOutSelect+` WHERE o.tenant_id = $1 AND o.id = $2`, tenantID, id))
+}
+
+// CancelHostelLeaveOptOuts drops the opt-outs a leave made.
+func (q *Queries) CancelHostelLeaveOptOuts(ctx context.Context, tenantID, leaveID pgtype.UUID) error {
+	_, err := q.db.Exec(ctx, `
+		UPDATE hostel_meal_opt_outs SET status = 'cancelled'
+		WHERE tenant_id = $1 AND leave_id = $2 AND status = 'active'
+	`, tenantID, leaveID)
+	return err
+}
+
+// EndHostelLeaveOptOuts cuts a leave's opt-outs short at lastDay, for a
+// student back early.
+func (q *Queries) EndHostelLeaveOptOuts(ctx context.Context, tenantID, leaveID pgtype.UUID, lastDay pgtype.Date) error {
+	if _, err := q.db.Exec(ctx, `
+		UPDATE hostel_meal_opt_outs SET status = 'cancelled'
+		WHERE tenant_id = $1 AND leave_id = $2 AND status = 'active' AND from_date > $3
+	`, tenantID, leaveID, lastDay); err != nil {
+		return err
+	}
+	_, err := q.db.Exec(ctx, `
+		UPDATE hostel_meal_opt_outs SET to_date = $3
+		WHERE tenant_id = $1 AND leave_id = $2 AND status = 'active' AND to_date > $3
+	`, tenantID, leaveID, lastDay)
+	return err
+}
+
+// ListHostelMealOptOuts returns active opt-outs overlapping from to to.
+func (q *Queries) ListHostelMealOptOuts(ctx context.Context, tenantID, studentID pgtype.UUID, from, to pgtype.Date) ([]HostelMealOptOut, error) {
+	rows, err := q.db.Query(ctx, hostelMealOptOutSelect+`
+		WHERE o.tenant_id = $1 AND o.status = 'active'
+		  AND ($2::uuid IS NULL OR o.student_id = $2)
+		  AND o.from_date <= $4 AND o.to_date >= $3
+		ORDER BY o.from_date, s.full_name
+	`, tenantID, studentID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []HostelMealOptOut
+	for rows.Next() {
+		o, err := scanHostelMealOptOut(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, o)
+	}
+	return out, rows.Err()
+}
+
+type HostelMealCount struct {
+	BuildingID   pgtype.UUID `json:"building_id"`
+	BuildingName string      `json:"building_name"`
+	Meal         string      `json:"meal"`
+	Residents    int32       `json:"residents"`
+	OptedOut     int32       `json:"opted_out"`
+}
+
+// ListHostelMealCounts counts, per building and meal, the residents on a
+// day and those who opted out of the meal.
+func (q *Queries) ListHostelMealCounts(ctx context.Context, tenantID pgtype.UUID, on pgtype.Date) ([]HostelMealCount, error) {
+	rows, err := q.db.Query(ctx, `
+		WITH residents AS (
+			SELECT a.student_id, r.building_id
+			FROM hostel_allocations a JOIN hostel_rooms r ON r.id = a.room_id
+			WHERE a.tenant_id = $1 AND a.status IN ('active', 'vacated')
+			  AND a.allotted_on <= $2 AND (a.vacated_on IS NULL OR a.vacated_on > $2)
+		), meals (meal, ord) AS (
+			VALUES ('breakfast', 1), ('lunch', 2), ('snacks', 3), ('dinner', 4)
+		)
+		SELECT b.id, b.name, m.meal, COUNT(*)::int,
+			(COUNT(*) FILTER (WHERE EXISTS (
+				SELECT 1 FROM hostel_meal_opt_outs o
+				WHERE o.tenant_id = $1 AND o.student_id = res.student_id AND o.status = 'active'
+				  AND $2 BETWEEN o.from_date AND o.to_date AND m.meal = ANY (o.meals)
+			)))::int
+		FROM residents res
+		JOIN hostel_buildings b ON b.id = res.building_id
+		CROSS JOIN meals m
+		GROUP BY b.id, b.name, m.meal, m.ord
+		ORDER BY b.name, m.ord
+	`, tenantID, on)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []HostelMealCount
+	for rows.Next() {
+		var c HostelMealCount
+		if err := rows.Scan(&c.BuildingID, &c.BuildingName, &c.Meal, &c.Residents, &c.OptedOut); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// Fees
+
+type HostelFeeSettings struct {
+	TenantID          pgtype.UUID        `json:"tenant_id"`
+	FeeHeadID         pgtype.UUID        `json:"fee_head_id"`
+	MessFeeHeadID     pgtype.UUID        `json:"mess_fee_head_id"`
+	MessMonthlyFee    int64              `json:"mess_monthly_fee"`
+	MessRebatePerDay  int64              `json:"mess_rebate_per_day"`
+	MessRebateMinDays int32              `json:"mess_rebate_min_days"`
+	Proration         string             `json:"proration"`
+	UpdatedBy         pgtype.UUID        `json:"updated_by"`
+	UpdatedAt         pgtype.Timestamptz `json:"updated_at"`
+}
+
+const hostelFeeSettingsColumns = `
+	tenant_id, fee_head_id, mess_fee_head_id, mess_monthly_fee, mess_rebate_per_day, mess_rebate_min_days,
+	proration, updated_by, updated_at`
+
+func scanHostelFeeSettings(row pgx.Row) (HostelFeeSettings, error) {
+	var s HostelFeeSettings
+	err := row.Scan(
+		&s.TenantID, &s.FeeHeadID, &s.MessFeeHeadID, &s.MessMonthlyFee, &s.MessRebatePerDay, &s.MessRebateMinDays,
+		&s.Proration, &s.UpdatedBy, &s.UpdatedAt,
+	)
+	return s, err
+}
+
+func (q *Queries) GetHostelFeeSettings(ctx context.Context, tenantID pgtype.UUID) (HostelFeeSettings, error) {
+	query := `SELECT ` + hostelFeeSettingsColumns + ` FROM hostel_fee_settings WHERE tenant_id = $1`
+	return scanHostelFeeSettings(q.db.QueryRow(ctx, query, tenantID))
+}
+
+// UpsertHostelFeeSettings saves the settings. Fee heads given must belong
+// to the tenant; otherwise no row comes back.
+func (q *Queries) UpsertHostelFeeSettings(ctx context.Context, arg HostelFeeSettings) (HostelFeeSettings, error) {
+	query := `
+		INSERT INTO hostel_fee_settings (
+			tenant_id, fee_head_id, mess_fee_head_id, mess_monthly_fee, mess_rebate_per_day, mess_rebate_min_days,
+			proration, updated_by, updated_at
+		)
+		SELECT $1, $2, $3, $4, $5, $6, $7, $8, NOW()
+		WHERE ($2::uuid IS NULL OR EXISTS (SELECT 1 FROM fee_heads WHERE tenant_id = $1 AND id = $2))
+		  AND ($3::uuid IS NULL OR EXISTS (SELECT 1 FROM fee_heads WHERE tenant_id = $1 AND id = $3))
+		ON CONFLICT (tenant_id) DO UPDATE
+		SET fee_head_id = EXCLUDED.fee_head_id, mess_fee_head_id = EXCLUDED.mess_fee_head_id,
+			mess_monthly_fee = EXCLUDED.mess_monthly_fee, mess_rebate_per_day = EXCLUDED.mess_rebate_per_day,
+			mess_rebate_min_days = EXCLUDED.mess_rebate_min_days, proration = EXCLUDED.proration,
+			updated_by = EXCLUDED.updated_by, updated_at = NOW()
+		RETURNING ` + hostelFeeSettingsColumns
+	return scanHostelFeeSettings(q.db.QueryRow(ctx, query,
+		arg.TenantID, arg.FeeHeadID, arg.MessFeeHeadID, arg.MessMonthlyFee, arg.MessRebatePerDay, arg.MessRebateMinDays,
+		arg.Proration, arg.UpdatedBy,
+	))
+}
+
+type HostelFeeTerm struct {
+	ID               pgtype.UUID        `json:"id"`
+	TenantID         pgtype.UUID        `json:"tenant_id"`
+	AcademicYearID   pgtype.UUID        `json:"academic_year_id"`
+	AcademicYearName string             `json:"academic_year_name"`
+	Name             string             `json:"name"`
+	StartDate        pgtype.Date        `json:"start_date"`
+	EndDate          pgtype.Date        `json:"end_date"`
+	DueDate          pgtype.Date        `json:"due_date"`
+	CreatedAt        pgtype.Timestamptz `json:"created_at"`
+}
+
+const hostelFeeTermColumns = `
+	t.id, t.tenant_id, t.academic_year_id, y.name, t.name, t.start_date, t.end_date, t.due_date, t.created_at`
+
+func scanHostelFeeTerm(row pgx.Row) (HostelFeeTerm, error) {
+	var t HostelFeeTerm
+	err := row.Scan(&t.ID, &t.TenantID, &t.AcademicYearID, &t.AcademicYearName, &t.Name, &t.StartDate, &t.EndDate, &t.DueDate, &t.CreatedAt)
+	return t, err
+}
+
+// CreateHostelFeeTerm returns ErrNoRows when the academic year is not the
+// tenant's.
+func (q *Queries) CreateHostelFeeTerm(ctx context.Context, arg HostelFeeTerm) (HostelFeeTerm, error) {
+	var id pgtype.UUID
+	err := q.db.QueryRow(ctx, `
+		INSERT INTO hostel_fee_terms (tenant_id, academic_year_id, name, start_date, end_date, due_date)
+		SELECT $1, y.id, $3, $4, $5, $6
+		FROM academic_years y WHERE y.tenant_id = $1 AND y.id = $2
+		RETURNING id
+	`, arg.TenantID, arg.AcademicYearID, arg.Name, arg.StartDate, arg.EndDate, arg.DueDate).Scan(&id)
+	if err != nil {
+		return HostelFeeTerm{}, err
+	}
+	return q.GetHostelFeeTerm(ctx, arg.TenantID, id)
+}
+
+func (q *Queries) GetHostelFeeTerm(ctx context.Context, tenantID, id pgtype.UUID) (HostelFeeTerm, error) {
+	query := `SELECT ` + hostelFeeTermColumns + `
+		FROM hostel_fee_terms t JOIN academic_years y ON y.id = t.academic_year_id
+		WHERE t.tenant_id = $1 AND t.id = $2`
+	return scanHostelFeeTerm(q.db.QueryRow(ctx, query, tenantID, id))
+}
+
+func (q *Queries) ListHostelFeeTerms(ctx context.Context, tenantID, academicYearID pgtype.UUID) ([]HostelFeeTerm, error) {
+	query := `SELECT ` + hostelFeeTermColumns + `
+		FROM hostel_fee_terms t JOIN academic_years y ON y.id = t.academic_year_id
+		WHERE t.tenant_id = $1 AND ($2::uuid IS NULL OR t.academic_year_id = $2)
+		ORDER BY t.start_date`
+	rows, err := q.db.Query(ctx, query, tenantID, academicYearID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []HostelFeeTerm
+	for rows.Next() {
+		t, err := scanHostelFeeTerm(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+// HostelFeeAllocation is a stay that overlaps a billing period, with the
+// room's monthly rent in paise.
+type HostelFeeAllocation struct {
+	AllocationID    pgtype.UUID
+	StudentID       pgtype.UUID
+	StudentName     string
+	AdmissionNumber string
+	BuildingName    string
+	RoomNumber      string
+	MonthlyRent     int64
+	AllottedOn      pgtype.Date
+	VacatedOn       pgtype.Date
+}
+
+// ListHostelFeeAllocations returns the stays that were live at some point
+// between from and to, including students who have since moved out.
+func (q *Queries) ListHostelFeeAllocations(ctx context.Context, tenantID pgtype.UUID, from, to pgtype.Date) ([]HostelFeeAllocation, error) {
+	rows, err := q.db.Query(ctx, `
+		SELECT a.id, a.student_id, s.full_name, s.admission_number, b.name, r.room_number,
+			ROUND(COALESCE(r.cost_per_month, 0) * 100)::BIGINT, a.allotted_on, a.vacated_on
+		FROM hostel_allocations a
+		JOIN students s ON s.id = a.student_id
+		JOIN hostel_rooms r ON r.id = a.room_id
+		JOIN hostel_buildings b ON b.id = r.building_id
+		WHERE a.tenant_id = $1 AND a.status IN ('active', 'vacated')
+		  AND a.allotted_on <= $3 AND (a.vacated_on IS NULL OR a.vacated_on > $2)
+		ORDER BY s.full_name, a.student_id, a.allotted_on
+	`, tenantID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []HostelFeeAllocation
+	for rows.Next() {
+		var a HostelFeeAllocation
+		if err := rows.Scan(
+			&a.AllocationID, &a.StudentID, &a.StudentName, &a.AdmissionNumber, &a.BuildingName, &a.RoomNumber,
+			&a.MonthlyRent, &a.AllottedOn, &a.VacatedOn,
+		); err != nil {
+			return nil, err
+		}
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
+
+// HostelFeeAbsence is a stretch of days a student took no meals at all.
+type HostelFeeAbsence struct {
+	StudentID pgtype.UUID
+	FromDate  pgtype.Date
+	ToDate    pgtype.Date
+}
+
+// ListHostelFullDayOptOuts returns the active opt-outs covering every meal
+// that overlap from to to.
+func (q *Queries) ListHostelFullDayOptOuts(ctx context.Context, tenantID pgtype.UUID, from, to pgtype.Date) ([]HostelFeeAbsence, error) {
+	rows, err := q.db.Query(ctx, `
+		SELECT student_id, from_date, to_date
+		FROM hostel_meal_opt_outs
+		WHERE tenant_id = $1 AND status = 'active'
+		  AND meals @> ARRAY['breakfast', 'lunch', 'snacks', 'dinner']
+		  AND from_date <= $3 AND to_date >= $2
+		ORDER BY student_id, from_date
+	`, tenantID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []HostelFeeAbsence
+	for rows.Next() {
+		var a HostelFeeAbsence
+		if err := rows.Scan(&a.StudentID, &a.FromDate, &a.ToDate); err != nil {
+			return nil, err
+		}
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
+
+type HostelFeeRun struct {
+	ID             pgtype.UUID        `json:"id"`
+	TenantID       pgtype.UUID        `json:"tenant_id"`
+	TermID         pgtype.UUID        `json:"term_id"`
+	CreatedCount   int32              `json:"created_count"`
+	UpdatedCount   int32              `json:"updated_count"`
+	UnchangedCount int32              `json:"unchanged_count"`
+	CancelledCount int32              `json:"cancelled_count"`
+	SkippedCount   int32              `json:"skipped_count"`
+	Report         json.RawMessage    `json:"report,omitempty"`
+	CreatedBy      pgtype.UUID        `json:"created_by"`
+	CreatedAt      pgtype.Timestamptz `json:"created_at"`
+}
+
+const hostelFeeRunColumns = `
+	id, tenant_id, term_id, created_count, updated_count, unchanged_count, cancelled_count, skipped_count,
+	report, created_by, created_at`
+
+func scanHostelFeeRun(row pgx.Row) (HostelFeeRun, error) {
+	var r HostelFeeRun
+	err := row.Scan(
+		&r.ID, &r.TenantID, &r.TermID, &r.CreatedCount, &r.UpdatedCount, &r.UnchangedCount, &r.CancelledCount, &r.SkippedCount,
+		&r.Report, &r.CreatedBy, &r.CreatedAt,
+	)
+	return r, err
+}
+
+func (q *Queries) CreateHostelFeeRun(ctx context.Context, arg HostelFeeRun) (HostelFeeRun, error) {
+	query := `
+		INSERT INTO hostel_fee_runs (
+			tenant_id, term_id, created_count, updated_count, unchanged_count, cancelled_count, skipped_count, report, created_by
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING ` + hostelFeeRunColumns
+	return scanHostelFeeRun(q.db.QueryRow(ctx, query,
+		arg.TenantID, arg.TermID, arg.CreatedCount, arg.UpdatedCount, arg.UnchangedCount, arg.CancelledCount, arg.SkippedCount,
+		arg.Report, arg.CreatedBy,
+	))
+}
+
+func (q *Queries) GetHostelFeeRun(ctx context.Context, tenantID, id pgtype.UUID) (HostelFeeRun, error) {
+	query := `SELECT ` + hostelFeeRunColumns + ` FROM hostel_fee_runs WHERE tenant_id = $1 AND id = $2`
+	return scanHostelFeeRun(q.db.QueryRow(ctx, query, tenantID, id))
+}
+
+// ListHostelFeeRuns returns a term's runs without their reports.
+func (q *Queries) ListHostelFeeRuns(ctx context.Context, tenantID, termID pgtype.UUID) ([]HostelFeeRun, error) {
+	rows, err := q.db.Query(ctx, `
+		SELECT id, tenant_id, term_id, created_count, updated_count, unchanged_count, cancelled_count, skipped_count,
+			NULL::jsonb, created_by, created_at
+		FROM hostel_fee_runs
+		WHERE tenant_id = $1 AND term_id = $2
+		ORDER BY created_at DESC
+		LIMIT 100
+	`, tenantID, termID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []HostelFeeRun
+	for rows.Next() {
+		r, err := scanHostelFeeRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,736 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Amounts on stock are NUMERIC rupees in the database and are read and
+// written here in paise.
+
+// Stores
+
+type InventoryStore struct {
+	ID          pgtype.UUID        `json:"id"`
+	TenantID    pgtype.UUID        `json:"tenant_id"`
+	Name        string             `json:"name"`
+	Code        pgtype.Text        `json:"code"`
+	Campus      pgtype.Text        `json:"campus"`
+	Description pgtype.Text        `json:"description"`
+	InChargeID  pgtype.UUID        `json:"in_charge_id"`
+	IsDefault   bool               `json:"is_default"`
+	Active      bool               `json:"active"`
+	CreatedAt   pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt   pgtype.Timestamptz `json:"updated_at"`
+}
+
+const inventoryStoreColumns = `
+	id, tenant_id, name, code, campus, description, in_charge_id, is_default, active, created_at, updated_at`
+
+func scanInventoryStore(row pgx.Row) (InventoryStore, error) {
+	var s InventoryStore
+	err := row.Scan(
+		&s.ID, &s.TenantID, &s.Name, &s.Code, &s.Campus, &s.Description, &s.InChargeID, &s.IsDefault, &s.Active,
+		&s.CreatedAt, &s.UpdatedAt,
+	)
+	return s, err
+}
+
+func (q *Queries) ListInventoryStores(ctx context.Context, tenantID pgtype.UUID) ([]InventoryStore, error) {
+	rows, err := q.db.Query(ctx, `SELECT `+inventoryStoreColumns+` FROM inventory_stores
+		WHERE tenant_id = $1 ORDER BY is_default DESC, active DESC, name`, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []InventoryStore
+	for rows.Next() {
+		s, err := scanInventoryStore(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+func (q *Queries) GetInventoryStore(ctx context.Context, tenantID, id pgtype.UUID) (InventoryStore, error) {
+	query := `SELECT ` + inventoryStoreColumns + ` FROM inventory_stores WHERE tenant_id = $1 AND id = $2`
+	return scanInventoryStore(q.db.QueryRow(ctx, query, tenantID, id))
+}
+
+// FindInventoryStoreByName matches the name without regard to case.
+func (q *Queries) FindInventoryStoreByName(ctx context.Context, tenantID pgtype.UUID, name string) (InventoryStore, error) {
+	query := `SELECT ` + inventoryStoreColumns + ` FROM inventory_stores
+		WHERE tenant_id = $1 AND lower(name) = lower(btrim($2))`
+	return scanInventoryStore(q.db.QueryRow(ctx, query, tenantID, name))
+}
+
+// EnsureDefaultInventoryStore returns the tenant's default store, making
+// the Main Store the default when there is none.
+func (q *Queries) EnsureDefaultInventoryStore(ctx context.Context, tenantID pgtype.UUID) (InventoryStore, error) {
+	store, err := scanInventoryStore(q.db.QueryRow(ctx, `SELECT `+inventoryStoreColumns+` FROM inventory_stores
+		WHERE tenant_id = $1 AND is_default`, tenantID))
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return store, err
+	}
+	return scanInventoryStore(q.db.QueryRow(ctx, `
+		INSERT INTO inventory_stores (tenant_id, name, is_default) VALUES ($1, 'Main Store', TRUE)
+		ON CONFLICT (tenant_id, name) DO UPDATE SET is_default = TRUE, active = TRUE, updated_at = NOW()
+		RETURNING `+inventoryStoreColumns, tenantID))
+}
+
+type SaveInventoryStoreParams struct {
+	ID          pgtype.UUID
+	TenantID    pgtype.UUID
+	Name        string
+	Code        pgtype.Text
+	Campus      pgtype.Text
+	Description pgtype.Text
+	InChargeID  pgtype.UUID
+	IsDefault   bool
+	Active      bool
+}
+
+// SaveInventoryStore creates a store, or updates it when ID is set. A new
+// default store takes over from the old one.
+func (q *Queries) SaveInventoryStore(ctx context.Context, arg SaveInventoryStoreParams) (InventoryStore, error) {
+	if arg.IsDefault {
+		if _, err := q.db.Exec(ctx, `
+			UPDATE inventory_stores SET is_default = FALSE, updated_at = NOW()
+			WHERE tenant_id = $1 AND is_default AND id IS DISTINCT FROM $2
+		`, arg.TenantID, arg.ID); err != nil {
+			return InventoryStore{}, err
+		}
+	}
+	if !arg.ID.Valid {
+		return scanInventoryStore(q.db.QueryRow(ctx, `
+			INSERT INTO inventory_stores (tenant_id, name, code, campus, description, in_charge_id, is_default, active)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			RETURNING `+inventoryStoreColumns,
+			arg.TenantID, arg.Name, arg.Code, arg.Campus, arg.Description, arg.InChargeID, arg.IsDefault, arg.Active))
+	}
+	store, err := scanInventoryStore(q.db.QueryRow(ctx, `
+		UPDATE inventory_stores
+		SET name = $3, code = $4, campus = $5, description = $6, in_charge_id = $7, is_default = $8, active = $9,
+			updated_at = NOW()
+		WHERE tenant_id = $1 AND id = $2
+		RETURNING `+inventoryStoreColumns,
+		arg.TenantID, arg.ID, arg.Name, arg.Code, arg.Campus, arg.Description, arg.InChargeID, arg.IsDefault, arg.Active))
+	if err != nil {
+		return store, err
+	}
+	// Balances carry the store name as their location.
+	_, err = q.db.Exec(ctx, `UPDATE inventory_stocks SET location = $2 WHERE store_id = $1 AND location IS DISTINCT FROM $2`,
+		store.ID, store.Name)
+	return store, err
+}
+
+// Valuation method
+
+func (q *Queries) GetInventoryItemValuation(ctx context.Context, tenantID, itemID pgtype.UUID) (string, error) {
+	var method string
+	err := q.db.QueryRow(ctx, `SELECT valuation_method FROM inventory_items WHERE tenant_id = $1 AND id = $2`,
+		tenantID, itemID).Scan(&method)
+	return method, err
+}
+
+// SetInventoryItemValuation changes how an item is costed. It only does so
+// while none of the item is in stock or in transit, and reports whether it
+// did.
+func (q *Queries) SetInventoryItemValuation(ctx context.Context, tenantID, itemID pgtype.UUID, method string) (bool, error) {
+	tag, err := q.db.Exec(ctx, `
+		UPDATE inventory_items i SET valuation_method = $3, updated_at = NOW()
+		WHERE i.tenant_id = $1 AND i.id = $2
+			AND NOT EXISTS (SELECT 1 FROM inventory_stocks s WHERE s.item_id = i.id AND s.quantity <> 0)
+			AND NOT EXISTS (
+				SELECT 1 FROM inventory_transfer_items ti JOIN inventory_transfers t ON t.id = ti.transfer_id
+				WHERE ti.item_id = i.id AND t.status = 'in_transit'
+			)
+	`, tenantID, itemID, method)
+	return tag.RowsAffected() > 0, err
+}
+
+// GetInventoryItemLastCost returns the unit price the item was last bought
+// at, in paise.
+func (q *Queries) GetInventoryItemLastCost(ctx context.Context, tenantID, itemID pgtype.UUID) (int64, error) {
+	var cost int64
+	err := q.db.QueryRow(ctx, `
+		SELECT COALESCE((
+			SELECT ROUND(unit_price * 100)::BIGINT FROM inventory_transactions
+			WHERE tenant_id = $1 AND item_id = $2 AND type = 'in' AND unit_price > 0
+			ORDER BY created_at DESC LIMIT 1
+		), 0)
+	`, tenantID, itemID).Scan(&cost)
+	return cost, err
+}
+
+// GetSchoolTimezone returns the school's time zone, India's when the
+// school has not set one.
+func (q *Queries) GetSchoolTimezone(ctx context.Context, tenantID pgtype.UUID) (string, error) {
+	var tz string
+	err := q.db.QueryRow(ctx, `
+		SELECT COALESCE((SELECT NULLIF(timezone, '') FROM school_profiles WHERE tenant_id = $1), 'Asia/Kolkata')
+	`, tenantID).Scan(&tz)
+	return tz, err
+}
+
+// Balances
+
+type InventoryStockBalance struct {
+	Quantity int32 `json:"quantity"`
+	Value    int64 `json:"value"`
+}
+
+// LockInventoryStock locks an item's balance in a store, creating an empty
+// one the first time. No row comes back for a store of another tenant.
+func (q *Queries) LockInventoryStock(ctx context.Context, tenantID, itemID, storeID pgtype.UUID) (InventoryStockBalance, error) {
+	if _, err := q.db.Exec(ctx, `
+		INSERT INTO inventory_stocks (tenant_id, item_id, store_id, location, quantity)
+		SELECT st.tenant_id, $2, st.id, st.name, 0 FROM inventory_stores st WHERE st.tenant_id = $1 AND st.id = $3
+		ON CONFLICT (store_id, item_id) DO NOTHING
+	`, tenantID, itemID, storeID); err != nil {
+		return InventoryStockBalance{}, err
+	}
+	var b InventoryStockBalance
+	err := q.db.QueryRow(ctx, `
+		SELECT quantity, ROUND(stock_value * 100)::BIGINT FROM inventory_stocks
+		WHERE tenant_id = $1 AND item_id = $2 AND store_id = $3
+		FOR UPDATE
+	`, tenantID, itemID, storeID).Scan(&b.Quantity, &b.Value)
+	return b, err
+}
+
+func (q *Queries) SetInventoryStock(ctx context.Context, itemID, storeID pgtype.UUID, b InventoryStockBalance) error {
+	_, err := q.db.Exec(ctx, `
+		UPDATE inventory_stocks SET quantity = $3, stock_value = $4::BIGINT / 100.0, updated_at = NOW()
+		WHERE item_id = $1 AND store_id = $2
+	`, itemID, storeID, b.Quantity, b.Value)
+	return err
+}
+
+// FIFO cost layers
+
+type InventoryCostLayer struct {
+	ID         pgtype.UUID        `json:"id"`
+	ReceivedAt pgtype.Timestamptz `json:"received_at"`
+	Remaining  int32              `json:"remaining"`
+	UnitCost   int64              `json:"unit_cost"`
+}
+
+// LockOpenInventoryCostLayers returns the layers of an item in a store with
+// stock left, oldest first.
+func (q *Queries) LockOpenInventoryCostLayers(ctx context.Context, itemID, storeID pgtype.UUID) ([]InventoryCostLayer, error) {
+	rows, err := q.db.Query(ctx, `
+		SELECT id, received_at, remaining, ROUND(unit_cost * 100)::BIGINT FROM inventory_cost_layers
+		WHERE item_id = $1 AND store_id = $2 AND remaining > 0
+		ORDER BY received_at, id
+		FOR UPDATE
+	`, itemID, storeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []InventoryCostLayer
+	for rows.Next() {
+		var l InventoryCostLayer
+		if err := rows.Scan(&l.ID, &l.ReceivedAt, &l.Remaining, &l.UnitCost); err != nil {
+			return nil, err
+		}
+		out = append(out, l)
+	}
+	return out, rows.Err()
+}
+
+func (q *Queries) SetInventoryCostLayerRemaining(ctx context.Context, id pgtype.UUID, remaining int32) error {
+	_, err := q.db.Exec(ctx, `UPDATE inventory_cost_layers SET remaining = $2 WHERE id = $1`, id, remaining)
+	return err
+}
+
+type CreateInventoryCostLayerParams struct {
+	TenantID      pgtype.UUID
+	ItemID        pgtype.UUID
+	StoreID       pgtype.UUID
+	TransactionID pgtype.UUID
+	ReceivedAt    time.Time
+	Quantity      int32
+	UnitCost      int64
+}
+
+func (q *Queries) CreateInventoryCostLayer(ctx context.Context, arg CreateInventoryCostLayerParams) error {
+	_, err := q.db.Exec(ctx, `
+		INSERT INTO inventory_cost_layers (tenant_id, item_id, store_id, transaction_id, received_at, quantity, remaining, unit_cost)
+		VALUES ($1, $2, $3, $4, $5, $6, $6, $7::BIGINT / 100.0)
+	`, arg.TenantID, arg.ItemID, arg.StoreID, arg.TransactionID, arg.ReceivedAt, arg.Quantity, arg.UnitCost)
+	return err
+}
+
+// Ledger
+
+type CreateInventoryMovementParams struct {
+	TenantID      pgtype.UUID
+	ItemID        pgtype.UUID
+	StoreID       pgtype.UUID
+	Type          string
+	Delta         int32
+	UnitPrice     pgtype.Numeric
+	Value         int64
+	SupplierID    pgtype.UUID
+	ReferenceID   pgtype.UUID
+	ReferenceType pgtype.Text
+	Remarks       pgtype.Text
+	CreatedBy     pgtype.UUID
+}
+
+// CreateInventoryMovement records a change to a store's stock. Quantity is
+// kept unsigned as before; Delta and Value carry the direction.
+func (q *Queries) CreateInventoryMovement(ctx context.Context, arg CreateInventoryMovementParams) (InventoryTransaction, error) {
+	quantity := arg.Delta
+	if quantity < 0 {
+		quantity = -quantity
+	}
+	var t InventoryTransaction
+	err := q.db.QueryRow(ctx, `
+		INSERT INTO inventory_transactions (
+			tenant_id, item_id, type, quantity, unit_price, supplier_id, reference_id, reference_type, remarks, created_by,
+			store_id, stock_delta, stock_value
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13::BIGINT / 100.0)
+		RETURNING id, tenant_id, item_id, type, quantity, unit_price, supplier_id, reference_id, reference_type, remarks,
+			created_by, created_at
+	`,
+		arg.TenantID, arg.ItemID, arg.Type, quantity, arg.UnitPrice, arg.SupplierID, arg.ReferenceID, arg.ReferenceType,
+		arg.Remarks, arg.CreatedBy, arg.StoreID, arg.Delta, arg.Value,
+	).Scan(
+		&t.ID, &t.TenantID, &t.ItemID, &t.Type, &t.Quantity, &t.UnitPrice, &t.SupplierID, &t.ReferenceID,
+		&t.ReferenceType, &t.Remarks, &t.CreatedBy, &t.CreatedAt,
+	)
+	return t, err
+}
+
+// Stock positions
+
+type InventoryStockPosition struct {
+	ItemID    pgtype.UUID `json:"item_id"`
+	ItemName  string      `json:"item_name"`
+	Sku       pgtype.Text `json:"sku"`
+	Unit      pgtype.Text `json:"unit"`
+	StoreID   pgtype.UUID `json:"store_id"`
+	StoreName string      `json:"store_name"`
+	Quantity  int64       `json:"quantity"`
+	Value     int64       `json:"value"`
+}
+
+type ListInventoryStockPositionsParams struct {
+	TenantID pgtype.UUID
+	StoreID  pgtype.UUID
+	ItemID   pgtype.UUID
+	// Before, when set, works the positions out from the ledger as they
+	// stood at that moment; otherwise current balances are read.
+	Before pgtype.Timestamptz
+}
+
+// ListInventoryStockPositions returns each item's quantity and value per
+// store, leaving out empty balances.
+func (q *Queries) ListInventoryStockPositions(ctx context.Context, arg ListInventoryStockPositionsParams) ([]InventoryStockPosition, error) {
+	source := `
+		SELECT store_id, item_id, quantity::BIGINT AS quantity, ROUND(stock_value * 100)::BIGINT AS value
+		FROM inventory_stocks WHERE tenant_id = $1`
+	args := []any{arg.TenantID, arg.StoreID, arg.ItemID}
+	if arg.Before.Valid {
+		source = `
+		SELECT store_id, item_id, SUM(stock_delta)::BIGINT AS quantity, ROUND(SUM(stock_value) * 100)::BIGINT AS value
+		FROM inventory_transactions WHERE tenant_id = $1 AND created_at < $4
+		GROUP BY store_id, item_id`
+		args = append(args, arg.Before)
+	}
+	rows, err := q.db.Query(ctx, `
+		SELECT p.item_id, i.name, i.sku, i.unit, p.store_id, st.name, p.quantity, p.value
+		FROM (`+source+`) p
+		JOIN inventory_items i ON i.id = p.item_id
+		JOIN inventory_stores st ON st.id = p.store_id
+		WHERE (p.quantity <> 0 OR p.value <> 0)
+			AND ($2::uuid IS NULL OR p.store_id = $2)
+			AND ($3::uuid IS NULL OR p.item_id = $3)
+		ORDER BY st.name, i.name
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []InventoryStockPosition
+	for rows.Next() {
+		var p InventoryStockPosition
+		if err := rows.Scan(&p.ItemID, &p.ItemName, &p.Sku, &p.Unit, &p.StoreID, &p.StoreName, &p.Quantity, &p.Value); err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+// InventoryInTransitValue is the value dispatched but not yet received at
+// a moment, or now when at is not set.
+func (q *Queries) InventoryInTransitValue(ctx context.Context, tenantID pgtype.UUID, at pgtype.Timestamptz) (int64, error) {
+	var value int64
+	err := q.db.QueryRow(ctx, `
+		SELECT COALESCE(ROUND(SUM(ti.value) * 100), 0)::BIGINT
+		FROM inventory_transfers t JOIN inventory_transfer_items ti ON ti.transfer_id = t.id
+		WHERE t.tenant_id = $1 AND t.dispatched_at IS NOT NULL
+			AND t.dispatched_at < COALESCE($2, 'infinity'::timestamptz)
+			AND (t.received_at IS NULL OR t.received_at >= COALESCE($2, 'infinity'::timestamptz))
+	`, tenantID, at).Scan(&value)
+	return value, err
+}
+
+// Transfers
+
+type InventoryTransfer struct {
+	ID             pgtype.UUID        `json:"id"`
+	TenantID       pgtype.UUID        `json:"tenant_id"`
+	TransferNumber string             `json:"transfer_number"`
+	FromStoreID    pgtype.UUID        `json:"from_store_id"`
+	FromStoreName  string             `json:"from_store_name"`
+	ToStoreID      pgtype.UUID        `json:"to_store_id"`
+	ToStoreName    string             `json:"to_store_name"`
+	Status         string             `json:"status"`
+	Notes          pgtype.Text        `json:"notes"`
+	CreatedBy      pgtype.UUID        `json:"created_by"`
+	DispatchedBy   pgtype.UUID        `json:"dispatched_by"`
+	DispatchedAt   pgtype.Timestamptz `json:"dispatched_at"`
+	ReceivedBy     pgtype.UUID        `json:"received_by"`
+	ReceivedAt     pgtype.Timestamptz `json:"received_at"`
+	CreatedAt      pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt      pgtype.Timestamptz `json:"updated_at"`
+}
+
+const inventoryTransferColumns = `
+	t.id, t.tenant_id, t.transfer_number, t.from_store_id, fs.name, t.to_store_id, ts.name, t.status, t.notes,
+	t.created_by, t.dispatched_by, t.dispatched_at, t.received_by, t.received_at, t.created_at, t.updated_at`
+
+const inventoryTransferFrom = `
+	inventory_transfers t
+	JOIN inventory_stores fs ON fs.id = t.from_store_id
+	JOIN inventory_stores ts ON ts.id = t.to_store_id`
+
+func scanInventoryTransfer(row pgx.Row) (InventoryTransfer, error) {
+	var t InventoryTransfer
+	err := row.Scan(
+		&t.ID, &t.TenantID, &t.TransferNumber, &t.FromStoreID, &t.FromStoreName, &t.ToStoreID, &t.ToStoreName,
+		&t.Status, &t.Notes, &t.CreatedBy, &t.DispatchedBy, &t.DispatchedAt, &t.ReceivedBy, &t.ReceivedAt,
+		&t.CreatedAt, &t.UpdatedAt,
+	)
+	return t, err
+}
+
+// CreateInventoryTransfer opens a draft transfer numbered TRF-000001,
+// TRF-000002 and so on per tenant.
+func (q *Queries) CreateInventoryTransfer(ctx context.Context, tenantID, fromStoreID, toStoreID pgtype.UUID, notes pgtype.Text, createdBy pgtype.UUID) (pgtype.UUID, error) {
+	if _, err := q.db.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext('inventory_transfer:' || $1::text))`, tenantID); err != nil {
+		return pgtype.UUID{}, err
+	}
+	var id pgtype.UUID
+	err := q.db.QueryRow(ctx, `
+		INSERT INTO inventory_transfers (tenant_id, transfer_number, from_store_id, to_store_id, notes, created_by)
+		SELECT $1, 'TRF-' || lpad((COALESCE(MAX(substring(transfer_number FROM 5)::BIGINT), 0) + 1)::text, 6, '0'),
+			$2, $3, $4, $5
+		FROM inventory_transfers WHERE tenant_id = $1
+		RETURNING id
+	`, tenantID, fromStoreID, toStoreID, notes, createdBy).Scan(&id)
+	return id, err
+}
+
+func (q *Queries) GetInventoryTransfer(ctx context.Context, tenantID, id pgtype.UUID) (InventoryTransfer, error) {
+	query := `SELECT ` + inventoryTransferColumns + ` FROM ` + inventoryTransferFrom + ` WHERE t.tenant_id = $1 AND t.id = $2`
+	return scanInventoryTransfer(q.db.QueryRow(ctx, query, tenantID, id))
+}
+
+func (q *Queries) LockInventoryTransfer(ctx context.Context, tenantID, id pgtype.UUID) (InventoryTransfer, error) {
+	query := `SELECT ` + inventoryTransferColumns + ` FROM ` + inventoryTransferFrom + `
+		WHERE t.tenant_id = $1 AND t.id = $2 FOR UPDATE OF t`
+	return scanInventoryTransfer(q.db.QueryRow(ctx, query, tenantID, id))
+}
+
+type ListInventoryTransfersParams struct {
+	TenantID pgtype.UUID
+	StoreID  pgtype.UUID
+	Status   pgtype.Text
+}
+
+// ListInventoryTransfers returns transfers newest first; a store matches
+// transfers out of it and into it.
+func (q *Queries) ListInventoryTransfers(ctx context.Context, arg ListInventoryTransfersParams) ([]InventoryTransfer, error) {
+	rows, err := q.db.Query(ctx, `SELECT `+inventoryTransferColumns+` FROM `+inventoryTransferFrom+`
+		WHERE t.tenant_id = $1
+			AND ($2::uuid IS NULL OR t.from_store_id = $2 OR t.to_store_id = $2)
+			AND ($3::text IS NULL OR t.status = $3)
+		ORDER BY t.created_at DESC
+		LIMIT 500`, arg.TenantID, arg.StoreID, arg.Status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []InventoryTransfer
+	for rows.Next() {
+		t, err := scanInventoryTransfer(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+// SetInventoryTransferStatus moves a transfer on, stamping who dispatched
+// or received it.
+func (q *Queries) SetInventoryTransferStatus(ctx context.Context, id pgtype.UUID, status string, by pgtype.UUID) error {
+	_, err := q.db.Exec(ctx, `
+		UPDATE inventory_transfers SET
+			status = $2,
+			dispatched_by = CASE WHEN $2 = 'in_transit' THEN $3 ELSE dispatched_by END,
+			dispatched_at = CASE WHEN $2 = 'in_transit' THEN NOW() ELSE dispatched_at END,
+			received_by = CASE WHEN $2 = 'received' THEN $3 ELSE received_by END,
+			received_at = CASE WHEN $2 = 'received' THEN NOW() ELSE received_at END,
+			updated_at = NOW()
+		WHERE id = $1
+	`, id, status, by)
+	return err
+}
+
+type InventoryTransferItem struct {
+	ID               pgtype.UUID `json:"id"`
+	TransferID       pgtype.UUID `json:"transfer_id"`
+	ItemID           pgtype.UUID `json:"item_id"`
+	ItemName         string      `json:"item_name"`
+	Unit             pgtype.Text `json:"unit"`
+	Quantity         int32       `json:"quantity"`
+	Value            int64       `json:"value"`
+	CostLayers       []byte      `json:"-"`
+	ReceivedQuantity pgtype.Int4 `json:"received_quantity"`
+	ReceivedValue    pgtype.Int8 `json:"received_value"`
+	Remarks          pgtype.Text `json:"remarks"`
+}
+
+// CreateInventoryTransferItem adds a line for an item of the tenant; no
+// row comes back for another tenant's item.
+func (q *Queries) CreateInventoryTransferItem(ctx context.Context, tenantID, transferID, itemID pgtype.UUID, quantity int32) error {
+	var id pgtype.UUID
+	return q.db.QueryRow(ctx, `
+		INSERT INTO inventory_transfer_items (transfer_id, item_id, quantity)
+		SELECT $2, i.id, $4 FROM inventory_items i WHERE i.tenant_id = $1 AND i.id = $3
+		RETURNING id
+	`, tenantID, transferID, itemID, quantity).Scan(&id)
+}
+
+func (q *Queries) ListInventoryTransferItems(ctx context.Context, transferID pgtype.UUID) ([]InventoryTransferItem, error) {
+	rows, err := q.db.Query(ctx, `
+		SELECT ti.id, ti.transfer_id, ti.item_id, i.name, i.unit, ti.quantity, ROUND(ti.value * 100)::BIGINT,
+			ti.cost_layers, ti.received_quantity, ROUND(ti.received_value * 100)::BIGINT, ti.remarks
+		FROM inventory_transfer_items ti JOIN inventory_items i ON i.id = ti.item_id
+		WHERE ti.transfer_id = $1
+		ORDER BY i.name, ti.id
+	`, transferID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []InventoryTransferItem
+	for rows.Next() {
+		var it InventoryTransferItem
+		if err := rows.Scan(
+			&it.ID, &it.TransferID, &it.ItemID, &it.ItemName, &it.Unit, &it.Quantity, &it.Value, &it.CostLayers,
+			&it.ReceivedQuantity, &it.ReceivedValue, &it.Remarks,
+		); err != nil {
+			return nil, err
+		}
+		out = append(out, it)
+	}
+	return out, rows.Err()
+}
+
+// SetInventoryTransferItemDispatch records what a line cost the sending
+// store, and its FIFO layers.
+func (q *Queries) SetInventoryTransferItemDispatch(ctx context.Context, id pgtype.UUID, value int64, layers []byte) error {
+	_, err := q.db.Exec(ctx, `
+		UPDATE inventory_transfer_items SET value = $2::BIGINT / 100.0, cost_layers = $3 WHERE id = $1
+	`, id, value, layers)
+	return err
+}
+
+func (q *Queries) SetInventoryTransferItemReceipt(ctx context.Context, id pgtype.UUID, quantity int32, value int64, remarks pgtype.Text) error {
+	_, err := q.db.Exec(ctx, `
+		UPDATE inventory_transfer_items
+		SET received_quantity = $2, received_value = $3::BIGINT / 100.0, remarks = COALESCE($4, remarks)
+		WHERE id = $1
+	`, id, quantity, value, remarks)
+	return err
+}
+
+// Stock-takes
+
+type InventoryStockTake struct {
+	ID        pgtype.UUID        `json:"id"`
+	TenantID  pgtype.UUID        `json:"tenant_id"`
+	StoreID   pgtype.UUID        `json:"store_id"`
+	StoreName string             `json:"store_name"`
+	Status    string             `json:"status"`
+	Notes     pgtype.Text        `json:"notes"`
+	StartedBy pgtype.UUID        `json:"started_by"`
+	PostedBy  pgtype.UUID        `json:"posted_by"`
+	PostedAt  pgtype.Timestamptz `json:"posted_at"`
+	CreatedAt pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt pgtype.Timestamptz `json:"updated_at"`
+}
+
+const inventoryStockTakeColumns = `
+	k.id, k.tenant_id, k.store_id, st.name, k.status, k.notes, k.started_by, k.posted_by, k.posted_at,
+	k.created_at, k.updated_at`
+
+func scanInventoryStockTake(row pgx.Row) (InventoryStockTake, error) {
+	var k InventoryStockTake
+	err := row.Scan(
+		&k.ID, &k.TenantID, &k.StoreID, &k.StoreName, &k.Status, &k.Notes, &k.StartedBy, &k.PostedBy, &k.PostedAt,
+		&k.CreatedAt, &k.UpdatedAt,
+	)
+	return k, err
+}
+
+// CreateInventoryStockTake starts counting a store. A store has one count
+// open at a time; a second start fails on a unique violation.
+func (q *Queries) CreateInventoryStockTake(ctx context.Context, tenantID, storeID pgtype.UUID, notes pgtype.Text, startedBy pgtype.UUID) (pgtype.UUID, error) {
+	var id pgtype.UUID
+	err := q.db.QueryRow(ctx, `
+		INSERT INTO inventory_stock_takes (tenant_id, store_id, notes, started_by) VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`, tenantID, storeID, notes, startedBy).Scan(&id)
+	return id, err
+}
+
+// SnapshotInventoryStockTakeItems adds the lines to count with the store's
+// balances as they stand: the given items, or every item in stock there.
+func (q *Queries) SnapshotInventoryStockTakeItems(ctx context.Context, tenantID, stockTakeID, storeID pgtype.UUID, itemIDs []pgtype.UUID) (int64, error) {
+	tag, err := q.db.Exec(ctx, `
+		INSERT INTO inventory_stock_take_items (stock_take_id, item_id, system_quantity, system_value)
+		SELECT $2, i.id, COALESCE(s.quantity, 0), COALESCE(s.stock_value, 0)
+		FROM inventory_items i
+		LEFT JOIN inventory_stocks s ON s.item_id = i.id AND s.store_id = $3
+		WHERE i.tenant_id = $1
+			AND (CASE WHEN $4::uuid[] IS NULL THEN COALESCE(s.quantity, 0) <> 0 ELSE i.id = ANY($4) END)
+		ON CONFLICT (stock_take_id, item_id) DO NOTHING
+	`, tenantID, stockTakeID, storeID, itemIDs)
+	return tag.RowsAffected(), err
+}
+
+func (q *Queries) GetInventoryStockTake(ctx context.Context, tenantID, id pgtype.UUID) (InventoryStockTake, error) {
+	query := `SELECT ` + inventoryStockTakeColumns + ` FROM inventory_stock_takes k
+		JOIN inventory_stores st ON st.id = k.store_id WHERE k.tenant_id = $1 AND k.id = $2`
+	return scanInventoryStockTake(q.db.QueryRow(ctx, query, tenantID, id))
+}
+
+func (q *Queries) LockInventoryStockTake(ctx context.Context, tenantID, id pgtype.UUID) (InventoryStockTake, error) {
+	query := `SELECT ` + inventoryStockTakeColumns + ` FROM inventory_stock_takes k
+		JOIN inventory_stores st ON st.id = k.store_id WHERE k.tenant_id = $1 AND k.id = $2 FOR UPDATE OF k`
+	return scanInventoryStockTake(q.db.QueryRow(ctx, query, tenantID, id))
+}
+
+func (q *Queries) ListInventoryStockTakes(ctx context.Context, tenantID, storeID pgtype.UUID) ([]InventoryStockTake, error) {
+	rows, err := q.db.Query(ctx, `SELECT `+inventoryStockTakeColumns+` FROM inventory_stock_takes k
+		JOIN inventory_stores st ON st.id = k.store_id
+		WHERE k.tenant_id = $1 AND ($2::uuid IS NULL OR k.store_id = $2)
+		ORDER BY k.created_at DESC
+		LIMIT 200`, tenantID, storeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []InventoryStockTake
+	for rows.Next() {
+		k, err := scanInventoryStockTake(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, k)
+	}
+	return out, rows.Err()
+}
+
+func (q *Queries) SetInventoryStockTakeStatus(ctx context.Context, id pgtype.UUID, status string, by pgtype.UUID) error {
+	_, err := q.db.Exec(ctx, `
+		UPDATE inventory_stock_takes SET
+			status = $2,
+			posted_by = CASE WHEN $2 = 'posted' THEN $3 ELSE posted_by END,
+			posted_at = CASE WHEN $2 = 'posted' THEN NOW() ELSE posted_at END,
+			updated_at = NOW()
+		WHERE id = $1
+	`, id, status, by)
+	return err
+}
+
+type InventoryStockTakeItem struct {
+	ID              pgtype.UUID        `json:"id"`
+	ItemID          pgtype.UUID        `json:"item_id"`
+	ItemName        string             `json:"item_name"`
+	Sku             pgtype.Text        `json:"sku"`
+	Unit            pgtype.Text        `json:"unit"`
+	SystemQuantity  int32              `json:"system_quantity"`
+	SystemValue     int64              `json:"system_value"`
+	CountedQuantity pgtype.Int4        `json:"counted_quantity"`
+	VarianceValue   pgtype.Int8        `json:"variance_value"`
+	Reason          pgtype.Text        `json:"reason"`
+	CountedBy       pgtype.UUID        `json:"counted_by"`
+	CountedAt       pgtype.Timestamptz `json:"counted_at"`
+}
+
+func (q *Queries) ListInventoryStockTakeItems(ctx context.Context, stockTakeID pgtype.UUID) ([]InventoryStockTakeItem, error) {
+	rows, err := q.db.Query(ctx, `
+		SELECT ki.id, ki.item_id, i.name, i.sku, i.unit, ki.system_quantity, ROUND(ki.system_value * 100)::BIGINT,
+			ki.counted_quantity, ROUND(ki.variance_value * 100)::BIGINT, ki.reason, ki.counted_by, ki.counted_at
+		FROM inventory_stock_take_items ki JOIN inventory_items i ON i.id = ki.item_id
+		WHERE ki.stock_take_id = $1
+		ORDER BY i.name, ki.id
+	`, stockTakeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []InventoryStockTakeItem
+	for rows.Next() {
+		var it InventoryStockTakeItem
+		if err := rows.Scan(
+			&it.ID, &it.ItemID, &it.ItemName, &it.Sku, &it.Unit, &it.SystemQuantity, &it.SystemValue,
+			&it.CountedQuantity, &it.VarianceValue, &it.Reason, &it.CountedBy, &it.CountedAt,
+		); err != nil {
+			return nil, err
+		}
+		out = append(out, it)
+	}
+	return out, rows.Err()
+}
+
+// RecordInventoryStockTakeCount saves the count of a line; no row comes
+// back when the item is not on the stock-take.
+func (q *Queries) RecordInventoryStockTakeCount(ctx context.Context, stockTakeID, itemID pgtype.UUID, counted int32, reason pgtype.Text, by pgtype.UUID) error {
+	var id pgtype.UUID
+	return q.db.QueryRow(ctx, `
+		UPDATE inventory_stock_take_items
+		SET counted_quantity = $3, reason = $4, counted_by = $5, counted_at = NOW()
+		WHERE stock_take_id = $1 AND item_id = $2
+		RETURNING id
+	`, stockTakeID, itemID, counted, reason, by).Scan(&id)
+}
+
+func (q *Queries) SetInventoryStockTakeItemVariance(ctx context.Context, id pgtype.UUID, value int64) error {
+	_, err := q.db.Exec(ctx, `UPDATE inventory_stock_take_items SET variance_value = $2::BIGINT / 100.0 WHERE id = $1`, id, value)
+	return err
+}
@@ -0,0 +1,336 @@
+package db
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// TenantDataKey is a tenant's data encryption key, wrapped by a master key.
+type TenantDataKey struct {
+	ID          pgtype.UUID
+	TenantID    pgtype.UUID
+	Version     int32
+	Status      string
+	MasterKeyID string
+	WrappedKey  []byte
+	CreatedAt   pgtype.Timestamptz
+}
+
+const tenantDataKeyColumns = `id, tenant_id, version, status, COALESCE(master_key_id, ''), wrapped_key, created_at`
+
+func scanTenantDataKey(row pgx.Row) (TenantDataKey, error) {
+	var k TenantDataKey
+	err := row.Scan(&k.ID, &k.TenantID, &k.Version, &k.Status, &k.MasterKeyID, &k.WrappedKey, &k.CreatedAt)
+	return k, err
+}
+
+// GetActiveTenantDataKey returns the newest active key for a tenant.
+func (q *Queries) GetActiveTenantDataKey(ctx context.Context, tenantID pgtype.UUID) (TenantDataKey, error) {
+	query := `
+		SELECT ` + tenantDataKeyColumns + `
+		FROM tenant_data_keys
+		WHERE tenant_id = $1 AND status = 'active'
+		ORDER BY version DESC
+		LIMIT 1
+	`
+	return scanTenantDataKey(q.db.QueryRow(ctx, query, tenantID))
+}
+
+func (q *Queries) GetTenantDataKey(ctx context.Context, id pgtype.UUID) (TenantDataKey, error) {
+	query := `SELECT ` + tenantDataKeyColumns + ` FROM tenant_data_keys WHERE id = $1`
+	return scanTenantDataKey(q.db.QueryRow(ctx, query, id))
+}
+
+type CreateTenantDataKeyParams struct {
+	ID          pgtype.UUID
+	TenantID    pgtype.UUID
+	MasterKeyID string
+	WrappedKey  []byte
+}
+
+// CreateTenantDataKey adds the next key version as active. It returns
+// pgx.ErrNoRows when another writer took that version first, or when the
+// tenant's keys have been destroyed.
+func (q *Queries) CreateTenantDataKey(ctx context.Context, arg CreateTenantDataKeyParams) (TenantDataKey, error) {
+	query := `
+		INSERT INTO tenant_data_keys (id, tenant_id, version, status, master_key_id, wrapped_key)
+		SELECT $1, $2, COALESCE(MAX(version), 0) + 1, 'active', $3, $4
+		FROM tenant_data_keys
+		WHERE tenant_id = $2
+		HAVING COUNT(*) FILTER (WHERE status = 'destroyed') = 0
+		ON CONFLICT (tenant_id, version) DO NOTHING
+		RETURNING ` + tenantDataKeyColumns
+	return scanTenantDataKey(q.db.QueryRow(ctx, query, arg.ID, arg.TenantID, arg.MasterKeyID, arg.WrappedKey))
+}
+
+// RetireOlderTenantDataKeys retires active keys older than version. Retired
+// keys still decrypt until re-encryption has moved their values.
+func (q *Queries) RetireOlderTenantDataKeys(ctx context.Context, tenantID pgtype.UUID, version int32) error {
+	const query = `
+		UPDATE tenant_data_keys
+		SET status = 'retired', retired_at = NOW()
+		WHERE tenant_id = $1 AND status = 'active' AND version < $2
+	`
+	_, err := q.db.Exec(ctx, query, tenantID, version)
+	return err
+}
+
+// RewrapTenantDataKey stores a key re-wrapped under a new master key, unless
+// another worker already did.
+func (q *Queries) RewrapTenantDataKey(ctx context.Context, id pgtype.UUID, fromMasterKeyID, toMasterKeyID string, wrapped []byte) (int64, error) {
+	const query = `
+		UPDATE tenant_data_keys
+		SET master_key_id = $3, wrapped_key = $4
+		WHERE id = $1 AND master_key_id = $2 AND status <> 'destroyed'
+	`
+	tag, err := q.db.Exec(ctx, query, id, fromMasterKeyID, toMasterKeyID, wrapped)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// ListTenantDataKeysWrappedByOtherMaster pages through live keys not yet
+// wrapped by masterKeyID.
+func (q *Queries) ListTenantDataKeysWrappedByOtherMaster(ctx context.Context, masterKeyID string, after pgtype.UUID, limit int32) ([]TenantDataKey, error) {
+	query := `
+		SELECT ` + tenantDataKeyColumns + `
+		FROM tenant_data_keys
+		WHERE status <> 'destroyed' AND master_key_id <> $1 AND id > $2
+		ORDER BY id
+		LIMIT $3
+	`
+	if !after.Valid {
+		after = pgtype.UUID{Valid: true}
+	}
+	rows, err := q.db.Query(ctx, query, masterKeyID, after, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []TenantDataKey
+	for rows.Next() {
+		k, err := scanTenantDataKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, k)
+	}
+	return out, rows.Err()
+}
+
+// ListTenantsWithActiveKeyBefore pages through tenants whose active key was
+// created before a cutoff, i.e. those a rotation job still has to rotate.
+func (q *Queries) ListTenantsWithActiveKeyBefore(ctx context.Context, before pgtype.Timestamptz, after pgtype.UUID, limit int32) ([]pgtype.UUID, error) {
+	const query = `
+		SELECT DISTINCT tenant_id
+		FROM tenant_data_keys
+		WHERE status = 'active' AND created_at < $1 AND tenant_id > $2
+		ORDER BY tenant_id
+		LIMIT $3
+	`
+	if !after.Valid {
+		after = pgtype.UUID{Valid: true}
+	}
+	rows, err := q.db.Query(ctx, query, before, after, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []pgtype.UUID
+	for rows.Next() {
+		var id pgtype.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		out = append(out, id)
+	}
+	return out, rows.Err()
+}
+
+// DestroyTenantDataKeys crypto-shreds a tenant: wrapped keys are erased and
+// cannot be recovered from any master key.
+func (q *Queries) DestroyTenantDataKeys(ctx context.Context, tenantID pgtype.UUID) (int64, error) {
+	const query = `
+		UPDATE tenant_data_keys
+		SET status = 'destroyed', wrapped_key = NULL, master_key_id = NULL, destroyed_at = NOW()
+		WHERE tenant_id = $1 AND status <> 'destroyed'
+	`
+	tag, err := q.db.Exec(ctx, query, tenantID)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// MarkTenantDataKeysDestroyed records a shredded tenant that never had a key,
+// so no key can be created for it later.
+func (q *Queries) MarkTenantDataKeysDestroyed(ctx context.Context, id, tenantID pgtype.UUID) error {
+	const query = `
+		INSERT INTO tenant_data_keys (id, tenant_id, version, status, destroyed_at)
+		SELECT $1, $2, COALESCE(MAX(version), 0) + 1, 'destroyed', NOW()
+		FROM tenant_data_keys
+		WHERE tenant_id = $2
+		ON CONFLICT (tenant_id, version) DO NOTHING
+	`
+	_, err := q.db.Exec(ctx, query, id, tenantID)
+	return err
+}
+
+// ClearTenantLegacySecrets erases a tenant's sensitive values that are not
+// under a tenant data key (plaintext, or encrypted directly with a master
+// key), since destroying the tenant's keys would not make them unreadable.
+func (q *Queries) ClearTenantLegacySecrets(ctx context.Context, tenantID pgtype.UUID) error {
+	statements := []string{
+		`UPDATE employees SET bank_details = NULL
+		 WHERE tenant_id = $1 AND bank_details IS NOT NULL
+		   AND NOT (jsonb_typeof(bank_details) = 'string' AND bank_details #>> '{}' LIKE 'ev1:%')`,
+		`UPDATE visitors SET id_number = NULL
+		 WHERE tenant_id = $1 AND id_number IS NOT NULL AND id_number NOT LIKE 'ev1:%'`,
+		`UPDATE student_confidential_notes SET encrypted_content = ''
+		 WHERE tenant_id = $1 AND encrypted_content NOT LIKE 'ev1:%'`,
+		`UPDATE student_health_records
+		 SET allergies = '[]', vaccinations = '[]', medical_conditions = NULL,
+		     encrypted_details = CASE WHEN encrypted_details LIKE 'ev1:%' THEN encrypted_details END
+		 WHERE tenant_id = $1`,
+	}
+	for _, stmt := range statements {
+		if _, err := q.db.Exec(ctx, stmt, tenantID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DataReencryptionJob tracks a re-encryption run after a master key rotation.
+type DataReencryptionJob struct {
+	ID                pgtype.UUID        `json:"id"`
+	RotationRequestID pgtype.UUID        `json:"rotation_request_id"`
+	TargetMasterKeyID string             `json:"target_master_key_id"`
+	Status            string             `json:"status"`
+	KeysRotated       int32              `json:"keys_rotated"`
+	KeysRewrapped     int32              `json:"keys_rewrapped"`
+	ValuesReencrypted int64              `json:"values_reencrypted"`
+	Failures          int32              `json:"failures"`
+	LastError         pgtype.Text        `json:"last_error"`
+	CreatedAt         pgtype.Timestamptz `json:"created_at"`
+	StartedAt         pgtype.Timestamptz `json:"started_at"`
+	CompletedAt       pgtype.Timestamptz `json:"completed_at"`
+}
+
+const dataReencryptionJobColumns = `
+	id, rotation_request_id, target_master_key_id, status, keys_rotated, keys_rewrapped,
+	values_reencrypted, failures, last_error, created_at, started_at, completed_at
+`
+
+func scanDataReencryptionJob(row pgx.Row) (DataReencryptionJob, error) {
+	var j DataReencryptionJob
+	err := row.Scan(
+		&j.ID, &j.RotationRequestID, &j.TargetMasterKeyID, &j.Status, &j.KeysRotated, &j.KeysRewrapped,
+		&j.ValuesReencrypted, &j.Failures, &j.LastError, &j.CreatedAt, &j.StartedAt, &j.CompletedAt,
+	)
+	return j, err
+}
+
+func (q *Queries) CreateDataReencryptionJob(ctx context.Context, rotationRequestID pgtype.UUID, targetMasterKeyID string) (DataReencryptionJob, error) {
+	query := `
+		INSERT INTO data_reencryption_jobs (rotation_request_id, target_master_key_id)
+		VALUES ($1, $2)
+		RETURNING ` + dataReencryptionJobColumns
+	return scanDataReencryptionJob(q.db.QueryRow(ctx, query, rotationRequestID, targetMasterKeyID))
+}
+
+func (q *Queries) ListDataReencryptionJobs(ctx context.Context, limit, offset int32) ([]DataReencryptionJob, error) {
+	query := `
+		SELECT ` + dataReencryptionJobColumns + `
+		FROM data_reencryption_jobs
+		ORDER BY created_at DESC
+		LIMIT $1 OFFSET $2
+	`
+	rows, err := q.db.Query(ctx, query, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]DataReencryptionJob, 0)
+	for rows.Next() {
+		j, err := scanDataReencryptionJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, j)
+	}
+	return out, rows.Err()
+}
+
+// ClaimDataReencryptionJob takes the oldest open job targeting masterKeyID.
+// A running job whose worker stopped heartbeating for leaseSeconds can be
+// taken over.
+func (q *Queries) ClaimDataReencryptionJob(ctx context.Context, masterKeyID string, leaseSeconds int32) (DataReencryptionJob, error) {
+	query := `
+		UPDATE data_reencryption_jobs
+		SET status = 'running', started_at = COALESCE(started_at, NOW()), updated_at = NOW()
+		WHERE id = (
+			SELECT id FROM data_reencryption_jobs
+			WHERE target_master_key_id = $1
+			  AND (status = 'waiting' OR (status = 'running' AND updated_at < NOW() - make_interval(secs => $2)))
+			ORDER BY created_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + dataReencryptionJobColumns
+	return scanDataReencryptionJob(q.db.QueryRow(ctx, query, masterKeyID, leaseSeconds))
+}
+
+type DataReencryptionProgress struct {
+	KeysRotated       int32
+	KeysRewrapped     int32
+	ValuesReencrypted int64
+	Failures          int32
+	LastError         string
+}
+
+// UpdateDataReencryptionJob adds progress counts and extends the job's lease.
+func (q *Queries) UpdateDataReencryptionJob(ctx context.Context, id pgtype.UUID, p DataReencryptionProgress) error {
+	const query = `
+		UPDATE data_reencryption_jobs
+		SET keys_rotated = keys_rotated + $2,
+		    keys_rewrapped = keys_rewrapped + $3,
+		    values_reencrypted = values_reencrypted + $4,
+		    failures = failures + $5,
+		    last_error = COALESCE(NULLIF($6, ''), last_error),
+		    updated_at = NOW()
+		WHERE id = $1
+	`
+	_, err := q.db.Exec(ctx, query, id, p.KeysRotated, p.KeysRewrapped, p.ValuesReencrypted, p.Failures, p.LastError)
+	return err
+}
+
+func (q *Queries) FinishDataReencryptionJob(ctx context.Context, id pgtype.UUID, status string) error {
+	const query = `
+		UPDATE data_reencryption_jobs
+		SET status = $2, completed_at = NOW(), updated_at = NOW()
+		WHERE id = $1
+	`
+	_, err := q.db.Exec(ctx, query, id, status)
+	return err
+}
+
+// SupersedeDataReencryptionJobs closes waiting jobs queued before keepID:
+// their master keys were rotated again before they ran, and keepID covers
+// their work.
+func (q *Queries) SupersedeDataReencryptionJobs(ctx context.Context, keepID pgtype.UUID) error {
+	const query = `
+		UPDATE data_reencryption_jobs
+		SET status = 'failed', last_error = 'superseded by a newer rotation', completed_at = NOW(), updated_at = NOW()
+		WHERE id <> $1 AND status = 'waiting'
+		  AND created_at < (SELECT created_at FROM data_reencryption_jobs WHERE id = $1)
+	`
+	_, err := q.db.Exec(ctx, query, keepID)
+	return err
+}
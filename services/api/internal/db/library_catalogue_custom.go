@@ -0,0 +1,187 @@
+package db
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// ISBN cache
+
+// LibraryISBNRecord is a cached bibliographic record, keyed by ISBN-13.
+type LibraryISBNRecord struct {
+	TenantID      pgtype.UUID        `json:"tenant_id"`
+	ISBN          string             `json:"isbn"`
+	Title         string             `json:"title"`
+	Authors       []string           `json:"authors"`
+	Publisher     pgtype.Text        `json:"publisher"`
+	PublishedYear pgtype.Int4        `json:"published_year"`
+	Language      pgtype.Text        `json:"language"`
+	Subjects      []string           `json:"subjects"`
+	Source        string             `json:"source"`
+	FetchedAt     pgtype.Timestamptz `json:"fetched_at"`
+}
+
+const libraryISBNRecordColumns = `
+	tenant_id, isbn, title, authors, publisher, published_year, language, subjects, source, fetched_at`
+
+func scanLibraryISBNRecord(row pgx.Row) (LibraryISBNRecord, error) {
+	var r LibraryISBNRecord
+	err := row.Scan(
+		&r.TenantID, &r.ISBN, &r.Title, &r.Authors, &r.Publisher, &r.PublishedYear, &r.Language, &r.Subjects,
+		&r.Source, &r.FetchedAt,
+	)
+	return r, err
+}
+
+func (q *Queries) GetLibraryISBNRecord(ctx context.Context, tenantID pgtype.UUID, isbn string) (LibraryISBNRecord, error) {
+	query := `SELECT ` + libraryISBNRecordColumns + ` FROM library_isbn_cache WHERE tenant_id = $1 AND isbn = $2`
+	return scanLibraryISBNRecord(q.db.QueryRow(ctx, query, tenantID, isbn))
+}
+
+// UpsertLibraryISBNRecord stores a record, replacing what was cached for
+// the ISBN.
+func (q *Queries) UpsertLibraryISBNRecord(ctx context.Context, arg LibraryISBNRecord) error {
+	authors, subjects := arg.Authors, arg.Subjects
+	if authors == nil {
+		authors = []string{}
+	}
+	if subjects == nil {
+		subjects = []string{}
+	}
+	_, err := q.db.Exec(ctx, `
+		INSERT INTO library_isbn_cache (tenant_id, isbn, title, authors, publisher, published_year, language, subjects, source)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (tenant_id, isbn) DO UPDATE SET
+			title = EXCLUDED.title, authors = EXCLUDED.authors, publisher = EXCLUDED.publisher,
+			published_year = EXCLUDED.published_year, language = EXCLUDED.language,
+			subjects = EXCLUDED.subjects, source = EXCLUDED.source, fetched_at = NOW()
+	`, arg.TenantID, arg.ISBN, arg.Title, authors, arg.Publisher, arg.PublishedYear, arg.Language, subjects, arg.Source)
+	return err
+}
+
+// Catalogue
+
+// LibraryCatalogueBook is a title as it is exported, with its authors and
+// category by name.
+type LibraryCatalogueBook struct {
+	ID            pgtype.UUID        `json:"id"`
+	Title         string             `json:"title"`
+	ISBN          pgtype.Text        `json:"isbn"`
+	Publisher     pgtype.Text        `json:"publisher"`
+	PublishedYear pgtype.Int4        `json:"published_year"`
+	Language      pgtype.Text        `json:"language"`
+	CategoryName  pgtype.Text        `json:"category_name"`
+	Price         pgtype.Numeric     `json:"price"`
+	ShelfLocation pgtype.Text        `json:"shelf_location"`
+	Authors       []string           `json:"authors"`
+	CreatedAt     pgtype.Timestamptz `json:"created_at"`
+}
+
+const libraryCatalogueBookColumns = `
+	b.id, b.title, b.isbn, b.publisher, b.published_year, b.language, lc.name, b.price, b.shelf_location,
+	ARRAY(
+		SELECT a.name FROM library_book_authors ba JOIN library_authors a ON a.id = ba.author_id
+		WHERE ba.book_id = b.id ORDER BY a.created_at, a.name
+	),
+	b.created_at`
+
+func scanLibraryCatalogueBook(row pgx.Row) (LibraryCatalogueBook, error) {
+	var b LibraryCatalogueBook
+	err := row.Scan(
+		&b.ID, &b.Title, &b.ISBN, &b.Publisher, &b.PublishedYear, &b.Language, &b.CategoryName, &b.Price,
+		&b.ShelfLocation, &b.Authors, &b.CreatedAt,
+	)
+	return b, err
+}
+
+// isbnDigits matches the stored ISBN on its digits and check character.
+const isbnDigits = `regexp_replace(upper(b.isbn), '[^0-9X]', '', 'g')`
+
+// FindLibraryBookByISBN returns the tenant's title with any of the given
+// ISBN forms, oldest first.
+func (q *Queries) FindLibraryBookByISBN(ctx context.Context, tenantID pgtype.UUID, isbns []string) (LibraryCatalogueBook, error) {
+	query := `SELECT ` + libraryCatalogueBookColumns + `
+		FROM library_books b LEFT JOIN library_categories lc ON lc.id = b.category_id
+		WHERE b.tenant_id = $1 AND b.isbn IS NOT NULL AND ` + isbnDigits + ` = ANY($2::text[])
+		ORDER BY b.created_at, b.id
+		LIMIT 1`
+	return scanLibraryCatalogueBook(q.db.QueryRow(ctx, query, tenantID, isbns))
+}
+
+func (q *Queries) ListLibraryCatalogue(ctx context.Context, tenantID pgtype.UUID) ([]LibraryCatalogueBook, error) {
+	query := `SELECT ` + libraryCatalogueBookColumns + `
+		FROM library_books b LEFT JOIN library_categories lc ON lc.id = b.category_id
+		WHERE b.tenant_id = $1
+		ORDER BY b.title, b.id`
+	rows, err := q.db.Query(ctx, query, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []LibraryCatalogueBook
+	for rows.Next() {
+		b, err := scanLibraryCatalogueBook(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, b)
+	}
+	return out, rows.Err()
+}
+
+// ListLibraryCatalogueCopies returns every copy the library still holds,
+// grouped by title.
+func (q *Queries) ListLibraryCatalogueCopies(ctx context.Context, tenantID pgtype.UUID) ([]LibraryBookCopy, error) {
+	query := `SELECT ` + libraryBookCopyColumns + `
+		FROM library_book_copies c JOIN library_books b ON b.id = c.book_id
+		WHERE c.tenant_id = $1 AND c.status <> 'withdrawn'
+		ORDER BY c.book_id, c.accession_number`
+	rows, err := q.db.Query(ctx, query, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []LibraryBookCopy
+	for rows.Next() {
+		c, err := scanLibraryBookCopy(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// EnsureLibraryCategory returns the id of the category with a name,
+// creating it when the tenant has none.
+func (q *Queries) EnsureLibraryCategory(ctx context.Context, tenantID pgtype.UUID, name string) (pgtype.UUID, error) {
+	var id pgtype.UUID
+	err := q.db.QueryRow(ctx, `
+		INSERT INTO library_categories (tenant_id, name) VALUES ($1, $2)
+		ON CONFLICT (tenant_id, name) DO UPDATE SET updated_at = library_categories.updated_at
+		RETURNING id
+	`, tenantID, name).Scan(&id)
+	return id, err
+}
+
+// EnsureLibraryAuthor returns the id of the author with a name, matched
+// without regard to case, creating the author when there is none.
+func (q *Queries) EnsureLibraryAuthor(ctx context.Context, tenantID pgtype.UUID, name string) (pgtype.UUID, error) {
+	var id pgtype.UUID
+	err := q.db.QueryRow(ctx, `
+		SELECT id FROM library_authors WHERE tenant_id = $1 AND lower(name) = lower($2)
+		ORDER BY created_at LIMIT 1
+	`, tenantID, name).Scan(&id)
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return id, err
+	}
+	err = q.db.QueryRow(ctx, `
+		INSERT INTO library_authors (tenant_id, name) VALUES ($1, $2) RETURNING id
+	`, tenantID, name).Scan(&id)
+	return id, err
+}
@@ -0,0 +1,718 @@
+package db
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Settings
+
+type LibrarySettings struct {
+	TenantID        pgtype.UUID        `json:"tenant_id"`
+	AccessionPrefix string             `json:"accession_prefix"`
+	NextAccession   int64              `json:"next_accession"`
+	HoldDays        int32              `json:"hold_days"`
+	FineFeeHeadID   pgtype.UUID        `json:"fine_fee_head_id"`
+	UpdatedBy       pgtype.UUID        `json:"updated_by"`
+	UpdatedAt       pgtype.Timestamptz `json:"updated_at"`
+}
+
+const librarySettingsColumns = `tenant_id, accession_prefix, next_accession, hold_days, fine_fee_head_id, updated_by, updated_at`
+
+func scanLibrarySettings(row pgx.Row) (LibrarySettings, error) {
+	var s LibrarySettings
+	err := row.Scan(&s.TenantID, &s.AccessionPrefix, &s.NextAccession, &s.HoldDays, &s.FineFeeHeadID, &s.UpdatedBy, &s.UpdatedAt)
+	return s, err
+}
+
+func (q *Queries) GetLibrarySettings(ctx context.Context, tenantID pgtype.UUID) (LibrarySettings, error) {
+	query := `SELECT ` + librarySettingsColumns + ` FROM library_settings WHERE tenant_id = $1`
+	return scanLibrarySettings(q.db.QueryRow(ctx, query, tenantID))
+}
+
+// UpsertLibrarySettings saves the settings. It returns pgx.ErrNoRows when
+// the fine fee head is not the tenant's.
+func (q *Queries) UpsertLibrarySettings(ctx context.Context, tenantID pgtype.UUID, prefix string, holdDays int32, fineFeeHeadID, updatedBy pgtype.UUID) (LibrarySettings, error) {
+	query := `
+		INSERT INTO library_settings (tenant_id, accession_prefix, hold_days, fine_fee_head_id, updated_by)
+		SELECT $1, $2, $3, $4, $5
+		WHERE $4::uuid IS NULL OR EXISTS (SELECT 1 FROM fee_heads WHERE id = $4 AND tenant_id = $1)
+		ON CONFLICT (tenant_id) DO UPDATE SET
+			accession_prefix = EXCLUDED.accession_prefix, hold_days = EXCLUDED.hold_days,
+			fine_fee_head_id = EXCLUDED.fine_fee_head_id, updated_by = EXCLUDED.updated_by, updated_at = NOW()
+		RETURNING ` + librarySettingsColumns
+	return scanLibrarySettings(q.db.QueryRow(ctx, query, tenantID, prefix, holdDays, fineFeeHeadID, updatedBy))
+}
+
+// ReserveLibraryAccessions claims n consecutive accession numbers and
+// returns the first with the prefix to print them with.
+func (q *Queries) ReserveLibraryAccessions(ctx context.Context, tenantID pgtype.UUID, n int) (int64, string, error) {
+	var first int64
+	var prefix string
+	err := q.db.QueryRow(ctx, `
+		INSERT INTO library_settings (tenant_id, next_accession) VALUES ($1, 1 + $2::bigint)
+		ON CONFLICT (tenant_id) DO UPDATE SET next_accession = library_settings.next_accession + $2::bigint
+		RETURNING next_accession - $2::bigint, accession_prefix
+	`, tenantID, n).Scan(&first, &prefix)
+	return first, prefix, err
+}
+
+// Copies
+
+// LibraryBookCopy is one physical, accession-numbered copy of a title.
+type LibraryBookCopy struct {
+	ID              pgtype.UUID        `json:"id"`
+	TenantID        pgtype.UUID        `json:"tenant_id"`
+	BookID          pgtype.UUID        `json:"book_id"`
+	BookTitle       string             `json:"book_title"`
+	AccessionNumber string             `json:"accession_number"`
+	Barcode         string             `json:"barcode"`
+	Status          string             `json:"status"`
+	ShelfLocation   pgtype.Text        `json:"shelf_location"`
+	AcquiredOn      pgtype.Date        `json:"acquired_on"`
+	Notes           pgtype.Text        `json:"notes"`
+	CreatedAt       pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt       pgtype.Timestamptz `json:"updated_at"`
+}
+
+const libraryBookCopyColumns = `
+	c.id, c.tenant_id, c.book_id, b.title, c.accession_number, c.barcode, c.status,
+	c.shelf_location, c.acquired_on, c.notes, c.created_at, c.updated_at`
+
+func scanLibraryBookCopy(row pgx.Row) (LibraryBookCopy, error) {
+	var c LibraryBookCopy
+	err := row.Scan(
+		&c.ID, &c.TenantID, &c.BookID, &c.BookTitle, &c.AccessionNumber, &c.Barcode, &c.Status,
+		&c.ShelfLocation, &c.AcquiredOn, &c.Notes, &c.CreatedAt, &c.UpdatedAt,
+	)
+	return c, err
+}
+
+func (q *Queries) listLibraryBookCopies(ctx context.Context, query string, args ...any) ([]LibraryBookCopy, error) {
+	rows, err := q.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []LibraryBookCopy
+	for rows.Next() {
+		c, err := scanLibraryBookCopy(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+type CreateLibraryBookCopyParams struct {
+	TenantID        pgtype.UUID
+	BookID          pgtype.UUID
+	AccessionNumber string
+	Barcode         string
+	ShelfLocation   pgtype.Text
+	AcquiredOn      pgtype.Date
+	Notes           pgtype.Text
+}
+
+func (q *Queries) CreateLibraryBookCopy(ctx context.Context, arg CreateLibraryBookCopyParams) (LibraryBookCopy, error) {
+	query := `
+		WITH c AS (
+			INSERT INTO library_book_copies (tenant_id, book_id, accession_number, barcode, shelf_location, acquired_on, notes)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			RETURNING *
+		)
+		SELECT ` + libraryBookCopyColumns + ` FROM c JOIN library_books b ON b.id = c.book_id`
+	return scanLibraryBookCopy(q.db.QueryRow(ctx, query,
+		arg.TenantID, arg.BookID, arg.AccessionNumber, arg.Barcode, arg.ShelfLocation, arg.AcquiredOn, arg.Notes,
+	))
+}
+
+func (q *Queries) ListLibraryBookCopies(ctx context.Context, tenantID, bookID pgtype.UUID) ([]LibraryBookCopy, error) {
+	query := `SELECT ` + libraryBookCopyColumns + `
+		FROM library_book_copies c JOIN library_books b ON b.id = c.book_id
+		WHERE c.tenant_id = $1 AND c.book_id = $2
+		ORDER BY c.accession_number`
+	return q.listLibraryBookCopies(ctx, query, tenantID, bookID)
+}
+
+func (q *Queries) GetLibraryBookCopy(ctx context.Context, tenantID, id pgtype.UUID) (LibraryBookCopy, error) {
+	query := `SELECT ` + libraryBookCopyColumns + `
+		FROM library_book_copies c JOIN library_books b ON b.id = c.book_id
+		WHERE c.tenant_id = $1 AND c.id = $2`
+	return scanLibraryBookCopy(q.db.QueryRow(ctx, query, tenantID, id))
+}
+
+// GetLibraryBookCopyByBarcode finds a copy by its barcode or accession
+// number, whichever the desk scanned.
+func (q *Queries) GetLibraryBookCopyByBarcode(ctx context.Context, tenantID pgtype.UUID, code string) (LibraryBookCopy, error) {
+	query := `SELECT ` + libraryBookCopyColumns + `
+		FROM library_book_copies c JOIN library_books b ON b.id = c.book_id
+		WHERE c.tenant_id = $1 AND (c.barcode = $2 OR c.accession_number = $2)
+		ORDER BY (c.barcode = $2) DESC
+		LIMIT 1`
+	return scanLibraryBookCopy(q.db.QueryRow(ctx, query, tenantID, code))
+}
+
+// FirstAvailableLibraryBookCopy returns the lowest-numbered copy of a title
+// on the shelf. Callers lock the title first.
+func (q *Queries) FirstAvailableLibraryBookCopy(ctx context.Context, tenantID, bookID pgtype.UUID) (LibraryBookCopy, error) {
+	query := `SELECT ` + libraryBookCopyColumns + `
+		FROM library_book_copies c JOIN library_books b ON b.id = c.book_id
+		WHERE c.tenant_id = $1 AND c.book_id = $2 AND c.status = 'available'
+		ORDER BY c.accession_number
+		LIMIT 1`
+	return scanLibraryBookCopy(q.db.QueryRow(ctx, query, tenantID, bookID))
+}
+
+func (q *Queries) UpdateLibraryBookCopy(ctx context.Context, tenantID, id pgtype.UUID, status string, shelfLocation, notes pgtype.Text) error {
+	tag, err := q.db.Exec(ctx, `
+		UPDATE library_book_copies
+		SET status = $3, shelf_location = COALESCE($4, shelf_location), notes = COALESCE($5, notes), updated_at = NOW()
+		WHERE tenant_id = $1 AND id = $2
+	`, tenantID, id, status, shelfLocation, notes)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+func (q *Queries) SetLibraryBookCopyStatus(ctx context.Context, tenantID, id pgtype.UUID, status string) error {
+	return q.UpdateLibraryBookCopy(ctx, tenantID, id, status, pgtype.Text{}, pgtype.Text{})
+}
+
+// LockLibraryBook takes the title's row lock. Circulation on a title runs
+// under it so copies and the reservation queue change one step at a time.
+func (q *Queries) LockLibraryBook(ctx context.Context, tenantID, bookID pgtype.UUID) (string, error) {
+	var title string
+	err := q.db.QueryRow(ctx, `
+		SELECT title FROM library_books WHERE tenant_id = $1 AND id = $2 FOR UPDATE
+	`, tenantID, bookID).Scan(&title)
+	return title, err
+}
+
+// SyncLibraryBookCounts brings a title's copy counters in line with its
+// copies. Withdrawn copies no longer count towards the total.
+func (q *Queries) SyncLibraryBookCounts(ctx context.Context, tenantID, bookID pgtype.UUID) (LibraryBook, error) {
+	row := q.db.QueryRow(ctx, `
+		UPDATE library_books b SET
+			total_copies = (SELECT COUNT(*) FROM library_book_copies c WHERE c.book_id = b.id AND c.status <> 'withdrawn'),
+			available_copies = (SELECT COUNT(*) FROM library_book_copies c WHERE c.book_id = b.id AND c.status = 'available'),
+			updated_at = NOW()
+		WHERE b.tenant_id = $1 AND b.id = $2
+		RETURNING id, tenant_id, title, isbn, barcode, publisher, published_year, category_id, total_copies,
+			available_copies, shelf_location, cover_image_url, price, language, status, created_at, updated_at
+	`, tenantID, bookID)
+	var b LibraryBook
+	err := row.Scan(
+		&b.ID, &b.TenantID, &b.Title, &b.Isbn, &b.Barcode, &b.Publisher, &b.PublishedYear, &b.CategoryID,
+		&b.TotalCopies, &b.AvailableCopies, &b.ShelfLocation, &b.CoverImageUrl, &b.Price, &b.Language,
+		&b.Status, &b.CreatedAt, &b.UpdatedAt,
+	)
+	return b, err
+}
+
+// Members
+
+// LibraryMember is a student or staff member who borrows books.
+type LibraryMember struct {
+	Type    string      `json:"member_type"`
+	ID      pgtype.UUID `json:"member_id"`
+	Name    string      `json:"name"`
+	ClassID pgtype.UUID `json:"class_id"`
+	Status  string      `json:"status"`
+}
+
+func (q *Queries) GetLibraryStudentMember(ctx context.Context, tenantID, studentID pgtype.UUID) (LibraryMember, error) {
+	m := LibraryMember{Type: "student"}
+	err := q.db.QueryRow(ctx, `
+		SELECT s.id, s.full_name, sec.class_id, COALESCE(s.status, 'active')
+		FROM students s LEFT JOIN sections sec ON sec.id = s.section_id
+		WHERE s.tenant_id = $1 AND s.id = $2
+	`, tenantID, studentID).Scan(&m.ID, &m.Name, &m.ClassID, &m.Status)
+	return m, err
+}
+
+func (q *Queries) GetLibraryStaffMember(ctx context.Context, tenantID, employeeID pgtype.UUID) (LibraryMember, error) {
+	m := LibraryMember{Type: "staff"}
+	err := q.db.QueryRow(ctx, `
+		SELECT id, full_name, status FROM employees WHERE tenant_id = $1 AND id = $2
+	`, tenantID, employeeID).Scan(&m.ID, &m.Name, &m.Status)
+	return m, err
+}
+
+// ListLibraryMemberRecipients returns the users to tell about a member's
+// loans and holds: a student's guardians, or the staff member.
+func (q *Queries) ListLibraryMemberRecipients(ctx context.Context, tenantID, studentID, employeeID pgtype.UUID) ([]pgtype.UUID, error) {
+	const query = `
+		SELECT g.user_id
+		FROM student_guardians sg
+		JOIN guardians g ON g.id = sg.guardian_id
+		WHERE g.tenant_id = $1 AND sg.student_id = $2 AND g.user_id IS NOT NULL
+		UNION
+		SELECT e.user_id FROM employees e
+		WHERE e.tenant_id = $1 AND e.id = $3 AND e.user_id IS NOT NULL
+	`
+	return q.listUUIDs(ctx, query, tenantID, studentID, employeeID)
+}
+
+// Policies
+
+type LibraryMemberPolicy struct {
+	ID          pgtype.UUID        `json:"id"`
+	TenantID    pgtype.UUID        `json:"tenant_id"`
+	MemberType  string             `json:"member_type"`
+	ClassID     pgtype.UUID        `json:"class_id"`
+	ClassName   pgtype.Text        `json:"class_name"`
+	LoanDays    int32              `json:"loan_days"`
+	MaxBooks    int32              `json:"max_books"`
+	MaxRenewals int32              `json:"max_renewals"`
+	CreatedAt   pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt   pgtype.Timestamptz `json:"updated_at"`
+}
+
+const libraryMemberPolicyColumns = `
+	p.id, p.tenant_id, p.member_type, p.class_id, cl.name, p.loan_days, p.max_books, p.max_renewals,
+	p.created_at, p.updated_at`
+
+func scanLibraryMemberPolicy(row pgx.Row) (LibraryMemberPolicy, error) {
+	var p LibraryMemberPolicy
+	err := row.Scan(
+		&p.ID, &p.TenantID, &p.MemberType, &p.ClassID, &p.ClassName, &p.LoanDays, &p.MaxBooks, &p.MaxRenewals,
+		&p.CreatedAt, &p.UpdatedAt,
+	)
+	return p, err
+}
+
+func (q *Queries) ListLibraryMemberPolicies(ctx context.Context, tenantID pgtype.UUID) ([]LibraryMemberPolicy, error) {
+	query := `SELECT ` + libraryMemberPolicyColumns + `
+		FROM library_member_policies p LEFT JOIN classes cl ON cl.id = p.class_id
+		WHERE p.tenant_id = $1
+		ORDER BY p.member_type, p.class_id NULLS FIRST, cl.name`
+	rows, err := q.db.Query(ctx, query, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []LibraryMemberPolicy
+	for rows.Next() {
+		p, err := scanLibraryMemberPolicy(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+type UpsertLibraryMemberPolicyParams struct {
+	TenantID    pgtype.UUID
+	MemberType  string
+	ClassID     pgtype.UUID
+	LoanDays    int32
+	MaxBooks    int32
+	MaxRenewals int32
+}
+
+// UpsertLibraryMemberPolicy saves the policy for a member type and class.
+// It returns pgx.ErrNoRows when the class is not the tenant's.
+func (q *Queries) UpsertLibraryMemberPolicy(ctx context.Context, arg UpsertLibraryMemberPolicyParams) (LibraryMemberPolicy, error) {
+	query := `
+		WITH p AS (
+			INSERT INTO library_member_policies (tenant_id, member_type, class_id, loan_days, max_books, max_renewals)
+			SELECT $1, $2, $3, $4, $5, $6
+			WHERE $3::uuid IS NULL OR EXISTS (SELECT 1 FROM classes WHERE id = $3 AND tenant_id = $1)
+			ON CONFLICT (tenant_id, member_type, COALESCE(class_id, '00000000-0000-0000-0000-000000000000'::uuid))
+			DO UPDATE SET loan_days = EXCLUDED.loan_days, max_books = EXCLUDED.max_books,
+				max_renewals = EXCLUDED.max_renewals, updated_at = NOW()
+			RETURNING *
+		)
+		SELECT ` + libraryMemberPolicyColumns + ` FROM p LEFT JOIN classes cl ON cl.id = p.class_id`
+	return scanLibraryMemberPolicy(q.db.QueryRow(ctx, query,
+		arg.TenantID, arg.MemberType, arg.ClassID, arg.LoanDays, arg.MaxBooks, arg.MaxRenewals,
+	))
+}
+
+func (q *Queries) DeleteLibraryMemberPolicy(ctx context.Context, tenantID, id pgtype.UUID) error {
+	tag, err := q.db.Exec(ctx, `DELETE FROM library_member_policies WHERE tenant_id = $1 AND id = $2`, tenantID, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// ResolveLibraryMemberPolicy returns the policy that applies to a member:
+// the class policy for a student in a class that has one, otherwise the
+// member type's general policy.
+func (q *Queries) ResolveLibraryMemberPolicy(ctx context.Context, tenantID pgtype.UUID, memberType string, classID pgtype.UUID) (LibraryMemberPolicy, error) {
+	query := `SELECT ` + libraryMemberPolicyColumns + `
+		FROM library_member_policies p LEFT JOIN classes cl ON cl.id = p.class_id
+		WHERE p.tenant_id = $1 AND p.member_type = $2 AND (p.class_id IS NULL OR p.class_id = $3)
+		ORDER BY p.class_id NULLS LAST
+		LIMIT 1`
+	return scanLibraryMemberPolicy(q.db.QueryRow(ctx, query, tenantID, memberType, classID))
+}
+
+// Loans
+
+// LibraryLoan is a library issue with the copy and borrower it concerns.
+type LibraryLoan struct {
+	ID              pgtype.UUID        `json:"id"`
+	TenantID        pgtype.UUID        `json:"tenant_id"`
+	BookID          pgtype.UUID        `json:"book_id"`
+	BookTitle       string             `json:"book_title"`
+	CopyID          pgtype.UUID        `json:"copy_id"`
+	AccessionNumber pgtype.Text        `json:"accession_number"`
+	Barcode         pgtype.Text        `json:"barcode"`
+	StudentID       pgtype.UUID        `json:"student_id"`
+	EmployeeID      pgtype.UUID        `json:"employee_id"`
+	MemberName      pgtype.Text        `json:"member_name"`
+	UserID          pgtype.UUID        `json:"user_id"`
+	IssueDate       pgtype.Timestamptz `json:"issue_date"`
+	DueDate         pgtype.Timestamptz `json:"due_date"`
+	ReturnDate      pgtype.Timestamptz `json:"return_date"`
+	FineAmount      pgtype.Numeric     `json:"fine_amount"`
+	Status          string             `json:"status"`
+	Remarks         pgtype.Text        `json:"remarks"`
+	RenewalCount    int32              `json:"renewal_count"`
+	LastRenewedAt   pgtype.Timestamptz `json:"last_renewed_at"`
+	CreatedAt       pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt       pgtype.Timestamptz `json:"updated_at"`
+}
+
+// libraryOpenLoan matches loans whose copy is still out.
+const libraryOpenLoan = `i.status IN ('issued', 'overdue')`
+
+const libraryLoanColumns = `
+	i.id, i.tenant_id, i.book_id, b.title, i.copy_id, c.accession_number, c.barcode, i.student_id,
+	i.employee_id, COALESCE(s.full_name, e.full_name), i.user_id, i.issue_date, i.due_date, i.return_date,
+	i.fine_amount, i.status, i.remarks, i.renewal_count, i.last_renewed_at, i.created_at, i.updated_at`
+
+const libraryLoanFrom = `
+	FROM library_issues i
+	JOIN library_books b ON b.id = i.book_id
+	LEFT JOIN library_book_copies c ON c.id = i.copy_id
+	LEFT JOIN students s ON s.id = i.student_id
+	LEFT JOIN employees e ON e.id = i.employee_id`
+
+func scanLibraryLoan(row pgx.Row) (LibraryLoan, error) {
+	var l LibraryLoan
+	err := row.Scan(
+		&l.ID, &l.TenantID, &l.BookID, &l.BookTitle, &l.CopyID, &l.AccessionNumber, &l.Barcode, &l.StudentID,
+		&l.EmployeeID, &l.MemberName, &l.UserID, &l.IssueDate, &l.DueDate, &l.ReturnDate,
+		&l.FineAmount, &l.Status, &l.Remarks, &l.RenewalCount, &l.LastRenewedAt, &l.CreatedAt, &l.UpdatedAt,
+	)
+	return l, err
+}
+
+func (q *Queries) GetLibraryLoan(ctx context.Context, tenantID, id pgtype.UUID) (LibraryLoan, error) {
+	query := `SELECT ` + libraryLoanColumns + libraryLoanFrom + ` WHERE i.tenant_id = $1 AND i.id = $2`
+	return scanLibraryLoan(q.db.QueryRow(ctx, query, tenantID, id))
+}
+
+// LockLibraryLoan reads a loan and locks it for the rest of the transaction.
+func (q *Queries) LockLibraryLoan(ctx context.Context, tenantID, id pgtype.UUID) (LibraryLoan, error) {
+	query := `SELECT ` + libraryLoanColumns + libraryLoanFrom + ` WHERE i.tenant_id = $1 AND i.id = $2 FOR UPDATE OF i`
+	return scanLibraryLoan(q.db.QueryRow(ctx, query, tenantID, id))
+}
+
+// GetOpenLibraryLoanByCopy returns the loan a copy is out on.
+func (q *Queries) GetOpenLibraryLoanByCopy(ctx context.Context, tenantID, copyID pgtype.UUID) (LibraryLoan, error) {
+	query := `SELECT ` + libraryLoanColumns + libraryLoanFrom + `
+		WHERE i.tenant_id = $1 AND i.copy_id = $2 AND ` + libraryOpenLoan + `
+		ORDER BY i.issue_date DESC LIMIT 1`
+	return scanLibraryLoan(q.db.QueryRow(ctx, query, tenantID, copyID))
+}
+
+// ListLibraryMemberLoans returns a member's loans, newest first. Pass the
+// student or the employee; the other stays invalid.
+func (q *Queries) ListLibraryMemberLoans(ctx context.Context, tenantID, studentID, employeeID pgtype.UUID, openOnly bool) ([]LibraryLoan, error) {
+	query := `SELECT ` + libraryLoanColumns + libraryLoanFrom + `
+		WHERE i.tenant_id = $1 AND (i.student_id = $2 OR i.employee_id = $3)
+		  AND (NOT $4 OR ` + libraryOpenLoan + `)
+		ORDER BY i.issue_date DESC
+		LIMIT 200`
+	rows, err := q.db.Query(ctx, query, tenantID, studentID, employeeID, openOnly)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []LibraryLoan
+	for rows.Next() {
+		l, err := scanLibraryLoan(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, l)
+	}
+	return out, rows.Err()
+}
+
+func (q *Queries) CountOpenLibraryLoans(ctx context.Context, tenantID, studentID, employeeID pgtype.UUID) (int, error) {
+	var n int
+	err := q.db.QueryRow(ctx, `
+		SELECT COUNT(*) FROM library_issues i
+		WHERE i.tenant_id = $1 AND (i.student_id = $2 OR i.employee_id = $3) AND `+libraryOpenLoan,
+		tenantID, studentID, employeeID).Scan(&n)
+	return n, err
+}
+
+type CreateLibraryLoanParams struct {
+	TenantID   pgtype.UUID
+	BookID     pgtype.UUID
+	CopyID     pgtype.UUID
+	StudentID  pgtype.UUID
+	EmployeeID pgtype.UUID
+	UserID     pgtype.UUID
+	IssueDate  pgtype.Timestamptz
+	DueDate    pgtype.Timestamptz
+}
+
+func (q *Queries) CreateLibraryLoan(ctx context.Context, arg CreateLibraryLoanParams) (LibraryLoan, error) {
+	var id pgtype.UUID
+	err := q.db.QueryRow(ctx, `
+		INSERT INTO library_issues (tenant_id, book_id, copy_id, student_id, employee_id, user_id, issue_date, due_date, status)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, 'issued')
+		RETURNING id
+	`, arg.TenantID, arg.BookID, arg.CopyID, arg.StudentID, arg.EmployeeID, arg.UserID, arg.IssueDate, arg.DueDate).Scan(&id)
+	if err != nil {
+		return LibraryLoan{}, err
+	}
+	return q.GetLibraryLoan(ctx, arg.TenantID, id)
+}
+
+func (q *Queries) RenewLibraryLoan(ctx context.Context, tenantID, id pgtype.UUID, dueDate pgtype.Timestamptz) (LibraryLoan, error) {
+	_, err := q.db.Exec(ctx, `
+		UPDATE library_issues
+		SET due_date = $3, status = 'issued', renewal_count = renewal_count + 1, last_renewed_at = NOW(), updated_at = NOW()
+		WHERE tenant_id = $1 AND id = $2
+	`, tenantID, id, dueDate)
+	if err != nil {
+		return LibraryLoan{}, err
+	}
+	return q.GetLibraryLoan(ctx, tenantID, id)
+}
+
+type CloseLibraryLoanParams struct {
+	TenantID   pgtype.UUID
+	ID         pgtype.UUID
+	Status     string
+	ReturnDate pgtype.Timestamptz
+	FineAmount pgtype.Numeric
+	Remarks    pgtype.Text
+}
+
+// CloseLibraryLoan ends a loan as returned or lost.
+func (q *Queries) CloseLibraryLoan(ctx context.Context, arg CloseLibraryLoanParams) (LibraryLoan, error) {
+	_, err := q.db.Exec(ctx, `
+		UPDATE library_issues
+		SET status = $3, return_date = $4, fine_amount = $5, remarks = COALESCE($6, remarks), updated_at = NOW()
+		WHERE tenant_id = $1 AND id = $2
+	`, arg.TenantID, arg.ID, arg.Status, arg.ReturnDate, arg.FineAmount, arg.Remarks)
+	if err != nil {
+		return LibraryLoan{}, err
+	}
+	return q.GetLibraryLoan(ctx, arg.TenantID, arg.ID)
+}
+
+// Reservations
+
+type LibraryReservation struct {
+	ID              pgtype.UUID        `json:"id"`
+	TenantID        pgtype.UUID        `json:"tenant_id"`
+	BookID          pgtype.UUID        `json:"book_id"`
+	BookTitle       string             `json:"book_title"`
+	StudentID       pgtype.UUID        `json:"student_id"`
+	EmployeeID      pgtype.UUID        `json:"employee_id"`
+	MemberName      string             `json:"member_name"`
+	Status          string             `json:"status"`
+	Position        pgtype.Int4        `json:"position"`
+	CopyID          pgtype.UUID        `json:"copy_id"`
+	AccessionNumber pgtype.Text        `json:"accession_number"`
+	IssueID         pgtype.UUID        `json:"issue_id"`
+	ReadyAt         pgtype.Timestamptz `json:"ready_at"`
+	HoldUntil       pgtype.Timestamptz `json:"hold_until"`
+	CreatedBy       pgtype.UUID        `json:"created_by"`
+	CreatedAt       pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt       pgtype.Timestamptz `json:"updated_at"`
+}
+
+// Waiting reservations carry their place in the title's queue.
+const libraryReservationColumns = `
+	r.id, r.tenant_id, r.book_id, b.title, r.student_id, r.employee_id, COALESCE(s.full_name, e.full_name, ''),
+	r.status,
+	CASE WHEN r.status = 'waiting' THEN (
+		SELECT COUNT(*)::int FROM library_reservations w
+		WHERE w.book_id = r.book_id AND w.status = 'waiting' AND (w.created_at, w.id) <= (r.created_at, r.id)
+	) END,
+	r.copy_id, c.accession_number, r.issue_id, r.ready_at, r.hold_until, r.created_by, r.created_at, r.updated_at`
+
+const libraryReservationFrom = `
+	FROM library_reservations r
+	JOIN library_books b ON b.id = r.book_id
+	LEFT JOIN library_book_copies c ON c.id = r.copy_id
+	LEFT JOIN students s ON s.id = r.student_id
+	LEFT JOIN employees e ON e.id = r.employee_id`
+
+func scanLibraryReservation(row pgx.Row) (LibraryReservation, error) {
+	var r LibraryReservation
+	err := row.Scan(
+		&r.ID, &r.TenantID, &r.BookID, &r.BookTitle, &r.StudentID, &r.EmployeeID, &r.MemberName,
+		&r.Status, &r.Position,
+		&r.CopyID, &r.AccessionNumber, &r.IssueID, &r.ReadyAt, &r.HoldUntil, &r.CreatedBy, &r.CreatedAt, &r.UpdatedAt,
+	)
+	return r, err
+}
+
+func (q *Queries) listLibraryReservations(ctx context.Context, query string, args ...any) ([]LibraryReservation, error) {
+	rows, err := q.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []LibraryReservation
+	for rows.Next() {
+		r, err := scanLibraryReservation(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+func (q *Queries) GetLibraryReservation(ctx context.Context, tenantID, id pgtype.UUID) (LibraryReservation, error) {
+	query := `SELECT ` + libraryReservationColumns + libraryReservationFrom + ` WHERE r.tenant_id = $1 AND r.id = $2`
+	return scanLibraryReservation(q.db.QueryRow(ctx, query, tenantID, id))
+}
+
+type ListLibraryReservationsParams struct {
+	TenantID   pgtype.UUID
+	BookID     pgtype.UUID
+	StudentID  pgtype.UUID
+	EmployeeID pgtype.UUID
+	OpenOnly   bool
+}
+
+// ListLibraryReservations returns reservations in queue order, filtered by
+// title and member when given.
+func (q *Queries) ListLibraryReservations(ctx context.Context, arg ListLibraryReservationsParams) ([]LibraryReservation, error) {
+	query := `SELECT ` + libraryReservationColumns + libraryReservationFrom + `
+		WHERE r.tenant_id = $1
+		  AND ($2::uuid IS NULL OR r.book_id = $2)
+		  AND ($3::uuid IS NULL OR r.student_id = $3)
+		  AND ($4::uuid IS NULL OR r.employee_id = $4)
+		  AND (NOT $5 OR r.status IN ('waiting', 'ready'))
+		ORDER BY b.title, r.created_at, r.id
+		LIMIT 500`
+	return q.listLibraryReservations(ctx, query, arg.TenantID, arg.BookID, arg.StudentID, arg.EmployeeID, arg.OpenOnly)
+}
+
+func (q *Queries) CreateLibraryReservation(ctx context.Context, tenantID, bookID, studentID, employeeID, createdBy pgtype.UUID) (LibraryReservation, error) {
+	var id pgtype.UUID
+	err := q.db.QueryRow(ctx, `
+		INSERT INTO library_reservations (tenant_id, book_id, student_id, employee_id, created_by)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id
+	`, tenantID, bookID, studentID, employeeID, createdBy).Scan(&id)
+	if err != nil {
+		return LibraryReservation{}, err
+	}
+	return q.GetLibraryReservation(ctx, tenantID, id)
+}
+
+// GetOpenLibraryReservation returns a member's waiting or ready reservation
+// for a title.
+func (q *Queries) GetOpenLibraryReservation(ctx context.Context, tenantID, bookID, studentID, employeeID pgtype.UUID) (LibraryReservation, error) {
+	query := `SELECT ` + libraryReservationColumns + libraryReservationFrom + `
+		WHERE r.tenant_id = $1 AND r.book_id = $2 AND (r.student_id = $3 OR r.employee_id = $4)
+		  AND r.status IN ('waiting', 'ready')`
+	return scanLibraryReservation(q.db.QueryRow(ctx, query, tenantID, bookID, studentID, employeeID))
+}
+
+// NextWaitingLibraryReservation returns the head of a title's queue.
+func (q *Queries) NextWaitingLibraryReservation(ctx context.Context, tenantID, bookID pgtype.UUID) (LibraryReservation, error) {
+	query := `SELECT ` + libraryReservationColumns + libraryReservationFrom + `
+		WHERE r.tenant_id = $1 AND r.book_id = $2 AND r.status = 'waiting'
+		ORDER BY r.created_at, r.id
+		LIMIT 1`
+	return scanLibraryReservation(q.db.QueryRow(ctx, query, tenantID, bookID))
+}
+
+func (q *Queries) CountWaitingLibraryReservations(ctx context.Context, tenantID, bookID pgtype.UUID) (int, error) {
+	var n int
+	err := q.db.QueryRow(ctx, `
+		SELECT COUNT(*) FROM library_reservations WHERE tenant_id = $1 AND book_id = $2 AND status = 'waiting'
+	`, tenantID, bookID).Scan(&n)
+	return n, err
+}
+
+// HoldLibraryReservation sets a copy aside for a waiting reservation.
+func (q *Queries) HoldLibraryReservation(ctx context.Context, tenantID, id, copyID pgtype.UUID, holdUntil pgtype.Timestamptz) (LibraryReservation, error) {
+	_, err := q.db.Exec(ctx, `
+		UPDATE library_reservations
+		SET status = 'ready', copy_id = $3, ready_at = NOW(), hold_until = $4, updated_at = NOW()
+		WHERE tenant_id = $1 AND id = $2
+	`, tenantID, id, copyID, holdUntil)
+	if err != nil {
+		return LibraryReservation{}, err
+	}
+	return q.GetLibraryReservation(ctx, tenantID, id)
+}
+
+// CloseLibraryReservation ends a reservation as fulfilled, cancelled or
+// expired. A fulfilled reservation records the loan it became.
+func (q *Queries) CloseLibraryReservation(ctx context.Context, tenantID, id pgtype.UUID, status string, issueID pgtype.UUID) (LibraryReservation, error) {
+	_, err := q.db.Exec(ctx, `
+		UPDATE library_reservations SET status = $3, issue_id = $4, updated_at = NOW()
+		WHERE tenant_id = $1 AND id = $2
+	`, tenantID, id, status, issueID)
+	if err != nil {
+		return LibraryReservation{}, err
+	}
+	return q.GetLibraryReservation(ctx, tenantID, id)
+}
+
+// LibraryExpiredHold is a ready reservation whose pickup window has passed.
+type LibraryExpiredHold struct {
+	ID       pgtype.UUID
+	TenantID pgtype.UUID
+	BookID   pgtype.UUID
+}
+
+// ListExpiredLibraryHolds returns holds past their pickup window across
+// tenants, oldest first.
+func (q *Queries) ListExpiredLibraryHolds(ctx context.Context, limit int32) ([]LibraryExpiredHold, error) {
+	rows, err := q.db.Query(ctx, `
+		SELECT id, tenant_id, book_id FROM library_reservations
+		WHERE status = 'ready' AND hold_until < NOW()
+		ORDER BY hold_until
+		LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []LibraryExpiredHold
+	for rows.Next() {
+		var h LibraryExpiredHold
+		if err := rows.Scan(&h.ID, &h.TenantID, &h.BookID); err != nil {
+			return nil, err
+		}
+		out = append(out, h)
+	}
+	return out, rows.Err()
+}
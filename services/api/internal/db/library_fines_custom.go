@@ -0,0 +1,311 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Fine policies
+
+// LibraryFinePolicy sets how overdue, lost and damaged books are charged
+// for a member type, optionally for one book category. Amounts are in
+// paise.
+type LibraryFinePolicy struct {
+	ID            pgtype.UUID        `json:"id"`
+	TenantID      pgtype.UUID        `json:"tenant_id"`
+	MemberType    string             `json:"member_type"`
+	CategoryID    pgtype.UUID        `json:"category_id"`
+	CategoryName  pgtype.Text        `json:"category_name"`
+	PerDay        int64              `json:"per_day"`
+	GraceDays     int32              `json:"grace_days"`
+	MaxFine       pgtype.Int8        `json:"max_fine"`
+	SkipHolidays  bool               `json:"skip_holidays"`
+	SkipSundays   bool               `json:"skip_sundays"`
+	LostPercent   int32              `json:"lost_percent"`
+	LostMinimum   int64              `json:"lost_minimum"`
+	ProcessingFee int64              `json:"processing_fee"`
+	DamagePercent int32              `json:"damage_percent"`
+	CreatedAt     pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt     pgtype.Timestamptz `json:"updated_at"`
+}
+
+const libraryFinePolicyColumns = `
+	p.id, p.tenant_id, p.member_type, p.category_id, lc.name, p.per_day, p.grace_days, p.max_fine,
+	p.skip_holidays, p.skip_sundays, p.lost_percent, p.lost_minimum, p.processing_fee, p.damage_percent,
+	p.created_at, p.updated_at`
+
+func scanLibraryFinePolicy(row pgx.Row) (LibraryFinePolicy, error) {
+	var p LibraryFinePolicy
+	err := row.Scan(
+		&p.ID, &p.TenantID, &p.MemberType, &p.CategoryID, &p.CategoryName, &p.PerDay, &p.GraceDays, &p.MaxFine,
+		&p.SkipHolidays, &p.SkipSundays, &p.LostPercent, &p.LostMinimum, &p.ProcessingFee, &p.DamagePercent,
+		&p.CreatedAt, &p.UpdatedAt,
+	)
+	return p, err
+}
+
+func (q *Queries) ListLibraryFinePolicies(ctx context.Context, tenantID pgtype.UUID) ([]LibraryFinePolicy, error) {
+	query := `SELECT ` + libraryFinePolicyColumns + `
+		FROM library_fine_policies p LEFT JOIN library_categories lc ON lc.id = p.category_id
+		WHERE p.tenant_id = $1
+		ORDER BY p.member_type, p.category_id NULLS FIRST, lc.name`
+	rows, err := q.db.Query(ctx, query, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []LibraryFinePolicy
+	for rows.Next() {
+		p, err := scanLibraryFinePolicy(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+// UpsertLibraryFinePolicy saves the policy for a member type and category.
+// It returns pgx.ErrNoRows when the category is not the tenant's.
+func (q *Queries) UpsertLibraryFinePolicy(ctx context.Context, arg LibraryFinePolicy) (LibraryFinePolicy, error) {
+	query := `
+		WITH p AS (
+			INSERT INTO library_fine_policies (
+				tenant_id, member_type, category_id, per_day, grace_days, max_fine, skip_holidays,
+				skip_sundays, lost_percent, lost_minimum, processing_fee, damage_percent
+			)
+			SELECT $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12
+			WHERE $3::uuid IS NULL OR EXISTS (SELECT 1 FROM library_categories WHERE id = $3 AND tenant_id = $1)
+			ON CONFLICT (tenant_id, member_type, COALESCE(category_id, '00000000-0000-0000-0000-000000000000'::uuid))
+			DO UPDATE SET per_day = EXCLUDED.per_day, grace_days = EXCLUDED.grace_days, max_fine = EXCLUDED.max_fine,
+				skip_holidays = EXCLUDED.skip_holidays, skip_sundays = EXCLUDED.skip_sundays,
+				lost_percent = EXCLUDED.lost_percent, lost_minimum = EXCLUDED.lost_minimum,
+				processing_fee = EXCLUDED.processing_fee, damage_percent = EXCLUDED.damage_percent, updated_at = NOW()
+			RETURNING *
+		)
+		SELECT ` + libraryFinePolicyColumns + ` FROM p LEFT JOIN library_categories lc ON lc.id = p.category_id`
+	return scanLibraryFinePolicy(q.db.QueryRow(ctx, query,
+		arg.TenantID, arg.MemberType, arg.CategoryID, arg.PerDay, arg.GraceDays, arg.MaxFine, arg.SkipHolidays,
+		arg.SkipSundays, arg.LostPercent, arg.LostMinimum, arg.ProcessingFee, arg.DamagePercent,
+	))
+}
+
+func (q *Queries) DeleteLibraryFinePolicy(ctx context.Context, tenantID, id pgtype.UUID) error {
+	tag, err := q.db.Exec(ctx, `DELETE FROM library_fine_policies WHERE tenant_id = $1 AND id = $2`, tenantID, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// ResolveLibraryFinePolicy returns the fine policy for a member type and a
+// book: the one for the book's category when there is one, else the
+// general one.
+func (q *Queries) ResolveLibraryFinePolicy(ctx context.Context, tenantID pgtype.UUID, memberType string, bookID pgtype.UUID) (LibraryFinePolicy, error) {
+	query := `SELECT ` + libraryFinePolicyColumns + `
+		FROM library_fine_policies p LEFT JOIN library_categories lc ON lc.id = p.category_id
+		WHERE p.tenant_id = $1 AND p.member_type = $2
+		  AND (p.category_id IS NULL OR p.category_id = (SELECT category_id FROM library_books WHERE id = $3))
+		ORDER BY p.category_id NULLS LAST
+		LIMIT 1`
+	return scanLibraryFinePolicy(q.db.QueryRow(ctx, query, tenantID, memberType, bookID))
+}
+
+// GetLibraryBookPrice returns a title's price in paise; zero when no price
+// is recorded.
+func (q *Queries) GetLibraryBookPrice(ctx context.Context, tenantID, bookID pgtype.UUID) (int64, error) {
+	var price int64
+	err := q.db.QueryRow(ctx, `
+		SELECT COALESCE(ROUND(price * 100), 0)::bigint FROM library_books WHERE tenant_id = $1 AND id = $2
+	`, tenantID, bookID).Scan(&price)
+	return price, err
+}
+
+// Fines
+
+// LibraryFine is a charge raised on a loan. Outstanding is what is left
+// after waivers.
+type LibraryFine struct {
+	ID              pgtype.UUID        `json:"id"`
+	TenantID        pgtype.UUID        `json:"tenant_id"`
+	IssueID         pgtype.UUID        `json:"issue_id"`
+	BookID          pgtype.UUID        `json:"book_id"`
+	BookTitle       string             `json:"book_title"`
+	AccessionNumber pgtype.Text        `json:"accession_number"`
+	StudentID       pgtype.UUID        `json:"student_id"`
+	EmployeeID      pgtype.UUID        `json:"employee_id"`
+	MemberName      pgtype.Text        `json:"member_name"`
+	Kind            string             `json:"kind"`
+	Amount          int64              `json:"amount"`
+	WaivedAmount    int64              `json:"waived_amount"`
+	Outstanding     int64              `json:"outstanding"`
+	Status          string             `json:"status"`
+	Details         json.RawMessage    `json:"details"`
+	WaiverAmount    pgtype.Int8        `json:"waiver_amount"`
+	WaiverReason    pgtype.Text        `json:"waiver_reason"`
+	WaiverRequestID pgtype.UUID        `json:"waiver_request_id"`
+	FeeChargeID     pgtype.UUID        `json:"fee_charge_id"`
+	PostedAt        pgtype.Timestamptz `json:"posted_at"`
+	PaidAt          pgtype.Timestamptz `json:"paid_at"`
+	CreatedBy       pgtype.UUID        `json:"created_by"`
+	CreatedAt       pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt       pgtype.Timestamptz `json:"updated_at"`
+}
+
+const libraryFineColumns = `
+	f.id, f.tenant_id, f.issue_id, i.book_id, b.title, c.accession_number, f.student_id, f.employee_id,
+	COALESCE(s.full_name, e.full_name), f.kind, f.amount, f.waived_amount, f.amount - f.waived_amount,
+	f.status, f.details, f.waiver_amount, f.waiver_reason, f.waiver_request_id, f.fee_charge_id,
+	f.posted_at, f.paid_at, f.created_by, f.created_at, f.updated_at`
+
+const libraryFineFrom = `
+	FROM library_fines f
+	JOIN library_issues i ON i.id = f.issue_id
+	JOIN library_books b ON b.id = i.book_id
+	LEFT JOIN library_book_copies c ON c.id = i.copy_id
+	LEFT JOIN students s ON s.id = f.student_id
+	LEFT JOIN employees e ON e.id = f.employee_id`
+
+func scanLibraryFine(row pgx.Row) (LibraryFine, error) {
+	var f LibraryFine
+	err := row.Scan(
+		&f.ID, &f.TenantID, &f.IssueID, &f.BookID, &f.BookTitle, &f.AccessionNumber, &f.StudentID, &f.EmployeeID,
+		&f.MemberName, &f.Kind, &f.Amount, &f.WaivedAmount, &f.Outstanding,
+		&f.Status, &f.Details, &f.WaiverAmount, &f.WaiverReason, &f.WaiverRequestID, &f.FeeChargeID,
+		&f.PostedAt, &f.PaidAt, &f.CreatedBy, &f.CreatedAt, &f.UpdatedAt,
+	)
+	return f, err
+}
+
+func (q *Queries) GetLibraryFine(ctx context.Context, tenantID, id pgtype.UUID) (LibraryFine, error) {
+	query := `SELECT ` + libraryFineColumns + libraryFineFrom + ` WHERE f.tenant_id = $1 AND f.id = $2`
+	return scanLibraryFine(q.db.QueryRow(ctx, query, tenantID, id))
+}
+
+// LockLibraryFine reads a fine and locks it for the rest of the
+// transaction.
+func (q *Queries) LockLibraryFine(ctx context.Context, tenantID, id pgtype.UUID) (LibraryFine, error) {
+	query := `SELECT ` + libraryFineColumns + libraryFineFrom + ` WHERE f.tenant_id = $1 AND f.id = $2 FOR UPDATE OF f`
+	return scanLibraryFine(q.db.QueryRow(ctx, query, tenantID, id))
+}
+
+type ListLibraryFinesParams struct {
+	TenantID   pgtype.UUID
+	StudentID  pgtype.UUID
+	EmployeeID pgtype.UUID
+	IssueID    pgtype.UUID
+	// Statuses limits the list when not empty.
+	Statuses []string
+}
+
+func (q *Queries) ListLibraryFines(ctx context.Context, arg ListLibraryFinesParams) ([]LibraryFine, error) {
+	query := `SELECT ` + libraryFineColumns + libraryFineFrom + `
+		WHERE f.tenant_id = $1
+		  AND ($2::uuid IS NULL OR f.student_id = $2)
+		  AND ($3::uuid IS NULL OR f.employee_id = $3)
+		  AND ($4::uuid IS NULL OR f.issue_id = $4)
+		  AND (cardinality($5::text[]) = 0 OR f.status = ANY($5))
+		ORDER BY f.created_at DESC, f.id
+		LIMIT 500`
+	statuses := arg.Statuses
+	if statuses == nil {
+		statuses = []string{}
+	}
+	rows, err := q.db.Query(ctx, query, arg.TenantID, arg.StudentID, arg.EmployeeID, arg.IssueID, statuses)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []LibraryFine
+	for rows.Next() {
+		f, err := scanLibraryFine(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, f)
+	}
+	return out, rows.Err()
+}
+
+type CreateLibraryFineParams struct {
+	TenantID   pgtype.UUID
+	IssueID    pgtype.UUID
+	StudentID  pgtype.UUID
+	EmployeeID pgtype.UUID
+	Kind       string
+	Amount     int64
+	Details    []byte
+	CreatedBy  pgtype.UUID
+}
+
+func (q *Queries) CreateLibraryFine(ctx context.Context, arg CreateLibraryFineParams) (LibraryFine, error) {
+	var id pgtype.UUID
+	err := q.db.QueryRow(ctx, `
+		INSERT INTO library_fines (tenant_id, issue_id, student_id, employee_id, kind, amount, details, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, COALESCE($7::jsonb, '{}'::jsonb), $8)
+		RETURNING id
+	`, arg.TenantID, arg.IssueID, arg.StudentID, arg.EmployeeID, arg.Kind, arg.Amount, arg.Details, arg.CreatedBy).Scan(&id)
+	if err != nil {
+		return LibraryFine{}, err
+	}
+	return q.GetLibraryFine(ctx, arg.TenantID, id)
+}
+
+// RequestLibraryFineWaiver records a waiver awaiting approval.
+func (q *Queries) RequestLibraryFineWaiver(ctx context.Context, tenantID, id pgtype.UUID, amount int64, reason string, approvalID pgtype.UUID) (LibraryFine, error) {
+	_, err := q.db.Exec(ctx, `
+		UPDATE library_fines
+		SET status = 'waiver_requested', waiver_amount = $3, waiver_reason = $4, waiver_request_id = $5, updated_at = NOW()
+		WHERE tenant_id = $1 AND id = $2
+	`, tenantID, id, amount, reason, approvalID)
+	if err != nil {
+		return LibraryFine{}, err
+	}
+	return q.GetLibraryFine(ctx, tenantID, id)
+}
+
+// SettleLibraryFineWaiver records the outcome of a waiver request: the
+// fine's new status and the total waived so far.
+func (q *Queries) SettleLibraryFineWaiver(ctx context.Context, tenantID, id pgtype.UUID, status string, waivedAmount int64) (LibraryFine, error) {
+	_, err := q.db.Exec(ctx, `
+		UPDATE library_fines SET status = $3, waived_amount = $4, updated_at = NOW()
+		WHERE tenant_id = $1 AND id = $2
+	`, tenantID, id, status, waivedAmount)
+	if err != nil {
+		return LibraryFine{}, err
+	}
+	return q.GetLibraryFine(ctx, tenantID, id)
+}
+
+// MarkLibraryFinePosted links a fine to the fee ledger charge it was
+// posted as.
+func (q *Queries) MarkLibraryFinePosted(ctx context.Context, tenantID, id, chargeID pgtype.UUID) (LibraryFine, error) {
+	_, err := q.db.Exec(ctx, `
+		UPDATE library_fines SET status = 'posted', fee_charge_id = $3, posted_at = NOW(), updated_at = NOW()
+		WHERE tenant_id = $1 AND id = $2
+	`, tenantID, id, chargeID)
+	if err != nil {
+		return LibraryFine{}, err
+	}
+	return q.GetLibraryFine(ctx, tenantID, id)
+}
+
+// MarkLibraryFinePaid records a fine collected at the desk.
+func (q *Queries) MarkLibraryFinePaid(ctx context.Context, tenantID, id pgtype.UUID) (LibraryFine, error) {
+	_, err := q.db.Exec(ctx, `
+		UPDATE library_fines SET status = 'paid', paid_at = NOW(), updated_at = NOW()
+		WHERE tenant_id = $1 AND id = $2
+	`, tenantID, id)
+	if err != nil {
+		return LibraryFine{}, err
+	}
+	return q.GetLibraryFine(ctx, tenantID, id)
+}
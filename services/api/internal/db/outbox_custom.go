@@ -0,0 +1,33 @@
+package db
+
+import "context"
+
+// GetPendingOutboxEventsExcept is GetPendingOutboxEvents without the given
+// event types, for a consumer that leaves them to another one.
+func (q *Queries) GetPendingOutboxEventsExcept(ctx context.Context, limitCount int32, eventTypes []string) ([]Outbox, error) {
+	const query = `
+		SELECT id, tenant_id, event_type, payload, status, retry_count, error_message, process_after, created_at, processed_at
+		FROM outbox
+		WHERE (status = 'pending' OR (status = 'failed' AND retry_count < 5))
+		  AND process_after <= NOW()
+		  AND NOT (event_type = ANY($2::text[]))
+		ORDER BY process_after ASC, created_at ASC
+		LIMIT $1
+	`
+	rows, err := q.db.Query(ctx, query, limitCount, eventTypes)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []Outbox
+	for rows.Next() {
+		var i Outbox
+		if err := rows.Scan(&i.ID, &i.TenantID, &i.EventType, &i.Payload, &i.Status, &i.RetryCount,
+			&i.ErrorMessage, &i.ProcessAfter, &i.CreatedAt, &i.ProcessedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	return items, rows.Err()
+}
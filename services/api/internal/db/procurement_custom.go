@@ -0,0 +1,654 @@
+package db
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Amounts are NUMERIC rupees in the database and paise here, as for stock.
+
+// Settings
+
+type ProcurementSettings struct {
+	TenantID             pgtype.UUID        `json:"tenant_id"`
+	AutoReorder          bool               `json:"auto_reorder"`
+	QuantityTolerancePct float64            `json:"quantity_tolerance_pct"`
+	PriceTolerancePct    float64            `json:"price_tolerance_pct"`
+	AmountTolerance      int64              `json:"amount_tolerance"`
+	UpdatedBy            pgtype.UUID        `json:"updated_by"`
+	UpdatedAt            pgtype.Timestamptz `json:"updated_at"`
+}
+
+// GetProcurementSettings returns the school's settings, or the defaults
+// when it has not saved any.
+func (q *Queries) GetProcurementSettings(ctx context.Context, tenantID pgtype.UUID) (ProcurementSettings, error) {
+	var s ProcurementSettings
+	err := q.db.QueryRow(ctx, `
+		SELECT $1::uuid, COALESCE(p.auto_reorder, FALSE), COALESCE(p.quantity_tolerance_pct, 0)::FLOAT8,
+			COALESCE(p.price_tolerance_pct, 2)::FLOAT8, ROUND(COALESCE(p.amount_tolerance, 0) * 100)::BIGINT,
+			p.updated_by, p.updated_at
+		FROM (SELECT 1) d
+		LEFT JOIN procurement_settings p ON p.tenant_id = $1
+	`, tenantID).Scan(&s.TenantID, &s.AutoReorder, &s.QuantityTolerancePct, &s.PriceTolerancePct, &s.AmountTolerance,
+		&s.UpdatedBy, &s.UpdatedAt)
+	return s, err
+}
+
+func (q *Queries) SaveProcurementSettings(ctx context.Context, s ProcurementSettings) error {
+	_, err := q.db.Exec(ctx, `
+		INSERT INTO procurement_settings (tenant_id, auto_reorder, quantity_tolerance_pct, price_tolerance_pct, amount_tolerance, updated_by)
+		VALUES ($1, $2, $3, $4, $5::BIGINT / 100.0, $6)
+		ON CONFLICT (tenant_id) DO UPDATE SET
+			auto_reorder = EXCLUDED.auto_reorder,
+			quantity_tolerance_pct = EXCLUDED.quantity_tolerance_pct,
+			price_tolerance_pct = EXCLUDED.price_tolerance_pct,
+			amount_tolerance = EXCLUDED.amount_tolerance,
+			updated_by = EXCLUDED.updated_by,
+			updated_at = NOW()
+	`, s.TenantID, s.AutoReorder, s.QuantityTolerancePct, s.PriceTolerancePct, s.AmountTolerance, s.UpdatedBy)
+	return err
+}
+
+// ListAutoReorderTenants returns the schools that have reorders drafted
+// for them.
+func (q *Queries) ListAutoReorderTenants(ctx context.Context) ([]pgtype.UUID, error) {
+	rows, err := q.db.Query(ctx, `SELECT tenant_id FROM procurement_settings WHERE auto_reorder`)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[pgtype.UUID])
+}
+
+// Reorder levels
+
+func (q *Queries) InventorySupplierExists(ctx context.Context, tenantID, id pgtype.UUID) (bool, error) {
+	var ok bool
+	err := q.db.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM inventory_suppliers WHERE tenant_id = $1 AND id = $2)`,
+		tenantID, id).Scan(&ok)
+	return ok, err
+}
+
+type SetInventoryItemReorderParams struct {
+	TenantID            pgtype.UUID
+	ItemID              pgtype.UUID
+	ReorderLevel        int32
+	ReorderQuantity     pgtype.Int4
+	PreferredSupplierID pgtype.UUID
+}
+
+// SetInventoryItemReorder saves an item's reorder rule; no row comes back
+// for another tenant's item.
+func (q *Queries) SetInventoryItemReorder(ctx context.Context, arg SetInventoryItemReorderParams) error {
+	var id pgtype.UUID
+	return q.db.QueryRow(ctx, `
+		UPDATE inventory_items SET reorder_level = $3, reorder_quantity = $4, preferred_supplier_id = $5, updated_at = NOW()
+		WHERE tenant_id = $1 AND id = $2
+		RETURNING id
+	`, arg.TenantID, arg.ItemID, arg.ReorderLevel, arg.ReorderQuantity, arg.PreferredSupplierID).Scan(&id)
+}
+
+type ReorderCandidate struct {
+	ItemID          pgtype.UUID `json:"item_id"`
+	ItemName        string      `json:"item_name"`
+	Sku             pgtype.Text `json:"sku"`
+	Unit            pgtype.Text `json:"unit"`
+	ReorderLevel    int32       `json:"reorder_level"`
+	ReorderQuantity pgtype.Int4 `json:"reorder_quantity"`
+	OnHand          int64       `json:"on_hand"`
+	OnOrder         int64       `json:"on_order"`
+	SupplierID      pgtype.UUID `json:"supplier_id"`
+	SupplierName    pgtype.Text `json:"supplier_name"`
+	LastCost        int64       `json:"last_cost"`
+}
+
+// ListReorderCandidates returns the items whose stock, counting stock in
+// transit between stores and stock still to come on open orders, is at or
+// below their reorder level. The supplier is the item's preferred one, or
+// the one it was last bought from.
+func (q *Queries) ListReorderCandidates(ctx context.Context, tenantID pgtype.UUID) ([]ReorderCandidate, error) {
+	rows, err := q.db.Query(ctx, `
+		WITH stock AS (
+			SELECT item_id, SUM(quantity) AS qty FROM inventory_stocks WHERE tenant_id = $1 GROUP BY item_id
+		), transit AS (
+			SELECT ti.item_id, SUM(ti.quantity) AS qty
+			FROM inventory_transfer_items ti JOIN inventory_transfers t ON t.id = ti.transfer_id
+			WHERE t.tenant_id = $1 AND t.status = 'in_transit'
+			GROUP BY ti.item_id
+		), on_order AS (
+			SELECT poi.item_id, SUM(GREATEST(poi.quantity - poi.received_quantity, 0)) AS qty
+			FROM purchase_order_items poi JOIN purchase_orders po ON po.id = poi.po_id
+			WHERE po.tenant_id = $1 AND po.status IN ('draft', 'submitted', 'approved', 'partially_received')
+			GROUP BY poi.item_id
+		), last_cost AS (
+			SELECT DISTINCT ON (item_id) item_id, ROUND(unit_price * 100)::BIGINT AS cost
+			FROM inventory_transactions
+			WHERE tenant_id = $1 AND type = 'in' AND unit_price > 0
+			ORDER BY item_id, created_at DESC
+		), last_supplier AS (
+			SELECT DISTINCT ON (item_id) item_id, supplier_id
+			FROM inventory_transactions
+			WHERE tenant_id = $1 AND type = 'in' AND supplier_id IS NOT NULL
+			ORDER BY item_id, created_at DESC
+		), c AS (
+			SELECT i.id, i.name, i.sku, i.unit, i.reorder_level, i.reorder_quantity,
+				(COALESCE(st.qty, 0) + COALESCE(tr.qty, 0))::BIGINT AS on_hand,
+				COALESCE(oo.qty, 0)::BIGINT AS on_order,
+				COALESCE(i.preferred_supplier_id, ls.supplier_id) AS supplier_id,
+				COALESCE(lc.cost, 0) AS last_cost
+			FROM inventory_items i
+			LEFT JOIN stock st ON st.item_id = i.id
+			LEFT JOIN transit tr ON tr.item_id = i.id
+			LEFT JOIN on_order oo ON oo.item_id = i.id
+			LEFT JOIN last_cost lc ON lc.item_id = i.id
+			LEFT JOIN last_supplier ls ON ls.item_id = i.id
+			WHERE i.tenant_id = $1 AND COALESCE(i.reorder_level, 0) > 0
+		)
+		SELECT c.id, c.name, c.sku, c.unit, c.reorder_level, c.reorder_quantity, c.on_hand, c.on_order,
+			c.supplier_id, s.name, c.last_cost
+		FROM c LEFT JOIN inventory_suppliers s ON s.id = c.supplier_id
+		WHERE c.on_hand + c.on_order <= c.reorder_level
+		ORDER BY s.name NULLS LAST, c.name
+	`, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []ReorderCandidate
+	for rows.Next() {
+		var c ReorderCandidate
+		if err := rows.Scan(&c.ItemID, &c.ItemName, &c.Sku, &c.Unit, &c.ReorderLevel, &c.ReorderQuantity,
+			&c.OnHand, &c.OnOrder, &c.SupplierID, &c.SupplierName, &c.LastCost); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// LockTenantReorder serialises reorder runs for a school, so two runs do
+// not both order the same shortfall.
+func (q *Queries) LockTenantReorder(ctx context.Context, tenantID pgtype.UUID) error {
+	_, err := q.db.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext('inventory_reorder:' || $1::text))`, tenantID)
+	return err
+}
+
+// Purchase orders
+
+// CreateAutoPurchaseOrder drafts an order for the reorder run, numbered
+// PO-AUTO-000001, PO-AUTO-000002 and so on per tenant.
+func (q *Queries) CreateAutoPurchaseOrder(ctx context.Context, tenantID, supplierID pgtype.UUID, notes pgtype.Text) (pgtype.UUID, error) {
+	if _, err := q.db.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext('purchase_order:' || $1::text))`, tenantID); err != nil {
+		return pgtype.UUID{}, err
+	}
+	var id pgtype.UUID
+	err := q.db.QueryRow(ctx, `
+		INSERT INTO purchase_orders (tenant_id, po_number, supplier_id, status, notes, auto_generated)
+		SELECT $1, 'PO-AUTO-' || lpad((COALESCE(MAX(substring(po_number FROM 9)::BIGINT), 0) + 1)::text, 6, '0'),
+			$2, 'draft', $3, TRUE
+		FROM purchase_orders WHERE tenant_id = $1 AND po_number ~ '^PO-AUTO-[0-9]+$'
+		RETURNING id
+	`, tenantID, supplierID, notes).Scan(&id)
+	return id, err
+}
+
+// SetPurchaseOrderDelivery records where and by when an order is to be
+// delivered, and totals its lines.
+func (q *Queries) SetPurchaseOrderDelivery(ctx context.Context, id, storeID pgtype.UUID, expected pgtype.Date) error {
+	_, err := q.db.Exec(ctx, `
+		UPDATE purchase_orders SET store_id = $2, expected_date = $3,
+			total_amount = (SELECT COALESCE(SUM(quantity * unit_price), 0) FROM purchase_order_items WHERE po_id = $1),
+			updated_at = NOW()
+		WHERE id = $1
+	`, id, storeID, expected)
+	return err
+}
+
+type ProcurementOrder struct {
+	ID            pgtype.UUID        `json:"id"`
+	TenantID      pgtype.UUID        `json:"tenant_id"`
+	PoNumber      string             `json:"po_number"`
+	SupplierID    pgtype.UUID        `json:"supplier_id"`
+	SupplierName  pgtype.Text        `json:"supplier_name"`
+	Status        string             `json:"status"`
+	TotalAmount   int64              `json:"total_amount"`
+	StoreID       pgtype.UUID        `json:"store_id"`
+	StoreName     pgtype.Text        `json:"store_name"`
+	ExpectedDate  pgtype.Date        `json:"expected_date"`
+	AutoGenerated bool               `json:"auto_generated"`
+	Notes         pgtype.Text        `json:"notes"`
+	CreatedBy     pgtype.UUID        `json:"created_by"`
+	ApprovedBy    pgtype.UUID        `json:"approved_by"`
+	ApprovedAt    pgtype.Timestamptz `json:"approved_at"`
+	ReceivedAt    pgtype.Timestamptz `json:"received_at"`
+	CreatedAt     pgtype.Timestamptz `json:"created_at"`
+}
+
+const procurementOrderQuery = `
+	SELECT po.id, po.tenant_id, po.po_number, po.supplier_id, s.name, po.status,
+		ROUND(COALESCE(po.total_amount, 0) * 100)::BIGINT, po.store_id, st.name, po.expected_date, po.auto_generated,
+		po.notes, po.created_by, po.approved_by, po.approved_at, po.received_at, po.created_at
+	FROM purchase_orders po
+	LEFT JOIN inventory_suppliers s ON s.id = po.supplier_id
+	LEFT JOIN inventory_stores st ON st.id = po.store_id
+	WHERE po.tenant_id = $1 AND po.id = $2`
+
+func scanProcurementOrder(row pgx.Row) (ProcurementOrder, error) {
+	var o ProcurementOrder
+	err := row.Scan(&o.ID, &o.TenantID, &o.PoNumber, &o.SupplierID, &o.SupplierName, &o.Status, &o.TotalAmount,
+		&o.StoreID, &o.StoreName, &o.ExpectedDate, &o.AutoGenerated, &o.Notes, &o.CreatedBy, &o.ApprovedBy,
+		&o.ApprovedAt, &o.ReceivedAt, &o.CreatedAt)
+	return o, err
+}
+
+func (q *Queries) GetProcurementOrder(ctx context.Context, tenantID, id pgtype.UUID) (ProcurementOrder, error) {
+	return scanProcurementOrder(q.db.QueryRow(ctx, procurementOrderQuery, tenantID, id))
+}
+
+func (q *Queries) LockProcurementOrder(ctx context.Context, tenantID, id pgtype.UUID) (ProcurementOrder, error) {
+	return scanProcurementOrder(q.db.QueryRow(ctx, procurementOrderQuery+` FOR UPDATE OF po`, tenantID, id))
+}
+
+// SetPurchaseOrderStatus moves an order on; received_at is stamped when
+// the last of it arrives or it is closed short.
+func (q *Queries) SetPurchaseOrderStatus(ctx context.Context, id pgtype.UUID, status string) error {
+	_, err := q.db.Exec(ctx, `
+		UPDATE purchase_orders SET status = $2,
+			received_at = CASE WHEN $2 IN ('received', 'closed') THEN COALESCE(received_at, NOW()) ELSE received_at END,
+			updated_at = NOW()
+		WHERE id = $1
+	`, id, status)
+	return err
+}
+
+type PurchaseOrderLine struct {
+	ID               pgtype.UUID `json:"id"`
+	ItemID           pgtype.UUID `json:"item_id"`
+	ItemName         string      `json:"item_name"`
+	Sku              pgtype.Text `json:"sku"`
+	Unit             pgtype.Text `json:"unit"`
+	Quantity         int32       `json:"quantity"`
+	UnitPrice        int64       `json:"unit_price"`
+	ReceivedQuantity int32       `json:"received_quantity"`
+	RejectedQuantity int32       `json:"rejected_quantity"`
+	InvoicedQuantity int32       `json:"invoiced_quantity"`
+}
+
+// ListPurchaseOrderLines returns an order's lines with what has been
+// accepted into stock, sent back, and billed on invoices not rejected.
+func (q *Queries) ListPurchaseOrderLines(ctx context.Context, poID pgtype.UUID) ([]PurchaseOrderLine, error) {
+	rows, err := q.db.Query(ctx, `
+		SELECT poi.id, poi.item_id, i.name, i.sku, i.unit, poi.quantity, ROUND(poi.unit_price * 100)::BIGINT,
+			poi.received_quantity, poi.rejected_quantity,
+			COALESCE((
+				SELECT SUM(sii.quantity) FROM supplier_invoice_items sii
+				JOIN supplier_invoices si ON si.id = sii.invoice_id
+				WHERE sii.po_item_id = poi.id AND si.status <> 'rejected'
+			), 0)::INTEGER
+		FROM purchase_order_items poi JOIN inventory_items i ON i.id = poi.item_id
+		WHERE poi.po_id = $1
+		ORDER BY poi.created_at, poi.id
+	`, poID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []PurchaseOrderLine
+	for rows.Next() {
+		var l PurchaseOrderLine
+		if err := rows.Scan(&l.ID, &l.ItemID, &l.ItemName, &l.Sku, &l.Unit, &l.Quantity, &l.UnitPrice,
+			&l.ReceivedQuantity, &l.RejectedQuantity, &l.InvoicedQuantity); err != nil {
+			return nil, err
+		}
+		out = append(out, l)
+	}
+	return out, rows.Err()
+}
+
+func (q *Queries) RecordPurchaseOrderLineReceipt(ctx context.Context, id pgtype.UUID, accepted, rejected int32) error {
+	_, err := q.db.Exec(ctx, `
+		UPDATE purchase_order_items
+		SET received_quantity = received_quantity + $2, rejected_quantity = rejected_quantity + $3
+		WHERE id = $1
+	`, id, accepted, rejected)
+	return err
+}
+
+// Goods receipts
+
+// CreatePurchaseReceipt records a delivery, numbered GRN-000001,
+// GRN-000002 and so on per tenant.
+func (q *Queries) CreatePurchaseReceipt(ctx context.Context, tenantID, poID, storeID pgtype.UUID, notes pgtype.Text, receivedBy pgtype.UUID) (pgtype.UUID, string, error) {
+	if _, err := q.db.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext('purchase_receipt:' || $1::text))`, tenantID); err != nil {
+		return pgtype.UUID{}, "", err
+	}
+	var id pgtype.UUID
+	var number string
+	err := q.db.QueryRow(ctx, `
+		INSERT INTO purchase_receipts (tenant_id, po_id, receipt_number, store_id, notes, received_by)
+		SELECT $1, $2, 'GRN-' || lpad((COALESCE(MAX(substring(receipt_number FROM 5)::BIGINT), 0) + 1)::text, 6, '0'),
+			$3, $4, $5
+		FROM purchase_receipts WHERE tenant_id = $1
+		RETURNING id, receipt_number
+	`, tenantID, poID, storeID, notes, receivedBy).Scan(&id, &number)
+	return id, number, err
+}
+
+type CreatePurchaseReceiptItemParams struct {
+	ReceiptID         pgtype.UUID
+	POItemID          pgtype.UUID
+	ItemID            pgtype.UUID
+	DeliveredQuantity int32
+	RejectedQuantity  int32
+	RejectionReason   pgtype.Text
+	TransactionID     pgtype.UUID
+}
+
+func (q *Queries) CreatePurchaseReceiptItem(ctx context.Context, arg CreatePurchaseReceiptItemParams) error {
+	_, err := q.db.Exec(ctx, `
+		INSERT INTO purchase_receipt_items (receipt_id, po_item_id, item_id, delivered_quantity, rejected_quantity, rejection_reason, transaction_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`, arg.ReceiptID, arg.POItemID, arg.ItemID, arg.DeliveredQuantity, arg.RejectedQuantity, arg.RejectionReason, arg.TransactionID)
+	return err
+}
+
+type PurchaseReceiptLine struct {
+	ReceiptID         pgtype.UUID        `json:"receipt_id"`
+	ReceiptNumber     string             `json:"receipt_number"`
+	StoreID           pgtype.UUID        `json:"store_id"`
+	StoreName         string             `json:"store_name"`
+	Notes             pgtype.Text        `json:"notes"`
+	ReceivedBy        pgtype.UUID        `json:"received_by"`
+	ReceivedAt        pgtype.Timestamptz `json:"received_at"`
+	POItemID          pgtype.UUID        `json:"po_item_id"`
+	ItemID            pgtype.UUID        `json:"item_id"`
+	ItemName          string             `json:"item_name"`
+	DeliveredQuantity int32              `json:"delivered_quantity"`
+	RejectedQuantity  int32              `json:"rejected_quantity"`
+	RejectionReason   pgtype.Text        `json:"rejection_reason"`
+}
+
+// ListPurchaseReceiptLines returns every line of every delivery against an
+// order, in the order they arrived.
+func (q *Queries) ListPurchaseReceiptLines(ctx context.Context, poID pgtype.UUID) ([]PurchaseReceiptLine, error) {
+	rows, err := q.db.Query(ctx, `
+		SELECT r.id, r.receipt_number, r.store_id, st.name, r.notes, r.received_by, r.received_at,
+			ri.po_item_id, ri.item_id, i.name, ri.delivered_quantity, ri.rejected_quantity, ri.rejection_reason
+		FROM purchase_receipts r
+		JOIN inventory_stores st ON st.id = r.store_id
+		JOIN purchase_receipt_items ri ON ri.receipt_id = r.id
+		JOIN inventory_items i ON i.id = ri.item_id
+		WHERE r.po_id = $1
+		ORDER BY r.received_at, r.id, i.name
+	`, poID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []PurchaseReceiptLine
+	for rows.Next() {
+		var l PurchaseReceiptLine
+		if err := rows.Scan(&l.ReceiptID, &l.ReceiptNumber, &l.StoreID, &l.StoreName, &l.Notes, &l.ReceivedBy, &l.ReceivedAt,
+			&l.POItemID, &l.ItemID, &l.ItemName, &l.DeliveredQuantity, &l.RejectedQuantity, &l.RejectionReason); err != nil {
+			return nil, err
+		}
+		out = append(out, l)
+	}
+	return out, rows.Err()
+}
+
+// Supplier invoices
+
+type SupplierInvoice struct {
+	ID             pgtype.UUID        `json:"id"`
+	TenantID       pgtype.UUID        `json:"tenant_id"`
+	SupplierID     pgtype.UUID        `json:"supplier_id"`
+	SupplierName   string             `json:"supplier_name"`
+	PoID           pgtype.UUID        `json:"po_id"`
+	PoNumber       string             `json:"po_number"`
+	InvoiceNumber  string             `json:"invoice_number"`
+	InvoiceDate    pgtype.Date        `json:"invoice_date"`
+	Subtotal       int64              `json:"subtotal"`
+	TaxAmount      int64              `json:"tax_amount"`
+	TotalAmount    int64              `json:"total_amount"`
+	Status         string             `json:"status"`
+	Exceptions     []byte             `json:"-"`
+	Notes          pgtype.Text        `json:"notes"`
+	CreatedBy      pgtype.UUID        `json:"created_by"`
+	DecidedBy      pgtype.UUID        `json:"decided_by"`
+	DecidedAt      pgtype.Timestamptz `json:"decided_at"`
+	DecisionReason pgtype.Text        `json:"decision_reason"`
+	CreatedAt      pgtype.Timestamptz `json:"created_at"`
+}
+
+const supplierInvoiceColumns = `
+	si.id, si.tenant_id, si.supplier_id, s.name, si.po_id, po.po_number, si.invoice_number, si.invoice_date,
+	ROUND(si.subtotal * 100)::BIGINT, ROUND(si.tax_amount * 100)::BIGINT, ROUND(si.total_amount * 100)::BIGINT,
+	si.status, si.exceptions, si.notes, si.created_by, si.decided_by, si.decided_at, si.decision_reason, si.created_at`
+
+const supplierInvoiceFrom = `
+	supplier_invoices si
+	JOIN inventory_suppliers s ON s.id = si.supplier_id
+	JOIN purchase_orders po ON po.id = si.po_id`
+
+func scanSupplierInvoice(row pgx.Row) (SupplierInvoice, error) {
+	var i SupplierInvoice
+	err := row.Scan(&i.ID, &i.TenantID, &i.SupplierID, &i.SupplierName, &i.PoID, &i.PoNumber, &i.InvoiceNumber,
+		&i.InvoiceDate, &i.Subtotal, &i.TaxAmount, &i.TotalAmount, &i.Status, &i.Exceptions, &i.Notes, &i.CreatedBy,
+		&i.DecidedBy, &i.DecidedAt, &i.DecisionReason, &i.CreatedAt)
+	return i, err
+}
+
+type CreateSupplierInvoiceParams struct {
+	TenantID      pgtype.UUID
+	SupplierID    pgtype.UUID
+	PoID          pgtype.UUID
+	InvoiceNumber string
+	InvoiceDate   pgtype.Date
+	Subtotal      int64
+	TaxAmount     int64
+	TotalAmount   int64
+	Status        string
+	Exceptions    []byte
+	Notes         pgtype.Text
+	CreatedBy     pgtype.UUID
+}
+
+func (q *Queries) CreateSupplierInvoice(ctx context.Context, arg CreateSupplierInvoiceParams) (pgtype.UUID, error) {
+	var id pgtype.UUID
+	err := q.db.QueryRow(ctx, `
+		INSERT INTO supplier_invoices (tenant_id, supplier_id, po_id, invoice_number, invoice_date, subtotal, tax_amount,
+			total_amount, status, exceptions, notes, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6::BIGINT / 100.0, $7::BIGINT / 100.0, $8::BIGINT / 100.0, $9, $10, $11, $12)
+		RETURNING id
+	`, arg.TenantID, arg.SupplierID, arg.PoID, arg.InvoiceNumber, arg.InvoiceDate, arg.Subtotal, arg.TaxAmount,
+		arg.TotalAmount, arg.Status, arg.Exceptions, arg.Notes, arg.CreatedBy).Scan(&id)
+	return id, err
+}
+
+func (q *Queries) CreateSupplierInvoiceItem(ctx context.Context, invoiceID, poItemID, itemID pgtype.UUID, quantity int32, unitPrice int64) error {
+	_, err := q.db.Exec(ctx, `
+		INSERT INTO supplier_invoice_items (invoice_id, po_item_id, item_id, quantity, unit_price)
+		VALUES ($1, $2, $3, $4, $5::BIGINT / 100.0)
+	`, invoiceID, poItemID, itemID, quantity, unitPrice)
+	return err
+}
+
+func (q *Queries) GetSupplierInvoice(ctx context.Context, tenantID, id pgtype.UUID) (SupplierInvoice, error) {
+	return scanSupplierInvoice(q.db.QueryRow(ctx, `SELECT `+supplierInvoiceColumns+` FROM `+supplierInvoiceFrom+`
+		WHERE si.tenant_id = $1 AND si.id = $2`, tenantID, id))
+}
+
+func (q *Queries) LockSupplierInvoice(ctx context.Context, tenantID, id pgtype.UUID) (SupplierInvoice, error) {
+	return scanSupplierInvoice(q.db.QueryRow(ctx, `SELECT `+supplierInvoiceColumns+` FROM `+supplierInvoiceFrom+`
+		WHERE si.tenant_id = $1 AND si.id = $2 FOR UPDATE OF si`, tenantID, id))
+}
+
+type ListSupplierInvoicesParams struct {
+	TenantID   pgtype.UUID
+	SupplierID pgtype.UUID
+	PoID       pgtype.UUID
+	Status     pgtype.Text
+}
+
+func (q *Queries) ListSupplierInvoices(ctx context.Context, arg ListSupplierInvoicesParams) ([]SupplierInvoice, error) {
+	rows, err := q.db.Query(ctx, `SELECT `+supplierInvoiceColumns+` FROM `+supplierInvoiceFrom+`
+		WHERE si.tenant_id = $1
+			AND ($2::uuid IS NULL OR si.supplier_id = $2)
+			AND ($3::uuid IS NULL OR si.po_id = $3)
+			AND ($4::text IS NULL OR si.status = $4)
+		ORDER BY si.invoice_date DESC, si.created_at DESC
+		LIMIT 500`, arg.TenantID, arg.SupplierID, arg.PoID, arg.Status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []SupplierInvoice
+	for rows.Next() {
+		i, err := scanSupplierInvoice(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, i)
+	}
+	return out, rows.Err()
+}
+
+type SupplierInvoiceLine struct {
+	ID        pgtype.UUID `json:"id"`
+	POItemID  pgtype.UUID `json:"po_item_id"`
+	ItemID    pgtype.UUID `json:"item_id"`
+	ItemName  string      `json:"item_name"`
+	Quantity  int32       `json:"quantity"`
+	UnitPrice int64       `json:"unit_price"`
+}
+
+func (q *Queries) ListSupplierInvoiceLines(ctx context.Context, invoiceID pgtype.UUID) ([]SupplierInvoiceLine, error) {
+	rows, err := q.db.Query(ctx, `
+		SELECT sii.id, sii.po_item_id, sii.item_id, i.name, sii.quantity, ROUND(sii.unit_price * 100)::BIGINT
+		FROM supplier_invoice_items sii JOIN inventory_items i ON i.id = sii.item_id
+		WHERE sii.invoice_id = $1
+		ORDER BY i.name, sii.id
+	`, invoiceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []SupplierInvoiceLine
+	for rows.Next() {
+		var l SupplierInvoiceLine
+		if err := rows.Scan(&l.ID, &l.POItemID, &l.ItemID, &l.ItemName, &l.Quantity, &l.UnitPrice); err != nil {
+			return nil, err
+		}
+		out = append(out, l)
+	}
+	return out, rows.Err()
+}
+
+// ListInvoiceExceptionsForOrder returns the invoices of an order still
+// held on a mismatch, to be matched again when more goods arrive.
+func (q *Queries) ListInvoiceExceptionsForOrder(ctx context.Context, poID pgtype.UUID) ([]pgtype.UUID, error) {
+	rows, err := q.db.Query(ctx, `SELECT id FROM supplier_invoices WHERE po_id = $1 AND status = 'exception' ORDER BY created_at FOR UPDATE`, poID)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[pgtype.UUID])
+}
+
+func (q *Queries) SetSupplierInvoiceMatch(ctx context.Context, id pgtype.UUID, status string, exceptions []byte) error {
+	_, err := q.db.Exec(ctx, `UPDATE supplier_invoices SET status = $2, exceptions = $3, updated_at = NOW() WHERE id = $1`,
+		id, status, exceptions)
+	return err
+}
+
+// DecideSupplierInvoice approves an invoice for payment or rejects it.
+func (q *Queries) DecideSupplierInvoice(ctx context.Context, id pgtype.UUID, status string, by pgtype.UUID, reason pgtype.Text) error {
+	_, err := q.db.Exec(ctx, `
+		UPDATE supplier_invoices SET status = $2, decided_by = $3, decided_at = NOW(), decision_reason = $4, updated_at = NOW()
+		WHERE id = $1
+	`, id, status, by, reason)
+	return err
+}
+
+// Supplier performance
+
+type SupplierPerformanceRow struct {
+	SupplierID        pgtype.UUID   `json:"supplier_id"`
+	SupplierName      string        `json:"supplier_name"`
+	Orders            int64         `json:"orders"`
+	OrderedQuantity   int64         `json:"ordered_quantity"`
+	DeliveredQuantity int64         `json:"delivered_quantity"`
+	RejectedQuantity  int64         `json:"rejected_quantity"`
+	AvgLeadTimeDays   pgtype.Float8 `json:"avg_lead_time_days"`
+	DueOrders         int64         `json:"due_orders"`
+	OnTimeOrders      int64         `json:"on_time_orders"`
+	Invoices          int64         `json:"invoices"`
+	InvoiceExceptions int64         `json:"invoice_exceptions"`
+}
+
+type SupplierPerformanceParams struct {
+	TenantID pgtype.UUID
+	From     pgtype.Date
+	To       pgtype.Date
+	Timezone string
+}
+
+// SupplierPerformance sums up, per supplier, the orders placed in a period
+// and how they were delivered: lead time from approval to first delivery,
+// deliveries on or before the expected date, quantities rejected at the
+// gate and invoices that did not match.
+func (q *Queries) SupplierPerformance(ctx context.Context, arg SupplierPerformanceParams) ([]SupplierPerformanceRow, error) {
+	rows, err := q.db.Query(ctx, `
+		WITH po AS (
+			SELECT po.id, po.supplier_id, COALESCE(po.approved_at, po.created_at) AS placed_at, po.expected_date
+			FROM purchase_orders po
+			WHERE po.tenant_id = $1 AND po.supplier_id IS NOT NULL AND po.status NOT IN ('draft', 'submitted', 'cancelled')
+				AND ($2::date IS NULL OR (po.created_at AT TIME ZONE $4)::date >= $2)
+				AND ($3::date IS NULL OR (po.created_at AT TIME ZONE $4)::date <= $3)
+		), ordered AS (
+			SELECT poi.po_id, SUM(poi.quantity) AS qty FROM purchase_order_items poi JOIN po ON po.id = poi.po_id GROUP BY poi.po_id
+		), delivered AS (
+			SELECT r.po_id, MIN(r.received_at) AS first_at, SUM(ri.delivered_quantity) AS delivered, SUM(ri.rejected_quantity) AS rejected
+			FROM purchase_receipts r JOIN purchase_receipt_items ri ON ri.receipt_id = r.id JOIN po ON po.id = r.po_id
+			GROUP BY r.po_id
+		), inv AS (
+			SELECT si.po_id, COUNT(*) AS n, COUNT(*) FILTER (WHERE jsonb_array_length(si.exceptions) > 0) AS exc
+			FROM supplier_invoices si JOIN po ON po.id = si.po_id
+			GROUP BY si.po_id
+		)
+		SELECT s.id, s.name, COUNT(po.id),
+			COALESCE(SUM(o.qty), 0)::BIGINT, COALESCE(SUM(d.delivered), 0)::BIGINT, COALESCE(SUM(d.rejected), 0)::BIGINT,
+			AVG(EXTRACT(EPOCH FROM d.first_at - po.placed_at) / 86400)::FLOAT8,
+			COUNT(*) FILTER (WHERE po.expected_date IS NOT NULL AND d.first_at IS NOT NULL),
+			COUNT(*) FILTER (WHERE po.expected_date IS NOT NULL AND (d.first_at AT TIME ZONE $4)::date <= po.expected_date),
+			COALESCE(SUM(inv.n), 0)::BIGINT, COALESCE(SUM(inv.exc), 0)::BIGINT
+		FROM po
+		JOIN inventory_suppliers s ON s.id = po.supplier_id
+		LEFT JOIN ordered o ON o.po_id = po.id
+		LEFT JOIN delivered d ON d.po_id = po.id
+		LEFT JOIN inv ON inv.po_id = po.id
+		GROUP BY s.id, s.name
+		ORDER BY s.name
+	`, arg.TenantID, arg.From, arg.To, arg.Timezone)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []SupplierPerformanceRow
+	for rows.Next() {
+		var r SupplierPerformanceRow
+		if err := rows.Scan(&r.SupplierID, &r.SupplierName, &r.Orders, &r.OrderedQuantity, &r.DeliveredQuantity,
+			&r.RejectedQuantity, &r.AvgLeadTimeDays, &r.DueOrders, &r.OnTimeOrders, &r.Invoices, &r.InvoiceExceptions); err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
@@ -3724,3 +3724,1830 @@ CREATE TABLE IF NOT EXISTS certificates (
     updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
     UNIQUE(tenant_id, certificate_number)
 );
+
+-- 000078_admission_online_forms.up.sql
+-- Online application fee orders for schema-driven public admission forms.
+-- Form schemas themselves live in tenants.config (admissions.forms).
+
+CREATE TABLE IF NOT EXISTS admission_fee_orders (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    application_id UUID NOT NULL REFERENCES admission_applications(id) ON DELETE CASCADE,
+    amount BIGINT NOT NULL CHECK (amount > 0),
+    currency TEXT NOT NULL DEFAULT 'INR',
+    provider TEXT, -- "razorpay", "payu"
+    external_ref TEXT, -- Gateway order id
+    gateway_payment_id TEXT,
+    status TEXT NOT NULL DEFAULT 'created' CHECK (status IN ('created', 'pending', 'paid', 'failed')),
+    paid_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_admission_fee_orders_application ON admission_fee_orders(tenant_id, application_id);
+CREATE INDEX IF NOT EXISTS idx_admission_fee_orders_external_ref ON admission_fee_orders(tenant_id, external_ref);
+
+-- 000079_kb_document_ingestion.up.sql
+
+-- Source file tracking for documents ingested from PDF/DOCX/HTML uploads.
+ALTER TABLE kb_documents
+    ADD COLUMN IF NOT EXISTS source_type TEXT NOT NULL DEFAULT 'text'
+        CHECK (source_type IN ('text', 'pdf', 'docx', 'html')),
+    ADD COLUMN IF NOT EXISTS source_file_id UUID REFERENCES files(id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS source_file_name TEXT,
+    ADD COLUMN IF NOT EXISTS source_sha256 TEXT,
+    ADD COLUMN IF NOT EXISTS ingested_at TIMESTAMPTZ;
+
+-- Each chunk remembers where it came from in the source document.
+ALTER TABLE kb_chunks
+    ADD COLUMN IF NOT EXISTS block_type TEXT NOT NULL DEFAULT 'text'
+        CHECK (block_type IN ('text', 'paragraph', 'list', 'table')),
+    ADD COLUMN IF NOT EXISTS section_path TEXT,
+    ADD COLUMN IF NOT EXISTS page_number INT,
+    ADD COLUMN IF NOT EXISTS source_anchor TEXT;
+
+-- 000080_kb_chunk_embeddings.up.sql
+
+-- One embedding per chunk for the configured model. Vectors are stored
+-- L2-normalised so cosine similarity is a plain dot product.
+CREATE TABLE IF NOT EXISTS kb_chunk_embeddings (
+    chunk_id UUID PRIMARY KEY REFERENCES kb_chunks(id) ON DELETE CASCADE,
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    document_id UUID NOT NULL REFERENCES kb_documents(id) ON DELETE CASCADE,
+    model TEXT NOT NULL,
+    dimensions INT NOT NULL CHECK (dimensions > 0),
+    embedding REAL[] NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS kb_chunk_embeddings_tenant_model
+    ON kb_chunk_embeddings (tenant_id, model);
+
+-- 000081_ai_helpdesk_answers.up.sql
+
+-- One row per parent helpdesk answer: which knowledgebase chunks were
+-- retrieved and cited, and whether the question was handed off to staff.
+-- Chunk ids are kept without a foreign key because chunks are rewritten
+-- whenever a document is edited; the log must outlive them.
+CREATE TABLE IF NOT EXISTS ai_helpdesk_answers (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    channel TEXT NOT NULL CHECK (channel IN ('app', 'whatsapp')),
+    user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    external_id TEXT,
+    query TEXT NOT NULL,
+    answer TEXT NOT NULL,
+    confidence DOUBLE PRECISION NOT NULL DEFAULT 0,
+    retrieval TEXT,
+    retrieved_chunk_ids UUID[] NOT NULL DEFAULT '{}',
+    cited_chunk_ids UUID[] NOT NULL DEFAULT '{}',
+    cited_document_ids UUID[] NOT NULL DEFAULT '{}',
+    handoff_reason TEXT,
+    handoff_status TEXT CHECK (handoff_status IN ('open', 'resolved')),
+    resolved_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    resolved_at TIMESTAMPTZ,
+    resolution_note TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS ai_helpdesk_answers_tenant_created
+    ON ai_helpdesk_answers (tenant_id, created_at DESC);
+
+CREATE INDEX IF NOT EXISTS ai_helpdesk_answers_open_handoffs
+    ON ai_helpdesk_answers (tenant_id, created_at)
+    WHERE handoff_status = 'open';
+
+-- 000082_ai_helpdesk_tools.up.sql
+
+-- Read-only tools the helpdesk model called while answering (fee summary,
+-- attendance, homework, exams). Each invocation is also in audit_logs.
+ALTER TABLE ai_helpdesk_answers ADD COLUMN IF NOT EXISTS tools_used TEXT[] NOT NULL DEFAULT '{}';
+
+-- 000083_auth_phone_otp.up.sql
+
+-- A guardian phone counts as verified only while phone_key still matches the
+-- guardian's current number.
+CREATE TABLE IF NOT EXISTS guardian_phone_verifications (
+    guardian_id UUID PRIMARY KEY REFERENCES guardians(id) ON DELETE CASCADE,
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    phone_key TEXT NOT NULL,
+    verified_via TEXT NOT NULL CHECK (verified_via IN ('otp', 'staff')),
+    verified_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    verified_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_guardian_phone_verifications_phone
+    ON guardian_phone_verifications(tenant_id, phone_key);
+
+CREATE TABLE IF NOT EXISTS auth_otp_challenges (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    guardian_id UUID NOT NULL REFERENCES guardians(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    purpose TEXT NOT NULL CHECK (purpose IN ('login', 'verify_phone')),
+    channel TEXT NOT NULL CHECK (channel IN ('sms', 'whatsapp')),
+    phone_key TEXT NOT NULL,
+    code_hash TEXT NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    max_attempts INT NOT NULL DEFAULT 5,
+    expires_at TIMESTAMPTZ NOT NULL,
+    consumed_at TIMESTAMPTZ,
+    ip_address TEXT,
+    user_agent TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_auth_otp_challenges_phone
+    ON auth_otp_challenges(tenant_id, phone_key, purpose, created_at DESC);
+
+CREATE TABLE IF NOT EXISTS auth_trusted_devices (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token_hash TEXT NOT NULL UNIQUE,
+    label TEXT,
+    ip_address TEXT,
+    user_agent TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_used_at TIMESTAMPTZ,
+    expires_at TIMESTAMPTZ NOT NULL,
+    revoked_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_auth_trusted_devices_user
+    ON auth_trusted_devices(user_id, created_at DESC);
+
+-- 000084_auth_sso.up.sql
+
+-- Per-tenant identity providers for staff single sign-on. Only the fields of the
+-- provider's protocol are populated; the OIDC client secret is stored encrypted.
+CREATE TABLE IF NOT EXISTS tenant_sso_providers (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    protocol TEXT NOT NULL CHECK (protocol IN ('oidc', 'saml')),
+    is_enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    oidc_issuer TEXT,
+    oidc_client_id TEXT,
+    oidc_client_secret_enc TEXT,
+    oidc_scopes TEXT[] NOT NULL DEFAULT ARRAY['openid', 'email', 'profile'],
+    saml_idp_entity_id TEXT,
+    saml_idp_sso_url TEXT,
+    saml_idp_certificate TEXT,
+    allowed_domains TEXT[] NOT NULL DEFAULT '{}',
+    groups_claim TEXT NOT NULL DEFAULT 'groups',
+    -- [{"group": "...", "role": "<role code>"}]
+    role_mappings JSONB NOT NULL DEFAULT '[]'::jsonb,
+    assume_email_verified BOOLEAN NOT NULL DEFAULT FALSE,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (tenant_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS tenant_sso_settings (
+    tenant_id UUID PRIMARY KEY REFERENCES tenants(id) ON DELETE CASCADE,
+    -- When set, staff must sign in through an enabled provider; parents and
+    -- students keep their existing login methods.
+    sso_only BOOLEAN NOT NULL DEFAULT FALSE,
+    updated_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- One row per SSO attempt. state_hash binds the IdP callback to the request and the
+-- ticket is a short-lived, single-use handle the frontend swaps for a session.
+CREATE TABLE IF NOT EXISTS sso_login_requests (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    provider_id UUID NOT NULL REFERENCES tenant_sso_providers(id) ON DELETE CASCADE,
+    state_hash TEXT NOT NULL UNIQUE,
+    nonce TEXT,
+    code_verifier TEXT,
+    saml_request_id TEXT,
+    redirect_path TEXT,
+    expires_at TIMESTAMPTZ NOT NULL,
+    completed_at TIMESTAMPTZ,
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    identity_id UUID REFERENCES user_identities(id) ON DELETE CASCADE,
+    ticket_hash TEXT UNIQUE,
+    ticket_expires_at TIMESTAMPTZ,
+    redeemed_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_sso_login_requests_saml
+    ON sso_login_requests(provider_id, saml_request_id)
+    WHERE saml_request_id IS NOT NULL;
+
+-- 000085_auth_webauthn.up.sql
+
+-- WebAuthn credentials (security keys and passkeys). A user may register
+-- several; public_key is the COSE_Key returned at registration.
+CREATE TABLE IF NOT EXISTS webauthn_credentials (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    credential_id BYTEA NOT NULL UNIQUE,
+    public_key BYTEA NOT NULL,
+    algorithm INTEGER NOT NULL,
+    sign_count BIGINT NOT NULL DEFAULT 0,
+    aaguid BYTEA,
+    transports TEXT[] NOT NULL DEFAULT '{}',
+    attestation_format TEXT NOT NULL DEFAULT 'none',
+    user_verified BOOLEAN NOT NULL DEFAULT FALSE,
+    backup_eligible BOOLEAN NOT NULL DEFAULT FALSE,
+    backup_state BOOLEAN NOT NULL DEFAULT FALSE,
+    name TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_used_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_webauthn_credentials_user ON webauthn_credentials(user_id);
+
+-- Single-use challenges for registration and assertion ceremonies. user_id is
+-- NULL for passwordless logins, where the user is only known from the response.
+CREATE TABLE IF NOT EXISTS webauthn_challenges (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    purpose TEXT NOT NULL CHECK (purpose IN ('register', 'mfa', 'passwordless')),
+    challenge BYTEA NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    consumed_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_webauthn_challenges_expiry ON webauthn_challenges(expires_at);
+
+-- A password login waiting for its second factor. The client holds the token;
+-- only its hash is stored. Too many wrong codes burn the session.
+CREATE TABLE IF NOT EXISTS mfa_login_sessions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token_hash TEXT NOT NULL UNIQUE,
+    methods TEXT[] NOT NULL DEFAULT '{}',
+    enrollment_required BOOLEAN NOT NULL DEFAULT FALSE,
+    failed_attempts INTEGER NOT NULL DEFAULT 0,
+    expires_at TIMESTAMPTZ NOT NULL,
+    completed_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- One-time recovery codes, stored hashed. Regenerating replaces the whole set.
+CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash TEXT NOT NULL,
+    used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (user_id, code_hash)
+);
+
+-- 000086_tenant_data_keys.up.sql
+
+-- Per-tenant data encryption keys. Each key is wrapped (AES-GCM) by a master
+-- key from DATA_ENCRYPTION_KEYS, identified by master_key_id (a prefix of the
+-- SHA-256 fingerprint shown when the master key was generated). Ciphertext
+-- carries the id of the data key that produced it. Destroying a tenant's keys
+-- clears wrapped_key, which makes every value encrypted under them unreadable.
+CREATE TABLE IF NOT EXISTS tenant_data_keys (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    version INTEGER NOT NULL,
+    status TEXT NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'retired', 'destroyed')),
+    master_key_id TEXT,
+    wrapped_key BYTEA,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    retired_at TIMESTAMPTZ,
+    destroyed_at TIMESTAMPTZ,
+    UNIQUE (tenant_id, version),
+    CHECK (status = 'destroyed' OR (wrapped_key IS NOT NULL AND master_key_id IS NOT NULL))
+);
+
+-- The newest active version encrypts. Rotation inserts the new version before
+-- retiring the old one, so two active rows can briefly coexist.
+CREATE INDEX IF NOT EXISTS idx_tenant_data_keys_tenant
+    ON tenant_data_keys(tenant_id, status, version DESC);
+
+-- Re-encryption runs queued by data_encryption secret rotations. A job waits
+-- until the API is deployed with target_master_key_id as its primary key.
+CREATE TABLE IF NOT EXISTS data_reencryption_jobs (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    rotation_request_id UUID REFERENCES platform_action_approvals(id) ON DELETE SET NULL,
+    target_master_key_id TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'waiting' CHECK (status IN ('waiting', 'running', 'completed', 'failed')),
+    keys_rotated INTEGER NOT NULL DEFAULT 0,
+    keys_rewrapped INTEGER NOT NULL DEFAULT 0,
+    values_reencrypted BIGINT NOT NULL DEFAULT 0,
+    failures INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    started_at TIMESTAMPTZ,
+    completed_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_data_reencryption_jobs_status
+    ON data_reencryption_jobs(status, created_at);
+
+-- Allergies, vaccinations and medical conditions move into one encrypted
+-- document; the plaintext columns are cleared as rows are rewritten.
+ALTER TABLE student_health_records ADD COLUMN IF NOT EXISTS encrypted_details TEXT;
+
+-- 000087_tenant_webhooks.up.sql
+
+-- Tenant-managed webhook endpoints subscribed to domain events from the outbox.
+-- The signing secret is stored encrypted with the tenant data key.
+CREATE TABLE IF NOT EXISTS tenant_webhook_subscriptions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    target_url TEXT NOT NULL,
+    secret_enc TEXT NOT NULL,
+    events TEXT[] NOT NULL DEFAULT '{}',
+    status TEXT NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'disabled')),
+    -- Failed attempts since the last success; the endpoint is disabled when it
+    -- reaches the dispatcher's threshold.
+    consecutive_failures INT NOT NULL DEFAULT 0,
+    disabled_reason TEXT,
+    disabled_at TIMESTAMPTZ,
+    last_success_at TIMESTAMPTZ,
+    last_failure_at TIMESTAMPTZ,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (tenant_id, name)
+);
+
+CREATE INDEX IF NOT EXISTS idx_tenant_webhook_subscriptions_active
+    ON tenant_webhook_subscriptions(tenant_id)
+    WHERE status = 'active';
+
+-- One row per event per endpoint. next_attempt_at doubles as the lease of an
+-- in-flight attempt so a crashed worker's delivery is picked up again.
+CREATE TABLE IF NOT EXISTS tenant_webhook_deliveries (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    subscription_id UUID NOT NULL REFERENCES tenant_webhook_subscriptions(id) ON DELETE CASCADE,
+    event_id UUID NOT NULL,
+    event_type TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'succeeded', 'dead')),
+    attempts INT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_response_status INT,
+    last_error TEXT,
+    delivered_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (subscription_id, event_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_tenant_webhook_deliveries_due
+    ON tenant_webhook_deliveries(next_attempt_at)
+    WHERE status = 'pending';
+
+CREATE INDEX IF NOT EXISTS idx_tenant_webhook_deliveries_subscription
+    ON tenant_webhook_deliveries(subscription_id, created_at DESC);
+
+-- Every HTTP attempt, kept for the per-endpoint delivery log.
+CREATE TABLE IF NOT EXISTS tenant_webhook_delivery_attempts (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    delivery_id UUID NOT NULL REFERENCES tenant_webhook_deliveries(id) ON DELETE CASCADE,
+    attempt INT NOT NULL,
+    response_status INT,
+    response_body TEXT,
+    error TEXT,
+    duration_ms INT NOT NULL DEFAULT 0,
+    manual BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_tenant_webhook_delivery_attempts_delivery
+    ON tenant_webhook_delivery_attempts(delivery_id, created_at);
+
+-- 000088_api_clients.up.sql
+
+-- Tenant-issued credentials for third-party integrations. Each client acts as
+-- its own service-account user so audit logs name the integration that made a
+-- change. Secrets and access tokens are stored as SHA-256 hashes only.
+CREATE TABLE IF NOT EXISTS api_clients (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    description TEXT,
+    client_id TEXT NOT NULL UNIQUE,
+    secret_hash TEXT NOT NULL,
+    secret_hint TEXT NOT NULL,
+    service_user_id UUID NOT NULL REFERENCES users(id),
+    scopes TEXT[] NOT NULL DEFAULT '{}',
+    rate_limit_per_minute INT NOT NULL DEFAULT 120 CHECK (rate_limit_per_minute > 0),
+    expires_at TIMESTAMPTZ,
+    last_used_at TIMESTAMPTZ,
+    last_used_ip TEXT,
+    revoked_at TIMESTAMPTZ,
+    revoked_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    revoke_reason TEXT,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (tenant_id, name)
+);
+
+-- Short-lived bearer tokens issued through the OAuth2 client-credentials grant.
+CREATE TABLE IF NOT EXISTS api_client_tokens (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    api_client_id UUID NOT NULL REFERENCES api_clients(id) ON DELETE CASCADE,
+    token_hash TEXT NOT NULL UNIQUE,
+    scopes TEXT[] NOT NULL DEFAULT '{}',
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_client_tokens_client
+    ON api_client_tokens(api_client_id, expires_at);
+
+-- 000089_transport_tracking.up.sql
+
+-- Per-tenant thresholds for live tracking. A tenant without a row uses the
+-- defaults below.
+CREATE TABLE IF NOT EXISTS transport_tracking_settings (
+    tenant_id UUID PRIMARY KEY REFERENCES tenants(id) ON DELETE CASCADE,
+    speed_limit_kmph INT NOT NULL DEFAULT 50 CHECK (speed_limit_kmph > 0),
+    deviation_threshold_m INT NOT NULL DEFAULT 300 CHECK (deviation_threshold_m > 0),
+    stop_radius_m INT NOT NULL DEFAULT 150 CHECK (stop_radius_m > 0),
+    arrival_notice_minutes INT NOT NULL DEFAULT 5 CHECK (arrival_notice_minutes > 0),
+    default_speed_kmph INT NOT NULL DEFAULT 25 CHECK (default_speed_kmph > 0),
+    alert_cooldown_minutes INT NOT NULL DEFAULT 10 CHECK (alert_cooldown_minutes >= 0),
+    updated_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- A run of a route in one direction. Pickup trips visit stops in sequence
+-- order, drop trips in reverse. The last accepted ping is kept on the trip.
+CREATE TABLE IF NOT EXISTS transport_trips (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    route_id UUID NOT NULL REFERENCES transport_routes(id) ON DELETE CASCADE,
+    vehicle_id UUID NOT NULL REFERENCES transport_vehicles(id),
+    driver_id UUID REFERENCES transport_drivers(id),
+    direction TEXT NOT NULL CHECK (direction IN ('pickup', 'drop')),
+    status TEXT NOT NULL DEFAULT 'in_progress' CHECK (status IN ('in_progress', 'completed', 'cancelled')),
+    started_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    ended_at TIMESTAMPTZ,
+    last_latitude DOUBLE PRECISION,
+    last_longitude DOUBLE PRECISION,
+    last_speed_kmph DOUBLE PRECISION,
+    last_heading DOUBLE PRECISION,
+    last_ping_at TIMESTAMPTZ,
+    started_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS uq_transport_trips_route_active
+    ON transport_trips (route_id) WHERE status = 'in_progress';
+CREATE UNIQUE INDEX IF NOT EXISTS uq_transport_trips_vehicle_active
+    ON transport_trips (vehicle_id) WHERE status = 'in_progress';
+CREATE INDEX IF NOT EXISTS idx_transport_trips_tenant_started
+    ON transport_trips (tenant_id, started_at DESC);
+
+-- Progress of a trip through its stops. Rows are created when the trip starts.
+CREATE TABLE IF NOT EXISTS transport_trip_stops (
+    trip_id UUID NOT NULL REFERENCES transport_trips(id) ON DELETE CASCADE,
+    stop_id UUID NOT NULL REFERENCES transport_route_stops(id) ON DELETE CASCADE,
+    visit_order INT NOT NULL,
+    arrived_at TIMESTAMPTZ,
+    departed_at TIMESTAMPTZ,
+    arrival_notified_at TIMESTAMPTZ,
+    PRIMARY KEY (trip_id, stop_id)
+);
+
+-- Raw positions from driver phones and AIS-140 devices. Pings outside a trip
+-- are kept for the vehicle's history.
+CREATE TABLE IF NOT EXISTS transport_gps_pings (
+    id BIGSERIAL PRIMARY KEY,
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    vehicle_id UUID NOT NULL REFERENCES transport_vehicles(id) ON DELETE CASCADE,
+    trip_id UUID REFERENCES transport_trips(id) ON DELETE SET NULL,
+    recorded_at TIMESTAMPTZ NOT NULL,
+    received_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    latitude DOUBLE PRECISION NOT NULL CHECK (latitude BETWEEN -90 AND 90),
+    longitude DOUBLE PRECISION NOT NULL CHECK (longitude BETWEEN -180 AND 180),
+    speed_kmph DOUBLE PRECISION,
+    heading DOUBLE PRECISION,
+    accuracy_m DOUBLE PRECISION,
+    source TEXT NOT NULL DEFAULT 'phone' CHECK (source IN ('phone', 'ais140'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_transport_gps_pings_trip
+    ON transport_gps_pings (trip_id, recorded_at) WHERE trip_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_transport_gps_pings_vehicle
+    ON transport_gps_pings (vehicle_id, recorded_at DESC);
+
+CREATE TABLE IF NOT EXISTS transport_trip_boardings (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    trip_id UUID NOT NULL REFERENCES transport_trips(id) ON DELETE CASCADE,
+    student_id UUID NOT NULL REFERENCES students(id) ON DELETE CASCADE,
+    stop_id UUID REFERENCES transport_route_stops(id) ON DELETE SET NULL,
+    boarded_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    latitude DOUBLE PRECISION,
+    longitude DOUBLE PRECISION,
+    recorded_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    UNIQUE (trip_id, student_id)
+);
+
+-- Overspeed and route-deviation alerts for the transport manager.
+CREATE TABLE IF NOT EXISTS transport_trip_alerts (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    trip_id UUID NOT NULL REFERENCES transport_trips(id) ON DELETE CASCADE,
+    alert_type TEXT NOT NULL CHECK (alert_type IN ('overspeed', 'route_deviation')),
+    observed_value DOUBLE PRECISION NOT NULL,
+    threshold_value DOUBLE PRECISION NOT NULL,
+    latitude DOUBLE PRECISION NOT NULL,
+    longitude DOUBLE PRECISION NOT NULL,
+    observed_at TIMESTAMPTZ NOT NULL,
+    acknowledged_at TIMESTAMPTZ,
+    acknowledged_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_transport_trip_alerts_trip
+    ON transport_trip_alerts (trip_id, alert_type, observed_at DESC);
+CREATE INDEX IF NOT EXISTS idx_transport_trip_alerts_open
+    ON transport_trip_alerts (tenant_id, created_at DESC) WHERE acknowledged_at IS NULL;
+
+INSERT INTO permissions (code, module, description) VALUES
+    ('transport:alerts', 'transport', 'Receive overspeed and route-deviation alerts')
+ON CONFLICT (code) DO NOTHING;
+
+-- 000090_transport_trip_attendance.up.sql
+
+-- Trips are scheduled per route, day and direction ahead of time and started
+-- when the bus leaves. A scheduled trip has no start time yet.
+ALTER TABLE transport_trips ADD COLUMN IF NOT EXISTS trip_date DATE;
+UPDATE transport_trips SET trip_date = started_at::date WHERE trip_date IS NULL;
+ALTER TABLE transport_trips ALTER COLUMN trip_date SET DEFAULT CURRENT_DATE;
+ALTER TABLE transport_trips ALTER COLUMN trip_date SET NOT NULL;
+ALTER TABLE transport_trips ALTER COLUMN started_at DROP NOT NULL;
+ALTER TABLE transport_trips ALTER COLUMN started_at DROP DEFAULT;
+ALTER TABLE transport_trips DROP CONSTRAINT IF EXISTS transport_trips_status_check;
+ALTER TABLE transport_trips ADD CONSTRAINT transport_trips_status_check
+    CHECK (status IN ('scheduled', 'in_progress', 'completed', 'cancelled'));
+
+ALTER TABLE transport_trips ADD COLUMN IF NOT EXISTS attendant_id UUID REFERENCES employees(id) ON DELETE SET NULL;
+ALTER TABLE transport_trips ADD COLUMN IF NOT EXISTS driver_checked_in_at TIMESTAMPTZ;
+ALTER TABLE transport_trips ADD COLUMN IF NOT EXISTS attendant_checked_in_at TIMESTAMPTZ;
+
+CREATE UNIQUE INDEX IF NOT EXISTS uq_transport_trips_route_scheduled
+    ON transport_trips (route_id, trip_date, direction) WHERE status = 'scheduled';
+CREATE INDEX IF NOT EXISTS idx_transport_trips_tenant_date
+    ON transport_trips (tenant_id, trip_date, route_id);
+
+-- RFID readers fitted on buses post to the biometric ingest endpoint with
+-- their device id; the id ties the reader to its vehicle.
+ALTER TABLE transport_vehicles ADD COLUMN IF NOT EXISTS rfid_reader_id TEXT;
+CREATE UNIQUE INDEX IF NOT EXISTS uq_transport_vehicles_reader
+    ON transport_vehicles (tenant_id, rfid_reader_id) WHERE rfid_reader_id IS NOT NULL;
+
+-- A boarding row tracks a student through one trip. A student marked only on
+-- the way off has no boarded_at.
+ALTER TABLE transport_trip_boardings ALTER COLUMN boarded_at DROP NOT NULL;
+ALTER TABLE transport_trip_boardings ADD COLUMN IF NOT EXISTS board_method TEXT
+    CHECK (board_method IN ('manual', 'rfid', 'qr'));
+UPDATE transport_trip_boardings SET board_method = 'manual' WHERE board_method IS NULL AND boarded_at IS NOT NULL;
+ALTER TABLE transport_trip_boardings ADD COLUMN IF NOT EXISTS alighted_at TIMESTAMPTZ;
+ALTER TABLE transport_trip_boardings ADD COLUMN IF NOT EXISTS alight_stop_id UUID REFERENCES transport_route_stops(id) ON DELETE SET NULL;
+ALTER TABLE transport_trip_boardings ADD COLUMN IF NOT EXISTS alight_latitude DOUBLE PRECISION;
+ALTER TABLE transport_trip_boardings ADD COLUMN IF NOT EXISTS alight_longitude DOUBLE PRECISION;
+ALTER TABLE transport_trip_boardings ADD COLUMN IF NOT EXISTS alight_method TEXT
+    CHECK (alight_method IN ('manual', 'rfid', 'qr'));
+ALTER TABLE transport_trip_boardings ADD COLUMN IF NOT EXISTS alight_recorded_by UUID REFERENCES users(id) ON DELETE SET NULL;
+
+-- Missed-drop alerts name a student instead of a measurement.
+ALTER TABLE transport_trip_alerts DROP CONSTRAINT IF EXISTS transport_trip_alerts_alert_type_check;
+ALTER TABLE transport_trip_alerts ADD CONSTRAINT transport_trip_alerts_alert_type_check
+    CHECK (alert_type IN ('overspeed', 'route_deviation', 'missed_drop'));
+ALTER TABLE transport_trip_alerts ADD COLUMN IF NOT EXISTS student_id UUID REFERENCES students(id) ON DELETE CASCADE;
+ALTER TABLE transport_trip_alerts ALTER COLUMN observed_value DROP NOT NULL;
+ALTER TABLE transport_trip_alerts ALTER COLUMN threshold_value DROP NOT NULL;
+ALTER TABLE transport_trip_alerts ALTER COLUMN latitude DROP NOT NULL;
+ALTER TABLE transport_trip_alerts ALTER COLUMN longitude DROP NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS uq_transport_trip_alerts_missed_drop
+    ON transport_trip_alerts (trip_id, student_id) WHERE alert_type = 'missed_drop';
+
+-- 000091_transport_fleet.up.sql
+
+-- Fitness, insurance, PUC and permit certificates of vehicles and driving
+-- licences of drivers. A renewal is a new row; the row with the latest
+-- expiry of a kind is the current one. last_reminder_stage records which
+-- expiry reminder was last sent for the row.
+CREATE TABLE IF NOT EXISTS transport_compliance_documents (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    vehicle_id UUID REFERENCES transport_vehicles(id) ON DELETE CASCADE,
+    driver_id UUID REFERENCES transport_drivers(id) ON DELETE CASCADE,
+    doc_type TEXT NOT NULL CHECK (doc_type IN ('fitness', 'insurance', 'puc', 'permit', 'licence')),
+    document_number TEXT,
+    issuer TEXT,
+    issued_on DATE,
+    expires_on DATE NOT NULL,
+    reminder_days INT NOT NULL DEFAULT 30 CHECK (reminder_days >= 0),
+    last_reminder_stage INT NOT NULL DEFAULT 0,
+    notes TEXT,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK (
+        (vehicle_id IS NOT NULL AND driver_id IS NULL AND doc_type <> 'licence')
+        OR (driver_id IS NOT NULL AND vehicle_id IS NULL AND doc_type = 'licence')
+    )
+);
+
+CREATE INDEX IF NOT EXISTS idx_transport_compliance_documents_vehicle
+    ON transport_compliance_documents (vehicle_id, doc_type, expires_on DESC) WHERE vehicle_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_transport_compliance_documents_driver
+    ON transport_compliance_documents (driver_id, expires_on DESC) WHERE driver_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_transport_compliance_documents_expiry
+    ON transport_compliance_documents (tenant_id, expires_on);
+
+-- Recurring services of a vehicle, due every interval_km kilometres or
+-- interval_days days from the last service, whichever comes first.
+CREATE TABLE IF NOT EXISTS transport_service_schedules (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    vehicle_id UUID NOT NULL REFERENCES transport_vehicles(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    interval_km INT CHECK (interval_km > 0),
+    interval_days INT CHECK (interval_days > 0),
+    last_service_km INT CHECK (last_service_km >= 0),
+    last_service_date DATE,
+    due_soon_km INT NOT NULL DEFAULT 500 CHECK (due_soon_km >= 0),
+    due_soon_days INT NOT NULL DEFAULT 7 CHECK (due_soon_days >= 0),
+    last_reminder_stage INT NOT NULL DEFAULT 0,
+    is_active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK (interval_km IS NOT NULL OR interval_days IS NOT NULL),
+    UNIQUE (vehicle_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS transport_work_orders (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    vehicle_id UUID NOT NULL REFERENCES transport_vehicles(id) ON DELETE CASCADE,
+    schedule_id UUID REFERENCES transport_service_schedules(id) ON DELETE SET NULL,
+    title TEXT NOT NULL,
+    description TEXT,
+    vendor TEXT,
+    status TEXT NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'in_progress', 'completed', 'cancelled')),
+    odometer_km INT CHECK (odometer_km >= 0),
+    labour_cost NUMERIC(12, 2) NOT NULL DEFAULT 0 CHECK (labour_cost >= 0),
+    parts_cost NUMERIC(12, 2) NOT NULL DEFAULT 0 CHECK (parts_cost >= 0),
+    opened_on DATE NOT NULL DEFAULT CURRENT_DATE,
+    completed_on DATE,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    completed_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_transport_work_orders_vehicle
+    ON transport_work_orders (tenant_id, vehicle_id, opened_on DESC);
+
+-- 000092_transport_route_planning.up.sql
+
+-- Where the route planner starts from: the school's location, when buses
+-- must arrive and how long a child may ride.
+CREATE TABLE IF NOT EXISTS transport_planning_settings (
+    tenant_id UUID PRIMARY KEY REFERENCES tenants(id) ON DELETE CASCADE,
+    school_latitude DOUBLE PRECISION CHECK (school_latitude BETWEEN -90 AND 90),
+    school_longitude DOUBLE PRECISION CHECK (school_longitude BETWEEN -180 AND 180),
+    arrive_by TIME NOT NULL DEFAULT '08:00',
+    max_ride_minutes INT NOT NULL DEFAULT 60 CHECK (max_ride_minutes > 0),
+    walk_radius_m INT NOT NULL DEFAULT 300 CHECK (walk_radius_m >= 0),
+    speed_kmph INT NOT NULL DEFAULT 25 CHECK (speed_kmph > 0),
+    updated_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- A student's geocoded pickup point, usually their home.
+CREATE TABLE IF NOT EXISTS transport_pickup_points (
+    student_id UUID PRIMARY KEY REFERENCES students(id) ON DELETE CASCADE,
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    latitude DOUBLE PRECISION NOT NULL CHECK (latitude BETWEEN -90 AND 90),
+    longitude DOUBLE PRECISION NOT NULL CHECK (longitude BETWEEN -180 AND 180),
+    address TEXT,
+    updated_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_transport_pickup_points_tenant
+    ON transport_pickup_points (tenant_id);
+
+-- Proposals from the route planner. A full plan lays out new routes for the
+-- chosen vehicles; a rebalance fits new students into running routes.
+-- Nothing changes until a draft is applied.
+CREATE TABLE IF NOT EXISTS transport_route_plans (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    kind TEXT NOT NULL CHECK (kind IN ('full', 'rebalance')),
+    status TEXT NOT NULL DEFAULT 'draft' CHECK (status IN ('draft', 'applied', 'discarded')),
+    options JSONB NOT NULL,
+    result JSONB NOT NULL,
+    student_count INT NOT NULL DEFAULT 0,
+    route_count INT NOT NULL DEFAULT 0,
+    unplanned_count INT NOT NULL DEFAULT 0,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    effective_date DATE,
+    applied_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    applied_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_transport_route_plans_tenant
+    ON transport_route_plans (tenant_id, created_at DESC);
+
+-- 000093_transport_fees.up.sql
+
+-- Charges other modules raise on a student, such as a term's transport
+-- fare. Each is posted to the student's fee ledger as a fee plan of its own,
+-- so dues, reminders and receipts treat it like any other fee. The source
+-- key makes posting idempotent.
+CREATE TABLE IF NOT EXISTS student_fee_charges (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    student_id UUID NOT NULL REFERENCES students(id) ON DELETE CASCADE,
+    source TEXT NOT NULL,
+    source_key TEXT NOT NULL,
+    period TEXT,
+    fee_plan_id UUID NOT NULL REFERENCES fee_plans(id),
+    fee_head_id UUID NOT NULL REFERENCES fee_heads(id),
+    academic_year_id UUID REFERENCES academic_years(id),
+    description TEXT NOT NULL,
+    amount BIGINT NOT NULL CHECK (amount >= 0), -- in paise
+    due_date DATE,
+    status TEXT NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'cancelled')),
+    details JSONB NOT NULL DEFAULT '{}'::jsonb,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (tenant_id, source, source_key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_student_fee_charges_period
+    ON student_fee_charges (tenant_id, source, period);
+CREATE INDEX IF NOT EXISTS idx_student_fee_charges_student
+    ON student_fee_charges (student_id);
+
+-- How transport fares are worked out.
+CREATE TABLE IF NOT EXISTS transport_fee_settings (
+    tenant_id UUID PRIMARY KEY REFERENCES tenants(id) ON DELETE CASCADE,
+    fare_mode TEXT NOT NULL DEFAULT 'slab' CHECK (fare_mode IN ('slab', 'zone')),
+    proration TEXT NOT NULL DEFAULT 'monthly' CHECK (proration IN ('none', 'monthly', 'daily')),
+    fee_head_id UUID REFERENCES fee_heads(id) ON DELETE SET NULL,
+    updated_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Term fares by distance from the school; amounts in paise.
+CREATE TABLE IF NOT EXISTS transport_fare_slabs (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    from_km DOUBLE PRECISION NOT NULL CHECK (from_km >= 0),
+    to_km DOUBLE PRECISION CHECK (to_km > from_km),
+    one_way_amount BIGINT NOT NULL CHECK (one_way_amount >= 0),
+    two_way_amount BIGINT NOT NULL CHECK (two_way_amount >= 0),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_transport_fare_slabs_tenant
+    ON transport_fare_slabs (tenant_id, from_km);
+
+-- Term fares by zone; stops are put in a zone.
+CREATE TABLE IF NOT EXISTS transport_fare_zones (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    one_way_amount BIGINT NOT NULL CHECK (one_way_amount >= 0),
+    two_way_amount BIGINT NOT NULL CHECK (two_way_amount >= 0),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (tenant_id, name)
+);
+
+ALTER TABLE transport_route_stops
+    ADD COLUMN IF NOT EXISTS zone_id UUID REFERENCES transport_fare_zones(id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS distance_km DOUBLE PRECISION CHECK (distance_km >= 0);
+
+-- Whether the student rides both ways or only to or from school.
+ALTER TABLE transport_allocations
+    ADD COLUMN IF NOT EXISTS trip_type TEXT NOT NULL DEFAULT 'two_way'
+        CHECK (trip_type IN ('two_way', 'pickup', 'drop'));
+
+-- The billing terms transport fares are charged for.
+CREATE TABLE IF NOT EXISTS transport_fee_terms (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    academic_year_id UUID NOT NULL REFERENCES academic_years(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    start_date DATE NOT NULL,
+    end_date DATE NOT NULL,
+    due_date DATE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (tenant_id, academic_year_id, name),
+    CHECK (end_date >= start_date)
+);
+
+-- Each fee generation and what it did to each student.
+CREATE TABLE IF NOT EXISTS transport_fee_runs (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    term_id UUID NOT NULL REFERENCES transport_fee_terms(id) ON DELETE CASCADE,
+    created_count INT NOT NULL DEFAULT 0,
+    updated_count INT NOT NULL DEFAULT 0,
+    unchanged_count INT NOT NULL DEFAULT 0,
+    cancelled_count INT NOT NULL DEFAULT 0,
+    skipped_count INT NOT NULL DEFAULT 0,
+    report JSONB NOT NULL DEFAULT '[]'::jsonb,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_transport_fee_runs_term
+    ON transport_fee_runs (tenant_id, term_id, created_at DESC);
+
+-- 000094_library_copies.up.sql
+
+-- Per-school circulation settings. Accession numbers are the prefix
+-- followed by a running number.
+CREATE TABLE IF NOT EXISTS library_settings (
+    tenant_id UUID PRIMARY KEY REFERENCES tenants(id) ON DELETE CASCADE,
+    accession_prefix TEXT NOT NULL DEFAULT 'ACC',
+    next_accession BIGINT NOT NULL DEFAULT 1 CHECK (next_accession > 0),
+    hold_days INTEGER NOT NULL DEFAULT 3 CHECK (hold_days > 0),
+    updated_by UUID REFERENCES users(id),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Physical copies of a title. The counters on library_books are kept in
+-- step with these rows.
+CREATE TABLE IF NOT EXISTS library_book_copies (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    book_id UUID NOT NULL REFERENCES library_books(id) ON DELETE CASCADE,
+    accession_number TEXT NOT NULL,
+    barcode TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'available'
+        CHECK (status IN ('available', 'issued', 'on_hold', 'lost', 'damaged', 'withdrawn')),
+    shelf_location TEXT,
+    acquired_on DATE,
+    notes TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (tenant_id, accession_number),
+    UNIQUE (tenant_id, barcode)
+);
+
+CREATE INDEX IF NOT EXISTS idx_library_book_copies_book
+    ON library_book_copies (book_id, status);
+
+-- Loan length and limits by member type. A student policy may be narrowed
+-- to a class; the class policy wins over the general one.
+CREATE TABLE IF NOT EXISTS library_member_policies (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    member_type TEXT NOT NULL CHECK (member_type IN ('student', 'staff')),
+    class_id UUID REFERENCES classes(id) ON DELETE CASCADE,
+    loan_days INTEGER NOT NULL CHECK (loan_days > 0),
+    max_books INTEGER NOT NULL CHECK (max_books >= 0),
+    max_renewals INTEGER NOT NULL DEFAULT 0 CHECK (max_renewals >= 0),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK (member_type = 'student' OR class_id IS NULL)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_library_member_policies_scope
+    ON library_member_policies (tenant_id, member_type, COALESCE(class_id, '00000000-0000-0000-0000-000000000000'::uuid));
+
+ALTER TABLE library_issues
+    ADD COLUMN IF NOT EXISTS copy_id UUID REFERENCES library_book_copies(id),
+    ADD COLUMN IF NOT EXISTS employee_id UUID REFERENCES employees(id),
+    ADD COLUMN IF NOT EXISTS renewal_count INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS last_renewed_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_library_issues_copy ON library_issues (copy_id);
+CREATE INDEX IF NOT EXISTS idx_library_issues_employee ON library_issues (employee_id);
+
+-- Reservation queue per title. When a copy comes back it is held for the
+-- first waiting member until hold_until.
+CREATE TABLE IF NOT EXISTS library_reservations (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    book_id UUID NOT NULL REFERENCES library_books(id) ON DELETE CASCADE,
+    student_id UUID REFERENCES students(id) ON DELETE CASCADE,
+    employee_id UUID REFERENCES employees(id) ON DELETE CASCADE,
+    status TEXT NOT NULL DEFAULT 'waiting'
+        CHECK (status IN ('waiting', 'ready', 'fulfilled', 'cancelled', 'expired')),
+    copy_id UUID REFERENCES library_book_copies(id),
+    issue_id UUID REFERENCES library_issues(id),
+    ready_at TIMESTAMPTZ,
+    hold_until TIMESTAMPTZ,
+    created_by UUID REFERENCES users(id),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK ((student_id IS NULL) <> (employee_id IS NULL))
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_library_reservations_open
+    ON library_reservations (book_id, COALESCE(student_id, employee_id))
+    WHERE status IN ('waiting', 'ready');
+CREATE INDEX IF NOT EXISTS idx_library_reservations_queue
+    ON library_reservations (book_id, status, created_at);
+CREATE INDEX IF NOT EXISTS idx_library_reservations_hold
+    ON library_reservations (hold_until) WHERE status = 'ready';
+
+-- Give every existing title its copies, carrying the title barcode over to
+-- the first one, and attach open loans to them.
+INSERT INTO library_book_copies (tenant_id, book_id, accession_number, barcode, shelf_location)
+SELECT b.tenant_id, b.id,
+       'ACC' || lpad(row_number() OVER (PARTITION BY b.tenant_id ORDER BY b.created_at, b.id, g.n)::text, 6, '0'),
+       CASE WHEN g.n = 1 AND b.barcode IS NOT NULL THEN b.barcode
+            ELSE 'ACC' || lpad(row_number() OVER (PARTITION BY b.tenant_id ORDER BY b.created_at, b.id, g.n)::text, 6, '0') END,
+       b.shelf_location
+FROM library_books b
+CROSS JOIN LATERAL generate_series(1, GREATEST(b.total_copies, 1)) AS g(n)
+WHERE NOT EXISTS (SELECT 1 FROM library_book_copies c WHERE c.book_id = b.id);
+
+INSERT INTO library_settings (tenant_id, next_accession)
+SELECT tenant_id, COUNT(*) + 1 FROM library_book_copies GROUP BY tenant_id
+ON CONFLICT (tenant_id) DO NOTHING;
+
+WITH open_loans AS (
+    SELECT id, book_id, row_number() OVER (PARTITION BY book_id ORDER BY issue_date, id) AS rn
+    FROM library_issues
+    WHERE copy_id IS NULL AND status IN ('issued', 'overdue')
+), copies AS (
+    SELECT id, book_id, row_number() OVER (PARTITION BY book_id ORDER BY accession_number) AS rn
+    FROM library_book_copies
+)
+UPDATE library_issues i SET copy_id = c.id
+FROM open_loans l JOIN copies c ON c.book_id = l.book_id AND c.rn = l.rn
+WHERE i.id = l.id;
+
+UPDATE library_book_copies c SET status = 'issued'
+WHERE EXISTS (
+    SELECT 1 FROM library_issues i WHERE i.copy_id = c.id AND i.status IN ('issued', 'overdue')
+);
+
+UPDATE library_books b SET
+    total_copies = x.total,
+    available_copies = x.available
+FROM (
+    SELECT book_id,
+           COUNT(*) FILTER (WHERE status <> 'withdrawn') AS total,
+           COUNT(*) FILTER (WHERE status = 'available') AS available
+    FROM library_book_copies GROUP BY book_id
+) x
+WHERE x.book_id = b.id;
+
+-- 000095_library_fines.up.sql
+
+-- Fee head library fines are posted under on the student's fee ledger.
+ALTER TABLE library_settings
+    ADD COLUMN IF NOT EXISTS fine_fee_head_id UUID REFERENCES fee_heads(id) ON DELETE SET NULL;
+
+-- Fine rules by member type, optionally narrowed to a book category.
+-- Amounts are in paise; the lost and damage charges are a share of the
+-- book's price.
+CREATE TABLE IF NOT EXISTS library_fine_policies (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    member_type TEXT NOT NULL CHECK (member_type IN ('student', 'staff')),
+    category_id UUID REFERENCES library_categories(id) ON DELETE CASCADE,
+    per_day BIGINT NOT NULL CHECK (per_day >= 0),
+    grace_days INTEGER NOT NULL DEFAULT 0 CHECK (grace_days >= 0),
+    max_fine BIGINT CHECK (max_fine >= 0),
+    skip_holidays BOOLEAN NOT NULL DEFAULT TRUE,
+    skip_sundays BOOLEAN NOT NULL DEFAULT FALSE,
+    lost_percent INTEGER NOT NULL DEFAULT 100 CHECK (lost_percent >= 0),
+    lost_minimum BIGINT NOT NULL DEFAULT 0 CHECK (lost_minimum >= 0),
+    processing_fee BIGINT NOT NULL DEFAULT 0 CHECK (processing_fee >= 0),
+    damage_percent INTEGER NOT NULL DEFAULT 50 CHECK (damage_percent >= 0),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_library_fine_policies_scope
+    ON library_fine_policies (tenant_id, member_type, COALESCE(category_id, '00000000-0000-0000-0000-000000000000'::uuid));
+
+-- Charges raised on a loan. Student fines are collected by posting them to
+-- the fee ledger; staff fines are collected at the desk.
+CREATE TABLE IF NOT EXISTS library_fines (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    issue_id UUID NOT NULL REFERENCES library_issues(id) ON DELETE CASCADE,
+    student_id UUID REFERENCES students(id) ON DELETE CASCADE,
+    employee_id UUID REFERENCES employees(id) ON DELETE CASCADE,
+    kind TEXT NOT NULL CHECK (kind IN ('overdue', 'lost', 'damaged')),
+    amount BIGINT NOT NULL CHECK (amount > 0),
+    waived_amount BIGINT NOT NULL DEFAULT 0,
+    status TEXT NOT NULL DEFAULT 'open'
+        CHECK (status IN ('open', 'waiver_requested', 'posted', 'paid', 'waived')),
+    details JSONB NOT NULL DEFAULT '{}'::jsonb,
+    waiver_amount BIGINT,
+    waiver_reason TEXT,
+    waiver_request_id UUID REFERENCES approval_requests(id) ON DELETE SET NULL,
+    fee_charge_id UUID REFERENCES student_fee_charges(id) ON DELETE SET NULL,
+    posted_at TIMESTAMPTZ,
+    paid_at TIMESTAMPTZ,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK ((student_id IS NULL) <> (employee_id IS NULL)),
+    CHECK (waived_amount BETWEEN 0 AND amount),
+    UNIQUE (issue_id, kind)
+);
+
+CREATE INDEX IF NOT EXISTS idx_library_fines_status ON library_fines (tenant_id, status);
+CREATE INDEX IF NOT EXISTS idx_library_fines_student ON library_fines (student_id);
+CREATE INDEX IF NOT EXISTS idx_library_fines_employee ON library_fines (employee_id);
+
+-- Carry fines already recorded on returned loans over as open overdue fines.
+INSERT INTO library_fines (tenant_id, issue_id, student_id, employee_id, kind, amount)
+SELECT i.tenant_id, i.id, i.student_id, i.employee_id, 'overdue', ROUND(i.fine_amount * 100)::bigint
+FROM library_issues i
+WHERE i.fine_amount > 0
+  AND (i.student_id IS NULL) <> (i.employee_id IS NULL)
+ON CONFLICT (issue_id, kind) DO NOTHING;
+
+-- 000096_library_catalogue.up.sql
+
+-- Bibliographic records seen by the school, from imports and from
+-- external ISBN lookups, so a title is looked up online at most once.
+CREATE TABLE IF NOT EXISTS library_isbn_cache (
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    isbn TEXT NOT NULL CHECK (isbn ~ '^97[89][0-9]{10}$'),
+    title TEXT NOT NULL,
+    authors TEXT[] NOT NULL DEFAULT '{}',
+    publisher TEXT,
+    published_year INTEGER,
+    language TEXT,
+    subjects TEXT[] NOT NULL DEFAULT '{}',
+    source TEXT NOT NULL,
+    fetched_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (tenant_id, isbn)
+);
+
+-- ISBNs are stored as typed; duplicates are found on the digits alone.
+CREATE INDEX IF NOT EXISTS idx_library_books_isbn_digits
+    ON library_books (tenant_id, (regexp_replace(upper(isbn), '[^0-9X]', '', 'g')))
+    WHERE isbn IS NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_library_authors_name
+    ON library_authors (tenant_id, lower(name));
+
+-- 000097_inventory_stores.up.sql
+
+-- Stores stock is kept in: the main store, labs, the sports room, stores on
+-- other campuses.
+CREATE TABLE IF NOT EXISTS inventory_stores (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    code TEXT,
+    campus TEXT,
+    description TEXT,
+    in_charge_id UUID REFERENCES users(id),
+    is_default BOOLEAN NOT NULL DEFAULT FALSE,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (tenant_id, name)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_inventory_stores_default
+    ON inventory_stores (tenant_id) WHERE is_default;
+
+-- Every location stock was kept at becomes a store, and every tenant with
+-- items gets a Main Store, which is the default.
+INSERT INTO inventory_stores (tenant_id, name)
+SELECT DISTINCT tenant_id, COALESCE(NULLIF(btrim(location), ''), 'Main Store') FROM inventory_stocks
+UNION
+SELECT DISTINCT tenant_id, 'Main Store' FROM inventory_items
+ON CONFLICT (tenant_id, name) DO NOTHING;
+
+UPDATE inventory_stores SET is_default = TRUE WHERE name = 'Main Store';
+
+-- Items are issued at FIFO or weighted-average cost.
+ALTER TABLE inventory_items
+    ADD COLUMN IF NOT EXISTS valuation_method TEXT NOT NULL DEFAULT 'weighted_average'
+        CHECK (valuation_method IN ('fifo', 'weighted_average'));
+
+-- Stock balances are kept per store, with their value.
+ALTER TABLE inventory_stocks
+    ADD COLUMN IF NOT EXISTS store_id UUID REFERENCES inventory_stores(id),
+    ADD COLUMN IF NOT EXISTS stock_value NUMERIC(14, 2) NOT NULL DEFAULT 0;
+
+UPDATE inventory_stocks s SET store_id = st.id
+FROM inventory_stores st
+WHERE st.tenant_id = s.tenant_id AND st.name = COALESCE(NULLIF(btrim(s.location), ''), 'Main Store');
+
+-- Rows without a location and rows for the Main Store are merged.
+WITH dup AS (
+    SELECT store_id, item_id, SUM(quantity) AS total, (array_agg(id ORDER BY created_at, id))[1] AS keep
+    FROM inventory_stocks GROUP BY store_id, item_id HAVING COUNT(*) > 1
+)
+UPDATE inventory_stocks s SET quantity = dup.total FROM dup WHERE s.id = dup.keep;
+
+WITH dup AS (
+    SELECT store_id, item_id, (array_agg(id ORDER BY created_at, id))[1] AS keep
+    FROM inventory_stocks GROUP BY store_id, item_id HAVING COUNT(*) > 1
+)
+DELETE FROM inventory_stocks s USING dup
+WHERE s.store_id = dup.store_id AND s.item_id = dup.item_id AND s.id <> dup.keep;
+
+UPDATE inventory_stocks s SET location = st.name FROM inventory_stores st WHERE st.id = s.store_id;
+
+ALTER TABLE inventory_stocks ALTER COLUMN store_id SET NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_inventory_stocks_store_item ON inventory_stocks (store_id, item_id);
+
+-- The transaction ledger records the store, the signed change in quantity
+-- and the value that moved, so stock and valuation can be worked out as of
+-- any date.
+ALTER TABLE inventory_transactions DROP CONSTRAINT IF EXISTS inventory_transactions_type_check;
+ALTER TABLE inventory_transactions ADD CONSTRAINT inventory_transactions_type_check
+    CHECK (type IN ('in', 'out', 'adjustment', 'transfer_out', 'transfer_in'));
+
+ALTER TABLE inventory_transactions
+    ADD COLUMN IF NOT EXISTS store_id UUID REFERENCES inventory_stores(id),
+    ADD COLUMN IF NOT EXISTS stock_delta INTEGER,
+    ADD COLUMN IF NOT EXISTS stock_value NUMERIC(14, 2) NOT NULL DEFAULT 0;
+
+-- Earlier transactions did not record where stock went; they are put in
+-- the default store and valued at the item's average purchase price.
+WITH cost AS (
+    SELECT item_id, COALESCE(SUM(quantity * unit_price) / NULLIF(SUM(quantity), 0), 0) AS price
+    FROM inventory_transactions
+    WHERE type IN ('in', 'adjustment') AND unit_price IS NOT NULL
+    GROUP BY item_id
+)
+UPDATE inventory_transactions t SET
+    store_id = (SELECT st.id FROM inventory_stores st WHERE st.tenant_id = t.tenant_id AND st.is_default),
+    stock_delta = CASE WHEN t.type = 'out' THEN -t.quantity ELSE t.quantity END,
+    stock_value = ROUND(CASE
+        WHEN t.type = 'out' THEN -t.quantity * COALESCE((SELECT price FROM cost WHERE cost.item_id = t.item_id), 0)
+        ELSE t.quantity * COALESCE(t.unit_price, (SELECT price FROM cost WHERE cost.item_id = t.item_id), 0)
+    END, 2)
+WHERE t.stock_delta IS NULL;
+
+WITH cost AS (
+    SELECT item_id, COALESCE(SUM(quantity * unit_price) / NULLIF(SUM(quantity), 0), 0) AS price
+    FROM inventory_transactions
+    WHERE type IN ('in', 'adjustment') AND unit_price IS NOT NULL
+    GROUP BY item_id
+)
+UPDATE inventory_stocks s SET stock_value = ROUND(s.quantity * cost.price, 2)
+FROM cost WHERE cost.item_id = s.item_id;
+
+-- Opening entries bring each store's ledger in line with its balance.
+INSERT INTO inventory_transactions (tenant_id, item_id, type, quantity, store_id, stock_delta, stock_value, reference_type, remarks)
+SELECT tenant_id, item_id, 'adjustment', ABS(diff), store_id, diff, value_diff, 'store_migration', 'Opening balance by store'
+FROM (
+    SELECT COALESCE(s.tenant_id, l.tenant_id) AS tenant_id, COALESCE(s.item_id, l.item_id) AS item_id,
+        COALESCE(s.store_id, l.store_id) AS store_id,
+        COALESCE(s.quantity, 0) - COALESCE(l.qty, 0) AS diff,
+        COALESCE(s.stock_value, 0) - COALESCE(l.value, 0) AS value_diff
+    FROM inventory_stocks s
+    FULL JOIN (
+        SELECT tenant_id, item_id, store_id, SUM(stock_delta) AS qty, SUM(stock_value) AS value
+        FROM inventory_transactions GROUP BY tenant_id, item_id, store_id
+    ) l ON l.store_id = s.store_id AND l.item_id = s.item_id
+) r
+WHERE diff <> 0 OR value_diff <> 0;
+
+ALTER TABLE inventory_transactions ALTER COLUMN store_id SET NOT NULL;
+ALTER TABLE inventory_transactions ALTER COLUMN stock_delta SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_inventory_transactions_store ON inventory_transactions (store_id, item_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_inventory_transactions_tenant_date ON inventory_transactions (tenant_id, created_at);
+
+-- Stock received into FIFO items, oldest first, with what is left of it.
+CREATE TABLE IF NOT EXISTS inventory_cost_layers (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    item_id UUID NOT NULL REFERENCES inventory_items(id) ON DELETE CASCADE,
+    store_id UUID NOT NULL REFERENCES inventory_stores(id),
+    transaction_id UUID REFERENCES inventory_transactions(id),
+    received_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    quantity INTEGER NOT NULL CHECK (quantity > 0),
+    remaining INTEGER NOT NULL CHECK (remaining >= 0),
+    unit_cost NUMERIC(12, 2) NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_inventory_cost_layers_open
+    ON inventory_cost_layers (store_id, item_id, received_at) WHERE remaining > 0;
+
+-- Transfers between stores: dispatched from one, received at the other.
+CREATE TABLE IF NOT EXISTS inventory_transfers (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    transfer_number TEXT NOT NULL,
+    from_store_id UUID NOT NULL REFERENCES inventory_stores(id),
+    to_store_id UUID NOT NULL REFERENCES inventory_stores(id),
+    status TEXT NOT NULL DEFAULT 'draft' CHECK (status IN ('draft', 'in_transit', 'received', 'cancelled')),
+    notes TEXT,
+    created_by UUID REFERENCES users(id),
+    dispatched_by UUID REFERENCES users(id),
+    dispatched_at TIMESTAMPTZ,
+    received_by UUID REFERENCES users(id),
+    received_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (tenant_id, transfer_number),
+    CHECK (from_store_id <> to_store_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_inventory_transfers_tenant ON inventory_transfers (tenant_id, status, created_at DESC);
+
+CREATE TABLE IF NOT EXISTS inventory_transfer_items (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    transfer_id UUID NOT NULL REFERENCES inventory_transfers(id) ON DELETE CASCADE,
+    item_id UUID NOT NULL REFERENCES inventory_items(id),
+    quantity INTEGER NOT NULL CHECK (quantity > 0),
+    value NUMERIC(14, 2) NOT NULL DEFAULT 0,
+    cost_layers JSONB NOT NULL DEFAULT '[]',
+    received_quantity INTEGER CHECK (received_quantity >= 0 AND received_quantity <= quantity),
+    received_value NUMERIC(14, 2),
+    remarks TEXT,
+    UNIQUE (transfer_id, item_id)
+);
+
+-- Stock-takes count a store against the balances taken when counting
+-- started; posting adjusts the store by the variances.
+CREATE TABLE IF NOT EXISTS inventory_stock_takes (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    store_id UUID NOT NULL REFERENCES inventory_stores(id),
+    status TEXT NOT NULL DEFAULT 'counting' CHECK (status IN ('counting', 'posted', 'cancelled')),
+    notes TEXT,
+    started_by UUID REFERENCES users(id),
+    posted_by UUID REFERENCES users(id),
+    posted_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_inventory_stock_takes_open
+    ON inventory_stock_takes (store_id) WHERE status = 'counting';
+
+CREATE TABLE IF NOT EXISTS inventory_stock_take_items (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    stock_take_id UUID NOT NULL REFERENCES inventory_stock_takes(id) ON DELETE CASCADE,
+    item_id UUID NOT NULL REFERENCES inventory_items(id),
+    system_quantity INTEGER NOT NULL,
+    system_value NUMERIC(14, 2) NOT NULL DEFAULT 0,
+    counted_quantity INTEGER CHECK (counted_quantity >= 0),
+    variance_value NUMERIC(14, 2),
+    reason TEXT,
+    counted_by UUID REFERENCES users(id),
+    counted_at TIMESTAMPTZ,
+    UNIQUE (stock_take_id, item_id)
+);
+
+-- 000098_procurement.up.sql
+
+-- Items are reordered from their preferred supplier when stock on hand and
+-- on order falls to the reorder level.
+ALTER TABLE inventory_items
+    ADD COLUMN IF NOT EXISTS reorder_quantity INTEGER CHECK (reorder_quantity > 0),
+    ADD COLUMN IF NOT EXISTS preferred_supplier_id UUID REFERENCES inventory_suppliers(id) ON DELETE SET NULL;
+
+-- Per-school purchasing settings: whether reorders are drafted on their own
+-- and how far an invoice may differ from the order and the goods received.
+CREATE TABLE IF NOT EXISTS procurement_settings (
+    tenant_id UUID PRIMARY KEY REFERENCES tenants(id) ON DELETE CASCADE,
+    auto_reorder BOOLEAN NOT NULL DEFAULT FALSE,
+    quantity_tolerance_pct NUMERIC(5, 2) NOT NULL DEFAULT 0 CHECK (quantity_tolerance_pct >= 0),
+    price_tolerance_pct NUMERIC(5, 2) NOT NULL DEFAULT 2 CHECK (price_tolerance_pct >= 0),
+    amount_tolerance NUMERIC(12, 2) NOT NULL DEFAULT 0 CHECK (amount_tolerance >= 0),
+    updated_by UUID REFERENCES users(id),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Orders can be received in parts, and closed short when the rest will not
+-- come.
+ALTER TABLE purchase_orders DROP CONSTRAINT IF EXISTS purchase_orders_status_check;
+ALTER TABLE purchase_orders ADD CONSTRAINT purchase_orders_status_check
+    CHECK (status IN ('draft', 'submitted', 'approved', 'partially_received', 'received', 'closed', 'cancelled'));
+
+ALTER TABLE purchase_orders
+    ADD COLUMN IF NOT EXISTS store_id UUID REFERENCES inventory_stores(id),
+    ADD COLUMN IF NOT EXISTS expected_date DATE,
+    ADD COLUMN IF NOT EXISTS auto_generated BOOLEAN NOT NULL DEFAULT FALSE;
+
+UPDATE purchase_order_items SET received_quantity = 0 WHERE received_quantity IS NULL;
+ALTER TABLE purchase_order_items
+    ALTER COLUMN received_quantity SET NOT NULL,
+    ADD COLUMN IF NOT EXISTS rejected_quantity INTEGER NOT NULL DEFAULT 0 CHECK (rejected_quantity >= 0);
+
+-- Goods receipts: each delivery against an order, with what was accepted
+-- into stock and what was sent back.
+CREATE TABLE IF NOT EXISTS purchase_receipts (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    po_id UUID NOT NULL REFERENCES purchase_orders(id) ON DELETE CASCADE,
+    receipt_number TEXT NOT NULL,
+    store_id UUID NOT NULL REFERENCES inventory_stores(id),
+    notes TEXT,
+    received_by UUID REFERENCES users(id),
+    received_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (tenant_id, receipt_number)
+);
+
+CREATE INDEX IF NOT EXISTS idx_purchase_receipts_po ON purchase_receipts (po_id, received_at);
+
+CREATE TABLE IF NOT EXISTS purchase_receipt_items (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    receipt_id UUID NOT NULL REFERENCES purchase_receipts(id) ON DELETE CASCADE,
+    po_item_id UUID NOT NULL REFERENCES purchase_order_items(id) ON DELETE CASCADE,
+    item_id UUID NOT NULL REFERENCES inventory_items(id),
+    delivered_quantity INTEGER NOT NULL CHECK (delivered_quantity > 0),
+    rejected_quantity INTEGER NOT NULL DEFAULT 0 CHECK (rejected_quantity >= 0 AND rejected_quantity <= delivered_quantity),
+    rejection_reason TEXT,
+    transaction_id UUID REFERENCES inventory_transactions(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_purchase_receipt_items_po_item ON purchase_receipt_items (po_item_id);
+
+-- Supplier invoices, matched against the order and the goods received.
+CREATE TABLE IF NOT EXISTS supplier_invoices (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    supplier_id UUID NOT NULL REFERENCES inventory_suppliers(id),
+    po_id UUID NOT NULL REFERENCES purchase_orders(id),
+    invoice_number TEXT NOT NULL,
+    invoice_date DATE NOT NULL,
+    subtotal NUMERIC(12, 2) NOT NULL DEFAULT 0,
+    tax_amount NUMERIC(12, 2) NOT NULL DEFAULT 0,
+    total_amount NUMERIC(12, 2) NOT NULL DEFAULT 0,
+    status TEXT NOT NULL CHECK (status IN ('matched', 'exception', 'approved', 'rejected')),
+    exceptions JSONB NOT NULL DEFAULT '[]',
+    notes TEXT,
+    created_by UUID REFERENCES users(id),
+    decided_by UUID REFERENCES users(id),
+    decided_at TIMESTAMPTZ,
+    decision_reason TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (tenant_id, supplier_id, invoice_number)
+);
+
+CREATE INDEX IF NOT EXISTS idx_supplier_invoices_po ON supplier_invoices (po_id);
+CREATE INDEX IF NOT EXISTS idx_supplier_invoices_tenant ON supplier_invoices (tenant_id, status, invoice_date DESC);
+
+CREATE TABLE IF NOT EXISTS supplier_invoice_items (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    invoice_id UUID NOT NULL REFERENCES supplier_invoices(id) ON DELETE CASCADE,
+    po_item_id UUID NOT NULL REFERENCES purchase_order_items(id),
+    item_id UUID NOT NULL REFERENCES inventory_items(id),
+    quantity INTEGER NOT NULL CHECK (quantity > 0),
+    unit_price NUMERIC(12, 2) NOT NULL CHECK (unit_price >= 0),
+    UNIQUE (invoice_id, po_item_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_supplier_invoice_items_po_item ON supplier_invoice_items (po_item_id);
+
+-- 000099_fixed_assets.up.sql
+
+-- Items in asset categories carry the depreciation defaults for the assets
+-- registered against them.
+ALTER TABLE inventory_items
+    ADD COLUMN IF NOT EXISTS depreciation_method TEXT CHECK (depreciation_method IN ('straight_line', 'wdv')),
+    ADD COLUMN IF NOT EXISTS useful_life_months INTEGER CHECK (useful_life_months > 0),
+    ADD COLUMN IF NOT EXISTS depreciation_rate_pct NUMERIC(5, 2) CHECK (depreciation_rate_pct > 0 AND depreciation_rate_pct < 100),
+    ADD COLUMN IF NOT EXISTS residual_pct NUMERIC(5, 2) CHECK (residual_pct >= 0 AND residual_pct < 100);
+
+-- The register: one row per physical asset, tagged, with where it is and
+-- who answers for it.
+CREATE TABLE IF NOT EXISTS fixed_assets (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    item_id UUID NOT NULL REFERENCES inventory_items(id),
+    asset_tag TEXT NOT NULL,
+    name TEXT NOT NULL,
+    serial_number TEXT,
+    description TEXT,
+    room TEXT,
+    custodian_id UUID REFERENCES employees(id),
+    supplier_id UUID REFERENCES inventory_suppliers(id),
+    po_id UUID REFERENCES purchase_orders(id),
+    purchase_date DATE NOT NULL,
+    in_service_date DATE NOT NULL,
+    cost NUMERIC(12, 2) NOT NULL CHECK (cost >= 0),
+    residual_value NUMERIC(12, 2) NOT NULL DEFAULT 0 CHECK (residual_value >= 0 AND residual_value <= cost),
+    depreciation_method TEXT NOT NULL CHECK (depreciation_method IN ('straight_line', 'wdv')),
+    useful_life_months INTEGER CHECK (useful_life_months > 0),
+    depreciation_rate_pct NUMERIC(5, 2) CHECK (depreciation_rate_pct > 0 AND depreciation_rate_pct < 100),
+    accumulated_depreciation NUMERIC(12, 2) NOT NULL DEFAULT 0,
+    status TEXT NOT NULL DEFAULT 'in_use' CHECK (status IN ('in_use', 'in_store', 'under_repair', 'missing', 'disposed')),
+    last_verified_on DATE,
+    disposed_on DATE,
+    created_by UUID REFERENCES users(id),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (tenant_id, asset_tag),
+    CHECK (depreciation_method <> 'straight_line' OR useful_life_months IS NOT NULL),
+    CHECK (depreciation_method <> 'wdv' OR depreciation_rate_pct IS NOT NULL),
+    CHECK (in_service_date >= purchase_date)
+);
+
+CREATE INDEX IF NOT EXISTS idx_fixed_assets_tenant ON fixed_assets (tenant_id, status);
+CREATE INDEX IF NOT EXISTS idx_fixed_assets_item ON fixed_assets (item_id);
+CREATE INDEX IF NOT EXISTS idx_fixed_assets_custodian ON fixed_assets (custodian_id) WHERE custodian_id IS NOT NULL;
+
+-- Every change of room, custodian or status, starting with registration.
+CREATE TABLE IF NOT EXISTS fixed_asset_movements (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    asset_id UUID NOT NULL REFERENCES fixed_assets(id) ON DELETE CASCADE,
+    from_room TEXT,
+    to_room TEXT,
+    from_custodian_id UUID REFERENCES employees(id),
+    to_custodian_id UUID REFERENCES employees(id),
+    from_status TEXT,
+    to_status TEXT NOT NULL,
+    reason TEXT,
+    moved_by UUID REFERENCES users(id),
+    moved_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_fixed_asset_movements_asset ON fixed_asset_movements (asset_id, moved_at);
+
+-- Warranties and annual maintenance contracts.
+CREATE TABLE IF NOT EXISTS fixed_asset_contracts (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    asset_id UUID NOT NULL REFERENCES fixed_assets(id) ON DELETE CASCADE,
+    kind TEXT NOT NULL CHECK (kind IN ('warranty', 'amc')),
+    provider TEXT NOT NULL,
+    reference TEXT,
+    starts_on DATE NOT NULL,
+    ends_on DATE NOT NULL,
+    cost NUMERIC(12, 2) NOT NULL DEFAULT 0 CHECK (cost >= 0),
+    coverage TEXT,
+    created_by UUID REFERENCES users(id),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK (ends_on >= starts_on)
+);
+
+CREATE INDEX IF NOT EXISTS idx_fixed_asset_contracts_asset ON fixed_asset_contracts (asset_id, ends_on);
+CREATE INDEX IF NOT EXISTS idx_fixed_asset_contracts_expiry ON fixed_asset_contracts (tenant_id, ends_on);
+
+-- Depreciation charged per financial year (April to March), identified by
+-- the year it starts in.
+CREATE TABLE IF NOT EXISTS fixed_asset_depreciation (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    asset_id UUID NOT NULL REFERENCES fixed_assets(id) ON DELETE CASCADE,
+    financial_year INTEGER NOT NULL,
+    period_start DATE NOT NULL,
+    period_end DATE NOT NULL,
+    opening_value NUMERIC(12, 2) NOT NULL,
+    amount NUMERIC(12, 2) NOT NULL CHECK (amount >= 0),
+    closing_value NUMERIC(12, 2) NOT NULL,
+    posted_by UUID REFERENCES users(id),
+    posted_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (asset_id, financial_year)
+);
+
+CREATE INDEX IF NOT EXISTS idx_fixed_asset_depreciation_tenant ON fixed_asset_depreciation (tenant_id, financial_year);
+
+-- Disposal and write-off go through the approvals inbox.
+CREATE TABLE IF NOT EXISTS fixed_asset_disposals (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    asset_id UUID NOT NULL REFERENCES fixed_assets(id) ON DELETE CASCADE,
+    method TEXT NOT NULL CHECK (method IN ('sale', 'scrap', 'donation', 'write_off')),
+    disposal_date DATE NOT NULL,
+    proceeds NUMERIC(12, 2) NOT NULL DEFAULT 0 CHECK (proceeds >= 0),
+    book_value NUMERIC(12, 2) NOT NULL,
+    reason TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'approved', 'rejected')),
+    approval_request_id UUID REFERENCES approval_requests(id),
+    requested_by UUID REFERENCES users(id),
+    requested_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    decided_by UUID REFERENCES users(id),
+    decided_at TIMESTAMPTZ,
+    remark TEXT
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS uq_fixed_asset_disposals_pending ON fixed_asset_disposals (asset_id) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_fixed_asset_disposals_tenant ON fixed_asset_disposals (tenant_id, status);
+
+-- Yearly physical verification: every asset on the register when the
+-- round starts is checked off as found, damaged or missing.
+CREATE TABLE IF NOT EXISTS fixed_asset_verifications (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    financial_year INTEGER NOT NULL,
+    title TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'closed')),
+    notes TEXT,
+    started_by UUID REFERENCES users(id),
+    started_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    closed_by UUID REFERENCES users(id),
+    closed_at TIMESTAMPTZ,
+    UNIQUE (tenant_id, financial_year)
+);
+
+CREATE TABLE IF NOT EXISTS fixed_asset_verification_items (
+    verification_id UUID NOT NULL REFERENCES fixed_asset_verifications(id) ON DELETE CASCADE,
+    asset_id UUID NOT NULL REFERENCES fixed_assets(id) ON DELETE CASCADE,
+    expected_room TEXT,
+    expected_custodian_id UUID REFERENCES employees(id),
+    result TEXT NOT NULL DEFAULT 'pending' CHECK (result IN ('pending', 'found', 'damaged', 'missing')),
+    found_room TEXT,
+    remarks TEXT,
+    verified_by UUID REFERENCES users(id),
+    verified_at TIMESTAMPTZ,
+    PRIMARY KEY (verification_id, asset_id)
+);
+
+-- 000100_hostel_operations.up.sql
+
+-- Rooms and allocations only reached their tenant through the building.
+ALTER TABLE hostel_rooms ADD COLUMN IF NOT EXISTS tenant_id UUID REFERENCES tenants(id) ON DELETE CASCADE;
+UPDATE hostel_rooms r SET tenant_id = b.tenant_id
+FROM hostel_buildings b WHERE b.id = r.building_id AND r.tenant_id IS NULL;
+ALTER TABLE hostel_rooms ALTER COLUMN tenant_id SET NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_hostel_rooms_tenant ON hostel_rooms (tenant_id, building_id);
+
+-- Beds are what a student is allotted; a room's capacity is its bed count.
+CREATE TABLE IF NOT EXISTS hostel_beds (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    room_id UUID NOT NULL REFERENCES hostel_rooms(id) ON DELETE CASCADE,
+    label TEXT NOT NULL,
+    is_active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (room_id, label)
+);
+
+INSERT INTO hostel_beds (tenant_id, room_id, label)
+SELECT r.tenant_id, r.id, 'B' || g
+FROM hostel_rooms r, generate_series(1, GREATEST(r.capacity, 0)) g
+ON CONFLICT (room_id, label) DO NOTHING;
+
+ALTER TABLE hostel_allocations
+    ADD COLUMN IF NOT EXISTS tenant_id UUID REFERENCES tenants(id) ON DELETE CASCADE,
+    ADD COLUMN IF NOT EXISTS bed_id UUID REFERENCES hostel_beds(id),
+    ADD COLUMN IF NOT EXISTS allotted_by UUID REFERENCES users(id) ON DELETE SET NULL;
+UPDATE hostel_allocations a SET tenant_id = r.tenant_id
+FROM hostel_rooms r WHERE r.id = a.room_id AND a.tenant_id IS NULL;
+ALTER TABLE hostel_allocations ALTER COLUMN tenant_id SET NOT NULL;
+
+-- Concurrent allocations could leave a student in two rooms; keep the
+-- latest.
+UPDATE hostel_allocations a
+SET status = 'vacated', vacated_on = CURRENT_DATE,
+    remarks = COALESCE(a.remarks || ' ', '') || '(duplicate allocation closed)'
+WHERE a.status = 'active' AND EXISTS (
+    SELECT 1 FROM hostel_allocations n
+    WHERE n.student_id = a.student_id AND n.status = 'active'
+      AND (n.created_at, n.id) > (a.created_at, a.id)
+);
+
+-- Seat existing residents on the room's beds in allotment order. Rooms that
+-- were overfilled leave the extra residents without a bed.
+WITH residents AS (
+    SELECT id, room_id, row_number() OVER (PARTITION BY room_id ORDER BY allotted_on, created_at, id) AS n
+    FROM hostel_allocations WHERE status = 'active' AND bed_id IS NULL
+), beds AS (
+    SELECT id, room_id, row_number() OVER (PARTITION BY room_id ORDER BY length(label), label) AS n
+    FROM hostel_beds
+)
+UPDATE hostel_allocations a SET bed_id = beds.id
+FROM residents JOIN beds ON beds.room_id = residents.room_id AND beds.n = residents.n
+WHERE a.id = residents.id;
+
+UPDATE hostel_rooms r SET occupancy = (
+    SELECT COUNT(*) FROM hostel_allocations a WHERE a.room_id = r.id AND a.status = 'active'
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_hostel_allocations_one_per_student
+    ON hostel_allocations (tenant_id, student_id) WHERE status = 'active';
+CREATE UNIQUE INDEX IF NOT EXISTS idx_hostel_allocations_one_per_bed
+    ON hostel_allocations (bed_id) WHERE status = 'active';
+CREATE INDEX IF NOT EXISTS idx_hostel_allocations_dates
+    ON hostel_allocations (tenant_id, allotted_on, vacated_on);
+
+-- Leave and outings. An approved request issues a gate pass for the time
+-- the student is away.
+CREATE TABLE IF NOT EXISTS hostel_leave_requests (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    student_id UUID NOT NULL REFERENCES students(id) ON DELETE CASCADE,
+    allocation_id UUID NOT NULL REFERENCES hostel_allocations(id) ON DELETE CASCADE,
+    kind TEXT NOT NULL CHECK (kind IN ('leave', 'outing')),
+    reason TEXT NOT NULL,
+    destination TEXT,
+    escort_name TEXT,
+    escort_phone TEXT,
+    departs_at TIMESTAMPTZ NOT NULL,
+    returns_at TIMESTAMPTZ NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'approved', 'rejected', 'cancelled', 'out', 'returned')),
+    requested_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    decided_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    decided_at TIMESTAMPTZ,
+    decision_remark TEXT,
+    gate_pass_id UUID REFERENCES gate_passes(id) ON DELETE SET NULL,
+    checked_out_at TIMESTAMPTZ,
+    returned_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK (returns_at > departs_at)
+);
+
+CREATE INDEX IF NOT EXISTS idx_hostel_leave_requests_student
+    ON hostel_leave_requests (tenant_id, student_id, departs_at DESC);
+CREATE INDEX IF NOT EXISTS idx_hostel_leave_requests_status
+    ON hostel_leave_requests (tenant_id, status, departs_at);
+
+-- Nightly roll-call, one per building per night.
+CREATE TABLE IF NOT EXISTS hostel_roll_calls (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    building_id UUID NOT NULL REFERENCES hostel_buildings(id) ON DELETE CASCADE,
+    call_date DATE NOT NULL,
+    notes TEXT,
+    taken_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    taken_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (building_id, call_date)
+);
+
+CREATE TABLE IF NOT EXISTS hostel_roll_call_entries (
+    roll_call_id UUID NOT NULL REFERENCES hostel_roll_calls(id) ON DELETE CASCADE,
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    student_id UUID NOT NULL REFERENCES students(id) ON DELETE CASCADE,
+    allocation_id UUID REFERENCES hostel_allocations(id) ON DELETE SET NULL,
+    status TEXT NOT NULL CHECK (status IN ('present', 'absent', 'on_leave')),
+    leave_id UUID REFERENCES hostel_leave_requests(id) ON DELETE SET NULL,
+    remarks TEXT,
+    marked_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (roll_call_id, student_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_hostel_roll_call_entries_student
+    ON hostel_roll_call_entries (tenant_id, student_id);
+
+-- Mess menu by date and meal.
+CREATE TABLE IF NOT EXISTS hostel_mess_menus (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    menu_date DATE NOT NULL,
+    meal TEXT NOT NULL CHECK (meal IN ('breakfast', 'lunch', 'snacks', 'dinner')),
+    items TEXT NOT NULL,
+    notes TEXT,
+    updated_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (tenant_id, menu_date, meal)
+);
+
+-- Meals a resident will not take. Approved leave opts the student out of
+-- the whole days away.
+CREATE TABLE IF NOT EXISTS hostel_meal_opt_outs (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    student_id UUID NOT NULL REFERENCES students(id) ON DELETE CASCADE,
+    from_date DATE NOT NULL,
+    to_date DATE NOT NULL,
+    meals TEXT[] NOT NULL,
+    reason TEXT,
+    leave_id UUID REFERENCES hostel_leave_requests(id) ON DELETE CASCADE,
+    status TEXT NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'cancelled')),
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK (to_date >= from_date),
+    CHECK (cardinality(meals) > 0)
+);
+
+CREATE INDEX IF NOT EXISTS idx_hostel_meal_opt_outs_dates
+    ON hostel_meal_opt_outs (tenant_id, from_date, to_date) WHERE status = 'active';
+
+-- How hostel and mess fees are worked out; amounts in paise.
+CREATE TABLE IF NOT EXISTS hostel_fee_settings (
+    tenant_id UUID PRIMARY KEY REFERENCES tenants(id) ON DELETE CASCADE,
+    fee_head_id UUID REFERENCES fee_heads(id) ON DELETE SET NULL,
+    mess_fee_head_id UUID REFERENCES fee_heads(id) ON DELETE SET NULL,
+    mess_monthly_fee BIGINT NOT NULL DEFAULT 0 CHECK (mess_monthly_fee >= 0),
+    mess_rebate_per_day BIGINT NOT NULL DEFAULT 0 CHECK (mess_rebate_per_day >= 0),
+    mess_rebate_min_days INT NOT NULL DEFAULT 3 CHECK (mess_rebate_min_days >= 1),
+    proration TEXT NOT NULL DEFAULT 'monthly' CHECK (proration IN ('none', 'monthly', 'daily')),
+    updated_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- The billing terms hostel and mess fees are charged for.
+CREATE TABLE IF NOT EXISTS hostel_fee_terms (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    academic_year_id UUID NOT NULL REFERENCES academic_years(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    start_date DATE NOT NULL,
+    end_date DATE NOT NULL,
+    due_date DATE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (tenant_id, academic_year_id, name),
+    CHECK (end_date >= start_date)
+);
+
+CREATE TABLE IF NOT EXISTS hostel_fee_runs (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    term_id UUID NOT NULL REFERENCES hostel_fee_terms(id) ON DELETE CASCADE,
+    created_count INT NOT NULL DEFAULT 0,
+    updated_count INT NOT NULL DEFAULT 0,
+    unchanged_count INT NOT NULL DEFAULT 0,
+    cancelled_count INT NOT NULL DEFAULT 0,
+    skipped_count INT NOT NULL DEFAULT 0,
+    report JSONB NOT NULL DEFAULT '[]'::jsonb,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_hostel_fee_runs_term
+    ON hostel_fee_runs (tenant_id, term_id, created_at DESC);
+
+-- 000101_otp_code_delivery.up.sql
+
+-- OTP codes are held encrypted on the challenge until the worker has sent them,
+-- instead of travelling in plaintext in the outbox payload.
+ALTER TABLE auth_otp_challenges ADD COLUMN IF NOT EXISTS code_ciphertext TEXT;
+ALTER TABLE auth_otp_challenges ADD COLUMN IF NOT EXISTS dispatched_at TIMESTAMPTZ;
+
+-- Scrub codes already written to the outbox.
+UPDATE outbox
+SET payload = payload - 'message' - 'purpose' - 'expires_at'
+WHERE event_type = 'auth.otp.requested' AND payload ? 'message';
+
+-- 000102_sso_second_factor.up.sql
+
+-- How the IdP authenticated the user (OIDC amr / SAML AuthnContextClassRef),
+-- checked against the phishing-resistant policy when the ticket is exchanged.
+ALTER TABLE sso_login_requests ADD COLUMN IF NOT EXISTS auth_methods TEXT[] NOT NULL DEFAULT '{}';
+
+-- A second-factor challenge started from SSO signs in with the SSO identity
+-- rather than the password one.
+ALTER TABLE mfa_login_sessions ADD COLUMN IF NOT EXISTS identity_id UUID REFERENCES user_identities(id) ON DELETE CASCADE;
+
+-- 000103_outbox_webhook_cursor.up.sql
+
+-- Tenant webhook fan-out keeps its own cursor on the outbox instead of riding on
+-- status, which the API processor and the worker both move to 'completed'.
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS webhooks_enqueued_at TIMESTAMPTZ;
+
+-- Enqueuing is idempotent per endpoint, so the last day is left for the fan-out
+-- to pick up again; that recovers events the worker completed without it.
+UPDATE outbox SET webhooks_enqueued_at = NOW()
+WHERE webhooks_enqueued_at IS NULL AND created_at < NOW() - INTERVAL '1 day';
+
+CREATE INDEX IF NOT EXISTS idx_outbox_webhook_fanout
+    ON outbox (created_at) WHERE webhooks_enqueued_at IS NULL;
+
+-- 000104_kb_embedding_failures.up.sql
+
+-- Chunks the embedder returned nothing for. The indexer backs off between
+-- attempts and gives up after a fixed number, so one bad chunk no longer
+-- holds the head of the queue. Rows go away with the chunk, on a successful
+-- embed and on a tenant reindex.
+CREATE TABLE IF NOT EXISTS kb_chunk_embedding_failures (
+    chunk_id UUID PRIMARY KEY REFERENCES kb_chunks(id) ON DELETE CASCADE,
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    model TEXT NOT NULL,
+    attempts INT NOT NULL DEFAULT 1,
+    last_error TEXT NOT NULL DEFAULT '',
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS kb_chunk_embedding_failures_tenant_model
+    ON kb_chunk_embedding_failures (tenant_id, model);
+
+-- 000105_whatsapp_inbound.up.sql
+
+-- Inbound WhatsApp messages are routed to the tenant whose gateway settings
+-- name the receiving WhatsApp phone-number id, which the gateway signs with
+-- the message. A number can belong to one tenant only.
+CREATE UNIQUE INDEX IF NOT EXISTS notification_gateway_whatsapp_number
+    ON notification_gateway_configs ((settings->>'whatsapp_phone_number_id'))
+    WHERE settings->>'whatsapp_phone_number_id' IS NOT NULL;
+
+-- Provider message ids already answered, so a redelivered or replayed
+-- message is not answered twice.
+CREATE TABLE IF NOT EXISTS whatsapp_inbound_messages (
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    message_id TEXT NOT NULL,
+    received_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (tenant_id, message_id)
+);
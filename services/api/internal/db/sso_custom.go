@@ -0,0 +1,340 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// SSOProvider is a tenant's identity provider configuration.
+type SSOProvider struct {
+	ID                  pgtype.UUID
+	TenantID            pgtype.UUID
+	Name                string
+	Protocol            string
+	IsEnabled           bool
+	OIDCIssuer          string
+	OIDCClientID        string
+	OIDCClientSecretEnc string
+	OIDCScopes          []string
+	SAMLIdPEntityID     string
+	SAMLIdPSSOURL       string
+	SAMLIdPCertificate  string
+	AllowedDomains      []string
+	GroupsClaim         string
+	RoleMappings        []byte
+	AssumeEmailVerified bool
+	CreatedAt           pgtype.Timestamptz
+	UpdatedAt           pgtype.Timestamptz
+}
+
+const ssoProviderColumns = `
+	id, tenant_id, name, protocol, is_enabled,
+	COALESCE(oidc_issuer, ''), COALESCE(oidc_client_id, ''), COALESCE(oidc_client_secret_enc, ''), oidc_scopes,
+	COALESCE(saml_idp_entity_id, ''), COALESCE(saml_idp_sso_url, ''), COALESCE(saml_idp_certificate, ''),
+	allowed_domains, groups_claim, role_mappings, assume_email_verified, created_at, updated_at
+`
+
+func scanSSOProvider(row pgx.Row) (SSOProvider, error) {
+	var p SSOProvider
+	err := row.Scan(
+		&p.ID, &p.TenantID, &p.Name, &p.Protocol, &p.IsEnabled,
+		&p.OIDCIssuer, &p.OIDCClientID, &p.OIDCClientSecretEnc, &p.OIDCScopes,
+		&p.SAMLIdPEntityID, &p.SAMLIdPSSOURL, &p.SAMLIdPCertificate,
+		&p.AllowedDomains, &p.GroupsClaim, &p.RoleMappings, &p.AssumeEmailVerified, &p.CreatedAt, &p.UpdatedAt,
+	)
+	return p, err
+}
+
+// ListSSOProviders returns a tenant's identity providers, optionally only enabled ones.
+func (q *Queries) ListSSOProviders(ctx context.Context, tenantID pgtype.UUID, enabledOnly bool) ([]SSOProvider, error) {
+	query := `SELECT ` + ssoProviderColumns + ` FROM tenant_sso_providers
+		WHERE tenant_id = $1 AND ($2 = FALSE OR is_enabled)
+		ORDER BY name ASC`
+	rows, err := q.db.Query(ctx, query, tenantID, enabledOnly)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []SSOProvider
+	for rows.Next() {
+		p, err := scanSSOProvider(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+// GetSSOProvider returns one provider. A zero tenantID looks the provider up by ID
+// alone, which the SAML metadata and ACS endpoints need before a tenant is known.
+func (q *Queries) GetSSOProvider(ctx context.Context, tenantID, id pgtype.UUID) (SSOProvider, error) {
+	query := `SELECT ` + ssoProviderColumns + ` FROM tenant_sso_providers
+		WHERE id = $1 AND ($2::uuid IS NULL OR tenant_id = $2)`
+	return scanSSOProvider(q.db.QueryRow(ctx, query, id, tenantID))
+}
+
+// UpsertSSOProviderParams holds the writable provider fields.
+type UpsertSSOProviderParams struct {
+	ID                  pgtype.UUID
+	TenantID            pgtype.UUID
+	Name                string
+	Protocol            string
+	IsEnabled           bool
+	OIDCIssuer          string
+	OIDCClientID        string
+	OIDCClientSecretEnc string
+	OIDCScopes          []string
+	SAMLIdPEntityID     string
+	SAMLIdPSSOURL       string
+	SAMLIdPCertificate  string
+	AllowedDomains      []string
+	GroupsClaim         string
+	RoleMappings        []byte
+	AssumeEmailVerified bool
+	CreatedBy           pgtype.UUID
+}
+
+// CreateSSOProvider inserts a provider.
+func (q *Queries) CreateSSOProvider(ctx context.Context, arg UpsertSSOProviderParams) (SSOProvider, error) {
+	query := `
+		INSERT INTO tenant_sso_providers (
+			tenant_id, name, protocol, is_enabled,
+			oidc_issuer, oidc_client_id, oidc_client_secret_enc, oidc_scopes,
+			saml_idp_entity_id, saml_idp_sso_url, saml_idp_certificate,
+			allowed_domains, groups_claim, role_mappings, assume_email_verified, created_by
+		) VALUES (
+			$1, $2, $3, $4,
+			NULLIF($5, ''), NULLIF($6, ''), NULLIF($7, ''), $8,
+			NULLIF($9, ''), NULLIF($10, ''), NULLIF($11, ''),
+			$12, $13, $14, $15, $16
+		)
+		RETURNING ` + ssoProviderColumns
+	return scanSSOProvider(q.db.QueryRow(ctx, query,
+		arg.TenantID, arg.Name, arg.Protocol, arg.IsEnabled,
+		arg.OIDCIssuer, arg.OIDCClientID, arg.OIDCClientSecretEnc, arg.OIDCScopes,
+		arg.SAMLIdPEntityID, arg.SAMLIdPSSOURL, arg.SAMLIdPCertificate,
+		arg.AllowedDomains, arg.GroupsClaim, arg.RoleMappings, arg.AssumeEmailVerified, arg.CreatedBy,
+	))
+}
+
+// UpdateSSOProvider replaces a provider's settings. An empty secret keeps the stored one.
+func (q *Queries) UpdateSSOProvider(ctx context.Context, arg UpsertSSOProviderParams) (SSOProvider, error) {
+	query := `
+		UPDATE tenant_sso_providers SET
+			name = $3, is_enabled = $4,
+			oidc_issuer = NULLIF($5, ''), oidc_client_id = NULLIF($6, ''),
+			oidc_client_secret_enc = COALESCE(NULLIF($7, ''), oidc_client_secret_enc), oidc_scopes = $8,
+			saml_idp_entity_id = NULLIF($9, ''), saml_idp_sso_url = NULLIF($10, ''), saml_idp_certificate = NULLIF($11, ''),
+			allowed_domains = $12, groups_claim = $13, role_mappings = $14, assume_email_verified = $15,
+			updated_at = NOW()
+		WHERE id = $1 AND tenant_id = $2
+		RETURNING ` + ssoProviderColumns
+	return scanSSOProvider(q.db.QueryRow(ctx, query,
+		arg.ID, arg.TenantID, arg.Name, arg.IsEnabled,
+		arg.OIDCIssuer, arg.OIDCClientID, arg.OIDCClientSecretEnc, arg.OIDCScopes,
+		arg.SAMLIdPEntityID, arg.SAMLIdPSSOURL, arg.SAMLIdPCertificate,
+		arg.AllowedDomains, arg.GroupsClaim, arg.RoleMappings, arg.AssumeEmailVerified,
+	))
+}
+
+// DeleteSSOProvider removes a provider; it reports whether a row was deleted.
+func (q *Queries) DeleteSSOProvider(ctx context.Context, tenantID, id pgtype.UUID) (bool, error) {
+	tag, err := q.db.Exec(ctx, `DELETE FROM tenant_sso_providers WHERE id = $1 AND tenant_id = $2`, id, tenantID)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// GetTenantSSOOnly reports whether staff of a tenant must sign in through SSO.
+func (q *Queries) GetTenantSSOOnly(ctx context.Context, tenantID pgtype.UUID) (bool, error) {
+	var ssoOnly bool
+	err := q.db.QueryRow(ctx, `SELECT sso_only FROM tenant_sso_settings WHERE tenant_id = $1`, tenantID).Scan(&ssoOnly)
+	if err == pgx.ErrNoRows {
+		return false, nil
+	}
+	return ssoOnly, err
+}
+
+// UpsertTenantSSOSettings stores a tenant's SSO enforcement flag.
+func (q *Queries) UpsertTenantSSOSettings(ctx context.Context, tenantID pgtype.UUID, ssoOnly bool, updatedBy pgtype.UUID) error {
+	const query = `
+		INSERT INTO tenant_sso_settings (tenant_id, sso_only, updated_by, updated_at)
+		VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (tenant_id) DO UPDATE
+		SET sso_only = EXCLUDED.sso_only, updated_by = EXCLUDED.updated_by, updated_at = NOW()
+	`
+	_, err := q.db.Exec(ctx, query, tenantID, ssoOnly, updatedBy)
+	return err
+}
+
+// SSOLoginRequest is one in-flight SSO attempt.
+type SSOLoginRequest struct {
+	ID            pgtype.UUID
+	TenantID      pgtype.UUID
+	ProviderID    pgtype.UUID
+	Nonce         string
+	CodeVerifier  string
+	SAMLRequestID string
+	RedirectPath  string
+}
+
+// CreateSSOLoginRequestParams are the params for CreateSSOLoginRequest.
+type CreateSSOLoginRequestParams struct {
+	TenantID      pgtype.UUID
+	ProviderID    pgtype.UUID
+	StateHash     string
+	Nonce         string
+	CodeVerifier  string
+	SAMLRequestID string
+	RedirectPath  string
+	ExpiresAt     time.Time
+}
+
+// CreateSSOLoginRequest records an SSO attempt before the user is sent to the IdP.
+func (q *Queries) CreateSSOLoginRequest(ctx context.Context, arg CreateSSOLoginRequestParams) error {
+	const query = `
+		INSERT INTO sso_login_requests (
+			tenant_id, provider_id, state_hash, nonce, code_verifier, saml_request_id, redirect_path, expires_at
+		) VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''), NULLIF($6, ''), NULLIF($7, ''), $8)
+	`
+	_, err := q.db.Exec(ctx, query,
+		arg.TenantID, arg.ProviderID, arg.StateHash, arg.Nonce, arg.CodeVerifier, arg.SAMLRequestID, arg.RedirectPath, arg.ExpiresAt)
+	return err
+}
+
+// ClaimSSOLoginRequest marks an unexpired attempt as completed and returns it. Each
+// state can be claimed once, so a replayed callback finds no rows.
+func (q *Queries) ClaimSSOLoginRequest(ctx context.Context, stateHash string) (SSOLoginRequest, error) {
+	const query = `
+		UPDATE sso_login_requests
+		SET completed_at = NOW()
+		WHERE state_hash = $1 AND completed_at IS NULL AND expires_at > NOW()
+		RETURNING id, tenant_id, provider_id, COALESCE(nonce, ''), COALESCE(code_verifier, ''),
+		          COALESCE(saml_request_id, ''), COALESCE(redirect_path, '')
+	`
+	var r SSOLoginRequest
+	err := q.db.QueryRow(ctx, query, stateHash).Scan(
+		&r.ID, &r.TenantID, &r.ProviderID, &r.Nonce, &r.CodeVerifier, &r.SAMLRequestID, &r.RedirectPath)
+	return r, err
+}
+
+// SetSSOLoginTicket attaches the signed-in identity and a one-time ticket to an attempt.
+// authMethods is what the IdP asserted about how the user authenticated.
+func (q *Queries) SetSSOLoginTicket(ctx context.Context, id, userID, identityID pgtype.UUID, ticketHash string, expiresAt time.Time, authMethods []string) error {
+	if authMethods == nil {
+		authMethods = []string{}
+	}
+	const query = `
+		UPDATE sso_login_requests
+		SET user_id = $2, identity_id = $3, ticket_hash = $4, ticket_expires_at = $5, auth_methods = $6
+		WHERE id = $1
+	`
+	_, err := q.db.Exec(ctx, query, id, userID, identityID, ticketHash, expiresAt, authMethods)
+	return err
+}
+
+// SSOTicketRedemption is what a redeemed ticket was issued for.
+type SSOTicketRedemption struct {
+	TenantID     pgtype.UUID
+	RedirectPath string
+	Identity     AuthIdentity
+	AuthMethods  []string
+}
+
+// RedeemSSOTicket consumes a ticket. Each ticket can be redeemed once.
+func (q *Queries) RedeemSSOTicket(ctx context.Context, ticketHash string) (SSOTicketRedemption, error) {
+	const query = `
+		WITH redeemed AS (
+			UPDATE sso_login_requests
+			SET redeemed_at = NOW()
+			WHERE ticket_hash = $1 AND redeemed_at IS NULL AND ticket_expires_at > NOW()
+			RETURNING tenant_id, identity_id, COALESCE(redirect_path, '') AS redirect_path, auth_methods
+		)
+		SELECT r.tenant_id, r.redirect_path, r.auth_methods, i.id, i.user_id, i.provider, i.identifier, i.credential
+		FROM redeemed r
+		JOIN user_identities i ON i.id = r.identity_id
+	`
+	var out SSOTicketRedemption
+	err := q.db.QueryRow(ctx, query, ticketHash).Scan(
+		&out.TenantID, &out.RedirectPath, &out.AuthMethods,
+		&out.Identity.ID, &out.Identity.UserID, &out.Identity.Provider, &out.Identity.Identifier, &out.Identity.Credential)
+	return out, err
+}
+
+// GetIdentityByID loads one identity.
+func (q *Queries) GetIdentityByID(ctx context.Context, id pgtype.UUID) (AuthIdentity, error) {
+	const query = `
+		SELECT id, user_id, provider, identifier, credential
+		FROM user_identities
+		WHERE id = $1
+	`
+	var identity AuthIdentity
+	err := q.db.QueryRow(ctx, query, id).
+		Scan(&identity.ID, &identity.UserID, &identity.Provider, &identity.Identifier, &identity.Credential)
+	return identity, err
+}
+
+// GetIdentityByIdentifier finds the identity registered for a provider/identifier pair.
+func (q *Queries) GetIdentityByIdentifier(ctx context.Context, provider, identifier string) (AuthIdentity, error) {
+	const query = `
+		SELECT id, user_id, provider, identifier, credential
+		FROM user_identities
+		WHERE provider = $1 AND identifier = $2
+	`
+	var identity AuthIdentity
+	err := q.db.QueryRow(ctx, query, provider, identifier).
+		Scan(&identity.ID, &identity.UserID, &identity.Provider, &identity.Identifier, &identity.Credential)
+	return identity, err
+}
+
+// LinkUserIdentity registers an external identity for a user. It never re-points an
+// identifier that already belongs to someone else.
+func (q *Queries) LinkUserIdentity(ctx context.Context, userID pgtype.UUID, provider, identifier string) (AuthIdentity, error) {
+	const query = `
+		INSERT INTO user_identities (user_id, provider, identifier)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (provider, identifier) DO NOTHING
+	`
+	if _, err := q.db.Exec(ctx, query, userID, provider, identifier); err != nil {
+		return AuthIdentity{}, err
+	}
+	return q.GetIdentityByIdentifier(ctx, provider, identifier)
+}
+
+// TenantRoleAssignment is one of a user's roles within a tenant.
+type TenantRoleAssignment struct {
+	RoleID    pgtype.UUID
+	RoleCode  string
+	ScopeType string
+}
+
+// ListUserTenantRoles returns the roles a user holds in a tenant.
+func (q *Queries) ListUserTenantRoles(ctx context.Context, userID, tenantID pgtype.UUID) ([]TenantRoleAssignment, error) {
+	const query = `
+		SELECT ra.role_id, r.code, COALESCE(ra.scope_type, '')
+		FROM role_assignments ra
+		JOIN roles r ON r.id = ra.role_id
+		WHERE ra.user_id = $1 AND ra.tenant_id = $2
+	`
+	rows, err := q.db.Query(ctx, query, userID, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []TenantRoleAssignment
+	for rows.Next() {
+		var r TenantRoleAssignment
+		if err := rows.Scan(&r.RoleID, &r.RoleCode, &r.ScopeType); err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,404 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Settings
+
+type TransportFeeSettings struct {
+	TenantID  pgtype.UUID        `json:"tenant_id"`
+	FareMode  string             `json:"fare_mode"`
+	Proration string             `json:"proration"`
+	FeeHeadID pgtype.UUID        `json:"fee_head_id"`
+	UpdatedBy pgtype.UUID        `json:"updated_by"`
+	UpdatedAt pgtype.Timestamptz `json:"updated_at"`
+}
+
+const transportFeeSettingsColumns = `tenant_id, fare_mode, proration, fee_head_id, updated_by, updated_at`
+
+func scanTransportFeeSettings(row pgx.Row) (TransportFeeSettings, error) {
+	var s TransportFeeSettings
+	err := row.Scan(&s.TenantID, &s.FareMode, &s.Proration, &s.FeeHeadID, &s.UpdatedBy, &s.UpdatedAt)
+	return s, err
+}
+
+func (q *Queries) GetTransportFeeSettings(ctx context.Context, tenantID pgtype.UUID) (TransportFeeSettings, error) {
+	query := `SELECT ` + transportFeeSettingsColumns + ` FROM transport_fee_settings WHERE tenant_id = $1`
+	return scanTransportFeeSettings(q.db.QueryRow(ctx, query, tenantID))
+}
+
+// UpsertTransportFeeSettings saves the settings. The fee head must belong
+// to the tenant; otherwise no row comes back.
+func (q *Queries) UpsertTransportFeeSettings(ctx context.Context, arg TransportFeeSettings) (TransportFeeSettings, error) {
+	query := `
+		INSERT INTO transport_fee_settings (tenant_id, fare_mode, proration, fee_head_id, updated_by, updated_at)
+		SELECT $1, $2, $3, h.id, $5, NOW()
+		FROM fee_heads h WHERE h.tenant_id = $1 AND h.id = $4
+		ON CONFLICT (tenant_id) DO UPDATE
+		SET fare_mode = EXCLUDED.fare_mode, proration = EXCLUDED.proration, fee_head_id = EXCLUDED.fee_head_id,
+			updated_by = EXCLUDED.updated_by, updated_at = NOW()
+		RETURNING ` + transportFeeSettingsColumns
+	return scanTransportFeeSettings(q.db.QueryRow(ctx, query, arg.TenantID, arg.FareMode, arg.Proration, arg.FeeHeadID, arg.UpdatedBy))
+}
+
+// Fare tables
+
+// TransportFareSlab is a term fare for stops from FromKm up to, but not
+// including, ToKm from the school. A slab without ToKm is open-ended.
+type TransportFareSlab struct {
+	ID           pgtype.UUID   `json:"id"`
+	FromKm       float64       `json:"from_km"`
+	ToKm         pgtype.Float8 `json:"to_km"`
+	OneWayAmount int64         `json:"one_way_amount"`
+	TwoWayAmount int64         `json:"two_way_amount"`
+}
+
+func (q *Queries) ListTransportFareSlabs(ctx context.Context, tenantID pgtype.UUID) ([]TransportFareSlab, error) {
+	rows, err := q.db.Query(ctx, `
+		SELECT id, from_km, to_km, one_way_amount, two_way_amount
+		FROM transport_fare_slabs WHERE tenant_id = $1
+		ORDER BY from_km
+	`, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []TransportFareSlab
+	for rows.Next() {
+		var s TransportFareSlab
+		if err := rows.Scan(&s.ID, &s.FromKm, &s.ToKm, &s.OneWayAmount, &s.TwoWayAmount); err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+func (q *Queries) DeleteTransportFareSlabs(ctx context.Context, tenantID pgtype.UUID) error {
+	_, err := q.db.Exec(ctx, `DELETE FROM transport_fare_slabs WHERE tenant_id = $1`, tenantID)
+	return err
+}
+
+func (q *Queries) CreateTransportFareSlab(ctx context.Context, tenantID pgtype.UUID, s TransportFareSlab) error {
+	_, err := q.db.Exec(ctx, `
+		INSERT INTO transport_fare_slabs (tenant_id, from_km, to_km, one_way_amount, two_way_amount)
+		VALUES ($1, $2, $3, $4, $5)
+	`, tenantID, s.FromKm, s.ToKm, s.OneWayAmount, s.TwoWayAmount)
+	return err
+}
+
+type TransportFareZone struct {
+	ID           pgtype.UUID        `json:"id"`
+	TenantID     pgtype.UUID        `json:"tenant_id"`
+	Name         string             `json:"name"`
+	OneWayAmount int64              `json:"one_way_amount"`
+	TwoWayAmount int64              `json:"two_way_amount"`
+	StopCount    int32              `json:"stop_count"`
+	CreatedAt    pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt    pgtype.Timestamptz `json:"updated_at"`
+}
+
+const transportFareZoneColumns = `
+	z.id, z.tenant_id, z.name, z.one_way_amount, z.two_way_amount,
+	(SELECT COUNT(*) FROM transport_route_stops s WHERE s.zone_id = z.id)::int4,
+	z.created_at, z.updated_at`
+
+func scanTransportFareZone(row pgx.Row) (TransportFareZone, error) {
+	var z TransportFareZone
+	err := row.Scan(&z.ID, &z.TenantID, &z.Name, &z.OneWayAmount, &z.TwoWayAmount, &z.StopCount, &z.CreatedAt, &z.UpdatedAt)
+	return z, err
+}
+
+func (q *Queries) ListTransportFareZones(ctx context.Context, tenantID pgtype.UUID) ([]TransportFareZone, error) {
+	query := `SELECT ` + transportFareZoneColumns + ` FROM transport_fare_zones z WHERE z.tenant_id = $1 ORDER BY z.name`
+	rows, err := q.db.Query(ctx, query, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []TransportFareZone
+	for rows.Next() {
+		z, err := scanTransportFareZone(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, z)
+	}
+	return out, rows.Err()
+}
+
+func (q *Queries) CreateTransportFareZone(ctx context.Context, arg TransportFareZone) (TransportFareZone, error) {
+	query := `
+		WITH z AS (
+			INSERT INTO transport_fare_zones (tenant_id, name, one_way_amount, two_way_amount)
+			VALUES ($1, $2, $3, $4)
+			RETURNING *
+		)
+		SELECT z.id, z.tenant_id, z.name, z.one_way_amount, z.two_way_amount, 0::int4, z.created_at, z.updated_at FROM z`
+	return scanTransportFareZone(q.db.QueryRow(ctx, query, arg.TenantID, arg.Name, arg.OneWayAmount, arg.TwoWayAmount))
+}
+
+func (q *Queries) UpdateTransportFareZone(ctx context.Context, arg TransportFareZone) (TransportFareZone, error) {
+	_, err := q.db.Exec(ctx, `
+		UPDATE transport_fare_zones SET name = $3, one_way_amount = $4, two_way_amount = $5, updated_at = NOW()
+		WHERE tenant_id = $1 AND id = $2
+	`, arg.TenantID, arg.ID, arg.Name, arg.OneWayAmount, arg.TwoWayAmount)
+	if err != nil {
+		return TransportFareZone{}, err
+	}
+	query := `SELECT ` + transportFareZoneColumns + ` FROM transport_fare_zones z WHERE z.tenant_id = $1 AND z.id = $2`
+	return scanTransportFareZone(q.db.QueryRow(ctx, query, arg.TenantID, arg.ID))
+}
+
+// DeleteTransportFareZone removes a zone; its stops are left without one.
+// It returns ErrNoRows when the zone does not exist.
+func (q *Queries) DeleteTransportFareZone(ctx context.Context, tenantID, id pgtype.UUID) error {
+	tag, err := q.db.Exec(ctx, `DELETE FROM transport_fare_zones WHERE tenant_id = $1 AND id = $2`, tenantID, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// SetTransportStopFare sets the zone and distance a stop is charged by. The
+// stop must be on one of the tenant's routes and the zone, if any, one of
+// the tenant's zones; otherwise it returns ErrNoRows.
+func (q *Queries) SetTransportStopFare(ctx context.Context, tenantID, stopID, zoneID pgtype.UUID, distanceKm pgtype.Float8) error {
+	tag, err := q.db.Exec(ctx, `
+		UPDATE transport_route_stops s SET zone_id = $3, distance_km = $4, updated_at = NOW()
+		FROM transport_routes r
+		WHERE s.id = $2 AND r.id = s.route_id AND r.tenant_id = $1
+			AND ($3::uuid IS NULL OR EXISTS (SELECT 1 FROM transport_fare_zones z WHERE z.id = $3 AND z.tenant_id = $1))
+	`, tenantID, stopID, zoneID, distanceKm)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// SetTransportAllocationTripType returns ErrNoRows for an unknown
+// allocation.
+func (q *Queries) SetTransportAllocationTripType(ctx context.Context, tenantID, allocationID pgtype.UUID, tripType string) error {
+	tag, err := q.db.Exec(ctx, `
+		UPDATE transport_allocations SET trip_type = $3, updated_at = NOW()
+		WHERE tenant_id = $1 AND id = $2
+	`, tenantID, allocationID, tripType)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// Terms
+
+type TransportFeeTerm struct {
+	ID               pgtype.UUID        `json:"id"`
+	TenantID         pgtype.UUID        `json:"tenant_id"`
+	AcademicYearID   pgtype.UUID        `json:"academic_year_id"`
+	AcademicYearName string             `json:"academic_year_name"`
+	Name             string             `json:"name"`
+	StartDate        pgtype.Date        `json:"start_date"`
+	EndDate          pgtype.Date        `json:"end_date"`
+	DueDate          pgtype.Date        `json:"due_date"`
+	CreatedAt        pgtype.Timestamptz `json:"created_at"`
+}
+
+const transportFeeTermColumns = `
+	t.id, t.tenant_id, t.academic_year_id, y.name, t.name, t.start_date, t.end_date, t.due_date, t.created_at`
+
+func scanTransportFeeTerm(row pgx.Row) (TransportFeeTerm, error) {
+	var t TransportFeeTerm
+	err := row.Scan(&t.ID, &t.TenantID, &t.AcademicYearID, &t.AcademicYearName, &t.Name, &t.StartDate, &t.EndDate, &t.DueDate, &t.CreatedAt)
+	return t, err
+}
+
+// CreateTransportFeeTerm returns ErrNoRows when the academic year is not
+// the tenant's.
+func (q *Queries) CreateTransportFeeTerm(ctx context.Context, arg TransportFeeTerm) (TransportFeeTerm, error) {
+	var id pgtype.UUID
+	err := q.db.QueryRow(ctx, `
+		INSERT INTO transport_fee_terms (tenant_id, academic_year_id, name, start_date, end_date, due_date)
+		SELECT $1, y.id, $3, $4, $5, $6
+		FROM academic_years y WHERE y.tenant_id = $1 AND y.id = $2
+		RETURNING id
+	`, arg.TenantID, arg.AcademicYearID, arg.Name, arg.StartDate, arg.EndDate, arg.DueDate).Scan(&id)
+	if err != nil {
+		return TransportFeeTerm{}, err
+	}
+	return q.GetTransportFeeTerm(ctx, arg.TenantID, id)
+}
+
+func (q *Queries) GetTransportFeeTerm(ctx context.Context, tenantID, id pgtype.UUID) (TransportFeeTerm, error) {
+	query := `SELECT ` + transportFeeTermColumns + `
+		FROM transport_fee_terms t JOIN academic_years y ON y.id = t.academic_year_id
+		WHERE t.tenant_id = $1 AND t.id = $2`
+	return scanTransportFeeTerm(q.db.QueryRow(ctx, query, tenantID, id))
+}
+
+func (q *Queries) ListTransportFeeTerms(ctx context.Context, tenantID, academicYearID pgtype.UUID) ([]TransportFeeTerm, error) {
+	query := `SELECT ` + transportFeeTermColumns + `
+		FROM transport_fee_terms t JOIN academic_years y ON y.id = t.academic_year_id
+		WHERE t.tenant_id = $1 AND ($2::uuid IS NULL OR t.academic_year_id = $2)
+		ORDER BY t.start_date`
+	rows, err := q.db.Query(ctx, query, tenantID, academicYearID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []TransportFeeTerm
+	for rows.Next() {
+		t, err := scanTransportFeeTerm(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+// Generation
+
+// TransportFeeAllocation is an allocation that overlaps a billing period,
+// with what its fare depends on.
+type TransportFeeAllocation struct {
+	AllocationID    pgtype.UUID
+	StudentID       pgtype.UUID
+	StudentName     string
+	AdmissionNumber string
+	RouteName       string
+	StopID          pgtype.UUID
+	StopName        pgtype.Text
+	ZoneID          pgtype.UUID
+	ZoneName        pgtype.Text
+	DistanceKm      pgtype.Float8
+	Latitude        pgtype.Float8
+	Longitude       pgtype.Float8
+	TripType        string
+	StartDate       pgtype.Date
+	EndDate         pgtype.Date
+}
+
+// ListTransportFeeAllocations returns the allocations that were live at
+// some point between from and to. Students who have since left are
+// included, since they rode for part of the period.
+func (q *Queries) ListTransportFeeAllocations(ctx context.Context, tenantID pgtype.UUID, from, to pgtype.Date) ([]TransportFeeAllocation, error) {
+	rows, err := q.db.Query(ctx, `
+		SELECT a.id, a.student_id, st.full_name, st.admission_number, r.name,
+			s.id, s.name, z.id, z.name, s.distance_km, s.latitude, s.longitude,
+			a.trip_type, a.start_date, a.end_date
+		FROM transport_allocations a
+		JOIN students st ON st.id = a.student_id
+		JOIN transport_routes r ON r.id = a.route_id
+		LEFT JOIN transport_route_stops s ON s.id = a.stop_id
+		LEFT JOIN transport_fare_zones z ON z.id = s.zone_id
+		WHERE a.tenant_id = $1 AND a.status <> 'cancelled'
+			AND a.start_date <= $3 AND (a.end_date IS NULL OR a.end_date >= $2)
+		ORDER BY st.full_name, a.student_id, a.start_date
+	`, tenantID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []TransportFeeAllocation
+	for rows.Next() {
+		var a TransportFeeAllocation
+		if err := rows.Scan(
+			&a.AllocationID, &a.StudentID, &a.StudentName, &a.AdmissionNumber, &a.RouteName,
+			&a.StopID, &a.StopName, &a.ZoneID, &a.ZoneName, &a.DistanceKm, &a.Latitude, &a.Longitude,
+			&a.TripType, &a.StartDate, &a.EndDate,
+		); err != nil {
+			return nil, err
+		}
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
+
+type TransportFeeRun struct {
+	ID             pgtype.UUID        `json:"id"`
+	TenantID       pgtype.UUID        `json:"tenant_id"`
+	TermID         pgtype.UUID        `json:"term_id"`
+	CreatedCount   int32              `json:"created_count"`
+	UpdatedCount   int32              `json:"updated_count"`
+	UnchangedCount int32              `json:"unchanged_count"`
+	CancelledCount int32              `json:"cancelled_count"`
+	SkippedCount   int32              `json:"skipped_count"`
+	Report         json.RawMessage    `json:"report,omitempty"`
+	CreatedBy      pgtype.UUID        `json:"created_by"`
+	CreatedAt      pgtype.Timestamptz `json:"created_at"`
+}
+
+const transportFeeRunColumns = `
+	id, tenant_id, term_id, created_count, updated_count, unchanged_count, cancelled_count, skipped_count,
+	report, created_by, created_at`
+
+func scanTransportFeeRun(row pgx.Row) (TransportFeeRun, error) {
+	var r TransportFeeRun
+	err := row.Scan(
+		&r.ID, &r.TenantID, &r.TermID, &r.CreatedCount, &r.UpdatedCount, &r.UnchangedCount, &r.CancelledCount, &r.SkippedCount,
+		&r.Report, &r.CreatedBy, &r.CreatedAt,
+	)
+	return r, err
+}
+
+func (q *Queries) CreateTransportFeeRun(ctx context.Context, arg TransportFeeRun) (TransportFeeRun, error) {
+	query := `
+		INSERT INTO transport_fee_runs (
+			tenant_id, term_id, created_count, updated_count, unchanged_count, cancelled_count, skipped_count, report, created_by
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING ` + transportFeeRunColumns
+	return scanTransportFeeRun(q.db.QueryRow(ctx, query,
+		arg.TenantID, arg.TermID, arg.CreatedCount, arg.UpdatedCount, arg.UnchangedCount, arg.CancelledCount, arg.SkippedCount,
+		arg.Report, arg.CreatedBy,
+	))
+}
+
+func (q *Queries) GetTransportFeeRun(ctx context.Context, tenantID, id pgtype.UUID) (TransportFeeRun, error) {
+	query := `SELECT ` + transportFeeRunColumns + ` FROM transport_fee_runs WHERE tenant_id = $1 AND id = $2`
+	return scanTransportFeeRun(q.db.QueryRow(ctx, query, tenantID, id))
+}
+
+// ListTransportFeeRuns returns a term's runs without their reports.
+func (q *Queries) ListTransportFeeRuns(ctx context.Context, tenantID, termID pgtype.UUID) ([]TransportFeeRun, error) {
+	rows, err := q.db.Query(ctx, `
+		SELECT id, tenant_id, term_id, created_count, updated_count, unchanged_count, cancelled_count, skipped_count,
+			NULL::jsonb, created_by, created_at
+		FROM transport_fee_runs
+		WHERE tenant_id = $1 AND term_id = $2
+		ORDER BY created_at DESC
+		LIMIT 100
+	`, tenantID, termID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []TransportFeeRun
+	for rows.Next() {
+		r, err := scanTransportFeeRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,621 @@
+package db
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Compliance documents
+
+// TransportComplianceDocument is a vehicle certificate or a driver's licence.
+// IsCurrent marks the latest-expiring document of its kind for its vehicle
+// or driver.
+type TransportComplianceDocument struct {
+	ID                pgtype.UUID        `json:"id"`
+	TenantID          pgtype.UUID        `json:"tenant_id"`
+	VehicleID         pgtype.UUID        `json:"vehicle_id"`
+	DriverID          pgtype.UUID        `json:"driver_id"`
+	SubjectName       string             `json:"subject_name"`
+	DocType           string             `json:"doc_type"`
+	DocumentNumber    pgtype.Text        `json:"document_number"`
+	Issuer            pgtype.Text        `json:"issuer"`
+	IssuedOn          pgtype.Date        `json:"issued_on"`
+	ExpiresOn         pgtype.Date        `json:"expires_on"`
+	ReminderDays      int32              `json:"reminder_days"`
+	LastReminderStage int32              `json:"last_reminder_stage"`
+	Notes             pgtype.Text        `json:"notes"`
+	IsCurrent         bool               `json:"is_current"`
+	CreatedBy         pgtype.UUID        `json:"created_by"`
+	CreatedAt         pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt         pgtype.Timestamptz `json:"updated_at"`
+}
+
+const transportComplianceDocumentColumns = `
+	d.id, d.tenant_id, d.vehicle_id, d.driver_id, COALESCE(v.registration_number, dr.full_name, ''),
+	d.doc_type, d.document_number, d.issuer, d.issued_on, d.expires_on, d.reminder_days,
+	d.last_reminder_stage, d.notes,
+	NOT EXISTS (
+		SELECT 1 FROM transport_compliance_documents n
+		WHERE n.doc_type = d.doc_type AND n.expires_on > d.expires_on
+		  AND (n.vehicle_id = d.vehicle_id OR n.driver_id = d.driver_id)
+	),
+	d.created_by, d.created_at, d.updated_at`
+
+const transportComplianceDocumentFrom = `
+	FROM transport_compliance_documents d
+	LEFT JOIN transport_vehicles v ON v.id = d.vehicle_id
+	LEFT JOIN transport_drivers dr ON dr.id = d.driver_id`
+
+func scanTransportComplianceDocument(row pgx.Row, extra ...any) (TransportComplianceDocument, error) {
+	var d TransportComplianceDocument
+	dest := []any{
+		&d.ID, &d.TenantID, &d.VehicleID, &d.DriverID, &d.SubjectName,
+		&d.DocType, &d.DocumentNumber, &d.Issuer, &d.IssuedOn, &d.ExpiresOn, &d.ReminderDays,
+		&d.LastReminderStage, &d.Notes, &d.IsCurrent,
+		&d.CreatedBy, &d.CreatedAt, &d.UpdatedAt,
+	}
+	err := row.Scan(append(dest, extra...)...)
+	return d, err
+}
+
+func (q *Queries) listTransportComplianceDocuments(ctx context.Context, query string, args ...any) ([]TransportComplianceDocument, error) {
+	rows, err := q.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []TransportComplianceDocument
+	for rows.Next() {
+		d, err := scanTransportComplianceDocument(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+type UpsertTransportComplianceDocumentParams struct {
+	TenantID       pgtype.UUID
+	ID             pgtype.UUID
+	VehicleID      pgtype.UUID
+	DriverID       pgtype.UUID
+	DocType        string
+	DocumentNumber pgtype.Text
+	Issuer         pgtype.Text
+	IssuedOn       pgtype.Date
+	ExpiresOn      pgtype.Date
+	ReminderDays   int32
+	Notes          pgtype.Text
+	CreatedBy      pgtype.UUID
+}
+
+// CreateTransportComplianceDocument records a document for one of the
+// tenant's vehicles or drivers. It returns no rows when the vehicle or
+// driver is not the tenant's.
+func (q *Queries) CreateTransportComplianceDocument(ctx context.Context, arg UpsertTransportComplianceDocumentParams) (TransportComplianceDocument, error) {
+	query := `
+		WITH d AS (
+			INSERT INTO transport_compliance_documents (
+				tenant_id, vehicle_id, driver_id, doc_type, document_number, issuer, issued_on, expires_on,
+				reminder_days, notes, created_by
+			)
+			SELECT $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11
+			WHERE EXISTS (SELECT 1 FROM transport_vehicles WHERE id = $2 AND tenant_id = $1)
+			   OR EXISTS (SELECT 1 FROM transport_drivers WHERE id = $3 AND tenant_id = $1)
+			RETURNING *
+		)
+		SELECT ` + transportComplianceDocumentColumns + `
+		FROM d
+		LEFT JOIN transport_vehicles v ON v.id = d.vehicle_id
+		LEFT JOIN transport_drivers dr ON dr.id = d.driver_id
+	`
+	return scanTransportComplianceDocument(q.db.QueryRow(ctx, query,
+		arg.TenantID, arg.VehicleID, arg.DriverID, arg.DocType, arg.DocumentNumber, arg.Issuer, arg.IssuedOn,
+		arg.ExpiresOn, arg.ReminderDays, arg.Notes, arg.CreatedBy,
+	))
+}
+
+// UpdateTransportComplianceDocument edits a document's details. Moving the
+// expiry date starts its reminders afresh.
+func (q *Queries) UpdateTransportComplianceDocument(ctx context.Context, arg UpsertTransportComplianceDocumentParams) (TransportComplianceDocument, error) {
+	query := `
+		WITH d AS (
+			UPDATE transport_compliance_documents
+			SET document_number = $3, issuer = $4, issued_on = $5, expires_on = $6, reminder_days = $7, notes = $8,
+				last_reminder_stage = CASE WHEN expires_on = $6 THEN last_reminder_stage ELSE 0 END,
+				updated_at = NOW()
+			WHERE tenant_id = $1 AND id = $2
+			RETURNING *
+		)
+		SELECT ` + transportComplianceDocumentColumns + `
+		FROM d
+		LEFT JOIN transport_vehicles v ON v.id = d.vehicle_id
+		LEFT JOIN transport_drivers dr ON dr.id = d.driver_id
+	`
+	return scanTransportComplianceDocument(q.db.QueryRow(ctx, query,
+		arg.TenantID, arg.ID, arg.DocumentNumber, arg.Issuer, arg.IssuedOn, arg.ExpiresOn, arg.ReminderDays, arg.Notes,
+	))
+}
+
+func (q *Queries) DeleteTransportComplianceDocument(ctx context.Context, tenantID, id pgtype.UUID) error {
+	tag, err := q.db.Exec(ctx, `DELETE FROM transport_compliance_documents WHERE tenant_id = $1 AND id = $2`, tenantID, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+type ListTransportComplianceDocumentsParams struct {
+	TenantID  pgtype.UUID
+	VehicleID pgtype.UUID
+	DriverID  pgtype.UUID
+	// ExpiringBy keeps documents expiring on or before the date.
+	ExpiringBy  pgtype.Date
+	CurrentOnly bool
+}
+
+func (q *Queries) ListTransportComplianceDocuments(ctx context.Context, arg ListTransportComplianceDocumentsParams) ([]TransportComplianceDocument, error) {
+	query := `
+		SELECT * FROM (
+			SELECT ` + transportComplianceDocumentColumns + transportComplianceDocumentFrom + `
+			WHERE d.tenant_id = $1
+			  AND ($2::uuid IS NULL OR d.vehicle_id = $2)
+			  AND ($3::uuid IS NULL OR d.driver_id = $3)
+			  AND ($4::date IS NULL OR d.expires_on <= $4)
+		) docs (id, tenant_id, vehicle_id, driver_id, subject_name, doc_type, document_number, issuer, issued_on,
+			expires_on, reminder_days, last_reminder_stage, notes, is_current, created_by, created_at, updated_at)
+		WHERE NOT $5::boolean OR is_current
+		ORDER BY expires_on, subject_name, doc_type
+	`
+	return q.listTransportComplianceDocuments(ctx, query, arg.TenantID, arg.VehicleID, arg.DriverID, arg.ExpiringBy, arg.CurrentOnly)
+}
+
+// TransportDocumentReminder is a current document close to or past expiry,
+// with who to tell.
+type TransportDocumentReminder struct {
+	TransportComplianceDocument
+	DriverUserID pgtype.UUID `json:"driver_user_id"`
+}
+
+// ListDueTransportDocumentReminders returns, across tenants, current
+// documents inside their reminder window whose expiry reminders have not
+// all been sent.
+func (q *Queries) ListDueTransportDocumentReminders(ctx context.Context, maxStage int32, limit int32) ([]TransportDocumentReminder, error) {
+	query := `
+		SELECT ` + transportComplianceDocumentColumns + `, dr.user_id` + transportComplianceDocumentFrom + `
+		WHERE d.expires_on <= CURRENT_DATE + d.reminder_days
+		  AND d.last_reminder_stage < $1
+		  AND NOT EXISTS (
+			SELECT 1 FROM transport_compliance_documents n
+			WHERE n.doc_type = d.doc_type AND n.expires_on > d.expires_on
+			  AND (n.vehicle_id = d.vehicle_id OR n.driver_id = d.driver_id)
+		  )
+		ORDER BY d.expires_on
+		LIMIT $2
+	`
+	rows, err := q.db.Query(ctx, query, maxStage, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []TransportDocumentReminder
+	for rows.Next() {
+		var r TransportDocumentReminder
+		if r.TransportComplianceDocument, err = scanTransportComplianceDocument(rows, &r.DriverUserID); err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// ClaimTransportDocumentReminder moves a document to a reminder stage and
+// reports whether this call was the one to do so.
+func (q *Queries) ClaimTransportDocumentReminder(ctx context.Context, id pgtype.UUID, stage int32) (bool, error) {
+	tag, err := q.db.Exec(ctx, `
+		UPDATE transport_compliance_documents SET last_reminder_stage = $2
+		WHERE id = $1 AND last_reminder_stage < $2
+	`, id, stage)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// Service schedules
+
+// transportVehicleOdometer is the highest reading recorded for the vehicle
+// aliased v, from fuel fills and completed work orders.
+const transportVehicleOdometer = `
+	GREATEST(
+		(SELECT MAX(f.odometer_reading) FROM transport_fuel_logs f WHERE f.vehicle_id = v.id),
+		(SELECT MAX(w.odometer_km) FROM transport_work_orders w WHERE w.vehicle_id = v.id AND w.status = 'completed')
+	)`
+
+// TransportServiceSchedule is a recurring service of a vehicle, with the
+// vehicle's latest odometer reading.
+type TransportServiceSchedule struct {
+	ID                 pgtype.UUID        `json:"id"`
+	TenantID           pgtype.UUID        `json:"tenant_id"`
+	VehicleID          pgtype.UUID        `json:"vehicle_id"`
+	RegistrationNumber string             `json:"registration_number"`
+	Name               string             `json:"name"`
+	IntervalKm         pgtype.Int4        `json:"interval_km"`
+	IntervalDays       pgtype.Int4        `json:"interval_days"`
+	LastServiceKm      pgtype.Int4        `json:"last_service_km"`
+	LastServiceDate    pgtype.Date        `json:"last_service_date"`
+	DueSoonKm          int32              `json:"due_soon_km"`
+	DueSoonDays        int32              `json:"due_soon_days"`
+	LastReminderStage  int32              `json:"last_reminder_stage"`
+	IsActive           bool               `json:"is_active"`
+	OdometerKm         pgtype.Int4        `json:"odometer_km"`
+	CreatedAt          pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt          pgtype.Timestamptz `json:"updated_at"`
+}
+
+const transportServiceScheduleColumns = `
+	s.id, s.tenant_id, s.vehicle_id, v.registration_number, s.name, s.interval_km, s.interval_days,
+	s.last_service_km, s.last_service_date, s.due_soon_km, s.due_soon_days, s.last_reminder_stage,
+	s.is_active, ` + transportVehicleOdometer + `, s.created_at, s.updated_at`
+
+func scanTransportServiceSchedule(row pgx.Row) (TransportServiceSchedule, error) {
+	var s TransportServiceSchedule
+	err := row.Scan(
+		&s.ID, &s.TenantID, &s.VehicleID, &s.RegistrationNumber, &s.Name, &s.IntervalKm, &s.IntervalDays,
+		&s.LastServiceKm, &s.LastServiceDate, &s.DueSoonKm, &s.DueSoonDays, &s.LastReminderStage,
+		&s.IsActive, &s.OdometerKm, &s.CreatedAt, &s.UpdatedAt,
+	)
+	return s, err
+}
+
+func (q *Queries) listTransportServiceSchedules(ctx context.Context, query string, args ...any) ([]TransportServiceSchedule, error) {
+	rows, err := q.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []TransportServiceSchedule
+	for rows.Next() {
+		s, err := scanTransportServiceSchedule(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+type UpsertTransportServiceScheduleParams struct {
+	TenantID        pgtype.UUID
+	ID              pgtype.UUID
+	VehicleID       pgtype.UUID
+	Name            string
+	IntervalKm      pgtype.Int4
+	IntervalDays    pgtype.Int4
+	LastServiceKm   pgtype.Int4
+	LastServiceDate pgtype.Date
+	DueSoonKm       int32
+	DueSoonDays     int32
+	IsActive        bool
+}
+
+// CreateTransportServiceSchedule adds a service schedule to one of the
+// tenant's vehicles. It returns no rows for another tenant's vehicle.
+func (q *Queries) CreateTransportServiceSchedule(ctx context.Context, arg UpsertTransportServiceScheduleParams) (TransportServiceSchedule, error) {
+	query := `
+		WITH s AS (
+			INSERT INTO transport_service_schedules (
+				tenant_id, vehicle_id, name, interval_km, interval_days, last_service_km, last_service_date,
+				due_soon_km, due_soon_days, is_active
+			)
+			SELECT $1, id, $3, $4, $5, $6, $7, $8, $9, $10
+			FROM transport_vehicles WHERE id = $2 AND tenant_id = $1
+			RETURNING *
+		)
+		SELECT ` + transportServiceScheduleColumns + `
+		FROM s
+		JOIN transport_vehicles v ON v.id = s.vehicle_id
+	`
+	return scanTransportServiceSchedule(q.db.QueryRow(ctx, query,
+		arg.TenantID, arg.VehicleID, arg.Name, arg.IntervalKm, arg.IntervalDays, arg.LastServiceKm, arg.LastServiceDate,
+		arg.DueSoonKm, arg.DueSoonDays, arg.IsActive,
+	))
+}
+
+// UpdateTransportServiceSchedule edits a schedule. Reminders start afresh.
+func (q *Queries) UpdateTransportServiceSchedule(ctx context.Context, arg UpsertTransportServiceScheduleParams) (TransportServiceSchedule, error) {
+	query := `
+		WITH s AS (
+			UPDATE transport_service_schedules
+			SET name = $3, interval_km = $4, interval_days = $5, last_service_km = $6, last_service_date = $7,
+				due_soon_km = $8, due_soon_days = $9, is_active = $10, last_reminder_stage = 0, updated_at = NOW()
+			WHERE tenant_id = $1 AND id = $2
+			RETURNING *
+		)
+		SELECT ` + transportServiceScheduleColumns + `
+		FROM s
+		JOIN transport_vehicles v ON v.id = s.vehicle_id
+	`
+	return scanTransportServiceSchedule(q.db.QueryRow(ctx, query,
+		arg.TenantID, arg.ID, arg.Name, arg.IntervalKm, arg.IntervalDays, arg.LastServiceKm, arg.LastServiceDate,
+		arg.DueSoonKm, arg.DueSoonDays, arg.IsActive,
+	))
+}
+
+func (q *Queries) ListTransportServiceSchedules(ctx context.Context, tenantID, vehicleID pgtype.UUID) ([]TransportServiceSchedule, error) {
+	query := `
+		SELECT ` + transportServiceScheduleColumns + `
+		FROM transport_service_schedules s
+		JOIN transport_vehicles v ON v.id = s.vehicle_id
+		WHERE s.tenant_id = $1 AND ($2::uuid IS NULL OR s.vehicle_id = $2)
+		ORDER BY v.registration_number, s.name
+	`
+	return q.listTransportServiceSchedules(ctx, query, tenantID, vehicleID)
+}
+
+// ListActiveTransportServiceSchedules returns active schedules of all
+// tenants whose reminders have not all been sent, for the reminder worker.
+func (q *Queries) ListActiveTransportServiceSchedules(ctx context.Context, maxStage int32) ([]TransportServiceSchedule, error) {
+	query := `
+		SELECT ` + transportServiceScheduleColumns + `
+		FROM transport_service_schedules s
+		JOIN transport_vehicles v ON v.id = s.vehicle_id
+		WHERE s.is_active = TRUE AND v.is_active = TRUE AND s.last_reminder_stage < $1
+		ORDER BY s.tenant_id, v.registration_number
+	`
+	return q.listTransportServiceSchedules(ctx, query, maxStage)
+}
+
+// ClaimTransportServiceReminder moves a schedule to a reminder stage and
+// reports whether this call was the one to do so.
+func (q *Queries) ClaimTransportServiceReminder(ctx context.Context, id pgtype.UUID, stage int32) (bool, error) {
+	tag, err := q.db.Exec(ctx, `
+		UPDATE transport_service_schedules SET last_reminder_stage = $2
+		WHERE id = $1 AND last_reminder_stage < $2
+	`, id, stage)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// Work orders
+
+type TransportWorkOrder struct {
+	ID                 pgtype.UUID        `json:"id"`
+	TenantID           pgtype.UUID        `json:"tenant_id"`
+	VehicleID          pgtype.UUID        `json:"vehicle_id"`
+	RegistrationNumber string             `json:"registration_number"`
+	ScheduleID         pgtype.UUID        `json:"schedule_id"`
+	Title              string             `json:"title"`
+	Description        pgtype.Text        `json:"description"`
+	Vendor             pgtype.Text        `json:"vendor"`
+	Status             string             `json:"status"`
+	OdometerKm         pgtype.Int4        `json:"odometer_km"`
+	LabourCost         float64            `json:"labour_cost"`
+	PartsCost          float64            `json:"parts_cost"`
+	TotalCost          float64            `json:"total_cost"`
+	OpenedOn           pgtype.Date        `json:"opened_on"`
+	CompletedOn        pgtype.Date        `json:"completed_on"`
+	CreatedBy          pgtype.UUID        `json:"created_by"`
+	CompletedBy        pgtype.UUID        `json:"completed_by"`
+	CreatedAt          pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt          pgtype.Timestamptz `json:"updated_at"`
+}
+
+const transportWorkOrderColumns = `
+	w.id, w.tenant_id, w.vehicle_id, v.registration_number, w.schedule_id, w.title, w.description, w.vendor,
+	w.status, w.odometer_km, w.labour_cost::float8, w.parts_cost::float8, (w.labour_cost + w.parts_cost)::float8,
+	w.opened_on, w.completed_on, w.created_by, w.completed_by, w.created_at, w.updated_at`
+
+func scanTransportWorkOrder(row pgx.Row) (TransportWorkOrder, error) {
+	var w TransportWorkOrder
+	err := row.Scan(
+		&w.ID, &w.TenantID, &w.VehicleID, &w.RegistrationNumber, &w.ScheduleID, &w.Title, &w.Description, &w.Vendor,
+		&w.Status, &w.OdometerKm, &w.LabourCost, &w.PartsCost, &w.TotalCost,
+		&w.OpenedOn, &w.CompletedOn, &w.CreatedBy, &w.CompletedBy, &w.CreatedAt, &w.UpdatedAt,
+	)
+	return w, err
+}
+
+type UpsertTransportWorkOrderParams struct {
+	TenantID    pgtype.UUID
+	ID          pgtype.UUID
+	VehicleID   pgtype.UUID
+	ScheduleID  pgtype.UUID
+	Title       string
+	Description pgtype.Text
+	Vendor      pgtype.Text
+	Status      string
+	OdometerKm  pgtype.Int4
+	LabourCost  float64
+	PartsCost   float64
+	OpenedOn    pgtype.Date
+	CompletedOn pgtype.Date
+	UserID      pgtype.UUID
+}
+
+// CreateTransportWorkOrder opens a work order on one of the tenant's
+// vehicles, optionally against one of its service schedules. It returns no
+// rows for another tenant's vehicle or a schedule of another vehicle.
+func (q *Queries) CreateTransportWorkOrder(ctx context.Context, arg UpsertTransportWorkOrderParams) (TransportWorkOrder, error) {
+	query := `
+		WITH w AS (
+			INSERT INTO transport_work_orders (
+				tenant_id, vehicle_id, schedule_id, title, description, vendor, odometer_km,
+				labour_cost, parts_cost, opened_on, created_by
+			)
+			SELECT $1, v.id, $3, $4, $5, $6, $7, $8, $9, COALESCE($10, CURRENT_DATE), $11
+			FROM transport_vehicles v
+			WHERE v.id = $2 AND v.tenant_id = $1
+			  AND ($3::uuid IS NULL OR EXISTS (
+				SELECT 1 FROM transport_service_schedules s WHERE s.id = $3 AND s.vehicle_id = v.id
+			  ))
+			RETURNING *
+		)
+		SELECT ` + transportWorkOrderColumns + `
+		FROM w
+		JOIN transport_vehicles v ON v.id = w.vehicle_id
+	`
+	return scanTransportWorkOrder(q.db.QueryRow(ctx, query,
+		arg.TenantID, arg.VehicleID, arg.ScheduleID, arg.Title, arg.Description, arg.Vendor, arg.OdometerKm,
+		arg.LabourCost, arg.PartsCost, arg.OpenedOn, arg.UserID,
+	))
+}
+
+// UpdateTransportWorkOrder edits a work order that is not closed. Moving it
+// to completed stamps the completion and, for a scheduled service, restarts
+// the schedule from this service.
+func (q *Queries) UpdateTransportWorkOrder(ctx context.Context, arg UpsertTransportWorkOrderParams) (TransportWorkOrder, error) {
+	query := `
+		WITH w AS (
+			UPDATE transport_work_orders
+			SET title = $3, description = $4, vendor = $5, status = $6, odometer_km = $7,
+				labour_cost = $8, parts_cost = $9,
+				completed_on = CASE WHEN $6 = 'completed' THEN COALESCE($10, CURRENT_DATE) END,
+				completed_by = CASE WHEN $6 = 'completed' THEN $11::uuid END,
+				updated_at = NOW()
+			WHERE tenant_id = $1 AND id = $2 AND status IN ('open', 'in_progress')
+			RETURNING *
+		), serviced AS (
+			UPDATE transport_service_schedules s
+			SET last_service_km = COALESCE(w.odometer_km, s.last_service_km),
+				last_service_date = w.completed_on, last_reminder_stage = 0, updated_at = NOW()
+			FROM w
+			WHERE s.id = w.schedule_id AND w.status = 'completed'
+		)
+		SELECT ` + transportWorkOrderColumns + `
+		FROM w
+		JOIN transport_vehicles v ON v.id = w.vehicle_id
+	`
+	return scanTransportWorkOrder(q.db.QueryRow(ctx, query,
+		arg.TenantID, arg.ID, arg.Title, arg.Description, arg.Vendor, arg.Status, arg.OdometerKm,
+		arg.LabourCost, arg.PartsCost, arg.CompletedOn, arg.UserID,
+	))
+}
+
+func (q *Queries) GetTransportWorkOrder(ctx context.Context, tenantID, id pgtype.UUID) (TransportWorkOrder, error) {
+	query := `
+		SELECT ` + transportWorkOrderColumns + `
+		FROM transport_work_orders w
+		JOIN transport_vehicles v ON v.id = w.vehicle_id
+		WHERE w.tenant_id = $1 AND w.id = $2
+	`
+	return scanTransportWorkOrder(q.db.QueryRow(ctx, query, tenantID, id))
+}
+
+func (q *Queries) ListTransportWorkOrders(ctx context.Context, tenantID, vehicleID pgtype.UUID, status string) ([]TransportWorkOrder, error) {
+	query := `
+		SELECT ` + transportWorkOrderColumns + `
+		FROM transport_work_orders w
+		JOIN transport_vehicles v ON v.id = w.vehicle_id
+		WHERE w.tenant_id = $1 AND ($2::uuid IS NULL OR w.vehicle_id = $2) AND ($3 = '' OR w.status = $3)
+		ORDER BY w.opened_on DESC, w.created_at DESC
+		LIMIT 500
+	`
+	rows, err := q.db.Query(ctx, query, tenantID, vehicleID, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []TransportWorkOrder
+	for rows.Next() {
+		w, err := scanTransportWorkOrder(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, w)
+	}
+	return out, rows.Err()
+}
+
+// Fuel and cost analytics
+
+// TransportFuelPoint is a fuel fill with an odometer reading.
+type TransportFuelPoint struct {
+	VehicleID          pgtype.UUID
+	RegistrationNumber string
+	FillDate           pgtype.Date
+	OdometerKm         int32
+	Litres             float64
+	Cost               float64
+}
+
+// ListTransportFuelPoints returns the fills with odometer readings between
+// two days, by vehicle and reading.
+func (q *Queries) ListTransportFuelPoints(ctx context.Context, tenantID, vehicleID pgtype.UUID, from, to pgtype.Date) ([]TransportFuelPoint, error) {
+	const query = `
+		SELECT f.vehicle_id, v.registration_number, f.fill_date, f.odometer_reading, f.quantity::float8, f.total_cost::float8
+		FROM transport_fuel_logs f
+		JOIN transport_vehicles v ON v.id = f.vehicle_id
+		WHERE f.tenant_id = $1 AND ($2::uuid IS NULL OR f.vehicle_id = $2)
+		  AND f.fill_date BETWEEN $3 AND $4 AND f.odometer_reading IS NOT NULL
+		ORDER BY f.vehicle_id, f.odometer_reading, f.fill_date
+	`
+	rows, err := q.db.Query(ctx, query, tenantID, vehicleID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []TransportFuelPoint
+	for rows.Next() {
+		var p TransportFuelPoint
+		if err := rows.Scan(&p.VehicleID, &p.RegistrationNumber, &p.FillDate, &p.OdometerKm, &p.Litres, &p.Cost); err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+// TransportMaintenanceCost is what a vehicle's completed work orders cost
+// between two days.
+type TransportMaintenanceCost struct {
+	VehicleID          pgtype.UUID
+	RegistrationNumber string
+	Cost               float64
+}
+
+func (q *Queries) ListTransportMaintenanceCosts(ctx context.Context, tenantID, vehicleID pgtype.UUID, from, to pgtype.Date) ([]TransportMaintenanceCost, error) {
+	const query = `
+		SELECT w.vehicle_id, v.registration_number, SUM(w.labour_cost + w.parts_cost)::float8
+		FROM transport_work_orders w
+		JOIN transport_vehicles v ON v.id = w.vehicle_id
+		WHERE w.tenant_id = $1 AND ($2::uuid IS NULL OR w.vehicle_id = $2)
+		  AND w.status = 'completed' AND w.completed_on BETWEEN $3 AND $4
+		GROUP BY w.vehicle_id, v.registration_number
+	`
+	rows, err := q.db.Query(ctx, query, tenantID, vehicleID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []TransportMaintenanceCost
+	for rows.Next() {
+		var c TransportMaintenanceCost
+		if err := rows.Scan(&c.VehicleID, &c.RegistrationNumber, &c.Cost); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// GetTransportRouteVehicle returns the vehicle currently assigned to a route.
+func (q *Queries) GetTransportRouteVehicle(ctx context.Context, tenantID, routeID pgtype.UUID) (pgtype.UUID, error) {
+	var id pgtype.UUID
+	err := q.db.QueryRow(ctx, `SELECT vehicle_id FROM transport_routes WHERE tenant_id = $1 AND id = $2`, tenantID, routeID).Scan(&id)
+	return id, err
+}
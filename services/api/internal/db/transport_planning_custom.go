@@ -0,0 +1,398 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Planning settings
+
+type TransportPlanningSettings struct {
+	TenantID        pgtype.UUID        `json:"tenant_id"`
+	SchoolLatitude  pgtype.Float8      `json:"school_latitude"`
+	SchoolLongitude pgtype.Float8      `json:"school_longitude"`
+	ArriveBy        string             `json:"arrive_by"` // HH:MM
+	MaxRideMinutes  int32              `json:"max_ride_minutes"`
+	WalkRadiusM     int32              `json:"walk_radius_m"`
+	SpeedKmph       int32              `json:"speed_kmph"`
+	UpdatedBy       pgtype.UUID        `json:"updated_by"`
+	UpdatedAt       pgtype.Timestamptz `json:"updated_at"`
+}
+
+const transportPlanningSettingsColumns = `
+	tenant_id, school_latitude, school_longitude, to_char(arrive_by, 'HH24:MI'), max_ride_minutes, walk_radius_m, speed_kmph,
+	updated_by, updated_at`
+
+func scanTransportPlanningSettings(row pgx.Row) (TransportPlanningSettings, error) {
+	var s TransportPlanningSettings
+	err := row.Scan(
+		&s.TenantID, &s.SchoolLatitude, &s.SchoolLongitude, &s.ArriveBy, &s.MaxRideMinutes, &s.WalkRadiusM,
+		&s.SpeedKmph, &s.UpdatedBy, &s.UpdatedAt,
+	)
+	return s, err
+}
+
+func (q *Queries) GetTransportPlanningSettings(ctx context.Context, tenantID pgtype.UUID) (TransportPlanningSettings, error) {
+	query := `SELECT ` + transportPlanningSettingsColumns + ` FROM transport_planning_settings WHERE tenant_id = $1`
+	return scanTransportPlanningSettings(q.db.QueryRow(ctx, query, tenantID))
+}
+
+func (q *Queries) UpsertTransportPlanningSettings(ctx context.Context, arg TransportPlanningSettings) (TransportPlanningSettings, error) {
+	query := `
+		INSERT INTO transport_planning_settings (
+			tenant_id, school_latitude, school_longitude, arrive_by, max_ride_minutes, walk_radius_m, speed_kmph, updated_by
+		)
+		VALUES ($1, $2, $3, $4::time, $5, $6, $7, $8)
+		ON CONFLICT (tenant_id) DO UPDATE SET
+			school_latitude = EXCLUDED.school_latitude,
+			school_longitude = EXCLUDED.school_longitude,
+			arrive_by = EXCLUDED.arrive_by,
+			max_ride_minutes = EXCLUDED.max_ride_minutes,
+			walk_radius_m = EXCLUDED.walk_radius_m,
+			speed_kmph = EXCLUDED.speed_kmph,
+			updated_by = EXCLUDED.updated_by,
+			updated_at = NOW()
+		RETURNING ` + transportPlanningSettingsColumns
+	return scanTransportPlanningSettings(q.db.QueryRow(ctx, query,
+		arg.TenantID, arg.SchoolLatitude, arg.SchoolLongitude, arg.ArriveBy, arg.MaxRideMinutes, arg.WalkRadiusM,
+		arg.SpeedKmph, arg.UpdatedBy,
+	))
+}
+
+// Pickup points
+
+// TransportPickupPoint is a student's pickup point with the route and stop
+// of their current allocation, if any.
+type TransportPickupPoint struct {
+	StudentID       pgtype.UUID        `json:"student_id"`
+	StudentName     string             `json:"student_name"`
+	AdmissionNumber string             `json:"admission_number"`
+	Latitude        float64            `json:"latitude"`
+	Longitude       float64            `json:"longitude"`
+	Address         pgtype.Text        `json:"address"`
+	RouteID         pgtype.UUID        `json:"route_id"`
+	RouteName       pgtype.Text        `json:"route_name"`
+	StopID          pgtype.UUID        `json:"stop_id"`
+	UpdatedAt       pgtype.Timestamptz `json:"updated_at"`
+}
+
+type UpsertTransportPickupPointsParams struct {
+	TenantID   pgtype.UUID
+	StudentIDs []pgtype.UUID
+	Latitudes  []float64
+	Longitudes []float64
+	Addresses  []pgtype.Text
+	UpdatedBy  pgtype.UUID
+}
+
+// UpsertTransportPickupPoints saves pickup points in bulk. Points for
+// students of other tenants are ignored; the count saved is returned.
+func (q *Queries) UpsertTransportPickupPoints(ctx context.Context, arg UpsertTransportPickupPointsParams) (int64, error) {
+	const query = `
+		INSERT INTO transport_pickup_points (student_id, tenant_id, latitude, longitude, address, updated_by)
+		SELECT p.student_id, $1, p.latitude, p.longitude, p.address, $6
+		FROM unnest($2::uuid[], $3::float8[], $4::float8[], $5::text[]) AS p (student_id, latitude, longitude, address)
+		JOIN students s ON s.id = p.student_id AND s.tenant_id = $1
+		ON CONFLICT (student_id) DO UPDATE SET
+			latitude = EXCLUDED.latitude,
+			longitude = EXCLUDED.longitude,
+			address = EXCLUDED.address,
+			updated_by = EXCLUDED.updated_by,
+			updated_at = NOW()
+	`
+	tag, err := q.db.Exec(ctx, query, arg.TenantID, arg.StudentIDs, arg.Latitudes, arg.Longitudes, arg.Addresses, arg.UpdatedBy)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+func (q *Queries) DeleteTransportPickupPoint(ctx context.Context, tenantID, studentID pgtype.UUID) error {
+	tag, err := q.db.Exec(ctx, `DELETE FROM transport_pickup_points WHERE tenant_id = $1 AND student_id = $2`, tenantID, studentID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// ListTransportPickupPoints returns the pickup points of active students.
+func (q *Queries) ListTransportPickupPoints(ctx context.Context, tenantID pgtype.UUID) ([]TransportPickupPoint, error) {
+	query := `
+		SELECT p.student_id, s.full_name, s.admission_number, p.latitude, p.longitude, p.address,
+			a.route_id, r.name, a.stop_id, p.updated_at
+		FROM transport_pickup_points p
+		JOIN students s ON s.id = p.student_id
+		LEFT JOIN LATERAL (
+			SELECT a.route_id, a.stop_id FROM transport_allocations a
+			WHERE a.tenant_id = p.tenant_id AND a.student_id = p.student_id AND ` + transportActiveAllocation + `
+			ORDER BY a.start_date DESC
+			LIMIT 1
+		) a ON TRUE
+		LEFT JOIN transport_routes r ON r.id = a.route_id
+		WHERE p.tenant_id = $1 AND COALESCE(s.status, 'active') = 'active'
+		ORDER BY s.full_name
+	`
+	rows, err := q.db.Query(ctx, query, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []TransportPickupPoint
+	for rows.Next() {
+		var p TransportPickupPoint
+		if err := rows.Scan(
+			&p.StudentID, &p.StudentName, &p.AdmissionNumber, &p.Latitude, &p.Longitude, &p.Address,
+			&p.RouteID, &p.RouteName, &p.StopID, &p.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+// Running routes
+
+// TransportPlanningStop is a stop of an active route with a vehicle, with
+// how many students are allocated to it. RouteLoad counts every student
+// allocated to the route.
+type TransportPlanningStop struct {
+	RouteID            pgtype.UUID
+	RouteName          string
+	VehicleID          pgtype.UUID
+	RegistrationNumber string
+	Capacity           int32
+	RouteLoad          int32
+	StopID             pgtype.UUID
+	StopName           pgtype.Text
+	SequenceOrder      pgtype.Int4
+	Latitude           pgtype.Float8
+	Longitude          pgtype.Float8
+	StopLoad           int32
+}
+
+// ListTransportPlanningStops returns the tenant's active routes with a
+// vehicle and their stops in order. A route without stops comes back as a
+// single row with no stop.
+func (q *Queries) ListTransportPlanningStops(ctx context.Context, tenantID pgtype.UUID) ([]TransportPlanningStop, error) {
+	query := `
+		WITH loads AS (
+			SELECT a.route_id, a.stop_id, COUNT(*) AS students
+			FROM transport_allocations a
+			WHERE a.tenant_id = $1 AND ` + transportActiveAllocation + `
+			GROUP BY a.route_id, a.stop_id
+		)
+		SELECT r.id, r.name, v.id, v.registration_number, v.capacity,
+			(SELECT COALESCE(SUM(l.students), 0) FROM loads l WHERE l.route_id = r.id)::int4,
+			s.id, s.name, s.sequence_order, s.latitude, s.longitude,
+			COALESCE((SELECT l.students FROM loads l WHERE l.route_id = r.id AND l.stop_id = s.id), 0)::int4
+		FROM transport_routes r
+		JOIN transport_vehicles v ON v.id = r.vehicle_id
+		LEFT JOIN transport_route_stops s ON s.route_id = r.id
+		WHERE r.tenant_id = $1 AND r.is_active = TRUE
+		ORDER BY r.name, r.id, s.sequence_order
+	`
+	rows, err := q.db.Query(ctx, query, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []TransportPlanningStop
+	for rows.Next() {
+		var s TransportPlanningStop
+		if err := rows.Scan(
+			&s.RouteID, &s.RouteName, &s.VehicleID, &s.RegistrationNumber, &s.Capacity, &s.RouteLoad,
+			&s.StopID, &s.StopName, &s.SequenceOrder, &s.Latitude, &s.Longitude, &s.StopLoad,
+		); err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+// ListUnstoppedTransportStudents returns students with an active allocation
+// but no stop, the ones a rebalance places by default.
+func (q *Queries) ListUnstoppedTransportStudents(ctx context.Context, tenantID pgtype.UUID) ([]pgtype.UUID, error) {
+	query := `
+		SELECT DISTINCT a.student_id FROM transport_allocations a
+		WHERE a.tenant_id = $1 AND a.stop_id IS NULL AND ` + transportActiveAllocation
+	return q.listUUIDs(ctx, query, tenantID)
+}
+
+// Plans
+
+type TransportRoutePlan struct {
+	ID             pgtype.UUID        `json:"id"`
+	TenantID       pgtype.UUID        `json:"tenant_id"`
+	Kind           string             `json:"kind"`
+	Status         string             `json:"status"`
+	Options        json.RawMessage    `json:"options"`
+	Result         json.RawMessage    `json:"result,omitempty"`
+	StudentCount   int32              `json:"student_count"`
+	RouteCount     int32              `json:"route_count"`
+	UnplannedCount int32              `json:"unplanned_count"`
+	CreatedBy      pgtype.UUID        `json:"created_by"`
+	CreatedAt      pgtype.Timestamptz `json:"created_at"`
+	EffectiveDate  pgtype.Date        `json:"effective_date"`
+	AppliedBy      pgtype.UUID        `json:"applied_by"`
+	AppliedAt      pgtype.Timestamptz `json:"applied_at"`
+}
+
+const transportRoutePlanColumns = `
+	id, tenant_id, kind, status, options, result, student_count, route_count, unplanned_count,
+	created_by, created_at, effective_date, applied_by, applied_at`
+
+func scanTransportRoutePlan(row pgx.Row) (TransportRoutePlan, error) {
+	var p TransportRoutePlan
+	err := row.Scan(
+		&p.ID, &p.TenantID, &p.Kind, &p.Status, &p.Options, &p.Result, &p.StudentCount, &p.RouteCount, &p.UnplannedCount,
+		&p.CreatedBy, &p.CreatedAt, &p.EffectiveDate, &p.AppliedBy, &p.AppliedAt,
+	)
+	return p, err
+}
+
+type CreateTransportRoutePlanParams struct {
+	TenantID       pgtype.UUID
+	Kind           string
+	Options        []byte
+	Result         []byte
+	StudentCount   int32
+	RouteCount     int32
+	UnplannedCount int32
+	CreatedBy      pgtype.UUID
+}
+
+func (q *Queries) CreateTransportRoutePlan(ctx context.Context, arg CreateTransportRoutePlanParams) (TransportRoutePlan, error) {
+	query := `
+		INSERT INTO transport_route_plans (
+			tenant_id, kind, options, result, student_count, route_count, unplanned_count, created_by
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING ` + transportRoutePlanColumns
+	return scanTransportRoutePlan(q.db.QueryRow(ctx, query,
+		arg.TenantID, arg.Kind, arg.Options, arg.Result, arg.StudentCount, arg.RouteCount, arg.UnplannedCount, arg.CreatedBy,
+	))
+}
+
+func (q *Queries) GetTransportRoutePlan(ctx context.Context, tenantID, id pgtype.UUID) (TransportRoutePlan, error) {
+	query := `SELECT ` + transportRoutePlanColumns + ` FROM transport_route_plans WHERE tenant_id = $1 AND id = $2`
+	return scanTransportRoutePlan(q.db.QueryRow(ctx, query, tenantID, id))
+}
+
+// ListTransportRoutePlans returns recent plans without their results.
+func (q *Queries) ListTransportRoutePlans(ctx context.Context, tenantID pgtype.UUID) ([]TransportRoutePlan, error) {
+	const query = `
+		SELECT id, tenant_id, kind, status, options, NULL::jsonb, student_count, route_count, unplanned_count,
+			created_by, created_at, effective_date, applied_by, applied_at
+		FROM transport_route_plans
+		WHERE tenant_id = $1
+		ORDER BY created_at DESC
+		LIMIT 100
+	`
+	rows, err := q.db.Query(ctx, query, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []TransportRoutePlan
+	for rows.Next() {
+		p, err := scanTransportRoutePlan(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+// CloseTransportRoutePlan moves a draft to applied or discarded. It returns
+// no rows when the plan is not a draft.
+func (q *Queries) CloseTransportRoutePlan(ctx context.Context, tenantID, id pgtype.UUID, status string, effective pgtype.Date, userID pgtype.UUID) (TransportRoutePlan, error) {
+	query := `
+		UPDATE transport_route_plans
+		SET status = $3,
+			effective_date = CASE WHEN $3 = 'applied' THEN $4::date END,
+			applied_by = CASE WHEN $3 = 'applied' THEN $5::uuid END,
+			applied_at = CASE WHEN $3 = 'applied' THEN NOW() END
+		WHERE tenant_id = $1 AND id = $2 AND status = 'draft'
+		RETURNING ` + transportRoutePlanColumns
+	return scanTransportRoutePlan(q.db.QueryRow(ctx, query, tenantID, id, status, effective, userID))
+}
+
+// Applying plans
+
+// DeactivateTransportRoutesForVehicles retires the active routes run by any
+// of the vehicles.
+func (q *Queries) DeactivateTransportRoutesForVehicles(ctx context.Context, tenantID pgtype.UUID, vehicleIDs []pgtype.UUID) (int64, error) {
+	tag, err := q.db.Exec(ctx, `
+		UPDATE transport_routes SET is_active = FALSE, updated_at = NOW()
+		WHERE tenant_id = $1 AND vehicle_id = ANY($2::uuid[]) AND is_active = TRUE
+	`, tenantID, vehicleIDs)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+type CreateTransportPlannedStopParams struct {
+	RouteID       pgtype.UUID
+	Name          string
+	SequenceOrder int32
+	ArrivalTime   pgtype.Time
+	Latitude      float64
+	Longitude     float64
+}
+
+func (q *Queries) CreateTransportPlannedStop(ctx context.Context, arg CreateTransportPlannedStopParams) (pgtype.UUID, error) {
+	var id pgtype.UUID
+	err := q.db.QueryRow(ctx, `
+		INSERT INTO transport_route_stops (route_id, name, sequence_order, arrival_time, latitude, longitude)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id
+	`, arg.RouteID, arg.Name, arg.SequenceOrder, arg.ArrivalTime, arg.Latitude, arg.Longitude).Scan(&id)
+	return id, err
+}
+
+func (q *Queries) SetTransportStopSequence(ctx context.Context, routeID, stopID pgtype.UUID, sequence int32) error {
+	_, err := q.db.Exec(ctx, `
+		UPDATE transport_route_stops SET sequence_order = $3, updated_at = NOW()
+		WHERE route_id = $1 AND id = $2
+	`, routeID, stopID, sequence)
+	return err
+}
+
+// MoveTransportAllocationToStop points a student's active allocation on the
+// route at a stop. It reports false when the student has none on the route.
+func (q *Queries) MoveTransportAllocationToStop(ctx context.Context, tenantID, studentID, routeID, stopID pgtype.UUID) (bool, error) {
+	tag, err := q.db.Exec(ctx, `
+		UPDATE transport_allocations a SET stop_id = $4, updated_at = NOW()
+		WHERE a.tenant_id = $1 AND a.student_id = $2 AND a.route_id = $3 AND `+transportActiveAllocation,
+		tenantID, studentID, routeID, stopID)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// EndTransportAllocations ends a student's allocations running on or after
+// the effective date. One that would only have started then is cancelled.
+func (q *Queries) EndTransportAllocations(ctx context.Context, tenantID, studentID pgtype.UUID, effective pgtype.Date) error {
+	_, err := q.db.Exec(ctx, `
+		UPDATE transport_allocations
+		SET status = CASE WHEN start_date >= $3 THEN 'cancelled' ELSE status END,
+			end_date = CASE WHEN start_date >= $3 THEN end_date ELSE $3::date - 1 END,
+			updated_at = NOW()
+		WHERE tenant_id = $1 AND student_id = $2 AND status = 'active' AND (end_date IS NULL OR end_date >= $3)
+	`, tenantID, studentID, effective)
+	return err
+}
@@ -0,0 +1,974 @@
+package db
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type TransportTrackingSettings struct {
+	TenantID             pgtype.UUID        `json:"tenant_id"`
+	SpeedLimitKmph       int32              `json:"speed_limit_kmph"`
+	DeviationThresholdM  int32              `json:"deviation_threshold_m"`
+	StopRadiusM          int32              `json:"stop_radius_m"`
+	ArrivalNoticeMinutes int32              `json:"arrival_notice_minutes"`
+	DefaultSpeedKmph     int32              `json:"default_speed_kmph"`
+	AlertCooldownMinutes int32              `json:"alert_cooldown_minutes"`
+	UpdatedBy            pgtype.UUID        `json:"updated_by"`
+	UpdatedAt            pgtype.Timestamptz `json:"updated_at"`
+}
+
+const transportTrackingSettingsColumns = `
+	tenant_id, speed_limit_kmph, deviation_threshold_m, stop_radius_m, arrival_notice_minutes,
+	default_speed_kmph, alert_cooldown_minutes, updated_by, updated_at`
+
+func scanTransportTrackingSettings(row pgx.Row) (TransportTrackingSettings, error) {
+	var s TransportTrackingSettings
+	err := row.Scan(
+		&s.TenantID, &s.SpeedLimitKmph, &s.DeviationThresholdM, &s.StopRadiusM, &s.ArrivalNoticeMinutes,
+		&s.DefaultSpeedKmph, &s.AlertCooldownMinutes, &s.UpdatedBy, &s.UpdatedAt,
+	)
+	return s, err
+}
+
+func (q *Queries) GetTransportTrackingSettings(ctx context.Context, tenantID pgtype.UUID) (TransportTrackingSettings, error) {
+	query := `SELECT ` + transportTrackingSettingsColumns + ` FROM transport_tracking_settings WHERE tenant_id = $1`
+	return scanTransportTrackingSettings(q.db.QueryRow(ctx, query, tenantID))
+}
+
+func (q *Queries) UpsertTransportTrackingSettings(ctx context.Context, arg TransportTrackingSettings) (TransportTrackingSettings, error) {
+	query := `
+		INSERT INTO transport_tracking_settings (
+			tenant_id, speed_limit_kmph, deviation_threshold_m, stop_radius_m, arrival_notice_minutes,
+			default_speed_kmph, alert_cooldown_minutes, updated_by
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (tenant_id) DO UPDATE SET
+			speed_limit_kmph = EXCLUDED.speed_limit_kmph,
+			deviation_threshold_m = EXCLUDED.deviation_threshold_m,
+			stop_radius_m = EXCLUDED.stop_radius_m,
+			arrival_notice_minutes = EXCLUDED.arrival_notice_minutes,
+			default_speed_kmph = EXCLUDED.default_speed_kmph,
+			alert_cooldown_minutes = EXCLUDED.alert_cooldown_minutes,
+			updated_by = EXCLUDED.updated_by,
+			updated_at = NOW()
+		RETURNING ` + transportTrackingSettingsColumns
+	return scanTransportTrackingSettings(q.db.QueryRow(ctx, query,
+		arg.TenantID, arg.SpeedLimitKmph, arg.DeviationThresholdM, arg.StopRadiusM, arg.ArrivalNoticeMinutes,
+		arg.DefaultSpeedKmph, arg.AlertCooldownMinutes, arg.UpdatedBy,
+	))
+}
+
+// TransportTrip is a run of a route on a day, with its route and vehicle for
+// display.
+type TransportTrip struct {
+	ID                   pgtype.UUID        `json:"id"`
+	TenantID             pgtype.UUID        `json:"tenant_id"`
+	RouteID              pgtype.UUID        `json:"route_id"`
+	RouteName            string             `json:"route_name"`
+	VehicleID            pgtype.UUID        `json:"vehicle_id"`
+	RegistrationNumber   string             `json:"registration_number"`
+	DriverID             pgtype.UUID        `json:"driver_id"`
+	TripDate             pgtype.Date        `json:"trip_date"`
+	Direction            string             `json:"direction"`
+	Status               string             `json:"status"`
+	StartedAt            pgtype.Timestamptz `json:"started_at"`
+	EndedAt              pgtype.Timestamptz `json:"ended_at"`
+	LastLatitude         pgtype.Float8      `json:"last_latitude"`
+	LastLongitude        pgtype.Float8      `json:"last_longitude"`
+	LastSpeedKmph        pgtype.Float8      `json:"last_speed_kmph"`
+	LastHeading          pgtype.Float8      `json:"last_heading"`
+	LastPingAt           pgtype.Timestamptz `json:"last_ping_at"`
+	AttendantID          pgtype.UUID        `json:"attendant_id"`
+	DriverCheckedInAt    pgtype.Timestamptz `json:"driver_checked_in_at"`
+	AttendantCheckedInAt pgtype.Timestamptz `json:"attendant_checked_in_at"`
+	StartedBy            pgtype.UUID        `json:"started_by"`
+	CreatedAt            pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt            pgtype.Timestamptz `json:"updated_at"`
+}
+
+const transportTripColumns = `
+	t.id, t.tenant_id, t.route_id, r.name, t.vehicle_id, v.registration_number, t.driver_id,
+	t.trip_date, t.direction, t.status, t.started_at, t.ended_at, t.last_latitude, t.last_longitude,
+	t.last_speed_kmph, t.last_heading, t.last_ping_at, t.attendant_id, t.driver_checked_in_at,
+	t.attendant_checked_in_at, t.started_by, t.created_at, t.updated_at`
+
+const transportTripFrom = `
+	FROM transport_trips t
+	JOIN transport_routes r ON r.id = t.route_id
+	JOIN transport_vehicles v ON v.id = t.vehicle_id`
+
+func scanTransportTrip(row pgx.Row) (TransportTrip, error) {
+	var t TransportTrip
+	err := row.Scan(
+		&t.ID, &t.TenantID, &t.RouteID, &t.RouteName, &t.VehicleID, &t.RegistrationNumber, &t.DriverID,
+		&t.TripDate, &t.Direction, &t.Status, &t.StartedAt, &t.EndedAt, &t.LastLatitude, &t.LastLongitude,
+		&t.LastSpeedKmph, &t.LastHeading, &t.LastPingAt, &t.AttendantID, &t.DriverCheckedInAt,
+		&t.AttendantCheckedInAt, &t.StartedBy, &t.CreatedAt, &t.UpdatedAt,
+	)
+	return t, err
+}
+
+func (q *Queries) listTransportTrips(ctx context.Context, query string, args ...any) ([]TransportTrip, error) {
+	rows, err := q.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []TransportTrip
+	for rows.Next() {
+		t, err := scanTransportTrip(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+// StartTransportTrip starts today's trip on a route in a direction with the
+// route's current vehicle and driver, taking over the scheduled trip when
+// there is one, and lays out the stops in visiting order. It returns no rows
+// when the route does not exist or has no vehicle.
+func (q *Queries) StartTransportTrip(ctx context.Context, tenantID, routeID pgtype.UUID, direction string, startedBy pgtype.UUID) (TransportTrip, error) {
+	query := `
+		WITH route AS (
+			SELECT id, vehicle_id, driver_id
+			FROM transport_routes
+			WHERE tenant_id = $1 AND id = $2 AND is_active = TRUE AND vehicle_id IS NOT NULL
+		), scheduled AS (
+			UPDATE transport_trips st
+			SET status = 'in_progress', started_at = NOW(), started_by = $4,
+				vehicle_id = route.vehicle_id, driver_id = route.driver_id, updated_at = NOW()
+			FROM route
+			WHERE st.route_id = route.id AND st.trip_date = CURRENT_DATE AND st.direction = $3
+			  AND st.status = 'scheduled'
+			RETURNING st.*
+		), created AS (
+			INSERT INTO transport_trips (tenant_id, route_id, vehicle_id, driver_id, direction, started_at, started_by)
+			SELECT $1, route.id, route.vehicle_id, route.driver_id, $3, NOW(), $4 FROM route
+			WHERE NOT EXISTS (SELECT 1 FROM scheduled)
+			RETURNING *
+		), t AS (
+			SELECT * FROM scheduled
+			UNION ALL
+			SELECT * FROM created
+		), stops AS (
+			INSERT INTO transport_trip_stops (trip_id, stop_id, visit_order)
+			SELECT t.id, s.id,
+				ROW_NUMBER() OVER (ORDER BY CASE WHEN $3 = 'drop' THEN -s.sequence_order ELSE s.sequence_order END)
+			FROM t
+			JOIN transport_route_stops s ON s.route_id = t.route_id
+		)
+		SELECT ` + transportTripColumns + `
+		FROM t
+		JOIN transport_routes r ON r.id = t.route_id
+		JOIN transport_vehicles v ON v.id = t.vehicle_id
+	`
+	return scanTransportTrip(q.db.QueryRow(ctx, query, tenantID, routeID, direction, startedBy))
+}
+
+func (q *Queries) GetTransportTrip(ctx context.Context, tenantID, id pgtype.UUID) (TransportTrip, error) {
+	query := `SELECT ` + transportTripColumns + transportTripFrom + ` WHERE t.tenant_id = $1 AND t.id = $2`
+	return scanTransportTrip(q.db.QueryRow(ctx, query, tenantID, id))
+}
+
+func (q *Queries) GetActiveTransportTripForVehicle(ctx context.Context, tenantID, vehicleID pgtype.UUID) (TransportTrip, error) {
+	query := `SELECT ` + transportTripColumns + transportTripFrom + `
+		WHERE t.tenant_id = $1 AND t.vehicle_id = $2 AND t.status = 'in_progress'`
+	return scanTransportTrip(q.db.QueryRow(ctx, query, tenantID, vehicleID))
+}
+
+type ListTransportTripsParams struct {
+	TenantID pgtype.UUID
+	RouteID  pgtype.UUID
+	Status   string
+	TripDate pgtype.Date
+	Limit    int32
+}
+
+func (q *Queries) ListTransportTrips(ctx context.Context, arg ListTransportTripsParams) ([]TransportTrip, error) {
+	query := `SELECT ` + transportTripColumns + transportTripFrom + `
+		WHERE t.tenant_id = $1
+		  AND ($2::uuid IS NULL OR t.route_id = $2)
+		  AND ($3 = '' OR t.status = $3)
+		  AND ($4::date IS NULL OR t.trip_date = $4)
+		ORDER BY t.trip_date DESC, t.started_at DESC NULLS LAST, r.name, t.direction DESC
+		LIMIT $5`
+	return q.listTransportTrips(ctx, query, arg.TenantID, arg.RouteID, arg.Status, arg.TripDate, arg.Limit)
+}
+
+// ScheduleTransportTrips creates a pickup and a drop trip on a day for every
+// active route with a vehicle, skipping those that already have one. It
+// returns the number of trips created.
+func (q *Queries) ScheduleTransportTrips(ctx context.Context, tenantID pgtype.UUID, tripDate pgtype.Date) (int64, error) {
+	const query = `
+		INSERT INTO transport_trips (tenant_id, route_id, vehicle_id, driver_id, trip_date, direction, status)
+		SELECT r.tenant_id, r.id, r.vehicle_id, r.driver_id, $2, d.direction, 'scheduled'
+		FROM transport_routes r
+		CROSS JOIN (VALUES ('pickup'), ('drop')) AS d(direction)
+		WHERE r.tenant_id = $1 AND r.is_active = TRUE AND r.vehicle_id IS NOT NULL
+		  AND NOT EXISTS (
+			SELECT 1 FROM transport_trips t
+			WHERE t.route_id = r.id AND t.trip_date = $2 AND t.direction = d.direction AND t.status <> 'cancelled'
+		  )
+		ON CONFLICT DO NOTHING
+	`
+	tag, err := q.db.Exec(ctx, query, tenantID, tripDate)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// EndTransportTrip completes or cancels a trip that is still running. A
+// scheduled trip can only be cancelled.
+func (q *Queries) EndTransportTrip(ctx context.Context, tenantID, id pgtype.UUID, status string) (TransportTrip, error) {
+	query := `
+		WITH t AS (
+			UPDATE transport_trips
+			SET status = $3, ended_at = NOW(), updated_at = NOW()
+			WHERE tenant_id = $1 AND id = $2
+			  AND (status = 'in_progress' OR (status = 'scheduled' AND $3 = 'cancelled'))
+			RETURNING *
+		)
+		SELECT ` + transportTripColumns + `
+		FROM t
+		JOIN transport_routes r ON r.id = t.route_id
+		JOIN transport_vehicles v ON v.id = t.vehicle_id
+	`
+	return scanTransportTrip(q.db.QueryRow(ctx, query, tenantID, id, status))
+}
+
+// CheckInTransportTripDriver records when the driver reported for a trip
+// that has not ended. A repeat check-in keeps the first time.
+func (q *Queries) CheckInTransportTripDriver(ctx context.Context, tenantID, id pgtype.UUID) (TransportTrip, error) {
+	query := `
+		WITH t AS (
+			UPDATE transport_trips
+			SET driver_checked_in_at = COALESCE(driver_checked_in_at, NOW()), updated_at = NOW()
+			WHERE tenant_id = $1 AND id = $2 AND status IN ('scheduled', 'in_progress')
+			RETURNING *
+		)
+		SELECT ` + transportTripColumns + `
+		FROM t
+		JOIN transport_routes r ON r.id = t.route_id
+		JOIN transport_vehicles v ON v.id = t.vehicle_id
+	`
+	return scanTransportTrip(q.db.QueryRow(ctx, query, tenantID, id))
+}
+
+// CheckInTransportTripAttendant records the attendant riding a trip that has
+// not ended. Checking in a different attendant replaces the first.
+func (q *Queries) CheckInTransportTripAttendant(ctx context.Context, tenantID, id, employeeID pgtype.UUID) (TransportTrip, error) {
+	query := `
+		WITH t AS (
+			UPDATE transport_trips tr
+			SET attendant_id = e.id,
+				attendant_checked_in_at = CASE WHEN tr.attendant_id = e.id THEN tr.attendant_checked_in_at ELSE NOW() END,
+				updated_at = NOW()
+			FROM employees e
+			WHERE tr.tenant_id = $1 AND tr.id = $2 AND tr.status IN ('scheduled', 'in_progress')
+			  AND e.tenant_id = $1 AND e.id = $3 AND e.status = 'active'
+			RETURNING tr.*
+		)
+		SELECT ` + transportTripColumns + `
+		FROM t
+		JOIN transport_routes r ON r.id = t.route_id
+		JOIN transport_vehicles v ON v.id = t.vehicle_id
+	`
+	return scanTransportTrip(q.db.QueryRow(ctx, query, tenantID, id, employeeID))
+}
+
+// GetActiveEmployeeIDForUser returns the employee record of a staff user.
+func (q *Queries) GetActiveEmployeeIDForUser(ctx context.Context, tenantID, userID pgtype.UUID) (pgtype.UUID, error) {
+	const query = `SELECT id FROM employees WHERE tenant_id = $1 AND user_id = $2 AND status = 'active' LIMIT 1`
+	var id pgtype.UUID
+	err := q.db.QueryRow(ctx, query, tenantID, userID).Scan(&id)
+	return id, err
+}
+
+// GetActiveTransportTripForReader returns the running trip of the vehicle an
+// RFID reader is fitted to. No rows means the device is not a bus reader or
+// its bus is not on a trip; the reader's vehicle id is returned in both cases
+// when the device is registered.
+func (q *Queries) GetActiveTransportTripForReader(ctx context.Context, tenantID pgtype.UUID, deviceID string) (pgtype.UUID, TransportTrip, error) {
+	var vehicleID pgtype.UUID
+	err := q.db.QueryRow(ctx,
+		`SELECT id FROM transport_vehicles WHERE tenant_id = $1 AND rfid_reader_id = $2`,
+		tenantID, deviceID,
+	).Scan(&vehicleID)
+	if err != nil {
+		return vehicleID, TransportTrip{}, err
+	}
+	trip, err := q.GetActiveTransportTripForVehicle(ctx, tenantID, vehicleID)
+	return vehicleID, trip, err
+}
+
+// SetTransportVehicleReader ties an RFID reader to a vehicle, or unties it
+// when deviceID is empty.
+func (q *Queries) SetTransportVehicleReader(ctx context.Context, tenantID, vehicleID pgtype.UUID, deviceID string) error {
+	const query = `
+		UPDATE transport_vehicles SET rfid_reader_id = NULLIF($3, ''), updated_at = NOW()
+		WHERE tenant_id = $1 AND id = $2
+	`
+	tag, err := q.db.Exec(ctx, query, tenantID, vehicleID, deviceID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// ResolveTransportStudent finds an active student by the RFID tag on their
+// card or by the admission number or id encoded in its QR code.
+func (q *Queries) ResolveTransportStudent(ctx context.Context, tenantID pgtype.UUID, method, identifier string) (pgtype.UUID, error) {
+	const query = `
+		SELECT id FROM students
+		WHERE tenant_id = $1 AND status = 'active'
+		  AND CASE WHEN $2 = 'rfid' THEN rfid_tag = $3
+			ELSE admission_number = $3 OR id::text = LOWER($3) END
+		LIMIT 1
+	`
+	var id pgtype.UUID
+	err := q.db.QueryRow(ctx, query, tenantID, method, identifier).Scan(&id)
+	return id, err
+}
+
+type UpdateTransportTripPositionParams struct {
+	ID        pgtype.UUID
+	Latitude  float64
+	Longitude float64
+	SpeedKmph pgtype.Float8
+	Heading   pgtype.Float8
+	At        pgtype.Timestamptz
+}
+
+// UpdateTransportTripPosition moves a running trip to a newer position. It
+// reports false for a ping older than the one already applied.
+func (q *Queries) UpdateTransportTripPosition(ctx context.Context, arg UpdateTransportTripPositionParams) (bool, error) {
+	const query = `
+		UPDATE transport_trips
+		SET last_latitude = $2, last_longitude = $3, last_speed_kmph = $4, last_heading = $5,
+			last_ping_at = $6, updated_at = NOW()
+		WHERE id = $1 AND status = 'in_progress' AND (last_ping_at IS NULL OR last_ping_at < $6)
+	`
+	tag, err := q.db.Exec(ctx, query, arg.ID, arg.Latitude, arg.Longitude, arg.SpeedKmph, arg.Heading, arg.At)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// ResolveTransportVehicle finds a vehicle by id or registration number, the
+// identifier AIS-140 devices are provisioned with.
+func (q *Queries) ResolveTransportVehicle(ctx context.Context, tenantID, vehicleID pgtype.UUID, registrationNumber string) (pgtype.UUID, error) {
+	const query = `
+		SELECT id FROM transport_vehicles
+		WHERE tenant_id = $1
+		  AND (($2::uuid IS NOT NULL AND id = $2) OR ($2::uuid IS NULL AND UPPER(registration_number) = UPPER($3)))
+	`
+	var id pgtype.UUID
+	err := q.db.QueryRow(ctx, query, tenantID, vehicleID, registrationNumber).Scan(&id)
+	return id, err
+}
+
+type TransportGPSPing struct {
+	RecordedAt pgtype.Timestamptz `json:"recorded_at"`
+	Latitude   float64            `json:"latitude"`
+	Longitude  float64            `json:"longitude"`
+	SpeedKmph  pgtype.Float8      `json:"speed_kmph"`
+	Heading    pgtype.Float8      `json:"heading"`
+	AccuracyM  pgtype.Float8      `json:"accuracy_m"`
+}
+
+// InsertTransportGPSPings stores a batch of pings for a vehicle.
+func (q *Queries) InsertTransportGPSPings(ctx context.Context, tenantID, vehicleID, tripID pgtype.UUID, source string, pings []TransportGPSPing) error {
+	recordedAt := make([]pgtype.Timestamptz, len(pings))
+	lat := make([]float64, len(pings))
+	lng := make([]float64, len(pings))
+	speed := make([]pgtype.Float8, len(pings))
+	heading := make([]pgtype.Float8, len(pings))
+	accuracy := make([]pgtype.Float8, len(pings))
+	for i, p := range pings {
+		recordedAt[i], lat[i], lng[i] = p.RecordedAt, p.Latitude, p.Longitude
+		speed[i], heading[i], accuracy[i] = p.SpeedKmph, p.Heading, p.AccuracyM
+	}
+	const query = `
+		INSERT INTO transport_gps_pings (
+			tenant_id, vehicle_id, trip_id, source, recorded_at, latitude, longitude, speed_kmph, heading, accuracy_m
+		)
+		SELECT $1, $2, $3, $4, p.recorded_at, p.latitude, p.longitude, p.speed_kmph, p.heading, p.accuracy_m
+		FROM UNNEST($5::timestamptz[], $6::float8[], $7::float8[], $8::float8[], $9::float8[], $10::float8[])
+			AS p(recorded_at, latitude, longitude, speed_kmph, heading, accuracy_m)
+	`
+	_, err := q.db.Exec(ctx, query, tenantID, vehicleID, tripID, source, recordedAt, lat, lng, speed, heading, accuracy)
+	return err
+}
+
+// ListTransportTripPings returns a trip's pings in the order they were recorded.
+func (q *Queries) ListTransportTripPings(ctx context.Context, tripID pgtype.UUID, limit int32) ([]TransportGPSPing, error) {
+	const query = `
+		SELECT recorded_at, latitude, longitude, speed_kmph, heading, accuracy_m
+		FROM transport_gps_pings
+		WHERE trip_id = $1
+		ORDER BY recorded_at
+		LIMIT $2
+	`
+	rows, err := q.db.Query(ctx, query, tripID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []TransportGPSPing
+	for rows.Next() {
+		var p TransportGPSPing
+		if err := rows.Scan(&p.RecordedAt, &p.Latitude, &p.Longitude, &p.SpeedKmph, &p.Heading, &p.AccuracyM); err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+// AverageTransportTripSpeed is the mean reported speed of a trip since a
+// point in time, ignoring pings taken while standing.
+func (q *Queries) AverageTransportTripSpeed(ctx context.Context, tripID pgtype.UUID, since pgtype.Timestamptz) (pgtype.Float8, error) {
+	const query = `
+		SELECT AVG(speed_kmph)
+		FROM transport_gps_pings
+		WHERE trip_id = $1 AND recorded_at >= $2 AND speed_kmph >= 5
+	`
+	var avg pgtype.Float8
+	err := q.db.QueryRow(ctx, query, tripID, since).Scan(&avg)
+	return avg, err
+}
+
+// TransportTripStop is a stop of a trip and how far the trip has got to it.
+type TransportTripStop struct {
+	StopID            pgtype.UUID        `json:"stop_id"`
+	Name              string             `json:"name"`
+	VisitOrder        int32              `json:"visit_order"`
+	Latitude          pgtype.Float8      `json:"latitude"`
+	Longitude         pgtype.Float8      `json:"longitude"`
+	ScheduledTime     pgtype.Time        `json:"scheduled_time"`
+	ArrivedAt         pgtype.Timestamptz `json:"arrived_at"`
+	DepartedAt        pgtype.Timestamptz `json:"departed_at"`
+	ArrivalNotifiedAt pgtype.Timestamptz `json:"arrival_notified_at"`
+}
+
+func (q *Queries) ListTransportTripStops(ctx context.Context, tripID pgtype.UUID) ([]TransportTripStop, error) {
+	const query = `
+		SELECT ts.stop_id, s.name, ts.visit_order, s.latitude, s.longitude, s.arrival_time,
+			ts.arrived_at, ts.departed_at, ts.arrival_notified_at
+		FROM transport_trip_stops ts
+		JOIN transport_route_stops s ON s.id = ts.stop_id
+		WHERE ts.trip_id = $1
+		ORDER BY ts.visit_order
+	`
+	rows, err := q.db.Query(ctx, query, tripID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []TransportTripStop
+	for rows.Next() {
+		var s TransportTripStop
+		if err := rows.Scan(
+			&s.StopID, &s.Name, &s.VisitOrder, &s.Latitude, &s.Longitude, &s.ScheduledTime,
+			&s.ArrivedAt, &s.DepartedAt, &s.ArrivalNotifiedAt,
+		); err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+// MarkTransportTripStopArrived records the first time a trip entered a stop.
+func (q *Queries) MarkTransportTripStopArrived(ctx context.Context, tripID, stopID pgtype.UUID, at pgtype.Timestamptz) error {
+	const query = `
+		UPDATE transport_trip_stops SET arrived_at = $3
+		WHERE trip_id = $1 AND stop_id = $2 AND arrived_at IS NULL
+	`
+	_, err := q.db.Exec(ctx, query, tripID, stopID, at)
+	return err
+}
+
+// MarkTransportTripStopDeparted records when a trip left a stop it arrived at.
+func (q *Queries) MarkTransportTripStopDeparted(ctx context.Context, tripID, stopID pgtype.UUID, at pgtype.Timestamptz) error {
+	const query = `
+		UPDATE transport_trip_stops SET departed_at = $3
+		WHERE trip_id = $1 AND stop_id = $2 AND arrived_at IS NOT NULL AND departed_at IS NULL
+	`
+	_, err := q.db.Exec(ctx, query, tripID, stopID, at)
+	return err
+}
+
+// ClaimTransportStopArrivalNotice marks the arrival notice for a stop as sent
+// and reports whether this call was the one to do so.
+func (q *Queries) ClaimTransportStopArrivalNotice(ctx context.Context, tripID, stopID pgtype.UUID) (bool, error) {
+	const query = `
+		UPDATE transport_trip_stops SET arrival_notified_at = NOW()
+		WHERE trip_id = $1 AND stop_id = $2 AND arrival_notified_at IS NULL AND arrived_at IS NULL
+	`
+	tag, err := q.db.Exec(ctx, query, tripID, stopID)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// TransportGuardianRecipient is a guardian to notify about a student's bus.
+type TransportGuardianRecipient struct {
+	StudentID      pgtype.UUID `json:"student_id"`
+	StudentName    string      `json:"student_name"`
+	GuardianID     pgtype.UUID `json:"guardian_id"`
+	GuardianUserID pgtype.UUID `json:"guardian_user_id"`
+	Phone          string      `json:"phone"`
+}
+
+const transportActiveAllocation = `
+	a.status = 'active' AND a.start_date <= CURRENT_DATE AND (a.end_date IS NULL OR a.end_date >= CURRENT_DATE)`
+
+func (q *Queries) listTransportRecipients(ctx context.Context, query string, args ...any) ([]TransportGuardianRecipient, error) {
+	rows, err := q.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []TransportGuardianRecipient
+	for rows.Next() {
+		var r TransportGuardianRecipient
+		if err := rows.Scan(&r.StudentID, &r.StudentName, &r.GuardianID, &r.GuardianUserID, &r.Phone); err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// ListTransportStopRecipients returns the guardians of students currently
+// allocated to a stop of a route.
+func (q *Queries) ListTransportStopRecipients(ctx context.Context, tenantID, routeID, stopID pgtype.UUID) ([]TransportGuardianRecipient, error) {
+	query := `
+		SELECT st.id, st.full_name, g.id, g.user_id, g.phone
+		FROM transport_allocations a
+		JOIN students st ON st.id = a.student_id
+		JOIN student_guardians sg ON sg.student_id = st.id
+		JOIN guardians g ON g.id = sg.guardian_id
+		WHERE a.tenant_id = $1 AND a.route_id = $2 AND a.stop_id = $3 AND st.status = 'active'
+		  AND ` + transportActiveAllocation + `
+		ORDER BY st.full_name, sg.is_primary DESC
+	`
+	return q.listTransportRecipients(ctx, query, tenantID, routeID, stopID)
+}
+
+// ListTransportStudentRecipients returns the guardians of one student.
+func (q *Queries) ListTransportStudentRecipients(ctx context.Context, tenantID, studentID pgtype.UUID) ([]TransportGuardianRecipient, error) {
+	const query = `
+		SELECT st.id, st.full_name, g.id, g.user_id, g.phone
+		FROM students st
+		JOIN student_guardians sg ON sg.student_id = st.id
+		JOIN guardians g ON g.id = sg.guardian_id
+		WHERE st.tenant_id = $1 AND st.id = $2
+		ORDER BY sg.is_primary DESC
+	`
+	return q.listTransportRecipients(ctx, query, tenantID, studentID)
+}
+
+// ListUsersWithPermission returns the tenant's users holding a permission
+// through any role assignment.
+func (q *Queries) ListUsersWithPermission(ctx context.Context, tenantID pgtype.UUID, code string) ([]pgtype.UUID, error) {
+	const query = `
+		SELECT DISTINCT ra.user_id
+		FROM role_assignments ra
+		JOIN role_permissions rp ON rp.role_id = ra.role_id
+		JOIN permissions p ON p.id = rp.permission_id
+		JOIN users u ON u.id = ra.user_id
+		WHERE ra.tenant_id = $1 AND p.code = $2 AND u.is_active = TRUE
+	`
+	return q.listUUIDs(ctx, query, tenantID, code)
+}
+
+// TransportTripAlert is an overspeed or route-deviation measurement, or a
+// student who rode to school but not home.
+type TransportTripAlert struct {
+	ID             pgtype.UUID        `json:"id"`
+	TenantID       pgtype.UUID        `json:"tenant_id"`
+	TripID         pgtype.UUID        `json:"trip_id"`
+	AlertType      string             `json:"alert_type"`
+	StudentID      pgtype.UUID        `json:"student_id"`
+	ObservedValue  pgtype.Float8      `json:"observed_value"`
+	ThresholdValue pgtype.Float8      `json:"threshold_value"`
+	Latitude       pgtype.Float8      `json:"latitude"`
+	Longitude      pgtype.Float8      `json:"longitude"`
+	ObservedAt     pgtype.Timestamptz `json:"observed_at"`
+	AcknowledgedAt pgtype.Timestamptz `json:"acknowledged_at"`
+	AcknowledgedBy pgtype.UUID        `json:"acknowledged_by"`
+	CreatedAt      pgtype.Timestamptz `json:"created_at"`
+}
+
+const transportTripAlertColumns = `
+	id, tenant_id, trip_id, alert_type, student_id, observed_value, threshold_value, latitude, longitude,
+	observed_at, acknowledged_at, acknowledged_by, created_at`
+
+func scanTransportTripAlert(row pgx.Row, extra ...any) (TransportTripAlert, error) {
+	var a TransportTripAlert
+	dest := []any{
+		&a.ID, &a.TenantID, &a.TripID, &a.AlertType, &a.StudentID, &a.ObservedValue, &a.ThresholdValue, &a.Latitude, &a.Longitude,
+		&a.ObservedAt, &a.AcknowledgedAt, &a.AcknowledgedBy, &a.CreatedAt,
+	}
+	err := row.Scan(append(dest, extra...)...)
+	return a, err
+}
+
+type CreateTransportTripAlertParams struct {
+	TenantID        pgtype.UUID
+	TripID          pgtype.UUID
+	AlertType       string
+	ObservedValue   float64
+	ThresholdValue  float64
+	Latitude        float64
+	Longitude       float64
+	ObservedAt      pgtype.Timestamptz
+	CooldownMinutes int32
+}
+
+// CreateTransportTripAlert raises an alert unless the trip already raised one
+// of the same type within the cooldown. It returns no rows when suppressed.
+func (q *Queries) CreateTransportTripAlert(ctx context.Context, arg CreateTransportTripAlertParams) (TransportTripAlert, error) {
+	query := `
+		INSERT INTO transport_trip_alerts (
+			tenant_id, trip_id, alert_type, observed_value, threshold_value, latitude, longitude, observed_at
+		)
+		SELECT $1, $2, $3, $4, $5, $6, $7, $8
+		WHERE NOT EXISTS (
+			SELECT 1 FROM transport_trip_alerts
+			WHERE trip_id = $2 AND alert_type = $3
+			  AND observed_at > $8::timestamptz - make_interval(mins => $9::int)
+		)
+		RETURNING ` + transportTripAlertColumns
+	return scanTransportTripAlert(q.db.QueryRow(ctx, query,
+		arg.TenantID, arg.TripID, arg.AlertType, arg.ObservedValue, arg.ThresholdValue,
+		arg.Latitude, arg.Longitude, arg.ObservedAt, arg.CooldownMinutes,
+	))
+}
+
+// TransportMissedDrop is a missed-drop alert with the student it names.
+type TransportMissedDrop struct {
+	TransportTripAlert
+	StudentName string `json:"student_name"`
+}
+
+// CreateTransportMissedDropAlerts raises an alert on a drop trip for each
+// student allocated to its route who was on a pickup trip that day but on no
+// drop trip, unless the student left school on a gate pass. Students already
+// alerted on the trip are skipped, so only new alerts are returned.
+func (q *Queries) CreateTransportMissedDropAlerts(ctx context.Context, tenantID, tripID pgtype.UUID) ([]TransportMissedDrop, error) {
+	query := `
+		WITH trip AS (
+			SELECT id, tenant_id, route_id, trip_date, COALESCE(ended_at, NOW()) AS ended_at
+			FROM transport_trips
+			WHERE tenant_id = $1 AND id = $2 AND direction = 'drop'
+		), a AS (
+			INSERT INTO transport_trip_alerts (tenant_id, trip_id, alert_type, student_id, observed_at)
+			SELECT trip.tenant_id, trip.id, 'missed_drop', m.student_id, trip.ended_at
+			FROM trip
+			JOIN LATERAL (` + transportMissedDropStudents + `) m ON TRUE
+			ON CONFLICT DO NOTHING
+			RETURNING *
+		)
+		SELECT ` + transportTripAlertColumns + `, st.full_name
+		FROM a
+		JOIN students st ON st.id = a.student_id
+		ORDER BY st.full_name
+	`
+	rows, err := q.db.Query(ctx, query, tenantID, tripID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []TransportMissedDrop
+	for rows.Next() {
+		var m TransportMissedDrop
+		if m.TransportTripAlert, err = scanTransportTripAlert(rows, &m.StudentName); err != nil {
+			return nil, err
+		}
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
+
+// transportMissedDropStudents selects, for the route and day of a row named
+// trip, the students who rode a pickup trip but no drop trip.
+const transportMissedDropStudents = `
+	SELECT DISTINCT pb.student_id
+	FROM transport_trips pt
+	JOIN transport_trip_boardings pb ON pb.trip_id = pt.id
+	WHERE pt.route_id = trip.route_id AND pt.trip_date = trip.trip_date
+	  AND pt.direction = 'pickup' AND pt.status <> 'cancelled'
+	  AND NOT EXISTS (
+		SELECT 1 FROM transport_trips dt
+		JOIN transport_trip_boardings drb ON drb.trip_id = dt.id
+		WHERE dt.tenant_id = trip.tenant_id AND dt.trip_date = trip.trip_date
+		  AND dt.direction = 'drop' AND drb.student_id = pb.student_id
+	  )
+	  AND NOT EXISTS (
+		SELECT 1 FROM gate_passes gp
+		WHERE gp.tenant_id = trip.tenant_id AND gp.student_id = pb.student_id
+		  AND gp.status = 'used' AND gp.used_at::date = trip.trip_date
+	  )`
+
+func (q *Queries) ListTransportTripAlerts(ctx context.Context, tenantID, tripID pgtype.UUID, openOnly bool, limit int32) ([]TransportTripAlert, error) {
+	query := `
+		SELECT ` + transportTripAlertColumns + `
+		FROM transport_trip_alerts
+		WHERE tenant_id = $1
+		  AND ($2::uuid IS NULL OR trip_id = $2)
+		  AND (NOT $3 OR acknowledged_at IS NULL)
+		ORDER BY observed_at DESC
+		LIMIT $4
+	`
+	rows, err := q.db.Query(ctx, query, tenantID, tripID, openOnly, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []TransportTripAlert
+	for rows.Next() {
+		a, err := scanTransportTripAlert(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
+
+func (q *Queries) AcknowledgeTransportTripAlert(ctx context.Context, tenantID, id, userID pgtype.UUID) (TransportTripAlert, error) {
+	query := `
+		UPDATE transport_trip_alerts
+		SET acknowledged_at = COALESCE(acknowledged_at, NOW()), acknowledged_by = COALESCE(acknowledged_by, $3)
+		WHERE tenant_id = $1 AND id = $2
+		RETURNING ` + transportTripAlertColumns
+	return scanTransportTripAlert(q.db.QueryRow(ctx, query, tenantID, id, userID))
+}
+
+// TransportTripBoarding is a student's ride on a trip: where and how they
+// were marked on and off the bus.
+type TransportTripBoarding struct {
+	ID               pgtype.UUID        `json:"id"`
+	TripID           pgtype.UUID        `json:"trip_id"`
+	StudentID        pgtype.UUID        `json:"student_id"`
+	StudentName      string             `json:"student_name"`
+	StopID           pgtype.UUID        `json:"stop_id"`
+	BoardedAt        pgtype.Timestamptz `json:"boarded_at"`
+	BoardMethod      pgtype.Text        `json:"board_method"`
+	Latitude         pgtype.Float8      `json:"latitude"`
+	Longitude        pgtype.Float8      `json:"longitude"`
+	RecordedBy       pgtype.UUID        `json:"recorded_by"`
+	AlightStopID     pgtype.UUID        `json:"alight_stop_id"`
+	AlightedAt       pgtype.Timestamptz `json:"alighted_at"`
+	AlightMethod     pgtype.Text        `json:"alight_method"`
+	AlightLatitude   pgtype.Float8      `json:"alight_latitude"`
+	AlightLongitude  pgtype.Float8      `json:"alight_longitude"`
+	AlightRecordedBy pgtype.UUID        `json:"alight_recorded_by"`
+}
+
+const transportTripBoardingColumns = `
+	b.id, b.trip_id, b.student_id, st.full_name, b.stop_id, b.boarded_at, b.board_method, b.latitude, b.longitude,
+	b.recorded_by, b.alight_stop_id, b.alighted_at, b.alight_method, b.alight_latitude, b.alight_longitude,
+	b.alight_recorded_by`
+
+func scanTransportTripBoarding(row pgx.Row) (TransportTripBoarding, error) {
+	var b TransportTripBoarding
+	err := row.Scan(
+		&b.ID, &b.TripID, &b.StudentID, &b.StudentName, &b.StopID, &b.BoardedAt, &b.BoardMethod, &b.Latitude, &b.Longitude,
+		&b.RecordedBy, &b.AlightStopID, &b.AlightedAt, &b.AlightMethod, &b.AlightLatitude, &b.AlightLongitude,
+		&b.AlightRecordedBy,
+	)
+	return b, err
+}
+
+type MarkTransportTripBoardingParams struct {
+	TenantID  pgtype.UUID
+	TripID    pgtype.UUID
+	StudentID pgtype.UUID
+	// StopID is where the mark was made; when invalid the student's own stop
+	// is used at their end of the trip and the school at the other.
+	StopID     pgtype.UUID
+	Method     string
+	At         pgtype.Timestamptz
+	RecordedBy pgtype.UUID
+}
+
+// transportBoardingSource selects the running trip and the student's active
+// allocation to its route for a mark. Its parameters are those of
+// MarkTransportTripBoardingParams in order.
+const transportBoardingSource = `
+	FROM transport_trips t
+	JOIN transport_allocations a ON a.route_id = t.route_id AND a.tenant_id = t.tenant_id
+	WHERE t.tenant_id = $1 AND t.id = $2 AND t.status = 'in_progress' AND a.student_id = $3
+	  AND ` + transportActiveAllocation + `
+	LIMIT 1`
+
+// BoardTransportTrip marks a student allocated to the trip's route as on the
+// bus, at the trip's current position. No rows means the trip is not
+// running, the student is not allocated to its route, or the student is
+// already marked on.
+func (q *Queries) BoardTransportTrip(ctx context.Context, arg MarkTransportTripBoardingParams) (TransportTripBoarding, error) {
+	query := `
+		WITH b AS (
+			INSERT INTO transport_trip_boardings (
+				trip_id, student_id, stop_id, boarded_at, board_method, latitude, longitude, recorded_by
+			)
+			SELECT t.id, a.student_id, COALESCE($4, CASE WHEN t.direction = 'pickup' THEN a.stop_id END),
+				COALESCE($6, NOW()), $5, t.last_latitude, t.last_longitude, $7
+			` + transportBoardingSource + `
+			ON CONFLICT (trip_id, student_id) DO UPDATE SET
+				stop_id = EXCLUDED.stop_id, boarded_at = EXCLUDED.boarded_at, board_method = EXCLUDED.board_method,
+				latitude = EXCLUDED.latitude, longitude = EXCLUDED.longitude, recorded_by = EXCLUDED.recorded_by
+			WHERE transport_trip_boardings.boarded_at IS NULL
+			RETURNING *
+		)
+		SELECT ` + transportTripBoardingColumns + `
+		FROM b
+		JOIN students st ON st.id = b.student_id
+	`
+	return scanTransportTripBoarding(q.db.QueryRow(ctx, query,
+		arg.TenantID, arg.TripID, arg.StudentID, arg.StopID, arg.Method, arg.At, arg.RecordedBy,
+	))
+}
+
+// AlightTransportTrip marks a student allocated to the trip's route as off
+// the bus. A student never marked on gets a row with no boarding. No rows
+// means the trip is not running, the student is not allocated to its
+// route, or the student is already marked off.
+func (q *Queries) AlightTransportTrip(ctx context.Context, arg MarkTransportTripBoardingParams) (TransportTripBoarding, error) {
+	query := `
+		WITH b AS (
+			INSERT INTO transport_trip_boardings (
+				trip_id, student_id, boarded_at, alight_stop_id, alighted_at, alight_method,
+				alight_latitude, alight_longitude, alight_recorded_by
+			)
+			SELECT t.id, a.student_id, NULL, COALESCE($4, CASE WHEN t.direction = 'drop' THEN a.stop_id END),
+				COALESCE($6, NOW()), $5, t.last_latitude, t.last_longitude, $7
+			` + transportBoardingSource + `
+			ON CONFLICT (trip_id, student_id) DO UPDATE SET
+				alight_stop_id = EXCLUDED.alight_stop_id, alighted_at = EXCLUDED.alighted_at,
+				alight_method = EXCLUDED.alight_method, alight_latitude = EXCLUDED.alight_latitude,
+				alight_longitude = EXCLUDED.alight_longitude, alight_recorded_by = EXCLUDED.alight_recorded_by
+			WHERE transport_trip_boardings.alighted_at IS NULL
+			RETURNING *
+		)
+		SELECT ` + transportTripBoardingColumns + `
+		FROM b
+		JOIN students st ON st.id = b.student_id
+	`
+	return scanTransportTripBoarding(q.db.QueryRow(ctx, query,
+		arg.TenantID, arg.TripID, arg.StudentID, arg.StopID, arg.Method, arg.At, arg.RecordedBy,
+	))
+}
+
+func (q *Queries) GetTransportTripBoarding(ctx context.Context, tripID, studentID pgtype.UUID) (TransportTripBoarding, error) {
+	query := `
+		SELECT ` + transportTripBoardingColumns + `
+		FROM transport_trip_boardings b
+		JOIN students st ON st.id = b.student_id
+		WHERE b.trip_id = $1 AND b.student_id = $2
+	`
+	return scanTransportTripBoarding(q.db.QueryRow(ctx, query, tripID, studentID))
+}
+
+func (q *Queries) ListTransportTripBoardings(ctx context.Context, tripID pgtype.UUID) ([]TransportTripBoarding, error) {
+	query := `
+		SELECT ` + transportTripBoardingColumns + `
+		FROM transport_trip_boardings b
+		JOIN students st ON st.id = b.student_id
+		WHERE b.trip_id = $1
+		ORDER BY COALESCE(b.boarded_at, b.alighted_at)
+	`
+	rows, err := q.db.Query(ctx, query, tripID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []TransportTripBoarding
+	for rows.Next() {
+		b, err := scanTransportTripBoarding(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, b)
+	}
+	return out, rows.Err()
+}
+
+// GuardianTransportChild is a parent's child with a transport allocation and
+// the trip currently running on the child's route, if any.
+type GuardianTransportChild struct {
+	StudentID   pgtype.UUID `json:"student_id"`
+	StudentName string      `json:"student_name"`
+	RouteID     pgtype.UUID `json:"route_id"`
+	RouteName   string      `json:"route_name"`
+	StopID      pgtype.UUID `json:"stop_id"`
+	TripID      pgtype.UUID `json:"trip_id"`
+}
+
+func (q *Queries) ListGuardianTransportChildren(ctx context.Context, tenantID, userID pgtype.UUID) ([]GuardianTransportChild, error) {
+	query := `
+		SELECT DISTINCT st.id, st.full_name, r.id, r.name, a.stop_id, t.id
+		FROM guardians g
+		JOIN student_guardians sg ON sg.guardian_id = g.id
+		JOIN students st ON st.id = sg.student_id
+		JOIN transport_allocations a ON a.student_id = st.id AND a.tenant_id = g.tenant_id
+		JOIN transport_routes r ON r.id = a.route_id
+		LEFT JOIN transport_trips t ON t.route_id = r.id AND t.status = 'in_progress'
+		WHERE g.tenant_id = $1 AND g.user_id = $2
+		  AND ` + transportActiveAllocation + `
+	`
+	rows, err := q.db.Query(ctx, query, tenantID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []GuardianTransportChild
+	for rows.Next() {
+		var c GuardianTransportChild
+		if err := rows.Scan(&c.StudentID, &c.StudentName, &c.RouteID, &c.RouteName, &c.StopID, &c.TripID); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// SetRouteStopLocation sets the coordinates of a stop of a tenant's route.
+func (q *Queries) SetRouteStopLocation(ctx context.Context, tenantID, stopID pgtype.UUID, latitude, longitude pgtype.Float8) error {
+	const query = `
+		UPDATE transport_route_stops s
+		SET latitude = $3, longitude = $4, updated_at = NOW()
+		FROM transport_routes r
+		WHERE r.id = s.route_id AND r.tenant_id = $1 AND s.id = $2
+	`
+	tag, err := q.db.Exec(ctx, query, tenantID, stopID, latitude, longitude)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
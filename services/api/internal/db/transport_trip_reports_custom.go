@@ -0,0 +1,180 @@
+package db
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// TransportRouteSummary is how a route ran over a date range.
+type TransportRouteSummary struct {
+	RouteID           pgtype.UUID   `json:"route_id"`
+	RouteName         string        `json:"route_name"`
+	AllocatedStudents int64         `json:"allocated_students"`
+	Trips             int64         `json:"trips"`
+	CompletedTrips    int64         `json:"completed_trips"`
+	CancelledTrips    int64         `json:"cancelled_trips"`
+	DriverCheckIns    int64         `json:"driver_check_ins"`
+	AttendantCheckIns int64         `json:"attendant_check_ins"`
+	AvgTripMinutes    pgtype.Float8 `json:"avg_trip_minutes"`
+	Boardings         int64         `json:"boardings"`
+	Alightings        int64         `json:"alightings"`
+	RFIDMarks         int64         `json:"rfid_marks"`
+	QRMarks           int64         `json:"qr_marks"`
+	MissedDrops       int64         `json:"missed_drops"`
+	OverspeedAlerts   int64         `json:"overspeed_alerts"`
+	DeviationAlerts   int64         `json:"deviation_alerts"`
+}
+
+// ListTransportRouteSummaries summarises the trips of each of a tenant's
+// routes between two days, inclusive.
+func (q *Queries) ListTransportRouteSummaries(ctx context.Context, tenantID pgtype.UUID, from, to pgtype.Date) ([]TransportRouteSummary, error) {
+	query := `
+		WITH trips AS (
+			SELECT * FROM transport_trips
+			WHERE tenant_id = $1 AND trip_date BETWEEN $2 AND $3
+		), trip_totals AS (
+			SELECT route_id,
+				COUNT(*) FILTER (WHERE status <> 'cancelled') AS trips,
+				COUNT(*) FILTER (WHERE status = 'completed') AS completed,
+				COUNT(*) FILTER (WHERE status = 'cancelled') AS cancelled,
+				COUNT(*) FILTER (WHERE driver_checked_in_at IS NOT NULL) AS driver_check_ins,
+				COUNT(*) FILTER (WHERE attendant_checked_in_at IS NOT NULL) AS attendant_check_ins,
+				AVG(EXTRACT(EPOCH FROM ended_at - started_at) / 60) FILTER (WHERE status = 'completed') AS avg_minutes
+			FROM trips
+			GROUP BY route_id
+		), rides AS (
+			SELECT t.route_id,
+				COUNT(b.boarded_at) AS boardings,
+				COUNT(b.alighted_at) AS alightings,
+				COUNT(*) FILTER (WHERE b.board_method = 'rfid') + COUNT(*) FILTER (WHERE b.alight_method = 'rfid') AS rfid,
+				COUNT(*) FILTER (WHERE b.board_method = 'qr') + COUNT(*) FILTER (WHERE b.alight_method = 'qr') AS qr
+			FROM trips t
+			JOIN transport_trip_boardings b ON b.trip_id = t.id
+			GROUP BY t.route_id
+		), alerts AS (
+			SELECT t.route_id,
+				COUNT(*) FILTER (WHERE a.alert_type = 'missed_drop') AS missed_drops,
+				COUNT(*) FILTER (WHERE a.alert_type = 'overspeed') AS overspeed,
+				COUNT(*) FILTER (WHERE a.alert_type = 'route_deviation') AS deviation
+			FROM trips t
+			JOIN transport_trip_alerts a ON a.trip_id = t.id
+			GROUP BY t.route_id
+		), allocated AS (
+			SELECT a.route_id, COUNT(DISTINCT a.student_id) AS students
+			FROM transport_allocations a
+			WHERE a.tenant_id = $1 AND ` + transportActiveAllocation + `
+			GROUP BY a.route_id
+		)
+		SELECT r.id, r.name, COALESCE(al.students, 0),
+			COALESCE(tt.trips, 0), COALESCE(tt.completed, 0), COALESCE(tt.cancelled, 0),
+			COALESCE(tt.driver_check_ins, 0), COALESCE(tt.attendant_check_ins, 0), tt.avg_minutes::float8,
+			COALESCE(rd.boardings, 0), COALESCE(rd.alightings, 0), COALESCE(rd.rfid, 0), COALESCE(rd.qr, 0),
+			COALESCE(ta.missed_drops, 0), COALESCE(ta.overspeed, 0), COALESCE(ta.deviation, 0)
+		FROM transport_routes r
+		LEFT JOIN trip_totals tt ON tt.route_id = r.id
+		LEFT JOIN rides rd ON rd.route_id = r.id
+		LEFT JOIN alerts ta ON ta.route_id = r.id
+		LEFT JOIN allocated al ON al.route_id = r.id
+		WHERE r.tenant_id = $1 AND (r.is_active = TRUE OR tt.trips > 0)
+		ORDER BY r.name
+	`
+	rows, err := q.db.Query(ctx, query, tenantID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []TransportRouteSummary
+	for rows.Next() {
+		var s TransportRouteSummary
+		if err := rows.Scan(
+			&s.RouteID, &s.RouteName, &s.AllocatedStudents,
+			&s.Trips, &s.CompletedTrips, &s.CancelledTrips,
+			&s.DriverCheckIns, &s.AttendantCheckIns, &s.AvgTripMinutes,
+			&s.Boardings, &s.Alightings, &s.RFIDMarks, &s.QRMarks,
+			&s.MissedDrops, &s.OverspeedAlerts, &s.DeviationAlerts,
+		); err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+// TransportRosterEntry is one allocated student's rides on a route's trips
+// for a day.
+type TransportRosterEntry struct {
+	StudentID         pgtype.UUID        `json:"student_id"`
+	StudentName       string             `json:"student_name"`
+	AdmissionNumber   string             `json:"admission_number"`
+	StopID            pgtype.UUID        `json:"stop_id"`
+	StopName          pgtype.Text        `json:"stop_name"`
+	PickupBoardedAt   pgtype.Timestamptz `json:"pickup_boarded_at"`
+	PickupBoardMethod pgtype.Text        `json:"pickup_board_method"`
+	PickupAlightedAt  pgtype.Timestamptz `json:"pickup_alighted_at"`
+	DropBoardedAt     pgtype.Timestamptz `json:"drop_boarded_at"`
+	DropBoardMethod   pgtype.Text        `json:"drop_board_method"`
+	DropAlightedAt    pgtype.Timestamptz `json:"drop_alighted_at"`
+	// MissedDrop is set once the route's drop trip has completed for a
+	// student who rode to school but was on no drop trip and did not leave
+	// on a gate pass.
+	MissedDrop bool `json:"missed_drop"`
+}
+
+// ListTransportRouteRoster returns the students allocated to a route on a
+// day with their marks on that day's pickup and drop trips.
+func (q *Queries) ListTransportRouteRoster(ctx context.Context, tenantID, routeID pgtype.UUID, day pgtype.Date) ([]TransportRosterEntry, error) {
+	const query = `
+		WITH rides AS (
+			SELECT DISTINCT ON (t.direction, b.student_id)
+				t.direction, b.student_id, b.boarded_at, b.board_method, b.alighted_at
+			FROM transport_trips t
+			JOIN transport_trip_boardings b ON b.trip_id = t.id
+			WHERE t.tenant_id = $1 AND t.route_id = $2 AND t.trip_date = $3 AND t.status <> 'cancelled'
+			ORDER BY t.direction, b.student_id, t.started_at DESC NULLS LAST
+		)
+		SELECT st.id, st.full_name, st.admission_number, a.stop_id, s.name,
+			p.boarded_at, p.board_method, p.alighted_at,
+			d.boarded_at, d.board_method, d.alighted_at,
+			p.student_id IS NOT NULL AND NOT EXISTS (
+				SELECT 1 FROM transport_trips dt
+				JOIN transport_trip_boardings drb ON drb.trip_id = dt.id
+				WHERE dt.tenant_id = $1 AND dt.trip_date = $3 AND dt.direction = 'drop' AND drb.student_id = st.id
+			) AND EXISTS (
+				SELECT 1 FROM transport_trips dt
+				WHERE dt.route_id = $2 AND dt.trip_date = $3 AND dt.direction = 'drop' AND dt.status = 'completed'
+			) AND NOT EXISTS (
+				SELECT 1 FROM gate_passes gp
+				WHERE gp.tenant_id = $1 AND gp.student_id = st.id AND gp.status = 'used' AND gp.used_at::date = $3
+			)
+		FROM transport_allocations a
+		JOIN students st ON st.id = a.student_id
+		LEFT JOIN transport_route_stops s ON s.id = a.stop_id
+		LEFT JOIN rides p ON p.student_id = st.id AND p.direction = 'pickup'
+		LEFT JOIN rides d ON d.student_id = st.id AND d.direction = 'drop'
+		WHERE a.tenant_id = $1 AND a.route_id = $2 AND a.status = 'active'
+		  AND a.start_date <= $3 AND (a.end_date IS NULL OR a.end_date >= $3)
+		ORDER BY s.sequence_order NULLS LAST, st.full_name
+	`
+	rows, err := q.db.Query(ctx, query, tenantID, routeID, day)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []TransportRosterEntry
+	for rows.Next() {
+		var e TransportRosterEntry
+		if err := rows.Scan(
+			&e.StudentID, &e.StudentName, &e.AdmissionNumber, &e.StopID, &e.StopName,
+			&e.PickupBoardedAt, &e.PickupBoardMethod, &e.PickupAlightedAt,
+			&e.DropBoardedAt, &e.DropBoardMethod, &e.DropAlightedAt,
+			&e.MissedDrop,
+		); err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
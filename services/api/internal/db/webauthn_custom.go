@@ -0,0 +1,243 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// WebAuthnCredential is a registered security key or passkey.
+type WebAuthnCredential struct {
+	ID                pgtype.UUID
+	UserID            pgtype.UUID
+	CredentialID      []byte
+	PublicKey         []byte
+	Algorithm         int64
+	SignCount         int64
+	AAGUID            []byte
+	Transports        []string
+	AttestationFormat string
+	UserVerified      bool
+	BackupEligible    bool
+	BackupState       bool
+	Name              string
+	CreatedAt         pgtype.Timestamptz
+	LastUsedAt        pgtype.Timestamptz
+}
+
+const webAuthnCredentialColumns = `
+	id, user_id, credential_id, public_key, algorithm, sign_count, aaguid, transports,
+	attestation_format, user_verified, backup_eligible, backup_state, name, created_at, last_used_at
+`
+
+func scanWebAuthnCredential(row pgx.Row) (WebAuthnCredential, error) {
+	var c WebAuthnCredential
+	err := row.Scan(
+		&c.ID, &c.UserID, &c.CredentialID, &c.PublicKey, &c.Algorithm, &c.SignCount, &c.AAGUID, &c.Transports,
+		&c.AttestationFormat, &c.UserVerified, &c.BackupEligible, &c.BackupState, &c.Name, &c.CreatedAt, &c.LastUsedAt,
+	)
+	return c, err
+}
+
+// ListWebAuthnCredentials returns a user's credentials, oldest first.
+func (q *Queries) ListWebAuthnCredentials(ctx context.Context, userID pgtype.UUID) ([]WebAuthnCredential, error) {
+	query := `SELECT ` + webAuthnCredentialColumns + ` FROM webauthn_credentials WHERE user_id = $1 ORDER BY created_at ASC`
+	rows, err := q.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []WebAuthnCredential
+	for rows.Next() {
+		c, err := scanWebAuthnCredential(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// CountWebAuthnCredentials reports how many credentials a user has registered.
+func (q *Queries) CountWebAuthnCredentials(ctx context.Context, userID pgtype.UUID) (int64, error) {
+	var n int64
+	err := q.db.QueryRow(ctx, `SELECT COUNT(*) FROM webauthn_credentials WHERE user_id = $1`, userID).Scan(&n)
+	return n, err
+}
+
+// GetWebAuthnCredentialByCredentialID looks a credential up by its authenticator-assigned id.
+func (q *Queries) GetWebAuthnCredentialByCredentialID(ctx context.Context, credentialID []byte) (WebAuthnCredential, error) {
+	query := `SELECT ` + webAuthnCredentialColumns + ` FROM webauthn_credentials WHERE credential_id = $1`
+	return scanWebAuthnCredential(q.db.QueryRow(ctx, query, credentialID))
+}
+
+type CreateWebAuthnCredentialParams struct {
+	UserID            pgtype.UUID
+	CredentialID      []byte
+	PublicKey         []byte
+	Algorithm         int64
+	SignCount         int64
+	AAGUID            []byte
+	Transports        []string
+	AttestationFormat string
+	UserVerified      bool
+	BackupEligible    bool
+	BackupState       bool
+	Name              string
+}
+
+func (q *Queries) CreateWebAuthnCredential(ctx context.Context, arg CreateWebAuthnCredentialParams) (WebAuthnCredential, error) {
+	query := `
+		INSERT INTO webauthn_credentials (
+			user_id, credential_id, public_key, algorithm, sign_count, aaguid, transports,
+			attestation_format, user_verified, backup_eligible, backup_state, name
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		RETURNING ` + webAuthnCredentialColumns
+	if arg.Transports == nil {
+		arg.Transports = []string{}
+	}
+	return scanWebAuthnCredential(q.db.QueryRow(ctx, query,
+		arg.UserID, arg.CredentialID, arg.PublicKey, arg.Algorithm, arg.SignCount, arg.AAGUID, arg.Transports,
+		arg.AttestationFormat, arg.UserVerified, arg.BackupEligible, arg.BackupState, arg.Name,
+	))
+}
+
+// TouchWebAuthnCredential records a successful assertion. The counter only
+// moves forward so two concurrent assertions cannot roll it back.
+func (q *Queries) TouchWebAuthnCredential(ctx context.Context, id pgtype.UUID, signCount int64, backupState bool) error {
+	const query = `
+		UPDATE webauthn_credentials
+		SET sign_count = GREATEST(sign_count, $2), backup_state = $3, last_used_at = NOW()
+		WHERE id = $1
+	`
+	_, err := q.db.Exec(ctx, query, id, signCount, backupState)
+	return err
+}
+
+func (q *Queries) RenameWebAuthnCredential(ctx context.Context, userID, id pgtype.UUID, name string) (int64, error) {
+	tag, err := q.db.Exec(ctx, `UPDATE webauthn_credentials SET name = $3 WHERE id = $2 AND user_id = $1`, userID, id, name)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+func (q *Queries) DeleteWebAuthnCredential(ctx context.Context, userID, id pgtype.UUID) (int64, error) {
+	tag, err := q.db.Exec(ctx, `DELETE FROM webauthn_credentials WHERE id = $2 AND user_id = $1`, userID, id)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// CreateWebAuthnChallenge stores a ceremony challenge. userID may be invalid
+// (NULL) for passwordless logins.
+func (q *Queries) CreateWebAuthnChallenge(ctx context.Context, userID pgtype.UUID, purpose string, challenge []byte, expiresAt time.Time) (pgtype.UUID, error) {
+	const query = `
+		INSERT INTO webauthn_challenges (user_id, purpose, challenge, expires_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`
+	var id pgtype.UUID
+	err := q.db.QueryRow(ctx, query, userID, purpose, challenge, expiresAt).Scan(&id)
+	return id, err
+}
+
+// ConsumeWebAuthnChallenge marks an unexpired challenge used and returns it
+// with the user it was issued for. A challenge can be consumed once.
+func (q *Queries) ConsumeWebAuthnChallenge(ctx context.Context, id pgtype.UUID, purpose string) ([]byte, pgtype.UUID, error) {
+	const query = `
+		UPDATE webauthn_challenges
+		SET consumed_at = NOW()
+		WHERE id = $1 AND purpose = $2 AND consumed_at IS NULL AND expires_at > NOW()
+		RETURNING challenge, user_id
+	`
+	var challenge []byte
+	var userID pgtype.UUID
+	err := q.db.QueryRow(ctx, query, id, purpose).Scan(&challenge, &userID)
+	return challenge, userID, err
+}
+
+// MFALoginSession is a password or SSO login awaiting its second factor.
+// IdentityID is set for SSO logins and names the identity the session is
+// minted for; password logins leave it unset.
+type MFALoginSession struct {
+	ID                 pgtype.UUID
+	UserID             pgtype.UUID
+	IdentityID         pgtype.UUID
+	Methods            []string
+	EnrollmentRequired bool
+	FailedAttempts     int32
+}
+
+func (q *Queries) CreateMFALoginSession(ctx context.Context, userID, identityID pgtype.UUID, tokenHash string, methods []string, enrollmentRequired bool, expiresAt time.Time) error {
+	const query = `
+		INSERT INTO mfa_login_sessions (user_id, identity_id, token_hash, methods, enrollment_required, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+	_, err := q.db.Exec(ctx, query, userID, identityID, tokenHash, methods, enrollmentRequired, expiresAt)
+	return err
+}
+
+// GetOpenMFALoginSession returns an unexpired, uncompleted session below the attempt limit.
+func (q *Queries) GetOpenMFALoginSession(ctx context.Context, tokenHash string, maxAttempts int32) (MFALoginSession, error) {
+	const query = `
+		SELECT id, user_id, identity_id, methods, enrollment_required, failed_attempts
+		FROM mfa_login_sessions
+		WHERE token_hash = $1 AND completed_at IS NULL AND expires_at > NOW() AND failed_attempts < $2
+	`
+	var s MFALoginSession
+	err := q.db.QueryRow(ctx, query, tokenHash, maxAttempts).Scan(&s.ID, &s.UserID, &s.IdentityID, &s.Methods, &s.EnrollmentRequired, &s.FailedAttempts)
+	return s, err
+}
+
+func (q *Queries) RecordMFALoginFailure(ctx context.Context, id pgtype.UUID) error {
+	_, err := q.db.Exec(ctx, `UPDATE mfa_login_sessions SET failed_attempts = failed_attempts + 1 WHERE id = $1`, id)
+	return err
+}
+
+// CompleteMFALoginSession closes a session; it reports false if another
+// request completed it first.
+func (q *Queries) CompleteMFALoginSession(ctx context.Context, id pgtype.UUID) (bool, error) {
+	tag, err := q.db.Exec(ctx, `UPDATE mfa_login_sessions SET completed_at = NOW() WHERE id = $1 AND completed_at IS NULL`, id)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// ReplaceMFARecoveryCodes swaps a user's recovery codes for a new set.
+func (q *Queries) ReplaceMFARecoveryCodes(ctx context.Context, userID pgtype.UUID, codeHashes []string) error {
+	const query = `
+		WITH cleared AS (
+			DELETE FROM mfa_recovery_codes WHERE user_id = $1
+		)
+		INSERT INTO mfa_recovery_codes (user_id, code_hash)
+		SELECT $1, UNNEST($2::text[])
+	`
+	_, err := q.db.Exec(ctx, query, userID, codeHashes)
+	return err
+}
+
+// UseMFARecoveryCode burns a matching unused code and reports whether one matched.
+func (q *Queries) UseMFARecoveryCode(ctx context.Context, userID pgtype.UUID, codeHash string) (bool, error) {
+	const query = `
+		UPDATE mfa_recovery_codes
+		SET used_at = NOW()
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+	`
+	tag, err := q.db.Exec(ctx, query, userID, codeHash)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+func (q *Queries) CountUnusedMFARecoveryCodes(ctx context.Context, userID pgtype.UUID) (int64, error) {
+	var n int64
+	err := q.db.QueryRow(ctx, `SELECT COUNT(*) FROM mfa_recovery_codes WHERE user_id = $1 AND used_at IS NULL`, userID).Scan(&n)
+	return n, err
+}
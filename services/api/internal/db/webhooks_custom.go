@@ -0,0 +1,416 @@
+package db
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// TenantWebhookSubscription is an endpoint a tenant registered for domain
+// events. SecretEnc is the keyring-encrypted signing secret.
+type TenantWebhookSubscription struct {
+	ID                  pgtype.UUID        `json:"id"`
+	TenantID            pgtype.UUID        `json:"tenant_id"`
+	Name                string             `json:"name"`
+	TargetURL           string             `json:"target_url"`
+	SecretEnc           string             `json:"-"`
+	Events              []string           `json:"events"`
+	Status              string             `json:"status"`
+	ConsecutiveFailures int32              `json:"consecutive_failures"`
+	DisabledReason      pgtype.Text        `json:"disabled_reason"`
+	DisabledAt          pgtype.Timestamptz `json:"disabled_at"`
+	LastSuccessAt       pgtype.Timestamptz `json:"last_success_at"`
+	LastFailureAt       pgtype.Timestamptz `json:"last_failure_at"`
+	CreatedBy           pgtype.UUID        `json:"created_by"`
+	CreatedAt           pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt           pgtype.Timestamptz `json:"updated_at"`
+}
+
+const tenantWebhookSubscriptionColumns = `
+	id, tenant_id, name, target_url, secret_enc, events, status, consecutive_failures,
+	disabled_reason, disabled_at, last_success_at, last_failure_at, created_by, created_at, updated_at`
+
+func scanTenantWebhookSubscription(row pgx.Row) (TenantWebhookSubscription, error) {
+	var s TenantWebhookSubscription
+	err := row.Scan(
+		&s.ID, &s.TenantID, &s.Name, &s.TargetURL, &s.SecretEnc, &s.Events, &s.Status, &s.ConsecutiveFailures,
+		&s.DisabledReason, &s.DisabledAt, &s.LastSuccessAt, &s.LastFailureAt, &s.CreatedBy, &s.CreatedAt, &s.UpdatedAt,
+	)
+	return s, err
+}
+
+type CreateTenantWebhookSubscriptionParams struct {
+	TenantID  pgtype.UUID
+	Name      string
+	TargetURL string
+	SecretEnc string
+	Events    []string
+	CreatedBy pgtype.UUID
+}
+
+func (q *Queries) CreateTenantWebhookSubscription(ctx context.Context, arg CreateTenantWebhookSubscriptionParams) (TenantWebhookSubscription, error) {
+	query := `
+		INSERT INTO tenant_webhook_subscriptions (tenant_id, name, target_url, secret_enc, events, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING ` + tenantWebhookSubscriptionColumns
+	return scanTenantWebhookSubscription(q.db.QueryRow(ctx, query,
+		arg.TenantID, arg.Name, arg.TargetURL, arg.SecretEnc, arg.Events, arg.CreatedBy,
+	))
+}
+
+func (q *Queries) GetTenantWebhookSubscription(ctx context.Context, tenantID, id pgtype.UUID) (TenantWebhookSubscription, error) {
+	query := `SELECT ` + tenantWebhookSubscriptionColumns + ` FROM tenant_webhook_subscriptions WHERE tenant_id = $1 AND id = $2`
+	return scanTenantWebhookSubscription(q.db.QueryRow(ctx, query, tenantID, id))
+}
+
+func (q *Queries) ListTenantWebhookSubscriptions(ctx context.Context, tenantID pgtype.UUID) ([]TenantWebhookSubscription, error) {
+	query := `
+		SELECT ` + tenantWebhookSubscriptionColumns + `
+		FROM tenant_webhook_subscriptions
+		WHERE tenant_id = $1
+		ORDER BY created_at DESC
+	`
+	rows, err := q.db.Query(ctx, query, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []TenantWebhookSubscription
+	for rows.Next() {
+		s, err := scanTenantWebhookSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+type UpdateTenantWebhookSubscriptionParams struct {
+	TenantID  pgtype.UUID
+	ID        pgtype.UUID
+	Name      string
+	TargetURL string
+	Events    []string
+}
+
+func (q *Queries) UpdateTenantWebhookSubscription(ctx context.Context, arg UpdateTenantWebhookSubscriptionParams) (TenantWebhookSubscription, error) {
+	query := `
+		UPDATE tenant_webhook_subscriptions
+		SET name = $3, target_url = $4, events = $5, updated_at = NOW()
+		WHERE tenant_id = $1 AND id = $2
+		RETURNING ` + tenantWebhookSubscriptionColumns
+	return scanTenantWebhookSubscription(q.db.QueryRow(ctx, query, arg.TenantID, arg.ID, arg.Name, arg.TargetURL, arg.Events))
+}
+
+// SetTenantWebhookSubscriptionStatus enables or disables an endpoint.
+// Enabling clears the failure streak so the endpoint gets a fresh budget.
+func (q *Queries) SetTenantWebhookSubscriptionStatus(ctx context.Context, tenantID, id pgtype.UUID, status, reason string) (TenantWebhookSubscription, error) {
+	query := `
+		UPDATE tenant_webhook_subscriptions
+		SET status = $3,
+		    disabled_reason = CASE WHEN $3 = 'disabled' THEN NULLIF($4, '') END,
+		    disabled_at = CASE WHEN $3 = 'disabled' THEN NOW() END,
+		    consecutive_failures = CASE WHEN $3 = 'active' THEN 0 ELSE consecutive_failures END,
+		    updated_at = NOW()
+		WHERE tenant_id = $1 AND id = $2
+		RETURNING ` + tenantWebhookSubscriptionColumns
+	return scanTenantWebhookSubscription(q.db.QueryRow(ctx, query, tenantID, id, status, reason))
+}
+
+func (q *Queries) UpdateTenantWebhookSecret(ctx context.Context, tenantID, id pgtype.UUID, secretEnc string) (TenantWebhookSubscription, error) {
+	query := `
+		UPDATE tenant_webhook_subscriptions
+		SET secret_enc = $3, updated_at = NOW()
+		WHERE tenant_id = $1 AND id = $2
+		RETURNING ` + tenantWebhookSubscriptionColumns
+	return scanTenantWebhookSubscription(q.db.QueryRow(ctx, query, tenantID, id, secretEnc))
+}
+
+func (q *Queries) DeleteTenantWebhookSubscription(ctx context.Context, tenantID, id pgtype.UUID) (int64, error) {
+	tag, err := q.db.Exec(ctx, `DELETE FROM tenant_webhook_subscriptions WHERE tenant_id = $1 AND id = $2`, tenantID, id)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// RecordTenantWebhookSuccess resets the failure streak of an endpoint.
+func (q *Queries) RecordTenantWebhookSuccess(ctx context.Context, id pgtype.UUID) error {
+	const query = `
+		UPDATE tenant_webhook_subscriptions
+		SET consecutive_failures = 0, last_success_at = NOW(), updated_at = NOW()
+		WHERE id = $1
+	`
+	_, err := q.db.Exec(ctx, query, id)
+	return err
+}
+
+// RecordTenantWebhookFailure extends the failure streak of an endpoint and
+// disables it once the streak reaches threshold. It reports whether this call
+// disabled the endpoint.
+func (q *Queries) RecordTenantWebhookFailure(ctx context.Context, id pgtype.UUID, threshold int32, reason string) (bool, error) {
+	const query = `
+		UPDATE tenant_webhook_subscriptions
+		SET consecutive_failures = consecutive_failures + 1,
+		    last_failure_at = NOW(),
+		    status = CASE WHEN status = 'active' AND consecutive_failures + 1 >= $2 THEN 'disabled' ELSE status END,
+		    disabled_reason = CASE WHEN status = 'active' AND consecutive_failures + 1 >= $2 THEN $3 ELSE disabled_reason END,
+		    disabled_at = CASE WHEN status = 'active' AND consecutive_failures + 1 >= $2 THEN NOW() ELSE disabled_at END,
+		    updated_at = NOW()
+		WHERE id = $1
+		RETURNING status = 'disabled' AND consecutive_failures = $2
+	`
+	var disabled bool
+	err := q.db.QueryRow(ctx, query, id, threshold, reason).Scan(&disabled)
+	return disabled, err
+}
+
+// FanOutOutboxToTenantWebhooks advances the webhook cursor over the next batch
+// of outbox events, whatever their processing status, and creates a delivery
+// for every active endpoint subscribed to each event of eventTypes. Marking and
+// enqueuing happen in one statement, so a batch is never half done. It returns
+// how many events were scanned and how many deliveries were created; enqueuing
+// the same event twice is a no-op.
+func (q *Queries) FanOutOutboxToTenantWebhooks(ctx context.Context, eventTypes []string, limit int32) (int64, int64, error) {
+	const query = `
+		WITH due AS (
+			SELECT id
+			FROM outbox
+			WHERE webhooks_enqueued_at IS NULL
+			ORDER BY created_at
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		), marked AS (
+			UPDATE outbox o
+			SET webhooks_enqueued_at = NOW()
+			FROM due
+			WHERE o.id = due.id
+			RETURNING o.id, o.tenant_id, o.event_type, o.payload, COALESCE(o.created_at, NOW()) AS created_at
+		), queued AS (
+			INSERT INTO tenant_webhook_deliveries (tenant_id, subscription_id, event_id, event_type, payload)
+			SELECT s.tenant_id, s.id, m.id, m.event_type, jsonb_build_object(
+				'id', m.id::text,
+				'type', m.event_type,
+				'tenant_id', m.tenant_id::text,
+				'occurred_at', to_char(m.created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS"Z"'),
+				'data', m.payload
+			)
+			FROM marked m
+			JOIN tenant_webhook_subscriptions s
+			  ON s.tenant_id = m.tenant_id AND s.status = 'active' AND m.event_type = ANY(s.events)
+			WHERE m.event_type = ANY($1::text[])
+			ON CONFLICT (subscription_id, event_id) DO NOTHING
+			RETURNING 1
+		)
+		SELECT (SELECT COUNT(*) FROM marked), (SELECT COUNT(*) FROM queued)
+	`
+	var scanned, queued int64
+	err := q.db.QueryRow(ctx, query, eventTypes, limit).Scan(&scanned, &queued)
+	return scanned, queued, err
+}
+
+// TenantWebhookDelivery is one event queued for one endpoint.
+type TenantWebhookDelivery struct {
+	ID                 pgtype.UUID        `json:"id"`
+	TenantID           pgtype.UUID        `json:"tenant_id"`
+	SubscriptionID     pgtype.UUID        `json:"subscription_id"`
+	EventID            pgtype.UUID        `json:"event_id"`
+	EventType          string             `json:"event_type"`
+	Payload            []byte             `json:"-"`
+	Status             string             `json:"status"`
+	Attempts           int32              `json:"attempts"`
+	NextAttemptAt      pgtype.Timestamptz `json:"next_attempt_at"`
+	LastResponseStatus pgtype.Int4        `json:"last_response_status"`
+	LastError          pgtype.Text        `json:"last_error"`
+	DeliveredAt        pgtype.Timestamptz `json:"delivered_at"`
+	CreatedAt          pgtype.Timestamptz `json:"created_at"`
+}
+
+const tenantWebhookDeliveryColumns = `
+	d.id, d.tenant_id, d.subscription_id, d.event_id, d.event_type, d.payload, d.status, d.attempts,
+	d.next_attempt_at, d.last_response_status, d.last_error, d.delivered_at, d.created_at`
+
+func scanTenantWebhookDelivery(row pgx.Row, extra ...any) (TenantWebhookDelivery, error) {
+	var d TenantWebhookDelivery
+	dest := []any{
+		&d.ID, &d.TenantID, &d.SubscriptionID, &d.EventID, &d.EventType, &d.Payload, &d.Status, &d.Attempts,
+		&d.NextAttemptAt, &d.LastResponseStatus, &d.LastError, &d.DeliveredAt, &d.CreatedAt,
+	}
+	err := row.Scan(append(dest, extra...)...)
+	return d, err
+}
+
+// TenantWebhookDispatch is a delivery together with where and how to send it.
+type TenantWebhookDispatch struct {
+	Delivery  TenantWebhookDelivery
+	TargetURL string
+	SecretEnc string
+}
+
+// ClaimDueTenantWebhookDeliveries takes pending deliveries of active endpoints
+// whose next attempt is due, counts the attempt and pushes next_attempt_at out
+// by leaseSeconds so a crashed worker's claim expires on its own.
+func (q *Queries) ClaimDueTenantWebhookDeliveries(ctx context.Context, limit, leaseSeconds int32) ([]TenantWebhookDispatch, error) {
+	query := `
+		WITH due AS (
+			SELECT d.id
+			FROM tenant_webhook_deliveries d
+			JOIN tenant_webhook_subscriptions s ON s.id = d.subscription_id
+			WHERE d.status = 'pending' AND d.next_attempt_at <= NOW() AND s.status = 'active'
+			ORDER BY d.next_attempt_at
+			LIMIT $1
+			FOR UPDATE OF d SKIP LOCKED
+		)
+		UPDATE tenant_webhook_deliveries d
+		SET attempts = d.attempts + 1,
+		    next_attempt_at = NOW() + make_interval(secs => $2),
+		    updated_at = NOW()
+		FROM due, tenant_webhook_subscriptions s
+		WHERE d.id = due.id AND s.id = d.subscription_id
+		RETURNING ` + tenantWebhookDeliveryColumns + `, s.target_url, s.secret_enc
+	`
+	rows, err := q.db.Query(ctx, query, limit, leaseSeconds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []TenantWebhookDispatch
+	for rows.Next() {
+		var dispatch TenantWebhookDispatch
+		dispatch.Delivery, err = scanTenantWebhookDelivery(rows, &dispatch.TargetURL, &dispatch.SecretEnc)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, dispatch)
+	}
+	return out, rows.Err()
+}
+
+// GetTenantWebhookDispatch loads a delivery of an endpoint for redelivery.
+func (q *Queries) GetTenantWebhookDispatch(ctx context.Context, tenantID, subscriptionID, deliveryID pgtype.UUID) (TenantWebhookDispatch, error) {
+	query := `
+		SELECT ` + tenantWebhookDeliveryColumns + `, s.target_url, s.secret_enc
+		FROM tenant_webhook_deliveries d
+		JOIN tenant_webhook_subscriptions s ON s.id = d.subscription_id
+		WHERE d.tenant_id = $1 AND d.subscription_id = $2 AND d.id = $3
+	`
+	var dispatch TenantWebhookDispatch
+	var err error
+	dispatch.Delivery, err = scanTenantWebhookDelivery(
+		q.db.QueryRow(ctx, query, tenantID, subscriptionID, deliveryID),
+		&dispatch.TargetURL, &dispatch.SecretEnc,
+	)
+	return dispatch, err
+}
+
+type ListTenantWebhookDeliveriesParams struct {
+	TenantID       pgtype.UUID
+	SubscriptionID pgtype.UUID
+	Status         string
+	Limit          int32
+	Offset         int32
+}
+
+// ListTenantWebhookDeliveries is the delivery log of an endpoint, newest first.
+func (q *Queries) ListTenantWebhookDeliveries(ctx context.Context, arg ListTenantWebhookDeliveriesParams) ([]TenantWebhookDelivery, error) {
+	query := `
+		SELECT ` + tenantWebhookDeliveryColumns + `
+		FROM tenant_webhook_deliveries d
+		WHERE d.tenant_id = $1 AND d.subscription_id = $2
+		  AND ($3 = '' OR d.status = $3)
+		ORDER BY d.created_at DESC
+		LIMIT $4 OFFSET $5
+	`
+	rows, err := q.db.Query(ctx, query, arg.TenantID, arg.SubscriptionID, arg.Status, arg.Limit, arg.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []TenantWebhookDelivery
+	for rows.Next() {
+		d, err := scanTenantWebhookDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+type TenantWebhookAttemptResult struct {
+	DeliveryID     pgtype.UUID
+	Attempt        int32
+	ResponseStatus pgtype.Int4
+	ResponseBody   pgtype.Text
+	Error          pgtype.Text
+	DurationMS     int32
+	Manual         bool
+	// Status and NextAttemptAt are the delivery's state after the attempt.
+	Status        string
+	NextAttemptAt pgtype.Timestamptz
+}
+
+// RecordTenantWebhookAttempt logs an attempt and moves the delivery to the
+// state it left it in.
+func (q *Queries) RecordTenantWebhookAttempt(ctx context.Context, arg TenantWebhookAttemptResult) error {
+	const query = `
+		WITH logged AS (
+			INSERT INTO tenant_webhook_delivery_attempts (
+				delivery_id, attempt, response_status, response_body, error, duration_ms, manual
+			) VALUES ($1, $2, $3, $4, $5, $6, $7)
+		)
+		UPDATE tenant_webhook_deliveries
+		SET status = $8,
+		    next_attempt_at = COALESCE($9, next_attempt_at),
+		    last_response_status = $3,
+		    last_error = $5,
+		    delivered_at = CASE WHEN $8 = 'succeeded' THEN NOW() ELSE delivered_at END,
+		    updated_at = NOW()
+		WHERE id = $1
+	`
+	_, err := q.db.Exec(ctx, query,
+		arg.DeliveryID, arg.Attempt, arg.ResponseStatus, arg.ResponseBody, arg.Error, arg.DurationMS, arg.Manual,
+		arg.Status, arg.NextAttemptAt,
+	)
+	return err
+}
+
+type TenantWebhookDeliveryAttempt struct {
+	ID             pgtype.UUID        `json:"id"`
+	Attempt        int32              `json:"attempt"`
+	ResponseStatus pgtype.Int4        `json:"response_status"`
+	ResponseBody   pgtype.Text        `json:"response_body"`
+	Error          pgtype.Text        `json:"error"`
+	DurationMS     int32              `json:"duration_ms"`
+	Manual         bool               `json:"manual"`
+	CreatedAt      pgtype.Timestamptz `json:"created_at"`
+}
+
+func (q *Queries) ListTenantWebhookDeliveryAttempts(ctx context.Context, deliveryID pgtype.UUID) ([]TenantWebhookDeliveryAttempt, error) {
+	const query = `
+		SELECT id, attempt, response_status, response_body, error, duration_ms, manual, created_at
+		FROM tenant_webhook_delivery_attempts
+		WHERE delivery_id = $1
+		ORDER BY created_at
+	`
+	rows, err := q.db.Query(ctx, query, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []TenantWebhookDeliveryAttempt
+	for rows.Next() {
+		var a TenantWebhookDeliveryAttempt
+		if err := rows.Scan(&a.ID, &a.Attempt, &a.ResponseStatus, &a.ResponseBody, &a.Error, &a.DurationMS, &a.Manual, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
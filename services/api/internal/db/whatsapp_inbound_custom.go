@@ -0,0 +1,45 @@
+package db
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// ResolveWhatsAppInboundTenant finds the active tenant whose notification
+// gateway settings name the WhatsApp phone-number id a message was sent to.
+func (q *Queries) ResolveWhatsAppInboundTenant(ctx context.Context, phoneNumberID string) (pgtype.UUID, error) {
+	const query = `
+		SELECT t.id
+		FROM notification_gateway_configs g
+		JOIN tenants t ON t.id = g.tenant_id
+		WHERE g.settings->>'whatsapp_phone_number_id' = $1
+		  AND t.is_active = TRUE
+	`
+	var tenantID pgtype.UUID
+	err := q.db.QueryRow(ctx, query, phoneNumberID).Scan(&tenantID)
+	return tenantID, err
+}
+
+// ClaimWhatsAppInboundMessage records a provider message id for the tenant.
+// It reports false when the message has been seen before.
+func (q *Queries) ClaimWhatsAppInboundMessage(ctx context.Context, tenantID pgtype.UUID, messageID string) (bool, error) {
+	const query = `
+		INSERT INTO whatsapp_inbound_messages (tenant_id, message_id)
+		VALUES ($1, $2)
+		ON CONFLICT (tenant_id, message_id) DO NOTHING
+	`
+	tag, err := q.db.Exec(ctx, query, tenantID, messageID)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// ReleaseWhatsAppInboundMessage forgets a claimed message id so that the
+// gateway's retry is answered after a failure.
+func (q *Queries) ReleaseWhatsAppInboundMessage(ctx context.Context, tenantID pgtype.UUID, messageID string) error {
+	const query = `DELETE FROM whatsapp_inbound_messages WHERE tenant_id = $1 AND message_id = $2`
+	_, err := q.db.Exec(ctx, query, tenantID, messageID)
+	return err
+}
@@ -47,6 +47,12 @@ func NewClient(provider Provider, apiKey string) *Client {
 	}
 }
 
+// SetBaseURL points the client at a provider-compatible gateway or a test
+// server.
+func (c *Client) SetBaseURL(baseURL string) {
+	c.baseURL = strings.TrimRight(baseURL, "/")
+}
+
 func (c *Client) GetProvider() Provider {
 	return c.provider
 }
@@ -0,0 +1,489 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// DefaultMaxToolRounds bounds how many times the model may ask for tools
+// before ChatWithTools gives up, so a confused model cannot loop forever.
+const DefaultMaxToolRounds = 4
+
+// Tool describes a function the model may call. Parameters is a JSON Schema
+// object; keep it to the subset every provider accepts (type, properties,
+// required, description, enum).
+type Tool struct {
+	Name        string
+	Description string
+	Parameters  map[string]interface{}
+}
+
+type ToolCall struct {
+	ID        string
+	Name      string
+	Arguments json.RawMessage
+}
+
+// ToolHandler executes one tool call and returns its result, usually JSON.
+// An error is reported back to the model as the tool result rather than
+// aborting the conversation, so the model can explain it to the user.
+type ToolHandler func(ctx context.Context, call ToolCall) (string, error)
+
+type ToolInvocation struct {
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments"`
+	Error     string          `json:"error,omitempty"`
+}
+
+type ToolChatResult struct {
+	Content     string
+	Invocations []ToolInvocation
+}
+
+// toolTurn is the provider-neutral transcript of a tool conversation. Each
+// provider renders it into its own wire format on every round.
+type toolTurn struct {
+	role    string // system, user, assistant or tool
+	content string
+	calls   []ToolCall
+	callID  string
+	name    string
+	isError bool
+}
+
+// ChatWithTools runs a chat in which the model may call tools. Calls are
+// executed through handler and their results fed back until the model
+// answers in text or DefaultMaxToolRounds is exhausted.
+func (c *Client) ChatWithTools(ctx context.Context, req ChatRequest, tools []Tool, handler ToolHandler) (ToolChatResult, error) {
+	if len(tools) == 0 {
+		content, err := c.Chat(ctx, req)
+		return ToolChatResult{Content: content}, err
+	}
+
+	turns := make([]toolTurn, 0, len(req.Messages)+4)
+	for _, m := range req.Messages {
+		turns = append(turns, toolTurn{role: m.Role, content: m.Content})
+	}
+
+	var result ToolChatResult
+	for round := 0; round < DefaultMaxToolRounds; round++ {
+		var (
+			text  string
+			calls []ToolCall
+			err   error
+		)
+		switch c.provider {
+		case ProviderOpenAI:
+			text, calls, err = c.toolStepOpenAI(ctx, req, turns, tools)
+		case ProviderAnthropic:
+			text, calls, err = c.toolStepAnthropic(ctx, req, turns, tools)
+		case ProviderGemini:
+			text, calls, err = c.toolStepGemini(ctx, req, turns, tools, round)
+		default:
+			err = fmt.Errorf("unsupported provider: %s", c.provider)
+		}
+		if err != nil {
+			return result, err
+		}
+		if len(calls) == 0 {
+			if strings.TrimSpace(text) == "" {
+				return result, fmt.Errorf("no text content returned from %s", c.provider)
+			}
+			result.Content = text
+			return result, nil
+		}
+
+		for i := range calls {
+			if len(calls[i].Arguments) == 0 || !json.Valid(calls[i].Arguments) {
+				calls[i].Arguments = json.RawMessage("{}")
+			}
+		}
+		turns = append(turns, toolTurn{role: "assistant", content: text, calls: calls})
+		for _, call := range calls {
+			inv := ToolInvocation{Name: call.Name, Arguments: call.Arguments}
+			output, err := handler(ctx, call)
+			if err != nil {
+				inv.Error = err.Error()
+				errJSON, _ := json.Marshal(map[string]string{"error": err.Error()})
+				output = string(errJSON)
+			}
+			result.Invocations = append(result.Invocations, inv)
+			turns = append(turns, toolTurn{role: "tool", content: output, callID: call.ID, name: call.Name, isError: err != nil})
+		}
+	}
+	return result, fmt.Errorf("%s did not answer within %d tool rounds", c.provider, DefaultMaxToolRounds)
+}
+
+func (c *Client) postJSON(ctx context.Context, endpoint string, payload interface{}, headers map[string]string, out interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		httpReq.Header.Set(k, v)
+	}
+
+	resp, err := c.http.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("%s error (status %d): %s", c.provider, resp.StatusCode, string(respBody))
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// OpenAI
+
+type openAIToolMessage struct {
+	Role       string           `json:"role"`
+	Content    *string          `json:"content"`
+	ToolCalls  []openAIToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string           `json:"tool_call_id,omitempty"`
+}
+
+type openAIToolCall struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+type openAIFunctionTool struct {
+	Type     string `json:"type"`
+	Function struct {
+		Name        string                 `json:"name"`
+		Description string                 `json:"description,omitempty"`
+		Parameters  map[string]interface{} `json:"parameters"`
+	} `json:"function"`
+}
+
+type openAIToolRequest struct {
+	Model       string               `json:"model"`
+	Messages    []openAIToolMessage  `json:"messages"`
+	Tools       []openAIFunctionTool `json:"tools,omitempty"`
+	Temperature float64              `json:"temperature,omitempty"`
+	MaxTokens   int                  `json:"max_tokens,omitempty"`
+}
+
+type openAIToolResponse struct {
+	Choices []struct {
+		Message struct {
+			Content   *string          `json:"content"`
+			ToolCalls []openAIToolCall `json:"tool_calls"`
+		} `json:"message"`
+	} `json:"choices"`
+}
+
+func (c *Client) toolStepOpenAI(ctx context.Context, req ChatRequest, turns []toolTurn, tools []Tool) (string, []ToolCall, error) {
+	model := req.Model
+	if model == "" {
+		model = "gpt-4o-mini"
+	}
+	apiReq := openAIToolRequest{Model: model, Temperature: req.Temperature, MaxTokens: req.MaxTokens}
+	for _, t := range tools {
+		var ft openAIFunctionTool
+		ft.Type = "function"
+		ft.Function.Name = t.Name
+		ft.Function.Description = t.Description
+		ft.Function.Parameters = toolParameters(t)
+		apiReq.Tools = append(apiReq.Tools, ft)
+	}
+	for _, t := range turns {
+		content := t.content
+		msg := openAIToolMessage{Role: t.role, Content: &content}
+		switch t.role {
+		case "assistant":
+			if content == "" && len(t.calls) > 0 {
+				msg.Content = nil
+			}
+			for _, call := range t.calls {
+				var oc openAIToolCall
+				oc.ID = call.ID
+				oc.Type = "function"
+				oc.Function.Name = call.Name
+				oc.Function.Arguments = string(call.Arguments)
+				msg.ToolCalls = append(msg.ToolCalls, oc)
+			}
+		case "tool":
+			msg.ToolCallID = t.callID
+		}
+		apiReq.Messages = append(apiReq.Messages, msg)
+	}
+
+	var resp openAIToolResponse
+	if err := c.postJSON(ctx, c.baseURL+"/chat/completions", apiReq, map[string]string{"Authorization": "Bearer " + c.apiKey}, &resp); err != nil {
+		return "", nil, err
+	}
+	if len(resp.Choices) == 0 {
+		return "", nil, fmt.Errorf("no choices returned from openai")
+	}
+
+	msg := resp.Choices[0].Message
+	text := ""
+	if msg.Content != nil {
+		text = *msg.Content
+	}
+	calls := make([]ToolCall, 0, len(msg.ToolCalls))
+	for _, tc := range msg.ToolCalls {
+		calls = append(calls, ToolCall{ID: tc.ID, Name: tc.Function.Name, Arguments: json.RawMessage(tc.Function.Arguments)})
+	}
+	return text, calls, nil
+}
+
+// Anthropic
+
+type anthropicToolMessage struct {
+	Role    string                   `json:"role"`
+	Content []map[string]interface{} `json:"content"`
+}
+
+type anthropicTool struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	InputSchema map[string]interface{} `json:"input_schema"`
+}
+
+type anthropicToolRequest struct {
+	Model       string                 `json:"model"`
+	System      string                 `json:"system,omitempty"`
+	Messages    []anthropicToolMessage `json:"messages"`
+	Tools       []anthropicTool        `json:"tools,omitempty"`
+	MaxTokens   int                    `json:"max_tokens"`
+	Temperature float64                `json:"temperature,omitempty"`
+}
+
+type anthropicToolResponse struct {
+	Content []struct {
+		Type  string          `json:"type"`
+		Text  string          `json:"text"`
+		ID    string          `json:"id"`
+		Name  string          `json:"name"`
+		Input json.RawMessage `json:"input"`
+	} `json:"content"`
+}
+
+func (c *Client) toolStepAnthropic(ctx context.Context, req ChatRequest, turns []toolTurn, tools []Tool) (string, []ToolCall, error) {
+	model := req.Model
+	if model == "" {
+		model = "claude-3-5-haiku-latest"
+	}
+	maxTokens := req.MaxTokens
+	if maxTokens <= 0 {
+		maxTokens = 1024
+	}
+	apiReq := anthropicToolRequest{Model: model, MaxTokens: maxTokens, Temperature: req.Temperature}
+	for _, t := range tools {
+		apiReq.Tools = append(apiReq.Tools, anthropicTool{Name: t.Name, Description: t.Description, InputSchema: toolParameters(t)})
+	}
+
+	var system []string
+	for _, t := range turns {
+		var role string
+		var blocks []map[string]interface{}
+		switch t.role {
+		case "system":
+			system = append(system, t.content)
+			continue
+		case "assistant":
+			role = "assistant"
+			if t.content != "" {
+				blocks = append(blocks, map[string]interface{}{"type": "text", "text": t.content})
+			}
+			for _, call := range t.calls {
+				blocks = append(blocks, map[string]interface{}{"type": "tool_use", "id": call.ID, "name": call.Name, "input": call.Arguments})
+			}
+		case "tool":
+			role = "user"
+			blocks = append(blocks, map[string]interface{}{"type": "tool_result", "tool_use_id": t.callID, "content": t.content, "is_error": t.isError})
+		default:
+			role = "user"
+			blocks = append(blocks, map[string]interface{}{"type": "text", "text": t.content})
+		}
+		// Consecutive turns from the same side are merged; this is how
+		// several tool results answer one assistant message.
+		if n := len(apiReq.Messages); n > 0 && apiReq.Messages[n-1].Role == role {
+			apiReq.Messages[n-1].Content = append(apiReq.Messages[n-1].Content, blocks...)
+			continue
+		}
+		apiReq.Messages = append(apiReq.Messages, anthropicToolMessage{Role: role, Content: blocks})
+	}
+	apiReq.System = strings.Join(system, "\n\n")
+
+	var resp anthropicToolResponse
+	headers := map[string]string{"x-api-key": c.apiKey, "anthropic-version": "2023-06-01"}
+	if err := c.postJSON(ctx, c.baseURL+"/messages", apiReq, headers, &resp); err != nil {
+		return "", nil, err
+	}
+
+	var text []string
+	var calls []ToolCall
+	for _, part := range resp.Content {
+		switch part.Type {
+		case "text":
+			if part.Text != "" {
+				text = append(text, part.Text)
+			}
+		case "tool_use":
+			calls = append(calls, ToolCall{ID: part.ID, Name: part.Name, Arguments: part.Input})
+		}
+	}
+	return strings.Join(text, "\n"), calls, nil
+}
+
+// Gemini
+
+type geminiToolPart struct {
+	Text             string                  `json:"text,omitempty"`
+	FunctionCall     *geminiFunctionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *geminiFunctionResponse `json:"functionResponse,omitempty"`
+}
+
+type geminiFunctionCall struct {
+	Name string          `json:"name"`
+	Args json.RawMessage `json:"args,omitempty"`
+}
+
+type geminiFunctionResponse struct {
+	Name     string                 `json:"name"`
+	Response map[string]interface{} `json:"response"`
+}
+
+type geminiToolContent struct {
+	Role  string           `json:"role,omitempty"`
+	Parts []geminiToolPart `json:"parts"`
+}
+
+type geminiFunctionDeclaration struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	Parameters  map[string]interface{} `json:"parameters,omitempty"`
+}
+
+type geminiToolRequest struct {
+	SystemInstruction *geminiToolContent  `json:"systemInstruction,omitempty"`
+	Contents          []geminiToolContent `json:"contents"`
+	Tools             []struct {
+		FunctionDeclarations []geminiFunctionDeclaration `json:"functionDeclarations"`
+	} `json:"tools,omitempty"`
+	GenerationConfig struct {
+		Temperature     float64 `json:"temperature,omitempty"`
+		MaxOutputTokens int     `json:"maxOutputTokens,omitempty"`
+	} `json:"generationConfig,omitempty"`
+}
+
+type geminiToolResponse struct {
+	Candidates []struct {
+		Content geminiToolContent `json:"content"`
+	} `json:"candidates"`
+}
+
+func (c *Client) toolStepGemini(ctx context.Context, req ChatRequest, turns []toolTurn, tools []Tool, round int) (string, []ToolCall, error) {
+	model := strings.TrimSpace(req.Model)
+	if model == "" {
+		model = "gemini-1.5-flash"
+	}
+	apiReq := geminiToolRequest{}
+	apiReq.GenerationConfig.Temperature = req.Temperature
+	apiReq.GenerationConfig.MaxOutputTokens = req.MaxTokens
+	if apiReq.GenerationConfig.MaxOutputTokens <= 0 {
+		apiReq.GenerationConfig.MaxOutputTokens = 1024
+	}
+	if len(tools) > 0 {
+		decls := make([]geminiFunctionDeclaration, 0, len(tools))
+		for _, t := range tools {
+			decls = append(decls, geminiFunctionDeclaration{Name: t.Name, Description: t.Description, Parameters: toolParameters(t)})
+		}
+		apiReq.Tools = []struct {
+			FunctionDeclarations []geminiFunctionDeclaration `json:"functionDeclarations"`
+		}{{FunctionDeclarations: decls}}
+	}
+
+	var system []string
+	for _, t := range turns {
+		var role string
+		var parts []geminiToolPart
+		switch t.role {
+		case "system":
+			system = append(system, t.content)
+			continue
+		case "assistant":
+			role = "model"
+			if t.content != "" {
+				parts = append(parts, geminiToolPart{Text: t.content})
+			}
+			for _, call := range t.calls {
+				parts = append(parts, geminiToolPart{FunctionCall: &geminiFunctionCall{Name: call.Name, Args: call.Arguments}})
+			}
+		case "tool":
+			role = "user"
+			var decoded interface{}
+			if err := json.Unmarshal([]byte(t.content), &decoded); err != nil {
+				decoded = t.content
+			}
+			parts = append(parts, geminiToolPart{FunctionResponse: &geminiFunctionResponse{Name: t.name, Response: map[string]interface{}{"content": decoded}}})
+		default:
+			role = "user"
+			parts = append(parts, geminiToolPart{Text: t.content})
+		}
+		if n := len(apiReq.Contents); n > 0 && apiReq.Contents[n-1].Role == role {
+			apiReq.Contents[n-1].Parts = append(apiReq.Contents[n-1].Parts, parts...)
+			continue
+		}
+		apiReq.Contents = append(apiReq.Contents, geminiToolContent{Role: role, Parts: parts})
+	}
+	if len(system) > 0 {
+		apiReq.SystemInstruction = &geminiToolContent{Parts: []geminiToolPart{{Text: strings.Join(system, "\n\n")}}}
+	}
+
+	endpoint := fmt.Sprintf("%s/models/%s:generateContent?key=%s", c.baseURL, url.PathEscape(model), url.QueryEscape(c.apiKey))
+	var resp geminiToolResponse
+	if err := c.postJSON(ctx, endpoint, apiReq, nil, &resp); err != nil {
+		return "", nil, err
+	}
+	if len(resp.Candidates) == 0 {
+		return "", nil, fmt.Errorf("no candidates returned from gemini")
+	}
+
+	var text []string
+	var calls []ToolCall
+	for i, part := range resp.Candidates[0].Content.Parts {
+		if part.FunctionCall != nil {
+			// Gemini does not issue call ids; results are matched by name
+			// and order, so a positional id is enough for the transcript.
+			calls = append(calls, ToolCall{
+				ID:        fmt.Sprintf("gemini-%d-%d", round, i),
+				Name:      part.FunctionCall.Name,
+				Arguments: part.FunctionCall.Args,
+			})
+			continue
+		}
+		if strings.TrimSpace(part.Text) != "" {
+			text = append(text, part.Text)
+		}
+	}
+	return strings.Join(text, "\n"), calls, nil
+}
+
+func toolParameters(t Tool) map[string]interface{} {
+	if t.Parameters != nil {
+		return t.Parameters
+	}
+	return map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+}
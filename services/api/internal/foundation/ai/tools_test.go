@@ -0,0 +1,103 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// fakeToolServer answers the first request with a tool call and the second
+// with text, recording both request bodies.
+func fakeToolServer(t *testing.T, first, second string) (*httptest.Server, *[]string) {
+	t.Helper()
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		w.Header().Set("Content-Type", "application/json")
+		if len(bodies) == 1 {
+			_, _ = w.Write([]byte(first))
+			return
+		}
+		_, _ = w.Write([]byte(second))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &bodies
+}
+
+func TestChatWithToolsRoundTripsEachProvider(t *testing.T) {
+	cases := []struct {
+		provider Provider
+		first    string
+		second   string
+		wantArgs string
+		wantEcho string
+	}{
+		{
+			provider: ProviderOpenAI,
+			first:    `{"choices":[{"message":{"content":null,"tool_calls":[{"id":"call_1","type":"function","function":{"name":"get_fee_summary","arguments":"{\"student_name\":\"Asha\"}"}}]}}]}`,
+			second:   `{"choices":[{"message":{"content":"Asha owes Rs 1200."}}]}`,
+			wantArgs: `{"student_name":"Asha"}`,
+			wantEcho: `"tool_call_id":"call_1"`,
+		},
+		{
+			provider: ProviderAnthropic,
+			first:    `{"content":[{"type":"text","text":"Checking."},{"type":"tool_use","id":"toolu_1","name":"get_fee_summary","input":{"student_name":"Asha"}}]}`,
+			second:   `{"content":[{"type":"text","text":"Asha owes Rs 1200."}]}`,
+			wantArgs: `{"student_name":"Asha"}`,
+			wantEcho: `"tool_use_id":"toolu_1"`,
+		},
+		{
+			provider: ProviderGemini,
+			first:    `{"candidates":[{"content":{"role":"model","parts":[{"functionCall":{"name":"get_fee_summary","args":{"student_name":"Asha"}}}]}}]}`,
+			second:   `{"candidates":[{"content":{"role":"model","parts":[{"text":"Asha owes Rs 1200."}]}}]}`,
+			wantArgs: `{"student_name":"Asha"}`,
+			wantEcho: `"functionResponse":{"name":"get_fee_summary"`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(string(tc.provider), func(t *testing.T) {
+			srv, bodies := fakeToolServer(t, tc.first, tc.second)
+			c := NewClient(tc.provider, "test-key")
+			c.baseURL = srv.URL
+
+			var gotArgs string
+			result, err := c.ChatWithTools(context.Background(), ChatRequest{
+				Messages: []Message{
+					{Role: "system", Content: "You are a helpdesk."},
+					{Role: "user", Content: "What are Asha's dues?"},
+				},
+			}, []Tool{{Name: "get_fee_summary", Description: "Fee dues"}}, func(_ context.Context, call ToolCall) (string, error) {
+				gotArgs = string(call.Arguments)
+				return `{"outstanding":"1200.00"}`, nil
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result.Content != "Asha owes Rs 1200." {
+				t.Fatalf("unexpected content %q", result.Content)
+			}
+			if len(result.Invocations) != 1 || result.Invocations[0].Name != "get_fee_summary" {
+				t.Fatalf("unexpected invocations %#v", result.Invocations)
+			}
+
+			var got interface{}
+			_ = json.Unmarshal([]byte(gotArgs), &got)
+			if gotJSON, _ := json.Marshal(got); string(gotJSON) != tc.wantArgs {
+				t.Fatalf("unexpected arguments %s", gotArgs)
+			}
+
+			if len(*bodies) != 2 {
+				t.Fatalf("expected 2 requests, got %d", len(*bodies))
+			}
+			if !strings.Contains((*bodies)[1], tc.wantEcho) || !strings.Contains((*bodies)[1], "1200.00") {
+				t.Fatalf("tool result not sent back: %s", (*bodies)[1])
+			}
+		})
+	}
+}
@@ -0,0 +1,245 @@
+// Package apikeys defines the credentials tenants issue to integrations and
+// the scopes those credentials may be granted. A scope opens a set of admin
+// routes and carries the permissions their handlers check, so a key never
+// reaches a route its scopes do not name.
+package apikeys
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+)
+
+const (
+	// ServiceAccountRole is the role of requests made with an API client.
+	ServiceAccountRole = "service_account"
+
+	// ClientIDPrefix starts every public client id.
+	ClientIDPrefix = "serp_"
+	// TokenPrefix starts every access token from the client-credentials grant.
+	TokenPrefix = "sat_"
+)
+
+var ErrInvalidScope = errors.New("invalid api scope")
+
+// Scope is a grant an API client can hold.
+type Scope struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Methods     []string `json:"methods"`
+	Paths       []string `json:"paths"`
+	Permissions []string `json:"permissions"`
+}
+
+// Scopes is the catalogue of grants. Paths match themselves and everything
+// below them; deletes are deliberately not exposed to integrations.
+var Scopes = []Scope{
+	{
+		Name:        "students:read",
+		Description: "Read students, guardians and class structure",
+		Methods:     []string{"GET"},
+		Paths:       []string{"/v1/admin/students", "/v1/admin/academic-structure"},
+		Permissions: []string{"sis:read"},
+	},
+	{
+		Name:        "students:write",
+		Description: "Create and update students and guardians",
+		Methods:     []string{"POST", "PUT", "PATCH"},
+		Paths:       []string{"/v1/admin/students"},
+		Permissions: []string{"sis:write"},
+	},
+	{
+		Name:        "attendance:read",
+		Description: "Read attendance sessions and summaries",
+		Methods:     []string{"GET"},
+		Paths:       []string{"/v1/admin/attendance"},
+		Permissions: []string{"attendance:read"},
+	},
+	{
+		Name:        "attendance:write",
+		Description: "Mark attendance",
+		Methods:     []string{"POST", "PUT"},
+		Paths:       []string{"/v1/admin/attendance"},
+		Permissions: []string{"attendance:write"},
+	},
+	{
+		Name:        "fees:read",
+		Description: "Read fee structures, invoices and receipts",
+		Methods:     []string{"GET"},
+		Paths:       []string{"/v1/admin/fees"},
+		Permissions: []string{"fees:read", "finance:read"},
+	},
+	{
+		Name:        "exams:read",
+		Description: "Read exams and results",
+		Methods:     []string{"GET"},
+		Paths:       []string{"/v1/admin/exams"},
+		Permissions: []string{},
+	},
+	{
+		Name:        "transport:read",
+		Description: "Read vehicles, drivers, routes and allocations",
+		Methods:     []string{"GET"},
+		Paths:       []string{"/v1/admin/transport"},
+		Permissions: []string{},
+	},
+	{
+		Name:        "transport:write",
+		Description: "Update transport records and send GPS pings, e.g. from a fleet vendor's app",
+		Methods:     []string{"POST", "PUT", "PATCH"},
+		Paths:       []string{"/v1/admin/transport"},
+		Permissions: []string{},
+	},
+	{
+		Name:        "library:read",
+		Description: "Read the library catalogue and circulation",
+		Methods:     []string{"GET"},
+		Paths:       []string{"/v1/admin/library"},
+		Permissions: []string{},
+	},
+}
+
+// Lookup returns the scope with the given name.
+func Lookup(name string) (Scope, bool) {
+	for _, s := range Scopes {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return Scope{}, false
+}
+
+// NormalizeScopes lower-cases and de-duplicates scope names and rejects
+// unknown ones. At least one scope is required.
+func NormalizeScopes(names []string) ([]string, error) {
+	out := make([]string, 0, len(names))
+	for _, n := range names {
+		n = strings.ToLower(strings.TrimSpace(n))
+		if n == "" {
+			continue
+		}
+		if _, ok := Lookup(n); !ok {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidScope, n)
+		}
+		if !slices.Contains(out, n) {
+			out = append(out, n)
+		}
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("%w: at least one scope is required", ErrInvalidScope)
+	}
+	return out, nil
+}
+
+// Allows reports whether any granted scope covers the request. Paths with
+// dot segments are refused rather than resolved.
+func Allows(granted []string, method, reqPath string) bool {
+	method = strings.ToUpper(method)
+	if method == "HEAD" {
+		method = "GET"
+	}
+	reqPath = "/" + strings.Trim(reqPath, "/")
+	if path.Clean(reqPath) != reqPath {
+		return false
+	}
+	for _, name := range granted {
+		s, ok := Lookup(name)
+		if !ok || !slices.Contains(s.Methods, method) {
+			continue
+		}
+		for _, p := range s.Paths {
+			if reqPath == p || strings.HasPrefix(reqPath, p+"/") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Permissions returns the permission codes carried by the granted scopes.
+func Permissions(granted []string) []string {
+	var out []string
+	for _, name := range granted {
+		s, ok := Lookup(name)
+		if !ok {
+			continue
+		}
+		for _, p := range s.Permissions {
+			if !slices.Contains(out, p) {
+				out = append(out, p)
+			}
+		}
+	}
+	return out
+}
+
+// Principal is an authenticated API client.
+type Principal struct {
+	ClientID           string
+	ClientKey          string
+	Name               string
+	TenantID           string
+	ServiceUserID      string
+	Scopes             []string
+	RateLimitPerMinute int
+}
+
+// NewClientID returns a public client id.
+func NewClientID() (string, error) {
+	raw := make([]byte, 12)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return ClientIDPrefix + hex.EncodeToString(raw), nil
+}
+
+// NewSecret returns a client secret.
+func NewSecret() (string, error) {
+	return randomToken("")
+}
+
+// NewAccessToken returns a bearer token for the client-credentials grant.
+func NewAccessToken() (string, error) {
+	return randomToken(TokenPrefix)
+}
+
+func randomToken(prefix string) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return prefix + base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// Hash is how secrets and tokens are stored. They are random and long, so a
+// plain SHA-256 is enough.
+func Hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// APIKey is the single-header form of a credential: "<client_id>.<secret>".
+func APIKey(clientID, secret string) string {
+	return clientID + "." + secret
+}
+
+// SplitAPIKey separates an API key into client id and secret.
+func SplitAPIKey(key string) (string, string, bool) {
+	clientID, secret, ok := strings.Cut(strings.TrimSpace(key), ".")
+	if !ok || !strings.HasPrefix(clientID, ClientIDPrefix) || secret == "" {
+		return "", "", false
+	}
+	return clientID, secret, true
+}
+
+// IsAccessToken reports whether a bearer token came from the
+// client-credentials grant rather than an interactive login.
+func IsAccessToken(token string) bool {
+	return strings.HasPrefix(token, TokenPrefix)
+}
@@ -0,0 +1,78 @@
+package apikeys
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestNormalizeScopes(t *testing.T) {
+	got, err := NormalizeScopes([]string{" Students:Read ", "students:read", "", "fees:read"})
+	if err != nil {
+		t.Fatalf("expected scopes to normalize: %v", err)
+	}
+	if !slices.Equal(got, []string{"students:read", "fees:read"}) {
+		t.Fatalf("unexpected scopes %v", got)
+	}
+	if _, err := NormalizeScopes([]string{"students:delete"}); !errors.Is(err, ErrInvalidScope) {
+		t.Fatalf("expected unknown scope to be rejected, got %v", err)
+	}
+	if _, err := NormalizeScopes(nil); !errors.Is(err, ErrInvalidScope) {
+		t.Fatalf("expected empty scopes to be rejected, got %v", err)
+	}
+}
+
+func TestAllows(t *testing.T) {
+	granted := []string{"students:read", "transport:write"}
+	cases := []struct {
+		method, path string
+		want         bool
+	}{
+		{"GET", "/v1/admin/students", true},
+		{"HEAD", "/v1/admin/students/123", true},
+		{"GET", "/v1/admin/academic-structure/classes", true},
+		{"POST", "/v1/admin/students", false},
+		{"DELETE", "/v1/admin/transport/vehicles/1", false},
+		{"PUT", "/v1/admin/transport/vehicles/1", true},
+		{"GET", "/v1/admin/studentsx", false},
+		{"GET", "/v1/admin/students/../fees", false},
+		{"GET", "/v1/admin/fees", false},
+	}
+	for _, c := range cases {
+		if got := Allows(granted, c.method, c.path); got != c.want {
+			t.Fatalf("%s %s: expected %v, got %v", c.method, c.path, c.want, got)
+		}
+	}
+}
+
+func TestPermissions(t *testing.T) {
+	got := Permissions([]string{"fees:read", "students:read", "students:write", "unknown"})
+	if !slices.Equal(got, []string{"fees:read", "finance:read", "sis:read", "sis:write"}) {
+		t.Fatalf("unexpected permissions %v", got)
+	}
+}
+
+func TestAPIKeyRoundTrip(t *testing.T) {
+	clientID, err := NewClientID()
+	if err != nil {
+		t.Fatalf("failed to create client id: %v", err)
+	}
+	secret, err := NewSecret()
+	if err != nil {
+		t.Fatalf("failed to create secret: %v", err)
+	}
+	gotID, gotSecret, ok := SplitAPIKey(APIKey(clientID, secret))
+	if !ok || gotID != clientID || gotSecret != secret {
+		t.Fatalf("expected key to split back into %q/%q, got %q/%q", clientID, secret, gotID, gotSecret)
+	}
+	for _, key := range []string{"", "serp_abc", "other_abc.secret", "serp_abc."} {
+		if _, _, ok := SplitAPIKey(key); ok {
+			t.Fatalf("expected %q to be rejected", key)
+		}
+	}
+
+	token, err := NewAccessToken()
+	if err != nil || !IsAccessToken(token) || IsAccessToken("eyJhbGciOi") {
+		t.Fatalf("expected access tokens to be recognisable: %v", err)
+	}
+}
@@ -0,0 +1,273 @@
+// Package datascope narrows what a user may see below the permission check:
+// a class teacher sees their sections, a subject teacher their subjects in
+// the sections they teach, a parent their linked children and a hostel
+// warden the boarders of their building. Services resolve a Scope for the
+// caller and consult it for every record they return or change.
+package datascope
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/schoolerp/api/internal/db"
+)
+
+// ErrOutOfScope is wrapped by every Violation.
+var ErrOutOfScope = errors.New("record is outside the caller's data scope")
+
+// Violation describes a denied access so handlers can record it as a
+// security event.
+type Violation struct {
+	Resource   string
+	ResourceID string
+	Reason     string
+}
+
+func (v *Violation) Error() string {
+	return fmt.Sprintf("%s %s: %s", v.Resource, v.ResourceID, ErrOutOfScope.Error())
+}
+
+func (v *Violation) Unwrap() error { return ErrOutOfScope }
+
+// Actor is the caller a scope is resolved for. An empty actor is a system
+// caller (jobs, internal calls) and is not restricted.
+type Actor struct {
+	UserID string
+	Role   string
+}
+
+// restrictedRoles are the roles whose access is limited to related records.
+// Staff roles such as tenant_admin or finance see the whole tenant; what
+// they may do is governed by permissions alone.
+var restrictedRoles = map[string]bool{
+	"teacher":       true,
+	"parent":        true,
+	"student":       true,
+	"warden":        true,
+	"hostel_warden": true,
+}
+
+// Scope is the set of records an actor may reach within a tenant.
+type Scope struct {
+	Restricted bool
+
+	sections        map[pgtype.UUID]bool
+	subjectSections map[pgtype.UUID]map[pgtype.UUID]bool
+	students        map[pgtype.UUID]bool
+	buildings       map[pgtype.UUID]bool
+}
+
+// Unrestricted is the scope of staff and system callers.
+func Unrestricted() Scope {
+	return Scope{}
+}
+
+// StudentFacts is what a scope decision needs to know about a student.
+type StudentFacts struct {
+	ID         pgtype.UUID
+	SectionID  pgtype.UUID
+	BuildingID pgtype.UUID
+}
+
+// CanViewStudent allows the student's own parents, any teacher of their
+// section and the warden of their hostel building.
+func (s Scope) CanViewStudent(f StudentFacts) bool {
+	if !s.Restricted {
+		return true
+	}
+	if s.students[f.ID] {
+		return true
+	}
+	if f.SectionID.Valid && (s.sections[f.SectionID] || len(s.subjectSections[f.SectionID]) > 0) {
+		return true
+	}
+	return f.BuildingID.Valid && s.buildings[f.BuildingID]
+}
+
+// CanViewMarks allows parents, the class teacher of the section and the
+// teacher of that subject in the section. Wardens do not see marks.
+func (s Scope) CanViewMarks(f StudentFacts, subjectID pgtype.UUID) bool {
+	if !s.Restricted {
+		return true
+	}
+	return s.students[f.ID] || s.CanEnterMarks(f, subjectID)
+}
+
+// CanEnterMarks allows the class teacher of the section and the teacher of
+// that subject in the section.
+func (s Scope) CanEnterMarks(f StudentFacts, subjectID pgtype.UUID) bool {
+	if !s.Restricted {
+		return true
+	}
+	if !f.SectionID.Valid {
+		return false
+	}
+	return s.sections[f.SectionID] || s.subjectSections[f.SectionID][subjectID]
+}
+
+// CanTeachSection allows the class teacher of the section and any teacher
+// of a subject in it.
+func (s Scope) CanTeachSection(sectionID pgtype.UUID) bool {
+	if !s.Restricted {
+		return true
+	}
+	return sectionID.Valid && (s.sections[sectionID] || len(s.subjectSections[sectionID]) > 0)
+}
+
+type scopeStore interface {
+	ListClassTeacherSections(ctx context.Context, tenantID, userID pgtype.UUID) ([]pgtype.UUID, error)
+	ListTeacherSubjectSections(ctx context.Context, tenantID, userID pgtype.UUID) ([]db.TeacherSubjectSection, error)
+	ListGuardianStudentIDs(ctx context.Context, tenantID, userID pgtype.UUID) ([]pgtype.UUID, error)
+	ListWardenBuildings(ctx context.Context, tenantID, userID pgtype.UUID) ([]pgtype.UUID, error)
+	ListStudentScopeFacts(ctx context.Context, tenantID pgtype.UUID, studentIDs []pgtype.UUID) ([]db.StudentScopeFacts, error)
+}
+
+type Service struct {
+	q scopeStore
+}
+
+func NewService(q *db.Queries) *Service {
+	return &Service{q: q}
+}
+
+// Resolve loads the scope of an actor within a tenant.
+func (s *Service) Resolve(ctx context.Context, tenantID string, a Actor) (Scope, error) {
+	role := strings.ToLower(strings.TrimSpace(a.Role))
+	if strings.TrimSpace(a.UserID) == "" || !restrictedRoles[role] {
+		return Unrestricted(), nil
+	}
+
+	var tid, uid pgtype.UUID
+	if err := tid.Scan(strings.TrimSpace(tenantID)); err != nil || !tid.Valid {
+		return Scope{}, errors.New("invalid tenant id")
+	}
+	if err := uid.Scan(strings.TrimSpace(a.UserID)); err != nil || !uid.Valid {
+		return Scope{}, errors.New("invalid user id")
+	}
+
+	scope := Scope{
+		Restricted:      true,
+		sections:        make(map[pgtype.UUID]bool),
+		subjectSections: make(map[pgtype.UUID]map[pgtype.UUID]bool),
+		students:        make(map[pgtype.UUID]bool),
+		buildings:       make(map[pgtype.UUID]bool),
+	}
+
+	switch role {
+	case "teacher":
+		sections, err := s.q.ListClassTeacherSections(ctx, tid, uid)
+		if err != nil {
+			return Scope{}, err
+		}
+		for _, id := range sections {
+			scope.sections[id] = true
+		}
+		pairs, err := s.q.ListTeacherSubjectSections(ctx, tid, uid)
+		if err != nil {
+			return Scope{}, err
+		}
+		for _, p := range pairs {
+			if scope.subjectSections[p.SectionID] == nil {
+				scope.subjectSections[p.SectionID] = make(map[pgtype.UUID]bool)
+			}
+			scope.subjectSections[p.SectionID][p.SubjectID] = true
+		}
+	case "parent":
+		students, err := s.q.ListGuardianStudentIDs(ctx, tid, uid)
+		if err != nil {
+			return Scope{}, err
+		}
+		for _, id := range students {
+			scope.students[id] = true
+		}
+	}
+
+	// Any restricted staff member may also be a hostel warden.
+	if role != "parent" && role != "student" {
+		buildings, err := s.q.ListWardenBuildings(ctx, tid, uid)
+		if err != nil {
+			return Scope{}, err
+		}
+		for _, id := range buildings {
+			scope.buildings[id] = true
+		}
+	}
+	return scope, nil
+}
+
+// StudentFacts loads scope facts for students of the tenant, keyed by id.
+// Unknown ids are absent from the result.
+func (s *Service) StudentFacts(ctx context.Context, tenantID pgtype.UUID, studentIDs []pgtype.UUID) (map[pgtype.UUID]StudentFacts, error) {
+	out := make(map[pgtype.UUID]StudentFacts, len(studentIDs))
+	if len(studentIDs) == 0 {
+		return out, nil
+	}
+	rows, err := s.q.ListStudentScopeFacts(ctx, tenantID, studentIDs)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range rows {
+		out[r.StudentID] = StudentFacts{ID: r.StudentID, SectionID: r.SectionID, BuildingID: r.BuildingID}
+	}
+	return out, nil
+}
+
+// AuthorizeStudent returns a Violation unless the actor may view the student.
+func (s *Service) AuthorizeStudent(ctx context.Context, tenantID string, a Actor, studentID string) error {
+	scope, err := s.Resolve(ctx, tenantID, a)
+	if err != nil || !scope.Restricted {
+		return err
+	}
+	var tid, sid pgtype.UUID
+	_ = tid.Scan(strings.TrimSpace(tenantID))
+	if err := sid.Scan(strings.TrimSpace(studentID)); err != nil || !sid.Valid {
+		return &Violation{Resource: "student", ResourceID: studentID, Reason: "invalid_student_id"}
+	}
+	facts, err := s.StudentFacts(ctx, tid, []pgtype.UUID{sid})
+	if err != nil {
+		return err
+	}
+	f, ok := facts[sid]
+	if !ok || !scope.CanViewStudent(f) {
+		return &Violation{Resource: "student", ResourceID: studentID, Reason: "student_not_in_scope"}
+	}
+	return nil
+}
+
+// AuthorizeSection returns a Violation unless the actor teaches the section
+// and every listed student belongs to it.
+func (s *Service) AuthorizeSection(ctx context.Context, tenantID string, a Actor, sectionID string, studentIDs []string) error {
+	scope, err := s.Resolve(ctx, tenantID, a)
+	if err != nil || !scope.Restricted {
+		return err
+	}
+	var tid, secID pgtype.UUID
+	_ = tid.Scan(strings.TrimSpace(tenantID))
+	if err := secID.Scan(strings.TrimSpace(sectionID)); err != nil || !scope.CanTeachSection(secID) {
+		return &Violation{Resource: "class_section", ResourceID: sectionID, Reason: "section_not_in_scope"}
+	}
+	if len(studentIDs) == 0 {
+		return nil
+	}
+	ids := make([]pgtype.UUID, 0, len(studentIDs))
+	for _, raw := range studentIDs {
+		var id pgtype.UUID
+		if err := id.Scan(strings.TrimSpace(raw)); err != nil || !id.Valid {
+			return &Violation{Resource: "student", ResourceID: raw, Reason: "invalid_student_id"}
+		}
+		ids = append(ids, id)
+	}
+	facts, err := s.StudentFacts(ctx, tid, ids)
+	if err != nil {
+		return err
+	}
+	for i, id := range ids {
+		if f, ok := facts[id]; !ok || f.SectionID != secID {
+			return &Violation{Resource: "student", ResourceID: studentIDs[i], Reason: "student_not_in_section"}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package datascope
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/schoolerp/api/internal/db"
+)
+
+func testUUID(b byte) pgtype.UUID {
+	var id pgtype.UUID
+	id.Bytes[15] = b
+	id.Valid = true
+	return id
+}
+
+type fakeStore struct {
+	classSections   []pgtype.UUID
+	subjectSections []db.TeacherSubjectSection
+	children        []pgtype.UUID
+	buildings       []pgtype.UUID
+	facts           []db.StudentScopeFacts
+}
+
+func (f *fakeStore) ListClassTeacherSections(context.Context, pgtype.UUID, pgtype.UUID) ([]pgtype.UUID, error) {
+	return f.classSections, nil
+}
+
+func (f *fakeStore) ListTeacherSubjectSections(context.Context, pgtype.UUID, pgtype.UUID) ([]db.TeacherSubjectSection, error) {
+	return f.subjectSections, nil
+}
+
+func (f *fakeStore) ListGuardianStudentIDs(context.Context, pgtype.UUID, pgtype.UUID) ([]pgtype.UUID, error) {
+	return f.children, nil
+}
+
+func (f *fakeStore) ListWardenBuildings(context.Context, pgtype.UUID, pgtype.UUID) ([]pgtype.UUID, error) {
+	return f.buildings, nil
+}
+
+func (f *fakeStore) ListStudentScopeFacts(_ context.Context, _ pgtype.UUID, ids []pgtype.UUID) ([]db.StudentScopeFacts, error) {
+	var out []db.StudentScopeFacts
+	for _, fact := range f.facts {
+		for _, id := range ids {
+			if fact.StudentID == id {
+				out = append(out, fact)
+			}
+		}
+	}
+	return out, nil
+}
+
+const (
+	tenant  = "0190a000-0000-7000-8000-000000000001"
+	userID  = "0190a000-0000-7000-8000-000000000002"
+	student = "00000000-0000-0000-0000-000000000015"
+)
+
+func TestTeacherScope(t *testing.T) {
+	sectionA, sectionB, sectionC := testUUID(1), testUUID(2), testUUID(3)
+	maths, physics := testUUID(10), testUUID(11)
+	s := &Service{q: &fakeStore{
+		classSections:   []pgtype.UUID{sectionA},
+		subjectSections: []db.TeacherSubjectSection{{SectionID: sectionB, SubjectID: maths}},
+	}}
+
+	scope, err := s.Resolve(context.Background(), tenant, Actor{UserID: userID, Role: "teacher"})
+	if err != nil || !scope.Restricted {
+		t.Fatalf("expected a restricted scope, got %+v, %v", scope, err)
+	}
+
+	inA := StudentFacts{ID: testUUID(20), SectionID: sectionA}
+	inB := StudentFacts{ID: testUUID(21), SectionID: sectionB}
+	inC := StudentFacts{ID: testUUID(22), SectionID: sectionC}
+
+	if !scope.CanViewStudent(inA) || !scope.CanViewStudent(inB) || scope.CanViewStudent(inC) {
+		t.Fatalf("teacher must see students of their own sections only")
+	}
+	if !scope.CanEnterMarks(inA, physics) {
+		t.Fatalf("class teacher may enter marks for any subject of their section")
+	}
+	if !scope.CanEnterMarks(inB, maths) || scope.CanEnterMarks(inB, physics) {
+		t.Fatalf("subject teacher may enter marks only for the subject they teach")
+	}
+}
+
+func TestParentAndWardenScope(t *testing.T) {
+	child, other := testUUID(20), testUUID(21)
+	building := testUUID(30)
+	maths := testUUID(10)
+
+	parent := &Service{q: &fakeStore{children: []pgtype.UUID{child}, buildings: []pgtype.UUID{building}}}
+	scope, err := parent.Resolve(context.Background(), tenant, Actor{UserID: userID, Role: "parent"})
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	if !scope.CanViewStudent(StudentFacts{ID: child}) || scope.CanViewStudent(StudentFacts{ID: other}) {
+		t.Fatalf("parent must see linked children only")
+	}
+	if !scope.CanViewMarks(StudentFacts{ID: child}, maths) || scope.CanEnterMarks(StudentFacts{ID: child}, maths) {
+		t.Fatalf("parent may view but not enter their child's marks")
+	}
+	if scope.CanViewStudent(StudentFacts{ID: other, BuildingID: building}) {
+		t.Fatalf("warden buildings must not apply to parents")
+	}
+
+	warden := &Service{q: &fakeStore{buildings: []pgtype.UUID{building}}}
+	scope, err = warden.Resolve(context.Background(), tenant, Actor{UserID: userID, Role: "warden"})
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	boarder := StudentFacts{ID: other, BuildingID: building}
+	if !scope.CanViewStudent(boarder) || scope.CanViewMarks(boarder, maths) {
+		t.Fatalf("warden sees boarders of their building but not their marks")
+	}
+}
+
+func TestAuthorizeStudent(t *testing.T) {
+	section := testUUID(1)
+	sid := pgtype.UUID{}
+	_ = sid.Scan(student)
+	store := &fakeStore{facts: []db.StudentScopeFacts{{StudentID: sid, SectionID: section}}}
+	s := &Service{q: store}
+
+	if err := s.AuthorizeStudent(context.Background(), tenant, Actor{UserID: userID, Role: "tenant_admin"}, student); err != nil {
+		t.Fatalf("staff roles are not restricted: %v", err)
+	}
+	if err := s.AuthorizeStudent(context.Background(), tenant, Actor{}, student); err != nil {
+		t.Fatalf("system callers are not restricted: %v", err)
+	}
+
+	err := s.AuthorizeStudent(context.Background(), tenant, Actor{UserID: userID, Role: "teacher"}, student)
+	var violation *Violation
+	if !errors.As(err, &violation) || !errors.Is(err, ErrOutOfScope) || violation.Resource != "student" {
+		t.Fatalf("expected a student violation, got %v", err)
+	}
+
+	store.classSections = []pgtype.UUID{section}
+	if err := s.AuthorizeStudent(context.Background(), tenant, Actor{UserID: userID, Role: "teacher"}, student); err != nil {
+		t.Fatalf("class teacher must see their student: %v", err)
+	}
+}
+
+func TestAuthorizeSection(t *testing.T) {
+	sid := pgtype.UUID{}
+	_ = sid.Scan(student)
+	section := pgtype.UUID{}
+	_ = section.Scan("0190a000-0000-7000-8000-0000000000a1")
+	other := "0190a000-0000-7000-8000-0000000000a2"
+	store := &fakeStore{facts: []db.StudentScopeFacts{{StudentID: sid, SectionID: section}}}
+	s := &Service{q: store}
+	teacher := Actor{UserID: userID, Role: "teacher"}
+
+	if err := s.AuthorizeSection(context.Background(), tenant, teacher, section.String(), []string{student}); !errors.Is(err, ErrOutOfScope) {
+		t.Fatalf("a teacher outside the section must be refused, got %v", err)
+	}
+
+	store.classSections = []pgtype.UUID{section}
+	if err := s.AuthorizeSection(context.Background(), tenant, teacher, section.String(), []string{student}); err != nil {
+		t.Fatalf("class teacher must reach their section: %v", err)
+	}
+
+	var otherSection pgtype.UUID
+	_ = otherSection.Scan(other)
+	store.subjectSections = []db.TeacherSubjectSection{{SectionID: otherSection, SubjectID: testUUID(10)}}
+	err := s.AuthorizeSection(context.Background(), tenant, teacher, other, []string{student})
+	var violation *Violation
+	if !errors.As(err, &violation) || violation.Reason != "student_not_in_section" {
+		t.Fatalf("students of another section must be refused, got %v", err)
+	}
+
+	if err := s.AuthorizeSection(context.Background(), tenant, Actor{UserID: userID, Role: "tenant_admin"}, other, []string{student}); err != nil {
+		t.Fatalf("staff roles are not restricted: %v", err)
+	}
+}
@@ -0,0 +1,392 @@
+// Package keyring implements envelope encryption for tenant data. Each tenant
+// has its own data keys, wrapped by a master key from DATA_ENCRYPTION_KEYS.
+// Ciphertext records the data key that produced it, so master keys and data
+// keys can be rotated without a flag day, and a tenant can be crypto-shredded
+// by destroying its keys.
+package keyring
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/schoolerp/api/internal/db"
+	"github.com/schoolerp/api/internal/foundation/security"
+	"github.com/schoolerp/shared/datacrypt"
+)
+
+const (
+	activeKeyTTL    = time.Minute
+	unwrappedKeyTTL = 5 * time.Minute
+)
+
+var (
+	ErrInvalidTenant        = errors.New("invalid tenant id")
+	ErrInvalidCiphertext    = datacrypt.ErrInvalidCiphertext
+	ErrTenantMismatch       = errors.New("ciphertext belongs to another tenant")
+	ErrKeyDestroyed         = errors.New("tenant data key has been destroyed")
+	ErrTenantShredded       = errors.New("tenant encryption keys have been destroyed")
+	ErrMasterKeyUnavailable = datacrypt.ErrMasterKeyUnavailable
+)
+
+// keyStore is the subset of db.Queries the keyring needs to serve requests.
+type keyStore interface {
+	GetActiveTenantDataKey(ctx context.Context, tenantID pgtype.UUID) (db.TenantDataKey, error)
+	GetTenantDataKey(ctx context.Context, id pgtype.UUID) (db.TenantDataKey, error)
+	CreateTenantDataKey(ctx context.Context, arg db.CreateTenantDataKeyParams) (db.TenantDataKey, error)
+	RetireOlderTenantDataKeys(ctx context.Context, tenantID pgtype.UUID, version int32) error
+	DestroyTenantDataKeys(ctx context.Context, tenantID pgtype.UUID) (int64, error)
+	MarkTenantDataKeysDestroyed(ctx context.Context, id, tenantID pgtype.UUID) error
+	ClearTenantLegacySecrets(ctx context.Context, tenantID pgtype.UUID) error
+}
+
+type cachedKey struct {
+	id        pgtype.UUID
+	tenantID  pgtype.UUID
+	key       []byte
+	expiresAt time.Time
+}
+
+type Service struct {
+	store      keyStore
+	q          *db.Queries
+	db         *pgxpool.Pool
+	masterKeys func() ([][]byte, error)
+	now        func() time.Time
+
+	mu     sync.Mutex
+	keys   map[pgtype.UUID]cachedKey // by data key id
+	active map[pgtype.UUID]cachedKey // by tenant id
+}
+
+func NewService(q *db.Queries, pool *pgxpool.Pool) *Service {
+	s := newService(q, security.ResolveDataEncryptionKeys)
+	s.q = q
+	s.db = pool
+	return s
+}
+
+func newService(store keyStore, masterKeys func() ([][]byte, error)) *Service {
+	return &Service{
+		store:      store,
+		masterKeys: masterKeys,
+		now:        time.Now,
+		keys:       make(map[pgtype.UUID]cachedKey),
+		active:     make(map[pgtype.UUID]cachedKey),
+	}
+}
+
+// Encrypt seals plaintext under the tenant's active data key, creating the
+// key on first use.
+func (s *Service) Encrypt(ctx context.Context, tenantID string, plaintext []byte) (string, error) {
+	tid, err := parseTenant(tenantID)
+	if err != nil {
+		return "", err
+	}
+	key, err := s.activeKey(ctx, tid)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := datacrypt.Seal(key.key, plaintext, valueAAD(tid, key.id))
+	if err != nil {
+		return "", err
+	}
+	return datacrypt.FormatEnvelope(uuidString(key.id), sealed), nil
+}
+
+// Decrypt opens a value produced by Encrypt. Values written before envelope
+// encryption are opened with the master keys directly.
+func (s *Service) Decrypt(ctx context.Context, tenantID, value string) ([]byte, error) {
+	tid, err := parseTenant(tenantID)
+	if err != nil {
+		return nil, err
+	}
+	if !IsEnvelope(value) {
+		return s.decryptLegacy(value)
+	}
+
+	keyID, sealed, err := parseEnvelope(value)
+	if err != nil {
+		return nil, err
+	}
+	key, err := s.dataKey(ctx, keyID)
+	if err != nil {
+		return nil, err
+	}
+	if key.tenantID != tid {
+		return nil, ErrTenantMismatch
+	}
+	return datacrypt.Open(key.key, sealed, valueAAD(tid, keyID))
+}
+
+func (s *Service) EncryptString(ctx context.Context, tenantID, plaintext string) (string, error) {
+	return s.Encrypt(ctx, tenantID, []byte(plaintext))
+}
+
+func (s *Service) DecryptString(ctx context.Context, tenantID, value string) (string, error) {
+	plain, err := s.Decrypt(ctx, tenantID, value)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+// IsEnvelope reports whether value was produced by Encrypt.
+func IsEnvelope(value string) bool {
+	return datacrypt.IsEnvelope(value)
+}
+
+// RotateTenantKey makes a fresh data key active for the tenant and retires
+// the previous one. Values under the old key stay readable until they are
+// re-encrypted.
+func (s *Service) RotateTenantKey(ctx context.Context, tenantID string) error {
+	tid, err := parseTenant(tenantID)
+	if err != nil {
+		return err
+	}
+	key, err := s.createKey(ctx, tid)
+	if err != nil {
+		return err
+	}
+	return s.store.RetireOlderTenantDataKeys(ctx, tid, key.version)
+}
+
+// ShredTenant destroys every data key of the tenant, making its envelope
+// encrypted values permanently unreadable, and erases sensitive values that
+// are not under a tenant key. No new key can be created for the tenant
+// afterwards.
+func (s *Service) ShredTenant(ctx context.Context, tenantID string) error {
+	tid, err := parseTenant(tenantID)
+	if err != nil {
+		return err
+	}
+	destroyed, err := s.store.DestroyTenantDataKeys(ctx, tid)
+	if err != nil {
+		return err
+	}
+	if destroyed == 0 {
+		if err := s.store.MarkTenantDataKeysDestroyed(ctx, newKeyID(), tid); err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	delete(s.active, tid)
+	for id, k := range s.keys {
+		if k.tenantID == tid {
+			delete(s.keys, id)
+		}
+	}
+	s.mu.Unlock()
+
+	return s.store.ClearTenantLegacySecrets(ctx, tid)
+}
+
+// MasterKeyIDs returns the ids of the configured master keys, primary first.
+func (s *Service) MasterKeyIDs() ([]string, error) {
+	keys, err := s.masterKeys()
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(keys))
+	for _, k := range keys {
+		ids = append(ids, security.MasterKeyID(k))
+	}
+	return ids, nil
+}
+
+type activeDataKey struct {
+	cachedKey
+	version int32
+}
+
+func (s *Service) activeKey(ctx context.Context, tid pgtype.UUID) (cachedKey, error) {
+	now := s.now()
+	s.mu.Lock()
+	if k, ok := s.active[tid]; ok && now.Before(k.expiresAt) {
+		s.mu.Unlock()
+		return k, nil
+	}
+	s.mu.Unlock()
+
+	row, err := s.store.GetActiveTenantDataKey(ctx, tid)
+	if errors.Is(err, pgx.ErrNoRows) {
+		created, err := s.createKey(ctx, tid)
+		if err != nil {
+			return cachedKey{}, err
+		}
+		return created.cachedKey, nil
+	}
+	if err != nil {
+		return cachedKey{}, err
+	}
+	key, err := s.unwrap(row)
+	if err != nil {
+		return cachedKey{}, err
+	}
+	s.remember(key, true)
+	return key, nil
+}
+
+func (s *Service) createKey(ctx context.Context, tid pgtype.UUID) (activeDataKey, error) {
+	masters, err := s.masterKeys()
+	if err != nil {
+		return activeDataKey{}, err
+	}
+	plain, err := security.GenerateRandomKey()
+	if err != nil {
+		return activeDataKey{}, err
+	}
+	id := newKeyID()
+	wrapped, err := wrapKey(masters[0], id, plain)
+	if err != nil {
+		return activeDataKey{}, err
+	}
+
+	row, err := s.store.CreateTenantDataKey(ctx, db.CreateTenantDataKeyParams{
+		ID:          id,
+		TenantID:    tid,
+		MasterKeyID: security.MasterKeyID(masters[0]),
+		WrappedKey:  wrapped,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		// Either a concurrent writer created this version, or the tenant
+		// has been shredded.
+		existing, getErr := s.store.GetActiveTenantDataKey(ctx, tid)
+		if errors.Is(getErr, pgx.ErrNoRows) {
+			return activeDataKey{}, ErrTenantShredded
+		}
+		if getErr != nil {
+			return activeDataKey{}, getErr
+		}
+		key, err := s.unwrap(existing)
+		if err != nil {
+			return activeDataKey{}, err
+		}
+		s.remember(key, true)
+		return activeDataKey{cachedKey: key, version: existing.Version}, nil
+	}
+	if err != nil {
+		return activeDataKey{}, err
+	}
+
+	key := cachedKey{id: row.ID, tenantID: tid, key: plain}
+	s.remember(key, true)
+	return activeDataKey{cachedKey: key, version: row.Version}, nil
+}
+
+func (s *Service) dataKey(ctx context.Context, id pgtype.UUID) (cachedKey, error) {
+	now := s.now()
+	s.mu.Lock()
+	if k, ok := s.keys[id]; ok && now.Before(k.expiresAt) {
+		s.mu.Unlock()
+		return k, nil
+	}
+	s.mu.Unlock()
+
+	row, err := s.store.GetTenantDataKey(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return cachedKey{}, ErrKeyDestroyed
+	}
+	if err != nil {
+		return cachedKey{}, err
+	}
+	key, err := s.unwrap(row)
+	if err != nil {
+		return cachedKey{}, err
+	}
+	s.remember(key, false)
+	return key, nil
+}
+
+func (s *Service) unwrap(row db.TenantDataKey) (cachedKey, error) {
+	if row.Status == "destroyed" || len(row.WrappedKey) == 0 {
+		return cachedKey{}, ErrKeyDestroyed
+	}
+	master, err := s.masterKey(row.MasterKeyID)
+	if err != nil {
+		return cachedKey{}, err
+	}
+	plain, err := unwrapKey(master, row.ID, row.WrappedKey)
+	if err != nil {
+		return cachedKey{}, fmt.Errorf("unwrap tenant data key: %w", err)
+	}
+	return cachedKey{id: row.ID, tenantID: row.TenantID, key: plain}, nil
+}
+
+func (s *Service) masterKey(id string) ([]byte, error) {
+	masters, err := s.masterKeys()
+	if err != nil {
+		return nil, err
+	}
+	return datacrypt.MasterKey(masters, id)
+}
+
+func (s *Service) remember(key cachedKey, active bool) {
+	now := s.now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key.expiresAt = now.Add(unwrappedKeyTTL)
+	s.keys[key.id] = key
+	if active {
+		key.expiresAt = now.Add(activeKeyTTL)
+		s.active[key.tenantID] = key
+	}
+}
+
+func (s *Service) decryptLegacy(value string) ([]byte, error) {
+	masters, err := s.masterKeys()
+	if err != nil {
+		return nil, err
+	}
+	return datacrypt.OpenLegacy(masters, value)
+}
+
+// Wrapped keys are bound to their id and values to their tenant and key, so
+// neither can be replayed under another id or tenant.
+func wrapKey(master []byte, id pgtype.UUID, plain []byte) ([]byte, error) {
+	return datacrypt.WrapKey(master, uuidString(id), plain)
+}
+
+func unwrapKey(master []byte, id pgtype.UUID, wrapped []byte) ([]byte, error) {
+	return datacrypt.UnwrapKey(master, uuidString(id), wrapped)
+}
+
+func valueAAD(tid, keyID pgtype.UUID) []byte {
+	return datacrypt.ValueAAD(uuidString(tid), uuidString(keyID))
+}
+
+func parseEnvelope(value string) (pgtype.UUID, []byte, error) {
+	idPart, sealed, err := datacrypt.ParseEnvelope(value)
+	if err != nil {
+		return pgtype.UUID{}, nil, err
+	}
+	id, err := uuid.Parse(idPart)
+	if err != nil {
+		return pgtype.UUID{}, nil, ErrInvalidCiphertext
+	}
+	return pgtype.UUID{Bytes: id, Valid: true}, sealed, nil
+}
+
+func parseTenant(raw string) (pgtype.UUID, error) {
+	var id pgtype.UUID
+	if err := id.Scan(strings.TrimSpace(raw)); err != nil || !id.Valid {
+		return pgtype.UUID{}, ErrInvalidTenant
+	}
+	return id, nil
+}
+
+func newKeyID() pgtype.UUID {
+	return pgtype.UUID{Bytes: uuid.Must(uuid.NewV7()), Valid: true}
+}
+
+func uuidString(id pgtype.UUID) string {
+	return uuid.UUID(id.Bytes).String()
+}
@@ -0,0 +1,224 @@
+package keyring
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/schoolerp/api/internal/db"
+	"github.com/schoolerp/api/internal/foundation/security"
+)
+
+type memoryStore struct {
+	keys    []db.TenantDataKey
+	cleared []pgtype.UUID
+}
+
+func (m *memoryStore) GetActiveTenantDataKey(_ context.Context, tenantID pgtype.UUID) (db.TenantDataKey, error) {
+	var best *db.TenantDataKey
+	for i := range m.keys {
+		k := &m.keys[i]
+		if k.TenantID == tenantID && k.Status == "active" && (best == nil || k.Version > best.Version) {
+			best = k
+		}
+	}
+	if best == nil {
+		return db.TenantDataKey{}, pgx.ErrNoRows
+	}
+	return *best, nil
+}
+
+func (m *memoryStore) GetTenantDataKey(_ context.Context, id pgtype.UUID) (db.TenantDataKey, error) {
+	for _, k := range m.keys {
+		if k.ID == id {
+			return k, nil
+		}
+	}
+	return db.TenantDataKey{}, pgx.ErrNoRows
+}
+
+func (m *memoryStore) CreateTenantDataKey(_ context.Context, arg db.CreateTenantDataKeyParams) (db.TenantDataKey, error) {
+	var version int32
+	for _, k := range m.keys {
+		if k.TenantID != arg.TenantID {
+			continue
+		}
+		if k.Status == "destroyed" {
+			return db.TenantDataKey{}, pgx.ErrNoRows
+		}
+		if k.Version > version {
+			version = k.Version
+		}
+	}
+	k := db.TenantDataKey{ID: arg.ID, TenantID: arg.TenantID, Version: version + 1, Status: "active", MasterKeyID: arg.MasterKeyID, WrappedKey: arg.WrappedKey}
+	m.keys = append(m.keys, k)
+	return k, nil
+}
+
+func (m *memoryStore) RetireOlderTenantDataKeys(_ context.Context, tenantID pgtype.UUID, version int32) error {
+	for i := range m.keys {
+		if m.keys[i].TenantID == tenantID && m.keys[i].Status == "active" && m.keys[i].Version < version {
+			m.keys[i].Status = "retired"
+		}
+	}
+	return nil
+}
+
+func (m *memoryStore) DestroyTenantDataKeys(_ context.Context, tenantID pgtype.UUID) (int64, error) {
+	var n int64
+	for i := range m.keys {
+		if m.keys[i].TenantID == tenantID && m.keys[i].Status != "destroyed" {
+			m.keys[i].Status, m.keys[i].WrappedKey, m.keys[i].MasterKeyID = "destroyed", nil, ""
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *memoryStore) MarkTenantDataKeysDestroyed(_ context.Context, id, tenantID pgtype.UUID) error {
+	m.keys = append(m.keys, db.TenantDataKey{ID: id, TenantID: tenantID, Status: "destroyed"})
+	return nil
+}
+
+func (m *memoryStore) ClearTenantLegacySecrets(_ context.Context, tenantID pgtype.UUID) error {
+	m.cleared = append(m.cleared, tenantID)
+	return nil
+}
+
+const (
+	tenantA = "0190a000-0000-7000-8000-00000000000a"
+	tenantB = "0190a000-0000-7000-8000-00000000000b"
+)
+
+func testMasters(keys ...string) func() ([][]byte, error) {
+	return func() ([][]byte, error) {
+		out := make([][]byte, 0, len(keys))
+		for _, k := range keys {
+			out = append(out, []byte(k))
+		}
+		return out, nil
+	}
+}
+
+func TestEncryptRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	store := &memoryStore{}
+	s := newService(store, testMasters("0123456789abcdef0123456789abcdef"))
+
+	sealed, err := s.EncryptString(ctx, tenantA, "IFSC0001 / 1234567890")
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	if !IsEnvelope(sealed) || strings.Contains(sealed, "1234567890") {
+		t.Fatalf("unexpected ciphertext %q", sealed)
+	}
+	if len(store.keys) != 1 || store.keys[0].MasterKeyID != security.MasterKeyID([]byte("0123456789abcdef0123456789abcdef")) {
+		t.Fatalf("expected one data key wrapped by the primary master key, got %+v", store.keys)
+	}
+
+	// A fresh instance has no cached keys and must unwrap from the store.
+	fresh := newService(store, testMasters("0123456789abcdef0123456789abcdef"))
+	plain, err := fresh.DecryptString(ctx, tenantA, sealed)
+	if err != nil || plain != "IFSC0001 / 1234567890" {
+		t.Fatalf("decrypt: %q, %v", plain, err)
+	}
+
+	if _, err := fresh.Decrypt(ctx, tenantB, sealed); !errors.Is(err, ErrTenantMismatch) {
+		t.Fatalf("expected tenant mismatch, got %v", err)
+	}
+}
+
+func TestDecryptAfterMasterRotation(t *testing.T) {
+	ctx := context.Background()
+	store := &memoryStore{}
+	oldMaster, newMaster := "0123456789abcdef0123456789abcdef", "fedcba9876543210fedcba9876543210"
+
+	sealed, err := newService(store, testMasters(oldMaster)).EncryptString(ctx, tenantA, "asthma")
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+
+	// The old master key is kept as a secondary key during the grace window.
+	rotated := newService(store, testMasters(newMaster, oldMaster))
+	if plain, err := rotated.DecryptString(ctx, tenantA, sealed); err != nil || plain != "asthma" {
+		t.Fatalf("decrypt with secondary master: %q, %v", plain, err)
+	}
+
+	if err := rotated.RotateTenantKey(ctx, tenantA); err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+	again, err := rotated.EncryptString(ctx, tenantA, "asthma")
+	if err != nil {
+		t.Fatalf("encrypt after rotation: %v", err)
+	}
+	if again[:40] == sealed[:40] {
+		t.Fatalf("expected a new data key after rotation")
+	}
+	if plain, err := rotated.DecryptString(ctx, tenantA, sealed); err != nil || plain != "asthma" {
+		t.Fatalf("retired key must still decrypt: %q, %v", plain, err)
+	}
+
+	dropped := newService(store, testMasters(newMaster))
+	if _, err := dropped.Decrypt(ctx, tenantA, sealed); !errors.Is(err, ErrMasterKeyUnavailable) {
+		t.Fatalf("expected unavailable master key, got %v", err)
+	}
+}
+
+func TestLegacyValues(t *testing.T) {
+	master := "0123456789abcdef0123456789abcdef"
+	c, _ := security.NewCrypto([]byte(master))
+	raw, err := c.Encrypt([]byte("A1234567"))
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+
+	s := newService(&memoryStore{}, testMasters(master))
+	plain, err := s.DecryptString(context.Background(), tenantA, base64.StdEncoding.EncodeToString(raw))
+	if err != nil || plain != "A1234567" {
+		t.Fatalf("legacy decrypt: %q, %v", plain, err)
+	}
+}
+
+func TestShredTenant(t *testing.T) {
+	ctx := context.Background()
+	store := &memoryStore{}
+	s := newService(store, testMasters("0123456789abcdef0123456789abcdef"))
+
+	sealed, err := s.EncryptString(ctx, tenantA, "note")
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	other, err := s.EncryptString(ctx, tenantB, "note")
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+
+	if err := s.ShredTenant(ctx, tenantA); err != nil {
+		t.Fatalf("shred: %v", err)
+	}
+	if len(store.cleared) != 1 {
+		t.Fatalf("expected legacy values to be cleared")
+	}
+	if _, err := s.Decrypt(ctx, tenantA, sealed); !errors.Is(err, ErrKeyDestroyed) {
+		t.Fatalf("expected destroyed key, got %v", err)
+	}
+	if _, err := s.Encrypt(ctx, tenantA, []byte("new")); !errors.Is(err, ErrTenantShredded) {
+		t.Fatalf("expected shredded tenant, got %v", err)
+	}
+	if plain, err := s.DecryptString(ctx, tenantB, other); err != nil || plain != "note" {
+		t.Fatalf("other tenants must be unaffected: %q, %v", plain, err)
+	}
+
+	// A tenant that never stored encrypted data is still marked shredded.
+	const tenantC = "0190a000-0000-7000-8000-00000000000c"
+	if err := s.ShredTenant(ctx, tenantC); err != nil {
+		t.Fatalf("shred: %v", err)
+	}
+	if _, err := s.Encrypt(ctx, tenantC, []byte("new")); !errors.Is(err, ErrTenantShredded) {
+		t.Fatalf("expected shredded tenant, got %v", err)
+	}
+}
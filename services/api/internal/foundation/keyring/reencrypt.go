@@ -0,0 +1,330 @@
+package keyring
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/rs/zerolog/log"
+	"github.com/schoolerp/api/internal/db"
+	"github.com/schoolerp/api/internal/foundation/security"
+)
+
+const (
+	reencryptionBatchSize = 200
+	// A running job whose worker has not reported progress for this long is
+	// taken over by another instance.
+	reencryptionLeaseSeconds = 600
+)
+
+// encryptedField describes a column holding tenant data under the keyring.
+// value reads the stored text; plain is true when that text is not
+// ciphertext yet; set writes $2 back.
+type encryptedField struct {
+	name   string
+	table  string
+	filter string
+	value  string
+	plain  string
+	set    string
+}
+
+var encryptedFields = []encryptedField{
+	{
+		// Stored as a JSON string holding the ciphertext. Older rows may hold
+		// the bank details object in plaintext.
+		name:   "employee bank details",
+		table:  "employees",
+		filter: "bank_details IS NOT NULL AND jsonb_typeof(bank_details) <> 'null'",
+		value:  "CASE WHEN jsonb_typeof(bank_details) = 'string' THEN bank_details #>> '{}' ELSE bank_details::text END",
+		plain:  "jsonb_typeof(bank_details) <> 'string'",
+		set:    "bank_details = to_jsonb($2::text)",
+	},
+	{
+		name:   "visitor id numbers",
+		table:  "visitors",
+		filter: "id_number IS NOT NULL AND id_number <> ''",
+		value:  "id_number",
+		plain:  "FALSE",
+		set:    "id_number = $2",
+	},
+	{
+		name:   "confidential notes",
+		table:  "student_confidential_notes",
+		filter: "encrypted_content <> ''",
+		value:  "encrypted_content",
+		plain:  "FALSE",
+		set:    "encrypted_content = $2",
+	},
+	{
+		// Rows written before encryption keep the details in the plaintext
+		// columns, which are cleared once encrypted_details is set.
+		name:  "health records",
+		table: "student_health_records",
+		filter: `(encrypted_details IS NOT NULL OR medical_conditions IS NOT NULL
+			OR COALESCE(allergies, '[]') <> '[]' OR COALESCE(vaccinations, '[]') <> '[]')`,
+		value: `COALESCE(encrypted_details, json_build_object(
+			'allergies', COALESCE(allergies, '[]'),
+			'vaccinations', COALESCE(vaccinations, '[]'),
+			'medical_conditions', COALESCE(medical_conditions, ''))::text)`,
+		plain: "encrypted_details IS NULL",
+		set:   "encrypted_details = $2, allergies = '[]', vaccinations = '[]', medical_conditions = NULL",
+	},
+}
+
+// EnqueueReencryption queues a re-encryption run for a master key produced
+// by a data_encryption secret rotation. It starts once the API runs with
+// that key first in DATA_ENCRYPTION_KEYS.
+func (s *Service) EnqueueReencryption(ctx context.Context, rotationRequestID, targetMasterKeyID string) (db.DataReencryptionJob, error) {
+	var rid pgtype.UUID
+	_ = rid.Scan(strings.TrimSpace(rotationRequestID))
+	targetMasterKeyID = strings.TrimSpace(targetMasterKeyID)
+	if targetMasterKeyID == "" {
+		return db.DataReencryptionJob{}, errors.New("target master key id is required")
+	}
+	return s.q.CreateDataReencryptionJob(ctx, rid, targetMasterKeyID)
+}
+
+func (s *Service) ListReencryptionJobs(ctx context.Context, limit, offset int32) ([]db.DataReencryptionJob, error) {
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	return s.q.ListDataReencryptionJobs(ctx, limit, offset)
+}
+
+// StartReencryptionWorker polls for re-encryption jobs until ctx is done.
+func (s *Service) StartReencryptionWorker(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.RunReencryption(ctx); err != nil {
+				log.Error().Err(err).Msg("data re-encryption run failed")
+			}
+		}
+	}
+}
+
+// RunReencryption claims the next job for the current primary master key
+// and runs it: every tenant gets a fresh data key, every data key is
+// re-wrapped under the primary master key, and every encrypted field is
+// rewritten under its tenant's new key.
+func (s *Service) RunReencryption(ctx context.Context) error {
+	masters, err := s.masterKeys()
+	if err != nil {
+		return err
+	}
+	primary := security.MasterKeyID(masters[0])
+
+	job, err := s.q.ClaimDataReencryptionJob(ctx, primary, reencryptionLeaseSeconds)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := s.q.SupersedeDataReencryptionJobs(ctx, job.ID); err != nil {
+		return err
+	}
+
+	var failed bool
+	report := func(p db.DataReencryptionProgress) error {
+		if p.Failures > 0 {
+			failed = true
+		}
+		return s.q.UpdateDataReencryptionJob(ctx, job.ID, p)
+	}
+
+	steps := []func(context.Context, db.DataReencryptionJob, string, func(db.DataReencryptionProgress) error) error{
+		s.rotateTenantKeys,
+		s.rewrapKeys,
+		s.reencryptFields,
+	}
+	for _, step := range steps {
+		if err := step(ctx, job, primary, report); err != nil {
+			_ = s.q.UpdateDataReencryptionJob(ctx, job.ID, db.DataReencryptionProgress{Failures: 1, LastError: err.Error()})
+			_ = s.q.FinishDataReencryptionJob(ctx, job.ID, "failed")
+			return err
+		}
+	}
+
+	status := "completed"
+	if failed {
+		status = "failed"
+	}
+	log.Info().Str("job_id", uuidString(job.ID)).Str("status", status).Msg("data re-encryption finished")
+	return s.q.FinishDataReencryptionJob(ctx, job.ID, status)
+}
+
+func (s *Service) rotateTenantKeys(ctx context.Context, job db.DataReencryptionJob, _ string, report func(db.DataReencryptionProgress) error) error {
+	var after pgtype.UUID
+	for {
+		tenants, err := s.q.ListTenantsWithActiveKeyBefore(ctx, job.CreatedAt, after, reencryptionBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(tenants) == 0 {
+			return nil
+		}
+		var p db.DataReencryptionProgress
+		for _, tid := range tenants {
+			if err := s.RotateTenantKey(ctx, uuidString(tid)); err != nil {
+				p.Failures++
+				p.LastError = fmt.Sprintf("rotate tenant %s: %v", uuidString(tid), err)
+				continue
+			}
+			p.KeysRotated++
+		}
+		if err := report(p); err != nil {
+			return err
+		}
+		after = tenants[len(tenants)-1]
+	}
+}
+
+func (s *Service) rewrapKeys(ctx context.Context, _ db.DataReencryptionJob, primary string, report func(db.DataReencryptionProgress) error) error {
+	masters, err := s.masterKeys()
+	if err != nil {
+		return err
+	}
+	var after pgtype.UUID
+	for {
+		keys, err := s.q.ListTenantDataKeysWrappedByOtherMaster(ctx, primary, after, reencryptionBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(keys) == 0 {
+			return nil
+		}
+		var p db.DataReencryptionProgress
+		for _, row := range keys {
+			key, err := s.unwrap(row)
+			if err == nil {
+				var wrapped []byte
+				wrapped, err = wrapKey(masters[0], row.ID, key.key)
+				if err == nil {
+					_, err = s.q.RewrapTenantDataKey(ctx, row.ID, row.MasterKeyID, primary, wrapped)
+				}
+			}
+			if err != nil {
+				p.Failures++
+				p.LastError = fmt.Sprintf("rewrap key %s: %v", uuidString(row.ID), err)
+				continue
+			}
+			p.KeysRewrapped++
+		}
+		if err := report(p); err != nil {
+			return err
+		}
+		after = keys[len(keys)-1].ID
+	}
+}
+
+func (s *Service) reencryptFields(ctx context.Context, _ db.DataReencryptionJob, _ string, report func(db.DataReencryptionProgress) error) error {
+	for _, f := range encryptedFields {
+		if err := s.reencryptField(ctx, f, report); err != nil {
+			return fmt.Errorf("%s: %w", f.name, err)
+		}
+	}
+	return nil
+}
+
+func (s *Service) reencryptField(ctx context.Context, f encryptedField, report func(db.DataReencryptionProgress) error) error {
+	// Tenants whose keys were destroyed are skipped: their values are
+	// unreadable by design.
+	selectQuery := fmt.Sprintf(`
+		SELECT t.id, t.tenant_id, %s, %s
+		FROM %s t
+		WHERE %s AND t.id > $1
+		  AND NOT EXISTS (
+			SELECT 1 FROM tenant_data_keys d
+			WHERE d.tenant_id = t.tenant_id AND d.status = 'destroyed'
+		  )
+		ORDER BY t.id
+		LIMIT $2
+	`, f.value, f.plain, f.table, f.filter)
+	updateQuery := fmt.Sprintf(`UPDATE %s SET %s WHERE id = $1 AND %s = $3`, f.table, f.set, f.value)
+
+	after := pgtype.UUID{Valid: true}
+	for {
+		type pending struct {
+			id, tenantID pgtype.UUID
+			value        string
+			plain        bool
+		}
+		rows, err := s.db.Query(ctx, selectQuery, after, reencryptionBatchSize)
+		if err != nil {
+			return err
+		}
+		batch, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (pending, error) {
+			var p pending
+			err := row.Scan(&p.id, &p.tenantID, &p.value, &p.plain)
+			return p, err
+		})
+		if err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+
+		var p db.DataReencryptionProgress
+		for _, row := range batch {
+			tenantID := uuidString(row.tenantID)
+			upToDate, err := s.isCurrent(ctx, row.tenantID, row.value, row.plain)
+			if err == nil && upToDate {
+				continue
+			}
+			plain := []byte(row.value)
+			if err == nil && !row.plain {
+				plain, err = s.Decrypt(ctx, tenantID, row.value)
+			}
+			var sealed string
+			if err == nil {
+				sealed, err = s.Encrypt(ctx, tenantID, plain)
+			}
+			if err == nil {
+				// The value guard skips rows changed since they were read;
+				// those were written with the current key anyway.
+				_, err = s.db.Exec(ctx, updateQuery, row.id, sealed, row.value)
+			}
+			if err != nil {
+				p.Failures++
+				p.LastError = fmt.Sprintf("%s %s: %v", f.name, uuidString(row.id), err)
+				continue
+			}
+			p.ValuesReencrypted++
+		}
+		if err := report(p); err != nil {
+			return err
+		}
+		after = batch[len(batch)-1].id
+	}
+}
+
+// isCurrent reports whether value is already under the tenant's active key.
+func (s *Service) isCurrent(ctx context.Context, tid pgtype.UUID, value string, plain bool) (bool, error) {
+	if plain || !IsEnvelope(value) {
+		return false, nil
+	}
+	keyID, _, err := parseEnvelope(value)
+	if err != nil {
+		return false, err
+	}
+	active, err := s.activeKey(ctx, tid)
+	if err != nil {
+		return false, err
+	}
+	return active.id == keyID, nil
+}
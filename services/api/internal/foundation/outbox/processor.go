@@ -15,6 +15,9 @@ type Processor struct {
 	engine *automation.Engine
 }
 
+// NewProcessor handles outbox events in the API. Tenant webhook fan-out is not
+// done here: the worker consumes the same table, so SubscriptionService keeps
+// its own cursor instead.
 func NewProcessor(q db.Querier, engine *automation.Engine) *Processor {
 	return &Processor{q: q, engine: engine}
 }
@@ -33,8 +36,35 @@ func (p *Processor) Start(ctx context.Context) {
 	}
 }
 
+// workerDeliveredEvents are sent by the worker, which reads the same table.
+// The processor has nothing to do for them, so it must not take them: an event
+// it marked completed first would never be delivered.
+var workerDeliveredEvents = []string{
+	"auth.otp.requested",
+	"transport.bus_arriving",
+	"transport.student_boarded",
+	"transport.student_alighted",
+	"transport.missed_drop",
+	"transport.alert",
+	"transport.compliance_expiring",
+	"transport.service_due",
+	"library.reservation_ready",
+}
+
+// pendingEventSource is implemented by *db.Queries.
+type pendingEventSource interface {
+	GetPendingOutboxEventsExcept(ctx context.Context, limitCount int32, eventTypes []string) ([]db.Outbox, error)
+}
+
+func (p *Processor) pending(ctx context.Context) ([]db.Outbox, error) {
+	if src, ok := p.q.(pendingEventSource); ok {
+		return src.GetPendingOutboxEventsExcept(ctx, 50, workerDeliveredEvents)
+	}
+	return p.q.GetPendingOutboxEvents(ctx, 50)
+}
+
 func (p *Processor) process(ctx context.Context) {
-	events, err := p.q.GetPendingOutboxEvents(ctx, 50)
+	events, err := p.pending(ctx)
 	if err != nil {
 		log.Error().Err(err).Msg("failed to fetch pending outbox events")
 		return
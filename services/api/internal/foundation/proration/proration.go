@@ -0,0 +1,55 @@
+// Package proration scales a term charge to the part of the term it covers,
+// for the fee generators that bill by term. Dates are whole UTC days, as
+// DATE columns are scanned.
+package proration
+
+import (
+	"math"
+	"time"
+)
+
+// Modes a fee generator can be set to. With Monthly any part of a month
+// counts as the whole month; None charges the full term.
+const (
+	None    = "none"
+	Monthly = "monthly"
+	Daily   = "daily"
+)
+
+// Valid reports whether mode is one of the modes above.
+func Valid(mode string) bool {
+	return mode == None || mode == Monthly || mode == Daily
+}
+
+// DaysBetween counts whole days from one date to another.
+func DaysBetween(from, to time.Time) int {
+	return int(math.Round(to.Sub(from).Hours() / 24))
+}
+
+// Days counts the days from one date to another, both included.
+func Days(from, to time.Time) int {
+	return DaysBetween(from, to) + 1
+}
+
+// MonthsTouched counts the calendar months from one date to another,
+// both included.
+func MonthsTouched(from, to time.Time) int {
+	return (to.Year()-from.Year())*12 + int(to.Month()) - int(from.Month()) + 1
+}
+
+// Prorate scales a term amount to the part from..to of the term.
+func Prorate(amount int64, termStart, termEnd, from, to time.Time, mode string) int64 {
+	var part, whole int
+	switch mode {
+	case Daily:
+		part, whole = Days(from, to), Days(termStart, termEnd)
+	case Monthly:
+		part, whole = MonthsTouched(from, to), MonthsTouched(termStart, termEnd)
+	default:
+		return amount
+	}
+	if part >= whole {
+		return amount
+	}
+	return int64(math.Round(float64(amount) * float64(part) / float64(whole)))
+}
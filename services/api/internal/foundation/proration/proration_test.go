@@ -0,0 +1,46 @@
+package proration
+
+import (
+	"testing"
+	"time"
+)
+
+func day(s string) time.Time {
+	t, _ := time.Parse("2006-01-02", s)
+	return t
+}
+
+func TestProrate(t *testing.T) {
+	start, end := day("2026-04-01"), day("2026-09-30")
+	cases := []struct {
+		mode     string
+		from, to string
+		want     int64
+	}{
+		{None, "2026-07-15", "2026-09-30", 600000},
+		{Monthly, "2026-04-01", "2026-09-30", 600000},
+		{Monthly, "2026-07-15", "2026-09-30", 300000},
+		{Monthly, "2026-04-01", "2026-04-02", 100000},
+		{Daily, "2026-04-01", "2026-06-30", 298361},
+	}
+	for _, c := range cases {
+		if got := Prorate(600000, start, end, day(c.from), day(c.to), c.mode); got != c.want {
+			t.Fatalf("%s %s..%s: got %d, want %d", c.mode, c.from, c.to, got, c.want)
+		}
+	}
+}
+
+func TestDayAndMonthCounts(t *testing.T) {
+	if got := Days(day("2026-04-01"), day("2026-04-01")); got != 1 {
+		t.Fatalf("a single day should count once, got %d", got)
+	}
+	if got := DaysBetween(day("2026-03-01"), day("2026-04-01")); got != 31 {
+		t.Fatalf("expected 31 days in March, got %d", got)
+	}
+	if got := MonthsTouched(day("2025-12-31"), day("2026-01-01")); got != 2 {
+		t.Fatalf("a span across a year end touches two months, got %d", got)
+	}
+	if Valid("weekly") || !Valid(None) {
+		t.Fatalf("unexpected mode validation")
+	}
+}
@@ -0,0 +1,90 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+
+	"github.com/schoolerp/api/internal/foundation/sessionstore"
+)
+
+// Memory is the single-process limiter. It runs the same GCRA algorithm as the
+// Redis script so behaviour does not change when Redis drops out.
+type Memory struct {
+	mu        sync.Mutex
+	tats      map[string]time.Time
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		tats: make(map[string]time.Time),
+		now:  time.Now,
+	}
+}
+
+// Take charges one call against every request atomically.
+func (m *Memory) Take(reqs []Request) Decision {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	m.sweep(now)
+
+	type pending struct {
+		tat  time.Time
+		next time.Time
+	}
+	buckets := make([]pending, len(reqs))
+	states := make([]sessionstore.RateLimitState, len(reqs))
+	allowed := true
+	for i, req := range reqs {
+		tat := m.tats[req.Key]
+		if tat.Before(now) {
+			tat = now
+		}
+		next := tat.Add(interval(req))
+		if allowAt := next.Add(-req.Window); allowAt.After(now) {
+			allowed = false
+			states[i].RetryAfter = allowAt.Sub(now)
+		}
+		buckets[i] = pending{tat: tat, next: next}
+	}
+
+	for i, req := range reqs {
+		b := buckets[i]
+		if allowed {
+			m.tats[req.Key] = b.next
+			states[i].Remaining = int(now.Sub(b.next.Add(-req.Window)) / interval(req))
+			states[i].ResetAfter = b.next.Sub(now)
+			continue
+		}
+		if states[i].RetryAfter == 0 {
+			states[i].Remaining = int(now.Add(req.Window).Sub(b.tat) / interval(req))
+		}
+		states[i].ResetAfter = b.tat.Sub(now)
+	}
+
+	return decide(reqs, allowed, states)
+}
+
+// sweep drops buckets that have fully refilled; they carry no state.
+func (m *Memory) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < memorySweepEvery {
+		return
+	}
+	m.lastSweep = now
+	for key, tat := range m.tats {
+		if !tat.After(now) {
+			delete(m.tats, key)
+		}
+	}
+}
+
+func interval(req Request) time.Duration {
+	step := req.Window / time.Duration(req.Limit)
+	if step <= 0 {
+		step = time.Nanosecond
+	}
+	return step
+}
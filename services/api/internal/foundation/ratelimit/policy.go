@@ -0,0 +1,126 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// PolicySettingKey is the platform_settings key holding the Policy JSON.
+const PolicySettingKey = "security.rate_limits"
+
+const (
+	maxQuotaLimit         = 1_000_000
+	maxQuotaWindowSeconds = 24 * 60 * 60
+)
+
+var (
+	ErrInvalidPolicy = errors.New("invalid rate limit policy")
+
+	groupNamePattern = regexp.MustCompile(`^[a-z0-9_]{1,64}$`)
+)
+
+// Quota allows Limit requests per WindowSeconds, refilled continuously.
+type Quota struct {
+	Limit         int `json:"limit"`
+	WindowSeconds int `json:"window_seconds"`
+}
+
+func (q Quota) Window() time.Duration {
+	return time.Duration(q.WindowSeconds) * time.Second
+}
+
+// GroupPolicy holds the quotas for one route group. PerClient keys on the
+// client IP (or the route's own key); PerTenant and PerUser apply only once
+// the request has a resolved tenant or user. Nil quotas are not enforced
+// unless the route supplies a default.
+type GroupPolicy struct {
+	PerClient *Quota `json:"per_client,omitempty"`
+	PerTenant *Quota `json:"per_tenant,omitempty"`
+	PerUser   *Quota `json:"per_user,omitempty"`
+}
+
+// Merge returns g with any quota set in override replacing its own.
+func (g GroupPolicy) Merge(override GroupPolicy) GroupPolicy {
+	if override.PerClient != nil {
+		g.PerClient = override.PerClient
+	}
+	if override.PerTenant != nil {
+		g.PerTenant = override.PerTenant
+	}
+	if override.PerUser != nil {
+		g.PerUser = override.PerUser
+	}
+	return g
+}
+
+// Policy is the platform-wide rate limit configuration keyed by route group,
+// e.g. "auth", "admin", "parent" or a named limiter such as "otp_request".
+type Policy struct {
+	Groups map[string]GroupPolicy `json:"groups"`
+}
+
+// Group returns the configured quotas for name, if any.
+func (p Policy) Group(name string) (GroupPolicy, bool) {
+	g, ok := p.Groups[name]
+	return g, ok
+}
+
+// ParsePolicy decodes and validates a stored policy. An empty value is an
+// empty policy.
+func ParsePolicy(raw []byte) (Policy, error) {
+	var p Policy
+	if len(raw) == 0 {
+		return p, nil
+	}
+	if err := json.Unmarshal(raw, &p); err != nil {
+		return Policy{}, fmt.Errorf("%w: %v", ErrInvalidPolicy, err)
+	}
+	if err := p.Validate(); err != nil {
+		return Policy{}, err
+	}
+	return p, nil
+}
+
+func (p Policy) Validate() error {
+	for name, group := range p.Groups {
+		if !groupNamePattern.MatchString(name) {
+			return fmt.Errorf("%w: group %q must be lowercase letters, digits or underscores", ErrInvalidPolicy, name)
+		}
+		for scope, q := range map[string]*Quota{"per_client": group.PerClient, "per_tenant": group.PerTenant, "per_user": group.PerUser} {
+			if q == nil {
+				continue
+			}
+			if q.Limit <= 0 || q.Limit > maxQuotaLimit {
+				return fmt.Errorf("%w: %s.%s.limit must be between 1 and %d", ErrInvalidPolicy, name, scope, maxQuotaLimit)
+			}
+			if q.WindowSeconds <= 0 || q.WindowSeconds > maxQuotaWindowSeconds {
+				return fmt.Errorf("%w: %s.%s.window_seconds must be between 1 and %d", ErrInvalidPolicy, name, scope, maxQuotaWindowSeconds)
+			}
+		}
+	}
+	return nil
+}
+
+// Requests expands the group's quotas into limiter requests for one call.
+// Quotas whose identity is unknown (no tenant, anonymous user) are skipped.
+func (g GroupPolicy) Requests(group, clientKey, tenantID, userID string) []Request {
+	reqs := make([]Request, 0, 3)
+	add := func(scope, id string, q *Quota) {
+		if q == nil || id == "" || q.Limit <= 0 || q.WindowSeconds <= 0 {
+			return
+		}
+		reqs = append(reqs, Request{
+			Scope:  scope,
+			Key:    group + ":" + scope + ":" + id,
+			Limit:  q.Limit,
+			Window: q.Window(),
+		})
+	}
+	add("client", clientKey, g.PerClient)
+	add("tenant", tenantID, g.PerTenant)
+	add("user", userID, g.PerUser)
+	return reqs
+}
@@ -0,0 +1,176 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/schoolerp/api/internal/foundation/sessionstore"
+)
+
+const (
+	redisTimeout      = 500 * time.Millisecond
+	policyCacheTTL    = 30 * time.Second
+	policyLoadTimeout = time.Second
+	fallbackLogEvery  = 30 * time.Second
+	memorySweepEvery  = time.Minute
+)
+
+// Request is one quota to charge for an incoming call. Scope names the quota
+// (client, tenant, user) for headers and security events.
+type Request struct {
+	Scope  string
+	Key    string
+	Limit  int
+	Window time.Duration
+}
+
+// Decision is the outcome of charging a set of quotas. Limit, Remaining and
+// ResetAfter describe the most restrictive quota; when the call is rejected
+// they describe the quota that rejected it.
+type Decision struct {
+	Allowed    bool
+	Scope      string
+	Key        string
+	Limit      int
+	Window     time.Duration
+	Remaining  int
+	RetryAfter time.Duration
+	ResetAfter time.Duration
+	Backend    string
+}
+
+// PolicyLoader returns the raw platform rate-limit policy, or nil if unset.
+type PolicyLoader func(ctx context.Context) ([]byte, error)
+
+// Limiter charges quotas against Redis when the session store is configured
+// so limits hold across API replicas, and against process memory otherwise or
+// whenever Redis is unreachable.
+type Limiter struct {
+	store  *sessionstore.Store
+	memory *Memory
+	loader PolicyLoader
+
+	mu             sync.Mutex
+	policy         Policy
+	policyLoadedAt time.Time
+	lastFallbackAt time.Time
+}
+
+func New(store *sessionstore.Store, loader PolicyLoader) *Limiter {
+	return &Limiter{
+		store:  store,
+		memory: NewMemory(),
+		loader: loader,
+	}
+}
+
+// Take charges one call against every request. It never fails: errors from
+// Redis fall back to the in-memory limiter.
+func (l *Limiter) Take(ctx context.Context, reqs []Request) Decision {
+	if len(reqs) == 0 {
+		return Decision{Allowed: true}
+	}
+
+	if l.store.Enabled() {
+		redisCtx, cancel := context.WithTimeout(ctx, redisTimeout)
+		allowed, states, err := l.store.TakeRateLimit(redisCtx, toStoreRequests(reqs))
+		cancel()
+		if err == nil {
+			decision := decide(reqs, allowed, states)
+			decision.Backend = "redis"
+			return decision
+		}
+		l.logFallback(err)
+	}
+
+	decision := l.memory.Take(reqs)
+	decision.Backend = "memory"
+	return decision
+}
+
+// Policy returns the platform policy, reloading it at most every 30 seconds.
+// A failed load keeps serving the previous policy.
+func (l *Limiter) Policy(ctx context.Context) Policy {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.loader == nil || (!l.policyLoadedAt.IsZero() && time.Since(l.policyLoadedAt) < policyCacheTTL) {
+		return l.policy
+	}
+	l.policyLoadedAt = time.Now()
+
+	loadCtx, cancel := context.WithTimeout(ctx, policyLoadTimeout)
+	defer cancel()
+	raw, err := l.loader(loadCtx)
+	if err != nil {
+		log.Warn().Err(err).Msg("rate limit policy load failed; keeping previous policy")
+		return l.policy
+	}
+	policy, err := ParsePolicy(raw)
+	if err != nil {
+		log.Warn().Err(err).Msg("rate limit policy is invalid; keeping previous policy")
+		return l.policy
+	}
+	l.policy = policy
+	return l.policy
+}
+
+// InvalidatePolicy forces the next Policy call to reload from the loader.
+func (l *Limiter) InvalidatePolicy() {
+	l.mu.Lock()
+	l.policyLoadedAt = time.Time{}
+	l.mu.Unlock()
+}
+
+func (l *Limiter) logFallback(err error) {
+	l.mu.Lock()
+	due := time.Since(l.lastFallbackAt) >= fallbackLogEvery
+	if due {
+		l.lastFallbackAt = time.Now()
+	}
+	l.mu.Unlock()
+	if due {
+		log.Warn().Err(err).Msg("redis rate limiter unavailable; falling back to in-memory limits")
+	}
+}
+
+func toStoreRequests(reqs []Request) []sessionstore.RateLimitRequest {
+	out := make([]sessionstore.RateLimitRequest, len(reqs))
+	for i, req := range reqs {
+		out[i] = sessionstore.RateLimitRequest{Key: req.Key, Limit: req.Limit, Window: req.Window}
+	}
+	return out
+}
+
+// decide folds per-key states into a single decision.
+func decide(reqs []Request, allowed bool, states []sessionstore.RateLimitState) Decision {
+	pick := -1
+	for i := range reqs {
+		if i >= len(states) {
+			break
+		}
+		switch {
+		case pick == -1:
+			pick = i
+		case !allowed && states[i].RetryAfter > states[pick].RetryAfter:
+			pick = i
+		case allowed && states[i].Remaining < states[pick].Remaining:
+			pick = i
+		}
+	}
+	if pick == -1 {
+		return Decision{Allowed: allowed}
+	}
+	return Decision{
+		Allowed:    allowed,
+		Scope:      reqs[pick].Scope,
+		Key:        reqs[pick].Key,
+		Limit:      reqs[pick].Limit,
+		Window:     reqs[pick].Window,
+		Remaining:  states[pick].Remaining,
+		RetryAfter: states[pick].RetryAfter,
+		ResetAfter: states[pick].ResetAfter,
+	}
+}
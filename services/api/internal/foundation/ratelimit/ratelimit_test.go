@@ -0,0 +1,111 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func newTestMemory(now *time.Time) *Memory {
+	m := NewMemory()
+	m.now = func() time.Time { return *now }
+	return m
+}
+
+func TestMemoryRefillsContinuously(t *testing.T) {
+	now := time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)
+	m := newTestMemory(&now)
+	req := []Request{{Scope: "client", Key: "auth:client:1.2.3.4", Limit: 3, Window: 3 * time.Second}}
+
+	for i, want := range []int{2, 1, 0} {
+		d := m.Take(req)
+		if !d.Allowed || d.Remaining != want {
+			t.Fatalf("call %d: allowed=%v remaining=%d, want remaining %d", i+1, d.Allowed, d.Remaining, want)
+		}
+	}
+
+	d := m.Take(req)
+	if d.Allowed {
+		t.Fatalf("expected fourth call inside the window to be rejected")
+	}
+	if d.RetryAfter != time.Second {
+		t.Fatalf("expected retry after one refill interval, got %s", d.RetryAfter)
+	}
+
+	// A sliding refill frees one slot per interval rather than resetting the
+	// whole window at once.
+	now = now.Add(time.Second)
+	if d := m.Take(req); !d.Allowed || d.Remaining != 0 {
+		t.Fatalf("expected exactly one slot after one interval, got allowed=%v remaining=%d", d.Allowed, d.Remaining)
+	}
+	if d := m.Take(req); d.Allowed {
+		t.Fatalf("expected the refilled slot to be used up")
+	}
+}
+
+func TestMemoryChargesAllQuotasAtomically(t *testing.T) {
+	now := time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)
+	m := newTestMemory(&now)
+	tenant := Request{Scope: "tenant", Key: "admin:tenant:t1", Limit: 10, Window: time.Minute}
+	user := Request{Scope: "user", Key: "admin:user:u1", Limit: 1, Window: time.Minute}
+
+	if d := m.Take([]Request{tenant, user}); !d.Allowed || d.Scope != "user" {
+		t.Fatalf("expected first call allowed with user as the tightest quota, got %+v", d)
+	}
+	d := m.Take([]Request{tenant, user})
+	if d.Allowed || d.Scope != "user" {
+		t.Fatalf("expected the user quota to reject, got %+v", d)
+	}
+
+	// The rejected call must not have consumed tenant capacity.
+	if d := m.Take([]Request{tenant}); !d.Allowed || d.Remaining != 8 {
+		t.Fatalf("expected tenant to have 8 left after one admitted call, got %+v", d)
+	}
+}
+
+func TestLimiterFallsBackToMemoryWithoutRedis(t *testing.T) {
+	l := New(nil, nil)
+	req := []Request{{Scope: "client", Key: "k", Limit: 1, Window: time.Minute}}
+
+	if d := l.Take(context.Background(), req); !d.Allowed || d.Backend != "memory" {
+		t.Fatalf("expected in-memory admission, got %+v", d)
+	}
+	if d := l.Take(context.Background(), req); d.Allowed {
+		t.Fatalf("expected in-memory limiter to enforce the quota")
+	}
+}
+
+func TestPolicyParseAndMerge(t *testing.T) {
+	raw := []byte(`{"groups":{"otp_request":{"per_client":{"limit":2,"window_seconds":60},"per_tenant":{"limit":100,"window_seconds":60}}}}`)
+	policy, err := ParsePolicy(raw)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	group, ok := policy.Group("otp_request")
+	if !ok {
+		t.Fatalf("expected otp_request group")
+	}
+
+	defaults := GroupPolicy{PerClient: &Quota{Limit: 5, WindowSeconds: 60}}
+	merged := defaults.Merge(group)
+	if merged.PerClient.Limit != 2 || merged.PerTenant == nil || merged.PerUser != nil {
+		t.Fatalf("unexpected merge result: %+v", merged)
+	}
+
+	reqs := merged.Requests("otp_request", "1.2.3.4", "", "")
+	if len(reqs) != 1 || reqs[0].Key != "otp_request:client:1.2.3.4" {
+		t.Fatalf("tenant quota must be skipped without a tenant, got %+v", reqs)
+	}
+
+	for _, bad := range []string{
+		`{"groups":{"Admin":{}}}`,
+		`{"groups":{"admin":{"per_user":{"limit":0,"window_seconds":60}}}}`,
+		`{"groups":{"admin":{"per_user":{"limit":10,"window_seconds":0}}}}`,
+		`{"groups":`,
+	} {
+		if _, err := ParsePolicy([]byte(bad)); !errors.Is(err, ErrInvalidPolicy) {
+			t.Fatalf("expected %s to be rejected, got %v", bad, err)
+		}
+	}
+}
@@ -1,11 +1,11 @@
 package security
 
 import (
-	"crypto/aes"
-	"crypto/cipher"
 	"crypto/rand"
 	"errors"
 	"io"
+
+	"github.com/schoolerp/shared/datacrypt"
 )
 
 // Crypto provides AES-GCM encryption/decryption.
@@ -23,46 +23,23 @@ func NewCrypto(key []byte) (*Crypto, error) {
 
 // Encrypt encrypts plain text using AES-GCM.
 func (c *Crypto) Encrypt(plainText []byte) ([]byte, error) {
-	block, err := aes.NewCipher(c.key)
-	if err != nil {
-		return nil, err
-	}
-
-	gcm, err := cipher.NewGCM(block)
-	if err != nil {
-		return nil, err
-	}
-
-	nonce := make([]byte, gcm.NonceSize())
-	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
-		return nil, err
-	}
-
-	// Output is nonce + cipherText
-	return gcm.Seal(nonce, nonce, plainText, nil), nil
+	return c.Seal(plainText, nil)
 }
 
 // Decrypt decrypts cipher text using AES-GCM.
 func (c *Crypto) Decrypt(cipherText []byte) ([]byte, error) {
-	block, err := aes.NewCipher(c.key)
-	if err != nil {
-		return nil, err
-	}
-
-	gcm, err := cipher.NewGCM(block)
-	if err != nil {
-		return nil, err
-	}
-
-	nonceSize := gcm.NonceSize()
-	if len(cipherText) < nonceSize {
-		return nil, errors.New("cipher text too short")
-	}
+	return c.Open(cipherText, nil)
+}
 
-	nonce := cipherText[:nonceSize]
-	actualCipherText := cipherText[nonceSize:]
+// Seal encrypts plain text and authenticates additionalData alongside it;
+// Open must be given the same additionalData. Output is nonce + cipherText.
+func (c *Crypto) Seal(plainText, additionalData []byte) ([]byte, error) {
+	return datacrypt.Seal(c.key, plainText, additionalData)
+}
 
-	return gcm.Open(nil, nonce, actualCipherText, nil)
+// Open reverses Seal.
+func (c *Crypto) Open(cipherText, additionalData []byte) ([]byte, error) {
+	return datacrypt.Open(c.key, cipherText, additionalData)
 }
 
 // GenerateRandomKey generates a random 32-byte key.
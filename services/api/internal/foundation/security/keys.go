@@ -0,0 +1,58 @@
+package security
+
+import (
+	"encoding/base64"
+
+	"github.com/schoolerp/shared/datacrypt"
+)
+
+var ErrDataKeysNotConfigured = datacrypt.ErrKeysNotConfigured
+
+// ResolveDataEncryptionKeys returns the AES-256 keys used for data at rest.
+// Order matters: the first key encrypts, all keys are tried when decrypting.
+// The worker reads the same keys through datacrypt.
+//
+// Supported env vars:
+// - DATA_ENCRYPTION_KEYS: comma-separated list of keys (preferred for rotation)
+// - DATA_ENCRYPTION_KEY: single key (legacy)
+//
+// Each key is either 32 raw characters or base64 for 32 bytes.
+func ResolveDataEncryptionKeys() ([][]byte, error) {
+	return datacrypt.ResolveKeys()
+}
+
+// MasterKeyID identifies a data encryption master key without revealing it:
+// the first 16 hex characters of its SHA-256 fingerprint, which is also what
+// secret rotation reports for a newly generated key.
+func MasterKeyID(key []byte) string {
+	return datacrypt.MasterKeyID(key)
+}
+
+// EncryptString encrypts s with the current master key and returns base64
+// text. Tenant-owned data should go through keyring instead, which adds
+// per-tenant keys and crypto-shredding; this remains for platform secrets
+// and values written before envelope encryption.
+func EncryptString(s string) (string, error) {
+	keys, err := ResolveDataEncryptionKeys()
+	if err != nil {
+		return "", err
+	}
+	out, err := datacrypt.Seal(keys[0], []byte(s), nil)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(out), nil
+}
+
+// DecryptString reverses EncryptString, trying every configured key.
+func DecryptString(s string) (string, error) {
+	keys, err := ResolveDataEncryptionKeys()
+	if err != nil {
+		return "", err
+	}
+	plain, err := datacrypt.OpenLegacy(keys, s)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
@@ -0,0 +1,118 @@
+package sessionstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const rateLimitKeyPrefix = "ratelimit"
+
+// rateLimitScript runs GCRA (a continuously refilling token bucket) over every
+// key in one atomic step: the request is admitted only if all keys have
+// capacity, and no key is charged otherwise. Times are milliseconds taken from
+// the Redis clock so replicas never disagree about "now".
+//
+// ARGV holds (limit, window_ms) pairs in key order. The reply is
+// {allowed, remaining_1, retry_ms_1, reset_ms_1, remaining_2, ...}.
+const rateLimitScript = `
+redis.replicate_commands()
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + tonumber(t[2]) / 1000
+local allowed = 1
+local state = {}
+for i = 1, #KEYS do
+  local limit = tonumber(ARGV[i * 2 - 1])
+  local window = tonumber(ARGV[i * 2])
+  local interval = window / limit
+  local tat = tonumber(redis.call('GET', KEYS[i]) or now) or now
+  if tat < now then tat = now end
+  local nxt = tat + interval
+  local retry = 0
+  if nxt - window > now then
+    allowed = 0
+    retry = nxt - window - now
+  end
+  state[i] = {tat, nxt, interval, window, retry}
+end
+local reply = {allowed}
+for i = 1, #KEYS do
+  local tat, nxt, interval, window, retry = unpack(state[i])
+  local remaining, reset
+  if allowed == 1 then
+    redis.call('SET', KEYS[i], string.format('%.3f', nxt), 'PX', math.ceil(nxt - now))
+    remaining = math.floor((now - (nxt - window)) / interval)
+    reset = nxt - now
+  else
+    remaining = math.floor((now + window - tat) / interval)
+    if retry > 0 then remaining = 0 end
+    reset = tat - now
+  end
+  table.insert(reply, remaining)
+  table.insert(reply, math.ceil(retry))
+  table.insert(reply, math.ceil(reset))
+end
+return reply
+`
+
+// RateLimitRequest is one quota to charge: Limit requests per Window.
+type RateLimitRequest struct {
+	Key    string
+	Limit  int
+	Window time.Duration
+}
+
+// RateLimitState reports a key's bucket after a TakeRateLimit call.
+// RetryAfter is zero unless this key rejected the request.
+type RateLimitState struct {
+	Remaining  int
+	RetryAfter time.Duration
+	ResetAfter time.Duration
+}
+
+// TakeRateLimit charges one request against every key atomically and reports
+// whether it was admitted along with the state of each key.
+func (s *Store) TakeRateLimit(ctx context.Context, reqs []RateLimitRequest) (bool, []RateLimitState, error) {
+	if !s.Enabled() {
+		return false, nil, ErrUnavailable
+	}
+	if len(reqs) == 0 {
+		return true, nil, nil
+	}
+
+	args := make([]string, 0, 3+len(reqs)*3)
+	args = append(args, "EVAL", rateLimitScript, strconv.Itoa(len(reqs)))
+	for _, req := range reqs {
+		key := strings.TrimSpace(req.Key)
+		if key == "" || req.Limit <= 0 || req.Window <= 0 {
+			return false, nil, errors.New("invalid rate limit request")
+		}
+		args = append(args, rateLimitKeyPrefix+":"+key)
+	}
+	for _, req := range reqs {
+		args = append(args, strconv.Itoa(req.Limit), strconv.FormatInt(req.Window.Milliseconds(), 10))
+	}
+
+	value, err := s.do(ctx, args...)
+	if err != nil {
+		return false, nil, err
+	}
+	if value.kind != respArray || len(value.array) != 1+len(reqs)*3 {
+		return false, nil, fmt.Errorf("unexpected rate limit reply")
+	}
+
+	states := make([]RateLimitState, len(reqs))
+	for i := range reqs {
+		base := 1 + i*3
+		states[i] = RateLimitState{
+			Remaining:  int(math.Max(0, float64(value.array[base].num))),
+			RetryAfter: time.Duration(value.array[base+1].num) * time.Millisecond,
+			ResetAfter: time.Duration(value.array[base+2].num) * time.Millisecond,
+		}
+	}
+	return value.array[0].num == 1, states, nil
+}
@@ -0,0 +1,318 @@
+package sso
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"html/template"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// MockIdP is a self-contained OpenID provider and SAML IdP for tests and local
+// development. Every authorization request is approved immediately for User.
+// It is not meant to be exposed beyond a developer machine.
+type MockIdP struct {
+	// BaseURL is the externally reachable root of the server, e.g. the httptest URL.
+	BaseURL      string
+	ClientID     string
+	ClientSecret string
+	User         Identity
+
+	Key     *rsa.PrivateKey
+	Cert    *x509.Certificate
+	CertPEM string
+
+	mu    sync.Mutex
+	codes map[string]mockAuthCode
+}
+
+type mockAuthCode struct {
+	clientID    string
+	redirectURI string
+	nonce       string
+	challenge   string
+	expiresAt   time.Time
+}
+
+const mockKeyID = "mock-idp-key"
+
+// NewMockIdP creates a mock IdP with a fresh RSA key and self-signed certificate.
+func NewMockIdP() (*MockIdP, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "schoolerp mock idp"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().AddDate(1, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return &MockIdP{
+		ClientID:     "schoolerp",
+		ClientSecret: "mock-secret",
+		User: Identity{
+			Subject: "mock-user-1",
+			Email:   "teacher@example.edu",
+			Name:    "Mock Teacher",
+			Groups:  []string{"staff"},
+		},
+		Key:     key,
+		Cert:    cert,
+		CertPEM: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		codes:   map[string]mockAuthCode{},
+	}, nil
+}
+
+// EntityID is the SAML entity ID of the mock IdP.
+func (m *MockIdP) EntityID() string { return m.BaseURL + "/saml/metadata" }
+
+// SAMLSSOURL is where AuthnRequests are sent.
+func (m *MockIdP) SAMLSSOURL() string { return m.BaseURL + "/saml/sso" }
+
+func (m *MockIdP) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/.well-known/openid-configuration":
+		writeMockJSON(w, map[string]string{
+			"issuer":                 m.BaseURL,
+			"authorization_endpoint": m.BaseURL + "/authorize",
+			"token_endpoint":         m.BaseURL + "/token",
+			"jwks_uri":               m.BaseURL + "/jwks",
+		})
+	case "/jwks":
+		pub := m.Key.PublicKey
+		writeMockJSON(w, map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": mockKeyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}}})
+	case "/authorize":
+		m.authorize(w, r)
+	case "/token":
+		m.token(w, r)
+	case "/saml/sso":
+		m.samlSSO(w, r)
+	case "/saml/metadata":
+		w.Header().Set("Content-Type", "application/xml")
+		fmt.Fprintf(w, `<md:EntityDescriptor xmlns:md="%s" entityID="%s"><md:IDPSSODescriptor protocolSupportEnumeration="%s">`+
+			`<md:SingleSignOnService Binding="%s" Location="%s"/></md:IDPSSODescriptor></md:EntityDescriptor>`,
+			nsSAMLMetadata, xmlEscape(m.EntityID()), nsSAMLProtocol, samlBindingRedirect, xmlEscape(m.SAMLSSOURL()))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (m *MockIdP) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("response_type") != "code" || q.Get("client_id") != m.ClientID || q.Get("code_challenge_method") != "S256" {
+		http.Error(w, "invalid authorization request", http.StatusBadRequest)
+		return
+	}
+	redirect, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil || redirect.Scheme == "" {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	code := randomToken(16)
+	m.mu.Lock()
+	m.codes[code] = mockAuthCode{
+		clientID:    m.ClientID,
+		redirectURI: q.Get("redirect_uri"),
+		nonce:       q.Get("nonce"),
+		challenge:   q.Get("code_challenge"),
+		expiresAt:   time.Now().Add(time.Minute),
+	}
+	m.mu.Unlock()
+
+	rq := redirect.Query()
+	rq.Set("code", code)
+	rq.Set("state", q.Get("state"))
+	redirect.RawQuery = rq.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (m *MockIdP) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		http.Error(w, `{"error":"invalid_request"}`, http.StatusBadRequest)
+		return
+	}
+	if r.PostForm.Get("client_id") != m.ClientID || r.PostForm.Get("client_secret") != m.ClientSecret {
+		http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+		return
+	}
+
+	m.mu.Lock()
+	ac, ok := m.codes[r.PostForm.Get("code")]
+	delete(m.codes, r.PostForm.Get("code"))
+	m.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || time.Now().After(ac.expiresAt) || ac.redirectURI != r.PostForm.Get("redirect_uri") ||
+		base64.RawURLEncoding.EncodeToString(sum[:]) != ac.challenge {
+		http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	tok := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":            m.BaseURL,
+		"sub":            m.User.Subject,
+		"aud":            ac.clientID,
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"iat":            now.Unix(),
+		"nonce":          ac.nonce,
+		"email":          m.User.Email,
+		"email_verified": m.User.EmailVerified || m.User.Email != "",
+		"name":           m.User.Name,
+		"groups":         m.User.Groups,
+		"amr":            m.User.AuthMethods,
+	})
+	tok.Header["kid"] = mockKeyID
+	signed, err := tok.SignedString(m.Key)
+	if err != nil {
+		http.Error(w, `{"error":"server_error"}`, http.StatusInternalServerError)
+		return
+	}
+	writeMockJSON(w, map[string]interface{}{
+		"access_token": randomToken(16),
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     signed,
+	})
+}
+
+var mockPostForm = template.Must(template.New("saml").Parse(`<!DOCTYPE html>
+<html><body onload="document.forms[0].submit()">
+<form method="post" action="{{.Action}}">
+<input type="hidden" name="SAMLResponse" value="{{.Response}}">
+<input type="hidden" name="RelayState" value="{{.RelayState}}">
+<noscript><button type="submit">Continue</button></noscript>
+</form></body></html>`))
+
+func (m *MockIdP) samlSSO(w http.ResponseWriter, r *http.Request) {
+	raw, err := base64.StdEncoding.DecodeString(r.URL.Query().Get("SAMLRequest"))
+	if err != nil {
+		http.Error(w, "invalid SAMLRequest", http.StatusBadRequest)
+		return
+	}
+	inflated, err := io.ReadAll(io.LimitReader(flate.NewReader(bytes.NewReader(raw)), 1<<16))
+	if err != nil {
+		http.Error(w, "invalid SAMLRequest", http.StatusBadRequest)
+		return
+	}
+	req, err := parseXMLDocument(inflated)
+	if err != nil || !req.is(nsSAMLProtocol, "AuthnRequest") {
+		http.Error(w, "invalid SAMLRequest", http.StatusBadRequest)
+		return
+	}
+	audience := ""
+	if iss := req.Element(nsSAMLAssertion, "Issuer"); iss != nil {
+		audience = iss.Text()
+	}
+	acs := req.Attr("AssertionConsumerServiceURL")
+
+	resp, err := m.SAMLResponse(req.Attr("ID"), acs, audience, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_ = mockPostForm.Execute(w, map[string]string{
+		"Action":     acs,
+		"Response":   resp,
+		"RelayState": r.URL.Query().Get("RelayState"),
+	})
+}
+
+// SAMLResponse returns a base64 Response with a signed assertion for User, as it
+// would be posted to the ACS.
+func (m *MockIdP) SAMLResponse(inResponseTo, acsURL, audience string, now time.Time) (string, error) {
+	now = now.UTC()
+	ts := func(t time.Time) string { return t.Format(time.RFC3339) }
+
+	var attrs strings.Builder
+	writeAttr := func(name string, values ...string) {
+		if len(values) == 0 {
+			return
+		}
+		fmt.Fprintf(&attrs, `<saml:Attribute Name="%s">`, xmlEscape(name))
+		for _, v := range values {
+			fmt.Fprintf(&attrs, `<saml:AttributeValue>%s</saml:AttributeValue>`, xmlEscape(v))
+		}
+		attrs.WriteString(`</saml:Attribute>`)
+	}
+	if m.User.Email != "" {
+		writeAttr("email", m.User.Email)
+	}
+	if m.User.Name != "" {
+		writeAttr("displayName", m.User.Name)
+	}
+	writeAttr("groups", m.User.Groups...)
+
+	assertionID := NewSAMLRequestID()
+	doc := fmt.Sprintf(
+		`<samlp:Response xmlns:samlp="%[1]s" xmlns:saml="%[2]s" ID="%[3]s" Version="2.0" IssueInstant="%[4]s" Destination="%[5]s" InResponseTo="%[6]s">`+
+			`<saml:Issuer>%[7]s</saml:Issuer>`+
+			`<samlp:Status><samlp:StatusCode Value="%[8]s"/></samlp:Status>`+
+			`<saml:Assertion ID="%[9]s" Version="2.0" IssueInstant="%[4]s">`+
+			`<saml:Issuer>%[7]s</saml:Issuer>`+
+			`<saml:Subject><saml:NameID Format="%[10]s">%[11]s</saml:NameID>`+
+			`<saml:SubjectConfirmation Method="urn:oasis:names:tc:SAML:2.0:cm:bearer">`+
+			`<saml:SubjectConfirmationData InResponseTo="%[6]s" Recipient="%[5]s" NotOnOrAfter="%[12]s"/>`+
+			`</saml:SubjectConfirmation></saml:Subject>`+
+			`<saml:Conditions NotBefore="%[13]s" NotOnOrAfter="%[12]s">`+
+			`<saml:AudienceRestriction><saml:Audience>%[14]s</saml:Audience></saml:AudienceRestriction></saml:Conditions>`+
+			`<saml:AuthnStatement AuthnInstant="%[4]s"><saml:AuthnContext>`+
+			`<saml:AuthnContextClassRef>urn:oasis:names:tc:SAML:2.0:ac:classes:PasswordProtectedTransport</saml:AuthnContextClassRef>`+
+			`</saml:AuthnContext></saml:AuthnStatement>`+
+			`<saml:AttributeStatement>%[15]s</saml:AttributeStatement>`+
+			`</saml:Assertion></samlp:Response>`,
+		nsSAMLProtocol, nsSAMLAssertion, NewSAMLRequestID(), ts(now), xmlEscape(acsURL), xmlEscape(inResponseTo),
+		xmlEscape(m.EntityID()), samlStatusSuccess, assertionID, samlNameIDEmail, xmlEscape(m.User.Subject),
+		ts(now.Add(5*time.Minute)), ts(now.Add(-time.Minute)), xmlEscape(audience), attrs.String(),
+	)
+
+	root, err := parseXMLDocument([]byte(doc))
+	if err != nil {
+		return "", err
+	}
+	assertion := root.Element(nsSAMLAssertion, "Assertion")
+	if err := signEnveloped(assertion, m.Key, m.Cert); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(serialize(root)), nil
+}
+
+func writeMockJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,394 @@
+// Package sso implements the OpenID Connect and SAML 2.0 relying-party pieces used for
+// staff single sign-on. It only speaks the protocols; account linking and role mapping
+// live in the auth service.
+package sso
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var ErrIDTokenInvalid = errors.New("oidc id token is invalid")
+
+// Identity is what an IdP asserted about the signed-in user.
+type Identity struct {
+	Subject       string              `json:"subject"`
+	Email         string              `json:"email"`
+	EmailVerified bool                `json:"email_verified"`
+	Name          string              `json:"name"`
+	Groups        []string            `json:"groups"`
+	Attributes    map[string][]string `json:"-"`
+	// AuthMethods is how the IdP says it authenticated the user: the OIDC amr
+	// claim, or the SAML AuthnContextClassRef.
+	AuthMethods []string `json:"auth_methods"`
+}
+
+// phishingResistantMethods are amr values (RFC 8176 and common IdP extensions)
+// and SAML authentication context classes that prove a key bound to the origin
+// or to hardware, rather than a secret the user could be tricked into typing.
+var phishingResistantMethods = map[string]bool{
+	"hwk":  true,
+	"fido": true,
+	"phr":  true,
+	"phrh": true,
+	"sc":   true,
+	"urn:oasis:names:tc:SAML:2.0:ac:classes:X509":                     true,
+	"urn:oasis:names:tc:SAML:2.0:ac:classes:Smartcard":                true,
+	"urn:oasis:names:tc:SAML:2.0:ac:classes:SmartcardPKI":             true,
+	"urn:oasis:names:tc:SAML:2.0:ac:classes:TLSClient":                true,
+	"urn:rsa:names:tc:SAML:2.0:ac:classes:FIDO":                       true,
+	"https://refeds.org/profile/mfa/phishing-resistant":               true,
+	"http://schemas.microsoft.com/claims/authnmethodsreferences/fido": true,
+}
+
+// PhishingResistant reports whether the IdP asserted a phishing-resistant
+// authentication method.
+func (id *Identity) PhishingResistant() bool {
+	return PhishingResistantMethods(id.AuthMethods)
+}
+
+// PhishingResistantMethods reports whether any of methods is phishing-resistant.
+func PhishingResistantMethods(methods []string) bool {
+	for _, m := range methods {
+		if phishingResistantMethods[strings.TrimSpace(m)] {
+			return true
+		}
+	}
+	return false
+}
+
+// OIDCConfig describes one relying-party registration with an OpenID provider.
+type OIDCConfig struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	GroupsClaim  string
+	// AssumeEmailVerified trusts the email claim when the IdP omits email_verified,
+	// as Microsoft Entra ID does for organisational accounts.
+	AssumeEmailVerified bool
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// OIDCProvider is a discovered OpenID provider bound to one client registration.
+type OIDCProvider struct {
+	cfg    OIDCConfig
+	issuer *oidcIssuer
+	http   *http.Client
+}
+
+// oidcIssuer holds what is shared by every client of an issuer: its discovery
+// document and key set.
+type oidcIssuer struct {
+	discovery oidcDiscovery
+
+	mu   sync.Mutex
+	keys map[string]interface{}
+}
+
+var (
+	issuerCacheMu sync.Mutex
+	issuerCache   = map[string]*oidcIssuer{}
+)
+
+// DiscoverOIDC loads the provider's discovery document. Issuers are cached so the
+// discovery document and key set are not refetched on every login.
+func DiscoverOIDC(ctx context.Context, cfg OIDCConfig, client *http.Client) (*OIDCProvider, error) {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	cfg.Issuer = strings.TrimRight(strings.TrimSpace(cfg.Issuer), "/")
+	if cfg.Issuer == "" || cfg.ClientID == "" {
+		return nil, errors.New("oidc issuer and client id are required")
+	}
+
+	issuerCacheMu.Lock()
+	iss, ok := issuerCache[cfg.Issuer]
+	issuerCacheMu.Unlock()
+	if !ok {
+		var d oidcDiscovery
+		if err := getJSON(ctx, client, cfg.Issuer+"/.well-known/openid-configuration", &d); err != nil {
+			return nil, fmt.Errorf("oidc discovery failed: %w", err)
+		}
+		if strings.TrimRight(d.Issuer, "/") != cfg.Issuer {
+			return nil, fmt.Errorf("oidc discovery issuer %q does not match configured issuer", d.Issuer)
+		}
+		if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JWKSURI == "" {
+			return nil, errors.New("oidc discovery document is incomplete")
+		}
+		iss = &oidcIssuer{discovery: d}
+		issuerCacheMu.Lock()
+		issuerCache[cfg.Issuer] = iss
+		issuerCacheMu.Unlock()
+	}
+	return &OIDCProvider{cfg: cfg, issuer: iss, http: client}, nil
+}
+
+// NewPKCEVerifier returns a random code verifier and its S256 challenge.
+func NewPKCEVerifier() (verifier, challenge string) {
+	verifier = randomToken(32)
+	sum := sha256.Sum256([]byte(verifier))
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// NewNonce returns a random value for state and nonce parameters.
+func NewNonce() string {
+	return randomToken(24)
+}
+
+// AuthCodeURL builds the authorization request for the code flow with PKCE.
+func (p *OIDCProvider) AuthCodeURL(state, nonce, codeChallenge string) string {
+	scopes := p.cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"openid", "email", "profile"}
+	}
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", p.cfg.ClientID)
+	q.Set("redirect_uri", p.cfg.RedirectURL)
+	q.Set("scope", strings.Join(scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", codeChallenge)
+	q.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(p.issuer.discovery.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return p.issuer.discovery.AuthorizationEndpoint + sep + q.Encode()
+}
+
+// Exchange redeems an authorization code and verifies the returned ID token.
+func (p *OIDCProvider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*Identity, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.cfg.RedirectURL)
+	form.Set("client_id", p.cfg.ClientID)
+	form.Set("client_secret", p.cfg.ClientSecret)
+	form.Set("code_verifier", codeVerifier)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.issuer.discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("oidc token endpoint returned %d", resp.StatusCode)
+	}
+
+	var tok struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.Unmarshal(body, &tok); err != nil || tok.IDToken == "" {
+		return nil, errors.New("oidc token response has no id_token")
+	}
+	return p.VerifyIDToken(ctx, tok.IDToken, nonce)
+}
+
+// VerifyIDToken checks signature, issuer, audience, expiry and nonce.
+func (p *OIDCProvider) VerifyIDToken(ctx context.Context, raw, nonce string) (*Identity, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return p.key(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256"}),
+		jwt.WithIssuer(p.issuer.discovery.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrIDTokenInvalid, err)
+	}
+
+	if got, _ := claims["nonce"].(string); nonce == "" || got != nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrIDTokenInvalid)
+	}
+	if aud, _ := claims.GetAudience(); len(aud) > 1 {
+		if azp, _ := claims["azp"].(string); azp != p.cfg.ClientID {
+			return nil, fmt.Errorf("%w: authorized party mismatch", ErrIDTokenInvalid)
+		}
+	}
+
+	id := &Identity{}
+	id.Subject, _ = claims["sub"].(string)
+	if id.Subject == "" {
+		return nil, fmt.Errorf("%w: missing subject", ErrIDTokenInvalid)
+	}
+	id.Email, _ = claims["email"].(string)
+	id.Name, _ = claims["name"].(string)
+	switch v := claims["email_verified"].(type) {
+	case bool:
+		id.EmailVerified = v
+	case string:
+		id.EmailVerified = strings.EqualFold(v, "true")
+	default:
+		id.EmailVerified = p.cfg.AssumeEmailVerified
+	}
+	if id.Email == "" && p.cfg.AssumeEmailVerified {
+		if upn, _ := claims["preferred_username"].(string); strings.Contains(upn, "@") {
+			id.Email = upn
+			id.EmailVerified = true
+		}
+	}
+
+	groupsClaim := p.cfg.GroupsClaim
+	if groupsClaim == "" {
+		groupsClaim = "groups"
+	}
+	switch v := claims[groupsClaim].(type) {
+	case []interface{}:
+		for _, g := range v {
+			if s, ok := g.(string); ok {
+				id.Groups = append(id.Groups, s)
+			}
+		}
+	case string:
+		id.Groups = strings.Fields(strings.ReplaceAll(v, ",", " "))
+	}
+	if amr, ok := claims["amr"].([]interface{}); ok {
+		for _, m := range amr {
+			if s, ok := m.(string); ok {
+				id.AuthMethods = append(id.AuthMethods, s)
+			}
+		}
+	}
+	return id, nil
+}
+
+// key returns the verification key for kid, refetching the key set once on a miss so
+// IdP key rotation does not break logins.
+func (p *OIDCProvider) key(ctx context.Context, kid string) (interface{}, error) {
+	iss := p.issuer
+	iss.mu.Lock()
+	defer iss.mu.Unlock()
+
+	if k, ok := iss.lookupKey(kid); ok {
+		return k, nil
+	}
+	keys, err := fetchJWKS(ctx, p.http, iss.discovery.JWKSURI)
+	if err != nil {
+		return nil, err
+	}
+	iss.keys = keys
+	if k, ok := iss.lookupKey(kid); ok {
+		return k, nil
+	}
+	return nil, fmt.Errorf("no signing key %q", kid)
+}
+
+func (iss *oidcIssuer) lookupKey(kid string) (interface{}, bool) {
+	if kid == "" && len(iss.keys) == 1 {
+		for _, k := range iss.keys {
+			return k, true
+		}
+	}
+	k, ok := iss.keys[kid]
+	return k, ok
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func fetchJWKS(ctx context.Context, client *http.Client, uri string) (map[string]interface{}, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := getJSON(ctx, client, uri, &set); err != nil {
+		return nil, fmt.Errorf("oidc jwks fetch failed: %w", err)
+	}
+
+	keys := map[string]interface{}{}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		switch k.Kty {
+		case "RSA":
+			n, errN := base64.RawURLEncoding.DecodeString(k.N)
+			e, errE := base64.RawURLEncoding.DecodeString(k.E)
+			if errN != nil || errE != nil {
+				continue
+			}
+			keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		case "EC":
+			if k.Crv != "P-256" {
+				continue
+			}
+			x, errX := base64.RawURLEncoding.DecodeString(k.X)
+			y, errY := base64.RawURLEncoding.DecodeString(k.Y)
+			if errX != nil || errY != nil {
+				continue
+			}
+			keys[k.Kid] = &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		}
+	}
+	return keys, nil
+}
+
+func getJSON(ctx context.Context, client *http.Client, uri string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %d", uri, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(out)
+}
+
+func randomToken(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,280 @@
+package sso
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	nsSAMLAssertion = "urn:oasis:names:tc:SAML:2.0:assertion"
+	nsSAMLProtocol  = "urn:oasis:names:tc:SAML:2.0:protocol"
+	nsSAMLMetadata  = "urn:oasis:names:tc:SAML:2.0:metadata"
+
+	samlStatusSuccess   = "urn:oasis:names:tc:SAML:2.0:status:Success"
+	samlBindingPOST     = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
+	samlBindingRedirect = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect"
+	samlNameIDEmail     = "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress"
+
+	samlClockSkew = 2 * time.Minute
+)
+
+// Attribute names commonly used by Google Workspace, Microsoft Entra ID and ADFS.
+var (
+	samlEmailAttributes = []string{
+		"email", "mail", "Email",
+		"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/emailaddress",
+		"urn:oid:0.9.2342.19200300.100.1.3",
+	}
+	samlNameAttributes = []string{
+		"name", "displayName",
+		"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/name",
+		"urn:oid:2.16.840.1.113730.3.1.241",
+	}
+)
+
+var ErrSAMLResponseInvalid = errors.New("saml response is invalid")
+
+// SAMLConfig describes one SP <-> IdP relationship.
+type SAMLConfig struct {
+	SPEntityID     string
+	ACSURL         string
+	IdPEntityID    string
+	IdPSSOURL      string
+	IdPCertificate string
+	GroupsClaim    string
+}
+
+// NewSAMLRequestID returns an ID suitable for an AuthnRequest (must not start with a digit).
+func NewSAMLRequestID() string {
+	b := make([]byte, 20)
+	_, _ = rand.Read(b)
+	return "_" + hex.EncodeToString(b)
+}
+
+// AuthnRequestURL builds an HTTP-Redirect binding URL that sends the user to the IdP.
+func (c SAMLConfig) AuthnRequestURL(requestID, relayState string, now time.Time) (string, error) {
+	req := fmt.Sprintf(
+		`<samlp:AuthnRequest xmlns:samlp="%s" xmlns:saml="%s" ID="%s" Version="2.0" IssueInstant="%s" Destination="%s" AssertionConsumerServiceURL="%s" ProtocolBinding="%s">`+
+			`<saml:Issuer>%s</saml:Issuer><samlp:NameIDPolicy Format="%s" AllowCreate="true"/></samlp:AuthnRequest>`,
+		nsSAMLProtocol, nsSAMLAssertion, xmlEscape(requestID), now.UTC().Format(time.RFC3339),
+		xmlEscape(c.IdPSSOURL), xmlEscape(c.ACSURL), samlBindingPOST, xmlEscape(c.SPEntityID), samlNameIDEmail,
+	)
+
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, flate.DefaultCompression)
+	if err != nil {
+		return "", err
+	}
+	if _, err := w.Write([]byte(req)); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(c.IdPSSOURL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return "", errors.New("invalid IdP SSO URL")
+	}
+	q := u.Query()
+	q.Set("SAMLRequest", base64.StdEncoding.EncodeToString(buf.Bytes()))
+	if relayState != "" {
+		q.Set("RelayState", relayState)
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// Metadata returns SP metadata that a school admin can upload to their IdP.
+func (c SAMLConfig) Metadata() []byte {
+	return []byte(fmt.Sprintf(
+		`<?xml version="1.0" encoding="UTF-8"?>`+"\n"+
+			`<md:EntityDescriptor xmlns:md="%s" entityID="%s">`+
+			`<md:SPSSODescriptor AuthnRequestsSigned="false" WantAssertionsSigned="true" protocolSupportEnumeration="%s">`+
+			`<md:NameIDFormat>%s</md:NameIDFormat>`+
+			`<md:AssertionConsumerService Binding="%s" Location="%s" index="0" isDefault="true"/>`+
+			`</md:SPSSODescriptor></md:EntityDescriptor>`,
+		nsSAMLMetadata, xmlEscape(c.SPEntityID), nsSAMLProtocol, samlNameIDEmail, samlBindingPOST, xmlEscape(c.ACSURL),
+	))
+}
+
+// ParseResponse validates a base64 SAMLResponse posted to the ACS and returns the
+// asserted identity. Either the Response or its single Assertion must be signed by the
+// configured certificate, and every value is read from the verified element.
+func (c SAMLConfig) ParseResponse(encoded, expectedRequestID string, now time.Time) (*Identity, error) {
+	cert, err := ParseCertificate(c.IdPCertificate)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := base64.StdEncoding.DecodeString(stripSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("%w: not base64", ErrSAMLResponseInvalid)
+	}
+	doc, err := parseXMLDocument(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSAMLResponseInvalid, err)
+	}
+	return c.identityFromResponse(doc, cert, expectedRequestID, now)
+}
+
+func (c SAMLConfig) identityFromResponse(resp *xmlNode, cert *x509.Certificate, expectedRequestID string, now time.Time) (*Identity, error) {
+	invalid := func(reason string) error { return fmt.Errorf("%w: %s", ErrSAMLResponseInvalid, reason) }
+
+	if !resp.is(nsSAMLProtocol, "Response") {
+		return nil, invalid("root is not a Response")
+	}
+	if dest := resp.Attr("Destination"); dest != "" && dest != c.ACSURL {
+		return nil, invalid("unexpected destination")
+	}
+	if irt := resp.Attr("InResponseTo"); expectedRequestID == "" || irt != expectedRequestID {
+		return nil, invalid("response does not match the login request")
+	}
+	status := resp.Element(nsSAMLProtocol, "Status")
+	if status == nil {
+		return nil, invalid("missing status")
+	}
+	if code := status.Element(nsSAMLProtocol, "StatusCode"); code == nil || code.Attr("Value") != samlStatusSuccess {
+		return nil, invalid("IdP did not report success")
+	}
+	if len(resp.Elements(nsSAMLAssertion, "EncryptedAssertion")) > 0 {
+		return nil, invalid("encrypted assertions are not supported")
+	}
+	assertions := resp.Elements(nsSAMLAssertion, "Assertion")
+	if len(assertions) != 1 {
+		return nil, invalid("expected exactly one assertion")
+	}
+	assertion := assertions[0]
+
+	// Values are read only from the assertion the signature references, or from
+	// one directly inside the signed Response; a signed assertion wrapped
+	// anywhere else is never consumed.
+	signed := assertion
+	if len(resp.Elements(nsDSig, "Signature")) > 0 {
+		signed = resp
+	}
+	if err := verifyEnvelopedSignature(signed, cert); err != nil {
+		return nil, err
+	}
+	if signed != assertion && assertion.Parent != signed {
+		return nil, invalid("assertion is not covered by the signature")
+	}
+
+	issuer := assertion.Element(nsSAMLAssertion, "Issuer")
+	if issuer == nil || issuer.Text() != c.IdPEntityID {
+		return nil, invalid("unexpected issuer")
+	}
+
+	subject := assertion.Element(nsSAMLAssertion, "Subject")
+	if subject == nil {
+		return nil, invalid("missing subject")
+	}
+	nameID := subject.Element(nsSAMLAssertion, "NameID")
+	if nameID == nil || nameID.Text() == "" {
+		return nil, invalid("missing NameID")
+	}
+	confirmed := false
+	for _, sc := range subject.Elements(nsSAMLAssertion, "SubjectConfirmation") {
+		data := sc.Element(nsSAMLAssertion, "SubjectConfirmationData")
+		if sc.Attr("Method") != "urn:oasis:names:tc:SAML:2.0:cm:bearer" || data == nil {
+			continue
+		}
+		if data.Attr("Recipient") != c.ACSURL || data.Attr("InResponseTo") != expectedRequestID {
+			continue
+		}
+		if notAfter, err := parseSAMLTime(data.Attr("NotOnOrAfter")); err != nil || !now.Before(notAfter.Add(samlClockSkew)) {
+			continue
+		}
+		confirmed = true
+	}
+	if !confirmed {
+		return nil, invalid("no valid bearer subject confirmation")
+	}
+
+	conditions := assertion.Element(nsSAMLAssertion, "Conditions")
+	if conditions == nil {
+		return nil, invalid("missing conditions")
+	}
+	if v := conditions.Attr("NotBefore"); v != "" {
+		if t, err := parseSAMLTime(v); err != nil || now.Add(samlClockSkew).Before(t) {
+			return nil, invalid("assertion not yet valid")
+		}
+	}
+	if v := conditions.Attr("NotOnOrAfter"); v != "" {
+		if t, err := parseSAMLTime(v); err != nil || !now.Before(t.Add(samlClockSkew)) {
+			return nil, invalid("assertion expired")
+		}
+	}
+	audienceOK := false
+	for _, ar := range conditions.Elements(nsSAMLAssertion, "AudienceRestriction") {
+		for _, a := range ar.Elements(nsSAMLAssertion, "Audience") {
+			if a.Text() == c.SPEntityID {
+				audienceOK = true
+			}
+		}
+	}
+	if !audienceOK {
+		return nil, invalid("audience does not match this service provider")
+	}
+
+	attrs := map[string][]string{}
+	if stmt := assertion.Element(nsSAMLAssertion, "AttributeStatement"); stmt != nil {
+		for _, a := range stmt.Elements(nsSAMLAssertion, "Attribute") {
+			name := a.Attr("Name")
+			for _, v := range a.Elements(nsSAMLAssertion, "AttributeValue") {
+				attrs[name] = append(attrs[name], v.Text())
+			}
+		}
+	}
+
+	id := &Identity{Subject: nameID.Text(), Attributes: attrs}
+	id.Email = firstAttr(attrs, samlEmailAttributes)
+	if id.Email == "" && nameID.Attr("Format") == samlNameIDEmail {
+		id.Email = nameID.Text()
+	}
+	// The assertion is signed by the school's own IdP, which is authoritative for the
+	// mail domains it serves; callers still restrict linking to allowed domains.
+	id.EmailVerified = id.Email != ""
+	id.Name = firstAttr(attrs, samlNameAttributes)
+	groupsClaim := c.GroupsClaim
+	if groupsClaim == "" {
+		groupsClaim = "groups"
+	}
+	id.Groups = attrs[groupsClaim]
+	for _, stmt := range assertion.Elements(nsSAMLAssertion, "AuthnStatement") {
+		if ctx := stmt.Element(nsSAMLAssertion, "AuthnContext"); ctx != nil {
+			if ref := ctx.Element(nsSAMLAssertion, "AuthnContextClassRef"); ref != nil && ref.Text() != "" {
+				id.AuthMethods = append(id.AuthMethods, strings.TrimSpace(ref.Text()))
+			}
+		}
+	}
+	return id, nil
+}
+
+func parseSAMLTime(v string) (time.Time, error) {
+	return time.Parse(time.RFC3339Nano, strings.TrimSpace(v))
+}
+
+func firstAttr(attrs map[string][]string, names []string) string {
+	for _, n := range names {
+		if vals := attrs[n]; len(vals) > 0 && strings.TrimSpace(vals[0]) != "" {
+			return strings.TrimSpace(vals[0])
+		}
+	}
+	return ""
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
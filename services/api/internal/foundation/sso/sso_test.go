@@ -0,0 +1,306 @@
+package sso
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCanonicalizeExclusive(t *testing.T) {
+	doc, err := parseXMLDocument([]byte(`<a:root xmlns:a="urn:a" xmlns:b="urn:b" z="1" a="2"><!-- note --><a:child b:x="y">t&amp;</a:child></a:root>`))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	want := `<a:root xmlns:a="urn:a" a="2" z="1"><a:child xmlns:b="urn:b" b:x="y">t&amp;</a:child></a:root>`
+	if got := string(canonicalize(doc, nil, nil)); got != want {
+		t.Fatalf("unexpected root c14n:\n got %s\nwant %s", got, want)
+	}
+
+	child := doc.Element("urn:a", "child")
+	want = `<a:child xmlns:a="urn:a" xmlns:b="urn:b" b:x="y">t&amp;</a:child>`
+	if got := string(canonicalize(child, nil, nil)); got != want {
+		t.Fatalf("unexpected subtree c14n:\n got %s\nwant %s", got, want)
+	}
+}
+
+func TestParseXMLRejectsDoctype(t *testing.T) {
+	_, err := parseXMLDocument([]byte(`<!DOCTYPE r [<!ENTITY x "y">]><r>&x;</r>`))
+	if err == nil {
+		t.Fatalf("expected documents with a DTD to be rejected")
+	}
+}
+
+func TestOIDCRoundTrip(t *testing.T) {
+	idp, err := NewMockIdP()
+	if err != nil {
+		t.Fatalf("mock idp: %v", err)
+	}
+	srv := httptest.NewServer(idp)
+	defer srv.Close()
+	idp.BaseURL = srv.URL
+
+	cfg := OIDCConfig{
+		Issuer:       srv.URL,
+		ClientID:     idp.ClientID,
+		ClientSecret: idp.ClientSecret,
+		RedirectURL:  "https://api.example.edu/v1/auth/sso/oidc/callback",
+	}
+	provider, err := DiscoverOIDC(context.Background(), cfg, srv.Client())
+	if err != nil {
+		t.Fatalf("discover: %v", err)
+	}
+
+	authorize := func(nonce, challenge string) string {
+		client := srv.Client()
+		client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+		state := NewNonce()
+		resp, err := client.Get(provider.AuthCodeURL(state, nonce, challenge))
+		if err != nil {
+			t.Fatalf("authorize: %v", err)
+		}
+		resp.Body.Close()
+		loc, err := url.Parse(resp.Header.Get("Location"))
+		if err != nil {
+			t.Fatalf("bad redirect: %v", err)
+		}
+		if loc.Query().Get("state") != state {
+			t.Fatalf("state was not echoed")
+		}
+		return loc.Query().Get("code")
+	}
+
+	idp.User.AuthMethods = []string{"pwd", "hwk"}
+	verifier, challenge := NewPKCEVerifier()
+	nonce := NewNonce()
+	id, err := provider.Exchange(context.Background(), authorize(nonce, challenge), verifier, nonce)
+	if err != nil {
+		t.Fatalf("exchange: %v", err)
+	}
+	if id.Subject != idp.User.Subject || id.Email != idp.User.Email || !id.EmailVerified {
+		t.Fatalf("unexpected identity: %+v", id)
+	}
+	if len(id.Groups) != 1 || id.Groups[0] != "staff" {
+		t.Fatalf("unexpected groups: %v", id.Groups)
+	}
+	if !id.PhishingResistant() {
+		t.Fatalf("hardware key amr should be phishing-resistant: %v", id.AuthMethods)
+	}
+
+	// A code issued for one verifier cannot be redeemed with another.
+	code := authorize(nonce, challenge)
+	other, _ := NewPKCEVerifier()
+	if _, err := provider.Exchange(context.Background(), code, other, nonce); err == nil {
+		t.Fatalf("expected PKCE mismatch to fail")
+	}
+}
+
+func TestOIDCRejectsWrongNonce(t *testing.T) {
+	idp, err := NewMockIdP()
+	if err != nil {
+		t.Fatalf("mock idp: %v", err)
+	}
+	srv := httptest.NewServer(idp)
+	defer srv.Close()
+	idp.BaseURL = srv.URL
+
+	provider, err := DiscoverOIDC(context.Background(), OIDCConfig{
+		Issuer:       srv.URL,
+		ClientID:     idp.ClientID,
+		ClientSecret: idp.ClientSecret,
+		RedirectURL:  "https://api.example.edu/cb",
+	}, srv.Client())
+	if err != nil {
+		t.Fatalf("discover: %v", err)
+	}
+
+	verifier, challenge := NewPKCEVerifier()
+	client := srv.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	resp, err := client.Get(provider.AuthCodeURL("s", "nonce-a", challenge))
+	if err != nil {
+		t.Fatalf("authorize: %v", err)
+	}
+	resp.Body.Close()
+	loc, _ := url.Parse(resp.Header.Get("Location"))
+
+	_, err = provider.Exchange(context.Background(), loc.Query().Get("code"), verifier, "nonce-b")
+	if !errors.Is(err, ErrIDTokenInvalid) {
+		t.Fatalf("expected nonce mismatch, got %v", err)
+	}
+}
+
+func newSAMLFixture(t *testing.T) (*MockIdP, SAMLConfig) {
+	t.Helper()
+	idp, err := NewMockIdP()
+	if err != nil {
+		t.Fatalf("mock idp: %v", err)
+	}
+	idp.BaseURL = "https://idp.example.edu"
+	return idp, SAMLConfig{
+		SPEntityID:     "https://api.example.edu/v1/auth/sso/saml/p1/metadata",
+		ACSURL:         "https://api.example.edu/v1/auth/sso/saml/p1/acs",
+		IdPEntityID:    idp.EntityID(),
+		IdPSSOURL:      idp.SAMLSSOURL(),
+		IdPCertificate: idp.CertPEM,
+	}
+}
+
+func TestSAMLResponseValid(t *testing.T) {
+	idp, cfg := newSAMLFixture(t)
+	now := time.Now()
+
+	resp, err := idp.SAMLResponse("_req1", cfg.ACSURL, cfg.SPEntityID, now)
+	if err != nil {
+		t.Fatalf("build response: %v", err)
+	}
+	id, err := cfg.ParseResponse(resp, "_req1", now)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if id.Email != idp.User.Email || !id.EmailVerified || id.Name != idp.User.Name {
+		t.Fatalf("unexpected identity: %+v", id)
+	}
+	if len(id.Groups) != 1 || id.Groups[0] != "staff" {
+		t.Fatalf("unexpected groups: %v", id.Groups)
+	}
+	if len(id.AuthMethods) != 1 || id.PhishingResistant() {
+		t.Fatalf("a password context is not phishing-resistant: %v", id.AuthMethods)
+	}
+}
+
+func TestSAMLResponseRejected(t *testing.T) {
+	idp, cfg := newSAMLFixture(t)
+	now := time.Now()
+
+	valid, err := idp.SAMLResponse("_req1", cfg.ACSURL, cfg.SPEntityID, now)
+	if err != nil {
+		t.Fatalf("build response: %v", err)
+	}
+	raw, _ := base64.StdEncoding.DecodeString(valid)
+	tampered := base64.StdEncoding.EncodeToString([]byte(strings.Replace(string(raw), idp.User.Email, "principal@example.edu", 1)))
+	wrongAudience, _ := idp.SAMLResponse("_req1", cfg.ACSURL, "https://other.example.edu", now)
+
+	otherIdP, _ := NewMockIdP()
+	otherIdP.BaseURL = idp.BaseURL
+	wrongKey, _ := otherIdP.SAMLResponse("_req1", cfg.ACSURL, cfg.SPEntityID, now)
+
+	cases := []struct {
+		name      string
+		response  string
+		requestID string
+		at        time.Time
+	}{
+		{"tampered attribute", tampered, "_req1", now},
+		{"wrong audience", wrongAudience, "_req1", now},
+		{"unsolicited or replayed", valid, "_req2", now},
+		{"expired", valid, "_req1", now.Add(10 * time.Minute)},
+		{"untrusted signer", wrongKey, "_req1", now},
+	}
+	for _, tc := range cases {
+		if _, err := cfg.ParseResponse(tc.response, tc.requestID, tc.at); err == nil {
+			t.Fatalf("%s: expected response to be rejected", tc.name)
+		}
+	}
+
+	if _, err := cfg.ParseResponse(tampered, "_req1", now); !errors.Is(err, ErrSignatureInvalid) {
+		t.Fatalf("expected tampering to break the signature, got %v", err)
+	}
+}
+
+func TestAuthnRequestURL(t *testing.T) {
+	idp, cfg := newSAMLFixture(t)
+	srv := httptest.NewServer(idp)
+	defer srv.Close()
+	idp.BaseURL = srv.URL
+	cfg.IdPSSOURL = idp.SAMLSSOURL()
+	cfg.IdPEntityID = idp.EntityID()
+
+	u, err := cfg.AuthnRequestURL("_req9", "relay", time.Now())
+	if err != nil {
+		t.Fatalf("authn url: %v", err)
+	}
+	resp, err := srv.Client().Get(u)
+	if err != nil {
+		t.Fatalf("sso: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("mock idp rejected the AuthnRequest: %d", resp.StatusCode)
+	}
+}
+
+func TestSAMLSignatureWrappingRejected(t *testing.T) {
+	idp, cfg := newSAMLFixture(t)
+	now := time.Now()
+
+	valid, err := idp.SAMLResponse("_req1", cfg.ACSURL, cfg.SPEntityID, now)
+	if err != nil {
+		t.Fatalf("build response: %v", err)
+	}
+	raw, _ := base64.StdEncoding.DecodeString(valid)
+	doc := string(raw)
+
+	// Split the response around its signed assertion, and forge an unsigned one
+	// for another user with an ID of its own.
+	start := strings.Index(doc, "<saml:Assertion")
+	end := strings.Index(doc, "</saml:Assertion>") + len("</saml:Assertion>")
+	head, signed, tail := doc[:start], doc[start:end], doc[end:]
+	sigStart := strings.Index(signed, "<ds:Signature")
+	sigEnd := strings.Index(signed, "</ds:Signature>") + len("</ds:Signature>")
+	signature := signed[sigStart:sigEnd]
+	signedID := signed[strings.Index(signed, `ID="`)+4:]
+	signedID = signedID[:strings.Index(signedID, `"`)]
+	forged := strings.Replace(signed[:sigStart]+signed[sigEnd:], `ID="`+signedID+`"`, `ID="_forged"`, 1)
+	forged = strings.Replace(forged, ">"+idp.User.Subject+"<", ">principal<", 1)
+	issuerEnd := strings.Index(forged, "</saml:Issuer>") + len("</saml:Issuer>")
+	withSignature := func(sig string) string { return forged[:issuerEnd] + sig + forged[issuerEnd:] }
+	objectSignature := strings.Replace(signature, "</ds:Signature>", "<ds:Object>"+signed+"</ds:Object></ds:Signature>", 1)
+
+	cases := []struct {
+		name string
+		doc  string
+	}{
+		{"second unsigned assertion", head + signed + forged + tail},
+		{"signed assertion under Extensions", head + "<samlp:Extensions>" + signed + "</samlp:Extensions>" + forged + tail},
+		{"signed assertion under a signature Object", head + withSignature(objectSignature) + tail},
+		{"reference to another element", head + "<samlp:Extensions>" + signed + "</samlp:Extensions>" + withSignature(signature) + tail},
+		{"forged assertion reusing the signed ID", head + strings.Replace(withSignature(objectSignature), `ID="_forged"`, `ID="`+signedID+`"`, 1) + tail},
+	}
+	for _, tc := range cases {
+		id, err := cfg.ParseResponse(base64.StdEncoding.EncodeToString([]byte(tc.doc)), "_req1", now)
+		if err == nil {
+			t.Fatalf("%s: expected response to be rejected, got subject %q", tc.name, id.Subject)
+		}
+	}
+}
+
+func TestSAMLNameIDCommentsDoNotTruncate(t *testing.T) {
+	idp, cfg := newSAMLFixture(t)
+	now := time.Now()
+	idp.User.Subject = "teacher@example.edu.evil.test"
+	idp.User.Email = ""
+
+	valid, err := idp.SAMLResponse("_req1", cfg.ACSURL, cfg.SPEntityID, now)
+	if err != nil {
+		t.Fatalf("build response: %v", err)
+	}
+	raw, _ := base64.StdEncoding.DecodeString(valid)
+	// Exclusive c14n drops comments, so the signature still holds; the NameID
+	// must still be read whole rather than up to the comment.
+	commented := strings.Replace(string(raw), ">teacher@example.edu.evil.test<", ">teacher@example.edu<!-- -->.evil.test<", 1)
+
+	id, err := cfg.ParseResponse(base64.StdEncoding.EncodeToString([]byte(commented)), "_req1", now)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if id.Subject != idp.User.Subject || id.Email != idp.User.Subject {
+		t.Fatalf("expected the whole signed NameID, got subject %q email %q", id.Subject, id.Email)
+	}
+}
@@ -0,0 +1,329 @@
+package sso
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+const xmlNamespace = "http://www.w3.org/XML/1998/namespace"
+
+// xmlAttr is an attribute as written in the document, with its raw prefix.
+type xmlAttr struct {
+	Prefix string
+	Local  string
+	Value  string
+}
+
+// xmlNode is a minimal DOM that keeps prefixes and namespace declarations exactly as
+// written, which encoding/xml's resolved names lose. Signature verification needs both.
+type xmlNode struct {
+	Prefix   string
+	Local    string
+	Attrs    []xmlAttr
+	NSDecls  map[string]string // prefix ("" for default) -> URI declared on this element
+	Children []interface{}     // *xmlNode, xmlText or xmlPI
+	Parent   *xmlNode
+}
+
+type xmlText string
+
+type xmlPI struct {
+	Target string
+	Inst   string
+}
+
+// parseXMLDocument parses a document into an xmlNode tree. Documents carrying a DTD
+// are rejected outright; SAML never needs one and they are a common attack vector.
+func parseXMLDocument(data []byte) (*xmlNode, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.Strict = true
+
+	var root, cur *xmlNode
+	ids := map[string]bool{}
+	for {
+		tok, err := dec.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			n := &xmlNode{Prefix: t.Name.Space, Local: t.Name.Local, Parent: cur, NSDecls: map[string]string{}}
+			for _, a := range t.Attr {
+				switch {
+				case a.Name.Space == "" && a.Name.Local == "xmlns":
+					n.NSDecls[""] = a.Value
+				case a.Name.Space == "xmlns":
+					n.NSDecls[a.Name.Local] = a.Value
+				default:
+					n.Attrs = append(n.Attrs, xmlAttr{Prefix: a.Name.Space, Local: a.Name.Local, Value: a.Value})
+					if a.Name.Space == "" && a.Name.Local == "ID" {
+						if ids[a.Value] {
+							return nil, fmt.Errorf("duplicate ID %q", a.Value)
+						}
+						ids[a.Value] = true
+					}
+				}
+			}
+			if cur == nil {
+				if root != nil {
+					return nil, errors.New("multiple root elements")
+				}
+				root = n
+			} else {
+				cur.Children = append(cur.Children, n)
+			}
+			cur = n
+		case xml.EndElement:
+			if cur == nil || cur.Prefix != t.Name.Space || cur.Local != t.Name.Local {
+				return nil, errors.New("mismatched end element")
+			}
+			cur = cur.Parent
+		case xml.CharData:
+			if cur != nil {
+				cur.Children = append(cur.Children, xmlText(string(t)))
+			} else if strings.TrimSpace(string(t)) != "" {
+				return nil, errors.New("text outside root element")
+			}
+		case xml.ProcInst:
+			if cur != nil {
+				cur.Children = append(cur.Children, xmlPI{Target: t.Target, Inst: string(t.Inst)})
+			}
+		case xml.Directive:
+			return nil, errors.New("xml directives are not allowed")
+		case xml.Comment:
+			// Dropped: exclusive canonicalization without comments ignores them.
+		}
+	}
+	if root == nil || cur != nil {
+		return nil, errors.New("incomplete xml document")
+	}
+	return root, nil
+}
+
+// lookupNS resolves a prefix against this element and its ancestors.
+func (n *xmlNode) lookupNS(prefix string) (string, bool) {
+	if prefix == "xml" {
+		return xmlNamespace, true
+	}
+	for e := n; e != nil; e = e.Parent {
+		if uri, ok := e.NSDecls[prefix]; ok {
+			return uri, true
+		}
+	}
+	return "", prefix == ""
+}
+
+// Namespace returns the element's resolved namespace URI.
+func (n *xmlNode) Namespace() string {
+	uri, _ := n.lookupNS(n.Prefix)
+	return uri
+}
+
+func (n *xmlNode) is(ns, local string) bool {
+	return n.Local == local && n.Namespace() == ns
+}
+
+// Attr returns an unprefixed attribute value.
+func (n *xmlNode) Attr(local string) string {
+	for _, a := range n.Attrs {
+		if a.Prefix == "" && a.Local == local {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// Elements returns direct child elements with the given namespace and local name.
+func (n *xmlNode) Elements(ns, local string) []*xmlNode {
+	var out []*xmlNode
+	for _, c := range n.Children {
+		if e, ok := c.(*xmlNode); ok && e.is(ns, local) {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// Element returns the first direct child element with the given name, or nil.
+func (n *xmlNode) Element(ns, local string) *xmlNode {
+	if els := n.Elements(ns, local); len(els) > 0 {
+		return els[0]
+	}
+	return nil
+}
+
+// Text returns the concatenated text content of the element's direct text children.
+func (n *xmlNode) Text() string {
+	var b strings.Builder
+	for _, c := range n.Children {
+		if t, ok := c.(xmlText); ok {
+			b.WriteString(string(t))
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// canonicalize serialises the subtree rooted at n using Exclusive XML Canonicalization
+// 1.0 without comments (https://www.w3.org/TR/xml-exc-c14n/). exclude, when set, is
+// left out of the output, which implements the enveloped-signature transform.
+func canonicalize(n *xmlNode, exclude *xmlNode, inclusivePrefixes []string) []byte {
+	var buf bytes.Buffer
+	inclusive := map[string]bool{}
+	for _, p := range inclusivePrefixes {
+		if p == "#default" {
+			p = ""
+		}
+		inclusive[p] = true
+	}
+	writeCanonical(&buf, n, exclude, map[string]string{}, inclusive)
+	return buf.Bytes()
+}
+
+func writeCanonical(buf *bytes.Buffer, n, exclude *xmlNode, rendered map[string]string, inclusive map[string]bool) {
+	// Namespaces that must be rendered: those visibly used by the element or its
+	// attributes, plus in-scope prefixes listed in InclusiveNamespaces.
+	used := map[string]bool{n.Prefix: true}
+	for _, a := range n.Attrs {
+		if a.Prefix != "" {
+			used[a.Prefix] = true
+		}
+	}
+	for p := range inclusive {
+		if _, ok := n.lookupNS(p); ok {
+			used[p] = true
+		}
+	}
+
+	type nsOut struct{ prefix, uri string }
+	var decls []nsOut
+	next := rendered
+	for p := range used {
+		if p == "xml" {
+			continue
+		}
+		uri, _ := n.lookupNS(p)
+		prev, seen := rendered[p]
+		if p == "" && !seen && uri == "" {
+			continue
+		}
+		if seen && prev == uri {
+			continue
+		}
+		if len(decls) == 0 {
+			next = make(map[string]string, len(rendered)+1)
+			for k, v := range rendered {
+				next[k] = v
+			}
+		}
+		next[p] = uri
+		decls = append(decls, nsOut{p, uri})
+	}
+	sort.Slice(decls, func(i, j int) bool { return decls[i].prefix < decls[j].prefix })
+
+	type attrOut struct{ ns, name, local, value string }
+	attrs := make([]attrOut, 0, len(n.Attrs))
+	for _, a := range n.Attrs {
+		ns := ""
+		name := a.Local
+		if a.Prefix != "" {
+			ns, _ = n.lookupNS(a.Prefix)
+			name = a.Prefix + ":" + a.Local
+		}
+		attrs = append(attrs, attrOut{ns, name, a.Local, a.Value})
+	}
+	sort.Slice(attrs, func(i, j int) bool {
+		if attrs[i].ns != attrs[j].ns {
+			return attrs[i].ns < attrs[j].ns
+		}
+		return attrs[i].local < attrs[j].local
+	})
+
+	qname := n.Local
+	if n.Prefix != "" {
+		qname = n.Prefix + ":" + n.Local
+	}
+	buf.WriteByte('<')
+	buf.WriteString(qname)
+	for _, d := range decls {
+		if d.prefix == "" {
+			buf.WriteString(` xmlns="`)
+		} else {
+			buf.WriteString(` xmlns:` + d.prefix + `="`)
+		}
+		escapeC14NAttr(buf, d.uri)
+		buf.WriteByte('"')
+	}
+	for _, a := range attrs {
+		buf.WriteString(" " + a.name + `="`)
+		escapeC14NAttr(buf, a.value)
+		buf.WriteByte('"')
+	}
+	buf.WriteByte('>')
+
+	for _, c := range n.Children {
+		switch v := c.(type) {
+		case *xmlNode:
+			if v == exclude {
+				continue
+			}
+			writeCanonical(buf, v, exclude, next, inclusive)
+		case xmlText:
+			escapeC14NText(buf, string(v))
+		case xmlPI:
+			buf.WriteString("<?" + v.Target)
+			if v.Inst != "" {
+				buf.WriteString(" " + v.Inst)
+			}
+			buf.WriteString("?>")
+		}
+	}
+
+	buf.WriteString("</" + qname + ">")
+}
+
+func escapeC14NText(buf *bytes.Buffer, s string) {
+	for _, r := range s {
+		switch r {
+		case '&':
+			buf.WriteString("&amp;")
+		case '<':
+			buf.WriteString("&lt;")
+		case '>':
+			buf.WriteString("&gt;")
+		case '\r':
+			buf.WriteString("&#xD;")
+		default:
+			buf.WriteRune(r)
+		}
+	}
+}
+
+func escapeC14NAttr(buf *bytes.Buffer, s string) {
+	for _, r := range s {
+		switch r {
+		case '&':
+			buf.WriteString("&amp;")
+		case '<':
+			buf.WriteString("&lt;")
+		case '"':
+			buf.WriteString("&quot;")
+		case '\t':
+			buf.WriteString("&#x9;")
+		case '\n':
+			buf.WriteString("&#xA;")
+		case '\r':
+			buf.WriteString("&#xD;")
+		default:
+			buf.WriteRune(r)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// A minimal CBOR (RFC 8949) decoder covering what authenticators emit in
+// attestation objects and COSE keys: integers, byte/text strings, arrays,
+// maps, simple values and floats. Indefinite lengths and tags beyond a
+// passthrough are not needed for WebAuthn and are rejected.
+
+var errCBOR = errors.New("malformed cbor")
+
+const (
+	cborMaxDepth = 16
+	cborMaxItems = 4096
+)
+
+type cborDecoder struct {
+	data []byte
+	pos  int
+}
+
+// decodeCBOR decodes one item and returns it with the number of bytes read,
+// so callers can find where authenticator data's embedded COSE key ends.
+func decodeCBOR(data []byte) (any, int, error) {
+	d := &cborDecoder{data: data}
+	v, err := d.item(0)
+	if err != nil {
+		return nil, 0, err
+	}
+	return v, d.pos, nil
+}
+
+func (d *cborDecoder) item(depth int) (any, error) {
+	if depth > cborMaxDepth {
+		return nil, errCBOR
+	}
+	if d.pos >= len(d.data) {
+		return nil, errCBOR
+	}
+	initial := d.data[d.pos]
+	d.pos++
+	major := initial >> 5
+	info := initial & 0x1f
+
+	if major == 7 {
+		return d.simple(info)
+	}
+
+	arg, err := d.argument(info)
+	if err != nil {
+		return nil, err
+	}
+
+	switch major {
+	case 0:
+		if arg > math.MaxInt64 {
+			return nil, errCBOR
+		}
+		return int64(arg), nil
+	case 1:
+		if arg > math.MaxInt64 {
+			return nil, errCBOR
+		}
+		return -1 - int64(arg), nil
+	case 2, 3:
+		if arg > uint64(len(d.data)-d.pos) {
+			return nil, errCBOR
+		}
+		b := d.data[d.pos : d.pos+int(arg)]
+		d.pos += int(arg)
+		if major == 3 {
+			return string(b), nil
+		}
+		out := make([]byte, len(b))
+		copy(out, b)
+		return out, nil
+	case 4:
+		if arg > cborMaxItems {
+			return nil, errCBOR
+		}
+		out := make([]any, 0, arg)
+		for i := uint64(0); i < arg; i++ {
+			v, err := d.item(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, v)
+		}
+		return out, nil
+	case 5:
+		if arg > cborMaxItems {
+			return nil, errCBOR
+		}
+		out := make(map[any]any, arg)
+		for i := uint64(0); i < arg; i++ {
+			k, err := d.item(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			switch k.(type) {
+			case int64, string:
+			default:
+				return nil, errCBOR
+			}
+			v, err := d.item(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			if _, dup := out[k]; dup {
+				return nil, errCBOR
+			}
+			out[k] = v
+		}
+		return out, nil
+	case 6:
+		return d.item(depth + 1)
+	}
+	return nil, errCBOR
+}
+
+func (d *cborDecoder) argument(info byte) (uint64, error) {
+	switch {
+	case info < 24:
+		return uint64(info), nil
+	case info == 24:
+		if d.pos+1 > len(d.data) {
+			return 0, errCBOR
+		}
+		v := uint64(d.data[d.pos])
+		d.pos++
+		return v, nil
+	case info == 25:
+		if d.pos+2 > len(d.data) {
+			return 0, errCBOR
+		}
+		v := uint64(binary.BigEndian.Uint16(d.data[d.pos:]))
+		d.pos += 2
+		return v, nil
+	case info == 26:
+		if d.pos+4 > len(d.data) {
+			return 0, errCBOR
+		}
+		v := uint64(binary.BigEndian.Uint32(d.data[d.pos:]))
+		d.pos += 4
+		return v, nil
+	case info == 27:
+		if d.pos+8 > len(d.data) {
+			return 0, errCBOR
+		}
+		v := binary.BigEndian.Uint64(d.data[d.pos:])
+		d.pos += 8
+		return v, nil
+	}
+	// 28-30 are reserved, 31 is indefinite length.
+	return 0, errCBOR
+}
+
+func (d *cborDecoder) simple(info byte) (any, error) {
+	switch info {
+	case 20:
+		return false, nil
+	case 21:
+		return true, nil
+	case 22, 23:
+		return nil, nil
+	case 25:
+		if d.pos+2 > len(d.data) {
+			return nil, errCBOR
+		}
+		d.pos += 2
+		return nil, nil // half floats never appear in WebAuthn structures
+	case 26:
+		if d.pos+4 > len(d.data) {
+			return nil, errCBOR
+		}
+		v := math.Float32frombits(binary.BigEndian.Uint32(d.data[d.pos:]))
+		d.pos += 4
+		return float64(v), nil
+	case 27:
+		if d.pos+8 > len(d.data) {
+			return nil, errCBOR
+		}
+		v := math.Float64frombits(binary.BigEndian.Uint64(d.data[d.pos:]))
+		d.pos += 8
+		return v, nil
+	}
+	return nil, errCBOR
+}
@@ -0,0 +1,501 @@
+// Package webauthn implements the relying-party side of WebAuthn Level 2:
+// building creation/request options and verifying registration and assertion
+// responses from browsers. Attestation is requested as "none"; credentials are
+// trusted on first use rather than against an authenticator metadata service.
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+var (
+	ErrInvalidResponse     = errors.New("webauthn: malformed authenticator response")
+	ErrChallengeMismatch   = errors.New("webauthn: challenge mismatch")
+	ErrOriginNotAllowed    = errors.New("webauthn: origin not allowed")
+	ErrRPIDMismatch        = errors.New("webauthn: relying party id mismatch")
+	ErrUserNotPresent      = errors.New("webauthn: user presence not asserted")
+	ErrUserNotVerified     = errors.New("webauthn: user verification required")
+	ErrSignatureInvalid    = errors.New("webauthn: signature invalid")
+	ErrUnsupportedKey      = errors.New("webauthn: unsupported credential public key")
+	ErrAttestationInvalid  = errors.New("webauthn: attestation statement invalid")
+	ErrCredentialMismatch  = errors.New("webauthn: credential id mismatch")
+	ErrSignCountRegression = errors.New("webauthn: signature counter did not increase; authenticator may be cloned")
+)
+
+const (
+	flagUserPresent    = 0x01
+	flagUserVerified   = 0x04
+	flagBackupEligible = 0x08
+	flagBackupState    = 0x10
+	flagAttestedData   = 0x40
+	flagExtensionData  = 0x80
+
+	challengeSize      = 32
+	maxCredentialIDLen = 1023
+	defaultTimeoutMS   = 120000
+)
+
+// RelyingParty identifies this deployment to authenticators. ID is the
+// registrable domain credentials are scoped to; Origins lists the exact web
+// origins (scheme://host[:port]) allowed to use them.
+type RelyingParty struct {
+	ID      string
+	Name    string
+	Origins []string
+}
+
+// UserEntity is the account a credential is created for. ID is the opaque
+// user handle returned by discoverable credentials.
+type UserEntity struct {
+	ID          []byte
+	Name        string
+	DisplayName string
+}
+
+// Credential is what a relying party stores after registration.
+type Credential struct {
+	ID                []byte
+	PublicKey         []byte // COSE_Key
+	Algorithm         int64
+	SignCount         uint32
+	AAGUID            []byte
+	Transports        []string
+	AttestationFormat string
+	UserVerified      bool
+	BackupEligible    bool
+	BackupState       bool
+}
+
+// Assertion is the verified outcome of an authentication ceremony.
+type Assertion struct {
+	CredentialID []byte
+	UserHandle   []byte
+	SignCount    uint32
+	UserVerified bool
+	BackupState  bool
+}
+
+type CredentialDescriptor struct {
+	Type       string   `json:"type"`
+	ID         string   `json:"id"`
+	Transports []string `json:"transports,omitempty"`
+}
+
+// CreationOptions is the JSON form of PublicKeyCredentialCreationOptions.
+type CreationOptions struct {
+	Challenge string `json:"challenge"`
+	RP        struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"rp"`
+	User struct {
+		ID          string `json:"id"`
+		Name        string `json:"name"`
+		DisplayName string `json:"displayName"`
+	} `json:"user"`
+	PubKeyCredParams []struct {
+		Type string `json:"type"`
+		Alg  int64  `json:"alg"`
+	} `json:"pubKeyCredParams"`
+	Timeout                int                    `json:"timeout"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection struct {
+		ResidentKey      string `json:"residentKey"`
+		UserVerification string `json:"userVerification"`
+	} `json:"authenticatorSelection"`
+	Attestation string `json:"attestation"`
+}
+
+// RequestOptions is the JSON form of PublicKeyCredentialRequestOptions.
+type RequestOptions struct {
+	Challenge        string                 `json:"challenge"`
+	Timeout          int                    `json:"timeout"`
+	RPID             string                 `json:"rpId"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+// RegistrationResponse is the JSON-serialised PublicKeyCredential returned by
+// navigator.credentials.create(); binary fields are base64url.
+type RegistrationResponse struct {
+	ID       string `json:"id"`
+	RawID    string `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string   `json:"clientDataJSON"`
+		AttestationObject string   `json:"attestationObject"`
+		Transports        []string `json:"transports,omitempty"`
+	} `json:"response"`
+}
+
+// AssertionResponse is the JSON-serialised PublicKeyCredential returned by
+// navigator.credentials.get(); binary fields are base64url.
+type AssertionResponse struct {
+	ID       string `json:"id"`
+	RawID    string `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string `json:"clientDataJSON"`
+		AuthenticatorData string `json:"authenticatorData"`
+		Signature         string `json:"signature"`
+		UserHandle        string `json:"userHandle,omitempty"`
+	} `json:"response"`
+}
+
+// NewChallenge returns a fresh random challenge.
+func NewChallenge() ([]byte, error) {
+	b := make([]byte, challengeSize)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// EncodeID renders binary ids and challenges the way browsers expect them.
+func EncodeID(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeID accepts base64url with or without padding.
+func DecodeID(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(strings.TrimSpace(s), "="))
+}
+
+func userVerificationValue(require bool) string {
+	if require {
+		return "required"
+	}
+	return "preferred"
+}
+
+// CreationOptions builds options for registering a new credential. Existing
+// credentials are excluded so an authenticator is not registered twice.
+func (rp RelyingParty) CreationOptions(user UserEntity, challenge []byte, exclude []Credential, requireUV bool) CreationOptions {
+	var out CreationOptions
+	out.Challenge = EncodeID(challenge)
+	out.RP.ID = rp.ID
+	out.RP.Name = rp.Name
+	out.User.ID = EncodeID(user.ID)
+	out.User.Name = user.Name
+	out.User.DisplayName = user.DisplayName
+	for _, alg := range SupportedAlgorithms {
+		out.PubKeyCredParams = append(out.PubKeyCredParams, struct {
+			Type string `json:"type"`
+			Alg  int64  `json:"alg"`
+		}{Type: "public-key", Alg: alg})
+	}
+	out.Timeout = defaultTimeoutMS
+	out.ExcludeCredentials = descriptors(exclude)
+	out.AuthenticatorSelection.ResidentKey = "preferred"
+	out.AuthenticatorSelection.UserVerification = userVerificationValue(requireUV)
+	out.Attestation = "none"
+	return out
+}
+
+// RequestOptions builds options for an authentication ceremony. An empty
+// allow list asks the browser for a discoverable credential (passkey login).
+func (rp RelyingParty) RequestOptions(challenge []byte, allow []Credential, requireUV bool) RequestOptions {
+	return RequestOptions{
+		Challenge:        EncodeID(challenge),
+		Timeout:          defaultTimeoutMS,
+		RPID:             rp.ID,
+		AllowCredentials: descriptors(allow),
+		UserVerification: userVerificationValue(requireUV),
+	}
+}
+
+func descriptors(creds []Credential) []CredentialDescriptor {
+	out := make([]CredentialDescriptor, 0, len(creds))
+	for _, c := range creds {
+		out = append(out, CredentialDescriptor{Type: "public-key", ID: EncodeID(c.ID), Transports: c.Transports})
+	}
+	return out
+}
+
+// VerifyRegistration checks a create() response against the challenge issued
+// for it and returns the credential to store.
+func (rp RelyingParty) VerifyRegistration(challenge []byte, resp RegistrationResponse, requireUV bool) (*Credential, error) {
+	if resp.Type != "public-key" {
+		return nil, ErrInvalidResponse
+	}
+	clientData, err := DecodeID(resp.Response.ClientDataJSON)
+	if err != nil {
+		return nil, ErrInvalidResponse
+	}
+	if err := rp.verifyClientData(clientData, "webauthn.create", challenge); err != nil {
+		return nil, err
+	}
+
+	attRaw, err := DecodeID(resp.Response.AttestationObject)
+	if err != nil {
+		return nil, ErrInvalidResponse
+	}
+	v, n, err := decodeCBOR(attRaw)
+	if err != nil || n != len(attRaw) {
+		return nil, ErrInvalidResponse
+	}
+	att, ok := v.(map[any]any)
+	if !ok {
+		return nil, ErrInvalidResponse
+	}
+	format, _ := att["fmt"].(string)
+	authDataRaw, _ := att["authData"].([]byte)
+	attStmt, _ := att["attStmt"].(map[any]any)
+	if format == "" || authDataRaw == nil || attStmt == nil {
+		return nil, ErrInvalidResponse
+	}
+
+	authData, err := parseAuthenticatorData(authDataRaw)
+	if err != nil {
+		return nil, err
+	}
+	if err := rp.verifyAuthenticatorFlags(authData, requireUV); err != nil {
+		return nil, err
+	}
+	if authData.flags&flagAttestedData == 0 || len(authData.credentialID) == 0 {
+		return nil, ErrInvalidResponse
+	}
+	if rawID, err := DecodeID(resp.RawID); err != nil || !bytes.Equal(rawID, authData.credentialID) {
+		return nil, ErrCredentialMismatch
+	}
+	_, alg, err := parseCOSEKey(authData.publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	clientDataHash := sha256.Sum256(clientData)
+	if err := verifyAttestation(format, attStmt, authDataRaw, clientDataHash[:], authData.publicKey, alg); err != nil {
+		return nil, err
+	}
+
+	return &Credential{
+		ID:                authData.credentialID,
+		PublicKey:         authData.publicKey,
+		Algorithm:         alg,
+		SignCount:         authData.signCount,
+		AAGUID:            authData.aaguid,
+		Transports:        resp.Response.Transports,
+		AttestationFormat: format,
+		UserVerified:      authData.flags&flagUserVerified != 0,
+		BackupEligible:    authData.flags&flagBackupEligible != 0,
+		BackupState:       authData.flags&flagBackupState != 0,
+	}, nil
+}
+
+// VerifyAssertion checks a get() response for a stored credential.
+func (rp RelyingParty) VerifyAssertion(challenge []byte, resp AssertionResponse, cred Credential, requireUV bool) (*Assertion, error) {
+	if resp.Type != "public-key" {
+		return nil, ErrInvalidResponse
+	}
+	rawID, err := DecodeID(resp.RawID)
+	if err != nil || !bytes.Equal(rawID, cred.ID) {
+		return nil, ErrCredentialMismatch
+	}
+	clientData, err := DecodeID(resp.Response.ClientDataJSON)
+	if err != nil {
+		return nil, ErrInvalidResponse
+	}
+	if err := rp.verifyClientData(clientData, "webauthn.get", challenge); err != nil {
+		return nil, err
+	}
+	authDataRaw, err := DecodeID(resp.Response.AuthenticatorData)
+	if err != nil {
+		return nil, ErrInvalidResponse
+	}
+	authData, err := parseAuthenticatorData(authDataRaw)
+	if err != nil {
+		return nil, err
+	}
+	if err := rp.verifyAuthenticatorFlags(authData, requireUV); err != nil {
+		return nil, err
+	}
+	sig, err := DecodeID(resp.Response.Signature)
+	if err != nil {
+		return nil, ErrInvalidResponse
+	}
+
+	clientDataHash := sha256.Sum256(clientData)
+	signed := append(append([]byte{}, authDataRaw...), clientDataHash[:]...)
+	if err := verifySignature(cred.PublicKey, signed, sig); err != nil {
+		return nil, err
+	}
+
+	if (authData.signCount != 0 || cred.SignCount != 0) && authData.signCount <= cred.SignCount {
+		return nil, ErrSignCountRegression
+	}
+
+	var userHandle []byte
+	if resp.Response.UserHandle != "" {
+		if userHandle, err = DecodeID(resp.Response.UserHandle); err != nil {
+			return nil, ErrInvalidResponse
+		}
+	}
+
+	return &Assertion{
+		CredentialID: cred.ID,
+		UserHandle:   userHandle,
+		SignCount:    authData.signCount,
+		UserVerified: authData.flags&flagUserVerified != 0,
+		BackupState:  authData.flags&flagBackupState != 0,
+	}, nil
+}
+
+type clientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+func (rp RelyingParty) verifyClientData(raw []byte, ceremony string, challenge []byte) error {
+	var cd clientData
+	if err := json.Unmarshal(raw, &cd); err != nil {
+		return ErrInvalidResponse
+	}
+	if cd.Type != ceremony {
+		return ErrInvalidResponse
+	}
+	got, err := DecodeID(cd.Challenge)
+	if err != nil || len(challenge) == 0 || subtle.ConstantTimeCompare(got, challenge) != 1 {
+		return ErrChallengeMismatch
+	}
+	if cd.CrossOrigin || !rp.originAllowed(cd.Origin) {
+		return ErrOriginNotAllowed
+	}
+	return nil
+}
+
+func (rp RelyingParty) originAllowed(origin string) bool {
+	origin = strings.TrimRight(strings.TrimSpace(origin), "/")
+	for _, allowed := range rp.Origins {
+		if strings.EqualFold(origin, strings.TrimRight(strings.TrimSpace(allowed), "/")) {
+			return true
+		}
+	}
+	return false
+}
+
+func (rp RelyingParty) verifyAuthenticatorFlags(ad *authenticatorData, requireUV bool) error {
+	want := sha256.Sum256([]byte(rp.ID))
+	if subtle.ConstantTimeCompare(ad.rpIDHash, want[:]) != 1 {
+		return ErrRPIDMismatch
+	}
+	if ad.flags&flagUserPresent == 0 {
+		return ErrUserNotPresent
+	}
+	if requireUV && ad.flags&flagUserVerified == 0 {
+		return ErrUserNotVerified
+	}
+	return nil
+}
+
+type authenticatorData struct {
+	rpIDHash     []byte
+	flags        byte
+	signCount    uint32
+	aaguid       []byte
+	credentialID []byte
+	publicKey    []byte
+}
+
+func parseAuthenticatorData(raw []byte) (*authenticatorData, error) {
+	if len(raw) < 37 {
+		return nil, ErrInvalidResponse
+	}
+	ad := &authenticatorData{
+		rpIDHash:  raw[:32],
+		flags:     raw[32],
+		signCount: binary.BigEndian.Uint32(raw[33:37]),
+	}
+	rest := raw[37:]
+
+	if ad.flags&flagAttestedData != 0 {
+		if len(rest) < 18 {
+			return nil, ErrInvalidResponse
+		}
+		ad.aaguid = rest[:16]
+		idLen := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if idLen == 0 || idLen > maxCredentialIDLen || len(rest) < idLen {
+			return nil, ErrInvalidResponse
+		}
+		ad.credentialID = rest[:idLen]
+		rest = rest[idLen:]
+		_, n, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, ErrInvalidResponse
+		}
+		ad.publicKey = rest[:n]
+		rest = rest[n:]
+	}
+	if ad.flags&flagExtensionData != 0 {
+		_, n, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, ErrInvalidResponse
+		}
+		rest = rest[n:]
+	}
+	if len(rest) != 0 {
+		return nil, ErrInvalidResponse
+	}
+	return ad, nil
+}
+
+// verifyAttestation checks the formats we can check without a trust store.
+// "none" must be empty; "packed" signatures are verified against either the
+// credential key (self attestation) or the leaf certificate. Other formats are
+// accepted unverified, consistent with requesting attestation "none".
+func verifyAttestation(format string, stmt map[any]any, authData, clientDataHash, coseKey []byte, credAlg int64) error {
+	switch format {
+	case "none":
+		if len(stmt) != 0 {
+			return ErrAttestationInvalid
+		}
+		return nil
+	case "packed":
+		alg, _ := stmt["alg"].(int64)
+		sig, _ := stmt["sig"].([]byte)
+		if sig == nil {
+			return ErrAttestationInvalid
+		}
+		signed := append(append([]byte{}, authData...), clientDataHash...)
+		x5c, hasCert := stmt["x5c"].([]any)
+		if !hasCert {
+			if alg != credAlg {
+				return ErrAttestationInvalid
+			}
+			if verifySignature(coseKey, signed, sig) != nil {
+				return ErrAttestationInvalid
+			}
+			return nil
+		}
+		if len(x5c) == 0 {
+			return ErrAttestationInvalid
+		}
+		der, _ := x5c[0].([]byte)
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return ErrAttestationInvalid
+		}
+		sigAlg := x509.ECDSAWithSHA256
+		if alg == AlgRS256 {
+			sigAlg = x509.SHA256WithRSA
+		} else if alg != AlgES256 {
+			return ErrAttestationInvalid
+		}
+		if cert.CheckSignature(sigAlg, signed, sig) != nil {
+			return ErrAttestationInvalid
+		}
+		return nil
+	}
+	return nil
+}
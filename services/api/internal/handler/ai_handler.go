@@ -2,12 +2,19 @@ package handler
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"io"
 	"net/http"
+	"os"
+	"strconv"
 	"strings"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/schoolerp/api/internal/db"
 	"github.com/schoolerp/api/internal/middleware"
@@ -15,19 +22,34 @@ import (
 )
 
 type AIHandler struct {
-	aiSvc *ai.Service
-	q     db.Querier
+	aiSvc    *ai.Service
+	q        db.Querier
+	whatsapp *ai.WhatsAppService
 }
 
 func NewAIHandler(aiSvc *ai.Service, q db.Querier) *AIHandler {
 	return &AIHandler{aiSvc: aiSvc, q: q}
 }
 
+// SetWhatsApp enables the inbound WhatsApp bot route.
+func (h *AIHandler) SetWhatsApp(svc *ai.WhatsAppService) {
+	h.whatsapp = svc
+}
+
+// RegisterWhatsAppRoutes mounts the gateway callback. It is public: the
+// gateway signs each message with WHATSAPP_WEBHOOK_SECRET, and the tenant is
+// taken from the signed message rather than from request headers.
+func (h *AIHandler) RegisterWhatsAppRoutes(r chi.Router) {
+	r.Post("/whatsapp/inbound", h.WhatsAppInbound)
+}
+
 func (h *AIHandler) RegisterRoutes(r chi.Router) {
 	r.Route("/ai", func(r chi.Router) {
 		r.Post("/generate-lesson-plan", h.GenerateLessonPlan)
 		r.Post("/parent-query", h.ParentQuery)
 		r.Post("/exams/rubrics/generate", h.GenerateRubric)
+		r.Get("/helpdesk/answers", h.ListHelpdeskAnswers)
+		r.Post("/helpdesk/answers/{id}/resolve", h.ResolveHandoff)
 	})
 }
 
@@ -102,6 +124,11 @@ func (h *AIHandler) ParentQuery(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if strings.TrimSpace(req.Query) == "" {
+		http.Error(w, "query is required", http.StatusBadRequest)
+		return
+	}
+
 	tenantID := middleware.GetTenantID(r.Context())
 	userID := middleware.GetUserID(r.Context())
 
@@ -112,7 +139,162 @@ func (h *AIHandler) ParentQuery(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"answer": answer})
+	json.NewEncoder(w).Encode(answer)
+}
+
+// whatsAppInboundStore is implemented by *db.Queries.
+type whatsAppInboundStore interface {
+	ResolveWhatsAppInboundTenant(ctx context.Context, phoneNumberID string) (pgtype.UUID, error)
+	ClaimWhatsAppInboundMessage(ctx context.Context, tenantID pgtype.UUID, messageID string) (bool, error)
+	ReleaseWhatsAppInboundMessage(ctx context.Context, tenantID pgtype.UUID, messageID string) error
+}
+
+// WhatsAppInbound answers a message relayed by the WhatsApp gateway. The
+// tenant is the one that owns the receiving phone-number id in the signed
+// body, each provider message id is answered once, and tools are scoped to
+// the guardian whose phone number sent it.
+func (h *AIHandler) WhatsAppInbound(w http.ResponseWriter, r *http.Request) {
+	secret := strings.TrimSpace(os.Getenv("WHATSAPP_WEBHOOK_SECRET"))
+	store, ok := h.q.(whatsAppInboundStore)
+	if h.whatsapp == nil || secret == "" || !ok {
+		http.Error(w, "WhatsApp bot not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 64<<10))
+	if err != nil {
+		http.Error(w, "could not read body", http.StatusBadRequest)
+		return
+	}
+	if !validWhatsAppSignature(secret, body, r.Header.Get("X-Hub-Signature-256")) {
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		PhoneNumberID string `json:"phone_number_id"`
+		MessageID     string `json:"message_id"`
+		From          string `json:"from"`
+		Text          string `json:"text"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.PhoneNumberID, req.MessageID = strings.TrimSpace(req.PhoneNumberID), strings.TrimSpace(req.MessageID)
+	if req.PhoneNumberID == "" || req.MessageID == "" || strings.TrimSpace(req.From) == "" || strings.TrimSpace(req.Text) == "" {
+		http.Error(w, "phone_number_id, message_id, from and text are required", http.StatusBadRequest)
+		return
+	}
+
+	tenantID, err := store.ResolveWhatsAppInboundTenant(r.Context(), req.PhoneNumberID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "unknown WhatsApp number", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "failed to resolve tenant", http.StatusInternalServerError)
+		return
+	}
+
+	enabled, err := h.featureEnabledFor(r.Context(), tenantID, "enable_parent_helpdesk")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !enabled {
+		http.Error(w, "AI Parent Helpdesk is disabled for this tenant", http.StatusForbidden)
+		return
+	}
+
+	claimed, err := store.ClaimWhatsAppInboundMessage(r.Context(), tenantID, req.MessageID)
+	if err != nil {
+		http.Error(w, "failed to record message", http.StatusInternalServerError)
+		return
+	}
+	if !claimed {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"duplicate": true})
+		return
+	}
+
+	reply, err := h.whatsapp.HandleIncomingMessage(r.Context(), tenantID.String(), req.From, req.Text)
+	if err != nil {
+		_ = store.ReleaseWhatsAppInboundMessage(context.WithoutCancel(r.Context()), tenantID, req.MessageID)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"reply": reply})
+}
+
+// validWhatsAppSignature checks a "sha256=<hex>" HMAC of the raw body.
+func validWhatsAppSignature(secret string, body []byte, header string) bool {
+	sig, ok := strings.CutPrefix(strings.TrimSpace(header), "sha256=")
+	if !ok {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal([]byte(sig), []byte(hex.EncodeToString(mac.Sum(nil))))
+}
+
+func (h *AIHandler) ListHelpdeskAnswers(w http.ResponseWriter, r *http.Request) {
+	if h.aiSvc == nil {
+		http.Error(w, "AI Service not initialized", http.StatusServiceUnavailable)
+		return
+	}
+
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	answers, err := h.aiSvc.ListHelpdeskAnswers(r.Context(), middleware.GetTenantID(r.Context()), r.URL.Query().Get("handoff_status"), limit)
+	if err != nil {
+		if errors.Is(err, ai.ErrHelpdeskLogUnavailable) {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(answers)
+}
+
+func (h *AIHandler) ResolveHandoff(w http.ResponseWriter, r *http.Request) {
+	if h.aiSvc == nil {
+		http.Error(w, "AI Service not initialized", http.StatusServiceUnavailable)
+		return
+	}
+
+	var req struct {
+		Note string `json:"note"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	tenantID := middleware.GetTenantID(r.Context())
+	userID := middleware.GetUserID(r.Context())
+
+	answer, err := h.aiSvc.ResolveHandoff(r.Context(), tenantID, chi.URLParam(r, "id"), userID, req.Note)
+	if err != nil {
+		switch {
+		case errors.Is(err, ai.ErrHandoffNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, ai.ErrHelpdeskLogUnavailable):
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(answer)
 }
 
 func (h *AIHandler) GenerateRubric(w http.ResponseWriter, r *http.Request) {
@@ -172,7 +354,10 @@ func (h *AIHandler) isFeatureEnabled(ctx context.Context, featureKey string) (bo
 	if err := tID.Scan(tenantID); err != nil {
 		return false, errors.New("invalid tenant context")
 	}
+	return h.featureEnabledFor(ctx, tID, featureKey)
+}
 
+func (h *AIHandler) featureEnabledFor(ctx context.Context, tID pgtype.UUID, featureKey string) (bool, error) {
 	tenant, err := h.q.GetTenantByID(ctx, tID)
 	if err != nil {
 		return false, err
@@ -106,6 +106,10 @@ func (h *Handler) MarkAttendance(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, err.Error(), http.StatusAccepted)
 			return
 		}
+		if middleware.RecordDataScopeViolation(r, err) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
 		if strings.Contains(err.Error(), "required") || strings.Contains(err.Error(), "invalid") || strings.Contains(err.Error(), "denied") {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
@@ -0,0 +1,188 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+	"github.com/schoolerp/api/internal/foundation/apikeys"
+	"github.com/schoolerp/api/internal/middleware"
+	"github.com/schoolerp/api/internal/service/auth"
+)
+
+// RegisterAPIClientRoutes wires the OAuth2 client-credentials grant. The
+// endpoint is public: the client authenticates with its id and secret.
+func (h *Handler) RegisterAPIClientRoutes(r chi.Router) {
+	r.With(middleware.RateLimitByKey("oauth_token", 30, 0, nil)).Post("/auth/oauth/token", h.IssueAPIToken)
+}
+
+type apiClientRevokeRequest struct {
+	Reason string `json:"reason"`
+}
+
+// IssueAPIToken accepts client credentials as form fields or HTTP Basic auth
+// and answers in the RFC 6749 format integrations expect.
+func (h *Handler) IssueAPIToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "malformed form body")
+		return
+	}
+	if grant := r.PostForm.Get("grant_type"); grant != "client_credentials" {
+		writeOAuthError(w, http.StatusBadRequest, "unsupported_grant_type", "only client_credentials is supported")
+		return
+	}
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientID, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if clientID == "" || clientSecret == "" {
+		writeOAuthError(w, http.StatusUnauthorized, "invalid_client", "client credentials are required")
+		return
+	}
+
+	token, err := h.svc.APIClients.IssueToken(r.Context(), clientID, clientSecret, strings.Fields(r.PostForm.Get("scope")))
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrAPICredentialDenied):
+			middleware.RecordSecurityEvent(r.Context(), middleware.SecurityEvent{
+				EventType:  "auth.api_token_denied",
+				Severity:   "warning",
+				Method:     r.Method,
+				Path:       r.URL.Path,
+				StatusCode: http.StatusUnauthorized,
+				IPAddress:  clientIPForAuth(r),
+				UserAgent:  r.UserAgent(),
+				Metadata:   map[string]any{"client_id": clientID},
+			})
+			writeOAuthError(w, http.StatusUnauthorized, "invalid_client", "client authentication failed")
+		case errors.Is(err, apikeys.ErrInvalidScope):
+			writeOAuthError(w, http.StatusBadRequest, "invalid_scope", err.Error())
+		default:
+			log.Error().Err(err).Msg("failed to issue api access token")
+			writeOAuthError(w, http.StatusInternalServerError, "server_error", "failed to issue token")
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	_ = json.NewEncoder(w).Encode(token)
+}
+
+func writeOAuthError(w http.ResponseWriter, status int, code, description string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Basic realm="schoolerp"`)
+	}
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": code, "error_description": description})
+}
+
+// Admin: API client management
+
+func (h *Handler) ListAPIScopes(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "data": apikeys.Scopes})
+}
+
+func (h *Handler) ListAPIClients(w http.ResponseWriter, r *http.Request) {
+	clients, err := h.svc.APIClients.ListClients(r.Context(), middleware.GetTenantID(r.Context()))
+	if err != nil {
+		writeAPIClientError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "data": clients})
+}
+
+func (h *Handler) CreateAPIClient(w http.ResponseWriter, r *http.Request) {
+	var req auth.APIClientInput
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	creds, err := h.svc.APIClients.CreateClient(r.Context(), middleware.GetTenantID(r.Context()), middleware.GetUserID(r.Context()), req)
+	if err != nil {
+		writeAPIClientError(w, err)
+		return
+	}
+	h.recordAdminEvent(r, "auth.api_client.created", map[string]any{
+		"api_client_id": creds.Client.ClientID,
+		"scopes":        creds.Client.Scopes,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "data": creds})
+}
+
+func (h *Handler) UpdateAPIClient(w http.ResponseWriter, r *http.Request) {
+	var req auth.APIClientInput
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	client, err := h.svc.APIClients.UpdateClient(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"), req)
+	if err != nil {
+		writeAPIClientError(w, err)
+		return
+	}
+	h.recordAdminEvent(r, "auth.api_client.updated", map[string]any{
+		"api_client_id":         client.ClientID,
+		"scopes":                client.Scopes,
+		"rate_limit_per_minute": client.RateLimitPerMinute,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "data": client})
+}
+
+func (h *Handler) RotateAPIClientSecret(w http.ResponseWriter, r *http.Request) {
+	creds, err := h.svc.APIClients.RotateSecret(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"))
+	if err != nil {
+		writeAPIClientError(w, err)
+		return
+	}
+	h.recordAdminEvent(r, "auth.api_client.secret_rotated", map[string]any{"api_client_id": creds.Client.ClientID})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "data": creds})
+}
+
+func (h *Handler) RevokeAPIClient(w http.ResponseWriter, r *http.Request) {
+	var req apiClientRevokeRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+	client, err := h.svc.APIClients.RevokeClient(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"), middleware.GetUserID(r.Context()), req.Reason)
+	if err != nil {
+		writeAPIClientError(w, err)
+		return
+	}
+	h.recordAdminEvent(r, "auth.api_client.revoked", map[string]any{"api_client_id": client.ClientID, "reason": req.Reason})
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "data": client})
+}
+
+func writeAPIClientError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, auth.ErrTenantRequired), errors.Is(err, auth.ErrAPIClientInvalid):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, auth.ErrAPIClientNotFound):
+		http.Error(w, "API client not found", http.StatusNotFound)
+	default:
+		log.Error().Err(err).Msg("api client administration failed")
+		http.Error(w, "Failed to update API clients", http.StatusInternalServerError)
+	}
+}
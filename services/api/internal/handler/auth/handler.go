@@ -88,8 +88,17 @@ func (h *Handler) EnableMFA(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(`{"success": true}`))
+	// Recovery codes are issued with the first factor and shown once.
+	codes, err := h.svc.EnsureRecoveryCodes(r.Context(), userID)
+	if err != nil {
+		log.Ctx(r.Context()).Warn().Err(err).Str("user_id", userID).Msg("mfa enable: unable to issue recovery codes")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":        true,
+		"recovery_codes": codes,
+	})
 }
 
 type validateMFARequest struct {
@@ -254,6 +263,14 @@ func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
 			eventType = "auth.mfa_required"
 			severity = "info"
 		}
+		var challengeErr *auth.MFAChallengeRequiredError
+		if errors.As(err, &challengeErr) {
+			statusCode = http.StatusForbidden
+			eventType = "auth.mfa.challenge_issued"
+			severity = "info"
+			code = "mfa_challenge_required"
+			meta = challengeErr
+		}
 		if errors.Is(err, auth.ErrAccessBlocked) {
 			statusCode = http.StatusForbidden
 			eventType = "auth.access_blocked"
@@ -264,6 +281,12 @@ func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
 			eventType = "auth.password_expired"
 			severity = "info"
 		}
+		if errors.Is(err, auth.ErrSSORequired) {
+			statusCode = http.StatusForbidden
+			eventType = "auth.sso_required"
+			severity = "info"
+			code = "sso_required"
+		}
 		if errors.Is(err, auth.ErrSessionStoreUnavailable) {
 			statusCode = http.StatusServiceUnavailable
 			eventType = "auth.session_store_unavailable"
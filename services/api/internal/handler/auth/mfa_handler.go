@@ -0,0 +1,394 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+	"github.com/schoolerp/api/internal/foundation/webauthn"
+	"github.com/schoolerp/api/internal/middleware"
+	"github.com/schoolerp/api/internal/service/auth"
+)
+
+// RegisterMFARoutes wires the second-factor challenge that follows a password
+// login, passkey sign-in, and self-service factor management. Challenge
+// routes are authenticated by the mfa_token returned from /auth/login.
+func (h *Handler) RegisterMFARoutes(r chi.Router) {
+	r.With(middleware.RateLimitByKey("mfa_verify", 10, 0, nil)).Post("/auth/mfa/challenge/webauthn-options", h.MFAChallengeWebAuthnOptions)
+	r.With(middleware.RateLimitByKey("mfa_verify", 10, 0, nil)).Post("/auth/mfa/challenge/verify", h.VerifyMFAChallenge)
+	r.With(middleware.RateLimitByKey("mfa_verify", 10, 0, nil)).Post("/auth/mfa/challenge/enroll-options", h.MFAChallengeEnrollOptions)
+	r.With(middleware.RateLimitByKey("mfa_verify", 10, 0, nil)).Post("/auth/mfa/challenge/enroll", h.CompleteMFAEnrollment)
+	r.With(middleware.RateLimitByKey("passkey_login", 20, 0, nil)).Post("/auth/passkey/options", h.PasskeyLoginOptions)
+	r.With(middleware.RateLimitByKey("passkey_login", 20, 0, nil)).Post("/auth/passkey/login", h.PasskeyLogin)
+
+	r.Get("/auth/mfa/status", h.GetMFAStatus)
+	r.Get("/auth/mfa/webauthn/credentials", h.ListPasskeys)
+	r.Post("/auth/mfa/webauthn/register-options", h.PasskeyRegisterOptions)
+	r.Post("/auth/mfa/webauthn/register", h.RegisterPasskey)
+	r.Patch("/auth/mfa/webauthn/credentials/{id}", h.RenamePasskey)
+	r.Delete("/auth/mfa/webauthn/credentials/{id}", h.DeletePasskey)
+	r.Post("/auth/mfa/recovery-codes", h.RegenerateRecoveryCodes)
+}
+
+type mfaTokenRequest struct {
+	MFAToken string `json:"mfa_token"`
+}
+
+type mfaVerifyRequest struct {
+	MFAToken string `json:"mfa_token"`
+	auth.MFAVerifyInput
+}
+
+type mfaEnrollRequest struct {
+	MFAToken string `json:"mfa_token"`
+	auth.MFAEnrollInput
+}
+
+type passkeyLoginRequest struct {
+	ChallengeID string                     `json:"challenge_id"`
+	Credential  webauthn.AssertionResponse `json:"credential"`
+}
+
+type passkeyRegisterRequest struct {
+	ChallengeID string                        `json:"challenge_id"`
+	Name        string                        `json:"name"`
+	Credential  webauthn.RegistrationResponse `json:"credential"`
+}
+
+type passkeyRenameRequest struct {
+	Name string `json:"name"`
+}
+
+func (h *Handler) MFAChallengeWebAuthnOptions(w http.ResponseWriter, r *http.Request) {
+	var req mfaTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	ceremony, err := h.svc.MFAWebAuthnOptions(r.Context(), req.MFAToken)
+	if err != nil {
+		writeMFAError(w, r, err)
+		return
+	}
+	writeMFAData(w, ceremony)
+}
+
+func (h *Handler) VerifyMFAChallenge(w http.ResponseWriter, r *http.Request) {
+	var req mfaVerifyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.svc.VerifyMFAChallenge(r.Context(), req.MFAToken, req.MFAVerifyInput)
+	if err != nil {
+		h.recordMFAFailure(r, err)
+		h.writeStrongLoginError(w, r, err)
+		return
+	}
+
+	eventType, severity := "auth.mfa.verified", "info"
+	if req.Method == auth.MFAMethodRecoveryCode {
+		// A recovery code in use usually means a lost authenticator.
+		eventType, severity = "auth.mfa.recovery_code_used", "warning"
+	}
+	h.recordMFAEvent(r, eventType, severity, http.StatusOK, result.UserID, map[string]any{"method": req.Method})
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(loginResponse{Success: true, Data: result})
+}
+
+func (h *Handler) MFAChallengeEnrollOptions(w http.ResponseWriter, r *http.Request) {
+	var req mfaTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	ceremony, err := h.svc.MFAEnrollmentOptions(r.Context(), req.MFAToken)
+	if err != nil {
+		writeMFAError(w, r, err)
+		return
+	}
+	writeMFAData(w, ceremony)
+}
+
+func (h *Handler) CompleteMFAEnrollment(w http.ResponseWriter, r *http.Request) {
+	var req mfaEnrollRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.svc.CompleteMFAEnrollment(r.Context(), req.MFAToken, req.MFAEnrollInput)
+	if err != nil {
+		h.recordMFAFailure(r, err)
+		h.writeStrongLoginError(w, r, err)
+		return
+	}
+
+	h.recordMFAEvent(r, "auth.webauthn.registered", "info", http.StatusOK, result.Login.UserID, map[string]any{"during_login": true})
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(loginResponse{
+		Success: true,
+		Data:    result.Login,
+		Meta:    map[string]interface{}{"recovery_codes": result.RecoveryCodes},
+	})
+}
+
+func (h *Handler) PasskeyLoginOptions(w http.ResponseWriter, r *http.Request) {
+	ceremony, err := h.svc.WebAuthn.BeginPasswordless(r.Context())
+	if err != nil {
+		writeMFAError(w, r, err)
+		return
+	}
+	writeMFAData(w, ceremony)
+}
+
+func (h *Handler) PasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	var req passkeyLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.svc.WebAuthn.FinishPasswordless(r.Context(), req.ChallengeID, req.Credential)
+	if err != nil {
+		var factorErr *auth.AuthFactorError
+		var legalErr *auth.LegalAcceptanceRequiredError
+		if !errors.As(err, &legalErr) {
+			userID := ""
+			if errors.As(err, &factorErr) {
+				userID = factorErr.UserID
+			}
+			h.recordMFAEvent(r, "auth.webauthn.login_failed", "warning", http.StatusUnauthorized, userID, map[string]any{"error": err.Error()})
+		}
+		h.writeStrongLoginError(w, r, err)
+		return
+	}
+
+	h.recordMFAEvent(r, "auth.webauthn.login", "info", http.StatusOK, result.UserID, nil)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(loginResponse{Success: true, Data: result})
+}
+
+// writeStrongLoginError renders failures from the challenge and passkey flows
+// in the same shape as /auth/login so clients share one error path.
+func (h *Handler) writeStrongLoginError(w http.ResponseWriter, r *http.Request, err error) {
+	statusCode := http.StatusUnauthorized
+	code := ""
+	var meta interface{}
+
+	var legalErr *auth.LegalAcceptanceRequiredError
+	switch {
+	case errors.As(err, &legalErr):
+		statusCode = http.StatusForbidden
+		code = "legal_acceptance_required"
+		meta = map[string]interface{}{
+			"requirements":  legalErr.Requirements,
+			"preauth_token": legalErr.PreauthToken,
+		}
+	case errors.Is(err, auth.ErrMFAEnrollmentRequired):
+		statusCode = http.StatusForbidden
+		code = "mfa_enrollment_required"
+	case errors.Is(err, auth.ErrMFAChallengeInvalid):
+		code = "mfa_challenge_invalid"
+	case errors.Is(err, auth.ErrSSORequired):
+		statusCode = http.StatusForbidden
+		code = "sso_required"
+	case errors.Is(err, auth.ErrAccessBlocked), errors.Is(err, auth.ErrMFAMethodNotAllowed), errors.Is(err, auth.ErrUserInactive):
+		statusCode = http.StatusForbidden
+	case errors.Is(err, auth.ErrWebAuthnCredentialExists), errors.Is(err, auth.ErrMFAEnrollmentNotDue):
+		statusCode = http.StatusConflict
+	case errors.Is(err, auth.ErrWebAuthnNotConfigured):
+		statusCode = http.StatusServiceUnavailable
+	case errors.Is(err, auth.ErrMFACodeInvalid),
+		errors.Is(err, auth.ErrWebAuthnChallengeInvalid),
+		errors.Is(err, auth.ErrWebAuthnVerificationFailed),
+		errors.Is(err, auth.ErrWebAuthnCredentialNotFound),
+		errors.Is(err, auth.ErrUserNotFound),
+		errors.Is(err, auth.ErrInvalidCredentials):
+	default:
+		log.Ctx(r.Context()).Error().Err(err).Str("path", r.URL.Path).Msg("auth strong login failed")
+		http.Error(w, "Failed to process request", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	_ = json.NewEncoder(w).Encode(loginResponse{
+		Success: false,
+		Code:    code,
+		Message: err.Error(),
+		Meta:    meta,
+	})
+}
+
+func (h *Handler) recordMFAFailure(r *http.Request, err error) {
+	var factorErr *auth.AuthFactorError
+	if !errors.As(err, &factorErr) {
+		return
+	}
+	h.recordMFAEvent(r, "auth.mfa.failed", "warning", http.StatusUnauthorized, factorErr.UserID, map[string]any{
+		"method": factorErr.Method,
+		"error":  factorErr.Err.Error(),
+	})
+}
+
+func (h *Handler) recordMFAEvent(r *http.Request, eventType, severity string, statusCode int, userID string, metadata map[string]any) {
+	if userID == "" {
+		userID = middleware.GetUserID(r.Context())
+	}
+	middleware.RecordSecurityEvent(r.Context(), middleware.SecurityEvent{
+		TenantID:   middleware.GetTenantID(r.Context()),
+		UserID:     userID,
+		Role:       middleware.GetRole(r.Context()),
+		EventType:  eventType,
+		Severity:   severity,
+		Method:     r.Method,
+		Path:       r.URL.Path,
+		StatusCode: statusCode,
+		IPAddress:  clientIPForAuth(r),
+		UserAgent:  r.UserAgent(),
+		Origin:     r.Header.Get("Origin"),
+		Metadata:   metadata,
+	})
+}
+
+// Self-service factor management
+
+func (h *Handler) GetMFAStatus(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+	if userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	status, err := h.svc.GetMFAStatus(r.Context(), userID)
+	if err != nil {
+		writeMFAError(w, r, err)
+		return
+	}
+	writeMFAData(w, status)
+}
+
+func (h *Handler) ListPasskeys(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+	if userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	creds, err := h.svc.WebAuthn.ListCredentials(r.Context(), userID)
+	if err != nil {
+		writeMFAError(w, r, err)
+		return
+	}
+	writeMFAData(w, creds)
+}
+
+func (h *Handler) PasskeyRegisterOptions(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+	if userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	ceremony, err := h.svc.WebAuthn.BeginRegistration(r.Context(), userID)
+	if err != nil {
+		writeMFAError(w, r, err)
+		return
+	}
+	writeMFAData(w, ceremony)
+}
+
+func (h *Handler) RegisterPasskey(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+	if userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var req passkeyRegisterRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	registered, err := h.svc.WebAuthn.FinishRegistration(r.Context(), userID, req.ChallengeID, req.Name, req.Credential)
+	if err != nil {
+		writeMFAError(w, r, err)
+		return
+	}
+	h.recordMFAEvent(r, "auth.webauthn.registered", "info", http.StatusOK, userID, map[string]any{"credential_id": registered.Credential.ID})
+	writeMFAData(w, registered)
+}
+
+func (h *Handler) RenamePasskey(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+	if userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var req passkeyRenameRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := h.svc.WebAuthn.RenameCredential(r.Context(), userID, chi.URLParam(r, "id"), req.Name); err != nil {
+		writeMFAError(w, r, err)
+		return
+	}
+	writeMFAData(w, map[string]bool{"renamed": true})
+}
+
+func (h *Handler) DeletePasskey(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+	if userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	credentialID := chi.URLParam(r, "id")
+	if err := h.svc.WebAuthn.DeleteCredential(r.Context(), userID, credentialID); err != nil {
+		writeMFAError(w, r, err)
+		return
+	}
+	h.recordMFAEvent(r, "auth.webauthn.removed", "warning", http.StatusOK, userID, map[string]any{"credential_id": credentialID})
+	writeMFAData(w, map[string]bool{"deleted": true})
+}
+
+func (h *Handler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+	if userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	codes, err := h.svc.RegenerateRecoveryCodes(r.Context(), userID)
+	if err != nil {
+		writeMFAError(w, r, err)
+		return
+	}
+	h.recordMFAEvent(r, "auth.mfa.recovery_codes_regenerated", "info", http.StatusOK, userID, nil)
+	writeMFAData(w, map[string][]string{"recovery_codes": codes})
+}
+
+func writeMFAData(w http.ResponseWriter, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "data": data})
+}
+
+func writeMFAError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, auth.ErrMFAChallengeInvalid), errors.Is(err, auth.ErrUserNotFound):
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+	case errors.Is(err, auth.ErrMFAMethodNotAllowed), errors.Is(err, auth.ErrLastPhishingResistantFactor):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, auth.ErrWebAuthnCredentialNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, auth.ErrWebAuthnCredentialExists), errors.Is(err, auth.ErrMFAEnrollmentNotDue):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, auth.ErrWebAuthnChallengeInvalid), errors.Is(err, auth.ErrWebAuthnVerificationFailed):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, auth.ErrWebAuthnNotConfigured):
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	default:
+		log.Ctx(r.Context()).Error().Err(err).Str("path", r.URL.Path).Msg("auth mfa request failed")
+		http.Error(w, "Failed to process request", http.StatusInternalServerError)
+	}
+}
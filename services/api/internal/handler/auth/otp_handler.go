@@ -0,0 +1,413 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+	"github.com/schoolerp/api/internal/middleware"
+	"github.com/schoolerp/api/internal/service/auth"
+)
+
+// RegisterOTPRoutes wires passwordless phone login for parents.
+func (h *Handler) RegisterOTPRoutes(r chi.Router) {
+	r.With(middleware.RateLimitByKey("otp_request", 5, 0, nil)).Post("/auth/otp/request", h.RequestOTP)
+	r.With(middleware.RateLimitByKey("otp_request", 5, 0, nil)).Post("/auth/request-otp", h.RequestOTP)
+	r.With(middleware.RateLimitByKey("otp_verify", 10, 0, nil)).Post("/auth/otp/verify", h.VerifyOTP)
+	r.With(middleware.RateLimitByKey("otp_verify", 10, 0, nil)).Post("/auth/otp/device-login", h.DeviceLogin)
+	r.Post("/auth/otp/phone/request", h.RequestPhoneVerification)
+	r.Post("/auth/otp/phone/confirm", h.ConfirmPhoneVerification)
+	r.Get("/auth/devices", h.ListDevices)
+	r.Delete("/auth/devices/{id}", h.RevokeDevice)
+}
+
+// RegisterAdminRoutes wires staff-side auth administration.
+func (h *Handler) RegisterAdminRoutes(r chi.Router) {
+	r.Post("/guardians/{id}/phone-verification", h.VerifyGuardianPhone)
+	r.Get("/sso/providers", h.ListSSOProviders)
+	r.Post("/sso/providers", h.CreateSSOProvider)
+	r.Put("/sso/providers/{id}", h.UpdateSSOProvider)
+	r.Delete("/sso/providers/{id}", h.DeleteSSOProvider)
+	r.Put("/sso/settings", h.UpdateSSOSettings)
+	r.Get("/api-clients", h.ListAPIClients)
+	r.Get("/api-clients/scopes", h.ListAPIScopes)
+	r.Post("/api-clients", h.CreateAPIClient)
+	r.Put("/api-clients/{id}", h.UpdateAPIClient)
+	r.Post("/api-clients/{id}/rotate-secret", h.RotateAPIClientSecret)
+	r.Post("/api-clients/{id}/revoke", h.RevokeAPIClient)
+}
+
+type otpRequest struct {
+	Phone   string `json:"phone"`
+	Channel string `json:"channel"`
+}
+
+type otpVerifyRequest struct {
+	Phone          string `json:"phone"`
+	Code           string `json:"code"`
+	RememberDevice bool   `json:"remember_device"`
+	DeviceLabel    string `json:"device_label"`
+}
+
+type deviceLoginRequest struct {
+	Phone       string `json:"phone"`
+	DeviceToken string `json:"device_token"`
+}
+
+func (h *Handler) RequestOTP(w http.ResponseWriter, r *http.Request) {
+	var req otpRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	tenantID := middleware.GetTenantID(r.Context())
+	result, err := h.svc.RequestLoginOTP(r.Context(), tenantID, req.Phone, req.Channel, clientIPForAuth(r), r.UserAgent())
+	if err != nil {
+		statusCode := otpErrorStatus(err)
+		if statusCode == http.StatusInternalServerError {
+			log.Ctx(r.Context()).Error().Err(err).Str("phone", auth.MaskPhone(req.Phone)).Msg("auth otp request failed")
+			http.Error(w, "Failed to process request", statusCode)
+			return
+		}
+		if statusCode == http.StatusTooManyRequests {
+			h.recordOTPEvent(r, otpLimitEvent(err), otpLimitSeverity(err), statusCode, req.Phone, nil)
+		}
+		http.Error(w, err.Error(), statusCode)
+		return
+	}
+
+	if !result.Sent {
+		h.recordOTPEvent(r, "auth.otp.request_unmatched", "info", http.StatusOK, req.Phone, map[string]any{
+			"reason": result.Reason,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "If the number is registered, a code has been sent",
+		"meta": map[string]interface{}{
+			"channel":    result.Channel,
+			"expires_in": result.ExpiresIn,
+		},
+	})
+}
+
+func (h *Handler) VerifyOTP(w http.ResponseWriter, r *http.Request) {
+	var req otpVerifyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.svc.VerifyLoginOTP(r.Context(), middleware.GetTenantID(r.Context()), req.Phone, req.Code, auth.OTPLoginOptions{
+		RememberDevice: req.RememberDevice,
+		DeviceLabel:    req.DeviceLabel,
+		IPAddress:      clientIPForAuth(r),
+		UserAgent:      r.UserAgent(),
+	})
+	if err != nil {
+		h.writePhoneLoginError(w, r, req.Phone, err)
+		return
+	}
+
+	var meta interface{}
+	if result.DeviceToken != "" {
+		meta = map[string]interface{}{
+			"device_token":      result.DeviceToken,
+			"device_expires_at": result.DeviceExpiresAt,
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(loginResponse{
+		Success: true,
+		Data:    result.Login,
+		Meta:    meta,
+	})
+}
+
+func (h *Handler) DeviceLogin(w http.ResponseWriter, r *http.Request) {
+	var req deviceLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.svc.LoginWithTrustedDevice(r.Context(), middleware.GetTenantID(r.Context()), req.Phone, req.DeviceToken)
+	if err != nil {
+		h.writePhoneLoginError(w, r, req.Phone, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(loginResponse{
+		Success: true,
+		Data:    result,
+	})
+}
+
+func (h *Handler) RequestPhoneVerification(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+	if userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req otpRequest
+	_ = json.NewDecoder(r.Body).Decode(&req)
+
+	result, err := h.svc.RequestPhoneVerificationOTP(r.Context(), middleware.GetTenantID(r.Context()), userID, req.Channel, clientIPForAuth(r), r.UserAgent())
+	if err != nil {
+		statusCode := otpErrorStatus(err)
+		if statusCode == http.StatusInternalServerError {
+			http.Error(w, "Failed to process request", statusCode)
+			return
+		}
+		http.Error(w, err.Error(), statusCode)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    true,
+		"channel":    result.Channel,
+		"expires_in": result.ExpiresIn,
+	})
+}
+
+func (h *Handler) ConfirmPhoneVerification(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+	if userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req otpVerifyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.svc.ConfirmPhoneVerification(r.Context(), middleware.GetTenantID(r.Context()), userID, req.Code); err != nil {
+		statusCode := otpErrorStatus(err)
+		if statusCode == http.StatusInternalServerError {
+			http.Error(w, "Failed to verify phone", statusCode)
+			return
+		}
+		if errors.Is(err, auth.ErrOTPInvalid) {
+			h.recordOTPFailure(r, "", err)
+		}
+		http.Error(w, err.Error(), statusCode)
+		return
+	}
+
+	middleware.RecordSecurityEvent(r.Context(), middleware.SecurityEvent{
+		TenantID:   middleware.GetTenantID(r.Context()),
+		UserID:     userID,
+		Role:       middleware.GetRole(r.Context()),
+		EventType:  "auth.guardian_phone.verified",
+		Severity:   "info",
+		Method:     r.Method,
+		Path:       r.URL.Path,
+		StatusCode: http.StatusOK,
+		IPAddress:  clientIPForAuth(r),
+		UserAgent:  r.UserAgent(),
+		Metadata:   map[string]any{"verified_via": "otp"},
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+}
+
+func (h *Handler) ListDevices(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+	if userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	devices, err := h.svc.ListTrustedDevices(r.Context(), userID)
+	if err != nil {
+		http.Error(w, "Failed to list devices", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(devices)
+}
+
+func (h *Handler) RevokeDevice(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+	if userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.svc.RevokeTrustedDevice(r.Context(), userID, chi.URLParam(r, "id")); err != nil {
+		if errors.Is(err, auth.ErrDeviceNotTrusted) {
+			http.Error(w, "Device not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to revoke device", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) VerifyGuardianPhone(w http.ResponseWriter, r *http.Request) {
+	tenantID := middleware.GetTenantID(r.Context())
+	userID := middleware.GetUserID(r.Context())
+
+	phoneKey, err := h.svc.MarkGuardianPhoneVerified(r.Context(), tenantID, chi.URLParam(r, "id"), userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrGuardianNotFound):
+			http.Error(w, "Guardian not found", http.StatusNotFound)
+		case errors.Is(err, auth.ErrInvalidPhone), errors.Is(err, auth.ErrTenantRequired):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, "Failed to verify phone", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	middleware.RecordSecurityEvent(r.Context(), middleware.SecurityEvent{
+		TenantID:   tenantID,
+		UserID:     userID,
+		Role:       middleware.GetRole(r.Context()),
+		EventType:  "auth.guardian_phone.verified",
+		Severity:   "info",
+		Method:     r.Method,
+		Path:       r.URL.Path,
+		StatusCode: http.StatusOK,
+		IPAddress:  clientIPForAuth(r),
+		UserAgent:  r.UserAgent(),
+		Metadata: map[string]any{
+			"guardian_id":  chi.URLParam(r, "id"),
+			"phone_masked": auth.MaskPhone(phoneKey),
+			"verified_via": "staff",
+		},
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+}
+
+func (h *Handler) writePhoneLoginError(w http.ResponseWriter, r *http.Request, phone string, err error) {
+	statusCode := otpErrorStatus(err)
+	code := ""
+	var meta interface{}
+
+	var legalErr *auth.LegalAcceptanceRequiredError
+	switch {
+	case errors.As(err, &legalErr):
+		statusCode = http.StatusForbidden
+		code = "legal_acceptance_required"
+		meta = map[string]interface{}{
+			"requirements":  legalErr.Requirements,
+			"preauth_token": legalErr.PreauthToken,
+		}
+	case errors.Is(err, auth.ErrOTPInvalid):
+		h.recordOTPFailure(r, phone, err)
+	case errors.Is(err, auth.ErrDeviceNotTrusted):
+		h.recordOTPEvent(r, "auth.otp.device_rejected", "warning", statusCode, phone, nil)
+	case errors.Is(err, auth.ErrOTPNotAllowed), errors.Is(err, auth.ErrAccessBlocked):
+		h.recordOTPEvent(r, "auth.otp.login_denied", "warning", statusCode, phone, map[string]any{"error": err.Error()})
+	case statusCode == http.StatusInternalServerError:
+		log.Ctx(r.Context()).Error().Err(err).Str("phone", auth.MaskPhone(phone)).Msg("auth otp login failed")
+		http.Error(w, "Failed to process request", statusCode)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	_ = json.NewEncoder(w).Encode(loginResponse{
+		Success: false,
+		Code:    code,
+		Message: err.Error(),
+		Meta:    meta,
+	})
+}
+
+// recordOTPFailure raises a warning for each wrong code and a critical event once a
+// challenge has been locked by repeated failures.
+func (h *Handler) recordOTPFailure(r *http.Request, phone string, err error) {
+	metadata := map[string]any{}
+	eventType := "auth.otp.failed"
+	severity := "warning"
+
+	var attemptErr *auth.OTPAttemptError
+	if errors.As(err, &attemptErr) {
+		metadata["attempts"] = attemptErr.Attempts
+		metadata["remaining"] = attemptErr.Remaining
+		if attemptErr.Remaining <= 0 {
+			eventType = "auth.otp.locked"
+			severity = "critical"
+		}
+	}
+	h.recordOTPEvent(r, eventType, severity, http.StatusUnauthorized, phone, metadata)
+}
+
+func (h *Handler) recordOTPEvent(r *http.Request, eventType, severity string, statusCode int, phone string, metadata map[string]any) {
+	if metadata == nil {
+		metadata = map[string]any{}
+	}
+	if phone != "" {
+		metadata["phone_masked"] = auth.MaskPhone(phone)
+	}
+	middleware.RecordSecurityEvent(r.Context(), middleware.SecurityEvent{
+		TenantID:   middleware.GetTenantID(r.Context()),
+		UserID:     middleware.GetUserID(r.Context()),
+		Role:       middleware.GetRole(r.Context()),
+		EventType:  eventType,
+		Severity:   severity,
+		Method:     r.Method,
+		Path:       r.URL.Path,
+		StatusCode: statusCode,
+		IPAddress:  clientIPForAuth(r),
+		UserAgent:  r.UserAgent(),
+		Origin:     r.Header.Get("Origin"),
+		Metadata:   metadata,
+	})
+}
+
+func otpErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, auth.ErrTenantRequired),
+		errors.Is(err, auth.ErrInvalidPhone),
+		errors.Is(err, auth.ErrInvalidChannel):
+		return http.StatusBadRequest
+	case errors.Is(err, auth.ErrOTPThrottled), errors.Is(err, auth.ErrOTPLocked):
+		return http.StatusTooManyRequests
+	case errors.Is(err, auth.ErrOTPInvalid),
+		errors.Is(err, auth.ErrDeviceNotTrusted),
+		errors.Is(err, auth.ErrUserNotFound),
+		errors.Is(err, auth.ErrUserInactive):
+		return http.StatusUnauthorized
+	case errors.Is(err, auth.ErrOTPNotAllowed), errors.Is(err, auth.ErrAccessBlocked):
+		return http.StatusForbidden
+	case errors.Is(err, auth.ErrGuardianNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, auth.ErrSessionStoreUnavailable):
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+func otpLimitEvent(err error) string {
+	if errors.Is(err, auth.ErrOTPLocked) {
+		return "auth.otp.phone_locked"
+	}
+	return "auth.otp.throttled"
+}
+
+func otpLimitSeverity(err error) string {
+	if errors.Is(err, auth.ErrOTPLocked) {
+		return "critical"
+	}
+	return "warning"
+}
@@ -0,0 +1,394 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+	"github.com/schoolerp/api/internal/foundation/sso"
+	"github.com/schoolerp/api/internal/middleware"
+	"github.com/schoolerp/api/internal/service/auth"
+)
+
+// RegisterSSORoutes wires staff single sign-on. The callback and ACS endpoints are
+// reached by browser redirects from the IdP, so they resolve the tenant from the
+// stored login request rather than from headers.
+func (h *Handler) RegisterSSORoutes(r chi.Router) {
+	r.Get("/auth/sso/providers", h.ListSSOLoginOptions)
+	r.With(middleware.RateLimitByKey("sso_start", 20, 0, nil)).Post("/auth/sso/{id}/start", h.StartSSO)
+	r.Get("/auth/sso/oidc/callback", h.OIDCCallback)
+	r.Post("/auth/sso/saml/{id}/acs", h.SAMLACS)
+	r.Get("/auth/sso/saml/{id}/metadata", h.SAMLMetadata)
+	r.With(middleware.RateLimitByKey("sso_exchange", 20, 0, nil)).Post("/auth/sso/exchange", h.ExchangeSSOTicket)
+}
+
+type ssoStartRequest struct {
+	Next string `json:"next"`
+}
+
+type ssoExchangeRequest struct {
+	Ticket string `json:"ticket"`
+}
+
+type ssoSettingsRequest struct {
+	SSOOnly bool `json:"sso_only"`
+}
+
+func (h *Handler) ListSSOLoginOptions(w http.ResponseWriter, r *http.Request) {
+	opts, err := h.svc.SSO.LoginOptions(r.Context(), middleware.GetTenantID(r.Context()))
+	if err != nil {
+		if errors.Is(err, auth.ErrTenantRequired) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "Failed to load sign-in options", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "data": opts})
+}
+
+func (h *Handler) StartSSO(w http.ResponseWriter, r *http.Request) {
+	var req ssoStartRequest
+	_ = json.NewDecoder(r.Body).Decode(&req)
+
+	redirectURL, err := h.svc.SSO.Begin(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"), req.Next)
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrTenantRequired):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, auth.ErrSSOProviderNotFound):
+			http.Error(w, "SSO provider not found", http.StatusNotFound)
+		case errors.Is(err, auth.ErrSSONotConfigured):
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		default:
+			log.Ctx(r.Context()).Error().Err(err).Str("provider_id", chi.URLParam(r, "id")).Msg("sso start failed")
+			http.Error(w, "Unable to reach the identity provider", http.StatusBadGateway)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"data":    map[string]string{"redirect_url": redirectURL},
+	})
+}
+
+func (h *Handler) OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if idpErr := q.Get("error"); idpErr != "" {
+		h.recordSSOFailure(r, &auth.SSOLoginError{Err: errors.New("identity provider returned " + idpErr)})
+		h.redirectSSOResult(w, r, nil, "idp_error")
+		return
+	}
+	result, err := h.svc.SSO.CompleteOIDC(r.Context(), q.Get("state"), q.Get("code"))
+	h.finishSSOCallback(w, r, result, err)
+}
+
+func (h *Handler) SAMLACS(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid SAML response", http.StatusBadRequest)
+		return
+	}
+	result, err := h.svc.SSO.CompleteSAML(r.Context(), chi.URLParam(r, "id"), r.PostForm.Get("SAMLResponse"), r.PostForm.Get("RelayState"))
+	h.finishSSOCallback(w, r, result, err)
+}
+
+func (h *Handler) finishSSOCallback(w http.ResponseWriter, r *http.Request, result *auth.SSOCompletion, err error) {
+	if err != nil {
+		h.recordSSOFailure(r, err)
+		h.redirectSSOResult(w, r, nil, ssoErrorCode(err))
+		return
+	}
+	middleware.RecordSecurityEvent(r.Context(), middleware.SecurityEvent{
+		TenantID:   result.TenantID,
+		UserID:     result.UserID,
+		EventType:  "auth.sso.login",
+		Severity:   "info",
+		Method:     r.Method,
+		Path:       r.URL.Path,
+		StatusCode: http.StatusFound,
+		IPAddress:  clientIPForAuth(r),
+		UserAgent:  r.UserAgent(),
+		Metadata: map[string]any{
+			"provider_id": result.ProviderID,
+		},
+	})
+	h.redirectSSOResult(w, r, result, "")
+}
+
+// redirectSSOResult sends the browser back to the frontend with either a one-time
+// ticket or an error code; session tokens never appear in URLs.
+func (h *Handler) redirectSSOResult(w http.ResponseWriter, r *http.Request, result *auth.SSOCompletion, errCode string) {
+	target, err := url.Parse(auth.SSOFrontendCallbackURL())
+	if err != nil {
+		http.Error(w, "SSO is misconfigured", http.StatusInternalServerError)
+		return
+	}
+	q := target.Query()
+	if result != nil {
+		q.Set("ticket", result.Ticket)
+		if result.RedirectPath != "" {
+			q.Set("next", result.RedirectPath)
+		}
+	} else {
+		q.Set("error", errCode)
+	}
+	target.RawQuery = q.Encode()
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
+
+func (h *Handler) recordSSOFailure(r *http.Request, err error) {
+	metadata := map[string]any{"error": err.Error()}
+	tenantID := ""
+	var loginErr *auth.SSOLoginError
+	if errors.As(err, &loginErr) {
+		tenantID = loginErr.TenantID
+		if loginErr.ProviderID != "" {
+			metadata["provider_id"] = loginErr.ProviderID
+		}
+		if loginErr.Email != "" {
+			metadata["email_masked"] = loginErr.Email
+		}
+	}
+
+	severity := "warning"
+	if errors.Is(err, sso.ErrSignatureInvalid) || errors.Is(err, auth.ErrSSORoleNotAllowed) {
+		severity = "critical"
+	}
+	middleware.RecordSecurityEvent(r.Context(), middleware.SecurityEvent{
+		TenantID:   tenantID,
+		EventType:  "auth.sso.failed",
+		Severity:   severity,
+		Method:     r.Method,
+		Path:       r.URL.Path,
+		StatusCode: http.StatusFound,
+		IPAddress:  clientIPForAuth(r),
+		UserAgent:  r.UserAgent(),
+		Origin:     r.Header.Get("Origin"),
+		Metadata:   metadata,
+	})
+}
+
+// ssoErrorCode maps failures to the small set of codes the frontend can explain.
+func ssoErrorCode(err error) string {
+	switch {
+	case errors.Is(err, auth.ErrSSOStateInvalid):
+		return "expired"
+	case errors.Is(err, auth.ErrSSOEmailUnverified), errors.Is(err, auth.ErrSSODomainNotAllowed):
+		return "email_not_allowed"
+	case errors.Is(err, auth.ErrSSOAccountNotLinked), errors.Is(err, auth.ErrUserInactive):
+		return "account_not_found"
+	case errors.Is(err, auth.ErrSSONoMappedRole), errors.Is(err, auth.ErrSSORoleNotAllowed):
+		return "not_authorized"
+	case errors.Is(err, auth.ErrSSOProviderNotFound):
+		return "provider_unavailable"
+	}
+	return "sso_failed"
+}
+
+func (h *Handler) SAMLMetadata(w http.ResponseWriter, r *http.Request) {
+	metadata, err := h.svc.SSO.SAMLMetadata(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		if errors.Is(err, auth.ErrSSOProviderNotFound) {
+			http.Error(w, "SSO provider not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "application/samlmetadata+xml")
+	_, _ = w.Write(metadata)
+}
+
+func (h *Handler) ExchangeSSOTicket(w http.ResponseWriter, r *http.Request) {
+	var req ssoExchangeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.svc.SSO.ExchangeTicket(r.Context(), req.Ticket)
+	if err != nil {
+		statusCode := http.StatusUnauthorized
+		code := ""
+		var meta interface{}
+
+		var legalErr *auth.LegalAcceptanceRequiredError
+		var challengeErr *auth.MFAChallengeRequiredError
+		switch {
+		case errors.As(err, &legalErr):
+			statusCode = http.StatusForbidden
+			code = "legal_acceptance_required"
+			meta = map[string]interface{}{
+				"requirements":  legalErr.Requirements,
+				"preauth_token": legalErr.PreauthToken,
+			}
+		case errors.As(err, &challengeErr):
+			statusCode = http.StatusForbidden
+			code = "mfa_challenge_required"
+			meta = challengeErr
+		case errors.Is(err, auth.ErrSSOPhishingResistantRequired):
+			statusCode = http.StatusForbidden
+			code = "phishing_resistant_required"
+			var factorErr *auth.AuthFactorError
+			userID := ""
+			if errors.As(err, &factorErr) {
+				userID = factorErr.UserID
+			}
+			middleware.RecordSecurityEvent(r.Context(), middleware.SecurityEvent{
+				UserID:     userID,
+				EventType:  "auth.sso.factor_rejected",
+				Severity:   "warning",
+				Method:     r.Method,
+				Path:       r.URL.Path,
+				StatusCode: statusCode,
+				IPAddress:  clientIPForAuth(r),
+				UserAgent:  r.UserAgent(),
+				Origin:     r.Header.Get("Origin"),
+			})
+		case errors.Is(err, auth.ErrSSOTicketInvalid):
+			middleware.RecordSecurityEvent(r.Context(), middleware.SecurityEvent{
+				EventType:  "auth.sso.ticket_rejected",
+				Severity:   "warning",
+				Method:     r.Method,
+				Path:       r.URL.Path,
+				StatusCode: statusCode,
+				IPAddress:  clientIPForAuth(r),
+				UserAgent:  r.UserAgent(),
+				Origin:     r.Header.Get("Origin"),
+			})
+		case errors.Is(err, auth.ErrAccessBlocked), errors.Is(err, auth.ErrSSORoleNotAllowed):
+			statusCode = http.StatusForbidden
+		case errors.Is(err, auth.ErrSessionStoreUnavailable):
+			statusCode = http.StatusServiceUnavailable
+		case errors.Is(err, auth.ErrUserNotFound), errors.Is(err, auth.ErrUserInactive):
+		default:
+			log.Ctx(r.Context()).Error().Err(err).Msg("sso ticket exchange failed")
+			http.Error(w, "Failed to process request", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(statusCode)
+		_ = json.NewEncoder(w).Encode(loginResponse{
+			Success: false,
+			Code:    code,
+			Message: err.Error(),
+			Meta:    meta,
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(loginResponse{
+		Success: true,
+		Data:    result,
+	})
+}
+
+// Admin: provider management
+
+func (h *Handler) ListSSOProviders(w http.ResponseWriter, r *http.Request) {
+	providers, err := h.svc.SSO.ListProviders(r.Context(), middleware.GetTenantID(r.Context()))
+	if err != nil {
+		writeSSOAdminError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "data": providers})
+}
+
+func (h *Handler) CreateSSOProvider(w http.ResponseWriter, r *http.Request) {
+	var req auth.SSOProviderInput
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	provider, err := h.svc.SSO.CreateProvider(r.Context(), middleware.GetTenantID(r.Context()), middleware.GetUserID(r.Context()), req)
+	if err != nil {
+		writeSSOAdminError(w, err)
+		return
+	}
+	h.recordAdminEvent(r, "auth.sso.provider_created", map[string]any{"provider_id": provider.ID, "protocol": provider.Protocol})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "data": provider})
+}
+
+func (h *Handler) UpdateSSOProvider(w http.ResponseWriter, r *http.Request) {
+	var req auth.SSOProviderInput
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	provider, err := h.svc.SSO.UpdateProvider(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"), req)
+	if err != nil {
+		writeSSOAdminError(w, err)
+		return
+	}
+	h.recordAdminEvent(r, "auth.sso.provider_updated", map[string]any{"provider_id": provider.ID, "enabled": provider.IsEnabled})
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "data": provider})
+}
+
+func (h *Handler) DeleteSSOProvider(w http.ResponseWriter, r *http.Request) {
+	if err := h.svc.SSO.DeleteProvider(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id")); err != nil {
+		writeSSOAdminError(w, err)
+		return
+	}
+	h.recordAdminEvent(r, "auth.sso.provider_deleted", map[string]any{"provider_id": chi.URLParam(r, "id")})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) UpdateSSOSettings(w http.ResponseWriter, r *http.Request) {
+	var req ssoSettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := h.svc.SSO.UpdateSettings(r.Context(), middleware.GetTenantID(r.Context()), middleware.GetUserID(r.Context()), req.SSOOnly); err != nil {
+		writeSSOAdminError(w, err)
+		return
+	}
+	h.recordAdminEvent(r, "auth.sso.settings_updated", map[string]any{"sso_only": req.SSOOnly})
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "data": req})
+}
+
+func (h *Handler) recordAdminEvent(r *http.Request, eventType string, metadata map[string]any) {
+	middleware.RecordSecurityEvent(r.Context(), middleware.SecurityEvent{
+		TenantID:   middleware.GetTenantID(r.Context()),
+		UserID:     middleware.GetUserID(r.Context()),
+		Role:       middleware.GetRole(r.Context()),
+		EventType:  eventType,
+		Severity:   "info",
+		Method:     r.Method,
+		Path:       r.URL.Path,
+		StatusCode: http.StatusOK,
+		IPAddress:  clientIPForAuth(r),
+		UserAgent:  r.UserAgent(),
+		Metadata:   metadata,
+	})
+}
+
+func writeSSOAdminError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, auth.ErrTenantRequired), errors.Is(err, auth.ErrSSOInvalidConfig):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, auth.ErrSSOProviderNotFound):
+		http.Error(w, "SSO provider not found", http.StatusNotFound)
+	default:
+		http.Error(w, "Failed to update SSO configuration", http.StatusInternalServerError)
+	}
+}
@@ -10,11 +10,12 @@ import (
 )
 
 type AutomationHandler struct {
-	svc *automation.AutomationService
+	svc      *automation.AutomationService
+	webhooks *automation.SubscriptionService
 }
 
-func NewAutomationHandler(svc *automation.AutomationService) *AutomationHandler {
-	return &AutomationHandler{svc: svc}
+func NewAutomationHandler(svc *automation.AutomationService, webhooks *automation.SubscriptionService) *AutomationHandler {
+	return &AutomationHandler{svc: svc, webhooks: webhooks}
 }
 
 func (h *AutomationHandler) RegisterRoutes(r chi.Router) {
@@ -23,6 +24,19 @@ func (h *AutomationHandler) RegisterRoutes(r chi.Router) {
 		r.Post("/rules", h.CreateRule)
 		r.Put("/rules/{id}", h.UpdateRule)
 		r.Delete("/rules/{id}", h.DeleteRule)
+
+		r.Get("/webhooks", h.ListWebhooks)
+		r.Get("/webhooks/events", h.ListWebhookEvents)
+		r.Post("/webhooks", h.CreateWebhook)
+		r.Get("/webhooks/{id}", h.GetWebhook)
+		r.Put("/webhooks/{id}", h.UpdateWebhook)
+		r.Delete("/webhooks/{id}", h.DeleteWebhook)
+		r.Post("/webhooks/{id}/enable", h.EnableWebhook)
+		r.Post("/webhooks/{id}/disable", h.DisableWebhook)
+		r.Post("/webhooks/{id}/rotate-secret", h.RotateWebhookSecret)
+		r.Get("/webhooks/{id}/deliveries", h.ListWebhookDeliveries)
+		r.Get("/webhooks/{id}/deliveries/{deliveryID}/attempts", h.ListWebhookDeliveryAttempts)
+		r.Post("/webhooks/{id}/deliveries/{deliveryID}/redeliver", h.RedeliverWebhook)
 	})
 }
 
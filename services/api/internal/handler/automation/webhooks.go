@@ -0,0 +1,168 @@
+package automation
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/schoolerp/api/internal/middleware"
+	"github.com/schoolerp/api/internal/service/automation"
+)
+
+func webhookActor(r *http.Request) automation.WebhookActor {
+	return automation.WebhookActor{
+		UserID:    middleware.GetUserID(r.Context()),
+		RequestID: middleware.GetReqID(r.Context()),
+		IP:        r.RemoteAddr,
+	}
+}
+
+func writeWebhookError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, automation.ErrInvalidWebhookSubscription):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, automation.ErrWebhookSubscriptionNotFound), errors.Is(err, automation.ErrWebhookDeliveryNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func (h *AutomationHandler) ListWebhookEvents(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, automation.WebhookEvents)
+}
+
+func (h *AutomationHandler) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	subs, err := h.webhooks.ListSubscriptions(r.Context(), middleware.GetTenantID(r.Context()))
+	if err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, subs)
+}
+
+func (h *AutomationHandler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var in automation.WebhookSubscriptionInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	sub, err := h.webhooks.CreateSubscription(r.Context(), middleware.GetTenantID(r.Context()), webhookActor(r), in)
+	if err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, sub)
+}
+
+func (h *AutomationHandler) GetWebhook(w http.ResponseWriter, r *http.Request) {
+	sub, err := h.webhooks.GetSubscription(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"))
+	if err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, sub)
+}
+
+func (h *AutomationHandler) UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	var in automation.WebhookSubscriptionInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	sub, err := h.webhooks.UpdateSubscription(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"), webhookActor(r), in)
+	if err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, sub)
+}
+
+func (h *AutomationHandler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	if err := h.webhooks.DeleteSubscription(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"), webhookActor(r)); err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *AutomationHandler) EnableWebhook(w http.ResponseWriter, r *http.Request) {
+	h.setWebhookEnabled(w, r, true)
+}
+
+func (h *AutomationHandler) DisableWebhook(w http.ResponseWriter, r *http.Request) {
+	h.setWebhookEnabled(w, r, false)
+}
+
+func (h *AutomationHandler) setWebhookEnabled(w http.ResponseWriter, r *http.Request, enabled bool) {
+	sub, err := h.webhooks.SetSubscriptionEnabled(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"), webhookActor(r), enabled)
+	if err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, sub)
+}
+
+func (h *AutomationHandler) RotateWebhookSecret(w http.ResponseWriter, r *http.Request) {
+	sub, err := h.webhooks.RotateSecret(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"), webhookActor(r))
+	if err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, sub)
+}
+
+func (h *AutomationHandler) ListWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+	deliveries, err := h.webhooks.ListDeliveries(
+		r.Context(),
+		middleware.GetTenantID(r.Context()),
+		chi.URLParam(r, "id"),
+		r.URL.Query().Get("status"),
+		int32(limit),
+		int32(offset),
+	)
+	if err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, deliveries)
+}
+
+func (h *AutomationHandler) ListWebhookDeliveryAttempts(w http.ResponseWriter, r *http.Request) {
+	attempts, err := h.webhooks.ListDeliveryAttempts(
+		r.Context(),
+		middleware.GetTenantID(r.Context()),
+		chi.URLParam(r, "id"),
+		chi.URLParam(r, "deliveryID"),
+	)
+	if err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, attempts)
+}
+
+func (h *AutomationHandler) RedeliverWebhook(w http.ResponseWriter, r *http.Request) {
+	delivery, err := h.webhooks.Redeliver(
+		r.Context(),
+		middleware.GetTenantID(r.Context()),
+		chi.URLParam(r, "id"),
+		chi.URLParam(r, "deliveryID"),
+		webhookActor(r),
+	)
+	if err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, delivery)
+}
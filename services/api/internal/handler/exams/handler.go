@@ -159,8 +159,12 @@ func (h *Handler) ListSubjects(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) GetMarks(w http.ResponseWriter, r *http.Request) {
 	examID := chi.URLParam(r, "id")
 	subjectID := chi.URLParam(r, "subjectId")
-	marks, err := h.svc.GetExamMarks(r.Context(), middleware.GetTenantID(r.Context()), examID, subjectID)
+	marks, err := h.svc.GetExamMarks(r.Context(), middleware.GetTenantID(r.Context()), examID, subjectID, middleware.DataScopeActor(r.Context()))
 	if err != nil {
+		if middleware.RecordDataScopeViolation(r, err) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -195,10 +199,15 @@ func (h *Handler) UpsertMarks(w http.ResponseWriter, r *http.Request) {
 		StudentID: req.StudentID,
 		Marks:     req.Marks,
 		UserID:    middleware.GetUserID(r.Context()),
+		Role:      middleware.GetRole(r.Context()),
 		RequestID: middleware.GetReqID(r.Context()),
 		IP:        r.RemoteAddr,
 	})
 	if err != nil {
+		if middleware.RecordDataScopeViolation(r, err) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
 		if strings.Contains(err.Error(), "locked") {
 			http.Error(w, err.Error(), http.StatusConflict)
 			return
@@ -228,10 +237,15 @@ func (h *Handler) UpsertMarksBulk(w http.ResponseWriter, r *http.Request) {
 		SubjectID: subjectID,
 		Entries:   req.Entries,
 		UserID:    middleware.GetUserID(r.Context()),
+		Role:      middleware.GetRole(r.Context()),
 		RequestID: middleware.GetReqID(r.Context()),
 		IP:        r.RemoteAddr,
 	})
 	if err != nil {
+		if middleware.RecordDataScopeViolation(r, err) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
 		if strings.Contains(err.Error(), "locked") {
 			http.Error(w, err.Error(), http.StatusConflict)
 			return
@@ -313,8 +327,12 @@ func (h *Handler) Publish(w http.ResponseWriter, r *http.Request) {
 
 func (h *Handler) GetResultsForStudent(w http.ResponseWriter, r *http.Request) {
 	studentID := chi.URLParam(r, "id")
-	results, err := h.svc.GetExamResultsForStudent(r.Context(), middleware.GetTenantID(r.Context()), studentID)
+	results, err := h.svc.GetExamResultsForStudent(r.Context(), middleware.GetTenantID(r.Context()), studentID, middleware.DataScopeActor(r.Context()))
 	if err != nil {
+		if middleware.RecordDataScopeViolation(r, err) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
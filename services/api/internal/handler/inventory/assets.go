@@ -0,0 +1,353 @@
+package inventory
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/schoolerp/api/internal/middleware"
+	"github.com/schoolerp/api/internal/service/inventory"
+)
+
+func (h *Handler) registerAssetRoutes(r chi.Router) {
+	r.Put("/inventory/items/{id}/asset-profile", h.SetItemAssetProfile)
+
+	// Register and custody
+	r.Get("/inventory/assets", h.ListAssets)
+	r.Post("/inventory/assets", h.RegisterAssets)
+	r.Get("/inventory/assets/{id}", h.GetAsset)
+	r.Post("/inventory/assets/{id}/move", h.MoveAsset)
+	r.Post("/inventory/assets/{id}/contracts", h.AddAssetContract)
+	r.Post("/inventory/assets/{id}/dispose", h.RequestAssetDisposal)
+	r.Get("/inventory/asset-contracts/expiring", h.ExpiringAssetContracts)
+
+	// Depreciation
+	r.Get("/inventory/asset-depreciation", h.DepreciationRegister)
+	r.Post("/inventory/asset-depreciation/run", h.PostDepreciation)
+
+	// Disposals
+	r.Get("/inventory/asset-disposals", h.ListAssetDisposals)
+	r.Post("/inventory/asset-disposals/{id}/approve", h.ApproveAssetDisposal)
+	r.Post("/inventory/asset-disposals/{id}/reject", h.RejectAssetDisposal)
+
+	// Physical verification
+	r.Get("/inventory/asset-verifications", h.ListAssetVerifications)
+	r.Post("/inventory/asset-verifications", h.StartAssetVerification)
+	r.Get("/inventory/asset-verifications/{id}", h.GetAssetVerification)
+	r.Put("/inventory/asset-verifications/{id}/results", h.RecordAssetVerification)
+	r.Post("/inventory/asset-verifications/{id}/close", h.CloseAssetVerification)
+}
+
+func (h *Handler) SetItemAssetProfile(w http.ResponseWriter, r *http.Request) {
+	var req inventory.AssetProfile
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	profile, err := h.assets.SetItemProfile(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"), req, stockActor(r))
+	if err != nil {
+		writeStockError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, profile)
+}
+
+// Register and custody
+
+type registerAssetsReq struct {
+	ItemID              string   `json:"item_id"`
+	Name                string   `json:"name"`
+	AssetTag            string   `json:"asset_tag"`
+	SerialNumbers       []string `json:"serial_numbers"`
+	Quantity            int32    `json:"quantity"`
+	Description         string   `json:"description"`
+	Room                string   `json:"room"`
+	CustodianID         string   `json:"custodian_id"`
+	SupplierID          string   `json:"supplier_id"`
+	POID                string   `json:"po_id"`
+	PurchaseDate        string   `json:"purchase_date"`
+	InServiceDate       string   `json:"in_service_date"`
+	Cost                float64  `json:"cost"`
+	ResidualValue       *float64 `json:"residual_value"`
+	DepreciationMethod  string   `json:"depreciation_method"`
+	UsefulLifeMonths    int32    `json:"useful_life_months"`
+	DepreciationRatePct float64  `json:"depreciation_rate_pct"`
+	Status              string   `json:"status"`
+}
+
+func (h *Handler) RegisterAssets(w http.ResponseWriter, r *http.Request) {
+	var req registerAssetsReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	assets, err := h.assets.RegisterAssets(r.Context(), middleware.GetTenantID(r.Context()), inventory.AssetInput{
+		ItemID:              req.ItemID,
+		Name:                req.Name,
+		AssetTag:            req.AssetTag,
+		SerialNumbers:       req.SerialNumbers,
+		Quantity:            req.Quantity,
+		Description:         req.Description,
+		Room:                req.Room,
+		CustodianID:         req.CustodianID,
+		SupplierID:          req.SupplierID,
+		POID:                req.POID,
+		PurchaseDate:        req.PurchaseDate,
+		InServiceDate:       req.InServiceDate,
+		Cost:                req.Cost,
+		ResidualValue:       req.ResidualValue,
+		DepreciationMethod:  req.DepreciationMethod,
+		UsefulLifeMonths:    req.UsefulLifeMonths,
+		DepreciationRatePct: req.DepreciationRatePct,
+		Status:              req.Status,
+	}, stockActor(r))
+	if err != nil {
+		writeStockError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusCreated, assets)
+}
+
+func (h *Handler) ListAssets(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	offset, _ := strconv.Atoi(q.Get("offset"))
+	assets, err := h.assets.ListAssets(r.Context(), middleware.GetTenantID(r.Context()), inventory.AssetFilter{
+		ItemID:      q.Get("item_id"),
+		CustodianID: q.Get("custodian_id"),
+		Status:      q.Get("status"),
+		Room:        q.Get("room"),
+		Search:      q.Get("q"),
+		Limit:       int32(limit),
+		Offset:      int32(offset),
+	})
+	if err != nil {
+		writeStockError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, assets)
+}
+
+func (h *Handler) GetAsset(w http.ResponseWriter, r *http.Request) {
+	asset, err := h.assets.GetAsset(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"))
+	if err != nil {
+		writeStockError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, asset)
+}
+
+func (h *Handler) MoveAsset(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Room        *string `json:"room"`
+		CustodianID *string `json:"custodian_id"`
+		Status      string  `json:"status"`
+		Reason      string  `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	asset, err := h.assets.MoveAsset(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"), inventory.MoveInput{
+		Room: req.Room, CustodianID: req.CustodianID, Status: req.Status, Reason: req.Reason,
+	}, stockActor(r))
+	if err != nil {
+		writeStockError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, asset)
+}
+
+func (h *Handler) AddAssetContract(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Kind      string  `json:"kind"`
+		Provider  string  `json:"provider"`
+		Reference string  `json:"reference"`
+		StartsOn  string  `json:"starts_on"`
+		EndsOn    string  `json:"ends_on"`
+		Cost      float64 `json:"cost"`
+		Coverage  string  `json:"coverage"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	contract, err := h.assets.AddContract(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"), inventory.ContractInput{
+		Kind: req.Kind, Provider: req.Provider, Reference: req.Reference,
+		StartsOn: req.StartsOn, EndsOn: req.EndsOn, Cost: req.Cost, Coverage: req.Coverage,
+	}, stockActor(r))
+	if err != nil {
+		writeStockError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusCreated, contract)
+}
+
+func (h *Handler) ExpiringAssetContracts(w http.ResponseWriter, r *http.Request) {
+	days, _ := strconv.Atoi(r.URL.Query().Get("days"))
+	contracts, err := h.assets.ExpiringContracts(r.Context(), middleware.GetTenantID(r.Context()), days)
+	if err != nil {
+		writeStockError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, contracts)
+}
+
+// Depreciation
+
+func (h *Handler) DepreciationRegister(w http.ResponseWriter, r *http.Request) {
+	register, err := h.assets.DepreciationRegister(r.Context(), middleware.GetTenantID(r.Context()), r.URL.Query().Get("financial_year"))
+	if err != nil {
+		writeStockError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, register)
+}
+
+func (h *Handler) PostDepreciation(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		FinancialYear string `json:"financial_year"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	run, err := h.assets.PostDepreciation(r.Context(), middleware.GetTenantID(r.Context()), req.FinancialYear, stockActor(r))
+	if err != nil {
+		writeStockError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, run)
+}
+
+// Disposals
+
+func (h *Handler) RequestAssetDisposal(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Method       string  `json:"method"`
+		DisposalDate string  `json:"disposal_date"`
+		Proceeds     float64 `json:"proceeds"`
+		Reason       string  `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	disposal, err := h.assets.RequestDisposal(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"), inventory.DisposalInput{
+		Method: req.Method, DisposalDate: req.DisposalDate, Proceeds: req.Proceeds, Reason: req.Reason,
+	}, stockActor(r))
+	if err != nil {
+		writeStockError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusCreated, disposal)
+}
+
+func (h *Handler) ListAssetDisposals(w http.ResponseWriter, r *http.Request) {
+	disposals, err := h.assets.ListDisposals(r.Context(), middleware.GetTenantID(r.Context()), r.URL.Query().Get("status"))
+	if err != nil {
+		writeStockError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, disposals)
+}
+
+func (h *Handler) ApproveAssetDisposal(w http.ResponseWriter, r *http.Request) {
+	h.decideAssetDisposal(w, r, true)
+}
+
+func (h *Handler) RejectAssetDisposal(w http.ResponseWriter, r *http.Request) {
+	h.decideAssetDisposal(w, r, false)
+}
+
+func (h *Handler) decideAssetDisposal(w http.ResponseWriter, r *http.Request, approve bool) {
+	var req struct {
+		Remark string `json:"remark"`
+	}
+	if err := decodeOptional(r, &req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	disposal, err := h.assets.DecideDisposal(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"), approve, req.Remark, stockActor(r))
+	if err != nil {
+		writeStockError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, disposal)
+}
+
+// Physical verification
+
+func (h *Handler) ListAssetVerifications(w http.ResponseWriter, r *http.Request) {
+	rounds, err := h.assets.ListVerifications(r.Context(), middleware.GetTenantID(r.Context()))
+	if err != nil {
+		writeStockError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, rounds)
+}
+
+func (h *Handler) StartAssetVerification(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		FinancialYear string `json:"financial_year"`
+		Title         string `json:"title"`
+		Notes         string `json:"notes"`
+	}
+	if err := decodeOptional(r, &req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	round, err := h.assets.StartVerification(r.Context(), middleware.GetTenantID(r.Context()), req.FinancialYear, req.Title, req.Notes, stockActor(r))
+	if err != nil {
+		writeStockError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusCreated, round)
+}
+
+func (h *Handler) GetAssetVerification(w http.ResponseWriter, r *http.Request) {
+	round, err := h.assets.GetVerification(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"))
+	if err != nil {
+		writeStockError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, round)
+}
+
+func (h *Handler) RecordAssetVerification(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Items []struct {
+			AssetID   string `json:"asset_id"`
+			AssetTag  string `json:"asset_tag"`
+			Result    string `json:"result"`
+			FoundRoom string `json:"found_room"`
+			Remarks   string `json:"remarks"`
+		} `json:"items"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	lines := make([]inventory.VerificationLine, 0, len(req.Items))
+	for _, it := range req.Items {
+		lines = append(lines, inventory.VerificationLine{
+			AssetID: it.AssetID, AssetTag: it.AssetTag, Result: it.Result, FoundRoom: it.FoundRoom, Remarks: it.Remarks,
+		})
+	}
+	round, err := h.assets.RecordVerification(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"), lines, stockActor(r))
+	if err != nil {
+		writeStockError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, round)
+}
+
+func (h *Handler) CloseAssetVerification(w http.ResponseWriter, r *http.Request) {
+	round, err := h.assets.CloseVerification(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"), stockActor(r))
+	if err != nil {
+		writeStockError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, round)
+}
@@ -2,6 +2,7 @@ package inventory
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 	"strings"
@@ -12,11 +13,14 @@ import (
 )
 
 type Handler struct {
-	svc *inventory.InventoryService
+	svc         *inventory.InventoryService
+	stock       *inventory.StockService
+	procurement *inventory.ProcurementService
+	assets      *inventory.AssetService
 }
 
-func NewHandler(svc *inventory.InventoryService) *Handler {
-	return &Handler{svc: svc}
+func NewHandler(svc *inventory.InventoryService, stock *inventory.StockService, procurement *inventory.ProcurementService, assets *inventory.AssetService) *Handler {
+	return &Handler{svc: svc, stock: stock, procurement: procurement, assets: assets}
 }
 
 func (h *Handler) RegisterRoutes(r chi.Router) {
@@ -42,12 +46,15 @@ func (h *Handler) RegisterRoutes(r chi.Router) {
 	r.Post("/inventory/purchase-orders", h.CreatePurchaseOrder)
 	r.Get("/inventory/purchase-orders", h.ListPurchaseOrders)
 	r.Post("/inventory/purchase-orders/{id}/approve", h.ApprovePurchaseOrder)
-	r.Post("/inventory/purchase-orders/{id}/receive", h.ReceivePurchaseOrder)
 
 	// Requisitions
 	r.Post("/inventory/requisitions", h.CreateRequisition)
 	r.Get("/inventory/requisitions", h.ListRequisitions)
 	r.Put("/inventory/requisitions/{id}/status", h.UpdateRequisitionStatus)
+
+	h.registerStockRoutes(r)
+	h.registerProcurementRoutes(r)
+	h.registerAssetRoutes(r)
 }
 
 // Category Handlers
@@ -192,6 +199,9 @@ type createItemReq struct {
 	Unit         string `json:"unit"`
 	ReorderLevel int32  `json:"reorder_level"`
 	Description  string `json:"description"`
+	// Asset sets the depreciation defaults for an item in an asset
+	// category; left out, the standard profile is used.
+	Asset *inventory.AssetProfile `json:"asset"`
 }
 
 func (h *Handler) CreateItem(w http.ResponseWriter, r *http.Request) {
@@ -212,11 +222,15 @@ func (h *Handler) CreateItem(w http.ResponseWriter, r *http.Request) {
 
 	item, err := h.svc.CreateItem(ctx,
 		middleware.GetTenantID(ctx),
-		req.CategoryID, req.Name, req.Sku, req.Unit, req.Description, req.ReorderLevel,
+		req.CategoryID, req.Name, req.Sku, req.Unit, req.Description, req.ReorderLevel, req.Asset,
 		middleware.GetUserID(ctx), middleware.GetReqID(ctx), r.RemoteAddr,
 	)
 
 	if err != nil {
+		if errors.Is(err, inventory.ErrInvalidAsset) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -285,6 +299,7 @@ type createTxnReq struct {
 	Quantity      int32   `json:"quantity"`
 	UnitPrice     float64 `json:"unit_price"`
 	SupplierID    string  `json:"supplier_id"`
+	StoreID       string  `json:"store_id"`
 	Location      string  `json:"location"`
 	ReferenceType string  `json:"reference_type"`
 	Remarks       string  `json:"remarks"`
@@ -317,6 +332,7 @@ func (h *Handler) CreateTransaction(w http.ResponseWriter, r *http.Request) {
 		Quantity:      req.Quantity,
 		UnitPrice:     req.UnitPrice,
 		SupplierID:    req.SupplierID,
+		StoreID:       req.StoreID,
 		Location:      req.Location,
 		ReferenceType: req.ReferenceType,
 		Remarks:       req.Remarks,
@@ -326,7 +342,7 @@ func (h *Handler) CreateTransaction(w http.ResponseWriter, r *http.Request) {
 	})
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeStockError(w, err)
 		return
 	}
 	respondJSON(w, http.StatusCreated, txn)
@@ -350,9 +366,16 @@ func (h *Handler) ListTransactions(w http.ResponseWriter, r *http.Request) {
 // Purchase Order Handlers
 
 type createPOReq struct {
-	PONumber   string `json:"po_number"`
-	SupplierID string `json:"supplier_id"`
-	Notes      string `json:"notes"`
+	PONumber     string `json:"po_number"`
+	SupplierID   string `json:"supplier_id"`
+	StoreID      string `json:"store_id"`
+	ExpectedDate string `json:"expected_date"`
+	Notes        string `json:"notes"`
+	Items        []struct {
+		ItemID    string  `json:"item_id"`
+		Quantity  int32   `json:"quantity"`
+		UnitPrice float64 `json:"unit_price"`
+	} `json:"items"`
 }
 
 func (h *Handler) CreatePurchaseOrder(w http.ResponseWriter, r *http.Request) {
@@ -363,17 +386,25 @@ func (h *Handler) CreatePurchaseOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	items := make([]inventory.PurchaseOrderItemParams, 0, len(req.Items))
+	for _, it := range req.Items {
+		items = append(items, inventory.PurchaseOrderItemParams{ItemID: it.ItemID, Quantity: it.Quantity, UnitPrice: it.UnitPrice})
+	}
+
 	po, err := h.svc.CreatePurchaseOrder(ctx, inventory.CreatePurchaseOrderParams{
-		TenantID:   middleware.GetTenantID(ctx),
-		PONumber:   req.PONumber,
-		SupplierID: req.SupplierID,
-		Notes:      req.Notes,
-		UserID:     middleware.GetUserID(ctx),
-		RequestID:  middleware.GetReqID(ctx),
-		IP:         r.RemoteAddr,
+		TenantID:     middleware.GetTenantID(ctx),
+		PONumber:     req.PONumber,
+		SupplierID:   req.SupplierID,
+		StoreID:      req.StoreID,
+		ExpectedDate: req.ExpectedDate,
+		Notes:        req.Notes,
+		Items:        items,
+		UserID:       middleware.GetUserID(ctx),
+		RequestID:    middleware.GetReqID(ctx),
+		IP:           r.RemoteAddr,
 	})
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeStockError(w, err)
 		return
 	}
 	respondJSON(w, http.StatusCreated, po)
@@ -405,17 +436,6 @@ func (h *Handler) ApprovePurchaseOrder(w http.ResponseWriter, r *http.Request) {
 	respondJSON(w, http.StatusOK, po)
 }
 
-func (h *Handler) ReceivePurchaseOrder(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
-	poID := chi.URLParam(r, "id")
-	po, err := h.svc.ReceivePurchaseOrder(ctx, middleware.GetTenantID(ctx), poID, middleware.GetUserID(ctx), middleware.GetReqID(ctx), r.RemoteAddr)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-	respondJSON(w, http.StatusOK, po)
-}
-
 func (h *Handler) CreateRequisition(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	var req struct {
@@ -0,0 +1,275 @@
+package inventory
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/schoolerp/api/internal/middleware"
+	"github.com/schoolerp/api/internal/service/inventory"
+)
+
+func (h *Handler) registerProcurementRoutes(r chi.Router) {
+	// Reorder levels
+	r.Get("/inventory/procurement/settings", h.GetProcurementSettings)
+	r.Put("/inventory/procurement/settings", h.SaveProcurementSettings)
+	r.Put("/inventory/items/{id}/reorder", h.SetReorderRule)
+	r.Get("/inventory/reorder/suggestions", h.ReorderSuggestions)
+	r.Post("/inventory/reorder/run", h.RunReorder)
+
+	// Receiving against purchase orders
+	r.Get("/inventory/purchase-orders/{id}", h.GetPurchaseOrder)
+	r.Post("/inventory/purchase-orders/{id}/receive", h.ReceiveGoods)
+	r.Post("/inventory/purchase-orders/{id}/close", h.ClosePurchaseOrder)
+
+	// Supplier invoices
+	r.Get("/inventory/supplier-invoices", h.ListSupplierInvoices)
+	r.Post("/inventory/supplier-invoices", h.RecordSupplierInvoice)
+	r.Get("/inventory/supplier-invoices/{id}", h.GetSupplierInvoice)
+	r.Post("/inventory/supplier-invoices/{id}/approve", h.ApproveSupplierInvoice)
+	r.Post("/inventory/supplier-invoices/{id}/reject", h.RejectSupplierInvoice)
+
+	r.Get("/inventory/suppliers/performance", h.SupplierPerformance)
+}
+
+// decodeOptional decodes a request body that may be left empty.
+func decodeOptional(r *http.Request, v any) error {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+// Reorder levels
+
+func (h *Handler) GetProcurementSettings(w http.ResponseWriter, r *http.Request) {
+	settings, err := h.procurement.GetSettings(r.Context(), middleware.GetTenantID(r.Context()))
+	if err != nil {
+		writeStockError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, settings)
+}
+
+func (h *Handler) SaveProcurementSettings(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		AutoReorder          bool    `json:"auto_reorder"`
+		QuantityTolerancePct float64 `json:"quantity_tolerance_pct"`
+		PriceTolerancePct    float64 `json:"price_tolerance_pct"`
+		AmountTolerance      float64 `json:"amount_tolerance"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	settings, err := h.procurement.SaveSettings(r.Context(), middleware.GetTenantID(r.Context()), inventory.SettingsInput{
+		AutoReorder:          req.AutoReorder,
+		QuantityTolerancePct: req.QuantityTolerancePct,
+		PriceTolerancePct:    req.PriceTolerancePct,
+		AmountTolerance:      req.AmountTolerance,
+	}, stockActor(r))
+	if err != nil {
+		writeStockError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, settings)
+}
+
+func (h *Handler) SetReorderRule(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ReorderLevel        int32  `json:"reorder_level"`
+		ReorderQuantity     int32  `json:"reorder_quantity"`
+		PreferredSupplierID string `json:"preferred_supplier_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	err := h.procurement.SetReorderRule(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"), inventory.ReorderRule{
+		Level:               req.ReorderLevel,
+		Quantity:            req.ReorderQuantity,
+		PreferredSupplierID: req.PreferredSupplierID,
+	}, stockActor(r))
+	if err != nil {
+		writeStockError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, req)
+}
+
+func (h *Handler) ReorderSuggestions(w http.ResponseWriter, r *http.Request) {
+	suggestions, err := h.procurement.ReorderSuggestions(r.Context(), middleware.GetTenantID(r.Context()))
+	if err != nil {
+		writeStockError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, suggestions)
+}
+
+func (h *Handler) RunReorder(w http.ResponseWriter, r *http.Request) {
+	run, err := h.procurement.DraftReorders(r.Context(), middleware.GetTenantID(r.Context()), stockActor(r))
+	if err != nil {
+		writeStockError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, run)
+}
+
+// Receiving against purchase orders
+
+func (h *Handler) GetPurchaseOrder(w http.ResponseWriter, r *http.Request) {
+	po, err := h.procurement.GetPurchaseOrder(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"))
+	if err != nil {
+		writeStockError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, po)
+}
+
+type receiveGoodsReq struct {
+	StoreID string `json:"store_id"`
+	Notes   string `json:"notes"`
+	Items   []struct {
+		POItemID          string `json:"po_item_id"`
+		DeliveredQuantity int32  `json:"delivered_quantity"`
+		RejectedQuantity  int32  `json:"rejected_quantity"`
+		RejectionReason   string `json:"rejection_reason"`
+	} `json:"items"`
+}
+
+func (h *Handler) ReceiveGoods(w http.ResponseWriter, r *http.Request) {
+	var req receiveGoodsReq
+	if err := decodeOptional(r, &req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	in := inventory.GoodsReceiptInput{StoreID: req.StoreID, Notes: req.Notes}
+	for _, it := range req.Items {
+		in.Lines = append(in.Lines, inventory.GoodsReceiptLineInput{
+			POItemID:          it.POItemID,
+			DeliveredQuantity: it.DeliveredQuantity,
+			RejectedQuantity:  it.RejectedQuantity,
+			RejectionReason:   it.RejectionReason,
+		})
+	}
+	po, err := h.procurement.ReceiveGoods(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"), in, stockActor(r))
+	if err != nil {
+		writeStockError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, po)
+}
+
+func (h *Handler) ClosePurchaseOrder(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if err := decodeOptional(r, &req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	po, err := h.procurement.ClosePurchaseOrder(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"), req.Reason, stockActor(r))
+	if err != nil {
+		writeStockError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, po)
+}
+
+// Supplier invoices
+
+type supplierInvoiceReq struct {
+	POID          string  `json:"po_id"`
+	InvoiceNumber string  `json:"invoice_number"`
+	InvoiceDate   string  `json:"invoice_date"`
+	TaxAmount     float64 `json:"tax_amount"`
+	TotalAmount   float64 `json:"total_amount"`
+	Notes         string  `json:"notes"`
+	Items         []struct {
+		POItemID  string  `json:"po_item_id"`
+		Quantity  int32   `json:"quantity"`
+		UnitPrice float64 `json:"unit_price"`
+	} `json:"items"`
+}
+
+func (h *Handler) RecordSupplierInvoice(w http.ResponseWriter, r *http.Request) {
+	var req supplierInvoiceReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	in := inventory.InvoiceInput{
+		POID: req.POID, InvoiceNumber: req.InvoiceNumber, InvoiceDate: req.InvoiceDate,
+		TaxAmount: req.TaxAmount, TotalAmount: req.TotalAmount, Notes: req.Notes,
+	}
+	for _, it := range req.Items {
+		in.Lines = append(in.Lines, inventory.InvoiceLineInput{POItemID: it.POItemID, Quantity: it.Quantity, UnitPrice: it.UnitPrice})
+	}
+	inv, err := h.procurement.RecordInvoice(r.Context(), middleware.GetTenantID(r.Context()), in, stockActor(r))
+	if err != nil {
+		writeStockError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusCreated, inv)
+}
+
+func (h *Handler) ListSupplierInvoices(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	invoices, err := h.procurement.ListInvoices(r.Context(), middleware.GetTenantID(r.Context()), inventory.InvoiceFilter{
+		SupplierID: q.Get("supplier_id"),
+		POID:       q.Get("po_id"),
+		Status:     q.Get("status"),
+	})
+	if err != nil {
+		writeStockError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, invoices)
+}
+
+func (h *Handler) GetSupplierInvoice(w http.ResponseWriter, r *http.Request) {
+	inv, err := h.procurement.GetInvoice(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"))
+	if err != nil {
+		writeStockError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, inv)
+}
+
+func (h *Handler) ApproveSupplierInvoice(w http.ResponseWriter, r *http.Request) {
+	h.decideSupplierInvoice(w, r, h.procurement.ApproveInvoice)
+}
+
+func (h *Handler) RejectSupplierInvoice(w http.ResponseWriter, r *http.Request) {
+	h.decideSupplierInvoice(w, r, h.procurement.RejectInvoice)
+}
+
+func (h *Handler) decideSupplierInvoice(w http.ResponseWriter, r *http.Request,
+	decide func(ctx context.Context, tenantID, invoiceID, reason string, actor inventory.Actor) (inventory.Invoice, error)) {
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if err := decodeOptional(r, &req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	inv, err := decide(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"), req.Reason, stockActor(r))
+	if err != nil {
+		writeStockError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, inv)
+}
+
+func (h *Handler) SupplierPerformance(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	metrics, err := h.procurement.SupplierPerformance(r.Context(), middleware.GetTenantID(r.Context()), q.Get("from"), q.Get("to"))
+	if err != nil {
+		writeStockError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, metrics)
+}
@@ -0,0 +1,331 @@
+package inventory
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+	"github.com/schoolerp/api/internal/middleware"
+	"github.com/schoolerp/api/internal/service/inventory"
+)
+
+func (h *Handler) registerStockRoutes(r chi.Router) {
+	// Stores
+	r.Get("/inventory/stores", h.ListStores)
+	r.Post("/inventory/stores", h.CreateStore)
+	r.Put("/inventory/stores/{id}", h.UpdateStore)
+	r.Put("/inventory/items/{id}/valuation", h.SetValuationMethod)
+
+	// Stock on hand and valuation
+	r.Get("/inventory/stock", h.StockReport)
+
+	// Transfers
+	r.Get("/inventory/transfers", h.ListTransfers)
+	r.Post("/inventory/transfers", h.CreateTransfer)
+	r.Get("/inventory/transfers/{id}", h.GetTransfer)
+	r.Post("/inventory/transfers/{id}/dispatch", h.DispatchTransfer)
+	r.Post("/inventory/transfers/{id}/receive", h.ReceiveTransfer)
+	r.Post("/inventory/transfers/{id}/cancel", h.CancelTransfer)
+
+	// Stock-takes
+	r.Get("/inventory/stock-takes", h.ListStockTakes)
+	r.Post("/inventory/stock-takes", h.StartStockTake)
+	r.Get("/inventory/stock-takes/{id}", h.GetStockTake)
+	r.Put("/inventory/stock-takes/{id}/counts", h.RecordCounts)
+	r.Post("/inventory/stock-takes/{id}/post", h.PostStockTake)
+	r.Post("/inventory/stock-takes/{id}/cancel", h.CancelStockTake)
+}
+
+func stockActor(r *http.Request) inventory.Actor {
+	ctx := r.Context()
+	return inventory.Actor{UserID: middleware.GetUserID(ctx), RequestID: middleware.GetReqID(ctx), IP: r.RemoteAddr}
+}
+
+func writeStockError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, inventory.ErrInvalidStock), errors.Is(err, inventory.ErrInvalidAsset):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, inventory.ErrStoreNotFound), errors.Is(err, inventory.ErrItemNotFound),
+		errors.Is(err, inventory.ErrTransferNotFound), errors.Is(err, inventory.ErrStockTakeNotFound),
+		errors.Is(err, inventory.ErrPurchaseOrderNotFound), errors.Is(err, inventory.ErrInvoiceNotFound),
+		errors.Is(err, inventory.ErrAssetNotFound), errors.Is(err, inventory.ErrDisposalNotFound),
+		errors.Is(err, inventory.ErrVerificationNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, inventory.ErrInsufficientStock), errors.Is(err, inventory.ErrValuationLocked),
+		errors.Is(err, inventory.ErrTransferState), errors.Is(err, inventory.ErrStockTakeState),
+		errors.Is(err, inventory.ErrPurchaseOrderState), errors.Is(err, inventory.ErrInvoiceState),
+		errors.Is(err, inventory.ErrDuplicateInvoice), errors.Is(err, inventory.ErrAssetState),
+		errors.Is(err, inventory.ErrDuplicateAssetTag), errors.Is(err, inventory.ErrDisposalState),
+		errors.Is(err, inventory.ErrVerificationState):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case strings.Contains(strings.ToLower(err.Error()), "not found"):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		log.Error().Err(err).Msg("inventory stock request failed")
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+	}
+}
+
+// Stores
+
+type storeReq struct {
+	Name        string `json:"name"`
+	Code        string `json:"code"`
+	Campus      string `json:"campus"`
+	Description string `json:"description"`
+	InChargeID  string `json:"in_charge_id"`
+	IsDefault   bool   `json:"is_default"`
+	Active      *bool  `json:"active"`
+}
+
+func (req storeReq) input() inventory.StoreInput {
+	active := req.Active == nil || *req.Active
+	return inventory.StoreInput{
+		Name: req.Name, Code: req.Code, Campus: req.Campus, Description: req.Description,
+		InChargeID: req.InChargeID, IsDefault: req.IsDefault, Active: active,
+	}
+}
+
+func (h *Handler) ListStores(w http.ResponseWriter, r *http.Request) {
+	stores, err := h.stock.ListStores(r.Context(), middleware.GetTenantID(r.Context()))
+	if err != nil {
+		writeStockError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, stores)
+}
+
+func (h *Handler) CreateStore(w http.ResponseWriter, r *http.Request) {
+	h.saveStore(w, r, "", http.StatusCreated)
+}
+
+func (h *Handler) UpdateStore(w http.ResponseWriter, r *http.Request) {
+	h.saveStore(w, r, chi.URLParam(r, "id"), http.StatusOK)
+}
+
+func (h *Handler) saveStore(w http.ResponseWriter, r *http.Request, storeID string, status int) {
+	var req storeReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	store, err := h.stock.SaveStore(r.Context(), middleware.GetTenantID(r.Context()), storeID, req.input(), stockActor(r))
+	if err != nil {
+		writeStockError(w, err)
+		return
+	}
+	respondJSON(w, status, store)
+}
+
+func (h *Handler) SetValuationMethod(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Method string `json:"method"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	err := h.stock.SetValuationMethod(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"), req.Method, stockActor(r))
+	if err != nil {
+		writeStockError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]string{"valuation_method": req.Method})
+}
+
+func (h *Handler) StockReport(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	report, err := h.stock.StockReport(r.Context(), middleware.GetTenantID(r.Context()), inventory.StockFilter{
+		StoreID: q.Get("store_id"),
+		ItemID:  q.Get("item_id"),
+		AsOf:    q.Get("as_of"),
+	})
+	if err != nil {
+		writeStockError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, report)
+}
+
+// Transfers
+
+type transferReq struct {
+	FromStoreID string `json:"from_store_id"`
+	ToStoreID   string `json:"to_store_id"`
+	Notes       string `json:"notes"`
+	Items       []struct {
+		ItemID   string `json:"item_id"`
+		Quantity int32  `json:"quantity"`
+	} `json:"items"`
+}
+
+type receiveReq struct {
+	Items []struct {
+		ItemID           string `json:"item_id"`
+		ReceivedQuantity int32  `json:"received_quantity"`
+		Remarks          string `json:"remarks"`
+	} `json:"items"`
+}
+
+func (h *Handler) ListTransfers(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	transfers, err := h.stock.ListTransfers(r.Context(), middleware.GetTenantID(r.Context()), q.Get("store_id"), q.Get("status"))
+	if err != nil {
+		writeStockError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, transfers)
+}
+
+func (h *Handler) CreateTransfer(w http.ResponseWriter, r *http.Request) {
+	var req transferReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	in := inventory.TransferInput{FromStoreID: req.FromStoreID, ToStoreID: req.ToStoreID, Notes: req.Notes}
+	for _, it := range req.Items {
+		in.Items = append(in.Items, inventory.TransferLineInput{ItemID: it.ItemID, Quantity: it.Quantity})
+	}
+	transfer, err := h.stock.CreateTransfer(r.Context(), middleware.GetTenantID(r.Context()), in, stockActor(r))
+	if err != nil {
+		writeStockError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusCreated, transfer)
+}
+
+func (h *Handler) GetTransfer(w http.ResponseWriter, r *http.Request) {
+	transfer, err := h.stock.GetTransfer(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"))
+	if err != nil {
+		writeStockError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, transfer)
+}
+
+func (h *Handler) DispatchTransfer(w http.ResponseWriter, r *http.Request) {
+	transfer, err := h.stock.DispatchTransfer(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"), stockActor(r))
+	if err != nil {
+		writeStockError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, transfer)
+}
+
+func (h *Handler) ReceiveTransfer(w http.ResponseWriter, r *http.Request) {
+	var req receiveReq
+	// The body is optional: without it everything arrived.
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+	var in inventory.ReceiveInput
+	for _, it := range req.Items {
+		in.Lines = append(in.Lines, inventory.ReceiptLineInput{ItemID: it.ItemID, ReceivedQuantity: it.ReceivedQuantity, Remarks: it.Remarks})
+	}
+	transfer, err := h.stock.ReceiveTransfer(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"), in, stockActor(r))
+	if err != nil {
+		writeStockError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, transfer)
+}
+
+func (h *Handler) CancelTransfer(w http.ResponseWriter, r *http.Request) {
+	if err := h.stock.CancelTransfer(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"), stockActor(r)); err != nil {
+		writeStockError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Stock-takes
+
+type stockTakeReq struct {
+	StoreID string   `json:"store_id"`
+	ItemIDs []string `json:"item_ids"`
+	Notes   string   `json:"notes"`
+}
+
+type countsReq struct {
+	Counts []struct {
+		ItemID          string `json:"item_id"`
+		CountedQuantity int32  `json:"counted_quantity"`
+		Reason          string `json:"reason"`
+	} `json:"counts"`
+}
+
+func (h *Handler) ListStockTakes(w http.ResponseWriter, r *http.Request) {
+	takes, err := h.stock.ListStockTakes(r.Context(), middleware.GetTenantID(r.Context()), r.URL.Query().Get("store_id"))
+	if err != nil {
+		writeStockError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, takes)
+}
+
+func (h *Handler) StartStockTake(w http.ResponseWriter, r *http.Request) {
+	var req stockTakeReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	take, err := h.stock.StartStockTake(r.Context(), middleware.GetTenantID(r.Context()), inventory.StockTakeInput{
+		StoreID: req.StoreID, ItemIDs: req.ItemIDs, Notes: req.Notes,
+	}, stockActor(r))
+	if err != nil {
+		writeStockError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusCreated, take)
+}
+
+func (h *Handler) GetStockTake(w http.ResponseWriter, r *http.Request) {
+	take, err := h.stock.GetStockTake(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"))
+	if err != nil {
+		writeStockError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, take)
+}
+
+func (h *Handler) RecordCounts(w http.ResponseWriter, r *http.Request) {
+	var req countsReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	var counts []inventory.CountInput
+	for _, c := range req.Counts {
+		counts = append(counts, inventory.CountInput{ItemID: c.ItemID, CountedQuantity: c.CountedQuantity, Reason: c.Reason})
+	}
+	take, err := h.stock.RecordCounts(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"), counts, stockActor(r))
+	if err != nil {
+		writeStockError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, take)
+}
+
+func (h *Handler) PostStockTake(w http.ResponseWriter, r *http.Request) {
+	take, err := h.stock.PostStockTake(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"), stockActor(r))
+	if err != nil {
+		writeStockError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, take)
+}
+
+func (h *Handler) CancelStockTake(w http.ResponseWriter, r *http.Request) {
+	if err := h.stock.CancelStockTake(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"), stockActor(r)); err != nil {
+		writeStockError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -3,6 +3,7 @@ package kb
 import (
 	"encoding/json"
 	"errors"
+	"io"
 	"net/http"
 	"strconv"
 	"strings"
@@ -23,12 +24,16 @@ func NewHandler(svc *kbservice.Service) *Handler {
 func (h *Handler) RegisterAdminRoutes(r chi.Router) {
 	r.Route("/kb", func(r chi.Router) {
 		r.Post("/documents", h.CreateDocument)
+		r.Post("/documents/upload", h.UploadDocument)
 		r.Get("/documents", h.ListDocuments)
 		r.Get("/documents/{id}", h.GetDocument)
 		r.Patch("/documents/{id}", h.UpdateDocument)
 		r.Delete("/documents/{id}", h.DeleteDocument)
+		r.Put("/documents/{id}/source", h.ReplaceDocumentSource)
 		r.Get("/settings", h.GetSettings)
 		r.Patch("/settings", h.UpdateSettings)
+		r.Get("/embeddings/status", h.GetEmbeddingStatus)
+		r.Post("/embeddings/reindex", h.ReindexEmbeddings)
 	})
 }
 
@@ -55,6 +60,88 @@ func (h *Handler) CreateDocument(w http.ResponseWriter, r *http.Request) {
 	_ = json.NewEncoder(w).Encode(doc)
 }
 
+func (h *Handler) UploadDocument(w http.ResponseWriter, r *http.Request) {
+	file, ok := readSourceFile(w, r)
+	if !ok {
+		return
+	}
+
+	var tags []string
+	for _, raw := range r.MultipartForm.Value["tags"] {
+		tags = append(tags, strings.Split(raw, ",")...)
+	}
+
+	result, err := h.svc.IngestDocument(r.Context(), middleware.GetTenantID(r.Context()), middleware.GetUserID(r.Context()), kbservice.DocumentUpsertRequest{
+		Title:      r.FormValue("title"),
+		Category:   r.FormValue("category"),
+		Tags:       tags,
+		Visibility: r.FormValue("visibility"),
+		Status:     r.FormValue("status"),
+	}, file)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(result)
+}
+
+func (h *Handler) ReplaceDocumentSource(w http.ResponseWriter, r *http.Request) {
+	file, ok := readSourceFile(w, r)
+	if !ok {
+		return
+	}
+
+	result, err := h.svc.ReplaceDocumentSource(
+		r.Context(),
+		middleware.GetTenantID(r.Context()),
+		chi.URLParam(r, "id"),
+		middleware.GetUserID(r.Context()),
+		file,
+	)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(result)
+}
+
+// readSourceFile reads the multipart "file" part of an ingestion request.
+func readSourceFile(w http.ResponseWriter, r *http.Request) (kbservice.SourceFile, bool) {
+	r.Body = http.MaxBytesReader(w, r.Body, kbservice.MaxSourceFileBytes+1<<20)
+	if err := r.ParseMultipartForm(kbservice.MaxSourceFileBytes); err != nil {
+		http.Error(w, "payload too large or invalid multipart form", http.StatusBadRequest)
+		return kbservice.SourceFile{}, false
+	}
+
+	f, header, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "file is required", http.StatusBadRequest)
+		return kbservice.SourceFile{}, false
+	}
+	defer f.Close()
+
+	content, err := io.ReadAll(io.LimitReader(f, kbservice.MaxSourceFileBytes+1))
+	if err != nil {
+		http.Error(w, "could not read uploaded file", http.StatusBadRequest)
+		return kbservice.SourceFile{}, false
+	}
+	if len(content) > kbservice.MaxSourceFileBytes {
+		http.Error(w, "file exceeds the 20 MB limit", http.StatusRequestEntityTooLarge)
+		return kbservice.SourceFile{}, false
+	}
+
+	return kbservice.SourceFile{
+		Name:     header.Filename,
+		MimeType: header.Header.Get("Content-Type"),
+		Content:  content,
+	}, true
+}
+
 func (h *Handler) ListDocuments(w http.ResponseWriter, r *http.Request) {
 	limit, _ := strconv.ParseInt(strings.TrimSpace(r.URL.Query().Get("limit")), 10, 32)
 	offset, _ := strconv.ParseInt(strings.TrimSpace(r.URL.Query().Get("offset")), 10, 32)
@@ -150,6 +237,27 @@ func (h *Handler) UpdateSettings(w http.ResponseWriter, r *http.Request) {
 	_ = json.NewEncoder(w).Encode(settings)
 }
 
+func (h *Handler) GetEmbeddingStatus(w http.ResponseWriter, r *http.Request) {
+	status, err := h.svc.EmbeddingStatus(r.Context(), middleware.GetTenantID(r.Context()))
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(status)
+}
+
+func (h *Handler) ReindexEmbeddings(w http.ResponseWriter, r *http.Request) {
+	status, err := h.svc.ReindexEmbeddings(r.Context(), middleware.GetTenantID(r.Context()), middleware.GetUserID(r.Context()))
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(status)
+}
+
 func (h *Handler) Search(w http.ResponseWriter, r *http.Request) {
 	var req kbservice.SearchRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -0,0 +1,94 @@
+package library
+
+import (
+	"bytes"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/schoolerp/api/internal/middleware"
+	"github.com/schoolerp/api/internal/service/library"
+)
+
+func (h *Handler) registerCatalogueRoutes(r chi.Router) {
+	r.Get("/library/isbn/{isbn}", h.LookupISBN)
+	r.Post("/library/catalogue/import", h.ImportCatalogue)
+	r.Get("/library/catalogue/export", h.ExportCatalogue)
+}
+
+func (h *Handler) LookupISBN(w http.ResponseWriter, r *http.Request) {
+	offline := r.URL.Query().Get("offline") == "true"
+	rec, err := h.cat.LookupISBN(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "isbn"), offline)
+	if err != nil {
+		writeCirculationError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, rec)
+}
+
+// catalogueFormat takes the format from the form, or else from the file's
+// extension.
+func catalogueFormat(format, filename string) string {
+	if format = strings.ToLower(strings.TrimSpace(format)); format != "" {
+		return format
+	}
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv":
+		return library.FormatCSV
+	case ".mrc", ".marc", ".iso", ".dat":
+		return library.FormatMARC
+	case ".xml":
+		return library.FormatMARCXML
+	}
+	return ""
+}
+
+func (h *Handler) ImportCatalogue(w http.ResponseWriter, r *http.Request) {
+	// Max 32MB
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		http.Error(w, "invalid multipart form", http.StatusBadRequest)
+		return
+	}
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "file is required", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	opts := library.ImportOptions{
+		Format:      catalogueFormat(r.FormValue("format"), header.Filename),
+		OnDuplicate: r.FormValue("on_duplicate"),
+		DryRun:      r.FormValue("dry_run") == "true",
+	}
+	report, err := h.cat.ImportCatalogue(r.Context(), middleware.GetTenantID(r.Context()), file, opts, deskActor(r))
+	if err != nil {
+		writeCirculationError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, report)
+}
+
+var catalogueExports = map[string]struct{ contentType, ext string }{
+	library.FormatCSV:     {"text/csv", "csv"},
+	library.FormatMARC:    {"application/marc", "mrc"},
+	library.FormatMARCXML: {"application/marcxml+xml", "xml"},
+}
+
+func (h *Handler) ExportCatalogue(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = library.FormatCSV
+	}
+	// Buffer the file so a failure part way still gets an error status.
+	var buf bytes.Buffer
+	if err := h.cat.ExportCatalogue(r.Context(), middleware.GetTenantID(r.Context()), format, &buf); err != nil {
+		writeCirculationError(w, err)
+		return
+	}
+	out := catalogueExports[format]
+	w.Header().Set("Content-Type", out.contentType)
+	w.Header().Set("Content-Disposition", "attachment;filename=library_catalogue."+out.ext)
+	w.Write(buf.Bytes())
+}
@@ -0,0 +1,288 @@
+package library
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+	"github.com/schoolerp/api/internal/middleware"
+	"github.com/schoolerp/api/internal/service/library"
+)
+
+func (h *Handler) registerCirculationRoutes(r chi.Router) {
+	r.Get("/library/settings", h.GetSettings)
+	r.Put("/library/settings", h.UpdateSettings)
+
+	// Copies
+	r.Get("/library/books/{book_id}/copies", h.ListCopies)
+	r.Post("/library/books/{book_id}/copies", h.AddCopies)
+	r.Get("/library/copies/lookup", h.LookupCopy)
+	r.Put("/library/copies/{id}", h.UpdateCopy)
+
+	// Borrowing policies
+	r.Get("/library/policies", h.ListPolicies)
+	r.Put("/library/policies", h.SavePolicy)
+	r.Delete("/library/policies/{id}", h.DeletePolicy)
+	r.Get("/library/members/status", h.MemberStatus)
+
+	// Renewals and reservations
+	r.Post("/library/issues/{id}/renew", h.RenewIssue)
+	r.Get("/library/reservations", h.ListReservations)
+	r.Post("/library/reservations", h.CreateReservation)
+	r.Post("/library/reservations/{id}/cancel", h.CancelReservation)
+
+	h.registerFineRoutes(r)
+}
+
+func deskActor(r *http.Request) library.Actor {
+	ctx := r.Context()
+	return library.Actor{UserID: middleware.GetUserID(ctx), RequestID: middleware.GetReqID(ctx), IP: r.RemoteAddr}
+}
+
+func memberFromQuery(r *http.Request) library.MemberRef {
+	q := r.URL.Query()
+	return library.MemberRef{StudentID: q.Get("student_id"), EmployeeID: q.Get("employee_id")}
+}
+
+func (h *Handler) GetSettings(w http.ResponseWriter, r *http.Request) {
+	settings, err := h.circ.GetSettings(r.Context(), middleware.GetTenantID(r.Context()))
+	if err != nil {
+		writeCirculationError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, settings)
+}
+
+func (h *Handler) UpdateSettings(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		AccessionPrefix string `json:"accession_prefix"`
+		HoldDays        int32  `json:"hold_days"`
+		FineFeeHeadID   string `json:"fine_fee_head_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	settings, err := h.circ.UpdateSettings(r.Context(), middleware.GetTenantID(r.Context()), req.AccessionPrefix, req.HoldDays, req.FineFeeHeadID, deskActor(r))
+	if err != nil {
+		writeCirculationError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, settings)
+}
+
+// Copies
+
+func (h *Handler) ListCopies(w http.ResponseWriter, r *http.Request) {
+	copies, err := h.circ.ListCopies(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "book_id"))
+	if err != nil {
+		writeCirculationError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, copies)
+}
+
+func (h *Handler) AddCopies(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Count         int      `json:"count"`
+		Barcodes      []string `json:"barcodes"`
+		ShelfLocation string   `json:"shelf_location"`
+		AcquiredOn    string   `json:"acquired_on"`
+		Notes         string   `json:"notes"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	in := library.AddCopiesInput{Count: req.Count, Barcodes: req.Barcodes, ShelfLocation: req.ShelfLocation, Notes: req.Notes}
+	if req.AcquiredOn != "" {
+		d, err := time.Parse("2006-01-02", req.AcquiredOn)
+		if err != nil {
+			http.Error(w, "acquired_on must be in YYYY-MM-DD format", http.StatusBadRequest)
+			return
+		}
+		in.AcquiredOn = d
+	}
+	copies, err := h.circ.AddCopies(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "book_id"), in, deskActor(r))
+	if err != nil {
+		writeCirculationError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusCreated, copies)
+}
+
+func (h *Handler) LookupCopy(w http.ResponseWriter, r *http.Request) {
+	code := strings.TrimSpace(r.URL.Query().Get("code"))
+	if code == "" {
+		http.Error(w, "code is required", http.StatusBadRequest)
+		return
+	}
+	c, err := h.circ.CopyByBarcode(r.Context(), middleware.GetTenantID(r.Context()), code)
+	if err != nil {
+		writeCirculationError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, c)
+}
+
+func (h *Handler) UpdateCopy(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Status        string `json:"status"`
+		ShelfLocation string `json:"shelf_location"`
+		Notes         string `json:"notes"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	c, err := h.circ.UpdateCopy(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"), library.CopyUpdate{
+		Status:        req.Status,
+		ShelfLocation: req.ShelfLocation,
+		Notes:         req.Notes,
+	}, deskActor(r))
+	if err != nil {
+		writeCirculationError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, c)
+}
+
+// Policies
+
+func (h *Handler) ListPolicies(w http.ResponseWriter, r *http.Request) {
+	policies, err := h.circ.ListPolicies(r.Context(), middleware.GetTenantID(r.Context()))
+	if err != nil {
+		writeCirculationError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, policies)
+}
+
+func (h *Handler) SavePolicy(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		MemberType  string `json:"member_type"`
+		ClassID     string `json:"class_id"`
+		LoanDays    int32  `json:"loan_days"`
+		MaxBooks    int32  `json:"max_books"`
+		MaxRenewals int32  `json:"max_renewals"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	policy, err := h.circ.SavePolicy(r.Context(), middleware.GetTenantID(r.Context()), library.PolicyInput{
+		MemberType:  req.MemberType,
+		ClassID:     req.ClassID,
+		LoanDays:    req.LoanDays,
+		MaxBooks:    req.MaxBooks,
+		MaxRenewals: req.MaxRenewals,
+	}, deskActor(r))
+	if err != nil {
+		writeCirculationError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, policy)
+}
+
+func (h *Handler) DeletePolicy(w http.ResponseWriter, r *http.Request) {
+	if err := h.circ.DeletePolicy(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"), deskActor(r)); err != nil {
+		writeCirculationError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) MemberStatus(w http.ResponseWriter, r *http.Request) {
+	status, err := h.circ.MemberStatus(r.Context(), middleware.GetTenantID(r.Context()), memberFromQuery(r))
+	if err != nil {
+		writeCirculationError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, status)
+}
+
+// Renewals and reservations
+
+func (h *Handler) RenewIssue(w http.ResponseWriter, r *http.Request) {
+	loan, err := h.circ.Renew(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"), deskActor(r))
+	if err != nil {
+		writeCirculationError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, loan)
+}
+
+func (h *Handler) ListReservations(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	reservations, err := h.circ.ListReservations(r.Context(), middleware.GetTenantID(r.Context()), library.ReservationFilter{
+		BookID:   q.Get("book_id"),
+		Member:   memberFromQuery(r),
+		OpenOnly: q.Get("open") == "true",
+	})
+	if err != nil {
+		writeCirculationError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, reservations)
+}
+
+func (h *Handler) CreateReservation(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		BookID     string `json:"book_id"`
+		StudentID  string `json:"student_id"`
+		EmployeeID string `json:"employee_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.BookID) == "" {
+		http.Error(w, "book_id is required", http.StatusBadRequest)
+		return
+	}
+	res, err := h.circ.Reserve(r.Context(), middleware.GetTenantID(r.Context()), req.BookID, library.MemberRef{
+		StudentID:  req.StudentID,
+		EmployeeID: req.EmployeeID,
+	}, deskActor(r))
+	if err != nil {
+		writeCirculationError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusCreated, res)
+}
+
+func (h *Handler) CancelReservation(w http.ResponseWriter, r *http.Request) {
+	res, err := h.circ.CancelReservation(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"), deskActor(r))
+	if err != nil {
+		writeCirculationError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, res)
+}
+
+func writeCirculationError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, library.ErrInvalidCirculation), errors.Is(err, library.ErrInvalidCatalogue),
+		errors.Is(err, library.ErrInvalidISBN):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, library.ErrBookNotFound), errors.Is(err, library.ErrCopyNotFound),
+		errors.Is(err, library.ErrLoanNotFound), errors.Is(err, library.ErrMemberNotFound),
+		errors.Is(err, library.ErrPolicyNotFound), errors.Is(err, library.ErrReservationNotFound),
+		errors.Is(err, library.ErrFineNotFound), errors.Is(err, library.ErrFinePolicyNotFound),
+		errors.Is(err, library.ErrISBNNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, library.ErrCopyUnavailable), errors.Is(err, library.ErrBorrowLimit),
+		errors.Is(err, library.ErrRenewalRefused), errors.Is(err, library.ErrAlreadyReserved),
+		errors.Is(err, library.ErrFineState):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case strings.Contains(strings.ToLower(err.Error()), "not found"):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		log.Error().Err(err).Msg("library circulation request failed")
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+	}
+}
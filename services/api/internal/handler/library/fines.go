@@ -0,0 +1,179 @@
+package library
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/schoolerp/api/internal/middleware"
+	"github.com/schoolerp/api/internal/service/library"
+)
+
+func (h *Handler) registerFineRoutes(r chi.Router) {
+	r.Get("/library/fine-policies", h.ListFinePolicies)
+	r.Put("/library/fine-policies", h.SaveFinePolicy)
+	r.Delete("/library/fine-policies/{id}", h.DeleteFinePolicy)
+
+	r.Get("/library/fines", h.ListFines)
+	r.Post("/library/fines/post", h.PostFines)
+	r.Get("/library/fines/{id}", h.GetFine)
+	r.Post("/library/fines/{id}/collect", h.CollectFine)
+	r.Post("/library/fines/{id}/waiver", h.RequestFineWaiver)
+	r.Post("/library/fines/{id}/waiver/{decision}", h.DecideFineWaiver)
+}
+
+// Fine policies
+
+func (h *Handler) ListFinePolicies(w http.ResponseWriter, r *http.Request) {
+	policies, err := h.circ.ListFinePolicies(r.Context(), middleware.GetTenantID(r.Context()))
+	if err != nil {
+		writeCirculationError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, policies)
+}
+
+func (h *Handler) SaveFinePolicy(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		MemberType    string `json:"member_type"`
+		CategoryID    string `json:"category_id"`
+		PerDay        int64  `json:"per_day"`
+		GraceDays     int32  `json:"grace_days"`
+		MaxFine       *int64 `json:"max_fine"`
+		SkipHolidays  *bool  `json:"skip_holidays"`
+		SkipSundays   bool   `json:"skip_sundays"`
+		LostPercent   *int32 `json:"lost_percent"`
+		LostMinimum   int64  `json:"lost_minimum"`
+		ProcessingFee int64  `json:"processing_fee"`
+		DamagePercent *int32 `json:"damage_percent"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	in := library.FinePolicyInput{
+		MemberType:    req.MemberType,
+		CategoryID:    req.CategoryID,
+		PerDay:        req.PerDay,
+		GraceDays:     req.GraceDays,
+		MaxFine:       req.MaxFine,
+		SkipHolidays:  true,
+		SkipSundays:   req.SkipSundays,
+		LostPercent:   100,
+		LostMinimum:   req.LostMinimum,
+		ProcessingFee: req.ProcessingFee,
+		DamagePercent: 50,
+	}
+	if req.SkipHolidays != nil {
+		in.SkipHolidays = *req.SkipHolidays
+	}
+	if req.LostPercent != nil {
+		in.LostPercent = *req.LostPercent
+	}
+	if req.DamagePercent != nil {
+		in.DamagePercent = *req.DamagePercent
+	}
+	policy, err := h.circ.SaveFinePolicy(r.Context(), middleware.GetTenantID(r.Context()), in, deskActor(r))
+	if err != nil {
+		writeCirculationError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, policy)
+}
+
+func (h *Handler) DeleteFinePolicy(w http.ResponseWriter, r *http.Request) {
+	if err := h.circ.DeleteFinePolicy(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"), deskActor(r)); err != nil {
+		writeCirculationError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Fines
+
+func (h *Handler) ListFines(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	fines, err := h.circ.ListFines(r.Context(), middleware.GetTenantID(r.Context()), library.FineFilter{
+		Member:  memberFromQuery(r),
+		IssueID: q.Get("issue_id"),
+		Status:  q.Get("status"),
+	})
+	if err != nil {
+		writeCirculationError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, fines)
+}
+
+func (h *Handler) GetFine(w http.ResponseWriter, r *http.Request) {
+	fine, err := h.circ.GetFine(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"))
+	if err != nil {
+		writeCirculationError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, fine)
+}
+
+func (h *Handler) PostFines(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		StudentID string   `json:"student_id"`
+		FineIDs   []string `json:"fine_ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	result, err := h.circ.PostFines(r.Context(), middleware.GetTenantID(r.Context()), library.PostFinesInput{
+		StudentID: req.StudentID,
+		FineIDs:   req.FineIDs,
+	}, deskActor(r))
+	if err != nil {
+		writeCirculationError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, result)
+}
+
+func (h *Handler) CollectFine(w http.ResponseWriter, r *http.Request) {
+	fine, err := h.circ.CollectFine(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"), deskActor(r))
+	if err != nil {
+		writeCirculationError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, fine)
+}
+
+func (h *Handler) RequestFineWaiver(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Amount int64  `json:"amount"`
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	fine, err := h.circ.RequestWaiver(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"), req.Amount, req.Reason, deskActor(r))
+	if err != nil {
+		writeCirculationError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusAccepted, fine)
+}
+
+func (h *Handler) DecideFineWaiver(w http.ResponseWriter, r *http.Request) {
+	decision := chi.URLParam(r, "decision")
+	if decision != "approve" && decision != "reject" {
+		http.Error(w, "decision must be approve or reject", http.StatusBadRequest)
+		return
+	}
+	var req struct {
+		Remark string `json:"remark"`
+	}
+	_ = json.NewDecoder(r.Body).Decode(&req)
+	fine, err := h.circ.DecideWaiver(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"), decision == "approve", req.Remark, deskActor(r))
+	if err != nil {
+		writeCirculationError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, fine)
+}
@@ -12,11 +12,13 @@ import (
 )
 
 type Handler struct {
-	svc *library.LibraryService
+	svc  *library.LibraryService
+	circ *library.CirculationService
+	cat  *library.CatalogueService
 }
 
-func NewHandler(svc *library.LibraryService) *Handler {
-	return &Handler{svc: svc}
+func NewHandler(svc *library.LibraryService, circ *library.CirculationService, cat *library.CatalogueService) *Handler {
+	return &Handler{svc: svc, circ: circ, cat: cat}
 }
 
 func (h *Handler) RegisterRoutes(r chi.Router) {
@@ -40,12 +42,15 @@ func (h *Handler) RegisterRoutes(r chi.Router) {
 	r.Delete("/library/assets/{id}", h.DeleteDigitalAsset)
 
 	h.RegisterReadingProgressRoutes(r)
+	h.registerCirculationRoutes(r)
+	h.registerCatalogueRoutes(r)
 }
 
 type scanIssueReq struct {
-	Barcode   string `json:"barcode"`
-	StudentID string `json:"student_id"`
-	Days      int    `json:"days"`
+	Barcode    string `json:"barcode"`
+	StudentID  string `json:"student_id"`
+	EmployeeID string `json:"employee_id"`
+	Days       int    `json:"days"`
 }
 
 func (h *Handler) ScanIssueBook(w http.ResponseWriter, r *http.Request) {
@@ -55,22 +60,23 @@ func (h *Handler) ScanIssueBook(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "invalid request body", http.StatusBadRequest)
 		return
 	}
-	if strings.TrimSpace(req.Barcode) == "" || strings.TrimSpace(req.StudentID) == "" {
-		http.Error(w, "barcode and student_id are required", http.StatusBadRequest)
+	if strings.TrimSpace(req.Barcode) == "" || (strings.TrimSpace(req.StudentID) == "" && strings.TrimSpace(req.EmployeeID) == "") {
+		http.Error(w, "barcode and student_id or employee_id are required", http.StatusBadRequest)
 		return
 	}
 
 	issue, err := h.svc.ScanBookForIssue(ctx, library.IssueBookParams{
-		TenantID:  middleware.GetTenantID(ctx),
-		StudentID: req.StudentID,
-		UserID:    middleware.GetUserID(ctx),
-		Days:      req.Days,
-		RequestID: middleware.GetReqID(ctx),
-		IP:        r.RemoteAddr,
+		TenantID:   middleware.GetTenantID(ctx),
+		StudentID:  req.StudentID,
+		EmployeeID: req.EmployeeID,
+		UserID:     middleware.GetUserID(ctx),
+		Days:       req.Days,
+		RequestID:  middleware.GetReqID(ctx),
+		IP:         r.RemoteAddr,
 	}, req.Barcode)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeCirculationError(w, err)
 		return
 	}
 	respondJSON(w, http.StatusCreated, issue)
@@ -79,6 +85,7 @@ func (h *Handler) ScanIssueBook(w http.ResponseWriter, r *http.Request) {
 type scanReturnReq struct {
 	Barcode string `json:"barcode"`
 	Remarks string `json:"remarks"`
+	Damaged bool   `json:"damaged"`
 }
 
 func (h *Handler) ScanReturnBook(w http.ResponseWriter, r *http.Request) {
@@ -93,9 +100,16 @@ func (h *Handler) ScanReturnBook(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	issue, err := h.svc.ScanBookForReturn(ctx, middleware.GetTenantID(ctx), middleware.GetUserID(ctx), req.Barcode, req.Remarks)
+	issue, err := h.svc.ScanBookForReturn(ctx, library.ReturnBookParams{
+		TenantID:  middleware.GetTenantID(ctx),
+		UserID:    middleware.GetUserID(ctx),
+		Remarks:   req.Remarks,
+		Damaged:   req.Damaged,
+		RequestID: middleware.GetReqID(ctx),
+		IP:        r.RemoteAddr,
+	}, req.Barcode)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeCirculationError(w, err)
 		return
 	}
 	respondJSON(w, http.StatusOK, issue)
@@ -245,9 +259,11 @@ func (h *Handler) ListAuthors(w http.ResponseWriter, r *http.Request) {
 // Issue Handlers
 
 type issueBookReq struct {
-	BookID    string `json:"book_id"`
-	StudentID string `json:"student_id"`
-	Days      int    `json:"days"`
+	BookID     string `json:"book_id"`
+	CopyID     string `json:"copy_id"`
+	StudentID  string `json:"student_id"`
+	EmployeeID string `json:"employee_id"`
+	Days       int    `json:"days"`
 }
 
 func (h *Handler) IssueBook(w http.ResponseWriter, r *http.Request) {
@@ -257,26 +273,29 @@ func (h *Handler) IssueBook(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "invalid body", http.StatusBadRequest)
 		return
 	}
-	if strings.TrimSpace(req.BookID) == "" || strings.TrimSpace(req.StudentID) == "" {
-		http.Error(w, "book_id and student_id are required", http.StatusBadRequest)
+	if strings.TrimSpace(req.BookID) == "" && strings.TrimSpace(req.CopyID) == "" {
+		http.Error(w, "book_id or copy_id is required", http.StatusBadRequest)
 		return
 	}
-	if req.Days <= 0 {
-		req.Days = 14
+	if strings.TrimSpace(req.StudentID) == "" && strings.TrimSpace(req.EmployeeID) == "" {
+		http.Error(w, "student_id or employee_id is required", http.StatusBadRequest)
+		return
 	}
 
 	issue, err := h.svc.IssueBook(ctx, library.IssueBookParams{
-		TenantID:  middleware.GetTenantID(ctx),
-		BookID:    req.BookID,
-		StudentID: req.StudentID,
-		UserID:    middleware.GetUserID(ctx),
-		Days:      req.Days,
-		RequestID: middleware.GetReqID(ctx),
-		IP:        r.RemoteAddr,
+		TenantID:   middleware.GetTenantID(ctx),
+		BookID:     req.BookID,
+		CopyID:     req.CopyID,
+		StudentID:  req.StudentID,
+		EmployeeID: req.EmployeeID,
+		UserID:     middleware.GetUserID(ctx),
+		Days:       req.Days,
+		RequestID:  middleware.GetReqID(ctx),
+		IP:         r.RemoteAddr,
 	})
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeCirculationError(w, err)
 		return
 	}
 	respondJSON(w, http.StatusCreated, issue)
@@ -284,6 +303,7 @@ func (h *Handler) IssueBook(w http.ResponseWriter, r *http.Request) {
 
 type returnBookReq struct {
 	Remarks string `json:"remarks"`
+	Damaged bool   `json:"damaged"`
 }
 
 func (h *Handler) ReturnBook(w http.ResponseWriter, r *http.Request) {
@@ -300,14 +320,17 @@ func (h *Handler) ReturnBook(w http.ResponseWriter, r *http.Request) {
 	}
 
 	issue, err := h.svc.ReturnBook(ctx, library.ReturnBookParams{
-		TenantID: middleware.GetTenantID(ctx),
-		IssueID:  issueID,
-		UserID:   middleware.GetUserID(ctx),
-		Remarks:  req.Remarks,
+		TenantID:  middleware.GetTenantID(ctx),
+		IssueID:   issueID,
+		UserID:    middleware.GetUserID(ctx),
+		Remarks:   req.Remarks,
+		Damaged:   req.Damaged,
+		RequestID: middleware.GetReqID(ctx),
+		IP:        r.RemoteAddr,
 	})
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeCirculationError(w, err)
 		return
 	}
 	respondJSON(w, http.StatusOK, issue)
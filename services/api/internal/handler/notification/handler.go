@@ -2,6 +2,7 @@ package notification
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 	"time"
@@ -209,6 +210,10 @@ func (h *Handler) UpdateGatewayConfig(w http.ResponseWriter, r *http.Request) {
 
 	tenantID := middleware.GetTenantID(r.Context())
 	config, err := h.svc.CreateOrUpdateGatewayConfig(r.Context(), tenantID, req.Provider, req.ApiKey, req.ApiSecret, req.SenderID, req.IsActive, []byte(req.Settings))
+	if errors.Is(err, notifsvc.ErrWhatsAppNumberTaken) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -2,9 +2,11 @@ package sis
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
 	"github.com/schoolerp/api/internal/middleware"
 	"github.com/schoolerp/api/internal/service/sis"
 )
@@ -23,12 +25,50 @@ func (h *HostelHandler) RegisterRoutes(r chi.Router) {
 		r.Post("/buildings", h.CreateBuilding)
 		r.Get("/buildings/{buildingId}/rooms", h.ListRooms)
 		r.Post("/buildings/{buildingId}/rooms", h.CreateRoom)
+		r.Get("/rooms/{roomId}/beds", h.ListBeds)
 		r.Get("/allocations", h.ListAllocations)
 		r.Post("/allocations", h.AllocateRoom)
+		r.Post("/allocations/{id}/transfer", h.TransferAllocation)
 		r.Post("/allocations/{id}/vacate", h.VacateRoom)
+
+		h.registerAttendanceRoutes(r)
+		h.registerMessRoutes(r)
+		h.registerFeeRoutes(r)
 	})
 }
 
+func hostelActor(r *http.Request) sis.HostelActor {
+	return sis.HostelActor{
+		UserID:    middleware.GetUserID(r.Context()),
+		RequestID: middleware.GetReqID(r.Context()),
+		IP:        r.RemoteAddr,
+	}
+}
+
+func writeHostelJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeHostelError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, sis.ErrInvalidHostel), errors.Is(err, sis.ErrInvalidHostelFees):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, sis.ErrHostelBuildingNotFound), errors.Is(err, sis.ErrHostelRoomNotFound),
+		errors.Is(err, sis.ErrHostelAllocationNotFound), errors.Is(err, sis.ErrLeaveNotFound),
+		errors.Is(err, sis.ErrOptOutNotFound), errors.Is(err, sis.ErrHostelFeeTermNotFound),
+		errors.Is(err, sis.ErrHostelFeeRunNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, sis.ErrRoomFull), errors.Is(err, sis.ErrAlreadyAllocated),
+		errors.Is(err, sis.ErrHostelState), errors.Is(err, sis.ErrLeaveState):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		log.Error().Err(err).Msg("hostel request failed")
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+	}
+}
+
 func (h *HostelHandler) CreateBuilding(w http.ResponseWriter, r *http.Request) {
 	tenantID := middleware.GetTenantID(r.Context())
 	userID := middleware.GetUserID(r.Context())
@@ -71,9 +111,9 @@ func (h *HostelHandler) CreateRoom(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	res, err := h.svc.CreateRoom(r.Context(), bID, room)
+	res, err := h.svc.CreateRoom(r.Context(), middleware.GetTenantID(r.Context()), bID, room)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeHostelError(w, err)
 		return
 	}
 
@@ -83,7 +123,7 @@ func (h *HostelHandler) CreateRoom(w http.ResponseWriter, r *http.Request) {
 
 func (h *HostelHandler) ListRooms(w http.ResponseWriter, r *http.Request) {
 	bID := chi.URLParam(r, "buildingId")
-	rooms, err := h.svc.ListRooms(r.Context(), bID)
+	rooms, err := h.svc.ListRooms(r.Context(), middleware.GetTenantID(r.Context()), bID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -93,6 +133,15 @@ func (h *HostelHandler) ListRooms(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(rooms)
 }
 
+func (h *HostelHandler) ListBeds(w http.ResponseWriter, r *http.Request) {
+	beds, err := h.svc.ListBeds(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "roomId"))
+	if err != nil {
+		writeHostelError(w, err)
+		return
+	}
+	writeHostelJSON(w, http.StatusOK, beds)
+}
+
 func (h *HostelHandler) AllocateRoom(w http.ResponseWriter, r *http.Request) {
 	tenantID := middleware.GetTenantID(r.Context())
 	userID := middleware.GetUserID(r.Context())
@@ -101,6 +150,7 @@ func (h *HostelHandler) AllocateRoom(w http.ResponseWriter, r *http.Request) {
 
 	var req struct {
 		RoomID    string `json:"room_id"`
+		BedID     string `json:"bed_id"`
 		StudentID string `json:"student_id"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -108,12 +158,35 @@ func (h *HostelHandler) AllocateRoom(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.svc.AllocateRoom(r.Context(), tenantID, req.RoomID, req.StudentID, userID, reqID, ip); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	allocation, err := h.svc.AllocateRoom(r.Context(), tenantID, req.RoomID, req.BedID, req.StudentID, userID, reqID, ip)
+	if err != nil {
+		writeHostelError(w, err)
 		return
 	}
 
-	w.WriteHeader(http.StatusCreated)
+	writeHostelJSON(w, http.StatusCreated, allocation)
+}
+
+func (h *HostelHandler) TransferAllocation(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		RoomID  string `json:"room_id"`
+		BedID   string `json:"bed_id"`
+		Remarks string `json:"remarks"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.RoomID == "" && req.BedID == "" {
+		http.Error(w, "room_id or bed_id is required", http.StatusBadRequest)
+		return
+	}
+	allocation, err := h.svc.TransferAllocation(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"), req.RoomID, req.BedID, req.Remarks, hostelActor(r))
+	if err != nil {
+		writeHostelError(w, err)
+		return
+	}
+	writeHostelJSON(w, http.StatusOK, allocation)
 }
 
 func (h *HostelHandler) ListAllocations(w http.ResponseWriter, r *http.Request) {
@@ -136,7 +209,7 @@ func (h *HostelHandler) VacateRoom(w http.ResponseWriter, r *http.Request) {
 	ip := r.RemoteAddr
 
 	if err := h.svc.VacateRoom(r.Context(), tenantID, id, userID, reqID, ip); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeHostelError(w, err)
 		return
 	}
 
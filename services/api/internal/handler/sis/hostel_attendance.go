@@ -0,0 +1,185 @@
+package sis
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/schoolerp/api/internal/middleware"
+	"github.com/schoolerp/api/internal/service/sis"
+)
+
+func (h *HostelHandler) registerAttendanceRoutes(r chi.Router) {
+	r.Get("/roll-calls", h.GetRollCall)
+	r.Put("/roll-calls", h.RecordRollCall)
+
+	r.Get("/leaves", h.ListLeaves)
+	r.Post("/leaves", h.RequestLeave)
+	r.Get("/leaves/{id}", h.GetLeave)
+	r.Post("/leaves/{id}/approve", h.ApproveLeave)
+	r.Post("/leaves/{id}/reject", h.RejectLeave)
+	r.Post("/leaves/{id}/check-out", h.CheckOutLeave)
+	r.Post("/leaves/{id}/check-in", h.CheckInLeave)
+	r.Post("/leaves/{id}/cancel", h.CancelLeave)
+}
+
+// Roll-call
+
+func (h *HostelHandler) GetRollCall(w http.ResponseWriter, r *http.Request) {
+	buildingID := r.URL.Query().Get("building_id")
+	if buildingID == "" {
+		http.Error(w, "building_id is required", http.StatusBadRequest)
+		return
+	}
+	sheet, err := h.svc.RollCall(r.Context(), middleware.GetTenantID(r.Context()), buildingID, r.URL.Query().Get("date"))
+	if err != nil {
+		writeHostelError(w, err)
+		return
+	}
+	writeHostelJSON(w, http.StatusOK, sheet)
+}
+
+// RecordRollCall marks residents for a night. Students away on leave who
+// are not in the request are marked on leave.
+func (h *HostelHandler) RecordRollCall(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		BuildingID string             `json:"building_id"`
+		Date       string             `json:"date"`
+		Notes      string             `json:"notes"`
+		Entries    []sis.RollCallMark `json:"entries"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.BuildingID == "" {
+		http.Error(w, "building_id is required", http.StatusBadRequest)
+		return
+	}
+	sheet, err := h.svc.RecordRollCall(r.Context(), middleware.GetTenantID(r.Context()), req.BuildingID, req.Date, req.Entries, req.Notes, hostelActor(r))
+	if err != nil {
+		writeHostelError(w, err)
+		return
+	}
+	writeHostelJSON(w, http.StatusOK, sheet)
+}
+
+// Leave and outings
+
+func (h *HostelHandler) ListLeaves(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	offset, _ := strconv.Atoi(q.Get("offset"))
+	leaves, err := h.svc.ListLeaves(r.Context(), middleware.GetTenantID(r.Context()), sis.LeaveFilter{
+		Status:     q.Get("status"),
+		StudentID:  q.Get("student_id"),
+		BuildingID: q.Get("building_id"),
+		Overdue:    q.Get("overdue") == "true",
+		Limit:      int32(limit),
+		Offset:     int32(offset),
+	})
+	if err != nil {
+		writeHostelError(w, err)
+		return
+	}
+	writeHostelJSON(w, http.StatusOK, leaves)
+}
+
+func (h *HostelHandler) RequestLeave(w http.ResponseWriter, r *http.Request) {
+	var req sis.LeaveInput
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body; times must be RFC 3339", http.StatusBadRequest)
+		return
+	}
+	if req.StudentID == "" {
+		http.Error(w, "student_id is required", http.StatusBadRequest)
+		return
+	}
+	leave, err := h.svc.RequestLeave(r.Context(), middleware.GetTenantID(r.Context()), req, hostelActor(r))
+	if err != nil {
+		writeHostelError(w, err)
+		return
+	}
+	writeHostelJSON(w, http.StatusCreated, leave)
+}
+
+func (h *HostelHandler) GetLeave(w http.ResponseWriter, r *http.Request) {
+	leave, err := h.svc.GetLeave(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"))
+	if err != nil {
+		writeHostelError(w, err)
+		return
+	}
+	writeHostelJSON(w, http.StatusOK, leave)
+}
+
+type leaveRemarkReq struct {
+	Remarks string `json:"remarks"`
+}
+
+// decodeRemark reads an optional {"remarks": ...} body.
+func decodeRemark(r *http.Request) (string, bool) {
+	var req leaveRemarkReq
+	if r.ContentLength == 0 {
+		return "", true
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return "", false
+	}
+	return req.Remarks, true
+}
+
+func (h *HostelHandler) decideLeave(w http.ResponseWriter, r *http.Request, approve bool) {
+	remark, ok := decodeRemark(r)
+	if !ok {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	leave, err := h.svc.DecideLeave(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"), approve, remark, hostelActor(r))
+	if err != nil {
+		writeHostelError(w, err)
+		return
+	}
+	writeHostelJSON(w, http.StatusOK, leave)
+}
+
+// ApproveLeave approves a request and issues its gate pass.
+func (h *HostelHandler) ApproveLeave(w http.ResponseWriter, r *http.Request) {
+	h.decideLeave(w, r, true)
+}
+
+func (h *HostelHandler) RejectLeave(w http.ResponseWriter, r *http.Request) {
+	h.decideLeave(w, r, false)
+}
+
+func (h *HostelHandler) CheckOutLeave(w http.ResponseWriter, r *http.Request) {
+	leave, err := h.svc.CheckOutLeave(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"), hostelActor(r))
+	if err != nil {
+		writeHostelError(w, err)
+		return
+	}
+	writeHostelJSON(w, http.StatusOK, leave)
+}
+
+func (h *HostelHandler) CheckInLeave(w http.ResponseWriter, r *http.Request) {
+	leave, err := h.svc.CheckInLeave(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"), hostelActor(r))
+	if err != nil {
+		writeHostelError(w, err)
+		return
+	}
+	writeHostelJSON(w, http.StatusOK, leave)
+}
+
+func (h *HostelHandler) CancelLeave(w http.ResponseWriter, r *http.Request) {
+	remark, ok := decodeRemark(r)
+	if !ok {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	leave, err := h.svc.CancelLeave(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"), remark, hostelActor(r))
+	if err != nil {
+		writeHostelError(w, err)
+		return
+	}
+	writeHostelJSON(w, http.StatusOK, leave)
+}
@@ -0,0 +1,162 @@
+package sis
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/schoolerp/api/internal/db"
+	"github.com/schoolerp/api/internal/middleware"
+	"github.com/schoolerp/api/internal/service/sis"
+)
+
+func (h *HostelHandler) registerFeeRoutes(r chi.Router) {
+	r.Get("/fees/settings", h.GetFeeSettings)
+	r.Put("/fees/settings", h.UpdateFeeSettings)
+	r.Get("/fees/terms", h.ListFeeTerms)
+	r.Post("/fees/terms", h.CreateFeeTerm)
+	r.Post("/fees/terms/{id}/generate", h.GenerateFees)
+	r.Get("/fees/terms/{id}/charges", h.ListFeeCharges)
+	r.Get("/fees/terms/{id}/runs", h.ListFeeRuns)
+	r.Get("/fees/runs/{id}", h.GetFeeRun)
+}
+
+func optionalHostelDate(raw, field string) (time.Time, error) {
+	if raw == "" {
+		return time.Time{}, nil
+	}
+	date, err := time.Parse("2006-01-02", raw)
+	if err != nil {
+		return time.Time{}, errors.New(field + " must be in YYYY-MM-DD format")
+	}
+	return date, nil
+}
+
+func (h *HostelHandler) GetFeeSettings(w http.ResponseWriter, r *http.Request) {
+	settings, err := h.svc.GetFeeSettings(r.Context(), middleware.GetTenantID(r.Context()))
+	if err != nil {
+		writeHostelError(w, err)
+		return
+	}
+	writeHostelJSON(w, http.StatusOK, settings)
+}
+
+// UpdateFeeSettings saves the fee heads and mess rates. Amounts are in
+// paise.
+func (h *HostelHandler) UpdateFeeSettings(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		FeeHeadID         string `json:"fee_head_id"`
+		MessFeeHeadID     string `json:"mess_fee_head_id"`
+		MessMonthlyFee    int64  `json:"mess_monthly_fee"`
+		MessRebatePerDay  int64  `json:"mess_rebate_per_day"`
+		MessRebateMinDays int32  `json:"mess_rebate_min_days"`
+		Proration         string `json:"proration"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	in := db.HostelFeeSettings{
+		MessMonthlyFee:    req.MessMonthlyFee,
+		MessRebatePerDay:  req.MessRebatePerDay,
+		MessRebateMinDays: req.MessRebateMinDays,
+		Proration:         req.Proration,
+	}
+	_ = in.FeeHeadID.Scan(req.FeeHeadID)
+	_ = in.MessFeeHeadID.Scan(req.MessFeeHeadID)
+	settings, err := h.svc.UpdateFeeSettings(r.Context(), middleware.GetTenantID(r.Context()), in, hostelActor(r))
+	if err != nil {
+		writeHostelError(w, err)
+		return
+	}
+	writeHostelJSON(w, http.StatusOK, settings)
+}
+
+func (h *HostelHandler) ListFeeTerms(w http.ResponseWriter, r *http.Request) {
+	terms, err := h.svc.ListFeeTerms(r.Context(), middleware.GetTenantID(r.Context()), r.URL.Query().Get("academic_year_id"))
+	if err != nil {
+		writeHostelError(w, err)
+		return
+	}
+	writeHostelJSON(w, http.StatusOK, terms)
+}
+
+func (h *HostelHandler) CreateFeeTerm(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		AcademicYearID string `json:"academic_year_id"`
+		Name           string `json:"name"`
+		StartDate      string `json:"start_date"`
+		EndDate        string `json:"end_date"`
+		DueDate        string `json:"due_date"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	in := sis.HostelFeeTermInput{AcademicYearID: req.AcademicYearID, Name: req.Name}
+	var err error
+	if in.StartDate, err = optionalHostelDate(req.StartDate, "start_date"); err == nil {
+		if in.EndDate, err = optionalHostelDate(req.EndDate, "end_date"); err == nil {
+			in.DueDate, err = optionalHostelDate(req.DueDate, "due_date")
+		}
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	term, err := h.svc.CreateFeeTerm(r.Context(), middleware.GetTenantID(r.Context()), in, hostelActor(r))
+	if err != nil {
+		writeHostelError(w, err)
+		return
+	}
+	writeHostelJSON(w, http.StatusCreated, term)
+}
+
+// GenerateFees brings a term's hostel and mess charges in line with the
+// stays and returns the reconciliation report.
+func (h *HostelHandler) GenerateFees(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		DryRun bool `json:"dry_run"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+	report, err := h.svc.GenerateFees(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"), req.DryRun, hostelActor(r))
+	if err != nil {
+		writeHostelError(w, err)
+		return
+	}
+	writeHostelJSON(w, http.StatusOK, report)
+}
+
+func (h *HostelHandler) ListFeeCharges(w http.ResponseWriter, r *http.Request) {
+	charges, err := h.svc.ListFeeCharges(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"))
+	if err != nil {
+		writeHostelError(w, err)
+		return
+	}
+	writeHostelJSON(w, http.StatusOK, charges)
+}
+
+func (h *HostelHandler) ListFeeRuns(w http.ResponseWriter, r *http.Request) {
+	runs, err := h.svc.ListFeeRuns(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"))
+	if err != nil {
+		writeHostelError(w, err)
+		return
+	}
+	writeHostelJSON(w, http.StatusOK, runs)
+}
+
+func (h *HostelHandler) GetFeeRun(w http.ResponseWriter, r *http.Request) {
+	run, err := h.svc.GetFeeRun(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"))
+	if err != nil {
+		writeHostelError(w, err)
+		return
+	}
+	writeHostelJSON(w, http.StatusOK, run)
+}
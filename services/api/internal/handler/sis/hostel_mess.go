@@ -0,0 +1,92 @@
+package sis
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/schoolerp/api/internal/middleware"
+	"github.com/schoolerp/api/internal/service/sis"
+)
+
+func (h *HostelHandler) registerMessRoutes(r chi.Router) {
+	r.Get("/mess/menu", h.GetMessMenu)
+	r.Put("/mess/menu", h.SetMessMenu)
+	r.Get("/mess/opt-outs", h.ListMealOptOuts)
+	r.Post("/mess/opt-outs", h.CreateMealOptOut)
+	r.Post("/mess/opt-outs/{id}/cancel", h.CancelMealOptOut)
+	r.Get("/mess/counts", h.GetMealCounts)
+}
+
+func (h *HostelHandler) GetMessMenu(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	menu, err := h.svc.Menu(r.Context(), middleware.GetTenantID(r.Context()), q.Get("from"), q.Get("to"))
+	if err != nil {
+		writeHostelError(w, err)
+		return
+	}
+	writeHostelJSON(w, http.StatusOK, menu)
+}
+
+func (h *HostelHandler) SetMessMenu(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Entries []sis.MenuEntry `json:"entries"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	menu, err := h.svc.SetMenu(r.Context(), middleware.GetTenantID(r.Context()), req.Entries, hostelActor(r))
+	if err != nil {
+		writeHostelError(w, err)
+		return
+	}
+	writeHostelJSON(w, http.StatusOK, menu)
+}
+
+func (h *HostelHandler) ListMealOptOuts(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	optOuts, err := h.svc.ListOptOuts(r.Context(), middleware.GetTenantID(r.Context()), q.Get("student_id"), q.Get("from"), q.Get("to"))
+	if err != nil {
+		writeHostelError(w, err)
+		return
+	}
+	writeHostelJSON(w, http.StatusOK, optOuts)
+}
+
+func (h *HostelHandler) CreateMealOptOut(w http.ResponseWriter, r *http.Request) {
+	var req sis.OptOutInput
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.StudentID == "" {
+		http.Error(w, "student_id is required", http.StatusBadRequest)
+		return
+	}
+	optOut, err := h.svc.OptOut(r.Context(), middleware.GetTenantID(r.Context()), req, hostelActor(r))
+	if err != nil {
+		writeHostelError(w, err)
+		return
+	}
+	writeHostelJSON(w, http.StatusCreated, optOut)
+}
+
+func (h *HostelHandler) CancelMealOptOut(w http.ResponseWriter, r *http.Request) {
+	optOut, err := h.svc.CancelOptOut(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"), hostelActor(r))
+	if err != nil {
+		writeHostelError(w, err)
+		return
+	}
+	writeHostelJSON(w, http.StatusOK, optOut)
+}
+
+// GetMealCounts is the kitchen's head count for each meal of a day.
+func (h *HostelHandler) GetMealCounts(w http.ResponseWriter, r *http.Request) {
+	report, err := h.svc.MealCounts(r.Context(), middleware.GetTenantID(r.Context()), r.URL.Query().Get("date"))
+	if err != nil {
+		writeHostelError(w, err)
+		return
+	}
+	writeHostelJSON(w, http.StatusOK, report)
+}
@@ -44,8 +44,12 @@ func (h *Handler) CreateRemark(w http.ResponseWriter, r *http.Request) {
 		RequiresAck: pgtype.Bool{Bool: req.RequiresAck, Valid: true},
 	}
 
-	remark, err := h.svc.CreateStudentRemark(ctx, arg)
+	remark, err := h.svc.CreateStudentRemark(ctx, arg, middleware.DataScopeActor(ctx))
 	if err != nil {
+		if middleware.RecordDataScopeViolation(r, err) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -69,8 +73,12 @@ func (h *Handler) ListRemarks(w http.ResponseWriter, r *http.Request) {
 		StudentID: sUUID,
 	}
 
-	remarks, err := h.svc.ListStudentRemarks(ctx, arg)
+	remarks, err := h.svc.ListStudentRemarks(ctx, arg, middleware.DataScopeActor(ctx))
 	if err != nil {
+		if middleware.RecordDataScopeViolation(r, err) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
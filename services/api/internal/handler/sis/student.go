@@ -572,8 +572,12 @@ func (h *Handler) Get(w http.ResponseWriter, r *http.Request) {
 	tenantID := middleware.GetTenantID(r.Context())
 	studentID := chi.URLParam(r, "id")
 
-	student, err := h.svc.GetStudent(r.Context(), tenantID, studentID)
+	student, err := h.svc.GetStudent(r.Context(), tenantID, studentID, middleware.DataScopeActor(r.Context()))
 	if err != nil {
+		if middleware.RecordDataScopeViolation(r, err) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
 		// Check for not found error specifically in real implementation
 		http.Error(w, "student not found", http.StatusNotFound)
 		return
@@ -611,7 +615,6 @@ func (h *Handler) ListMyChildren(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) GetMyChildProfile(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	tenantID := middleware.GetTenantID(ctx)
-	userID := middleware.GetUserID(ctx)
 	childID := chi.URLParam(r, "id")
 
 	if childID == "" {
@@ -619,33 +622,13 @@ func (h *Handler) GetMyChildProfile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	children, err := h.svc.ListChildrenByParent(ctx, tenantID, userID)
+	// The parent's data scope limits this to their linked children.
+	student, err := h.svc.GetStudent(ctx, tenantID, childID, middleware.DataScopeActor(ctx))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	childUUID := pgtype.UUID{}
-	if err := childUUID.Scan(childID); err != nil {
-		http.Error(w, "invalid child id", http.StatusBadRequest)
-		return
-	}
-
-	authorized := false
-	for _, child := range children {
-		if child.ID.Valid && childUUID.Valid && child.ID.Bytes == childUUID.Bytes {
-			authorized = true
-			break
+		if middleware.RecordDataScopeViolation(r, err) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
 		}
-	}
-
-	if !authorized {
-		http.Error(w, "forbidden", http.StatusForbidden)
-		return
-	}
-
-	student, err := h.svc.GetStudent(ctx, tenantID, childID)
-	if err != nil {
 		http.Error(w, "student not found", http.StatusNotFound)
 		return
 	}
@@ -78,7 +78,7 @@ func (h *Student360Handler) AddBehavioralLog(w http.ResponseWriter, r *http.Requ
 
 func (h *Student360Handler) GetHealthRecord(w http.ResponseWriter, r *http.Request) {
 	studentID := chi.URLParam(r, "studentID")
-	record, err := h.svc.GetHealthRecord(r.Context(), studentID)
+	record, err := h.svc.GetHealthRecord(r.Context(), middleware.GetTenantID(r.Context()), studentID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
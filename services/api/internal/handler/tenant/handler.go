@@ -129,6 +129,8 @@ func (h *Handler) RegisterPlatformRoutes(r chi.Router) {
 		r.Post("/security/retention-policy", h.UpdatePlatformDataRetentionPolicy)
 		r.Get("/security/password-policy", h.GetPlatformPasswordPolicy)
 		r.Post("/security/password-policy", h.UpdatePlatformPasswordPolicy)
+		r.Get("/security/rate-limits", h.GetPlatformRateLimitPolicy)
+		r.Post("/security/rate-limits", h.UpdatePlatformRateLimitPolicy)
 		r.Get("/settings/notifications", h.GetPlatformNotificationSettings)
 		r.Post("/settings/notifications", h.UpdatePlatformNotificationSettings)
 		r.Get("/settings/notification-templates", h.ListNotificationTemplates)
@@ -177,6 +179,7 @@ func (h *Handler) RegisterPlatformRoutes(r chi.Router) {
 		r.Post("/security/secret-rotations", h.CreatePlatformSecretRotationRequest)
 		r.Post("/security/secret-rotations/{rotation_id}/review", h.ReviewPlatformSecretRotationRequest)
 		r.Post("/security/secret-rotations/{rotation_id}/execute", h.ExecutePlatformSecretRotationRequest)
+		r.Get("/security/reencryption-jobs", h.ListPlatformReencryptionJobs)
 	})
 
 	r.Group(func(r chi.Router) {
@@ -1546,7 +1549,12 @@ func (h *Handler) UpdatePlatformMFAPolicy(w http.ResponseWriter, r *http.Request
 
 	updated, err := h.service.UpdatePlatformMFAPolicy(r.Context(), req)
 	if err != nil {
-		http.Error(w, "Failed to update MFA policy", http.StatusInternalServerError)
+		switch {
+		case errors.Is(err, tenant.ErrInvalidMFAPolicy):
+			http.Error(w, "Invalid MFA policy", http.StatusBadRequest)
+		default:
+			http.Error(w, "Failed to update MFA policy", http.StatusInternalServerError)
+		}
 		return
 	}
 
@@ -2161,6 +2169,51 @@ func (h *Handler) UpdatePlatformPasswordPolicy(w http.ResponseWriter, r *http.Re
 	_ = json.NewEncoder(w).Encode(updated)
 }
 
+func (h *Handler) GetPlatformRateLimitPolicy(w http.ResponseWriter, r *http.Request) {
+	policy, err := h.service.GetPlatformRateLimitPolicy(r.Context())
+	if err != nil {
+		http.Error(w, "Failed to load rate limit policy", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(policy)
+}
+
+func (h *Handler) UpdatePlatformRateLimitPolicy(w http.ResponseWriter, r *http.Request) {
+	actorID := middleware.GetUserID(r.Context())
+	var req tenant.UpdatePlatformRateLimitPolicyParams
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.UpdatedBy = actorID
+
+	before, _ := h.service.GetPlatformRateLimitPolicy(r.Context())
+	updated, err := h.service.UpdatePlatformRateLimitPolicy(r.Context(), req)
+	if err != nil {
+		switch {
+		case errors.Is(err, tenant.ErrInvalidRateLimitPolicy):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, "Failed to update rate limit policy", http.StatusInternalServerError)
+		}
+		return
+	}
+	middleware.InvalidateRateLimitPolicy()
+
+	h.service.RecordPlatformAudit(r.Context(), actorID, tenant.PlatformAuditEntry{
+		Action:       "platform.security.rate_limit_policy.update",
+		ResourceType: "platform_security_policy",
+		ResourceID:   "security.rate_limits",
+		Before:       before,
+		After:        updated,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(updated)
+}
+
 func (h *Handler) ListPlatformLegalDocs(w http.ResponseWriter, r *http.Request) {
 	qp := r.URL.Query()
 
@@ -2790,6 +2843,15 @@ func (h *Handler) GetPlatformSecretsStatus(w http.ResponseWriter, r *http.Reques
 
 	dataKeys := parseEnvList("DATA_ENCRYPTION_KEYS", "DATA_ENCRYPTION_KEY")
 
+	// Key ids let operators match configured keys with rotation
+	// fingerprints and re-encryption job targets; the primary key is first.
+	masterKeyIDs := make([]string, 0, len(dataKeys))
+	if resolved, err := security.ResolveDataEncryptionKeys(); err == nil {
+		for _, key := range resolved {
+			masterKeyIDs = append(masterKeyIDs, security.MasterKeyID(key))
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(map[string]any{
 		"jwt": map[string]any{
@@ -2801,6 +2863,7 @@ func (h *Handler) GetPlatformSecretsStatus(w http.ResponseWriter, r *http.Reques
 			"configured": len(dataKeys) > 0,
 			"env_var":    "DATA_ENCRYPTION_KEYS",
 			"count":      len(dataKeys),
+			"key_ids":    masterKeyIDs,
 		},
 	})
 }
@@ -2834,6 +2897,30 @@ func (h *Handler) ListPlatformSecretRotationRequests(w http.ResponseWriter, r *h
 	_ = json.NewEncoder(w).Encode(rows)
 }
 
+func (h *Handler) ListPlatformReencryptionJobs(w http.ResponseWriter, r *http.Request) {
+	limit := int32(20)
+	if raw := strings.TrimSpace(r.URL.Query().Get("limit")); raw != "" {
+		if parsed, err := strconv.Atoi(raw); err == nil {
+			limit = int32(parsed)
+		}
+	}
+	offset := int32(0)
+	if raw := strings.TrimSpace(r.URL.Query().Get("offset")); raw != "" {
+		if parsed, err := strconv.Atoi(raw); err == nil {
+			offset = int32(parsed)
+		}
+	}
+
+	rows, err := h.service.ListDataReencryptionJobs(r.Context(), limit, offset)
+	if err != nil {
+		http.Error(w, "Failed to load re-encryption jobs", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(rows)
+}
+
 func (h *Handler) CreatePlatformSecretRotationRequest(w http.ResponseWriter, r *http.Request) {
 	actorID := middleware.GetUserID(r.Context())
 
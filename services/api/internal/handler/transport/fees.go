@@ -0,0 +1,334 @@
+package transport
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+	"github.com/schoolerp/api/internal/db"
+	"github.com/schoolerp/api/internal/middleware"
+	"github.com/schoolerp/api/internal/service/transport"
+)
+
+func (h *Handler) registerFeeRoutes(r chi.Router) {
+	r.Get("/transport/fees/settings", h.GetFeeSettings)
+	r.Put("/transport/fees/settings", h.UpdateFeeSettings)
+	r.Get("/transport/fees/slabs", h.ListFareSlabs)
+	r.Put("/transport/fees/slabs", h.ReplaceFareSlabs)
+	r.Get("/transport/fees/zones", h.ListFareZones)
+	r.Post("/transport/fees/zones", h.CreateFareZone)
+	r.Put("/transport/fees/zones/{id}", h.UpdateFareZone)
+	r.Delete("/transport/fees/zones/{id}", h.DeleteFareZone)
+	r.Put("/transport/stops/{id}/fare", h.SetStopFare)
+	r.Put("/transport/allocations/{id}/trip-type", h.SetAllocationTripType)
+
+	r.Get("/transport/fees/terms", h.ListFeeTerms)
+	r.Post("/transport/fees/terms", h.CreateFeeTerm)
+	r.Get("/transport/fees/terms/{id}/charges", h.ListFeeCharges)
+	r.Post("/transport/fees/terms/{id}/generate", h.GenerateTermFees)
+	r.Get("/transport/fees/terms/{id}/runs", h.ListFeeRuns)
+	r.Get("/transport/fees/runs/{id}", h.GetFeeRun)
+}
+
+// Settings and fare tables
+
+func (h *Handler) GetFeeSettings(w http.ResponseWriter, r *http.Request) {
+	settings, err := h.fees.GetSettings(r.Context(), middleware.GetTenantID(r.Context()))
+	if err != nil {
+		writeFeeError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, settings)
+}
+
+func (h *Handler) UpdateFeeSettings(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		FareMode  string `json:"fare_mode"`
+		Proration string `json:"proration"`
+		FeeHeadID string `json:"fee_head_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	in := db.TransportFeeSettings{FareMode: req.FareMode, Proration: req.Proration}
+	_ = in.FeeHeadID.Scan(req.FeeHeadID)
+	settings, err := h.fees.UpdateSettings(r.Context(), middleware.GetTenantID(r.Context()), in, trackingActor(r))
+	if err != nil {
+		writeFeeError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, settings)
+}
+
+func (h *Handler) ListFareSlabs(w http.ResponseWriter, r *http.Request) {
+	slabs, err := h.fees.ListSlabs(r.Context(), middleware.GetTenantID(r.Context()))
+	if err != nil {
+		writeFeeError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, slabs)
+}
+
+func (h *Handler) ReplaceFareSlabs(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Slabs []struct {
+			FromKm       float64  `json:"from_km"`
+			ToKm         *float64 `json:"to_km"`
+			OneWayAmount int64    `json:"one_way_amount"`
+			TwoWayAmount int64    `json:"two_way_amount"`
+		} `json:"slabs"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	slabs := make([]db.TransportFareSlab, 0, len(req.Slabs))
+	for _, s := range req.Slabs {
+		slabs = append(slabs, db.TransportFareSlab{
+			FromKm:       s.FromKm,
+			ToKm:         optionalCoord(s.ToKm),
+			OneWayAmount: s.OneWayAmount,
+			TwoWayAmount: s.TwoWayAmount,
+		})
+	}
+	out, err := h.fees.ReplaceSlabs(r.Context(), middleware.GetTenantID(r.Context()), slabs, trackingActor(r))
+	if err != nil {
+		writeFeeError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, out)
+}
+
+type fareZoneReq struct {
+	Name         string `json:"name"`
+	OneWayAmount int64  `json:"one_way_amount"`
+	TwoWayAmount int64  `json:"two_way_amount"`
+}
+
+func (req fareZoneReq) zone() db.TransportFareZone {
+	return db.TransportFareZone{Name: req.Name, OneWayAmount: req.OneWayAmount, TwoWayAmount: req.TwoWayAmount}
+}
+
+func (h *Handler) ListFareZones(w http.ResponseWriter, r *http.Request) {
+	zones, err := h.fees.ListZones(r.Context(), middleware.GetTenantID(r.Context()))
+	if err != nil {
+		writeFeeError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, zones)
+}
+
+func (h *Handler) CreateFareZone(w http.ResponseWriter, r *http.Request) {
+	var req fareZoneReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	zone, err := h.fees.CreateZone(r.Context(), middleware.GetTenantID(r.Context()), req.zone(), trackingActor(r))
+	if err != nil {
+		writeFeeError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusCreated, zone)
+}
+
+func (h *Handler) UpdateFareZone(w http.ResponseWriter, r *http.Request) {
+	var req fareZoneReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	zone, err := h.fees.UpdateZone(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"), req.zone(), trackingActor(r))
+	if err != nil {
+		writeFeeError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, zone)
+}
+
+func (h *Handler) DeleteFareZone(w http.ResponseWriter, r *http.Request) {
+	if err := h.fees.DeleteZone(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"), trackingActor(r)); err != nil {
+		writeFeeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) SetStopFare(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ZoneID     string   `json:"zone_id"`
+		DistanceKm *float64 `json:"distance_km"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	err := h.fees.SetStopFare(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"), req.ZoneID, req.DistanceKm, trackingActor(r))
+	if err != nil {
+		writeFeeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) SetAllocationTripType(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		TripType string `json:"trip_type"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	err := h.fees.SetAllocationTripType(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"), req.TripType, trackingActor(r))
+	if err != nil {
+		writeFeeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Terms and generation
+
+func (h *Handler) ListFeeTerms(w http.ResponseWriter, r *http.Request) {
+	terms, err := h.fees.ListTerms(r.Context(), middleware.GetTenantID(r.Context()), r.URL.Query().Get("academic_year_id"))
+	if err != nil {
+		writeFeeError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, terms)
+}
+
+func (h *Handler) CreateFeeTerm(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		AcademicYearID string `json:"academic_year_id"`
+		Name           string `json:"name"`
+		StartDate      string `json:"start_date"`
+		EndDate        string `json:"end_date"`
+		DueDate        string `json:"due_date"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	in := transport.FeeTermInput{AcademicYearID: req.AcademicYearID, Name: req.Name}
+	var err error
+	if in.StartDate, err = optionalDate(req.StartDate, "start_date"); err == nil {
+		if in.EndDate, err = optionalDate(req.EndDate, "end_date"); err == nil {
+			in.DueDate, err = optionalDate(req.DueDate, "due_date")
+		}
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	term, err := h.fees.CreateTerm(r.Context(), middleware.GetTenantID(r.Context()), in, trackingActor(r))
+	if err != nil {
+		writeFeeError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusCreated, term)
+}
+
+func (h *Handler) ListFeeCharges(w http.ResponseWriter, r *http.Request) {
+	charges, err := h.fees.ListCharges(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"))
+	if err != nil {
+		writeFeeError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, charges)
+}
+
+// GenerateTermFees brings a term's transport charges in line with the
+// allocations and returns the reconciliation report.
+func (h *Handler) GenerateTermFees(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		DryRun bool `json:"dry_run"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+	report, err := h.fees.GenerateFees(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"), req.DryRun, trackingActor(r))
+	if err != nil {
+		writeFeeError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, report)
+}
+
+// GenerateFees is the original one-click endpoint. Without a term_id it
+// bills the term covering today, and it keeps the message and count fields
+// older clients read next to the report.
+func (h *Handler) GenerateFees(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		TermID string `json:"term_id"`
+		DryRun bool   `json:"dry_run"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+	tenantID := middleware.GetTenantID(r.Context())
+	if req.TermID == "" {
+		term, err := h.fees.CurrentTerm(r.Context(), tenantID, time.Now())
+		if err != nil {
+			writeFeeError(w, err)
+			return
+		}
+		req.TermID = term.ID.String()
+	}
+	report, err := h.fees.GenerateFees(r.Context(), tenantID, req.TermID, req.DryRun, trackingActor(r))
+	if err != nil {
+		writeFeeError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, struct {
+		transport.FeeRunReport
+		Message string `json:"message"`
+		Count   int    `json:"count"`
+	}{
+		FeeRunReport: report,
+		Message:      "Transport fees generated successfully",
+		Count:        report.Created + report.Updated + report.Unchanged,
+	})
+}
+
+func (h *Handler) ListFeeRuns(w http.ResponseWriter, r *http.Request) {
+	runs, err := h.fees.ListRuns(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"))
+	if err != nil {
+		writeFeeError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, runs)
+}
+
+func (h *Handler) GetFeeRun(w http.ResponseWriter, r *http.Request) {
+	run, err := h.fees.GetRun(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"))
+	if err != nil {
+		writeFeeError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, run)
+}
+
+func writeFeeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, transport.ErrInvalidFees):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, transport.ErrFeeTermNotFound), errors.Is(err, transport.ErrFareZoneNotFound),
+		errors.Is(err, transport.ErrFeeRunNotFound), errors.Is(err, transport.ErrAllocationNotFound),
+		errors.Is(err, transport.ErrStopNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		log.Error().Err(err).Msg("transport fee request failed")
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+	}
+}
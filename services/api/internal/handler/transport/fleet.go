@@ -0,0 +1,351 @@
+package transport
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+	"github.com/schoolerp/api/internal/middleware"
+	"github.com/schoolerp/api/internal/service/transport"
+)
+
+func (h *Handler) registerFleetRoutes(r chi.Router) {
+	// Compliance
+	r.Get("/transport/fleet/documents", h.ListFleetDocuments)
+	r.Post("/transport/fleet/documents", h.CreateFleetDocument)
+	r.Put("/transport/fleet/documents/{id}", h.UpdateFleetDocument)
+	r.Delete("/transport/fleet/documents/{id}", h.DeleteFleetDocument)
+	r.Get("/transport/fleet/compliance", h.FleetCompliance)
+
+	// Maintenance
+	r.Get("/transport/fleet/service-schedules", h.ListServiceSchedules)
+	r.Post("/transport/fleet/service-schedules", h.CreateServiceSchedule)
+	r.Put("/transport/fleet/service-schedules/{id}", h.UpdateServiceSchedule)
+	r.Get("/transport/fleet/work-orders", h.ListWorkOrders)
+	r.Post("/transport/fleet/work-orders", h.CreateWorkOrder)
+	r.Put("/transport/fleet/work-orders/{id}", h.UpdateWorkOrder)
+
+	// Analytics
+	r.Get("/transport/fleet/fuel-efficiency", h.FuelEfficiency)
+}
+
+// optionalDate parses a YYYY-MM-DD field that may be left empty.
+func optionalDate(raw, field string) (time.Time, error) {
+	if raw == "" {
+		return time.Time{}, nil
+	}
+	date, ok := parseDate(raw)
+	if !ok {
+		return time.Time{}, errors.New(field + " must be in YYYY-MM-DD format")
+	}
+	return date, nil
+}
+
+// Compliance documents
+
+type fleetDocumentReq struct {
+	VehicleID      string `json:"vehicle_id"`
+	DriverID       string `json:"driver_id"`
+	DocType        string `json:"doc_type"`
+	DocumentNumber string `json:"document_number"`
+	Issuer         string `json:"issuer"`
+	IssuedOn       string `json:"issued_on"`
+	ExpiresOn      string `json:"expires_on"`
+	ReminderDays   *int32 `json:"reminder_days"`
+	Notes          string `json:"notes"`
+}
+
+func (req fleetDocumentReq) input() (transport.DocumentInput, error) {
+	in := transport.DocumentInput{
+		VehicleID:      req.VehicleID,
+		DriverID:       req.DriverID,
+		DocType:        req.DocType,
+		DocumentNumber: req.DocumentNumber,
+		Issuer:         req.Issuer,
+		ReminderDays:   req.ReminderDays,
+		Notes:          req.Notes,
+	}
+	var err error
+	if in.IssuedOn, err = optionalDate(req.IssuedOn, "issued_on"); err != nil {
+		return in, err
+	}
+	in.ExpiresOn, err = optionalDate(req.ExpiresOn, "expires_on")
+	return in, err
+}
+
+func (h *Handler) ListFleetDocuments(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	f := transport.ListDocumentsFilter{
+		VehicleID:   q.Get("vehicle_id"),
+		DriverID:    q.Get("driver_id"),
+		CurrentOnly: q.Get("current") == "true",
+	}
+	if raw := q.Get("expiring_within_days"); raw != "" {
+		days, err := strconv.Atoi(raw)
+		if err != nil {
+			http.Error(w, "expiring_within_days must be a number", http.StatusBadRequest)
+			return
+		}
+		f.ExpiringWithinDays = &days
+	}
+	docs, err := h.fleet.ListDocuments(r.Context(), middleware.GetTenantID(r.Context()), f)
+	if err != nil {
+		writeFleetError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, docs)
+}
+
+func (h *Handler) CreateFleetDocument(w http.ResponseWriter, r *http.Request) {
+	var req fleetDocumentReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	in, err := req.input()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	doc, err := h.fleet.CreateDocument(r.Context(), middleware.GetTenantID(r.Context()), in, trackingActor(r))
+	if err != nil {
+		writeFleetError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusCreated, doc)
+}
+
+func (h *Handler) UpdateFleetDocument(w http.ResponseWriter, r *http.Request) {
+	var req fleetDocumentReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	in, err := req.input()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	doc, err := h.fleet.UpdateDocument(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"), in, trackingActor(r))
+	if err != nil {
+		writeFleetError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, doc)
+}
+
+func (h *Handler) DeleteFleetDocument(w http.ResponseWriter, r *http.Request) {
+	if err := h.fleet.DeleteDocument(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"), trackingActor(r)); err != nil {
+		writeFleetError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) FleetCompliance(w http.ResponseWriter, r *http.Request) {
+	report, err := h.fleet.ComplianceReport(r.Context(), middleware.GetTenantID(r.Context()))
+	if err != nil {
+		writeFleetError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, report)
+}
+
+// Service schedules
+
+type serviceScheduleReq struct {
+	VehicleID       string `json:"vehicle_id"`
+	Name            string `json:"name"`
+	IntervalKm      *int32 `json:"interval_km"`
+	IntervalDays    *int32 `json:"interval_days"`
+	LastServiceKm   *int32 `json:"last_service_km"`
+	LastServiceDate string `json:"last_service_date"`
+	DueSoonKm       *int32 `json:"due_soon_km"`
+	DueSoonDays     *int32 `json:"due_soon_days"`
+	IsActive        *bool  `json:"is_active"`
+}
+
+func (req serviceScheduleReq) input() (transport.ScheduleInput, error) {
+	in := transport.ScheduleInput{
+		VehicleID:     req.VehicleID,
+		Name:          req.Name,
+		IntervalKm:    req.IntervalKm,
+		IntervalDays:  req.IntervalDays,
+		LastServiceKm: req.LastServiceKm,
+		DueSoonKm:     req.DueSoonKm,
+		DueSoonDays:   req.DueSoonDays,
+		IsActive:      req.IsActive,
+	}
+	var err error
+	in.LastServiceDate, err = optionalDate(req.LastServiceDate, "last_service_date")
+	return in, err
+}
+
+func (h *Handler) ListServiceSchedules(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	schedules, err := h.fleet.ListSchedules(r.Context(), middleware.GetTenantID(r.Context()), q.Get("vehicle_id"), q.Get("status"))
+	if err != nil {
+		writeFleetError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, schedules)
+}
+
+func (h *Handler) CreateServiceSchedule(w http.ResponseWriter, r *http.Request) {
+	var req serviceScheduleReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	in, err := req.input()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	schedule, err := h.fleet.CreateSchedule(r.Context(), middleware.GetTenantID(r.Context()), in, trackingActor(r))
+	if err != nil {
+		writeFleetError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusCreated, schedule)
+}
+
+func (h *Handler) UpdateServiceSchedule(w http.ResponseWriter, r *http.Request) {
+	var req serviceScheduleReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	in, err := req.input()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	schedule, err := h.fleet.UpdateSchedule(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"), in, trackingActor(r))
+	if err != nil {
+		writeFleetError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, schedule)
+}
+
+// Work orders
+
+type workOrderReq struct {
+	VehicleID   string  `json:"vehicle_id"`
+	ScheduleID  string  `json:"schedule_id"`
+	Title       string  `json:"title"`
+	Description string  `json:"description"`
+	Vendor      string  `json:"vendor"`
+	Status      string  `json:"status"`
+	OdometerKm  *int32  `json:"odometer_km"`
+	LabourCost  float64 `json:"labour_cost"`
+	PartsCost   float64 `json:"parts_cost"`
+	OpenedOn    string  `json:"opened_on"`
+	CompletedOn string  `json:"completed_on"`
+}
+
+func (req workOrderReq) input() (transport.WorkOrderInput, error) {
+	in := transport.WorkOrderInput{
+		VehicleID:   req.VehicleID,
+		ScheduleID:  req.ScheduleID,
+		Title:       req.Title,
+		Description: req.Description,
+		Vendor:      req.Vendor,
+		Status:      req.Status,
+		OdometerKm:  req.OdometerKm,
+		LabourCost:  req.LabourCost,
+		PartsCost:   req.PartsCost,
+	}
+	var err error
+	if in.OpenedOn, err = optionalDate(req.OpenedOn, "opened_on"); err != nil {
+		return in, err
+	}
+	in.CompletedOn, err = optionalDate(req.CompletedOn, "completed_on")
+	return in, err
+}
+
+func (h *Handler) ListWorkOrders(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	orders, err := h.fleet.ListWorkOrders(r.Context(), middleware.GetTenantID(r.Context()), q.Get("vehicle_id"), q.Get("status"))
+	if err != nil {
+		writeFleetError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, orders)
+}
+
+func (h *Handler) CreateWorkOrder(w http.ResponseWriter, r *http.Request) {
+	var req workOrderReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	in, err := req.input()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	order, err := h.fleet.CreateWorkOrder(r.Context(), middleware.GetTenantID(r.Context()), in, trackingActor(r))
+	if err != nil {
+		writeFleetError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusCreated, order)
+}
+
+func (h *Handler) UpdateWorkOrder(w http.ResponseWriter, r *http.Request) {
+	var req workOrderReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	in, err := req.input()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	order, err := h.fleet.UpdateWorkOrder(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"), in, trackingActor(r))
+	if err != nil {
+		writeFleetError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, order)
+}
+
+// Analytics
+
+func (h *Handler) FuelEfficiency(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	from, okFrom := parseDate(q.Get("from"))
+	to, okTo := parseDate(q.Get("to"))
+	if !okFrom || !okTo {
+		http.Error(w, "from and to must be in YYYY-MM-DD format", http.StatusBadRequest)
+		return
+	}
+	rows, err := h.fleet.FuelEfficiency(r.Context(), middleware.GetTenantID(r.Context()), q.Get("vehicle_id"), from, to)
+	if err != nil {
+		writeFleetError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, rows)
+}
+
+func writeFleetError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, transport.ErrInvalidFleet):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, transport.ErrDocumentNotFound), errors.Is(err, transport.ErrScheduleNotFound),
+		errors.Is(err, transport.ErrWorkOrderNotFound), errors.Is(err, transport.ErrVehicleNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, transport.ErrScheduleExists), errors.Is(err, transport.ErrWorkOrderClosed):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		log.Error().Err(err).Msg("transport fleet request failed")
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,209 @@
+package transport
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/rs/zerolog/log"
+	"github.com/schoolerp/api/internal/db"
+	"github.com/schoolerp/api/internal/middleware"
+	"github.com/schoolerp/api/internal/service/transport"
+)
+
+func (h *Handler) registerPlanningRoutes(r chi.Router) {
+	r.Get("/transport/planning/settings", h.GetPlanningSettings)
+	r.Put("/transport/planning/settings", h.UpdatePlanningSettings)
+	r.Get("/transport/planning/pickup-points", h.ListPickupPoints)
+	r.Put("/transport/planning/pickup-points", h.SavePickupPoints)
+	r.Delete("/transport/planning/pickup-points/{student_id}", h.DeletePickupPoint)
+
+	r.Get("/transport/planning/plans", h.ListRoutePlans)
+	r.Post("/transport/planning/plans", h.CreateRoutePlan)
+	r.Post("/transport/planning/rebalance", h.CreateRebalancePlan)
+	r.Get("/transport/planning/plans/{id}", h.GetRoutePlan)
+	r.Post("/transport/planning/plans/{id}/apply", h.ApplyRoutePlan)
+	r.Post("/transport/planning/plans/{id}/discard", h.DiscardRoutePlan)
+}
+
+// Settings
+
+type planningSettingsReq struct {
+	SchoolLatitude  *float64 `json:"school_latitude"`
+	SchoolLongitude *float64 `json:"school_longitude"`
+	ArriveBy        string   `json:"arrive_by"`
+	MaxRideMinutes  int32    `json:"max_ride_minutes"`
+	WalkRadiusM     int32    `json:"walk_radius_m"`
+	SpeedKmph       int32    `json:"speed_kmph"`
+}
+
+func optionalCoord(v *float64) pgtype.Float8 {
+	if v == nil {
+		return pgtype.Float8{}
+	}
+	return pgtype.Float8{Float64: *v, Valid: true}
+}
+
+func (h *Handler) GetPlanningSettings(w http.ResponseWriter, r *http.Request) {
+	settings, err := h.planning.GetSettings(r.Context(), middleware.GetTenantID(r.Context()))
+	if err != nil {
+		writePlanningError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, settings)
+}
+
+func (h *Handler) UpdatePlanningSettings(w http.ResponseWriter, r *http.Request) {
+	var req planningSettingsReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	in := db.TransportPlanningSettings{
+		SchoolLatitude:  optionalCoord(req.SchoolLatitude),
+		SchoolLongitude: optionalCoord(req.SchoolLongitude),
+		ArriveBy:        req.ArriveBy,
+		MaxRideMinutes:  req.MaxRideMinutes,
+		WalkRadiusM:     req.WalkRadiusM,
+		SpeedKmph:       req.SpeedKmph,
+	}
+	settings, err := h.planning.UpdateSettings(r.Context(), middleware.GetTenantID(r.Context()), in, trackingActor(r))
+	if err != nil {
+		writePlanningError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, settings)
+}
+
+// Pickup points
+
+func (h *Handler) ListPickupPoints(w http.ResponseWriter, r *http.Request) {
+	points, err := h.planning.ListPickupPoints(r.Context(), middleware.GetTenantID(r.Context()))
+	if err != nil {
+		writePlanningError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, points)
+}
+
+func (h *Handler) SavePickupPoints(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Points []transport.PickupPointInput `json:"points"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	saved, err := h.planning.SavePickupPoints(r.Context(), middleware.GetTenantID(r.Context()), req.Points, trackingActor(r))
+	if err != nil {
+		writePlanningError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]any{"received": len(req.Points), "saved": saved})
+}
+
+func (h *Handler) DeletePickupPoint(w http.ResponseWriter, r *http.Request) {
+	err := h.planning.DeletePickupPoint(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "student_id"), trackingActor(r))
+	if err != nil {
+		writePlanningError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Plans
+
+func (h *Handler) ListRoutePlans(w http.ResponseWriter, r *http.Request) {
+	plans, err := h.planning.ListPlans(r.Context(), middleware.GetTenantID(r.Context()))
+	if err != nil {
+		writePlanningError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, plans)
+}
+
+func (h *Handler) CreateRoutePlan(w http.ResponseWriter, r *http.Request) {
+	var req transport.PlanRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	plan, err := h.planning.CreatePlan(r.Context(), middleware.GetTenantID(r.Context()), req, trackingActor(r))
+	if err != nil {
+		writePlanningError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusCreated, plan)
+}
+
+func (h *Handler) CreateRebalancePlan(w http.ResponseWriter, r *http.Request) {
+	var req transport.PlanRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	plan, err := h.planning.CreateRebalance(r.Context(), middleware.GetTenantID(r.Context()), req, trackingActor(r))
+	if err != nil {
+		writePlanningError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusCreated, plan)
+}
+
+func (h *Handler) GetRoutePlan(w http.ResponseWriter, r *http.Request) {
+	plan, err := h.planning.GetPlan(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"))
+	if err != nil {
+		writePlanningError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, plan)
+}
+
+func (h *Handler) ApplyRoutePlan(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		EffectiveDate string `json:"effective_date"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+	effective, err := optionalDate(req.EffectiveDate, "effective_date")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	out, err := h.planning.ApplyPlan(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"), effective, trackingActor(r))
+	if err != nil {
+		writePlanningError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, out)
+}
+
+func (h *Handler) DiscardRoutePlan(w http.ResponseWriter, r *http.Request) {
+	plan, err := h.planning.DiscardPlan(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"), trackingActor(r))
+	if err != nil {
+		writePlanningError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, plan)
+}
+
+func writePlanningError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, transport.ErrInvalidPlan):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, transport.ErrPlanNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, transport.ErrPlanClosed), errors.Is(err, transport.ErrPlanStale),
+		errors.Is(err, transport.ErrVehicleNonCompliant):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		log.Error().Err(err).Msg("transport planning request failed")
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+	}
+}
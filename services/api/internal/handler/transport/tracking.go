@@ -0,0 +1,423 @@
+package transport
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+	"github.com/schoolerp/api/internal/db"
+	"github.com/schoolerp/api/internal/middleware"
+	"github.com/schoolerp/api/internal/service/transport"
+)
+
+func (h *Handler) registerTrackingRoutes(r chi.Router) {
+	// Live tracking
+	r.Get("/transport/tracking/settings", h.GetTrackingSettings)
+	r.Put("/transport/tracking/settings", h.UpdateTrackingSettings)
+	r.Post("/transport/tracking/pings", h.IngestPings)
+	r.Get("/transport/tracking/live", h.ListLiveTrips)
+	r.Get("/transport/tracking/alerts", h.ListTrackingAlerts)
+	r.Post("/transport/tracking/alerts/{id}/acknowledge", h.AcknowledgeTrackingAlert)
+	r.Put("/transport/stops/{id}/location", h.SetStopLocation)
+
+	// Trips
+	r.Post("/transport/trips", h.StartTrip)
+	r.Get("/transport/trips", h.ListTrips)
+	r.Get("/transport/trips/{id}/live", h.GetTripLive)
+	r.Get("/transport/trips/{id}/replay", h.GetTripReplay)
+	r.Post("/transport/trips/{id}/end", h.EndTrip)
+
+	// Trip attendance
+	r.Post("/transport/trips/schedule", h.ScheduleTrips)
+	r.Post("/transport/trips/{id}/check-in", h.CheckInTrip)
+	r.Get("/transport/trips/{id}/boardings", h.ListTripBoardings)
+	r.Post("/transport/trips/{id}/boardings", h.RecordBoarding)
+	r.Post("/transport/trips/{id}/alightings", h.RecordAlighting)
+	r.Post("/transport/trips/{id}/scans", h.RecordScan)
+	r.Put("/transport/vehicles/{id}/reader", h.SetVehicleReader)
+
+	// Reports
+	r.Get("/transport/reports/routes", h.RouteSummaryReport)
+	r.Get("/transport/reports/routes/{id}/roster", h.RouteRosterReport)
+}
+
+// RegisterParentRoutes lets parents follow their children's buses.
+func (h *Handler) RegisterParentRoutes(r chi.Router) {
+	r.Get("/transport/live", h.ListChildBuses)
+}
+
+func trackingActor(r *http.Request) transport.TrackingActor {
+	ctx := r.Context()
+	return transport.TrackingActor{
+		UserID:    middleware.GetUserID(ctx),
+		RequestID: middleware.GetReqID(ctx),
+		IP:        r.RemoteAddr,
+	}
+}
+
+func (h *Handler) GetTrackingSettings(w http.ResponseWriter, r *http.Request) {
+	settings, err := h.tracking.GetSettings(r.Context(), middleware.GetTenantID(r.Context()))
+	if err != nil {
+		writeTrackingError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, settings)
+}
+
+func (h *Handler) UpdateTrackingSettings(w http.ResponseWriter, r *http.Request) {
+	var req db.TransportTrackingSettings
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	settings, err := h.tracking.UpdateSettings(r.Context(), middleware.GetTenantID(r.Context()), req, trackingActor(r))
+	if err != nil {
+		writeTrackingError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, settings)
+}
+
+type ingestPingsReq struct {
+	VehicleID          string                `json:"vehicle_id"`
+	RegistrationNumber string                `json:"registration_number"`
+	Source             string                `json:"source"`
+	Pings              []transport.PingInput `json:"pings"`
+}
+
+// IngestPings accepts positions from driver phones and AIS-140 devices. A
+// device identifies its vehicle by id or registration number.
+func (h *Handler) IngestPings(w http.ResponseWriter, r *http.Request) {
+	var req ingestPingsReq
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.VehicleID == "" && req.RegistrationNumber == "" {
+		http.Error(w, "vehicle_id or registration_number is required", http.StatusBadRequest)
+		return
+	}
+	result, err := h.tracking.IngestPings(r.Context(), transport.IngestPingsParams{
+		TenantID:           middleware.GetTenantID(r.Context()),
+		VehicleID:          req.VehicleID,
+		RegistrationNumber: req.RegistrationNumber,
+		Source:             req.Source,
+		Pings:              req.Pings,
+	})
+	if err != nil {
+		writeTrackingError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusAccepted, result)
+}
+
+func (h *Handler) ListLiveTrips(w http.ResponseWriter, r *http.Request) {
+	trips, err := h.tracking.ListLiveTrips(r.Context(), middleware.GetTenantID(r.Context()))
+	if err != nil {
+		writeTrackingError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, trips)
+}
+
+func (h *Handler) ListTrackingAlerts(w http.ResponseWriter, r *http.Request) {
+	openOnly := r.URL.Query().Get("open") == "true"
+	alerts, err := h.tracking.ListAlerts(r.Context(), middleware.GetTenantID(r.Context()), r.URL.Query().Get("trip_id"), openOnly)
+	if err != nil {
+		writeTrackingError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, alerts)
+}
+
+func (h *Handler) AcknowledgeTrackingAlert(w http.ResponseWriter, r *http.Request) {
+	alert, err := h.tracking.AcknowledgeAlert(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"), trackingActor(r))
+	if err != nil {
+		writeTrackingError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, alert)
+}
+
+func (h *Handler) SetStopLocation(w http.ResponseWriter, r *http.Request) {
+	var req transport.LatLng
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := h.tracking.SetStopLocation(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"), req); err != nil {
+		writeTrackingError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type startTripReq struct {
+	RouteID   string `json:"route_id"`
+	Direction string `json:"direction"`
+}
+
+func (h *Handler) StartTrip(w http.ResponseWriter, r *http.Request) {
+	var req startTripReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.RouteID == "" {
+		http.Error(w, "route_id is required", http.StatusBadRequest)
+		return
+	}
+	trip, err := h.tracking.StartTrip(r.Context(), middleware.GetTenantID(r.Context()), req.RouteID, req.Direction, trackingActor(r))
+	if err != nil {
+		writeTrackingError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusCreated, trip)
+}
+
+func (h *Handler) ListTrips(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := transport.ListTripsFilter{RouteID: q.Get("route_id"), Status: q.Get("status")}
+	if raw := q.Get("date"); raw != "" {
+		date, ok := parseDate(raw)
+		if !ok {
+			http.Error(w, "date must be in YYYY-MM-DD format", http.StatusBadRequest)
+			return
+		}
+		filter.Date = date
+	}
+	if raw := q.Get("limit"); raw != "" {
+		limit, _ := strconv.Atoi(raw)
+		filter.Limit = int32(limit)
+	}
+	trips, err := h.tracking.ListTrips(r.Context(), middleware.GetTenantID(r.Context()), filter)
+	if err != nil {
+		writeTrackingError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, trips)
+}
+
+func (h *Handler) GetTripLive(w http.ResponseWriter, r *http.Request) {
+	live, err := h.tracking.GetTripLive(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"))
+	if err != nil {
+		writeTrackingError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, live)
+}
+
+func (h *Handler) GetTripReplay(w http.ResponseWriter, r *http.Request) {
+	replay, err := h.tracking.GetTripReplay(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"))
+	if err != nil {
+		writeTrackingError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, replay)
+}
+
+func (h *Handler) EndTrip(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Cancel bool `json:"cancel"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+	trip, err := h.tracking.EndTrip(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"), req.Cancel, trackingActor(r))
+	if err != nil {
+		writeTrackingError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, trip)
+}
+
+func parseDate(raw string) (time.Time, bool) {
+	date, err := time.Parse("2006-01-02", raw)
+	return date, err == nil
+}
+
+func (h *Handler) ScheduleTrips(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Date string `json:"date"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	date, ok := parseDate(req.Date)
+	if !ok {
+		http.Error(w, "date must be in YYYY-MM-DD format", http.StatusBadRequest)
+		return
+	}
+	created, err := h.tracking.ScheduleTrips(r.Context(), middleware.GetTenantID(r.Context()), date, trackingActor(r))
+	if err != nil {
+		writeTrackingError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]any{"trip_date": req.Date, "created": created})
+}
+
+func (h *Handler) CheckInTrip(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Role       string `json:"role"`
+		EmployeeID string `json:"employee_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	trip, err := h.tracking.CheckIn(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"), req.Role, req.EmployeeID, trackingActor(r))
+	if err != nil {
+		writeTrackingError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, trip)
+}
+
+func (h *Handler) ListTripBoardings(w http.ResponseWriter, r *http.Request) {
+	boardings, err := h.tracking.GetTripBoardings(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"))
+	if err != nil {
+		writeTrackingError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, boardings)
+}
+
+type markReq struct {
+	StudentID  string    `json:"student_id"`
+	Method     string    `json:"method"`
+	Identifier string    `json:"identifier"`
+	Action     string    `json:"action"`
+	StopID     string    `json:"stop_id"`
+	ScannedAt  time.Time `json:"scanned_at"`
+}
+
+func (h *Handler) mark(w http.ResponseWriter, r *http.Request, req markReq) {
+	result, err := h.tracking.Mark(r.Context(), transport.MarkParams{
+		TenantID:   middleware.GetTenantID(r.Context()),
+		TripID:     chi.URLParam(r, "id"),
+		StudentID:  req.StudentID,
+		Identifier: req.Identifier,
+		Method:     req.Method,
+		Action:     req.Action,
+		StopID:     req.StopID,
+		At:         req.ScannedAt,
+		Actor:      trackingActor(r),
+	})
+	if err != nil {
+		writeTrackingError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, result)
+}
+
+// RecordBoarding and RecordAlighting are the attendant's manual marks.
+func (h *Handler) RecordBoarding(w http.ResponseWriter, r *http.Request) {
+	h.recordManual(w, r, "board")
+}
+
+func (h *Handler) RecordAlighting(w http.ResponseWriter, r *http.Request) {
+	h.recordManual(w, r, "alight")
+}
+
+func (h *Handler) recordManual(w http.ResponseWriter, r *http.Request, action string) {
+	var req markReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.StudentID == "" {
+		http.Error(w, "student_id is required", http.StatusBadRequest)
+		return
+	}
+	h.mark(w, r, markReq{StudentID: req.StudentID, Method: "manual", Action: action, StopID: req.StopID})
+}
+
+// RecordScan marks a student by the RFID tag or QR code on their card, read
+// by the attendant's app.
+func (h *Handler) RecordScan(w http.ResponseWriter, r *http.Request) {
+	var req markReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Method != "rfid" && req.Method != "qr" {
+		http.Error(w, "method must be rfid or qr", http.StatusBadRequest)
+		return
+	}
+	req.StudentID = ""
+	h.mark(w, r, req)
+}
+
+func (h *Handler) SetVehicleReader(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		DeviceID string `json:"device_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := h.tracking.SetVehicleReader(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"), req.DeviceID); err != nil {
+		writeTrackingError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) RouteSummaryReport(w http.ResponseWriter, r *http.Request) {
+	from, okFrom := parseDate(r.URL.Query().Get("from"))
+	to, okTo := parseDate(r.URL.Query().Get("to"))
+	if !okFrom || !okTo {
+		http.Error(w, "from and to must be in YYYY-MM-DD format", http.StatusBadRequest)
+		return
+	}
+	rows, err := h.tracking.RouteSummaries(r.Context(), middleware.GetTenantID(r.Context()), from, to)
+	if err != nil {
+		writeTrackingError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, rows)
+}
+
+func (h *Handler) RouteRosterReport(w http.ResponseWriter, r *http.Request) {
+	date, ok := parseDate(r.URL.Query().Get("date"))
+	if !ok {
+		http.Error(w, "date must be in YYYY-MM-DD format", http.StatusBadRequest)
+		return
+	}
+	rows, err := h.tracking.RouteRoster(r.Context(), middleware.GetTenantID(r.Context()), chi.URLParam(r, "id"), date)
+	if err != nil {
+		writeTrackingError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, rows)
+}
+
+func (h *Handler) ListChildBuses(w http.ResponseWriter, r *http.Request) {
+	buses, err := h.tracking.ListChildBuses(r.Context(), middleware.GetTenantID(r.Context()), middleware.GetUserID(r.Context()))
+	if err != nil {
+		writeTrackingError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, buses)
+}
+
+func writeTrackingError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, transport.ErrInvalidTracking):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, transport.ErrTripNotFound), errors.Is(err, transport.ErrVehicleNotFound),
+		errors.Is(err, transport.ErrAlertNotFound), errors.Is(err, transport.ErrStopNotFound),
+		errors.Is(err, transport.ErrRouteUntrackable), errors.Is(err, transport.ErrUnknownCard):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, transport.ErrTripConflict), errors.Is(err, transport.ErrStudentNotOnTrip),
+		errors.Is(err, transport.ErrCheckInRejected), errors.Is(err, transport.ErrReaderInUse):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		log.Error().Err(err).Msg("transport tracking request failed")
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+	}
+}
@@ -2,6 +2,7 @@ package transport
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strings"
 	"time"
@@ -13,11 +14,15 @@ import (
 )
 
 type Handler struct {
-	svc *transport.TransportService
+	svc      *transport.TransportService
+	tracking *transport.TrackingService
+	fleet    *transport.FleetService
+	planning *transport.PlanningService
+	fees     *transport.FeeService
 }
 
-func NewHandler(svc *transport.TransportService) *Handler {
-	return &Handler{svc: svc}
+func NewHandler(svc *transport.TransportService, tracking *transport.TrackingService, fleet *transport.FleetService, planning *transport.PlanningService, fees *transport.FeeService) *Handler {
+	return &Handler{svc: svc, tracking: tracking, fleet: fleet, planning: planning, fees: fees}
 }
 
 func (h *Handler) RegisterRoutes(r chi.Router) {
@@ -49,6 +54,11 @@ func (h *Handler) RegisterRoutes(r chi.Router) {
 
 	// Fee Generation (Bulk)
 	r.Post("/transport/generate-fees", h.GenerateFees)
+
+	h.registerTrackingRoutes(r)
+	h.registerFleetRoutes(r)
+	h.registerPlanningRoutes(r)
+	h.registerFeeRoutes(r)
 }
 
 // Vehicle Handlers
@@ -273,6 +283,10 @@ func (h *Handler) CreateRoute(w http.ResponseWriter, r *http.Request) {
 		IP:          r.RemoteAddr,
 	})
 
+	if errors.Is(err, transport.ErrVehicleNonCompliant) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -304,6 +318,10 @@ func (h *Handler) UpdateRoute(w http.ResponseWriter, r *http.Request) {
 		IP:          r.RemoteAddr,
 	})
 
+	if errors.Is(err, transport.ErrVehicleNonCompliant) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -323,8 +341,10 @@ func (h *Handler) ListRoutes(w http.ResponseWriter, r *http.Request) {
 // Stop Handlers
 
 type createStopReq struct {
-	Name          string `json:"name"`
-	SequenceOrder int32  `json:"sequence_order"`
+	Name          string   `json:"name"`
+	SequenceOrder int32    `json:"sequence_order"`
+	Latitude      *float64 `json:"latitude"`
+	Longitude     *float64 `json:"longitude"`
 }
 
 func (h *Handler) CreateRouteStop(w http.ResponseWriter, r *http.Request) {
@@ -339,6 +359,15 @@ func (h *Handler) CreateRouteStop(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if (req.Latitude == nil) != (req.Longitude == nil) {
+		http.Error(w, "latitude and longitude must be sent together", http.StatusBadRequest)
+		return
+	}
+	if req.Latitude != nil && !(transport.LatLng{Lat: *req.Latitude, Lng: *req.Longitude}).Valid() {
+		http.Error(w, "latitude or longitude out of range", http.StatusBadRequest)
+		return
+	}
+
 	stop, err := h.svc.CreateRouteStop(r.Context(), transport.CreateStopParams{
 		RouteID:       routeID,
 		Name:          req.Name,
@@ -349,6 +378,15 @@ func (h *Handler) CreateRouteStop(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if req.Latitude != nil {
+		pos := transport.LatLng{Lat: *req.Latitude, Lng: *req.Longitude}
+		if err := h.tracking.SetStopLocation(r.Context(), middleware.GetTenantID(r.Context()), stop.ID.String(), pos); err != nil {
+			writeTrackingError(w, err)
+			return
+		}
+		stop.Latitude = pgtype.Float8{Float64: pos.Lat, Valid: true}
+		stop.Longitude = pgtype.Float8{Float64: pos.Lng, Valid: true}
+	}
 	respondJSON(w, http.StatusCreated, stop)
 }
 
@@ -370,6 +408,7 @@ type createAllocationReq struct {
 	StopID    string `json:"stop_id"`
 	StartDate string `json:"start_date"`
 	Status    string `json:"status"`
+	TripType  string `json:"trip_type"`
 }
 
 func (h *Handler) CreateAllocation(w http.ResponseWriter, r *http.Request) {
@@ -383,6 +422,10 @@ func (h *Handler) CreateAllocation(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "student_id and route_id are required", http.StatusBadRequest)
 		return
 	}
+	if req.TripType != "" && !transport.ValidTripType(req.TripType) {
+		http.Error(w, "trip_type must be two_way, pickup or drop", http.StatusBadRequest)
+		return
+	}
 
 	var startDate pgtype.Date
 	if req.StartDate != "" {
@@ -409,6 +452,12 @@ func (h *Handler) CreateAllocation(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if req.TripType != "" {
+		if err := h.fees.SetAllocationTripType(ctx, middleware.GetTenantID(ctx), alloc.ID.String(), req.TripType, trackingActor(r)); err != nil {
+			writeFeeError(w, err)
+			return
+		}
+	}
 	respondJSON(w, http.StatusCreated, alloc)
 }
 
@@ -465,21 +514,6 @@ func (h *Handler) ListFuelLogs(w http.ResponseWriter, r *http.Request) {
 	respondJSON(w, http.StatusOK, logs)
 }
 
-func (h *Handler) GenerateFees(w http.ResponseWriter, r *http.Request) {
-	tenantID := middleware.GetTenantID(r.Context())
-	count, err := h.svc.GenerateTransportFees(r.Context(), tenantID)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	respondJSON(w, http.StatusOK, map[string]interface{}{
-		"message": "Transport fees generated successfully",
-		"count":   count,
-	})
-}
-
-
 // Helpers
 
 func respondJSON(w http.ResponseWriter, status int, payload interface{}) {
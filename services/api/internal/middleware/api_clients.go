@@ -0,0 +1,174 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/schoolerp/api/internal/foundation/apikeys"
+	"github.com/schoolerp/api/internal/foundation/ratelimit"
+)
+
+// APIClientIDKey holds the id of the API client a request was made with.
+const APIClientIDKey contextKey = "api_client_id"
+
+// APIClientAuthenticator resolves an API key or client-credentials access
+// token to its client. Errors other than an invalid credential are treated
+// as the credential store being unavailable.
+type APIClientAuthenticator interface {
+	Authenticate(ctx context.Context, credential, clientIP string) (apikeys.Principal, error)
+}
+
+var (
+	apiClientAuthMu sync.RWMutex
+	apiClientAuth   APIClientAuthenticator
+
+	// errAPICredentialDenied lets the authenticator mark a credential as
+	// invalid rather than the lookup as failed.
+	errAPICredentialDenied error
+)
+
+// SetAPIClientAuthenticator enables API key and access token authentication.
+// denied is the authenticator's error for an unknown, expired or revoked
+// credential.
+func SetAPIClientAuthenticator(a APIClientAuthenticator, denied error) {
+	apiClientAuthMu.Lock()
+	defer apiClientAuthMu.Unlock()
+	apiClientAuth = a
+	errAPICredentialDenied = denied
+}
+
+func currentAPIClientAuthenticator() (APIClientAuthenticator, error) {
+	apiClientAuthMu.RLock()
+	defer apiClientAuthMu.RUnlock()
+	return apiClientAuth, errAPICredentialDenied
+}
+
+// GetAPIClientID returns the API client of the request, if it was made with one.
+func GetAPIClientID(ctx context.Context) string {
+	if val, ok := ctx.Value(APIClientIDKey).(string); ok {
+		return val
+	}
+	return ""
+}
+
+// IsAPIClient reports whether the request was authenticated with an API client.
+func IsAPIClient(ctx context.Context) bool {
+	return GetAPIClientID(ctx) != ""
+}
+
+// apiClientCredential extracts an API credential: the X-API-Key header, or a
+// bearer token issued by the client-credentials grant.
+func apiClientCredential(r *http.Request) (string, bool) {
+	if key := strings.TrimSpace(r.Header.Get("X-API-Key")); key != "" {
+		return key, true
+	}
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && apikeys.IsAccessToken(strings.TrimSpace(token)) {
+		return strings.TrimSpace(token), true
+	}
+	return "", false
+}
+
+// serveAPIClient authenticates a request made with an API credential and
+// serves it as the client's service account: scoped to its tenant, to the
+// routes its scopes name and to its own rate limit.
+func serveAPIClient(w http.ResponseWriter, r *http.Request, next http.Handler, credential string) {
+	ctx := r.Context()
+	ip := clientIPForSecurity(r)
+	deny := func(status int, eventType, severity, message string, metadata map[string]any) {
+		RecordSecurityEvent(ctx, SecurityEvent{
+			TenantID:   GetTenantID(ctx),
+			UserID:     GetUserID(ctx),
+			Role:       GetRole(ctx),
+			EventType:  eventType,
+			Severity:   severity,
+			Method:     r.Method,
+			Path:       r.URL.Path,
+			StatusCode: status,
+			IPAddress:  ip,
+			UserAgent:  r.UserAgent(),
+			Origin:     r.Header.Get("Origin"),
+			Metadata:   metadata,
+		})
+		http.Error(w, message, status)
+	}
+
+	auth, denied := currentAPIClientAuthenticator()
+	if auth == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	principal, err := auth.Authenticate(ctx, credential, ip)
+	if err != nil {
+		if denied != nil && errors.Is(err, denied) {
+			deny(http.StatusUnauthorized, "auth.api_credential_rejected", "warning", "Unauthorized", nil)
+			return
+		}
+		log.Ctx(ctx).Error().Err(err).Str("path", r.URL.Path).Msg("api client authentication failed")
+		http.Error(w, "Credential store unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	// Everything below is attributed to the client's service account.
+	ctx = context.WithValue(ctx, APIClientIDKey, principal.ClientID)
+	if headerTenant := GetTenantID(ctx); headerTenant != "" && headerTenant != principal.TenantID {
+		ctx = context.WithValue(ctx, UserIDKey, principal.ServiceUserID)
+		ctx = context.WithValue(ctx, RoleKey, apikeys.ServiceAccountRole)
+		deny(http.StatusForbidden, "access.api_tenant_mismatch", "warning", "Forbidden", map[string]any{
+			"api_client_id": principal.ClientID,
+			"client_tenant": principal.TenantID,
+		})
+		return
+	}
+	ctx = context.WithValue(ctx, TenantIDKey, principal.TenantID)
+	ctx = context.WithValue(ctx, UserIDKey, principal.ServiceUserID)
+	ctx = context.WithValue(ctx, RoleKey, apikeys.ServiceAccountRole)
+	ctx = context.WithValue(ctx, PermissionsKey, apikeys.Permissions(principal.Scopes))
+	r = r.WithContext(ctx)
+
+	if !apikeys.Allows(principal.Scopes, r.Method, r.URL.Path) {
+		deny(http.StatusForbidden, "access.api_scope_denied", "warning", "Forbidden: API client scope does not cover this route", map[string]any{
+			"api_client_id": principal.ClientID,
+			"scopes":        principal.Scopes,
+		})
+		return
+	}
+
+	decision := currentRateLimiter().Take(ctx, []ratelimit.Request{{
+		Scope:  "api_client",
+		Key:    "api_client:" + principal.ClientID,
+		Limit:  principal.RateLimitPerMinute,
+		Window: time.Minute,
+	}})
+	writeRateLimitHeaders(w, decision)
+	if !decision.Allowed {
+		if shouldReportRateLimit("api_client:"+principal.ClientID, decision.Window) {
+			RecordSecurityEvent(ctx, SecurityEvent{
+				TenantID:   principal.TenantID,
+				UserID:     principal.ServiceUserID,
+				Role:       apikeys.ServiceAccountRole,
+				EventType:  "request.rate_limited",
+				Severity:   "warning",
+				Method:     r.Method,
+				Path:       r.URL.Path,
+				StatusCode: http.StatusTooManyRequests,
+				IPAddress:  ip,
+				UserAgent:  r.UserAgent(),
+				Metadata: map[string]any{
+					"limiter":       "api_client",
+					"api_client_id": principal.ClientID,
+					"limit_count":   decision.Limit,
+					"backend":       decision.Backend,
+				},
+			})
+		}
+		http.Error(w, "Too many requests", http.StatusTooManyRequests)
+		return
+	}
+
+	next.ServeHTTP(w, r)
+}
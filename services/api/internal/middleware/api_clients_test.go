@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/schoolerp/api/internal/foundation/apikeys"
+	"github.com/schoolerp/api/internal/foundation/ratelimit"
+)
+
+var errTestDenied = errors.New("denied")
+
+type stubAPIClients struct{}
+
+func (stubAPIClients) Authenticate(_ context.Context, credential, _ string) (apikeys.Principal, error) {
+	if credential != "serp_vendor.secret" && credential != "sat_token" {
+		return apikeys.Principal{}, errTestDenied
+	}
+	return apikeys.Principal{
+		ClientID:           "serp_vendor",
+		TenantID:           "tenant-a",
+		ServiceUserID:      "service-user",
+		Scopes:             []string{"transport:read"},
+		RateLimitPerMinute: 2,
+	}, nil
+}
+
+func TestAuthResolverServesAPIClients(t *testing.T) {
+	SetRateLimiter(ratelimit.New(nil, nil))
+	SetAPIClientAuthenticator(stubAPIClients{}, errTestDenied)
+	defer SetAPIClientAuthenticator(nil, nil)
+
+	var seenUser, seenRole, seenTenant string
+	handler := AuthResolver(RoleGuard("tenant_admin")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seenUser, seenRole, seenTenant = GetUserID(r.Context()), GetRole(r.Context()), GetTenantID(r.Context())
+		w.WriteHeader(http.StatusOK)
+	})))
+
+	call := func(method, path string, header, value string, tenant string) int {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set(header, value)
+		if tenant != "" {
+			req = req.WithContext(context.WithValue(req.Context(), TenantIDKey, tenant))
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	if code := call(http.MethodGet, "/v1/admin/transport/routes", "X-API-Key", "serp_vendor.secret", ""); code != http.StatusOK {
+		t.Fatalf("expected scoped request to pass, got %d", code)
+	}
+	if seenUser != "service-user" || seenRole != apikeys.ServiceAccountRole || seenTenant != "tenant-a" {
+		t.Fatalf("expected service-account identity, got %q/%q/%q", seenUser, seenRole, seenTenant)
+	}
+	if code := call(http.MethodGet, "/v1/admin/fees/invoices", "Authorization", "Bearer sat_token", ""); code != http.StatusForbidden {
+		t.Fatalf("expected route outside scope to be forbidden, got %d", code)
+	}
+	if code := call(http.MethodGet, "/v1/admin/transport/routes", "X-API-Key", "serp_vendor.secret", "tenant-b"); code != http.StatusForbidden {
+		t.Fatalf("expected another tenant to be forbidden, got %d", code)
+	}
+	if code := call(http.MethodGet, "/v1/admin/transport/routes", "X-API-Key", "serp_vendor.wrong", ""); code != http.StatusUnauthorized {
+		t.Fatalf("expected bad key to be rejected, got %d", code)
+	}
+	call(http.MethodGet, "/v1/admin/transport/routes", "Authorization", "Bearer sat_token", "")
+	if code := call(http.MethodGet, "/v1/admin/transport/routes", "X-API-Key", "serp_vendor.secret", ""); code != http.StatusTooManyRequests {
+		t.Fatalf("expected per-key limit to apply, got %d", code)
+	}
+}
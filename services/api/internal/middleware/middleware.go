@@ -22,6 +22,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/rs/zerolog/log"
 	"github.com/schoolerp/api/internal/db"
+	"github.com/schoolerp/api/internal/foundation/apikeys"
 	"github.com/schoolerp/api/internal/foundation/security"
 	"github.com/schoolerp/api/internal/foundation/sessionstore"
 )
@@ -307,6 +308,12 @@ func AuthResolver(next http.Handler) http.Handler {
 			return
 		}
 
+		// API clients authenticate with their own credentials, not a session.
+		if credential, ok := apiClientCredential(r); ok {
+			serveAPIClient(w, r, next, credential)
+			return
+		}
+
 		authHeader := r.Header.Get("Authorization")
 		isProtectedPath := strings.HasPrefix(r.URL.Path, "/v1/admin") ||
 			strings.HasPrefix(r.URL.Path, "/v1/teacher") ||
@@ -552,6 +559,13 @@ func RoleGuard(allowedRoles ...string) func(http.Handler) http.Handler {
 				return
 			}
 
+			// API clients reach only the routes their scopes name, which
+			// AuthResolver has already checked.
+			if userRole == apikeys.ServiceAccountRole && IsAPIClient(r.Context()) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
 			// Check if userRole is in allowedRoles
 			for _, role := range allowedRoles {
 				if role == userRole {
@@ -6,9 +6,12 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/schoolerp/api/internal/foundation/ratelimit"
 )
 
 var (
@@ -137,6 +140,7 @@ func CORS(next http.Handler) http.Handler {
 			w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE, PATCH")
 			w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, X-Tenant-ID")
 			w.Header().Set("Access-Control-Allow-Credentials", "true")
+			w.Header().Set("Access-Control-Expose-Headers", "RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset, RateLimit-Policy, Retry-After")
 		}
 
 		if r.Method == "OPTIONS" {
@@ -165,85 +169,45 @@ func CORS(next http.Handler) http.Handler {
 	})
 }
 
-// Simple in-memory rate limiter
-type limiter struct {
-	counts map[string]int
-	mu     sync.Mutex
-}
-
-var authLimiter = &limiter{
-	counts: make(map[string]int),
-}
-
 var (
-	namedLimiterMu sync.Mutex
-	namedLimiters  = make(map[string]*limiter)
-)
+	rateLimiterMu sync.RWMutex
+	rateLimiter   = ratelimit.New(nil, nil)
 
-func getNamedLimiter(name string, window time.Duration) *limiter {
-	key := fmt.Sprintf("%s:%s", strings.TrimSpace(name), window.String())
+	rateLimitReportMu sync.Mutex
+	rateLimitReported = make(map[string]time.Time)
+)
 
-	namedLimiterMu.Lock()
-	defer namedLimiterMu.Unlock()
+const maxRateLimitReports = 10000
 
-	if existing, ok := namedLimiters[key]; ok {
-		return existing
+// SetRateLimiter configures the shared limiter behind RateLimit, RateLimitByKey
+// and RateLimitGroup. Until it is called limits are kept in process memory.
+func SetRateLimiter(l *ratelimit.Limiter) {
+	if l == nil {
+		return
 	}
+	rateLimiterMu.Lock()
+	rateLimiter = l
+	rateLimiterMu.Unlock()
+}
 
-	created := &limiter{counts: make(map[string]int)}
-	namedLimiters[key] = created
-
-	go func(l *limiter, d time.Duration) {
-		ticker := time.NewTicker(d)
-		defer ticker.Stop()
-		for range ticker.C {
-			l.mu.Lock()
-			l.counts = make(map[string]int)
-			l.mu.Unlock()
-		}
-	}(created, window)
-
-	return created
+// InvalidateRateLimitPolicy makes this replica reload the platform rate limit
+// policy on the next request. Other replicas pick it up within 30 seconds.
+func InvalidateRateLimitPolicy() {
+	currentRateLimiter().InvalidatePolicy()
 }
 
-func init() {
-	go func() {
-		for {
-			time.Sleep(1 * time.Minute)
-			authLimiter.mu.Lock()
-			authLimiter.counts = make(map[string]int)
-			authLimiter.mu.Unlock()
-		}
-	}()
+func currentRateLimiter() *ratelimit.Limiter {
+	rateLimiterMu.RLock()
+	defer rateLimiterMu.RUnlock()
+	return rateLimiter
 }
 
 // RateLimit restricts the number of requests to sensitive paths
 func RateLimit(next http.Handler) http.Handler {
+	defaults := ratelimit.GroupPolicy{PerClient: &ratelimit.Quota{Limit: 20, WindowSeconds: 60}}
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if strings.HasPrefix(r.URL.Path, "/v1/auth") {
-			ip := clientIPForSecurity(r)
-			authLimiter.mu.Lock()
-			authLimiter.counts[ip]++
-			count := authLimiter.counts[ip]
-			authLimiter.mu.Unlock()
-
-			if count > 20 { // 20 req/min limit
-				if count == 21 {
-					RecordSecurityEvent(r.Context(), SecurityEvent{
-						EventType:  "auth.rate_limited",
-						Severity:   "warning",
-						Method:     r.Method,
-						Path:       r.URL.Path,
-						StatusCode: http.StatusTooManyRequests,
-						IPAddress:  ip,
-						UserAgent:  r.UserAgent(),
-						Origin:     r.Header.Get("Origin"),
-						Metadata: map[string]any{
-							"limit_per_minute": 20,
-						},
-					})
-				}
-				http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			if !enforceRateLimit(w, r, "auth", defaults, clientIPForSecurity(r), "auth.rate_limited") {
 				return
 			}
 		}
@@ -251,8 +215,9 @@ func RateLimit(next http.Handler) http.Handler {
 	})
 }
 
-// RateLimitByKey applies a fixed-window in-memory rate limit for a derived key.
-// Use for lightweight endpoint protection where Redis-based limiting is not configured.
+// RateLimitByKey limits a route per derived key (the client IP by default).
+// name doubles as the route group, so platform admins can override the quota
+// or add per-tenant and per-user quotas for it.
 func RateLimitByKey(name string, limit int, window time.Duration, keyFn func(*http.Request) string) func(http.Handler) http.Handler {
 	if limit <= 0 {
 		limit = 60
@@ -260,8 +225,9 @@ func RateLimitByKey(name string, limit int, window time.Duration, keyFn func(*ht
 	if window <= 0 {
 		window = time.Minute
 	}
-
-	l := getNamedLimiter(name, window)
+	windowSeconds := int((window + time.Second - 1) / time.Second)
+	group := strings.TrimSpace(name)
+	defaults := ratelimit.GroupPolicy{PerClient: &ratelimit.Quota{Limit: limit, WindowSeconds: windowSeconds}}
 
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -272,43 +238,124 @@ func RateLimitByKey(name string, limit int, window time.Duration, keyFn func(*ht
 			if key == "" {
 				key = clientIPForSecurity(r)
 			}
-
-			l.mu.Lock()
-			l.counts[key]++
-			count := l.counts[key]
-			l.mu.Unlock()
-
-			if count > limit {
-				if count == limit+1 {
-					RecordSecurityEvent(r.Context(), SecurityEvent{
-						TenantID:   GetTenantID(r.Context()),
-						UserID:     GetUserID(r.Context()),
-						Role:       GetRole(r.Context()),
-						EventType:  "request.rate_limited",
-						Severity:   "warning",
-						Method:     r.Method,
-						Path:       r.URL.Path,
-						StatusCode: http.StatusTooManyRequests,
-						IPAddress:  clientIPForSecurity(r),
-						UserAgent:  r.UserAgent(),
-						Origin:     r.Header.Get("Origin"),
-						Metadata: map[string]any{
-							"limiter":     name,
-							"window":      window.String(),
-							"limit_count": limit,
-							"key":         key,
-						},
-					})
-				}
-				http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			if !enforceRateLimit(w, r, group, defaults, key, "request.rate_limited") {
 				return
 			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
 
+// RateLimitGroup applies the platform-configured quotas for a route group.
+// Mount it after AuthResolver so per-tenant and per-user quotas can apply;
+// groups without configuration pass straight through.
+func RateLimitGroup(group string) func(http.Handler) http.Handler {
+	group = strings.TrimSpace(group)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !enforceRateLimit(w, r, group, ratelimit.GroupPolicy{}, clientIPForSecurity(r), "request.rate_limited") {
+				return
+			}
 			next.ServeHTTP(w, r)
 		})
 	}
 }
 
+// enforceRateLimit charges the request against the group's quotas, writes the
+// RateLimit-* headers and, when rejected, the 429 response. It reports whether
+// the request may proceed.
+func enforceRateLimit(w http.ResponseWriter, r *http.Request, group string, defaults ratelimit.GroupPolicy, clientKey string, eventType string) bool {
+	ctx := r.Context()
+	limiter := currentRateLimiter()
+
+	quotas := defaults
+	if configured, ok := limiter.Policy(ctx).Group(group); ok {
+		quotas = quotas.Merge(configured)
+	}
+	reqs := quotas.Requests(group, clientKey, GetTenantID(ctx), GetUserID(ctx))
+	if len(reqs) == 0 {
+		return true
+	}
+
+	decision := limiter.Take(ctx, reqs)
+	writeRateLimitHeaders(w, decision)
+	if decision.Allowed {
+		return true
+	}
+
+	if shouldReportRateLimit(eventType+":"+decision.Key, decision.Window) {
+		RecordSecurityEvent(ctx, SecurityEvent{
+			TenantID:   GetTenantID(ctx),
+			UserID:     GetUserID(ctx),
+			Role:       GetRole(ctx),
+			EventType:  eventType,
+			Severity:   "warning",
+			Method:     r.Method,
+			Path:       r.URL.Path,
+			StatusCode: http.StatusTooManyRequests,
+			IPAddress:  clientIPForSecurity(r),
+			UserAgent:  r.UserAgent(),
+			Origin:     r.Header.Get("Origin"),
+			Metadata: map[string]any{
+				"limiter":     group,
+				"scope":       decision.Scope,
+				"window":      decision.Window.String(),
+				"limit_count": decision.Limit,
+				"key":         decision.Key,
+				"backend":     decision.Backend,
+			},
+		})
+	}
+	http.Error(w, "Too many requests", http.StatusTooManyRequests)
+	return false
+}
+
+func writeRateLimitHeaders(w http.ResponseWriter, d ratelimit.Decision) {
+	if d.Limit <= 0 {
+		return
+	}
+	h := w.Header()
+	h.Set("RateLimit-Limit", strconv.Itoa(d.Limit))
+	h.Set("RateLimit-Remaining", strconv.Itoa(d.Remaining))
+	h.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(d.ResetAfter)))
+	h.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", d.Limit, ceilSeconds(d.Window)))
+	if !d.Allowed {
+		retry := ceilSeconds(d.RetryAfter)
+		if retry < 1 {
+			retry = 1
+		}
+		h.Set("Retry-After", strconv.Itoa(retry))
+	}
+}
+
+// shouldReportRateLimit lets one security event through per key and window so
+// a client hammering a limit does not flood the event log.
+func shouldReportRateLimit(key string, window time.Duration) bool {
+	now := time.Now()
+	rateLimitReportMu.Lock()
+	defer rateLimitReportMu.Unlock()
+
+	if until, ok := rateLimitReported[key]; ok && now.Before(until) {
+		return false
+	}
+	if len(rateLimitReported) >= maxRateLimitReports {
+		for k, until := range rateLimitReported {
+			if !now.Before(until) {
+				delete(rateLimitReported, k)
+			}
+		}
+	}
+	rateLimitReported[key] = now.Add(window)
+	return true
+}
+
+func ceilSeconds(d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+	return int((d + time.Second - 1) / time.Second)
+}
+
 func clientIPForSecurity(r *http.Request) string {
 	ip := strings.TrimSpace(r.Header.Get("X-Forwarded-For"))
 	if ip != "" {
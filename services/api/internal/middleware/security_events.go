@@ -4,12 +4,14 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"net/http"
 	"strings"
 	"time"
 
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/rs/zerolog/log"
+	"github.com/schoolerp/api/internal/foundation/datascope"
 )
 
 type SecurityEvent struct {
@@ -70,6 +72,41 @@ func RecordSecurityEvent(ctx context.Context, ev SecurityEvent) {
 	}(ctx, ev)
 }
 
+// DataScopeActor returns the data-scope identity of the caller.
+func DataScopeActor(ctx context.Context) datascope.Actor {
+	return datascope.Actor{UserID: GetUserID(ctx), Role: GetRole(ctx)}
+}
+
+// RecordDataScopeViolation records err as a security event when it is a
+// data-scope violation and reports whether it was one. The caller still
+// writes the response.
+func RecordDataScopeViolation(r *http.Request, err error) bool {
+	var violation *datascope.Violation
+	if !errors.As(err, &violation) {
+		return false
+	}
+	ctx := r.Context()
+	RecordSecurityEvent(ctx, SecurityEvent{
+		TenantID:   GetTenantID(ctx),
+		UserID:     GetUserID(ctx),
+		Role:       GetRole(ctx),
+		EventType:  "access.data_scope_denied",
+		Severity:   "warning",
+		Method:     r.Method,
+		Path:       r.URL.Path,
+		StatusCode: http.StatusForbidden,
+		IPAddress:  clientIPForSecurity(r),
+		UserAgent:  r.UserAgent(),
+		Origin:     r.Header.Get("Origin"),
+		Metadata: map[string]any{
+			"resource":    violation.Resource,
+			"resource_id": violation.ResourceID,
+			"reason":      violation.Reason,
+		},
+	})
+	return true
+}
+
 type DBSecurityEventRecorder struct {
 	pool *pgxpool.Pool
 }
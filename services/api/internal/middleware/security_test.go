@@ -5,6 +5,9 @@ import (
 	"net/http/httptest"
 	"sync"
 	"testing"
+	"time"
+
+	"github.com/schoolerp/api/internal/foundation/ratelimit"
 )
 
 func resetCORSStateForTest() {
@@ -86,3 +89,54 @@ func TestCORSPreflight_DisallowedOrigin(t *testing.T) {
 		t.Fatalf("expected preflight 403, got %d", rr.Code)
 	}
 }
+
+func TestRateLimitByKeySetsHeadersAndRetryAfter(t *testing.T) {
+	SetRateLimiter(ratelimit.New(nil, nil))
+
+	handler := RateLimitByKey("test_headers", 2, time.Minute, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	call := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/things", nil)
+		req.RemoteAddr = "203.0.113.9:4000"
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	first := call()
+	if first.Code != http.StatusOK {
+		t.Fatalf("expected first call allowed, got %d", first.Code)
+	}
+	if got := first.Header().Get("RateLimit-Limit"); got != "2" {
+		t.Fatalf("unexpected RateLimit-Limit: %q", got)
+	}
+	if got := first.Header().Get("RateLimit-Remaining"); got != "1" {
+		t.Fatalf("unexpected RateLimit-Remaining: %q", got)
+	}
+
+	call()
+	blocked := call()
+	if blocked.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", blocked.Code)
+	}
+	if got := blocked.Header().Get("Retry-After"); got != "30" {
+		t.Fatalf("expected Retry-After of one refill interval, got %q", got)
+	}
+}
+
+func TestRateLimitGroupWithoutPolicyPassesThrough(t *testing.T) {
+	SetRateLimiter(ratelimit.New(nil, nil))
+
+	handler := RateLimitGroup("parent")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	for i := 0; i < 50; i++ {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/parent/children", nil))
+		if rr.Code != http.StatusOK || rr.Header().Get("RateLimit-Limit") != "" {
+			t.Fatalf("unconfigured groups must not be limited")
+		}
+	}
+}
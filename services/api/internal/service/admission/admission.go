@@ -161,10 +161,19 @@ func (s *AdmissionService) saveTenantConfig(ctx context.Context, tenantID pgtype
 }
 
 func (s *AdmissionService) SubmitEnquiry(ctx context.Context, p CreateEnquiryParams) (db.AdmissionEnquiry, error) {
+	enquiry, err := createEnquiry(ctx, s.q, p)
+	if err != nil {
+		return db.AdmissionEnquiry{}, err
+	}
+	s.auditPublicEnquiry(ctx, enquiry, p)
+	return enquiry, nil
+}
+
+func createEnquiry(ctx context.Context, q db.Querier, p CreateEnquiryParams) (db.AdmissionEnquiry, error) {
 	tID := pgtype.UUID{}
 	tID.Scan(p.TenantID)
 
-	enquiry, err := s.q.CreateEnquiry(ctx, db.CreateEnquiryParams{
+	enquiry, err := q.CreateEnquiry(ctx, db.CreateEnquiryParams{
 		TenantID:        tID,
 		ParentName:      p.ParentName,
 		Email:           pgtype.Text{String: p.Email, Valid: p.Email != ""},
@@ -179,18 +188,19 @@ func (s *AdmissionService) SubmitEnquiry(ctx context.Context, p CreateEnquiryPar
 	if err != nil {
 		return db.AdmissionEnquiry{}, fmt.Errorf("failed to submit enquiry: %w", err)
 	}
+	return enquiry, nil
+}
 
-	// Audit (Public action, no UserID)
+// auditPublicEnquiry records an enquiry made from a public form, so no user.
+func (s *AdmissionService) auditPublicEnquiry(ctx context.Context, enquiry db.AdmissionEnquiry, p CreateEnquiryParams) {
 	_ = s.audit.Log(ctx, audit.Entry{
-		TenantID:     tID,
+		TenantID:     enquiry.TenantID,
 		Action:       "PUBLIC_ENQUIRY",
 		ResourceType: "admission_enquiry",
 		ResourceID:   enquiry.ID,
 		After:        map[string]interface{}{"parent": p.ParentName, "grade": p.GradeInterested},
 		IPAddress:    p.IPAddress,
 	})
-
-	return enquiry, nil
 }
 
 // Admin Operations
@@ -259,6 +269,26 @@ func (s *AdmissionService) CreateApplication(ctx context.Context, tenantID, enqu
 		return db.AdmissionApplication{}, fmt.Errorf("failed to load enquiry: %w", err)
 	}
 
+	app, err := createApplication(ctx, s.q, enquiry, data)
+	if err != nil {
+		return db.AdmissionApplication{}, err
+	}
+
+	_ = s.audit.Log(ctx, audit.Entry{
+		TenantID:     tID,
+		UserID:       uID,
+		Action:       "CREATE_APPLICATION",
+		ResourceType: "admission_application",
+		ResourceID:   app.ID,
+		IPAddress:    ip,
+	})
+
+	return app, nil
+}
+
+// createApplication files an application against an enquiry, filling in the
+// applicant details the form data does not carry.
+func createApplication(ctx context.Context, q db.Querier, enquiry db.AdmissionEnquiry, data map[string]interface{}) (db.AdmissionApplication, error) {
 	if data == nil {
 		data = map[string]interface{}{}
 	}
@@ -280,9 +310,9 @@ func (s *AdmissionService) CreateApplication(ctx context.Context, tenantID, enqu
 
 	jsonBytes, _ := json.Marshal(data)
 
-	app, err := s.q.CreateApplication(ctx, db.CreateApplicationParams{
-		TenantID:          tID,
-		EnquiryID:         eID,
+	app, err := q.CreateApplication(ctx, db.CreateApplicationParams{
+		TenantID:          enquiry.TenantID,
+		EnquiryID:         enquiry.ID,
 		ApplicationNumber: appNum,
 		Status:            "submitted",
 		FormData:          jsonBytes,
@@ -291,16 +321,6 @@ func (s *AdmissionService) CreateApplication(ctx context.Context, tenantID, enqu
 	if err != nil {
 		return db.AdmissionApplication{}, fmt.Errorf("failed to create application: %w", err)
 	}
-	
-	_ = s.audit.Log(ctx, audit.Entry{
-		TenantID:     tID,
-		UserID:       uID,
-		Action:       "CREATE_APPLICATION",
-		ResourceType: "admission_application",
-		ResourceID:   app.ID,
-		IPAddress:    ip,
-	})
-
 	return app, nil
 }
 
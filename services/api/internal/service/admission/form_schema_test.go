@@ -0,0 +1,149 @@
+package admission
+
+import (
+	"errors"
+	"testing"
+)
+
+func testFormSchema(t *testing.T) ApplicationFormSchema {
+	t.Helper()
+	maxLen := 40
+	minAge := 2.0
+	schema, err := NormalizeFormSchema(ApplicationFormSchema{
+		AcademicYear:   "2026-2027",
+		Title:          "Admission Form",
+		ApplicationFee: 50000,
+		Sections: []FormSection{
+			{
+				Key:   "student",
+				Title: "Student",
+				Fields: []FormField{
+					{Key: "dob", Label: "Date of birth", Type: "date", Required: true},
+					{Key: "age", Label: "Age", Type: "number", Min: &minAge},
+					{Key: "previous_school", Label: "Previous school", Type: "select", Options: []string{"yes", "no"}, Required: true},
+					{Key: "school_name", Label: "School name", Type: "text", MaxLength: &maxLen, Required: true,
+						ShowIf: &FieldCondition{Field: "previous_school", Equals: "yes"}},
+					{Key: "tc", Label: "Transfer certificate", Type: "file", Required: true, Accept: []string{"application/pdf", ".jpg"},
+						ShowIf: &FieldCondition{Field: "previous_school", Equals: "yes"}},
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected schema error: %v", err)
+	}
+	return schema
+}
+
+func TestNormalizeFormSchemaRejectsForwardConditions(t *testing.T) {
+	_, err := NormalizeFormSchema(ApplicationFormSchema{
+		AcademicYear: "2026-2027",
+		Sections: []FormSection{{
+			Key: "main",
+			Fields: []FormField{
+				{Key: "a", Type: "text", ShowIf: &FieldCondition{Field: "b", Equals: "x"}},
+				{Key: "b", Type: "text"},
+			},
+		}},
+	})
+	if err == nil {
+		t.Fatal("expected error for condition referencing a later field")
+	}
+}
+
+func TestNormalizeFormSchemaRequiresSelectOptions(t *testing.T) {
+	_, err := NormalizeFormSchema(ApplicationFormSchema{
+		AcademicYear: "2026-2027",
+		Sections:     []FormSection{{Key: "main", Fields: []FormField{{Key: "grade", Type: "select"}}}},
+	})
+	if err == nil {
+		t.Fatal("expected error for select without options")
+	}
+}
+
+func TestValidateSubmissionConditionalFields(t *testing.T) {
+	schema := testFormSchema(t)
+
+	cleaned, files, err := ValidateSubmission(schema, map[string]interface{}{
+		"dob":             "2019-04-01",
+		"previous_school": "no",
+		"school_name":     "should be dropped",
+		"unknown":         "dropped too",
+	}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := cleaned["school_name"]; ok {
+		t.Fatal("hidden conditional field should not be kept")
+	}
+	if _, ok := cleaned["unknown"]; ok {
+		t.Fatal("unknown field should not be kept")
+	}
+	if len(files) != 0 {
+		t.Fatalf("expected no file fields, got %d", len(files))
+	}
+
+	_, _, err = ValidateSubmission(schema, map[string]interface{}{
+		"dob":             "2019-04-01",
+		"previous_school": "yes",
+	}, nil)
+	var validationErr *FormValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("expected validation error, got %v", err)
+	}
+	if len(validationErr.Errors) != 2 {
+		t.Fatalf("expected school_name and tc errors, got %#v", validationErr.Errors)
+	}
+}
+
+func TestValidateSubmissionTypes(t *testing.T) {
+	schema := testFormSchema(t)
+
+	_, _, err := ValidateSubmission(schema, map[string]interface{}{
+		"dob":             "01/04/2019",
+		"age":             "1",
+		"previous_school": "maybe",
+	}, nil)
+	var validationErr *FormValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("expected validation error, got %v", err)
+	}
+	fields := map[string]bool{}
+	for _, fe := range validationErr.Errors {
+		fields[fe.Field] = true
+	}
+	for _, want := range []string{"dob", "age", "previous_school"} {
+		if !fields[want] {
+			t.Fatalf("expected error for %s, got %#v", want, validationErr.Errors)
+		}
+	}
+
+	cleaned, files, err := ValidateSubmission(schema, map[string]interface{}{
+		"dob":             "2019-04-01",
+		"age":             "6",
+		"previous_school": "yes",
+		"school_name":     "Springfield Primary",
+	}, map[string]UploadedFileInfo{
+		"tc": {Name: "tc.pdf", MimeType: "application/pdf", Size: 2048},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cleaned["age"] != 6.0 {
+		t.Fatalf("expected age coerced to number, got %#v", cleaned["age"])
+	}
+	if len(files) != 1 || files[0].DocumentType != "Transfer certificate" {
+		t.Fatalf("unexpected file fields: %#v", files)
+	}
+
+	_, _, err = ValidateSubmission(schema, map[string]interface{}{
+		"dob":             "2019-04-01",
+		"previous_school": "yes",
+		"school_name":     "Springfield Primary",
+	}, map[string]UploadedFileInfo{
+		"tc": {Name: "tc.exe", MimeType: "application/octet-stream", Size: 2048},
+	})
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("expected disallowed file type to fail, got %v", err)
+	}
+}
@@ -0,0 +1,471 @@
+package admission
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/schoolerp/api/internal/db"
+	"github.com/schoolerp/api/internal/foundation/audit"
+	fileservice "github.com/schoolerp/api/internal/service/files"
+)
+
+var (
+	ErrFormNotConfigured = errors.New("admission form is not available for this academic year")
+	ErrFeeOrderNotFound  = errors.New("admission fee order not found")
+	ErrApplicantMismatch = errors.New("application not found for the supplied contact details")
+)
+
+// FeeGateway is the subset of the finance service used to collect application
+// fees online. It is satisfied by *finance.Service.
+type FeeGateway interface {
+	CreateGatewayOrder(ctx context.Context, tenantID string, amount int64, receiptID string) (string, string, error)
+	VerifyGatewayWebhook(ctx context.Context, tenantID, eventID string, body []byte, signature string, secret string) (bool, error)
+}
+
+// OnlineApplicationService handles public, schema-driven application
+// submissions including document uploads and online fee collection.
+type OnlineApplicationService struct {
+	db        *pgxpool.Pool
+	admission *AdmissionService
+	files     *fileservice.FileService
+	gateway   FeeGateway
+	audit     *audit.Logger
+}
+
+func NewOnlineApplicationService(pool *pgxpool.Pool, admissionSvc *AdmissionService, files *fileservice.FileService, gateway FeeGateway, auditLogger *audit.Logger) *OnlineApplicationService {
+	return &OnlineApplicationService{
+		db:        pool,
+		admission: admissionSvc,
+		files:     files,
+		gateway:   gateway,
+		audit:     auditLogger,
+	}
+}
+
+type OnlineFile struct {
+	UploadedFileInfo
+	Content io.Reader
+}
+
+type OnlineSubmission struct {
+	TenantID        string
+	AcademicYear    string
+	ParentName      string
+	Email           string
+	Phone           string
+	StudentName     string
+	GradeInterested string
+	Data            map[string]interface{}
+	Files           map[string]OnlineFile
+	IPAddress       string
+}
+
+type FeeOrder struct {
+	ID            string     `json:"id"`
+	ApplicationID string     `json:"application_id"`
+	Amount        int64      `json:"amount"`
+	Currency      string     `json:"currency"`
+	Provider      string     `json:"provider"`
+	ExternalRef   string     `json:"external_ref"`
+	Status        string     `json:"status"`
+	CreatedAt     time.Time  `json:"created_at"`
+	PaidAt        *time.Time `json:"paid_at,omitempty"`
+}
+
+type OnlineSubmissionResult struct {
+	ApplicationID     string    `json:"application_id"`
+	ApplicationNumber string    `json:"application_number"`
+	Status            string    `json:"status"`
+	FeeStatus         string    `json:"fee_status"`
+	FeeOrder          *FeeOrder `json:"fee_order,omitempty"`
+}
+
+func (s *OnlineApplicationService) Submit(ctx context.Context, p OnlineSubmission) (OnlineSubmissionResult, error) {
+	p.ParentName = strings.TrimSpace(p.ParentName)
+	p.Phone = strings.TrimSpace(p.Phone)
+	p.StudentName = strings.TrimSpace(p.StudentName)
+	p.GradeInterested = strings.TrimSpace(p.GradeInterested)
+	if p.ParentName == "" || p.Phone == "" || p.StudentName == "" || p.GradeInterested == "" {
+		return OnlineSubmissionResult{}, fmt.Errorf("parent_name, phone, student_name and grade_interested are required")
+	}
+
+	schema, err := s.admission.GetPublishedFormSchema(ctx, p.TenantID, p.AcademicYear)
+	if err != nil {
+		return OnlineSubmissionResult{}, err
+	}
+
+	fileInfo := make(map[string]UploadedFileInfo, len(p.Files))
+	for key, f := range p.Files {
+		fileInfo[key] = f.UploadedFileInfo
+	}
+	cleaned, fileFields, err := ValidateSubmission(schema, p.Data, fileInfo)
+	if err != nil {
+		return OnlineSubmissionResult{}, err
+	}
+
+	// Upload documents before creating records so a storage failure does not
+	// leave an application without its mandatory attachments.
+	documents := make([]map[string]interface{}, 0, len(fileFields))
+	for _, field := range fileFields {
+		f := p.Files[field.Key]
+		uploaded, err := s.files.Upload(ctx, fileservice.UploadParams{
+			TenantID:    p.TenantID,
+			Name:        f.Name,
+			MimeType:    f.MimeType,
+			Content:     f.Content,
+			ContentSize: f.Size,
+		})
+		if err != nil {
+			return OnlineSubmissionResult{}, fmt.Errorf("failed to upload %s: %w", field.Label, err)
+		}
+		documents = append(documents, map[string]interface{}{
+			"type":        field.DocumentType,
+			"field_key":   field.Key,
+			"file_id":     uploaded.ID.String(),
+			"name":        uploaded.Name,
+			"attached_at": time.Now().UTC().Format(time.RFC3339),
+			"source":      "online_form",
+		})
+	}
+
+	// The enquiry, application, documents and fee status are written together,
+	// so a failure part-way leaves no half-filed application behind.
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return OnlineSubmissionResult{}, err
+	}
+	defer tx.Rollback(ctx)
+	qtx := db.New(tx)
+
+	enquiryParams := CreateEnquiryParams{
+		TenantID:        p.TenantID,
+		ParentName:      p.ParentName,
+		Email:           strings.TrimSpace(p.Email),
+		Phone:           p.Phone,
+		StudentName:     p.StudentName,
+		GradeInterested: p.GradeInterested,
+		AcademicYear:    schema.AcademicYear,
+		Source:          "online_form",
+		IPAddress:       p.IPAddress,
+	}
+	enquiry, err := createEnquiry(ctx, qtx, enquiryParams)
+	if err != nil {
+		return OnlineSubmissionResult{}, err
+	}
+
+	cleaned["form_version"] = schema.Version
+	app, err := createApplication(ctx, qtx, enquiry, cleaned)
+	if err != nil {
+		return OnlineSubmissionResult{}, err
+	}
+
+	if len(documents) > 0 {
+		docsJSON, _ := json.Marshal(documents)
+		if err := qtx.UpdateApplicationDocuments(ctx, db.UpdateApplicationDocumentsParams{
+			ID:        app.ID,
+			TenantID:  app.TenantID,
+			Documents: docsJSON,
+		}); err != nil {
+			return OnlineSubmissionResult{}, fmt.Errorf("failed to attach documents: %w", err)
+		}
+	}
+
+	feeStatus := "waived"
+	if schema.ApplicationFee > 0 {
+		feeStatus = "pending"
+	}
+	if err := qtx.UpdateApplicationFee(ctx, db.UpdateApplicationFeeParams{
+		ID:                  app.ID,
+		TenantID:            app.TenantID,
+		ProcessingFeeAmount: pgtype.Int8{Int64: max(schema.ApplicationFee, 0), Valid: true},
+		ProcessingFeeStatus: pgtype.Text{String: feeStatus, Valid: true},
+	}); err != nil {
+		return OnlineSubmissionResult{}, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return OnlineSubmissionResult{}, err
+	}
+
+	s.admission.auditPublicEnquiry(ctx, enquiry, enquiryParams)
+	_ = s.audit.Log(ctx, audit.Entry{
+		TenantID:     app.TenantID,
+		Action:       "PUBLIC_ADMISSION_APPLICATION",
+		ResourceType: "admission_application",
+		ResourceID:   app.ID,
+		After: map[string]interface{}{
+			"academic_year": schema.AcademicYear,
+			"form_version":  schema.Version,
+			"documents":     len(documents),
+		},
+		IPAddress: p.IPAddress,
+	})
+
+	result := OnlineSubmissionResult{
+		ApplicationID:     app.ID.String(),
+		ApplicationNumber: app.ApplicationNumber,
+		Status:            app.Status,
+		FeeStatus:         feeStatus,
+	}
+	if schema.ApplicationFee <= 0 {
+		return result, nil
+	}
+
+	// The gateway is called after commit: the application is stored either
+	// way, and the applicant can retry payment later.
+	order, err := s.createFeeOrder(ctx, p.TenantID, app.ID.String(), schema.ApplicationFee)
+	if err != nil {
+		return result, fmt.Errorf("application %s saved but payment could not be initiated: %w", app.ApplicationNumber, err)
+	}
+	result.FeeOrder = &order
+	return result, nil
+}
+
+// StartFeePayment (re)creates a gateway order for an unpaid application. The
+// applicant proves ownership with the phone number used on the form.
+func (s *OnlineApplicationService) StartFeePayment(ctx context.Context, tenantID, applicationNumber, phone string) (FeeOrder, error) {
+	var appID, status, feeStatus, storedPhone, academicYear string
+	err := s.db.QueryRow(ctx, `
+		SELECT a.id::text, a.status, COALESCE(a.processing_fee_status, 'pending'), COALESCE(e.phone, ''), COALESCE(e.academic_year, '')
+		FROM admission_applications a
+		LEFT JOIN admission_enquiries e ON a.enquiry_id = e.id
+		WHERE a.tenant_id = $1 AND a.application_number = $2
+	`, tenantID, strings.TrimSpace(applicationNumber)).Scan(&appID, &status, &feeStatus, &storedPhone, &academicYear)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return FeeOrder{}, ErrApplicantMismatch
+		}
+		return FeeOrder{}, err
+	}
+	if normalizePhone(storedPhone) == "" || normalizePhone(storedPhone) != normalizePhone(phone) {
+		return FeeOrder{}, ErrApplicantMismatch
+	}
+	if feeStatus == "paid" || feeStatus == "waived" {
+		return FeeOrder{}, fmt.Errorf("application fee is already %s", feeStatus)
+	}
+	if status == "declined" {
+		return FeeOrder{}, fmt.Errorf("application has been declined")
+	}
+
+	schema, err := s.admission.GetFormSchema(ctx, tenantID, academicYear)
+	if err != nil {
+		return FeeOrder{}, err
+	}
+	if schema.ApplicationFee <= 0 {
+		return FeeOrder{}, fmt.Errorf("no application fee is configured for %s", academicYear)
+	}
+	return s.createFeeOrder(ctx, tenantID, appID, schema.ApplicationFee)
+}
+
+func (s *OnlineApplicationService) createFeeOrder(ctx context.Context, tenantID, applicationID string, amount int64) (FeeOrder, error) {
+	if s.gateway == nil {
+		return FeeOrder{}, fmt.Errorf("online payments are not configured")
+	}
+
+	var order FeeOrder
+	err := s.db.QueryRow(ctx, `
+		INSERT INTO admission_fee_orders (tenant_id, application_id, amount, currency, status)
+		VALUES ($1, $2, $3, 'INR', 'created')
+		RETURNING id::text, application_id::text, amount, currency, status, created_at
+	`, tenantID, applicationID, amount).Scan(&order.ID, &order.ApplicationID, &order.Amount, &order.Currency, &order.Status, &order.CreatedAt)
+	if err != nil {
+		return FeeOrder{}, err
+	}
+
+	provider, externalRef, err := s.gateway.CreateGatewayOrder(ctx, tenantID, amount, order.ID)
+	if err != nil {
+		_, _ = s.db.Exec(ctx, `UPDATE admission_fee_orders SET status = 'failed', updated_at = NOW() WHERE id = $1`, order.ID)
+		return FeeOrder{}, err
+	}
+
+	_, err = s.db.Exec(ctx, `
+		UPDATE admission_fee_orders
+		SET provider = $2, external_ref = $3, status = 'pending', updated_at = NOW()
+		WHERE id = $1
+	`, order.ID, provider, externalRef)
+	if err != nil {
+		return FeeOrder{}, err
+	}
+	order.Provider = provider
+	order.ExternalRef = externalRef
+	order.Status = "pending"
+
+	if err := s.admission.q.UpdateApplicationFee(ctx, db.UpdateApplicationFeeParams{
+		ID:                  toPgUUID(applicationID),
+		TenantID:            toPgUUID(tenantID),
+		ProcessingFeeAmount: pgtype.Int8{Int64: amount, Valid: true},
+		ProcessingFeeStatus: pgtype.Text{String: "pending", Valid: true},
+		PaymentReference:    pgtype.Text{String: externalRef, Valid: externalRef != ""},
+	}); err != nil {
+		return FeeOrder{}, err
+	}
+	return order, nil
+}
+
+// HandlePaymentWebhook marks the application fee as paid when the gateway
+// confirms capture of an admission fee order. Events for orders that are not
+// admission fee orders are rejected with ErrFeeOrderNotFound.
+func (s *OnlineApplicationService) HandlePaymentWebhook(ctx context.Context, tenantID, eventID string, body []byte, signature, secret string) error {
+	if s.gateway == nil {
+		return fmt.Errorf("online payments are not configured")
+	}
+
+	var event struct {
+		Event   string `json:"event"`
+		Payload struct {
+			Payment struct {
+				Entity struct {
+					ID      string `json:"id"`
+					OrderID string `json:"order_id"`
+					Amount  int64  `json:"amount"`
+				} `json:"entity"`
+			} `json:"payment"`
+		} `json:"payload"`
+	}
+	if err := json.Unmarshal(body, &event); err != nil {
+		return err
+	}
+	if strings.TrimSpace(eventID) == "" {
+		eventID = event.Payload.Payment.Entity.ID + ":" + event.Event
+	}
+
+	alreadyProcessed, err := s.gateway.VerifyGatewayWebhook(ctx, tenantID, eventID, body, signature, secret)
+	if err != nil {
+		return err
+	}
+	if alreadyProcessed {
+		return nil
+	}
+	if event.Event != "payment.captured" && event.Event != "order.paid" {
+		return nil
+	}
+
+	gatewayOrderID := strings.TrimSpace(event.Payload.Payment.Entity.OrderID)
+	internalID := strings.TrimPrefix(gatewayOrderID, "order_")
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var orderID, applicationID, status string
+	var amount int64
+	err = tx.QueryRow(ctx, `
+		SELECT id::text, application_id::text, amount, status
+		FROM admission_fee_orders
+		WHERE tenant_id = $1 AND (external_ref = $2 OR id::text = $3)
+		ORDER BY created_at DESC
+		LIMIT 1
+		FOR UPDATE
+	`, tenantID, gatewayOrderID, internalID).Scan(&orderID, &applicationID, &amount, &status)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrFeeOrderNotFound
+		}
+		return err
+	}
+	if status == "paid" {
+		return nil
+	}
+	if event.Payload.Payment.Entity.Amount != amount {
+		return fmt.Errorf("captured amount %d does not match order amount %d", event.Payload.Payment.Entity.Amount, amount)
+	}
+
+	paymentRef := event.Payload.Payment.Entity.ID
+	if _, err := tx.Exec(ctx, `
+		UPDATE admission_fee_orders
+		SET status = 'paid', gateway_payment_id = $2, paid_at = NOW(), updated_at = NOW()
+		WHERE id = $1
+	`, orderID, paymentRef); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `
+		UPDATE admission_applications
+		SET processing_fee_amount = $3, processing_fee_status = 'paid', payment_reference = $4, updated_at = NOW()
+		WHERE id = $1 AND tenant_id = $2
+	`, applicationID, tenantID, amount, paymentRef); err != nil {
+		return err
+	}
+	// Recorded only once the fee is marked paid, in the same transaction, so a
+	// failed update does not leave the event looking processed.
+	if _, err := db.New(tx).LogPaymentEvent(ctx, db.LogPaymentEventParams{
+		TenantID:       toPgUUID(tenantID),
+		GatewayEventID: eventID,
+		EventType:      event.Event,
+	}); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	_ = s.audit.Log(ctx, audit.Entry{
+		TenantID:     toPgUUID(tenantID),
+		Action:       "ONLINE_ADMISSION_FEE_PAID",
+		ResourceType: "admission_application",
+		ResourceID:   toPgUUID(applicationID),
+		After:        map[string]interface{}{"amount": amount, "order_id": orderID, "payment_ref": paymentRef},
+	})
+	return nil
+}
+
+func (s *OnlineApplicationService) ListFeeOrders(ctx context.Context, tenantID, applicationID string) ([]FeeOrder, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT id::text, application_id::text, amount, currency, COALESCE(provider, ''), COALESCE(external_ref, ''), status, created_at, paid_at
+		FROM admission_fee_orders
+		WHERE tenant_id = $1 AND application_id = $2
+		ORDER BY created_at DESC
+	`, tenantID, applicationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orders := make([]FeeOrder, 0)
+	for rows.Next() {
+		var o FeeOrder
+		if err := rows.Scan(&o.ID, &o.ApplicationID, &o.Amount, &o.Currency, &o.Provider, &o.ExternalRef, &o.Status, &o.CreatedAt, &o.PaidAt); err != nil {
+			return nil, err
+		}
+		orders = append(orders, o)
+	}
+	return orders, rows.Err()
+}
+
+func normalizePhone(phone string) string {
+	var b strings.Builder
+	for _, r := range phone {
+		if r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		}
+	}
+	digits := b.String()
+	// Compare on the national number so "+91 98xxx" matches "98xxx".
+	if len(digits) > 10 {
+		digits = digits[len(digits)-10:]
+	}
+	return digits
+}
+
+func toPgUUID(s string) pgtype.UUID {
+	var u pgtype.UUID
+	u.Scan(s)
+	return u
+}
+
+func remarshal(in interface{}, out interface{}) error {
+	raw, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, out)
+}
@@ -0,0 +1,533 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog/log"
+	"github.com/schoolerp/api/internal/foundation/ai"
+	"github.com/schoolerp/api/internal/service/kb"
+)
+
+const (
+	defaultHelpdeskMinConfidence = 0.15
+	helpdeskTopK                 = 5
+	helpdeskHistoryTurns         = 6
+	notInSourcesMarker           = "NOT_IN_SOURCES"
+
+	ChannelApp      = "app"
+	ChannelWhatsApp = "whatsapp"
+
+	HandoffKnowledgebaseUnavailable = "knowledgebase_unavailable"
+	HandoffLowConfidence            = "low_confidence"
+	HandoffNotInSources             = "not_in_sources"
+	HandoffUncitedAnswer            = "uncited_answer"
+)
+
+var (
+	ErrHelpdeskLogUnavailable = errors.New("helpdesk answer log is not configured")
+	ErrHandoffNotFound        = errors.New("helpdesk handoff not found")
+)
+
+const handoffMessage = "I couldn't find a confirmed answer to this in the school's published information, so I've passed your question to the school office. A staff member will get back to you soon."
+
+// KnowledgeRetriever returns ranked knowledgebase chunks for a role. It is
+// satisfied by *kb.Service.
+type KnowledgeRetriever interface {
+	Retrieve(ctx context.Context, tenantID string, userCtx kb.UserContext, query string, topK int32) (kb.Retrieval, error)
+}
+
+type Citation struct {
+	Ref         int    `json:"ref"`
+	DocumentID  string `json:"document_id"`
+	Title       string `json:"title"`
+	ChunkID     string `json:"chunk_id"`
+	SectionPath string `json:"section_path,omitempty"`
+	PageNumber  int32  `json:"page_number,omitempty"`
+}
+
+type GroundedAnswer struct {
+	ID            string     `json:"id,omitempty"`
+	Answer        string     `json:"answer"`
+	Citations     []Citation `json:"citations"`
+	Confidence    float64    `json:"confidence"`
+	HandedOff     bool       `json:"handed_off"`
+	HandoffReason string     `json:"handoff_reason,omitempty"`
+	ToolsUsed     []string   `json:"tools_used,omitempty"`
+}
+
+type HelpdeskAnswerDTO struct {
+	ID                string     `json:"id"`
+	Channel           string     `json:"channel"`
+	UserID            string     `json:"user_id,omitempty"`
+	ExternalID        string     `json:"external_id,omitempty"`
+	Query             string     `json:"query"`
+	Answer            string     `json:"answer"`
+	Confidence        float64    `json:"confidence"`
+	Retrieval         string     `json:"retrieval,omitempty"`
+	RetrievedChunkIDs []string   `json:"retrieved_chunk_ids"`
+	CitedChunkIDs     []string   `json:"cited_chunk_ids"`
+	CitedDocumentIDs  []string   `json:"cited_document_ids"`
+	ToolsUsed         []string   `json:"tools_used"`
+	HandoffReason     string     `json:"handoff_reason,omitempty"`
+	HandoffStatus     string     `json:"handoff_status,omitempty"`
+	ResolvedBy        string     `json:"resolved_by,omitempty"`
+	ResolvedAt        *time.Time `json:"resolved_at,omitempty"`
+	ResolutionNote    string     `json:"resolution_note,omitempty"`
+	CreatedAt         time.Time  `json:"created_at"`
+}
+
+type helpdeskRequest struct {
+	TenantID    string
+	UserID      string
+	Channel     string
+	ExternalID  string
+	Query       string
+	ContextInfo string
+	Language    string
+	History     []ai.Message
+	Tools       *toolContext
+}
+
+// toolContext carries the parent tools together with the guardian scope
+// they were resolved for.
+type toolContext struct {
+	parent *ParentTools
+	scope  *guardianScope
+}
+
+// SetKnowledgeBase grounds parent helpdesk answers on the tenant
+// knowledgebase and enables the answer log.
+func (s *Service) SetKnowledgeBase(retriever KnowledgeRetriever, pool *pgxpool.Pool) {
+	s.kb = retriever
+	s.pool = pool
+	s.minConfidence = defaultHelpdeskMinConfidence
+	if raw := strings.TrimSpace(os.Getenv("AI_HELPDESK_MIN_CONFIDENCE")); raw != "" {
+		if v, err := strconv.ParseFloat(raw, 64); err == nil && v >= 0 && v <= 1 {
+			s.minConfidence = v
+		}
+	}
+}
+
+// answerGrounded retrieves parent-visible chunks, asks the model to answer
+// strictly from them and keeps only citations that point at real sources.
+// Anything it cannot ground is handed off to staff instead of guessed.
+func (s *Service) answerGrounded(ctx context.Context, req helpdeskRequest) (GroundedAnswer, error) {
+	query := strings.TrimSpace(req.Query)
+	if query == "" {
+		return GroundedAnswer{}, fmt.Errorf("query is required")
+	}
+
+	hasTools := req.Tools != nil && req.Tools.scope != nil
+	if s.kb == nil && !hasTools {
+		return s.handOff(ctx, req, kb.Retrieval{}, HandoffKnowledgebaseUnavailable)
+	}
+
+	var retrieval kb.Retrieval
+	if s.kb != nil {
+		// The helpdesk always answers as a parent would see it, whoever asks,
+		// so staff previews never leak internal documents.
+		var err error
+		retrieval, err = s.kb.Retrieve(ctx, req.TenantID, kb.UserContext{UserID: req.UserID, Role: "parent"}, query, helpdeskTopK)
+		if err != nil {
+			if !errors.Is(err, kb.ErrKBDisabled) && !errors.Is(err, kb.ErrKBForbidden) {
+				return GroundedAnswer{}, fmt.Errorf("knowledgebase retrieval failed: %w", err)
+			}
+			if !hasTools {
+				return s.handOff(ctx, req, kb.Retrieval{}, HandoffKnowledgebaseUnavailable)
+			}
+			retrieval = kb.Retrieval{}
+		}
+	}
+
+	// Weak matches are not offered as sources. Without tools there is then
+	// nothing to answer from; with tools the model may still look up the
+	// parent's own data.
+	var sources []kb.RetrievedChunk
+	if len(retrieval.Chunks) > 0 && retrieval.Confidence >= s.minConfidence {
+		sources = retrieval.Chunks
+	}
+	if len(sources) == 0 && !hasTools {
+		return s.handOff(ctx, req, retrieval, HandoffLowConfidence)
+	}
+
+	systemPrompt := groundedSystemPrompt(req.Language)
+	if hasTools {
+		systemPrompt += " " + toolsSystemPrompt(req.Tools.scope)
+	}
+	messages := []ai.Message{{Role: "system", Content: systemPrompt}}
+	messages = append(messages, trimHistory(req.History, helpdeskHistoryTurns)...)
+	messages = append(messages, ai.Message{Role: "user", Content: buildGroundedPrompt(query, req.ContextInfo, sources)})
+	chatReq := ai.ChatRequest{Messages: messages, Temperature: 0.2}
+
+	var (
+		resp      string
+		toolsUsed []string
+	)
+	if hasTools {
+		result, err := s.client.ChatWithTools(ctx, chatReq, req.Tools.parent.definitions(), req.Tools.parent.handler(req.Tools.scope))
+		if err != nil {
+			return GroundedAnswer{}, fmt.Errorf("failed to answer query: %w", err)
+		}
+		resp = result.Content
+		for _, inv := range result.Invocations {
+			if inv.Error == "" && !containsString(toolsUsed, inv.Name) {
+				toolsUsed = append(toolsUsed, inv.Name)
+			}
+		}
+	} else {
+		var err error
+		resp, err = s.client.Chat(ctx, chatReq)
+		if err != nil {
+			return GroundedAnswer{}, fmt.Errorf("failed to answer query: %w", err)
+		}
+	}
+
+	if strings.Contains(strings.ToUpper(resp), notInSourcesMarker) {
+		return s.handOff(ctx, req, retrieval, HandoffNotInSources)
+	}
+	answer, citations := extractCitations(resp, sources)
+	// Facts from the parent's own records come from tools and carry no
+	// citation; anything else must point at a source.
+	if len(citations) == 0 && len(toolsUsed) == 0 {
+		return s.handOff(ctx, req, retrieval, HandoffUncitedAnswer)
+	}
+
+	out := GroundedAnswer{
+		Answer:     answer,
+		Citations:  citations,
+		Confidence: retrieval.Confidence,
+		ToolsUsed:  toolsUsed,
+	}
+	out.ID = s.recordAnswer(ctx, req, retrieval, out)
+	return out, nil
+}
+
+func (s *Service) handOff(ctx context.Context, req helpdeskRequest, retrieval kb.Retrieval, reason string) (GroundedAnswer, error) {
+	out := GroundedAnswer{
+		Answer:        handoffMessage,
+		Citations:     []Citation{},
+		Confidence:    retrieval.Confidence,
+		HandedOff:     true,
+		HandoffReason: reason,
+	}
+	out.ID = s.recordAnswer(ctx, req, retrieval, out)
+	return out, nil
+}
+
+// recordAnswer stores the answer with the chunks it was built from. The log
+// is best effort: a failure to write it must not cost the parent a reply.
+func (s *Service) recordAnswer(ctx context.Context, req helpdeskRequest, retrieval kb.Retrieval, out GroundedAnswer) string {
+	retrieved := make([]string, 0, len(retrieval.Chunks))
+	for _, c := range retrieval.Chunks {
+		retrieved = append(retrieved, c.ChunkID)
+	}
+	toolsUsed := out.ToolsUsed
+	if toolsUsed == nil {
+		toolsUsed = []string{}
+	}
+	citedChunks := make([]string, 0, len(out.Citations))
+	citedDocs := make([]string, 0, len(out.Citations))
+	for _, c := range out.Citations {
+		citedChunks = append(citedChunks, c.ChunkID)
+		if !containsString(citedDocs, c.DocumentID) {
+			citedDocs = append(citedDocs, c.DocumentID)
+		}
+	}
+
+	logType := "parent_query"
+	if req.Channel == ChannelWhatsApp {
+		logType = "whatsapp_chat"
+	}
+	logUser := req.UserID
+	if logUser == "" {
+		logUser = req.Channel
+	}
+	go s.logQuery(context.Background(), req.TenantID, logUser, string(s.client.GetProvider()), "default", 0, 0, map[string]interface{}{
+		"type":             logType,
+		"retrieval":        retrieval.Meta.Retrieval,
+		"confidence":       out.Confidence,
+		"retrieved_chunks": retrieved,
+		"cited_chunks":     citedChunks,
+		"handed_off":       out.HandedOff,
+		"handoff_reason":   out.HandoffReason,
+		"tools_used":       out.ToolsUsed,
+	})
+
+	if s.pool == nil {
+		return ""
+	}
+
+	var handoffReason, handoffStatus pgtype.Text
+	if out.HandedOff {
+		handoffReason = pgtype.Text{String: out.HandoffReason, Valid: true}
+		handoffStatus = pgtype.Text{String: "open", Valid: true}
+	}
+	var userID pgtype.UUID
+	if req.UserID != "" {
+		_ = userID.Scan(req.UserID)
+	}
+
+	var id pgtype.UUID
+	err := s.pool.QueryRow(ctx, `
+		INSERT INTO ai_helpdesk_answers (
+			tenant_id, channel, user_id, external_id, query, answer, confidence, retrieval,
+			retrieved_chunk_ids, cited_chunk_ids, cited_document_ids, tools_used, handoff_reason, handoff_status
+		) VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6, $7, NULLIF($8, ''), $9::uuid[], $10::uuid[], $11::uuid[], $12::text[], $13, $14)
+		RETURNING id`,
+		toPgUUID(req.TenantID), req.Channel, userID, req.ExternalID, strings.TrimSpace(req.Query), out.Answer,
+		out.Confidence, retrieval.Meta.Retrieval, retrieved, citedChunks, citedDocs, toolsUsed, handoffReason, handoffStatus,
+	).Scan(&id)
+	if err != nil {
+		log.Error().Err(err).Str("tenant_id", req.TenantID).Msg("failed to record helpdesk answer")
+		return ""
+	}
+	return id.String()
+}
+
+// ListHelpdeskAnswers returns recent helpdesk answers, newest first. With
+// handoffStatus "open" or "resolved" only handed-off questions are listed.
+func (s *Service) ListHelpdeskAnswers(ctx context.Context, tenantID, handoffStatus string, limit int) ([]HelpdeskAnswerDTO, error) {
+	if s.pool == nil {
+		return nil, ErrHelpdeskLogUnavailable
+	}
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	handoffStatus = strings.ToLower(strings.TrimSpace(handoffStatus))
+	if handoffStatus != "" && handoffStatus != "open" && handoffStatus != "resolved" {
+		return nil, fmt.Errorf("invalid handoff status %q", handoffStatus)
+	}
+
+	rows, err := s.pool.Query(ctx, `
+		SELECT id, channel, user_id, COALESCE(external_id, ''), query, answer, confidence, COALESCE(retrieval, ''),
+		       retrieved_chunk_ids::text[], cited_chunk_ids::text[], cited_document_ids::text[], tools_used,
+		       COALESCE(handoff_reason, ''), COALESCE(handoff_status, ''), resolved_by, resolved_at,
+		       COALESCE(resolution_note, ''), created_at
+		FROM ai_helpdesk_answers
+		WHERE tenant_id = $1 AND ($2 = '' OR handoff_status = $2)
+		ORDER BY created_at DESC
+		LIMIT $3`, toPgUUID(tenantID), handoffStatus, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]HelpdeskAnswerDTO, 0)
+	for rows.Next() {
+		var (
+			a          HelpdeskAnswerDTO
+			id         pgtype.UUID
+			userID     pgtype.UUID
+			resolvedBy pgtype.UUID
+			resolvedAt pgtype.Timestamptz
+		)
+		if err := rows.Scan(
+			&id, &a.Channel, &userID, &a.ExternalID, &a.Query, &a.Answer, &a.Confidence, &a.Retrieval,
+			&a.RetrievedChunkIDs, &a.CitedChunkIDs, &a.CitedDocumentIDs, &a.ToolsUsed,
+			&a.HandoffReason, &a.HandoffStatus, &resolvedBy, &resolvedAt, &a.ResolutionNote, &a.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		a.ID = id.String()
+		if userID.Valid {
+			a.UserID = userID.String()
+		}
+		if resolvedBy.Valid {
+			a.ResolvedBy = resolvedBy.String()
+		}
+		if resolvedAt.Valid {
+			t := resolvedAt.Time
+			a.ResolvedAt = &t
+		}
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
+
+// ResolveHandoff closes an open handoff once staff have replied to the parent.
+func (s *Service) ResolveHandoff(ctx context.Context, tenantID, answerID, userID, note string) (HelpdeskAnswerDTO, error) {
+	if s.pool == nil {
+		return HelpdeskAnswerDTO{}, ErrHelpdeskLogUnavailable
+	}
+	var resolver pgtype.UUID
+	if userID != "" {
+		_ = resolver.Scan(userID)
+	}
+	var id pgtype.UUID
+	if err := id.Scan(answerID); err != nil {
+		return HelpdeskAnswerDTO{}, ErrHandoffNotFound
+	}
+
+	var a HelpdeskAnswerDTO
+	var resolvedAt time.Time
+	err := s.pool.QueryRow(ctx, `
+		UPDATE ai_helpdesk_answers
+		SET handoff_status = 'resolved', resolved_by = $3, resolved_at = NOW(), resolution_note = NULLIF($4, '')
+		WHERE tenant_id = $1 AND id = $2 AND handoff_status = 'open'
+		RETURNING channel, COALESCE(external_id, ''), query, answer, COALESCE(handoff_reason, ''), resolved_at, created_at`,
+		toPgUUID(tenantID), id, resolver, strings.TrimSpace(note),
+	).Scan(&a.Channel, &a.ExternalID, &a.Query, &a.Answer, &a.HandoffReason, &resolvedAt, &a.CreatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return HelpdeskAnswerDTO{}, ErrHandoffNotFound
+		}
+		return HelpdeskAnswerDTO{}, err
+	}
+	a.ID = answerID
+	a.HandoffStatus = "resolved"
+	a.ResolvedBy = userID
+	a.ResolvedAt = &resolvedAt
+	a.ResolutionNote = strings.TrimSpace(note)
+	return a, nil
+}
+
+func groundedSystemPrompt(lang string) string {
+	prompt := "You are a professional school helpdesk agent answering parents. " +
+		"Answer only from the numbered sources you are given, never from general knowledge. " +
+		"Cite every fact with the number of its source in square brackets, for example [1] or [2]. " +
+		"If the sources do not answer the question, reply with exactly " + notInSourcesMarker + " and nothing else. " +
+		"Be concise, polite and professional."
+	if lang != "" && lang != "en" {
+		prompt += fmt.Sprintf(" Respond in the language code: %s.", lang)
+	}
+	return prompt
+}
+
+func buildGroundedPrompt(query, contextInfo string, chunks []kb.RetrievedChunk) string {
+	var b strings.Builder
+	b.WriteString("Sources:\n")
+	if len(chunks) == 0 {
+		b.WriteString("(no published school documents matched this question)\n")
+	}
+	for i, c := range chunks {
+		fmt.Fprintf(&b, "\n[%d] %s\n%s\n", i+1, sourceLabel(c.Title, c.SectionPath, c.PageNumber), strings.TrimSpace(c.Content))
+	}
+	if info := strings.TrimSpace(contextInfo); info != "" {
+		b.WriteString("\nAdditional context from the parent's app (not a citable source):\n")
+		b.WriteString(info)
+		b.WriteString("\n")
+	}
+	b.WriteString("\nParent query: ")
+	b.WriteString(query)
+	return b.String()
+}
+
+var (
+	citationPattern       = regexp.MustCompile(`\[(\d+(?:\s*,\s*\d+)*)\]`)
+	strayPunctuationSpace = regexp.MustCompile(`[ \t]+([.,;:!?])`)
+)
+
+// extractCitations keeps the references in the answer that point at a
+// provided source, strips any that do not, and returns the cited sources in
+// source order.
+func extractCitations(answer string, chunks []kb.RetrievedChunk) (string, []Citation) {
+	cited := map[int]bool{}
+	stripped := false
+	cleaned := citationPattern.ReplaceAllStringFunc(answer, func(match string) string {
+		inner := citationPattern.FindStringSubmatch(match)[1]
+		valid := make([]string, 0, 2)
+		for _, part := range strings.Split(inner, ",") {
+			n, err := strconv.Atoi(strings.TrimSpace(part))
+			if err != nil || n < 1 || n > len(chunks) {
+				continue
+			}
+			cited[n] = true
+			valid = append(valid, strconv.Itoa(n))
+		}
+		if len(valid) == 0 {
+			stripped = true
+			return ""
+		}
+		return "[" + strings.Join(valid, ", ") + "]"
+	})
+
+	if stripped {
+		cleaned = strayPunctuationSpace.ReplaceAllString(cleaned, "$1")
+	}
+
+	refs := make([]int, 0, len(cited))
+	for n := range cited {
+		refs = append(refs, n)
+	}
+	sort.Ints(refs)
+
+	citations := make([]Citation, 0, len(refs))
+	for _, n := range refs {
+		c := chunks[n-1]
+		citations = append(citations, Citation{
+			Ref:         n,
+			DocumentID:  c.DocumentID,
+			Title:       c.Title,
+			ChunkID:     c.ChunkID,
+			SectionPath: c.SectionPath,
+			PageNumber:  c.PageNumber,
+		})
+	}
+	return strings.TrimSpace(cleaned), citations
+}
+
+// FormatWithSources renders an answer and its citations as plain text for
+// channels without rich formatting, such as WhatsApp.
+func FormatWithSources(answer GroundedAnswer) string {
+	if len(answer.Citations) == 0 {
+		return answer.Answer
+	}
+	var b strings.Builder
+	b.WriteString(answer.Answer)
+	b.WriteString("\n\nSources:")
+	for _, c := range answer.Citations {
+		fmt.Fprintf(&b, "\n[%d] %s", c.Ref, sourceLabel(c.Title, c.SectionPath, c.PageNumber))
+	}
+	return b.String()
+}
+
+func sourceLabel(title, sectionPath string, page int32) string {
+	label := strings.TrimSpace(title)
+	if section := strings.TrimSpace(sectionPath); section != "" && section != label {
+		label += " - " + section
+	}
+	if page > 0 {
+		label += fmt.Sprintf(" (p. %d)", page)
+	}
+	return label
+}
+
+func trimHistory(history []ai.Message, turns int) []ai.Message {
+	out := make([]ai.Message, 0, len(history))
+	for _, m := range history {
+		if m.Role == "user" || m.Role == "assistant" {
+			out = append(out, m)
+		}
+	}
+	if len(out) > turns {
+		out = out[len(out)-turns:]
+	}
+	return out
+}
+
+func containsString(values []string, target string) bool {
+	for _, v := range values {
+		if v == target {
+			return true
+		}
+	}
+	return false
+}
+
+func toolsSystemPrompt(scope *guardianScope) string {
+	return "You are talking to the guardian of " + scope.describe() + ". " +
+		"For questions about these children's fees, attendance, homework or exams, call the tools instead of using the sources; " +
+		"facts from tool results need no citation. Never guess personal details the tools did not return. " +
+		"If a question is neither answered by the sources nor by a tool, reply with exactly " + notInSourcesMarker + "."
+}
@@ -0,0 +1,49 @@
+package ai
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/schoolerp/api/internal/service/kb"
+)
+
+func TestExtractCitationsDropsUnknownSources(t *testing.T) {
+	chunks := []kb.RetrievedChunk{
+		{SearchResult: kb.SearchResult{DocumentID: "doc-1", ChunkID: "chunk-1", Title: "Fee Policy", SectionPath: "Late payment", PageNumber: 2}},
+		{SearchResult: kb.SearchResult{DocumentID: "doc-2", ChunkID: "chunk-2", Title: "Transport"}},
+	}
+
+	answer, citations := extractCitations("Fees are due by the 10th [1]. Late fees are Rs 50 per day [1, 7]. Ask the office [9].", chunks)
+	if answer != "Fees are due by the 10th [1]. Late fees are Rs 50 per day [1]. Ask the office." {
+		t.Fatalf("unexpected cleaned answer: %q", answer)
+	}
+	if len(citations) != 1 || citations[0].Ref != 1 || citations[0].ChunkID != "chunk-1" {
+		t.Fatalf("unexpected citations: %#v", citations)
+	}
+
+	text := FormatWithSources(GroundedAnswer{Answer: answer, Citations: citations})
+	if !strings.HasSuffix(text, "Sources:\n[1] Fee Policy - Late payment (p. 2)") {
+		t.Fatalf("unexpected formatted answer: %q", text)
+	}
+
+	if _, none := extractCitations("The bus leaves at 7:30.", chunks); len(none) != 0 {
+		t.Fatalf("expected no citations, got %#v", none)
+	}
+}
+
+func TestGuardianScopeOnlyNarrowsToLinkedChildren(t *testing.T) {
+	if phoneKey("whatsapp:+91 98765-43210") != phoneKey("098765 43210") {
+		t.Fatal("expected phone numbers to normalise to the same key")
+	}
+
+	scope := &guardianScope{Children: []linkedChild{{Name: "Asha Verma"}, {Name: "Rohan Verma"}}}
+	if got, err := scope.selectChildren(""); err != nil || len(got) != 2 {
+		t.Fatalf("expected all children, got %#v, %v", got, err)
+	}
+	if got, err := scope.selectChildren("asha"); err != nil || len(got) != 1 || got[0].Name != "Asha Verma" {
+		t.Fatalf("expected Asha, got %#v, %v", got, err)
+	}
+	if _, err := scope.selectChildren("Meera Shah"); err != ErrNoLinkedChild {
+		t.Fatalf("expected unlinked child to be denied, got %v", err)
+	}
+}
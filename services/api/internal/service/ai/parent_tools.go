@@ -0,0 +1,481 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/schoolerp/api/internal/db"
+	"github.com/schoolerp/api/internal/foundation/ai"
+	"github.com/schoolerp/api/internal/foundation/audit"
+)
+
+const (
+	ToolFeeSummary     = "get_fee_summary"
+	ToolAttendance     = "get_attendance_today"
+	ToolHomeworkDue    = "get_homework_due"
+	ToolUpcomingExams  = "get_upcoming_exams"
+	homeworkWindowDays = 7
+	examWindowDays     = 45
+)
+
+var ErrNoLinkedChild = errors.New("no linked child matches this request")
+
+// ParentTools exposes read-only student data to the helpdesk model. Every
+// call is scoped to the children of one guardian — the sender's phone number
+// on WhatsApp, the signed-in user in the app — and is written to the audit
+// log.
+type ParentTools struct {
+	q     db.Querier
+	pool  *pgxpool.Pool
+	audit *audit.Logger
+
+	// links loads the guardian-child links a scope is built from.
+	links func(ctx context.Context, tenantID pgtype.UUID, match string, arg any) ([]guardianLink, error)
+}
+
+func NewParentTools(q db.Querier, pool *pgxpool.Pool, auditLogger *audit.Logger) *ParentTools {
+	t := &ParentTools{q: q, pool: pool, audit: auditLogger}
+	t.links = t.queryGuardianLinks
+	return t
+}
+
+type linkedChild struct {
+	ID        pgtype.UUID
+	Name      string
+	SectionID pgtype.UUID
+	Class     string
+}
+
+// guardianScope is what a tool call may see: the guardian records matching
+// the caller and the students linked to them in this tenant.
+type guardianScope struct {
+	TenantID    pgtype.UUID
+	UserID      pgtype.UUID
+	Channel     string
+	GuardianIDs []string
+	Phone       string
+	Children    []linkedChild
+}
+
+type guardianLink struct {
+	GuardianID string
+	UserID     pgtype.UUID
+	Child      linkedChild
+}
+
+const (
+	matchGuardianPhone = `right(regexp_replace(g.phone, '\D', '', 'g'), 10) = $2`
+	matchGuardianUser  = `g.user_id = $2::uuid`
+)
+
+// phoneKey reduces a phone number to its last ten digits so "+91 98765
+// 43210", "whatsapp:+919876543210" and "09876543210" all match.
+func phoneKey(phone string) string {
+	digits := strings.Map(func(r rune) rune {
+		if unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, phone)
+	if len(digits) > 10 {
+		digits = digits[len(digits)-10:]
+	}
+	return digits
+}
+
+func maskPhone(phone string) string {
+	key := phoneKey(phone)
+	if len(key) <= 4 {
+		return "****"
+	}
+	return strings.Repeat("*", len(key)-4) + key[len(key)-4:]
+}
+
+// resolveGuardian returns nil when no guardian in the tenant uses this phone.
+func (t *ParentTools) resolveGuardian(ctx context.Context, tenantID, phone string) (*guardianScope, error) {
+	key := phoneKey(phone)
+	if len(key) < 7 {
+		return nil, nil
+	}
+	scope := &guardianScope{TenantID: toPgUUID(tenantID), Channel: ChannelWhatsApp, Phone: phone}
+	return t.fillScope(ctx, scope, matchGuardianPhone, key)
+}
+
+// resolveGuardianUser returns nil when the user is not a guardian in the
+// tenant or has no active linked children.
+func (t *ParentTools) resolveGuardianUser(ctx context.Context, tenantID, userID string) (*guardianScope, error) {
+	uid := toPgUUID(userID)
+	if !uid.Valid {
+		return nil, nil
+	}
+	scope := &guardianScope{TenantID: toPgUUID(tenantID), UserID: uid, Channel: ChannelApp}
+	return t.fillScope(ctx, scope, matchGuardianUser, uid)
+}
+
+func (t *ParentTools) fillScope(ctx context.Context, scope *guardianScope, match string, arg any) (*guardianScope, error) {
+	links, err := t.links(ctx, scope.TenantID, match, arg)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	for _, l := range links {
+		if !containsString(scope.GuardianIDs, l.GuardianID) {
+			scope.GuardianIDs = append(scope.GuardianIDs, l.GuardianID)
+		}
+		if l.UserID.Valid && !scope.UserID.Valid {
+			scope.UserID = l.UserID
+		}
+		if !seen[l.Child.ID.String()] {
+			seen[l.Child.ID.String()] = true
+			scope.Children = append(scope.Children, l.Child)
+		}
+	}
+	if len(scope.Children) == 0 {
+		return nil, nil
+	}
+	return scope, nil
+}
+
+func (t *ParentTools) queryGuardianLinks(ctx context.Context, tenantID pgtype.UUID, match string, arg any) ([]guardianLink, error) {
+	rows, err := t.pool.Query(ctx, `
+		SELECT g.id::text, g.user_id, s.id, s.full_name, s.section_id,
+		       COALESCE(c.name || ' ' || sec.name, c.name, '')
+		FROM guardians g
+		JOIN student_guardians sg ON sg.guardian_id = g.id
+		JOIN students s ON s.id = sg.student_id AND s.tenant_id = g.tenant_id
+		LEFT JOIN sections sec ON sec.id = s.section_id
+		LEFT JOIN classes c ON c.id = sec.class_id
+		WHERE g.tenant_id = $1
+		  AND `+match+`
+		  AND COALESCE(s.status, 'active') = 'active'
+		ORDER BY s.full_name`, tenantID, arg)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []guardianLink
+	for rows.Next() {
+		var l guardianLink
+		if err := rows.Scan(&l.GuardianID, &l.UserID, &l.Child.ID, &l.Child.Name, &l.Child.SectionID, &l.Child.Class); err != nil {
+			return nil, err
+		}
+		out = append(out, l)
+	}
+	return out, rows.Err()
+}
+
+func (t *ParentTools) definitions() []ai.Tool {
+	studentParam := func() map[string]interface{} {
+		return map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"student_name": map[string]interface{}{
+					"type":        "string",
+					"description": "First name or full name of the child. Omit to include all of the parent's children.",
+				},
+			},
+		}
+	}
+	return []ai.Tool{
+		{Name: ToolFeeSummary, Description: "Fee dues for the parent's children: amount due, paid and outstanding per fee head, with due dates. Amounts are in rupees.", Parameters: studentParam()},
+		{Name: ToolAttendance, Description: "Whether the parent's children were marked present, absent or late today.", Parameters: studentParam()},
+		{Name: ToolHomeworkDue, Description: "Homework due in the next 7 days for the parent's children, with submission status.", Parameters: studentParam()},
+		{Name: ToolUpcomingExams, Description: "Exams and exam subjects scheduled in the next 45 days.", Parameters: studentParam()},
+	}
+}
+
+// handler binds tool execution to one guardian scope. The model can only
+// narrow the scope by naming a child; it can never widen it.
+func (t *ParentTools) handler(scope *guardianScope) ai.ToolHandler {
+	return func(ctx context.Context, call ai.ToolCall) (string, error) {
+		var args struct {
+			StudentName string `json:"student_name"`
+		}
+		_ = json.Unmarshal(call.Arguments, &args)
+
+		children, err := scope.selectChildren(args.StudentName)
+		var result interface{}
+		if err == nil {
+			switch call.Name {
+			case ToolFeeSummary:
+				result, err = t.feeSummary(ctx, children)
+			case ToolAttendance:
+				result, err = t.attendanceToday(ctx, scope, children)
+			case ToolHomeworkDue:
+				result, err = t.homeworkDue(ctx, scope, children)
+			case ToolUpcomingExams:
+				result, err = t.upcomingExams(ctx, scope, children)
+			default:
+				err = fmt.Errorf("unknown tool %q", call.Name)
+			}
+		}
+		t.auditInvocation(ctx, scope, call, children, err)
+		if err != nil {
+			return "", err
+		}
+		out, err := json.Marshal(result)
+		if err != nil {
+			return "", err
+		}
+		return string(out), nil
+	}
+}
+
+func (s *guardianScope) selectChildren(name string) ([]linkedChild, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return s.Children, nil
+	}
+	var out []linkedChild
+	for _, c := range s.Children {
+		full := strings.ToLower(c.Name)
+		if full == name || strings.HasPrefix(full, name+" ") || containsString(strings.Fields(full), name) {
+			out = append(out, c)
+		}
+	}
+	if len(out) == 0 {
+		return nil, ErrNoLinkedChild
+	}
+	return out, nil
+}
+
+func (t *ParentTools) auditInvocation(ctx context.Context, scope *guardianScope, call ai.ToolCall, children []linkedChild, callErr error) {
+	if t.audit == nil {
+		return
+	}
+	studentIDs := make([]string, 0, len(children))
+	for _, c := range children {
+		studentIDs = append(studentIDs, c.ID.String())
+	}
+	outcome := "ok"
+	reason := ""
+	if callErr != nil {
+		outcome = "error"
+		if errors.Is(callErr, ErrNoLinkedChild) {
+			outcome = "denied"
+			reason = "child_not_linked"
+		}
+	}
+	var resourceID pgtype.UUID
+	if len(children) == 1 {
+		resourceID = children[0].ID
+	}
+	after := map[string]interface{}{
+		"channel":      scope.Channel,
+		"guardian_ids": scope.GuardianIDs,
+		"student_ids":  studentIDs,
+		"arguments":    call.Arguments,
+		"outcome":      outcome,
+	}
+	if scope.Phone != "" {
+		after["phone"] = maskPhone(scope.Phone)
+	}
+	_ = t.audit.Log(ctx, audit.Entry{
+		TenantID:     scope.TenantID,
+		UserID:       scope.UserID,
+		Action:       "ai.tool." + call.Name,
+		ResourceType: "ai_tool",
+		ResourceID:   resourceID,
+		ReasonCode:   reason,
+		After:        after,
+	})
+}
+
+func rupees(paise int64) string {
+	sign := ""
+	if paise < 0 {
+		sign = "-"
+		paise = -paise
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, paise/100, paise%100)
+}
+
+func formatDate(d pgtype.Date) string {
+	if !d.Valid {
+		return ""
+	}
+	return d.Time.Format("2006-01-02")
+}
+
+func (t *ParentTools) feeSummary(ctx context.Context, children []linkedChild) (interface{}, error) {
+	type feeItem struct {
+		FeeHead     string `json:"fee_head"`
+		DueDate     string `json:"due_date,omitempty"`
+		Amount      string `json:"amount"`
+		Paid        string `json:"paid"`
+		Outstanding string `json:"outstanding"`
+		Overdue     bool   `json:"overdue"`
+	}
+	type childFees struct {
+		Student          string    `json:"student"`
+		TotalDue         string    `json:"total_due"`
+		TotalPaid        string    `json:"total_paid"`
+		TotalOutstanding string    `json:"total_outstanding"`
+		Items            []feeItem `json:"items"`
+	}
+
+	today := time.Now().Truncate(24 * time.Hour)
+	out := make([]childFees, 0, len(children))
+	for _, c := range children {
+		rows, err := t.q.GetStudentFeeSummary(ctx, c.ID)
+		if err != nil {
+			return nil, err
+		}
+		cf := childFees{Student: c.Name, Items: []feeItem{}}
+		var due, paid int64
+		for _, r := range rows {
+			outstanding := max(r.Amount-r.PaidAmount, 0)
+			due += r.Amount
+			paid += r.PaidAmount
+			cf.Items = append(cf.Items, feeItem{
+				FeeHead:     r.HeadName,
+				DueDate:     formatDate(r.DueDate),
+				Amount:      rupees(r.Amount),
+				Paid:        rupees(r.PaidAmount),
+				Outstanding: rupees(outstanding),
+				Overdue:     outstanding > 0 && r.DueDate.Valid && r.DueDate.Time.Before(today),
+			})
+		}
+		cf.TotalDue = rupees(due)
+		cf.TotalPaid = rupees(paid)
+		cf.TotalOutstanding = rupees(max(due-paid, 0))
+		out = append(out, cf)
+	}
+	return out, nil
+}
+
+func (t *ParentTools) attendanceToday(ctx context.Context, scope *guardianScope, children []linkedChild) (interface{}, error) {
+	type childAttendance struct {
+		Student string `json:"student"`
+		Date    string `json:"date"`
+		Status  string `json:"status"`
+		Remarks string `json:"remarks,omitempty"`
+	}
+	out := make([]childAttendance, 0, len(children))
+	for _, c := range children {
+		row := childAttendance{Student: c.Name, Date: time.Now().Format("2006-01-02"), Status: "not_marked"}
+		var status string
+		var remarks pgtype.Text
+		err := t.pool.QueryRow(ctx, `
+			SELECT ae.status, ae.remarks
+			FROM attendance_entries ae
+			JOIN attendance_sessions s ON s.id = ae.session_id
+			WHERE s.tenant_id = $1 AND ae.student_id = $2 AND s.date = CURRENT_DATE
+			LIMIT 1`, scope.TenantID, c.ID).Scan(&status, &remarks)
+		if err == nil {
+			row.Status = status
+			row.Remarks = remarks.String
+		} else if !errors.Is(err, pgx.ErrNoRows) {
+			return nil, err
+		}
+		out = append(out, row)
+	}
+	return out, nil
+}
+
+func (t *ParentTools) homeworkDue(ctx context.Context, scope *guardianScope, children []linkedChild) (interface{}, error) {
+	type homeworkItem struct {
+		Subject          string `json:"subject"`
+		Title            string `json:"title"`
+		DueDate          string `json:"due_date"`
+		SubmissionStatus string `json:"submission_status"`
+	}
+	type childHomework struct {
+		Student  string         `json:"student"`
+		Homework []homeworkItem `json:"homework"`
+	}
+
+	now := time.Now()
+	until := now.AddDate(0, 0, homeworkWindowDays)
+	out := make([]childHomework, 0, len(children))
+	for _, c := range children {
+		rows, err := t.q.GetHomeworkForStudent(ctx, db.GetHomeworkForStudentParams{ID: c.ID, TenantID: scope.TenantID})
+		if err != nil {
+			return nil, err
+		}
+		ch := childHomework{Student: c.Name, Homework: []homeworkItem{}}
+		for _, r := range rows {
+			if !r.DueDate.Valid || r.DueDate.Time.Before(now) || r.DueDate.Time.After(until) {
+				continue
+			}
+			status := r.SubmissionStatus.String
+			if !r.SubmissionStatus.Valid {
+				status = "not_submitted"
+			}
+			ch.Homework = append(ch.Homework, homeworkItem{
+				Subject:          r.SubjectName,
+				Title:            r.Title,
+				DueDate:          r.DueDate.Time.Format(time.RFC3339),
+				SubmissionStatus: status,
+			})
+		}
+		out = append(out, ch)
+	}
+	return out, nil
+}
+
+// upcomingExams lists scheduled exam subjects. Exams are tenant-wide in this
+// schema, so the result is the same for every child.
+func (t *ParentTools) upcomingExams(ctx context.Context, scope *guardianScope, children []linkedChild) (interface{}, error) {
+	type examItem struct {
+		Exam     string `json:"exam"`
+		Subject  string `json:"subject"`
+		Date     string `json:"date"`
+		MaxMarks int32  `json:"max_marks"`
+	}
+	rows, err := t.pool.Query(ctx, `
+		SELECT e.name, sub.name, es.exam_date, es.max_marks
+		FROM exams e
+		JOIN exam_subjects es ON es.exam_id = e.id
+		JOIN subjects sub ON sub.id = es.subject_id
+		WHERE e.tenant_id = $1
+		  AND e.status <> 'draft'
+		  AND es.exam_date BETWEEN CURRENT_DATE AND CURRENT_DATE + $2::int
+		ORDER BY es.exam_date, e.name, sub.name
+		LIMIT 50`, scope.TenantID, examWindowDays)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	exams := []examItem{}
+	for rows.Next() {
+		var item examItem
+		var date pgtype.Date
+		if err := rows.Scan(&item.Exam, &item.Subject, &date, &item.MaxMarks); err != nil {
+			return nil, err
+		}
+		item.Date = formatDate(date)
+		exams = append(exams, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	students := make([]string, 0, len(children))
+	for _, c := range children {
+		students = append(students, c.Name)
+	}
+	return map[string]interface{}{"students": students, "exams": exams}, nil
+}
+
+func (s *guardianScope) describe() string {
+	names := make([]string, 0, len(s.Children))
+	for _, c := range s.Children {
+		if c.Class != "" {
+			names = append(names, fmt.Sprintf("%s (%s)", c.Name, c.Class))
+		} else {
+			names = append(names, c.Name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
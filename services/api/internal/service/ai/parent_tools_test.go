@@ -0,0 +1,154 @@
+package ai
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/schoolerp/api/internal/db"
+	"github.com/schoolerp/api/internal/foundation/ai"
+)
+
+const (
+	toolTenant   = "0190a000-0000-7000-8000-000000000001"
+	toolGuardian = "0190a000-0000-7000-8000-000000000002"
+)
+
+type toolQuerier struct {
+	db.Querier
+	mu      sync.Mutex
+	feesFor []pgtype.UUID
+}
+
+func (q *toolQuerier) GetStudentFeeSummary(_ context.Context, studentID pgtype.UUID) ([]db.GetStudentFeeSummaryRow, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.feesFor = append(q.feesFor, studentID)
+	return []db.GetStudentFeeSummaryRow{{HeadName: "Tuition", Amount: 120000, PaidAmount: 30000}}, nil
+}
+
+func (q *toolQuerier) CreateAIQueryLog(context.Context, db.CreateAIQueryLogParams) (db.AiQueryLog, error) {
+	return db.AiQueryLog{}, nil
+}
+
+func (q *toolQuerier) GetAIChatSession(context.Context, db.GetAIChatSessionParams) (db.AiChatSession, error) {
+	return db.AiChatSession{}, pgx.ErrNoRows
+}
+
+func (q *toolQuerier) UpsertAIChatSession(context.Context, db.UpsertAIChatSessionParams) (db.AiChatSession, error) {
+	return db.AiChatSession{}, nil
+}
+
+// fakeModel detects English, asks for the fee summary and then answers from
+// the tool result, recording every request body.
+func fakeModel(t *testing.T) (*httptest.Server, *[]string) {
+	t.Helper()
+	var (
+		mu     sync.Mutex
+		bodies []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, _ := io.ReadAll(r.Body)
+		body := string(raw)
+		mu.Lock()
+		bodies = append(bodies, body)
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case strings.Contains(body, "language detection"):
+			_, _ = w.Write([]byte(`{"choices":[{"message":{"content":"en"}}]}`))
+		case strings.Contains(body, `"role":"tool"`):
+			_, _ = w.Write([]byte(`{"choices":[{"message":{"content":"Asha has Rs 900.00 outstanding."}}]}`))
+		default:
+			_, _ = w.Write([]byte(`{"choices":[{"message":{"content":null,"tool_calls":[{"id":"call_1","type":"function","function":{"name":"get_fee_summary","arguments":"{}"}}]}}]}`))
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &bodies
+}
+
+func newToolService(t *testing.T, q *toolQuerier) (*Service, *ParentTools, *[]string, *[]string) {
+	srv, bodies := fakeModel(t)
+	client := ai.NewClient(ai.ProviderOpenAI, "test-key")
+	client.SetBaseURL(srv.URL)
+	s := &Service{q: q, client: client}
+
+	asha := pgtype.UUID{Bytes: [16]byte{15: 20}, Valid: true}
+	var matches []string
+	tools := NewParentTools(q, nil, nil)
+	tools.links = func(_ context.Context, _ pgtype.UUID, match string, arg any) ([]guardianLink, error) {
+		matches = append(matches, match)
+		switch v := arg.(type) {
+		case pgtype.UUID:
+			if v.String() != toolGuardian {
+				return nil, nil
+			}
+		case string:
+			if v != "9876543210" {
+				return nil, nil
+			}
+		}
+		return []guardianLink{{GuardianID: "g1", Child: linkedChild{ID: asha, Name: "Asha Verma"}}}, nil
+	}
+	s.SetParentTools(tools)
+	return s, tools, bodies, &matches
+}
+
+func TestAnswerParentQueryScopesToolsToSignedInGuardian(t *testing.T) {
+	q := &toolQuerier{}
+	s, _, bodies, matches := newToolService(t, q)
+
+	answer, err := s.AnswerParentQuery(context.Background(), toolTenant, toolGuardian, "What are the dues?", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if answer.HandedOff || len(answer.ToolsUsed) != 1 || answer.ToolsUsed[0] != ToolFeeSummary {
+		t.Fatalf("expected a tool answer, got %#v", answer)
+	}
+	if len(*matches) != 1 || (*matches)[0] != matchGuardianUser {
+		t.Fatalf("expected the guardian to be resolved by user id, got %v", *matches)
+	}
+	if len(q.feesFor) != 1 || q.feesFor[0].Bytes[15] != 20 {
+		t.Fatalf("expected fees for the linked child only, got %v", q.feesFor)
+	}
+	if !strings.Contains(strings.Join(*bodies, "\n"), `900.00`) {
+		t.Fatalf("expected the tool result to reach the model")
+	}
+
+	// Someone who is not a guardian gets no tools and, without a
+	// knowledgebase, is handed off.
+	other, err := s.AnswerParentQuery(context.Background(), toolTenant, "0190a000-0000-7000-8000-000000000009", "What are the dues?", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !other.HandedOff || other.HandoffReason != HandoffKnowledgebaseUnavailable {
+		t.Fatalf("expected a handoff without tools, got %#v", other)
+	}
+}
+
+func TestWhatsAppScopesToolsToSender(t *testing.T) {
+	q := &toolQuerier{}
+	s, tools, _, matches := newToolService(t, q)
+	wa := NewWhatsAppService(s, q)
+	wa.SetParentTools(tools)
+
+	reply, err := wa.HandleIncomingMessage(context.Background(), toolTenant, "whatsapp:+91 98765 43210", "What are the dues?")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(reply, "900.00") {
+		t.Fatalf("unexpected reply %q", reply)
+	}
+	if len(*matches) != 1 || (*matches)[0] != matchGuardianPhone {
+		t.Fatalf("expected the guardian to be resolved by phone, got %v", *matches)
+	}
+	if len(q.feesFor) != 1 {
+		t.Fatalf("expected one fee lookup, got %v", q.feesFor)
+	}
+}
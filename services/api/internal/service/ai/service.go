@@ -9,6 +9,7 @@ import (
 	"strings"
 
 	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/schoolerp/api/internal/db"
 	"github.com/schoolerp/api/internal/foundation/ai"
 )
@@ -16,6 +17,11 @@ import (
 type Service struct {
 	q      db.Querier
 	client *ai.Client
+
+	kb            KnowledgeRetriever
+	pool          *pgxpool.Pool
+	minConfidence float64
+	tools         *ParentTools
 }
 
 func NewService(q db.Querier) (*Service, error) {
@@ -108,33 +114,35 @@ Keep it practical and easy for a teacher to follow.`, subject, topic, grade)
 	return resp, nil
 }
 
-// AnswerParentQuery handles general school queries grounded in provided context
-func (s *Service) AnswerParentQuery(ctx context.Context, tenantID, userID string, query, contextInfo string) (string, error) {
-	prompt := fmt.Sprintf(`You are a school admin helpdesk assistant. 
-Use the following context to answer the parent's query. If the answer is not in the context, politely say you don't know and suggest contacting the school office.
-
-Context:
-%s
-
-Parent Query: %s
-
-Answer concisely and professionally.`, contextInfo, query)
-
-	resp, err := s.client.Chat(ctx, ai.ChatRequest{
-		Messages: []ai.Message{
-			{Role: "system", Content: "You are a professional school helpdesk agent. Always be polite and helpful."},
-			{Role: "user", Content: prompt},
-		},
-		Temperature: 0.3,
-	})
+// SetParentTools lets the app helpdesk look up fees, attendance, homework
+// and exams for the children of the signed-in guardian.
+func (s *Service) SetParentTools(tools *ParentTools) {
+	s.tools = tools
+}
 
-	if err == nil {
-		go s.logQuery(context.Background(), tenantID, userID, string(s.client.GetProvider()), "default", 0, 0, map[string]interface{}{
-			"type": "parent_query",
-		})
+// AnswerParentQuery answers a parent's question from the tenant
+// knowledgebase with citations, or hands it off to staff when the published
+// documents do not cover it. contextInfo is extra app context (for example
+// the child's class) and is never cited as a source. Tools are only offered
+// when userID belongs to a guardian of the tenant.
+func (s *Service) AnswerParentQuery(ctx context.Context, tenantID, userID string, query, contextInfo string) (GroundedAnswer, error) {
+	req := helpdeskRequest{
+		TenantID:    tenantID,
+		UserID:      userID,
+		Channel:     ChannelApp,
+		Query:       query,
+		ContextInfo: contextInfo,
 	}
-
-	return resp, err
+	if s.tools != nil {
+		scope, err := s.tools.resolveGuardianUser(ctx, tenantID, userID)
+		if err != nil {
+			return GroundedAnswer{}, fmt.Errorf("failed to resolve guardian: %w", err)
+		}
+		if scope != nil {
+			req.Tools = &toolContext{parent: s.tools, scope: scope}
+		}
+	}
+	return s.answerGrounded(ctx, req)
 }
 
 // GenerateRubric creates evaluation criteria for an exam
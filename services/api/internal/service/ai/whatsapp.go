@@ -14,12 +14,19 @@ import (
 type WhatsAppService struct {
 	aiSvc *Service
 	q     db.Querier
+	tools *ParentTools
 }
 
 func NewWhatsAppService(aiSvc *Service, q db.Querier) *WhatsAppService {
 	return &WhatsAppService{aiSvc: aiSvc, q: q}
 }
 
+// SetParentTools lets the bot look up fees, attendance, homework and exams
+// for the children of the guardian whose phone number sent the message.
+func (s *WhatsAppService) SetParentTools(tools *ParentTools) {
+	s.tools = tools
+}
+
 func (s *WhatsAppService) HandleIncomingMessage(ctx context.Context, tenantID, fromNumber, text string) (string, error) {
 	tID := toPgUUID(tenantID)
 
@@ -36,8 +43,12 @@ func (s *WhatsAppService) HandleIncomingMessage(ctx context.Context, tenantID, f
 		}
 	}
 
+	// Only user and assistant turns are kept; the grounded prompt and its
+	// sources are rebuilt for every message.
+	history := trimHistory(messages, len(messages))
+
 	// 2. Append User Message
-	messages = append(messages, ai.Message{Role: "user", Content: text})
+	messages = append(history, ai.Message{Role: "user", Content: text})
 
 	// 3. Detect Language (if first message or session language unknown)
 	lang := "en"
@@ -54,21 +65,31 @@ func (s *WhatsAppService) HandleIncomingMessage(ctx context.Context, tenantID, f
 		}
 	}
 
-	// 4. Call AI Service with History and Language instructions
-	systemPrompt := "You are a professional school helpdesk agent. Always be polite and helpful. "
-	if lang != "en" {
-		systemPrompt += fmt.Sprintf("Please respond in the language code: %s.", lang)
+	// 4. Answer from the knowledgebase; the sender is treated as a parent.
+	// Tools are only offered when the number belongs to a known guardian.
+	req := helpdeskRequest{
+		TenantID:   tenantID,
+		Channel:    ChannelWhatsApp,
+		ExternalID: fromNumber,
+		Query:      text,
+		Language:   lang,
+		History:    history,
 	}
-
-	// Ensure system prompt is at the start
-	if len(messages) > 0 && messages[0].Role != "system" {
-		messages = append([]ai.Message{{Role: "system", Content: systemPrompt}}, messages...)
+	if s.tools != nil {
+		scope, err := s.tools.resolveGuardian(ctx, tenantID, fromNumber)
+		if err != nil {
+			return "", fmt.Errorf("failed to resolve guardian: %w", err)
+		}
+		if scope != nil {
+			req.UserID = uuidString(scope.UserID)
+			req.Tools = &toolContext{parent: s.tools, scope: scope}
+		}
 	}
-
-	response, err := s.aiSvc.ChatWithHistory(ctx, tenantID, messages)
+	answer, err := s.aiSvc.answerGrounded(ctx, req)
 	if err != nil {
 		return "", fmt.Errorf("failed to get AI response: %w", err)
 	}
+	response := FormatWithSources(answer)
 
 	// 5. Append AI Response
 	messages = append(messages, ai.Message{Role: "assistant", Content: response})
@@ -76,7 +97,11 @@ func (s *WhatsAppService) HandleIncomingMessage(ctx context.Context, tenantID, f
 	// 6. Save Session
 	msgJSON, _ := json.Marshal(messages)
 	expiresAt := time.Now().Add(24 * time.Hour)
-	metaJSON, _ := json.Marshal(map[string]interface{}{"language": lang})
+	metaJSON, _ := json.Marshal(map[string]interface{}{
+		"language":       lang,
+		"last_answer_id": answer.ID,
+		"handed_off":     answer.HandedOff,
+	})
 
 	_, err = s.q.UpsertAIChatSession(ctx, db.UpsertAIChatSessionParams{
 		TenantID:   tID,
@@ -89,6 +114,13 @@ func (s *WhatsAppService) HandleIncomingMessage(ctx context.Context, tenantID, f
 	return response, err
 }
 
+func uuidString(u pgtype.UUID) string {
+	if !u.Valid {
+		return ""
+	}
+	return u.String()
+}
+
 func toPgUUID(s string) pgtype.UUID {
 	var u pgtype.UUID
 	u.Scan(s)
@@ -13,6 +13,7 @@ import (
 	"github.com/schoolerp/api/internal/db"
 	"github.com/schoolerp/api/internal/foundation/approvals"
 	"github.com/schoolerp/api/internal/foundation/audit"
+	"github.com/schoolerp/api/internal/foundation/datascope"
 	"github.com/schoolerp/api/internal/foundation/locks"
 	"github.com/schoolerp/api/internal/foundation/policy"
 )
@@ -23,10 +24,11 @@ type Service struct {
 	policy    *policy.Evaluator
 	approvals *approvals.Service
 	locks     *locks.Service
+	scope     *datascope.Service
 }
 
-func NewService(q db.Querier, audit *audit.Logger, poly *policy.Evaluator, app *approvals.Service, lks *locks.Service) *Service {
-	return &Service{q: q, audit: audit, policy: poly, approvals: app, locks: lks}
+func NewService(q db.Querier, audit *audit.Logger, poly *policy.Evaluator, app *approvals.Service, lks *locks.Service, scope *datascope.Service) *Service {
+	return &Service{q: q, audit: audit, policy: poly, approvals: app, locks: lks, scope: scope}
 }
 
 type MarkAttendanceParams struct {
@@ -129,6 +131,9 @@ func attendanceEntryStatusAllowed(status string) bool {
 	}
 }
 
+// MarkAttendance records a section's register. A teacher who does not teach
+// the section, or lists a student from another one, gets a
+// *datascope.Violation.
 func (s *Service) MarkAttendance(ctx context.Context, p MarkAttendanceParams) error {
 	if strings.TrimSpace(p.ClassSectionID) == "" {
 		return errors.New("class_section_id is required")
@@ -146,6 +151,14 @@ func (s *Service) MarkAttendance(ctx context.Context, p MarkAttendanceParams) er
 		}
 	}
 
+	studentIDs := make([]string, len(p.Entries))
+	for i, e := range p.Entries {
+		studentIDs[i] = e.StudentID
+	}
+	if err := s.scope.AuthorizeSection(ctx, p.TenantID, datascope.Actor{UserID: p.UserID, Role: p.Role}, p.ClassSectionID, studentIDs); err != nil {
+		return err
+	}
+
 	locked, err := s.locks.IsLocked(ctx, p.TenantID, "attendance", nil)
 	if err != nil {
 		return err
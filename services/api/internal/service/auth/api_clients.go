@@ -0,0 +1,400 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/rs/zerolog/log"
+	"github.com/schoolerp/api/internal/db"
+	"github.com/schoolerp/api/internal/foundation/apikeys"
+)
+
+var (
+	ErrAPIClientNotFound   = errors.New("api client not found")
+	ErrAPIClientInvalid    = errors.New("invalid api client")
+	ErrAPICredentialDenied = errors.New("api credential is invalid, expired or revoked")
+)
+
+const (
+	apiClientDefaultRateLimit = 120
+	apiClientMaxRateLimit     = 6000
+	apiAccessTokenTTL         = time.Hour
+	// Authenticated credentials are cached this long per replica, which
+	// bounds how long a revocation takes to reach other replicas.
+	apiCredentialCacheTTL = 15 * time.Second
+)
+
+type APIClientInput struct {
+	Name               string     `json:"name"`
+	Description        string     `json:"description"`
+	Scopes             []string   `json:"scopes"`
+	RateLimitPerMinute int32      `json:"rate_limit_per_minute"`
+	ExpiresAt          *time.Time `json:"expires_at"`
+}
+
+// APIClientCredentials is returned when a secret is issued. The secret is not
+// stored and cannot be shown again.
+type APIClientCredentials struct {
+	Client       db.APIClient `json:"client"`
+	ClientSecret string       `json:"client_secret"`
+	APIKey       string       `json:"api_key"`
+}
+
+// APIAccessToken is the client-credentials grant response (RFC 6749 §5.1).
+type APIAccessToken struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+	Scope       string `json:"scope"`
+}
+
+type cachedPrincipal struct {
+	principal apikeys.Principal
+	expiresAt time.Time
+}
+
+// APIClientService issues and authenticates tenant API clients. Requests
+// made with a client act as its service-account user.
+type APIClientService struct {
+	queries *db.Queries
+
+	mu    sync.Mutex
+	cache map[string]cachedPrincipal
+}
+
+func newAPIClientService(s *Service) *APIClientService {
+	return &APIClientService{queries: s.queries, cache: make(map[string]cachedPrincipal)}
+}
+
+func (s *APIClientService) CreateClient(ctx context.Context, tenantID, actorID string, in APIClientInput) (*APIClientCredentials, error) {
+	tid, ok := parseUUID(tenantID)
+	if !ok {
+		return nil, ErrTenantRequired
+	}
+	in, err := normalizeAPIClientInput(in)
+	if err != nil {
+		return nil, err
+	}
+	clientID, err := apikeys.NewClientID()
+	if err != nil {
+		return nil, err
+	}
+	secret, err := apikeys.NewSecret()
+	if err != nil {
+		return nil, err
+	}
+	createdBy, _ := parseUUID(actorID)
+
+	client, err := s.queries.CreateAPIClient(ctx, db.CreateAPIClientParams{
+		TenantID:           tid,
+		Name:               in.Name,
+		Description:        pgtype.Text{String: in.Description, Valid: in.Description != ""},
+		ClientID:           clientID,
+		SecretHash:         apikeys.Hash(secret),
+		SecretHint:         secretHint(secret),
+		Scopes:             in.Scopes,
+		RateLimitPerMinute: in.RateLimitPerMinute,
+		ExpiresAt:          optionalTime(in.ExpiresAt),
+		CreatedBy:          createdBy,
+	})
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return nil, fmt.Errorf("%w: a client with this name already exists", ErrAPIClientInvalid)
+		}
+		return nil, err
+	}
+	return &APIClientCredentials{Client: client, ClientSecret: secret, APIKey: apikeys.APIKey(clientID, secret)}, nil
+}
+
+func (s *APIClientService) ListClients(ctx context.Context, tenantID string) ([]db.APIClient, error) {
+	tid, ok := parseUUID(tenantID)
+	if !ok {
+		return nil, ErrTenantRequired
+	}
+	return s.queries.ListAPIClients(ctx, tid)
+}
+
+// UpdateClient replaces the name, scopes, rate limit and expiry of a client.
+func (s *APIClientService) UpdateClient(ctx context.Context, tenantID, id string, in APIClientInput) (db.APIClient, error) {
+	tid, cid, err := apiClientIDs(tenantID, id)
+	if err != nil {
+		return db.APIClient{}, err
+	}
+	in, err = normalizeAPIClientInput(in)
+	if err != nil {
+		return db.APIClient{}, err
+	}
+	client, err := s.queries.UpdateAPIClient(ctx, db.UpdateAPIClientParams{
+		TenantID:           tid,
+		ID:                 cid,
+		Name:               in.Name,
+		Description:        pgtype.Text{String: in.Description, Valid: in.Description != ""},
+		Scopes:             in.Scopes,
+		RateLimitPerMinute: in.RateLimitPerMinute,
+		ExpiresAt:          optionalTime(in.ExpiresAt),
+	})
+	if err != nil {
+		return db.APIClient{}, apiClientNotFound(err)
+	}
+	s.forget(client.ID)
+	return client, nil
+}
+
+// RotateSecret issues a new secret; the old secret and the access tokens
+// issued with it stop working.
+func (s *APIClientService) RotateSecret(ctx context.Context, tenantID, id string) (*APIClientCredentials, error) {
+	tid, cid, err := apiClientIDs(tenantID, id)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := apikeys.NewSecret()
+	if err != nil {
+		return nil, err
+	}
+	client, err := s.queries.UpdateAPIClientSecret(ctx, tid, cid, apikeys.Hash(secret), secretHint(secret))
+	if err != nil {
+		return nil, apiClientNotFound(err)
+	}
+	s.forget(client.ID)
+	return &APIClientCredentials{Client: client, ClientSecret: secret, APIKey: apikeys.APIKey(client.ClientID, secret)}, nil
+}
+
+func (s *APIClientService) RevokeClient(ctx context.Context, tenantID, id, actorID, reason string) (db.APIClient, error) {
+	tid, cid, err := apiClientIDs(tenantID, id)
+	if err != nil {
+		return db.APIClient{}, err
+	}
+	revokedBy, _ := parseUUID(actorID)
+	client, err := s.queries.RevokeAPIClient(ctx, tid, cid, revokedBy, strings.TrimSpace(reason))
+	if err != nil {
+		return db.APIClient{}, apiClientNotFound(err)
+	}
+	s.forget(client.ID)
+	return client, nil
+}
+
+// IssueToken implements the OAuth2 client-credentials grant. requested
+// narrows the token to a subset of the client's scopes; empty means all.
+func (s *APIClientService) IssueToken(ctx context.Context, clientID, clientSecret string, requested []string) (*APIAccessToken, error) {
+	client, err := s.queries.GetAPIClientByClientID(ctx, strings.TrimSpace(clientID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrAPICredentialDenied
+		}
+		return nil, err
+	}
+	if !secretMatches(client.SecretHash, clientSecret) || !apiClientUsable(client, time.Now()) {
+		return nil, ErrAPICredentialDenied
+	}
+
+	scopes := client.Scopes
+	if len(requested) > 0 {
+		normalized, err := apikeys.NormalizeScopes(requested)
+		if err != nil {
+			return nil, err
+		}
+		for _, sc := range normalized {
+			if !slices.Contains(client.Scopes, sc) {
+				return nil, fmt.Errorf("%w: %q is not granted to this client", apikeys.ErrInvalidScope, sc)
+			}
+		}
+		scopes = normalized
+	}
+
+	token, err := apikeys.NewAccessToken()
+	if err != nil {
+		return nil, err
+	}
+	ttl := apiAccessTokenTTL
+	if client.ExpiresAt.Valid {
+		if remaining := time.Until(client.ExpiresAt.Time); remaining < ttl {
+			ttl = remaining
+		}
+	}
+	expires := pgtype.Timestamptz{Time: time.Now().Add(ttl), Valid: true}
+	if err := s.queries.CreateAPIClientToken(ctx, client.ID, apikeys.Hash(token), scopes, expires); err != nil {
+		return nil, err
+	}
+	return &APIAccessToken{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(ttl / time.Second),
+		Scope:       strings.Join(scopes, " "),
+	}, nil
+}
+
+// Authenticate resolves an API key or an access token to the client it
+// belongs to. It satisfies middleware.APIClientAuthenticator.
+func (s *APIClientService) Authenticate(ctx context.Context, credential, clientIP string) (apikeys.Principal, error) {
+	cacheKey := apikeys.Hash(credential)
+	if p, ok := s.cached(cacheKey); ok {
+		return p, nil
+	}
+
+	var (
+		client db.APIClient
+		scopes []string
+		err    error
+	)
+	if apikeys.IsAccessToken(credential) {
+		var granted []string
+		client, granted, err = s.queries.GetAPIClientByToken(ctx, cacheKey)
+		// A token never outlives a narrowing of its client's scopes.
+		for _, sc := range granted {
+			if slices.Contains(client.Scopes, sc) {
+				scopes = append(scopes, sc)
+			}
+		}
+	} else {
+		clientID, secret, ok := apikeys.SplitAPIKey(credential)
+		if !ok {
+			return apikeys.Principal{}, ErrAPICredentialDenied
+		}
+		client, err = s.queries.GetAPIClientByClientID(ctx, clientID)
+		if err == nil && !secretMatches(client.SecretHash, secret) {
+			err = ErrAPICredentialDenied
+		}
+		scopes = client.Scopes
+	}
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return apikeys.Principal{}, ErrAPICredentialDenied
+		}
+		return apikeys.Principal{}, err
+	}
+	if !apiClientUsable(client, time.Now()) {
+		return apikeys.Principal{}, ErrAPICredentialDenied
+	}
+
+	if err := s.queries.TouchAPIClient(ctx, client.ID, clientIP); err != nil {
+		log.Ctx(ctx).Warn().Err(err).Str("api_client_id", client.ID.String()).Msg("failed to record api client use")
+	}
+
+	p := apikeys.Principal{
+		ClientID:           client.ID.String(),
+		ClientKey:          client.ClientID,
+		Name:               client.Name,
+		TenantID:           client.TenantID.String(),
+		ServiceUserID:      client.ServiceUserID.String(),
+		Scopes:             scopes,
+		RateLimitPerMinute: int(client.RateLimitPerMinute),
+	}
+	s.remember(cacheKey, p, client.ExpiresAt)
+	return p, nil
+}
+
+func (s *APIClientService) cached(key string) (apikeys.Principal, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.cache[key]
+	if !ok || time.Now().After(entry.expiresAt) {
+		delete(s.cache, key)
+		return apikeys.Principal{}, false
+	}
+	return entry.principal, true
+}
+
+func (s *APIClientService) remember(key string, p apikeys.Principal, clientExpiry pgtype.Timestamptz) {
+	expires := time.Now().Add(apiCredentialCacheTTL)
+	if clientExpiry.Valid && clientExpiry.Time.Before(expires) {
+		expires = clientExpiry.Time
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for k, e := range s.cache {
+		if now.After(e.expiresAt) {
+			delete(s.cache, k)
+		}
+	}
+	s.cache[key] = cachedPrincipal{principal: p, expiresAt: expires}
+}
+
+// forget drops this replica's cached credentials of a client.
+func (s *APIClientService) forget(id pgtype.UUID) {
+	clientID := id.String()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, e := range s.cache {
+		if e.principal.ClientID == clientID {
+			delete(s.cache, k)
+		}
+	}
+}
+
+func normalizeAPIClientInput(in APIClientInput) (APIClientInput, error) {
+	in.Name = strings.TrimSpace(in.Name)
+	in.Description = strings.TrimSpace(in.Description)
+	if in.Name == "" {
+		return in, fmt.Errorf("%w: name is required", ErrAPIClientInvalid)
+	}
+	scopes, err := apikeys.NormalizeScopes(in.Scopes)
+	if err != nil {
+		return in, fmt.Errorf("%w: %v", ErrAPIClientInvalid, err)
+	}
+	in.Scopes = scopes
+	if in.RateLimitPerMinute == 0 {
+		in.RateLimitPerMinute = apiClientDefaultRateLimit
+	}
+	if in.RateLimitPerMinute < 1 || in.RateLimitPerMinute > apiClientMaxRateLimit {
+		return in, fmt.Errorf("%w: rate_limit_per_minute must be between 1 and %d", ErrAPIClientInvalid, apiClientMaxRateLimit)
+	}
+	if in.ExpiresAt != nil && !in.ExpiresAt.After(time.Now()) {
+		return in, fmt.Errorf("%w: expires_at must be in the future", ErrAPIClientInvalid)
+	}
+	return in, nil
+}
+
+func apiClientUsable(c db.APIClient, now time.Time) bool {
+	if c.RevokedAt.Valid {
+		return false
+	}
+	return !c.ExpiresAt.Valid || now.Before(c.ExpiresAt.Time)
+}
+
+func secretMatches(hash, secret string) bool {
+	return subtle.ConstantTimeCompare([]byte(hash), []byte(apikeys.Hash(secret))) == 1
+}
+
+func secretHint(secret string) string {
+	if len(secret) <= 4 {
+		return ""
+	}
+	return "…" + secret[len(secret)-4:]
+}
+
+func optionalTime(t *time.Time) pgtype.Timestamptz {
+	if t == nil {
+		return pgtype.Timestamptz{}
+	}
+	return pgtype.Timestamptz{Time: *t, Valid: true}
+}
+
+func apiClientIDs(tenantID, id string) (pgtype.UUID, pgtype.UUID, error) {
+	tid, ok := parseUUID(tenantID)
+	if !ok {
+		return tid, pgtype.UUID{}, ErrTenantRequired
+	}
+	cid, ok := parseUUID(id)
+	if !ok {
+		return tid, cid, ErrAPIClientNotFound
+	}
+	return tid, cid, nil
+}
+
+func apiClientNotFound(err error) error {
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrAPIClientNotFound
+	}
+	return err
+}
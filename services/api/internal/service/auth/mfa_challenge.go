@@ -0,0 +1,516 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/pquerna/otp/totp"
+	"github.com/schoolerp/api/internal/db"
+	"github.com/schoolerp/api/internal/foundation/webauthn"
+)
+
+var (
+	ErrMFAChallengeInvalid   = errors.New("sign-in challenge is invalid or expired; sign in again")
+	ErrMFAMethodNotAllowed   = errors.New("this verification method is not allowed for your account")
+	ErrMFACodeInvalid        = errors.New("verification failed")
+	ErrMFAEnrollmentRequired = errors.New("register a passkey to finish signing in")
+	ErrMFAEnrollmentNotDue   = errors.New("passkey enrollment is not required for this sign-in")
+)
+
+const (
+	MFAMethodWebAuthn     = "webauthn"
+	MFAMethodTOTP         = "totp"
+	MFAMethodRecoveryCode = "recovery_code"
+
+	mfaChallengeTTL         = 5 * time.Minute
+	mfaChallengeMaxAttempts = 5
+	recoveryCodeCount       = 10
+	recoveryCodeAlphabet    = "abcdefghjkmnpqrstuvwxyz23456789"
+)
+
+// MFAChallengeRequiredError is returned by Login once the password is
+// accepted but a second factor is still needed. Token is exchanged at the
+// challenge endpoints for a session.
+type MFAChallengeRequiredError struct {
+	UserID             string    `json:"-"`
+	Token              string    `json:"mfa_token"`
+	Methods            []string  `json:"methods"`
+	EnrollmentRequired bool      `json:"enrollment_required"`
+	ExpiresAt          time.Time `json:"expires_at"`
+}
+
+func (e *MFAChallengeRequiredError) Error() string {
+	return "second factor required"
+}
+
+// AuthFactorError carries the account a failed factor check resolved to so
+// handlers can attribute the security event.
+type AuthFactorError struct {
+	UserID string
+	Method string
+	Err    error
+}
+
+func (e *AuthFactorError) Error() string { return e.Err.Error() }
+func (e *AuthFactorError) Unwrap() error { return e.Err }
+
+type mfaPolicy struct {
+	EnforceInternal        bool
+	PhishingResistantRoles []string
+}
+
+// loadMFAPolicy reads security.internal_mfa_policy. Lookup failures fall back
+// to the zero policy, matching how password login has always treated it.
+func (s *Service) loadMFAPolicy(ctx context.Context) mfaPolicy {
+	var out mfaPolicy
+	raw, err := s.queries.GetPlatformSettingValue(ctx, "security.internal_mfa_policy")
+	if err != nil || len(raw) == 0 {
+		return out
+	}
+	var payload struct {
+		EnforceForInternalUsers bool     `json:"enforce_for_internal_users"`
+		PhishingResistantRoles  []string `json:"phishing_resistant_roles"`
+	}
+	if err := json.Unmarshal(raw, &payload); err != nil {
+		return out
+	}
+	out.EnforceInternal = payload.EnforceForInternalUsers
+	out.PhishingResistantRoles = payload.PhishingResistantRoles
+	return out
+}
+
+func (p mfaPolicy) requiresPhishingResistant(roleCode string) bool {
+	for _, role := range p.PhishingResistantRoles {
+		if role == roleCode {
+			return true
+		}
+	}
+	return false
+}
+
+func (p mfaPolicy) requiresSecondFactor(roleCode string) bool {
+	return p.requiresPhishingResistant(roleCode) || (p.EnforceInternal && isInternalPlatformRole(roleCode))
+}
+
+type enrolledFactors struct {
+	Passkeys      int64
+	TOTP          bool
+	RecoveryCodes int64
+}
+
+func (f enrolledFactors) any() bool {
+	return f.Passkeys > 0 || f.TOTP
+}
+
+func (s *Service) enrolledFactors(ctx context.Context, uid pgtype.UUID) enrolledFactors {
+	var f enrolledFactors
+	if n, err := s.queries.CountWebAuthnCredentials(ctx, uid); err == nil {
+		f.Passkeys = n
+	}
+	if secret, err := s.queries.GetMFASecret(ctx, uid); err == nil {
+		f.TOTP = secret.Enabled.Bool
+	}
+	if n, err := s.queries.CountUnusedMFARecoveryCodes(ctx, uid); err == nil {
+		f.RecoveryCodes = n
+	}
+	return f
+}
+
+// challengeMethods decides how a password login must be completed. An empty
+// method list with enrollment required means the user has no factor yet and
+// proves possession by registering a passkey during the challenge.
+func challengeMethods(required, phishingResistant bool, f enrolledFactors) ([]string, bool) {
+	var methods []string
+	if f.Passkeys > 0 {
+		methods = append(methods, MFAMethodWebAuthn)
+	}
+	if f.TOTP && (!phishingResistant || f.Passkeys == 0) {
+		methods = append(methods, MFAMethodTOTP)
+	}
+	if len(methods) > 0 && f.RecoveryCodes > 0 {
+		methods = append(methods, MFAMethodRecoveryCode)
+	}
+
+	enrollment := false
+	if required {
+		enrollment = f.Passkeys == 0 && (phishingResistant || !f.TOTP)
+	}
+	return methods, enrollment
+}
+
+// requireSecondFactor runs after the password check or SSO ticket exchange.
+// Users with an enrolled factor are always challenged; the platform policy
+// additionally forces a factor (or a passkey) on the roles it names.
+// identityID is the SSO identity the session will be minted for, or unset
+// for password logins.
+func (s *Service) requireSecondFactor(ctx context.Context, userID, identityID pgtype.UUID, roleCode string) error {
+	policy := s.loadMFAPolicy(ctx)
+	required := policy.requiresSecondFactor(roleCode)
+	factors := s.enrolledFactors(ctx, userID)
+	if !required && !factors.any() {
+		return nil
+	}
+
+	methods, enrollment := challengeMethods(required, policy.requiresPhishingResistant(roleCode), factors)
+	token, err := newMFAToken()
+	if err != nil {
+		return err
+	}
+	expiresAt := time.Now().Add(mfaChallengeTTL)
+	if methods == nil {
+		methods = []string{}
+	}
+	if err := s.queries.CreateMFALoginSession(ctx, userID, identityID, hashSSOToken(token), methods, enrollment, expiresAt); err != nil {
+		return err
+	}
+	return &MFAChallengeRequiredError{
+		UserID:             userID.String(),
+		Token:              token,
+		Methods:            methods,
+		EnrollmentRequired: enrollment,
+		ExpiresAt:          expiresAt.UTC(),
+	}
+}
+
+func newMFAToken() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+func (s *Service) openMFASession(ctx context.Context, token string) (db.MFALoginSession, error) {
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return db.MFALoginSession{}, ErrMFAChallengeInvalid
+	}
+	session, err := s.queries.GetOpenMFALoginSession(ctx, hashSSOToken(token), mfaChallengeMaxAttempts)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return db.MFALoginSession{}, ErrMFAChallengeInvalid
+		}
+		return db.MFALoginSession{}, err
+	}
+	return session, nil
+}
+
+func sessionAllows(session db.MFALoginSession, method string) bool {
+	for _, m := range session.Methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// MFAWebAuthnOptions issues an assertion challenge for a pending sign-in.
+func (s *Service) MFAWebAuthnOptions(ctx context.Context, token string) (*WebAuthnCeremony, error) {
+	session, err := s.openMFASession(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if !sessionAllows(session, MFAMethodWebAuthn) {
+		return nil, ErrMFAMethodNotAllowed
+	}
+	return s.WebAuthn.beginAssertion(ctx, session.UserID)
+}
+
+type MFAVerifyInput struct {
+	Method      string                      `json:"method"`
+	Code        string                      `json:"code"`
+	ChallengeID string                      `json:"challenge_id"`
+	Credential  *webauthn.AssertionResponse `json:"credential"`
+}
+
+// checkFactor verifies one factor for the session's user. Failures count
+// against the session's attempt limit.
+func (s *Service) checkFactor(ctx context.Context, session db.MFALoginSession, in MFAVerifyInput) error {
+	if !sessionAllows(session, in.Method) {
+		return ErrMFAMethodNotAllowed
+	}
+
+	var ok bool
+	switch in.Method {
+	case MFAMethodTOTP:
+		secret, err := s.queries.GetMFASecret(ctx, session.UserID)
+		ok = err == nil && secret.Enabled.Bool && totp.Validate(strings.TrimSpace(in.Code), secret.Secret)
+	case MFAMethodRecoveryCode:
+		code := normalizeRecoveryCode(in.Code)
+		if code != "" {
+			used, err := s.queries.UseMFARecoveryCode(ctx, session.UserID, hashRecoveryCode(session.UserID, code))
+			if err != nil {
+				return err
+			}
+			ok = used
+		}
+	case MFAMethodWebAuthn:
+		if in.Credential != nil {
+			_, err := s.WebAuthn.verifyAssertion(ctx, session.UserID, in.ChallengeID, webAuthnPurposeMFA, *in.Credential, false)
+			ok = err == nil
+		}
+	}
+	if ok {
+		return nil
+	}
+	if err := s.queries.RecordMFALoginFailure(ctx, session.ID); err != nil {
+		return err
+	}
+	return ErrMFACodeInvalid
+}
+
+// VerifyMFAChallenge completes a pending password sign-in with a second factor.
+func (s *Service) VerifyMFAChallenge(ctx context.Context, token string, in MFAVerifyInput) (*LoginResult, error) {
+	session, err := s.openMFASession(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	userID := session.UserID.String()
+	if session.EnrollmentRequired {
+		return nil, &AuthFactorError{UserID: userID, Method: in.Method, Err: ErrMFAEnrollmentRequired}
+	}
+	if err := s.checkFactor(ctx, session, in); err != nil {
+		return nil, &AuthFactorError{UserID: userID, Method: in.Method, Err: err}
+	}
+	return s.completeMFASession(ctx, session)
+}
+
+// MFAEnrollmentOptions starts passkey registration for a sign-in that the
+// policy will not let through without one.
+func (s *Service) MFAEnrollmentOptions(ctx context.Context, token string) (*WebAuthnCeremony, error) {
+	session, err := s.openMFASession(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if !session.EnrollmentRequired {
+		return nil, ErrMFAEnrollmentNotDue
+	}
+	return s.WebAuthn.beginRegistration(ctx, session.UserID)
+}
+
+type MFAEnrollInput struct {
+	ChallengeID string                        `json:"challenge_id"`
+	Name        string                        `json:"name"`
+	Credential  webauthn.RegistrationResponse `json:"credential"`
+	// Method and Code prove an existing factor when the session lists one,
+	// e.g. a TOTP user whose role now requires a passkey.
+	Method string `json:"method"`
+	Code   string `json:"code"`
+}
+
+type MFAEnrollmentResult struct {
+	Login         *LoginResult `json:"login"`
+	RecoveryCodes []string     `json:"recovery_codes,omitempty"`
+}
+
+// CompleteMFAEnrollment registers the passkey and finishes the sign-in.
+func (s *Service) CompleteMFAEnrollment(ctx context.Context, token string, in MFAEnrollInput) (*MFAEnrollmentResult, error) {
+	session, err := s.openMFASession(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	userID := session.UserID.String()
+	if !session.EnrollmentRequired {
+		return nil, ErrMFAEnrollmentNotDue
+	}
+	if len(session.Methods) > 0 {
+		if err := s.checkFactor(ctx, session, MFAVerifyInput{Method: in.Method, Code: in.Code}); err != nil {
+			return nil, &AuthFactorError{UserID: userID, Method: in.Method, Err: err}
+		}
+	}
+
+	registered, err := s.WebAuthn.finishRegistration(ctx, session.UserID, in.ChallengeID, in.Name, in.Credential)
+	if err != nil {
+		return nil, &AuthFactorError{UserID: userID, Method: MFAMethodWebAuthn, Err: err}
+	}
+	login, err := s.completeMFASession(ctx, session)
+	if err != nil {
+		return nil, err
+	}
+	return &MFAEnrollmentResult{Login: login, RecoveryCodes: registered.RecoveryCodes}, nil
+}
+
+func (s *Service) completeMFASession(ctx context.Context, session db.MFALoginSession) (*LoginResult, error) {
+	completed, err := s.queries.CompleteMFALoginSession(ctx, session.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !completed {
+		return nil, ErrMFAChallengeInvalid
+	}
+
+	user, err := s.queries.GetUserByID(ctx, session.UserID)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+	if !user.IsActive.Bool {
+		return nil, ErrUserInactive
+	}
+	var identity db.AuthIdentity
+	if session.IdentityID.Valid {
+		identity, err = s.queries.GetIdentityByID(ctx, session.IdentityID)
+		if err == nil && identity.UserID != user.ID {
+			err = pgx.ErrNoRows
+		}
+	} else {
+		identity, err = s.queries.GetUserIdentity(ctx, db.GetUserIdentityParams{UserID: user.ID, Provider: "password"})
+	}
+	if err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	roleAssignment, err := s.queries.GetUserRoleAssignmentWithPermissions(ctx, user.ID)
+	if err != nil {
+		roleAssignment = db.GetUserRoleAssignmentWithPermissionsRow{
+			RoleCode:    "user",
+			Permissions: []string{},
+		}
+	}
+	return s.finishStrongLogin(ctx, user, identity, roleAssignment)
+}
+
+// finishStrongLogin applies the post-authentication account checks shared by
+// the MFA challenge and passkey sign-in before minting a session.
+func (s *Service) finishStrongLogin(ctx context.Context, user db.AuthUser, identity db.AuthIdentity, roleAssignment db.GetUserRoleAssignmentWithPermissionsRow) (*LoginResult, error) {
+	blocked, err := s.queries.IsPlatformSecurityBlocked(ctx, user.ID, roleAssignment.TenantID)
+	if err == nil && blocked {
+		return nil, ErrAccessBlocked
+	}
+	if !isSSOIdentity(identity) {
+		if err := s.enforceSSOOnly(ctx, roleAssignment); err != nil {
+			return nil, err
+		}
+	}
+
+	missingLegal, err := s.missingLegalAcceptances(ctx, user.ID)
+	if err == nil && len(missingLegal) > 0 {
+		preauth, err := s.mintLegalPreauthToken(user.ID.String())
+		if err != nil {
+			return nil, err
+		}
+		return nil, &LegalAcceptanceRequiredError{
+			Requirements: missingLegal,
+			PreauthToken: preauth,
+		}
+	}
+	return s.mintLoginResult(ctx, user, identity, roleAssignment)
+}
+
+// normalizeRecoveryCode accepts codes typed with or without the separator
+// and in any case.
+func normalizeRecoveryCode(code string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(code) {
+		if r == '-' || r == ' ' {
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// hashRecoveryCode salts with the user id so equal codes on two accounts
+// do not share a hash.
+func hashRecoveryCode(userID pgtype.UUID, normalized string) string {
+	sum := sha256.Sum256([]byte(userID.String() + ":" + normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+func generateRecoveryCode() (string, error) {
+	raw := make([]byte, 10)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	out := make([]byte, 0, 11)
+	for i, b := range raw {
+		if i == 5 {
+			out = append(out, '-')
+		}
+		out = append(out, recoveryCodeAlphabet[int(b)%len(recoveryCodeAlphabet)])
+	}
+	return string(out), nil
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes. The plaintext
+// codes are only ever returned here.
+func (s *Service) RegenerateRecoveryCodes(ctx context.Context, userID string) ([]string, error) {
+	uid, ok := parseUUID(userID)
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	return s.regenerateRecoveryCodes(ctx, uid)
+}
+
+func (s *Service) regenerateRecoveryCodes(ctx context.Context, uid pgtype.UUID) ([]string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for len(codes) < recoveryCodeCount {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(uid, normalizeRecoveryCode(code)))
+	}
+	if err := s.queries.ReplaceMFARecoveryCodes(ctx, uid, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// ensureRecoveryCodes issues codes when the user has none left, returning nil
+// if existing codes were kept.
+func (s *Service) ensureRecoveryCodes(ctx context.Context, uid pgtype.UUID) ([]string, error) {
+	n, err := s.queries.CountUnusedMFARecoveryCodes(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	if n > 0 {
+		return nil, nil
+	}
+	return s.regenerateRecoveryCodes(ctx, uid)
+}
+
+// EnsureRecoveryCodes is called after a TOTP factor is enabled.
+func (s *Service) EnsureRecoveryCodes(ctx context.Context, userID string) ([]string, error) {
+	uid, ok := parseUUID(userID)
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	return s.ensureRecoveryCodes(ctx, uid)
+}
+
+type MFAStatus struct {
+	TOTPEnabled               bool  `json:"totp_enabled"`
+	Passkeys                  int64 `json:"passkeys"`
+	RecoveryCodesRemaining    int64 `json:"recovery_codes_remaining"`
+	SecondFactorRequired      bool  `json:"second_factor_required"`
+	PhishingResistantRequired bool  `json:"phishing_resistant_required"`
+}
+
+func (s *Service) GetMFAStatus(ctx context.Context, userID string) (*MFAStatus, error) {
+	uid, ok := parseUUID(userID)
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	factors := s.enrolledFactors(ctx, uid)
+	out := &MFAStatus{
+		TOTPEnabled:            factors.TOTP,
+		Passkeys:               factors.Passkeys,
+		RecoveryCodesRemaining: factors.RecoveryCodes,
+	}
+	if role, err := s.queries.GetUserRoleAssignmentWithPermissions(ctx, uid); err == nil {
+		policy := s.loadMFAPolicy(ctx)
+		out.SecondFactorRequired = policy.requiresSecondFactor(role.RoleCode)
+		out.PhishingResistantRequired = policy.requiresPhishingResistant(role.RoleCode)
+	}
+	return out, nil
+}
@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestChallengeMethods(t *testing.T) {
+	cases := []struct {
+		name              string
+		required          bool
+		phishingResistant bool
+		factors           enrolledFactors
+		methods           []string
+		enrollment        bool
+	}{
+		{"optional totp", false, false, enrolledFactors{TOTP: true, RecoveryCodes: 10}, []string{"totp", "recovery_code"}, false},
+		{"passkey and totp", true, false, enrolledFactors{Passkeys: 2, TOTP: true}, []string{"webauthn", "totp"}, false},
+		{"enforced without factor", true, false, enrolledFactors{}, nil, true},
+		// TOTP proves the user before the required passkey is registered.
+		{"phishing resistant with totp only", true, true, enrolledFactors{TOTP: true, RecoveryCodes: 3}, []string{"totp", "recovery_code"}, true},
+		{"phishing resistant with passkey", true, true, enrolledFactors{Passkeys: 1, TOTP: true, RecoveryCodes: 3}, []string{"webauthn", "recovery_code"}, false},
+		// Recovery codes alone never count as a factor.
+		{"recovery codes only", false, false, enrolledFactors{RecoveryCodes: 5}, nil, false},
+	}
+	for _, tc := range cases {
+		methods, enrollment := challengeMethods(tc.required, tc.phishingResistant, tc.factors)
+		if !reflect.DeepEqual(methods, tc.methods) || enrollment != tc.enrollment {
+			t.Fatalf("%s: got %v enrollment=%v, want %v enrollment=%v", tc.name, methods, enrollment, tc.methods, tc.enrollment)
+		}
+	}
+}
+
+func TestMFAPolicyRoles(t *testing.T) {
+	policy := mfaPolicy{EnforceInternal: true, PhishingResistantRoles: []string{"tenant_admin"}}
+	if !policy.requiresPhishingResistant("tenant_admin") || !policy.requiresSecondFactor("tenant_admin") {
+		t.Fatalf("tenant_admin must require a passkey")
+	}
+	if policy.requiresPhishingResistant("super_admin") || !policy.requiresSecondFactor("super_admin") {
+		t.Fatalf("super_admin must require any second factor")
+	}
+	if policy.requiresSecondFactor("teacher") {
+		t.Fatalf("teacher is not covered by the policy")
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	code, err := generateRecoveryCode()
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if len(code) != 11 || code[5] != '-' {
+		t.Fatalf("unexpected recovery code format %q", code)
+	}
+
+	var a, b pgtype.UUID
+	a.Bytes[0], b.Bytes[0] = 1, 2
+	a.Valid, b.Valid = true, true
+	typed := " " + code[:5] + " " + code[6:] + " "
+	if hashRecoveryCode(a, normalizeRecoveryCode(typed)) != hashRecoveryCode(a, normalizeRecoveryCode(code)) {
+		t.Fatalf("codes typed with spaces must match")
+	}
+	if hashRecoveryCode(a, "abc") == hashRecoveryCode(b, "abc") {
+		t.Fatalf("recovery code hashes must be salted per user")
+	}
+}
@@ -0,0 +1,582 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/rs/zerolog/log"
+	"github.com/schoolerp/api/internal/db"
+	"github.com/schoolerp/api/internal/foundation/security"
+)
+
+const (
+	OTPPurposeLogin       = "login"
+	OTPPurposeVerifyPhone = "verify_phone"
+
+	OTPChannelSMS      = "sms"
+	OTPChannelWhatsApp = "whatsapp"
+
+	otpDigits         = 6
+	otpTTL            = 5 * time.Minute
+	otpMaxAttempts    = 5
+	otpResendCooldown = 30 * time.Second
+	otpIssueWindow    = time.Hour
+	otpMaxPerWindow   = 5
+	otpMaxLockouts    = 3
+
+	trustedDeviceTTL = 90 * 24 * time.Hour
+	phoneOTPProvider = "phone_otp"
+)
+
+var (
+	ErrTenantRequired   = errors.New("tenant is required")
+	ErrInvalidPhone     = errors.New("a valid phone number is required")
+	ErrInvalidChannel   = errors.New("channel must be sms or whatsapp")
+	ErrOTPThrottled     = errors.New("too many codes requested; try again later")
+	ErrOTPLocked        = errors.New("too many failed attempts; try again later")
+	ErrOTPInvalid       = errors.New("invalid or expired code")
+	ErrOTPNotAllowed    = errors.New("phone login is not available for this account")
+	ErrDeviceNotTrusted = errors.New("device is not remembered")
+	ErrGuardianNotFound = errors.New("guardian not found")
+
+	ErrOTPSecretNotConfigured = errors.New("AUTH_OTP_SECRET (or JWT_SECRETS) is not configured")
+)
+
+var nonDigits = regexp.MustCompile(`\D`)
+
+// OTPAttemptError is returned for a wrong code while the challenge still has attempts left
+// or has just run out of them.
+type OTPAttemptError struct {
+	Attempts  int
+	Remaining int
+}
+
+func (e *OTPAttemptError) Error() string {
+	return ErrOTPInvalid.Error()
+}
+
+func (e *OTPAttemptError) Is(target error) bool {
+	return target == ErrOTPInvalid
+}
+
+// OTPRequestResult describes what happened to an OTP request. Callers must not reveal
+// Sent to the client, so that phone numbers cannot be enumerated.
+type OTPRequestResult struct {
+	Sent      bool
+	Reason    string
+	Channel   string
+	ExpiresIn int
+}
+
+// OTPLoginOptions carries request metadata for OTP verification.
+type OTPLoginOptions struct {
+	RememberDevice bool
+	DeviceLabel    string
+	IPAddress      string
+	UserAgent      string
+}
+
+// OTPLoginResult is a minted session plus an optional remembered-device token.
+type OTPLoginResult struct {
+	Login           *LoginResult
+	DeviceToken     string
+	DeviceExpiresAt time.Time
+}
+
+// PhoneKey normalises a phone number to its last 10 digits, matching how guardian
+// phones are compared elsewhere. It returns "" for numbers that are too short.
+func PhoneKey(phone string) string {
+	digits := nonDigits.ReplaceAllString(phone, "")
+	if len(digits) < 10 {
+		return ""
+	}
+	return digits[len(digits)-10:]
+}
+
+// RequestLoginOTP issues a login code to a guardian's verified phone through the
+// tenant's SMS/WhatsApp gateway.
+func (s *Service) RequestLoginOTP(ctx context.Context, tenantID, phone, channel, ipAddress, userAgent string) (OTPRequestResult, error) {
+	tID, phoneKey, channel, err := parseOTPRequest(tenantID, phone, channel)
+	if err != nil {
+		return OTPRequestResult{}, err
+	}
+
+	guardian, reason, err := s.resolveOTPGuardian(ctx, tID, phoneKey)
+	if err != nil {
+		return OTPRequestResult{}, err
+	}
+	if guardian == nil {
+		return OTPRequestResult{Reason: reason, Channel: channel, ExpiresIn: int(otpTTL.Seconds())}, nil
+	}
+
+	if err := s.issueOTP(ctx, tID, *guardian, phoneKey, OTPPurposeLogin, channel, ipAddress, userAgent); err != nil {
+		return OTPRequestResult{}, err
+	}
+	return OTPRequestResult{Sent: true, Channel: channel, ExpiresIn: int(otpTTL.Seconds())}, nil
+}
+
+// VerifyLoginOTP checks a login code and mints the same session as password login.
+func (s *Service) VerifyLoginOTP(ctx context.Context, tenantID, phone, code string, opts OTPLoginOptions) (*OTPLoginResult, error) {
+	tID, phoneKey, _, err := parseOTPRequest(tenantID, phone, OTPChannelSMS)
+	if err != nil {
+		return nil, err
+	}
+
+	challenge, err := s.checkOTP(ctx, tID, phoneKey, OTPPurposeLogin, code)
+	if err != nil {
+		return nil, err
+	}
+
+	login, err := s.finishPhoneLogin(ctx, tID, challenge.UserID, phoneKey)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &OTPLoginResult{Login: login}
+	if opts.RememberDevice {
+		token, expiresAt, err := s.rememberDevice(ctx, tID, challenge.UserID, opts)
+		if err != nil {
+			log.Ctx(ctx).Warn().Err(err).Str("user_id", login.UserID).Msg("auth otp warning: unable to remember device")
+		} else {
+			out.DeviceToken = token
+			out.DeviceExpiresAt = expiresAt
+		}
+	}
+	return out, nil
+}
+
+// LoginWithTrustedDevice skips the OTP step for a device remembered at an earlier
+// verification. The phone must still be the guardian's verified phone.
+func (s *Service) LoginWithTrustedDevice(ctx context.Context, tenantID, phone, deviceToken string) (*LoginResult, error) {
+	tID, phoneKey, _, err := parseOTPRequest(tenantID, phone, OTPChannelSMS)
+	if err != nil {
+		return nil, err
+	}
+	deviceToken = strings.TrimSpace(deviceToken)
+	if deviceToken == "" {
+		return nil, ErrDeviceNotTrusted
+	}
+
+	guardian, _, err := s.resolveOTPGuardian(ctx, tID, phoneKey)
+	if err != nil {
+		return nil, err
+	}
+	if guardian == nil {
+		return nil, ErrDeviceNotTrusted
+	}
+
+	ok, err := s.queries.TouchTrustedDevice(ctx, tID, guardian.UserID, hashDeviceToken(deviceToken))
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrDeviceNotTrusted
+	}
+	return s.finishPhoneLogin(ctx, tID, guardian.UserID, phoneKey)
+}
+
+// RequestPhoneVerificationOTP sends a code to the signed-in guardian's current phone so
+// they can prove possession and enable phone login.
+func (s *Service) RequestPhoneVerificationOTP(ctx context.Context, tenantID, userID, channel, ipAddress, userAgent string) (OTPRequestResult, error) {
+	tID, guardian, phoneKey, err := s.guardianForUser(ctx, tenantID, userID)
+	if err != nil {
+		return OTPRequestResult{}, err
+	}
+	_, _, channel, err = parseOTPRequest(tenantID, phoneKey, channel)
+	if err != nil {
+		return OTPRequestResult{}, err
+	}
+
+	if err := s.issueOTP(ctx, tID, guardian, phoneKey, OTPPurposeVerifyPhone, channel, ipAddress, userAgent); err != nil {
+		return OTPRequestResult{}, err
+	}
+	return OTPRequestResult{Sent: true, Channel: channel, ExpiresIn: int(otpTTL.Seconds())}, nil
+}
+
+// ConfirmPhoneVerification marks the signed-in guardian's phone as verified.
+func (s *Service) ConfirmPhoneVerification(ctx context.Context, tenantID, userID, code string) error {
+	tID, guardian, phoneKey, err := s.guardianForUser(ctx, tenantID, userID)
+	if err != nil {
+		return err
+	}
+
+	challenge, err := s.checkOTP(ctx, tID, phoneKey, OTPPurposeVerifyPhone, code)
+	if err != nil {
+		return err
+	}
+	if challenge.GuardianID != guardian.GuardianID {
+		return ErrOTPInvalid
+	}
+	return s.queries.UpsertGuardianPhoneVerification(ctx, tID, guardian.GuardianID, phoneKey, "otp", guardian.UserID)
+}
+
+// MarkGuardianPhoneVerified records a staff-verified phone, e.g. checked in person at the front desk.
+func (s *Service) MarkGuardianPhoneVerified(ctx context.Context, tenantID, guardianID, staffUserID string) (string, error) {
+	var tID, gID, staffID pgtype.UUID
+	if err := tID.Scan(strings.TrimSpace(tenantID)); err != nil || !tID.Valid {
+		return "", ErrTenantRequired
+	}
+	if err := gID.Scan(strings.TrimSpace(guardianID)); err != nil || !gID.Valid {
+		return "", ErrGuardianNotFound
+	}
+	_ = staffID.Scan(strings.TrimSpace(staffUserID))
+
+	phone, err := s.queries.GetGuardianPhone(ctx, tID, gID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", ErrGuardianNotFound
+		}
+		return "", err
+	}
+	phoneKey := PhoneKey(phone)
+	if phoneKey == "" {
+		return "", ErrInvalidPhone
+	}
+	if err := s.queries.UpsertGuardianPhoneVerification(ctx, tID, gID, phoneKey, "staff", staffID); err != nil {
+		return "", err
+	}
+	return phoneKey, nil
+}
+
+// ListTrustedDevices lists the signed-in user's remembered devices.
+func (s *Service) ListTrustedDevices(ctx context.Context, userID string) ([]db.TrustedDevice, error) {
+	var uID pgtype.UUID
+	if err := uID.Scan(strings.TrimSpace(userID)); err != nil || !uID.Valid {
+		return nil, ErrUserNotFound
+	}
+	devices, err := s.queries.ListTrustedDevices(ctx, uID)
+	if err != nil {
+		return nil, err
+	}
+	if devices == nil {
+		devices = []db.TrustedDevice{}
+	}
+	return devices, nil
+}
+
+// RevokeTrustedDevice forgets one of the signed-in user's remembered devices.
+func (s *Service) RevokeTrustedDevice(ctx context.Context, userID, deviceID string) error {
+	var uID, dID pgtype.UUID
+	if err := uID.Scan(strings.TrimSpace(userID)); err != nil || !uID.Valid {
+		return ErrUserNotFound
+	}
+	if err := dID.Scan(strings.TrimSpace(deviceID)); err != nil || !dID.Valid {
+		return ErrDeviceNotTrusted
+	}
+	ok, err := s.queries.RevokeTrustedDevice(ctx, uID, dID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrDeviceNotTrusted
+	}
+	return nil
+}
+
+func parseOTPRequest(tenantID, phone, channel string) (pgtype.UUID, string, string, error) {
+	var tID pgtype.UUID
+	if err := tID.Scan(strings.TrimSpace(tenantID)); err != nil || !tID.Valid {
+		return tID, "", "", ErrTenantRequired
+	}
+	phoneKey := PhoneKey(phone)
+	if phoneKey == "" {
+		return tID, "", "", ErrInvalidPhone
+	}
+	channel = strings.ToLower(strings.TrimSpace(channel))
+	if channel == "" {
+		channel = OTPChannelSMS
+	}
+	if channel != OTPChannelSMS && channel != OTPChannelWhatsApp {
+		return tID, "", "", ErrInvalidChannel
+	}
+	return tID, phoneKey, channel, nil
+}
+
+// resolveOTPGuardian finds the single guardian account that may log in with a phone.
+// A nil guardian with a reason means the request must be silently dropped.
+func (s *Service) resolveOTPGuardian(ctx context.Context, tenantID pgtype.UUID, phoneKey string) (*db.OTPGuardianRow, string, error) {
+	rows, err := s.queries.ListOTPGuardiansByPhone(ctx, tenantID, phoneKey)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var match *db.OTPGuardianRow
+	unverified := false
+	for i := range rows {
+		if !rows[i].PhoneVerified {
+			unverified = true
+			continue
+		}
+		if match != nil && match.UserID != rows[i].UserID {
+			return nil, "ambiguous_phone", nil
+		}
+		if match == nil {
+			match = &rows[i]
+		}
+	}
+	if match == nil {
+		if unverified {
+			return nil, "phone_not_verified", nil
+		}
+		return nil, "no_linked_guardian", nil
+	}
+	return match, "", nil
+}
+
+func (s *Service) guardianForUser(ctx context.Context, tenantID, userID string) (pgtype.UUID, db.OTPGuardianRow, string, error) {
+	var tID, uID pgtype.UUID
+	if err := tID.Scan(strings.TrimSpace(tenantID)); err != nil || !tID.Valid {
+		return tID, db.OTPGuardianRow{}, "", ErrTenantRequired
+	}
+	if err := uID.Scan(strings.TrimSpace(userID)); err != nil || !uID.Valid {
+		return tID, db.OTPGuardianRow{}, "", ErrUserNotFound
+	}
+
+	g, err := s.queries.GetGuardianByUserID(ctx, uID)
+	if err != nil || g.TenantID != tID {
+		return tID, db.OTPGuardianRow{}, "", ErrGuardianNotFound
+	}
+	phoneKey := PhoneKey(g.Phone)
+	if phoneKey == "" {
+		return tID, db.OTPGuardianRow{}, "", ErrInvalidPhone
+	}
+	return tID, db.OTPGuardianRow{GuardianID: g.ID, UserID: uID, FullName: g.FullName, Phone: g.Phone}, phoneKey, nil
+}
+
+func (s *Service) issueOTP(ctx context.Context, tenantID pgtype.UUID, guardian db.OTPGuardianRow, phoneKey, purpose, channel, ipAddress, userAgent string) error {
+	now := time.Now()
+	stats, err := s.queries.GetOTPIssuanceStats(ctx, tenantID, phoneKey, now.Add(-otpIssueWindow))
+	if err != nil {
+		return err
+	}
+	if stats.Locked >= otpMaxLockouts {
+		return ErrOTPLocked
+	}
+	if stats.Issued >= otpMaxPerWindow || (stats.LastSent.Valid && now.Sub(stats.LastSent.Time) < otpResendCooldown) {
+		return ErrOTPThrottled
+	}
+
+	code, err := generateOTPCode(otpDigits)
+	if err != nil {
+		return err
+	}
+	challengeID := uuid.Must(uuid.NewV7())
+	expiresAt := now.Add(otpTTL)
+	codeHash, err := hashOTPCode(challengeID.String(), code)
+	if err != nil {
+		return err
+	}
+	// The code is held under the tenant's data key until the worker has sent it,
+	// so it never sits in the outbox in plaintext.
+	codeCiphertext, err := s.keys.EncryptString(ctx, tenantID.String(), code)
+	if err != nil {
+		return err
+	}
+
+	if err := s.queries.CreateOTPChallenge(ctx, db.CreateOTPChallengeParams{
+		ID:             pgtype.UUID{Bytes: challengeID, Valid: true},
+		TenantID:       tenantID,
+		GuardianID:     guardian.GuardianID,
+		UserID:         guardian.UserID,
+		Purpose:        purpose,
+		Channel:        channel,
+		PhoneKey:       phoneKey,
+		CodeHash:       codeHash,
+		CodeCiphertext: codeCiphertext,
+		MaxAttempts:    otpMaxAttempts,
+		ExpiresAt:      expiresAt,
+		IPAddress:      ipAddress,
+		UserAgent:      userAgent,
+	}); err != nil {
+		return err
+	}
+
+	// The worker loads the code from the challenge, delivers it through the tenant's
+	// active SMS/WhatsApp gateway and then clears it.
+	payload, _ := json.Marshal(map[string]interface{}{
+		"challenge_id": challengeID.String(),
+		"channel":      channel,
+		"phone":        guardian.Phone,
+	})
+	_, err = s.queries.CreateOutboxEvent(ctx, db.CreateOutboxEventParams{
+		TenantID:  tenantID,
+		EventType: "auth.otp.requested",
+		Payload:   payload,
+	})
+	return err
+}
+
+// checkOTP counts an attempt against the latest challenge and consumes it on a match.
+func (s *Service) checkOTP(ctx context.Context, tenantID pgtype.UUID, phoneKey, purpose, code string) (db.OTPAttemptRow, error) {
+	code = strings.TrimSpace(code)
+	if len(code) != otpDigits {
+		return db.OTPAttemptRow{}, ErrOTPInvalid
+	}
+
+	challenge, err := s.queries.RecordOTPAttempt(ctx, tenantID, phoneKey, purpose)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return db.OTPAttemptRow{}, ErrOTPInvalid
+		}
+		return db.OTPAttemptRow{}, err
+	}
+
+	expected, err := hashOTPCode(uuid.UUID(challenge.ID.Bytes).String(), code)
+	if err != nil {
+		return db.OTPAttemptRow{}, err
+	}
+	if !hmac.Equal([]byte(expected), []byte(challenge.CodeHash)) {
+		return db.OTPAttemptRow{}, &OTPAttemptError{
+			Attempts:  int(challenge.Attempts),
+			Remaining: int(challenge.MaxAttempts - challenge.Attempts),
+		}
+	}
+
+	ok, err := s.queries.ConsumeOTPChallenge(ctx, challenge.ID)
+	if err != nil {
+		return db.OTPAttemptRow{}, err
+	}
+	if !ok {
+		return db.OTPAttemptRow{}, ErrOTPInvalid
+	}
+	return challenge, nil
+}
+
+// finishPhoneLogin applies the same account checks as password login before minting a
+// session. Phone login is limited to parent accounts in the requesting tenant.
+func (s *Service) finishPhoneLogin(ctx context.Context, tenantID, userID pgtype.UUID, phoneKey string) (*LoginResult, error) {
+	user, err := s.queries.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+	if !user.IsActive.Bool {
+		return nil, ErrUserInactive
+	}
+
+	roleAssignment, err := s.queries.GetUserRoleAssignmentWithPermissions(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if roleAssignment.RoleCode != "parent" || roleAssignment.TenantID != tenantID {
+		return nil, ErrOTPNotAllowed
+	}
+
+	blocked, err := s.queries.IsPlatformSecurityBlocked(ctx, user.ID, roleAssignment.TenantID)
+	if err == nil && blocked {
+		return nil, ErrAccessBlocked
+	}
+
+	missingLegal, err := s.missingLegalAcceptances(ctx, user.ID)
+	if err == nil && len(missingLegal) > 0 {
+		preauth, err := s.mintLegalPreauthToken(user.ID.String())
+		if err != nil {
+			return nil, err
+		}
+		return nil, &LegalAcceptanceRequiredError{
+			Requirements: missingLegal,
+			PreauthToken: preauth,
+		}
+	}
+
+	identity, err := s.queries.UpsertUserIdentity(ctx, user.ID, phoneOTPProvider, uuid.UUID(tenantID.Bytes).String()+":"+phoneKey)
+	if err != nil {
+		return nil, err
+	}
+	return s.mintLoginResult(ctx, user, identity, roleAssignment)
+}
+
+func (s *Service) rememberDevice(ctx context.Context, tenantID, userID pgtype.UUID, opts OTPLoginOptions) (string, time.Time, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", time.Time{}, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+	expiresAt := time.Now().Add(trustedDeviceTTL)
+
+	label := strings.TrimSpace(opts.DeviceLabel)
+	if len(label) > 100 {
+		label = label[:100]
+	}
+	if err := s.queries.CreateTrustedDevice(ctx, tenantID, userID, hashDeviceToken(token), label, opts.IPAddress, opts.UserAgent, expiresAt); err != nil {
+		return "", time.Time{}, err
+	}
+	return token, expiresAt, nil
+}
+
+func generateOTPCode(digits int) (string, error) {
+	limit := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(digits)), nil)
+	n, err := rand.Int(rand.Reader, limit)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", digits, n.Int64()), nil
+}
+
+// hashOTPCode keys the hash with a server secret so that six-digit codes cannot be
+// brute-forced from a database dump. The challenge ID salts each code.
+func hashOTPCode(challengeID, code string) (string, error) {
+	secret, err := otpSecret()
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(challengeID + ":" + code))
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// otpSecret is AUTH_OTP_SECRET, or the active JWT secret when one is explicitly
+// configured. There is no built-in default.
+func otpSecret() ([]byte, error) {
+	if secret := strings.TrimSpace(os.Getenv("AUTH_OTP_SECRET")); secret != "" {
+		return []byte(secret), nil
+	}
+	if strings.TrimSpace(os.Getenv("JWT_SECRETS")) != "" || strings.TrimSpace(os.Getenv("JWT_SECRET")) != "" {
+		if secrets, ok := security.ResolveJWTSecrets(); ok && len(secrets) > 0 {
+			return []byte(secrets[0]), nil
+		}
+	}
+	return nil, ErrOTPSecretNotConfigured
+}
+
+// CheckOTPConfig reports whether phone OTP can run: codes are hashed with the OTP
+// secret and held for delivery under the tenant's data key. It is called at
+// startup so that OTP login is left off, rather than failing at the first login,
+// when it is not configured.
+func CheckOTPConfig() error {
+	if _, err := otpSecret(); err != nil {
+		return err
+	}
+	if _, err := security.ResolveDataEncryptionKeys(); err != nil {
+		return fmt.Errorf("phone OTP: %w", err)
+	}
+	return nil
+}
+
+func hashDeviceToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// MaskPhone keeps only the last four digits of a phone for logs and security events.
+func MaskPhone(phone string) string {
+	key := PhoneKey(phone)
+	if key == "" {
+		return ""
+	}
+	return "******" + key[6:]
+}
@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPhoneKeyNormalisesFormats(t *testing.T) {
+	for _, in := range []string{"+91 98765 43210", "098765-43210", "9876543210"} {
+		if got := PhoneKey(in); got != "9876543210" {
+			t.Fatalf("PhoneKey(%q) = %q", in, got)
+		}
+	}
+	if got := PhoneKey("12345"); got != "" {
+		t.Fatalf("expected short number to be rejected, got %q", got)
+	}
+	if got := MaskPhone("+91 98765 43210"); got != "******3210" {
+		t.Fatalf("unexpected mask %q", got)
+	}
+}
+
+func TestOTPCodeHashing(t *testing.T) {
+	t.Setenv("AUTH_OTP_SECRET", "test-secret")
+
+	code, err := generateOTPCode(otpDigits)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(code) != otpDigits {
+		t.Fatalf("expected %d digits, got %q", otpDigits, code)
+	}
+
+	hash := mustHashOTP(t, "challenge-a", code)
+	if hash == code || hash != mustHashOTP(t, "challenge-a", code) {
+		t.Fatalf("hash must be deterministic and not the code itself")
+	}
+	if hash == mustHashOTP(t, "challenge-b", code) {
+		t.Fatalf("hash must be salted by challenge")
+	}
+
+	t.Setenv("AUTH_OTP_SECRET", "other-secret")
+	if hash == mustHashOTP(t, "challenge-a", code) {
+		t.Fatalf("hash must depend on the server secret")
+	}
+}
+
+func mustHashOTP(t *testing.T, challengeID, code string) string {
+	t.Helper()
+	hash, err := hashOTPCode(challengeID, code)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return hash
+}
+
+func TestOTPSecretRequired(t *testing.T) {
+	t.Setenv("AUTH_OTP_SECRET", "")
+	t.Setenv("JWT_SECRETS", "")
+	t.Setenv("JWT_SECRET", "")
+	if _, err := hashOTPCode("challenge-a", "123456"); !errors.Is(err, ErrOTPSecretNotConfigured) {
+		t.Fatalf("expected ErrOTPSecretNotConfigured, got %v", err)
+	}
+	if err := CheckOTPConfig(); !errors.Is(err, ErrOTPSecretNotConfigured) {
+		t.Fatalf("startup check should report a missing secret, got %v", err)
+	}
+
+	t.Setenv("JWT_SECRET", "jwt-secret")
+	if _, err := hashOTPCode("challenge-a", "123456"); err != nil {
+		t.Fatalf("an explicit JWT secret should be accepted: %v", err)
+	}
+}
+
+func TestOTPAttemptErrorIsInvalid(t *testing.T) {
+	var err error = &OTPAttemptError{Attempts: 5, Remaining: 0}
+	if !errors.Is(err, ErrOTPInvalid) {
+		t.Fatalf("attempt error should match ErrOTPInvalid")
+	}
+}
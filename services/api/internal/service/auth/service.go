@@ -16,6 +16,7 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/rs/zerolog/log"
 	"github.com/schoolerp/api/internal/db"
+	"github.com/schoolerp/api/internal/foundation/keyring"
 	"github.com/schoolerp/api/internal/foundation/security"
 	"github.com/schoolerp/api/internal/foundation/sessionstore"
 )
@@ -35,17 +36,26 @@ const authStoreTimeout = 5 * time.Second
 type Service struct {
 	queries      *db.Queries
 	sessionStore *sessionstore.Store
+	keys         *keyring.Service
 	MFA          *MFAService
 	IPGuard      *IPGuard
+	SSO          *SSOService
+	WebAuthn     *WebAuthnService
+	APIClients   *APIClientService
 }
 
-func NewService(queries *db.Queries, store *sessionstore.Store) *Service {
-	return &Service{
+func NewService(queries *db.Queries, store *sessionstore.Store, keys *keyring.Service) *Service {
+	s := &Service{
 		queries:      queries,
 		sessionStore: store,
+		keys:         keys,
 		MFA:          NewMFAService(queries),
 		IPGuard:      NewIPGuard(queries),
 	}
+	s.SSO = newSSOService(s)
+	s.WebAuthn = newWebAuthnService(s)
+	s.APIClients = newAPIClientService(s)
+	return s
 }
 
 func (s *Service) GetMFAAccountLabel(ctx context.Context, userID string) (string, error) {
@@ -188,18 +198,25 @@ func (s *Service) Login(ctx context.Context, email, password string) (*LoginResu
 		return nil, ErrAccessBlocked
 	}
 
-	if isInternalPlatformRole(roleAssignment.RoleCode) {
-		enforceMFA, err := s.isInternalMFAEnforced(ctx)
-		if err != nil {
-			logger.Warn().Err(err).Msg("auth login warning: unable to evaluate internal MFA policy")
+	if err := s.enforceSSOOnly(ctx, roleAssignment); err != nil {
+		if errors.Is(err, ErrSSORequired) {
+			logger.Info().Str("user_id", user.ID.String()).Msg("auth login blocked: tenant requires sso")
+		} else {
+			logger.Error().Err(err).Str("user_id", user.ID.String()).Msg("auth login failed: sso policy lookup")
 		}
-		if enforceMFA {
-			secret, err := s.queries.GetMFASecret(ctx, user.ID)
-			if err != nil || !secret.Enabled.Bool {
-				logger.Warn().Str("user_id", user.ID.String()).Msg("auth login blocked: internal MFA policy enforcement")
-				return nil, ErrMFARequired
-			}
+		return nil, err
+	}
+
+	// Legal acceptance and session minting happen once the second factor is
+	// verified; see completeMFASession.
+	if err := s.requireSecondFactor(ctx, user.ID, pgtype.UUID{}, roleAssignment.RoleCode); err != nil {
+		var challenge *MFAChallengeRequiredError
+		if errors.As(err, &challenge) {
+			logger.Info().Str("user_id", user.ID.String()).Strs("methods", challenge.Methods).Msg("auth login pending: second factor required")
+		} else {
+			logger.Error().Err(err).Str("user_id", user.ID.String()).Msg("auth login failed: unable to start second factor challenge")
 		}
+		return nil, err
 	}
 
 	missingLegal, err := s.missingLegalAcceptances(ctx, user.ID)
@@ -240,12 +257,25 @@ func (s *Service) IssueTokenForUser(ctx context.Context, userID string) (*LoginR
 		UserID:   user.ID,
 		Provider: "password",
 	})
-	if err != nil {
-		return nil, ErrInvalidCredentials
-	}
-
-	if err := s.enforcePasswordExpiry(ctx, user.ID.String(), identity.ID); err != nil {
-		return nil, err
+	if err == nil {
+		if err := s.enforcePasswordExpiry(ctx, user.ID.String(), identity.ID); err != nil {
+			return nil, err
+		}
+	} else {
+		// Parents who only sign in with a phone OTP and staff who only use SSO have no
+		// password identity.
+		for _, provider := range []string{phoneOTPProvider, SSOProtocolOIDC, SSOProtocolSAML, MFAMethodWebAuthn} {
+			identity, err = s.queries.GetUserIdentity(ctx, db.GetUserIdentityParams{
+				UserID:   user.ID,
+				Provider: provider,
+			})
+			if err == nil {
+				break
+			}
+		}
+		if err != nil {
+			return nil, ErrInvalidCredentials
+		}
 	}
 
 	roleAssignment, err := s.queries.GetUserRoleAssignmentWithPermissions(ctx, user.ID)
@@ -261,13 +291,10 @@ func (s *Service) IssueTokenForUser(ctx context.Context, userID string) (*LoginR
 		return nil, ErrAccessBlocked
 	}
 
-	if isInternalPlatformRole(roleAssignment.RoleCode) {
-		enforceMFA, err := s.isInternalMFAEnforced(ctx)
-		if err == nil && enforceMFA {
-			secret, err := s.queries.GetMFASecret(ctx, user.ID)
-			if err != nil || !secret.Enabled.Bool {
-				return nil, ErrMFARequired
-			}
+	if policy := s.loadMFAPolicy(ctx); policy.requiresSecondFactor(roleAssignment.RoleCode) {
+		factors := s.enrolledFactors(ctx, user.ID)
+		if factors.Passkeys == 0 && (policy.requiresPhishingResistant(roleAssignment.RoleCode) || !factors.TOTP) {
+			return nil, ErrMFARequired
 		}
 	}
 
@@ -356,7 +383,7 @@ func (s *Service) mintLoginResult(ctx context.Context, user db.AuthUser, identit
 	// 5. Update last login timestamp
 	if err := s.queries.UpdateUserLastLogin(ctx, db.UpdateUserLastLoginParams{
 		ID:       identity.ID,
-		Provider: "password",
+		Provider: identity.Provider,
 	}); err != nil {
 		logger.Warn().Err(err).Str("user_id", user.ID.String()).Msg("auth login warning: unable to update last_login")
 	}
@@ -813,24 +840,3 @@ func (s *Service) AcceptLegalDocs(ctx context.Context, userID string, accept []L
 
 	return nil
 }
-
-func (s *Service) isInternalMFAEnforced(ctx context.Context) (bool, error) {
-	raw, err := s.queries.GetPlatformSettingValue(ctx, "security.internal_mfa_policy")
-	if err != nil {
-		return false, err
-	}
-	if len(raw) == 0 {
-		return false, nil
-	}
-
-	var payload map[string]interface{}
-	if err := json.Unmarshal(raw, &payload); err != nil {
-		return false, nil
-	}
-
-	value, ok := payload["enforce_for_internal_users"].(bool)
-	if !ok {
-		return false, nil
-	}
-	return value, nil
-}
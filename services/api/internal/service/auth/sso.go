@@ -0,0 +1,1006 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/schoolerp/api/internal/db"
+	"github.com/schoolerp/api/internal/foundation/security"
+	"github.com/schoolerp/api/internal/foundation/sso"
+)
+
+const (
+	SSOProtocolOIDC = "oidc"
+	SSOProtocolSAML = "saml"
+
+	ssoRequestTTL = 10 * time.Minute
+	ssoTicketTTL  = 60 * time.Second
+)
+
+var (
+	ErrSSORequired         = errors.New("single sign-on is required for this account")
+	ErrSSONotConfigured    = errors.New("sso is not configured on this server")
+	ErrSSOProviderNotFound = errors.New("sso provider not found")
+	ErrSSOInvalidConfig    = errors.New("invalid sso provider configuration")
+	ErrSSOStateInvalid     = errors.New("sso login request is invalid or expired")
+	ErrSSOTicketInvalid    = errors.New("sso ticket is invalid or expired")
+	ErrSSOEmailUnverified  = errors.New("identity provider did not assert a verified email")
+	ErrSSODomainNotAllowed = errors.New("email domain is not allowed for this provider")
+	ErrSSOAccountNotLinked = errors.New("no staff account matches this identity")
+	ErrSSONoMappedRole     = errors.New("identity is not in any group mapped to a role")
+	ErrSSORoleNotAllowed   = errors.New("this account cannot sign in with sso")
+
+	// ErrSSOPhishingResistantRequired is returned when the policy requires a
+	// phishing-resistant factor for the role and the IdP did not assert one.
+	ErrSSOPhishingResistantRequired = errors.New("your role requires signing in to your identity provider with a passkey or security key")
+)
+
+// SSOLoginError carries what is known about a failed SSO callback so the handler
+// can attribute the security event to the right tenant.
+type SSOLoginError struct {
+	TenantID   string
+	ProviderID string
+	Email      string
+	Err        error
+}
+
+func (e *SSOLoginError) Error() string { return e.Err.Error() }
+func (e *SSOLoginError) Unwrap() error { return e.Err }
+
+// SSORoleMapping grants role codes to members of an IdP group.
+type SSORoleMapping struct {
+	Group string `json:"group"`
+	Role  string `json:"role"`
+}
+
+// SSOProviderInput is the admin-editable provider configuration.
+type SSOProviderInput struct {
+	Name                string           `json:"name"`
+	Protocol            string           `json:"protocol"`
+	IsEnabled           *bool            `json:"is_enabled"`
+	OIDCIssuer          string           `json:"oidc_issuer"`
+	OIDCClientID        string           `json:"oidc_client_id"`
+	OIDCClientSecret    string           `json:"oidc_client_secret"`
+	OIDCScopes          []string         `json:"oidc_scopes"`
+	SAMLIdPEntityID     string           `json:"saml_idp_entity_id"`
+	SAMLIdPSSOURL       string           `json:"saml_idp_sso_url"`
+	SAMLIdPCertificate  string           `json:"saml_idp_certificate"`
+	AllowedDomains      []string         `json:"allowed_domains"`
+	GroupsClaim         string           `json:"groups_claim"`
+	RoleMappings        []SSORoleMapping `json:"role_mappings"`
+	AssumeEmailVerified bool             `json:"assume_email_verified"`
+}
+
+// SSOProviderView is a provider as shown to tenant admins. The client secret is never
+// returned; the service-provider URLs are what the admin registers with their IdP.
+type SSOProviderView struct {
+	ID                  string           `json:"id"`
+	Name                string           `json:"name"`
+	Protocol            string           `json:"protocol"`
+	IsEnabled           bool             `json:"is_enabled"`
+	OIDCIssuer          string           `json:"oidc_issuer,omitempty"`
+	OIDCClientID        string           `json:"oidc_client_id,omitempty"`
+	HasClientSecret     bool             `json:"has_client_secret"`
+	OIDCScopes          []string         `json:"oidc_scopes,omitempty"`
+	SAMLIdPEntityID     string           `json:"saml_idp_entity_id,omitempty"`
+	SAMLIdPSSOURL       string           `json:"saml_idp_sso_url,omitempty"`
+	SAMLIdPCertificate  string           `json:"saml_idp_certificate,omitempty"`
+	AllowedDomains      []string         `json:"allowed_domains"`
+	GroupsClaim         string           `json:"groups_claim"`
+	RoleMappings        []SSORoleMapping `json:"role_mappings"`
+	AssumeEmailVerified bool             `json:"assume_email_verified"`
+	RedirectURI         string           `json:"redirect_uri,omitempty"`
+	SPEntityID          string           `json:"sp_entity_id,omitempty"`
+	ACSURL              string           `json:"acs_url,omitempty"`
+	CreatedAt           time.Time        `json:"created_at"`
+	UpdatedAt           time.Time        `json:"updated_at"`
+}
+
+// SSOLoginOptions is what the login page needs to offer SSO for a tenant.
+type SSOLoginOptions struct {
+	SSOOnly   bool                `json:"sso_only"`
+	Providers []PublicSSOProvider `json:"providers"`
+}
+
+type PublicSSOProvider struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Protocol string `json:"protocol"`
+}
+
+// SSOCompletion is the result of a successful IdP callback.
+type SSOCompletion struct {
+	Ticket       string
+	RedirectPath string
+	TenantID     string
+	UserID       string
+	ProviderID   string
+}
+
+// SSOService implements tenant-configured OIDC and SAML sign-in for staff. Users are
+// never created here: an IdP identity signs in only as an existing staff account of
+// the provider's tenant.
+type SSOService struct {
+	auth    *Service
+	queries *db.Queries
+	http    *http.Client
+}
+
+func newSSOService(s *Service) *SSOService {
+	return &SSOService{auth: s, queries: s.queries, http: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// ssoPublicBaseURL is the externally reachable API root that IdPs redirect back to.
+func ssoPublicBaseURL() (string, error) {
+	base := strings.TrimRight(strings.TrimSpace(os.Getenv("API_PUBLIC_URL")), "/")
+	if base == "" {
+		if strings.EqualFold(strings.TrimSpace(os.Getenv("ENV")), "production") {
+			return "", ErrSSONotConfigured
+		}
+		base = "http://localhost:8080"
+	}
+	return base, nil
+}
+
+// SSOFrontendCallbackURL is where the browser lands after the IdP round trip.
+func SSOFrontendCallbackURL() string {
+	if v := strings.TrimSpace(os.Getenv("SSO_FRONTEND_CALLBACK_URL")); v != "" {
+		return v
+	}
+	return "http://localhost:3000/auth/sso/callback"
+}
+
+func oidcRedirectURL(base string) string { return base + "/v1/auth/sso/oidc/callback" }
+
+func samlSPURLs(base string, providerID pgtype.UUID) (entityID, acsURL string) {
+	root := base + "/v1/auth/sso/saml/" + uuid.UUID(providerID.Bytes).String()
+	return root + "/metadata", root + "/acs"
+}
+
+func hashSSOToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// SafeRedirectPath keeps post-login redirects on the frontend's own origin.
+func SafeRedirectPath(next string) string {
+	next = strings.TrimSpace(next)
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") || len(next) > 512 {
+		return ""
+	}
+	return next
+}
+
+func parseUUID(raw string) (pgtype.UUID, bool) {
+	var id pgtype.UUID
+	if err := id.Scan(strings.TrimSpace(raw)); err != nil || !id.Valid {
+		return pgtype.UUID{}, false
+	}
+	return id, true
+}
+
+func (s *SSOService) providerView(p db.SSOProvider) SSOProviderView {
+	v := SSOProviderView{
+		ID:                  uuid.UUID(p.ID.Bytes).String(),
+		Name:                p.Name,
+		Protocol:            p.Protocol,
+		IsEnabled:           p.IsEnabled,
+		AllowedDomains:      p.AllowedDomains,
+		GroupsClaim:         p.GroupsClaim,
+		RoleMappings:        decodeRoleMappings(p.RoleMappings),
+		AssumeEmailVerified: p.AssumeEmailVerified,
+		CreatedAt:           p.CreatedAt.Time,
+		UpdatedAt:           p.UpdatedAt.Time,
+	}
+	if v.AllowedDomains == nil {
+		v.AllowedDomains = []string{}
+	}
+	base, _ := ssoPublicBaseURL()
+	switch p.Protocol {
+	case SSOProtocolOIDC:
+		v.OIDCIssuer = p.OIDCIssuer
+		v.OIDCClientID = p.OIDCClientID
+		v.HasClientSecret = p.OIDCClientSecretEnc != ""
+		v.OIDCScopes = p.OIDCScopes
+		if base != "" {
+			v.RedirectURI = oidcRedirectURL(base)
+		}
+	case SSOProtocolSAML:
+		v.SAMLIdPEntityID = p.SAMLIdPEntityID
+		v.SAMLIdPSSOURL = p.SAMLIdPSSOURL
+		v.SAMLIdPCertificate = p.SAMLIdPCertificate
+		if base != "" {
+			v.SPEntityID, v.ACSURL = samlSPURLs(base, p.ID)
+		}
+	}
+	return v
+}
+
+func decodeRoleMappings(raw []byte) []SSORoleMapping {
+	out := []SSORoleMapping{}
+	if len(raw) > 0 {
+		_ = json.Unmarshal(raw, &out)
+	}
+	return out
+}
+
+// ListProviders returns every provider configured for a tenant.
+func (s *SSOService) ListProviders(ctx context.Context, tenantID string) ([]SSOProviderView, error) {
+	tid, ok := parseUUID(tenantID)
+	if !ok {
+		return nil, ErrTenantRequired
+	}
+	rows, err := s.queries.ListSSOProviders(ctx, tid, false)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]SSOProviderView, 0, len(rows))
+	for _, p := range rows {
+		out = append(out, s.providerView(p))
+	}
+	return out, nil
+}
+
+// LoginOptions lists the enabled providers a tenant's login page should offer.
+func (s *SSOService) LoginOptions(ctx context.Context, tenantID string) (*SSOLoginOptions, error) {
+	tid, ok := parseUUID(tenantID)
+	if !ok {
+		return nil, ErrTenantRequired
+	}
+	rows, err := s.queries.ListSSOProviders(ctx, tid, true)
+	if err != nil {
+		return nil, err
+	}
+	ssoOnly, err := s.queries.GetTenantSSOOnly(ctx, tid)
+	if err != nil {
+		return nil, err
+	}
+	out := &SSOLoginOptions{SSOOnly: ssoOnly, Providers: make([]PublicSSOProvider, 0, len(rows))}
+	for _, p := range rows {
+		out.Providers = append(out.Providers, PublicSSOProvider{
+			ID:       uuid.UUID(p.ID.Bytes).String(),
+			Name:     p.Name,
+			Protocol: p.Protocol,
+		})
+	}
+	return out, nil
+}
+
+// CreateProvider validates and stores a new provider.
+func (s *SSOService) CreateProvider(ctx context.Context, tenantID, actorID string, in SSOProviderInput) (*SSOProviderView, error) {
+	tid, ok := parseUUID(tenantID)
+	if !ok {
+		return nil, ErrTenantRequired
+	}
+	params, err := s.buildProviderParams(ctx, tid, in, nil)
+	if err != nil {
+		return nil, err
+	}
+	params.CreatedBy, _ = parseUUID(actorID)
+
+	row, err := s.queries.CreateSSOProvider(ctx, params)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return nil, fmt.Errorf("%w: a provider with this name already exists", ErrSSOInvalidConfig)
+		}
+		return nil, err
+	}
+	v := s.providerView(row)
+	return &v, nil
+}
+
+// UpdateProvider replaces a provider's configuration. The protocol cannot change and
+// an empty client secret keeps the stored one.
+func (s *SSOService) UpdateProvider(ctx context.Context, tenantID, providerID string, in SSOProviderInput) (*SSOProviderView, error) {
+	tid, ok := parseUUID(tenantID)
+	if !ok {
+		return nil, ErrTenantRequired
+	}
+	pid, ok := parseUUID(providerID)
+	if !ok {
+		return nil, ErrSSOProviderNotFound
+	}
+	existing, err := s.queries.GetSSOProvider(ctx, tid, pid)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrSSOProviderNotFound
+		}
+		return nil, err
+	}
+	params, err := s.buildProviderParams(ctx, tid, in, &existing)
+	if err != nil {
+		return nil, err
+	}
+	params.ID = pid
+
+	row, err := s.queries.UpdateSSOProvider(ctx, params)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return nil, fmt.Errorf("%w: a provider with this name already exists", ErrSSOInvalidConfig)
+		}
+		return nil, err
+	}
+	if !row.IsEnabled {
+		if err := s.ensureSSOOnlyStillReachable(ctx, tid); err != nil {
+			return nil, err
+		}
+	}
+	v := s.providerView(row)
+	return &v, nil
+}
+
+// DeleteProvider removes a provider. Linked identities stay so that re-adding the
+// provider does not require relinking, but they cannot sign in while it is absent.
+func (s *SSOService) DeleteProvider(ctx context.Context, tenantID, providerID string) error {
+	tid, ok := parseUUID(tenantID)
+	if !ok {
+		return ErrTenantRequired
+	}
+	pid, ok := parseUUID(providerID)
+	if !ok {
+		return ErrSSOProviderNotFound
+	}
+	deleted, err := s.queries.DeleteSSOProvider(ctx, tid, pid)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrSSOProviderNotFound
+	}
+	return s.ensureSSOOnlyStillReachable(ctx, tid)
+}
+
+// ensureSSOOnlyStillReachable turns SSO-only off when its last provider goes away, so
+// that a tenant can never lock all of its staff out.
+func (s *SSOService) ensureSSOOnlyStillReachable(ctx context.Context, tenantID pgtype.UUID) error {
+	enabled, err := s.queries.ListSSOProviders(ctx, tenantID, true)
+	if err != nil || len(enabled) > 0 {
+		return err
+	}
+	ssoOnly, err := s.queries.GetTenantSSOOnly(ctx, tenantID)
+	if err != nil || !ssoOnly {
+		return err
+	}
+	return s.queries.UpsertTenantSSOSettings(ctx, tenantID, false, pgtype.UUID{})
+}
+
+// UpdateSettings sets whether staff must use SSO. Enabling it requires at least one
+// enabled provider.
+func (s *SSOService) UpdateSettings(ctx context.Context, tenantID, actorID string, ssoOnly bool) error {
+	tid, ok := parseUUID(tenantID)
+	if !ok {
+		return ErrTenantRequired
+	}
+	if ssoOnly {
+		enabled, err := s.queries.ListSSOProviders(ctx, tid, true)
+		if err != nil {
+			return err
+		}
+		if len(enabled) == 0 {
+			return fmt.Errorf("%w: enable a provider before requiring sso", ErrSSOInvalidConfig)
+		}
+	}
+	actor, _ := parseUUID(actorID)
+	return s.queries.UpsertTenantSSOSettings(ctx, tid, ssoOnly, actor)
+}
+
+func (s *SSOService) buildProviderParams(ctx context.Context, tenantID pgtype.UUID, in SSOProviderInput, existing *db.SSOProvider) (db.UpsertSSOProviderParams, error) {
+	invalid := func(reason string) error { return fmt.Errorf("%w: %s", ErrSSOInvalidConfig, reason) }
+
+	p := db.UpsertSSOProviderParams{
+		TenantID:            tenantID,
+		Name:                strings.TrimSpace(in.Name),
+		Protocol:            strings.ToLower(strings.TrimSpace(in.Protocol)),
+		IsEnabled:           true,
+		GroupsClaim:         strings.TrimSpace(in.GroupsClaim),
+		AssumeEmailVerified: in.AssumeEmailVerified,
+	}
+	if existing != nil {
+		p.Protocol = existing.Protocol
+		p.IsEnabled = existing.IsEnabled
+	}
+	if in.IsEnabled != nil {
+		p.IsEnabled = *in.IsEnabled
+	}
+	if p.Name == "" || len(p.Name) > 100 {
+		return p, invalid("name is required and must be at most 100 characters")
+	}
+	if p.GroupsClaim == "" {
+		p.GroupsClaim = "groups"
+	}
+
+	for _, d := range in.AllowedDomains {
+		d = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(d)), "@")
+		if d == "" {
+			continue
+		}
+		if !strings.Contains(d, ".") || strings.ContainsAny(d, " /@") {
+			return p, invalid(fmt.Sprintf("invalid domain %q", d))
+		}
+		p.AllowedDomains = append(p.AllowedDomains, d)
+	}
+	// IdPs vouch for whatever mail attribute they are configured to send, so
+	// linking by email is only safe for domains the school actually owns.
+	if len(p.AllowedDomains) == 0 {
+		return p, invalid("allowed_domains must list at least one domain")
+	}
+
+	switch p.Protocol {
+	case SSOProtocolOIDC:
+		p.OIDCIssuer = strings.TrimRight(strings.TrimSpace(in.OIDCIssuer), "/")
+		p.OIDCClientID = strings.TrimSpace(in.OIDCClientID)
+		if err := validateIdPURL(p.OIDCIssuer); err != nil {
+			return p, invalid("oidc_issuer " + err.Error())
+		}
+		if p.OIDCClientID == "" {
+			return p, invalid("oidc_client_id is required")
+		}
+		if secret := strings.TrimSpace(in.OIDCClientSecret); secret != "" {
+			enc, err := security.EncryptString(secret)
+			if err != nil {
+				return p, fmt.Errorf("unable to encrypt client secret: %w", err)
+			}
+			p.OIDCClientSecretEnc = enc
+		} else if existing == nil || existing.OIDCClientSecretEnc == "" {
+			return p, invalid("oidc_client_secret is required")
+		}
+		p.OIDCScopes = []string{"openid"}
+		for _, sc := range in.OIDCScopes {
+			if sc = strings.TrimSpace(sc); sc != "" && sc != "openid" {
+				p.OIDCScopes = append(p.OIDCScopes, sc)
+			}
+		}
+		if len(p.OIDCScopes) == 1 {
+			p.OIDCScopes = append(p.OIDCScopes, "email", "profile")
+		}
+	case SSOProtocolSAML:
+		p.SAMLIdPEntityID = strings.TrimSpace(in.SAMLIdPEntityID)
+		p.SAMLIdPSSOURL = strings.TrimSpace(in.SAMLIdPSSOURL)
+		p.SAMLIdPCertificate = strings.TrimSpace(in.SAMLIdPCertificate)
+		if p.SAMLIdPEntityID == "" {
+			return p, invalid("saml_idp_entity_id is required")
+		}
+		if err := validateIdPURL(p.SAMLIdPSSOURL); err != nil {
+			return p, invalid("saml_idp_sso_url " + err.Error())
+		}
+		if _, err := sso.ParseCertificate(p.SAMLIdPCertificate); err != nil {
+			return p, invalid("saml_idp_certificate is not a valid X.509 certificate")
+		}
+	default:
+		return p, invalid("protocol must be oidc or saml")
+	}
+
+	mappings, err := s.validateRoleMappings(ctx, tenantID, in.RoleMappings)
+	if err != nil {
+		return p, err
+	}
+	p.RoleMappings, _ = json.Marshal(mappings)
+	return p, nil
+}
+
+func validateIdPURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return errors.New("must be an absolute URL")
+	}
+	if u.Scheme == "https" {
+		return nil
+	}
+	if u.Scheme == "http" && !strings.EqualFold(strings.TrimSpace(os.Getenv("ENV")), "production") {
+		return nil
+	}
+	return errors.New("must use https")
+}
+
+// validateRoleMappings only allows staff roles of the tenant. Parent and student
+// access comes from SIS links, and platform roles are never granted by a school IdP.
+func (s *SSOService) validateRoleMappings(ctx context.Context, tenantID pgtype.UUID, in []SSORoleMapping) ([]SSORoleMapping, error) {
+	out := make([]SSORoleMapping, 0, len(in))
+	if len(in) == 0 {
+		return out, nil
+	}
+	roles, err := s.queries.ListRolesByTenant(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	known := map[string]bool{}
+	for _, r := range roles {
+		known[r.Code] = true
+	}
+	for _, m := range in {
+		m.Group = strings.TrimSpace(m.Group)
+		m.Role = strings.TrimSpace(m.Role)
+		if m.Group == "" || m.Role == "" {
+			return nil, fmt.Errorf("%w: role mappings need a group and a role", ErrSSOInvalidConfig)
+		}
+		if !isSSOStaffRole(m.Role) || !known[m.Role] {
+			return nil, fmt.Errorf("%w: role %q cannot be granted through sso", ErrSSOInvalidConfig, m.Role)
+		}
+		out = append(out, m)
+	}
+	return out, nil
+}
+
+// isSSOIdentity reports whether identity was linked by an SSO provider.
+func isSSOIdentity(identity db.AuthIdentity) bool {
+	return identity.Provider == SSOProtocolOIDC || identity.Provider == SSOProtocolSAML
+}
+
+func isSSOStaffRole(code string) bool {
+	switch strings.ToLower(strings.TrimSpace(code)) {
+	case "parent", "student", "guest", "user", "":
+		return false
+	}
+	return !isInternalPlatformRole(code)
+}
+
+// Begin starts an SSO login and returns the IdP URL to redirect the browser to.
+func (s *SSOService) Begin(ctx context.Context, tenantID, providerID, next string) (string, error) {
+	tid, ok := parseUUID(tenantID)
+	if !ok {
+		return "", ErrTenantRequired
+	}
+	pid, ok := parseUUID(providerID)
+	if !ok {
+		return "", ErrSSOProviderNotFound
+	}
+	p, err := s.queries.GetSSOProvider(ctx, tid, pid)
+	if err != nil || !p.IsEnabled {
+		if err == nil || errors.Is(err, pgx.ErrNoRows) {
+			return "", ErrSSOProviderNotFound
+		}
+		return "", err
+	}
+	base, err := ssoPublicBaseURL()
+	if err != nil {
+		return "", err
+	}
+
+	state := sso.NewNonce()
+	params := db.CreateSSOLoginRequestParams{
+		TenantID:     tid,
+		ProviderID:   pid,
+		StateHash:    hashSSOToken(state),
+		RedirectPath: SafeRedirectPath(next),
+		ExpiresAt:    time.Now().Add(ssoRequestTTL),
+	}
+
+	var redirect string
+	switch p.Protocol {
+	case SSOProtocolOIDC:
+		provider, err := s.oidcProvider(ctx, p, base)
+		if err != nil {
+			return "", err
+		}
+		verifier, challenge := sso.NewPKCEVerifier()
+		params.Nonce = sso.NewNonce()
+		params.CodeVerifier = verifier
+		redirect = provider.AuthCodeURL(state, params.Nonce, challenge)
+	case SSOProtocolSAML:
+		params.SAMLRequestID = sso.NewSAMLRequestID()
+		redirect, err = samlConfig(p, base).AuthnRequestURL(params.SAMLRequestID, state, time.Now())
+		if err != nil {
+			return "", err
+		}
+	default:
+		return "", ErrSSOProviderNotFound
+	}
+
+	if err := s.queries.CreateSSOLoginRequest(ctx, params); err != nil {
+		return "", err
+	}
+	return redirect, nil
+}
+
+func (s *SSOService) oidcProvider(ctx context.Context, p db.SSOProvider, base string) (*sso.OIDCProvider, error) {
+	secret := ""
+	if p.OIDCClientSecretEnc != "" {
+		var err error
+		if secret, err = security.DecryptString(p.OIDCClientSecretEnc); err != nil {
+			return nil, fmt.Errorf("unable to decrypt client secret: %w", err)
+		}
+	}
+	return sso.DiscoverOIDC(ctx, sso.OIDCConfig{
+		Issuer:              p.OIDCIssuer,
+		ClientID:            p.OIDCClientID,
+		ClientSecret:        secret,
+		RedirectURL:         oidcRedirectURL(base),
+		Scopes:              p.OIDCScopes,
+		GroupsClaim:         p.GroupsClaim,
+		AssumeEmailVerified: p.AssumeEmailVerified,
+	}, s.http)
+}
+
+func samlConfig(p db.SSOProvider, base string) sso.SAMLConfig {
+	entityID, acs := samlSPURLs(base, p.ID)
+	return sso.SAMLConfig{
+		SPEntityID:     entityID,
+		ACSURL:         acs,
+		IdPEntityID:    p.SAMLIdPEntityID,
+		IdPSSOURL:      p.SAMLIdPSSOURL,
+		IdPCertificate: p.SAMLIdPCertificate,
+		GroupsClaim:    p.GroupsClaim,
+	}
+}
+
+// SAMLMetadata returns the SP metadata for a SAML provider.
+func (s *SSOService) SAMLMetadata(ctx context.Context, providerID string) ([]byte, error) {
+	pid, ok := parseUUID(providerID)
+	if !ok {
+		return nil, ErrSSOProviderNotFound
+	}
+	p, err := s.queries.GetSSOProvider(ctx, pgtype.UUID{}, pid)
+	if err != nil || p.Protocol != SSOProtocolSAML {
+		return nil, ErrSSOProviderNotFound
+	}
+	base, err := ssoPublicBaseURL()
+	if err != nil {
+		return nil, err
+	}
+	return samlConfig(p, base).Metadata(), nil
+}
+
+// CompleteOIDC handles the authorization-code callback.
+func (s *SSOService) CompleteOIDC(ctx context.Context, state, code string) (*SSOCompletion, error) {
+	if state == "" || code == "" {
+		return nil, &SSOLoginError{Err: ErrSSOStateInvalid}
+	}
+	req, err := s.queries.ClaimSSOLoginRequest(ctx, hashSSOToken(state))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, &SSOLoginError{Err: ErrSSOStateInvalid}
+		}
+		return nil, err
+	}
+	fail := func(err error) error {
+		return &SSOLoginError{TenantID: req.TenantID.String(), ProviderID: req.ProviderID.String(), Err: err}
+	}
+
+	p, err := s.queries.GetSSOProvider(ctx, req.TenantID, req.ProviderID)
+	if err != nil || !p.IsEnabled || p.Protocol != SSOProtocolOIDC {
+		return nil, fail(ErrSSOProviderNotFound)
+	}
+	base, err := ssoPublicBaseURL()
+	if err != nil {
+		return nil, fail(err)
+	}
+	provider, err := s.oidcProvider(ctx, p, base)
+	if err != nil {
+		return nil, fail(err)
+	}
+	identity, err := provider.Exchange(ctx, code, req.CodeVerifier, req.Nonce)
+	if err != nil {
+		return nil, fail(err)
+	}
+	return s.finish(ctx, req, p, identity)
+}
+
+// CompleteSAML handles a Response posted to a provider's ACS. Only SP-initiated
+// logins are accepted: RelayState must name a pending request for this provider and
+// the assertion must answer that request's ID.
+func (s *SSOService) CompleteSAML(ctx context.Context, providerID, samlResponse, relayState string) (*SSOCompletion, error) {
+	pid, ok := parseUUID(providerID)
+	if !ok || relayState == "" || samlResponse == "" {
+		return nil, &SSOLoginError{Err: ErrSSOStateInvalid}
+	}
+	req, err := s.queries.ClaimSSOLoginRequest(ctx, hashSSOToken(relayState))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, &SSOLoginError{ProviderID: providerID, Err: ErrSSOStateInvalid}
+		}
+		return nil, err
+	}
+	fail := func(err error) error {
+		return &SSOLoginError{TenantID: req.TenantID.String(), ProviderID: req.ProviderID.String(), Err: err}
+	}
+	if req.ProviderID != pid || req.SAMLRequestID == "" {
+		return nil, fail(ErrSSOStateInvalid)
+	}
+
+	p, err := s.queries.GetSSOProvider(ctx, req.TenantID, pid)
+	if err != nil || !p.IsEnabled || p.Protocol != SSOProtocolSAML {
+		return nil, fail(ErrSSOProviderNotFound)
+	}
+	base, err := ssoPublicBaseURL()
+	if err != nil {
+		return nil, fail(err)
+	}
+	identity, err := samlConfig(p, base).ParseResponse(samlResponse, req.SAMLRequestID, time.Now())
+	if err != nil {
+		return nil, fail(err)
+	}
+	return s.finish(ctx, req, p, identity)
+}
+
+func (s *SSOService) finish(ctx context.Context, req db.SSOLoginRequest, p db.SSOProvider, identity *sso.Identity) (*SSOCompletion, error) {
+	linked, err := s.linkIdentity(ctx, p, identity)
+	if err != nil {
+		return nil, &SSOLoginError{
+			TenantID:   req.TenantID.String(),
+			ProviderID: req.ProviderID.String(),
+			Email:      maskEmail(strings.ToLower(identity.Email)),
+			Err:        err,
+		}
+	}
+
+	ticket := sso.NewNonce()
+	if err := s.queries.SetSSOLoginTicket(ctx, req.ID, linked.UserID, linked.ID, hashSSOToken(ticket), time.Now().Add(ssoTicketTTL), identity.AuthMethods); err != nil {
+		return nil, err
+	}
+	return &SSOCompletion{
+		Ticket:       ticket,
+		RedirectPath: req.RedirectPath,
+		TenantID:     req.TenantID.String(),
+		UserID:       linked.UserID.String(),
+		ProviderID:   req.ProviderID.String(),
+	}, nil
+}
+
+// linkIdentity resolves the staff account for an IdP identity and applies the
+// provider's role mappings. A previously linked subject wins; otherwise the verified
+// email must match an existing staff member of the provider's tenant.
+func (s *SSOService) linkIdentity(ctx context.Context, p db.SSOProvider, id *sso.Identity) (db.AuthIdentity, error) {
+	email := strings.ToLower(strings.TrimSpace(id.Email))
+	if email == "" || !id.EmailVerified {
+		return db.AuthIdentity{}, ErrSSOEmailUnverified
+	}
+	if !emailDomainAllowed(email, p.AllowedDomains) {
+		return db.AuthIdentity{}, ErrSSODomainNotAllowed
+	}
+
+	identifier := uuid.UUID(p.ID.Bytes).String() + ":" + id.Subject
+	identity, err := s.queries.GetIdentityByIdentifier(ctx, p.Protocol, identifier)
+	linked := err == nil
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return db.AuthIdentity{}, err
+	}
+
+	var user db.AuthUser
+	if linked {
+		user, err = s.queries.GetUserByID(ctx, identity.UserID)
+	} else {
+		user, err = s.queries.GetUserByEmail(ctx, email)
+	}
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return db.AuthIdentity{}, ErrSSOAccountNotLinked
+		}
+		return db.AuthIdentity{}, err
+	}
+	if !user.IsActive.Bool {
+		return db.AuthIdentity{}, ErrUserInactive
+	}
+
+	roles, err := s.queries.ListUserTenantRoles(ctx, user.ID, p.TenantID)
+	if err != nil {
+		return db.AuthIdentity{}, err
+	}
+	if len(roles) == 0 {
+		return db.AuthIdentity{}, ErrSSOAccountNotLinked
+	}
+	staff := false
+	for _, r := range roles {
+		if isInternalPlatformRole(r.RoleCode) || strings.EqualFold(r.ScopeType, "platform") {
+			return db.AuthIdentity{}, ErrSSORoleNotAllowed
+		}
+		if isSSOStaffRole(r.RoleCode) {
+			staff = true
+		}
+	}
+	if !staff {
+		return db.AuthIdentity{}, ErrSSORoleNotAllowed
+	}
+
+	if err := s.applyRoleMappings(ctx, p, user.ID, roles, id.Groups); err != nil {
+		return db.AuthIdentity{}, err
+	}
+
+	if !linked {
+		identity, err = s.queries.LinkUserIdentity(ctx, user.ID, p.Protocol, identifier)
+		if err != nil {
+			return db.AuthIdentity{}, err
+		}
+		if identity.UserID != user.ID {
+			return db.AuthIdentity{}, ErrSSOAccountNotLinked
+		}
+	}
+	return identity, nil
+}
+
+// emailDomainAllowed reports whether the email's domain is listed. An empty
+// list allows nothing.
+func emailDomainAllowed(email string, allowed []string) bool {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+	domain := email[at+1:]
+	for _, d := range allowed {
+		if domain == d {
+			return true
+		}
+	}
+	return false
+}
+
+// roleChanges computes which mapped roles to grant and revoke for a set of IdP groups.
+// Roles that no mapping mentions are left alone, so manual assignments survive.
+// ok is false when mappings exist but none of the groups match any of them.
+func roleChanges(mappings []SSORoleMapping, groups []string, held []string) (grant, revoke []string, ok bool) {
+	if len(mappings) == 0 {
+		return nil, nil, true
+	}
+	inGroup := map[string]bool{}
+	for _, g := range groups {
+		inGroup[strings.ToLower(strings.TrimSpace(g))] = true
+	}
+	mapped := map[string]bool{}
+	desired := map[string]bool{}
+	var desiredOrder []string
+	for _, m := range mappings {
+		mapped[m.Role] = true
+		if inGroup[strings.ToLower(m.Group)] && !desired[m.Role] {
+			desired[m.Role] = true
+			desiredOrder = append(desiredOrder, m.Role)
+		}
+	}
+	if len(desired) == 0 {
+		return nil, nil, false
+	}
+
+	has := map[string]bool{}
+	for _, code := range held {
+		has[code] = true
+		if mapped[code] && !desired[code] {
+			revoke = append(revoke, code)
+		}
+	}
+	for _, code := range desiredOrder {
+		if !has[code] {
+			grant = append(grant, code)
+		}
+	}
+	return grant, revoke, true
+}
+
+func (s *SSOService) applyRoleMappings(ctx context.Context, p db.SSOProvider, userID pgtype.UUID, current []db.TenantRoleAssignment, groups []string) error {
+	mappings := decodeRoleMappings(p.RoleMappings)
+	held := make([]string, 0, len(current))
+	heldIDs := map[string]pgtype.UUID{}
+	for _, r := range current {
+		held = append(held, r.RoleCode)
+		heldIDs[r.RoleCode] = r.RoleID
+	}
+	grant, revoke, ok := roleChanges(mappings, groups, held)
+	if !ok {
+		return ErrSSONoMappedRole
+	}
+	if len(grant) == 0 && len(revoke) == 0 {
+		return nil
+	}
+
+	roles, err := s.queries.ListRolesByTenant(ctx, p.TenantID)
+	if err != nil {
+		return err
+	}
+	roleIDs := map[string]pgtype.UUID{}
+	for _, r := range roles {
+		roleIDs[r.Code] = r.ID
+	}
+	for _, code := range grant {
+		roleID, ok := roleIDs[code]
+		if !ok {
+			continue
+		}
+		if err := s.queries.AssignRoleToUser(ctx, db.AssignRoleToUserParams{
+			TenantID:  p.TenantID,
+			UserID:    userID,
+			RoleID:    roleID,
+			ScopeType: "tenant",
+		}); err != nil {
+			return err
+		}
+	}
+	for _, code := range revoke {
+		if err := s.queries.RemoveRoleFromUser(ctx, p.TenantID, userID, heldIDs[code]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExchangeTicket swaps a one-time SSO ticket for a session.
+func (s *SSOService) ExchangeTicket(ctx context.Context, ticket string) (*LoginResult, error) {
+	ticket = strings.TrimSpace(ticket)
+	if ticket == "" {
+		return nil, ErrSSOTicketInvalid
+	}
+	redeemed, err := s.queries.RedeemSSOTicket(ctx, hashSSOToken(ticket))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrSSOTicketInvalid
+		}
+		return nil, err
+	}
+
+	user, err := s.queries.GetUserByID(ctx, redeemed.Identity.UserID)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+	if !user.IsActive.Bool {
+		return nil, ErrUserInactive
+	}
+
+	roleAssignment, err := s.queries.GetUserRoleAssignmentWithPermissions(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if roleAssignment.TenantID != redeemed.TenantID || !isSSOStaffRole(roleAssignment.RoleCode) {
+		return nil, ErrSSORoleNotAllowed
+	}
+
+	blocked, err := s.queries.IsPlatformSecurityBlocked(ctx, user.ID, roleAssignment.TenantID)
+	if err == nil && blocked {
+		return nil, ErrAccessBlocked
+	}
+
+	// SSO goes through the same second-factor step as password login. A role
+	// that must use a phishing-resistant factor is let through only on the
+	// IdP's word that it used one; a TOTP or local challenge is not enough.
+	if s.auth.loadMFAPolicy(ctx).requiresPhishingResistant(roleAssignment.RoleCode) {
+		if !sso.PhishingResistantMethods(redeemed.AuthMethods) {
+			return nil, &AuthFactorError{UserID: user.ID.String(), Method: "sso", Err: ErrSSOPhishingResistantRequired}
+		}
+	} else if err := s.auth.requireSecondFactor(ctx, user.ID, redeemed.Identity.ID, roleAssignment.RoleCode); err != nil {
+		return nil, err
+	}
+
+	missingLegal, err := s.auth.missingLegalAcceptances(ctx, user.ID)
+	if err == nil && len(missingLegal) > 0 {
+		preauth, err := s.auth.mintLegalPreauthToken(user.ID.String())
+		if err != nil {
+			return nil, err
+		}
+		return nil, &LegalAcceptanceRequiredError{
+			Requirements: missingLegal,
+			PreauthToken: preauth,
+		}
+	}
+
+	return s.auth.mintLoginResult(ctx, user, redeemed.Identity, roleAssignment)
+}
+
+// enforceSSOOnly rejects password sign-in for staff of tenants that require SSO.
+// Parents and students are unaffected; platform staff are not governed by a tenant.
+func (s *Service) enforceSSOOnly(ctx context.Context, roleAssignment db.GetUserRoleAssignmentWithPermissionsRow) error {
+	if !isSSOStaffRole(roleAssignment.RoleCode) || !roleAssignment.TenantID.Valid {
+		return nil
+	}
+	ssoOnly, err := s.queries.GetTenantSSOOnly(ctx, roleAssignment.TenantID)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "42P01" {
+			return nil
+		}
+		return err
+	}
+	if ssoOnly {
+		return ErrSSORequired
+	}
+	return nil
+}
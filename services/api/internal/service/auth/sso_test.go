@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRoleChangesFromGroups(t *testing.T) {
+	mappings := []SSORoleMapping{
+		{Group: "Teachers", Role: "teacher"},
+		{Group: "Accounts", Role: "accountant"},
+	}
+
+	grant, revoke, ok := roleChanges(mappings, []string{"teachers"}, []string{"accountant", "librarian"})
+	if !ok {
+		t.Fatalf("expected a mapped group to match")
+	}
+	if !reflect.DeepEqual(grant, []string{"teacher"}) {
+		t.Fatalf("unexpected grants: %v", grant)
+	}
+	// librarian is not mapped by the IdP, so a manual assignment must survive.
+	if !reflect.DeepEqual(revoke, []string{"accountant"}) {
+		t.Fatalf("unexpected revokes: %v", revoke)
+	}
+
+	if _, _, ok := roleChanges(mappings, []string{"Students"}, []string{"teacher"}); ok {
+		t.Fatalf("expected no matching group to be rejected")
+	}
+	if grant, revoke, ok := roleChanges(nil, nil, []string{"teacher"}); !ok || grant != nil || revoke != nil {
+		t.Fatalf("providers without mappings must leave roles alone")
+	}
+}
+
+func TestSSOStaffRoles(t *testing.T) {
+	for _, code := range []string{"parent", "student", "super_admin", "support_l1", ""} {
+		if isSSOStaffRole(code) {
+			t.Fatalf("%q must not be grantable through sso", code)
+		}
+	}
+	for _, code := range []string{"teacher", "tenant_admin", "accountant", "librarian"} {
+		if !isSSOStaffRole(code) {
+			t.Fatalf("%q should be a staff role", code)
+		}
+	}
+}
+
+func TestSafeRedirectPathAndDomains(t *testing.T) {
+	for in, want := range map[string]string{
+		"/dashboard":           "/dashboard",
+		"//evil.example":       "",
+		"/\\evil.example":      "",
+		"https://evil.example": "",
+		"":                     "",
+	} {
+		if got := SafeRedirectPath(in); got != want {
+			t.Fatalf("SafeRedirectPath(%q) = %q, want %q", in, got, want)
+		}
+	}
+
+	if emailDomainAllowed("a@school.edu", nil) {
+		t.Fatalf("an empty allow-list must allow no domain")
+	}
+	if emailDomainAllowed("a@evil.school.edu", []string{"school.edu"}) {
+		t.Fatalf("subdomains must be listed explicitly")
+	}
+	if !emailDomainAllowed("a@school.edu", []string{"school.edu"}) {
+		t.Fatalf("listed domain should be allowed")
+	}
+}
@@ -0,0 +1,476 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/schoolerp/api/internal/db"
+	"github.com/schoolerp/api/internal/foundation/webauthn"
+)
+
+var (
+	ErrWebAuthnNotConfigured       = errors.New("passkeys are not configured")
+	ErrWebAuthnChallengeInvalid    = errors.New("passkey challenge is invalid or expired")
+	ErrWebAuthnVerificationFailed  = errors.New("passkey verification failed")
+	ErrWebAuthnCredentialNotFound  = errors.New("passkey not found")
+	ErrWebAuthnCredentialExists    = errors.New("passkey is already registered")
+	ErrLastPhishingResistantFactor = errors.New("your role requires a passkey; register another before removing this one")
+)
+
+const (
+	webAuthnChallengeTTL = 5 * time.Minute
+	maxPasskeyNameLength = 64
+
+	webAuthnPurposeRegister     = "register"
+	webAuthnPurposeMFA          = "mfa"
+	webAuthnPurposePasswordless = "passwordless"
+)
+
+// WebAuthnService manages passkeys and security keys and runs the WebAuthn
+// ceremonies for second-factor and passwordless sign-in.
+type WebAuthnService struct {
+	auth    *Service
+	queries *db.Queries
+}
+
+func newWebAuthnService(s *Service) *WebAuthnService {
+	return &WebAuthnService{auth: s, queries: s.queries}
+}
+
+// WebAuthnCeremony is handed to the browser: Options go to
+// navigator.credentials.create/get and ChallengeID comes back with the result.
+type WebAuthnCeremony struct {
+	ChallengeID string `json:"challenge_id"`
+	Options     any    `json:"public_key"`
+}
+
+type WebAuthnCredentialView struct {
+	ID             string     `json:"id"`
+	Name           string     `json:"name"`
+	Transports     []string   `json:"transports"`
+	BackupEligible bool       `json:"backup_eligible"`
+	BackupState    bool       `json:"backup_state"`
+	CreatedAt      time.Time  `json:"created_at"`
+	LastUsedAt     *time.Time `json:"last_used_at,omitempty"`
+}
+
+// RegisteredPasskey is returned after registration. RecoveryCodes is only set
+// when this was the user's first second factor.
+type RegisteredPasskey struct {
+	Credential    WebAuthnCredentialView `json:"credential"`
+	RecoveryCodes []string               `json:"recovery_codes,omitempty"`
+}
+
+// webAuthnRelyingParty reads the RP configuration. WEBAUTHN_RP_ID must be the
+// registrable domain shared by every frontend origin; tenants on custom
+// domains outside it cannot use passkeys.
+func webAuthnRelyingParty() (webauthn.RelyingParty, error) {
+	production := strings.EqualFold(strings.TrimSpace(os.Getenv("ENV")), "production")
+	rp := webauthn.RelyingParty{
+		ID:   strings.ToLower(strings.TrimSpace(os.Getenv("WEBAUTHN_RP_ID"))),
+		Name: strings.TrimSpace(os.Getenv("WEBAUTHN_RP_NAME")),
+	}
+	if rp.Name == "" {
+		rp.Name = "SchoolERP"
+	}
+	if rp.ID == "" {
+		if production {
+			return webauthn.RelyingParty{}, ErrWebAuthnNotConfigured
+		}
+		rp.ID = "localhost"
+	}
+
+	origins := strings.TrimSpace(os.Getenv("WEBAUTHN_ORIGINS"))
+	if origins == "" {
+		origins = os.Getenv("CORS_ALLOWED_ORIGINS")
+	}
+	for _, origin := range strings.Split(origins, ",") {
+		origin = strings.TrimRight(strings.TrimSpace(origin), "/")
+		u, err := url.Parse(origin)
+		if err != nil || u.Host == "" || strings.Contains(origin, "*") {
+			continue
+		}
+		host := strings.ToLower(u.Hostname())
+		if host == rp.ID || strings.HasSuffix(host, "."+rp.ID) {
+			rp.Origins = append(rp.Origins, origin)
+		}
+	}
+	if len(rp.Origins) == 0 {
+		if production {
+			return webauthn.RelyingParty{}, ErrWebAuthnNotConfigured
+		}
+		rp.Origins = []string{"http://localhost:3000", "http://localhost:3001"}
+	}
+	return rp, nil
+}
+
+func webAuthnCredentialView(c db.WebAuthnCredential) WebAuthnCredentialView {
+	v := WebAuthnCredentialView{
+		ID:             uuid.UUID(c.ID.Bytes).String(),
+		Name:           c.Name,
+		Transports:     c.Transports,
+		BackupEligible: c.BackupEligible,
+		BackupState:    c.BackupState,
+		CreatedAt:      c.CreatedAt.Time,
+	}
+	if c.LastUsedAt.Valid {
+		t := c.LastUsedAt.Time
+		v.LastUsedAt = &t
+	}
+	return v
+}
+
+func toWebAuthnCredential(c db.WebAuthnCredential) webauthn.Credential {
+	return webauthn.Credential{
+		ID:         c.CredentialID,
+		PublicKey:  c.PublicKey,
+		Algorithm:  c.Algorithm,
+		SignCount:  uint32(c.SignCount),
+		Transports: c.Transports,
+	}
+}
+
+// listCredentials treats a missing table as no credentials so sign-in keeps
+// working before the migration is applied.
+func (s *WebAuthnService) listCredentials(ctx context.Context, userID pgtype.UUID) ([]db.WebAuthnCredential, error) {
+	creds, err := s.queries.ListWebAuthnCredentials(ctx, userID)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "42P01" {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return creds, nil
+}
+
+func (s *WebAuthnService) ListCredentials(ctx context.Context, userID string) ([]WebAuthnCredentialView, error) {
+	uid, ok := parseUUID(userID)
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	creds, err := s.listCredentials(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]WebAuthnCredentialView, 0, len(creds))
+	for _, c := range creds {
+		out = append(out, webAuthnCredentialView(c))
+	}
+	return out, nil
+}
+
+func (s *WebAuthnService) newChallenge(ctx context.Context, userID pgtype.UUID, purpose string) ([]byte, string, error) {
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		return nil, "", err
+	}
+	id, err := s.queries.CreateWebAuthnChallenge(ctx, userID, purpose, challenge, time.Now().Add(webAuthnChallengeTTL))
+	if err != nil {
+		return nil, "", err
+	}
+	return challenge, uuid.UUID(id.Bytes).String(), nil
+}
+
+// consumeChallenge returns the challenge bytes once. When userID is valid the
+// challenge must have been issued to that user.
+func (s *WebAuthnService) consumeChallenge(ctx context.Context, challengeID, purpose string, userID pgtype.UUID) ([]byte, error) {
+	id, ok := parseUUID(challengeID)
+	if !ok {
+		return nil, ErrWebAuthnChallengeInvalid
+	}
+	challenge, owner, err := s.queries.ConsumeWebAuthnChallenge(ctx, id, purpose)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrWebAuthnChallengeInvalid
+		}
+		return nil, err
+	}
+	if userID.Valid && owner != userID {
+		return nil, ErrWebAuthnChallengeInvalid
+	}
+	return challenge, nil
+}
+
+// BeginRegistration starts adding a passkey to the signed-in user's account.
+func (s *WebAuthnService) BeginRegistration(ctx context.Context, userID string) (*WebAuthnCeremony, error) {
+	uid, ok := parseUUID(userID)
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	return s.beginRegistration(ctx, uid)
+}
+
+func (s *WebAuthnService) beginRegistration(ctx context.Context, uid pgtype.UUID) (*WebAuthnCeremony, error) {
+	rp, err := webAuthnRelyingParty()
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.queries.GetUserByID(ctx, uid)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+	existing, err := s.listCredentials(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	exclude := make([]webauthn.Credential, 0, len(existing))
+	for _, c := range existing {
+		exclude = append(exclude, toWebAuthnCredential(c))
+	}
+
+	challenge, challengeID, err := s.newChallenge(ctx, uid, webAuthnPurposeRegister)
+	if err != nil {
+		return nil, err
+	}
+	name := user.Email.String
+	if name == "" {
+		name = user.FullName
+	}
+	options := rp.CreationOptions(webauthn.UserEntity{
+		ID:          uid.Bytes[:],
+		Name:        name,
+		DisplayName: user.FullName,
+	}, challenge, exclude, false)
+	return &WebAuthnCeremony{ChallengeID: challengeID, Options: options}, nil
+}
+
+// FinishRegistration verifies the browser's response and stores the passkey.
+func (s *WebAuthnService) FinishRegistration(ctx context.Context, userID, challengeID, name string, resp webauthn.RegistrationResponse) (*RegisteredPasskey, error) {
+	uid, ok := parseUUID(userID)
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	return s.finishRegistration(ctx, uid, challengeID, name, resp)
+}
+
+func (s *WebAuthnService) finishRegistration(ctx context.Context, uid pgtype.UUID, challengeID, name string, resp webauthn.RegistrationResponse) (*RegisteredPasskey, error) {
+	rp, err := webAuthnRelyingParty()
+	if err != nil {
+		return nil, err
+	}
+	challenge, err := s.consumeChallenge(ctx, challengeID, webAuthnPurposeRegister, uid)
+	if err != nil {
+		return nil, err
+	}
+	cred, err := rp.VerifyRegistration(challenge, resp, false)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrWebAuthnVerificationFailed, err)
+	}
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = "Passkey"
+	}
+	if len(name) > maxPasskeyNameLength {
+		name = name[:maxPasskeyNameLength]
+	}
+
+	hadSecondFactor := s.auth.enrolledFactors(ctx, uid).any()
+	stored, err := s.queries.CreateWebAuthnCredential(ctx, db.CreateWebAuthnCredentialParams{
+		UserID:            uid,
+		CredentialID:      cred.ID,
+		PublicKey:         cred.PublicKey,
+		Algorithm:         cred.Algorithm,
+		SignCount:         int64(cred.SignCount),
+		AAGUID:            cred.AAGUID,
+		Transports:        cred.Transports,
+		AttestationFormat: cred.AttestationFormat,
+		UserVerified:      cred.UserVerified,
+		BackupEligible:    cred.BackupEligible,
+		BackupState:       cred.BackupState,
+		Name:              name,
+	})
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return nil, ErrWebAuthnCredentialExists
+		}
+		return nil, err
+	}
+
+	out := &RegisteredPasskey{Credential: webAuthnCredentialView(stored)}
+	if !hadSecondFactor {
+		codes, err := s.auth.ensureRecoveryCodes(ctx, uid)
+		if err != nil {
+			return nil, err
+		}
+		out.RecoveryCodes = codes
+	}
+	return out, nil
+}
+
+func (s *WebAuthnService) RenameCredential(ctx context.Context, userID, credentialID, name string) error {
+	uid, ok := parseUUID(userID)
+	if !ok {
+		return ErrUserNotFound
+	}
+	id, ok := parseUUID(credentialID)
+	if !ok {
+		return ErrWebAuthnCredentialNotFound
+	}
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > maxPasskeyNameLength {
+		return fmt.Errorf("%w: name must be 1-%d characters", ErrWebAuthnVerificationFailed, maxPasskeyNameLength)
+	}
+	n, err := s.queries.RenameWebAuthnCredential(ctx, uid, id, name)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrWebAuthnCredentialNotFound
+	}
+	return nil
+}
+
+// DeleteCredential removes a passkey. Users whose role requires a
+// phishing-resistant factor cannot remove their last one.
+func (s *WebAuthnService) DeleteCredential(ctx context.Context, userID, credentialID string) error {
+	uid, ok := parseUUID(userID)
+	if !ok {
+		return ErrUserNotFound
+	}
+	id, ok := parseUUID(credentialID)
+	if !ok {
+		return ErrWebAuthnCredentialNotFound
+	}
+
+	creds, err := s.listCredentials(ctx, uid)
+	if err != nil {
+		return err
+	}
+	if len(creds) <= 1 {
+		role, err := s.queries.GetUserRoleAssignmentWithPermissions(ctx, uid)
+		if err == nil && s.auth.loadMFAPolicy(ctx).requiresPhishingResistant(role.RoleCode) {
+			return ErrLastPhishingResistantFactor
+		}
+	}
+
+	n, err := s.queries.DeleteWebAuthnCredential(ctx, uid, id)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrWebAuthnCredentialNotFound
+	}
+	return nil
+}
+
+// beginAssertion issues a challenge for one of the user's own credentials.
+func (s *WebAuthnService) beginAssertion(ctx context.Context, uid pgtype.UUID) (*WebAuthnCeremony, error) {
+	rp, err := webAuthnRelyingParty()
+	if err != nil {
+		return nil, err
+	}
+	creds, err := s.listCredentials(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	if len(creds) == 0 {
+		return nil, ErrWebAuthnCredentialNotFound
+	}
+	allow := make([]webauthn.Credential, 0, len(creds))
+	for _, c := range creds {
+		allow = append(allow, toWebAuthnCredential(c))
+	}
+	challenge, challengeID, err := s.newChallenge(ctx, uid, webAuthnPurposeMFA)
+	if err != nil {
+		return nil, err
+	}
+	return &WebAuthnCeremony{ChallengeID: challengeID, Options: rp.RequestOptions(challenge, allow, false)}, nil
+}
+
+// verifyAssertion checks an assertion and advances the credential's counter.
+// When uid is valid the credential must belong to that user.
+func (s *WebAuthnService) verifyAssertion(ctx context.Context, uid pgtype.UUID, challengeID, purpose string, resp webauthn.AssertionResponse, requireUV bool) (db.WebAuthnCredential, error) {
+	rp, err := webAuthnRelyingParty()
+	if err != nil {
+		return db.WebAuthnCredential{}, err
+	}
+	challenge, err := s.consumeChallenge(ctx, challengeID, purpose, uid)
+	if err != nil {
+		return db.WebAuthnCredential{}, err
+	}
+	rawID, err := webauthn.DecodeID(resp.RawID)
+	if err != nil || len(rawID) == 0 {
+		return db.WebAuthnCredential{}, ErrWebAuthnVerificationFailed
+	}
+	stored, err := s.queries.GetWebAuthnCredentialByCredentialID(ctx, rawID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return db.WebAuthnCredential{}, ErrWebAuthnCredentialNotFound
+		}
+		return db.WebAuthnCredential{}, err
+	}
+	if uid.Valid && stored.UserID != uid {
+		return db.WebAuthnCredential{}, ErrWebAuthnCredentialNotFound
+	}
+
+	assertion, err := rp.VerifyAssertion(challenge, resp, toWebAuthnCredential(stored), requireUV)
+	if err != nil {
+		return stored, fmt.Errorf("%w: %v", ErrWebAuthnVerificationFailed, err)
+	}
+	if len(assertion.UserHandle) > 0 && string(assertion.UserHandle) != string(stored.UserID.Bytes[:]) {
+		return stored, ErrWebAuthnVerificationFailed
+	}
+	if err := s.queries.TouchWebAuthnCredential(ctx, stored.ID, int64(assertion.SignCount), assertion.BackupState); err != nil {
+		return stored, err
+	}
+	return stored, nil
+}
+
+// BeginPasswordless asks the browser for any discoverable passkey for this site.
+func (s *WebAuthnService) BeginPasswordless(ctx context.Context) (*WebAuthnCeremony, error) {
+	rp, err := webAuthnRelyingParty()
+	if err != nil {
+		return nil, err
+	}
+	challenge, challengeID, err := s.newChallenge(ctx, pgtype.UUID{}, webAuthnPurposePasswordless)
+	if err != nil {
+		return nil, err
+	}
+	return &WebAuthnCeremony{ChallengeID: challengeID, Options: rp.RequestOptions(challenge, nil, true)}, nil
+}
+
+// FinishPasswordless signs a user in with a passkey alone. User verification
+// (PIN or biometric) is required, so the passkey counts as multi-factor and
+// satisfies the phishing-resistant policy.
+func (s *WebAuthnService) FinishPasswordless(ctx context.Context, challengeID string, resp webauthn.AssertionResponse) (*LoginResult, error) {
+	stored, err := s.verifyAssertion(ctx, pgtype.UUID{}, challengeID, webAuthnPurposePasswordless, resp, true)
+	if err != nil {
+		if stored.UserID.Valid {
+			return nil, &AuthFactorError{UserID: stored.UserID.String(), Method: MFAMethodWebAuthn, Err: err}
+		}
+		return nil, err
+	}
+
+	user, err := s.queries.GetUserByID(ctx, stored.UserID)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+	if !user.IsActive.Bool {
+		return nil, &AuthFactorError{UserID: user.ID.String(), Method: MFAMethodWebAuthn, Err: ErrUserInactive}
+	}
+
+	roleAssignment, err := s.queries.GetUserRoleAssignmentWithPermissions(ctx, user.ID)
+	if err != nil {
+		roleAssignment = db.GetUserRoleAssignmentWithPermissionsRow{
+			RoleCode:    "user",
+			Permissions: []string{},
+		}
+	}
+	identity, err := s.queries.UpsertUserIdentity(ctx, user.ID, MFAMethodWebAuthn, user.ID.String())
+	if err != nil {
+		return nil, err
+	}
+	return s.auth.finishStrongLogin(ctx, user, identity, roleAssignment)
+}
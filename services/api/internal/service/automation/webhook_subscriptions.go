@@ -0,0 +1,532 @@
+package automation
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/rs/zerolog/log"
+	"github.com/schoolerp/api/internal/db"
+	"github.com/schoolerp/api/internal/foundation/audit"
+	"github.com/schoolerp/api/internal/foundation/keyring"
+)
+
+// WebhookEvents are the outbox events tenants may subscribe endpoints to.
+var WebhookEvents = []string{
+	"student.created",
+	"fee.paid",
+	"attendance.absent",
+	"exam.published",
+}
+
+const (
+	// Headers sent with every tenant webhook delivery.
+	WebhookSignatureHeader = "X-SchoolERP-Signature"
+	WebhookEventHeader     = "X-SchoolERP-Event"
+	WebhookDeliveryHeader  = "X-SchoolERP-Delivery"
+
+	// A delivery is given up ("dead") after this many failed attempts.
+	webhookMaxAttempts = 10
+	// An endpoint is disabled after this many failed attempts in a row,
+	// across all of its deliveries.
+	webhookDisableAfterFailures = 50
+	webhookRetryBase            = 30 * time.Second
+	webhookRetryCap             = 2 * time.Hour
+	webhookLeaseSeconds         = 120
+	webhookBatchSize            = 25
+	webhookFanOutBatchSize      = 200
+	webhookResponseSnippet      = 1024
+)
+
+var (
+	ErrInvalidWebhookSubscription  = errors.New("invalid webhook subscription")
+	ErrWebhookSubscriptionNotFound = errors.New("webhook subscription not found")
+	ErrWebhookDeliveryNotFound     = errors.New("webhook delivery not found")
+)
+
+// WebhookActor identifies who changed a subscription, for the audit log.
+type WebhookActor struct {
+	UserID    string
+	RequestID string
+	IP        string
+}
+
+type WebhookSubscriptionInput struct {
+	Name      string   `json:"name"`
+	TargetURL string   `json:"target_url"`
+	Events    []string `json:"events"`
+}
+
+// WebhookSubscriptionWithSecret is returned when a signing secret is issued;
+// the secret is not retrievable afterwards.
+type WebhookSubscriptionWithSecret struct {
+	db.TenantWebhookSubscription
+	Secret string `json:"secret"`
+}
+
+// SubscriptionService manages tenant webhook endpoints and delivers outbox
+// events to them: signed with the endpoint secret, retried with exponential
+// backoff and disabled when the endpoint keeps failing.
+type SubscriptionService struct {
+	q       *db.Queries
+	keys    *keyring.Service
+	audit   *audit.Logger
+	webhook *WebhookService
+}
+
+func NewSubscriptionService(q *db.Queries, keys *keyring.Service, auditLogger *audit.Logger) *SubscriptionService {
+	return &SubscriptionService{
+		q:       q,
+		keys:    keys,
+		audit:   auditLogger,
+		webhook: newSigningWebhookService(),
+	}
+}
+
+func (s *SubscriptionService) CreateSubscription(ctx context.Context, tenantID string, actor WebhookActor, in WebhookSubscriptionInput) (WebhookSubscriptionWithSecret, error) {
+	in, err := normalizeWebhookSubscription(ctx, in)
+	if err != nil {
+		return WebhookSubscriptionWithSecret{}, err
+	}
+	secret, secretEnc, err := s.newSecret(ctx, tenantID)
+	if err != nil {
+		return WebhookSubscriptionWithSecret{}, err
+	}
+
+	sub, err := s.q.CreateTenantWebhookSubscription(ctx, db.CreateTenantWebhookSubscriptionParams{
+		TenantID:  toPgUUID(tenantID),
+		Name:      in.Name,
+		TargetURL: in.TargetURL,
+		SecretEnc: secretEnc,
+		Events:    in.Events,
+		CreatedBy: toPgUUID(actor.UserID),
+	})
+	if err != nil {
+		return WebhookSubscriptionWithSecret{}, err
+	}
+	s.logChange(ctx, actor, "webhook_subscription.create", sub)
+	return WebhookSubscriptionWithSecret{TenantWebhookSubscription: sub, Secret: secret}, nil
+}
+
+func (s *SubscriptionService) ListSubscriptions(ctx context.Context, tenantID string) ([]db.TenantWebhookSubscription, error) {
+	return s.q.ListTenantWebhookSubscriptions(ctx, toPgUUID(tenantID))
+}
+
+func (s *SubscriptionService) GetSubscription(ctx context.Context, tenantID, id string) (db.TenantWebhookSubscription, error) {
+	sub, err := s.q.GetTenantWebhookSubscription(ctx, toPgUUID(tenantID), toPgUUID(id))
+	return sub, notFound(err, ErrWebhookSubscriptionNotFound)
+}
+
+func (s *SubscriptionService) UpdateSubscription(ctx context.Context, tenantID, id string, actor WebhookActor, in WebhookSubscriptionInput) (db.TenantWebhookSubscription, error) {
+	in, err := normalizeWebhookSubscription(ctx, in)
+	if err != nil {
+		return db.TenantWebhookSubscription{}, err
+	}
+	sub, err := s.q.UpdateTenantWebhookSubscription(ctx, db.UpdateTenantWebhookSubscriptionParams{
+		TenantID:  toPgUUID(tenantID),
+		ID:        toPgUUID(id),
+		Name:      in.Name,
+		TargetURL: in.TargetURL,
+		Events:    in.Events,
+	})
+	if err != nil {
+		return db.TenantWebhookSubscription{}, notFound(err, ErrWebhookSubscriptionNotFound)
+	}
+	s.logChange(ctx, actor, "webhook_subscription.update", sub)
+	return sub, nil
+}
+
+// SetSubscriptionEnabled enables or disables an endpoint. Deliveries queued
+// while it was disabled resume when it is enabled again.
+func (s *SubscriptionService) SetSubscriptionEnabled(ctx context.Context, tenantID, id string, actor WebhookActor, enabled bool) (db.TenantWebhookSubscription, error) {
+	status, reason, action := "active", "", "webhook_subscription.enable"
+	if !enabled {
+		status, reason, action = "disabled", "disabled_by_user", "webhook_subscription.disable"
+	}
+	sub, err := s.q.SetTenantWebhookSubscriptionStatus(ctx, toPgUUID(tenantID), toPgUUID(id), status, reason)
+	if err != nil {
+		return db.TenantWebhookSubscription{}, notFound(err, ErrWebhookSubscriptionNotFound)
+	}
+	s.logChange(ctx, actor, action, sub)
+	return sub, nil
+}
+
+// RotateSecret issues a new signing secret. Deliveries sent from now on,
+// including retries of earlier events, are signed with it.
+func (s *SubscriptionService) RotateSecret(ctx context.Context, tenantID, id string, actor WebhookActor) (WebhookSubscriptionWithSecret, error) {
+	secret, secretEnc, err := s.newSecret(ctx, tenantID)
+	if err != nil {
+		return WebhookSubscriptionWithSecret{}, err
+	}
+	sub, err := s.q.UpdateTenantWebhookSecret(ctx, toPgUUID(tenantID), toPgUUID(id), secretEnc)
+	if err != nil {
+		return WebhookSubscriptionWithSecret{}, notFound(err, ErrWebhookSubscriptionNotFound)
+	}
+	s.logChange(ctx, actor, "webhook_subscription.rotate_secret", sub)
+	return WebhookSubscriptionWithSecret{TenantWebhookSubscription: sub, Secret: secret}, nil
+}
+
+func (s *SubscriptionService) DeleteSubscription(ctx context.Context, tenantID, id string, actor WebhookActor) error {
+	sub, err := s.GetSubscription(ctx, tenantID, id)
+	if err != nil {
+		return err
+	}
+	if _, err := s.q.DeleteTenantWebhookSubscription(ctx, sub.TenantID, sub.ID); err != nil {
+		return err
+	}
+	s.logChange(ctx, actor, "webhook_subscription.delete", sub)
+	return nil
+}
+
+// ListDeliveries is the delivery log of an endpoint, optionally filtered by
+// status (pending, succeeded or dead).
+func (s *SubscriptionService) ListDeliveries(ctx context.Context, tenantID, subscriptionID, status string, limit, offset int32) ([]db.TenantWebhookDelivery, error) {
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	return s.q.ListTenantWebhookDeliveries(ctx, db.ListTenantWebhookDeliveriesParams{
+		TenantID:       toPgUUID(tenantID),
+		SubscriptionID: toPgUUID(subscriptionID),
+		Status:         strings.TrimSpace(status),
+		Limit:          limit,
+		Offset:         offset,
+	})
+}
+
+func (s *SubscriptionService) ListDeliveryAttempts(ctx context.Context, tenantID, subscriptionID, deliveryID string) ([]db.TenantWebhookDeliveryAttempt, error) {
+	dispatch, err := s.q.GetTenantWebhookDispatch(ctx, toPgUUID(tenantID), toPgUUID(subscriptionID), toPgUUID(deliveryID))
+	if err != nil {
+		return nil, notFound(err, ErrWebhookDeliveryNotFound)
+	}
+	return s.q.ListTenantWebhookDeliveryAttempts(ctx, dispatch.Delivery.ID)
+}
+
+// Redeliver sends a delivery again right away, whatever its state, and
+// returns the updated delivery. A successful redelivery completes it; a
+// failed one leaves its retry schedule unchanged.
+func (s *SubscriptionService) Redeliver(ctx context.Context, tenantID, subscriptionID, deliveryID string, actor WebhookActor) (db.TenantWebhookDelivery, error) {
+	dispatch, err := s.q.GetTenantWebhookDispatch(ctx, toPgUUID(tenantID), toPgUUID(subscriptionID), toPgUUID(deliveryID))
+	if err != nil {
+		return db.TenantWebhookDelivery{}, notFound(err, ErrWebhookDeliveryNotFound)
+	}
+	dispatch.Delivery.Attempts++
+	outcome := s.attempt(ctx, dispatch)
+
+	status := dispatch.Delivery.Status
+	if outcome.ok() {
+		status = "succeeded"
+		_ = s.q.RecordTenantWebhookSuccess(ctx, dispatch.Delivery.SubscriptionID)
+	}
+	if err := s.q.RecordTenantWebhookAttempt(ctx, outcome.result(dispatch.Delivery, status, pgtype.Timestamptz{}, true)); err != nil {
+		return db.TenantWebhookDelivery{}, err
+	}
+
+	_ = s.audit.Log(ctx, audit.Entry{
+		TenantID:     dispatch.Delivery.TenantID,
+		UserID:       toPgUUID(actor.UserID),
+		RequestID:    actor.RequestID,
+		Action:       "webhook_delivery.redeliver",
+		ResourceType: "webhook_delivery",
+		ResourceID:   dispatch.Delivery.ID,
+		After:        map[string]any{"status": status, "response_status": outcome.statusCode},
+		IPAddress:    actor.IP,
+	})
+
+	dispatch.Delivery.Status = status
+	dispatch.Delivery.LastResponseStatus = pgtype.Int4{Int32: int32(outcome.statusCode), Valid: outcome.statusCode > 0}
+	dispatch.Delivery.LastError = pgtype.Text{String: outcome.err, Valid: outcome.err != ""}
+	return dispatch.Delivery, nil
+}
+
+// FanOut queues deliveries for outbox events not yet offered to tenant
+// endpoints. It follows its own cursor on the outbox, so events are fanned out
+// whether the API's processor or the worker handles them. Events outside
+// WebhookEvents pass the cursor without deliveries.
+func (s *SubscriptionService) FanOut(ctx context.Context) {
+	for {
+		scanned, _, err := s.q.FanOutOutboxToTenantWebhooks(ctx, WebhookEvents, webhookFanOutBatchSize)
+		if err != nil {
+			log.Error().Err(err).Msg("failed to fan out outbox events to webhooks")
+			return
+		}
+		if scanned < webhookFanOutBatchSize || ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// StartDeliveryWorker fans out new outbox events and sends due deliveries
+// until ctx is cancelled.
+func (s *SubscriptionService) StartDeliveryWorker(ctx context.Context) {
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.FanOut(ctx)
+			s.RunDeliveries(ctx)
+		}
+	}
+}
+
+// RunDeliveries sends one batch of due deliveries.
+func (s *SubscriptionService) RunDeliveries(ctx context.Context) {
+	batch, err := s.q.ClaimDueTenantWebhookDeliveries(ctx, webhookBatchSize, webhookLeaseSeconds)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to claim webhook deliveries")
+		return
+	}
+	for _, dispatch := range batch {
+		s.deliver(ctx, dispatch)
+	}
+}
+
+func (s *SubscriptionService) deliver(ctx context.Context, dispatch db.TenantWebhookDispatch) {
+	d := dispatch.Delivery
+	outcome := s.attempt(ctx, dispatch)
+
+	status := "succeeded"
+	var next pgtype.Timestamptz
+	if outcome.ok() {
+		if err := s.q.RecordTenantWebhookSuccess(ctx, d.SubscriptionID); err != nil {
+			log.Error().Err(err).Str("subscription_id", d.SubscriptionID.String()).Msg("failed to record webhook success")
+		}
+	} else {
+		status = "pending"
+		if d.Attempts >= webhookMaxAttempts {
+			status = "dead"
+		} else {
+			next = pgtype.Timestamptz{Time: time.Now().Add(webhookRetryDelay(d.Attempts)), Valid: true}
+		}
+		disabled, err := s.q.RecordTenantWebhookFailure(ctx, d.SubscriptionID, webhookDisableAfterFailures, "too_many_failures")
+		if err != nil {
+			log.Error().Err(err).Str("subscription_id", d.SubscriptionID.String()).Msg("failed to record webhook failure")
+		}
+		if disabled {
+			log.Warn().
+				Str("tenant_id", d.TenantID.String()).
+				Str("subscription_id", d.SubscriptionID.String()).
+				Msg("webhook endpoint disabled after repeated failures")
+		}
+	}
+
+	if err := s.q.RecordTenantWebhookAttempt(ctx, outcome.result(d, status, next, false)); err != nil {
+		log.Error().Err(err).Str("delivery_id", d.ID.String()).Msg("failed to record webhook attempt")
+	}
+}
+
+func (s *SubscriptionService) attempt(ctx context.Context, dispatch db.TenantWebhookDispatch) webhookOutcome {
+	secret, err := s.keys.DecryptString(ctx, dispatch.Delivery.TenantID.String(), dispatch.SecretEnc)
+	if err != nil {
+		return webhookOutcome{err: "signing secret unavailable"}
+	}
+	return s.webhook.send(ctx, dispatch.TargetURL, secret, dispatch.Delivery, time.Now())
+}
+
+func (s *SubscriptionService) newSecret(ctx context.Context, tenantID string) (string, string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", err
+	}
+	secret := "whsec_" + hex.EncodeToString(raw)
+	enc, err := s.keys.EncryptString(ctx, tenantID, secret)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to encrypt webhook secret: %w", err)
+	}
+	return secret, enc, nil
+}
+
+func (s *SubscriptionService) logChange(ctx context.Context, actor WebhookActor, action string, sub db.TenantWebhookSubscription) {
+	_ = s.audit.Log(ctx, audit.Entry{
+		TenantID:     sub.TenantID,
+		UserID:       toPgUUID(actor.UserID),
+		RequestID:    actor.RequestID,
+		Action:       action,
+		ResourceType: "webhook_subscription",
+		ResourceID:   sub.ID,
+		After:        sub,
+		IPAddress:    actor.IP,
+	})
+}
+
+// webhookOutcome is the result of one HTTP attempt.
+type webhookOutcome struct {
+	statusCode int
+	body       string
+	err        string
+	duration   time.Duration
+}
+
+func (o webhookOutcome) ok() bool {
+	return o.err == "" && o.statusCode >= 200 && o.statusCode < 300
+}
+
+func (o webhookOutcome) result(d db.TenantWebhookDelivery, status string, next pgtype.Timestamptz, manual bool) db.TenantWebhookAttemptResult {
+	errMsg := o.err
+	if errMsg == "" && !o.ok() {
+		errMsg = fmt.Sprintf("endpoint returned status %d", o.statusCode)
+	}
+	return db.TenantWebhookAttemptResult{
+		DeliveryID:     d.ID,
+		Attempt:        d.Attempts,
+		ResponseStatus: pgtype.Int4{Int32: int32(o.statusCode), Valid: o.statusCode > 0},
+		ResponseBody:   pgtype.Text{String: o.body, Valid: o.body != ""},
+		Error:          pgtype.Text{String: errMsg, Valid: errMsg != ""},
+		DurationMS:     int32(o.duration / time.Millisecond),
+		Manual:         manual,
+		Status:         status,
+		NextAttemptAt:  next,
+	}
+}
+
+// newSigningWebhookService returns a client for tenant endpoints. Redirects
+// are not followed: a delivery must be acknowledged by the registered URL.
+// Connections to private, loopback and link-local addresses are refused.
+func newSigningWebhookService() *WebhookService {
+	return &WebhookService{
+		client: &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: webhookTransport(),
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+func (s *WebhookService) send(ctx context.Context, targetURL, secret string, d db.TenantWebhookDelivery, now time.Time) webhookOutcome {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, targetURL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return webhookOutcome{err: "invalid target url"}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "SchoolERP-Webhooks/1.0")
+	req.Header.Set(WebhookEventHeader, d.EventType)
+	req.Header.Set(WebhookDeliveryHeader, d.ID.String())
+	req.Header.Set(WebhookSignatureHeader, SignWebhookPayload(secret, now, d.Payload))
+
+	started := time.Now()
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return webhookOutcome{err: err.Error(), duration: time.Since(started)}
+	}
+	defer resp.Body.Close()
+
+	snippet, _ := io.ReadAll(io.LimitReader(resp.Body, webhookResponseSnippet))
+	return webhookOutcome{
+		statusCode: resp.StatusCode,
+		body:       strings.ToValidUTF8(string(snippet), ""),
+		duration:   time.Since(started),
+	}
+}
+
+// SignWebhookPayload returns the signature header value for a body sent at
+// ts: "t=<unix seconds>,v1=<hex HMAC-SHA256 of "<unix seconds>.<body>">".
+// Receivers recompute v1 with their secret and reject stale timestamps.
+func SignWebhookPayload(secret string, ts time.Time, body []byte) string {
+	unix := strconv.FormatInt(ts.Unix(), 10)
+	return "t=" + unix + ",v1=" + webhookMAC(secret, unix, body)
+}
+
+// VerifyWebhookSignature checks a signature header produced by
+// SignWebhookPayload and that its timestamp is within tolerance of now.
+func VerifyWebhookSignature(secret, header string, body []byte, tolerance time.Duration, now time.Time) error {
+	var unix, sig string
+	for _, part := range strings.Split(header, ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch k {
+		case "t":
+			unix = v
+		case "v1":
+			sig = v
+		}
+	}
+	ts, err := strconv.ParseInt(unix, 10, 64)
+	if err != nil || sig == "" {
+		return errors.New("malformed webhook signature")
+	}
+	if age := now.Sub(time.Unix(ts, 0)); age > tolerance || age < -tolerance {
+		return errors.New("webhook signature timestamp outside tolerance")
+	}
+	if !hmac.Equal([]byte(sig), []byte(webhookMAC(secret, unix, body))) {
+		return errors.New("webhook signature mismatch")
+	}
+	return nil
+}
+
+func webhookMAC(secret, unix string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(unix))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookRetryDelay is the wait after the given failed attempt: 30s doubling
+// per attempt, capped at two hours.
+func webhookRetryDelay(attempt int32) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	delay := webhookRetryBase
+	for i := int32(1); i < attempt; i++ {
+		delay *= 2
+		if delay >= webhookRetryCap {
+			return webhookRetryCap
+		}
+	}
+	return delay
+}
+
+func normalizeWebhookSubscription(ctx context.Context, in WebhookSubscriptionInput) (WebhookSubscriptionInput, error) {
+	in.Name = strings.TrimSpace(in.Name)
+	in.TargetURL = strings.TrimSpace(in.TargetURL)
+	if in.Name == "" {
+		return in, fmt.Errorf("%w: name is required", ErrInvalidWebhookSubscription)
+	}
+	if err := validateWebhookURL(ctx, in.TargetURL); err != nil {
+		return in, err
+	}
+
+	var events []string
+	for _, e := range in.Events {
+		e = strings.ToLower(strings.TrimSpace(e))
+		if !slices.Contains(WebhookEvents, e) {
+			return in, fmt.Errorf("%w: unsupported event %q", ErrInvalidWebhookSubscription, e)
+		}
+		if !slices.Contains(events, e) {
+			events = append(events, e)
+		}
+	}
+	if len(events) == 0 {
+		return in, fmt.Errorf("%w: at least one event is required", ErrInvalidWebhookSubscription)
+	}
+	in.Events = events
+	return in, nil
+}
+
+func notFound(err, sentinel error) error {
+	if errors.Is(err, pgx.ErrNoRows) {
+		return sentinel
+	}
+	return err
+}
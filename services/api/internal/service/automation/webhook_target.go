@@ -0,0 +1,142 @@
+package automation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// errWebhookTargetBlocked is returned when an endpoint resolves to an address
+// the API must not reach on a tenant's behalf.
+var errWebhookTargetBlocked = errors.New("target resolves to a private, loopback or link-local address")
+
+// lookupWebhookHost resolves endpoint hosts; tests replace it.
+var lookupWebhookHost = net.DefaultResolver.LookupIPAddr
+
+// blockedWebhookNets are ranges net.IP has no predicate for: "this network",
+// carrier-grade NAT, IETF protocol assignments, benchmarking, reserved, and
+// NAT64, which can wrap any of the private ranges.
+var blockedWebhookNets = func() []*net.IPNet {
+	var nets []*net.IPNet
+	for _, cidr := range []string{
+		"0.0.0.0/8",
+		"100.64.0.0/10",
+		"192.0.0.0/24",
+		"198.18.0.0/15",
+		"240.0.0.0/4",
+		"64:ff9b::/96",
+	} {
+		_, n, _ := net.ParseCIDR(cidr)
+		nets = append(nets, n)
+	}
+	return nets
+}()
+
+// webhookDevTargets reports whether endpoints on this machine or a private
+// network may be used, so integrations can be developed against a local
+// receiver. Only explicit development environments allow it.
+func webhookDevTargets() bool {
+	switch strings.ToLower(strings.TrimSpace(os.Getenv("ENV"))) {
+	case "development", "dev", "local":
+		return true
+	}
+	return false
+}
+
+// publicWebhookAddr reports whether ip is an address tenant endpoints may use.
+func publicWebhookAddr(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, n := range blockedWebhookNets {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// validateWebhookURL requires an absolute https URL whose host resolves only to
+// public addresses. Development environments may also use plain http and local
+// hosts. The address is checked again on every connection, see webhookDialer.
+func validateWebhookURL(ctx context.Context, raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("%w: target_url must be an absolute URL", ErrInvalidWebhookSubscription)
+	}
+	if u.User != nil {
+		return fmt.Errorf("%w: target_url must not embed credentials", ErrInvalidWebhookSubscription)
+	}
+	dev := webhookDevTargets()
+	if u.Scheme != "https" && !(dev && u.Scheme == "http") {
+		return fmt.Errorf("%w: target_url must use https", ErrInvalidWebhookSubscription)
+	}
+	if dev {
+		return nil
+	}
+
+	host := u.Hostname()
+	if strings.EqualFold(host, "localhost") || strings.HasSuffix(strings.ToLower(host), ".localhost") {
+		return fmt.Errorf("%w: %v", ErrInvalidWebhookSubscription, errWebhookTargetBlocked)
+	}
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	addrs, err := lookupWebhookHost(ctx, host)
+	if err != nil || len(addrs) == 0 {
+		return fmt.Errorf("%w: target_url host could not be resolved", ErrInvalidWebhookSubscription)
+	}
+	for _, a := range addrs {
+		if !publicWebhookAddr(a.IP) {
+			return fmt.Errorf("%w: %v", ErrInvalidWebhookSubscription, errWebhookTargetBlocked)
+		}
+	}
+	return nil
+}
+
+// webhookDialer refuses connections to non-public addresses. The check runs on
+// the address actually dialled, after resolution, so a host that passed
+// validation and later re-resolves to an internal address (DNS rebinding) is
+// still blocked.
+func webhookDialer() *net.Dialer {
+	return &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			if webhookDevTargets() {
+				return nil
+			}
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || !publicWebhookAddr(ip) {
+				return errWebhookTargetBlocked
+			}
+			return nil
+		},
+	}
+}
+
+// webhookTransport is the transport for tenant endpoints. Proxies from the
+// environment are ignored, since a proxy would dial on our behalf and bypass
+// the address check.
+func webhookTransport() *http.Transport {
+	return &http.Transport{
+		Proxy:                 nil,
+		DialContext:           webhookDialer().DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          20,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+}
@@ -6,16 +6,24 @@ import (
 	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog/log"
 	"github.com/schoolerp/api/internal/foundation/audit"
 )
 
+// TransportScanner takes taps on readers fitted to buses. It reports false
+// for devices that are not bus readers.
+type TransportScanner interface {
+	RecordReaderScan(ctx context.Context, tenantID, deviceID, entityType, entityID, direction string, at time.Time) (bool, error)
+}
+
 type BiometricService struct {
-	pool  *pgxpool.Pool
-	audit *audit.Logger
+	pool      *pgxpool.Pool
+	audit     *audit.Logger
+	transport TransportScanner
 }
 
-func NewBiometricService(pool *pgxpool.Pool, audit *audit.Logger) *BiometricService {
-	return &BiometricService{pool: pool, audit: audit}
+func NewBiometricService(pool *pgxpool.Pool, audit *audit.Logger, transport TransportScanner) *BiometricService {
+	return &BiometricService{pool: pool, audit: audit, transport: transport}
 }
 
 type LogEntry struct {
@@ -58,7 +66,18 @@ func (s *BiometricService) IngestLog(ctx context.Context, tenantID string, entry
 		return "", fmt.Errorf("failed to save log: %w", err)
 	}
 
-	// 3. Trigger Attendance Logic (Asynchronous recommended in production)
+	// 3. Taps on bus readers mark trip boarding, not school attendance
+	if entityID != "" && s.transport != nil {
+		handled, err := s.transport.RecordReaderScan(ctx, tenantID, entry.DeviceID, entityType, entityID, entry.Direction, entry.Timestamp)
+		if err != nil {
+			log.Ctx(ctx).Error().Err(err).Str("device_id", entry.DeviceID).Msg("failed to record bus reader tap")
+		}
+		if handled {
+			return logID, nil
+		}
+	}
+
+	// 4. Trigger Attendance Logic (Asynchronous recommended in production)
 	if entityID != "" {
 		if entityType == "student" {
 			go s.markStudentAttendance(context.Background(), tenantID, entityID, entry.Timestamp)
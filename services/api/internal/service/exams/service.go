@@ -2,6 +2,7 @@ package exams
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"math"
 	"math/big"
@@ -12,15 +13,17 @@ import (
 	"github.com/rs/zerolog/log"
 	"github.com/schoolerp/api/internal/db"
 	"github.com/schoolerp/api/internal/foundation/audit"
+	"github.com/schoolerp/api/internal/foundation/datascope"
 )
 
 type Service struct {
 	q     db.Querier
 	audit *audit.Logger
+	scope *datascope.Service
 }
 
-func NewService(q db.Querier, audit *audit.Logger) *Service {
-	return &Service{q: q, audit: audit}
+func NewService(q db.Querier, audit *audit.Logger, scope *datascope.Service) *Service {
+	return &Service{q: q, audit: audit, scope: scope}
 }
 
 type CreateExamParams struct {
@@ -153,7 +156,10 @@ func (s *Service) UpdateSubjectMetadata(ctx context.Context, tenantID, examID, s
 	})
 }
 
-func (s *Service) GetExamMarks(ctx context.Context, tenantID, examID, subjectID string) ([]db.GetExamMarksRow, error) {
+// GetExamMarks returns the marks sheet of a subject, limited to the students
+// whose marks the actor may see. An actor with none of them gets a
+// *datascope.Violation.
+func (s *Service) GetExamMarks(ctx context.Context, tenantID, examID, subjectID string, actor datascope.Actor) ([]db.GetExamMarksRow, error) {
 	tUUID := pgtype.UUID{}
 	tUUID.Scan(tenantID)
 
@@ -163,11 +169,58 @@ func (s *Service) GetExamMarks(ctx context.Context, tenantID, examID, subjectID
 	sUUID := pgtype.UUID{}
 	sUUID.Scan(subjectID)
 
-	return s.q.GetExamMarks(ctx, db.GetExamMarksParams{
+	scope, err := s.scope.Resolve(ctx, tenantID, actor)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.q.GetExamMarks(ctx, db.GetExamMarksParams{
 		ExamID:    eUUID,
 		SubjectID: sUUID,
 		TenantID:  tUUID,
 	})
+	if err != nil || !scope.Restricted || len(rows) == 0 {
+		return rows, err
+	}
+
+	ids := make([]pgtype.UUID, len(rows))
+	for i, row := range rows {
+		ids[i] = row.StudentID
+	}
+	facts, err := s.scope.StudentFacts(ctx, tUUID, ids)
+	if err != nil {
+		return nil, err
+	}
+	visible := make([]db.GetExamMarksRow, 0, len(rows))
+	for _, row := range rows {
+		if scope.CanViewMarks(facts[row.StudentID], sUUID) {
+			visible = append(visible, row)
+		}
+	}
+	if len(visible) == 0 {
+		return nil, &datascope.Violation{Resource: "exam_subject", ResourceID: examID + "/" + subjectID, Reason: "subject_not_in_scope"}
+	}
+	return visible, nil
+}
+
+// authorizeMarksEntry fails with a *datascope.Violation unless the actor
+// teaches the subject to, or is class teacher of, every listed student.
+func (s *Service) authorizeMarksEntry(ctx context.Context, tenantID string, actor datascope.Actor, subjectID pgtype.UUID, studentIDs []pgtype.UUID) error {
+	scope, err := s.scope.Resolve(ctx, tenantID, actor)
+	if err != nil || !scope.Restricted {
+		return err
+	}
+	facts, err := s.scope.StudentFacts(ctx, toPgUUID(tenantID), studentIDs)
+	if err != nil {
+		return err
+	}
+	for _, id := range studentIDs {
+		f, ok := facts[id]
+		if !ok || !scope.CanEnterMarks(f, subjectID) {
+			return &datascope.Violation{Resource: "student", ResourceID: id.String(), Reason: "marks_entry_not_in_scope"}
+		}
+	}
+	return nil
 }
 
 type UpsertMarksParams struct {
@@ -177,6 +230,7 @@ type UpsertMarksParams struct {
 	StudentID string
 	Marks     float64
 	UserID    string
+	Role      string
 	RequestID string
 	IP        string
 }
@@ -203,6 +257,10 @@ func (s *Service) UpsertMarks(ctx context.Context, p UpsertMarksParams) error {
 	stUUID := pgtype.UUID{}
 	stUUID.Scan(p.StudentID)
 
+	if err := s.authorizeMarksEntry(ctx, p.TenantID, datascope.Actor{UserID: p.UserID, Role: p.Role}, sUUID, []pgtype.UUID{stUUID}); err != nil {
+		return err
+	}
+
 	uUUID := pgtype.UUID{}
 	uUUID.Scan(p.UserID)
 
@@ -248,6 +306,7 @@ type BulkUpsertMarksParams struct {
 	SubjectID string
 	Entries   []BulkUpsertMarksEntry
 	UserID    string
+	Role      string
 	RequestID string
 	IP        string
 }
@@ -286,6 +345,10 @@ func (s *Service) BulkUpsertMarks(ctx context.Context, p BulkUpsertMarksParams)
 		marks[i] = numericMarks
 	}
 
+	if err := s.authorizeMarksEntry(ctx, p.TenantID, datascope.Actor{UserID: p.UserID, Role: p.Role}, sUUID, studentIDs); err != nil {
+		return err
+	}
+
 	err = s.q.BatchUpsertMarks(ctx, db.BatchUpsertMarksParams{
 		ExamID:      eUUID,
 		SubjectID:   sUUID,
@@ -462,10 +525,29 @@ func (s *Service) PublishExam(ctx context.Context, tenantID, id string, userID,
 		IPAddress:    ip,
 	})
 
+	payload, _ := json.Marshal(map[string]interface{}{
+		"exam_id":          exam.ID,
+		"academic_year_id": exam.AcademicYearID,
+		"name":             exam.Name,
+		"type":             exam.Type,
+		"published_by":     userID,
+	})
+	_, _ = s.q.CreateOutboxEvent(ctx, db.CreateOutboxEventParams{
+		TenantID:  tUUID,
+		EventType: "exam.published",
+		Payload:   payload,
+	})
+
 	return exam, nil
 }
 
-func (s *Service) GetExamResultsForStudent(ctx context.Context, tenantID, studentID string) ([]db.GetExamResultsForStudentRow, error) {
+// GetExamResultsForStudent returns the published results of a student. An
+// actor outside the student's scope gets a *datascope.Violation.
+func (s *Service) GetExamResultsForStudent(ctx context.Context, tenantID, studentID string, actor datascope.Actor) ([]db.GetExamResultsForStudentRow, error) {
+	if err := s.scope.AuthorizeStudent(ctx, tenantID, actor, studentID); err != nil {
+		return nil, err
+	}
+
 	tUUID := pgtype.UUID{}
 	tUUID.Scan(tenantID)
 
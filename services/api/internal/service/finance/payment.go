@@ -359,3 +359,60 @@ func (s *Service) ProcessPaymentWebhook(ctx context.Context, tenantID, eventID s
 	return nil
 }
 
+
+// CreateGatewayOrder opens an order with the tenant's active payment gateway for
+// collections that are not tied to a student fee ledger (e.g. admission
+// application fees). receiptID is the caller's internal reference and is echoed
+// back by the gateway in webhook payloads.
+func (s *Service) CreateGatewayOrder(ctx context.Context, tenantID string, amount int64, receiptID string) (string, string, error) {
+	if amount <= 0 {
+		return "", "", fmt.Errorf("amount must be greater than zero")
+	}
+
+	provider, err := s.getTenantPaymentProvider(ctx, tenantID)
+	if err != nil {
+		return "", "", err
+	}
+
+	externalRef, err := provider.CreateOrder(ctx, amount, "INR", receiptID)
+	if err != nil {
+		return "", "", err
+	}
+
+	providerName := "razorpay"
+	if _, ok := provider.(*PayUProvider); ok {
+		providerName = "payu"
+	}
+	return providerName, externalRef, nil
+}
+
+// VerifyGatewayWebhook validates a gateway callback against the tenant's
+// configured secret. It returns true when the event has already been processed
+// and should be ignored by the caller. It does not record the event: the
+// caller logs it with LogPaymentEvent in the same transaction as the update it
+// makes, so a failed update leaves the event free to be retried.
+func (s *Service) VerifyGatewayWebhook(ctx context.Context, tenantID, eventID string, body []byte, signature string, secret string) (bool, error) {
+	provider, err := s.getTenantPaymentProvider(ctx, tenantID)
+	if err != nil {
+		return false, err
+	}
+
+	if _, ok := provider.(*RazorpayProvider); ok {
+		cfg, err := s.q.GetActiveGatewayConfig(ctx, db.GetActiveGatewayConfigParams{
+			TenantID: toPgUUID(tenantID),
+			Provider: "razorpay",
+		})
+		if err == nil && cfg.WebhookSecret.Valid {
+			secret = cfg.WebhookSecret.String
+		}
+	}
+
+	if !provider.VerifyWebhookSignature(body, signature, secret) {
+		return false, fmt.Errorf("invalid webhook signature")
+	}
+
+	return s.q.CheckPaymentEventProcessed(ctx, db.CheckPaymentEventProcessedParams{
+		TenantID:       toPgUUID(tenantID),
+		GatewayEventID: eventID,
+	})
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/schoolerp/api/internal/db"
 	"github.com/schoolerp/api/internal/foundation/approvals"
 	"github.com/schoolerp/api/internal/foundation/audit"
+	"github.com/schoolerp/api/internal/foundation/keyring"
 	"github.com/schoolerp/api/internal/foundation/quota"
 )
 
@@ -22,10 +23,11 @@ type Service struct {
 	audit     *audit.Logger
 	approvals *approvals.Service
 	quota     *quota.Service
+	keys      *keyring.Service
 }
 
-func NewService(q db.Querier, pool *pgxpool.Pool, audit *audit.Logger, approvals *approvals.Service, quotaSvc *quota.Service) *Service {
-	return &Service{q: q, pool: pool, audit: audit, approvals: approvals, quota: quotaSvc}
+func NewService(q db.Querier, pool *pgxpool.Pool, audit *audit.Logger, approvals *approvals.Service, quotaSvc *quota.Service, keys *keyring.Service) *Service {
+	return &Service{q: q, pool: pool, audit: audit, approvals: approvals, quota: quotaSvc, keys: keys}
 }
 
 // ==================== Employees ====================
@@ -75,14 +77,17 @@ func (s *Service) CreateEmployee(ctx context.Context, p CreateEmployeeParams) (d
 		joinDate = pgtype.Date{Time: parsed, Valid: true}
 	}
 
-	// 1. Encrypt Bank Details
-	var encryptedBank string
+	// 1. Encrypt Bank Details. bank_details is JSONB, so the ciphertext is
+	// stored as a JSON string.
+	var encryptedBank []byte
 	if len(p.BankDetails) > 0 {
-		var err error
-		encryptedBank, err = encrypt(p.BankDetails)
+		sealed, err := s.keys.Encrypt(ctx, p.TenantID, p.BankDetails)
 		if err != nil {
 			return db.Employee{}, fmt.Errorf("encryption failed: %w", err)
 		}
+		if encryptedBank, err = json.Marshal(sealed); err != nil {
+			return db.Employee{}, err
+		}
 	}
 
 	return s.q.CreateEmployee(ctx, db.CreateEmployeeParams{
@@ -95,7 +100,7 @@ func (s *Service) CreateEmployee(ctx context.Context, p CreateEmployeeParams) (d
 		Designation:       pgtype.Text{String: p.Designation, Valid: p.Designation != ""},
 		JoinDate:          joinDate,
 		SalaryStructureID: ssID,
-		BankDetails:       []byte(encryptedBank),
+		BankDetails:       encryptedBank,
 		Status:            "active",
 	})
 }
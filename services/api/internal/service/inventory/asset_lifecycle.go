@@ -0,0 +1,579 @@
+package inventory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/schoolerp/api/internal/db"
+)
+
+var (
+	ErrDisposalNotFound     = errors.New("asset disposal not found")
+	ErrDisposalState        = errors.New("asset disposal already decided")
+	ErrVerificationNotFound = errors.New("asset verification not found")
+	ErrVerificationState    = errors.New("asset verification cannot change in its current status")
+)
+
+// Depreciation
+
+type DepreciationRun struct {
+	FinancialYear int                `json:"financial_year"`
+	Assets        int                `json:"assets"`
+	Posted        []DepreciationPost `json:"posted"`
+	Total         float64            `json:"total"`
+}
+
+type DepreciationPost struct {
+	AssetID       pgtype.UUID `json:"asset_id"`
+	AssetTag      string      `json:"asset_tag"`
+	FinancialYear int         `json:"financial_year"`
+	Amount        float64     `json:"amount"`
+	ClosingValue  float64     `json:"closing_value"`
+}
+
+// PostDepreciation charges depreciation for a financial year on every asset
+// held, along with any earlier years not yet posted for it. Years already
+// posted are left alone, so a run can be repeated.
+func (s *AssetService) PostDepreciation(ctx context.Context, tenantID, year string, actor Actor) (DepreciationRun, error) {
+	fy, err := financialYearOf(year)
+	if err != nil {
+		return DepreciationRun{}, err
+	}
+	tid := toPgUUID(tenantID)
+	today, err := s.today(ctx, tid)
+	if err != nil {
+		return DepreciationRun{}, err
+	}
+	if fy > financialYear(today) {
+		return DepreciationRun{}, fmt.Errorf("%w: financial year %d has not started", ErrInvalidAsset, fy)
+	}
+	run := DepreciationRun{FinancialYear: fy, Posted: []DepreciationPost{}}
+	var total int64
+	err = s.stock.inTx(ctx, func(q *db.Queries) error {
+		assets, err := q.ListDepreciableFixedAssets(ctx, tid, pgDate(financialYearEnd(fy)))
+		if err != nil {
+			return err
+		}
+		run.Assets = len(assets)
+		for _, a := range assets {
+			for _, p := range depreciationSchedule(policyOf(a), financialYearEnd(fy)) {
+				ok, err := q.CreateFixedAssetDepreciation(ctx, db.CreateFixedAssetDepreciationParams{
+					TenantID:      tid,
+					AssetID:       a.ID,
+					FinancialYear: int32(p.FinancialYear),
+					PeriodStart:   pgDate(p.Start),
+					PeriodEnd:     pgDate(p.End),
+					OpeningValue:  p.Opening,
+					Amount:        p.Amount,
+					ClosingValue:  p.Closing,
+					PostedBy:      toPgUUID(actor.UserID),
+				})
+				if err != nil {
+					return fmt.Errorf("%s: %w", a.AssetTag, err)
+				}
+				if ok {
+					total += p.Amount
+					run.Posted = append(run.Posted, DepreciationPost{
+						AssetID: a.ID, AssetTag: a.AssetTag, FinancialYear: p.FinancialYear,
+						Amount: rupees(p.Amount), ClosingValue: rupees(p.Closing),
+					})
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return DepreciationRun{}, err
+	}
+	run.Total = rupees(total)
+	s.stock.log(ctx, tid, actor, "inventory.post_depreciation", "fixed_asset_depreciation", tid, map[string]any{
+		"financial_year": fy, "entries": len(run.Posted), "total": run.Total,
+	})
+	return run, nil
+}
+
+type DepreciationRegister struct {
+	FinancialYear int                         `json:"financial_year"`
+	Entries       []DepreciationRegisterEntry `json:"entries"`
+	Opening       float64                     `json:"opening_value"`
+	Total         float64                     `json:"total"`
+	Closing       float64                     `json:"closing_value"`
+}
+
+type DepreciationRegisterEntry struct {
+	AssetID      pgtype.UUID `json:"asset_id"`
+	AssetTag     string      `json:"asset_tag"`
+	AssetName    string      `json:"asset_name"`
+	PeriodStart  pgtype.Date `json:"period_start"`
+	PeriodEnd    pgtype.Date `json:"period_end"`
+	OpeningValue float64     `json:"opening_value"`
+	Amount       float64     `json:"amount"`
+	ClosingValue float64     `json:"closing_value"`
+}
+
+// DepreciationRegister is what was posted for a financial year.
+func (s *AssetService) DepreciationRegister(ctx context.Context, tenantID, year string) (DepreciationRegister, error) {
+	fy, err := financialYearOf(year)
+	if err != nil {
+		return DepreciationRegister{}, err
+	}
+	rows, err := s.q.ListFixedAssetDepreciationForYear(ctx, toPgUUID(tenantID), int32(fy))
+	if err != nil {
+		return DepreciationRegister{}, err
+	}
+	reg := DepreciationRegister{FinancialYear: fy, Entries: make([]DepreciationRegisterEntry, 0, len(rows))}
+	var opening, total, closing int64
+	for _, d := range rows {
+		opening, total, closing = opening+d.OpeningValue, total+d.Amount, closing+d.ClosingValue
+		reg.Entries = append(reg.Entries, DepreciationRegisterEntry{
+			AssetID: d.AssetID, AssetTag: d.AssetTag, AssetName: d.AssetName, PeriodStart: d.PeriodStart,
+			PeriodEnd: d.PeriodEnd, OpeningValue: rupees(d.OpeningValue), Amount: rupees(d.Amount),
+			ClosingValue: rupees(d.ClosingValue),
+		})
+	}
+	reg.Opening, reg.Total, reg.Closing = rupees(opening), rupees(total), rupees(closing)
+	return reg, nil
+}
+
+// Disposal
+
+type AssetDisposal struct {
+	ID                pgtype.UUID        `json:"id"`
+	AssetID           pgtype.UUID        `json:"asset_id"`
+	AssetTag          string             `json:"asset_tag"`
+	AssetName         string             `json:"asset_name"`
+	Method            string             `json:"method"`
+	DisposalDate      pgtype.Date        `json:"disposal_date"`
+	Proceeds          float64            `json:"proceeds"`
+	BookValue         float64            `json:"book_value"`
+	GainOrLoss        float64            `json:"gain_or_loss"`
+	Reason            string             `json:"reason"`
+	Status            string             `json:"status"`
+	ApprovalRequestID pgtype.UUID        `json:"approval_request_id"`
+	RequestedBy       pgtype.UUID        `json:"requested_by"`
+	RequestedAt       pgtype.Timestamptz `json:"requested_at"`
+	DecidedBy         pgtype.UUID        `json:"decided_by"`
+	DecidedAt         pgtype.Timestamptz `json:"decided_at"`
+	Remark            pgtype.Text        `json:"remark"`
+}
+
+func disposalView(d db.FixedAssetDisposal) AssetDisposal {
+	return AssetDisposal{
+		ID: d.ID, AssetID: d.AssetID, AssetTag: d.AssetTag, AssetName: d.AssetName, Method: d.Method,
+		DisposalDate: d.DisposalDate, Proceeds: rupees(d.Proceeds), BookValue: rupees(d.BookValue),
+		GainOrLoss: rupees(d.Proceeds - d.BookValue), Reason: d.Reason, Status: d.Status,
+		ApprovalRequestID: d.ApprovalRequestID, RequestedBy: d.RequestedBy, RequestedAt: d.RequestedAt,
+		DecidedBy: d.DecidedBy, DecidedAt: d.DecidedAt, Remark: d.Remark,
+	}
+}
+
+type DisposalInput struct {
+	Method       string
+	DisposalDate string
+	Proceeds     float64
+	Reason       string
+}
+
+// RequestDisposal asks for an asset to be sold, scrapped, donated or
+// written off. The request goes to the approvals inbox; the asset stays on
+// the register until it is approved.
+func (s *AssetService) RequestDisposal(ctx context.Context, tenantID, assetID string, in DisposalInput, actor Actor) (AssetDisposal, error) {
+	if s.approvals == nil {
+		return AssetDisposal{}, errors.New("approval workflow is not configured")
+	}
+	switch in.Method {
+	case "sale", "scrap", "donation", "write_off":
+	default:
+		return AssetDisposal{}, fmt.Errorf("%w: method must be sale, scrap, donation or write_off", ErrInvalidAsset)
+	}
+	reason := strings.TrimSpace(in.Reason)
+	if reason == "" {
+		return AssetDisposal{}, fmt.Errorf("%w: a reason is required", ErrInvalidAsset)
+	}
+	if in.Proceeds < 0 || (in.Method != "sale" && in.Method != "scrap" && in.Proceeds > 0) {
+		return AssetDisposal{}, fmt.Errorf("%w: only a sale or scrap has proceeds", ErrInvalidAsset)
+	}
+	tid, id := toPgUUID(tenantID), toPgUUID(assetID)
+	today, err := s.today(ctx, tid)
+	if err != nil {
+		return AssetDisposal{}, err
+	}
+	on := today
+	if in.DisposalDate != "" {
+		if on, err = parseAssetDate("disposal_date", in.DisposalDate); err != nil {
+			return AssetDisposal{}, err
+		}
+	}
+	if on.After(today) {
+		return AssetDisposal{}, fmt.Errorf("%w: disposal_date is in the future", ErrInvalidAsset)
+	}
+
+	var disposalID pgtype.UUID
+	err = s.stock.inTx(ctx, func(q *db.Queries) error {
+		a, err := q.LockFixedAsset(ctx, tid, id)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrAssetNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if a.Status == assetDisposed {
+			return fmt.Errorf("%w: %s has been disposed of", ErrAssetState, a.AssetTag)
+		}
+		if on.Before(a.PurchaseDate.Time) {
+			return fmt.Errorf("%w: disposal_date is before the asset was bought", ErrInvalidAsset)
+		}
+		book := bookValueOn(policyOf(a), on)
+		req, err := s.approvals.CreateRequest(ctx, tenantID, actor.UserID, "inventory", "asset_disposal", assetID, map[string]any{
+			"asset_id":   assetID,
+			"asset_tag":  a.AssetTag,
+			"asset_name": a.Name,
+			"method":     in.Method,
+			"date":       on.Format("2006-01-02"),
+			"proceeds":   in.Proceeds,
+			"book_value": rupees(book),
+			"reason":     reason,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create approval request: %w", err)
+		}
+		disposalID, err = q.CreateFixedAssetDisposal(ctx, db.CreateFixedAssetDisposalParams{
+			TenantID:          tid,
+			AssetID:           a.ID,
+			Method:            in.Method,
+			DisposalDate:      pgDate(on),
+			Proceeds:          paise(in.Proceeds),
+			BookValue:         book,
+			Reason:            reason,
+			ApprovalRequestID: req.ID,
+			RequestedBy:       toPgUUID(actor.UserID),
+		})
+		if isUniqueViolation(err) {
+			return fmt.Errorf("%w: %s already has a disposal awaiting approval", ErrAssetState, a.AssetTag)
+		}
+		return err
+	})
+	if err != nil {
+		return AssetDisposal{}, err
+	}
+	d, err := s.q.GetFixedAssetDisposal(ctx, tid, disposalID)
+	if err != nil {
+		return AssetDisposal{}, err
+	}
+	s.stock.log(ctx, tid, actor, "inventory.request_asset_disposal", "fixed_asset", id, d)
+	return disposalView(d), nil
+}
+
+// DecideDisposal approves or rejects a pending disposal. A decision
+// already taken in the approvals inbox is applied as it stands. An
+// approved disposal takes the asset off the register at its book value on
+// the disposal date.
+func (s *AssetService) DecideDisposal(ctx context.Context, tenantID, disposalID string, approve bool, remark string, actor Actor) (AssetDisposal, error) {
+	if s.approvals == nil {
+		return AssetDisposal{}, errors.New("approval workflow is not configured")
+	}
+	decision := "rejected"
+	if approve {
+		decision = "approved"
+	}
+	tid, did := toPgUUID(tenantID), toPgUUID(disposalID)
+	err := s.stock.inTx(ctx, func(q *db.Queries) error {
+		d, err := q.LockFixedAssetDisposal(ctx, tid, did)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrDisposalNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if d.Status != "pending" {
+			return fmt.Errorf("%w: it was %s", ErrDisposalState, d.Status)
+		}
+		req, err := q.GetApprovalRequest(ctx, d.ApprovalRequestID)
+		if err != nil {
+			return fmt.Errorf("failed to load approval request: %w", err)
+		}
+		if req.TenantID != tid {
+			return ErrDisposalNotFound
+		}
+		switch req.Status.String {
+		case "pending":
+			if approve && req.RequesterID == toPgUUID(actor.UserID) {
+				return fmt.Errorf("%w: a disposal cannot be approved by the person who asked for it", ErrAssetState)
+			}
+			if _, err := s.approvals.ProcessRequest(ctx, req.ID.String(), decision, strings.TrimSpace(remark)); err != nil {
+				return fmt.Errorf("failed to record decision: %w", err)
+			}
+		case decision:
+		default:
+			return fmt.Errorf("%w: the request was already %s", ErrDisposalState, req.Status.String)
+		}
+
+		book := d.BookValue
+		if approve {
+			a, err := q.LockFixedAsset(ctx, tid, d.AssetID)
+			if err != nil {
+				return err
+			}
+			if a.Status == assetDisposed {
+				return fmt.Errorf("%w: %s has already been disposed of", ErrAssetState, a.AssetTag)
+			}
+			book = bookValueOn(policyOf(a), d.DisposalDate.Time)
+			if err := s.move(ctx, q, a, a.Room, pgtype.UUID{}, assetDisposed, "Disposed by "+strings.ReplaceAll(d.Method, "_", "-"), actor); err != nil {
+				return err
+			}
+			if err := q.SetFixedAssetDisposed(ctx, a.ID, d.DisposalDate); err != nil {
+				return err
+			}
+		}
+		return q.SettleFixedAssetDisposal(ctx, d.ID, decision, book, toPgUUID(actor.UserID), optionalText(remark))
+	})
+	if err != nil {
+		return AssetDisposal{}, err
+	}
+	d, err := s.q.GetFixedAssetDisposal(ctx, tid, did)
+	if err != nil {
+		return AssetDisposal{}, err
+	}
+	action := "inventory.reject_asset_disposal"
+	if approve {
+		action = "inventory.approve_asset_disposal"
+	}
+	s.stock.log(ctx, tid, actor, action, "fixed_asset", d.AssetID, d)
+	return disposalView(d), nil
+}
+
+func (s *AssetService) ListDisposals(ctx context.Context, tenantID, status string) ([]AssetDisposal, error) {
+	disposals, err := s.q.ListFixedAssetDisposals(ctx, toPgUUID(tenantID), optionalText(status))
+	if err != nil {
+		return nil, err
+	}
+	out := make([]AssetDisposal, 0, len(disposals))
+	for _, d := range disposals {
+		out = append(out, disposalView(d))
+	}
+	return out, nil
+}
+
+// Physical verification
+
+type VerificationDetail struct {
+	db.FixedAssetVerification
+	Items []db.FixedAssetVerificationItem `json:"items"`
+}
+
+// StartVerification opens the year's physical verification with every
+// asset still held on its list. There is one round per financial year;
+// an empty year means the current one.
+func (s *AssetService) StartVerification(ctx context.Context, tenantID, year, title, notes string, actor Actor) (VerificationDetail, error) {
+	tid := toPgUUID(tenantID)
+	today, err := s.today(ctx, tid)
+	if err != nil {
+		return VerificationDetail{}, err
+	}
+	fy := financialYear(today)
+	if year != "" {
+		if fy, err = financialYearOf(year); err != nil {
+			return VerificationDetail{}, err
+		}
+	}
+	if fy > financialYear(today) {
+		return VerificationDetail{}, fmt.Errorf("%w: financial year %d has not started", ErrInvalidAsset, fy)
+	}
+	title = strings.TrimSpace(title)
+	if title == "" {
+		title = fmt.Sprintf("Physical verification %d-%02d", fy, (fy+1)%100)
+	}
+	var id pgtype.UUID
+	err = s.stock.inTx(ctx, func(q *db.Queries) error {
+		id, err = q.CreateFixedAssetVerification(ctx, tid, int32(fy), title, optionalText(notes), toPgUUID(actor.UserID))
+		if isUniqueViolation(err) {
+			return fmt.Errorf("%w: verification for %d-%02d has already been started", ErrVerificationState, fy, (fy+1)%100)
+		}
+		return err
+	})
+	if err != nil {
+		return VerificationDetail{}, err
+	}
+	s.stock.log(ctx, tid, actor, "inventory.start_asset_verification", "fixed_asset_verification", id, map[string]any{
+		"financial_year": fy, "title": title,
+	})
+	return s.GetVerification(ctx, tenantID, id.String())
+}
+
+func (s *AssetService) GetVerification(ctx context.Context, tenantID, verificationID string) (VerificationDetail, error) {
+	v, err := s.q.GetFixedAssetVerification(ctx, toPgUUID(tenantID), toPgUUID(verificationID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return VerificationDetail{}, ErrVerificationNotFound
+	}
+	if err != nil {
+		return VerificationDetail{}, err
+	}
+	items, err := s.q.ListFixedAssetVerificationItems(ctx, v.ID)
+	if err != nil {
+		return VerificationDetail{}, err
+	}
+	if items == nil {
+		items = []db.FixedAssetVerificationItem{}
+	}
+	return VerificationDetail{FixedAssetVerification: v, Items: items}, nil
+}
+
+func (s *AssetService) ListVerifications(ctx context.Context, tenantID string) ([]db.FixedAssetVerification, error) {
+	out, err := s.q.ListFixedAssetVerifications(ctx, toPgUUID(tenantID))
+	if out == nil {
+		out = []db.FixedAssetVerification{}
+	}
+	return out, err
+}
+
+// VerificationLine is one asset checked, identified by its id or by the tag
+// read off its label.
+type VerificationLine struct {
+	AssetID   string
+	AssetTag  string
+	Result    string
+	FoundRoom string
+	Remarks   string
+}
+
+// RecordVerification records what was found; an asset can be recorded
+// again until the round is closed.
+func (s *AssetService) RecordVerification(ctx context.Context, tenantID, verificationID string, lines []VerificationLine, actor Actor) (VerificationDetail, error) {
+	if len(lines) == 0 {
+		return VerificationDetail{}, fmt.Errorf("%w: nothing to record", ErrInvalidAsset)
+	}
+	tid, vid := toPgUUID(tenantID), toPgUUID(verificationID)
+	err := s.stock.inTx(ctx, func(q *db.Queries) error {
+		v, err := q.LockFixedAssetVerification(ctx, tid, vid)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrVerificationNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if v.Status != "open" {
+			return fmt.Errorf("%w: %s is closed", ErrVerificationState, v.Title)
+		}
+		for _, l := range lines {
+			if l.Result != "found" && l.Result != "damaged" && l.Result != "missing" {
+				return fmt.Errorf("%w: result must be found, damaged or missing", ErrInvalidAsset)
+			}
+			assetID := toPgUUID(l.AssetID)
+			label := l.AssetID
+			if !assetID.Valid {
+				label = strings.TrimSpace(l.AssetTag)
+				a, err := q.GetFixedAssetByTag(ctx, tid, label)
+				if errors.Is(err, pgx.ErrNoRows) {
+					return fmt.Errorf("%w: no asset tagged %s", ErrAssetNotFound, label)
+				}
+				if err != nil {
+					return err
+				}
+				assetID = a.ID
+			}
+			err := q.RecordFixedAssetVerification(ctx, v.ID, assetID, l.Result, optionalText(l.FoundRoom), optionalText(l.Remarks), toPgUUID(actor.UserID))
+			if errors.Is(err, pgx.ErrNoRows) {
+				return fmt.Errorf("%w: %s is not on this verification", ErrInvalidAsset, label)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return VerificationDetail{}, err
+	}
+	return s.GetVerification(ctx, tenantID, verificationID)
+}
+
+// CloseVerification ends the round. Assets not checked are taken as
+// missing. The register is brought in line with what was found: assets
+// found elsewhere are moved there, damaged ones go for repair, missing ones
+// are marked missing and ones that turn up again go back in use.
+func (s *AssetService) CloseVerification(ctx context.Context, tenantID, verificationID string, actor Actor) (VerificationDetail, error) {
+	tid, vid := toPgUUID(tenantID), toPgUUID(verificationID)
+	today, err := s.today(ctx, tid)
+	if err != nil {
+		return VerificationDetail{}, err
+	}
+	err = s.stock.inTx(ctx, func(q *db.Queries) error {
+		v, err := q.LockFixedAssetVerification(ctx, tid, vid)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrVerificationNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if v.Status != "open" {
+			return fmt.Errorf("%w: %s is already closed", ErrVerificationState, v.Title)
+		}
+		if err := q.CloseFixedAssetVerification(ctx, v.ID, toPgUUID(actor.UserID)); err != nil {
+			return err
+		}
+		items, err := q.ListFixedAssetVerificationItems(ctx, v.ID)
+		if err != nil {
+			return err
+		}
+		for _, it := range items {
+			a, err := q.LockFixedAsset(ctx, tid, it.AssetID)
+			if err != nil {
+				return err
+			}
+			if a.Status == assetDisposed {
+				continue
+			}
+			room, status := a.Room, a.Status
+			switch it.Result {
+			case "found", "damaged":
+				if err := q.SetFixedAssetVerified(ctx, a.ID, pgDate(today)); err != nil {
+					return err
+				}
+				if it.FoundRoom.Valid {
+					room = it.FoundRoom
+				}
+				if it.Result == "damaged" {
+					status = assetUnderRepair
+				} else if status == assetMissing {
+					status = assetInUse
+				}
+			case "missing":
+				status = assetMissing
+			}
+			if strings.EqualFold(room.String, a.Room.String) && status == a.Status {
+				continue
+			}
+			reason := fmt.Sprintf("%s: %s", v.Title, it.Result)
+			if err := s.move(ctx, q, a, room, a.CustodianID, status, reason, actor); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return VerificationDetail{}, err
+	}
+	detail, err := s.GetVerification(ctx, tenantID, verificationID)
+	if err == nil {
+		s.stock.log(ctx, tid, actor, "inventory.close_asset_verification", "fixed_asset_verification", vid, detail.FixedAssetVerification)
+	}
+	return detail, err
+}
+
+// financialYearOf reads a financial year given as its starting year
+// ("2025") or in the usual form ("2025-26").
+func financialYearOf(v string) (int, error) {
+	v = strings.TrimSpace(v)
+	var fy, next int
+	if n, _ := fmt.Sscanf(v, "%d-%d", &fy, &next); n == 2 && fy >= 1900 && (next == (fy+1)%100 || next == fy+1) {
+		return fy, nil
+	}
+	if n, err := fmt.Sscanf(v, "%d", &fy); n == 1 && err == nil && len(v) == 4 && fy >= 1900 {
+		return fy, nil
+	}
+	return 0, fmt.Errorf("%w: financial_year must look like 2025 or 2025-26", ErrInvalidAsset)
+}
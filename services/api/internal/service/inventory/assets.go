@@ -0,0 +1,740 @@
+package inventory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/schoolerp/api/internal/db"
+	"github.com/schoolerp/api/internal/foundation/approvals"
+)
+
+var (
+	ErrInvalidAsset      = errors.New("invalid asset request")
+	ErrAssetNotFound     = errors.New("asset not found")
+	ErrAssetState        = errors.New("asset cannot change in its current status")
+	ErrDuplicateAssetTag = errors.New("asset tag already in use")
+)
+
+const (
+	assetInUse       = "in_use"
+	assetInStore     = "in_store"
+	assetUnderRepair = "under_repair"
+	assetMissing     = "missing"
+	assetDisposed    = "disposed"
+
+	// wdvProjectionYears is how far ahead a WDV schedule is shown, as it
+	// never quite reaches the residual value.
+	wdvProjectionYears = 10
+)
+
+// AssetService keeps the fixed asset register: tagged assets against
+// inventory items in asset categories, where they are and who holds them,
+// their warranties, depreciation, disposal and yearly verification.
+type AssetService struct {
+	q         *db.Queries
+	stock     *StockService
+	approvals *approvals.Service
+}
+
+func NewAssetService(q *db.Queries, stock *StockService, approvals *approvals.Service) *AssetService {
+	return &AssetService{q: q, stock: stock, approvals: approvals}
+}
+
+// today is the current date at the school.
+func (s *AssetService) today(ctx context.Context, tid pgtype.UUID) (time.Time, error) {
+	tz, err := s.q.GetSchoolTimezone(ctx, tid)
+	if err != nil {
+		return time.Time{}, err
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		loc = time.UTC
+	}
+	now := time.Now().In(loc)
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC), nil
+}
+
+func parseAssetDate(field, v string) (time.Time, error) {
+	d, err := time.Parse("2006-01-02", strings.TrimSpace(v))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %s must be a date (YYYY-MM-DD)", ErrInvalidAsset, field)
+	}
+	return d, nil
+}
+
+func pgDate(t time.Time) pgtype.Date {
+	return pgtype.Date{Time: t, Valid: true}
+}
+
+// Item asset profiles
+
+// AssetProfile is how assets registered against an item depreciate unless
+// they say otherwise.
+type AssetProfile struct {
+	DepreciationMethod  string  `json:"depreciation_method"`
+	UsefulLifeMonths    int32   `json:"useful_life_months,omitempty"`
+	DepreciationRatePct float64 `json:"depreciation_rate_pct,omitempty"`
+	ResidualPct         float64 `json:"residual_pct"`
+}
+
+// defaultAssetProfile is five years straight line down to 5% of cost.
+func defaultAssetProfile() AssetProfile {
+	return AssetProfile{DepreciationMethod: DepreciationStraightLine, UsefulLifeMonths: 60, ResidualPct: 5}
+}
+
+func (p AssetProfile) validate() error {
+	switch p.DepreciationMethod {
+	case DepreciationStraightLine:
+		if p.UsefulLifeMonths <= 0 {
+			return fmt.Errorf("%w: straight-line depreciation needs a useful life in months", ErrInvalidAsset)
+		}
+	case DepreciationWDV:
+		if p.DepreciationRatePct <= 0 || p.DepreciationRatePct >= 100 {
+			return fmt.Errorf("%w: WDV depreciation needs a rate between 0 and 100", ErrInvalidAsset)
+		}
+	default:
+		return fmt.Errorf("%w: depreciation_method must be straight_line or wdv", ErrInvalidAsset)
+	}
+	if p.UsefulLifeMonths < 0 || p.ResidualPct < 0 || p.ResidualPct >= 100 {
+		return fmt.Errorf("%w: residual_pct must be from 0 to under 100", ErrInvalidAsset)
+	}
+	return nil
+}
+
+// applyAssetProfile sets the profile on an item in an asset category, the
+// default one when p is nil. Items in other categories take no profile.
+func applyAssetProfile(ctx context.Context, q *db.Queries, tid, itemID pgtype.UUID, p *AssetProfile) (*AssetProfile, error) {
+	item, err := q.GetInventoryItemAssetProfile(ctx, tid, itemID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrItemNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if item.CategoryType.String != "asset" {
+		if p != nil {
+			return nil, fmt.Errorf("%w: %s is not in an asset category", ErrInvalidAsset, item.ItemName)
+		}
+		return nil, nil
+	}
+	profile := defaultAssetProfile()
+	if p != nil {
+		profile = *p
+	}
+	if err := profile.validate(); err != nil {
+		return nil, err
+	}
+	err = q.SetInventoryItemAssetProfile(ctx, db.SetInventoryItemAssetProfileParams{
+		TenantID:            tid,
+		ItemID:              itemID,
+		DepreciationMethod:  profile.DepreciationMethod,
+		UsefulLifeMonths:    pgtype.Int4{Int32: profile.UsefulLifeMonths, Valid: profile.UsefulLifeMonths > 0},
+		DepreciationRatePct: pgtype.Float8{Float64: profile.DepreciationRatePct, Valid: profile.DepreciationRatePct > 0},
+		ResidualPct:         profile.ResidualPct,
+	})
+	return &profile, err
+}
+
+func (s *AssetService) SetItemProfile(ctx context.Context, tenantID, itemID string, p AssetProfile, actor Actor) (AssetProfile, error) {
+	tid, iid := toPgUUID(tenantID), toPgUUID(itemID)
+	var saved *AssetProfile
+	err := s.stock.inTx(ctx, func(q *db.Queries) error {
+		var err error
+		saved, err = applyAssetProfile(ctx, q, tid, iid, &p)
+		return err
+	})
+	if err != nil {
+		return AssetProfile{}, err
+	}
+	s.stock.log(ctx, tid, actor, "inventory.set_asset_profile", "inventory_item", iid, saved)
+	return *saved, nil
+}
+
+// Register
+
+type Asset struct {
+	ID                      pgtype.UUID        `json:"id"`
+	ItemID                  pgtype.UUID        `json:"item_id"`
+	ItemName                string             `json:"item_name"`
+	AssetTag                string             `json:"asset_tag"`
+	Name                    string             `json:"name"`
+	SerialNumber            pgtype.Text        `json:"serial_number"`
+	Description             pgtype.Text        `json:"description"`
+	Room                    pgtype.Text        `json:"room"`
+	CustodianID             pgtype.UUID        `json:"custodian_id"`
+	CustodianName           pgtype.Text        `json:"custodian_name"`
+	SupplierID              pgtype.UUID        `json:"supplier_id"`
+	POID                    pgtype.UUID        `json:"po_id"`
+	PurchaseDate            pgtype.Date        `json:"purchase_date"`
+	InServiceDate           pgtype.Date        `json:"in_service_date"`
+	Cost                    float64            `json:"cost"`
+	ResidualValue           float64            `json:"residual_value"`
+	DepreciationMethod      string             `json:"depreciation_method"`
+	UsefulLifeMonths        pgtype.Int4        `json:"useful_life_months"`
+	DepreciationRatePct     pgtype.Float8      `json:"depreciation_rate_pct"`
+	AccumulatedDepreciation float64            `json:"accumulated_depreciation"`
+	BookValue               float64            `json:"book_value"`
+	Status                  string             `json:"status"`
+	LastVerifiedOn          pgtype.Date        `json:"last_verified_on"`
+	DisposedOn              pgtype.Date        `json:"disposed_on"`
+	WarrantyEndsOn          pgtype.Date        `json:"warranty_ends_on"`
+	AmcEndsOn               pgtype.Date        `json:"amc_ends_on"`
+	CreatedAt               pgtype.Timestamptz `json:"created_at"`
+}
+
+func assetView(a db.FixedAsset) Asset {
+	return Asset{
+		ID: a.ID, ItemID: a.ItemID, ItemName: a.ItemName, AssetTag: a.AssetTag, Name: a.Name,
+		SerialNumber: a.SerialNumber, Description: a.Description, Room: a.Room, CustodianID: a.CustodianID,
+		CustodianName: a.CustodianName, SupplierID: a.SupplierID, POID: a.PoID, PurchaseDate: a.PurchaseDate,
+		InServiceDate: a.InServiceDate, Cost: rupees(a.Cost), ResidualValue: rupees(a.ResidualValue),
+		DepreciationMethod: a.DepreciationMethod, UsefulLifeMonths: a.UsefulLifeMonths,
+		DepreciationRatePct: a.DepreciationRatePct, AccumulatedDepreciation: rupees(a.AccumulatedDepreciation),
+		BookValue: rupees(a.Cost - a.AccumulatedDepreciation), Status: a.Status, LastVerifiedOn: a.LastVerifiedOn,
+		DisposedOn: a.DisposedOn, WarrantyEndsOn: a.WarrantyEndsOn, AmcEndsOn: a.AmcEndsOn, CreatedAt: a.CreatedAt,
+	}
+}
+
+func policyOf(a db.FixedAsset) depreciationPolicy {
+	return depreciationPolicy{
+		Method:     a.DepreciationMethod,
+		Cost:       a.Cost,
+		Residual:   a.ResidualValue,
+		LifeMonths: a.UsefulLifeMonths.Int32,
+		RatePct:    a.DepreciationRatePct.Float64,
+		InService:  a.InServiceDate.Time,
+	}
+}
+
+// AssetInput registers one asset, or Quantity alike ones, against an item.
+// Depreciation fields left empty come from the item's asset profile.
+type AssetInput struct {
+	ItemID        string
+	Name          string
+	AssetTag      string
+	SerialNumbers []string
+	Quantity      int32
+	Description   string
+	Room          string
+	CustodianID   string
+	SupplierID    string
+	POID          string
+	PurchaseDate  string
+	InServiceDate string
+	Cost          float64
+	// ResidualValue is per asset; nil takes the item's residual percentage.
+	ResidualValue       *float64
+	DepreciationMethod  string
+	UsefulLifeMonths    int32
+	DepreciationRatePct float64
+	Status              string
+}
+
+func (s *AssetService) RegisterAssets(ctx context.Context, tenantID string, in AssetInput, actor Actor) ([]Asset, error) {
+	quantity := in.Quantity
+	if len(in.SerialNumbers) > 0 {
+		if quantity != 0 && int(quantity) != len(in.SerialNumbers) {
+			return nil, fmt.Errorf("%w: quantity does not match the serial numbers given", ErrInvalidAsset)
+		}
+		quantity = int32(len(in.SerialNumbers))
+	}
+	if quantity == 0 {
+		quantity = 1
+	}
+	switch {
+	case quantity < 0 || quantity > 500:
+		return nil, fmt.Errorf("%w: quantity must be between 1 and 500", ErrInvalidAsset)
+	case in.AssetTag != "" && quantity > 1:
+		return nil, fmt.Errorf("%w: an asset tag can only be given when registering one asset", ErrInvalidAsset)
+	case in.Cost < 0:
+		return nil, fmt.Errorf("%w: cost cannot be negative", ErrInvalidAsset)
+	}
+	status := in.Status
+	if status == "" {
+		status = assetInUse
+	}
+	if status != assetInUse && status != assetInStore {
+		return nil, fmt.Errorf("%w: new assets are in_use or in_store", ErrInvalidAsset)
+	}
+	purchased, err := parseAssetDate("purchase_date", in.PurchaseDate)
+	if err != nil {
+		return nil, err
+	}
+	inService := purchased
+	if in.InServiceDate != "" {
+		if inService, err = parseAssetDate("in_service_date", in.InServiceDate); err != nil {
+			return nil, err
+		}
+		if inService.Before(purchased) {
+			return nil, fmt.Errorf("%w: in_service_date is before purchase_date", ErrInvalidAsset)
+		}
+	}
+
+	tid := toPgUUID(tenantID)
+	var ids []pgtype.UUID
+	err = s.stock.inTx(ctx, func(q *db.Queries) error {
+		item, err := q.GetInventoryItemAssetProfile(ctx, tid, toPgUUID(in.ItemID))
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrItemNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if item.CategoryType.String != "asset" {
+			return fmt.Errorf("%w: %s is not in an asset category", ErrInvalidAsset, item.ItemName)
+		}
+		profile := defaultAssetProfile()
+		if item.DepreciationMethod.Valid {
+			profile = AssetProfile{
+				DepreciationMethod:  item.DepreciationMethod.String,
+				UsefulLifeMonths:    item.UsefulLifeMonths.Int32,
+				DepreciationRatePct: item.DepreciationRatePct.Float64,
+				ResidualPct:         item.ResidualPct.Float64,
+			}
+		}
+		if in.DepreciationMethod != "" {
+			profile.DepreciationMethod = in.DepreciationMethod
+		}
+		if in.UsefulLifeMonths != 0 {
+			profile.UsefulLifeMonths = in.UsefulLifeMonths
+		}
+		if in.DepreciationRatePct != 0 {
+			profile.DepreciationRatePct = in.DepreciationRatePct
+		}
+		if err := profile.validate(); err != nil {
+			return err
+		}
+
+		cost := paise(in.Cost)
+		residual := int64(float64(cost) * profile.ResidualPct / 100)
+		if in.ResidualValue != nil {
+			residual = paise(*in.ResidualValue)
+		}
+		if residual < 0 || residual > cost {
+			return fmt.Errorf("%w: residual value must be between zero and the cost", ErrInvalidAsset)
+		}
+
+		custodian := toPgUUID(in.CustodianID)
+		if custodian.Valid {
+			ok, err := q.EmployeeExists(ctx, tid, custodian)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return fmt.Errorf("%w: custodian is not a staff member", ErrInvalidAsset)
+			}
+		}
+		supplier := toPgUUID(in.SupplierID)
+		if supplier.Valid {
+			ok, err := q.InventorySupplierExists(ctx, tid, supplier)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return fmt.Errorf("%w: supplier", ErrInvalidAsset)
+			}
+		}
+		po := toPgUUID(in.POID)
+		if po.Valid {
+			if _, err := q.GetProcurementOrder(ctx, tid, po); errors.Is(err, pgx.ErrNoRows) {
+				return ErrPurchaseOrderNotFound
+			} else if err != nil {
+				return err
+			}
+		}
+
+		name := strings.TrimSpace(in.Name)
+		if name == "" {
+			name = item.ItemName
+		}
+		for i := int32(0); i < quantity; i++ {
+			tag := strings.TrimSpace(in.AssetTag)
+			if tag == "" {
+				if tag, err = q.NextFixedAssetTag(ctx, tid); err != nil {
+					return err
+				}
+			}
+			var serial string
+			if len(in.SerialNumbers) > 0 {
+				serial = in.SerialNumbers[i]
+			}
+			id, err := q.CreateFixedAsset(ctx, db.CreateFixedAssetParams{
+				TenantID:            tid,
+				ItemID:              item.ItemID,
+				AssetTag:            tag,
+				Name:                name,
+				SerialNumber:        optionalText(serial),
+				Description:         optionalText(in.Description),
+				Room:                optionalText(in.Room),
+				CustodianID:         custodian,
+				SupplierID:          supplier,
+				PoID:                po,
+				PurchaseDate:        pgDate(purchased),
+				InServiceDate:       pgDate(inService),
+				Cost:                cost,
+				ResidualValue:       residual,
+				DepreciationMethod:  profile.DepreciationMethod,
+				UsefulLifeMonths:    pgtype.Int4{Int32: profile.UsefulLifeMonths, Valid: profile.UsefulLifeMonths > 0},
+				DepreciationRatePct: pgtype.Float8{Float64: profile.DepreciationRatePct, Valid: profile.DepreciationRatePct > 0},
+				Status:              status,
+				CreatedBy:           toPgUUID(actor.UserID),
+			})
+			if isUniqueViolation(err) {
+				return fmt.Errorf("%w: %s", ErrDuplicateAssetTag, tag)
+			}
+			if err != nil {
+				return err
+			}
+			if err := q.CreateFixedAssetMovement(ctx, db.CreateFixedAssetMovementParams{
+				TenantID:      tid,
+				AssetID:       id,
+				ToRoom:        optionalText(in.Room),
+				ToCustodianID: custodian,
+				ToStatus:      status,
+				Reason:        optionalText("Registered"),
+				MovedBy:       toPgUUID(actor.UserID),
+			}); err != nil {
+				return err
+			}
+			ids = append(ids, id)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]Asset, 0, len(ids))
+	for _, id := range ids {
+		a, err := s.q.GetFixedAsset(ctx, tid, id)
+		if err != nil {
+			return nil, err
+		}
+		s.stock.log(ctx, tid, actor, "inventory.register_asset", "fixed_asset", id, a)
+		out = append(out, assetView(a))
+	}
+	return out, nil
+}
+
+type AssetFilter struct {
+	ItemID      string
+	CustodianID string
+	Status      string
+	Room        string
+	Search      string
+	Limit       int32
+	Offset      int32
+}
+
+func (s *AssetService) ListAssets(ctx context.Context, tenantID string, f AssetFilter) ([]Asset, error) {
+	if f.Limit <= 0 {
+		f.Limit = 50
+	}
+	assets, err := s.q.ListFixedAssets(ctx, db.ListFixedAssetsParams{
+		TenantID:    toPgUUID(tenantID),
+		ItemID:      toPgUUID(f.ItemID),
+		CustodianID: toPgUUID(f.CustodianID),
+		Status:      optionalText(f.Status),
+		Room:        optionalText(f.Room),
+		Search:      optionalText(f.Search),
+		Limit:       f.Limit,
+		Offset:      f.Offset,
+	})
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Asset, 0, len(assets))
+	for _, a := range assets {
+		out = append(out, assetView(a))
+	}
+	return out, nil
+}
+
+type DepreciationLine struct {
+	FinancialYear int         `json:"financial_year"`
+	PeriodStart   pgtype.Date `json:"period_start"`
+	PeriodEnd     pgtype.Date `json:"period_end"`
+	OpeningValue  float64     `json:"opening_value"`
+	Amount        float64     `json:"amount"`
+	ClosingValue  float64     `json:"closing_value"`
+	Posted        bool        `json:"posted"`
+}
+
+type AssetDetail struct {
+	Asset
+	Movements []db.FixedAssetMovement `json:"movements"`
+	Contracts []AssetContract         `json:"contracts"`
+	Schedule  []DepreciationLine      `json:"schedule"`
+	Disposals []AssetDisposal         `json:"disposals"`
+}
+
+// GetAsset returns an asset with its movements, contracts and depreciation
+// schedule: years posted as they were posted, later years as projected.
+func (s *AssetService) GetAsset(ctx context.Context, tenantID, assetID string) (AssetDetail, error) {
+	tid := toPgUUID(tenantID)
+	a, err := s.q.GetFixedAsset(ctx, tid, toPgUUID(assetID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return AssetDetail{}, ErrAssetNotFound
+	}
+	if err != nil {
+		return AssetDetail{}, err
+	}
+	detail := AssetDetail{
+		Asset: assetView(a), Movements: []db.FixedAssetMovement{}, Contracts: []AssetContract{},
+		Schedule: []DepreciationLine{}, Disposals: []AssetDisposal{},
+	}
+	if detail.Movements, err = s.q.ListFixedAssetMovements(ctx, a.ID); err != nil {
+		return AssetDetail{}, err
+	}
+	contracts, err := s.q.ListFixedAssetContracts(ctx, a.ID)
+	if err != nil {
+		return AssetDetail{}, err
+	}
+	for _, c := range contracts {
+		detail.Contracts = append(detail.Contracts, contractView(c))
+	}
+
+	posted, err := s.q.ListFixedAssetDepreciation(ctx, a.ID)
+	if err != nil {
+		return AssetDetail{}, err
+	}
+	done := map[int]bool{}
+	for _, d := range posted {
+		done[int(d.FinancialYear)] = true
+		detail.Schedule = append(detail.Schedule, DepreciationLine{
+			FinancialYear: int(d.FinancialYear), PeriodStart: d.PeriodStart, PeriodEnd: d.PeriodEnd,
+			OpeningValue: rupees(d.OpeningValue), Amount: rupees(d.Amount), ClosingValue: rupees(d.ClosingValue), Posted: true,
+		})
+	}
+	if a.Status != assetDisposed {
+		p := policyOf(a)
+		until := financialYearEnd(financialYear(p.InService) + wdvProjectionYears - 1)
+		if p.Method == DepreciationStraightLine {
+			until = p.lifeEnd()
+		}
+		for _, period := range depreciationSchedule(p, until) {
+			if done[period.FinancialYear] {
+				continue
+			}
+			detail.Schedule = append(detail.Schedule, DepreciationLine{
+				FinancialYear: period.FinancialYear, PeriodStart: pgDate(period.Start), PeriodEnd: pgDate(period.End),
+				OpeningValue: rupees(period.Opening), Amount: rupees(period.Amount), ClosingValue: rupees(period.Closing),
+			})
+		}
+	}
+
+	disposals, err := s.q.ListFixedAssetDisposals(ctx, tid, pgtype.Text{})
+	if err != nil {
+		return AssetDetail{}, err
+	}
+	for _, d := range disposals {
+		if d.AssetID == a.ID {
+			detail.Disposals = append(detail.Disposals, disposalView(d))
+		}
+	}
+	return detail, nil
+}
+
+// MoveInput changes where an asset is, who holds it, or its status. Nil
+// fields stay as they are; an empty room or custodian clears it.
+type MoveInput struct {
+	Room        *string
+	CustodianID *string
+	Status      string
+	Reason      string
+}
+
+// MoveAsset transfers an asset to another room or custodian, or changes its
+// status, and keeps the move in its history.
+func (s *AssetService) MoveAsset(ctx context.Context, tenantID, assetID string, in MoveInput, actor Actor) (Asset, error) {
+	tid, id := toPgUUID(tenantID), toPgUUID(assetID)
+	switch in.Status {
+	case "", assetInUse, assetInStore, assetUnderRepair, assetMissing:
+	default:
+		return Asset{}, fmt.Errorf("%w: status must be in_use, in_store, under_repair or missing", ErrInvalidAsset)
+	}
+	err := s.stock.inTx(ctx, func(q *db.Queries) error {
+		a, err := q.LockFixedAsset(ctx, tid, id)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrAssetNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if a.Status == assetDisposed {
+			return fmt.Errorf("%w: %s has been disposed of", ErrAssetState, a.AssetTag)
+		}
+		room, custodian, status := a.Room, a.CustodianID, a.Status
+		if in.Room != nil {
+			room = optionalText(*in.Room)
+		}
+		if in.CustodianID != nil {
+			custodian = toPgUUID(*in.CustodianID)
+			if custodian.Valid {
+				ok, err := q.EmployeeExists(ctx, tid, custodian)
+				if err != nil {
+					return err
+				}
+				if !ok {
+					return fmt.Errorf("%w: custodian is not a staff member", ErrInvalidAsset)
+				}
+			}
+		}
+		if in.Status != "" {
+			status = in.Status
+		}
+		return s.move(ctx, q, a, room, custodian, status, in.Reason, actor)
+	})
+	if err != nil {
+		return Asset{}, err
+	}
+	a, err := s.q.GetFixedAsset(ctx, tid, id)
+	if err != nil {
+		return Asset{}, err
+	}
+	s.stock.log(ctx, tid, actor, "inventory.move_asset", "fixed_asset", id, a)
+	return assetView(a), nil
+}
+
+// move places a locked asset and records the movement. Nothing changing is
+// an error.
+func (s *AssetService) move(ctx context.Context, q *db.Queries, a db.FixedAsset, room pgtype.Text, custodian pgtype.UUID, status, reason string, actor Actor) error {
+	if strings.EqualFold(room.String, a.Room.String) && room.Valid == a.Room.Valid && custodian == a.CustodianID && status == a.Status {
+		return fmt.Errorf("%w: %s is already there", ErrInvalidAsset, a.AssetTag)
+	}
+	if err := q.SetFixedAssetPlacement(ctx, a.ID, room, custodian, status); err != nil {
+		return err
+	}
+	return q.CreateFixedAssetMovement(ctx, db.CreateFixedAssetMovementParams{
+		TenantID:        a.TenantID,
+		AssetID:         a.ID,
+		FromRoom:        a.Room,
+		ToRoom:          room,
+		FromCustodianID: a.CustodianID,
+		ToCustodianID:   custodian,
+		FromStatus:      pgtype.Text{String: a.Status, Valid: true},
+		ToStatus:        status,
+		Reason:          optionalText(reason),
+		MovedBy:         toPgUUID(actor.UserID),
+	})
+}
+
+// Warranties and AMCs
+
+type AssetContract struct {
+	ID        pgtype.UUID        `json:"id"`
+	AssetID   pgtype.UUID        `json:"asset_id"`
+	AssetTag  string             `json:"asset_tag"`
+	AssetName string             `json:"asset_name"`
+	Kind      string             `json:"kind"`
+	Provider  string             `json:"provider"`
+	Reference pgtype.Text        `json:"reference"`
+	StartsOn  pgtype.Date        `json:"starts_on"`
+	EndsOn    pgtype.Date        `json:"ends_on"`
+	Cost      float64            `json:"cost"`
+	Coverage  pgtype.Text        `json:"coverage"`
+	CreatedAt pgtype.Timestamptz `json:"created_at"`
+}
+
+func contractView(c db.FixedAssetContract) AssetContract {
+	return AssetContract{
+		ID: c.ID, AssetID: c.AssetID, AssetTag: c.AssetTag, AssetName: c.AssetName, Kind: c.Kind, Provider: c.Provider,
+		Reference: c.Reference, StartsOn: c.StartsOn, EndsOn: c.EndsOn, Cost: rupees(c.Cost), Coverage: c.Coverage,
+		CreatedAt: c.CreatedAt,
+	}
+}
+
+type ContractInput struct {
+	Kind      string
+	Provider  string
+	Reference string
+	StartsOn  string
+	EndsOn    string
+	Cost      float64
+	Coverage  string
+}
+
+func (s *AssetService) AddContract(ctx context.Context, tenantID, assetID string, in ContractInput, actor Actor) (AssetContract, error) {
+	if in.Kind != "warranty" && in.Kind != "amc" {
+		return AssetContract{}, fmt.Errorf("%w: kind must be warranty or amc", ErrInvalidAsset)
+	}
+	if strings.TrimSpace(in.Provider) == "" || in.Cost < 0 {
+		return AssetContract{}, fmt.Errorf("%w: provider is required and cost cannot be negative", ErrInvalidAsset)
+	}
+	starts, err := parseAssetDate("starts_on", in.StartsOn)
+	if err != nil {
+		return AssetContract{}, err
+	}
+	ends, err := parseAssetDate("ends_on", in.EndsOn)
+	if err != nil {
+		return AssetContract{}, err
+	}
+	if ends.Before(starts) {
+		return AssetContract{}, fmt.Errorf("%w: ends_on is before starts_on", ErrInvalidAsset)
+	}
+	tid := toPgUUID(tenantID)
+	a, err := s.q.GetFixedAsset(ctx, tid, toPgUUID(assetID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return AssetContract{}, ErrAssetNotFound
+	}
+	if err != nil {
+		return AssetContract{}, err
+	}
+	if a.Status == assetDisposed {
+		return AssetContract{}, fmt.Errorf("%w: %s has been disposed of", ErrAssetState, a.AssetTag)
+	}
+	id, err := s.q.CreateFixedAssetContract(ctx, db.CreateFixedAssetContractParams{
+		TenantID:  tid,
+		AssetID:   a.ID,
+		Kind:      in.Kind,
+		Provider:  strings.TrimSpace(in.Provider),
+		Reference: optionalText(in.Reference),
+		StartsOn:  pgDate(starts),
+		EndsOn:    pgDate(ends),
+		Cost:      paise(in.Cost),
+		Coverage:  optionalText(in.Coverage),
+		CreatedBy: toPgUUID(actor.UserID),
+	})
+	if err != nil {
+		return AssetContract{}, err
+	}
+	s.stock.log(ctx, tid, actor, "inventory.add_asset_contract", "fixed_asset", a.ID, in)
+	contracts, err := s.q.ListFixedAssetContracts(ctx, a.ID)
+	if err != nil {
+		return AssetContract{}, err
+	}
+	for _, c := range contracts {
+		if c.ID == id {
+			return contractView(c), nil
+		}
+	}
+	return AssetContract{}, fmt.Errorf("contract %s not found after saving", id.String())
+}
+
+// ExpiringContracts lists warranties and AMCs ending in the next days
+// days, and those already lapsed in the last days, that have not been
+// renewed.
+func (s *AssetService) ExpiringContracts(ctx context.Context, tenantID string, days int) ([]AssetContract, error) {
+	if days <= 0 {
+		days = 30
+	}
+	tid := toPgUUID(tenantID)
+	today, err := s.today(ctx, tid)
+	if err != nil {
+		return nil, err
+	}
+	contracts, err := s.q.ListExpiringFixedAssetContracts(ctx, tid, pgDate(today.AddDate(0, 0, -days)), pgDate(today.AddDate(0, 0, days)))
+	if err != nil {
+		return nil, err
+	}
+	out := make([]AssetContract, 0, len(contracts))
+	for _, c := range contracts {
+		out = append(out, contractView(c))
+	}
+	return out, nil
+}
@@ -0,0 +1,116 @@
+package inventory
+
+import (
+	"math"
+	"time"
+
+	"github.com/schoolerp/api/internal/foundation/proration"
+)
+
+// Depreciation is charged per financial year (April to March), pro rata
+// by days in service in the first and last years. Amounts are in paise.
+
+const (
+	DepreciationStraightLine = "straight_line"
+	DepreciationWDV          = "wdv"
+)
+
+// financialYear is the year the April-to-March financial year holding d
+// starts in.
+func financialYear(d time.Time) int {
+	if d.Month() >= time.April {
+		return d.Year()
+	}
+	return d.Year() - 1
+}
+
+func financialYearStart(fy int) time.Time {
+	return time.Date(fy, time.April, 1, 0, 0, 0, 0, time.UTC)
+}
+
+func financialYearEnd(fy int) time.Time {
+	return time.Date(fy+1, time.March, 31, 0, 0, 0, 0, time.UTC)
+}
+
+type depreciationPolicy struct {
+	Method     string
+	Cost       int64
+	Residual   int64
+	LifeMonths int32
+	RatePct    float64
+	InService  time.Time
+}
+
+type depreciationPeriod struct {
+	FinancialYear int
+	Start, End    time.Time
+	Opening       int64
+	Amount        int64
+	Closing       int64
+}
+
+// lifeEnd is the last day of a straight-line asset's useful life.
+func (p depreciationPolicy) lifeEnd() time.Time {
+	return p.InService.AddDate(0, int(p.LifeMonths), -1)
+}
+
+// depreciationSchedule charges p year by year through until. Straight
+// line spreads cost less residual evenly over the useful life and writes
+// the asset down to exactly its residual value on the last day of it. WDV
+// charges the rate on the opening value each year and never goes below the
+// residual value.
+func depreciationSchedule(p depreciationPolicy, until time.Time) []depreciationPeriod {
+	var out []depreciationPeriod
+	opening := p.Cost
+	if p.Cost <= p.Residual || until.Before(p.InService) {
+		return out
+	}
+	for fy := financialYear(p.InService); fy <= financialYear(until); fy++ {
+		start, end := financialYearStart(fy), financialYearEnd(fy)
+		yearDays := proration.Days(start, end)
+		if start.Before(p.InService) {
+			start = p.InService
+		}
+		if end.After(until) {
+			end = until
+		}
+		fraction := float64(proration.Days(start, end)) / float64(yearDays)
+
+		var amount int64
+		switch p.Method {
+		case DepreciationStraightLine:
+			if p.LifeMonths <= 0 || start.After(p.lifeEnd()) {
+				return out
+			}
+			if !end.Before(p.lifeEnd()) {
+				end = p.lifeEnd()
+				amount = opening - p.Residual
+				break
+			}
+			annual := float64(p.Cost-p.Residual) * 12 / float64(p.LifeMonths)
+			amount = int64(math.Round(annual * fraction))
+		case DepreciationWDV:
+			amount = int64(math.Round(float64(opening) * p.RatePct / 100 * fraction))
+		default:
+			return out
+		}
+		amount = min(max(amount, 0), opening-p.Residual)
+		out = append(out, depreciationPeriod{
+			FinancialYear: fy, Start: start, End: end, Opening: opening, Amount: amount, Closing: opening - amount,
+		})
+		opening -= amount
+		if opening <= p.Residual {
+			break
+		}
+	}
+	return out
+}
+
+// bookValueOn is what the asset is worth on day d by its schedule.
+func bookValueOn(p depreciationPolicy, d time.Time) int64 {
+	periods := depreciationSchedule(p, d)
+	if len(periods) == 0 {
+		return p.Cost
+	}
+	return periods[len(periods)-1].Closing
+}
@@ -0,0 +1,106 @@
+package inventory
+
+import (
+	"testing"
+	"time"
+)
+
+func day(s string) time.Time {
+	d, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func TestFinancialYear(t *testing.T) {
+	if fy := financialYear(day("2025-03-31")); fy != 2024 {
+		t.Fatalf("31 March belongs to FY 2024, got %d", fy)
+	}
+	if fy := financialYear(day("2025-04-01")); fy != 2025 {
+		t.Fatalf("1 April starts FY 2025, got %d", fy)
+	}
+	for _, v := range []string{"2025", "2025-26", "2025-2026", " 2025-26 "} {
+		if fy, err := financialYearOf(v); err != nil || fy != 2025 {
+			t.Fatalf("financialYearOf(%q) = %d, %v", v, fy, err)
+		}
+	}
+	for _, v := range []string{"", "25", "2025-27", "2025-24", "next"} {
+		if _, err := financialYearOf(v); err == nil {
+			t.Fatalf("financialYearOf(%q) should fail", v)
+		}
+	}
+}
+
+func TestStraightLineFullYear(t *testing.T) {
+	p := depreciationPolicy{Method: DepreciationStraightLine, Cost: 12000000, LifeMonths: 60, InService: day("2024-04-01")}
+	periods := depreciationSchedule(p, day("2025-03-31"))
+	if len(periods) != 1 || periods[0].Amount != 2400000 || periods[0].Closing != 9600000 {
+		t.Fatalf("unexpected schedule %+v", periods)
+	}
+}
+
+func TestStraightLinePartialYearsTrueUpToResidual(t *testing.T) {
+	p := depreciationPolicy{
+		Method: DepreciationStraightLine, Cost: 12000000, Residual: 600000, LifeMonths: 60, InService: day("2024-10-01"),
+	}
+	periods := depreciationSchedule(p, day("2031-03-31"))
+	if len(periods) != 6 {
+		t.Fatalf("expected six financial years, got %d", len(periods))
+	}
+	// 182 of 365 days in the first year.
+	if periods[0].Amount != 1136877 {
+		t.Fatalf("first year charge = %d", periods[0].Amount)
+	}
+	if periods[1].Amount != 2280000 {
+		t.Fatalf("full year charge = %d", periods[1].Amount)
+	}
+	last := periods[len(periods)-1]
+	if !last.End.Equal(day("2029-09-30")) || last.Closing != 600000 {
+		t.Fatalf("life should end on 2029-09-30 at residual, got %+v", last)
+	}
+	var total int64
+	for _, pd := range periods {
+		total += pd.Amount
+	}
+	if total != 11400000 {
+		t.Fatalf("total charge = %d", total)
+	}
+	if v := bookValueOn(p, day("2024-09-30")); v != 12000000 {
+		t.Fatalf("book value before service = %d", v)
+	}
+}
+
+func TestWDVStopsAtResidual(t *testing.T) {
+	p := depreciationPolicy{Method: DepreciationWDV, Cost: 100000, Residual: 5000, RatePct: 40, InService: day("2024-04-01")}
+	periods := depreciationSchedule(p, day("2040-03-31"))
+	want := []int64{40000, 24000, 14400, 8640, 5184, 2776}
+	if len(periods) != len(want) {
+		t.Fatalf("expected %d years, got %+v", len(want), periods)
+	}
+	for i, amount := range want {
+		if periods[i].Amount != amount {
+			t.Fatalf("year %d charge = %d, want %d", i, periods[i].Amount, amount)
+		}
+	}
+	if v := bookValueOn(p, day("2040-03-31")); v != 5000 {
+		t.Fatalf("book value = %d, want residual", v)
+	}
+}
+
+func TestAssetProfileValidate(t *testing.T) {
+	if err := defaultAssetProfile().validate(); err != nil {
+		t.Fatalf("default profile rejected: %v", err)
+	}
+	bad := []AssetProfile{
+		{DepreciationMethod: DepreciationStraightLine},
+		{DepreciationMethod: DepreciationWDV, DepreciationRatePct: 100},
+		{DepreciationMethod: DepreciationWDV, DepreciationRatePct: 15, ResidualPct: 100},
+		{DepreciationMethod: "sum_of_digits", UsefulLifeMonths: 12},
+	}
+	for _, p := range bad {
+		if err := p.validate(); err == nil {
+			t.Fatalf("expected %+v to be rejected", p)
+		}
+	}
+}
@@ -2,8 +2,8 @@ package inventory
 
 import (
 	"context"
-	"errors"
 	"fmt"
+	"time"
 
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -15,13 +15,15 @@ type InventoryService struct {
 	q     db.Querier
 	pool  *pgxpool.Pool
 	audit *audit.Logger
+	stock *StockService
 }
 
-func NewInventoryService(q db.Querier, pool *pgxpool.Pool, audit *audit.Logger) *InventoryService {
+func NewInventoryService(q db.Querier, pool *pgxpool.Pool, audit *audit.Logger, stock *StockService) *InventoryService {
 	return &InventoryService{
 		q:     q,
 		pool:  pool,
 		audit: audit,
+		stock: stock,
 	}
 }
 
@@ -164,23 +166,39 @@ func (s *InventoryService) UpdateSupplier(ctx context.Context, tenantID, supplie
 
 // Item Management
 
-func (s *InventoryService) CreateItem(ctx context.Context, tenantID, catID, name, sku, unit, desc string, reorder int32, userID, reqID, ip string) (db.InventoryItem, error) {
+// CreatedItem is a new item with, for items in asset categories, the
+// depreciation defaults its assets are registered with.
+type CreatedItem struct {
+	db.InventoryItem
+	AssetProfile *AssetProfile `json:"asset_profile,omitempty"`
+}
+
+func (s *InventoryService) CreateItem(ctx context.Context, tenantID, catID, name, sku, unit, desc string, reorder int32, asset *AssetProfile, userID, reqID, ip string) (CreatedItem, error) {
 	tID := pgtype.UUID{}
 	tID.Scan(tenantID)
 	cID := pgtype.UUID{}
 	cID.Scan(catID)
 
-	item, err := s.q.CreateInventoryItem(ctx, db.CreateInventoryItemParams{
-		TenantID:     tID,
-		CategoryID:   cID,
-		Name:         name,
-		Sku:          pgtype.Text{String: sku, Valid: sku != ""},
-		Unit:         pgtype.Text{String: unit, Valid: unit != ""},
-		ReorderLevel: pgtype.Int4{Int32: reorder, Valid: true},
-		Description:  pgtype.Text{String: desc, Valid: desc != ""},
+	var created CreatedItem
+	err := s.stock.inTx(ctx, func(q *db.Queries) error {
+		item, err := q.CreateInventoryItem(ctx, db.CreateInventoryItemParams{
+			TenantID:     tID,
+			CategoryID:   cID,
+			Name:         name,
+			Sku:          pgtype.Text{String: sku, Valid: sku != ""},
+			Unit:         pgtype.Text{String: unit, Valid: unit != ""},
+			ReorderLevel: pgtype.Int4{Int32: reorder, Valid: true},
+			Description:  pgtype.Text{String: desc, Valid: desc != ""},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create item: %w", err)
+		}
+		created.InventoryItem = item
+		created.AssetProfile, err = applyAssetProfile(ctx, q, tID, item.ID, asset)
+		return err
 	})
 	if err != nil {
-		return db.InventoryItem{}, fmt.Errorf("failed to create item: %w", err)
+		return CreatedItem{}, err
 	}
 
 	uID := pgtype.UUID{}
@@ -192,12 +210,12 @@ func (s *InventoryService) CreateItem(ctx context.Context, tenantID, catID, name
 		RequestID:    reqID,
 		Action:       "inventory.create_item",
 		ResourceType: "inventory_item",
-		ResourceID:   item.ID,
-		After:        item,
+		ResourceID:   created.ID,
+		After:        created,
 		IPAddress:    ip,
 	})
 
-	return item, nil
+	return created, nil
 }
 
 func (s *InventoryService) ListItems(ctx context.Context, tenantID string, limit, offset int32) ([]db.ListInventoryItemsRow, error) {
@@ -281,7 +299,8 @@ type StockTransactionParams struct {
 	Quantity      int32
 	UnitPrice     float64
 	SupplierID    string
-	Location      string
+	StoreID       string
+	Location      string // store name, for clients that predate stores
 	ReferenceID   string
 	ReferenceType string
 	Remarks       string
@@ -292,18 +311,14 @@ type StockTransactionParams struct {
 
 func (s *InventoryService) CreateTransaction(ctx context.Context, p StockTransactionParams) (db.InventoryTransaction, error) {
 	if p.Quantity <= 0 {
-		return db.InventoryTransaction{}, errors.New("quantity must be greater than zero")
+		return db.InventoryTransaction{}, fmt.Errorf("%w: quantity must be greater than zero", ErrInvalidStock)
 	}
 	if p.Type != "in" && p.Type != "out" && p.Type != "adjustment" {
-		return db.InventoryTransaction{}, errors.New("invalid transaction type")
+		return db.InventoryTransaction{}, fmt.Errorf("%w: invalid transaction type", ErrInvalidStock)
 	}
-
-	tx, err := s.pool.Begin(ctx)
-	if err != nil {
-		return db.InventoryTransaction{}, fmt.Errorf("failed to begin transaction: %w", err)
+	if p.UnitPrice < 0 {
+		return db.InventoryTransaction{}, fmt.Errorf("%w: unit price cannot be negative", ErrInvalidStock)
 	}
-	defer tx.Rollback(ctx)
-	qtx := db.New(tx)
 
 	tID := pgtype.UUID{}
 	tID.Scan(p.TenantID)
@@ -316,67 +331,48 @@ func (s *InventoryService) CreateTransaction(ctx context.Context, p StockTransac
 	if p.SupplierID != "" {
 		sID.Scan(p.SupplierID)
 	}
-
-	// 1. Validate stock before creating transaction record for OUT operations.
-	delta := p.Quantity
-	if p.Type == "out" {
-		stock, sErr := qtx.GetStock(ctx, db.GetStockParams{ItemID: iID, TenantID: tID})
-		if sErr != nil {
-			return db.InventoryTransaction{}, errors.New("insufficient stock: item has no available quantity")
-		}
-		if stock.Quantity < p.Quantity {
-			return db.InventoryTransaction{}, fmt.Errorf("insufficient stock: available %d, requested %d", stock.Quantity, p.Quantity)
-		}
-		delta = -p.Quantity
-	}
-
-	// 2. Create Transaction Record
-	price := pgtype.Numeric{}
-	price.Scan(fmt.Sprintf("%.2f", p.UnitPrice))
-
 	refID := pgtype.UUID{}
 	if p.ReferenceID != "" {
 		refID.Scan(p.ReferenceID)
 	}
+	price := pgtype.Numeric{}
+	price.Scan(fmt.Sprintf("%.2f", p.UnitPrice))
 
-	txn, err := qtx.CreateInventoryTransaction(ctx, db.CreateInventoryTransactionParams{
-		TenantID:      tID,
-		ItemID:        iID,
-		Type:          p.Type,
-		Quantity:      p.Quantity,
-		UnitPrice:     price,
-		SupplierID:    sID,
-		ReferenceID:   refID,
-		ReferenceType: pgtype.Text{String: p.ReferenceType, Valid: p.ReferenceType != ""},
-		Remarks:       pgtype.Text{String: p.Remarks, Valid: p.Remarks != ""},
-		CreatedBy:     uID,
-	})
-	if err != nil {
-		return db.InventoryTransaction{}, fmt.Errorf("failed to create transaction: %w", err)
-	}
-
-	// Default location if not provided
-	location := p.Location
-	if location == "" {
-		location = "Main Store"
+	// Stock comes in at its unit price and goes out at the item's cost in
+	// the store, by its valuation method.
+	delta := p.Quantity
+	if p.Type == "out" {
+		delta = -p.Quantity
 	}
 
-	// 3. Update Stock Level
-	err = qtx.UpsertStock(ctx, db.UpsertStockParams{
-		TenantID: tID,
-		ItemID:   iID,
-		Location: pgtype.Text{String: location, Valid: true},
-		Quantity: delta,
+	var txn db.InventoryTransaction
+	var store db.InventoryStore
+	err := s.stock.inTx(ctx, func(q *db.Queries) error {
+		var err error
+		store, err = s.stock.resolveStore(ctx, q, tID, p.StoreID, p.Location)
+		if err != nil {
+			return err
+		}
+		posted, err := s.stock.post(ctx, q, tID, movement{
+			ItemID:        iID,
+			StoreID:       store.ID,
+			Type:          p.Type,
+			Delta:         delta,
+			Value:         paise(p.UnitPrice) * int64(p.Quantity),
+			UnitPrice:     price,
+			SupplierID:    sID,
+			ReferenceID:   refID,
+			ReferenceType: p.ReferenceType,
+			Remarks:       p.Remarks,
+			CreatedBy:     uID,
+		})
+		txn = posted.Txn
+		return err
 	})
 	if err != nil {
-		return db.InventoryTransaction{}, fmt.Errorf("failed to update stock: %w", err)
+		return db.InventoryTransaction{}, err
 	}
 
-	if err := tx.Commit(ctx); err != nil {
-		return db.InventoryTransaction{}, fmt.Errorf("failed to commit inventory transaction: %w", err)
-	}
-
-	// 4. Audit
 	_ = s.audit.Log(ctx, audit.Entry{
 		TenantID:     tID,
 		UserID:       uID,
@@ -384,7 +380,7 @@ func (s *InventoryService) CreateTransaction(ctx context.Context, p StockTransac
 		Action:       "STOCK_" + p.Type,
 		ResourceType: "inventory_transaction",
 		ResourceID:   txn.ID,
-		After:        map[string]interface{}{"item_id": p.ItemID, "qty": delta},
+		After:        map[string]interface{}{"item_id": p.ItemID, "store_id": store.ID, "qty": delta},
 		IPAddress:    p.IP,
 	})
 
@@ -404,13 +400,22 @@ func (s *InventoryService) ListTransactions(ctx context.Context, tenantID string
 // ==================== Purchase Orders ====================
 
 type CreatePurchaseOrderParams struct {
-	TenantID   string
-	PONumber   string
-	SupplierID string
-	Notes      string
-	UserID     string
-	RequestID  string
-	IP         string
+	TenantID     string
+	PONumber     string
+	SupplierID   string
+	StoreID      string
+	ExpectedDate string
+	Notes        string
+	Items        []PurchaseOrderItemParams
+	UserID       string
+	RequestID    string
+	IP           string
+}
+
+type PurchaseOrderItemParams struct {
+	ItemID    string
+	Quantity  int32
+	UnitPrice float64
 }
 
 func (s *InventoryService) CreatePurchaseOrder(ctx context.Context, p CreatePurchaseOrderParams) (db.PurchaseOrder, error) {
@@ -423,13 +428,56 @@ func (s *InventoryService) CreatePurchaseOrder(ctx context.Context, p CreatePurc
 	uID := pgtype.UUID{}
 	uID.Scan(p.UserID)
 
-	po, err := s.q.CreatePurchaseOrder(ctx, db.CreatePurchaseOrderParams{
-		TenantID:   tID,
-		PoNumber:   p.PONumber,
-		SupplierID: sID,
-		Status:     "draft",
-		Notes:      pgtype.Text{String: p.Notes, Valid: p.Notes != ""},
-		CreatedBy:  uID,
+	var expected pgtype.Date
+	if p.ExpectedDate != "" {
+		d, err := time.Parse("2006-01-02", p.ExpectedDate)
+		if err != nil {
+			return db.PurchaseOrder{}, fmt.Errorf("%w: expected_date must be a date (YYYY-MM-DD)", ErrInvalidStock)
+		}
+		expected = pgtype.Date{Time: d, Valid: true}
+	}
+	for _, it := range p.Items {
+		if it.ItemID == "" || it.Quantity <= 0 || it.UnitPrice < 0 {
+			return db.PurchaseOrder{}, fmt.Errorf("%w: each item needs an item_id, a positive quantity and a price", ErrInvalidStock)
+		}
+	}
+
+	var po db.PurchaseOrder
+	err := s.stock.inTx(ctx, func(q *db.Queries) error {
+		var storeID pgtype.UUID
+		if p.StoreID != "" {
+			store, err := activeStore(ctx, q, tID, p.StoreID)
+			if err != nil {
+				return err
+			}
+			storeID = store.ID
+		}
+		var err error
+		po, err = q.CreatePurchaseOrder(ctx, db.CreatePurchaseOrderParams{
+			TenantID:   tID,
+			PoNumber:   p.PONumber,
+			SupplierID: sID,
+			Status:     "draft",
+			Notes:      pgtype.Text{String: p.Notes, Valid: p.Notes != ""},
+			CreatedBy:  uID,
+		})
+		if err != nil {
+			return err
+		}
+		for _, it := range p.Items {
+			if _, err := q.GetInventoryItem(ctx, db.GetInventoryItemParams{ID: toPgUUID(it.ItemID), TenantID: tID}); err != nil {
+				return fmt.Errorf("%w: %s", ErrItemNotFound, it.ItemID)
+			}
+			if _, err := q.CreatePurchaseOrderItem(ctx, db.CreatePurchaseOrderItemParams{
+				PoID:      po.ID,
+				ItemID:    toPgUUID(it.ItemID),
+				Quantity:  it.Quantity,
+				UnitPrice: numericRupees(paise(it.UnitPrice)),
+			}); err != nil {
+				return err
+			}
+		}
+		return q.SetPurchaseOrderDelivery(ctx, po.ID, storeID, expected)
 	})
 	if err != nil {
 		return db.PurchaseOrder{}, err
@@ -442,7 +490,7 @@ func (s *InventoryService) CreatePurchaseOrder(ctx context.Context, p CreatePurc
 		Action:       "inventory.create_po",
 		ResourceType: "purchase_order",
 		ResourceID:   po.ID,
-		After:        po,
+		After:        p,
 		IPAddress:    p.IP,
 	})
 
@@ -491,55 +539,6 @@ func (s *InventoryService) ApprovePurchaseOrder(ctx context.Context, tenantID, p
 	return po, nil
 }
 
-func (s *InventoryService) ReceivePurchaseOrder(ctx context.Context, tenantID, poID, receiverID, reqID, ip string) (db.PurchaseOrder, error) {
-	tID := pgtype.UUID{}
-	tID.Scan(tenantID)
-	pID := pgtype.UUID{}
-	pID.Scan(poID)
-	uID := pgtype.UUID{}
-	uID.Scan(receiverID)
-
-	po, err := s.q.ReceivePurchaseOrder(ctx, db.ReceivePurchaseOrderParams{
-		ID:       pID,
-		TenantID: tID,
-	})
-	if err != nil {
-		return db.PurchaseOrder{}, err
-	}
-
-	// Auto-create inventory transactions for received items
-	items, _ := s.q.ListPurchaseOrderItems(ctx, pID)
-	for _, item := range items {
-		uPrice, _ := item.UnitPrice.Float64Value()
-		s.CreateTransaction(ctx, StockTransactionParams{
-			TenantID:      tenantID,
-			ItemID:        item.ItemID.String(),
-			Type:          "in",
-			Quantity:      int32(item.Quantity),
-			UnitPrice:     uPrice.Float64,
-			ReferenceID:   poID,
-			ReferenceType: "purchase_order",
-			Remarks:       "Received from PO",
-			UserID:        receiverID,
-			RequestID:     reqID,
-			IP:            ip,
-		})
-	}
-
-	_ = s.audit.Log(ctx, audit.Entry{
-		TenantID:     tID,
-		UserID:       uID,
-		RequestID:    reqID,
-		Action:       "inventory.receive_po",
-		ResourceType: "purchase_order",
-		ResourceID:   po.ID,
-		After:        po,
-		IPAddress:    ip,
-	})
-
-	return po, nil
-}
-
 // Requisitions
 
 type CreateRequisitionParams struct {
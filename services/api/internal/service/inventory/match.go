@@ -0,0 +1,101 @@
+package inventory
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Three-way match: each invoice line is checked against the order line it
+// bills (price) and the goods accepted into stock for it (quantity).
+
+// Tolerance is how far an invoice may go past the order and receipts before
+// it is held. Amount caps what the whole invoice may exceed the order value
+// of the quantities billed by; zero means no cap beyond the line checks.
+type Tolerance struct {
+	QuantityPct float64
+	PricePct    float64
+	Amount      int64
+}
+
+const (
+	MatchNotReceived = "not_received"
+	MatchQuantity    = "quantity"
+	MatchPrice       = "price"
+	MatchAmount      = "amount"
+	MatchTotal       = "total"
+)
+
+type MatchException struct {
+	Type     string  `json:"type"`
+	POItemID string  `json:"po_item_id,omitempty"`
+	Item     string  `json:"item,omitempty"`
+	Expected float64 `json:"expected"`
+	Actual   float64 `json:"actual"`
+	Message  string  `json:"message"`
+}
+
+// matchLine is an invoice line with what the order and receipts say of it.
+type matchLine struct {
+	POItemID  pgtype.UUID
+	ItemName  string
+	Quantity  int32
+	UnitPrice int64
+	// OrderPrice is the price on the order line; Accepted is what has been
+	// received into stock; BilledElsewhere is what other invoices not
+	// rejected have billed for the line.
+	OrderPrice      int64
+	Accepted        int32
+	BilledElsewhere int32
+}
+
+// matchInvoice returns what keeps an invoice from matching. Billing less
+// than received or below the order price is not an exception.
+func matchInvoice(lines []matchLine, tax, total int64, tol Tolerance) []MatchException {
+	out := []MatchException{}
+	var subtotal, orderValue int64
+	for _, l := range lines {
+		subtotal += int64(l.Quantity) * l.UnitPrice
+		orderValue += int64(l.Quantity) * l.OrderPrice
+
+		billed := l.BilledElsewhere + l.Quantity
+		allowed := l.Accepted + int32(math.Floor(float64(l.Accepted)*tol.QuantityPct/100))
+		switch {
+		case l.Accepted == 0:
+			out = append(out, MatchException{
+				Type: MatchNotReceived, POItemID: l.POItemID.String(), Item: l.ItemName,
+				Actual:  float64(billed),
+				Message: fmt.Sprintf("%s: billed %d, none received yet", l.ItemName, billed),
+			})
+		case billed > allowed:
+			out = append(out, MatchException{
+				Type: MatchQuantity, POItemID: l.POItemID.String(), Item: l.ItemName,
+				Expected: float64(l.Accepted), Actual: float64(billed),
+				Message: fmt.Sprintf("%s: billed %d, received %d", l.ItemName, billed, l.Accepted),
+			})
+		}
+
+		limit := l.OrderPrice + int64(math.Round(float64(l.OrderPrice)*tol.PricePct/100))
+		if l.UnitPrice > limit {
+			out = append(out, MatchException{
+				Type: MatchPrice, POItemID: l.POItemID.String(), Item: l.ItemName,
+				Expected: rupees(l.OrderPrice), Actual: rupees(l.UnitPrice),
+				Message: fmt.Sprintf("%s: billed at %.2f, ordered at %.2f", l.ItemName, rupees(l.UnitPrice), rupees(l.OrderPrice)),
+			})
+		}
+	}
+	if tol.Amount > 0 && subtotal-orderValue > tol.Amount {
+		out = append(out, MatchException{
+			Type: MatchAmount, Expected: rupees(orderValue), Actual: rupees(subtotal),
+			Message: fmt.Sprintf("invoice is %.2f over the order value of %.2f", rupees(subtotal-orderValue), rupees(orderValue)),
+		})
+	}
+	if total != subtotal+tax {
+		out = append(out, MatchException{
+			Type: MatchTotal, Expected: rupees(subtotal + tax), Actual: rupees(total),
+			Message: fmt.Sprintf("invoice total %.2f is not its lines plus tax (%.2f)", rupees(total), rupees(subtotal+tax)),
+		})
+	}
+	return out
+}
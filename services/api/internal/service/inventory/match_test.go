@@ -0,0 +1,107 @@
+package inventory
+
+import (
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/schoolerp/api/internal/db"
+)
+
+func exceptionTypes(ex []MatchException) []string {
+	out := make([]string, 0, len(ex))
+	for _, e := range ex {
+		out = append(out, e.Type)
+	}
+	return out
+}
+
+func TestMatchInvoiceClean(t *testing.T) {
+	lines := []matchLine{{ItemName: "Chalk", Quantity: 10, UnitPrice: 5000, OrderPrice: 5000, Accepted: 10}}
+	if ex := matchInvoice(lines, 9000, 59000, Tolerance{}); len(ex) != 0 {
+		t.Fatalf("expected a match, got %+v", ex)
+	}
+}
+
+func TestMatchInvoiceQuantityAgainstReceipts(t *testing.T) {
+	// 6 billed earlier and 5 now against 10 received.
+	lines := []matchLine{{ItemName: "Chalk", Quantity: 5, UnitPrice: 5000, OrderPrice: 5000, Accepted: 10, BilledElsewhere: 6}}
+	ex := matchInvoice(lines, 0, 25000, Tolerance{})
+	if len(ex) != 1 || ex[0].Type != MatchQuantity || ex[0].Expected != 10 || ex[0].Actual != 11 {
+		t.Fatalf("unexpected exceptions %+v", ex)
+	}
+
+	// A 10% quantity tolerance lets one extra unit through.
+	if ex := matchInvoice(lines, 0, 25000, Tolerance{QuantityPct: 10}); len(ex) != 0 {
+		t.Fatalf("expected the tolerance to absorb the extra unit, got %+v", ex)
+	}
+}
+
+func TestMatchInvoiceNothingReceived(t *testing.T) {
+	lines := []matchLine{{ItemName: "Paper", Quantity: 2, UnitPrice: 30000, OrderPrice: 30000}}
+	ex := matchInvoice(lines, 0, 60000, Tolerance{QuantityPct: 50})
+	if got := exceptionTypes(ex); len(got) != 1 || got[0] != MatchNotReceived {
+		t.Fatalf("unexpected exceptions %v", got)
+	}
+}
+
+func TestMatchInvoicePriceTolerance(t *testing.T) {
+	lines := []matchLine{{ItemName: "Toner", Quantity: 1, UnitPrice: 102000, OrderPrice: 100000, Accepted: 1}}
+	if ex := matchInvoice(lines, 0, 102000, Tolerance{PricePct: 2}); len(ex) != 0 {
+		t.Fatalf("2%% over should be within tolerance, got %+v", ex)
+	}
+	lines[0].UnitPrice = 102001
+	ex := matchInvoice(lines, 0, 102001, Tolerance{PricePct: 2})
+	if got := exceptionTypes(ex); len(got) != 1 || got[0] != MatchPrice {
+		t.Fatalf("unexpected exceptions %v", got)
+	}
+
+	// Billing under the order price is not an exception.
+	lines[0].UnitPrice = 90000
+	if ex := matchInvoice(lines, 0, 90000, Tolerance{}); len(ex) != 0 {
+		t.Fatalf("an undercharge should match, got %+v", ex)
+	}
+}
+
+func TestMatchInvoiceAmountAndTotal(t *testing.T) {
+	lines := []matchLine{
+		{ItemName: "Pens", Quantity: 100, UnitPrice: 1050, OrderPrice: 1000, Accepted: 100},
+		{ItemName: "Ink", Quantity: 10, UnitPrice: 2000, OrderPrice: 2000, Accepted: 10},
+	}
+	// Pens are 5% over: a price exception, and 50.00 over the order value.
+	ex := matchInvoice(lines, 0, 125000, Tolerance{PricePct: 10, Amount: 4000})
+	if got := exceptionTypes(ex); len(got) != 1 || got[0] != MatchAmount {
+		t.Fatalf("unexpected exceptions %v", got)
+	}
+	if ex := matchInvoice(lines, 0, 125000, Tolerance{PricePct: 10, Amount: 5000}); len(ex) != 0 {
+		t.Fatalf("expected a match within the amount tolerance, got %+v", ex)
+	}
+
+	ex = matchInvoice(lines, 1000, 125000, Tolerance{PricePct: 10})
+	if got := exceptionTypes(ex); len(got) != 1 || got[0] != MatchTotal {
+		t.Fatalf("unexpected exceptions %v", got)
+	}
+}
+
+func TestOrderQuantity(t *testing.T) {
+	c := db.ReorderCandidate{ReorderLevel: 20, OnHand: 12, OnOrder: 5}
+	if got := orderQuantity(c); got != 23 {
+		t.Fatalf("order quantity = %d, want 23", got)
+	}
+	c.OnHand, c.OnOrder = 40, 0
+	if got := orderQuantity(c); got != 1 {
+		t.Fatalf("order quantity = %d, want at least 1", got)
+	}
+	c.ReorderQuantity = pgtype.Int4{Int32: 50, Valid: true}
+	if got := orderQuantity(c); got != 50 {
+		t.Fatalf("order quantity = %d, want the set reorder quantity", got)
+	}
+}
+
+func TestPercent(t *testing.T) {
+	if got := percent(1, 3); got == nil || *got != 33.3 {
+		t.Fatalf("percent(1, 3) = %v", got)
+	}
+	if got := percent(5, 0); got != nil {
+		t.Fatalf("percent with nothing to measure should be nil, got %v", *got)
+	}
+}
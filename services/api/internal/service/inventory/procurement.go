@@ -0,0 +1,998 @@
+package inventory
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog/log"
+	"github.com/schoolerp/api/internal/db"
+	"github.com/schoolerp/api/internal/foundation/audit"
+)
+
+var (
+	ErrPurchaseOrderNotFound = errors.New("purchase order not found")
+	ErrPurchaseOrderState    = errors.New("purchase order cannot change in its current status")
+	ErrInvoiceNotFound       = errors.New("supplier invoice not found")
+	ErrInvoiceState          = errors.New("supplier invoice cannot change in its current status")
+	ErrDuplicateInvoice      = errors.New("supplier invoice already recorded")
+)
+
+const reorderInterval = 6 * time.Hour
+
+// ProcurementService drafts orders from reorder levels, receives goods
+// against orders and matches supplier invoices to both.
+type ProcurementService struct {
+	q     *db.Queries
+	pool  *pgxpool.Pool
+	audit *audit.Logger
+	stock *StockService
+}
+
+func NewProcurementService(q *db.Queries, pool *pgxpool.Pool, audit *audit.Logger, stock *StockService) *ProcurementService {
+	return &ProcurementService{q: q, pool: pool, audit: audit, stock: stock}
+}
+
+func numericRupees(p int64) pgtype.Numeric {
+	var n pgtype.Numeric
+	_ = n.Scan(fmt.Sprintf("%.2f", rupees(p)))
+	return n
+}
+
+// Settings
+
+type SettingsInput struct {
+	AutoReorder          bool
+	QuantityTolerancePct float64
+	PriceTolerancePct    float64
+	AmountTolerance      float64
+}
+
+type ProcurementSettings struct {
+	AutoReorder          bool               `json:"auto_reorder"`
+	QuantityTolerancePct float64            `json:"quantity_tolerance_pct"`
+	PriceTolerancePct    float64            `json:"price_tolerance_pct"`
+	AmountTolerance      float64            `json:"amount_tolerance"`
+	UpdatedAt            pgtype.Timestamptz `json:"updated_at"`
+}
+
+func settingsView(s db.ProcurementSettings) ProcurementSettings {
+	return ProcurementSettings{
+		AutoReorder:          s.AutoReorder,
+		QuantityTolerancePct: s.QuantityTolerancePct,
+		PriceTolerancePct:    s.PriceTolerancePct,
+		AmountTolerance:      rupees(s.AmountTolerance),
+		UpdatedAt:            s.UpdatedAt,
+	}
+}
+
+func tolerance(s db.ProcurementSettings) Tolerance {
+	return Tolerance{QuantityPct: s.QuantityTolerancePct, PricePct: s.PriceTolerancePct, Amount: s.AmountTolerance}
+}
+
+func (s *ProcurementService) GetSettings(ctx context.Context, tenantID string) (ProcurementSettings, error) {
+	settings, err := s.q.GetProcurementSettings(ctx, toPgUUID(tenantID))
+	return settingsView(settings), err
+}
+
+func (s *ProcurementService) SaveSettings(ctx context.Context, tenantID string, in SettingsInput, actor Actor) (ProcurementSettings, error) {
+	if in.QuantityTolerancePct < 0 || in.PriceTolerancePct < 0 || in.AmountTolerance < 0 {
+		return ProcurementSettings{}, fmt.Errorf("%w: tolerances cannot be negative", ErrInvalidStock)
+	}
+	if in.QuantityTolerancePct > 100 || in.PriceTolerancePct > 100 {
+		return ProcurementSettings{}, fmt.Errorf("%w: percentage tolerances cannot exceed 100", ErrInvalidStock)
+	}
+	tid := toPgUUID(tenantID)
+	err := s.q.SaveProcurementSettings(ctx, db.ProcurementSettings{
+		TenantID:             tid,
+		AutoReorder:          in.AutoReorder,
+		QuantityTolerancePct: in.QuantityTolerancePct,
+		PriceTolerancePct:    in.PriceTolerancePct,
+		AmountTolerance:      paise(in.AmountTolerance),
+		UpdatedBy:            toPgUUID(actor.UserID),
+	})
+	if err != nil {
+		return ProcurementSettings{}, err
+	}
+	s.stock.log(ctx, tid, actor, "inventory.update_procurement_settings", "procurement_settings", tid, in)
+	return s.GetSettings(ctx, tenantID)
+}
+
+// Reorder levels
+
+type ReorderRule struct {
+	Level int32
+	// Quantity is how much to order each time; without it the order brings
+	// stock up to twice the level.
+	Quantity            int32
+	PreferredSupplierID string
+}
+
+func (s *ProcurementService) SetReorderRule(ctx context.Context, tenantID, itemID string, rule ReorderRule, actor Actor) error {
+	if rule.Level < 0 || rule.Quantity < 0 {
+		return fmt.Errorf("%w: reorder level and quantity cannot be negative", ErrInvalidStock)
+	}
+	tid := toPgUUID(tenantID)
+	supplier := toPgUUID(rule.PreferredSupplierID)
+	if supplier.Valid {
+		ok, err := s.q.InventorySupplierExists(ctx, tid, supplier)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("%w: preferred supplier", ErrInvalidStock)
+		}
+	}
+	iid := toPgUUID(itemID)
+	err := s.q.SetInventoryItemReorder(ctx, db.SetInventoryItemReorderParams{
+		TenantID:            tid,
+		ItemID:              iid,
+		ReorderLevel:        rule.Level,
+		ReorderQuantity:     pgtype.Int4{Int32: rule.Quantity, Valid: rule.Quantity > 0},
+		PreferredSupplierID: supplier,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrItemNotFound
+	}
+	if err != nil {
+		return err
+	}
+	s.stock.log(ctx, tid, actor, "inventory.set_reorder_rule", "inventory_item", iid, rule)
+	return nil
+}
+
+type ReorderSuggestion struct {
+	ItemID        pgtype.UUID `json:"item_id"`
+	ItemName      string      `json:"item_name"`
+	Sku           pgtype.Text `json:"sku"`
+	Unit          pgtype.Text `json:"unit"`
+	ReorderLevel  int32       `json:"reorder_level"`
+	OnHand        int64       `json:"on_hand"`
+	OnOrder       int64       `json:"on_order"`
+	OrderQuantity int32       `json:"order_quantity"`
+	SupplierID    pgtype.UUID `json:"supplier_id"`
+	SupplierName  pgtype.Text `json:"supplier_name"`
+	UnitCost      float64     `json:"unit_cost"`
+}
+
+// orderQuantity is what to order for an item at or below its level: its
+// reorder quantity, or enough to bring it to twice the level.
+func orderQuantity(c db.ReorderCandidate) int32 {
+	if c.ReorderQuantity.Valid && c.ReorderQuantity.Int32 > 0 {
+		return c.ReorderQuantity.Int32
+	}
+	need := 2*int64(c.ReorderLevel) - c.OnHand - c.OnOrder
+	return int32(max(need, 1))
+}
+
+func suggestion(c db.ReorderCandidate) ReorderSuggestion {
+	return ReorderSuggestion{
+		ItemID: c.ItemID, ItemName: c.ItemName, Sku: c.Sku, Unit: c.Unit, ReorderLevel: c.ReorderLevel,
+		OnHand: c.OnHand, OnOrder: c.OnOrder, OrderQuantity: orderQuantity(c),
+		SupplierID: c.SupplierID, SupplierName: c.SupplierName, UnitCost: rupees(c.LastCost),
+	}
+}
+
+func (s *ProcurementService) ReorderSuggestions(ctx context.Context, tenantID string) ([]ReorderSuggestion, error) {
+	candidates, err := s.q.ListReorderCandidates(ctx, toPgUUID(tenantID))
+	if err != nil {
+		return nil, err
+	}
+	out := make([]ReorderSuggestion, 0, len(candidates))
+	for _, c := range candidates {
+		out = append(out, suggestion(c))
+	}
+	return out, nil
+}
+
+type ReorderOrder struct {
+	POID         pgtype.UUID         `json:"po_id"`
+	PONumber     string              `json:"po_number"`
+	SupplierID   pgtype.UUID         `json:"supplier_id"`
+	SupplierName string              `json:"supplier_name"`
+	Items        []ReorderSuggestion `json:"items"`
+	TotalAmount  float64             `json:"total_amount"`
+}
+
+// ReorderRun is what a run drafted. Items with no supplier to order from
+// are listed for someone to order by hand.
+type ReorderRun struct {
+	Orders     []ReorderOrder      `json:"orders"`
+	Unassigned []ReorderSuggestion `json:"unassigned"`
+}
+
+// DraftReorders drafts one purchase order per supplier for every item at
+// or below its reorder level. Drafts count as stock on order, so running
+// again does not order the same shortfall twice.
+func (s *ProcurementService) DraftReorders(ctx context.Context, tenantID string, actor Actor) (ReorderRun, error) {
+	tid := toPgUUID(tenantID)
+	run := ReorderRun{Orders: []ReorderOrder{}, Unassigned: []ReorderSuggestion{}}
+	err := s.stock.inTx(ctx, func(q *db.Queries) error {
+		if err := q.LockTenantReorder(ctx, tid); err != nil {
+			return err
+		}
+		candidates, err := q.ListReorderCandidates(ctx, tid)
+		if err != nil {
+			return err
+		}
+		bySupplier := map[pgtype.UUID]int{}
+		for _, c := range candidates {
+			sg := suggestion(c)
+			if !c.SupplierID.Valid {
+				run.Unassigned = append(run.Unassigned, sg)
+				continue
+			}
+			i, ok := bySupplier[c.SupplierID]
+			if !ok {
+				i = len(run.Orders)
+				bySupplier[c.SupplierID] = i
+				run.Orders = append(run.Orders, ReorderOrder{SupplierID: c.SupplierID, SupplierName: c.SupplierName.String})
+			}
+			run.Orders[i].Items = append(run.Orders[i].Items, sg)
+		}
+		for i := range run.Orders {
+			o := &run.Orders[i]
+			o.POID, err = q.CreateAutoPurchaseOrder(ctx, tid, o.SupplierID, optionalText("Drafted from reorder levels"))
+			if err != nil {
+				return err
+			}
+			var total int64
+			for _, it := range o.Items {
+				cost := paise(it.UnitCost)
+				if _, err := q.CreatePurchaseOrderItem(ctx, db.CreatePurchaseOrderItemParams{
+					PoID:      o.POID,
+					ItemID:    it.ItemID,
+					Quantity:  it.OrderQuantity,
+					UnitPrice: numericRupees(cost),
+				}); err != nil {
+					return err
+				}
+				total += cost * int64(it.OrderQuantity)
+			}
+			if err := q.SetPurchaseOrderDelivery(ctx, o.POID, pgtype.UUID{}, pgtype.Date{}); err != nil {
+				return err
+			}
+			po, err := q.GetProcurementOrder(ctx, tid, o.POID)
+			if err != nil {
+				return err
+			}
+			o.PONumber, o.TotalAmount = po.PoNumber, rupees(total)
+		}
+		return nil
+	})
+	if err != nil {
+		return ReorderRun{}, err
+	}
+	for _, o := range run.Orders {
+		s.stock.log(ctx, tid, actor, "inventory.draft_reorder_po", "purchase_order", o.POID, o)
+	}
+	return run, nil
+}
+
+// StartReorderWorker drafts reorders for schools that asked for it every
+// few hours until ctx is cancelled.
+func (s *ProcurementService) StartReorderWorker(ctx context.Context) {
+	ticker := time.NewTicker(reorderInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.RunAutoReorder(ctx)
+		}
+	}
+}
+
+func (s *ProcurementService) RunAutoReorder(ctx context.Context) {
+	tenants, err := s.q.ListAutoReorderTenants(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to list tenants for automatic reorder")
+		return
+	}
+	for _, tid := range tenants {
+		run, err := s.DraftReorders(ctx, tid.String(), Actor{})
+		if err != nil {
+			log.Error().Err(err).Str("tenant_id", tid.String()).Msg("automatic reorder failed")
+			continue
+		}
+		if len(run.Orders) > 0 || len(run.Unassigned) > 0 {
+			log.Info().Str("tenant_id", tid.String()).Int("orders", len(run.Orders)).
+				Int("unassigned", len(run.Unassigned)).Msg("drafted reorder purchase orders")
+		}
+	}
+}
+
+// Purchase orders
+
+type OrderLine struct {
+	ID               pgtype.UUID `json:"id"`
+	ItemID           pgtype.UUID `json:"item_id"`
+	ItemName         string      `json:"item_name"`
+	Sku              pgtype.Text `json:"sku"`
+	Unit             pgtype.Text `json:"unit"`
+	Quantity         int32       `json:"quantity"`
+	UnitPrice        float64     `json:"unit_price"`
+	ReceivedQuantity int32       `json:"received_quantity"`
+	RejectedQuantity int32       `json:"rejected_quantity"`
+	Outstanding      int32       `json:"outstanding"`
+	InvoicedQuantity int32       `json:"invoiced_quantity"`
+}
+
+type GoodsReceipt struct {
+	ID            pgtype.UUID            `json:"id"`
+	ReceiptNumber string                 `json:"receipt_number"`
+	StoreID       pgtype.UUID            `json:"store_id"`
+	StoreName     string                 `json:"store_name"`
+	Notes         pgtype.Text            `json:"notes"`
+	ReceivedBy    pgtype.UUID            `json:"received_by"`
+	ReceivedAt    pgtype.Timestamptz     `json:"received_at"`
+	Items         []GoodsReceiptLineView `json:"items"`
+}
+
+type GoodsReceiptLineView struct {
+	POItemID          pgtype.UUID `json:"po_item_id"`
+	ItemID            pgtype.UUID `json:"item_id"`
+	ItemName          string      `json:"item_name"`
+	DeliveredQuantity int32       `json:"delivered_quantity"`
+	RejectedQuantity  int32       `json:"rejected_quantity"`
+	RejectionReason   pgtype.Text `json:"rejection_reason"`
+}
+
+type PurchaseOrderDetail struct {
+	ID            pgtype.UUID        `json:"id"`
+	PONumber      string             `json:"po_number"`
+	SupplierID    pgtype.UUID        `json:"supplier_id"`
+	SupplierName  pgtype.Text        `json:"supplier_name"`
+	Status        string             `json:"status"`
+	TotalAmount   float64            `json:"total_amount"`
+	StoreID       pgtype.UUID        `json:"store_id"`
+	StoreName     pgtype.Text        `json:"store_name"`
+	ExpectedDate  pgtype.Date        `json:"expected_date"`
+	AutoGenerated bool               `json:"auto_generated"`
+	Notes         pgtype.Text        `json:"notes"`
+	ApprovedAt    pgtype.Timestamptz `json:"approved_at"`
+	ReceivedAt    pgtype.Timestamptz `json:"received_at"`
+	CreatedAt     pgtype.Timestamptz `json:"created_at"`
+	Items         []OrderLine        `json:"items"`
+	Receipts      []GoodsReceipt     `json:"receipts"`
+	Invoices      []Invoice          `json:"invoices"`
+}
+
+func (s *ProcurementService) GetPurchaseOrder(ctx context.Context, tenantID, poID string) (PurchaseOrderDetail, error) {
+	tid := toPgUUID(tenantID)
+	po, err := s.q.GetProcurementOrder(ctx, tid, toPgUUID(poID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return PurchaseOrderDetail{}, ErrPurchaseOrderNotFound
+	}
+	if err != nil {
+		return PurchaseOrderDetail{}, err
+	}
+	detail := PurchaseOrderDetail{
+		ID: po.ID, PONumber: po.PoNumber, SupplierID: po.SupplierID, SupplierName: po.SupplierName, Status: po.Status,
+		TotalAmount: rupees(po.TotalAmount), StoreID: po.StoreID, StoreName: po.StoreName, ExpectedDate: po.ExpectedDate,
+		AutoGenerated: po.AutoGenerated, Notes: po.Notes, ApprovedAt: po.ApprovedAt, ReceivedAt: po.ReceivedAt,
+		CreatedAt: po.CreatedAt, Items: []OrderLine{}, Receipts: []GoodsReceipt{}, Invoices: []Invoice{},
+	}
+	lines, err := s.q.ListPurchaseOrderLines(ctx, po.ID)
+	if err != nil {
+		return PurchaseOrderDetail{}, err
+	}
+	for _, l := range lines {
+		detail.Items = append(detail.Items, OrderLine{
+			ID: l.ID, ItemID: l.ItemID, ItemName: l.ItemName, Sku: l.Sku, Unit: l.Unit, Quantity: l.Quantity,
+			UnitPrice: rupees(l.UnitPrice), ReceivedQuantity: l.ReceivedQuantity, RejectedQuantity: l.RejectedQuantity,
+			Outstanding: max(l.Quantity-l.ReceivedQuantity, 0), InvoicedQuantity: l.InvoicedQuantity,
+		})
+	}
+	receipts, err := s.q.ListPurchaseReceiptLines(ctx, po.ID)
+	if err != nil {
+		return PurchaseOrderDetail{}, err
+	}
+	for _, r := range receipts {
+		n := len(detail.Receipts)
+		if n == 0 || detail.Receipts[n-1].ID != r.ReceiptID {
+			detail.Receipts = append(detail.Receipts, GoodsReceipt{
+				ID: r.ReceiptID, ReceiptNumber: r.ReceiptNumber, StoreID: r.StoreID, StoreName: r.StoreName,
+				Notes: r.Notes, ReceivedBy: r.ReceivedBy, ReceivedAt: r.ReceivedAt,
+			})
+			n++
+		}
+		detail.Receipts[n-1].Items = append(detail.Receipts[n-1].Items, GoodsReceiptLineView{
+			POItemID: r.POItemID, ItemID: r.ItemID, ItemName: r.ItemName, DeliveredQuantity: r.DeliveredQuantity,
+			RejectedQuantity: r.RejectedQuantity, RejectionReason: r.RejectionReason,
+		})
+	}
+	invoices, err := s.q.ListSupplierInvoices(ctx, db.ListSupplierInvoicesParams{TenantID: tid, PoID: po.ID})
+	if err != nil {
+		return PurchaseOrderDetail{}, err
+	}
+	for _, inv := range invoices {
+		detail.Invoices = append(detail.Invoices, invoiceView(inv))
+	}
+	return detail, nil
+}
+
+type GoodsReceiptLineInput struct {
+	POItemID          string
+	DeliveredQuantity int32
+	RejectedQuantity  int32
+	RejectionReason   string
+}
+
+// GoodsReceiptInput records a delivery. Without lines, everything still
+// outstanding on the order arrived and was accepted.
+type GoodsReceiptInput struct {
+	StoreID string
+	Notes   string
+	Lines   []GoodsReceiptLineInput
+}
+
+// ReceiveGoods books a delivery against an approved order. Accepted goods
+// go into stock at the order price; rejected goods stay outstanding for the
+// supplier to replace. The order is received once every line is in, and
+// invoices held for goods not yet received are matched again.
+func (s *ProcurementService) ReceiveGoods(ctx context.Context, tenantID, poID string, in GoodsReceiptInput, actor Actor) (PurchaseOrderDetail, error) {
+	tid, id := toPgUUID(tenantID), toPgUUID(poID)
+	by := toPgUUID(actor.UserID)
+	var receiptID pgtype.UUID
+	err := s.stock.inTx(ctx, func(q *db.Queries) error {
+		po, err := q.LockProcurementOrder(ctx, tid, id)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrPurchaseOrderNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if po.Status != "approved" && po.Status != "partially_received" {
+			return fmt.Errorf("%w: %s is %s", ErrPurchaseOrderState, po.PoNumber, po.Status)
+		}
+		lines, err := q.ListPurchaseOrderLines(ctx, po.ID)
+		if err != nil {
+			return err
+		}
+		byID := map[pgtype.UUID]db.PurchaseOrderLine{}
+		for _, l := range lines {
+			byID[l.ID] = l
+		}
+		receipt := in.Lines
+		if len(receipt) == 0 {
+			for _, l := range lines {
+				if out := l.Quantity - l.ReceivedQuantity; out > 0 {
+					receipt = append(receipt, GoodsReceiptLineInput{POItemID: l.ID.String(), DeliveredQuantity: out})
+				}
+			}
+			if len(receipt) == 0 {
+				return fmt.Errorf("%w: nothing is outstanding on %s", ErrPurchaseOrderState, po.PoNumber)
+			}
+		}
+
+		storeID := in.StoreID
+		if storeID == "" && po.StoreID.Valid {
+			storeID = po.StoreID.String()
+		}
+		store, err := s.stock.resolveStore(ctx, q, tid, storeID, "")
+		if err != nil {
+			return err
+		}
+		var number string
+		receiptID, number, err = q.CreatePurchaseReceipt(ctx, tid, po.ID, store.ID, optionalText(in.Notes), by)
+		if err != nil {
+			return err
+		}
+
+		seen := map[pgtype.UUID]bool{}
+		for _, r := range receipt {
+			l, ok := byID[toPgUUID(r.POItemID)]
+			if !ok {
+				return fmt.Errorf("%w: line %s is not on %s", ErrInvalidStock, r.POItemID, po.PoNumber)
+			}
+			if seen[l.ID] {
+				return fmt.Errorf("%w: %s is listed twice", ErrInvalidStock, l.ItemName)
+			}
+			seen[l.ID] = true
+			if r.DeliveredQuantity <= 0 || r.RejectedQuantity < 0 || r.RejectedQuantity > r.DeliveredQuantity {
+				return fmt.Errorf("%w: %s: delivered must be positive and rejected between zero and delivered", ErrInvalidStock, l.ItemName)
+			}
+			if r.RejectedQuantity > 0 && strings.TrimSpace(r.RejectionReason) == "" {
+				return fmt.Errorf("%w: %s: a rejection needs a reason", ErrInvalidStock, l.ItemName)
+			}
+			accepted := r.DeliveredQuantity - r.RejectedQuantity
+			if outstanding := l.Quantity - l.ReceivedQuantity; accepted > outstanding {
+				return fmt.Errorf("%w: %s: accepting %d, only %d outstanding", ErrInvalidStock, l.ItemName, accepted, outstanding)
+			}
+
+			var txnID pgtype.UUID
+			if accepted > 0 {
+				posted, err := s.stock.post(ctx, q, tid, movement{
+					ItemID:        l.ItemID,
+					StoreID:       store.ID,
+					Type:          txnIn,
+					Delta:         accepted,
+					Value:         l.UnitPrice * int64(accepted),
+					UnitPrice:     numericRupees(l.UnitPrice),
+					SupplierID:    po.SupplierID,
+					ReferenceID:   po.ID,
+					ReferenceType: "purchase_order",
+					Remarks:       "Received on " + number + " against " + po.PoNumber,
+					CreatedBy:     by,
+				})
+				if err != nil {
+					return fmt.Errorf("%s: %w", l.ItemName, err)
+				}
+				txnID = posted.Txn.ID
+			}
+			if err := q.CreatePurchaseReceiptItem(ctx, db.CreatePurchaseReceiptItemParams{
+				ReceiptID:         receiptID,
+				POItemID:          l.ID,
+				ItemID:            l.ItemID,
+				DeliveredQuantity: r.DeliveredQuantity,
+				RejectedQuantity:  r.RejectedQuantity,
+				RejectionReason:   optionalText(r.RejectionReason),
+				TransactionID:     txnID,
+			}); err != nil {
+				return err
+			}
+			if err := q.RecordPurchaseOrderLineReceipt(ctx, l.ID, accepted, r.RejectedQuantity); err != nil {
+				return err
+			}
+			l.ReceivedQuantity += accepted
+			byID[l.ID] = l
+		}
+
+		status := "received"
+		for _, l := range byID {
+			if l.ReceivedQuantity < l.Quantity {
+				status = "partially_received"
+				break
+			}
+		}
+		if err := q.SetPurchaseOrderStatus(ctx, po.ID, status); err != nil {
+			return err
+		}
+		return s.rematch(ctx, q, tid, po.ID)
+	})
+	if err != nil {
+		return PurchaseOrderDetail{}, err
+	}
+	detail, err := s.GetPurchaseOrder(ctx, tenantID, poID)
+	if err == nil {
+		s.stock.log(ctx, tid, actor, "inventory.receive_po", "purchase_order", id, map[string]any{
+			"receipt_id": receiptID, "status": detail.Status,
+		})
+	}
+	return detail, err
+}
+
+// ClosePurchaseOrder closes an order short when the rest of it will not
+// be delivered.
+func (s *ProcurementService) ClosePurchaseOrder(ctx context.Context, tenantID, poID, reason string, actor Actor) (PurchaseOrderDetail, error) {
+	tid, id := toPgUUID(tenantID), toPgUUID(poID)
+	err := s.stock.inTx(ctx, func(q *db.Queries) error {
+		po, err := q.LockProcurementOrder(ctx, tid, id)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrPurchaseOrderNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if po.Status != "approved" && po.Status != "partially_received" {
+			return fmt.Errorf("%w: %s is %s", ErrPurchaseOrderState, po.PoNumber, po.Status)
+		}
+		return q.SetPurchaseOrderStatus(ctx, po.ID, "closed")
+	})
+	if err != nil {
+		return PurchaseOrderDetail{}, err
+	}
+	s.stock.log(ctx, tid, actor, "inventory.close_po", "purchase_order", id, map[string]string{"reason": reason})
+	return s.GetPurchaseOrder(ctx, tenantID, poID)
+}
+
+// Supplier invoices
+
+type InvoiceLineInput struct {
+	POItemID  string
+	Quantity  int32
+	UnitPrice float64
+}
+
+type InvoiceInput struct {
+	POID          string
+	InvoiceNumber string
+	InvoiceDate   string
+	TaxAmount     float64
+	// TotalAmount is the total printed on the invoice; without it the lines
+	// plus tax are taken.
+	TotalAmount float64
+	Notes       string
+	Lines       []InvoiceLineInput
+}
+
+type InvoiceLine struct {
+	ID        pgtype.UUID `json:"id"`
+	POItemID  pgtype.UUID `json:"po_item_id"`
+	ItemID    pgtype.UUID `json:"item_id"`
+	ItemName  string      `json:"item_name"`
+	Quantity  int32       `json:"quantity"`
+	UnitPrice float64     `json:"unit_price"`
+	Amount    float64     `json:"amount"`
+}
+
+type Invoice struct {
+	ID             pgtype.UUID        `json:"id"`
+	SupplierID     pgtype.UUID        `json:"supplier_id"`
+	SupplierName   string             `json:"supplier_name"`
+	POID           pgtype.UUID        `json:"po_id"`
+	PONumber       string             `json:"po_number"`
+	InvoiceNumber  string             `json:"invoice_number"`
+	InvoiceDate    pgtype.Date        `json:"invoice_date"`
+	Subtotal       float64            `json:"subtotal"`
+	TaxAmount      float64            `json:"tax_amount"`
+	TotalAmount    float64            `json:"total_amount"`
+	Status         string             `json:"status"`
+	Exceptions     []MatchException   `json:"exceptions"`
+	Notes          pgtype.Text        `json:"notes"`
+	DecidedBy      pgtype.UUID        `json:"decided_by"`
+	DecidedAt      pgtype.Timestamptz `json:"decided_at"`
+	DecisionReason pgtype.Text        `json:"decision_reason"`
+	CreatedAt      pgtype.Timestamptz `json:"created_at"`
+	Items          []InvoiceLine      `json:"items,omitempty"`
+}
+
+func invoiceView(i db.SupplierInvoice) Invoice {
+	v := Invoice{
+		ID: i.ID, SupplierID: i.SupplierID, SupplierName: i.SupplierName, POID: i.PoID, PONumber: i.PoNumber,
+		InvoiceNumber: i.InvoiceNumber, InvoiceDate: i.InvoiceDate, Subtotal: rupees(i.Subtotal),
+		TaxAmount: rupees(i.TaxAmount), TotalAmount: rupees(i.TotalAmount), Status: i.Status, Notes: i.Notes,
+		DecidedBy: i.DecidedBy, DecidedAt: i.DecidedAt, DecisionReason: i.DecisionReason, CreatedAt: i.CreatedAt,
+	}
+	if err := json.Unmarshal(i.Exceptions, &v.Exceptions); err != nil || v.Exceptions == nil {
+		v.Exceptions = []MatchException{}
+	}
+	return v
+}
+
+func matchStatus(exceptions []MatchException) string {
+	if len(exceptions) == 0 {
+		return "matched"
+	}
+	return "exception"
+}
+
+// RecordInvoice captures a supplier's invoice against an order and matches
+// it. An invoice that does not match is held as an exception until goods
+// arrive to cover it or someone approves it anyway.
+func (s *ProcurementService) RecordInvoice(ctx context.Context, tenantID string, in InvoiceInput, actor Actor) (Invoice, error) {
+	number := strings.TrimSpace(in.InvoiceNumber)
+	switch {
+	case in.POID == "" || number == "":
+		return Invoice{}, fmt.Errorf("%w: po_id and invoice_number are required", ErrInvalidStock)
+	case len(in.Lines) == 0:
+		return Invoice{}, fmt.Errorf("%w: at least one line is required", ErrInvalidStock)
+	case in.TaxAmount < 0 || in.TotalAmount < 0:
+		return Invoice{}, fmt.Errorf("%w: amounts cannot be negative", ErrInvalidStock)
+	}
+	date, err := time.Parse("2006-01-02", in.InvoiceDate)
+	if err != nil {
+		return Invoice{}, fmt.Errorf("%w: invoice_date must be a date (YYYY-MM-DD)", ErrInvalidStock)
+	}
+	tid := toPgUUID(tenantID)
+	var id pgtype.UUID
+	err = s.stock.inTx(ctx, func(q *db.Queries) error {
+		po, err := q.LockProcurementOrder(ctx, tid, toPgUUID(in.POID))
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrPurchaseOrderNotFound
+		}
+		if err != nil {
+			return err
+		}
+		switch {
+		case po.Status != "approved" && po.Status != "partially_received" && po.Status != "received" && po.Status != "closed":
+			return fmt.Errorf("%w: %s is %s", ErrPurchaseOrderState, po.PoNumber, po.Status)
+		case !po.SupplierID.Valid:
+			return fmt.Errorf("%w: %s has no supplier", ErrPurchaseOrderState, po.PoNumber)
+		}
+		settings, err := q.GetProcurementSettings(ctx, tid)
+		if err != nil {
+			return err
+		}
+		lines, err := q.ListPurchaseOrderLines(ctx, po.ID)
+		if err != nil {
+			return err
+		}
+		byID := map[pgtype.UUID]db.PurchaseOrderLine{}
+		for _, l := range lines {
+			byID[l.ID] = l
+		}
+
+		var match []matchLine
+		var subtotal int64
+		for _, il := range in.Lines {
+			l, ok := byID[toPgUUID(il.POItemID)]
+			if !ok {
+				return fmt.Errorf("%w: line %s is not on %s", ErrInvalidStock, il.POItemID, po.PoNumber)
+			}
+			if il.Quantity <= 0 || il.UnitPrice < 0 {
+				return fmt.Errorf("%w: %s: quantity must be positive and price zero or more", ErrInvalidStock, l.ItemName)
+			}
+			for _, m := range match {
+				if m.POItemID == l.ID {
+					return fmt.Errorf("%w: %s is billed twice", ErrInvalidStock, l.ItemName)
+				}
+			}
+			price := paise(il.UnitPrice)
+			subtotal += price * int64(il.Quantity)
+			match = append(match, matchLine{
+				POItemID: l.ID, ItemName: l.ItemName, Quantity: il.Quantity, UnitPrice: price,
+				OrderPrice: l.UnitPrice, Accepted: l.ReceivedQuantity, BilledElsewhere: l.InvoicedQuantity,
+			})
+		}
+		tax := paise(in.TaxAmount)
+		total := subtotal + tax
+		if in.TotalAmount > 0 {
+			total = paise(in.TotalAmount)
+		}
+		exceptions := matchInvoice(match, tax, total, tolerance(settings))
+		raw, err := json.Marshal(exceptions)
+		if err != nil {
+			return err
+		}
+		id, err = q.CreateSupplierInvoice(ctx, db.CreateSupplierInvoiceParams{
+			TenantID:      tid,
+			SupplierID:    po.SupplierID,
+			PoID:          po.ID,
+			InvoiceNumber: number,
+			InvoiceDate:   pgtype.Date{Time: date, Valid: true},
+			Subtotal:      subtotal,
+			TaxAmount:     tax,
+			TotalAmount:   total,
+			Status:        matchStatus(exceptions),
+			Exceptions:    raw,
+			Notes:         optionalText(in.Notes),
+			CreatedBy:     toPgUUID(actor.UserID),
+		})
+		if isUniqueViolation(err) {
+			return fmt.Errorf("%w: %s from %s", ErrDuplicateInvoice, number, po.SupplierName.String)
+		}
+		if err != nil {
+			return err
+		}
+		for i, il := range in.Lines {
+			l := byID[toPgUUID(il.POItemID)]
+			if err := q.CreateSupplierInvoiceItem(ctx, id, l.ID, l.ItemID, il.Quantity, match[i].UnitPrice); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return Invoice{}, err
+	}
+	inv, err := s.GetInvoice(ctx, tenantID, id.String())
+	if err == nil {
+		s.stock.log(ctx, tid, actor, "inventory.record_supplier_invoice", "supplier_invoice", id, map[string]any{
+			"invoice_number": inv.InvoiceNumber, "status": inv.Status, "total_amount": inv.TotalAmount,
+		})
+	}
+	return inv, err
+}
+
+// rematch matches an order's held invoices again, after a delivery.
+func (s *ProcurementService) rematch(ctx context.Context, q *db.Queries, tid, poID pgtype.UUID) error {
+	held, err := q.ListInvoiceExceptionsForOrder(ctx, poID)
+	if err != nil || len(held) == 0 {
+		return err
+	}
+	settings, err := q.GetProcurementSettings(ctx, tid)
+	if err != nil {
+		return err
+	}
+	lines, err := q.ListPurchaseOrderLines(ctx, poID)
+	if err != nil {
+		return err
+	}
+	byID := map[pgtype.UUID]db.PurchaseOrderLine{}
+	for _, l := range lines {
+		byID[l.ID] = l
+	}
+	for _, id := range held {
+		inv, err := q.GetSupplierInvoice(ctx, tid, id)
+		if err != nil {
+			return err
+		}
+		invLines, err := q.ListSupplierInvoiceLines(ctx, id)
+		if err != nil {
+			return err
+		}
+		var match []matchLine
+		for _, il := range invLines {
+			l := byID[il.POItemID]
+			match = append(match, matchLine{
+				POItemID: l.ID, ItemName: l.ItemName, Quantity: il.Quantity, UnitPrice: il.UnitPrice,
+				OrderPrice: l.UnitPrice, Accepted: l.ReceivedQuantity,
+				BilledElsewhere: l.InvoicedQuantity - il.Quantity,
+			})
+		}
+		exceptions := matchInvoice(match, inv.TaxAmount, inv.TotalAmount, tolerance(settings))
+		raw, err := json.Marshal(exceptions)
+		if err != nil {
+			return err
+		}
+		if err := q.SetSupplierInvoiceMatch(ctx, id, matchStatus(exceptions), raw); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ApproveInvoice passes an invoice for payment. One held on exceptions can
+// only be approved with a reason, which is kept with it.
+func (s *ProcurementService) ApproveInvoice(ctx context.Context, tenantID, invoiceID, reason string, actor Actor) (Invoice, error) {
+	return s.decideInvoice(ctx, tenantID, invoiceID, "approved", reason, actor)
+}
+
+func (s *ProcurementService) RejectInvoice(ctx context.Context, tenantID, invoiceID, reason string, actor Actor) (Invoice, error) {
+	if strings.TrimSpace(reason) == "" {
+		return Invoice{}, fmt.Errorf("%w: a reason is required", ErrInvalidStock)
+	}
+	return s.decideInvoice(ctx, tenantID, invoiceID, "rejected", reason, actor)
+}
+
+func (s *ProcurementService) decideInvoice(ctx context.Context, tenantID, invoiceID, status, reason string, actor Actor) (Invoice, error) {
+	tid, id := toPgUUID(tenantID), toPgUUID(invoiceID)
+	var from string
+	err := s.stock.inTx(ctx, func(q *db.Queries) error {
+		inv, err := q.LockSupplierInvoice(ctx, tid, id)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrInvoiceNotFound
+		}
+		if err != nil {
+			return err
+		}
+		from = inv.Status
+		switch {
+		case inv.Status != "matched" && inv.Status != "exception":
+			return fmt.Errorf("%w: invoice %s is %s", ErrInvoiceState, inv.InvoiceNumber, inv.Status)
+		case status == "approved" && inv.Status == "exception" && strings.TrimSpace(reason) == "":
+			return fmt.Errorf("%w: invoice %s does not match; approving it needs a reason", ErrInvoiceState, inv.InvoiceNumber)
+		}
+		return q.DecideSupplierInvoice(ctx, id, status, toPgUUID(actor.UserID), optionalText(reason))
+	})
+	if err != nil {
+		return Invoice{}, err
+	}
+	s.stock.log(ctx, tid, actor, "inventory."+strings.TrimSuffix(status, "d")+"_supplier_invoice", "supplier_invoice", id,
+		map[string]string{"from": from, "to": status, "reason": reason})
+	return s.GetInvoice(ctx, tenantID, invoiceID)
+}
+
+func (s *ProcurementService) GetInvoice(ctx context.Context, tenantID, invoiceID string) (Invoice, error) {
+	inv, err := s.q.GetSupplierInvoice(ctx, toPgUUID(tenantID), toPgUUID(invoiceID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Invoice{}, ErrInvoiceNotFound
+	}
+	if err != nil {
+		return Invoice{}, err
+	}
+	lines, err := s.q.ListSupplierInvoiceLines(ctx, inv.ID)
+	if err != nil {
+		return Invoice{}, err
+	}
+	v := invoiceView(inv)
+	v.Items = make([]InvoiceLine, 0, len(lines))
+	for _, l := range lines {
+		v.Items = append(v.Items, InvoiceLine{
+			ID: l.ID, POItemID: l.POItemID, ItemID: l.ItemID, ItemName: l.ItemName, Quantity: l.Quantity,
+			UnitPrice: rupees(l.UnitPrice), Amount: rupees(l.UnitPrice * int64(l.Quantity)),
+		})
+	}
+	return v, nil
+}
+
+type InvoiceFilter struct {
+	SupplierID string
+	POID       string
+	Status     string
+}
+
+func (s *ProcurementService) ListInvoices(ctx context.Context, tenantID string, f InvoiceFilter) ([]Invoice, error) {
+	invoices, err := s.q.ListSupplierInvoices(ctx, db.ListSupplierInvoicesParams{
+		TenantID:   toPgUUID(tenantID),
+		SupplierID: toPgUUID(f.SupplierID),
+		PoID:       toPgUUID(f.POID),
+		Status:     optionalText(f.Status),
+	})
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Invoice, 0, len(invoices))
+	for _, inv := range invoices {
+		out = append(out, invoiceView(inv))
+	}
+	return out, nil
+}
+
+// Supplier performance
+
+type SupplierMetrics struct {
+	SupplierID           pgtype.UUID `json:"supplier_id"`
+	SupplierName         string      `json:"supplier_name"`
+	Orders               int64       `json:"orders"`
+	OrderedQuantity      int64       `json:"ordered_quantity"`
+	DeliveredQuantity    int64       `json:"delivered_quantity"`
+	RejectedQuantity     int64       `json:"rejected_quantity"`
+	AvgLeadTimeDays      *float64    `json:"avg_lead_time_days"`
+	OnTimeRate           *float64    `json:"on_time_rate"`
+	RejectionRate        *float64    `json:"rejection_rate"`
+	FillRate             *float64    `json:"fill_rate"`
+	Invoices             int64       `json:"invoices"`
+	InvoiceExceptionRate *float64    `json:"invoice_exception_rate"`
+}
+
+// percent is part of whole as a percentage to one decimal place, or nil
+// when there is nothing to measure.
+func percent(part, whole int64) *float64 {
+	if whole <= 0 {
+		return nil
+	}
+	v := math.Round(float64(part)*1000/float64(whole)) / 10
+	return &v
+}
+
+func supplierMetrics(r db.SupplierPerformanceRow) SupplierMetrics {
+	m := SupplierMetrics{
+		SupplierID: r.SupplierID, SupplierName: r.SupplierName, Orders: r.Orders, OrderedQuantity: r.OrderedQuantity,
+		DeliveredQuantity: r.DeliveredQuantity, RejectedQuantity: r.RejectedQuantity, Invoices: r.Invoices,
+		OnTimeRate:           percent(r.OnTimeOrders, r.DueOrders),
+		RejectionRate:        percent(r.RejectedQuantity, r.DeliveredQuantity),
+		FillRate:             percent(r.DeliveredQuantity-r.RejectedQuantity, r.OrderedQuantity),
+		InvoiceExceptionRate: percent(r.InvoiceExceptions, r.Invoices),
+	}
+	if r.AvgLeadTimeDays.Valid {
+		v := math.Round(r.AvgLeadTimeDays.Float64*10) / 10
+		m.AvgLeadTimeDays = &v
+	}
+	return m
+}
+
+// SupplierPerformance measures suppliers on the orders placed with them
+// between from and to, both optional dates.
+func (s *ProcurementService) SupplierPerformance(ctx context.Context, tenantID, from, to string) ([]SupplierMetrics, error) {
+	tid := toPgUUID(tenantID)
+	arg := db.SupplierPerformanceParams{TenantID: tid}
+	for _, d := range []struct {
+		in  string
+		out *pgtype.Date
+	}{{from, &arg.From}, {to, &arg.To}} {
+		if d.in == "" {
+			continue
+		}
+		t, err := time.Parse("2006-01-02", d.in)
+		if err != nil {
+			return nil, fmt.Errorf("%w: from and to must be dates (YYYY-MM-DD)", ErrInvalidStock)
+		}
+		*d.out = pgtype.Date{Time: t, Valid: true}
+	}
+	tz, err := s.q.GetSchoolTimezone(ctx, tid)
+	if err != nil {
+		return nil, err
+	}
+	arg.Timezone = tz
+	rows, err := s.q.SupplierPerformance(ctx, arg)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]SupplierMetrics, 0, len(rows))
+	for _, r := range rows {
+		out = append(out, supplierMetrics(r))
+	}
+	return out, nil
+}
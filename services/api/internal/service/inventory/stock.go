@@ -0,0 +1,486 @@
+package inventory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/schoolerp/api/internal/db"
+	"github.com/schoolerp/api/internal/foundation/audit"
+)
+
+var (
+	ErrInvalidStock      = errors.New("invalid inventory input")
+	ErrStoreNotFound     = errors.New("store not found")
+	ErrItemNotFound      = errors.New("item not found")
+	ErrInsufficientStock = errors.New("insufficient stock")
+	ErrValuationLocked   = errors.New("valuation method cannot change while the item is in stock")
+)
+
+const (
+	txnIn          = "in"
+	txnOut         = "out"
+	txnAdjustment  = "adjustment"
+	txnTransferOut = "transfer_out"
+	txnTransferIn  = "transfer_in"
+)
+
+// Actor identifies who made a change, for the audit log.
+type Actor struct {
+	UserID    string
+	RequestID string
+	IP        string
+}
+
+// StockService keeps stock per store: the stores themselves, the valued
+// movement ledger, transfers between stores and stock-takes.
+type StockService struct {
+	q     *db.Queries
+	pool  *pgxpool.Pool
+	audit *audit.Logger
+}
+
+func NewStockService(q *db.Queries, pool *pgxpool.Pool, audit *audit.Logger) *StockService {
+	return &StockService{q: q, pool: pool, audit: audit}
+}
+
+func toPgUUID(id string) pgtype.UUID {
+	var out pgtype.UUID
+	_ = out.Scan(strings.TrimSpace(id))
+	return out
+}
+
+func optionalText(v string) pgtype.Text {
+	v = strings.TrimSpace(v)
+	return pgtype.Text{String: v, Valid: v != ""}
+}
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+func (s *StockService) inTx(ctx context.Context, fn func(q *db.Queries) error) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+	if err := fn(s.q.WithTx(tx)); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (s *StockService) log(ctx context.Context, tenantID pgtype.UUID, actor Actor, action, resourceType string, resourceID pgtype.UUID, after any) {
+	if s.audit == nil {
+		return
+	}
+	_ = s.audit.Log(ctx, audit.Entry{
+		TenantID:     tenantID,
+		UserID:       toPgUUID(actor.UserID),
+		RequestID:    actor.RequestID,
+		Action:       action,
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+		After:        after,
+		IPAddress:    actor.IP,
+	})
+}
+
+// Stores
+
+type StoreInput struct {
+	Name        string
+	Code        string
+	Campus      string
+	Description string
+	InChargeID  string
+	IsDefault   bool
+	Active      bool
+}
+
+func (in StoreInput) validate() error {
+	switch {
+	case strings.TrimSpace(in.Name) == "":
+		return fmt.Errorf("%w: name is required", ErrInvalidStock)
+	case in.IsDefault && !in.Active:
+		return fmt.Errorf("%w: the default store must be active", ErrInvalidStock)
+	}
+	return nil
+}
+
+func (s *StockService) ListStores(ctx context.Context, tenantID string) ([]db.InventoryStore, error) {
+	tid := toPgUUID(tenantID)
+	// Tenants from before stores existed get their Main Store here.
+	if _, err := s.q.EnsureDefaultInventoryStore(ctx, tid); err != nil {
+		return nil, err
+	}
+	return s.q.ListInventoryStores(ctx, tid)
+}
+
+// SaveStore creates a store, or updates the one with storeID. A store that
+// holds stock cannot be deactivated.
+func (s *StockService) SaveStore(ctx context.Context, tenantID, storeID string, in StoreInput, actor Actor) (db.InventoryStore, error) {
+	if err := in.validate(); err != nil {
+		return db.InventoryStore{}, err
+	}
+	tid := toPgUUID(tenantID)
+	var store db.InventoryStore
+	err := s.inTx(ctx, func(q *db.Queries) error {
+		arg := db.SaveInventoryStoreParams{
+			TenantID:    tid,
+			Name:        strings.TrimSpace(in.Name),
+			Code:        optionalText(in.Code),
+			Campus:      optionalText(in.Campus),
+			Description: optionalText(in.Description),
+			InChargeID:  toPgUUID(in.InChargeID),
+			IsDefault:   in.IsDefault,
+			Active:      in.Active,
+		}
+		if storeID != "" {
+			current, err := q.GetInventoryStore(ctx, tid, toPgUUID(storeID))
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrStoreNotFound
+			}
+			if err != nil {
+				return err
+			}
+			if current.IsDefault && !in.IsDefault {
+				return fmt.Errorf("%w: make another store the default instead", ErrInvalidStock)
+			}
+			if current.Active && !in.Active {
+				positions, err := q.ListInventoryStockPositions(ctx, db.ListInventoryStockPositionsParams{TenantID: tid, StoreID: current.ID})
+				if err != nil {
+					return err
+				}
+				if len(positions) > 0 {
+					return fmt.Errorf("%w: the store still holds stock", ErrInvalidStock)
+				}
+			}
+			arg.ID = current.ID
+		}
+		var err error
+		store, err = q.SaveInventoryStore(ctx, arg)
+		if isUniqueViolation(err) {
+			return fmt.Errorf("%w: a store named %s already exists", ErrInvalidStock, arg.Name)
+		}
+		return err
+	})
+	if err != nil {
+		return db.InventoryStore{}, err
+	}
+	action := "inventory.create_store"
+	if storeID != "" {
+		action = "inventory.update_store"
+	}
+	s.log(ctx, tid, actor, action, "inventory_store", store.ID, store)
+	return store, nil
+}
+
+// resolveStore picks the store for a movement: the one given, else the one
+// named by location, created the first time a name is used so clients that
+// send free-text locations keep working, else the default store.
+func (s *StockService) resolveStore(ctx context.Context, q *db.Queries, tid pgtype.UUID, storeID, location string) (db.InventoryStore, error) {
+	var store db.InventoryStore
+	var err error
+	switch {
+	case strings.TrimSpace(storeID) != "":
+		store, err = q.GetInventoryStore(ctx, tid, toPgUUID(storeID))
+	case strings.TrimSpace(location) != "":
+		store, err = q.FindInventoryStoreByName(ctx, tid, location)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return q.SaveInventoryStore(ctx, db.SaveInventoryStoreParams{TenantID: tid, Name: strings.TrimSpace(location), Active: true})
+		}
+	default:
+		return q.EnsureDefaultInventoryStore(ctx, tid)
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		return store, ErrStoreNotFound
+	}
+	if err == nil && !store.Active {
+		return store, fmt.Errorf("%w: store %s is inactive", ErrInvalidStock, store.Name)
+	}
+	return store, err
+}
+
+// activeStore loads a store that can take part in a transfer or count.
+func activeStore(ctx context.Context, q *db.Queries, tid pgtype.UUID, storeID string) (db.InventoryStore, error) {
+	store, err := q.GetInventoryStore(ctx, tid, toPgUUID(storeID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return store, ErrStoreNotFound
+	}
+	if err == nil && !store.Active {
+		return store, fmt.Errorf("%w: store %s is inactive", ErrInvalidStock, store.Name)
+	}
+	return store, err
+}
+
+// Valuation method
+
+// SetValuationMethod switches an item between FIFO and weighted-average
+// costing. Stock on hand would otherwise be valued two ways, so the item
+// must be out of stock everywhere.
+func (s *StockService) SetValuationMethod(ctx context.Context, tenantID, itemID, method string, actor Actor) error {
+	if method != ValuationFIFO && method != ValuationWeightedAverage {
+		return fmt.Errorf("%w: method must be fifo or weighted_average", ErrInvalidStock)
+	}
+	tid, iid := toPgUUID(tenantID), toPgUUID(itemID)
+	current, err := s.q.GetInventoryItemValuation(ctx, tid, iid)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrItemNotFound
+	}
+	if err != nil || current == method {
+		return err
+	}
+	ok, err := s.q.SetInventoryItemValuation(ctx, tid, iid, method)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrValuationLocked
+	}
+	s.log(ctx, tid, actor, "inventory.set_valuation", "inventory_item", iid, map[string]any{"from": current, "to": method})
+	return nil
+}
+
+// Movements
+
+// movement is one change to an item's stock in a store.
+type movement struct {
+	ItemID  pgtype.UUID
+	StoreID pgtype.UUID
+	Type    string
+	// Delta is positive for stock coming in and negative going out.
+	Delta int32
+	// Value is the cost of stock coming in. FIFO items take it from Draws
+	// when they are given, keeping their costs and receipt dates.
+	Value         int64
+	Draws         []costDraw
+	UnitPrice     pgtype.Numeric
+	SupplierID    pgtype.UUID
+	ReferenceID   pgtype.UUID
+	ReferenceType string
+	Remarks       string
+	CreatedBy     pgtype.UUID
+}
+
+// postedMovement is the ledger entry with the value that moved, unsigned,
+// and for FIFO issues the layers it came from.
+type postedMovement struct {
+	Txn   db.InventoryTransaction
+	Value int64
+	Draws []costDraw
+}
+
+// post applies a movement to the store's balance, values it by the item's
+// method and writes it to the ledger. Stock cannot go below zero.
+func (s *StockService) post(ctx context.Context, q *db.Queries, tid pgtype.UUID, m movement) (postedMovement, error) {
+	if m.Delta == 0 {
+		return postedMovement{}, fmt.Errorf("%w: quantity must not be zero", ErrInvalidStock)
+	}
+	method, err := q.GetInventoryItemValuation(ctx, tid, m.ItemID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return postedMovement{}, ErrItemNotFound
+	}
+	if err != nil {
+		return postedMovement{}, err
+	}
+	bal, err := q.LockInventoryStock(ctx, tid, m.ItemID, m.StoreID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return postedMovement{}, ErrStoreNotFound
+	}
+	if err != nil {
+		return postedMovement{}, err
+	}
+
+	var out postedMovement
+	if m.Delta < 0 {
+		qty := -m.Delta
+		if bal.Quantity < qty {
+			return postedMovement{}, fmt.Errorf("%w: available %d, requested %d", ErrInsufficientStock, bal.Quantity, qty)
+		}
+		if method == ValuationFIFO {
+			layers, err := q.LockOpenInventoryCostLayers(ctx, m.ItemID, m.StoreID)
+			if err != nil {
+				return postedMovement{}, err
+			}
+			draws, left, err := drawFIFO(layers, qty)
+			if err != nil {
+				return postedMovement{}, err
+			}
+			for i, l := range layers {
+				if left[i] != l.Remaining {
+					if err := q.SetInventoryCostLayerRemaining(ctx, l.ID, left[i]); err != nil {
+						return postedMovement{}, err
+					}
+				}
+			}
+			out.Draws, out.Value = draws, drawsValue(draws)
+		} else {
+			out.Value = averageIssueCost(qty, bal.Quantity, bal.Value)
+		}
+		bal.Quantity -= qty
+		bal.Value -= out.Value
+	} else {
+		out.Value = m.Value
+		if method == ValuationFIFO {
+			out.Draws = m.Draws
+			if len(out.Draws) == 0 {
+				out.Draws = []costDraw{{Quantity: m.Delta, UnitCost: averageUnitCost(m.Delta, m.Value)}}
+			}
+			out.Value = drawsValue(out.Draws)
+		}
+		bal.Quantity += m.Delta
+		bal.Value += out.Value
+	}
+
+	signed := out.Value
+	if m.Delta < 0 {
+		signed = -signed
+	}
+	out.Txn, err = q.CreateInventoryMovement(ctx, db.CreateInventoryMovementParams{
+		TenantID:      tid,
+		ItemID:        m.ItemID,
+		StoreID:       m.StoreID,
+		Type:          m.Type,
+		Delta:         m.Delta,
+		UnitPrice:     m.UnitPrice,
+		Value:         signed,
+		SupplierID:    m.SupplierID,
+		ReferenceID:   m.ReferenceID,
+		ReferenceType: optionalText(m.ReferenceType),
+		Remarks:       optionalText(m.Remarks),
+		CreatedBy:     m.CreatedBy,
+	})
+	if err != nil {
+		return postedMovement{}, err
+	}
+	if m.Delta > 0 && method == ValuationFIFO {
+		for _, d := range out.Draws {
+			received := d.ReceivedAt
+			if received.IsZero() {
+				received = out.Txn.CreatedAt.Time
+			}
+			if err := q.CreateInventoryCostLayer(ctx, db.CreateInventoryCostLayerParams{
+				TenantID:      tid,
+				ItemID:        m.ItemID,
+				StoreID:       m.StoreID,
+				TransactionID: out.Txn.ID,
+				ReceivedAt:    received,
+				Quantity:      d.Quantity,
+				UnitCost:      d.UnitCost,
+			}); err != nil {
+				return postedMovement{}, err
+			}
+		}
+	}
+	return out, q.SetInventoryStock(ctx, m.ItemID, m.StoreID, bal)
+}
+
+// Reports
+
+type StockFilter struct {
+	StoreID string
+	ItemID  string
+	// AsOf is a date; the report then shows stock at the end of that day in
+	// the school's time zone. Without it the report shows stock now.
+	AsOf string
+}
+
+type StockPosition struct {
+	ItemID      pgtype.UUID `json:"item_id"`
+	ItemName    string      `json:"item_name"`
+	Sku         pgtype.Text `json:"sku"`
+	Unit        pgtype.Text `json:"unit"`
+	StoreID     pgtype.UUID `json:"store_id"`
+	StoreName   string      `json:"store_name"`
+	Quantity    int64       `json:"quantity"`
+	Value       float64     `json:"value"`
+	AverageCost float64     `json:"average_cost"`
+}
+
+type StoreValuation struct {
+	StoreID   pgtype.UUID `json:"store_id"`
+	StoreName string      `json:"store_name"`
+	Items     int         `json:"items"`
+	Value     float64     `json:"value"`
+}
+
+// StockReport is stock on hand with its value, by item and store. Stock
+// dispatched but not yet received belongs to no store and is shown apart.
+type StockReport struct {
+	AsOf           string           `json:"as_of,omitempty"`
+	Positions      []StockPosition  `json:"positions"`
+	Stores         []StoreValuation `json:"stores"`
+	InTransitValue float64          `json:"in_transit_value"`
+	TotalValue     float64          `json:"total_value"`
+}
+
+func (s *StockService) StockReport(ctx context.Context, tenantID string, f StockFilter) (StockReport, error) {
+	tid := toPgUUID(tenantID)
+	arg := db.ListInventoryStockPositionsParams{TenantID: tid, StoreID: toPgUUID(f.StoreID), ItemID: toPgUUID(f.ItemID)}
+	report := StockReport{AsOf: f.AsOf, Positions: []StockPosition{}, Stores: []StoreValuation{}}
+	if f.AsOf != "" {
+		tz, err := s.q.GetSchoolTimezone(ctx, tid)
+		if err != nil {
+			return report, err
+		}
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			loc = time.UTC
+		}
+		end, err := dayEnd(f.AsOf, loc)
+		if err != nil {
+			return report, err
+		}
+		arg.Before = pgtype.Timestamptz{Time: end, Valid: true}
+	}
+	positions, err := s.q.ListInventoryStockPositions(ctx, arg)
+	if err != nil {
+		return report, err
+	}
+
+	var total int64
+	byStore := map[pgtype.UUID]int{}
+	storeValue := map[pgtype.UUID]int64{}
+	for _, p := range positions {
+		avg := int64(0)
+		if p.Quantity > 0 {
+			avg = averageUnitCost(int32(min(p.Quantity, 1<<31-1)), p.Value)
+		}
+		report.Positions = append(report.Positions, StockPosition{
+			ItemID: p.ItemID, ItemName: p.ItemName, Sku: p.Sku, Unit: p.Unit, StoreID: p.StoreID, StoreName: p.StoreName,
+			Quantity: p.Quantity, Value: rupees(p.Value), AverageCost: rupees(avg),
+		})
+		if _, ok := byStore[p.StoreID]; !ok {
+			byStore[p.StoreID] = len(report.Stores)
+			report.Stores = append(report.Stores, StoreValuation{StoreID: p.StoreID, StoreName: p.StoreName})
+		}
+		i := byStore[p.StoreID]
+		report.Stores[i].Items++
+		storeValue[p.StoreID] += p.Value
+		total += p.Value
+	}
+	for i := range report.Stores {
+		report.Stores[i].Value = rupees(storeValue[report.Stores[i].StoreID])
+	}
+
+	// Goods in transit only count towards the whole school.
+	if !arg.StoreID.Valid && !arg.ItemID.Valid {
+		transit, err := s.q.InventoryInTransitValue(ctx, tid, arg.Before)
+		if err != nil {
+			return report, err
+		}
+		report.InTransitValue = rupees(transit)
+		total += transit
+	}
+	report.TotalValue = rupees(total)
+	return report, nil
+}
@@ -0,0 +1,291 @@
+package inventory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/schoolerp/api/internal/db"
+)
+
+var (
+	ErrStockTakeNotFound = errors.New("stock-take not found")
+	ErrStockTakeState    = errors.New("stock-take cannot change in its current status")
+)
+
+// A stock-take snapshots a store's balances, collects physical counts and
+// posts the differences as adjustments. Variances are taken against the
+// snapshot, so issues and receipts recorded while counting are kept.
+
+type StockTakeInput struct {
+	StoreID string
+	// ItemIDs limits the count to some items; without them every item in
+	// stock at the store is counted.
+	ItemIDs []string
+	Notes   string
+}
+
+type CountInput struct {
+	ItemID          string
+	CountedQuantity int32
+	Reason          string
+}
+
+type StockTakeLine struct {
+	ID              pgtype.UUID `json:"id"`
+	ItemID          pgtype.UUID `json:"item_id"`
+	ItemName        string      `json:"item_name"`
+	Sku             pgtype.Text `json:"sku"`
+	Unit            pgtype.Text `json:"unit"`
+	SystemQuantity  int32       `json:"system_quantity"`
+	SystemValue     float64     `json:"system_value"`
+	CountedQuantity *int32      `json:"counted_quantity,omitempty"`
+	Variance        *int32      `json:"variance,omitempty"`
+	VarianceValue   *float64    `json:"variance_value,omitempty"`
+	Reason          pgtype.Text `json:"reason"`
+	CountedBy       pgtype.UUID `json:"counted_by"`
+}
+
+type StockTakeDetail struct {
+	db.InventoryStockTake
+	Items         []StockTakeLine `json:"items"`
+	Counted       int             `json:"counted"`
+	SystemValue   float64         `json:"system_value"`
+	VarianceValue float64         `json:"variance_value"`
+}
+
+func (s *StockService) StartStockTake(ctx context.Context, tenantID string, in StockTakeInput, actor Actor) (StockTakeDetail, error) {
+	if in.StoreID == "" {
+		return StockTakeDetail{}, fmt.Errorf("%w: store_id is required", ErrInvalidStock)
+	}
+	tid := toPgUUID(tenantID)
+	var itemIDs []pgtype.UUID
+	for _, id := range in.ItemIDs {
+		itemIDs = append(itemIDs, toPgUUID(id))
+	}
+	var id pgtype.UUID
+	err := s.inTx(ctx, func(q *db.Queries) error {
+		store, err := activeStore(ctx, q, tid, in.StoreID)
+		if err != nil {
+			return err
+		}
+		id, err = q.CreateInventoryStockTake(ctx, tid, store.ID, optionalText(in.Notes), toPgUUID(actor.UserID))
+		if isUniqueViolation(err) {
+			return fmt.Errorf("%w: %s already has a count open", ErrStockTakeState, store.Name)
+		}
+		if err != nil {
+			return err
+		}
+		n, err := q.SnapshotInventoryStockTakeItems(ctx, tid, id, store.ID, itemIDs)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return fmt.Errorf("%w: nothing to count in %s", ErrInvalidStock, store.Name)
+		}
+		return nil
+	})
+	if err != nil {
+		return StockTakeDetail{}, err
+	}
+	detail, err := s.GetStockTake(ctx, tenantID, id.String())
+	if err == nil {
+		s.log(ctx, tid, actor, "inventory.start_stock_take", "inventory_stock_take", id, detail.InventoryStockTake)
+	}
+	return detail, err
+}
+
+func lockStockTake(ctx context.Context, q *db.Queries, tid, id pgtype.UUID) (db.InventoryStockTake, error) {
+	k, err := q.LockInventoryStockTake(ctx, tid, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return k, ErrStockTakeNotFound
+	}
+	if err != nil {
+		return k, err
+	}
+	if k.Status != "counting" {
+		return k, fmt.Errorf("%w: stock-take is %s", ErrStockTakeState, k.Status)
+	}
+	return k, nil
+}
+
+// RecordCounts saves counts; counting a line again replaces its count. An
+// item found on the shelf that was not on the sheet is added with the
+// store's balance at the time.
+func (s *StockService) RecordCounts(ctx context.Context, tenantID, stockTakeID string, counts []CountInput, actor Actor) (StockTakeDetail, error) {
+	if len(counts) == 0 {
+		return StockTakeDetail{}, fmt.Errorf("%w: no counts given", ErrInvalidStock)
+	}
+	for _, c := range counts {
+		if c.ItemID == "" || c.CountedQuantity < 0 {
+			return StockTakeDetail{}, fmt.Errorf("%w: each count needs an item_id and a quantity of zero or more", ErrInvalidStock)
+		}
+	}
+	tid, id := toPgUUID(tenantID), toPgUUID(stockTakeID)
+	by := toPgUUID(actor.UserID)
+	err := s.inTx(ctx, func(q *db.Queries) error {
+		k, err := lockStockTake(ctx, q, tid, id)
+		if err != nil {
+			return err
+		}
+		for _, c := range counts {
+			itemID := toPgUUID(c.ItemID)
+			err := q.RecordInventoryStockTakeCount(ctx, id, itemID, c.CountedQuantity, optionalText(c.Reason), by)
+			if errors.Is(err, pgx.ErrNoRows) {
+				n, serr := q.SnapshotInventoryStockTakeItems(ctx, tid, id, k.StoreID, []pgtype.UUID{itemID})
+				if serr != nil {
+					return serr
+				}
+				if n == 0 {
+					return fmt.Errorf("%w: %s", ErrItemNotFound, c.ItemID)
+				}
+				err = q.RecordInventoryStockTakeCount(ctx, id, itemID, c.CountedQuantity, optionalText(c.Reason), by)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return StockTakeDetail{}, err
+	}
+	return s.GetStockTake(ctx, tenantID, stockTakeID)
+}
+
+// PostStockTake adjusts the store to the counts. A surplus comes in at the
+// snapshot's average cost, or the last purchase price when the store had
+// none; a shortfall goes out at the item's cost like any issue. Lines left
+// uncounted are not adjusted.
+func (s *StockService) PostStockTake(ctx context.Context, tenantID, stockTakeID string, actor Actor) (StockTakeDetail, error) {
+	tid, id := toPgUUID(tenantID), toPgUUID(stockTakeID)
+	by := toPgUUID(actor.UserID)
+	err := s.inTx(ctx, func(q *db.Queries) error {
+		k, err := lockStockTake(ctx, q, tid, id)
+		if err != nil {
+			return err
+		}
+		lines, err := q.ListInventoryStockTakeItems(ctx, id)
+		if err != nil {
+			return err
+		}
+		counted := 0
+		for _, l := range lines {
+			if !l.CountedQuantity.Valid {
+				continue
+			}
+			counted++
+			delta := l.CountedQuantity.Int32 - l.SystemQuantity
+			if delta == 0 {
+				if err := q.SetInventoryStockTakeItemVariance(ctx, l.ID, 0); err != nil {
+					return err
+				}
+				continue
+			}
+			m := movement{
+				ItemID:        l.ItemID,
+				StoreID:       k.StoreID,
+				Type:          txnAdjustment,
+				Delta:         delta,
+				ReferenceID:   k.ID,
+				ReferenceType: "stock_take",
+				Remarks:       "Stock-take variance",
+				CreatedBy:     by,
+			}
+			if l.Reason.Valid {
+				m.Remarks += ": " + l.Reason.String
+			}
+			if delta > 0 {
+				unit := averageUnitCost(l.SystemQuantity, l.SystemValue)
+				if unit == 0 {
+					if unit, err = q.GetInventoryItemLastCost(ctx, tid, l.ItemID); err != nil {
+						return err
+					}
+				}
+				m.Value = unit * int64(delta)
+			}
+			posted, err := s.post(ctx, q, tid, m)
+			if err != nil {
+				return fmt.Errorf("%s: %w", l.ItemName, err)
+			}
+			variance := posted.Value
+			if delta < 0 {
+				variance = -variance
+			}
+			if err := q.SetInventoryStockTakeItemVariance(ctx, l.ID, variance); err != nil {
+				return err
+			}
+		}
+		if counted == 0 {
+			return fmt.Errorf("%w: no items have been counted", ErrInvalidStock)
+		}
+		return q.SetInventoryStockTakeStatus(ctx, id, "posted", by)
+	})
+	if err != nil {
+		return StockTakeDetail{}, err
+	}
+	detail, err := s.GetStockTake(ctx, tenantID, stockTakeID)
+	if err == nil {
+		s.log(ctx, tid, actor, "inventory.post_stock_take", "inventory_stock_take", id, map[string]any{
+			"store_id": detail.StoreID, "counted": detail.Counted, "variance_value": detail.VarianceValue,
+		})
+	}
+	return detail, err
+}
+
+func (s *StockService) CancelStockTake(ctx context.Context, tenantID, stockTakeID string, actor Actor) error {
+	tid, id := toPgUUID(tenantID), toPgUUID(stockTakeID)
+	err := s.inTx(ctx, func(q *db.Queries) error {
+		if _, err := lockStockTake(ctx, q, tid, id); err != nil {
+			return err
+		}
+		return q.SetInventoryStockTakeStatus(ctx, id, "cancelled", toPgUUID(actor.UserID))
+	})
+	if err == nil {
+		s.log(ctx, tid, actor, "inventory.cancel_stock_take", "inventory_stock_take", id, nil)
+	}
+	return err
+}
+
+func (s *StockService) ListStockTakes(ctx context.Context, tenantID, storeID string) ([]db.InventoryStockTake, error) {
+	return s.q.ListInventoryStockTakes(ctx, toPgUUID(tenantID), toPgUUID(storeID))
+}
+
+func (s *StockService) GetStockTake(ctx context.Context, tenantID, stockTakeID string) (StockTakeDetail, error) {
+	k, err := s.q.GetInventoryStockTake(ctx, toPgUUID(tenantID), toPgUUID(stockTakeID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return StockTakeDetail{}, ErrStockTakeNotFound
+	}
+	if err != nil {
+		return StockTakeDetail{}, err
+	}
+	lines, err := s.q.ListInventoryStockTakeItems(ctx, k.ID)
+	if err != nil {
+		return StockTakeDetail{}, err
+	}
+	detail := StockTakeDetail{InventoryStockTake: k, Items: make([]StockTakeLine, 0, len(lines))}
+	var systemValue, varianceValue int64
+	for _, l := range lines {
+		line := StockTakeLine{
+			ID: l.ID, ItemID: l.ItemID, ItemName: l.ItemName, Sku: l.Sku, Unit: l.Unit,
+			SystemQuantity: l.SystemQuantity, SystemValue: rupees(l.SystemValue), Reason: l.Reason, CountedBy: l.CountedBy,
+		}
+		if l.CountedQuantity.Valid {
+			counted := l.CountedQuantity.Int32
+			variance := counted - l.SystemQuantity
+			line.CountedQuantity, line.Variance = &counted, &variance
+			detail.Counted++
+		}
+		if l.VarianceValue.Valid {
+			v := rupees(l.VarianceValue.Int64)
+			line.VarianceValue = &v
+			varianceValue += l.VarianceValue.Int64
+		}
+		detail.Items = append(detail.Items, line)
+		systemValue += l.SystemValue
+	}
+	detail.SystemValue, detail.VarianceValue = rupees(systemValue), rupees(varianceValue)
+	return detail, nil
+}
@@ -0,0 +1,331 @@
+package inventory
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/schoolerp/api/internal/db"
+)
+
+var (
+	ErrTransferNotFound = errors.New("transfer not found")
+	ErrTransferState    = errors.New("transfer cannot change in its current status")
+)
+
+// A transfer moves stock between stores in two steps. Dispatch takes the
+// stock out of the sending store at its cost; until the receiving store
+// confirms, the stock is in transit and belongs to neither.
+
+type TransferLineInput struct {
+	ItemID   string
+	Quantity int32
+}
+
+type TransferInput struct {
+	FromStoreID string
+	ToStoreID   string
+	Notes       string
+	Items       []TransferLineInput
+}
+
+type ReceiptLineInput struct {
+	ItemID           string
+	ReceivedQuantity int32
+	Remarks          string
+}
+
+// ReceiveInput confirms a transfer. Lines not listed arrived in full.
+type ReceiveInput struct {
+	Lines []ReceiptLineInput
+}
+
+type TransferLine struct {
+	ID               pgtype.UUID `json:"id"`
+	ItemID           pgtype.UUID `json:"item_id"`
+	ItemName         string      `json:"item_name"`
+	Unit             pgtype.Text `json:"unit"`
+	Quantity         int32       `json:"quantity"`
+	Value            float64     `json:"value"`
+	ReceivedQuantity *int32      `json:"received_quantity,omitempty"`
+	ReceivedValue    *float64    `json:"received_value,omitempty"`
+	Shortage         int32       `json:"shortage"`
+	Remarks          pgtype.Text `json:"remarks"`
+}
+
+type TransferDetail struct {
+	db.InventoryTransfer
+	Items      []TransferLine `json:"items"`
+	TotalValue float64        `json:"total_value"`
+}
+
+func (in TransferInput) validate() error {
+	if in.FromStoreID == "" || in.ToStoreID == "" {
+		return fmt.Errorf("%w: from_store_id and to_store_id are required", ErrInvalidStock)
+	}
+	if toPgUUID(in.FromStoreID) == toPgUUID(in.ToStoreID) {
+		return fmt.Errorf("%w: a transfer needs two different stores", ErrInvalidStock)
+	}
+	if len(in.Items) == 0 {
+		return fmt.Errorf("%w: at least one item is required", ErrInvalidStock)
+	}
+	seen := map[string]bool{}
+	for _, it := range in.Items {
+		if it.ItemID == "" || it.Quantity <= 0 {
+			return fmt.Errorf("%w: each item needs an item_id and a positive quantity", ErrInvalidStock)
+		}
+		if seen[it.ItemID] {
+			return fmt.Errorf("%w: item %s is listed twice", ErrInvalidStock, it.ItemID)
+		}
+		seen[it.ItemID] = true
+	}
+	return nil
+}
+
+// CreateTransfer drafts a transfer. Stock is checked when it is dispatched,
+// not here, so a draft can be prepared ahead of a delivery.
+func (s *StockService) CreateTransfer(ctx context.Context, tenantID string, in TransferInput, actor Actor) (TransferDetail, error) {
+	if err := in.validate(); err != nil {
+		return TransferDetail{}, err
+	}
+	tid := toPgUUID(tenantID)
+	var id pgtype.UUID
+	err := s.inTx(ctx, func(q *db.Queries) error {
+		from, err := activeStore(ctx, q, tid, in.FromStoreID)
+		if err != nil {
+			return err
+		}
+		to, err := activeStore(ctx, q, tid, in.ToStoreID)
+		if err != nil {
+			return err
+		}
+		id, err = q.CreateInventoryTransfer(ctx, tid, from.ID, to.ID, optionalText(in.Notes), toPgUUID(actor.UserID))
+		if err != nil {
+			return err
+		}
+		for _, it := range in.Items {
+			err := q.CreateInventoryTransferItem(ctx, tid, id, toPgUUID(it.ItemID), it.Quantity)
+			if errors.Is(err, pgx.ErrNoRows) {
+				return fmt.Errorf("%w: %s", ErrItemNotFound, it.ItemID)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return TransferDetail{}, err
+	}
+	detail, err := s.GetTransfer(ctx, tenantID, id.String())
+	if err == nil {
+		s.log(ctx, tid, actor, "inventory.create_transfer", "inventory_transfer", id, detail)
+	}
+	return detail, err
+}
+
+// lockTransfer loads a transfer for update and checks it is in status.
+func lockTransfer(ctx context.Context, q *db.Queries, tid, id pgtype.UUID, status string) (db.InventoryTransfer, error) {
+	t, err := q.LockInventoryTransfer(ctx, tid, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return t, ErrTransferNotFound
+	}
+	if err != nil {
+		return t, err
+	}
+	if t.Status != status {
+		return t, fmt.Errorf("%w: transfer %s is %s", ErrTransferState, t.TransferNumber, t.Status)
+	}
+	return t, nil
+}
+
+// DispatchTransfer issues the stock from the sending store.
+func (s *StockService) DispatchTransfer(ctx context.Context, tenantID, transferID string, actor Actor) (TransferDetail, error) {
+	tid, id := toPgUUID(tenantID), toPgUUID(transferID)
+	by := toPgUUID(actor.UserID)
+	err := s.inTx(ctx, func(q *db.Queries) error {
+		t, err := lockTransfer(ctx, q, tid, id, "draft")
+		if err != nil {
+			return err
+		}
+		lines, err := q.ListInventoryTransferItems(ctx, id)
+		if err != nil {
+			return err
+		}
+		for _, l := range lines {
+			posted, err := s.post(ctx, q, tid, movement{
+				ItemID:        l.ItemID,
+				StoreID:       t.FromStoreID,
+				Type:          txnTransferOut,
+				Delta:         -l.Quantity,
+				ReferenceID:   t.ID,
+				ReferenceType: "inventory_transfer",
+				Remarks:       "Transfer " + t.TransferNumber + " to " + t.ToStoreName,
+				CreatedBy:     by,
+			})
+			if err != nil {
+				return fmt.Errorf("%s: %w", l.ItemName, err)
+			}
+			var layers []byte
+			if len(posted.Draws) > 0 {
+				if layers, err = json.Marshal(posted.Draws); err != nil {
+					return err
+				}
+			}
+			if err := q.SetInventoryTransferItemDispatch(ctx, l.ID, posted.Value, layers); err != nil {
+				return err
+			}
+		}
+		return q.SetInventoryTransferStatus(ctx, id, "in_transit", by)
+	})
+	if err != nil {
+		return TransferDetail{}, err
+	}
+	detail, err := s.GetTransfer(ctx, tenantID, transferID)
+	if err == nil {
+		s.log(ctx, tid, actor, "inventory.dispatch_transfer", "inventory_transfer", id, detail)
+	}
+	return detail, err
+}
+
+// ReceiveTransfer books the stock into the receiving store. A short
+// receipt brings in only what arrived; the rest is written off at the
+// cost it left the sending store with, recorded as the line's shortage.
+func (s *StockService) ReceiveTransfer(ctx context.Context, tenantID, transferID string, in ReceiveInput, actor Actor) (TransferDetail, error) {
+	tid, id := toPgUUID(tenantID), toPgUUID(transferID)
+	by := toPgUUID(actor.UserID)
+	receipts := map[pgtype.UUID]ReceiptLineInput{}
+	for _, l := range in.Lines {
+		if l.ReceivedQuantity < 0 {
+			return TransferDetail{}, fmt.Errorf("%w: received_quantity cannot be negative", ErrInvalidStock)
+		}
+		receipts[toPgUUID(l.ItemID)] = l
+	}
+	err := s.inTx(ctx, func(q *db.Queries) error {
+		t, err := lockTransfer(ctx, q, tid, id, "in_transit")
+		if err != nil {
+			return err
+		}
+		if _, err := activeStore(ctx, q, tid, t.ToStoreID.String()); err != nil {
+			return err
+		}
+		lines, err := q.ListInventoryTransferItems(ctx, id)
+		if err != nil {
+			return err
+		}
+		onTransfer := map[pgtype.UUID]bool{}
+		for _, l := range lines {
+			onTransfer[l.ItemID] = true
+		}
+		for itemID := range receipts {
+			if !onTransfer[itemID] {
+				return fmt.Errorf("%w: item %s is not on transfer %s", ErrInvalidStock, itemID.String(), t.TransferNumber)
+			}
+		}
+		for _, l := range lines {
+			qty, remarks := l.Quantity, ""
+			if r, ok := receipts[l.ItemID]; ok {
+				qty, remarks = r.ReceivedQuantity, r.Remarks
+			}
+			if qty > l.Quantity {
+				return fmt.Errorf("%w: %s: received %d of %d dispatched", ErrInvalidStock, l.ItemName, qty, l.Quantity)
+			}
+			var draws []costDraw
+			if len(l.CostLayers) > 0 {
+				if err := json.Unmarshal(l.CostLayers, &draws); err != nil {
+					return err
+				}
+				draws = takeDraws(draws, qty)
+			}
+			value := averageIssueCost(qty, l.Quantity, l.Value)
+			if qty > 0 {
+				posted, err := s.post(ctx, q, tid, movement{
+					ItemID:        l.ItemID,
+					StoreID:       t.ToStoreID,
+					Type:          txnTransferIn,
+					Delta:         qty,
+					Value:         value,
+					Draws:         draws,
+					ReferenceID:   t.ID,
+					ReferenceType: "inventory_transfer",
+					Remarks:       "Transfer " + t.TransferNumber + " from " + t.FromStoreName,
+					CreatedBy:     by,
+				})
+				if err != nil {
+					return fmt.Errorf("%s: %w", l.ItemName, err)
+				}
+				value = posted.Value
+			}
+			if err := q.SetInventoryTransferItemReceipt(ctx, l.ID, qty, value, optionalText(remarks)); err != nil {
+				return err
+			}
+		}
+		return q.SetInventoryTransferStatus(ctx, id, "received", by)
+	})
+	if err != nil {
+		return TransferDetail{}, err
+	}
+	detail, err := s.GetTransfer(ctx, tenantID, transferID)
+	if err == nil {
+		s.log(ctx, tid, actor, "inventory.receive_transfer", "inventory_transfer", id, detail)
+	}
+	return detail, err
+}
+
+// CancelTransfer drops a draft. Dispatched stock has left the store, so a
+// transfer in transit has to be received, short if need be.
+func (s *StockService) CancelTransfer(ctx context.Context, tenantID, transferID string, actor Actor) error {
+	tid, id := toPgUUID(tenantID), toPgUUID(transferID)
+	err := s.inTx(ctx, func(q *db.Queries) error {
+		if _, err := lockTransfer(ctx, q, tid, id, "draft"); err != nil {
+			return err
+		}
+		return q.SetInventoryTransferStatus(ctx, id, "cancelled", toPgUUID(actor.UserID))
+	})
+	if err == nil {
+		s.log(ctx, tid, actor, "inventory.cancel_transfer", "inventory_transfer", id, nil)
+	}
+	return err
+}
+
+func (s *StockService) ListTransfers(ctx context.Context, tenantID, storeID, status string) ([]db.InventoryTransfer, error) {
+	return s.q.ListInventoryTransfers(ctx, db.ListInventoryTransfersParams{
+		TenantID: toPgUUID(tenantID),
+		StoreID:  toPgUUID(storeID),
+		Status:   optionalText(status),
+	})
+}
+
+func (s *StockService) GetTransfer(ctx context.Context, tenantID, transferID string) (TransferDetail, error) {
+	t, err := s.q.GetInventoryTransfer(ctx, toPgUUID(tenantID), toPgUUID(transferID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return TransferDetail{}, ErrTransferNotFound
+	}
+	if err != nil {
+		return TransferDetail{}, err
+	}
+	lines, err := s.q.ListInventoryTransferItems(ctx, t.ID)
+	if err != nil {
+		return TransferDetail{}, err
+	}
+	detail := TransferDetail{InventoryTransfer: t, Items: make([]TransferLine, 0, len(lines))}
+	var total int64
+	for _, l := range lines {
+		line := TransferLine{
+			ID: l.ID, ItemID: l.ItemID, ItemName: l.ItemName, Unit: l.Unit,
+			Quantity: l.Quantity, Value: rupees(l.Value), Remarks: l.Remarks,
+		}
+		if l.ReceivedQuantity.Valid {
+			qty, value := l.ReceivedQuantity.Int32, rupees(l.ReceivedValue.Int64)
+			line.ReceivedQuantity, line.ReceivedValue = &qty, &value
+			line.Shortage = l.Quantity - qty
+		}
+		detail.Items = append(detail.Items, line)
+		total += l.Value
+	}
+	detail.TotalValue = rupees(total)
+	return detail, nil
+}
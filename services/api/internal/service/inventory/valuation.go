@@ -0,0 +1,110 @@
+package inventory
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/schoolerp/api/internal/db"
+)
+
+// Stock is valued in paise. Weighted-average items keep a running value per
+// store and issue at its average; FIFO items keep cost layers per store and
+// issue from the oldest.
+
+const (
+	ValuationFIFO            = "fifo"
+	ValuationWeightedAverage = "weighted_average"
+)
+
+// costDraw is a quantity at one unit cost, taken from or added to a FIFO
+// layer. Transfers carry the draws so the receiving store keeps the
+// original costs and receipt dates.
+type costDraw struct {
+	Quantity   int32     `json:"quantity"`
+	UnitCost   int64     `json:"unit_cost"`
+	ReceivedAt time.Time `json:"received_at"`
+}
+
+func drawsValue(draws []costDraw) int64 {
+	var total int64
+	for _, d := range draws {
+		total += int64(d.Quantity) * d.UnitCost
+	}
+	return total
+}
+
+func paise(rupees float64) int64 {
+	return int64(math.Round(rupees * 100))
+}
+
+func rupees(p int64) float64 {
+	return float64(p) / 100
+}
+
+// drawFIFO takes qty from the layers, oldest first. It returns what was
+// drawn and what each layer has left.
+func drawFIFO(layers []db.InventoryCostLayer, qty int32) ([]costDraw, []int32, error) {
+	left := make([]int32, len(layers))
+	var draws []costDraw
+	need := qty
+	for i, l := range layers {
+		left[i] = l.Remaining
+		if need == 0 || l.Remaining <= 0 {
+			continue
+		}
+		take := min(need, l.Remaining)
+		draws = append(draws, costDraw{Quantity: take, UnitCost: l.UnitCost, ReceivedAt: l.ReceivedAt.Time})
+		left[i] -= take
+		need -= take
+	}
+	if need > 0 {
+		return nil, nil, fmt.Errorf("cost layers hold %d fewer than the %d issued", need, qty)
+	}
+	return draws, left, nil
+}
+
+// averageIssueCost is the cost of issuing qty out of onHand worth value.
+// Issuing everything takes the whole value, so no rounding is left behind.
+func averageIssueCost(qty, onHand int32, value int64) int64 {
+	if onHand <= 0 || qty <= 0 {
+		return 0
+	}
+	if qty >= onHand {
+		return value
+	}
+	return int64(math.Round(float64(value) * float64(qty) / float64(onHand)))
+}
+
+// takeDraws returns the first qty units of the draws, for a transfer that
+// arrived short.
+func takeDraws(draws []costDraw, qty int32) []costDraw {
+	var out []costDraw
+	for _, d := range draws {
+		if qty == 0 {
+			break
+		}
+		d.Quantity = min(d.Quantity, qty)
+		qty -= d.Quantity
+		out = append(out, d)
+	}
+	return out
+}
+
+// averageUnitCost is the cost of one unit of a balance, to the paisa.
+func averageUnitCost(qty int32, value int64) int64 {
+	if qty <= 0 {
+		return 0
+	}
+	return int64(math.Round(float64(value) / float64(qty)))
+}
+
+// dayEnd is the first moment after a date in the school's time zone, so a
+// report as of a date includes everything that happened on it.
+func dayEnd(date string, loc *time.Location) (time.Time, error) {
+	d, err := time.ParseInLocation("2006-01-02", date, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: as_of must be a date (YYYY-MM-DD)", ErrInvalidStock)
+	}
+	return d.AddDate(0, 0, 1), nil
+}
@@ -0,0 +1,87 @@
+package inventory
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/schoolerp/api/internal/db"
+)
+
+func layer(remaining int32, unitCost int64, day int) db.InventoryCostLayer {
+	at := time.Date(2026, 4, day, 0, 0, 0, 0, time.UTC)
+	return db.InventoryCostLayer{Remaining: remaining, UnitCost: unitCost, ReceivedAt: pgtype.Timestamptz{Time: at, Valid: true}}
+}
+
+func TestDrawFIFOTakesOldestFirst(t *testing.T) {
+	layers := []db.InventoryCostLayer{layer(0, 900, 1), layer(4, 1000, 2), layer(10, 1200, 5)}
+
+	draws, left, err := drawFIFO(layers, 7)
+	if err != nil {
+		t.Fatalf("drawFIFO: %v", err)
+	}
+	if len(draws) != 2 || draws[0].Quantity != 4 || draws[0].UnitCost != 1000 || draws[1].Quantity != 3 || draws[1].UnitCost != 1200 {
+		t.Fatalf("unexpected draws %+v", draws)
+	}
+	if left[0] != 0 || left[1] != 0 || left[2] != 7 {
+		t.Fatalf("unexpected remaining %v", left)
+	}
+	if got := drawsValue(draws); got != 4*1000+3*1200 {
+		t.Fatalf("draws value = %d", got)
+	}
+	if !draws[1].ReceivedAt.Equal(layers[2].ReceivedAt.Time) {
+		t.Fatalf("draw lost its receipt date: %v", draws[1].ReceivedAt)
+	}
+}
+
+func TestDrawFIFOShortLayers(t *testing.T) {
+	if _, _, err := drawFIFO([]db.InventoryCostLayer{layer(2, 500, 1)}, 3); err == nil {
+		t.Fatalf("expected an error when the layers hold less than the issue")
+	}
+}
+
+func TestAverageIssueCost(t *testing.T) {
+	cases := []struct {
+		qty, onHand int32
+		value, want int64
+	}{
+		{qty: 1, onHand: 3, value: 1000, want: 333},
+		{qty: 2, onHand: 3, value: 1000, want: 667},
+		{qty: 3, onHand: 3, value: 1000, want: 1000},
+		{qty: 1, onHand: 0, value: 0, want: 0},
+	}
+	for _, c := range cases {
+		if got := averageIssueCost(c.qty, c.onHand, c.value); got != c.want {
+			t.Fatalf("averageIssueCost(%d, %d, %d) = %d, want %d", c.qty, c.onHand, c.value, got, c.want)
+		}
+	}
+}
+
+func TestTakeDrawsForShortReceipt(t *testing.T) {
+	draws := []costDraw{{Quantity: 4, UnitCost: 1000}, {Quantity: 3, UnitCost: 1200}}
+	got := takeDraws(draws, 5)
+	if len(got) != 2 || got[0].Quantity != 4 || got[1].Quantity != 1 {
+		t.Fatalf("unexpected draws %+v", got)
+	}
+	if drawsValue(got) != 5200 {
+		t.Fatalf("value = %d, want 5200", drawsValue(got))
+	}
+	if len(takeDraws(draws, 0)) != 0 {
+		t.Fatalf("expected no draws when nothing arrived")
+	}
+}
+
+func TestDayEndUsesSchoolTimezone(t *testing.T) {
+	loc := time.FixedZone("IST", 5*3600+1800)
+	end, err := dayEnd("2026-03-31", loc)
+	if err != nil {
+		t.Fatalf("dayEnd: %v", err)
+	}
+	if want := time.Date(2026, 3, 31, 18, 30, 0, 0, time.UTC); !end.Equal(want) {
+		t.Fatalf("dayEnd = %v, want %v", end.UTC(), want)
+	}
+	if _, err := dayEnd("31/03/2026", loc); !errors.Is(err, ErrInvalidStock) {
+		t.Fatalf("expected ErrInvalidStock, got %v", err)
+	}
+}
@@ -0,0 +1,305 @@
+package kb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Embedder turns text into dense vectors for semantic retrieval. Model must
+// identify both the provider and the model so vectors from different models
+// are never compared with each other.
+type Embedder interface {
+	Model() string
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// NewEmbedderFromEnv builds the embedding provider selected by
+// KB_EMBEDDING_PROVIDER (local, openai or ollama). It returns nil when
+// semantic retrieval is not configured.
+func NewEmbedderFromEnv() (Embedder, error) {
+	provider := strings.ToLower(strings.TrimSpace(os.Getenv("KB_EMBEDDING_PROVIDER")))
+	model := strings.TrimSpace(os.Getenv("KB_EMBEDDING_MODEL"))
+	baseURL := strings.TrimSpace(os.Getenv("KB_EMBEDDING_BASE_URL"))
+
+	switch provider {
+	case "", "none":
+		return nil, nil
+	case "local":
+		return NewLocalEmbedder(), nil
+	case "openai":
+		apiKey := strings.TrimSpace(os.Getenv("KB_EMBEDDING_API_KEY"))
+		if apiKey == "" {
+			apiKey = strings.TrimSpace(os.Getenv("OPENAI_API_KEY"))
+		}
+		if apiKey == "" {
+			return nil, fmt.Errorf("KB_EMBEDDING_API_KEY or OPENAI_API_KEY not set")
+		}
+		if baseURL == "" {
+			baseURL = "https://api.openai.com/v1"
+		}
+		if model == "" {
+			model = "text-embedding-3-small"
+		}
+		return NewHTTPEmbedder("openai", baseURL, apiKey, model), nil
+	case "ollama":
+		if baseURL == "" {
+			baseURL = "http://localhost:11434/v1"
+		}
+		if model == "" {
+			model = "nomic-embed-text"
+		}
+		return NewHTTPEmbedder("ollama", baseURL, "", model), nil
+	default:
+		return nil, fmt.Errorf("unsupported KB_EMBEDDING_PROVIDER %q; expected local, openai, or ollama", provider)
+	}
+}
+
+// HTTPEmbedder calls an OpenAI-compatible /embeddings endpoint. Besides
+// OpenAI this covers self-hosted servers such as Ollama, LM Studio and
+// llama.cpp, which keeps data on-premises.
+type HTTPEmbedder struct {
+	provider string
+	baseURL  string
+	apiKey   string
+	model    string
+	http     *http.Client
+}
+
+func NewHTTPEmbedder(provider, baseURL, apiKey, model string) *HTTPEmbedder {
+	return &HTTPEmbedder{
+		provider: provider,
+		baseURL:  strings.TrimRight(baseURL, "/"),
+		apiKey:   apiKey,
+		model:    model,
+		http:     &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (e *HTTPEmbedder) Model() string {
+	return e.provider + ":" + e.model
+}
+
+func (e *HTTPEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	if len(texts) == 0 {
+		return nil, nil
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"model": e.model,
+		"input": texts,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.baseURL+"/embeddings", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if e.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+e.apiKey)
+	}
+
+	resp, err := e.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("%s embeddings error (status %d): %s", e.provider, resp.StatusCode, string(respBody))
+	}
+
+	var parsed struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+		return nil, err
+	}
+	if len(parsed.Data) != len(texts) {
+		return nil, fmt.Errorf("%s embeddings returned %d vectors for %d inputs", e.provider, len(parsed.Data), len(texts))
+	}
+
+	out := make([][]float32, len(texts))
+	for _, item := range parsed.Data {
+		if item.Index < 0 || item.Index >= len(out) {
+			return nil, fmt.Errorf("%s embeddings returned invalid index %d", e.provider, item.Index)
+		}
+		out[item.Index] = normalizeVector(item.Embedding)
+	}
+	return out, nil
+}
+
+const localEmbeddingDims = 384
+
+// LocalEmbedder is an offline embedding model based on feature hashing.
+// Words are lightly stemmed and mapped onto school-domain concepts ("paid",
+// "payment" and "dues" all land on the same feature), then combined with
+// character trigrams so spelling variants still overlap. It needs no
+// network access or model files, which makes it the default for
+// air-gapped deployments; hosted models give better paraphrase recall.
+type LocalEmbedder struct {
+	dims int
+}
+
+func NewLocalEmbedder() *LocalEmbedder {
+	return &LocalEmbedder{dims: localEmbeddingDims}
+}
+
+func (e *LocalEmbedder) Model() string {
+	return fmt.Sprintf("local:hash-%d-v1", e.dims)
+}
+
+func (e *LocalEmbedder) Embed(_ context.Context, texts []string) ([][]float32, error) {
+	out := make([][]float32, len(texts))
+	for i, text := range texts {
+		out[i] = e.embed(text)
+	}
+	return out, nil
+}
+
+func (e *LocalEmbedder) embed(text string) []float32 {
+	vec := make([]float32, e.dims)
+	add := func(feature string, weight float32) {
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(feature))
+		sum := h.Sum64()
+		idx := int(sum % uint64(e.dims))
+		if sum&(1<<63) != 0 {
+			weight = -weight
+		}
+		vec[idx] += weight
+	}
+
+	var prev string
+	for _, word := range localTokens(text) {
+		if localStopwords[word] {
+			prev = ""
+			continue
+		}
+		stem := localStem(word)
+		for _, concept := range localConcepts[stem] {
+			add("c:"+concept, 1.5)
+		}
+		add("w:"+stem, 1)
+		padded := "^" + stem + "$"
+		runes := []rune(padded)
+		for i := 0; i+3 <= len(runes); i++ {
+			add("g:"+string(runes[i:i+3]), 0.25)
+		}
+		if prev != "" {
+			add("b:"+prev+"_"+stem, 0.5)
+		}
+		prev = stem
+	}
+	return normalizeVector(vec)
+}
+
+func localTokens(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func localStem(word string) string {
+	if len(word) <= 3 {
+		return word
+	}
+	for _, suffix := range []string{"ing", "ies", "es", "ed", "ly", "s"} {
+		if strings.HasSuffix(word, suffix) && len(word)-len(suffix) >= 3 {
+			stem := strings.TrimSuffix(word, suffix)
+			if suffix == "ies" {
+				stem += "y"
+			}
+			return stem
+		}
+	}
+	return word
+}
+
+var localStopwords = map[string]bool{
+	"a": true, "an": true, "the": true, "is": true, "are": true, "was": true,
+	"be": true, "to": true, "of": true, "and": true, "or": true, "in": true,
+	"on": true, "for": true, "do": true, "does": true, "have": true, "has": true,
+	"i": true, "my": true, "we": true, "our": true, "you": true, "your": true,
+	"it": true, "this": true, "that": true, "with": true, "at": true, "can": true,
+	"will": true, "please": true, "what": true, "how": true,
+}
+
+// localConcepts maps stems to shared concept features so paraphrases that
+// share no words still land close together.
+var localConcepts = func() map[string][]string {
+	groups := map[string][]string{
+		"fee":        {"fee", "fees", "tuition", "charge", "pay", "paid", "payment", "due", "dues", "amount", "installment", "instalment", "invoice", "receipt"},
+		"deadline":   {"when", "date", "deadline", "due", "last", "before", "schedule", "timing", "time", "day"},
+		"late":       {"late", "fine", "penalty", "overdue", "delay"},
+		"absence":    {"absent", "absence", "leave", "sick", "holiday", "vacation", "off"},
+		"exam":       {"exam", "examination", "test", "assessment", "result", "mark", "grade", "report"},
+		"transport":  {"bus", "transport", "van", "route", "pickup", "drop", "driver", "stop"},
+		"uniform":    {"uniform", "dress", "shoe", "tie", "attire"},
+		"admission":  {"admission", "enrol", "enroll", "enrollment", "enrolment", "apply", "application", "register", "registration"},
+		"timing":     {"start", "begin", "open", "close", "end", "hour", "timing", "morning", "afternoon"},
+		"homework":   {"homework", "assignment", "project", "worksheet"},
+		"refund":     {"refund", "return", "reimburse", "cancel", "cancellation", "withdraw"},
+		"contact":    {"contact", "phone", "call", "email", "office", "reach"},
+		"attendance": {"attendance", "present", "presence"},
+		"library":    {"library", "book", "borrow", "issue"},
+		"canteen":    {"canteen", "lunch", "meal", "food", "mess", "tiffin"},
+	}
+	out := map[string][]string{}
+	for concept, words := range groups {
+		for _, word := range words {
+			stem := localStem(word)
+			if !containsString(out[stem], concept) {
+				out[stem] = append(out[stem], concept)
+			}
+		}
+	}
+	return out
+}()
+
+func normalizeVector(vec []float32) []float32 {
+	var sum float64
+	for _, v := range vec {
+		sum += float64(v) * float64(v)
+	}
+	if sum == 0 {
+		return vec
+	}
+	norm := float32(1 / math.Sqrt(sum))
+	out := make([]float32, len(vec))
+	for i, v := range vec {
+		out[i] = v * norm
+	}
+	return out
+}
+
+func cosineSimilarity(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(na*nb)
+}
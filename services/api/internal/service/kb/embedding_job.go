@@ -0,0 +1,229 @@
+package kb
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	embeddingBatchSize    = 32
+	embeddingMaxBatches   = 50
+	embeddingPollInterval = time.Minute
+
+	// A chunk the embedder returns nothing for is retried after
+	// embeddingRetryBase, doubling each time, and skipped for good after
+	// embeddingMaxAttempts until it is rewritten or the tenant reindexes.
+	embeddingMaxAttempts = 5
+	embeddingRetryBase   = 5 * time.Minute
+)
+
+// EmbeddingIndexer keeps kb_chunk_embeddings in step with kb_chunks. Chunks
+// are rewritten whenever a document changes (and their embeddings cascade
+// away), so a single sweep for chunks without an embedding from the current
+// model covers new documents, edits, model changes and reindex requests.
+type EmbeddingIndexer struct {
+	pool     *pgxpool.Pool
+	embedder Embedder
+	interval time.Duration
+}
+
+func NewEmbeddingIndexer(pool *pgxpool.Pool, embedder Embedder) *EmbeddingIndexer {
+	return &EmbeddingIndexer{pool: pool, embedder: embedder, interval: embeddingPollInterval}
+}
+
+func (x *EmbeddingIndexer) Start(ctx context.Context) {
+	ticker := time.NewTicker(x.interval)
+	defer ticker.Stop()
+
+	log.Info().Str("model", x.embedder.Model()).Msg("KB embedding indexer started")
+
+	for {
+		if n, err := x.RunOnce(ctx); err != nil {
+			log.Error().Err(err).Msg("kb embedding sweep failed")
+		} else if n > 0 {
+			log.Info().Int("chunks", n).Str("model", x.embedder.Model()).Msg("kb chunks embedded")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce embeds pending chunks in batches and returns how many were stored.
+func (x *EmbeddingIndexer) RunOnce(ctx context.Context) (int, error) {
+	total := 0
+	for i := 0; i < embeddingMaxBatches; i++ {
+		stored, picked, err := x.embedBatch(ctx)
+		total += stored
+		if err != nil {
+			return total, err
+		}
+		if picked < embeddingBatchSize {
+			return total, nil
+		}
+	}
+	return total, nil
+}
+
+// embedBatch returns how many chunks it stored and how many it picked up.
+// Chunks that failed recently or too often are not picked up.
+func (x *EmbeddingIndexer) embedBatch(ctx context.Context) (int, int, error) {
+	model := x.embedder.Model()
+	rows, err := x.pool.Query(ctx, `
+		SELECT c.id, c.content
+		FROM kb_chunks c
+		JOIN kb_documents d ON d.id = c.document_id
+		LEFT JOIN kb_chunk_embeddings e ON e.chunk_id = c.id AND e.model = $1
+		LEFT JOIN kb_chunk_embedding_failures f ON f.chunk_id = c.id AND f.model = $1
+		WHERE e.chunk_id IS NULL
+		  AND d.deleted_at IS NULL
+		  AND (f.chunk_id IS NULL OR (f.attempts < $3 AND f.next_attempt_at <= NOW()))
+		ORDER BY c.created_at ASC
+		LIMIT $2`, model, embeddingBatchSize, embeddingMaxAttempts)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var (
+		pending []pgtype.UUID
+		texts   []string
+	)
+	for rows.Next() {
+		var id pgtype.UUID
+		var content string
+		if err := rows.Scan(&id, &content); err != nil {
+			rows.Close()
+			return 0, 0, err
+		}
+		pending = append(pending, id)
+		texts = append(texts, content)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, 0, err
+	}
+	if len(pending) == 0 {
+		return 0, 0, nil
+	}
+
+	vectors, errs, batchErr := embedChunks(ctx, x.embedder, texts)
+	if ctx.Err() != nil {
+		return 0, len(pending), ctx.Err()
+	}
+
+	stored := 0
+	for i, id := range pending {
+		if errs[i] != nil {
+			if err := x.recordFailure(ctx, id, model, errs[i].Error()); err != nil {
+				return stored, len(pending), err
+			}
+			continue
+		}
+		// The chunk may have been replaced while we were embedding; the
+		// INSERT ... SELECT skips chunks that no longer exist.
+		tag, err := x.pool.Exec(ctx, `
+			INSERT INTO kb_chunk_embeddings (chunk_id, tenant_id, document_id, model, dimensions, embedding)
+			SELECT c.id, c.tenant_id, c.document_id, $2, $3, $4::real[]
+			FROM kb_chunks c WHERE c.id = $1
+			ON CONFLICT (chunk_id) DO UPDATE
+			SET model = EXCLUDED.model,
+			    dimensions = EXCLUDED.dimensions,
+			    embedding = EXCLUDED.embedding,
+			    created_at = NOW()`,
+			id, model, len(vectors[i]), vectors[i])
+		if err != nil {
+			return stored, len(pending), err
+		}
+		stored += int(tag.RowsAffected())
+		if _, err := x.pool.Exec(ctx, `DELETE FROM kb_chunk_embedding_failures WHERE chunk_id = $1`, id); err != nil {
+			return stored, len(pending), err
+		}
+	}
+	return stored, len(pending), batchErr
+}
+
+var errEmptyEmbedding = errors.New("embedder returned no vector")
+
+// embedChunks embeds a batch, falling back to one request per chunk when
+// the batch request fails so a single bad chunk cannot fail the rest. It
+// returns a vector or an error per chunk, and the batch error when no
+// chunk could be embedded at all (the provider is probably down).
+func embedChunks(ctx context.Context, e Embedder, texts []string) ([][]float32, []error, error) {
+	vectors := make([][]float32, len(texts))
+	errs := make([]error, len(texts))
+
+	batch, batchErr := e.Embed(ctx, texts)
+	if batchErr == nil {
+		for i := range texts {
+			if i < len(batch) && len(batch[i]) > 0 {
+				vectors[i] = batch[i]
+			} else {
+				errs[i] = errEmptyEmbedding
+			}
+		}
+		return vectors, errs, nil
+	}
+
+	ok := 0
+	for i, text := range texts {
+		if ctx.Err() != nil {
+			return vectors, errs, ctx.Err()
+		}
+		one, err := e.Embed(ctx, []string{text})
+		switch {
+		case err != nil:
+			errs[i] = err
+		case len(one) == 0 || len(one[0]) == 0:
+			errs[i] = errEmptyEmbedding
+		default:
+			vectors[i] = one[0]
+			ok++
+		}
+	}
+	if ok == 0 {
+		return vectors, errs, batchErr
+	}
+	return vectors, errs, nil
+}
+
+// recordFailure counts a failed attempt for the chunk under this model and
+// schedules the next one. A failure under another model starts over.
+func (x *EmbeddingIndexer) recordFailure(ctx context.Context, chunkID pgtype.UUID, model, reason string) error {
+	var attempts int
+	err := x.pool.QueryRow(ctx, `
+		INSERT INTO kb_chunk_embedding_failures (chunk_id, tenant_id, model, attempts, last_error, next_attempt_at)
+		SELECT c.id, c.tenant_id, $2, 1, $3, NOW() + make_interval(secs => $4)
+		FROM kb_chunks c WHERE c.id = $1
+		ON CONFLICT (chunk_id) DO UPDATE
+		SET attempts = CASE WHEN kb_chunk_embedding_failures.model = EXCLUDED.model
+		                    THEN kb_chunk_embedding_failures.attempts + 1 ELSE 1 END,
+		    model = EXCLUDED.model,
+		    last_error = EXCLUDED.last_error,
+		    next_attempt_at = NOW() + make_interval(secs => $4 * power(2, CASE
+		        WHEN kb_chunk_embedding_failures.model = EXCLUDED.model
+		        THEN LEAST(kb_chunk_embedding_failures.attempts, 10) ELSE 0 END)),
+		    updated_at = NOW()
+		RETURNING attempts`,
+		chunkID, model, reason, embeddingRetryBase.Seconds()).Scan(&attempts)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// The chunk was replaced while we were embedding it.
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if attempts >= embeddingMaxAttempts {
+		log.Warn().Str("chunk_id", chunkID.String()).Str("model", model).Int("attempts", attempts).
+			Msg("kb chunk skipped after repeated empty embeddings")
+	}
+	return nil
+}
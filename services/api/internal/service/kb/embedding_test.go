@@ -0,0 +1,95 @@
+package kb
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestLocalEmbedderMatchesParaphrases(t *testing.T) {
+	e := NewLocalEmbedder()
+	vecs, err := e.Embed(context.Background(), []string{
+		"when do fees have to be paid",
+		"Fee due date: the tuition payment is due by the 10th of every month.",
+		"The school bus leaves the main gate at 7:30 in the morning.",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for i, v := range vecs {
+		if len(v) != localEmbeddingDims {
+			t.Fatalf("vector %d has %d dims", i, len(v))
+		}
+		if norm := cosineSimilarity(v, v); math.Abs(norm-1) > 1e-5 {
+			t.Fatalf("vector %d is not normalised: %f", i, norm)
+		}
+	}
+
+	related := cosineSimilarity(vecs[0], vecs[1])
+	unrelated := cosineSimilarity(vecs[0], vecs[2])
+	if related <= unrelated || related < defaultMinSimilarity {
+		t.Fatalf("expected paraphrase to score higher: related=%.3f unrelated=%.3f", related, unrelated)
+	}
+}
+
+func TestRankHybridBlendsScores(t *testing.T) {
+	candidates := []*hybridCandidate{
+		{result: SearchResult{ChunkID: "lexical-only"}, lexical: 0.4, vector: 0},
+		{result: SearchResult{ChunkID: "semantic"}, lexical: 0, vector: 0.7},
+		{result: SearchResult{ChunkID: "both"}, lexical: 0.3, vector: 0.6},
+	}
+	ranked := rankHybrid(candidates, 0.6, 2)
+	if len(ranked) != 2 {
+		t.Fatalf("expected top 2, got %d", len(ranked))
+	}
+	if ranked[0].result.ChunkID != "both" || ranked[1].result.ChunkID != "semantic" {
+		t.Fatalf("unexpected order: %s, %s", ranked[0].result.ChunkID, ranked[1].result.ChunkID)
+	}
+	if math.Abs(ranked[0].score-0.48) > 1e-9 {
+		t.Fatalf("unexpected blended score %f", ranked[0].score)
+	}
+}
+
+// poisonEmbedder fails any request containing "bad" and returns no vector
+// for "empty".
+type poisonEmbedder struct{ calls int }
+
+func (e *poisonEmbedder) Model() string { return "test" }
+
+func (e *poisonEmbedder) Embed(_ context.Context, texts []string) ([][]float32, error) {
+	e.calls++
+	out := make([][]float32, len(texts))
+	for i, t := range texts {
+		switch t {
+		case "bad":
+			return nil, errors.New("input rejected")
+		case "empty":
+		default:
+			out[i] = []float32{1}
+		}
+	}
+	return out, nil
+}
+
+func TestEmbedChunksIsolatesFailingChunks(t *testing.T) {
+	e := &poisonEmbedder{}
+	vectors, errs, err := embedChunks(context.Background(), e, []string{"a", "bad", "empty", "b"})
+	if err != nil {
+		t.Fatalf("unexpected batch error: %v", err)
+	}
+	if e.calls != 5 {
+		t.Fatalf("expected one batch call and four single calls, got %d", e.calls)
+	}
+	if vectors[0] == nil || vectors[3] == nil || errs[0] != nil || errs[3] != nil {
+		t.Fatalf("expected good chunks to be embedded, got %v %v", vectors, errs)
+	}
+	if errs[1] == nil || !errors.Is(errs[2], errEmptyEmbedding) {
+		t.Fatalf("expected the bad and empty chunks to fail, got %v", errs)
+	}
+
+	_, errs, err = embedChunks(context.Background(), e, []string{"bad"})
+	if err == nil || errs[0] == nil {
+		t.Fatalf("expected a lone failing chunk to report the batch error and its own, got %v %v", err, errs)
+	}
+}
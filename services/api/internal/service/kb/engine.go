@@ -110,8 +110,9 @@ func (e *SearchOnlyAnswerEngine) Answer(ctx context.Context, query string, tenan
 	}
 
 	meta := SearchMeta{
-		UsedTrgm: useTrgm,
-		Total:    len(results),
+		UsedTrgm:  useTrgm,
+		Total:     len(results),
+		Retrieval: "lexical",
 	}
 
 	return summary, results, meta, confidence, nil
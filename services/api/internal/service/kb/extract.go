@@ -0,0 +1,282 @@
+package kb
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	SourceTypeText = "text"
+	SourceTypePDF  = "pdf"
+	SourceTypeDOCX = "docx"
+	SourceTypeHTML = "html"
+)
+
+const (
+	blockText      = "text"
+	blockHeading   = "heading"
+	blockParagraph = "paragraph"
+	blockList      = "list"
+	blockTable     = "table"
+)
+
+// sourceBlock is one structural element extracted from an uploaded file.
+type sourceBlock struct {
+	Kind   string
+	Level  int
+	Text   string
+	Rows   [][]string
+	Page   int
+	Anchor string
+}
+
+// sourceChunk is a searchable chunk that remembers where it came from.
+type sourceChunk struct {
+	Content     string
+	BlockType   string
+	SectionPath string
+	Page        int
+	Anchor      string
+}
+
+type parsedSource struct {
+	Type   string
+	SHA256 string
+	Text   string
+	Chunks []sourceChunk
+}
+
+// DetectSourceType picks an extractor from the file signature, falling back
+// to the extension and declared mime type.
+func DetectSourceType(name, mimeType string, content []byte) (string, error) {
+	switch {
+	case bytes.HasPrefix(content, []byte("%PDF-")):
+		return SourceTypePDF, nil
+	case bytes.HasPrefix(content, []byte("PK\x03\x04")):
+		if isDOCX(content) {
+			return SourceTypeDOCX, nil
+		}
+		return "", fmt.Errorf("%w: zip archive is not a DOCX document", ErrKBInvalidPayload)
+	}
+
+	ext := strings.ToLower(filepath.Ext(name))
+	mimeType = strings.ToLower(strings.TrimSpace(mimeType))
+	if idx := strings.Index(mimeType, ";"); idx >= 0 {
+		mimeType = strings.TrimSpace(mimeType[:idx])
+	}
+	if ext == ".html" || ext == ".htm" || mimeType == "text/html" || mimeType == "application/xhtml+xml" {
+		return SourceTypeHTML, nil
+	}
+	head := bytes.ToLower(bytes.TrimSpace(content[:min(len(content), 512)]))
+	if bytes.HasPrefix(head, []byte("<!doctype html")) || bytes.HasPrefix(head, []byte("<html")) {
+		return SourceTypeHTML, nil
+	}
+	return "", fmt.Errorf("%w: unsupported file type, upload a PDF, DOCX or HTML file", ErrKBInvalidPayload)
+}
+
+func parseSourceFile(file SourceFile) (parsedSource, error) {
+	if len(file.Content) == 0 {
+		return parsedSource{}, fmt.Errorf("%w: file is empty", ErrKBInvalidPayload)
+	}
+	sourceType, err := DetectSourceType(file.Name, file.MimeType, file.Content)
+	if err != nil {
+		return parsedSource{}, err
+	}
+
+	var blocks []sourceBlock
+	switch sourceType {
+	case SourceTypePDF:
+		blocks, err = extractPDF(file.Content)
+	case SourceTypeDOCX:
+		blocks, err = extractDOCX(file.Content)
+	case SourceTypeHTML:
+		blocks = extractHTML(file.Content)
+	}
+	if err != nil {
+		return parsedSource{}, fmt.Errorf("%w: could not read %s: %v", ErrKBInvalidPayload, sourceType, err)
+	}
+
+	chunks := chunkBlocks(blocks, defaultChunkSize)
+	if len(chunks) == 0 {
+		return parsedSource{}, fmt.Errorf("%w: no text could be extracted from the file", ErrKBInvalidPayload)
+	}
+
+	sum := sha256.Sum256(file.Content)
+	return parsedSource{
+		Type:   sourceType,
+		SHA256: hex.EncodeToString(sum[:]),
+		Text:   renderBlocks(blocks),
+		Chunks: chunks,
+	}, nil
+}
+
+// chunkBlocks groups extracted blocks into chunks that never cross a section
+// boundary. Paragraphs and list items are packed together up to maxChars,
+// tables are emitted on their own (split by rows with the header repeated),
+// and every chunk is prefixed with its heading path so lexical search can
+// match section titles.
+func chunkBlocks(blocks []sourceBlock, maxChars int) []sourceChunk {
+	var (
+		out      []sourceChunk
+		headings []string
+		anchor   string
+		buf      []string
+		bufLen   int
+		bufKind  string
+		bufPage  int
+	)
+
+	sectionPath := func() string {
+		parts := make([]string, 0, len(headings))
+		for _, h := range headings {
+			if h != "" {
+				parts = append(parts, h)
+			}
+		}
+		return strings.Join(parts, " > ")
+	}
+	emit := func(body, kind string, page int) {
+		body = strings.TrimSpace(body)
+		if body == "" {
+			return
+		}
+		path := sectionPath()
+		content := body
+		if path != "" {
+			content = path + "\n" + body
+		}
+		out = append(out, sourceChunk{
+			Content:     content,
+			BlockType:   kind,
+			SectionPath: path,
+			Page:        page,
+			Anchor:      anchor,
+		})
+	}
+	flush := func() {
+		if len(buf) == 0 {
+			return
+		}
+		emit(strings.Join(buf, "\n\n"), bufKind, bufPage)
+		buf, bufLen, bufKind, bufPage = nil, 0, "", 0
+	}
+
+	for _, block := range blocks {
+		text := strings.TrimSpace(block.Text)
+		switch block.Kind {
+		case blockHeading:
+			flush()
+			level := block.Level
+			if level < 1 {
+				level = 1
+			}
+			if level > 6 {
+				level = 6
+			}
+			for len(headings) < level {
+				headings = append(headings, "")
+			}
+			headings = headings[:level]
+			headings[level-1] = text
+			anchor = block.Anchor
+		case blockTable:
+			flush()
+			for _, part := range splitTable(block.Rows, maxChars) {
+				emit(part, blockTable, block.Page)
+			}
+		default:
+			if text == "" {
+				continue
+			}
+			if block.Kind == blockList {
+				text = "- " + text
+			}
+			if len([]rune(text)) > maxChars {
+				flush()
+				for _, part := range chunkText(text, maxChars, defaultChunkOverlap) {
+					emit(part, block.Kind, block.Page)
+				}
+				continue
+			}
+			if bufLen > 0 && bufLen+len([]rune(text)) > maxChars {
+				flush()
+			}
+			if len(buf) == 0 {
+				bufKind = block.Kind
+				bufPage = block.Page
+			} else if bufKind != block.Kind {
+				bufKind = blockText
+			}
+			buf = append(buf, text)
+			bufLen += len([]rune(text)) + 2
+		}
+	}
+	flush()
+	return out
+}
+
+func splitTable(rows [][]string, maxChars int) []string {
+	lines := make([]string, 0, len(rows))
+	for _, row := range rows {
+		cells := make([]string, 0, len(row))
+		empty := true
+		for _, cell := range row {
+			cell = strings.TrimSpace(cell)
+			if cell != "" {
+				empty = false
+			}
+			cells = append(cells, cell)
+		}
+		if !empty {
+			lines = append(lines, strings.Join(cells, " | "))
+		}
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+
+	header := lines[0]
+	var parts []string
+	current := []string{header}
+	size := len([]rune(header))
+	for _, line := range lines[1:] {
+		if size+len([]rune(line)) > maxChars && len(current) > 1 {
+			parts = append(parts, strings.Join(current, "\n"))
+			current = []string{header}
+			size = len([]rune(header))
+		}
+		current = append(current, line)
+		size += len([]rune(line)) + 1
+	}
+	parts = append(parts, strings.Join(current, "\n"))
+	return parts
+}
+
+// renderBlocks produces the plain-text body stored in kb_documents.content_text.
+func renderBlocks(blocks []sourceBlock) string {
+	parts := make([]string, 0, len(blocks))
+	for _, block := range blocks {
+		switch block.Kind {
+		case blockTable:
+			parts = append(parts, splitTable(block.Rows, int(^uint(0)>>1))...)
+		case blockList:
+			if text := strings.TrimSpace(block.Text); text != "" {
+				parts = append(parts, "- "+text)
+			}
+		default:
+			if text := strings.TrimSpace(block.Text); text != "" {
+				parts = append(parts, text)
+			}
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// collapseSpace folds runs of whitespace into single spaces.
+func collapseSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
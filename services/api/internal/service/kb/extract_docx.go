@@ -0,0 +1,279 @@
+package kb
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const maxDOCXPartBytes = 32 << 20
+
+func isDOCX(content []byte) bool {
+	zr, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return false
+	}
+	for _, f := range zr.File {
+		if f.Name == "word/document.xml" {
+			return true
+		}
+	}
+	return false
+}
+
+// extractDOCX reads word/document.xml, using the style sheet to tell
+// headings apart from body text. Page numbers come from the page breaks
+// Word records when it last laid the document out, falling back to explicit
+// page breaks.
+func extractDOCX(content []byte) ([]sourceBlock, error) {
+	zr, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return nil, err
+	}
+
+	var document, styles []byte
+	for _, f := range zr.File {
+		switch f.Name {
+		case "word/document.xml":
+			document, err = readZipPart(f)
+		case "word/styles.xml":
+			styles, err = readZipPart(f)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if document == nil {
+		return nil, errors.New("word/document.xml not found")
+	}
+
+	headingStyles := parseDOCXHeadingStyles(styles)
+	useRenderedBreaks := bytes.Contains(document, []byte("lastRenderedPageBreak"))
+
+	var (
+		blocks      []sourceBlock
+		page        = 1
+		inText      bool
+		para        strings.Builder
+		paraLevel   int
+		paraList    bool
+		tableDepth  int
+		rows        [][]string
+		cell        *strings.Builder
+		pendingPage bool
+	)
+
+	dec := xml.NewDecoder(bytes.NewReader(document))
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "tbl":
+				tableDepth++
+				if tableDepth == 1 {
+					rows = nil
+				}
+			case "tr":
+				if tableDepth == 1 {
+					rows = append(rows, nil)
+				}
+			case "tc":
+				if tableDepth == 1 {
+					cell = &strings.Builder{}
+				}
+			case "p":
+				if tableDepth == 0 {
+					para.Reset()
+					paraLevel, paraList = 0, false
+				}
+			case "pStyle":
+				if tableDepth == 0 {
+					paraLevel = headingStyles[docxAttr(t, "val")]
+					if paraLevel == 0 {
+						paraLevel = docxHeadingLevel(docxAttr(t, "val"))
+					}
+				}
+			case "outlineLvl":
+				if tableDepth == 0 {
+					if lvl, err := strconv.Atoi(docxAttr(t, "val")); err == nil && lvl >= 0 && lvl < 9 {
+						paraLevel = lvl + 1
+					}
+				}
+			case "numPr":
+				paraList = true
+			case "pageBreakBefore":
+				if docxAttr(t, "val") != "0" && docxAttr(t, "val") != "false" {
+					pendingPage = true
+				}
+			case "lastRenderedPageBreak":
+				if useRenderedBreaks {
+					page++
+				}
+			case "br":
+				if docxAttr(t, "type") == "page" {
+					if !useRenderedBreaks {
+						pendingPage = true
+					}
+					continue
+				}
+				writeDOCXText(&para, cell, tableDepth, " ")
+			case "tab":
+				writeDOCXText(&para, cell, tableDepth, " ")
+			case "t":
+				inText = true
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				if tableDepth > 0 {
+					writeDOCXText(&para, cell, tableDepth, " ")
+					continue
+				}
+				text := collapseSpace(para.String())
+				para.Reset()
+				if pendingPage {
+					page++
+					pendingPage = false
+				}
+				if text == "" {
+					continue
+				}
+				block := sourceBlock{Kind: blockParagraph, Text: text, Page: page}
+				switch {
+				case paraLevel > 0:
+					block.Kind = blockHeading
+					block.Level = paraLevel
+				case paraList:
+					block.Kind = blockList
+				}
+				blocks = append(blocks, block)
+			case "tc":
+				if tableDepth == 1 && cell != nil {
+					if len(rows) == 0 {
+						rows = append(rows, nil)
+					}
+					rows[len(rows)-1] = append(rows[len(rows)-1], collapseSpace(cell.String()))
+					cell = nil
+				}
+			case "tbl":
+				tableDepth--
+				if tableDepth == 0 {
+					blocks = append(blocks, sourceBlock{Kind: blockTable, Rows: rows, Page: page})
+					rows = nil
+				}
+			}
+		case xml.CharData:
+			if inText {
+				writeDOCXText(&para, cell, tableDepth, string(t))
+			}
+		}
+	}
+	return blocks, nil
+}
+
+func writeDOCXText(para *strings.Builder, cell *strings.Builder, tableDepth int, s string) {
+	if tableDepth > 0 {
+		if cell != nil {
+			cell.WriteString(s)
+		}
+		return
+	}
+	para.WriteString(s)
+}
+
+// parseDOCXHeadingStyles maps style IDs to heading levels. Style IDs are
+// localised by Word ("berschrift1", "Titre1"), so the English style name and
+// the outline level are used instead of the ID.
+func parseDOCXHeadingStyles(styles []byte) map[string]int {
+	out := map[string]int{}
+	if len(styles) == 0 {
+		return out
+	}
+
+	dec := xml.NewDecoder(bytes.NewReader(styles))
+	var (
+		styleID string
+		level   int
+	)
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			break
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "style":
+				styleID = docxAttr(t, "styleId")
+				level = 0
+			case "name":
+				if styleID != "" && level == 0 {
+					level = docxHeadingLevel(docxAttr(t, "val"))
+				}
+			case "outlineLvl":
+				if styleID != "" {
+					if lvl, err := strconv.Atoi(docxAttr(t, "val")); err == nil && lvl >= 0 && lvl < 9 {
+						level = lvl + 1
+					}
+				}
+			}
+		case xml.EndElement:
+			if t.Name.Local == "style" {
+				if styleID != "" && level > 0 {
+					out[styleID] = level
+				}
+				styleID = ""
+			}
+		}
+	}
+	return out
+}
+
+func docxHeadingLevel(name string) int {
+	normalized := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(name), " ", ""))
+	switch {
+	case normalized == "title":
+		return 1
+	case strings.HasPrefix(normalized, "heading"):
+		if lvl, err := strconv.Atoi(strings.TrimPrefix(normalized, "heading")); err == nil && lvl > 0 && lvl < 10 {
+			return lvl
+		}
+	}
+	return 0
+}
+
+func docxAttr(el xml.StartElement, local string) string {
+	for _, attr := range el.Attr {
+		if attr.Name.Local == local {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+func readZipPart(f *zip.File) ([]byte, error) {
+	if f.UncompressedSize64 > maxDOCXPartBytes {
+		return nil, fmt.Errorf("%s is too large", f.Name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(io.LimitReader(rc, maxDOCXPartBytes))
+}
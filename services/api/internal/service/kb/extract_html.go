@@ -0,0 +1,300 @@
+package kb
+
+import (
+	"bytes"
+	"html"
+	"strings"
+)
+
+// htmlSkipElements have content that should never reach the knowledgebase.
+var htmlSkipElements = map[string]bool{
+	"script": true, "style": true, "noscript": true, "template": true,
+	"title": true, "nav": true, "svg": true, "iframe": true, "object": true,
+}
+
+var htmlBlockElements = map[string]bool{
+	"p": true, "div": true, "section": true, "article": true, "main": true,
+	"blockquote": true, "pre": true, "br": true, "hr": true, "dd": true,
+	"dt": true, "figcaption": true, "header": true, "footer": true,
+	"aside": true, "form": true, "address": true, "body": true, "ul": true,
+	"ol": true, "dl": true, "caption": true,
+}
+
+type htmlTag struct {
+	name        string
+	closing     bool
+	selfClosing bool
+	attrs       map[string]string
+}
+
+// extractHTML walks the markup with a small tolerant tokenizer. It keeps
+// headings (with their id for deep links), paragraphs, list items and
+// tables; everything else is flattened into the surrounding paragraph.
+func extractHTML(content []byte) []sourceBlock {
+	var (
+		blocks     []sourceBlock
+		text       strings.Builder
+		kind       = blockParagraph
+		level      int
+		anchor     string
+		tableDepth int
+		rows       [][]string
+		cell       *strings.Builder
+		pre        bool
+	)
+
+	flush := func() {
+		value := text.String()
+		text.Reset()
+		if !pre {
+			value = collapseSpace(value)
+		}
+		value = strings.TrimSpace(value)
+		if value != "" {
+			blocks = append(blocks, sourceBlock{Kind: kind, Level: level, Text: value, Anchor: anchor})
+		}
+		kind, level, anchor = blockParagraph, 0, ""
+	}
+	endCell := func() {
+		if cell == nil {
+			return
+		}
+		if len(rows) == 0 {
+			rows = append(rows, nil)
+		}
+		rows[len(rows)-1] = append(rows[len(rows)-1], collapseSpace(cell.String()))
+		cell = nil
+	}
+	writeText := func(s string) {
+		if tableDepth > 0 {
+			if cell == nil {
+				return
+			}
+			cell.WriteString(s)
+			return
+		}
+		text.WriteString(s)
+	}
+
+	i := 0
+	for i < len(content) {
+		lt := bytes.IndexByte(content[i:], '<')
+		if lt < 0 {
+			writeText(html.UnescapeString(string(content[i:])))
+			break
+		}
+		if lt > 0 {
+			writeText(html.UnescapeString(string(content[i : i+lt])))
+		}
+		i += lt
+
+		switch {
+		case bytes.HasPrefix(content[i:], []byte("<!--")):
+			end := bytes.Index(content[i+4:], []byte("-->"))
+			if end < 0 {
+				i = len(content)
+				continue
+			}
+			i += 4 + end + 3
+			continue
+		case bytes.HasPrefix(content[i:], []byte("<!")), bytes.HasPrefix(content[i:], []byte("<?")):
+			end := bytes.IndexByte(content[i:], '>')
+			if end < 0 {
+				i = len(content)
+				continue
+			}
+			i += end + 1
+			continue
+		}
+
+		tag, next, ok := parseHTMLTag(content, i)
+		if !ok {
+			writeText("<")
+			i++
+			continue
+		}
+		i = next
+
+		if !tag.closing && !tag.selfClosing && htmlSkipElements[tag.name] {
+			i = skipHTMLElement(content, i, tag.name)
+			continue
+		}
+
+		switch tag.name {
+		case "h1", "h2", "h3", "h4", "h5", "h6":
+			if tableDepth > 0 {
+				continue
+			}
+			flush()
+			if !tag.closing {
+				kind = blockHeading
+				level = int(tag.name[1] - '0')
+				anchor = tag.attrs["id"]
+			}
+		case "a":
+			if !tag.closing && kind == blockHeading && anchor == "" {
+				if id := tag.attrs["id"]; id != "" {
+					anchor = id
+				} else {
+					anchor = tag.attrs["name"]
+				}
+			}
+		case "li":
+			if tableDepth > 0 {
+				writeText(" ")
+				continue
+			}
+			flush()
+			if !tag.closing {
+				kind = blockList
+			}
+		case "table":
+			if tag.closing {
+				if tableDepth == 0 {
+					continue
+				}
+				tableDepth--
+				if tableDepth == 0 {
+					endCell()
+					blocks = append(blocks, sourceBlock{Kind: blockTable, Rows: rows})
+					rows = nil
+				}
+				continue
+			}
+			if tableDepth == 0 {
+				flush()
+			}
+			tableDepth++
+		case "tr":
+			if tableDepth == 1 {
+				endCell()
+				if !tag.closing {
+					rows = append(rows, nil)
+				}
+			}
+		case "td", "th":
+			if tableDepth == 1 {
+				endCell()
+				if !tag.closing {
+					cell = &strings.Builder{}
+				}
+			} else if tableDepth > 1 {
+				writeText(" ")
+			}
+		case "pre":
+			if tableDepth == 0 {
+				flush()
+				pre = !tag.closing
+			}
+		default:
+			if htmlBlockElements[tag.name] {
+				if tableDepth > 0 {
+					writeText(" ")
+				} else if kind != blockHeading {
+					flush()
+				}
+			}
+		}
+	}
+	if tableDepth > 0 {
+		endCell()
+		blocks = append(blocks, sourceBlock{Kind: blockTable, Rows: rows})
+	}
+	flush()
+	return blocks
+}
+
+// parseHTMLTag reads the tag starting at content[start] (which is '<') and
+// returns the offset just past its closing '>'.
+func parseHTMLTag(content []byte, start int) (htmlTag, int, bool) {
+	i := start + 1
+	tag := htmlTag{attrs: map[string]string{}}
+	if i < len(content) && content[i] == '/' {
+		tag.closing = true
+		i++
+	}
+	nameStart := i
+	for i < len(content) && isHTMLNameByte(content[i]) {
+		i++
+	}
+	if i == nameStart {
+		return htmlTag{}, start, false
+	}
+	tag.name = strings.ToLower(string(content[nameStart:i]))
+
+	for i < len(content) {
+		for i < len(content) && isHTMLSpace(content[i]) {
+			i++
+		}
+		if i >= len(content) {
+			break
+		}
+		if content[i] == '>' {
+			return tag, i + 1, true
+		}
+		if content[i] == '/' {
+			i++
+			tag.selfClosing = i < len(content) && content[i] == '>'
+			continue
+		}
+		keyStart := i
+		for i < len(content) && !isHTMLSpace(content[i]) && content[i] != '=' && content[i] != '>' && content[i] != '/' {
+			i++
+		}
+		key := strings.ToLower(string(content[keyStart:i]))
+		for i < len(content) && isHTMLSpace(content[i]) {
+			i++
+		}
+		value := ""
+		if i < len(content) && content[i] == '=' {
+			i++
+			for i < len(content) && isHTMLSpace(content[i]) {
+				i++
+			}
+			if i < len(content) && (content[i] == '"' || content[i] == '\'') {
+				quote := content[i]
+				i++
+				valueStart := i
+				for i < len(content) && content[i] != quote {
+					i++
+				}
+				value = string(content[valueStart:i])
+				if i < len(content) {
+					i++
+				}
+			} else {
+				valueStart := i
+				for i < len(content) && !isHTMLSpace(content[i]) && content[i] != '>' {
+					i++
+				}
+				value = string(content[valueStart:i])
+			}
+		}
+		if key != "" {
+			tag.attrs[key] = html.UnescapeString(value)
+		}
+	}
+	return tag, len(content), true
+}
+
+func skipHTMLElement(content []byte, from int, name string) int {
+	closing := []byte("</" + name)
+	lower := bytes.ToLower(content[from:])
+	idx := bytes.Index(lower, closing)
+	if idx < 0 {
+		return len(content)
+	}
+	end := bytes.IndexByte(content[from+idx:], '>')
+	if end < 0 {
+		return len(content)
+	}
+	return from + idx + end + 1
+}
+
+func isHTMLNameByte(b byte) bool {
+	return (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z') || (b >= '0' && b <= '9') || b == '-' || b == ':'
+}
+
+func isHTMLSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r' || b == '\f'
+}
@@ -0,0 +1,1048 @@
+package kb
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+)
+
+// The PDF reader below understands just enough of the format to pull text
+// out of the documents schools typically upload (circulars, handbooks, fee
+// notices exported from Word or Google Docs): indirect objects, object
+// streams, Flate-compressed content, the page tree and ToUnicode CMaps.
+// Layout is approximated from text positioning operators so paragraphs and
+// larger-font headings survive extraction.
+
+const maxPDFStreamBytes = 64 << 20
+
+type (
+	pdfName    string
+	pdfKeyword string
+	pdfDict    map[string]interface{}
+	pdfRef     struct{ num, gen int }
+)
+
+type pdfObject struct {
+	value  interface{}
+	stream []byte
+}
+
+type pdfDocument struct {
+	objects map[int]*pdfObject
+	fonts   map[int]*pdfFont
+}
+
+type pdfFont struct {
+	cmap    map[uint32]string
+	codeLen int
+	twoByte bool
+}
+
+type pdfLine struct {
+	text string
+	size float64
+	y    float64
+	page int
+	// gapBefore is true when the line starts a new visual paragraph.
+	gapBefore bool
+}
+
+var pdfObjHeader = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+
+func extractPDF(content []byte) ([]sourceBlock, error) {
+	doc := &pdfDocument{objects: map[int]*pdfObject{}, fonts: map[int]*pdfFont{}}
+	if err := doc.scanObjects(content); err != nil {
+		return nil, err
+	}
+	if len(doc.objects) == 0 {
+		return nil, errors.New("no PDF objects found")
+	}
+	doc.expandObjectStreams()
+
+	pages := doc.pages()
+	if len(pages) == 0 {
+		return nil, errors.New("no pages found")
+	}
+
+	var lines []pdfLine
+	for idx, page := range pages {
+		lines = append(lines, doc.pageLines(page, idx+1)...)
+	}
+	if len(lines) == 0 && bytes.Contains(content, []byte("/Encrypt")) {
+		return nil, errors.New("encrypted PDFs are not supported")
+	}
+	return groupPDFLines(lines), nil
+}
+
+func (d *pdfDocument) scanObjects(content []byte) error {
+	for _, loc := range pdfObjHeader.FindAllSubmatchIndex(content, -1) {
+		num, err := strconv.Atoi(string(content[loc[2]:loc[3]]))
+		if err != nil {
+			continue
+		}
+		lex := &pdfLexer{data: content, pos: loc[1]}
+		value := lex.value()
+		if lex.err != nil {
+			return fmt.Errorf("object %d: %w", num, lex.err)
+		}
+		obj := &pdfObject{value: value}
+
+		lex.skipSpace()
+		if dict, ok := value.(pdfDict); ok && bytes.HasPrefix(content[lex.pos:], []byte("stream")) {
+			start := lex.pos + len("stream")
+			if start < len(content) && content[start] == '\r' {
+				start++
+			}
+			if start < len(content) && content[start] == '\n' {
+				start++
+			}
+			end := -1
+			if length, ok := dict["Length"].(float64); ok {
+				candidate := start + int(length)
+				if candidate <= len(content) && candidate >= start {
+					rest := bytes.TrimLeft(content[candidate:min(len(content), candidate+32)], "\r\n \t")
+					if bytes.HasPrefix(rest, []byte("endstream")) {
+						end = candidate
+					}
+				}
+			}
+			if end < 0 {
+				idx := bytes.Index(content[start:], []byte("endstream"))
+				if idx < 0 {
+					continue
+				}
+				end = start + idx
+			}
+			obj.stream = content[start:end]
+		}
+		// Later definitions win, which matches incremental updates.
+		d.objects[num] = obj
+	}
+	return nil
+}
+
+func (d *pdfDocument) expandObjectStreams() {
+	nums := make([]int, 0, len(d.objects))
+	for num := range d.objects {
+		nums = append(nums, num)
+	}
+	sort.Ints(nums)
+	for _, num := range nums {
+		obj := d.objects[num]
+		dict, ok := obj.value.(pdfDict)
+		if !ok || dict["Type"] != pdfName("ObjStm") {
+			continue
+		}
+		data, err := d.decodeStream(obj)
+		if err != nil {
+			continue
+		}
+		count, _ := dict["N"].(float64)
+		first, _ := dict["First"].(float64)
+		header := &pdfLexer{data: data}
+		for i := 0; i < int(count); i++ {
+			objNum, ok1 := header.value().(float64)
+			offset, ok2 := header.value().(float64)
+			if !ok1 || !ok2 {
+				break
+			}
+			if _, exists := d.objects[int(objNum)]; exists {
+				continue
+			}
+			pos := int(first) + int(offset)
+			if pos < 0 || pos >= len(data) {
+				continue
+			}
+			lex := &pdfLexer{data: data, pos: pos}
+			d.objects[int(objNum)] = &pdfObject{value: lex.value()}
+		}
+	}
+}
+
+func (d *pdfDocument) resolve(v interface{}) interface{} {
+	for i := 0; i < 16; i++ {
+		ref, ok := v.(pdfRef)
+		if !ok {
+			return v
+		}
+		obj := d.objects[ref.num]
+		if obj == nil {
+			return nil
+		}
+		v = obj.value
+	}
+	return nil
+}
+
+func (d *pdfDocument) dict(v interface{}) pdfDict {
+	out, _ := d.resolve(v).(pdfDict)
+	return out
+}
+
+func (d *pdfDocument) findDict(match func(pdfDict) bool) pdfDict {
+	for _, obj := range d.objects {
+		if dict, ok := obj.value.(pdfDict); ok && match(dict) {
+			return dict
+		}
+	}
+	return nil
+}
+
+func (d *pdfDocument) decodeStream(obj *pdfObject) ([]byte, error) {
+	if obj == nil || obj.stream == nil {
+		return nil, errors.New("missing stream")
+	}
+	dict, _ := obj.value.(pdfDict)
+	var filters []interface{}
+	switch f := d.resolve(dict["Filter"]).(type) {
+	case pdfName:
+		filters = []interface{}{f}
+	case []interface{}:
+		filters = f
+	}
+
+	data := obj.stream
+	for _, raw := range filters {
+		switch d.resolve(raw) {
+		case pdfName("FlateDecode"), pdfName("Fl"):
+			zr, err := zlib.NewReader(bytes.NewReader(data))
+			if err != nil {
+				return nil, err
+			}
+			decoded, err := io.ReadAll(io.LimitReader(zr, maxPDFStreamBytes))
+			zr.Close()
+			// Truncated streams are common; keep whatever inflated cleanly.
+			if err != nil && len(decoded) == 0 {
+				return nil, err
+			}
+			data = decoded
+		case pdfName("ASCIIHexDecode"), pdfName("AHx"):
+			data = decodePDFHex(data)
+		default:
+			return nil, errors.New("unsupported stream filter")
+		}
+	}
+	return data, nil
+}
+
+// pages walks the page tree from the catalog, falling back to object order
+// when the catalog cannot be found.
+func (d *pdfDocument) pages() []pdfDict {
+	var out []pdfDict
+	if catalog := d.findDict(func(dict pdfDict) bool { return dict["Type"] == pdfName("Catalog") }); catalog != nil {
+		seen := map[int]bool{}
+		var walk func(v interface{}, depth int)
+		walk = func(v interface{}, depth int) {
+			if depth > 64 {
+				return
+			}
+			if ref, ok := v.(pdfRef); ok {
+				if seen[ref.num] {
+					return
+				}
+				seen[ref.num] = true
+			}
+			node := d.dict(v)
+			if node == nil {
+				return
+			}
+			if node["Type"] == pdfName("Page") {
+				out = append(out, node)
+				return
+			}
+			kids, _ := d.resolve(node["Kids"]).([]interface{})
+			for _, kid := range kids {
+				walk(kid, depth+1)
+			}
+		}
+		walk(catalog["Pages"], 0)
+	}
+	if len(out) > 0 {
+		return out
+	}
+
+	nums := make([]int, 0)
+	for num, obj := range d.objects {
+		if dict, ok := obj.value.(pdfDict); ok && dict["Type"] == pdfName("Page") {
+			nums = append(nums, num)
+		}
+	}
+	sort.Ints(nums)
+	for _, num := range nums {
+		out = append(out, d.objects[num].value.(pdfDict))
+	}
+	return out
+}
+
+func (d *pdfDocument) pageResources(page pdfDict) pdfDict {
+	node := page
+	for i := 0; node != nil && i < 32; i++ {
+		if res := d.dict(node["Resources"]); res != nil {
+			return res
+		}
+		node = d.dict(node["Parent"])
+	}
+	return nil
+}
+
+func (d *pdfDocument) pageContent(page pdfDict) []byte {
+	var refs []interface{}
+	switch c := page["Contents"].(type) {
+	case pdfRef:
+		if arr, ok := d.resolve(c).([]interface{}); ok {
+			refs = arr
+		} else {
+			refs = []interface{}{c}
+		}
+	case []interface{}:
+		refs = c
+	}
+
+	var buf bytes.Buffer
+	for _, raw := range refs {
+		ref, ok := raw.(pdfRef)
+		if !ok {
+			continue
+		}
+		data, err := d.decodeStream(d.objects[ref.num])
+		if err != nil {
+			continue
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+func (d *pdfDocument) font(resources pdfDict, name pdfName) *pdfFont {
+	fonts := d.dict(resources["Font"])
+	if fonts == nil {
+		return nil
+	}
+	raw := fonts[string(name)]
+	cacheKey := -1
+	if ref, ok := raw.(pdfRef); ok {
+		cacheKey = ref.num
+		if f, ok := d.fonts[cacheKey]; ok {
+			return f
+		}
+	}
+
+	fontDict := d.dict(raw)
+	font := &pdfFont{codeLen: 1}
+	if fontDict != nil {
+		font.twoByte = fontDict["Subtype"] == pdfName("Type0")
+		if font.twoByte {
+			font.codeLen = 2
+		}
+		if ref, ok := fontDict["ToUnicode"].(pdfRef); ok {
+			if data, err := d.decodeStream(d.objects[ref.num]); err == nil {
+				font.cmap, font.codeLen = parseToUnicode(data, font.codeLen)
+			}
+		}
+	}
+	if cacheKey >= 0 {
+		d.fonts[cacheKey] = font
+	}
+	return font
+}
+
+func (f *pdfFont) decode(raw []byte) string {
+	if f == nil || (f.cmap == nil && !f.twoByte) {
+		return latin1(raw)
+	}
+	if f.cmap == nil {
+		// Composite font without a ToUnicode map: the glyph IDs carry no
+		// recoverable text.
+		return ""
+	}
+	var b strings.Builder
+	step := f.codeLen
+	if step < 1 {
+		step = 1
+	}
+	for i := 0; i+step <= len(raw); i += step {
+		var code uint32
+		for j := 0; j < step; j++ {
+			code = code<<8 | uint32(raw[i+j])
+		}
+		if s, ok := f.cmap[code]; ok {
+			b.WriteString(s)
+		} else if step == 1 {
+			b.WriteRune(rune(raw[i]))
+		}
+	}
+	return b.String()
+}
+
+func latin1(raw []byte) string {
+	runes := make([]rune, 0, len(raw))
+	for _, c := range raw {
+		runes = append(runes, rune(c))
+	}
+	return string(runes)
+}
+
+// parseToUnicode reads bfchar/bfrange mappings from a ToUnicode CMap.
+func parseToUnicode(data []byte, defaultLen int) (map[uint32]string, int) {
+	out := map[uint32]string{}
+	codeLen := 0
+	lex := &pdfLexer{data: data}
+	var operands []interface{}
+	for {
+		v := lex.value()
+		if v == nil && lex.pos >= len(data) {
+			break
+		}
+		kw, ok := v.(pdfKeyword)
+		if !ok {
+			operands = append(operands, v)
+			continue
+		}
+		switch kw {
+		case "endcodespacerange":
+			for _, op := range operands {
+				if s, ok := op.(string); ok && len(s) > codeLen {
+					codeLen = len(s)
+				}
+			}
+		case "endbfchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				src, ok1 := operands[i].(string)
+				dst, ok2 := operands[i+1].(string)
+				if ok1 && ok2 {
+					out[pdfCode(src)] = utf16String(dst)
+				}
+			}
+		case "endbfrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				lo, ok1 := operands[i].(string)
+				hi, ok2 := operands[i+1].(string)
+				if !ok1 || !ok2 {
+					continue
+				}
+				start, end := pdfCode(lo), pdfCode(hi)
+				if end < start || end-start > 0xFFFF {
+					continue
+				}
+				switch dst := operands[i+2].(type) {
+				case string:
+					base := []rune(utf16String(dst))
+					if len(base) == 0 {
+						continue
+					}
+					for code := start; code <= end; code++ {
+						r := append([]rune{}, base...)
+						r[len(r)-1] += rune(code - start)
+						out[code] = string(r)
+					}
+				case []interface{}:
+					for idx, item := range dst {
+						if s, ok := item.(string); ok && start+uint32(idx) <= end {
+							out[start+uint32(idx)] = utf16String(s)
+						}
+					}
+				}
+			}
+		}
+		operands = operands[:0]
+	}
+	if codeLen == 0 {
+		codeLen = defaultLen
+	}
+	return out, codeLen
+}
+
+func pdfCode(s string) uint32 {
+	var code uint32
+	for i := 0; i < len(s); i++ {
+		code = code<<8 | uint32(s[i])
+	}
+	return code
+}
+
+func utf16String(s string) string {
+	if len(s)%2 != 0 {
+		return latin1([]byte(s))
+	}
+	units := make([]uint16, 0, len(s)/2)
+	for i := 0; i+1 < len(s); i += 2 {
+		units = append(units, uint16(s[i])<<8|uint16(s[i+1]))
+	}
+	return string(utf16.Decode(units))
+}
+
+// pageLines interprets the text operators of one page's content stream.
+func (d *pdfDocument) pageLines(page pdfDict, pageNumber int) []pdfLine {
+	content := d.pageContent(page)
+	if len(content) == 0 {
+		return nil
+	}
+	resources := d.pageResources(page)
+
+	var (
+		lines    []pdfLine
+		current  strings.Builder
+		font     *pdfFont
+		fontSize = 12.0
+		scale    = 1.0
+		leading  float64
+		y        float64
+		lineY    float64
+		lineSize float64
+		lastY    = math.NaN()
+		operands []interface{}
+	)
+
+	effectiveSize := func() float64 {
+		size := math.Abs(fontSize * scale)
+		if size == 0 {
+			return 12
+		}
+		return size
+	}
+	flushLine := func() {
+		text := collapseSpace(current.String())
+		current.Reset()
+		size := lineSize
+		lineSize = 0
+		if text == "" {
+			return
+		}
+		gap := false
+		if !math.IsNaN(lastY) {
+			delta := lastY - lineY
+			gap = delta > size*1.8 || delta < -size*0.5
+		}
+		lines = append(lines, pdfLine{text: text, size: size, y: lineY, page: pageNumber, gapBefore: gap})
+		lastY = lineY
+	}
+	moveTo := func(newY float64) {
+		if math.Abs(newY-y) > 0.5 {
+			flushLine()
+			lineY = newY
+		} else if current.Len() > 0 {
+			current.WriteByte(' ')
+		}
+		y = newY
+	}
+	show := func(raw string) {
+		if current.Len() == 0 {
+			lineY = y
+		}
+		lineSize = math.Max(lineSize, effectiveSize())
+		current.WriteString(font.decode([]byte(raw)))
+	}
+	num := func(i int) float64 {
+		if i < 0 || i >= len(operands) {
+			return 0
+		}
+		f, _ := operands[i].(float64)
+		return f
+	}
+
+	lex := &pdfLexer{data: content}
+	for lex.pos < len(content) {
+		v := lex.value()
+		kw, ok := v.(pdfKeyword)
+		if !ok {
+			if v != nil {
+				operands = append(operands, v)
+			}
+			continue
+		}
+		switch kw {
+		case "BT":
+			scale = 1
+		case "ET":
+			// Text objects often hold a single line; keep positioning state.
+		case "Tf":
+			if len(operands) >= 2 {
+				if name, ok := operands[0].(pdfName); ok {
+					font = d.font(resources, name)
+				}
+				fontSize = num(1)
+			}
+		case "TL":
+			leading = num(0)
+		case "Td":
+			moveTo(y + num(1)*scale)
+		case "TD":
+			leading = -num(1)
+			moveTo(y + num(1)*scale)
+		case "Tm":
+			if len(operands) >= 6 {
+				if sy := num(3); sy != 0 {
+					scale = sy
+				}
+				moveTo(num(5))
+			}
+		case "T*":
+			moveTo(y - leading*scale)
+		case "Tj":
+			if s, ok := lastOperand(operands).(string); ok {
+				show(s)
+			}
+		case "'", "\"":
+			moveTo(y - leading*scale)
+			if s, ok := lastOperand(operands).(string); ok {
+				show(s)
+			}
+		case "TJ":
+			if arr, ok := lastOperand(operands).([]interface{}); ok {
+				for _, item := range arr {
+					switch it := item.(type) {
+					case string:
+						show(it)
+					case float64:
+						if it < -250 {
+							current.WriteByte(' ')
+						}
+					}
+				}
+			}
+		case "BI":
+			lex.skipInlineImage()
+		}
+		operands = operands[:0]
+	}
+	flushLine()
+	return lines
+}
+
+func lastOperand(operands []interface{}) interface{} {
+	if len(operands) == 0 {
+		return nil
+	}
+	return operands[len(operands)-1]
+}
+
+// groupPDFLines turns positioned lines into headings, list items and
+// paragraphs. The body font size is the size used by most characters; short
+// lines noticeably larger than that are treated as headings.
+func groupPDFLines(lines []pdfLine) []sourceBlock {
+	if len(lines) == 0 {
+		return nil
+	}
+	weights := map[float64]int{}
+	for _, line := range lines {
+		weights[math.Round(line.size*2)/2] += len(line.text)
+	}
+	body, best := 0.0, -1
+	for size, weight := range weights {
+		if weight > best || (weight == best && size < body) {
+			body, best = size, weight
+		}
+	}
+
+	headingLevel := func(line pdfLine) int {
+		if body <= 0 || len([]rune(line.text)) > 150 {
+			return 0
+		}
+		ratio := line.size / body
+		switch {
+		case ratio >= 1.8:
+			return 1
+		case ratio >= 1.45:
+			return 2
+		case ratio >= 1.15:
+			return 3
+		}
+		return 0
+	}
+
+	var (
+		blocks []sourceBlock
+		para   []string
+		kind   string
+		page   int
+	)
+	flush := func() {
+		if len(para) == 0 {
+			return
+		}
+		blocks = append(blocks, sourceBlock{Kind: kind, Text: joinPDFLines(para), Page: page})
+		para = nil
+	}
+
+	for i, line := range lines {
+		if level := headingLevel(line); level > 0 {
+			// Multi-line headings arrive as consecutive large lines.
+			if i > 0 && len(blocks) > 0 && len(para) == 0 && !line.gapBefore {
+				last := &blocks[len(blocks)-1]
+				if last.Kind == blockHeading && last.Level == level && last.Page == line.page {
+					last.Text += " " + line.text
+					continue
+				}
+			}
+			flush()
+			blocks = append(blocks, sourceBlock{Kind: blockHeading, Level: level, Text: line.text, Page: line.page})
+			continue
+		}
+
+		item, isItem := stripListMarker(line.text)
+		if isItem || line.gapBefore || line.page != page || (len(para) > 0 && kind == blockList && line.size != lines[i-1].size) {
+			flush()
+		}
+		if len(para) == 0 {
+			kind = blockParagraph
+			page = line.page
+			if isItem {
+				kind = blockList
+			}
+		}
+		if isItem {
+			para = append(para, item)
+		} else {
+			para = append(para, line.text)
+		}
+	}
+	flush()
+	return blocks
+}
+
+var pdfListMarker = regexp.MustCompile(`^(?:[•▪◦●■\-–*]|\(?[0-9]{1,2}[.)]|\(?[a-zA-Z][.)])\s+`)
+
+func stripListMarker(text string) (string, bool) {
+	loc := pdfListMarker.FindStringIndex(text)
+	if loc == nil {
+		return text, false
+	}
+	return strings.TrimSpace(text[loc[1]:]), true
+}
+
+func joinPDFLines(lines []string) string {
+	var b strings.Builder
+	for i, line := range lines {
+		if i > 0 {
+			prev := b.String()
+			next := []rune(line)
+			if strings.HasSuffix(prev, "-") && len(next) > 0 && unicode.IsLower(next[0]) {
+				// Re-join words hyphenated across a line break.
+				trimmed := strings.TrimSuffix(prev, "-")
+				b.Reset()
+				b.WriteString(trimmed)
+			} else {
+				b.WriteByte(' ')
+			}
+		}
+		b.WriteString(line)
+	}
+	return b.String()
+}
+
+func decodePDFHex(data []byte) []byte {
+	out := make([]byte, 0, len(data)/2)
+	var hi byte
+	haveHi := false
+	for _, c := range data {
+		if c == '>' {
+			break
+		}
+		v, ok := hexNibble(c)
+		if !ok {
+			continue
+		}
+		if !haveHi {
+			hi, haveHi = v, true
+			continue
+		}
+		out = append(out, hi<<4|v)
+		haveHi = false
+	}
+	if haveHi {
+		out = append(out, hi<<4)
+	}
+	return out
+}
+
+func hexNibble(c byte) (byte, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0', true
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10, true
+	case c >= 'A' && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
+
+// pdfLexer parses PDF object syntax. Strings are returned as Go strings
+// holding the raw bytes; operators in content streams come back as
+// pdfKeyword values.
+type pdfLexer struct {
+	data  []byte
+	pos   int
+	depth int
+	err   error
+}
+
+var errPDFUnterminatedHex = errors.New("unterminated hex string")
+
+func (l *pdfLexer) skipSpace() {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		if c == '%' {
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+			continue
+		}
+		if !isPDFSpace(c) {
+			return
+		}
+		l.pos++
+	}
+}
+
+func (l *pdfLexer) value() interface{} {
+	l.skipSpace()
+	if l.pos >= len(l.data) {
+		return nil
+	}
+	if l.depth > 64 {
+		l.pos = len(l.data)
+		return nil
+	}
+
+	c := l.data[l.pos]
+	switch {
+	case c == '<' && l.pos+1 < len(l.data) && l.data[l.pos+1] == '<':
+		l.pos += 2
+		l.depth++
+		defer func() { l.depth-- }()
+		dict := pdfDict{}
+		for {
+			l.skipSpace()
+			if l.pos >= len(l.data) {
+				return dict
+			}
+			if l.data[l.pos] == '>' {
+				l.pos = min(l.pos+2, len(l.data))
+				return dict
+			}
+			key, ok := l.value().(pdfName)
+			if !ok {
+				continue
+			}
+			dict[string(key)] = l.value()
+		}
+	case c == '<':
+		end := bytes.IndexByte(l.data[l.pos:], '>')
+		if end < 0 {
+			l.err = errPDFUnterminatedHex
+			l.pos = len(l.data)
+			return nil
+		}
+		raw := l.data[l.pos+1 : l.pos+end]
+		l.pos += end + 1
+		return string(decodePDFHex(raw))
+	case c == '(':
+		return l.literalString()
+	case c == '[':
+		l.pos++
+		l.depth++
+		defer func() { l.depth-- }()
+		arr := []interface{}{}
+		for {
+			l.skipSpace()
+			if l.pos >= len(l.data) {
+				return arr
+			}
+			if l.data[l.pos] == ']' {
+				l.pos++
+				return arr
+			}
+			arr = append(arr, l.value())
+		}
+	case c == '/':
+		l.pos++
+		start := l.pos
+		for l.pos < len(l.data) && !isPDFSpace(l.data[l.pos]) && !isPDFDelimiter(l.data[l.pos]) {
+			l.pos++
+		}
+		return pdfName(decodePDFName(l.data[start:l.pos]))
+	case c == '+' || c == '-' || c == '.' || (c >= '0' && c <= '9'):
+		n := l.number()
+		// Look ahead for an indirect reference: "12 0 R".
+		if n == math.Trunc(n) && n >= 0 {
+			save := l.pos
+			l.skipSpace()
+			genStart := l.pos
+			for l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '9' {
+				l.pos++
+			}
+			if l.pos > genStart {
+				gen, _ := strconv.Atoi(string(l.data[genStart:l.pos]))
+				l.skipSpace()
+				if l.pos < len(l.data) && l.data[l.pos] == 'R' && (l.pos+1 >= len(l.data) || isPDFSpace(l.data[l.pos+1]) || isPDFDelimiter(l.data[l.pos+1])) {
+					l.pos++
+					return pdfRef{num: int(n), gen: gen}
+				}
+			}
+			l.pos = save
+		}
+		return n
+	case c == ']' || c == '>' || c == ')' || c == '{' || c == '}':
+		l.pos++
+		return pdfKeyword(string(c))
+	default:
+		start := l.pos
+		for l.pos < len(l.data) && !isPDFSpace(l.data[l.pos]) && !isPDFDelimiter(l.data[l.pos]) {
+			l.pos++
+		}
+		if l.pos == start {
+			l.pos++
+		}
+		word := string(l.data[start:l.pos])
+		switch word {
+		case "true":
+			return true
+		case "false":
+			return false
+		case "null":
+			return nil
+		}
+		return pdfKeyword(word)
+	}
+}
+
+func (l *pdfLexer) number() float64 {
+	start := l.pos
+	l.pos++
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		if (c >= '0' && c <= '9') || c == '.' {
+			l.pos++
+			continue
+		}
+		break
+	}
+	f, err := strconv.ParseFloat(string(l.data[start:l.pos]), 64)
+	if err != nil {
+		return 0
+	}
+	return f
+}
+
+func (l *pdfLexer) literalString() string {
+	l.pos++
+	var b []byte
+	depth := 1
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			depth++
+			b = append(b, c)
+		case ')':
+			depth--
+			if depth == 0 {
+				return string(b)
+			}
+			b = append(b, c)
+		case '\\':
+			if l.pos >= len(l.data) {
+				return string(b)
+			}
+			e := l.data[l.pos]
+			l.pos++
+			switch e {
+			case 'n':
+				b = append(b, '\n')
+			case 'r':
+				b = append(b, '\r')
+			case 't':
+				b = append(b, '\t')
+			case 'b':
+				b = append(b, '\b')
+			case 'f':
+				b = append(b, '\f')
+			case '\r':
+				if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+			case '\n':
+			default:
+				if e >= '0' && e <= '7' {
+					v := int(e - '0')
+					for i := 0; i < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+						v = v*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					b = append(b, byte(v))
+				} else {
+					b = append(b, e)
+				}
+			}
+		default:
+			b = append(b, c)
+		}
+	}
+	return string(b)
+}
+
+// skipInlineImage jumps over "ID <binary data> EI" after a BI operator.
+func (l *pdfLexer) skipInlineImage() {
+	idx := bytes.Index(l.data[l.pos:], []byte("ID"))
+	if idx < 0 {
+		l.pos = len(l.data)
+		return
+	}
+	l.pos += idx + 2
+	for l.pos < len(l.data) {
+		idx := bytes.Index(l.data[l.pos:], []byte("EI"))
+		if idx < 0 {
+			l.pos = len(l.data)
+			return
+		}
+		at := l.pos + idx
+		l.pos = at + 2
+		if at > 0 && isPDFSpace(l.data[at-1]) && (l.pos >= len(l.data) || isPDFSpace(l.data[l.pos])) {
+			return
+		}
+	}
+}
+
+func decodePDFName(raw []byte) string {
+	if bytes.IndexByte(raw, '#') < 0 {
+		return string(raw)
+	}
+	out := make([]byte, 0, len(raw))
+	for i := 0; i < len(raw); i++ {
+		if raw[i] == '#' && i+2 < len(raw) {
+			hi, ok1 := hexNibble(raw[i+1])
+			lo, ok2 := hexNibble(raw[i+2])
+			if ok1 && ok2 {
+				out = append(out, hi<<4|lo)
+				i += 2
+				continue
+			}
+		}
+		out = append(out, raw[i])
+	}
+	return string(out)
+}
+
+func isPDFSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == 0
+}
+
+func isPDFDelimiter(c byte) bool {
+	switch c {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
@@ -0,0 +1,157 @@
+package kb
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestExtractHTMLKeepsStructure(t *testing.T) {
+	page := `<!doctype html><html><head><title>Ignored</title><style>p{}</style></head>
+<body><nav><a href="/">Home</a></nav>
+<h1 id="fees">Fee Policy</h1>
+<p>Fees are due by the <b>10th</b> of each month &amp; late fees apply.</p>
+<h2 id="late">Late payment</h2>
+<ul><li>Rs 50 per day</li><li>Max Rs 500</li></ul>
+<table><tr><th>Grade</th><th>Fee</th></tr><tr><td>1</td><td>1200</td></tr></table>
+<script>alert(1)</script></body></html>`
+
+	chunks := chunkBlocks(extractHTML([]byte(page)), defaultChunkSize)
+	if len(chunks) != 3 {
+		t.Fatalf("expected 3 chunks, got %d: %#v", len(chunks), chunks)
+	}
+	if chunks[0].SectionPath != "Fee Policy" || chunks[0].Anchor != "fees" {
+		t.Fatalf("unexpected first chunk: %#v", chunks[0])
+	}
+	if !strings.Contains(chunks[0].Content, "due by the 10th of each month & late fees apply.") {
+		t.Fatalf("unexpected paragraph text: %q", chunks[0].Content)
+	}
+	if chunks[1].SectionPath != "Fee Policy > Late payment" || chunks[1].BlockType != blockList {
+		t.Fatalf("unexpected list chunk: %#v", chunks[1])
+	}
+	if chunks[2].BlockType != blockTable || !strings.Contains(chunks[2].Content, "Grade | Fee\n1 | 1200") {
+		t.Fatalf("unexpected table chunk: %#v", chunks[2])
+	}
+	for _, c := range chunks {
+		if strings.Contains(c.Content, "alert") || strings.Contains(c.Content, "Home") || strings.Contains(c.Content, "Ignored") {
+			t.Fatalf("skipped content leaked into chunk: %q", c.Content)
+		}
+	}
+}
+
+func TestExtractDOCXHeadingsTablesAndPages(t *testing.T) {
+	document := `<?xml version="1.0" encoding="UTF-8"?>
+<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>
+<w:p><w:pPr><w:pStyle w:val="Kop1"/></w:pPr><w:r><w:t>Transport</w:t></w:r></w:p>
+<w:p><w:r><w:t xml:space="preserve">Buses leave at </w:t></w:r><w:r><w:t>7:30.</w:t></w:r></w:p>
+<w:p><w:r><w:br w:type="page"/></w:r></w:p>
+<w:tbl><w:tr><w:tc><w:p><w:r><w:t>Route</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>Stop</w:t></w:r></w:p></w:tc></w:tr>
+<w:tr><w:tc><w:p><w:r><w:t>R1</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>Main Gate</w:t></w:r></w:p></w:tc></w:tr></w:tbl>
+</w:body></w:document>`
+	styles := `<?xml version="1.0" encoding="UTF-8"?>
+<w:styles xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">
+<w:style w:type="paragraph" w:styleId="Kop1"><w:name w:val="heading 1"/></w:style>
+</w:styles>`
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, body := range map[string]string{"word/document.xml": document, "word/styles.xml": styles} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = w.Write([]byte(body))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := parseSourceFile(SourceFile{Name: "transport.docx", Content: buf.Bytes()})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if parsed.Type != SourceTypeDOCX {
+		t.Fatalf("expected docx, got %s", parsed.Type)
+	}
+	if len(parsed.Chunks) != 2 {
+		t.Fatalf("expected 2 chunks, got %#v", parsed.Chunks)
+	}
+	if parsed.Chunks[0].Content != "Transport\nBuses leave at 7:30." || parsed.Chunks[0].Page != 1 {
+		t.Fatalf("unexpected paragraph chunk: %#v", parsed.Chunks[0])
+	}
+	if parsed.Chunks[1].BlockType != blockTable || parsed.Chunks[1].Page != 2 || !strings.Contains(parsed.Chunks[1].Content, "R1 | Main Gate") {
+		t.Fatalf("unexpected table chunk: %#v", parsed.Chunks[1])
+	}
+}
+
+func TestExtractPDFPagesAndHeadings(t *testing.T) {
+	pageOne := "BT /F1 24 Tf 72 720 Td (School Handbook) Tj ET\n" +
+		"BT /F1 11 Tf 72 680 Td (Classes begin at 8 a.m.) Tj 0 -14 Td [(every) -300 (week)] TJ ET"
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	_, _ = zw.Write([]byte(pageOne))
+	_ = zw.Close()
+	pageTwo := "BT /F1 11 Tf 72 720 Td (Uniform is mandatory.) Tj ET"
+
+	var pdf bytes.Buffer
+	pdf.WriteString("%PDF-1.4\n")
+	pdf.WriteString("1 0 obj << /Type /Catalog /Pages 2 0 R >> endobj\n")
+	pdf.WriteString("2 0 obj << /Type /Pages /Kids [3 0 R 4 0 R] /Count 2 /Resources << /Font << /F1 7 0 R >> >> >> endobj\n")
+	pdf.WriteString("3 0 obj << /Type /Page /Parent 2 0 R /Contents 5 0 R >> endobj\n")
+	pdf.WriteString("4 0 obj << /Type /Page /Parent 2 0 R /Contents 6 0 R >> endobj\n")
+	fmt.Fprintf(&pdf, "5 0 obj << /Length %d /Filter /FlateDecode >>\nstream\n", compressed.Len())
+	pdf.Write(compressed.Bytes())
+	pdf.WriteString("\nendstream endobj\n")
+	fmt.Fprintf(&pdf, "6 0 obj << /Length %d >>\nstream\n%s\nendstream endobj\n", len(pageTwo), pageTwo)
+	pdf.WriteString("7 0 obj << /Type /Font /Subtype /Type1 /BaseFont /Helvetica >> endobj\ntrailer << /Root 1 0 R >>\n%%EOF")
+
+	parsed, err := parseSourceFile(SourceFile{Name: "handbook.pdf", Content: pdf.Bytes()})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(parsed.Chunks) != 1 {
+		t.Fatalf("expected 1 chunk, got %#v", parsed.Chunks)
+	}
+	chunk := parsed.Chunks[0]
+	if chunk.SectionPath != "School Handbook" || chunk.Page != 1 {
+		t.Fatalf("unexpected chunk metadata: %#v", chunk)
+	}
+	if !strings.Contains(chunk.Content, "Classes begin at 8 a.m. every week") || !strings.Contains(chunk.Content, "Uniform is mandatory.") {
+		t.Fatalf("unexpected chunk content: %q", chunk.Content)
+	}
+}
+
+func TestDetectSourceTypeRejectsUnknownFiles(t *testing.T) {
+	if _, err := DetectSourceType("notes.txt", "text/plain", []byte("hello")); err == nil {
+		t.Fatal("expected plain text upload to be rejected")
+	}
+	if got, err := DetectSourceType("page", "", []byte("<!DOCTYPE html><p>x</p>")); err != nil || got != SourceTypeHTML {
+		t.Fatalf("expected html detection, got %q, %v", got, err)
+	}
+}
+
+func TestExtractPDFRejectsTruncatedObjects(t *testing.T) {
+	for _, in := range []string{
+		"%PDF-1.4\n1 0 obj<",
+		"%PDF-1.4\n1 0 obj<< /Type /Catalog /Name <4142",
+		"%PDF-1.4\n1 0 obj[(abc",
+	} {
+		if _, err := extractPDF([]byte(in)); err == nil {
+			t.Fatalf("%q: expected an error for a truncated PDF", in)
+		}
+	}
+}
+
+func FuzzExtractPDF(f *testing.F) {
+	f.Add([]byte("%PDF-1.4\n1 0 obj<"))
+	f.Add([]byte("%PDF-1.4\n1 0 obj<</A/)>"))
+	f.Add([]byte("%PDF-1.4\n1 0 obj << /Type /Catalog /Pages 2 0 R >> endobj\n2 0 obj << /Type /Pages /Kids [3 0 R] >> endobj\n" +
+		"3 0 obj << /Type /Page /Contents 4 0 R >> endobj\n4 0 obj << /Length 9 >>\nstream\nBT (a) Tj\nendstream endobj"))
+	f.Add([]byte("%PDF-1.4\n1 0 obj << /Type /ObjStm /N 2 /First 4 /Length 6 >>\nstream\n1 0 <\nendstream endobj"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		_, _ = extractPDF(data)
+	})
+}
@@ -0,0 +1,303 @@
+package kb
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	defaultVectorWeight   = 0.6
+	defaultMinSimilarity  = 0.25
+	hybridCandidateFactor = 3
+)
+
+// HybridAnswerEngine blends lexical ranking from SearchOnlyAnswerEngine with
+// cosine similarity between the query embedding and stored chunk
+// embeddings. When the embedding provider fails, or a tenant has no
+// embeddings yet, results degrade to the lexical ranking.
+type HybridAnswerEngine struct {
+	lexical       *SearchOnlyAnswerEngine
+	pool          *pgxpool.Pool
+	embedder      Embedder
+	vectorWeight  float64
+	minSimilarity float64
+}
+
+func NewHybridAnswerEngine(lexical *SearchOnlyAnswerEngine, pool *pgxpool.Pool, embedder Embedder) *HybridAnswerEngine {
+	e := &HybridAnswerEngine{
+		lexical:       lexical,
+		pool:          pool,
+		embedder:      embedder,
+		vectorWeight:  defaultVectorWeight,
+		minSimilarity: defaultMinSimilarity,
+	}
+	if raw := strings.TrimSpace(os.Getenv("KB_HYBRID_VECTOR_WEIGHT")); raw != "" {
+		if w, err := strconv.ParseFloat(raw, 64); err == nil && w >= 0 && w <= 1 {
+			e.vectorWeight = w
+		}
+	}
+	if raw := strings.TrimSpace(os.Getenv("KB_HYBRID_MIN_SIMILARITY")); raw != "" {
+		if v, err := strconv.ParseFloat(raw, 64); err == nil && v >= 0 && v < 1 {
+			e.minSimilarity = v
+		}
+	}
+	return e
+}
+
+type hybridCandidate struct {
+	result  SearchResult
+	content string
+	lexical float64
+	vector  float64
+	score   float64
+}
+
+func (e *HybridAnswerEngine) Answer(ctx context.Context, query string, tenantID string, userContext UserContext, filters SearchFilters) (string, []SearchResult, SearchMeta, float64, error) {
+	topK := filters.TopK
+	if topK <= 0 {
+		topK = 10
+	}
+	if topK > 25 {
+		topK = 25
+	}
+
+	lexFilters := filters
+	lexFilters.TopK = min(topK*hybridCandidateFactor, 25)
+	lexSummary, lexResults, meta, lexConfidence, err := e.lexical.Answer(ctx, query, tenantID, userContext, lexFilters)
+	if err != nil {
+		return "", nil, SearchMeta{}, 0, err
+	}
+
+	lexicalOnly := func() (string, []SearchResult, SearchMeta, float64, error) {
+		if len(lexResults) > int(topK) {
+			lexResults = lexResults[:topK]
+		}
+		meta.Total = len(lexResults)
+		meta.Retrieval = "lexical"
+		return lexSummary, lexResults, meta, lexConfidence, nil
+	}
+
+	vectors, err := e.embedder.Embed(ctx, []string{query})
+	if err != nil || len(vectors) != 1 || len(vectors[0]) == 0 {
+		log.Warn().Err(err).Str("model", e.embedder.Model()).Msg("kb query embedding failed, using lexical ranking")
+		return lexicalOnly()
+	}
+	queryVec := vectors[0]
+
+	tenantUUID, err := parseUUID(tenantID)
+	if err != nil {
+		return "", nil, SearchMeta{}, 0, err
+	}
+
+	vectorHits, err := e.vectorSearch(ctx, tenantUUID, queryVec, filters, topK*hybridCandidateFactor)
+	if err != nil {
+		log.Warn().Err(err).Msg("kb vector search failed, using lexical ranking")
+		return lexicalOnly()
+	}
+	if len(vectorHits) == 0 && len(lexResults) == 0 {
+		return lexicalOnly()
+	}
+
+	candidates := make(map[string]*hybridCandidate, len(lexResults)+len(vectorHits))
+	order := make([]string, 0, len(lexResults)+len(vectorHits))
+	missing := make([]string, 0, len(lexResults))
+	for _, r := range lexResults {
+		candidates[r.ChunkID] = &hybridCandidate{result: r, lexical: r.Score}
+		order = append(order, r.ChunkID)
+		missing = append(missing, r.ChunkID)
+	}
+	for _, hit := range vectorHits {
+		if existing, ok := candidates[hit.result.ChunkID]; ok {
+			existing.vector = hit.vector
+			existing.content = hit.content
+			existing.result.SectionPath = hit.result.SectionPath
+			existing.result.PageNumber = hit.result.PageNumber
+			continue
+		}
+		if hit.vector < e.minSimilarity {
+			continue
+		}
+		h := hit
+		h.result.SnippetHTML = fallbackSnippet(h.content, query)
+		candidates[h.result.ChunkID] = &h
+		order = append(order, h.result.ChunkID)
+	}
+
+	// Lexical hits outside the vector top-N still need their similarity and
+	// raw content for scoring and the summary.
+	pending := make([]string, 0, len(missing))
+	for _, id := range missing {
+		if candidates[id].content == "" {
+			pending = append(pending, id)
+		}
+	}
+	if len(pending) > 0 {
+		if err := e.fillCandidates(ctx, tenantUUID, queryVec, pending, candidates); err != nil {
+			log.Warn().Err(err).Msg("kb hybrid candidate lookup failed, using lexical ranking")
+			return lexicalOnly()
+		}
+	}
+
+	list := make([]*hybridCandidate, 0, len(order))
+	for _, id := range order {
+		list = append(list, candidates[id])
+	}
+	ranked := rankHybrid(list, e.vectorWeight, int(topK))
+
+	results := make([]SearchResult, 0, len(ranked))
+	for _, c := range ranked {
+		r := c.result
+		r.Score = c.score
+		results = append(results, r)
+	}
+
+	confidence := 0.0
+	summary := "Not found in KB"
+	if len(ranked) > 0 {
+		confidence = clamp01(ranked[0].score)
+		if confidence >= 0.15 {
+			summary = "Summary from Knowledgebase (auto-extracted): " + extractBestSummary(ranked[0].content, query)
+		}
+	}
+
+	meta.Total = len(results)
+	meta.Retrieval = "hybrid"
+	meta.EmbeddingModel = e.embedder.Model()
+	return summary, results, meta, confidence, nil
+}
+
+// rankHybrid scores candidates as a weighted sum of the lexical score and
+// cosine similarity, both clamped to [0, 1], and returns the best topK.
+func rankHybrid(candidates []*hybridCandidate, vectorWeight float64, topK int) []*hybridCandidate {
+	for _, c := range candidates {
+		c.score = (1-vectorWeight)*clamp01(c.lexical) + vectorWeight*clamp01(c.vector)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].score > candidates[j].score
+	})
+	if len(candidates) > topK {
+		candidates = candidates[:topK]
+	}
+	return candidates
+}
+
+func (e *HybridAnswerEngine) vectorSearch(ctx context.Context, tenantUUID pgtype.UUID, queryVec []float32, filters SearchFilters, limit int32) ([]hybridCandidate, error) {
+	status := strings.TrimSpace(strings.ToLower(filters.Status))
+	if status == "" {
+		status = "published"
+	}
+
+	rows, err := e.pool.Query(ctx, `
+		SELECT
+			d.id, d.title, d.category, d.tags, d.visibility, d.status, d.updated_at,
+			c.id, c.chunk_index, c.content, c.section_path, c.page_number,
+			(SELECT COALESCE(SUM(a * b), 0) FROM unnest(e.embedding, $2::real[]) AS v(a, b))::float8 AS similarity
+		FROM kb_chunk_embeddings e
+		JOIN kb_chunks c ON c.id = e.chunk_id
+		JOIN kb_documents d ON d.id = c.document_id
+		WHERE e.tenant_id = $1
+		  AND e.model = $3
+		  AND d.tenant_id = $1
+		  AND d.deleted_at IS NULL
+		  AND d.status = $4
+		  AND (array_length($5::text[], 1) IS NULL OR d.visibility = ANY($5::text[]))
+		  AND ($6::text = '' OR d.category = $6)
+		  AND (array_length($7::text[], 1) IS NULL OR d.tags && $7::text[])
+		  AND ($8::text = '' OR d.visibility = $8)
+		ORDER BY similarity DESC
+		LIMIT $9`,
+		tenantUUID,
+		queryVec,
+		e.embedder.Model(),
+		status,
+		normalizeAllowedVisibilities(filters.AllowedVisibilities),
+		strings.TrimSpace(filters.Category),
+		normalizeTags(filters.Tags),
+		strings.TrimSpace(strings.ToLower(filters.Visibility)),
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]hybridCandidate, 0, limit)
+	for rows.Next() {
+		var (
+			c         hybridCandidate
+			docID     pgtype.UUID
+			chunkID   pgtype.UUID
+			category  pgtype.Text
+			updatedAt pgtype.Timestamptz
+			section   pgtype.Text
+			page      pgtype.Int4
+		)
+		if err := rows.Scan(
+			&docID, &c.result.Title, &category, &c.result.Tags, &c.result.Visibility, &c.result.Status, &updatedAt,
+			&chunkID, &c.result.ChunkIndex, &c.content, &section, &page, &c.vector,
+		); err != nil {
+			return nil, err
+		}
+		c.result.DocumentID = docID.String()
+		c.result.ChunkID = chunkID.String()
+		c.result.Category = category.String
+		c.result.UpdatedAt = updatedAt.Time.UTC().Format(timeLayoutRFC3339())
+		c.result.SectionPath = section.String
+		c.result.PageNumber = page.Int32
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+func (e *HybridAnswerEngine) fillCandidates(ctx context.Context, tenantUUID pgtype.UUID, queryVec []float32, chunkIDs []string, candidates map[string]*hybridCandidate) error {
+	ids := make([]pgtype.UUID, 0, len(chunkIDs))
+	for _, id := range chunkIDs {
+		parsed, err := parseUUID(id)
+		if err != nil {
+			return fmt.Errorf("invalid chunk id %q: %w", id, err)
+		}
+		ids = append(ids, parsed)
+	}
+
+	rows, err := e.pool.Query(ctx, `
+		SELECT
+			c.id, c.content, c.section_path, c.page_number,
+			COALESCE((SELECT SUM(a * b) FROM unnest(e.embedding, $3::real[]) AS v(a, b)), 0)::float8
+		FROM kb_chunks c
+		LEFT JOIN kb_chunk_embeddings e ON e.chunk_id = c.id AND e.model = $4
+		WHERE c.tenant_id = $1 AND c.id = ANY($2::uuid[])`,
+		tenantUUID, ids, queryVec, e.embedder.Model(),
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			chunkID pgtype.UUID
+			content string
+			section pgtype.Text
+			page    pgtype.Int4
+			vector  float64
+		)
+		if err := rows.Scan(&chunkID, &content, &section, &page, &vector); err != nil {
+			return err
+		}
+		if c, ok := candidates[chunkID.String()]; ok {
+			c.content = content
+			c.vector = vector
+			c.result.SectionPath = section.String
+			c.result.PageNumber = page.Int32
+		}
+	}
+	return rows.Err()
+}
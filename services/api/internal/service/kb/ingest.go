@@ -0,0 +1,359 @@
+package kb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/schoolerp/api/internal/db"
+	filesvc "github.com/schoolerp/api/internal/service/files"
+)
+
+// MaxSourceFileBytes caps uploads accepted for ingestion.
+const MaxSourceFileBytes = 20 << 20
+
+// SetFileService enables keeping a copy of uploaded source files.
+func (s *Service) SetFileService(files *filesvc.FileService) {
+	s.files = files
+}
+
+// IngestDocument creates a document from an uploaded PDF, DOCX or HTML file.
+// Title defaults to the file name; ContentText in meta is ignored and
+// replaced by the extracted text.
+func (s *Service) IngestDocument(ctx context.Context, tenantID, userID string, meta DocumentUpsertRequest, file SourceFile) (IngestResult, error) {
+	parsed, err := parseSourceFile(file)
+	if err != nil {
+		return IngestResult{}, err
+	}
+
+	if strings.TrimSpace(meta.Title) == "" {
+		meta.Title = strings.TrimSuffix(filepath.Base(file.Name), filepath.Ext(file.Name))
+	}
+	meta.ContentText = parsed.Text
+	normalized, err := normalizeUpsertRequest(meta)
+	if err != nil {
+		return IngestResult{}, err
+	}
+
+	tenantUUID, err := parseUUID(tenantID)
+	if err != nil {
+		return IngestResult{}, err
+	}
+	userUUID, err := parseUUID(userID)
+	if err != nil {
+		return IngestResult{}, err
+	}
+
+	fileID, err := s.storeSourceFile(ctx, tenantID, userID, file)
+	if err != nil {
+		return IngestResult{}, err
+	}
+
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return IngestResult{}, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	qtx := s.q.WithTx(tx)
+	doc, err := qtx.CreateKBDocument(ctx, db.CreateKBDocumentParams{
+		TenantID:    tenantUUID,
+		Title:       normalized.Title,
+		Category:    toText(normalized.Category),
+		Tags:        normalized.Tags,
+		Visibility:  normalized.Visibility,
+		Status:      normalized.Status,
+		ContentText: normalized.ContentText,
+		CreatedBy:   userUUID,
+	})
+	if err != nil {
+		return IngestResult{}, err
+	}
+
+	source, err := writeDocumentSource(ctx, tx, tenantUUID, doc.ID, parsed, fileID, file.Name)
+	if err != nil {
+		return IngestResult{}, err
+	}
+	if err := insertSourceChunks(ctx, tx, tenantUUID, doc.ID, parsed.Chunks); err != nil {
+		return IngestResult{}, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return IngestResult{}, err
+	}
+
+	s.logDocumentAudit(ctx, tenantUUID, userUUID, "kb.document.ingest", doc.ID, nil, map[string]interface{}{
+		"title":       doc.Title,
+		"source_type": parsed.Type,
+		"file_name":   file.Name,
+		"sha256":      parsed.SHA256,
+		"chunks":      len(parsed.Chunks),
+	})
+
+	out := mapDocument(doc)
+	out.Source = &source
+	return IngestResult{Document: out, ChunkCount: len(parsed.Chunks)}, nil
+}
+
+// ReplaceDocumentSource re-ingests a document from a new version of its
+// source file. Uploading a byte-identical file is a no-op.
+func (s *Service) ReplaceDocumentSource(ctx context.Context, tenantID, documentID, userID string, file SourceFile) (IngestResult, error) {
+	parsed, err := parseSourceFile(file)
+	if err != nil {
+		return IngestResult{}, err
+	}
+
+	tenantUUID, err := parseUUID(tenantID)
+	if err != nil {
+		return IngestResult{}, err
+	}
+	docUUID, err := parseUUID(documentID)
+	if err != nil {
+		return IngestResult{}, err
+	}
+	userUUID, err := parseUUID(userID)
+	if err != nil {
+		return IngestResult{}, err
+	}
+
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return IngestResult{}, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	var currentHash pgtype.Text
+	err = tx.QueryRow(ctx, `
+		SELECT source_sha256 FROM kb_documents
+		WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL
+		FOR UPDATE`, docUUID, tenantUUID).Scan(&currentHash)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return IngestResult{}, ErrKBNotFound
+		}
+		return IngestResult{}, err
+	}
+
+	qtx := s.q.WithTx(tx)
+	before, err := qtx.GetKBDocument(ctx, db.GetKBDocumentParams{ID: docUUID, TenantID: tenantUUID})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return IngestResult{}, ErrKBNotFound
+		}
+		return IngestResult{}, err
+	}
+
+	if currentHash.Valid && currentHash.String == parsed.SHA256 {
+		source, err := loadDocumentSource(ctx, tx, tenantUUID, docUUID)
+		if err != nil {
+			return IngestResult{}, err
+		}
+		var count int
+		if err := tx.QueryRow(ctx, `SELECT COUNT(*) FROM kb_chunks WHERE tenant_id = $1 AND document_id = $2`, tenantUUID, docUUID).Scan(&count); err != nil {
+			return IngestResult{}, err
+		}
+		out := mapDocument(before)
+		out.Source = source
+		return IngestResult{Document: out, ChunkCount: count, Unchanged: true}, nil
+	}
+
+	fileID, err := s.storeSourceFile(ctx, tenantID, userID, file)
+	if err != nil {
+		return IngestResult{}, err
+	}
+
+	after, err := qtx.UpdateKBDocument(ctx, db.UpdateKBDocumentParams{
+		ID:          docUUID,
+		TenantID:    tenantUUID,
+		Title:       before.Title,
+		Category:    before.Category,
+		Tags:        before.Tags,
+		Visibility:  before.Visibility,
+		Status:      before.Status,
+		ContentText: parsed.Text,
+		UpdatedBy:   userUUID,
+	})
+	if err != nil {
+		return IngestResult{}, err
+	}
+	if err := qtx.DeleteKBChunksByDocument(ctx, db.DeleteKBChunksByDocumentParams{TenantID: tenantUUID, DocumentID: docUUID}); err != nil {
+		return IngestResult{}, err
+	}
+	source, err := writeDocumentSource(ctx, tx, tenantUUID, docUUID, parsed, fileID, file.Name)
+	if err != nil {
+		return IngestResult{}, err
+	}
+	if err := insertSourceChunks(ctx, tx, tenantUUID, docUUID, parsed.Chunks); err != nil {
+		return IngestResult{}, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return IngestResult{}, err
+	}
+
+	s.logDocumentAudit(ctx, tenantUUID, userUUID, "kb.document.reingest", docUUID, map[string]interface{}{
+		"sha256": currentHash.String,
+	}, map[string]interface{}{
+		"source_type": parsed.Type,
+		"file_name":   file.Name,
+		"sha256":      parsed.SHA256,
+		"chunks":      len(parsed.Chunks),
+	})
+
+	out := mapDocument(after)
+	out.Source = &source
+	return IngestResult{Document: out, ChunkCount: len(parsed.Chunks)}, nil
+}
+
+func (s *Service) storeSourceFile(ctx context.Context, tenantID, userID string, file SourceFile) (pgtype.UUID, error) {
+	if s.files == nil {
+		return pgtype.UUID{}, nil
+	}
+	stored, err := s.files.Upload(ctx, filesvc.UploadParams{
+		TenantID:    tenantID,
+		Name:        filepath.Base(file.Name),
+		MimeType:    file.MimeType,
+		UploadedBy:  userID,
+		Content:     bytes.NewReader(file.Content),
+		ContentSize: int64(len(file.Content)),
+	})
+	if err != nil {
+		return pgtype.UUID{}, fmt.Errorf("store source file: %w", err)
+	}
+	return stored.ID, nil
+}
+
+func writeDocumentSource(ctx context.Context, tx pgx.Tx, tenantUUID, docUUID pgtype.UUID, parsed parsedSource, fileID pgtype.UUID, fileName string) (DocumentSource, error) {
+	var ingestedAt time.Time
+	err := tx.QueryRow(ctx, `
+		UPDATE kb_documents
+		SET source_type = $3,
+		    source_file_id = $4,
+		    source_file_name = $5,
+		    source_sha256 = $6,
+		    ingested_at = NOW()
+		WHERE id = $1 AND tenant_id = $2
+		RETURNING ingested_at`,
+		docUUID, tenantUUID, parsed.Type, fileID, toText(filepath.Base(fileName)), parsed.SHA256,
+	).Scan(&ingestedAt)
+	if err != nil {
+		return DocumentSource{}, err
+	}
+
+	source := DocumentSource{
+		Type:       parsed.Type,
+		FileName:   filepath.Base(fileName),
+		SHA256:     parsed.SHA256,
+		IngestedAt: &ingestedAt,
+	}
+	if fileID.Valid {
+		source.FileID = fileID.String()
+	}
+	return source, nil
+}
+
+// clearDocumentSource marks a document as plain text once its content has
+// been edited by hand, so a later upload is never skipped as unchanged.
+func clearDocumentSource(ctx context.Context, tx pgx.Tx, tenantUUID, docUUID pgtype.UUID) error {
+	_, err := tx.Exec(ctx, `
+		UPDATE kb_documents
+		SET source_type = 'text', source_sha256 = NULL
+		WHERE id = $1 AND tenant_id = $2`, docUUID, tenantUUID)
+	return err
+}
+
+func insertSourceChunks(ctx context.Context, tx pgx.Tx, tenantUUID, docUUID pgtype.UUID, chunks []sourceChunk) error {
+	for idx, chunk := range chunks {
+		page := pgtype.Int4{Int32: int32(chunk.Page), Valid: chunk.Page > 0}
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO kb_chunks (
+				tenant_id, document_id, chunk_index, content, tsv,
+				block_type, section_path, page_number, source_anchor
+			) VALUES (
+				$1, $2, $3, $4, to_tsvector('simple', $4),
+				$5, $6, $7, $8
+			)`,
+			tenantUUID, docUUID, int32(idx), chunk.Content,
+			chunk.BlockType, toText(chunk.SectionPath), page, toText(chunk.Anchor),
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type queryRower interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+func loadDocumentSource(ctx context.Context, q queryRower, tenantUUID, docUUID pgtype.UUID) (*DocumentSource, error) {
+	var (
+		sourceType string
+		fileID     pgtype.UUID
+		fileName   pgtype.Text
+		hash       pgtype.Text
+		ingestedAt pgtype.Timestamptz
+	)
+	err := q.QueryRow(ctx, `
+		SELECT source_type, source_file_id, source_file_name, source_sha256, ingested_at
+		FROM kb_documents
+		WHERE id = $1 AND tenant_id = $2`, docUUID, tenantUUID,
+	).Scan(&sourceType, &fileID, &fileName, &hash, &ingestedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrKBNotFound
+		}
+		return nil, err
+	}
+	if sourceType == SourceTypeText && !fileID.Valid {
+		return nil, nil
+	}
+
+	source := &DocumentSource{Type: sourceType, FileName: fileName.String, SHA256: hash.String}
+	if fileID.Valid {
+		source.FileID = fileID.String()
+	}
+	if ingestedAt.Valid {
+		t := ingestedAt.Time.UTC()
+		source.IngestedAt = &t
+	}
+	return source, nil
+}
+
+func (s *Service) listDocumentChunks(ctx context.Context, tenantUUID, docUUID pgtype.UUID) ([]ChunkDTO, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT id, chunk_index, content, block_type, section_path, page_number, source_anchor
+		FROM kb_chunks
+		WHERE tenant_id = $1 AND document_id = $2
+		ORDER BY chunk_index ASC`, tenantUUID, docUUID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]ChunkDTO, 0)
+	for rows.Next() {
+		var (
+			id      pgtype.UUID
+			chunk   ChunkDTO
+			section pgtype.Text
+			page    pgtype.Int4
+			anchor  pgtype.Text
+		)
+		if err := rows.Scan(&id, &chunk.ChunkIndex, &chunk.Content, &chunk.BlockType, &section, &page, &anchor); err != nil {
+			return nil, err
+		}
+		chunk.ID = id.String()
+		chunk.SectionPath = section.String
+		chunk.PageNumber = page.Int32
+		chunk.Anchor = anchor.String
+		out = append(out, chunk)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,131 @@
+package kb
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Retrieve runs the configured answer engine for the given role and returns
+// the top published chunks with their full text. Access follows the same
+// tenant settings as Search, so a parent only ever receives chunks from
+// documents with parent visibility.
+func (s *Service) Retrieve(ctx context.Context, tenantID string, userCtx UserContext, query string, topK int32) (Retrieval, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return Retrieval{}, fmt.Errorf("query is required")
+	}
+
+	settings, err := s.ensureSettings(ctx, tenantID)
+	if err != nil {
+		return Retrieval{}, err
+	}
+	allowedVisibilities, err := evaluateSearchAccess(settings, strings.ToLower(strings.TrimSpace(userCtx.Role)))
+	if err != nil {
+		return Retrieval{}, err
+	}
+
+	if topK <= 0 {
+		topK = 5
+	}
+	if topK > 25 {
+		topK = 25
+	}
+	filters := SearchFilters{
+		Status:              "published",
+		TopK:                topK,
+		AllowedVisibilities: allowedVisibilities,
+	}
+
+	started := time.Now()
+	_, results, meta, confidence, err := s.engine.Answer(ctx, query, tenantID, userCtx, filters)
+	if err != nil {
+		return Retrieval{}, err
+	}
+
+	chunks, err := s.loadRetrievedChunks(ctx, tenantID, results)
+	if err != nil {
+		return Retrieval{}, err
+	}
+	meta.LatencyMs = time.Since(started).Milliseconds()
+
+	s.logSearchAudit(ctx, tenantID, userCtx.UserID, len(query), results, meta)
+	return Retrieval{
+		Chunks:              chunks,
+		Confidence:          confidence,
+		Meta:                meta,
+		AllowedVisibilities: allowedVisibilities,
+	}, nil
+}
+
+func (s *Service) loadRetrievedChunks(ctx context.Context, tenantID string, results []SearchResult) ([]RetrievedChunk, error) {
+	if len(results) == 0 {
+		return []RetrievedChunk{}, nil
+	}
+	tenantUUID, err := parseUUID(tenantID)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]pgtype.UUID, 0, len(results))
+	for _, r := range results {
+		id, err := parseUUID(r.ChunkID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid chunk id %q: %w", r.ChunkID, err)
+		}
+		ids = append(ids, id)
+	}
+
+	rows, err := s.pool.Query(ctx, `
+		SELECT id, content, section_path, page_number
+		FROM kb_chunks
+		WHERE tenant_id = $1 AND id = ANY($2::uuid[])`, tenantUUID, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	type chunkRow struct {
+		content string
+		section string
+		page    int32
+	}
+	byID := make(map[string]chunkRow, len(ids))
+	for rows.Next() {
+		var (
+			id      pgtype.UUID
+			row     chunkRow
+			section pgtype.Text
+			page    pgtype.Int4
+		)
+		if err := rows.Scan(&id, &row.content, &section, &page); err != nil {
+			return nil, err
+		}
+		row.section = section.String
+		row.page = page.Int32
+		byID[id.String()] = row
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Keep the engine's ranking; chunks replaced since the search ran are
+	// dropped rather than cited with stale text.
+	out := make([]RetrievedChunk, 0, len(results))
+	for _, r := range results {
+		row, ok := byID[r.ChunkID]
+		if !ok {
+			continue
+		}
+		if r.SectionPath == "" {
+			r.SectionPath = row.section
+		}
+		if r.PageNumber == 0 {
+			r.PageNumber = row.page
+		}
+		out = append(out, RetrievedChunk{SearchResult: r, Content: row.content})
+	}
+	return out, nil
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/schoolerp/api/internal/db"
 	"github.com/schoolerp/api/internal/foundation/audit"
+	filesvc "github.com/schoolerp/api/internal/service/files"
 )
 
 var (
@@ -31,6 +32,9 @@ type Service struct {
 	pool   *pgxpool.Pool
 	audit  *audit.Logger
 	engine KBAnswerEngine
+	files  *filesvc.FileService
+
+	embedder Embedder
 }
 
 func NewService(q *db.Queries, pool *pgxpool.Pool, auditLogger *audit.Logger) *Service {
@@ -154,24 +158,18 @@ func (s *Service) GetDocument(ctx context.Context, tenantID, documentID string)
 		return DocumentWithChunks{}, err
 	}
 
-	chunks, err := s.q.ListKBChunksByDocument(ctx, db.ListKBChunksByDocumentParams{
-		TenantID:   tenantUUID,
-		DocumentID: docUUID,
-	})
+	chunks, err := s.listDocumentChunks(ctx, tenantUUID, docUUID)
 	if err != nil {
 		return DocumentWithChunks{}, err
 	}
-
-	outChunks := make([]ChunkDTO, 0, len(chunks))
-	for _, chunk := range chunks {
-		outChunks = append(outChunks, ChunkDTO{
-			ID:         chunk.ID.String(),
-			ChunkIndex: chunk.ChunkIndex,
-			Content:    chunk.Content,
-		})
+	source, err := loadDocumentSource(ctx, s.pool, tenantUUID, docUUID)
+	if err != nil {
+		return DocumentWithChunks{}, err
 	}
 
-	return DocumentWithChunks{Document: mapDocument(doc), Chunks: outChunks}, nil
+	out := mapDocument(doc)
+	out.Source = source
+	return DocumentWithChunks{Document: out, Chunks: chunks}, nil
 }
 
 func (s *Service) UpdateDocument(ctx context.Context, tenantID, documentID, userID string, patch DocumentPatchRequest) (DocumentDTO, error) {
@@ -234,6 +232,9 @@ func (s *Service) UpdateDocument(ctx context.Context, tenantID, documentID, user
 		if err := insertChunks(ctx, qtx, tenantUUID, docUUID, merged.ContentText); err != nil {
 			return DocumentDTO{}, err
 		}
+		if err := clearDocumentSource(ctx, tx, tenantUUID, docUUID); err != nil {
+			return DocumentDTO{}, err
+		}
 	}
 
 	if err := tx.Commit(ctx); err != nil {
@@ -741,3 +742,75 @@ func (s *Service) logSearchAudit(ctx context.Context, tenantID string, userID st
 		},
 	})
 }
+
+// SetEmbedder switches search to hybrid lexical + vector ranking.
+func (s *Service) SetEmbedder(embedder Embedder) {
+	if embedder == nil {
+		return
+	}
+	s.embedder = embedder
+	s.engine = NewHybridAnswerEngine(NewSearchOnlyAnswerEngine(s.q, s.pool), s.pool, embedder)
+}
+
+func (s *Service) EmbeddingStatus(ctx context.Context, tenantID string) (EmbeddingStatusDTO, error) {
+	tenantUUID, err := parseUUID(tenantID)
+	if err != nil {
+		return EmbeddingStatusDTO{}, err
+	}
+	if s.embedder == nil {
+		var total int64
+		if err := s.pool.QueryRow(ctx, `SELECT COUNT(*) FROM kb_chunks WHERE tenant_id = $1`, tenantUUID).Scan(&total); err != nil {
+			return EmbeddingStatusDTO{}, err
+		}
+		return EmbeddingStatusDTO{Enabled: false, TotalChunks: total, PendingChunks: total}, nil
+	}
+
+	out := EmbeddingStatusDTO{Enabled: true, Model: s.embedder.Model()}
+	err = s.pool.QueryRow(ctx, `
+		SELECT COUNT(*), COUNT(e.chunk_id),
+		       COUNT(f.chunk_id) FILTER (WHERE e.chunk_id IS NULL AND f.attempts >= $3)
+		FROM kb_chunks c
+		LEFT JOIN kb_chunk_embeddings e ON e.chunk_id = c.id AND e.model = $2
+		LEFT JOIN kb_chunk_embedding_failures f ON f.chunk_id = c.id AND f.model = $2
+		WHERE c.tenant_id = $1`, tenantUUID, out.Model, embeddingMaxAttempts).Scan(&out.TotalChunks, &out.EmbeddedChunks, &out.FailedChunks)
+	if err != nil {
+		return EmbeddingStatusDTO{}, err
+	}
+	out.PendingChunks = out.TotalChunks - out.EmbeddedChunks - out.FailedChunks
+	return out, nil
+}
+
+// ReindexEmbeddings drops the tenant's stored embeddings and failure counts
+// so the background indexer recomputes them with the current model.
+func (s *Service) ReindexEmbeddings(ctx context.Context, tenantID, userID string) (EmbeddingStatusDTO, error) {
+	if s.embedder == nil {
+		return EmbeddingStatusDTO{}, fmt.Errorf("%w: semantic search is not configured", ErrKBInvalidPayload)
+	}
+	tenantUUID, err := parseUUID(tenantID)
+	if err != nil {
+		return EmbeddingStatusDTO{}, err
+	}
+	userUUID, _ := parseUUID(userID)
+
+	tag, err := s.pool.Exec(ctx, `DELETE FROM kb_chunk_embeddings WHERE tenant_id = $1`, tenantUUID)
+	if err != nil {
+		return EmbeddingStatusDTO{}, err
+	}
+	if _, err := s.pool.Exec(ctx, `DELETE FROM kb_chunk_embedding_failures WHERE tenant_id = $1`, tenantUUID); err != nil {
+		return EmbeddingStatusDTO{}, err
+	}
+
+	if s.audit != nil {
+		_ = s.audit.Log(ctx, audit.Entry{
+			TenantID:     tenantUUID,
+			UserID:       userUUID,
+			Action:       "kb.embeddings.reindex",
+			ResourceType: "kb_embeddings",
+			After: map[string]interface{}{
+				"model":   s.embedder.Model(),
+				"cleared": tag.RowsAffected(),
+			},
+		})
+	}
+	return s.EmbeddingStatus(ctx, tenantID)
+}
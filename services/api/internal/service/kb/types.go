@@ -30,21 +30,48 @@ type DocumentListFilters struct {
 }
 
 type DocumentDTO struct {
-	ID          string    `json:"id"`
-	Title       string    `json:"title"`
-	Category    string    `json:"category,omitempty"`
-	Tags        []string  `json:"tags"`
-	Visibility  string    `json:"visibility"`
-	Status      string    `json:"status"`
-	ContentText string    `json:"content_text"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID          string          `json:"id"`
+	Title       string          `json:"title"`
+	Category    string          `json:"category,omitempty"`
+	Tags        []string        `json:"tags"`
+	Visibility  string          `json:"visibility"`
+	Status      string          `json:"status"`
+	ContentText string          `json:"content_text"`
+	Source      *DocumentSource `json:"source,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+// DocumentSource describes the uploaded file a document was ingested from.
+type DocumentSource struct {
+	Type       string     `json:"type"`
+	FileID     string     `json:"file_id,omitempty"`
+	FileName   string     `json:"file_name,omitempty"`
+	SHA256     string     `json:"sha256,omitempty"`
+	IngestedAt *time.Time `json:"ingested_at,omitempty"`
 }
 
 type ChunkDTO struct {
-	ID         string `json:"id"`
-	ChunkIndex int32  `json:"chunk_index"`
-	Content    string `json:"content"`
+	ID          string `json:"id"`
+	ChunkIndex  int32  `json:"chunk_index"`
+	Content     string `json:"content"`
+	BlockType   string `json:"block_type"`
+	SectionPath string `json:"section_path,omitempty"`
+	PageNumber  int32  `json:"page_number,omitempty"`
+	Anchor      string `json:"anchor,omitempty"`
+}
+
+// SourceFile is an uploaded PDF, DOCX or HTML file to ingest.
+type SourceFile struct {
+	Name     string
+	MimeType string
+	Content  []byte
+}
+
+type IngestResult struct {
+	Document   DocumentDTO `json:"document"`
+	ChunkCount int         `json:"chunk_count"`
+	Unchanged  bool        `json:"unchanged"`
 }
 
 type DocumentWithChunks struct {
@@ -98,12 +125,25 @@ type SearchResult struct {
 	SnippetHTML string   `json:"snippet_html"`
 	Score       float64  `json:"score"`
 	UpdatedAt   string   `json:"updated_at"`
+	SectionPath string   `json:"section_path,omitempty"`
+	PageNumber  int32    `json:"page_number,omitempty"`
 }
 
 type SearchMeta struct {
-	UsedTrgm  bool  `json:"used_trgm"`
-	Total     int   `json:"total"`
-	LatencyMs int64 `json:"latency_ms"`
+	UsedTrgm       bool   `json:"used_trgm"`
+	Total          int    `json:"total"`
+	LatencyMs      int64  `json:"latency_ms"`
+	Retrieval      string `json:"retrieval,omitempty"`
+	EmbeddingModel string `json:"embedding_model,omitempty"`
+}
+
+type EmbeddingStatusDTO struct {
+	Enabled        bool   `json:"enabled"`
+	Model          string `json:"model,omitempty"`
+	TotalChunks    int64  `json:"total_chunks"`
+	EmbeddedChunks int64  `json:"embedded_chunks"`
+	PendingChunks  int64  `json:"pending_chunks"`
+	FailedChunks   int64  `json:"failed_chunks"`
 }
 
 type SearchResponse struct {
@@ -119,3 +159,17 @@ type FacetsResponse struct {
 	Categories []string `json:"categories"`
 	Tags       []string `json:"tags"`
 }
+
+// RetrievedChunk is a search hit together with the full chunk text, for
+// callers that ground generated answers on knowledgebase content.
+type RetrievedChunk struct {
+	SearchResult
+	Content string `json:"content"`
+}
+
+type Retrieval struct {
+	Chunks              []RetrievedChunk `json:"chunks"`
+	Confidence          float64          `json:"confidence"`
+	Meta                SearchMeta       `json:"meta"`
+	AllowedVisibilities []string         `json:"allowed_visibilities"`
+}
@@ -0,0 +1,830 @@
+package library
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog/log"
+	"github.com/schoolerp/api/internal/db"
+	"github.com/schoolerp/api/internal/foundation/audit"
+)
+
+var ErrInvalidCatalogue = errors.New("invalid catalogue file")
+
+const (
+	FormatCSV     = "csv"
+	FormatMARC    = "marc"
+	FormatMARCXML = "marcxml"
+
+	onDuplicateSkip      = "skip"
+	onDuplicateAddCopies = "add_copies"
+
+	importCreated     = "created"
+	importCopiesAdded = "copies_added"
+	importDuplicate   = "duplicate"
+	importFailed      = "error"
+
+	maxImportRecords = 5000
+	maxEntryCopies   = 200
+)
+
+// CatalogueService imports and exports the catalogue and looks titles up
+// by ISBN, trying the school's own catalogue and the local cache before
+// any external source.
+type CatalogueService struct {
+	q           *db.Queries
+	pool        *pgxpool.Pool
+	audit       *audit.Logger
+	circulation *CirculationService
+	external    []ISBNSource
+}
+
+func NewCatalogueService(q *db.Queries, pool *pgxpool.Pool, audit *audit.Logger, circulation *CirculationService, external ...ISBNSource) *CatalogueService {
+	return &CatalogueService{q: q, pool: pool, audit: audit, circulation: circulation, external: external}
+}
+
+// ISBN lookup
+
+// LookupISBN finds a title by ISBN. Offline lookups stop at the catalogue
+// and the cache; otherwise external sources are tried next and what they
+// find is cached.
+func (s *CatalogueService) LookupISBN(ctx context.Context, tenantID, isbn string, offline bool) (ISBNRecord, error) {
+	isbn13, err := normalizeISBN(isbn)
+	if err != nil {
+		return ISBNRecord{}, err
+	}
+	tid := toPgUUID(tenantID)
+	sources := []ISBNSource{catalogueSource{s.q}, cacheSource{s.q}}
+	if !offline {
+		sources = append(sources, s.external...)
+	}
+	for i, src := range sources {
+		rec, err := src.LookupISBN(ctx, tid, isbn13)
+		if errors.Is(err, ErrISBNNotFound) {
+			continue
+		}
+		if err != nil {
+			// An unreachable external source should not hide the others.
+			log.Warn().Err(err).Str("source", src.Name()).Str("isbn", isbn13).Msg("isbn lookup failed")
+			continue
+		}
+		rec.Source = src.Name()
+		if i >= 2 {
+			s.cache(ctx, tid, rec)
+		}
+		return rec, nil
+	}
+	return ISBNRecord{}, ErrISBNNotFound
+}
+
+func (s *CatalogueService) cache(ctx context.Context, tid pgtype.UUID, rec ISBNRecord) {
+	err := s.q.UpsertLibraryISBNRecord(ctx, db.LibraryISBNRecord{
+		TenantID:      tid,
+		ISBN:          rec.ISBN,
+		Title:         rec.Title,
+		Authors:       rec.Authors,
+		Publisher:     optionalText(rec.Publisher),
+		PublishedYear: pgtype.Int4{Int32: rec.PublishedYear, Valid: rec.PublishedYear > 0},
+		Language:      optionalText(rec.Language),
+		Subjects:      rec.Subjects,
+		Source:        rec.Source,
+	})
+	if err != nil {
+		log.Warn().Err(err).Str("isbn", rec.ISBN).Msg("failed to cache isbn record")
+	}
+}
+
+// Catalogue entries
+
+// CatalogueEntry is one title read from an import file or written to an
+// export.
+type CatalogueEntry struct {
+	ISBN          string
+	Title         string
+	Authors       []string
+	Publisher     string
+	PublishedYear int32
+	Language      string
+	Category      string
+	Price         float64
+	ShelfLocation string
+	// Copies lists the copies with their barcodes when the file has them;
+	// otherwise CopyCount copies are accessioned.
+	Copies    []EntryCopy
+	CopyCount int
+}
+
+type EntryCopy struct {
+	Barcode         string
+	AccessionNumber string
+	ShelfLocation   string
+}
+
+// copyBarcodes returns one barcode per copy to add; blank ones are given
+// the accession number.
+func (e CatalogueEntry) copyBarcodes() []string {
+	if len(e.Copies) > 0 {
+		out := make([]string, len(e.Copies))
+		for i, c := range e.Copies {
+			out[i] = strings.TrimSpace(c.Barcode)
+		}
+		return out
+	}
+	return make([]string, max(e.CopyCount, 1))
+}
+
+// addCopies accessions the entry's copies, keeping each one's shelf.
+func (s *CatalogueService) addCopies(ctx context.Context, q *db.Queries, tid, bookID pgtype.UUID, e CatalogueEntry) error {
+	barcodes := e.copyBarcodes()
+	for start := 0; start < len(barcodes); {
+		shelf, end := e.ShelfLocation, start+1
+		if len(e.Copies) > 0 {
+			if shelf = e.Copies[start].ShelfLocation; shelf == "" {
+				shelf = e.ShelfLocation
+			}
+			for end < len(e.Copies) && e.Copies[end].ShelfLocation == e.Copies[start].ShelfLocation {
+				end++
+			}
+		} else {
+			end = len(barcodes)
+		}
+		if _, err := s.circulation.addCopies(ctx, q, tid, bookID, barcodes[start:end], AddCopiesInput{ShelfLocation: shelf}); err != nil {
+			return err
+		}
+		start = end
+	}
+	return nil
+}
+
+func (e CatalogueEntry) validate() error {
+	switch {
+	case strings.TrimSpace(e.Title) == "":
+		return fmt.Errorf("%w: title is required", ErrInvalidCatalogue)
+	case e.Price < 0:
+		return fmt.Errorf("%w: price cannot be negative", ErrInvalidCatalogue)
+	case e.CopyCount < 0 || e.CopyCount > maxEntryCopies || len(e.Copies) > maxEntryCopies:
+		return fmt.Errorf("%w: a title may have 1 to %d copies", ErrInvalidCatalogue, maxEntryCopies)
+	}
+	seen := map[string]bool{}
+	for _, b := range e.copyBarcodes() {
+		if b != "" && seen[b] {
+			return fmt.Errorf("%w: barcode %s is repeated", ErrInvalidCatalogue, b)
+		}
+		seen[b] = true
+	}
+	return nil
+}
+
+// ISBD punctuation that closes MARC subfields. A full stop after an
+// initial, as in "Narayan, R. K.", is part of the name and stays.
+var (
+	isbdTrailing = regexp.MustCompile(`[\s/:;,=.]+$`)
+	isbdInitial  = regexp.MustCompile(`(^|[\s.])\p{Lu}\.$`)
+)
+
+func trimISBD(v string) string {
+	v = strings.TrimSpace(v)
+	trimmed := strings.TrimSpace(isbdTrailing.ReplaceAllString(v, ""))
+	if rest := v[len(trimmed):]; strings.HasPrefix(rest, ".") && isbdInitial.MatchString(trimmed+".") {
+		return trimmed + "."
+	}
+	return trimmed
+}
+
+var pricePattern = regexp.MustCompile(`[0-9]+(\.[0-9]+)?`)
+
+func parsePrice(v string) float64 {
+	f, _ := strconv.ParseFloat(pricePattern.FindString(strings.ReplaceAll(v, ",", "")), 64)
+	return f
+}
+
+func parseYear(v string) int32 {
+	y, _ := strconv.Atoi(yearPattern.FindString(v))
+	return int32(y)
+}
+
+// isLanguageCode reports whether v looks like a MARC language code.
+func isLanguageCode(v string) bool {
+	if len(v) != 3 {
+		return false
+	}
+	for _, c := range v {
+		if c < 'a' || c > 'z' {
+			return false
+		}
+	}
+	return true
+}
+
+// entryFromMARC reads a bibliographic record. Copies come from Koha item
+// fields (952) or MARC holdings fields (852).
+func entryFromMARC(rec marcRecord) CatalogueEntry {
+	e := CatalogueEntry{}
+	for _, f := range rec.fields("020") {
+		if a := f.subfield("a"); a != "" {
+			if e.ISBN == "" {
+				e.ISBN = a
+			}
+			if _, err := normalizeISBN(a); err == nil {
+				e.ISBN = a
+				if c := f.subfield("c"); c != "" {
+					e.Price = parsePrice(c)
+				}
+				break
+			}
+		}
+	}
+	if t := rec.fields("245"); len(t) > 0 {
+		e.Title = trimISBD(t[0].subfield("a"))
+		if sub := trimISBD(t[0].subfield("b")); sub != "" {
+			e.Title += ": " + sub
+		}
+	}
+	for _, f := range rec.fields("100", "110", "700", "710") {
+		if name := trimISBD(f.subfield("a")); name != "" {
+			e.Authors = appendUnique(e.Authors, name)
+		}
+	}
+	e.Publisher = trimISBD(rec.subfield("b", "264", "260"))
+	e.PublishedYear = parseYear(rec.subfield("c", "264", "260"))
+	fixed := rec.control("008")
+	if e.PublishedYear == 0 && len(fixed) >= 11 {
+		e.PublishedYear = parseYear(fixed[7:11])
+	}
+	switch lang := rec.subfield("a", "041"); {
+	case isLanguageCode(lang):
+		e.Language = lang
+	case len(fixed) >= 38 && isLanguageCode(fixed[35:38]):
+		e.Language = fixed[35:38]
+	default:
+		e.Language = trimISBD(rec.subfield("a", "546"))
+	}
+	e.Category = trimISBD(rec.subfield("a", "650", "082"))
+
+	for _, f := range rec.fields("952") {
+		e.Copies = append(e.Copies, EntryCopy{Barcode: f.subfield("p"), AccessionNumber: f.subfield("i"), ShelfLocation: f.subfield("o")})
+		if e.Price == 0 {
+			e.Price = parsePrice(f.subfield("g"))
+		}
+	}
+	for _, f := range rec.fields("852") {
+		shelf := strings.TrimSpace(f.subfield("h") + " " + f.subfield("i"))
+		if shelf == "" {
+			shelf = f.subfield("j")
+		}
+		e.Copies = append(e.Copies, EntryCopy{Barcode: f.subfield("p"), ShelfLocation: shelf})
+	}
+	if len(e.Copies) > 0 {
+		e.ShelfLocation = e.Copies[0].ShelfLocation
+	}
+	return e
+}
+
+func appendUnique(list []string, v string) []string {
+	for _, x := range list {
+		if strings.EqualFold(x, v) {
+			return list
+		}
+	}
+	return append(list, v)
+}
+
+// marcFromEntry writes a title as a MARC 21 bibliographic record with one
+// 952 item field per copy.
+func marcFromEntry(id string, created time.Time, e CatalogueEntry) marcRecord {
+	rec := marcRecord{Leader: defaultMARCLeader}
+	rec.Fields = append(rec.Fields, marcField{Tag: "001", Value: id})
+
+	fixed := []byte(strings.Repeat(" ", 40))
+	copy(fixed[0:6], created.Format("060102"))
+	fixed[6] = 's'
+	if e.PublishedYear > 0 {
+		copy(fixed[7:11], fmt.Sprintf("%04d", e.PublishedYear))
+	}
+	copy(fixed[35:38], "   ")
+	if isLanguageCode(e.Language) {
+		copy(fixed[35:38], e.Language)
+	}
+	fixed[39] = 'd'
+	rec.Fields = append(rec.Fields, marcField{Tag: "008", Value: string(fixed)})
+
+	add := func(tag, ind1, ind2 string, subfields ...marcSubfield) {
+		var kept []marcSubfield
+		for _, sf := range subfields {
+			if strings.TrimSpace(sf.Value) != "" {
+				kept = append(kept, sf)
+			}
+		}
+		if len(kept) > 0 {
+			rec.Fields = append(rec.Fields, marcField{Tag: tag, Ind1: ind1, Ind2: ind2, Subfields: kept})
+		}
+	}
+	price := ""
+	if e.Price > 0 {
+		price = strconv.FormatFloat(e.Price, 'f', 2, 64)
+	}
+	add("020", " ", " ", marcSubfield{"a", e.ISBN}, marcSubfield{"c", price})
+	if isLanguageCode(e.Language) {
+		add("041", "0", " ", marcSubfield{"a", e.Language})
+	}
+	for i, a := range e.Authors {
+		tag := "700"
+		if i == 0 {
+			tag = "100"
+		}
+		add(tag, "1", " ", marcSubfield{"a", a})
+	}
+	titleInd1 := "0"
+	if len(e.Authors) > 0 {
+		titleInd1 = "1"
+	}
+	add("245", titleInd1, "0", marcSubfield{"a", e.Title})
+	year := ""
+	if e.PublishedYear > 0 {
+		year = strconv.Itoa(int(e.PublishedYear))
+	}
+	add("264", " ", "1", marcSubfield{"b", e.Publisher}, marcSubfield{"c", year})
+	if e.Language != "" && !isLanguageCode(e.Language) {
+		add("546", " ", " ", marcSubfield{"a", e.Language})
+	}
+	add("650", " ", "4", marcSubfield{"a", e.Category})
+	for _, c := range e.Copies {
+		add("952", " ", " ",
+			marcSubfield{"p", c.Barcode}, marcSubfield{"i", c.AccessionNumber},
+			marcSubfield{"o", c.ShelfLocation}, marcSubfield{"g", price})
+	}
+	return rec
+}
+
+// CSV
+
+var catalogueCSVHeader = []string{
+	"isbn", "title", "authors", "publisher", "published_year", "category", "language", "price",
+	"copies", "shelf_location", "barcodes",
+}
+
+// Header names other systems use for the same columns.
+var catalogueCSVAliases = map[string]string{
+	"author": "authors", "year": "published_year", "subject": "category", "quantity": "copies",
+	"barcode": "barcodes", "shelf": "shelf_location", "call_number": "shelf_location",
+}
+
+// splitList splits a semicolon-separated cell.
+func splitList(v string) []string {
+	var out []string
+	for _, part := range strings.Split(v, ";") {
+		if p := strings.TrimSpace(part); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// readCatalogueCSV reads titles from a CSV file with a header row. Authors
+// and barcodes are separated by semicolons. Rows that cannot be read are
+// returned as errors by row number.
+func readCatalogueCSV(r io.Reader) ([]CatalogueEntry, map[int]error, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: failed to read header: %v", ErrInvalidCatalogue, err)
+	}
+	cols := map[string]int{}
+	for i, h := range header {
+		name := strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\uFEFF")))
+		name = strings.ReplaceAll(name, " ", "_")
+		if alias, ok := catalogueCSVAliases[name]; ok {
+			name = alias
+		}
+		if _, dup := cols[name]; !dup {
+			cols[name] = i
+		}
+	}
+	if _, ok := cols["title"]; !ok {
+		if _, ok := cols["isbn"]; !ok {
+			return nil, nil, fmt.Errorf("%w: the header needs a title or isbn column", ErrInvalidCatalogue)
+		}
+	}
+
+	var entries []CatalogueEntry
+	rowErrs := map[int]error{}
+	for row := 1; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		entries = append(entries, CatalogueEntry{})
+		if err != nil {
+			rowErrs[row] = fmt.Errorf("%w: %v", ErrInvalidCatalogue, err)
+			continue
+		}
+		cell := func(name string) string {
+			if i, ok := cols[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		e := CatalogueEntry{
+			ISBN:          cell("isbn"),
+			Title:         cell("title"),
+			Authors:       splitList(cell("authors")),
+			Publisher:     cell("publisher"),
+			PublishedYear: parseYear(cell("published_year")),
+			Category:      cell("category"),
+			Language:      cell("language"),
+			ShelfLocation: cell("shelf_location"),
+		}
+		if v := cell("price"); v != "" {
+			if e.Price, err = strconv.ParseFloat(v, 64); err != nil {
+				rowErrs[row] = fmt.Errorf("%w: price %q is not a number", ErrInvalidCatalogue, v)
+				continue
+			}
+		}
+		if v := cell("copies"); v != "" {
+			if e.CopyCount, err = strconv.Atoi(v); err != nil {
+				rowErrs[row] = fmt.Errorf("%w: copies %q is not a number", ErrInvalidCatalogue, v)
+				continue
+			}
+		}
+		for _, b := range splitList(cell("barcodes")) {
+			e.Copies = append(e.Copies, EntryCopy{Barcode: b, ShelfLocation: e.ShelfLocation})
+		}
+		if len(e.Copies) > 0 && e.CopyCount > len(e.Copies) {
+			rowErrs[row] = fmt.Errorf("%w: %d copies but only %d barcodes", ErrInvalidCatalogue, e.CopyCount, len(e.Copies))
+			continue
+		}
+		entries[row-1] = e
+	}
+	return entries, rowErrs, nil
+}
+
+// csvCell keeps spreadsheet programs from running a cell as a formula.
+func csvCell(v string) string {
+	if v != "" && strings.ContainsRune("=+-@\t\r", rune(v[0])) {
+		return "'" + v
+	}
+	return v
+}
+
+func writeCatalogueCSV(w io.Writer, entries []CatalogueEntry) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(catalogueCSVHeader); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		barcodes := make([]string, len(e.Copies))
+		for i, c := range e.Copies {
+			barcodes[i] = c.Barcode
+		}
+		year, price := "", ""
+		if e.PublishedYear > 0 {
+			year = strconv.Itoa(int(e.PublishedYear))
+		}
+		if e.Price > 0 {
+			price = strconv.FormatFloat(e.Price, 'f', 2, 64)
+		}
+		row := []string{
+			e.ISBN, e.Title, strings.Join(e.Authors, "; "), e.Publisher, year, e.Category, e.Language, price,
+			strconv.Itoa(len(e.Copies)), e.ShelfLocation, strings.Join(barcodes, "; "),
+		}
+		for i := range row {
+			row[i] = csvCell(row[i])
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// Import
+
+type ImportOptions struct {
+	Format string
+	// OnDuplicate is skip (the default) or add_copies, which adds the
+	// file's copies to the title already in the catalogue.
+	OnDuplicate string
+	DryRun      bool
+}
+
+type ImportLine struct {
+	Row     int    `json:"row"`
+	ISBN    string `json:"isbn,omitempty"`
+	Title   string `json:"title,omitempty"`
+	Action  string `json:"action"`
+	BookID  string `json:"book_id,omitempty"`
+	Copies  int    `json:"copies,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type ImportReport struct {
+	Format      string       `json:"format"`
+	DryRun      bool         `json:"dry_run"`
+	Total       int          `json:"total"`
+	Created     int          `json:"created"`
+	CopiesAdded int          `json:"copies_added"`
+	Duplicates  int          `json:"duplicates"`
+	Failed      int          `json:"failed"`
+	Lines       []ImportLine `json:"lines"`
+}
+
+func (r *ImportReport) add(l ImportLine) {
+	switch l.Action {
+	case importCreated:
+		r.Created++
+	case importCopiesAdded:
+		r.CopiesAdded++
+	case importDuplicate:
+		r.Duplicates++
+	case importFailed:
+		r.Failed++
+	}
+	r.Lines = append(r.Lines, l)
+}
+
+func readCatalogue(format string, r io.Reader) ([]CatalogueEntry, map[int]error, error) {
+	var recs []marcRecord
+	var err error
+	switch format {
+	case FormatCSV:
+		return readCatalogueCSV(r)
+	case FormatMARC:
+		recs, err = readISO2709(r)
+	case FormatMARCXML:
+		recs, err = readMARCXML(r)
+	default:
+		return nil, nil, fmt.Errorf("%w: format must be csv, marc or marcxml", ErrInvalidCatalogue)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidCatalogue, err)
+	}
+	entries := make([]CatalogueEntry, len(recs))
+	for i, rec := range recs {
+		entries[i] = entryFromMARC(rec)
+	}
+	return entries, map[int]error{}, nil
+}
+
+// ImportCatalogue adds the titles in a CSV, MARC or MARCXML file. Titles
+// are matched on ISBN, against the catalogue and earlier rows of the file;
+// a match is skipped or has its copies added. Gaps in a row are filled from
+// the offline ISBN lookup. Each title is saved on its own, so one bad row
+// does not stop the rest; a dry run reports without saving.
+func (s *CatalogueService) ImportCatalogue(ctx context.Context, tenantID string, r io.Reader, opts ImportOptions, actor Actor) (ImportReport, error) {
+	if opts.OnDuplicate == "" {
+		opts.OnDuplicate = onDuplicateSkip
+	}
+	if opts.OnDuplicate != onDuplicateSkip && opts.OnDuplicate != onDuplicateAddCopies {
+		return ImportReport{}, fmt.Errorf("%w: on_duplicate must be skip or add_copies", ErrInvalidCatalogue)
+	}
+	entries, rowErrs, err := readCatalogue(opts.Format, r)
+	if err != nil {
+		return ImportReport{}, err
+	}
+	if len(entries) > maxImportRecords {
+		return ImportReport{}, fmt.Errorf("%w: at most %d titles can be imported at once", ErrInvalidCatalogue, maxImportRecords)
+	}
+
+	tid := toPgUUID(tenantID)
+	report := ImportReport{Format: opts.Format, DryRun: opts.DryRun, Total: len(entries), Lines: []ImportLine{}}
+	inFile := map[string]int{}
+	for i, e := range entries {
+		row := i + 1
+		line := ImportLine{Row: row, ISBN: e.ISBN, Title: e.Title}
+		if err := rowErrs[row]; err != nil {
+			line.Action, line.Message = importFailed, err.Error()
+			report.add(line)
+			continue
+		}
+
+		var isbn13 string
+		if strings.TrimSpace(e.ISBN) != "" {
+			if isbn13, err = normalizeISBN(e.ISBN); err != nil {
+				line.Action, line.Message = importFailed, err.Error()
+				report.add(line)
+				continue
+			}
+			e.ISBN = isbn13
+			line.ISBN = isbn13
+			if e.Title == "" {
+				if rec, err := s.LookupISBN(ctx, tenantID, isbn13, true); err == nil {
+					e = fillFromISBN(e, rec)
+					line.Title = e.Title
+				}
+			}
+		}
+		if err := e.validate(); err != nil {
+			line.Action, line.Message = importFailed, err.Error()
+			report.add(line)
+			continue
+		}
+
+		if isbn13 != "" {
+			if first, ok := inFile[isbn13]; ok {
+				line.Action, line.Message = importDuplicate, fmt.Sprintf("same ISBN as row %d", first)
+				report.add(line)
+				continue
+			}
+			inFile[isbn13] = row
+			existing, err := s.q.FindLibraryBookByISBN(ctx, tid, isbnForms(isbn13))
+			if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+				return report, err
+			}
+			if err == nil {
+				line.BookID = existing.ID.String()
+				if opts.OnDuplicate == onDuplicateSkip {
+					line.Action, line.Message = importDuplicate, "already in the catalogue as "+existing.Title
+					report.add(line)
+					continue
+				}
+				line.Action, line.Copies = importCopiesAdded, len(e.copyBarcodes())
+				if !opts.DryRun {
+					if err := s.circulation.inTx(ctx, func(q *db.Queries) error {
+						return s.addCopies(ctx, q, tid, existing.ID, e)
+					}); err != nil {
+						line.Action, line.Copies, line.Message = importFailed, 0, err.Error()
+					}
+				}
+				report.add(line)
+				continue
+			}
+		}
+
+		line.Action, line.Copies = importCreated, len(e.copyBarcodes())
+		if !opts.DryRun {
+			bookID, err := s.createTitle(ctx, tid, e)
+			if err != nil {
+				line.Action, line.Copies, line.Message = importFailed, 0, err.Error()
+			} else {
+				line.BookID = bookID.String()
+			}
+		}
+		report.add(line)
+	}
+
+	if !opts.DryRun {
+		s.circulation.log(ctx, tid, actor, "IMPORT_LIBRARY_CATALOGUE", "library_book", pgtype.UUID{}, map[string]any{
+			"format": opts.Format, "total": report.Total, "created": report.Created,
+			"copies_added": report.CopiesAdded, "duplicates": report.Duplicates, "failed": report.Failed,
+		})
+	}
+	return report, nil
+}
+
+func fillFromISBN(e CatalogueEntry, rec ISBNRecord) CatalogueEntry {
+	e.Title = rec.Title
+	if len(e.Authors) == 0 {
+		e.Authors = rec.Authors
+	}
+	if e.Publisher == "" {
+		e.Publisher = rec.Publisher
+	}
+	if e.PublishedYear == 0 {
+		e.PublishedYear = rec.PublishedYear
+	}
+	if e.Language == "" {
+		e.Language = rec.Language
+	}
+	return e
+}
+
+// createTitle saves an imported title with its authors, category and
+// copies, and keeps its record in the ISBN cache.
+func (s *CatalogueService) createTitle(ctx context.Context, tid pgtype.UUID, e CatalogueEntry) (pgtype.UUID, error) {
+	var bookID pgtype.UUID
+	err := s.circulation.inTx(ctx, func(q *db.Queries) error {
+		var categoryID pgtype.UUID
+		if e.Category != "" {
+			var err error
+			if categoryID, err = q.EnsureLibraryCategory(ctx, tid, e.Category); err != nil {
+				return err
+			}
+		}
+		var price pgtype.Numeric
+		if e.Price > 0 {
+			_ = price.Scan(strconv.FormatFloat(e.Price, 'f', 2, 64))
+		}
+		book, err := q.CreateBook(ctx, db.CreateBookParams{
+			TenantID:      tid,
+			Title:         e.Title,
+			Isbn:          optionalText(e.ISBN),
+			Publisher:     optionalText(e.Publisher),
+			PublishedYear: pgtype.Int4{Int32: e.PublishedYear, Valid: e.PublishedYear > 0},
+			CategoryID:    categoryID,
+			ShelfLocation: optionalText(e.ShelfLocation),
+			Price:         price,
+			Language:      optionalText(e.Language),
+			Status:        "active",
+		})
+		if err != nil {
+			return err
+		}
+		bookID = book.ID
+		for _, name := range e.Authors {
+			authorID, err := q.EnsureLibraryAuthor(ctx, tid, name)
+			if err != nil {
+				return err
+			}
+			if err := q.CreateBookAuthor(ctx, db.CreateBookAuthorParams{BookID: book.ID, AuthorID: authorID}); err != nil {
+				return err
+			}
+		}
+		if err := s.addCopies(ctx, q, tid, book.ID, e); err != nil {
+			return err
+		}
+		if e.ISBN == "" {
+			return nil
+		}
+		var subjects []string
+		if e.Category != "" {
+			subjects = []string{e.Category}
+		}
+		return q.UpsertLibraryISBNRecord(ctx, db.LibraryISBNRecord{
+			TenantID:      tid,
+			ISBN:          e.ISBN,
+			Title:         e.Title,
+			Authors:       e.Authors,
+			Publisher:     optionalText(e.Publisher),
+			PublishedYear: pgtype.Int4{Int32: e.PublishedYear, Valid: e.PublishedYear > 0},
+			Language:      optionalText(e.Language),
+			Subjects:      subjects,
+			Source:        "import",
+		})
+	})
+	return bookID, err
+}
+
+// Export
+
+// ExportCatalogue writes the whole catalogue, with the copies still held,
+// in one of the import formats.
+func (s *CatalogueService) ExportCatalogue(ctx context.Context, tenantID, format string, w io.Writer) error {
+	if format != FormatCSV && format != FormatMARC && format != FormatMARCXML {
+		return fmt.Errorf("%w: format must be csv, marc or marcxml", ErrInvalidCatalogue)
+	}
+	tid := toPgUUID(tenantID)
+	books, err := s.q.ListLibraryCatalogue(ctx, tid)
+	if err != nil {
+		return err
+	}
+	copies, err := s.q.ListLibraryCatalogueCopies(ctx, tid)
+	if err != nil {
+		return err
+	}
+	byBook := map[pgtype.UUID][]EntryCopy{}
+	for _, c := range copies {
+		byBook[c.BookID] = append(byBook[c.BookID], EntryCopy{
+			Barcode:         c.Barcode,
+			AccessionNumber: c.AccessionNumber,
+			ShelfLocation:   c.ShelfLocation.String,
+		})
+	}
+
+	entries := make([]CatalogueEntry, len(books))
+	for i, b := range books {
+		price, _ := b.Price.Float64Value()
+		entries[i] = CatalogueEntry{
+			ISBN:          b.ISBN.String,
+			Title:         b.Title,
+			Authors:       b.Authors,
+			Publisher:     b.Publisher.String,
+			PublishedYear: b.PublishedYear.Int32,
+			Language:      b.Language.String,
+			Category:      b.CategoryName.String,
+			Price:         price.Float64,
+			ShelfLocation: b.ShelfLocation.String,
+			Copies:        byBook[b.ID],
+		}
+	}
+
+	switch format {
+	case FormatCSV:
+		return writeCatalogueCSV(w, entries)
+	case FormatMARCXML:
+		recs := make([]marcRecord, len(entries))
+		for i, e := range entries {
+			recs[i] = marcFromEntry(books[i].ID.String(), books[i].CreatedAt.Time, e)
+		}
+		return writeMARCXML(w, recs)
+	default:
+		for i, e := range entries {
+			if err := writeISO2709(w, marcFromEntry(books[i].ID.String(), books[i].CreatedAt.Time, e)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
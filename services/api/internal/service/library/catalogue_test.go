@@ -0,0 +1,154 @@
+package library
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNormalizeISBN(t *testing.T) {
+	cases := map[string]string{
+		"0-306-40615-2":        "9780306406157",
+		"978-0-306-40615-7":    "9780306406157",
+		"ISBN 0 8044 2957 X":   "9780804429573",
+		"9780306406157 (pbk.)": "9780306406157",
+		"979-10-90636-07-1":    "9791090636071",
+	}
+	for raw, want := range cases {
+		got, err := normalizeISBN(raw)
+		if err != nil || got != want {
+			t.Fatalf("normalizeISBN(%q) = %q, %v; want %q", raw, got, err, want)
+		}
+	}
+	for _, raw := range []string{"", "0-306-40615-3", "9780306406158", "1234567890123", "abc"} {
+		if _, err := normalizeISBN(raw); !errors.Is(err, ErrInvalidISBN) {
+			t.Fatalf("expected %q to be invalid, got %v", raw, err)
+		}
+	}
+}
+
+func TestISBNForms(t *testing.T) {
+	if got := isbnForms("9780804429573"); !reflect.DeepEqual(got, []string{"9780804429573", "080442957X"}) {
+		t.Fatalf("unexpected forms %v", got)
+	}
+	if got := isbnForms("9791090636071"); !reflect.DeepEqual(got, []string{"9791090636071"}) {
+		t.Fatalf("979 numbers have no ISBN-10, got %v", got)
+	}
+}
+
+func TestEntryFromMARC(t *testing.T) {
+	rec := sampleMARCRecord()
+	rec.Fields = append(rec.Fields,
+		marcField{Tag: "008", Value: "200101s2019    ii            000 0 eng d"},
+		marcField{Tag: "264", Ind2: "1", Subfields: []marcSubfield{{"a", "Chennai :"}, {"b", "Indian Thought Publications,"}, {"c", "c2019."}}},
+		marcField{Tag: "650", Ind2: "0", Subfields: []marcSubfield{{"a", "Short stories."}}},
+		marcField{Tag: "700", Ind1: "1", Subfields: []marcSubfield{{"a", "Narayan, R. K."}}},
+		marcField{Tag: "952", Subfields: []marcSubfield{{"p", "B-001"}, {"o", "R1"}}},
+		marcField{Tag: "852", Subfields: []marcSubfield{{"h", "823"}, {"i", "NAR"}, {"p", "B-002"}}},
+	)
+	e := entryFromMARC(rec)
+	if e.ISBN != "9780306406157" || e.Title != "Malgudi days: stories" || e.Price != 450 {
+		t.Fatalf("unexpected entry %+v", e)
+	}
+	if !reflect.DeepEqual(e.Authors, []string{"Narayan, R. K."}) {
+		t.Fatalf("expected the repeated author once, got %v", e.Authors)
+	}
+	if e.Publisher != "Indian Thought Publications" || e.PublishedYear != 2019 || e.Language != "eng" || e.Category != "Short stories" {
+		t.Fatalf("unexpected imprint %+v", e)
+	}
+	if len(e.Copies) != 2 || e.Copies[0].Barcode != "B-001" || e.Copies[1].ShelfLocation != "823 NAR" || e.ShelfLocation != "R1" {
+		t.Fatalf("unexpected copies %+v", e.Copies)
+	}
+}
+
+func TestMARCFromEntryRoundTrip(t *testing.T) {
+	in := CatalogueEntry{
+		ISBN: "9780306406157", Title: "Godan", Authors: []string{"Premchand", "Roy, Gordon C."},
+		Publisher: "Saraswati Press", PublishedYear: 1936, Language: "hin", Category: "Fiction", Price: 199.5,
+		Copies: []EntryCopy{{Barcode: "G-1", AccessionNumber: "LIB-000001", ShelfLocation: "H2"}},
+	}
+	var buf bytes.Buffer
+	if err := writeISO2709(&buf, marcFromEntry("bk-9", time.Date(2026, 1, 5, 0, 0, 0, 0, time.UTC), in)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	recs, err := readISO2709(&buf)
+	if err != nil || len(recs) != 1 {
+		t.Fatalf("read: %v", err)
+	}
+	out := entryFromMARC(recs[0])
+	out.ShelfLocation = ""
+	if !reflect.DeepEqual(in, out) {
+		t.Fatalf("round trip changed the entry:\n in %+v\nout %+v", in, out)
+	}
+	if fixed := recs[0].control("008"); fixed[:6] != "260105" || fixed[7:11] != "1936" || fixed[35:38] != "hin" {
+		t.Fatalf("unexpected 008 %q", fixed)
+	}
+}
+
+func TestReadCatalogueCSV(t *testing.T) {
+	file := "\uFEFFISBN,Title,Author,Year,Price,Quantity,Barcode,Shelf\n" +
+		"0-306-40615-2,Malgudi Days,R. K. Narayan; Premchand,1943,250,2,B1; B2,R1\n" +
+		",Godan,,,abc,,,\n" +
+		",Nirmala,,,,1,C1; C2; C3,\n" +
+		",Gaban,,,,3,C4,\n"
+	entries, rowErrs, err := readCatalogueCSV(strings.NewReader(file))
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if len(entries) != 4 {
+		t.Fatalf("expected 4 rows, got %d", len(entries))
+	}
+	e := entries[0]
+	if e.ISBN != "0-306-40615-2" || e.PublishedYear != 1943 || e.Price != 250 || e.CopyCount != 2 {
+		t.Fatalf("unexpected entry %+v", e)
+	}
+	if !reflect.DeepEqual(e.Authors, []string{"R. K. Narayan", "Premchand"}) || len(e.Copies) != 2 || e.Copies[1].ShelfLocation != "R1" {
+		t.Fatalf("unexpected lists %+v", e)
+	}
+	if !errors.Is(rowErrs[2], ErrInvalidCatalogue) || rowErrs[3] != nil || !errors.Is(rowErrs[4], ErrInvalidCatalogue) {
+		t.Fatalf("unexpected row errors %v", rowErrs)
+	}
+	if n := len(entries[2].copyBarcodes()); n != 3 {
+		t.Fatalf("expected the barcodes to set the copy count, got %d", n)
+	}
+
+	if _, _, err := readCatalogueCSV(strings.NewReader("publisher,year\nPenguin,2001\n")); !errors.Is(err, ErrInvalidCatalogue) {
+		t.Fatalf("expected a header without title or isbn to fail, got %v", err)
+	}
+}
+
+func TestWriteCatalogueCSV(t *testing.T) {
+	var buf bytes.Buffer
+	err := writeCatalogueCSV(&buf, []CatalogueEntry{{
+		ISBN: "9780306406157", Title: "=HYPERLINK(\"x\")", Authors: []string{"A", "B"}, Price: 12,
+		Copies: []EntryCopy{{Barcode: "B1"}, {Barcode: "B2"}},
+	}})
+	if err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	entries, rowErrs, err := readCatalogueCSV(&buf)
+	if err != nil || len(rowErrs) != 0 || len(entries) != 1 {
+		t.Fatalf("read back: %v %v", err, rowErrs)
+	}
+	e := entries[0]
+	if e.Title != "'=HYPERLINK(\"x\")" || e.CopyCount != 2 || len(e.Copies) != 2 || e.Price != 12 {
+		t.Fatalf("unexpected entry %+v", e)
+	}
+}
+
+func TestCatalogueEntryValidate(t *testing.T) {
+	if err := (CatalogueEntry{}).validate(); !errors.Is(err, ErrInvalidCatalogue) {
+		t.Fatalf("expected a title to be required, got %v", err)
+	}
+	dup := CatalogueEntry{Title: "x", Copies: []EntryCopy{{Barcode: "B1"}, {Barcode: "B1"}}}
+	if err := dup.validate(); !errors.Is(err, ErrInvalidCatalogue) {
+		t.Fatalf("expected repeated barcodes to fail, got %v", err)
+	}
+	blank := CatalogueEntry{Title: "x", CopyCount: 3}
+	if err := blank.validate(); err != nil {
+		t.Fatalf("blank barcodes are accessioned, got %v", err)
+	}
+}
@@ -0,0 +1,1058 @@
+package library
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog/log"
+	"github.com/schoolerp/api/internal/db"
+	"github.com/schoolerp/api/internal/foundation/approvals"
+	"github.com/schoolerp/api/internal/foundation/audit"
+)
+
+var (
+	ErrInvalidCirculation  = errors.New("invalid library request")
+	ErrBookNotFound        = errors.New("book not found")
+	ErrCopyNotFound        = errors.New("copy not found")
+	ErrLoanNotFound        = errors.New("issue not found")
+	ErrMemberNotFound      = errors.New("member not found")
+	ErrPolicyNotFound      = errors.New("borrowing policy not found")
+	ErrReservationNotFound = errors.New("reservation not found")
+	ErrCopyUnavailable     = errors.New("book not available")
+	ErrBorrowLimit         = errors.New("borrowing limit reached")
+	ErrRenewalRefused      = errors.New("renewal refused")
+	ErrAlreadyReserved     = errors.New("member already has an open reservation for this book")
+)
+
+const (
+	memberStudent = "student"
+	memberStaff   = "staff"
+
+	copyAvailable = "available"
+	copyIssued    = "issued"
+	copyOnHold    = "on_hold"
+	copyLost      = "lost"
+	copyDamaged   = "damaged"
+	copyWithdrawn = "withdrawn"
+
+	maxCopiesPerBatch = 500
+	holdCheckInterval = 15 * time.Minute
+)
+
+// Borrowing terms used until the school saves a policy of its own.
+var defaultPolicies = map[string]db.LibraryMemberPolicy{
+	memberStudent: {MemberType: memberStudent, LoanDays: 14, MaxBooks: 2, MaxRenewals: 1},
+	memberStaff:   {MemberType: memberStaff, LoanDays: 30, MaxBooks: 5, MaxRenewals: 2},
+}
+
+// DefaultLibrarySettings apply until the school saves its own.
+var DefaultLibrarySettings = db.LibrarySettings{AccessionPrefix: "ACC", NextAccession: 1, HoldDays: 3}
+
+// CirculationService lends copies of books: accession-numbered copies,
+// borrowing policies, issues, renewals, returns, the reservation queue and
+// the fines raised on loans.
+type CirculationService struct {
+	q         *db.Queries
+	pool      *pgxpool.Pool
+	audit     *audit.Logger
+	approvals *approvals.Service
+}
+
+func NewCirculationService(q *db.Queries, pool *pgxpool.Pool, audit *audit.Logger, approvals *approvals.Service) *CirculationService {
+	return &CirculationService{q: q, pool: pool, audit: audit, approvals: approvals}
+}
+
+// Actor is the staff member working the desk.
+type Actor struct {
+	UserID    string
+	RequestID string
+	IP        string
+}
+
+// MemberRef names a borrower: a student or a staff member.
+type MemberRef struct {
+	StudentID  string
+	EmployeeID string
+}
+
+func (s *CirculationService) log(ctx context.Context, tenantID pgtype.UUID, actor Actor, action, resourceType string, resourceID pgtype.UUID, after any) {
+	_ = s.audit.Log(ctx, audit.Entry{
+		TenantID:     tenantID,
+		UserID:       parseUserUUID(actor.UserID),
+		RequestID:    actor.RequestID,
+		Action:       action,
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+		After:        after,
+		IPAddress:    actor.IP,
+	})
+}
+
+func toPgUUID(id string) pgtype.UUID {
+	var u pgtype.UUID
+	_ = u.Scan(strings.TrimSpace(id))
+	return u
+}
+
+func optionalText(v string) pgtype.Text {
+	v = strings.TrimSpace(v)
+	return pgtype.Text{String: v, Valid: v != ""}
+}
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+func (s *CirculationService) inTx(ctx context.Context, fn func(q *db.Queries) error) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+	if err := fn(s.q.WithTx(tx)); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// Settings
+
+func (s *CirculationService) settings(ctx context.Context, q *db.Queries, tenantID pgtype.UUID) (db.LibrarySettings, error) {
+	settings, err := q.GetLibrarySettings(ctx, tenantID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		settings = DefaultLibrarySettings
+		settings.TenantID = tenantID
+		return settings, nil
+	}
+	return settings, err
+}
+
+func (s *CirculationService) GetSettings(ctx context.Context, tenantID string) (db.LibrarySettings, error) {
+	return s.settings(ctx, s.q, toPgUUID(tenantID))
+}
+
+func (s *CirculationService) UpdateSettings(ctx context.Context, tenantID, prefix string, holdDays int32, fineFeeHeadID string, actor Actor) (db.LibrarySettings, error) {
+	prefix = strings.TrimSpace(prefix)
+	if prefix == "" || len(prefix) > 12 {
+		return db.LibrarySettings{}, fmt.Errorf("%w: accession_prefix must be 1 to 12 characters", ErrInvalidCirculation)
+	}
+	if holdDays < 1 || holdDays > 30 {
+		return db.LibrarySettings{}, fmt.Errorf("%w: hold_days must be between 1 and 30", ErrInvalidCirculation)
+	}
+	tid := toPgUUID(tenantID)
+	settings, err := s.q.UpsertLibrarySettings(ctx, tid, prefix, holdDays, toPgUUID(fineFeeHeadID), parseUserUUID(actor.UserID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return settings, fmt.Errorf("%w: fee head not found", ErrInvalidCirculation)
+	}
+	if err != nil {
+		return settings, err
+	}
+	s.log(ctx, tid, actor, "UPDATE_LIBRARY_SETTINGS", "library_settings", tid, settings)
+	return settings, nil
+}
+
+// Copies
+
+// formatAccession prints an accession number as the prefix and a
+// six-digit running number.
+func formatAccession(prefix string, n int64) string {
+	return fmt.Sprintf("%s%06d", prefix, n)
+}
+
+type AddCopiesInput struct {
+	Count         int
+	Barcodes      []string
+	ShelfLocation string
+	AcquiredOn    time.Time
+	Notes         string
+}
+
+// normalize checks the batch and returns its barcodes, blank where the
+// accession number is to be used.
+func (in AddCopiesInput) normalize() ([]string, error) {
+	if len(in.Barcodes) == 0 {
+		if in.Count < 1 || in.Count > maxCopiesPerBatch {
+			return nil, fmt.Errorf("%w: count must be between 1 and %d", ErrInvalidCirculation, maxCopiesPerBatch)
+		}
+		return make([]string, in.Count), nil
+	}
+	if in.Count != 0 && in.Count != len(in.Barcodes) {
+		return nil, fmt.Errorf("%w: count does not match the barcodes given", ErrInvalidCirculation)
+	}
+	if len(in.Barcodes) > maxCopiesPerBatch {
+		return nil, fmt.Errorf("%w: at most %d copies at a time", ErrInvalidCirculation, maxCopiesPerBatch)
+	}
+	seen := map[string]bool{}
+	out := make([]string, len(in.Barcodes))
+	for i, b := range in.Barcodes {
+		b = strings.TrimSpace(b)
+		if b == "" {
+			return nil, fmt.Errorf("%w: barcode %d is blank", ErrInvalidCirculation, i+1)
+		}
+		if seen[b] {
+			return nil, fmt.Errorf("%w: barcode %s is repeated", ErrInvalidCirculation, b)
+		}
+		seen[b] = true
+		out[i] = b
+	}
+	return out, nil
+}
+
+// AddCopies accessions new copies of a title. Copies without a barcode use
+// their accession number. Members waiting for the title get the new copies
+// first.
+func (s *CirculationService) AddCopies(ctx context.Context, tenantID, bookID string, in AddCopiesInput, actor Actor) ([]db.LibraryBookCopy, error) {
+	barcodes, err := in.normalize()
+	if err != nil {
+		return nil, err
+	}
+	tid, bid := toPgUUID(tenantID), toPgUUID(bookID)
+	var copies []db.LibraryBookCopy
+	err = s.inTx(ctx, func(q *db.Queries) error {
+		copies, err = s.addCopies(ctx, q, tid, bid, barcodes, in)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.log(ctx, tid, actor, "ADD_BOOK_COPIES", "library_book", bid, map[string]any{"copies": len(copies)})
+	return copies, nil
+}
+
+func (s *CirculationService) addCopies(ctx context.Context, q *db.Queries, tid, bid pgtype.UUID, barcodes []string, in AddCopiesInput) ([]db.LibraryBookCopy, error) {
+	if _, err := q.LockLibraryBook(ctx, tid, bid); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrBookNotFound
+		}
+		return nil, err
+	}
+	settings, err := s.settings(ctx, q, tid)
+	if err != nil {
+		return nil, err
+	}
+	first, prefix, err := q.ReserveLibraryAccessions(ctx, tid, len(barcodes))
+	if err != nil {
+		return nil, err
+	}
+	acquired := pgtype.Date{Time: in.AcquiredOn, Valid: !in.AcquiredOn.IsZero()}
+
+	copies := make([]db.LibraryBookCopy, 0, len(barcodes))
+	for i, barcode := range barcodes {
+		accession := formatAccession(prefix, first+int64(i))
+		if barcode == "" {
+			barcode = accession
+		}
+		c, err := q.CreateLibraryBookCopy(ctx, db.CreateLibraryBookCopyParams{
+			TenantID:        tid,
+			BookID:          bid,
+			AccessionNumber: accession,
+			Barcode:         barcode,
+			ShelfLocation:   optionalText(in.ShelfLocation),
+			AcquiredOn:      acquired,
+			Notes:           optionalText(in.Notes),
+		})
+		if isUniqueViolation(err) {
+			return nil, fmt.Errorf("%w: barcode %s or accession %s is already in use", ErrInvalidCirculation, barcode, accession)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if c.Status, err = s.passOn(ctx, q, tid, bid, c.ID, settings); err != nil {
+			return nil, err
+		}
+		copies = append(copies, c)
+	}
+	if _, err := q.SyncLibraryBookCounts(ctx, tid, bid); err != nil {
+		return nil, err
+	}
+	return copies, nil
+}
+
+func (s *CirculationService) ListCopies(ctx context.Context, tenantID, bookID string) ([]db.LibraryBookCopy, error) {
+	return s.q.ListLibraryBookCopies(ctx, toPgUUID(tenantID), toPgUUID(bookID))
+}
+
+// CopyByBarcode looks a copy up by barcode or accession number.
+func (s *CirculationService) CopyByBarcode(ctx context.Context, tenantID, code string) (db.LibraryBookCopy, error) {
+	c, err := s.q.GetLibraryBookCopyByBarcode(ctx, toPgUUID(tenantID), strings.TrimSpace(code))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return c, ErrCopyNotFound
+	}
+	return c, err
+}
+
+type CopyUpdate struct {
+	Status        string
+	ShelfLocation string
+	Notes         string
+}
+
+// copyTransitionAllowed reports whether staff may move a copy between two
+// states by hand. Issues, returns and holds move copies in and out of
+// issued and on_hold; an issued copy can only be written off as lost.
+func copyTransitionAllowed(from, to string) bool {
+	switch to {
+	case copyAvailable, copyLost, copyDamaged, copyWithdrawn:
+	default:
+		return false
+	}
+	switch from {
+	case copyIssued:
+		return to == copyLost
+	case copyOnHold:
+		return false
+	}
+	return true
+}
+
+// UpdateCopy changes a copy's status, shelf or notes. Writing off an issued
+// copy as lost closes its loan and charges the borrower for it; a copy put
+// back into circulation goes to
+// the reservation queue first.
+func (s *CirculationService) UpdateCopy(ctx context.Context, tenantID, copyID string, in CopyUpdate, actor Actor) (db.LibraryBookCopy, error) {
+	tid, cid := toPgUUID(tenantID), toPgUUID(copyID)
+	c, err := s.q.GetLibraryBookCopy(ctx, tid, cid)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return c, ErrCopyNotFound
+	}
+	if err != nil {
+		return c, err
+	}
+	err = s.inTx(ctx, func(q *db.Queries) error {
+		if _, err := q.LockLibraryBook(ctx, tid, c.BookID); err != nil {
+			return err
+		}
+		if c, err = q.GetLibraryBookCopy(ctx, tid, cid); err != nil {
+			return err
+		}
+		status := in.Status
+		if status == "" {
+			status = c.Status
+		}
+		if status != c.Status && !copyTransitionAllowed(c.Status, status) {
+			return fmt.Errorf("%w: a %s copy cannot be marked %s", ErrInvalidCirculation, c.Status, status)
+		}
+		if status == copyLost && c.Status == copyIssued {
+			loan, err := q.GetOpenLibraryLoanByCopy(ctx, tid, cid)
+			if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+				return err
+			}
+			if err == nil {
+				now := time.Now()
+				total, err := s.raiseFines(ctx, q, tid, loan, now, fineLost, actor)
+				if err != nil {
+					return err
+				}
+				if _, err := q.CloseLibraryLoan(ctx, db.CloseLibraryLoanParams{
+					TenantID:   tid,
+					ID:         loan.ID,
+					Status:     "lost",
+					ReturnDate: pgtype.Timestamptz{Time: now, Valid: true},
+					FineAmount: fineNumeric(total),
+					Remarks:    optionalText(in.Notes),
+				}); err != nil {
+					return err
+				}
+			}
+		}
+		if err := q.UpdateLibraryBookCopy(ctx, tid, cid, status, optionalText(in.ShelfLocation), optionalText(in.Notes)); err != nil {
+			return err
+		}
+		if status == copyAvailable && c.Status != copyAvailable {
+			settings, err := s.settings(ctx, q, tid)
+			if err != nil {
+				return err
+			}
+			if _, err := s.passOn(ctx, q, tid, c.BookID, cid, settings); err != nil {
+				return err
+			}
+		}
+		if _, err := q.SyncLibraryBookCounts(ctx, tid, c.BookID); err != nil {
+			return err
+		}
+		c, err = q.GetLibraryBookCopy(ctx, tid, cid)
+		return err
+	})
+	if err != nil {
+		return c, err
+	}
+	s.log(ctx, tid, actor, "UPDATE_BOOK_COPY", "library_book_copy", cid, c)
+	return c, nil
+}
+
+// Members and policies
+
+func (s *CirculationService) member(ctx context.Context, q *db.Queries, tid pgtype.UUID, ref MemberRef) (db.LibraryMember, error) {
+	studentID, employeeID := strings.TrimSpace(ref.StudentID), strings.TrimSpace(ref.EmployeeID)
+	if (studentID == "") == (employeeID == "") {
+		return db.LibraryMember{}, fmt.Errorf("%w: give either student_id or employee_id", ErrInvalidCirculation)
+	}
+	var m db.LibraryMember
+	var err error
+	if studentID != "" {
+		m, err = q.GetLibraryStudentMember(ctx, tid, toPgUUID(studentID))
+	} else {
+		m, err = q.GetLibraryStaffMember(ctx, tid, toPgUUID(employeeID))
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		return m, ErrMemberNotFound
+	}
+	return m, err
+}
+
+// memberIDs splits a member into the student and employee columns of a
+// loan or reservation.
+func memberIDs(m db.LibraryMember) (student, employee pgtype.UUID) {
+	if m.Type == memberStaff {
+		return pgtype.UUID{}, m.ID
+	}
+	return m.ID, pgtype.UUID{}
+}
+
+func (s *CirculationService) loanMember(ctx context.Context, q *db.Queries, tid pgtype.UUID, studentID, employeeID pgtype.UUID) (db.LibraryMember, error) {
+	if employeeID.Valid {
+		return q.GetLibraryStaffMember(ctx, tid, employeeID)
+	}
+	return q.GetLibraryStudentMember(ctx, tid, studentID)
+}
+
+func (s *CirculationService) policy(ctx context.Context, q *db.Queries, tid pgtype.UUID, m db.LibraryMember) (db.LibraryMemberPolicy, error) {
+	p, err := q.ResolveLibraryMemberPolicy(ctx, tid, m.Type, m.ClassID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return defaultPolicies[m.Type], nil
+	}
+	return p, err
+}
+
+func (s *CirculationService) ListPolicies(ctx context.Context, tenantID string) ([]db.LibraryMemberPolicy, error) {
+	return s.q.ListLibraryMemberPolicies(ctx, toPgUUID(tenantID))
+}
+
+type PolicyInput struct {
+	MemberType  string
+	ClassID     string
+	LoanDays    int32
+	MaxBooks    int32
+	MaxRenewals int32
+}
+
+func (in PolicyInput) validate() error {
+	switch {
+	case in.MemberType != memberStudent && in.MemberType != memberStaff:
+		return fmt.Errorf("%w: member_type must be student or staff", ErrInvalidCirculation)
+	case in.MemberType == memberStaff && in.ClassID != "":
+		return fmt.Errorf("%w: only student policies can be set per class", ErrInvalidCirculation)
+	case in.LoanDays < 1 || in.LoanDays > 365:
+		return fmt.Errorf("%w: loan_days must be between 1 and 365", ErrInvalidCirculation)
+	case in.MaxBooks < 0 || in.MaxBooks > 50:
+		return fmt.Errorf("%w: max_books must be between 0 and 50", ErrInvalidCirculation)
+	case in.MaxRenewals < 0 || in.MaxRenewals > 10:
+		return fmt.Errorf("%w: max_renewals must be between 0 and 10", ErrInvalidCirculation)
+	}
+	return nil
+}
+
+// SavePolicy sets the borrowing terms for a member type, or for the
+// students of one class.
+func (s *CirculationService) SavePolicy(ctx context.Context, tenantID string, in PolicyInput, actor Actor) (db.LibraryMemberPolicy, error) {
+	in.ClassID = strings.TrimSpace(in.ClassID)
+	if err := in.validate(); err != nil {
+		return db.LibraryMemberPolicy{}, err
+	}
+	tid := toPgUUID(tenantID)
+	p, err := s.q.UpsertLibraryMemberPolicy(ctx, db.UpsertLibraryMemberPolicyParams{
+		TenantID:    tid,
+		MemberType:  in.MemberType,
+		ClassID:     toPgUUID(in.ClassID),
+		LoanDays:    in.LoanDays,
+		MaxBooks:    in.MaxBooks,
+		MaxRenewals: in.MaxRenewals,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return p, fmt.Errorf("%w: class not found", ErrInvalidCirculation)
+	}
+	if err != nil {
+		return p, err
+	}
+	s.log(ctx, tid, actor, "SAVE_LIBRARY_POLICY", "library_member_policy", p.ID, p)
+	return p, nil
+}
+
+func (s *CirculationService) DeletePolicy(ctx context.Context, tenantID, policyID string, actor Actor) error {
+	tid, pid := toPgUUID(tenantID), toPgUUID(policyID)
+	err := s.q.DeleteLibraryMemberPolicy(ctx, tid, pid)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrPolicyNotFound
+	}
+	if err != nil {
+		return err
+	}
+	s.log(ctx, tid, actor, "DELETE_LIBRARY_POLICY", "library_member_policy", pid, nil)
+	return nil
+}
+
+// MemberStatus is what the desk sees when a member walks up.
+type MemberStatus struct {
+	Member       db.LibraryMember        `json:"member"`
+	Policy       db.LibraryMemberPolicy  `json:"policy"`
+	Loans        []db.LibraryLoan        `json:"loans"`
+	Reservations []db.LibraryReservation `json:"reservations"`
+	// Fines are the member's fines not yet paid, waived or posted to the
+	// fee ledger.
+	Fines     []db.LibraryFine `json:"fines"`
+	FinesDue  int64            `json:"fines_due"`
+	CanBorrow int32            `json:"can_borrow"`
+}
+
+func (s *CirculationService) MemberStatus(ctx context.Context, tenantID string, ref MemberRef) (MemberStatus, error) {
+	tid := toPgUUID(tenantID)
+	m, err := s.member(ctx, s.q, tid, ref)
+	if err != nil {
+		return MemberStatus{}, err
+	}
+	out := MemberStatus{Member: m}
+	if out.Policy, err = s.policy(ctx, s.q, tid, m); err != nil {
+		return out, err
+	}
+	studentID, employeeID := memberIDs(m)
+	if out.Loans, err = s.q.ListLibraryMemberLoans(ctx, tid, studentID, employeeID, true); err != nil {
+		return out, err
+	}
+	if out.Reservations, err = s.q.ListLibraryReservations(ctx, db.ListLibraryReservationsParams{
+		TenantID: tid, StudentID: studentID, EmployeeID: employeeID, OpenOnly: true,
+	}); err != nil {
+		return out, err
+	}
+	if out.Fines, err = s.q.ListLibraryFines(ctx, db.ListLibraryFinesParams{
+		TenantID: tid, StudentID: studentID, EmployeeID: employeeID, Statuses: []string{fineOpen, fineWaiverRequested},
+	}); err != nil {
+		return out, err
+	}
+	for _, f := range out.Fines {
+		out.FinesDue += f.Outstanding
+	}
+	out.CanBorrow = max(out.Policy.MaxBooks-int32(len(out.Loans)), 0)
+	return out, nil
+}
+
+// Issues
+
+type IssueParams struct {
+	TenantID string
+	BookID   string
+	CopyID   string
+	Member   MemberRef
+	// Days overrides the policy's loan length when positive.
+	Days  int
+	Actor Actor
+}
+
+// Issue lends a copy to a member. Given only the title, the copy held for
+// the member's reservation is used, or else the first copy on the shelf.
+// A copy held for somebody else cannot be issued.
+func (s *CirculationService) Issue(ctx context.Context, p IssueParams) (db.LibraryLoan, error) {
+	tid := toPgUUID(p.TenantID)
+	bid := toPgUUID(p.BookID)
+	cid := toPgUUID(p.CopyID)
+	if cid.Valid {
+		c, err := s.q.GetLibraryBookCopy(ctx, tid, cid)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return db.LibraryLoan{}, ErrCopyNotFound
+		}
+		if err != nil {
+			return db.LibraryLoan{}, err
+		}
+		bid = c.BookID
+	}
+	if !bid.Valid {
+		return db.LibraryLoan{}, fmt.Errorf("%w: give a book or a copy", ErrInvalidCirculation)
+	}
+
+	var loan db.LibraryLoan
+	err := s.inTx(ctx, func(q *db.Queries) error {
+		m, err := s.member(ctx, q, tid, p.Member)
+		if err != nil {
+			return err
+		}
+		if m.Status != "active" {
+			return fmt.Errorf("%w: %s is not an active member", ErrInvalidCirculation, m.Name)
+		}
+		if _, err := q.LockLibraryBook(ctx, tid, bid); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrBookNotFound
+			}
+			return err
+		}
+		policy, err := s.policy(ctx, q, tid, m)
+		if err != nil {
+			return err
+		}
+		studentID, employeeID := memberIDs(m)
+		open, err := q.CountOpenLibraryLoans(ctx, tid, studentID, employeeID)
+		if err != nil {
+			return err
+		}
+		if open >= int(policy.MaxBooks) {
+			return fmt.Errorf("%w: %s already has %d of %d books", ErrBorrowLimit, m.Name, open, policy.MaxBooks)
+		}
+		settings, err := s.settings(ctx, q, tid)
+		if err != nil {
+			return err
+		}
+
+		res, err := q.GetOpenLibraryReservation(ctx, tid, bid, studentID, employeeID)
+		hasRes := err == nil
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return err
+		}
+		held := hasRes && res.Status == "ready" && res.CopyID.Valid
+
+		var c db.LibraryBookCopy
+		switch {
+		case cid.Valid:
+			c, err = q.GetLibraryBookCopy(ctx, tid, cid)
+		case held:
+			c, err = q.GetLibraryBookCopy(ctx, tid, res.CopyID)
+		default:
+			c, err = q.FirstAvailableLibraryBookCopy(ctx, tid, bid)
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrCopyUnavailable
+			}
+		}
+		if err != nil {
+			return err
+		}
+		heldForMember := held && c.ID == res.CopyID
+		if c.Status != copyAvailable && !(c.Status == copyOnHold && heldForMember) {
+			return fmt.Errorf("%w: copy %s is %s", ErrCopyUnavailable, c.AccessionNumber, c.Status)
+		}
+
+		days := int(policy.LoanDays)
+		if p.Days > 0 {
+			days = p.Days
+		}
+		now := time.Now()
+		loan, err = q.CreateLibraryLoan(ctx, db.CreateLibraryLoanParams{
+			TenantID:   tid,
+			BookID:     bid,
+			CopyID:     c.ID,
+			StudentID:  studentID,
+			EmployeeID: employeeID,
+			UserID:     parseUserUUID(p.Actor.UserID),
+			IssueDate:  pgtype.Timestamptz{Time: now, Valid: true},
+			DueDate:    pgtype.Timestamptz{Time: now.AddDate(0, 0, days), Valid: true},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to issue book: %w", err)
+		}
+		if err := q.SetLibraryBookCopyStatus(ctx, tid, c.ID, copyIssued); err != nil {
+			return err
+		}
+		if hasRes {
+			if _, err := q.CloseLibraryReservation(ctx, tid, res.ID, "fulfilled", loan.ID); err != nil {
+				return err
+			}
+			// The member took another copy; the one kept for them goes to
+			// the next in line.
+			if held && !heldForMember {
+				if _, err := s.passOn(ctx, q, tid, bid, res.CopyID, settings); err != nil {
+					return err
+				}
+			}
+		}
+		_, err = q.SyncLibraryBookCounts(ctx, tid, bid)
+		return err
+	})
+	if err != nil {
+		return loan, err
+	}
+	s.log(ctx, tid, p.Actor, "ISSUE_BOOK", "library_issue", loan.ID, map[string]any{
+		"book_id": loan.BookID.String(), "copy_id": loan.CopyID.String(),
+		"student_id": p.Member.StudentID, "employee_id": p.Member.EmployeeID,
+	})
+	return loan, nil
+}
+
+// checkRenewal applies the renewal rules: within the policy's limit, not
+// overdue, and nobody waiting for the title.
+func checkRenewal(loan db.LibraryLoan, policy db.LibraryMemberPolicy, waiting int, now time.Time) error {
+	switch {
+	case loan.Status != "issued" && loan.Status != "overdue":
+		return fmt.Errorf("%w: the book is not on loan", ErrRenewalRefused)
+	case loan.RenewalCount >= policy.MaxRenewals:
+		return fmt.Errorf("%w: the limit of %d renewals is reached", ErrRenewalRefused, policy.MaxRenewals)
+	case loan.DueDate.Valid && now.After(loan.DueDate.Time):
+		return fmt.Errorf("%w: overdue books must be returned", ErrRenewalRefused)
+	case waiting > 0:
+		return fmt.Errorf("%w: %d member(s) are waiting for this book", ErrRenewalRefused, waiting)
+	}
+	return nil
+}
+
+// Renew extends a loan by the member's loan length from its due date.
+func (s *CirculationService) Renew(ctx context.Context, tenantID, loanID string, actor Actor) (db.LibraryLoan, error) {
+	tid, lid := toPgUUID(tenantID), toPgUUID(loanID)
+	loan, err := s.q.GetLibraryLoan(ctx, tid, lid)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return loan, ErrLoanNotFound
+	}
+	if err != nil {
+		return loan, err
+	}
+	err = s.inTx(ctx, func(q *db.Queries) error {
+		if _, err := q.LockLibraryBook(ctx, tid, loan.BookID); err != nil {
+			return err
+		}
+		if loan, err = q.LockLibraryLoan(ctx, tid, lid); err != nil {
+			return err
+		}
+		m, err := s.loanMember(ctx, q, tid, loan.StudentID, loan.EmployeeID)
+		if err != nil {
+			return err
+		}
+		policy, err := s.policy(ctx, q, tid, m)
+		if err != nil {
+			return err
+		}
+		waiting, err := q.CountWaitingLibraryReservations(ctx, tid, loan.BookID)
+		if err != nil {
+			return err
+		}
+		if err := checkRenewal(loan, policy, waiting, time.Now()); err != nil {
+			return err
+		}
+		due := loan.DueDate.Time.AddDate(0, 0, int(policy.LoanDays))
+		loan, err = q.RenewLibraryLoan(ctx, tid, lid, pgtype.Timestamptz{Time: due, Valid: true})
+		return err
+	})
+	if err != nil {
+		return loan, err
+	}
+	s.log(ctx, tid, actor, "RENEW_BOOK", "library_issue", lid, map[string]any{
+		"due_date": loan.DueDate.Time, "renewal_count": loan.RenewalCount,
+	})
+	return loan, nil
+}
+
+type ReturnParams struct {
+	TenantID string
+	LoanID   string
+	// Damaged takes the copy out of circulation instead of shelving it and
+	// charges the borrower for the damage.
+	Damaged bool
+	Remarks string
+	Actor   Actor
+}
+
+// Return checks a copy back in, raises the overdue fine and any damage
+// charge under the member's fine policy and hands the copy to the next
+// member waiting for the title.
+func (s *CirculationService) Return(ctx context.Context, p ReturnParams) (db.LibraryLoan, error) {
+	tid, lid := toPgUUID(p.TenantID), toPgUUID(p.LoanID)
+	loan, err := s.q.GetLibraryLoan(ctx, tid, lid)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return loan, ErrLoanNotFound
+	}
+	if err != nil {
+		return loan, err
+	}
+	if loan.Status == "returned" {
+		return loan, nil // Already returned
+	}
+
+	err = s.inTx(ctx, func(q *db.Queries) error {
+		if _, err := q.LockLibraryBook(ctx, tid, loan.BookID); err != nil {
+			return err
+		}
+		if loan, err = q.LockLibraryLoan(ctx, tid, lid); err != nil {
+			return err
+		}
+		if loan.Status != "issued" && loan.Status != "overdue" {
+			return fmt.Errorf("%w: the issue is %s", ErrInvalidCirculation, loan.Status)
+		}
+		now := time.Now()
+		kind := ""
+		if p.Damaged {
+			kind = fineDamaged
+		}
+		total, err := s.raiseFines(ctx, q, tid, loan, now, kind, p.Actor)
+		if err != nil {
+			return err
+		}
+		if loan, err = q.CloseLibraryLoan(ctx, db.CloseLibraryLoanParams{
+			TenantID:   tid,
+			ID:         lid,
+			Status:     "returned",
+			ReturnDate: pgtype.Timestamptz{Time: now, Valid: true},
+			FineAmount: fineNumeric(total),
+			Remarks:    optionalText(p.Remarks),
+		}); err != nil {
+			return fmt.Errorf("failed to return book: %w", err)
+		}
+		if loan.CopyID.Valid {
+			if p.Damaged {
+				err = q.SetLibraryBookCopyStatus(ctx, tid, loan.CopyID, copyDamaged)
+			} else {
+				settings, serr := s.settings(ctx, q, tid)
+				if serr != nil {
+					return serr
+				}
+				_, err = s.passOn(ctx, q, tid, loan.BookID, loan.CopyID, settings)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		_, err = q.SyncLibraryBookCounts(ctx, tid, loan.BookID)
+		return err
+	})
+	if err != nil {
+		return loan, err
+	}
+	s.log(ctx, tid, p.Actor, "RETURN_BOOK", "library_issue", lid, map[string]any{
+		"copy_id": loan.CopyID.String(), "damaged": p.Damaged,
+	})
+	return loan, nil
+}
+
+// LoanByBarcode finds the open loan of the copy with a barcode or accession
+// number.
+func (s *CirculationService) LoanByBarcode(ctx context.Context, tenantID, code string) (db.LibraryLoan, error) {
+	c, err := s.CopyByBarcode(ctx, tenantID, code)
+	if err != nil {
+		return db.LibraryLoan{}, err
+	}
+	loan, err := s.q.GetOpenLibraryLoanByCopy(ctx, c.TenantID, c.ID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return loan, fmt.Errorf("%w: copy %s is not on loan", ErrLoanNotFound, c.AccessionNumber)
+	}
+	return loan, err
+}
+
+// Reservations
+
+// passOn puts a copy that has come free on hold for the first member
+// waiting for the title and queues their notice, or shelves it when nobody
+// is waiting. It returns the copy's new status. Callers hold the title lock.
+func (s *CirculationService) passOn(ctx context.Context, q *db.Queries, tid, bookID, copyID pgtype.UUID, settings db.LibrarySettings) (string, error) {
+	next, err := q.NextWaitingLibraryReservation(ctx, tid, bookID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return copyAvailable, q.SetLibraryBookCopyStatus(ctx, tid, copyID, copyAvailable)
+	}
+	if err != nil {
+		return "", err
+	}
+	if err := q.SetLibraryBookCopyStatus(ctx, tid, copyID, copyOnHold); err != nil {
+		return "", err
+	}
+	holdUntil := time.Now().AddDate(0, 0, int(settings.HoldDays))
+	res, err := q.HoldLibraryReservation(ctx, tid, next.ID, copyID, pgtype.Timestamptz{Time: holdUntil, Valid: true})
+	if err != nil {
+		return "", err
+	}
+	return copyOnHold, s.notifyReady(ctx, q, res)
+}
+
+func (s *CirculationService) notifyReady(ctx context.Context, q *db.Queries, res db.LibraryReservation) error {
+	users, err := q.ListLibraryMemberRecipients(ctx, res.TenantID, res.StudentID, res.EmployeeID)
+	if err != nil {
+		return err
+	}
+	recipients := make([]string, 0, len(users))
+	for _, u := range users {
+		recipients = append(recipients, u.String())
+	}
+	body, err := json.Marshal(map[string]any{
+		"reservation_id":     res.ID.String(),
+		"book_id":            res.BookID.String(),
+		"book_title":         res.BookTitle,
+		"member_name":        res.MemberName,
+		"accession_number":   res.AccessionNumber.String,
+		"hold_until":         res.HoldUntil.Time.UTC().Format(time.RFC3339),
+		"recipient_user_ids": recipients,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = q.CreateOutboxEvent(ctx, db.CreateOutboxEventParams{
+		TenantID:  res.TenantID,
+		EventType: "library.reservation_ready",
+		Payload:   body,
+	})
+	return err
+}
+
+// Reserve puts a member in the queue for a title. If a copy is on the shelf
+// it is set aside for them straight away.
+func (s *CirculationService) Reserve(ctx context.Context, tenantID, bookID string, ref MemberRef, actor Actor) (db.LibraryReservation, error) {
+	tid, bid := toPgUUID(tenantID), toPgUUID(bookID)
+	var res db.LibraryReservation
+	err := s.inTx(ctx, func(q *db.Queries) error {
+		m, err := s.member(ctx, q, tid, ref)
+		if err != nil {
+			return err
+		}
+		if m.Status != "active" {
+			return fmt.Errorf("%w: %s is not an active member", ErrInvalidCirculation, m.Name)
+		}
+		if _, err := q.LockLibraryBook(ctx, tid, bid); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrBookNotFound
+			}
+			return err
+		}
+		studentID, employeeID := memberIDs(m)
+		loans, err := q.ListLibraryMemberLoans(ctx, tid, studentID, employeeID, true)
+		if err != nil {
+			return err
+		}
+		for _, l := range loans {
+			if l.BookID == bid {
+				return fmt.Errorf("%w: %s already has this book", ErrInvalidCirculation, m.Name)
+			}
+		}
+		res, err = q.CreateLibraryReservation(ctx, tid, bid, studentID, employeeID, parseUserUUID(actor.UserID))
+		if isUniqueViolation(err) {
+			return ErrAlreadyReserved
+		}
+		if err != nil {
+			return err
+		}
+		c, err := q.FirstAvailableLibraryBookCopy(ctx, tid, bid)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		settings, err := s.settings(ctx, q, tid)
+		if err != nil {
+			return err
+		}
+		if _, err := s.passOn(ctx, q, tid, bid, c.ID, settings); err != nil {
+			return err
+		}
+		if _, err := q.SyncLibraryBookCounts(ctx, tid, bid); err != nil {
+			return err
+		}
+		res, err = q.GetLibraryReservation(ctx, tid, res.ID)
+		return err
+	})
+	if err != nil {
+		return res, err
+	}
+	s.log(ctx, tid, actor, "RESERVE_BOOK", "library_reservation", res.ID, map[string]any{
+		"book_id": bookID, "student_id": ref.StudentID, "employee_id": ref.EmployeeID,
+	})
+	return res, nil
+}
+
+type ReservationFilter struct {
+	BookID   string
+	Member   MemberRef
+	OpenOnly bool
+}
+
+func (s *CirculationService) ListReservations(ctx context.Context, tenantID string, f ReservationFilter) ([]db.LibraryReservation, error) {
+	return s.q.ListLibraryReservations(ctx, db.ListLibraryReservationsParams{
+		TenantID:   toPgUUID(tenantID),
+		BookID:     toPgUUID(f.BookID),
+		StudentID:  toPgUUID(f.Member.StudentID),
+		EmployeeID: toPgUUID(f.Member.EmployeeID),
+		OpenOnly:   f.OpenOnly,
+	})
+}
+
+// CancelReservation withdraws a member from the queue. A copy held for them
+// goes to the next in line.
+func (s *CirculationService) CancelReservation(ctx context.Context, tenantID, reservationID string, actor Actor) (db.LibraryReservation, error) {
+	res, err := s.closeReservation(ctx, toPgUUID(tenantID), toPgUUID(reservationID), "cancelled", false)
+	if err != nil {
+		return res, err
+	}
+	s.log(ctx, res.TenantID, actor, "CANCEL_RESERVATION", "library_reservation", res.ID, nil)
+	return res, nil
+}
+
+func (s *CirculationService) closeReservation(ctx context.Context, tid, rid pgtype.UUID, status string, onlyExpired bool) (db.LibraryReservation, error) {
+	res, err := s.q.GetLibraryReservation(ctx, tid, rid)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return res, ErrReservationNotFound
+	}
+	if err != nil {
+		return res, err
+	}
+	err = s.inTx(ctx, func(q *db.Queries) error {
+		if _, err := q.LockLibraryBook(ctx, tid, res.BookID); err != nil {
+			return err
+		}
+		if res, err = q.GetLibraryReservation(ctx, tid, rid); err != nil {
+			return err
+		}
+		if res.Status != "waiting" && res.Status != "ready" {
+			return fmt.Errorf("%w: the reservation is %s", ErrInvalidCirculation, res.Status)
+		}
+		if onlyExpired && (res.Status != "ready" || !res.HoldUntil.Time.Before(time.Now())) {
+			return errHoldNotExpired
+		}
+		wasHeld := res.Status == "ready" && res.CopyID.Valid
+		if res, err = q.CloseLibraryReservation(ctx, tid, rid, status, pgtype.UUID{}); err != nil {
+			return err
+		}
+		if !wasHeld {
+			return nil
+		}
+		settings, err := s.settings(ctx, q, tid)
+		if err != nil {
+			return err
+		}
+		if _, err := s.passOn(ctx, q, tid, res.BookID, res.CopyID, settings); err != nil {
+			return err
+		}
+		_, err = q.SyncLibraryBookCounts(ctx, tid, res.BookID)
+		return err
+	})
+	return res, err
+}
+
+var errHoldNotExpired = errors.New("hold not expired")
+
+// StartHoldExpiryWorker releases holds nobody collected in time.
+func (s *CirculationService) StartHoldExpiryWorker(ctx context.Context) {
+	ticker := time.NewTicker(holdCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.ExpireHolds(ctx)
+		}
+	}
+}
+
+// ExpireHolds closes holds past their pickup window and passes each copy
+// to the next member waiting, or back to the shelf.
+func (s *CirculationService) ExpireHolds(ctx context.Context) {
+	holds, err := s.q.ListExpiredLibraryHolds(ctx, 200)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to list expired library holds")
+		return
+	}
+	for _, h := range holds {
+		_, err := s.closeReservation(ctx, h.TenantID, h.ID, "expired", true)
+		if err != nil && !errors.Is(err, errHoldNotExpired) && !errors.Is(err, ErrInvalidCirculation) {
+			log.Error().Err(err).Str("reservation_id", h.ID.String()).Msg("failed to expire library hold")
+		}
+	}
+}
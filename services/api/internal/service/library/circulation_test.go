@@ -0,0 +1,112 @@
+package library
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/schoolerp/api/internal/db"
+)
+
+func TestFormatAccession(t *testing.T) {
+	if got := formatAccession("ACC", 42); got != "ACC000042" {
+		t.Fatalf("got %q", got)
+	}
+	if got := formatAccession("LIB-", 1234567); got != "LIB-1234567" {
+		t.Fatalf("got %q", got)
+	}
+}
+
+func TestAddCopiesInputNormalize(t *testing.T) {
+	barcodes, err := AddCopiesInput{Count: 3}.normalize()
+	if err != nil || len(barcodes) != 3 || barcodes[0] != "" {
+		t.Fatalf("expected three blank barcodes, got %q %v", barcodes, err)
+	}
+	barcodes, err = AddCopiesInput{Barcodes: []string{" B1 ", "B2"}}.normalize()
+	if err != nil || barcodes[0] != "B1" || barcodes[1] != "B2" {
+		t.Fatalf("expected trimmed barcodes, got %q %v", barcodes, err)
+	}
+
+	bad := []AddCopiesInput{
+		{},
+		{Count: maxCopiesPerBatch + 1},
+		{Count: 3, Barcodes: []string{"B1", "B2"}},
+		{Barcodes: []string{"B1", " "}},
+		{Barcodes: []string{"B1", "B1"}},
+	}
+	for _, in := range bad {
+		if _, err := in.normalize(); !errors.Is(err, ErrInvalidCirculation) {
+			t.Fatalf("expected %+v to be rejected, got %v", in, err)
+		}
+	}
+}
+
+func TestCopyTransitionAllowed(t *testing.T) {
+	cases := []struct {
+		from, to string
+		want     bool
+	}{
+		{copyAvailable, copyDamaged, true},
+		{copyDamaged, copyAvailable, true},
+		{copyLost, copyAvailable, true},
+		{copyAvailable, copyWithdrawn, true},
+		{copyIssued, copyLost, true},
+		{copyIssued, copyAvailable, false},
+		{copyIssued, copyWithdrawn, false},
+		{copyOnHold, copyLost, false},
+		{copyAvailable, copyIssued, false},
+		{copyAvailable, copyOnHold, false},
+		{copyAvailable, "borrowed", false},
+	}
+	for _, c := range cases {
+		if got := copyTransitionAllowed(c.from, c.to); got != c.want {
+			t.Fatalf("%s -> %s: got %v, want %v", c.from, c.to, got, c.want)
+		}
+	}
+}
+
+func TestCheckRenewal(t *testing.T) {
+	now := time.Date(2026, 10, 10, 9, 0, 0, 0, time.UTC)
+	due := pgtype.Timestamptz{Time: now.AddDate(0, 0, 3), Valid: true}
+	policy := db.LibraryMemberPolicy{LoanDays: 14, MaxBooks: 2, MaxRenewals: 1}
+
+	loan := db.LibraryLoan{Status: "issued", DueDate: due}
+	if err := checkRenewal(loan, policy, 0, now); err != nil {
+		t.Fatalf("unexpected refusal: %v", err)
+	}
+
+	refused := map[string]struct {
+		loan    db.LibraryLoan
+		waiting int
+	}{
+		"limit reached": {db.LibraryLoan{Status: "issued", DueDate: due, RenewalCount: 1}, 0},
+		"overdue":       {db.LibraryLoan{Status: "issued", DueDate: pgtype.Timestamptz{Time: now.AddDate(0, 0, -1), Valid: true}}, 0},
+		"queue":         {loan, 2},
+		"returned":      {db.LibraryLoan{Status: "returned", DueDate: due}, 0},
+	}
+	for name, c := range refused {
+		if err := checkRenewal(c.loan, policy, c.waiting, now); !errors.Is(err, ErrRenewalRefused) {
+			t.Fatalf("%s: expected a refusal, got %v", name, err)
+		}
+	}
+}
+
+func TestPolicyInputValidate(t *testing.T) {
+	ok := PolicyInput{MemberType: memberStudent, ClassID: "c", LoanDays: 7, MaxBooks: 1}
+	if err := ok.validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	bad := []PolicyInput{
+		{MemberType: "parent", LoanDays: 7, MaxBooks: 1},
+		{MemberType: memberStaff, ClassID: "c", LoanDays: 7, MaxBooks: 1},
+		{MemberType: memberStudent, LoanDays: 0, MaxBooks: 1},
+		{MemberType: memberStudent, LoanDays: 7, MaxBooks: -1},
+		{MemberType: memberStudent, LoanDays: 7, MaxBooks: 1, MaxRenewals: 11},
+	}
+	for _, in := range bad {
+		if err := in.validate(); !errors.Is(err, ErrInvalidCirculation) {
+			t.Fatalf("expected %+v to be rejected, got %v", in, err)
+		}
+	}
+}
@@ -0,0 +1,599 @@
+package library
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/schoolerp/api/internal/db"
+)
+
+var (
+	ErrFineNotFound       = errors.New("fine not found")
+	ErrFinePolicyNotFound = errors.New("fine policy not found")
+	ErrFineState          = errors.New("fine cannot be changed in its current state")
+)
+
+const (
+	fineOverdue = "overdue"
+	fineLost    = "lost"
+	fineDamaged = "damaged"
+
+	fineOpen            = "open"
+	fineWaiverRequested = "waiver_requested"
+	finePosted          = "posted"
+	finePaid            = "paid"
+	fineWaived          = "waived"
+
+	fineChargeSource = "library"
+	dateLayout       = "2006-01-02"
+)
+
+// defaultFinePolicy applies until the school saves fine policies of its
+// own: one rupee a day, school holidays free, the full price for a lost
+// book and half of it for a damaged one.
+var defaultFinePolicy = db.LibraryFinePolicy{PerDay: 100, SkipHolidays: true, LostPercent: 100, DamagePercent: 50}
+
+// Working out fines
+
+// chargeableDays counts the whole days a loan ran past its due date, and
+// of those the days that are charged: days in the grace period, Sundays
+// and holidays are free when the policy says so.
+func chargeableDays(due, at time.Time, p db.LibraryFinePolicy, holidays map[string]bool) (late, charged int) {
+	if !at.After(due) {
+		return 0, 0
+	}
+	late = int(at.Sub(due).Hours() / 24)
+	for k := int(p.GraceDays) + 1; k <= late; k++ {
+		day := due.AddDate(0, 0, k)
+		if p.SkipSundays && day.Weekday() == time.Sunday {
+			continue
+		}
+		if p.SkipHolidays && holidays[day.Format(dateLayout)] {
+			continue
+		}
+		charged++
+	}
+	return late, charged
+}
+
+// overdueAmount prices the charged days, capped at the policy's maximum.
+func overdueAmount(p db.LibraryFinePolicy, charged int) int64 {
+	amount := int64(charged) * p.PerDay
+	if p.MaxFine.Valid && amount > p.MaxFine.Int64 {
+		amount = p.MaxFine.Int64
+	}
+	return amount
+}
+
+// replacementCharge prices a lost or damaged copy from the book's price.
+// A lost copy costs at least the policy minimum, plus the processing fee.
+func replacementCharge(p db.LibraryFinePolicy, kind string, price int64) int64 {
+	switch kind {
+	case fineLost:
+		return max(price*int64(p.LostPercent)/100, p.LostMinimum) + p.ProcessingFee
+	case fineDamaged:
+		return price * int64(p.DamagePercent) / 100
+	}
+	return 0
+}
+
+func (s *CirculationService) finePolicy(ctx context.Context, q *db.Queries, tid pgtype.UUID, memberType string, bookID pgtype.UUID) (db.LibraryFinePolicy, error) {
+	p, err := q.ResolveLibraryFinePolicy(ctx, tid, memberType, bookID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		p = defaultFinePolicy
+		p.MemberType = memberType
+		return p, nil
+	}
+	return p, err
+}
+
+// closedDays returns the school's public and local holidays between two
+// dates. Restricted holidays are optional and do not close the library.
+func closedDays(ctx context.Context, q *db.Queries, tid pgtype.UUID, from, to time.Time) (map[string]bool, error) {
+	holidays, err := q.ListHolidays(ctx, db.ListHolidaysParams{
+		TenantID:      tid,
+		HolidayDate:   pgtype.Date{Time: from, Valid: true},
+		HolidayDate_2: pgtype.Date{Time: to, Valid: true},
+	})
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]bool, len(holidays))
+	for _, h := range holidays {
+		if h.HolidayType == "restricted" {
+			continue
+		}
+		out[h.HolidayDate.Time.Format(dateLayout)] = true
+	}
+	return out, nil
+}
+
+// raiseFines charges a loan that is being closed at the given time: the
+// overdue fine and, for a lost or damaged copy, its replacement charge. It
+// returns the total charged in paise.
+func (s *CirculationService) raiseFines(ctx context.Context, q *db.Queries, tid pgtype.UUID, loan db.LibraryLoan, at time.Time, kind string, actor Actor) (int64, error) {
+	memberType := memberStudent
+	if loan.EmployeeID.Valid {
+		memberType = memberStaff
+	}
+	p, err := s.finePolicy(ctx, q, tid, memberType, loan.BookID)
+	if err != nil {
+		return 0, err
+	}
+	create := func(kind string, amount int64, details map[string]any) error {
+		body, err := json.Marshal(details)
+		if err != nil {
+			return err
+		}
+		_, err = q.CreateLibraryFine(ctx, db.CreateLibraryFineParams{
+			TenantID:   tid,
+			IssueID:    loan.ID,
+			StudentID:  loan.StudentID,
+			EmployeeID: loan.EmployeeID,
+			Kind:       kind,
+			Amount:     amount,
+			Details:    body,
+			CreatedBy:  parseUserUUID(actor.UserID),
+		})
+		return err
+	}
+
+	var total int64
+	if loan.DueDate.Valid && at.After(loan.DueDate.Time) {
+		var holidays map[string]bool
+		if p.SkipHolidays {
+			if holidays, err = closedDays(ctx, q, tid, loan.DueDate.Time, at); err != nil {
+				return 0, err
+			}
+		}
+		late, charged := chargeableDays(loan.DueDate.Time, at, p, holidays)
+		if amount := overdueAmount(p, charged); amount > 0 {
+			if err := create(fineOverdue, amount, map[string]any{
+				"due_date":        loan.DueDate.Time.Format(dateLayout),
+				"days_late":       late,
+				"chargeable_days": charged,
+				"per_day":         p.PerDay,
+				"grace_days":      p.GraceDays,
+			}); err != nil {
+				return 0, err
+			}
+			total += amount
+		}
+	}
+	if kind == fineLost || kind == fineDamaged {
+		price, err := q.GetLibraryBookPrice(ctx, tid, loan.BookID)
+		if err != nil {
+			return 0, err
+		}
+		if amount := replacementCharge(p, kind, price); amount > 0 {
+			if err := create(kind, amount, map[string]any{
+				"price":          price,
+				"lost_percent":   p.LostPercent,
+				"damage_percent": p.DamagePercent,
+				"processing_fee": p.ProcessingFee,
+			}); err != nil {
+				return 0, err
+			}
+			total += amount
+		}
+	}
+	return total, nil
+}
+
+// fineNumeric converts paise to the rupee amount kept on the issue row.
+func fineNumeric(paise int64) pgtype.Numeric {
+	var n pgtype.Numeric
+	_ = n.Scan(fmt.Sprintf("%d.%02d", paise/100, paise%100))
+	return n
+}
+
+// Fine policies
+
+func (s *CirculationService) ListFinePolicies(ctx context.Context, tenantID string) ([]db.LibraryFinePolicy, error) {
+	return s.q.ListLibraryFinePolicies(ctx, toPgUUID(tenantID))
+}
+
+type FinePolicyInput struct {
+	MemberType    string
+	CategoryID    string
+	PerDay        int64
+	GraceDays     int32
+	MaxFine       *int64
+	SkipHolidays  bool
+	SkipSundays   bool
+	LostPercent   int32
+	LostMinimum   int64
+	ProcessingFee int64
+	DamagePercent int32
+}
+
+func (in FinePolicyInput) validate() error {
+	switch {
+	case in.MemberType != memberStudent && in.MemberType != memberStaff:
+		return fmt.Errorf("%w: member_type must be student or staff", ErrInvalidCirculation)
+	case in.PerDay < 0 || in.LostMinimum < 0 || in.ProcessingFee < 0 || (in.MaxFine != nil && *in.MaxFine < 0):
+		return fmt.Errorf("%w: amounts cannot be negative", ErrInvalidCirculation)
+	case in.GraceDays < 0 || in.GraceDays > 60:
+		return fmt.Errorf("%w: grace_days must be between 0 and 60", ErrInvalidCirculation)
+	case in.LostPercent < 0 || in.LostPercent > 500 || in.DamagePercent < 0 || in.DamagePercent > 500:
+		return fmt.Errorf("%w: lost_percent and damage_percent must be between 0 and 500", ErrInvalidCirculation)
+	}
+	return nil
+}
+
+// SaveFinePolicy sets the fine rules for a member type, or for one book
+// category borrowed by that member type.
+func (s *CirculationService) SaveFinePolicy(ctx context.Context, tenantID string, in FinePolicyInput, actor Actor) (db.LibraryFinePolicy, error) {
+	in.CategoryID = strings.TrimSpace(in.CategoryID)
+	if err := in.validate(); err != nil {
+		return db.LibraryFinePolicy{}, err
+	}
+	tid := toPgUUID(tenantID)
+	arg := db.LibraryFinePolicy{
+		TenantID:      tid,
+		MemberType:    in.MemberType,
+		CategoryID:    toPgUUID(in.CategoryID),
+		PerDay:        in.PerDay,
+		GraceDays:     in.GraceDays,
+		SkipHolidays:  in.SkipHolidays,
+		SkipSundays:   in.SkipSundays,
+		LostPercent:   in.LostPercent,
+		LostMinimum:   in.LostMinimum,
+		ProcessingFee: in.ProcessingFee,
+		DamagePercent: in.DamagePercent,
+	}
+	if in.MaxFine != nil {
+		arg.MaxFine = pgtype.Int8{Int64: *in.MaxFine, Valid: true}
+	}
+	p, err := s.q.UpsertLibraryFinePolicy(ctx, arg)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return p, fmt.Errorf("%w: category not found", ErrInvalidCirculation)
+	}
+	if err != nil {
+		return p, err
+	}
+	s.log(ctx, tid, actor, "SAVE_LIBRARY_FINE_POLICY", "library_fine_policy", p.ID, p)
+	return p, nil
+}
+
+func (s *CirculationService) DeleteFinePolicy(ctx context.Context, tenantID, policyID string, actor Actor) error {
+	tid, pid := toPgUUID(tenantID), toPgUUID(policyID)
+	err := s.q.DeleteLibraryFinePolicy(ctx, tid, pid)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrFinePolicyNotFound
+	}
+	if err != nil {
+		return err
+	}
+	s.log(ctx, tid, actor, "DELETE_LIBRARY_FINE_POLICY", "library_fine_policy", pid, nil)
+	return nil
+}
+
+// Fines
+
+type FineFilter struct {
+	Member  MemberRef
+	IssueID string
+	Status  string
+}
+
+func (s *CirculationService) ListFines(ctx context.Context, tenantID string, f FineFilter) ([]db.LibraryFine, error) {
+	arg := db.ListLibraryFinesParams{
+		TenantID:   toPgUUID(tenantID),
+		StudentID:  toPgUUID(f.Member.StudentID),
+		EmployeeID: toPgUUID(f.Member.EmployeeID),
+		IssueID:    toPgUUID(f.IssueID),
+	}
+	if status := strings.TrimSpace(f.Status); status != "" {
+		arg.Statuses = []string{status}
+	}
+	return s.q.ListLibraryFines(ctx, arg)
+}
+
+func (s *CirculationService) GetFine(ctx context.Context, tenantID, fineID string) (db.LibraryFine, error) {
+	fine, err := s.q.GetLibraryFine(ctx, toPgUUID(tenantID), toPgUUID(fineID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fine, ErrFineNotFound
+	}
+	return fine, err
+}
+
+func (s *CirculationService) lockFine(ctx context.Context, q *db.Queries, tid, fid pgtype.UUID) (db.LibraryFine, error) {
+	fine, err := q.LockLibraryFine(ctx, tid, fid)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fine, ErrFineNotFound
+	}
+	return fine, err
+}
+
+// RequestWaiver asks for part or all of a fine to be let off. The request
+// goes to the approvals inbox; the fine stays as it is until it is decided.
+// An amount of zero asks for everything still outstanding.
+func (s *CirculationService) RequestWaiver(ctx context.Context, tenantID, fineID string, amount int64, reason string, actor Actor) (db.LibraryFine, error) {
+	if s.approvals == nil {
+		return db.LibraryFine{}, errors.New("approval workflow is not configured")
+	}
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return db.LibraryFine{}, fmt.Errorf("%w: a reason is required", ErrInvalidCirculation)
+	}
+	tid, fid := toPgUUID(tenantID), toPgUUID(fineID)
+	var fine db.LibraryFine
+	err := s.inTx(ctx, func(q *db.Queries) error {
+		var err error
+		if fine, err = s.lockFine(ctx, q, tid, fid); err != nil {
+			return err
+		}
+		if fine.Status != fineOpen && fine.Status != finePosted {
+			return fmt.Errorf("%w: the fine is %s", ErrFineState, fine.Status)
+		}
+		if amount == 0 {
+			amount = fine.Outstanding
+		}
+		if amount < 0 || amount > fine.Outstanding {
+			return fmt.Errorf("%w: amount must be between 1 and the %d paise outstanding", ErrInvalidCirculation, fine.Outstanding)
+		}
+		req, err := s.approvals.CreateRequest(ctx, tenantID, actor.UserID, "library", "fine_waiver", fineID, map[string]any{
+			"fine_id":      fineID,
+			"kind":         fine.Kind,
+			"book_title":   fine.BookTitle,
+			"student_name": fine.MemberName.String,
+			"amount":       float64(amount) / 100,
+			"amount_paise": amount,
+			"reason":       reason,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create approval request: %w", err)
+		}
+		fine, err = q.RequestLibraryFineWaiver(ctx, tid, fid, amount, reason, req.ID)
+		return err
+	})
+	if err != nil {
+		return fine, err
+	}
+	s.log(ctx, tid, actor, "REQUEST_FINE_WAIVER", "library_fine", fid, map[string]any{
+		"amount": amount, "reason": reason, "approval_request_id": fine.WaiverRequestID.String(),
+	})
+	return fine, nil
+}
+
+// DecideWaiver approves or rejects a fine's pending waiver. A decision
+// already taken in the approvals inbox is applied as it stands. An
+// approved waiver reduces the fine and, when the fine is on the fee
+// ledger, its charge; a fully waived charge is taken off the ledger.
+func (s *CirculationService) DecideWaiver(ctx context.Context, tenantID, fineID string, approve bool, remark string, actor Actor) (db.LibraryFine, error) {
+	if s.approvals == nil {
+		return db.LibraryFine{}, errors.New("approval workflow is not configured")
+	}
+	decision := "rejected"
+	if approve {
+		decision = "approved"
+	}
+	tid, fid := toPgUUID(tenantID), toPgUUID(fineID)
+	var fine db.LibraryFine
+	err := s.inTx(ctx, func(q *db.Queries) error {
+		var err error
+		if fine, err = s.lockFine(ctx, q, tid, fid); err != nil {
+			return err
+		}
+		if fine.Status != fineWaiverRequested || !fine.WaiverRequestID.Valid {
+			return fmt.Errorf("%w: the fine has no pending waiver", ErrFineState)
+		}
+		req, err := q.GetApprovalRequest(ctx, fine.WaiverRequestID)
+		if err != nil {
+			return fmt.Errorf("failed to load approval request: %w", err)
+		}
+		if req.TenantID != tid {
+			return ErrFineNotFound
+		}
+		switch req.Status.String {
+		case "pending":
+			if approve && req.RequesterID == parseUserUUID(actor.UserID) {
+				return fmt.Errorf("%w: a waiver cannot be approved by the person who asked for it", ErrFineState)
+			}
+			if _, err := s.approvals.ProcessRequest(ctx, req.ID.String(), decision, strings.TrimSpace(remark)); err != nil {
+				return fmt.Errorf("failed to record decision: %w", err)
+			}
+		case decision:
+		default:
+			return fmt.Errorf("%w: the waiver was already %s", ErrFineState, req.Status.String)
+		}
+
+		prior := fineOpen
+		if fine.FeeChargeID.Valid {
+			prior = finePosted
+		}
+		if !approve {
+			fine, err = q.SettleLibraryFineWaiver(ctx, tid, fid, prior, fine.WaivedAmount)
+			return err
+		}
+		waived := min(fine.WaivedAmount+fine.WaiverAmount.Int64, fine.Amount)
+		status := prior
+		if waived == fine.Amount {
+			status = fineWaived
+		}
+		if fine.FeeChargeID.Valid {
+			if err := s.repostCharge(ctx, q, tid, fine.FeeChargeID, fine.Amount-waived); err != nil {
+				return err
+			}
+		}
+		fine, err = q.SettleLibraryFineWaiver(ctx, tid, fid, status, waived)
+		return err
+	})
+	if err != nil {
+		return fine, err
+	}
+	action := "REJECT_FINE_WAIVER"
+	if approve {
+		action = "APPROVE_FINE_WAIVER"
+	}
+	s.log(ctx, tid, actor, action, "library_fine", fid, map[string]any{
+		"waived_amount": fine.WaivedAmount, "status": fine.Status, "remark": remark,
+	})
+	return fine, nil
+}
+
+// repostCharge brings a fine's ledger charge down to what is still owed,
+// cancelling it when nothing is.
+func (s *CirculationService) repostCharge(ctx context.Context, q *db.Queries, tid, chargeID pgtype.UUID, outstanding int64) error {
+	if outstanding <= 0 {
+		_, err := q.CancelStudentFeeCharge(ctx, tid, chargeID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil // already off the ledger
+		}
+		return err
+	}
+	charge, err := q.GetStudentFeeCharge(ctx, tid, chargeID)
+	if err != nil {
+		return err
+	}
+	_, err = q.UpdateStudentFeeCharge(ctx, db.UpdateStudentFeeChargeParams{
+		TenantID:    tid,
+		ID:          charge.ID,
+		FeeHeadID:   charge.FeeHeadID,
+		Description: charge.Description,
+		Amount:      outstanding,
+		DueDate:     charge.DueDate,
+	})
+	return err
+}
+
+type PostFinesInput struct {
+	StudentID string
+	// FineIDs limits posting to these fines; otherwise every open fine of
+	// the student, or of all students, is posted.
+	FineIDs []string
+}
+
+type PostFinesResult struct {
+	Posted  []db.LibraryFine `json:"posted"`
+	Skipped int              `json:"skipped"`
+	Total   int64            `json:"total"`
+}
+
+func fineDescription(f db.LibraryFine) string {
+	label := map[string]string{fineOverdue: "overdue fine", fineLost: "lost book charge", fineDamaged: "damaged book charge"}[f.Kind]
+	return fmt.Sprintf("Library %s: %s", label, f.BookTitle)
+}
+
+// PostFines puts students' open fines on their fee ledgers, one charge per
+// fine, so they are paid through a fee receipt. Staff fines, and fines
+// that are waived, paid, posted or awaiting a waiver, are skipped.
+func (s *CirculationService) PostFines(ctx context.Context, tenantID string, in PostFinesInput, actor Actor) (PostFinesResult, error) {
+	tid := toPgUUID(tenantID)
+	settings, err := s.settings(ctx, s.q, tid)
+	if err != nil {
+		return PostFinesResult{}, err
+	}
+	if !settings.FineFeeHeadID.Valid {
+		return PostFinesResult{}, fmt.Errorf("%w: choose the fee head for library fines in the library settings first", ErrInvalidCirculation)
+	}
+	var yearID pgtype.UUID
+	if year, err := s.q.GetActiveAcademicYear(ctx, tid); err == nil {
+		yearID = year.ID
+	} else if !errors.Is(err, pgx.ErrNoRows) {
+		return PostFinesResult{}, err
+	}
+
+	var ids []pgtype.UUID
+	if len(in.FineIDs) > 0 {
+		for _, id := range in.FineIDs {
+			ids = append(ids, toPgUUID(id))
+		}
+	} else {
+		open, err := s.q.ListLibraryFines(ctx, db.ListLibraryFinesParams{
+			TenantID:  tid,
+			StudentID: toPgUUID(in.StudentID),
+			Statuses:  []string{fineOpen},
+		})
+		if err != nil {
+			return PostFinesResult{}, err
+		}
+		for _, f := range open {
+			ids = append(ids, f.ID)
+		}
+	}
+
+	now := time.Now()
+	result := PostFinesResult{Posted: []db.LibraryFine{}}
+	err = s.inTx(ctx, func(q *db.Queries) error {
+		for _, id := range ids {
+			fine, err := s.lockFine(ctx, q, tid, id)
+			if err != nil {
+				return err
+			}
+			if fine.Status != fineOpen || !fine.StudentID.Valid || fine.Outstanding <= 0 {
+				result.Skipped++
+				continue
+			}
+			details, err := json.Marshal(map[string]any{
+				"fine_id":          fine.ID.String(),
+				"issue_id":         fine.IssueID.String(),
+				"kind":             fine.Kind,
+				"book_title":       fine.BookTitle,
+				"accession_number": fine.AccessionNumber.String,
+			})
+			if err != nil {
+				return err
+			}
+			charge, err := q.PostStudentFeeCharge(ctx, db.PostStudentFeeChargeParams{
+				TenantID:       tid,
+				StudentID:      fine.StudentID,
+				Source:         fineChargeSource,
+				SourceKey:      fine.ID.String(),
+				Period:         pgtype.Text{String: now.Format("2006-01"), Valid: true},
+				FeeHeadID:      settings.FineFeeHeadID,
+				AcademicYearID: yearID,
+				Description:    fineDescription(fine),
+				Amount:         fine.Outstanding,
+				DueDate:        pgtype.Date{Time: now, Valid: true},
+				Details:        details,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to post fine %s: %w", fine.ID.String(), err)
+			}
+			if fine, err = q.MarkLibraryFinePosted(ctx, tid, fine.ID, charge.ID); err != nil {
+				return err
+			}
+			result.Posted = append(result.Posted, fine)
+			result.Total += charge.Amount
+		}
+		return nil
+	})
+	if err != nil {
+		return PostFinesResult{}, err
+	}
+	s.log(ctx, tid, actor, "POST_LIBRARY_FINES", "library_fine", pgtype.UUID{}, map[string]any{
+		"posted": len(result.Posted), "skipped": result.Skipped, "total": result.Total,
+	})
+	return result, nil
+}
+
+// CollectFine records a fine paid at the library desk. Fines on the fee
+// ledger are paid through a fee receipt instead.
+func (s *CirculationService) CollectFine(ctx context.Context, tenantID, fineID string, actor Actor) (db.LibraryFine, error) {
+	tid, fid := toPgUUID(tenantID), toPgUUID(fineID)
+	var fine db.LibraryFine
+	err := s.inTx(ctx, func(q *db.Queries) error {
+		var err error
+		if fine, err = s.lockFine(ctx, q, tid, fid); err != nil {
+			return err
+		}
+		if fine.Status != fineOpen {
+			return fmt.Errorf("%w: the fine is %s", ErrFineState, fine.Status)
+		}
+		fine, err = q.MarkLibraryFinePaid(ctx, tid, fid)
+		return err
+	})
+	if err != nil {
+		return fine, err
+	}
+	s.log(ctx, tid, actor, "COLLECT_LIBRARY_FINE", "library_fine", fid, map[string]any{"amount": fine.Outstanding})
+	return fine, nil
+}
@@ -0,0 +1,111 @@
+package library
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/schoolerp/api/internal/db"
+)
+
+func TestChargeableDays(t *testing.T) {
+	// Thursday noon.
+	due := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	policy := db.LibraryFinePolicy{PerDay: 100}
+
+	if late, charged := chargeableDays(due, due.Add(-time.Hour), policy, nil); late != 0 || charged != 0 {
+		t.Fatalf("expected nothing before the due date, got %d/%d", late, charged)
+	}
+	if late, charged := chargeableDays(due, due.Add(23*time.Hour), policy, nil); late != 0 || charged != 0 {
+		t.Fatalf("expected nothing within the first day, got %d/%d", late, charged)
+	}
+
+	// Returned the next Thursday: seven days late, Oct 2 to Oct 8.
+	at := due.AddDate(0, 0, 7).Add(time.Hour)
+	if late, charged := chargeableDays(due, at, policy, nil); late != 7 || charged != 7 {
+		t.Fatalf("expected seven charged days, got %d/%d", late, charged)
+	}
+
+	holidays := map[string]bool{"2026-10-02": true, "2026-10-06": true}
+	policy.SkipHolidays = true
+	if _, charged := chargeableDays(due, at, policy, holidays); charged != 5 {
+		t.Fatalf("expected holidays to be free, got %d", charged)
+	}
+	policy.SkipSundays = true
+	if _, charged := chargeableDays(due, at, policy, holidays); charged != 4 {
+		t.Fatalf("expected Sunday Oct 4 to be free too, got %d", charged)
+	}
+	policy.GraceDays = 3
+	if _, charged := chargeableDays(due, at, policy, holidays); charged != 3 {
+		t.Fatalf("expected Oct 5, 7 and 8 to be charged, got %d", charged)
+	}
+
+	policy.SkipHolidays = false
+	policy.SkipSundays = false
+	if _, charged := chargeableDays(due, at, policy, holidays); charged != 4 {
+		t.Fatalf("expected holidays to count when the policy says so, got %d", charged)
+	}
+}
+
+func TestOverdueAmount(t *testing.T) {
+	policy := db.LibraryFinePolicy{PerDay: 200}
+	if got := overdueAmount(policy, 6); got != 1200 {
+		t.Fatalf("expected 1200, got %d", got)
+	}
+	policy.MaxFine = pgtype.Int8{Int64: 1000, Valid: true}
+	if got := overdueAmount(policy, 6); got != 1000 {
+		t.Fatalf("expected the cap, got %d", got)
+	}
+	if got := overdueAmount(policy, 0); got != 0 {
+		t.Fatalf("expected nothing, got %d", got)
+	}
+}
+
+func TestReplacementCharge(t *testing.T) {
+	policy := db.LibraryFinePolicy{LostPercent: 150, LostMinimum: 20000, ProcessingFee: 5000, DamagePercent: 40}
+	if got := replacementCharge(policy, fineLost, 40000); got != 65000 {
+		t.Fatalf("expected 1.5x price plus fee, got %d", got)
+	}
+	if got := replacementCharge(policy, fineLost, 0); got != 25000 {
+		t.Fatalf("expected the minimum plus fee for an unpriced book, got %d", got)
+	}
+	if got := replacementCharge(policy, fineDamaged, 40000); got != 16000 {
+		t.Fatalf("expected 40%% of the price, got %d", got)
+	}
+	if got := replacementCharge(policy, fineOverdue, 40000); got != 0 {
+		t.Fatalf("expected no replacement charge for an overdue fine, got %d", got)
+	}
+}
+
+func TestFineNumeric(t *testing.T) {
+	got, err := fineNumeric(12345).Float64Value()
+	if err != nil || got.Float64 != 123.45 {
+		t.Fatalf("expected 123.45, got %v %v", got.Float64, err)
+	}
+	got, _ = fineNumeric(5).Float64Value()
+	if got.Float64 != 0.05 {
+		t.Fatalf("expected 0.05, got %v", got.Float64)
+	}
+}
+
+func TestFinePolicyInputValidate(t *testing.T) {
+	ok := FinePolicyInput{MemberType: memberStudent, PerDay: 100, LostPercent: 100, DamagePercent: 50}
+	if err := ok.validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	negative := int64(-1)
+	bad := []FinePolicyInput{
+		{MemberType: "parent", PerDay: 100},
+		{MemberType: memberStudent, PerDay: -1},
+		{MemberType: memberStudent, MaxFine: &negative},
+		{MemberType: memberStaff, GraceDays: 61},
+		{MemberType: memberStaff, LostPercent: 501},
+		{MemberType: memberStaff, DamagePercent: -1},
+	}
+	for _, in := range bad {
+		if err := in.validate(); !errors.Is(err, ErrInvalidCirculation) {
+			t.Fatalf("expected %+v to be rejected, got %v", in, err)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package library
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/schoolerp/api/internal/db"
+)
+
+var (
+	ErrInvalidISBN  = errors.New("invalid isbn")
+	ErrISBNNotFound = errors.New("isbn not found")
+)
+
+// isbnPattern picks the ISBN out of values such as "0-306-40615-2 (pbk.)".
+var isbnPattern = regexp.MustCompile(`[0-9][0-9\- ]{8,16}[0-9Xx]`)
+
+// normalizeISBN validates an ISBN-10 or ISBN-13, with or without hyphens,
+// and returns it as ISBN-13.
+func normalizeISBN(raw string) (string, error) {
+	match := isbnPattern.FindString(raw)
+	digits := strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(match))
+	switch len(digits) {
+	case 10:
+		sum := 0
+		for i, c := range digits {
+			var v int
+			switch {
+			case c >= '0' && c <= '9':
+				v = int(c - '0')
+			case c == 'X' && i == 9:
+				v = 10
+			default:
+				return "", fmt.Errorf("%w: %q", ErrInvalidISBN, raw)
+			}
+			sum += (10 - i) * v
+		}
+		if sum%11 != 0 {
+			return "", fmt.Errorf("%w: %q fails its check digit", ErrInvalidISBN, raw)
+		}
+		body := "978" + digits[:9]
+		return body + isbn13Check(body), nil
+	case 13:
+		if _, err := strconv.ParseUint(digits, 10, 64); err != nil || (digits[:3] != "978" && digits[:3] != "979") {
+			return "", fmt.Errorf("%w: %q", ErrInvalidISBN, raw)
+		}
+		if isbn13Check(digits[:12]) != digits[12:] {
+			return "", fmt.Errorf("%w: %q fails its check digit", ErrInvalidISBN, raw)
+		}
+		return digits, nil
+	}
+	return "", fmt.Errorf("%w: %q", ErrInvalidISBN, raw)
+}
+
+func isbn13Check(first12 string) string {
+	sum := 0
+	for i, c := range first12 {
+		w := 1
+		if i%2 == 1 {
+			w = 3
+		}
+		sum += w * int(c-'0')
+	}
+	return strconv.Itoa((10 - sum%10) % 10)
+}
+
+// isbnForms returns the ways an ISBN-13 may be stored: itself and, for
+// 978 numbers, the ISBN-10.
+func isbnForms(isbn13 string) []string {
+	forms := []string{isbn13}
+	if strings.HasPrefix(isbn13, "978") {
+		body := isbn13[3:12]
+		sum := 0
+		for i, c := range body {
+			sum += (10 - i) * int(c-'0')
+		}
+		check := (11 - sum%11) % 11
+		last := strconv.Itoa(check)
+		if check == 10 {
+			last = "X"
+		}
+		forms = append(forms, body+last)
+	}
+	return forms
+}
+
+// ISBNRecord is what a lookup found out about a title.
+type ISBNRecord struct {
+	ISBN          string   `json:"isbn"`
+	Title         string   `json:"title"`
+	Authors       []string `json:"authors,omitempty"`
+	Publisher     string   `json:"publisher,omitempty"`
+	PublishedYear int32    `json:"published_year,omitempty"`
+	Language      string   `json:"language,omitempty"`
+	Subjects      []string `json:"subjects,omitempty"`
+	// Source names where the record came from: catalogue, cache or an
+	// external source.
+	Source string `json:"source"`
+}
+
+// ISBNSource looks titles up by ISBN-13. It returns ErrISBNNotFound when it
+// does not know the number.
+type ISBNSource interface {
+	Name() string
+	LookupISBN(ctx context.Context, tenantID pgtype.UUID, isbn string) (ISBNRecord, error)
+}
+
+// catalogueSource finds the title in the school's own catalogue.
+type catalogueSource struct{ q *db.Queries }
+
+func (catalogueSource) Name() string { return "catalogue" }
+
+func (s catalogueSource) LookupISBN(ctx context.Context, tenantID pgtype.UUID, isbn string) (ISBNRecord, error) {
+	b, err := s.q.FindLibraryBookByISBN(ctx, tenantID, isbnForms(isbn))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ISBNRecord{}, ErrISBNNotFound
+	}
+	if err != nil {
+		return ISBNRecord{}, err
+	}
+	rec := ISBNRecord{
+		ISBN:          isbn,
+		Title:         b.Title,
+		Authors:       b.Authors,
+		Publisher:     b.Publisher.String,
+		PublishedYear: b.PublishedYear.Int32,
+		Language:      b.Language.String,
+	}
+	if b.CategoryName.Valid {
+		rec.Subjects = []string{b.CategoryName.String}
+	}
+	return rec, nil
+}
+
+// cacheSource returns records kept from imports and earlier lookups.
+type cacheSource struct{ q *db.Queries }
+
+func (cacheSource) Name() string { return "cache" }
+
+func (s cacheSource) LookupISBN(ctx context.Context, tenantID pgtype.UUID, isbn string) (ISBNRecord, error) {
+	r, err := s.q.GetLibraryISBNRecord(ctx, tenantID, isbn)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ISBNRecord{}, ErrISBNNotFound
+	}
+	if err != nil {
+		return ISBNRecord{}, err
+	}
+	return ISBNRecord{
+		ISBN:          r.ISBN,
+		Title:         r.Title,
+		Authors:       r.Authors,
+		Publisher:     r.Publisher.String,
+		PublishedYear: r.PublishedYear.Int32,
+		Language:      r.Language.String,
+		Subjects:      r.Subjects,
+	}, nil
+}
+
+// OpenLibrarySource looks titles up on openlibrary.org.
+type OpenLibrarySource struct {
+	Client  *http.Client
+	BaseURL string
+}
+
+func NewOpenLibrarySource() *OpenLibrarySource {
+	return &OpenLibrarySource{Client: &http.Client{Timeout: 5 * time.Second}, BaseURL: "https://openlibrary.org"}
+}
+
+func (*OpenLibrarySource) Name() string { return "openlibrary" }
+
+var yearPattern = regexp.MustCompile(`\b(1[5-9]|20)\d{2}\b`)
+
+func (s *OpenLibrarySource) LookupISBN(ctx context.Context, _ pgtype.UUID, isbn string) (ISBNRecord, error) {
+	requestURL := fmt.Sprintf("%s/api/books?bibkeys=ISBN:%s&format=json&jscmd=data", s.BaseURL, isbn)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, requestURL, nil)
+	if err != nil {
+		return ISBNRecord{}, err
+	}
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return ISBNRecord{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return ISBNRecord{}, fmt.Errorf("isbn lookup failed: %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return ISBNRecord{}, err
+	}
+	return parseOpenLibrary(body, isbn)
+}
+
+type openLibraryName struct {
+	Name string `json:"name"`
+}
+
+type openLibraryBook struct {
+	Title       string            `json:"title"`
+	Subtitle    string            `json:"subtitle"`
+	Authors     []openLibraryName `json:"authors"`
+	Publishers  []openLibraryName `json:"publishers"`
+	PublishDate string            `json:"publish_date"`
+	Subjects    []openLibraryName `json:"subjects"`
+}
+
+func parseOpenLibrary(body []byte, isbn string) (ISBNRecord, error) {
+	var payload map[string]openLibraryBook
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return ISBNRecord{}, err
+	}
+	book, ok := payload["ISBN:"+isbn]
+	if !ok || strings.TrimSpace(book.Title) == "" {
+		return ISBNRecord{}, ErrISBNNotFound
+	}
+	rec := ISBNRecord{ISBN: isbn, Title: strings.TrimSpace(book.Title)}
+	if sub := strings.TrimSpace(book.Subtitle); sub != "" {
+		rec.Title += ": " + sub
+	}
+	for _, a := range book.Authors {
+		if name := strings.TrimSpace(a.Name); name != "" {
+			rec.Authors = append(rec.Authors, name)
+		}
+	}
+	for _, p := range book.Publishers {
+		if name := strings.TrimSpace(p.Name); name != "" {
+			rec.Publisher = name
+			break
+		}
+	}
+	if year, err := strconv.Atoi(yearPattern.FindString(book.PublishDate)); err == nil {
+		rec.PublishedYear = int32(year)
+	}
+	for _, sub := range book.Subjects {
+		if name := strings.TrimSpace(sub.Name); name != "" && len(rec.Subjects) < 10 {
+			rec.Subjects = append(rec.Subjects, name)
+		}
+	}
+	return rec, nil
+}
@@ -2,14 +2,9 @@ package library
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
-	"net/http"
-	"regexp"
 	"strings"
-	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgtype"
@@ -19,18 +14,23 @@ import (
 )
 
 type LibraryService struct {
-	q          db.Querier
-	pool       *pgxpool.Pool
-	audit      *audit.Logger
-	finePerDay float64
+	q           db.Querier
+	pool        *pgxpool.Pool
+	audit       *audit.Logger
+	circulation *CirculationService
+	catalogue   *CatalogueService
 }
 
-func NewLibraryService(q db.Querier, pool *pgxpool.Pool, audit *audit.Logger) *LibraryService {
+// NewLibraryService builds the service. Lending goes through the
+// circulation service, which tracks individual copies; ISBN lookups go
+// through the catalogue service.
+func NewLibraryService(q db.Querier, pool *pgxpool.Pool, audit *audit.Logger, circulation *CirculationService, catalogue *CatalogueService) *LibraryService {
 	return &LibraryService{
-		q:          q,
-		pool:       pool,
-		audit:      audit,
-		finePerDay: 1.0, // Default $1 per day, can be externalized to DB/Config
+		q:           q,
+		pool:        pool,
+		audit:       audit,
+		circulation: circulation,
+		catalogue:   catalogue,
 	}
 }
 
@@ -59,75 +59,10 @@ func parseUserUUID(userID string) pgtype.UUID {
 	return uID
 }
 
-func (s *LibraryService) ISBNLookup(ctx context.Context, isbn string) (map[string]interface{}, error) {
-	normalizedISBN := strings.TrimSpace(isbn)
-	if normalizedISBN == "" {
-		return nil, errors.New("invalid isbn")
-	}
-
-	requestURL := fmt.Sprintf("https://openlibrary.org/api/books?bibkeys=ISBN:%s&format=json&jscmd=data", normalizedISBN)
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, requestURL, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	client := &http.Client{Timeout: 5 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("isbn lookup failed: %s", resp.Status)
-	}
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	var payload map[string]map[string]interface{}
-	if err := json.Unmarshal(body, &payload); err != nil {
-		return nil, err
-	}
-
-	key := "ISBN:" + normalizedISBN
-	book, ok := payload[key]
-	if !ok {
-		return nil, errors.New("isbn not found")
-	}
-
-	result := map[string]interface{}{}
-	title, _ := book["title"].(string)
-	if strings.TrimSpace(title) != "" {
-		result["title"] = strings.TrimSpace(title)
-	}
-
-	publisher := ""
-	if publishers, ok := book["publishers"].([]interface{}); ok {
-		for _, item := range publishers {
-			if row, ok := item.(map[string]interface{}); ok {
-				name, _ := row["name"].(string)
-				if strings.TrimSpace(name) != "" {
-					publisher = strings.TrimSpace(name)
-					break
-				}
-			}
-		}
-	}
-	if publisher != "" {
-		result["publisher"] = publisher
-	}
-
-	if publishDate, ok := book["publish_date"].(string); ok {
-		re := regexp.MustCompile(`\b(19|20)\d{2}\b`)
-		if year := re.FindString(publishDate); year != "" {
-			result["year"] = year
-		}
-	}
-
-	return result, nil
+// ISBNLookup finds a title by ISBN through the catalogue service, so the
+// school's catalogue and the local cache are tried before Open Library.
+func (s *LibraryService) ISBNLookup(ctx context.Context, tenantID, isbn string, offline bool) (ISBNRecord, error) {
+	return s.catalogue.LookupISBN(ctx, tenantID, isbn, offline)
 }
 
 func (s *LibraryService) CreateBook(ctx context.Context, p CreateBookParams) (db.LibraryBook, error) {
@@ -136,18 +71,16 @@ func (s *LibraryService) CreateBook(ctx context.Context, p CreateBookParams) (db
 
 	// Auto-fill from ISBN if title/publisher missing
 	if p.Title == "" && p.ISBN != "" {
-		if data, err := s.ISBNLookup(ctx, p.ISBN); err == nil {
-			if title, _ := data["title"].(string); strings.TrimSpace(title) != "" {
-				p.Title = strings.TrimSpace(title)
+		if rec, err := s.ISBNLookup(ctx, p.TenantID, p.ISBN, false); err == nil {
+			p.Title = rec.Title
+			if p.Publisher == "" {
+				p.Publisher = rec.Publisher
 			}
-			if publisher, _ := data["publisher"].(string); strings.TrimSpace(publisher) != "" {
-				p.Publisher = strings.TrimSpace(publisher)
+			if p.PublishedYear == 0 {
+				p.PublishedYear = rec.PublishedYear
 			}
-			if yearText, _ := data["year"].(string); len(yearText) == 4 {
-				var parsedYear int
-				if _, parseErr := fmt.Sscanf(yearText, "%d", &parsedYear); parseErr == nil && parsedYear > 0 {
-					p.PublishedYear = int32(parsedYear)
-				}
+			if p.Language == "" {
+				p.Language = rec.Language
 			}
 		}
 	}
@@ -192,6 +125,14 @@ func (s *LibraryService) CreateBook(ctx context.Context, p CreateBookParams) (db
 		}
 	}
 
+	actor := Actor{UserID: p.UserID, RequestID: p.RequestID, IP: p.IP}
+	if _, err := s.circulation.AddCopies(ctx, p.TenantID, book.ID.String(), AddCopiesInput{
+		Count:         int(p.TotalCopies),
+		ShelfLocation: p.ShelfLocation,
+	}, actor); err != nil {
+		return book, fmt.Errorf("book created but failed to add copies: %w", err)
+	}
+
 	_ = s.audit.Log(ctx, audit.Entry{
 		TenantID:     tenantUuid,
 		UserID:       parseUserUUID(p.UserID),
@@ -259,6 +200,31 @@ func (s *LibraryService) UpdateBook(ctx context.Context, tenantID, bookID string
 		return db.LibraryBook{}, fmt.Errorf("failed to update book: %w", err)
 	}
 
+	// Copies are the record of what the library holds: a higher total
+	// accessions the extra copies, and the counters are then re-read from
+	// the copies. Copies are removed by withdrawing them.
+	copies, err := s.circulation.ListCopies(ctx, tenantID, bookID)
+	if err != nil {
+		return book, err
+	}
+	held := 0
+	for _, c := range copies {
+		if c.Status != copyWithdrawn {
+			held++
+		}
+	}
+	if extra := int(p.TotalCopies) - held; extra > 0 {
+		if _, err := s.circulation.AddCopies(ctx, tenantID, bookID, AddCopiesInput{
+			Count:         extra,
+			ShelfLocation: p.ShelfLocation,
+		}, Actor{UserID: p.UserID, RequestID: p.RequestID, IP: p.IP}); err != nil {
+			return book, fmt.Errorf("book updated but failed to add copies: %w", err)
+		}
+	}
+	if book, err = s.circulation.q.SyncLibraryBookCounts(ctx, tID, bID); err != nil {
+		return book, err
+	}
+
 	// Update Author logic simplified: just re-create link if changed? 
 	// For MVP allow adding multiple? 
 	// Let's assume we just add the new author relationship if not exists.
@@ -288,161 +254,49 @@ func (s *LibraryService) UpdateBook(ctx context.Context, tenantID, bookID string
 // Issue Management
 
 type IssueBookParams struct {
-	TenantID  string
-	BookID    string
-	StudentID string
-	UserID    string
+	TenantID   string
+	BookID     string
+	CopyID     string
+	StudentID  string
+	EmployeeID string
+	UserID     string
+	// Days overrides the member's policy when positive.
 	Days      int
 	RequestID string
 	IP        string
 }
 
-func (s *LibraryService) IssueBook(ctx context.Context, p IssueBookParams) (db.LibraryIssue, error) {
-	if p.Days <= 0 {
-		p.Days = 14
-	}
-
-	tx, err := s.pool.Begin(ctx)
-	if err != nil {
-		return db.LibraryIssue{}, fmt.Errorf("failed to begin transaction: %w", err)
-	}
-	defer tx.Rollback(ctx)
-	qtx := db.New(tx)
-
-	// 1. Check Availability
-	tID := pgtype.UUID{}
-	tID.Scan(p.TenantID)
-	bID := pgtype.UUID{}
-	bID.Scan(p.BookID)
-	
-	book, err := qtx.GetBook(ctx, db.GetBookParams{ID: bID, TenantID: tID})
-	if err != nil {
-		return db.LibraryIssue{}, errors.New("book not found")
-	}
-	
-	if book.AvailableCopies <= 0 {
-		return db.LibraryIssue{}, errors.New("book not available")
-	}
-
-	// 2. Decrement Copies
-	copyID := pgtype.UUID{}
-	copyID.Scan(p.BookID)
-	if err := qtx.UpdateBookCopies(ctx, db.UpdateBookCopiesParams{
-		ID:              copyID,
-		AvailableCopies: -1,
-	}); err != nil {
-		return db.LibraryIssue{}, fmt.Errorf("failed to update copies: %w", err)
-	}
-
-	// 3. Create Issue Record
-	sID := pgtype.UUID{}
-	sID.Scan(p.StudentID)
-	uID := pgtype.UUID{}
-	uID.Scan(p.UserID)
-	
-	dueDate := time.Now().AddDate(0, 0, p.Days)
-	
-	issue, err := qtx.IssueBook(ctx, db.IssueBookParams{
-		TenantID:  tID,
-		BookID:    bID,
-		StudentID: sID,
-		UserID:    uID,
-		IssueDate: pgtype.Timestamptz{Time: time.Now(), Valid: true},
-		DueDate:   pgtype.Timestamptz{Time: dueDate, Valid: true},
-		Status:    "issued",
-	})
-	if err != nil {
-		return db.LibraryIssue{}, fmt.Errorf("failed to issue book: %w", err)
-	}
-
-	if err := tx.Commit(ctx); err != nil {
-		return db.LibraryIssue{}, fmt.Errorf("failed to commit issue transaction: %w", err)
-	}
-
-	_ = s.audit.Log(ctx, audit.Entry{
-		TenantID:     tID,
-		UserID:       uID,
-		RequestID:    p.RequestID,
-		Action:       "ISSUE_BOOK",
-		ResourceType: "library_issue",
-		ResourceID:   issue.ID,
-		After:        map[string]interface{}{"book_id": p.BookID, "student_id": p.StudentID},
-		IPAddress:    p.IP,
+// IssueBook lends a copy of a book to a student or staff member. See
+// CirculationService.Issue for how the copy is chosen.
+func (s *LibraryService) IssueBook(ctx context.Context, p IssueBookParams) (db.LibraryLoan, error) {
+	return s.circulation.Issue(ctx, IssueParams{
+		TenantID: p.TenantID,
+		BookID:   p.BookID,
+		CopyID:   p.CopyID,
+		Member:   MemberRef{StudentID: p.StudentID, EmployeeID: p.EmployeeID},
+		Days:     p.Days,
+		Actor:    Actor{UserID: p.UserID, RequestID: p.RequestID, IP: p.IP},
 	})
-
-	return issue, nil
 }
 
 type ReturnBookParams struct {
-	TenantID string
-	IssueID  string
-	UserID   string // Staff processing the return
-	Remarks  string
+	TenantID  string
+	IssueID   string
+	UserID    string // Staff processing the return
+	Remarks   string
+	Damaged   bool
+	RequestID string
+	IP        string
 }
 
-func (s *LibraryService) ReturnBook(ctx context.Context, p ReturnBookParams) (db.LibraryIssue, error) {
-	tx, err := s.pool.Begin(ctx)
-	if err != nil {
-		return db.LibraryIssue{}, fmt.Errorf("failed to begin transaction: %w", err)
-	}
-	defer tx.Rollback(ctx)
-	qtx := db.New(tx)
-
-	tID := pgtype.UUID{}
-	tID.Scan(p.TenantID)
-	iID := pgtype.UUID{}
-	iID.Scan(p.IssueID)
-
-	// 1. Fetch the Issue to get Due Date
-	issue, err := qtx.GetIssue(ctx, db.GetIssueParams{ID: iID, TenantID: tID})
-	if err != nil {
-		return db.LibraryIssue{}, fmt.Errorf("issue not found: %w", err)
-	}
-
-	if issue.Status == "returned" {
-		return issue, nil // Already returned
-	}
-
-	// 2. Calculate Fine
-	var fineAmount float64 = 0.0
-	now := time.Now()
-	if issue.DueDate.Valid && now.After(issue.DueDate.Time) {
-		daysOverdue := int(now.Sub(issue.DueDate.Time).Hours() / 24)
-		if daysOverdue > 0 {
-			fineAmount = float64(daysOverdue) * s.finePerDay
-		}
-	}
-
-	fineNumeric := pgtype.Numeric{}
-	fineNumeric.Scan(fmt.Sprintf("%.2f", fineAmount))
-
-	// 3. Update Issue
-	updatedIssue, err := qtx.ReturnBook(ctx, db.ReturnBookParams{
-		ID:         iID,
-		TenantID:   tID,
-		ReturnDate: pgtype.Timestamptz{Time: now, Valid: true},
-		FineAmount: fineNumeric,
-		Status:     "returned",
-		Remarks:    pgtype.Text{String: p.Remarks, Valid: p.Remarks != ""},
+func (s *LibraryService) ReturnBook(ctx context.Context, p ReturnBookParams) (db.LibraryLoan, error) {
+	return s.circulation.Return(ctx, ReturnParams{
+		TenantID: p.TenantID,
+		LoanID:   p.IssueID,
+		Damaged:  p.Damaged,
+		Remarks:  p.Remarks,
+		Actor:    Actor{UserID: p.UserID, RequestID: p.RequestID, IP: p.IP},
 	})
-	if err != nil {
-		return db.LibraryIssue{}, fmt.Errorf("failed to return book: %w", err)
-	}
-
-	// 4. Increment Copies
-	bID := issue.BookID
-	if err := qtx.UpdateBookCopies(ctx, db.UpdateBookCopiesParams{
-		ID:              bID,
-		AvailableCopies: 1,
-	}); err != nil {
-		return updatedIssue, fmt.Errorf("book returned but failed to update copies: %w", err)
-	}
-
-	if err := tx.Commit(ctx); err != nil {
-		return db.LibraryIssue{}, fmt.Errorf("failed to commit return transaction: %w", err)
-	}
-
-	return updatedIssue, nil
 }
 
 func (s *LibraryService) ListIssues(ctx context.Context, tenantID string, limit, offset int32) ([]db.ListIssuesRow, error) {
@@ -502,58 +356,48 @@ func (s *LibraryService) DeleteDigitalAsset(ctx context.Context, tenantID, id st
 	return s.q.DeleteDigitalAsset(ctx, uID)
 }
 
-func (s *LibraryService) ScanBookForIssue(ctx context.Context, p IssueBookParams, barcode string) (db.LibraryIssue, error) {
+// ScanBookForIssue issues the copy with the scanned barcode or accession
+// number. A title barcode from before copies were tracked issues any copy
+// of that title on the shelf.
+func (s *LibraryService) ScanBookForIssue(ctx context.Context, p IssueBookParams, barcode string) (db.LibraryLoan, error) {
+	c, err := s.circulation.CopyByBarcode(ctx, p.TenantID, barcode)
+	if err == nil {
+		p.CopyID = c.ID.String()
+		return s.IssueBook(ctx, p)
+	}
+	if !errors.Is(err, ErrCopyNotFound) {
+		return db.LibraryLoan{}, fmt.Errorf("lookup failed: %w", err)
+	}
+
 	tID := pgtype.UUID{}
 	tID.Scan(p.TenantID)
-	
 	book, err := s.q.GetBookByBarcode(ctx, db.GetBookByBarcodeParams{
 		Barcode:  pgtype.Text{String: barcode, Valid: true},
 		TenantID: tID,
 	})
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			return db.LibraryIssue{}, errors.New("book not found with this barcode")
+			return db.LibraryLoan{}, errors.New("book not found with this barcode")
 		}
-		return db.LibraryIssue{}, fmt.Errorf("lookup failed: %w", err)
+		return db.LibraryLoan{}, fmt.Errorf("lookup failed: %w", err)
 	}
 
 	p.BookID = book.ID.String()
 	return s.IssueBook(ctx, p)
 }
 
-func (s *LibraryService) ScanBookForReturn(ctx context.Context, tenantID, userID, barcode, remarks string) (db.LibraryIssue, error) {
-	tID := pgtype.UUID{}
-	tID.Scan(tenantID)
-	
-	book, err := s.q.GetBookByBarcode(ctx, db.GetBookByBarcodeParams{
-		Barcode:  pgtype.Text{String: barcode, Valid: true},
-		TenantID: tID,
-	})
-	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			return db.LibraryIssue{}, errors.New("book not found with this barcode")
-		}
-		return db.LibraryIssue{}, fmt.Errorf("lookup failed: %w", err)
-	}
-
-	// Find the active issue
-	issue, err := s.q.GetActiveIssueByBook(ctx, db.GetActiveIssueByBookParams{
-		BookID:   book.ID,
-		TenantID: tID,
-	})
+// ScanBookForReturn returns the loan of the copy with the scanned barcode or
+// accession number.
+func (s *LibraryService) ScanBookForReturn(ctx context.Context, p ReturnBookParams, barcode string) (db.LibraryLoan, error) {
+	loan, err := s.circulation.LoanByBarcode(ctx, p.TenantID, barcode)
 	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			return db.LibraryIssue{}, errors.New("no active issue found for this book")
+		if errors.Is(err, ErrCopyNotFound) {
+			return db.LibraryLoan{}, errors.New("book not found with this barcode")
 		}
-		return db.LibraryIssue{}, fmt.Errorf("failed to find active issue: %w", err)
+		return db.LibraryLoan{}, err
 	}
-
-	return s.ReturnBook(ctx, ReturnBookParams{
-		TenantID: tenantID,
-		IssueID:  issue.ID.String(),
-		UserID:   userID,
-		Remarks:  remarks,
-	})
+	p.IssueID = loan.ID.String()
+	return s.ReturnBook(ctx, p)
 }
 
 func (s *LibraryService) UpsertReadingLog(ctx context.Context, p db.UpsertReadingLogParams) (db.LibraryReadingLog, error) {
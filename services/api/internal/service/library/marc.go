@@ -0,0 +1,337 @@
+package library
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// MARC 21 bibliographic records in ISO 2709 (transmission format) and
+// MARCXML. Only UTF-8 records are read; MARC-8 records come through byte
+// for byte.
+
+const (
+	marcSubfieldDelimiter = 0x1F
+	marcFieldTerminator   = 0x1E
+	marcRecordTerminator  = 0x1D
+
+	marcLeaderLength   = 24
+	marcDirectoryEntry = 12
+
+	marcXMLNamespace = "http://www.loc.gov/MARC21/slim"
+)
+
+var errMARCFormat = errors.New("malformed MARC record")
+
+type marcSubfield struct {
+	Code  string
+	Value string
+}
+
+// marcField is a control field (tags 001 to 009, Value set) or a data field
+// with indicators and subfields.
+type marcField struct {
+	Tag       string
+	Ind1      string
+	Ind2      string
+	Value     string
+	Subfields []marcSubfield
+}
+
+func (f marcField) control() bool { return f.Tag < "010" }
+
+type marcRecord struct {
+	Leader string
+	Fields []marcField
+}
+
+// fields returns the record's fields with any of the tags, in order.
+func (r marcRecord) fields(tags ...string) []marcField {
+	var out []marcField
+	for _, f := range r.Fields {
+		for _, t := range tags {
+			if f.Tag == t {
+				out = append(out, f)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// subfield returns the first value of a subfield in the first field with
+// any of the tags that has it.
+func (r marcRecord) subfield(code string, tags ...string) string {
+	for _, f := range r.fields(tags...) {
+		if v := f.subfield(code); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func (r marcRecord) control(tag string) string {
+	for _, f := range r.fields(tag) {
+		return f.Value
+	}
+	return ""
+}
+
+func (f marcField) subfield(code string) string {
+	for _, sf := range f.Subfields {
+		if sf.Code == code {
+			return strings.TrimSpace(sf.Value)
+		}
+	}
+	return ""
+}
+
+// ISO 2709
+
+// readISO2709 parses a file of ISO 2709 records. Line breaks some systems
+// put between records are skipped.
+func readISO2709(r io.Reader) ([]marcRecord, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var out []marcRecord
+	for n := 1; ; n++ {
+		data = bytes.TrimLeft(data, "\r\n\t ")
+		if len(data) == 0 {
+			return out, nil
+		}
+		end := bytes.IndexByte(data, marcRecordTerminator)
+		if end < 0 {
+			return out, fmt.Errorf("%w: record %d has no terminator", errMARCFormat, n)
+		}
+		// Trust the leader's length when it points at a terminator; a
+		// terminator byte cannot appear inside a record otherwise.
+		if length, ok := marcDigits(data[:min(5, len(data))]); ok && length > end && length <= len(data) && data[length-1] == marcRecordTerminator {
+			end = length - 1
+		}
+		rec, err := parseISO2709(data[:end])
+		if err != nil {
+			return out, fmt.Errorf("record %d: %w", n, err)
+		}
+		out = append(out, rec)
+		data = data[end+1:]
+	}
+}
+
+func parseISO2709(raw []byte) (marcRecord, error) {
+	if len(raw) < marcLeaderLength+1 {
+		return marcRecord{}, fmt.Errorf("%w: record too short", errMARCFormat)
+	}
+	rec := marcRecord{Leader: string(raw[:marcLeaderLength])}
+	base, ok := marcDigits(raw[12:17])
+	if !ok || base <= marcLeaderLength || base > len(raw) {
+		return rec, fmt.Errorf("%w: bad base address", errMARCFormat)
+	}
+	dir := raw[marcLeaderLength : base-1]
+	if len(dir)%marcDirectoryEntry != 0 {
+		return rec, fmt.Errorf("%w: bad directory length", errMARCFormat)
+	}
+	body := raw[base:]
+	for i := 0; i < len(dir); i += marcDirectoryEntry {
+		entry := dir[i : i+marcDirectoryEntry]
+		length, ok1 := marcDigits(entry[3:7])
+		start, ok2 := marcDigits(entry[7:12])
+		if !ok1 || !ok2 || length < 1 || start+length > len(body) {
+			return rec, fmt.Errorf("%w: bad directory entry %q", errMARCFormat, entry)
+		}
+		value := bytes.TrimSuffix(body[start:start+length], []byte{marcFieldTerminator})
+		f := marcField{Tag: string(entry[:3])}
+		if f.control() {
+			f.Value = string(value)
+		} else {
+			if len(value) < 2 {
+				return rec, fmt.Errorf("%w: field %s has no indicators", errMARCFormat, f.Tag)
+			}
+			f.Ind1, f.Ind2 = string(value[0]), string(value[1])
+			for _, part := range bytes.Split(value[2:], []byte{marcSubfieldDelimiter}) {
+				if len(part) == 0 {
+					continue
+				}
+				f.Subfields = append(f.Subfields, marcSubfield{Code: string(part[0]), Value: string(part[1:])})
+			}
+		}
+		rec.Fields = append(rec.Fields, f)
+	}
+	return rec, nil
+}
+
+// marcDigits parses a fixed-width numeric field of the leader or directory.
+// Only ASCII digits are accepted, so signs and padding cannot produce a
+// negative or shifted offset.
+func marcDigits(b []byte) (int, bool) {
+	if len(b) == 0 {
+		return 0, false
+	}
+	n := 0
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+		n = n*10 + int(c-'0')
+	}
+	return n, true
+}
+
+// writeISO2709 encodes a record, working out the leader's lengths and the
+// directory. The rest of the leader is taken from the record.
+func writeISO2709(w io.Writer, rec marcRecord) error {
+	var dir, body bytes.Buffer
+	for _, f := range rec.Fields {
+		start := body.Len()
+		if f.control() {
+			body.WriteString(f.Value)
+		} else {
+			body.WriteString(indicator(f.Ind1))
+			body.WriteString(indicator(f.Ind2))
+			for _, sf := range f.Subfields {
+				body.WriteByte(marcSubfieldDelimiter)
+				body.WriteString(sf.Code)
+				body.WriteString(sf.Value)
+			}
+		}
+		body.WriteByte(marcFieldTerminator)
+		length := body.Len() - start
+		if len(f.Tag) != 3 || length > 9999 || start > 99999 {
+			return fmt.Errorf("%w: field %s is too long", errMARCFormat, f.Tag)
+		}
+		fmt.Fprintf(&dir, "%s%04d%05d", f.Tag, length, start)
+	}
+	dir.WriteByte(marcFieldTerminator)
+	base := marcLeaderLength + dir.Len()
+	total := base + body.Len() + 1
+	if total > 99999 {
+		return fmt.Errorf("%w: record is too long", errMARCFormat)
+	}
+	leader := []byte(rec.Leader)
+	if len(leader) != marcLeaderLength {
+		leader = []byte(defaultMARCLeader)
+	}
+	copy(leader[0:5], fmt.Sprintf("%05d", total))
+	copy(leader[12:17], fmt.Sprintf("%05d", base))
+	leader[9] = 'a' // UTF-8
+	leader[10], leader[11] = '2', '2'
+	copy(leader[20:24], "4500")
+
+	out := make([]byte, 0, total)
+	out = append(out, leader...)
+	out = append(out, dir.Bytes()...)
+	out = append(out, body.Bytes()...)
+	out = append(out, marcRecordTerminator)
+	_, err := w.Write(out)
+	return err
+}
+
+// defaultMARCLeader describes a new, complete, UTF-8 record of a printed
+// monograph; lengths are filled in when it is written.
+const defaultMARCLeader = "00000nam a2200000 i 4500"
+
+func indicator(v string) string {
+	if len(v) != 1 {
+		return " "
+	}
+	return v
+}
+
+// MARCXML
+
+type marcXMLSubfield struct {
+	Code  string `xml:"code,attr"`
+	Value string `xml:",chardata"`
+}
+
+type marcXMLControl struct {
+	Tag   string `xml:"tag,attr"`
+	Value string `xml:",chardata"`
+}
+
+type marcXMLData struct {
+	Tag       string            `xml:"tag,attr"`
+	Ind1      string            `xml:"ind1,attr"`
+	Ind2      string            `xml:"ind2,attr"`
+	Subfields []marcXMLSubfield `xml:"subfield"`
+}
+
+type marcXMLRecord struct {
+	XMLName  xml.Name         `xml:"record"`
+	Leader   string           `xml:"leader"`
+	Controls []marcXMLControl `xml:"controlfield"`
+	Data     []marcXMLData    `xml:"datafield"`
+}
+
+// readMARCXML parses every record element in a MARCXML document, whether
+// it is a collection or a single record.
+func readMARCXML(r io.Reader) ([]marcRecord, error) {
+	dec := xml.NewDecoder(r)
+	var out []marcRecord
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return out, nil
+		}
+		if err != nil {
+			return out, fmt.Errorf("%w: %v", errMARCFormat, err)
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != "record" {
+			continue
+		}
+		var x marcXMLRecord
+		if err := dec.DecodeElement(&x, &start); err != nil {
+			return out, fmt.Errorf("%w: record %d: %v", errMARCFormat, len(out)+1, err)
+		}
+		// MARCXML keeps control and data fields apart; tag order puts them
+		// back in record order.
+		rec := marcRecord{Leader: x.Leader}
+		for _, c := range x.Controls {
+			rec.Fields = append(rec.Fields, marcField{Tag: c.Tag, Value: c.Value})
+		}
+		for _, d := range x.Data {
+			f := marcField{Tag: d.Tag, Ind1: d.Ind1, Ind2: d.Ind2}
+			for _, sf := range d.Subfields {
+				f.Subfields = append(f.Subfields, marcSubfield{Code: sf.Code, Value: sf.Value})
+			}
+			rec.Fields = append(rec.Fields, f)
+		}
+		out = append(out, rec)
+	}
+}
+
+// writeMARCXML writes the records as a MARCXML collection.
+func writeMARCXML(w io.Writer, recs []marcRecord) error {
+	if _, err := io.WriteString(w, xml.Header+`<collection xmlns="`+marcXMLNamespace+`">`+"\n"); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("  ", "  ")
+	for _, rec := range recs {
+		x := marcXMLRecord{Leader: rec.Leader}
+		for _, f := range rec.Fields {
+			if f.control() {
+				x.Controls = append(x.Controls, marcXMLControl{Tag: f.Tag, Value: f.Value})
+				continue
+			}
+			d := marcXMLData{Tag: f.Tag, Ind1: indicator(f.Ind1), Ind2: indicator(f.Ind2)}
+			for _, sf := range f.Subfields {
+				d.Subfields = append(d.Subfields, marcXMLSubfield{Code: sf.Code, Value: sf.Value})
+			}
+			x.Data = append(x.Data, d)
+		}
+		if err := enc.Encode(x); err != nil {
+			return err
+		}
+	}
+	if err := enc.Flush(); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n</collection>\n")
+	return err
+}
@@ -0,0 +1,104 @@
+package library
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func sampleMARCRecord() marcRecord {
+	return marcRecord{
+		Leader: defaultMARCLeader,
+		Fields: []marcField{
+			{Tag: "001", Value: "bk-1"},
+			{Tag: "020", Ind1: " ", Ind2: " ", Subfields: []marcSubfield{{"a", "9780306406157"}, {"c", "₹450.00"}}},
+			{Tag: "100", Ind1: "1", Ind2: " ", Subfields: []marcSubfield{{"a", "Narayan, R. K.,"}}},
+			{Tag: "245", Ind1: "1", Ind2: "0", Subfields: []marcSubfield{{"a", "Malgudi days /"}, {"b", "stories :"}}},
+		},
+	}
+}
+
+func TestISO2709RoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	for i := 0; i < 2; i++ {
+		if err := writeISO2709(&buf, sampleMARCRecord()); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		// Some exports put a line break between records.
+		buf.WriteString("\r\n")
+	}
+	recs, err := readISO2709(&buf)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if len(recs) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(recs))
+	}
+	rec := recs[1]
+	if rec.control("001") != "bk-1" || rec.subfield("a", "245") != "Malgudi days /" || rec.subfield("c", "020") != "₹450.00" {
+		t.Fatalf("unexpected record %+v", rec)
+	}
+	if f := rec.fields("245")[0]; f.Ind1 != "1" || f.Ind2 != "0" {
+		t.Fatalf("expected indicators to survive, got %q %q", f.Ind1, f.Ind2)
+	}
+	if rec.Leader[9] != 'a' || !strings.HasSuffix(rec.Leader, "4500") {
+		t.Fatalf("unexpected leader %q", rec.Leader)
+	}
+}
+
+func TestReadISO2709Malformed(t *testing.T) {
+	if _, err := readISO2709(strings.NewReader("00010nam")); !errors.Is(err, errMARCFormat) {
+		t.Fatalf("expected a missing terminator to fail, got %v", err)
+	}
+	bad := "00030nam a2200099 i 4500" + "\x1e\x1d"
+	if _, err := readISO2709(strings.NewReader(bad)); !errors.Is(err, errMARCFormat) {
+		t.Fatalf("expected a bad base address to fail, got %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := writeISO2709(&buf, sampleMARCRecord()); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	// The first directory entry starts right after the leader: tag, 4-digit
+	// length, 5-digit start.
+	for _, start := range []string{"-0001", "+0001", " 0001"} {
+		raw := buf.Bytes()
+		mutated := string(raw[:31]) + start + string(raw[36:])
+		if _, err := readISO2709(strings.NewReader(mutated)); !errors.Is(err, errMARCFormat) {
+			t.Fatalf("expected directory start %q to fail, got %v", start, err)
+		}
+	}
+}
+
+func TestMARCXMLRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeMARCXML(&buf, []marcRecord{sampleMARCRecord()}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if !strings.Contains(buf.String(), marcXMLNamespace) {
+		t.Fatalf("expected the MARC21 slim namespace, got %s", buf.String())
+	}
+	recs, err := readMARCXML(&buf)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if len(recs) != 1 || recs[0].control("001") != "bk-1" || recs[0].subfield("b", "245") != "stories :" {
+		t.Fatalf("unexpected records %+v", recs)
+	}
+}
+
+func TestReadMARCXMLSingleRecord(t *testing.T) {
+	doc := `<record xmlns="http://www.loc.gov/MARC21/slim">
+  <leader>00000nam a2200000 i 4500</leader>
+  <controlfield tag="008">200101s2019    ii            000 0 hin d</controlfield>
+  <datafield tag="245" ind1="0" ind2="0"><subfield code="a">Godan</subfield></datafield>
+</record>`
+	recs, err := readMARCXML(strings.NewReader(doc))
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if len(recs) != 1 || recs[0].subfield("a", "245") != "Godan" || len(recs[0].control("008")) != 40 {
+		t.Fatalf("unexpected records %+v", recs)
+	}
+}
@@ -2,12 +2,18 @@ package notification
 
 import (
 	"context"
+	"errors"
 	"time"
 
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/schoolerp/api/internal/db"
 )
 
+// ErrWhatsAppNumberTaken means another tenant's gateway already names the
+// WhatsApp phone-number id; inbound messages are routed by it.
+var ErrWhatsAppNumberTaken = errors.New("whatsapp phone number id is linked to another tenant")
+
 type Service struct {
 	q db.Querier
 }
@@ -142,7 +148,7 @@ func (s *Service) CreateOrUpdateGatewayConfig(ctx context.Context, tenantID, pro
 	tID := pgtype.UUID{}
 	tID.Scan(tenantID)
 
-	return s.q.CreateNotificationGatewayConfig(ctx, db.CreateNotificationGatewayConfigParams{
+	cfg, err := s.q.CreateNotificationGatewayConfig(ctx, db.CreateNotificationGatewayConfigParams{
 		TenantID: tID,
 		Provider: provider,
 		ApiKey:   pgtype.Text{String: apiKey, Valid: apiKey != ""},
@@ -151,6 +157,11 @@ func (s *Service) CreateOrUpdateGatewayConfig(ctx context.Context, tenantID, pro
 		IsActive: pgtype.Bool{Bool: isActive, Valid: true},
 		Settings: settings,
 	})
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == "notification_gateway_whatsapp_number" {
+		return cfg, ErrWhatsAppNumberTaken
+	}
+	return cfg, err
 }
 
 func (s *Service) ListGatewayConfigs(ctx context.Context, tenantID string) ([]db.NotificationGatewayConfig, error) {
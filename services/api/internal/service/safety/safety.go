@@ -15,17 +15,20 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/schoolerp/api/internal/db"
 	"github.com/schoolerp/api/internal/foundation/audit"
+	"github.com/schoolerp/api/internal/foundation/keyring"
 )
 
 type Service struct {
 	q     db.Querier
 	audit *audit.Logger
+	keys  *keyring.Service
 }
 
-func NewService(q db.Querier, audit *audit.Logger) *Service {
+func NewService(q db.Querier, audit *audit.Logger, keys *keyring.Service) *Service {
 	return &Service{
 		q:     q,
 		audit: audit,
+		keys:  keys,
 	}
 }
 
@@ -177,7 +180,7 @@ func (s *Service) VisitorCheckIn(ctx context.Context, p VisitorCheckInParams) (d
 	encryptedID := p.IDNumber
 	if p.IDNumber != "" {
 		var encErr error
-		encryptedID, encErr = encrypt([]byte(p.IDNumber))
+		encryptedID, encErr = s.keys.EncryptString(ctx, p.TenantID, p.IDNumber)
 		if encErr != nil {
 			return db.VisitorLog{}, fmt.Errorf("encryption failed: %w", encErr)
 		}
@@ -516,7 +519,7 @@ func (s *Service) CreateConfidentialNote(ctx context.Context, tenantID, studentI
 	aID := pgtype.UUID{}
 	aID.Scan(authorID)
 
-	encrypted, err := encrypt([]byte(content))
+	encrypted, err := s.keys.EncryptString(ctx, tenantID, content)
 	if err != nil {
 		return db.StudentConfidentialNote{}, fmt.Errorf("failed to encrypt note: %w", err)
 	}
@@ -544,9 +547,9 @@ func (s *Service) ListConfidentialNotes(ctx context.Context, tenantID, studentID
 	}
 
 	for i := range rows {
-		decrypted, err := decrypt(rows[i].EncryptedContent)
+		decrypted, err := s.keys.DecryptString(ctx, tenantID, rows[i].EncryptedContent)
 		if err == nil {
-			rows[i].EncryptedContent = string(decrypted)
+			rows[i].EncryptedContent = decrypted
 		} else {
 			rows[i].EncryptedContent = "[DECRYPTION FAILED]"
 		}
@@ -704,3 +707,12 @@ func (s *Service) ListActivePickupCodesForStudent(ctx context.Context, tenantID,
 	})
 }
 
+func generateOTP(length int) string {
+	const digits = "0123456789"
+	result := make([]byte, length)
+	_, _ = io.ReadFull(rand.Reader, result)
+	for i := 0; i < length; i++ {
+		result[i] = digits[int(result[i])%len(digits)]
+	}
+	return string(result)
+}
@@ -2,20 +2,107 @@ package sis
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/schoolerp/api/internal/db"
 	"github.com/schoolerp/api/internal/foundation/audit"
 )
 
+var (
+	ErrInvalidHostel            = errors.New("invalid hostel input")
+	ErrHostelBuildingNotFound   = errors.New("hostel building not found")
+	ErrHostelRoomNotFound       = errors.New("hostel room not found")
+	ErrHostelAllocationNotFound = errors.New("hostel allocation not found")
+	ErrHostelState              = errors.New("hostel state conflict")
+	ErrRoomFull                 = errors.New("room is full")
+	ErrAlreadyAllocated         = errors.New("student already has a hostel bed")
+)
+
 type HostelService struct {
 	db    *pgxpool.Pool
+	q     *db.Queries
 	audit *audit.Logger
 }
 
-func NewHostelService(db *pgxpool.Pool, audit *audit.Logger) *HostelService {
-	return &HostelService{db: db, audit: audit}
+func NewHostelService(pool *pgxpool.Pool, q *db.Queries, audit *audit.Logger) *HostelService {
+	return &HostelService{db: pool, q: q, audit: audit}
+}
+
+// HostelActor is who is acting, for the audit trail.
+type HostelActor struct {
+	UserID    string
+	RequestID string
+	IP        string
+}
+
+func (s *HostelService) log(ctx context.Context, tenantID pgtype.UUID, actor HostelActor, action, resourceType string, resourceID pgtype.UUID, after any) {
+	if s.audit == nil {
+		return
+	}
+	_ = s.audit.Log(ctx, audit.Entry{
+		TenantID:     tenantID,
+		UserID:       toPgUUID(actor.UserID),
+		RequestID:    actor.RequestID,
+		Action:       action,
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+		After:        after,
+		IPAddress:    actor.IP,
+	})
+}
+
+func (s *HostelService) inTx(ctx context.Context, fn func(q *db.Queries) error) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	if err := fn(s.q.WithTx(tx)); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// location is the school's time zone.
+func (s *HostelService) location(ctx context.Context, tid pgtype.UUID) (*time.Location, error) {
+	tz, err := s.q.GetSchoolTimezone(ctx, tid)
+	if err != nil {
+		return nil, err
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return time.UTC, nil
+	}
+	return loc, nil
+}
+
+// today is the current date at the school.
+func (s *HostelService) today(ctx context.Context, tid pgtype.UUID) (time.Time, error) {
+	loc, err := s.location(ctx, tid)
+	if err != nil {
+		return time.Time{}, err
+	}
+	now := time.Now().In(loc)
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC), nil
+}
+
+func pgDate(t time.Time) pgtype.Date {
+	return pgtype.Date{Time: t, Valid: !t.IsZero()}
+}
+
+func optionalText(v string) pgtype.Text {
+	return pgtype.Text{String: v, Valid: v != ""}
+}
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
 }
 
 type HostelBuilding struct {
@@ -42,9 +129,11 @@ type HostelRoom struct {
 type HostelAllocation struct {
 	ID        string `json:"id"`
 	RoomID    string `json:"room_id"`
+	BedID     string `json:"bed_id,omitempty"`
 	StudentID string `json:"student_id"`
 	Student   string `json:"student_name,omitempty"`
 	Room      string `json:"room_number,omitempty"`
+	Bed       string `json:"bed_label,omitempty"`
 	Building  string `json:"building_name,omitempty"`
 	Since     string `json:"allotted_on"`
 	Status    string `json:"status"`
@@ -95,25 +184,51 @@ func (s *HostelService) ListBuildings(ctx context.Context, tenantID string) ([]H
 	return buildings, nil
 }
 
-func (s *HostelService) CreateRoom(ctx context.Context, bID string, r HostelRoom) (HostelRoom, error) {
+// CreateRoom adds a room to one of the tenant's buildings along with a bed
+// for each place in it.
+func (s *HostelService) CreateRoom(ctx context.Context, tenantID, bID string, r HostelRoom) (HostelRoom, error) {
+	if r.Capacity < 1 || r.Capacity > 50 {
+		return HostelRoom{}, fmt.Errorf("%w: capacity must be between 1 and 50", ErrInvalidHostel)
+	}
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return HostelRoom{}, err
+	}
+	defer tx.Rollback(ctx)
+
 	var id string
-	query := `INSERT INTO hostel_rooms (building_id, room_number, room_type, capacity, cost_per_month, amenities) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`
-	err := s.db.QueryRow(ctx, query, bID, r.RoomNumber, r.RoomType, r.Capacity, r.CostOfMonth, r.Amenities).Scan(&id)
+	query := `
+		INSERT INTO hostel_rooms (tenant_id, building_id, room_number, room_type, capacity, cost_per_month, amenities)
+		SELECT b.tenant_id, b.id, $3, $4, $5, $6, $7
+		FROM hostel_buildings b WHERE b.tenant_id = $1 AND b.id = $2
+		RETURNING id`
+	err = tx.QueryRow(ctx, query, tenantID, bID, r.RoomNumber, r.RoomType, r.Capacity, r.CostOfMonth, r.Amenities).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return HostelRoom{}, ErrHostelBuildingNotFound
+	}
 	if err != nil {
 		return HostelRoom{}, err
 	}
-	r.ID = id
-	r.BuildingID = bID
+	if err := s.q.WithTx(tx).CreateHostelBeds(ctx, toPgUUID(tenantID), toPgUUID(id), 1, int32(r.Capacity)); err != nil {
+		return HostelRoom{}, err
+	}
 
 	// Update total rooms count
-	s.db.Exec(ctx, `UPDATE hostel_buildings SET total_rooms = total_rooms + 1 WHERE id = $1`, bID)
+	if _, err := tx.Exec(ctx, `UPDATE hostel_buildings SET total_rooms = total_rooms + 1 WHERE id = $1`, bID); err != nil {
+		return HostelRoom{}, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return HostelRoom{}, err
+	}
+	r.ID = id
+	r.BuildingID = bID
 
 	return r, nil
 }
 
-func (s *HostelService) ListRooms(ctx context.Context, bID string) ([]HostelRoom, error) {
-	query := `SELECT id, building_id, room_number, room_type, capacity, occupancy, cost_per_month, amenities FROM hostel_rooms WHERE building_id = $1 AND is_active = true`
-	rows, err := s.db.Query(ctx, query, bID)
+func (s *HostelService) ListRooms(ctx context.Context, tenantID, bID string) ([]HostelRoom, error) {
+	query := `SELECT id, building_id, room_number, room_type, capacity, occupancy, cost_per_month, amenities FROM hostel_rooms WHERE tenant_id = $1 AND building_id = $2 AND is_active = true`
+	rows, err := s.db.Query(ctx, query, tenantID, bID)
 	if err != nil {
 		return nil, err
 	}
@@ -131,60 +246,193 @@ func (s *HostelService) ListRooms(ctx context.Context, bID string) ([]HostelRoom
 	return rooms, nil
 }
 
-func (s *HostelService) AllocateRoom(ctx context.Context, tenantID, roomID, studentID string, userID, reqID, ip string) error {
-	// Check capacity
-	var capacity, occupancy int
-	err := s.db.QueryRow(ctx, `SELECT capacity, occupancy FROM hostel_rooms WHERE id = $1`, roomID).Scan(&capacity, &occupancy)
+// ListBeds returns a room's beds and who holds each.
+func (s *HostelService) ListBeds(ctx context.Context, tenantID, roomID string) ([]db.HostelBed, error) {
+	beds, err := s.q.ListHostelBeds(ctx, toPgUUID(tenantID), toPgUUID(roomID))
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if occupancy >= capacity {
-		return fmt.Errorf("room is full")
+	if beds == nil {
+		return nil, ErrHostelRoomNotFound
 	}
+	return beds, nil
+}
 
-	tx, err := s.db.Begin(ctx)
-	if err != nil {
-		return err
-	}
-	defer tx.Rollback(ctx)
-
-	_, err = tx.Exec(ctx, `INSERT INTO hostel_allocations (room_id, student_id) VALUES ($1, $2)`, roomID, studentID)
+// AllocateRoom gives a student a bed in a room: the bed asked for, or else
+// the first free one. The room stays locked while the bed is chosen, so two
+// allocations at once cannot overfill it or share a bed.
+func (s *HostelService) AllocateRoom(ctx context.Context, tenantID, roomID, bedID, studentID string, userID, reqID, ip string) (HostelAllocation, error) {
+	tid := toPgUUID(tenantID)
+	today, err := s.today(ctx, tid)
 	if err != nil {
-		return err
+		return HostelAllocation{}, err
 	}
-
-	_, err = tx.Exec(ctx, `UPDATE hostel_rooms SET occupancy = occupancy + 1 WHERE id = $1`, roomID)
-	if err != nil {
+	var id pgtype.UUID
+	err = s.inTx(ctx, func(q *db.Queries) error {
+		var err error
+		id, err = allot(ctx, q, tid, toPgUUID(roomID), toPgUUID(bedID), toPgUUID(studentID), today, toPgUUID(userID), "")
 		return err
-	}
-
-	err = tx.Commit(ctx)
+	})
 	if err != nil {
-		return err
+		return HostelAllocation{}, err
 	}
 
 	s.audit.Log(ctx, audit.Entry{
-		TenantID:     toPgUUID(tenantID),
+		TenantID:     tid,
 		UserID:       toPgUUID(userID),
 		RequestID:    reqID,
 		Action:       "hostel.allocation.create",
 		ResourceType: "hostel_allocation",
-		After:        map[string]string{"room_id": roomID, "student_id": studentID},
+		ResourceID:   id,
+		After:        map[string]string{"room_id": roomID, "bed_id": bedID, "student_id": studentID},
 		IPAddress:    ip,
 	})
 
-	return nil
+	return s.getAllocation(ctx, tenantID, id.String())
 }
 
-func (s *HostelService) ListAllocations(ctx context.Context, tenantID string) ([]HostelAllocation, error) {
-	query := `
-		SELECT ha.id, ha.room_id, ha.student_id, hr.room_number, hb.name as building_name, s.full_name as student_name, ha.allotted_on, ha.status
+// allot takes a bed for a student in a transaction. The student must not
+// hold another bed.
+func allot(ctx context.Context, q *db.Queries, tid, roomID, bedID, studentID pgtype.UUID, on time.Time, by pgtype.UUID, remark string) (pgtype.UUID, error) {
+	room, err := q.LockHostelRoom(ctx, tid, roomID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return pgtype.UUID{}, ErrHostelRoomNotFound
+	}
+	if err != nil {
+		return pgtype.UUID{}, err
+	}
+	if !room.Active {
+		return pgtype.UUID{}, fmt.Errorf("%w: room %s is closed", ErrHostelState, room.RoomNumber)
+	}
+	if _, err := q.GetActiveHostelAllocation(ctx, tid, studentID); err == nil {
+		return pgtype.UUID{}, ErrAlreadyAllocated
+	} else if !errors.Is(err, pgx.ErrNoRows) {
+		return pgtype.UUID{}, err
+	}
+	if room.Occupancy >= room.Capacity {
+		return pgtype.UUID{}, ErrRoomFull
+	}
+	bed, err := q.LockFreeHostelBed(ctx, tid, room.ID, bedID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		if bedID.Valid {
+			return pgtype.UUID{}, fmt.Errorf("%w: the bed is taken or not in room %s", ErrHostelState, room.RoomNumber)
+		}
+		return pgtype.UUID{}, ErrRoomFull
+	}
+	if err != nil {
+		return pgtype.UUID{}, err
+	}
+	id, err := q.CreateHostelAllocation(ctx, db.CreateHostelAllocationParams{
+		TenantID:   tid,
+		RoomID:     room.ID,
+		BedID:      bed.ID,
+		StudentID:  studentID,
+		AllottedOn: pgDate(on),
+		AllottedBy: by,
+		Remarks:    optionalText(remark),
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return pgtype.UUID{}, fmt.Errorf("%w: unknown student", ErrInvalidHostel)
+	}
+	if isUniqueViolation(err) {
+		// Backstop for the partial unique indexes on bed and student.
+		return pgtype.UUID{}, ErrAlreadyAllocated
+	}
+	return id, err
+}
+
+// TransferAllocation moves a resident to another bed, in the same room or
+// another one. The old stay ends today and the new one starts today, so
+// the history keeps both.
+func (s *HostelService) TransferAllocation(ctx context.Context, tenantID, allocationID, roomID, bedID, remark string, actor HostelActor) (HostelAllocation, error) {
+	tid := toPgUUID(tenantID)
+	today, err := s.today(ctx, tid)
+	if err != nil {
+		return HostelAllocation{}, err
+	}
+	var id pgtype.UUID
+	err = s.inTx(ctx, func(q *db.Queries) error {
+		current, err := q.LockHostelAllocation(ctx, tid, toPgUUID(allocationID))
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrHostelAllocationNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if current.Status != "active" {
+			return fmt.Errorf("%w: the allocation is %s", ErrHostelState, current.Status)
+		}
+		target := toPgUUID(roomID)
+		if !target.Valid {
+			target = current.RoomID
+		}
+		if bed := toPgUUID(bedID); bed.Valid && bed == current.BedID {
+			return fmt.Errorf("%w: the student is already in that bed", ErrHostelState)
+		}
+		// Lock both rooms in a fixed order so crossing transfers cannot
+		// deadlock.
+		first, second := current.RoomID, target
+		if second.String() < first.String() {
+			first, second = second, first
+		}
+		for _, room := range []pgtype.UUID{first, second} {
+			if _, err := q.LockHostelRoom(ctx, tid, room); errors.Is(err, pgx.ErrNoRows) {
+				return ErrHostelRoomNotFound
+			} else if err != nil {
+				return err
+			}
+		}
+		if err := q.CloseHostelAllocation(ctx, tid, current.ID, pgDate(today), optionalText("transferred")); err != nil {
+			return err
+		}
+		id, err = allot(ctx, q, tid, target, toPgUUID(bedID), current.StudentID, today, toPgUUID(actor.UserID), remark)
+		return err
+	})
+	if err != nil {
+		return HostelAllocation{}, err
+	}
+	s.log(ctx, tid, actor, "hostel.allocation.transfer", "hostel_allocation", id, map[string]string{
+		"from_allocation_id": allocationID, "room_id": roomID, "bed_id": bedID,
+	})
+	return s.getAllocation(ctx, tenantID, id.String())
+}
+
+const hostelAllocationSelect = `
+		SELECT ha.id, ha.room_id, ha.bed_id, ha.student_id, hr.room_number, bd.label, hb.name as building_name, s.full_name as student_name, ha.allotted_on, ha.status
 		FROM hostel_allocations ha
 		JOIN hostel_rooms hr ON ha.room_id = hr.id
 		JOIN hostel_buildings hb ON hr.building_id = hb.id
 		JOIN students s ON ha.student_id = s.id
-		WHERE hb.tenant_id = $1 AND ha.status = 'active'
-	`
+		LEFT JOIN hostel_beds bd ON ha.bed_id = bd.id`
+
+func scanHostelAllocation(row pgx.Row) (HostelAllocation, error) {
+	var a HostelAllocation
+	var bedID, bed *string
+	var allottedOn time.Time
+	err := row.Scan(&a.ID, &a.RoomID, &bedID, &a.StudentID, &a.Room, &bed, &a.Building, &a.Student, &allottedOn, &a.Status)
+	if err != nil {
+		return HostelAllocation{}, err
+	}
+	if bedID != nil {
+		a.BedID = *bedID
+	}
+	if bed != nil {
+		a.Bed = *bed
+	}
+	a.Since = allottedOn.Format("2006-01-02")
+	return a, nil
+}
+
+func (s *HostelService) getAllocation(ctx context.Context, tenantID, id string) (HostelAllocation, error) {
+	a, err := scanHostelAllocation(s.db.QueryRow(ctx, hostelAllocationSelect+` WHERE ha.tenant_id = $1 AND ha.id = $2`, tenantID, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return a, ErrHostelAllocationNotFound
+	}
+	return a, err
+}
+
+func (s *HostelService) ListAllocations(ctx context.Context, tenantID string) ([]HostelAllocation, error) {
+	query := hostelAllocationSelect + ` WHERE ha.tenant_id = $1 AND ha.status = 'active'`
 	rows, err := s.db.Query(ctx, query, tenantID)
 	if err != nil {
 		return nil, err
@@ -193,32 +441,34 @@ func (s *HostelService) ListAllocations(ctx context.Context, tenantID string) ([
 
 	var allocations []HostelAllocation
 	for rows.Next() {
-		var a HostelAllocation
-		var allottedOn time.Time
-		err := rows.Scan(&a.ID, &a.RoomID, &a.StudentID, &a.Room, &a.Building, &a.Student, &allottedOn, &a.Status)
+		a, err := scanHostelAllocation(rows)
 		if err != nil {
 			return nil, err
 		}
-		a.Since = allottedOn.Format("2006-01-02")
 		allocations = append(allocations, a)
 	}
 	return allocations, nil
 }
 
+// VacateRoom ends an active stay and frees the bed.
 func (s *HostelService) VacateRoom(ctx context.Context, tenantID, allocationID string, userID, reqID, ip string) error {
-	var roomID string
-	err := s.db.QueryRow(ctx, `UPDATE hostel_allocations SET status = 'vacated', vacated_on = CURRENT_DATE WHERE id = $1 RETURNING room_id`, allocationID).Scan(&roomID)
+	tid := toPgUUID(tenantID)
+	today, err := s.today(ctx, tid)
 	if err != nil {
 		return err
 	}
-
-	_, err = s.db.Exec(ctx, `UPDATE hostel_rooms SET occupancy = occupancy - 1 WHERE id = $1`, roomID)
+	err = s.inTx(ctx, func(q *db.Queries) error {
+		return q.CloseHostelAllocation(ctx, tid, toPgUUID(allocationID), pgDate(today), pgtype.Text{})
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrHostelAllocationNotFound
+	}
 	if err != nil {
 		return err
 	}
 
 	s.audit.Log(ctx, audit.Entry{
-		TenantID:     toPgUUID(tenantID),
+		TenantID:     tid,
 		UserID:       toPgUUID(userID),
 		RequestID:    reqID,
 		Action:       "hostel.allocation.vacate",
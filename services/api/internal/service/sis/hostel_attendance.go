@@ -0,0 +1,619 @@
+package sis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/schoolerp/api/internal/db"
+)
+
+var (
+	ErrLeaveNotFound = errors.New("hostel leave request not found")
+	ErrLeaveState    = errors.New("hostel leave request is not in the right state")
+)
+
+const (
+	rollPresent = "present"
+	rollAbsent  = "absent"
+	rollOnLeave = "on_leave"
+
+	// rollCallHour is when the nightly roll-call is taken, in school time.
+	// A student away on leave at that hour is excused.
+	rollCallHour = 21
+
+	leaveKindLeave  = "leave"
+	leaveKindOuting = "outing"
+
+	leavePending   = "pending"
+	leaveApproved  = "approved"
+	leaveRejected  = "rejected"
+	leaveCancelled = "cancelled"
+	leaveOut       = "out"
+	leaveReturned  = "returned"
+
+	maxLeaveDays = 60
+)
+
+var hostelMeals = []string{"breakfast", "lunch", "snacks", "dinner"}
+
+// parseHostelDate reads a YYYY-MM-DD date, or returns fallback when v is
+// empty.
+func parseHostelDate(v string, fallback time.Time) (time.Time, error) {
+	if strings.TrimSpace(v) == "" {
+		return fallback, nil
+	}
+	d, err := time.Parse("2006-01-02", strings.TrimSpace(v))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: dates must be YYYY-MM-DD", ErrInvalidHostel)
+	}
+	return d, nil
+}
+
+// localDay is the school date of an instant.
+func localDay(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func (s *HostelService) buildingExists(ctx context.Context, tid pgtype.UUID, buildingID string) error {
+	var ok bool
+	err := s.db.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM hostel_buildings WHERE tenant_id = $1 AND id = $2)`, tid, toPgUUID(buildingID)).Scan(&ok)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrHostelBuildingNotFound
+	}
+	return nil
+}
+
+// Roll-call
+
+type RollCallLine struct {
+	db.HostelRollCallLine
+	// Suggested is on_leave for a student away on leave who has not been
+	// marked yet.
+	Suggested string `json:"suggested_status,omitempty"`
+}
+
+type RollCallSheet struct {
+	BuildingID string             `json:"building_id"`
+	Date       string             `json:"date"`
+	RollCall   *db.HostelRollCall `json:"roll_call,omitempty"`
+	Residents  int                `json:"residents"`
+	Present    int                `json:"present"`
+	Absent     int                `json:"absent"`
+	OnLeave    int                `json:"on_leave"`
+	Unmarked   int                `json:"unmarked"`
+	Lines      []RollCallLine     `json:"lines"`
+}
+
+type RollCallMark struct {
+	StudentID string `json:"student_id"`
+	Status    string `json:"status"`
+	Remarks   string `json:"remarks"`
+}
+
+// rollCallAt is the instant of a night's roll-call.
+func rollCallAt(day time.Time, loc *time.Location) pgtype.Timestamptz {
+	return pgtype.Timestamptz{Time: time.Date(day.Year(), day.Month(), day.Day(), rollCallHour, 0, 0, 0, loc), Valid: true}
+}
+
+func buildRollCallSheet(buildingID string, day time.Time, call *db.HostelRollCall, lines []db.HostelRollCallLine) RollCallSheet {
+	sheet := RollCallSheet{BuildingID: buildingID, Date: day.Format("2006-01-02"), RollCall: call, Lines: []RollCallLine{}}
+	for _, l := range lines {
+		line := RollCallLine{HostelRollCallLine: l}
+		switch l.Status.String {
+		case rollPresent:
+			sheet.Present++
+		case rollAbsent:
+			sheet.Absent++
+		case rollOnLeave:
+			sheet.OnLeave++
+		default:
+			sheet.Unmarked++
+			if l.LeaveID.Valid {
+				line.Suggested = rollOnLeave
+			}
+		}
+		sheet.Lines = append(sheet.Lines, line)
+	}
+	sheet.Residents = len(lines)
+	return sheet
+}
+
+func (s *HostelService) rollCallSheet(ctx context.Context, q *db.Queries, tid pgtype.UUID, buildingID string, day time.Time, loc *time.Location) (RollCallSheet, error) {
+	var call *db.HostelRollCall
+	c, err := q.GetHostelRollCall(ctx, tid, toPgUUID(buildingID), pgDate(day))
+	if err == nil {
+		call = &c
+	} else if !errors.Is(err, pgx.ErrNoRows) {
+		return RollCallSheet{}, err
+	}
+	lines, err := q.ListHostelRollCallSheet(ctx, tid, toPgUUID(buildingID), pgDate(day), rollCallAt(day, loc))
+	if err != nil {
+		return RollCallSheet{}, err
+	}
+	return buildRollCallSheet(buildingID, day, call, lines), nil
+}
+
+// RollCall returns a building's roll-call sheet for a night, today by
+// default: every resident, who is away on leave, and what was marked.
+func (s *HostelService) RollCall(ctx context.Context, tenantID, buildingID, date string) (RollCallSheet, error) {
+	tid := toPgUUID(tenantID)
+	if err := s.buildingExists(ctx, tid, buildingID); err != nil {
+		return RollCallSheet{}, err
+	}
+	loc, err := s.location(ctx, tid)
+	if err != nil {
+		return RollCallSheet{}, err
+	}
+	day, err := parseHostelDate(date, localDay(time.Now(), loc))
+	if err != nil {
+		return RollCallSheet{}, err
+	}
+	return s.rollCallSheet(ctx, s.q, tid, buildingID, day, loc)
+}
+
+// RecordRollCall marks residents present, absent or on leave for a night.
+// Marks can be sent in batches; a later mark for a student replaces the
+// earlier one. Students away on leave who have not been marked are marked
+// on leave, so the warden only has to call the rest.
+func (s *HostelService) RecordRollCall(ctx context.Context, tenantID, buildingID, date string, marks []RollCallMark, notes string, actor HostelActor) (RollCallSheet, error) {
+	tid := toPgUUID(tenantID)
+	if err := s.buildingExists(ctx, tid, buildingID); err != nil {
+		return RollCallSheet{}, err
+	}
+	loc, err := s.location(ctx, tid)
+	if err != nil {
+		return RollCallSheet{}, err
+	}
+	today := localDay(time.Now(), loc)
+	day, err := parseHostelDate(date, today)
+	if err != nil {
+		return RollCallSheet{}, err
+	}
+	if day.After(today) {
+		return RollCallSheet{}, fmt.Errorf("%w: cannot take a roll-call for a future night", ErrInvalidHostel)
+	}
+
+	var sheet RollCallSheet
+	err = s.inTx(ctx, func(q *db.Queries) error {
+		call, err := q.UpsertHostelRollCall(ctx, db.HostelRollCall{
+			TenantID:   tid,
+			BuildingID: toPgUUID(buildingID),
+			CallDate:   pgDate(day),
+			Notes:      optionalText(strings.TrimSpace(notes)),
+			TakenBy:    toPgUUID(actor.UserID),
+		})
+		if err != nil {
+			return err
+		}
+		lines, err := q.ListHostelRollCallSheet(ctx, tid, call.BuildingID, call.CallDate, rollCallAt(day, loc))
+		if err != nil {
+			return err
+		}
+		byStudent := make(map[string]db.HostelRollCallLine, len(lines))
+		for _, l := range lines {
+			byStudent[l.StudentID.String()] = l
+		}
+
+		marked := map[string]bool{}
+		for _, m := range marks {
+			line, ok := byStudent[toPgUUID(m.StudentID).String()]
+			if !ok {
+				return fmt.Errorf("%w: student %s is not a resident of this building on %s", ErrInvalidHostel, m.StudentID, day.Format("2006-01-02"))
+			}
+			switch m.Status {
+			case rollPresent, rollAbsent:
+			case rollOnLeave:
+				if !line.LeaveID.Valid {
+					return fmt.Errorf("%w: %s has no leave covering roll-call time", ErrInvalidHostel, line.StudentName)
+				}
+			default:
+				return fmt.Errorf("%w: status must be present, absent or on_leave", ErrInvalidHostel)
+			}
+			leaveID := pgtype.UUID{}
+			if m.Status == rollOnLeave {
+				leaveID = line.LeaveID
+			}
+			if err := q.UpsertHostelRollCallEntry(ctx, db.UpsertHostelRollCallEntryParams{
+				RollCallID:   call.ID,
+				TenantID:     tid,
+				StudentID:    line.StudentID,
+				AllocationID: line.AllocationID,
+				Status:       m.Status,
+				LeaveID:      leaveID,
+				Remarks:      optionalText(strings.TrimSpace(m.Remarks)),
+			}); err != nil {
+				return err
+			}
+			marked[line.StudentID.String()] = true
+		}
+		for _, l := range lines {
+			if !l.LeaveID.Valid || l.Status.Valid || marked[l.StudentID.String()] {
+				continue
+			}
+			if err := q.UpsertHostelRollCallEntry(ctx, db.UpsertHostelRollCallEntryParams{
+				RollCallID:   call.ID,
+				TenantID:     tid,
+				StudentID:    l.StudentID,
+				AllocationID: l.AllocationID,
+				Status:       rollOnLeave,
+				LeaveID:      l.LeaveID,
+			}); err != nil {
+				return err
+			}
+		}
+		sheet, err = s.rollCallSheet(ctx, q, tid, buildingID, day, loc)
+		return err
+	})
+	if err != nil {
+		return RollCallSheet{}, err
+	}
+	if sheet.RollCall != nil {
+		s.log(ctx, tid, actor, "hostel.roll_call.record", "hostel_roll_call", sheet.RollCall.ID, map[string]any{
+			"date": sheet.Date, "marked": len(marks), "present": sheet.Present, "absent": sheet.Absent, "on_leave": sheet.OnLeave,
+		})
+	}
+	return sheet, nil
+}
+
+// Leave and outings
+
+// LeaveRequest is a hostel leave or outing with whether the student is
+// overdue or came back late.
+type LeaveRequest struct {
+	db.HostelLeave
+	Overdue      bool `json:"overdue"`
+	ReturnedLate bool `json:"returned_late"`
+}
+
+func leaveView(l db.HostelLeave, now time.Time) LeaveRequest {
+	v := LeaveRequest{HostelLeave: l}
+	v.Overdue = l.Status == leaveOut && l.ReturnsAt.Time.Before(now)
+	v.ReturnedLate = l.Status == leaveReturned && l.ReturnedAt.Time.After(l.ReturnsAt.Time)
+	return v
+}
+
+type LeaveInput struct {
+	StudentID   string    `json:"student_id"`
+	Kind        string    `json:"kind"`
+	Reason      string    `json:"reason"`
+	Destination string    `json:"destination"`
+	EscortName  string    `json:"escort_name"`
+	EscortPhone string    `json:"escort_phone"`
+	DepartsAt   time.Time `json:"departs_at"`
+	ReturnsAt   time.Time `json:"returns_at"`
+}
+
+func (in LeaveInput) validate(now time.Time, loc *time.Location) error {
+	if in.Kind != leaveKindLeave && in.Kind != leaveKindOuting {
+		return fmt.Errorf("%w: kind must be leave or outing", ErrInvalidHostel)
+	}
+	if strings.TrimSpace(in.Reason) == "" {
+		return fmt.Errorf("%w: reason is required", ErrInvalidHostel)
+	}
+	if in.DepartsAt.IsZero() || in.ReturnsAt.IsZero() {
+		return fmt.Errorf("%w: departs_at and returns_at are required", ErrInvalidHostel)
+	}
+	if !in.ReturnsAt.After(in.DepartsAt) {
+		return fmt.Errorf("%w: returns_at must be after departs_at", ErrInvalidHostel)
+	}
+	if !in.ReturnsAt.After(now) {
+		return fmt.Errorf("%w: the return time has already passed", ErrInvalidHostel)
+	}
+	if in.Kind == leaveKindOuting && !localDay(in.DepartsAt, loc).Equal(localDay(in.ReturnsAt, loc)) {
+		return fmt.Errorf("%w: an outing must return the same day; request leave instead", ErrInvalidHostel)
+	}
+	if in.ReturnsAt.Sub(in.DepartsAt) > maxLeaveDays*24*time.Hour {
+		return fmt.Errorf("%w: leave cannot be longer than %d days", ErrInvalidHostel, maxLeaveDays)
+	}
+	return nil
+}
+
+// leaveMealDays is the whole days a student on leave is away, which are
+// the days their meals are opted out of: from the day after they leave to
+// the day before they return.
+func leaveMealDays(departs, returns time.Time, loc *time.Location) (from, to time.Time, ok bool) {
+	from = localDay(departs, loc).AddDate(0, 0, 1)
+	to = localDay(returns, loc).AddDate(0, 0, -1)
+	return from, to, !to.Before(from)
+}
+
+// RequestLeave files a leave or outing request for a resident. It needs a
+// warden's approval before the student can go.
+func (s *HostelService) RequestLeave(ctx context.Context, tenantID string, in LeaveInput, actor HostelActor) (LeaveRequest, error) {
+	tid := toPgUUID(tenantID)
+	in.Kind = strings.TrimSpace(in.Kind)
+	loc, err := s.location(ctx, tid)
+	if err != nil {
+		return LeaveRequest{}, err
+	}
+	if err := in.validate(time.Now(), loc); err != nil {
+		return LeaveRequest{}, err
+	}
+	studentID := toPgUUID(in.StudentID)
+	alloc, err := s.q.GetActiveHostelAllocation(ctx, tid, studentID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return LeaveRequest{}, fmt.Errorf("%w: the student has no hostel bed", ErrInvalidHostel)
+	}
+	if err != nil {
+		return LeaveRequest{}, err
+	}
+	departs := pgtype.Timestamptz{Time: in.DepartsAt, Valid: true}
+	returns := pgtype.Timestamptz{Time: in.ReturnsAt, Valid: true}
+	overlaps, err := s.q.HostelLeaveOverlaps(ctx, tid, studentID, departs, returns)
+	if err != nil {
+		return LeaveRequest{}, err
+	}
+	if overlaps {
+		return LeaveRequest{}, fmt.Errorf("%w: the student already has leave for part of that time", ErrLeaveState)
+	}
+	id, err := s.q.CreateHostelLeave(ctx, db.CreateHostelLeaveParams{
+		TenantID:     tid,
+		StudentID:    studentID,
+		AllocationID: alloc.ID,
+		Kind:         in.Kind,
+		Reason:       strings.TrimSpace(in.Reason),
+		Destination:  optionalText(strings.TrimSpace(in.Destination)),
+		EscortName:   optionalText(strings.TrimSpace(in.EscortName)),
+		EscortPhone:  optionalText(strings.TrimSpace(in.EscortPhone)),
+		DepartsAt:    departs,
+		ReturnsAt:    returns,
+		RequestedBy:  toPgUUID(actor.UserID),
+	})
+	if err != nil {
+		return LeaveRequest{}, err
+	}
+	s.log(ctx, tid, actor, "hostel.leave.request", "hostel_leave_request", id, in)
+	return s.GetLeave(ctx, tenantID, id.String())
+}
+
+func (s *HostelService) GetLeave(ctx context.Context, tenantID, leaveID string) (LeaveRequest, error) {
+	l, err := s.q.GetHostelLeave(ctx, toPgUUID(tenantID), toPgUUID(leaveID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return LeaveRequest{}, ErrLeaveNotFound
+	}
+	if err != nil {
+		return LeaveRequest{}, err
+	}
+	return leaveView(l, time.Now()), nil
+}
+
+type LeaveFilter struct {
+	Status     string
+	StudentID  string
+	BuildingID string
+	Overdue    bool
+	Limit      int32
+	Offset     int32
+}
+
+func (s *HostelService) ListLeaves(ctx context.Context, tenantID string, f LeaveFilter) ([]LeaveRequest, error) {
+	if f.Limit <= 0 || f.Limit > 200 {
+		f.Limit = 50
+	}
+	if f.Offset < 0 {
+		f.Offset = 0
+	}
+	rows, err := s.q.ListHostelLeaves(ctx, db.ListHostelLeavesParams{
+		TenantID:   toPgUUID(tenantID),
+		Status:     optionalText(strings.TrimSpace(f.Status)),
+		StudentID:  toPgUUID(f.StudentID),
+		BuildingID: toPgUUID(f.BuildingID),
+		Overdue:    f.Overdue,
+		Limit:      f.Limit,
+		Offset:     f.Offset,
+	})
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	out := make([]LeaveRequest, 0, len(rows))
+	for _, l := range rows {
+		out = append(out, leaveView(l, now))
+	}
+	return out, nil
+}
+
+// lockLeave loads a request for update and checks it is in one of the
+// given states.
+func lockLeave(ctx context.Context, q *db.Queries, tid pgtype.UUID, leaveID string, states ...string) (db.HostelLeave, error) {
+	l, err := q.LockHostelLeave(ctx, tid, toPgUUID(leaveID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return db.HostelLeave{}, ErrLeaveNotFound
+	}
+	if err != nil {
+		return db.HostelLeave{}, err
+	}
+	for _, st := range states {
+		if l.Status == st {
+			return l, nil
+		}
+	}
+	return db.HostelLeave{}, fmt.Errorf("%w: the request is %s", ErrLeaveState, l.Status)
+}
+
+// DecideLeave approves or rejects a pending request. Approval issues a
+// gate pass valid for the time away, which security checks at the gate,
+// and opts a student on leave out of the meals of the whole days they are
+// away.
+func (s *HostelService) DecideLeave(ctx context.Context, tenantID, leaveID string, approve bool, remark string, actor HostelActor) (LeaveRequest, error) {
+	tid := toPgUUID(tenantID)
+	remark = strings.TrimSpace(remark)
+	if !approve && remark == "" {
+		return LeaveRequest{}, fmt.Errorf("%w: a reason is required to reject a request", ErrInvalidHostel)
+	}
+	loc, err := s.location(ctx, tid)
+	if err != nil {
+		return LeaveRequest{}, err
+	}
+	var l db.HostelLeave
+	err = s.inTx(ctx, func(q *db.Queries) error {
+		var err error
+		l, err = lockLeave(ctx, q, tid, leaveID, leavePending)
+		if err != nil {
+			return err
+		}
+		decider := toPgUUID(actor.UserID)
+		if !approve {
+			return q.DecideHostelLeave(ctx, tid, l.ID, leaveRejected, decider, optionalText(remark), pgtype.UUID{})
+		}
+		if !l.ReturnsAt.Time.After(time.Now()) {
+			return fmt.Errorf("%w: the return time has already passed", ErrLeaveState)
+		}
+
+		requestedBy := l.RequestedBy
+		if !requestedBy.Valid {
+			requestedBy = decider
+		}
+		pass, err := q.CreateGatePass(ctx, db.CreateGatePassParams{
+			TenantID:    tid,
+			StudentID:   l.StudentID,
+			Reason:      fmt.Sprintf("Hostel %s: %s", l.Kind, l.Reason),
+			RequestedBy: requestedBy,
+			QrCode:      pgtype.Text{String: fmt.Sprintf("GP-%s-%d", l.StudentID.String(), time.Now().Unix()), Valid: true},
+			ValidFrom:   l.DepartsAt,
+			ValidUntil:  l.ReturnsAt,
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := q.ApproveGatePass(ctx, db.ApproveGatePassParams{
+			ID:         pass.ID,
+			TenantID:   tid,
+			ApprovedBy: decider,
+			QrCode:     pgtype.Text{String: fmt.Sprintf("GP-APPROVED-%s", pass.ID.String()), Valid: true},
+		}); err != nil {
+			return err
+		}
+		if err := q.DecideHostelLeave(ctx, tid, l.ID, leaveApproved, decider, optionalText(remark), pass.ID); err != nil {
+			return err
+		}
+
+		if l.Kind != leaveKindLeave {
+			return nil
+		}
+		from, to, ok := leaveMealDays(l.DepartsAt.Time, l.ReturnsAt.Time, loc)
+		if !ok {
+			return nil
+		}
+		_, err = q.CreateHostelMealOptOut(ctx, db.HostelMealOptOut{
+			TenantID:  tid,
+			StudentID: l.StudentID,
+			FromDate:  pgDate(from),
+			ToDate:    pgDate(to),
+			Meals:     hostelMeals,
+			Reason:    pgtype.Text{String: "On leave", Valid: true},
+			LeaveID:   l.ID,
+			CreatedBy: decider,
+		})
+		return err
+	})
+	if err != nil {
+		return LeaveRequest{}, err
+	}
+	action := "hostel.leave.reject"
+	if approve {
+		action = "hostel.leave.approve"
+	}
+	s.log(ctx, tid, actor, action, "hostel_leave_request", l.ID, map[string]string{"remark": remark})
+	return s.GetLeave(ctx, tenantID, leaveID)
+}
+
+// CheckOutLeave records a student leaving on an approved request and uses
+// its gate pass. A pass security already used at the gate is accepted.
+func (s *HostelService) CheckOutLeave(ctx context.Context, tenantID, leaveID string, actor HostelActor) (LeaveRequest, error) {
+	tid := toPgUUID(tenantID)
+	now := time.Now()
+	err := s.inTx(ctx, func(q *db.Queries) error {
+		l, err := lockLeave(ctx, q, tid, leaveID, leaveApproved)
+		if err != nil {
+			return err
+		}
+		if !l.ReturnsAt.Time.After(now) {
+			return fmt.Errorf("%w: the leave window has passed", ErrLeaveState)
+		}
+		switch l.GatePassStatus.String {
+		case "approved":
+			if _, err := q.UseGatePass(ctx, db.UseGatePassParams{ID: l.GatePassID, TenantID: tid}); err != nil {
+				return err
+			}
+		case "used":
+		default:
+			return fmt.Errorf("%w: the gate pass is not valid", ErrLeaveState)
+		}
+		at := pgtype.Timestamptz{Time: now, Valid: true}
+		if l.GatePassUsedAt.Valid {
+			at = l.GatePassUsedAt
+		}
+		return q.MarkHostelLeaveOut(ctx, tid, l.ID, at)
+	})
+	if err != nil {
+		return LeaveRequest{}, err
+	}
+	s.log(ctx, tid, actor, "hostel.leave.check_out", "hostel_leave_request", toPgUUID(leaveID), nil)
+	return s.GetLeave(ctx, tenantID, leaveID)
+}
+
+// CheckInLeave records a student back from leave. A student back early
+// gets their meals from today.
+func (s *HostelService) CheckInLeave(ctx context.Context, tenantID, leaveID string, actor HostelActor) (LeaveRequest, error) {
+	tid := toPgUUID(tenantID)
+	loc, err := s.location(ctx, tid)
+	if err != nil {
+		return LeaveRequest{}, err
+	}
+	now := time.Now()
+	err = s.inTx(ctx, func(q *db.Queries) error {
+		l, err := lockLeave(ctx, q, tid, leaveID, leaveOut)
+		if err != nil {
+			return err
+		}
+		if err := q.MarkHostelLeaveReturned(ctx, tid, l.ID, pgtype.Timestamptz{Time: now, Valid: true}); err != nil {
+			return err
+		}
+		return q.EndHostelLeaveOptOuts(ctx, tid, l.ID, pgDate(localDay(now, loc).AddDate(0, 0, -1)))
+	})
+	if err != nil {
+		return LeaveRequest{}, err
+	}
+	s.log(ctx, tid, actor, "hostel.leave.check_in", "hostel_leave_request", toPgUUID(leaveID), nil)
+	return s.GetLeave(ctx, tenantID, leaveID)
+}
+
+// CancelLeave withdraws a request before the student leaves, voiding its
+// gate pass and meal opt-outs.
+func (s *HostelService) CancelLeave(ctx context.Context, tenantID, leaveID, remark string, actor HostelActor) (LeaveRequest, error) {
+	tid := toPgUUID(tenantID)
+	remark = strings.TrimSpace(remark)
+	err := s.inTx(ctx, func(q *db.Queries) error {
+		l, err := lockLeave(ctx, q, tid, leaveID, leavePending, leaveApproved)
+		if err != nil {
+			return err
+		}
+		if l.GatePassStatus.String == "used" {
+			return fmt.Errorf("%w: the student has already passed the gate; check them out instead", ErrLeaveState)
+		}
+		if err := q.CancelHostelLeave(ctx, tid, l.ID, optionalText(remark)); err != nil {
+			return err
+		}
+		if l.GatePassID.Valid {
+			if err := q.CancelGatePass(ctx, tid, l.GatePassID); err != nil {
+				return err
+			}
+		}
+		return q.CancelHostelLeaveOptOuts(ctx, tid, l.ID)
+	})
+	if err != nil {
+		return LeaveRequest{}, err
+	}
+	s.log(ctx, tid, actor, "hostel.leave.cancel", "hostel_leave_request", toPgUUID(leaveID), map[string]string{"remark": remark})
+	return s.GetLeave(ctx, tenantID, leaveID)
+}
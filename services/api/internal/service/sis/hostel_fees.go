@@ -0,0 +1,611 @@
+package sis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/schoolerp/api/internal/db"
+	"github.com/schoolerp/api/internal/foundation/proration"
+)
+
+var (
+	ErrInvalidHostelFees     = errors.New("invalid hostel fee input")
+	ErrHostelFeeTermNotFound = errors.New("hostel fee term not found")
+	ErrHostelFeeRunNotFound  = errors.New("hostel fee run not found")
+)
+
+const (
+	hostelChargeSource = "hostel"
+	messChargeSource   = "hostel_mess"
+
+	feeCreated   = "created"
+	feeUpdated   = "updated"
+	feeUnchanged = "unchanged"
+	feeCancelled = "cancelled"
+	feeSkipped   = "skipped"
+)
+
+// DefaultHostelFeeSettings apply to tenants that have not saved their own.
+// Fees cannot be generated until a fee head is chosen.
+var DefaultHostelFeeSettings = db.HostelFeeSettings{Proration: proration.Monthly, MessRebateMinDays: 3}
+
+// Settings
+
+func (s *HostelService) GetFeeSettings(ctx context.Context, tenantID string) (db.HostelFeeSettings, error) {
+	tid := toPgUUID(tenantID)
+	settings, err := s.q.GetHostelFeeSettings(ctx, tid)
+	if errors.Is(err, pgx.ErrNoRows) {
+		settings = DefaultHostelFeeSettings
+		settings.TenantID = tid
+		return settings, nil
+	}
+	return settings, err
+}
+
+func (s *HostelService) UpdateFeeSettings(ctx context.Context, tenantID string, in db.HostelFeeSettings, actor HostelActor) (db.HostelFeeSettings, error) {
+	switch {
+	case !proration.Valid(in.Proration):
+		return db.HostelFeeSettings{}, fmt.Errorf("%w: proration must be none, monthly or daily", ErrInvalidHostelFees)
+	case !in.FeeHeadID.Valid:
+		return db.HostelFeeSettings{}, fmt.Errorf("%w: fee_head_id is required", ErrInvalidHostelFees)
+	case in.MessMonthlyFee < 0 || in.MessRebatePerDay < 0:
+		return db.HostelFeeSettings{}, fmt.Errorf("%w: amounts cannot be negative", ErrInvalidHostelFees)
+	case in.MessRebateMinDays < 1:
+		return db.HostelFeeSettings{}, fmt.Errorf("%w: mess_rebate_min_days must be at least 1", ErrInvalidHostelFees)
+	case in.MessMonthlyFee > 0 && !in.MessFeeHeadID.Valid:
+		return db.HostelFeeSettings{}, fmt.Errorf("%w: mess_fee_head_id is required when there is a mess fee", ErrInvalidHostelFees)
+	}
+	in.TenantID = toPgUUID(tenantID)
+	in.UpdatedBy = toPgUUID(actor.UserID)
+	settings, err := s.q.UpsertHostelFeeSettings(ctx, in)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return db.HostelFeeSettings{}, fmt.Errorf("%w: unknown fee head", ErrInvalidHostelFees)
+	}
+	if err != nil {
+		return settings, err
+	}
+	s.log(ctx, in.TenantID, actor, "hostel.fee_settings.update", "hostel_fee_settings", pgtype.UUID{}, settings)
+	return settings, nil
+}
+
+// Terms
+
+type HostelFeeTermInput struct {
+	AcademicYearID string
+	Name           string
+	StartDate      time.Time
+	EndDate        time.Time
+	DueDate        time.Time
+}
+
+func (s *HostelService) CreateFeeTerm(ctx context.Context, tenantID string, in HostelFeeTermInput, actor HostelActor) (db.HostelFeeTerm, error) {
+	ay := toPgUUID(in.AcademicYearID)
+	switch {
+	case !ay.Valid:
+		return db.HostelFeeTerm{}, fmt.Errorf("%w: academic_year_id is required", ErrInvalidHostelFees)
+	case strings.TrimSpace(in.Name) == "":
+		return db.HostelFeeTerm{}, fmt.Errorf("%w: name is required", ErrInvalidHostelFees)
+	case in.StartDate.IsZero() || in.EndDate.IsZero():
+		return db.HostelFeeTerm{}, fmt.Errorf("%w: start_date and end_date are required", ErrInvalidHostelFees)
+	case in.EndDate.Before(in.StartDate):
+		return db.HostelFeeTerm{}, fmt.Errorf("%w: end_date is before start_date", ErrInvalidHostelFees)
+	}
+	term, err := s.q.CreateHostelFeeTerm(ctx, db.HostelFeeTerm{
+		TenantID:       toPgUUID(tenantID),
+		AcademicYearID: ay,
+		Name:           strings.TrimSpace(in.Name),
+		StartDate:      pgDate(in.StartDate),
+		EndDate:        pgDate(in.EndDate),
+		DueDate:        pgDate(in.DueDate),
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return db.HostelFeeTerm{}, fmt.Errorf("%w: unknown academic year", ErrInvalidHostelFees)
+	}
+	if err != nil {
+		if isUniqueViolation(err) {
+			return db.HostelFeeTerm{}, fmt.Errorf("%w: the academic year already has a term with this name", ErrInvalidHostelFees)
+		}
+		return term, err
+	}
+	s.log(ctx, term.TenantID, actor, "hostel.fee_term.create", "hostel_fee_term", term.ID, term)
+	return term, nil
+}
+
+func (s *HostelService) ListFeeTerms(ctx context.Context, tenantID, academicYearID string) ([]db.HostelFeeTerm, error) {
+	return s.q.ListHostelFeeTerms(ctx, toPgUUID(tenantID), toPgUUID(academicYearID))
+}
+
+func (s *HostelService) feeTerm(ctx context.Context, tenantID pgtype.UUID, termID string) (db.HostelFeeTerm, error) {
+	term, err := s.q.GetHostelFeeTerm(ctx, tenantID, toPgUUID(termID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return term, ErrHostelFeeTermNotFound
+	}
+	return term, err
+}
+
+// ListFeeCharges returns the hostel and mess charges raised for a term.
+func (s *HostelService) ListFeeCharges(ctx context.Context, tenantID, termID string) ([]db.StudentFeeCharge, error) {
+	tid := toPgUUID(tenantID)
+	term, err := s.feeTerm(ctx, tid, termID)
+	if err != nil {
+		return nil, err
+	}
+	var out []db.StudentFeeCharge
+	for _, source := range []string{hostelChargeSource, messChargeSource} {
+		charges, err := s.q.ListStudentFeeCharges(ctx, tid, source, term.ID.String())
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, charges...)
+	}
+	return out, nil
+}
+
+// Charges
+
+type dateRange struct {
+	From, To time.Time
+}
+
+func (r dateRange) days() int {
+	return proration.Days(r.From, r.To)
+}
+
+// clip narrows r to lo..hi, reporting false when nothing is left.
+func (r dateRange) clip(lo, hi time.Time) (dateRange, bool) {
+	if r.From.Before(lo) {
+		r.From = lo
+	}
+	if r.To.After(hi) {
+		r.To = hi
+	}
+	return r, !r.To.Before(r.From)
+}
+
+// mergeRanges joins ranges that overlap or follow on from one another.
+func mergeRanges(rs []dateRange) []dateRange {
+	if len(rs) == 0 {
+		return nil
+	}
+	sorted := append([]dateRange(nil), rs...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].From.Before(sorted[j].From) })
+	out := []dateRange{sorted[0]}
+	for _, r := range sorted[1:] {
+		last := &out[len(out)-1]
+		if !r.From.After(last.To.AddDate(0, 0, 1)) {
+			if r.To.After(last.To) {
+				last.To = r.To
+			}
+			continue
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+// rebateDays counts the days a student was away from the mess for at
+// least minDays in a row while staying in the hostel. Absences are whole
+// days with every meal opted out of.
+func rebateDays(absences, stays []dateRange, minDays int) int {
+	var away []dateRange
+	for _, a := range absences {
+		for _, st := range stays {
+			if r, ok := a.clip(st.From, st.To); ok {
+				away = append(away, r)
+			}
+		}
+	}
+	total := 0
+	for _, r := range mergeRanges(away) {
+		if n := r.days(); n >= minDays {
+			total += n
+		}
+	}
+	return total
+}
+
+// HostelFeeSegment is one stay's share of a student's term rent.
+type HostelFeeSegment struct {
+	AllocationID string `json:"allocation_id"`
+	Building     string `json:"building"`
+	Room         string `json:"room"`
+	From         string `json:"from"`
+	To           string `json:"to"`
+	TermRent     int64  `json:"term_rent"`
+	Amount       int64  `json:"amount"`
+}
+
+// hostelDue is what a student owes for a term.
+type hostelDue struct {
+	StudentID       pgtype.UUID
+	StudentName     string
+	AdmissionNumber string
+	Rent            int64
+	Segments        []HostelFeeSegment
+	MessGross       int64
+	RebateDays      int
+	Rebate          int64
+
+	stays []dateRange
+}
+
+// hostelTermDues works out each resident's rent and mess fee for a term.
+// A student who changes room pays each stay's share of the term, but never
+// more than the dearest room's full-term rent. The mess fee covers the
+// days in residence, less the rebate for long absences.
+func hostelTermDues(term db.HostelFeeTerm, allocations []db.HostelFeeAllocation, absences []db.HostelFeeAbsence, settings db.HostelFeeSettings) []hostelDue {
+	var (
+		out   []hostelDue
+		index = map[pgtype.UUID]int{}
+	)
+	termStart, termEnd := term.StartDate.Time, term.EndDate.Time
+	months := int64(proration.MonthsTouched(termStart, termEnd))
+	for _, a := range allocations {
+		// A stay runs to the day before the student moved out.
+		stay := dateRange{From: a.AllottedOn.Time, To: termEnd}
+		if a.VacatedOn.Valid {
+			stay.To = a.VacatedOn.Time.AddDate(0, 0, -1)
+		}
+		stay, ok := stay.clip(termStart, termEnd)
+		if !ok {
+			continue
+		}
+		i, seen := index[a.StudentID]
+		if !seen {
+			i = len(out)
+			index[a.StudentID] = i
+			out = append(out, hostelDue{StudentID: a.StudentID, StudentName: a.StudentName, AdmissionNumber: a.AdmissionNumber})
+		}
+		d := &out[i]
+		termRent := a.MonthlyRent * months
+		d.Segments = append(d.Segments, HostelFeeSegment{
+			AllocationID: a.AllocationID.String(),
+			Building:     a.BuildingName,
+			Room:         a.RoomNumber,
+			From:         stay.From.Format("2006-01-02"),
+			To:           stay.To.Format("2006-01-02"),
+			TermRent:     termRent,
+			Amount:       proration.Prorate(termRent, termStart, termEnd, stay.From, stay.To, settings.Proration),
+		})
+		d.stays = append(d.stays, stay)
+	}
+
+	away := map[pgtype.UUID][]dateRange{}
+	for _, a := range absences {
+		away[a.StudentID] = append(away[a.StudentID], dateRange{From: a.FromDate.Time, To: a.ToDate.Time})
+	}
+	termMess := settings.MessMonthlyFee * months
+	for i := range out {
+		d := &out[i]
+		var dearest int64
+		for _, seg := range d.Segments {
+			d.Rent += seg.Amount
+			if seg.TermRent > dearest {
+				dearest = seg.TermRent
+			}
+		}
+		if d.Rent > dearest {
+			d.Rent = dearest
+		}
+
+		stays := mergeRanges(d.stays)
+		for _, st := range stays {
+			d.MessGross += proration.Prorate(termMess, termStart, termEnd, st.From, st.To, settings.Proration)
+		}
+		if d.MessGross > termMess {
+			d.MessGross = termMess
+		}
+		if settings.MessRebatePerDay > 0 {
+			d.RebateDays = rebateDays(away[d.StudentID], stays, int(settings.MessRebateMinDays))
+			d.Rebate = int64(d.RebateDays) * settings.MessRebatePerDay
+			if d.Rebate > d.MessGross {
+				d.Rebate = d.MessGross
+			}
+		}
+	}
+	return out
+}
+
+// HostelFeeLine is what a fee generation did, or would do, for one of a
+// student's charges.
+type HostelFeeLine struct {
+	Source          string             `json:"source"`
+	StudentID       string             `json:"student_id"`
+	StudentName     string             `json:"student_name"`
+	AdmissionNumber string             `json:"admission_number"`
+	Action          string             `json:"action"`
+	PreviousAmount  *int64             `json:"previous_amount,omitempty"`
+	Amount          int64              `json:"amount"`
+	Reason          string             `json:"reason,omitempty"`
+	Segments        []HostelFeeSegment `json:"segments,omitempty"`
+	MessGross       int64              `json:"mess_gross,omitempty"`
+	RebateDays      int                `json:"rebate_days,omitempty"`
+	Rebate          int64              `json:"rebate,omitempty"`
+
+	charge *db.StudentFeeCharge
+}
+
+// reconcileHostelCharges compares what each student owes under one charge
+// source with the charges already raised. Lines with a zero amount carry
+// zeroReason; charges for students who owe nothing under the source at all
+// are cancelled with goneReason.
+func reconcileHostelCharges(lines []HostelFeeLine, existing []db.StudentFeeCharge, zeroReason, goneReason string) []HostelFeeLine {
+	byStudent := make(map[string]*db.StudentFeeCharge, len(existing))
+	for i := range existing {
+		byStudent[existing[i].StudentID.String()] = &existing[i]
+	}
+	seen := map[string]bool{}
+	out := make([]HostelFeeLine, 0, len(lines))
+	for _, line := range lines {
+		seen[line.StudentID] = true
+		line.charge = byStudent[line.StudentID]
+		if c := line.charge; c != nil && c.Status == "active" {
+			prev := c.Amount
+			line.PreviousAmount = &prev
+		}
+		switch {
+		case line.Amount == 0 && line.PreviousAmount == nil:
+			line.Action, line.Reason = feeSkipped, zeroReason
+		case line.Amount == 0:
+			line.Action, line.Reason = feeCancelled, zeroReason
+		case line.charge == nil:
+			line.Action = feeCreated
+		case line.PreviousAmount == nil:
+			line.Action, line.Reason = feeUpdated, "reinstated"
+		case *line.PreviousAmount != line.Amount:
+			line.Action = feeUpdated
+		default:
+			line.Action = feeUnchanged
+		}
+		out = append(out, line)
+	}
+	for i := range existing {
+		c := &existing[i]
+		if seen[c.StudentID.String()] || c.Status != "active" {
+			continue
+		}
+		prev := c.Amount
+		out = append(out, HostelFeeLine{
+			Source:          c.Source,
+			StudentID:       c.StudentID.String(),
+			StudentName:     c.StudentName,
+			AdmissionNumber: c.AdmissionNumber,
+			Action:          feeCancelled,
+			PreviousAmount:  &prev,
+			Reason:          goneReason,
+			charge:          c,
+		})
+	}
+	return out
+}
+
+// hostelFeeLines turns the dues into rent and mess lines reconciled with
+// the charges already raised. Without a mess fee no mess lines are drawn
+// up and earlier mess charges are cancelled.
+func hostelFeeLines(dues []hostelDue, settings db.HostelFeeSettings, rentCharges, messCharges []db.StudentFeeCharge) []HostelFeeLine {
+	var rent, mess []HostelFeeLine
+	for _, d := range dues {
+		rent = append(rent, HostelFeeLine{
+			Source:          hostelChargeSource,
+			StudentID:       d.StudentID.String(),
+			StudentName:     d.StudentName,
+			AdmissionNumber: d.AdmissionNumber,
+			Amount:          d.Rent,
+			Segments:        d.Segments,
+		})
+		if settings.MessMonthlyFee > 0 {
+			mess = append(mess, HostelFeeLine{
+				Source:          messChargeSource,
+				StudentID:       d.StudentID.String(),
+				StudentName:     d.StudentName,
+				AdmissionNumber: d.AdmissionNumber,
+				Amount:          d.MessGross - d.Rebate,
+				MessGross:       d.MessGross,
+				RebateDays:      d.RebateDays,
+				Rebate:          d.Rebate,
+			})
+		}
+	}
+	out := reconcileHostelCharges(rent, rentCharges, "the rent is zero", "no stay in the term")
+	messGone := "no stay in the term"
+	if settings.MessMonthlyFee == 0 {
+		messGone = "no mess fee is set"
+	}
+	return append(out, reconcileHostelCharges(mess, messCharges, "fully rebated", messGone)...)
+}
+
+// HostelFeeRunReport reconciles a term's hostel and mess charges with the
+// stays: what was created, changed, left alone, cancelled or skipped for
+// each student.
+type HostelFeeRunReport struct {
+	RunID     string           `json:"run_id,omitempty"`
+	Term      db.HostelFeeTerm `json:"term"`
+	DryRun    bool             `json:"dry_run"`
+	Created   int              `json:"created"`
+	Updated   int              `json:"updated"`
+	Unchanged int              `json:"unchanged"`
+	Cancelled int              `json:"cancelled"`
+	Skipped   int              `json:"skipped"`
+	Billed    int64            `json:"billed"`
+	Lines     []HostelFeeLine  `json:"lines"`
+}
+
+func (r *HostelFeeRunReport) count() {
+	for _, l := range r.Lines {
+		switch l.Action {
+		case feeCreated:
+			r.Created++
+		case feeUpdated:
+			r.Updated++
+		case feeUnchanged:
+			r.Unchanged++
+		case feeCancelled:
+			r.Cancelled++
+		case feeSkipped:
+			r.Skipped++
+		}
+		switch l.Action {
+		case feeCreated, feeUpdated, feeUnchanged:
+			r.Billed += l.Amount
+		}
+	}
+}
+
+// GenerateFees works out every resident's hostel rent and mess fee for the
+// term and brings their ledger charges in line with it. Running it again
+// changes nothing unless stays, rents, opt-outs or settings changed. A dry
+// run reports what would happen without changing anything.
+func (s *HostelService) GenerateFees(ctx context.Context, tenantID, termID string, dryRun bool, actor HostelActor) (HostelFeeRunReport, error) {
+	tid := toPgUUID(tenantID)
+	settings, err := s.GetFeeSettings(ctx, tenantID)
+	if err != nil {
+		return HostelFeeRunReport{}, err
+	}
+	if !settings.FeeHeadID.Valid {
+		return HostelFeeRunReport{}, fmt.Errorf("%w: choose the fee head for hostel fees in the fee settings first", ErrInvalidHostelFees)
+	}
+	if settings.MessMonthlyFee > 0 && !settings.MessFeeHeadID.Valid {
+		return HostelFeeRunReport{}, fmt.Errorf("%w: choose the fee head for mess fees in the fee settings first", ErrInvalidHostelFees)
+	}
+	term, err := s.feeTerm(ctx, tid, termID)
+	if err != nil {
+		return HostelFeeRunReport{}, err
+	}
+
+	allocations, err := s.q.ListHostelFeeAllocations(ctx, tid, term.StartDate, term.EndDate)
+	if err != nil {
+		return HostelFeeRunReport{}, err
+	}
+	absences, err := s.q.ListHostelFullDayOptOuts(ctx, tid, term.StartDate, term.EndDate)
+	if err != nil {
+		return HostelFeeRunReport{}, err
+	}
+	rentCharges, err := s.q.ListStudentFeeCharges(ctx, tid, hostelChargeSource, term.ID.String())
+	if err != nil {
+		return HostelFeeRunReport{}, err
+	}
+	messCharges, err := s.q.ListStudentFeeCharges(ctx, tid, messChargeSource, term.ID.String())
+	if err != nil {
+		return HostelFeeRunReport{}, err
+	}
+
+	dues := hostelTermDues(term, allocations, absences, settings)
+	report := HostelFeeRunReport{Term: term, DryRun: dryRun, Lines: hostelFeeLines(dues, settings, rentCharges, messCharges)}
+	report.count()
+	if dryRun {
+		return report, nil
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return HostelFeeRunReport{}, err
+	}
+	defer tx.Rollback(ctx)
+	qtx := s.q.WithTx(tx)
+
+	due := term.DueDate
+	if !due.Valid {
+		due = term.StartDate
+	}
+	for _, line := range report.Lines {
+		head := settings.FeeHeadID
+		description := fmt.Sprintf("Hostel fee %s %s", term.AcademicYearName, term.Name)
+		detail := map[string]any{"term_id": term.ID.String(), "segments": line.Segments}
+		if line.Source == messChargeSource {
+			head = settings.MessFeeHeadID
+			description = fmt.Sprintf("Mess fee %s %s", term.AcademicYearName, term.Name)
+			detail = map[string]any{"term_id": term.ID.String(), "gross": line.MessGross, "rebate_days": line.RebateDays, "rebate": line.Rebate}
+		}
+		details, err := json.Marshal(detail)
+		if err != nil {
+			return HostelFeeRunReport{}, err
+		}
+		switch line.Action {
+		case feeCreated:
+			_, err = qtx.PostStudentFeeCharge(ctx, db.PostStudentFeeChargeParams{
+				TenantID:       tid,
+				StudentID:      toPgUUID(line.StudentID),
+				Source:         line.Source,
+				SourceKey:      term.ID.String() + "/" + line.StudentID,
+				Period:         pgtype.Text{String: term.ID.String(), Valid: true},
+				FeeHeadID:      head,
+				AcademicYearID: term.AcademicYearID,
+				Description:    description,
+				Amount:         line.Amount,
+				DueDate:        due,
+				Details:        details,
+			})
+		case feeUpdated:
+			_, err = qtx.UpdateStudentFeeCharge(ctx, db.UpdateStudentFeeChargeParams{
+				TenantID:    tid,
+				ID:          line.charge.ID,
+				FeeHeadID:   head,
+				Description: description,
+				Amount:      line.Amount,
+				DueDate:     due,
+				Details:     details,
+			})
+		case feeCancelled:
+			_, err = qtx.CancelStudentFeeCharge(ctx, tid, line.charge.ID)
+		}
+		if err != nil {
+			return HostelFeeRunReport{}, fmt.Errorf("%s %s %s: %w", line.Action, line.Source, line.StudentName, err)
+		}
+	}
+
+	body, err := json.Marshal(report.Lines)
+	if err != nil {
+		return HostelFeeRunReport{}, err
+	}
+	run, err := qtx.CreateHostelFeeRun(ctx, db.HostelFeeRun{
+		TenantID:       tid,
+		TermID:         term.ID,
+		CreatedCount:   int32(report.Created),
+		UpdatedCount:   int32(report.Updated),
+		UnchangedCount: int32(report.Unchanged),
+		CancelledCount: int32(report.Cancelled),
+		SkippedCount:   int32(report.Skipped),
+		Report:         body,
+		CreatedBy:      toPgUUID(actor.UserID),
+	})
+	if err != nil {
+		return HostelFeeRunReport{}, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return HostelFeeRunReport{}, err
+	}
+	report.RunID = run.ID.String()
+	s.log(ctx, tid, actor, "hostel.fees.generate", "hostel_fee_run", run.ID, map[string]any{
+		"term_id":   term.ID.String(),
+		"created":   report.Created,
+		"updated":   report.Updated,
+		"unchanged": report.Unchanged,
+		"cancelled": report.Cancelled,
+		"skipped":   report.Skipped,
+	})
+	return report, nil
+}
+
+func (s *HostelService) ListFeeRuns(ctx context.Context, tenantID, termID string) ([]db.HostelFeeRun, error) {
+	tid := toPgUUID(tenantID)
+	term, err := s.feeTerm(ctx, tid, termID)
+	if err != nil {
+		return nil, err
+	}
+	return s.q.ListHostelFeeRuns(ctx, tid, term.ID)
+}
+
+func (s *HostelService) GetFeeRun(ctx context.Context, tenantID, runID string) (db.HostelFeeRun, error) {
+	run, err := s.q.GetHostelFeeRun(ctx, toPgUUID(tenantID), toPgUUID(runID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return run, ErrHostelFeeRunNotFound
+	}
+	return run, err
+}
@@ -0,0 +1,177 @@
+package sis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/schoolerp/api/internal/db"
+	"github.com/schoolerp/api/internal/foundation/proration"
+)
+
+func day(s string) time.Time {
+	d, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func uuid(b byte) pgtype.UUID {
+	return pgtype.UUID{Bytes: [16]byte{b}, Valid: true}
+}
+
+var testTerm = db.HostelFeeTerm{
+	ID:        uuid(9),
+	StartDate: pgtype.Date{Time: day("2025-04-01"), Valid: true},
+	EndDate:   pgtype.Date{Time: day("2025-09-30"), Valid: true},
+}
+
+func stay(student, alloc byte, rent int64, from, vacated string) db.HostelFeeAllocation {
+	a := db.HostelFeeAllocation{
+		AllocationID: uuid(alloc),
+		StudentID:    uuid(student),
+		StudentName:  "Student",
+		MonthlyRent:  rent,
+		AllottedOn:   pgtype.Date{Time: day(from), Valid: true},
+	}
+	if vacated != "" {
+		a.VacatedOn = pgtype.Date{Time: day(vacated), Valid: true}
+	}
+	return a
+}
+
+func TestHostelRentProratedAndCapped(t *testing.T) {
+	settings := db.HostelFeeSettings{Proration: proration.Monthly}
+	dues := hostelTermDues(testTerm, []db.HostelFeeAllocation{
+		// Joined mid-May: May to September is five of six months.
+		stay(1, 1, 500000, "2025-05-15", ""),
+		// Moved rooms on 16 June; June counts in both rooms, but the total
+		// is held to the dearer room's full term.
+		stay(2, 2, 500000, "2025-01-10", "2025-06-16"),
+		stay(2, 3, 600000, "2025-06-16", ""),
+		// Left the day the term started: no stay in the term.
+		stay(3, 4, 500000, "2025-01-10", "2025-04-01"),
+	}, nil, settings)
+	if len(dues) != 2 {
+		t.Fatalf("expected two students, got %+v", dues)
+	}
+	if dues[0].Rent != 2500000 {
+		t.Fatalf("mid-term joiner rent = %d, want 2500000", dues[0].Rent)
+	}
+	if len(dues[1].Segments) != 2 || dues[1].Segments[0].To != "2025-06-15" {
+		t.Fatalf("unexpected segments %+v", dues[1].Segments)
+	}
+	// 3 months at 5000 plus 4 months at 6000 is 39000, over the 36000 term.
+	if dues[1].Rent != 3600000 {
+		t.Fatalf("transferred rent = %d, want 3600000", dues[1].Rent)
+	}
+}
+
+func TestHostelMessRebate(t *testing.T) {
+	settings := db.HostelFeeSettings{Proration: proration.Daily, MessMonthlyFee: 300000, MessRebatePerDay: 8000, MessRebateMinDays: 3}
+	absence := func(from, to string) db.HostelFeeAbsence {
+		return db.HostelFeeAbsence{
+			StudentID: uuid(1),
+			FromDate:  pgtype.Date{Time: day(from), Valid: true},
+			ToDate:    pgtype.Date{Time: day(to), Valid: true},
+		}
+	}
+	dues := hostelTermDues(testTerm, []db.HostelFeeAllocation{
+		stay(1, 1, 500000, "2025-03-01", "2025-07-01"),
+		stay(1, 2, 500000, "2025-07-01", ""),
+	}, []db.HostelFeeAbsence{
+		// Two days away: too short for a rebate.
+		absence("2025-04-10", "2025-04-11"),
+		// Overlapping opt-outs across the room change merge into 28 June to
+		// 3 July, six days.
+		absence("2025-06-28", "2025-07-01"),
+		absence("2025-07-01", "2025-07-03"),
+		// Runs past the term end: only 28 to 30 September count.
+		absence("2025-09-28", "2025-10-05"),
+	}, settings)
+	if len(dues) != 1 {
+		t.Fatalf("expected one student, got %+v", dues)
+	}
+	d := dues[0]
+	if d.MessGross != 1800000 {
+		t.Fatalf("mess gross = %d, want the full term", d.MessGross)
+	}
+	if d.RebateDays != 9 || d.Rebate != 72000 {
+		t.Fatalf("rebate = %d days, %d; want 9 days, 72000", d.RebateDays, d.Rebate)
+	}
+}
+
+func TestRebateNeverExceedsMess(t *testing.T) {
+	settings := db.HostelFeeSettings{Proration: proration.Daily, MessMonthlyFee: 1000, MessRebatePerDay: 5000, MessRebateMinDays: 1}
+	dues := hostelTermDues(testTerm, []db.HostelFeeAllocation{stay(1, 1, 0, "2025-04-01", "")}, []db.HostelFeeAbsence{{
+		StudentID: uuid(1),
+		FromDate:  pgtype.Date{Time: day("2025-04-01"), Valid: true},
+		ToDate:    pgtype.Date{Time: day("2025-04-30"), Valid: true},
+	}}, settings)
+	if dues[0].Rebate != dues[0].MessGross {
+		t.Fatalf("rebate %d should be capped at %d", dues[0].Rebate, dues[0].MessGross)
+	}
+}
+
+func TestHostelFeeLinesReconcile(t *testing.T) {
+	settings := db.HostelFeeSettings{MessMonthlyFee: 300000}
+	dues := []hostelDue{
+		{StudentID: uuid(1), Rent: 3000000, MessGross: 1800000},
+		{StudentID: uuid(2), Rent: 3000000, MessGross: 1800000, Rebate: 1800000},
+		{StudentID: uuid(3), Rent: 2500000, MessGross: 1500000},
+	}
+	rent := []db.StudentFeeCharge{
+		{ID: uuid(11), StudentID: uuid(1), Source: hostelChargeSource, Amount: 3000000, Status: "active"},
+		{ID: uuid(13), StudentID: uuid(3), Source: hostelChargeSource, Amount: 3000000, Status: "active"},
+		{ID: uuid(14), StudentID: uuid(4), Source: hostelChargeSource, Amount: 3000000, Status: "active"},
+	}
+	mess := []db.StudentFeeCharge{
+		{ID: uuid(22), StudentID: uuid(2), Source: messChargeSource, Amount: 1800000, Status: "active"},
+	}
+	want := map[string]string{
+		hostelChargeSource + uuid(1).String(): feeUnchanged,
+		hostelChargeSource + uuid(2).String(): feeCreated,
+		hostelChargeSource + uuid(3).String(): feeUpdated,
+		hostelChargeSource + uuid(4).String(): feeCancelled,
+		messChargeSource + uuid(1).String():   feeCreated,
+		messChargeSource + uuid(2).String():   feeCancelled,
+		messChargeSource + uuid(3).String():   feeCreated,
+	}
+	lines := hostelFeeLines(dues, settings, rent, mess)
+	if len(lines) != len(want) {
+		t.Fatalf("expected %d lines, got %+v", len(want), lines)
+	}
+	for _, l := range lines {
+		if got := want[l.Source+l.StudentID]; got != l.Action {
+			t.Fatalf("%s charge for %s: action %s, want %s", l.Source, l.StudentID, l.Action, got)
+		}
+	}
+
+	// Without a mess fee, mess charges already raised are cancelled.
+	lines = hostelFeeLines(dues, db.HostelFeeSettings{}, nil, mess)
+	last := lines[len(lines)-1]
+	if last.Source != messChargeSource || last.Action != feeCancelled || last.Reason != "no mess fee is set" {
+		t.Fatalf("unexpected mess line %+v", last)
+	}
+}
+
+func TestLeaveMealDays(t *testing.T) {
+	loc := time.FixedZone("IST", 5*3600+1800)
+	from, to, ok := leaveMealDays(
+		time.Date(2025, 7, 4, 16, 0, 0, 0, loc),
+		time.Date(2025, 7, 8, 18, 0, 0, 0, loc),
+		loc,
+	)
+	if !ok || !from.Equal(day("2025-07-05")) || !to.Equal(day("2025-07-07")) {
+		t.Fatalf("meal days = %s to %s (%v)", from, to, ok)
+	}
+	// Leaving in the evening and back the next morning misses no whole day.
+	if _, _, ok := leaveMealDays(
+		time.Date(2025, 7, 4, 18, 0, 0, 0, loc),
+		time.Date(2025, 7, 5, 9, 0, 0, 0, loc),
+		loc,
+	); ok {
+		t.Fatalf("an overnight leave should not opt out of meals")
+	}
+}
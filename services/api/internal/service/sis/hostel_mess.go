@@ -0,0 +1,296 @@
+package sis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/schoolerp/api/internal/db"
+)
+
+var ErrOptOutNotFound = errors.New("meal opt-out not found")
+
+const (
+	maxMenuDays   = 62
+	maxOptOutDays = 90
+)
+
+func validMeal(meal string) bool {
+	for _, m := range hostelMeals {
+		if m == meal {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeMeals checks and orders a meal list; an empty list means every
+// meal.
+func normalizeMeals(meals []string) ([]string, error) {
+	if len(meals) == 0 {
+		return hostelMeals, nil
+	}
+	want := map[string]bool{}
+	for _, m := range meals {
+		m = strings.ToLower(strings.TrimSpace(m))
+		if !validMeal(m) {
+			return nil, fmt.Errorf("%w: meal must be one of %s", ErrInvalidHostel, strings.Join(hostelMeals, ", "))
+		}
+		want[m] = true
+	}
+	var out []string
+	for _, m := range hostelMeals {
+		if want[m] {
+			out = append(out, m)
+		}
+	}
+	return out, nil
+}
+
+type MenuEntry struct {
+	Date  string `json:"date"`
+	Meal  string `json:"meal"`
+	Items string `json:"items"`
+	Notes string `json:"notes"`
+}
+
+// SetMenu writes mess menu entries. An entry with no items clears that
+// meal's menu.
+func (s *HostelService) SetMenu(ctx context.Context, tenantID string, entries []MenuEntry, actor HostelActor) ([]db.HostelMessMenu, error) {
+	tid := toPgUUID(tenantID)
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("%w: no menu entries", ErrInvalidHostel)
+	}
+	var first, last time.Time
+	for i, e := range entries {
+		d, err := parseHostelDate(e.Date, time.Time{})
+		if err != nil {
+			return nil, err
+		}
+		if d.IsZero() {
+			return nil, fmt.Errorf("%w: date is required", ErrInvalidHostel)
+		}
+		entries[i].Meal = strings.ToLower(strings.TrimSpace(e.Meal))
+		if !validMeal(entries[i].Meal) {
+			return nil, fmt.Errorf("%w: meal must be one of %s", ErrInvalidHostel, strings.Join(hostelMeals, ", "))
+		}
+		if first.IsZero() || d.Before(first) {
+			first = d
+		}
+		if d.After(last) {
+			last = d
+		}
+	}
+	if last.Sub(first) > maxMenuDays*24*time.Hour {
+		return nil, fmt.Errorf("%w: a menu update can span at most %d days", ErrInvalidHostel, maxMenuDays)
+	}
+
+	err := s.inTx(ctx, func(q *db.Queries) error {
+		for _, e := range entries {
+			d, _ := parseHostelDate(e.Date, time.Time{})
+			items := strings.TrimSpace(e.Items)
+			if items == "" {
+				if err := q.DeleteHostelMessMenu(ctx, tid, pgDate(d), e.Meal); err != nil {
+					return err
+				}
+				continue
+			}
+			if _, err := q.UpsertHostelMessMenu(ctx, db.HostelMessMenu{
+				TenantID:  tid,
+				MenuDate:  pgDate(d),
+				Meal:      e.Meal,
+				Items:     items,
+				Notes:     optionalText(strings.TrimSpace(e.Notes)),
+				UpdatedBy: toPgUUID(actor.UserID),
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.log(ctx, tid, actor, "hostel.mess_menu.update", "hostel_mess_menu", pgtype.UUID{}, map[string]any{
+		"from": first.Format("2006-01-02"), "to": last.Format("2006-01-02"), "entries": len(entries),
+	})
+	return s.q.ListHostelMessMenus(ctx, tid, pgDate(first), pgDate(last))
+}
+
+// Menu returns the mess menu from from to to, the coming week by default.
+func (s *HostelService) Menu(ctx context.Context, tenantID, from, to string) ([]db.HostelMessMenu, error) {
+	tid := toPgUUID(tenantID)
+	today, err := s.today(ctx, tid)
+	if err != nil {
+		return nil, err
+	}
+	start, err := parseHostelDate(from, today)
+	if err != nil {
+		return nil, err
+	}
+	end, err := parseHostelDate(to, start.AddDate(0, 0, 6))
+	if err != nil {
+		return nil, err
+	}
+	if end.Before(start) || end.Sub(start) > maxMenuDays*24*time.Hour {
+		return nil, fmt.Errorf("%w: the range must run forwards and span at most %d days", ErrInvalidHostel, maxMenuDays)
+	}
+	return s.q.ListHostelMessMenus(ctx, tid, pgDate(start), pgDate(end))
+}
+
+type OptOutInput struct {
+	StudentID string   `json:"student_id"`
+	FromDate  string   `json:"from_date"`
+	ToDate    string   `json:"to_date"`
+	Meals     []string `json:"meals"`
+	Reason    string   `json:"reason"`
+}
+
+// OptOut records a resident skipping meals over a run of days, so the
+// kitchen can plan for fewer. Past meals cannot be opted out of.
+func (s *HostelService) OptOut(ctx context.Context, tenantID string, in OptOutInput, actor HostelActor) (db.HostelMealOptOut, error) {
+	tid := toPgUUID(tenantID)
+	today, err := s.today(ctx, tid)
+	if err != nil {
+		return db.HostelMealOptOut{}, err
+	}
+	from, err := parseHostelDate(in.FromDate, time.Time{})
+	if err != nil {
+		return db.HostelMealOptOut{}, err
+	}
+	if from.IsZero() {
+		return db.HostelMealOptOut{}, fmt.Errorf("%w: from_date is required", ErrInvalidHostel)
+	}
+	to, err := parseHostelDate(in.ToDate, from)
+	if err != nil {
+		return db.HostelMealOptOut{}, err
+	}
+	if from.Before(today) {
+		return db.HostelMealOptOut{}, fmt.Errorf("%w: cannot opt out of past meals", ErrInvalidHostel)
+	}
+	if to.Before(from) || to.Sub(from) > maxOptOutDays*24*time.Hour {
+		return db.HostelMealOptOut{}, fmt.Errorf("%w: to_date must be on or after from_date and within %d days", ErrInvalidHostel, maxOptOutDays)
+	}
+	meals, err := normalizeMeals(in.Meals)
+	if err != nil {
+		return db.HostelMealOptOut{}, err
+	}
+	if _, err := s.q.GetActiveHostelAllocation(ctx, tid, toPgUUID(in.StudentID)); errors.Is(err, pgx.ErrNoRows) {
+		return db.HostelMealOptOut{}, fmt.Errorf("%w: the student has no hostel bed", ErrInvalidHostel)
+	} else if err != nil {
+		return db.HostelMealOptOut{}, err
+	}
+	o, err := s.q.CreateHostelMealOptOut(ctx, db.HostelMealOptOut{
+		TenantID:  tid,
+		StudentID: toPgUUID(in.StudentID),
+		FromDate:  pgDate(from),
+		ToDate:    pgDate(to),
+		Meals:     meals,
+		Reason:    optionalText(strings.TrimSpace(in.Reason)),
+		CreatedBy: toPgUUID(actor.UserID),
+	})
+	if err != nil {
+		return db.HostelMealOptOut{}, err
+	}
+	s.log(ctx, tid, actor, "hostel.meal_opt_out.create", "hostel_meal_opt_out", o.ID, o)
+	return o, nil
+}
+
+// CancelOptOut withdraws an opt-out. Opt-outs made by a leave go with the
+// leave.
+func (s *HostelService) CancelOptOut(ctx context.Context, tenantID, id string, actor HostelActor) (db.HostelMealOptOut, error) {
+	tid := toPgUUID(tenantID)
+	var o db.HostelMealOptOut
+	err := s.inTx(ctx, func(q *db.Queries) error {
+		var err error
+		o, err = q.CancelHostelMealOptOut(ctx, tid, toPgUUID(id))
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrOptOutNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if o.LeaveID.Valid {
+			return fmt.Errorf("%w: this opt-out belongs to a leave; cancel the leave instead", ErrHostelState)
+		}
+		return nil
+	})
+	if err != nil {
+		return db.HostelMealOptOut{}, err
+	}
+	s.log(ctx, tid, actor, "hostel.meal_opt_out.cancel", "hostel_meal_opt_out", o.ID, nil)
+	return o, nil
+}
+
+// ListOptOuts returns active opt-outs overlapping from to to, for one
+// student or all; the coming week by default.
+func (s *HostelService) ListOptOuts(ctx context.Context, tenantID, studentID, from, to string) ([]db.HostelMealOptOut, error) {
+	tid := toPgUUID(tenantID)
+	today, err := s.today(ctx, tid)
+	if err != nil {
+		return nil, err
+	}
+	start, err := parseHostelDate(from, today)
+	if err != nil {
+		return nil, err
+	}
+	end, err := parseHostelDate(to, start.AddDate(0, 0, 6))
+	if err != nil {
+		return nil, err
+	}
+	if end.Before(start) {
+		return nil, fmt.Errorf("%w: to must be on or after from", ErrInvalidHostel)
+	}
+	return s.q.ListHostelMealOptOuts(ctx, tid, toPgUUID(studentID), pgDate(start), pgDate(end))
+}
+
+type MealCount struct {
+	Meal      string `json:"meal"`
+	Residents int32  `json:"residents"`
+	OptedOut  int32  `json:"opted_out"`
+	Expected  int32  `json:"expected"`
+}
+
+type MealCountReport struct {
+	Date       string               `json:"date"`
+	Totals     []MealCount          `json:"totals"`
+	ByBuilding []db.HostelMealCount `json:"by_building"`
+}
+
+// MealCounts is how many residents the kitchen should expect at each meal
+// on a day, today by default.
+func (s *HostelService) MealCounts(ctx context.Context, tenantID, date string) (MealCountReport, error) {
+	tid := toPgUUID(tenantID)
+	today, err := s.today(ctx, tid)
+	if err != nil {
+		return MealCountReport{}, err
+	}
+	day, err := parseHostelDate(date, today)
+	if err != nil {
+		return MealCountReport{}, err
+	}
+	rows, err := s.q.ListHostelMealCounts(ctx, tid, pgDate(day))
+	if err != nil {
+		return MealCountReport{}, err
+	}
+	report := MealCountReport{Date: day.Format("2006-01-02"), ByBuilding: rows}
+	if report.ByBuilding == nil {
+		report.ByBuilding = []db.HostelMealCount{}
+	}
+	for _, meal := range hostelMeals {
+		c := MealCount{Meal: meal}
+		for _, r := range rows {
+			if r.Meal == meal {
+				c.Residents += r.Residents
+				c.OptedOut += r.OptedOut
+			}
+		}
+		c.Expected = c.Residents - c.OptedOut
+		report.Totals = append(report.Totals, c)
+	}
+	return report, nil
+}
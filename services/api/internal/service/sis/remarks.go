@@ -5,9 +5,16 @@ import (
 
 	"github.com/schoolerp/api/internal/db"
 	"github.com/schoolerp/api/internal/foundation/audit"
+	"github.com/schoolerp/api/internal/foundation/datascope"
 )
 
-func (s *StudentService) CreateStudentRemark(ctx context.Context, arg db.CreateStudentRemarkParams) (db.StudentRemark, error) {
+// CreateStudentRemark posts a remark on a student. An actor outside the
+// student's scope gets a *datascope.Violation.
+func (s *StudentService) CreateStudentRemark(ctx context.Context, arg db.CreateStudentRemarkParams, actor datascope.Actor) (db.StudentRemark, error) {
+	if err := s.scope.AuthorizeStudent(ctx, arg.TenantID.String(), actor, arg.StudentID.String()); err != nil {
+		return db.StudentRemark{}, err
+	}
+
 	remark, err := s.q.CreateStudentRemark(ctx, arg)
 	if err != nil {
 		return db.StudentRemark{}, err
@@ -25,7 +32,12 @@ After:        remark,
 	return remark, nil
 }
 
-func (s *StudentService) ListStudentRemarks(ctx context.Context, arg db.ListStudentRemarksParams) ([]db.ListStudentRemarksRow, error) {
+// ListStudentRemarks returns the remarks on a student. An actor outside the
+// student's scope gets a *datascope.Violation.
+func (s *StudentService) ListStudentRemarks(ctx context.Context, arg db.ListStudentRemarksParams, actor datascope.Actor) ([]db.ListStudentRemarksRow, error) {
+	if err := s.scope.AuthorizeStudent(ctx, arg.TenantID.String(), actor, arg.StudentID.String()); err != nil {
+		return nil, err
+	}
 	return s.q.ListStudentRemarks(ctx, arg)
 }
 
@@ -3,6 +3,7 @@ package sis
 import (
 	"context"
 	"encoding/csv"
+	"encoding/json"
 	"fmt"
 	"io"
 	"strings"
@@ -10,6 +11,7 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/schoolerp/api/internal/db"
 	"github.com/schoolerp/api/internal/foundation/audit"
+	"github.com/schoolerp/api/internal/foundation/datascope"
 	"github.com/schoolerp/api/internal/foundation/quota"
 )
 
@@ -17,10 +19,11 @@ type StudentService struct {
 	q     db.Querier
 	audit *audit.Logger
 	quota *quota.Service
+	scope *datascope.Service
 }
 
-func NewStudentService(q db.Querier, audit *audit.Logger, quota *quota.Service) *StudentService {
-	return &StudentService{q: q, audit: audit, quota: quota}
+func NewStudentService(q db.Querier, audit *audit.Logger, quota *quota.Service, scope *datascope.Service) *StudentService {
+	return &StudentService{q: q, audit: audit, quota: quota, scope: scope}
 }
 
 type CreateStudentParams struct {
@@ -88,6 +91,20 @@ func (s *StudentService) CreateStudent(ctx context.Context, p CreateStudentParam
 		IPAddress:    p.IP,
 	})
 
+	// 4. Outbox Event for integrations
+	payload, _ := json.Marshal(map[string]interface{}{
+		"student_id":       student.ID,
+		"admission_number": student.AdmissionNumber,
+		"full_name":        student.FullName,
+		"section_id":       student.SectionID,
+		"status":           student.Status,
+	})
+	_, _ = s.q.CreateOutboxEvent(ctx, db.CreateOutboxEventParams{
+		TenantID:  tenantUUID,
+		EventType: "student.created",
+		Payload:   payload,
+	})
+
 	return student, nil
 }
 
@@ -143,7 +160,13 @@ func (s *StudentService) SearchStudents(ctx context.Context, tenantID, userID, r
 	})
 }
 
-func (s *StudentService) GetStudent(ctx context.Context, tenantID, studentID string) (db.GetStudentRow, error) {
+// GetStudent returns a student the actor may see; out-of-scope requests fail
+// with a *datascope.Violation.
+func (s *StudentService) GetStudent(ctx context.Context, tenantID, studentID string, actor datascope.Actor) (db.GetStudentRow, error) {
+	if err := s.scope.AuthorizeStudent(ctx, tenantID, actor, studentID); err != nil {
+		return db.GetStudentRow{}, err
+	}
+
 	tUUID := pgtype.UUID{}
 	tUUID.Scan(tenantID)
 
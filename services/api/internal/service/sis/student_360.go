@@ -2,21 +2,24 @@ package sis
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"time"
 
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/schoolerp/api/internal/foundation/audit"
+	"github.com/schoolerp/api/internal/foundation/keyring"
 )
 
 type Student360Service struct {
 	pool  *pgxpool.Pool
 	audit *audit.Logger
+	keys  *keyring.Service
 }
 
-func NewStudent360Service(pool *pgxpool.Pool, audit *audit.Logger) *Student360Service {
-	return &Student360Service{pool: pool, audit: audit}
+func NewStudent360Service(pool *pgxpool.Pool, audit *audit.Logger, keys *keyring.Service) *Student360Service {
+	return &Student360Service{pool: pool, audit: audit, keys: keys}
 }
 
 // Behavioral Log Structs
@@ -121,32 +124,70 @@ func (s *Student360Service) ListBehavioralLogs(ctx context.Context, studentID st
 
 // --- Health Logic ---
 
+// healthDetails is the encrypted part of a health record.
+type healthDetails struct {
+	Allergies         []string `json:"allergies"`
+	Vaccinations      []string `json:"vaccinations"`
+	MedicalConditions string   `json:"medical_conditions"`
+}
+
 func (s *Student360Service) UpsertHealthRecord(ctx context.Context, tenantID string, h HealthRecord) error {
-	_, err := s.pool.Exec(ctx, `
-		INSERT INTO student_health_records (tenant_id, student_id, blood_group, allergies, vaccinations, medical_conditions, height_cm, weight_kg, last_updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, CURRENT_TIMESTAMP)
+	details, err := json.Marshal(healthDetails{
+		Allergies:         h.Allergies,
+		Vaccinations:      h.Vaccinations,
+		MedicalConditions: h.MedicalConditions,
+	})
+	if err != nil {
+		return err
+	}
+	encrypted, err := s.keys.Encrypt(ctx, tenantID, details)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt health record: %w", err)
+	}
+
+	// The plaintext columns are kept empty once the details are encrypted.
+	_, err = s.pool.Exec(ctx, `
+		INSERT INTO student_health_records (tenant_id, student_id, blood_group, allergies, vaccinations, medical_conditions, encrypted_details, height_cm, weight_kg, last_updated_at)
+		VALUES ($1, $2, $3, '[]', '[]', NULL, $4, $5, $6, CURRENT_TIMESTAMP)
 		ON CONFLICT (student_id) DO UPDATE SET
 			blood_group = EXCLUDED.blood_group,
-			allergies = EXCLUDED.allergies,
-			vaccinations = EXCLUDED.vaccinations,
-			medical_conditions = EXCLUDED.medical_conditions,
+			allergies = '[]',
+			vaccinations = '[]',
+			medical_conditions = NULL,
+			encrypted_details = EXCLUDED.encrypted_details,
 			height_cm = EXCLUDED.height_cm,
 			weight_kg = EXCLUDED.weight_kg,
 			last_updated_at = CURRENT_TIMESTAMP
-	`, tenantID, h.StudentID, h.BloodGroup, h.Allergies, h.Vaccinations, h.MedicalConditions, h.HeightCm, h.WeightKg)
+		WHERE student_health_records.tenant_id = EXCLUDED.tenant_id
+	`, tenantID, h.StudentID, h.BloodGroup, encrypted, h.HeightCm, h.WeightKg)
 	return err
 }
 
-func (s *Student360Service) GetHealthRecord(ctx context.Context, studentID string) (*HealthRecord, error) {
+func (s *Student360Service) GetHealthRecord(ctx context.Context, tenantID, studentID string) (*HealthRecord, error) {
 	var h HealthRecord
+	var conditions, encrypted pgtype.Text
 	err := s.pool.QueryRow(ctx, `
-		SELECT student_id, blood_group, allergies, vaccinations, medical_conditions, height_cm, weight_kg, last_updated_at
+		SELECT student_id, blood_group, allergies, vaccinations, medical_conditions, encrypted_details, height_cm, weight_kg, last_updated_at
 		FROM student_health_records
-		WHERE student_id = $1
-	`, studentID).Scan(&h.StudentID, &h.BloodGroup, &h.Allergies, &h.Vaccinations, &h.MedicalConditions, &h.HeightCm, &h.WeightKg, &h.LastUpdatedAt)
+		WHERE tenant_id = $1 AND student_id = $2
+	`, tenantID, studentID).Scan(&h.StudentID, &h.BloodGroup, &h.Allergies, &h.Vaccinations, &conditions, &encrypted, &h.HeightCm, &h.WeightKg, &h.LastUpdatedAt)
 	if err != nil {
 		return nil, err
 	}
+	h.MedicalConditions = conditions.String
+
+	// Records not yet re-encrypted still read from the plaintext columns.
+	if encrypted.Valid && encrypted.String != "" {
+		plain, err := s.keys.Decrypt(ctx, tenantID, encrypted.String)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt health record: %w", err)
+		}
+		var d healthDetails
+		if err := json.Unmarshal(plain, &d); err != nil {
+			return nil, err
+		}
+		h.Allergies, h.Vaccinations, h.MedicalConditions = d.Allergies, d.Vaccinations, d.MedicalConditions
+	}
 	return &h, nil
 }
 
@@ -239,7 +280,7 @@ func (s *Student360Service) GetStudent360(ctx context.Context, tenantID, student
 	}
 
 	// 4. Health
-	health, _ := s.GetHealthRecord(ctx, studentID)
+	health, _ := s.GetHealthRecord(ctx, tenantID, studentID)
 
 	// 5. Documents
 	docs, _ := s.ListDocuments(ctx, studentID)
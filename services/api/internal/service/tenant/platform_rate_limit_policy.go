@@ -0,0 +1,90 @@
+package tenant
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/schoolerp/api/internal/foundation/ratelimit"
+)
+
+var ErrInvalidRateLimitPolicy = ratelimit.ErrInvalidPolicy
+
+type PlatformRateLimitPolicy struct {
+	Groups    map[string]ratelimit.GroupPolicy `json:"groups"`
+	UpdatedAt *time.Time                       `json:"updated_at,omitempty"`
+}
+
+type UpdatePlatformRateLimitPolicyParams struct {
+	Groups    map[string]ratelimit.GroupPolicy `json:"groups"`
+	UpdatedBy string                           `json:"-"`
+}
+
+func (s *Service) GetPlatformRateLimitPolicy(ctx context.Context) (PlatformRateLimitPolicy, error) {
+	const query = `
+		SELECT value, updated_at
+		FROM platform_settings
+		WHERE key = $1
+		LIMIT 1
+	`
+
+	out := PlatformRateLimitPolicy{Groups: map[string]ratelimit.GroupPolicy{}}
+
+	var raw []byte
+	var updatedAt pgtype.Timestamptz
+	err := s.db.QueryRow(ctx, query, ratelimit.PolicySettingKey).Scan(&raw, &updatedAt)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return out, nil
+		}
+		return PlatformRateLimitPolicy{}, err
+	}
+
+	if policy, err := ratelimit.ParsePolicy(raw); err == nil && policy.Groups != nil {
+		out.Groups = policy.Groups
+	}
+	if updatedAt.Valid {
+		v := updatedAt.Time
+		out.UpdatedAt = &v
+	}
+	return out, nil
+}
+
+// UpdatePlatformRateLimitPolicy replaces the per-route-group quotas. Groups
+// left out fall back to the limits hard-coded on their routes.
+func (s *Service) UpdatePlatformRateLimitPolicy(ctx context.Context, params UpdatePlatformRateLimitPolicyParams) (PlatformRateLimitPolicy, error) {
+	groups := make(map[string]ratelimit.GroupPolicy, len(params.Groups))
+	for name, group := range params.Groups {
+		groups[strings.ToLower(strings.TrimSpace(name))] = group
+	}
+	policy := ratelimit.Policy{Groups: groups}
+	if err := policy.Validate(); err != nil {
+		return PlatformRateLimitPolicy{}, err
+	}
+
+	raw, err := json.Marshal(policy)
+	if err != nil {
+		return PlatformRateLimitPolicy{}, err
+	}
+
+	var updatedBy pgtype.UUID
+	_ = updatedBy.Scan(strings.TrimSpace(params.UpdatedBy))
+
+	const upsert = `
+		INSERT INTO platform_settings (key, value, updated_by, updated_at)
+		VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (key)
+		DO UPDATE SET
+			value = EXCLUDED.value,
+			updated_by = EXCLUDED.updated_by,
+			updated_at = NOW()
+	`
+	if _, err := s.db.Exec(ctx, upsert, ratelimit.PolicySettingKey, raw, updatedBy); err != nil {
+		return PlatformRateLimitPolicy{}, err
+	}
+
+	return s.GetPlatformRateLimitPolicy(ctx)
+}
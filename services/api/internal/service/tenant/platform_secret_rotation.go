@@ -8,11 +8,13 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"strings"
 	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/schoolerp/api/internal/db"
 )
 
 var (
@@ -78,6 +80,7 @@ type ExecutePlatformSecretRotationResult struct {
 	GeneratedSecret string                           `json:"generated_secret"`
 	EnvVar          string                           `json:"env_var"`
 	Instructions    []string                         `json:"instructions"`
+	ReencryptionJob *db.DataReencryptionJob          `json:"reencryption_job,omitempty"`
 }
 
 func normalizeSecretName(raw string) (string, string, bool) {
@@ -444,6 +447,19 @@ func (s *Service) ExecutePlatformSecretRotation(ctx context.Context, requestID s
 		return ExecutePlatformSecretRotationResult{}, err
 	}
 
+	// Queued before the request is marked executed, so a failure leaves the
+	// request approved and the rotation can be retried. The job waits until
+	// the API runs with the new key first in DATA_ENCRYPTION_KEYS, then
+	// rotates tenant data keys, re-wraps them and re-encrypts stored values.
+	var reencryption *db.DataReencryptionJob
+	if secretName == "data_encryption" {
+		job, err := s.keys.EnqueueReencryption(ctx, requestID, fingerprint[:16])
+		if err != nil {
+			return ExecutePlatformSecretRotationResult{}, fmt.Errorf("queue re-encryption job: %w", err)
+		}
+		reencryption = &job
+	}
+
 	payload.ExecutedAt = time.Now().UTC().Format(time.RFC3339)
 	payload.GeneratedFormat = "base64_32_bytes"
 	payload.GeneratedFingerprint = fingerprint
@@ -472,8 +488,12 @@ func (s *Service) ExecutePlatformSecretRotation(ctx context.Context, requestID s
 		"Redeploy the API service so the new environment configuration takes effect.",
 		"After the grace window, remove old secrets from " + envVar + " and redeploy again.",
 	}
-	if secretName == "data_encryption" {
-		instructions = append(instructions, "Plan a controlled re-encryption job before removing old encryption keys.")
+	if reencryption != nil {
+		instructions = []string{
+			"Update the backend environment variable " + envVar + " to start with this new secret and keep the previous keys after it.",
+			"Redeploy the API service; re-encryption job " + reencryption.ID.String() + " starts once the new key is primary.",
+			"Remove old keys from " + envVar + " only after the job has completed without failures, then redeploy again.",
+		}
 	}
 
 	return ExecutePlatformSecretRotationResult{
@@ -481,5 +501,12 @@ func (s *Service) ExecutePlatformSecretRotation(ctx context.Context, requestID s
 		GeneratedSecret: secret,
 		EnvVar:          envVar,
 		Instructions:    instructions,
+		ReencryptionJob: reencryption,
 	}, nil
 }
+
+// ListDataReencryptionJobs returns re-encryption runs queued by
+// data_encryption rotations, newest first.
+func (s *Service) ListDataReencryptionJobs(ctx context.Context, limit, offset int32) ([]db.DataReencryptionJob, error) {
+	return s.keys.ListReencryptionJobs(ctx, limit, offset)
+}
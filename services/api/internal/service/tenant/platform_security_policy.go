@@ -3,6 +3,9 @@ package tenant
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"regexp"
+	"sort"
 	"strings"
 	"time"
 
@@ -10,14 +13,23 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+var ErrInvalidMFAPolicy = errors.New("invalid mfa policy")
+
+var mfaPolicyRolePattern = regexp.MustCompile(`^[a-z0-9_]{1,64}$`)
+
 type PlatformSecurityPolicy struct {
-	EnforceInternalMFA bool       `json:"enforce_internal_mfa"`
-	UpdatedAt          *time.Time `json:"updated_at,omitempty"`
+	EnforceInternalMFA bool `json:"enforce_internal_mfa"`
+	// PhishingResistantRoles must sign in with a WebAuthn credential; TOTP is
+	// not accepted as their second factor.
+	PhishingResistantRoles []string   `json:"phishing_resistant_roles"`
+	UpdatedAt              *time.Time `json:"updated_at,omitempty"`
 }
 
 type UpdatePlatformMFAPolicyParams struct {
-	EnforceInternalMFA bool   `json:"enforce_internal_mfa"`
-	UpdatedBy          string `json:"-"`
+	EnforceInternalMFA bool `json:"enforce_internal_mfa"`
+	// Nil keeps the current list so older clients posting only the flag do not clear it.
+	PhishingResistantRoles *[]string `json:"phishing_resistant_roles,omitempty"`
+	UpdatedBy              string    `json:"-"`
 }
 
 func (s *Service) GetPlatformSecurityPolicy(ctx context.Context) (PlatformSecurityPolicy, error) {
@@ -38,13 +50,20 @@ func (s *Service) GetPlatformSecurityPolicy(ctx context.Context) (PlatformSecuri
 		return PlatformSecurityPolicy{}, err
 	}
 
-	out := PlatformSecurityPolicy{}
+	out := PlatformSecurityPolicy{PhishingResistantRoles: []string{}}
 	if len(raw) > 0 {
 		var payload map[string]interface{}
 		if err := json.Unmarshal(raw, &payload); err == nil {
 			if v, ok := payload["enforce_for_internal_users"].(bool); ok {
 				out.EnforceInternalMFA = v
 			}
+			if roles, ok := payload["phishing_resistant_roles"].([]interface{}); ok {
+				for _, role := range roles {
+					if code, ok := role.(string); ok {
+						out.PhishingResistantRoles = append(out.PhishingResistantRoles, code)
+					}
+				}
+			}
 		}
 	}
 	if updatedAt.Valid {
@@ -55,8 +74,24 @@ func (s *Service) GetPlatformSecurityPolicy(ctx context.Context) (PlatformSecuri
 }
 
 func (s *Service) UpdatePlatformMFAPolicy(ctx context.Context, params UpdatePlatformMFAPolicyParams) (PlatformSecurityPolicy, error) {
+	var roles []string
+	if params.PhishingResistantRoles != nil {
+		normalized, err := normalizeMFAPolicyRoles(*params.PhishingResistantRoles)
+		if err != nil {
+			return PlatformSecurityPolicy{}, err
+		}
+		roles = normalized
+	} else {
+		current, err := s.GetPlatformSecurityPolicy(ctx)
+		if err != nil {
+			return PlatformSecurityPolicy{}, err
+		}
+		roles = current.PhishingResistantRoles
+	}
+
 	payload := map[string]interface{}{
 		"enforce_for_internal_users": params.EnforceInternalMFA,
+		"phishing_resistant_roles":   roles,
 		"updated_at":                 time.Now().UTC().Format(time.RFC3339),
 	}
 	raw, err := json.Marshal(payload)
@@ -82,3 +117,24 @@ func (s *Service) UpdatePlatformMFAPolicy(ctx context.Context, params UpdatePlat
 
 	return s.GetPlatformSecurityPolicy(ctx)
 }
+
+func normalizeMFAPolicyRoles(in []string) ([]string, error) {
+	seen := make(map[string]struct{}, len(in))
+	out := make([]string, 0, len(in))
+	for _, role := range in {
+		code := strings.ToLower(strings.TrimSpace(role))
+		if code == "" {
+			continue
+		}
+		if !mfaPolicyRolePattern.MatchString(code) {
+			return nil, ErrInvalidMFAPolicy
+		}
+		if _, dup := seen[code]; dup {
+			continue
+		}
+		seen[code] = struct{}{}
+		out = append(out, code)
+	}
+	sort.Strings(out)
+	return out, nil
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"strings"
 	"time"
 
@@ -457,6 +458,13 @@ func (s *Service) ExecuteTenantDeletion(ctx context.Context, tenantID, requestID
 		return err
 	}
 
+	// Crypto-shred: destroying the tenant's data keys makes its encrypted
+	// bank details, health records and confidential notes unrecoverable,
+	// including copies in backups.
+	if err := s.keys.ShredTenant(ctx, tenantID); err != nil {
+		return fmt.Errorf("destroy tenant data keys: %w", err)
+	}
+
 	var payload TenantDeletionRequestPayload
 	_ = json.Unmarshal(payloadRaw, &payload)
 	payload.ExecutedAt = time.Now().UTC().Format(time.RFC3339)
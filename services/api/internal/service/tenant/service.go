@@ -15,6 +15,7 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/schoolerp/api/internal/db"
+	"github.com/schoolerp/api/internal/foundation/keyring"
 	"github.com/schoolerp/api/internal/foundation/sessionstore"
 )
 
@@ -22,10 +23,11 @@ type Service struct {
 	q            *db.Queries
 	db           *pgxpool.Pool
 	sessionStore *sessionstore.Store
+	keys         *keyring.Service
 }
 
-func NewService(q *db.Queries, pool *pgxpool.Pool, store *sessionstore.Store) *Service {
-	return &Service{q: q, db: pool, sessionStore: store}
+func NewService(q *db.Queries, pool *pgxpool.Pool, store *sessionstore.Store, keys *keyring.Service) *Service {
+	return &Service{q: q, db: pool, sessionStore: store, keys: keys}
 }
 
 type TenantConfig struct {
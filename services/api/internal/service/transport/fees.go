@@ -0,0 +1,797 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/schoolerp/api/internal/db"
+	"github.com/schoolerp/api/internal/foundation/audit"
+	"github.com/schoolerp/api/internal/foundation/proration"
+)
+
+var (
+	ErrInvalidFees        = errors.New("invalid transport fee input")
+	ErrFeeTermNotFound    = errors.New("transport fee term not found")
+	ErrFareZoneNotFound   = errors.New("fare zone not found")
+	ErrFeeRunNotFound     = errors.New("transport fee run not found")
+	ErrAllocationNotFound = errors.New("transport allocation not found")
+)
+
+const (
+	feeChargeSource = "transport"
+
+	fareModeSlab = "slab"
+	fareModeZone = "zone"
+
+	tripTwoWay = "two_way"
+	tripPickup = "pickup"
+	tripDrop   = "drop"
+
+	feeCreated   = "created"
+	feeUpdated   = "updated"
+	feeUnchanged = "unchanged"
+	feeCancelled = "cancelled"
+	feeSkipped   = "skipped"
+)
+
+// DefaultFeeSettings apply to tenants that have not saved their own. Fees
+// cannot be generated until a fee head is chosen.
+var DefaultFeeSettings = db.TransportFeeSettings{FareMode: fareModeSlab, Proration: proration.Monthly}
+
+// FeeService works out term transport fares from distance slabs or zones
+// and posts them to students' fee ledgers.
+type FeeService struct {
+	q     *db.Queries
+	pool  *pgxpool.Pool
+	audit *audit.Logger
+}
+
+func NewFeeService(q *db.Queries, pool *pgxpool.Pool, audit *audit.Logger) *FeeService {
+	return &FeeService{q: q, pool: pool, audit: audit}
+}
+
+func (s *FeeService) log(ctx context.Context, tenantID pgtype.UUID, actor TrackingActor, action, resourceType string, resourceID pgtype.UUID, after any) {
+	if s.audit == nil {
+		return
+	}
+	_ = s.audit.Log(ctx, audit.Entry{
+		TenantID:     tenantID,
+		UserID:       toPgUUID(actor.UserID),
+		RequestID:    actor.RequestID,
+		Action:       action,
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+		After:        after,
+		IPAddress:    actor.IP,
+	})
+}
+
+// Settings
+
+func (s *FeeService) GetSettings(ctx context.Context, tenantID string) (db.TransportFeeSettings, error) {
+	tid := toPgUUID(tenantID)
+	settings, err := s.q.GetTransportFeeSettings(ctx, tid)
+	if errors.Is(err, pgx.ErrNoRows) {
+		settings = DefaultFeeSettings
+		settings.TenantID = tid
+		return settings, nil
+	}
+	return settings, err
+}
+
+func (s *FeeService) UpdateSettings(ctx context.Context, tenantID string, in db.TransportFeeSettings, actor TrackingActor) (db.TransportFeeSettings, error) {
+	if in.FareMode != fareModeSlab && in.FareMode != fareModeZone {
+		return db.TransportFeeSettings{}, fmt.Errorf("%w: fare_mode must be slab or zone", ErrInvalidFees)
+	}
+	if !proration.Valid(in.Proration) {
+		return db.TransportFeeSettings{}, fmt.Errorf("%w: proration must be none, monthly or daily", ErrInvalidFees)
+	}
+	if !in.FeeHeadID.Valid {
+		return db.TransportFeeSettings{}, fmt.Errorf("%w: fee_head_id is required", ErrInvalidFees)
+	}
+	in.TenantID = toPgUUID(tenantID)
+	in.UpdatedBy = toPgUUID(actor.UserID)
+	settings, err := s.q.UpsertTransportFeeSettings(ctx, in)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return db.TransportFeeSettings{}, fmt.Errorf("%w: unknown fee head", ErrInvalidFees)
+	}
+	if err != nil {
+		return settings, err
+	}
+	s.log(ctx, in.TenantID, actor, "transport.fee_settings.update", "transport_fee_settings", pgtype.UUID{}, settings)
+	return settings, nil
+}
+
+// Fare tables
+
+func (s *FeeService) ListSlabs(ctx context.Context, tenantID string) ([]db.TransportFareSlab, error) {
+	return s.q.ListTransportFareSlabs(ctx, toPgUUID(tenantID))
+}
+
+// validateSlabs sorts the slabs and checks they do not overlap. Only the
+// last slab may be open-ended.
+func validateSlabs(slabs []db.TransportFareSlab) error {
+	sort.SliceStable(slabs, func(i, j int) bool { return slabs[i].FromKm < slabs[j].FromKm })
+	for i, sl := range slabs {
+		switch {
+		case sl.FromKm < 0:
+			return fmt.Errorf("%w: from_km cannot be negative", ErrInvalidFees)
+		case sl.ToKm.Valid && sl.ToKm.Float64 <= sl.FromKm:
+			return fmt.Errorf("%w: to_km must be above from_km in the slab from %g km", ErrInvalidFees, sl.FromKm)
+		case sl.OneWayAmount < 0 || sl.TwoWayAmount < 0:
+			return fmt.Errorf("%w: amounts cannot be negative", ErrInvalidFees)
+		}
+		if i == len(slabs)-1 {
+			break
+		}
+		if !sl.ToKm.Valid {
+			return fmt.Errorf("%w: only the last slab can be open-ended", ErrInvalidFees)
+		}
+		if next := slabs[i+1].FromKm; next < sl.ToKm.Float64 {
+			return fmt.Errorf("%w: the slabs from %g km and %g km overlap", ErrInvalidFees, sl.FromKm, next)
+		}
+	}
+	return nil
+}
+
+// ReplaceSlabs swaps the whole distance fare table for a new one.
+func (s *FeeService) ReplaceSlabs(ctx context.Context, tenantID string, slabs []db.TransportFareSlab, actor TrackingActor) ([]db.TransportFareSlab, error) {
+	if err := validateSlabs(slabs); err != nil {
+		return nil, err
+	}
+	tid := toPgUUID(tenantID)
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+	qtx := s.q.WithTx(tx)
+	if err := qtx.DeleteTransportFareSlabs(ctx, tid); err != nil {
+		return nil, err
+	}
+	for _, sl := range slabs {
+		if err := qtx.CreateTransportFareSlab(ctx, tid, sl); err != nil {
+			return nil, err
+		}
+	}
+	out, err := qtx.ListTransportFareSlabs(ctx, tid)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	s.log(ctx, tid, actor, "transport.fare_slabs.replace", "transport_fare_slab", pgtype.UUID{}, out)
+	return out, nil
+}
+
+func (s *FeeService) ListZones(ctx context.Context, tenantID string) ([]db.TransportFareZone, error) {
+	return s.q.ListTransportFareZones(ctx, toPgUUID(tenantID))
+}
+
+func validateZone(z db.TransportFareZone) error {
+	if strings.TrimSpace(z.Name) == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidFees)
+	}
+	if z.OneWayAmount < 0 || z.TwoWayAmount < 0 {
+		return fmt.Errorf("%w: amounts cannot be negative", ErrInvalidFees)
+	}
+	return nil
+}
+
+func (s *FeeService) CreateZone(ctx context.Context, tenantID string, in db.TransportFareZone, actor TrackingActor) (db.TransportFareZone, error) {
+	if err := validateZone(in); err != nil {
+		return db.TransportFareZone{}, err
+	}
+	in.TenantID = toPgUUID(tenantID)
+	in.Name = strings.TrimSpace(in.Name)
+	zone, err := s.q.CreateTransportFareZone(ctx, in)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return db.TransportFareZone{}, fmt.Errorf("%w: a zone with this name exists", ErrInvalidFees)
+		}
+		return zone, err
+	}
+	s.log(ctx, zone.TenantID, actor, "transport.fare_zone.create", "transport_fare_zone", zone.ID, zone)
+	return zone, nil
+}
+
+func (s *FeeService) UpdateZone(ctx context.Context, tenantID, zoneID string, in db.TransportFareZone, actor TrackingActor) (db.TransportFareZone, error) {
+	if err := validateZone(in); err != nil {
+		return db.TransportFareZone{}, err
+	}
+	in.TenantID, in.ID = toPgUUID(tenantID), toPgUUID(zoneID)
+	in.Name = strings.TrimSpace(in.Name)
+	zone, err := s.q.UpdateTransportFareZone(ctx, in)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return db.TransportFareZone{}, ErrFareZoneNotFound
+	}
+	if err != nil {
+		if isUniqueViolation(err) {
+			return db.TransportFareZone{}, fmt.Errorf("%w: a zone with this name exists", ErrInvalidFees)
+		}
+		return zone, err
+	}
+	s.log(ctx, zone.TenantID, actor, "transport.fare_zone.update", "transport_fare_zone", zone.ID, zone)
+	return zone, nil
+}
+
+func (s *FeeService) DeleteZone(ctx context.Context, tenantID, zoneID string, actor TrackingActor) error {
+	tid, zid := toPgUUID(tenantID), toPgUUID(zoneID)
+	err := s.q.DeleteTransportFareZone(ctx, tid, zid)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrFareZoneNotFound
+	}
+	if err != nil {
+		return err
+	}
+	s.log(ctx, tid, actor, "transport.fare_zone.delete", "transport_fare_zone", zid, nil)
+	return nil
+}
+
+// SetStopFare sets the zone and the road distance from the school a stop is
+// charged by. Without a distance, the straight-line distance from the
+// school location in the planning settings is used.
+func (s *FeeService) SetStopFare(ctx context.Context, tenantID, stopID, zoneID string, distanceKm *float64, actor TrackingActor) error {
+	tid, sid := toPgUUID(tenantID), toPgUUID(stopID)
+	zid := toPgUUID(zoneID)
+	if zoneID != "" && !zid.Valid {
+		return fmt.Errorf("%w: invalid zone_id", ErrInvalidFees)
+	}
+	if distanceKm != nil && *distanceKm < 0 {
+		return fmt.Errorf("%w: distance_km cannot be negative", ErrInvalidFees)
+	}
+	err := s.q.SetTransportStopFare(ctx, tid, sid, zid, optionalFloat(distanceKm))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("%w, or the zone is not this school's", ErrStopNotFound)
+	}
+	if err != nil {
+		return err
+	}
+	s.log(ctx, tid, actor, "transport.stop_fare.update", "transport_route_stop", sid, map[string]any{
+		"zone_id":     zoneID,
+		"distance_km": distanceKm,
+	})
+	return nil
+}
+
+// ValidTripType reports whether t is a trip type an allocation can have.
+func ValidTripType(t string) bool {
+	return t == tripTwoWay || t == tripPickup || t == tripDrop
+}
+
+// SetAllocationTripType records whether a student rides both ways or only
+// to or from school, which decides the fare.
+func (s *FeeService) SetAllocationTripType(ctx context.Context, tenantID, allocationID, tripType string, actor TrackingActor) error {
+	if !ValidTripType(tripType) {
+		return fmt.Errorf("%w: trip_type must be two_way, pickup or drop", ErrInvalidFees)
+	}
+	tid, aid := toPgUUID(tenantID), toPgUUID(allocationID)
+	err := s.q.SetTransportAllocationTripType(ctx, tid, aid, tripType)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrAllocationNotFound
+	}
+	if err != nil {
+		return err
+	}
+	s.log(ctx, tid, actor, "transport.allocation.trip_type", "transport_allocation", aid, map[string]any{"trip_type": tripType})
+	return nil
+}
+
+// Terms
+
+type FeeTermInput struct {
+	AcademicYearID string
+	Name           string
+	StartDate      time.Time
+	EndDate        time.Time
+	DueDate        time.Time
+}
+
+func (s *FeeService) CreateTerm(ctx context.Context, tenantID string, in FeeTermInput, actor TrackingActor) (db.TransportFeeTerm, error) {
+	ay := toPgUUID(in.AcademicYearID)
+	switch {
+	case !ay.Valid:
+		return db.TransportFeeTerm{}, fmt.Errorf("%w: academic_year_id is required", ErrInvalidFees)
+	case strings.TrimSpace(in.Name) == "":
+		return db.TransportFeeTerm{}, fmt.Errorf("%w: name is required", ErrInvalidFees)
+	case in.StartDate.IsZero() || in.EndDate.IsZero():
+		return db.TransportFeeTerm{}, fmt.Errorf("%w: start_date and end_date are required", ErrInvalidFees)
+	case in.EndDate.Before(in.StartDate):
+		return db.TransportFeeTerm{}, fmt.Errorf("%w: end_date is before start_date", ErrInvalidFees)
+	}
+	term, err := s.q.CreateTransportFeeTerm(ctx, db.TransportFeeTerm{
+		TenantID:       toPgUUID(tenantID),
+		AcademicYearID: ay,
+		Name:           strings.TrimSpace(in.Name),
+		StartDate:      pgtype.Date{Time: in.StartDate, Valid: true},
+		EndDate:        pgtype.Date{Time: in.EndDate, Valid: true},
+		DueDate:        pgtype.Date{Time: in.DueDate, Valid: !in.DueDate.IsZero()},
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return db.TransportFeeTerm{}, fmt.Errorf("%w: unknown academic year", ErrInvalidFees)
+	}
+	if err != nil {
+		if isUniqueViolation(err) {
+			return db.TransportFeeTerm{}, fmt.Errorf("%w: the academic year already has a term with this name", ErrInvalidFees)
+		}
+		return term, err
+	}
+	s.log(ctx, term.TenantID, actor, "transport.fee_term.create", "transport_fee_term", term.ID, term)
+	return term, nil
+}
+
+func (s *FeeService) ListTerms(ctx context.Context, tenantID, academicYearID string) ([]db.TransportFeeTerm, error) {
+	return s.q.ListTransportFeeTerms(ctx, toPgUUID(tenantID), toPgUUID(academicYearID))
+}
+
+// CurrentTerm returns the fee term whose dates cover the given day.
+func (s *FeeService) CurrentTerm(ctx context.Context, tenantID string, on time.Time) (db.TransportFeeTerm, error) {
+	terms, err := s.q.ListTransportFeeTerms(ctx, toPgUUID(tenantID), pgtype.UUID{})
+	if err != nil {
+		return db.TransportFeeTerm{}, err
+	}
+	term, ok := termCovering(terms, on)
+	if !ok {
+		return db.TransportFeeTerm{}, fmt.Errorf("%w: no term covers %s", ErrFeeTermNotFound, on.Format("2006-01-02"))
+	}
+	return term, nil
+}
+
+func termCovering(terms []db.TransportFeeTerm, on time.Time) (db.TransportFeeTerm, bool) {
+	d := time.Date(on.Year(), on.Month(), on.Day(), 0, 0, 0, 0, time.UTC)
+	for _, t := range terms {
+		if !t.StartDate.Time.After(d) && !t.EndDate.Time.Before(d) {
+			return t, true
+		}
+	}
+	return db.TransportFeeTerm{}, false
+}
+
+func (s *FeeService) term(ctx context.Context, tenantID pgtype.UUID, termID string) (db.TransportFeeTerm, error) {
+	term, err := s.q.GetTransportFeeTerm(ctx, tenantID, toPgUUID(termID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return term, ErrFeeTermNotFound
+	}
+	return term, err
+}
+
+// ListCharges returns the transport charges raised for a term.
+func (s *FeeService) ListCharges(ctx context.Context, tenantID, termID string) ([]db.StudentFeeCharge, error) {
+	tid := toPgUUID(tenantID)
+	term, err := s.term(ctx, tid, termID)
+	if err != nil {
+		return nil, err
+	}
+	return s.q.ListStudentFeeCharges(ctx, tid, feeChargeSource, term.ID.String())
+}
+
+// Fares
+
+// fareTable prices a stop for a whole term.
+type fareTable struct {
+	mode   string
+	slabs  []db.TransportFareSlab
+	zones  map[pgtype.UUID]db.TransportFareZone
+	school *LatLng
+}
+
+// distanceKm is the stop's recorded distance, or the road distance from the
+// school estimated from its location.
+func (f fareTable) distanceKm(a db.TransportFeeAllocation) (float64, bool) {
+	if a.DistanceKm.Valid {
+		return a.DistanceKm.Float64, true
+	}
+	if f.school == nil || !a.Latitude.Valid || !a.Longitude.Valid {
+		return 0, false
+	}
+	return round2(distanceMeters(*f.school, LatLng{Lat: a.Latitude.Float64, Lng: a.Longitude.Float64}) * roadFactor / 1000), true
+}
+
+// fare returns the term fare for an allocation and what it was based on,
+// or why it cannot be priced.
+func (f fareTable) fare(a db.TransportFeeAllocation) (amount int64, basis, problem string) {
+	if !a.StopID.Valid {
+		return 0, "", fmt.Sprintf("allocation on %s has no stop", a.RouteName)
+	}
+	pick := func(oneWay, twoWay int64) int64 {
+		if a.TripType == tripPickup || a.TripType == tripDrop {
+			return oneWay
+		}
+		return twoWay
+	}
+	if f.mode == fareModeZone {
+		zone, ok := f.zones[a.ZoneID]
+		if !ok {
+			return 0, "", fmt.Sprintf("stop %s has no fare zone", a.StopName.String)
+		}
+		return pick(zone.OneWayAmount, zone.TwoWayAmount), "zone " + zone.Name, ""
+	}
+	km, ok := f.distanceKm(a)
+	if !ok {
+		return 0, "", fmt.Sprintf("stop %s has no distance or location", a.StopName.String)
+	}
+	for _, sl := range f.slabs {
+		if km >= sl.FromKm && (!sl.ToKm.Valid || km < sl.ToKm.Float64) {
+			label := fmt.Sprintf("%g km, slab from %g km", km, sl.FromKm)
+			if sl.ToKm.Valid {
+				label = fmt.Sprintf("%g km, slab %g-%g km", km, sl.FromKm, sl.ToKm.Float64)
+			}
+			return pick(sl.OneWayAmount, sl.TwoWayAmount), label, ""
+		}
+	}
+	return 0, "", fmt.Sprintf("no fare slab covers %g km (stop %s)", km, a.StopName.String)
+}
+
+// FeeSegment is one allocation's share of a student's term charge.
+type FeeSegment struct {
+	AllocationID string `json:"allocation_id"`
+	Route        string `json:"route"`
+	Stop         string `json:"stop,omitempty"`
+	TripType     string `json:"trip_type"`
+	Basis        string `json:"basis,omitempty"`
+	From         string `json:"from"`
+	To           string `json:"to"`
+	TermFare     int64  `json:"term_fare"`
+	Amount       int64  `json:"amount"`
+}
+
+// studentFare is what a student owes for a term.
+type studentFare struct {
+	StudentID       pgtype.UUID
+	StudentName     string
+	AdmissionNumber string
+	Amount          int64
+	Segments        []FeeSegment
+	Problem         string
+}
+
+// termFares works out each student's charge for the term. A student who
+// changes stop pays for each allocation's share of the term, but never more
+// than the dearest full-term fare among them. A student with an allocation
+// that cannot be priced gets no charge and the reason instead.
+func termFares(term db.TransportFeeTerm, allocations []db.TransportFeeAllocation, table fareTable, mode string) []studentFare {
+	var (
+		out   []studentFare
+		index = map[pgtype.UUID]int{}
+	)
+	termStart, termEnd := term.StartDate.Time, term.EndDate.Time
+	for _, a := range allocations {
+		i, ok := index[a.StudentID]
+		if !ok {
+			i = len(out)
+			index[a.StudentID] = i
+			out = append(out, studentFare{StudentID: a.StudentID, StudentName: a.StudentName, AdmissionNumber: a.AdmissionNumber})
+		}
+		sf := &out[i]
+
+		from, to := termStart, termEnd
+		if a.StartDate.Time.After(from) {
+			from = a.StartDate.Time
+		}
+		if a.EndDate.Valid && a.EndDate.Time.Before(to) {
+			to = a.EndDate.Time
+		}
+		seg := FeeSegment{
+			AllocationID: a.AllocationID.String(),
+			Route:        a.RouteName,
+			Stop:         a.StopName.String,
+			TripType:     a.TripType,
+			From:         from.Format("2006-01-02"),
+			To:           to.Format("2006-01-02"),
+		}
+		fare, basis, problem := table.fare(a)
+		if problem != "" && sf.Problem == "" {
+			sf.Problem = problem
+		}
+		seg.Basis, seg.TermFare = basis, fare
+		seg.Amount = proration.Prorate(fare, termStart, termEnd, from, to, mode)
+		sf.Segments = append(sf.Segments, seg)
+	}
+
+	for i := range out {
+		sf := &out[i]
+		if sf.Problem != "" {
+			continue
+		}
+		var total, dearest int64
+		for _, seg := range sf.Segments {
+			total += seg.Amount
+			if seg.TermFare > dearest {
+				dearest = seg.TermFare
+			}
+		}
+		if total > dearest {
+			total = dearest
+		}
+		sf.Amount = total
+	}
+	return out
+}
+
+// FeeReportLine is what a fee generation did, or would do, for a student.
+type FeeReportLine struct {
+	StudentID       string       `json:"student_id"`
+	StudentName     string       `json:"student_name"`
+	AdmissionNumber string       `json:"admission_number"`
+	Action          string       `json:"action"`
+	PreviousAmount  *int64       `json:"previous_amount,omitempty"`
+	Amount          int64        `json:"amount"`
+	Reason          string       `json:"reason,omitempty"`
+	Segments        []FeeSegment `json:"segments,omitempty"`
+
+	charge *db.StudentFeeCharge
+}
+
+// reconcile compares the fares due with the charges already raised. Skipped
+// students keep whatever charge they have.
+func reconcile(fares []studentFare, existing []db.StudentFeeCharge) []FeeReportLine {
+	byStudent := make(map[pgtype.UUID]*db.StudentFeeCharge, len(existing))
+	for i := range existing {
+		byStudent[existing[i].StudentID] = &existing[i]
+	}
+	seen := map[pgtype.UUID]bool{}
+	var lines []FeeReportLine
+	for _, f := range fares {
+		seen[f.StudentID] = true
+		line := FeeReportLine{
+			StudentID:       f.StudentID.String(),
+			StudentName:     f.StudentName,
+			AdmissionNumber: f.AdmissionNumber,
+			Amount:          f.Amount,
+			Segments:        f.Segments,
+			charge:          byStudent[f.StudentID],
+		}
+		if c := line.charge; c != nil && c.Status == "active" {
+			prev := c.Amount
+			line.PreviousAmount = &prev
+		}
+		switch {
+		case f.Problem != "":
+			line.Action, line.Reason, line.Amount = feeSkipped, f.Problem, 0
+		case f.Amount == 0 && line.PreviousAmount == nil:
+			line.Action, line.Reason = feeSkipped, "the fare is zero"
+		case f.Amount == 0:
+			line.Action, line.Reason = feeCancelled, "the fare is zero"
+		case line.charge == nil:
+			line.Action = feeCreated
+		case line.PreviousAmount == nil:
+			line.Action, line.Reason = feeUpdated, "reinstated"
+		case *line.PreviousAmount != f.Amount:
+			line.Action = feeUpdated
+		default:
+			line.Action = feeUnchanged
+		}
+		lines = append(lines, line)
+	}
+	for i := range existing {
+		c := &existing[i]
+		if seen[c.StudentID] || c.Status != "active" {
+			continue
+		}
+		prev := c.Amount
+		lines = append(lines, FeeReportLine{
+			StudentID:       c.StudentID.String(),
+			StudentName:     c.StudentName,
+			AdmissionNumber: c.AdmissionNumber,
+			Action:          feeCancelled,
+			PreviousAmount:  &prev,
+			Reason:          "no allocation in the term",
+			charge:          c,
+		})
+	}
+	return lines
+}
+
+// FeeRunReport reconciles the transport charges of a term with the
+// allocations: what was created, changed, left alone, cancelled or skipped
+// for each student.
+type FeeRunReport struct {
+	RunID     string              `json:"run_id,omitempty"`
+	Term      db.TransportFeeTerm `json:"term"`
+	DryRun    bool                `json:"dry_run"`
+	Created   int                 `json:"created"`
+	Updated   int                 `json:"updated"`
+	Unchanged int                 `json:"unchanged"`
+	Cancelled int                 `json:"cancelled"`
+	Skipped   int                 `json:"skipped"`
+	Billed    int64               `json:"billed"`
+	Lines     []FeeReportLine     `json:"lines"`
+}
+
+func (r *FeeRunReport) count() {
+	for _, l := range r.Lines {
+		switch l.Action {
+		case feeCreated:
+			r.Created++
+		case feeUpdated:
+			r.Updated++
+		case feeUnchanged:
+			r.Unchanged++
+		case feeCancelled:
+			r.Cancelled++
+		case feeSkipped:
+			r.Skipped++
+		}
+		switch l.Action {
+		case feeCreated, feeUpdated, feeUnchanged:
+			r.Billed += l.Amount
+		case feeSkipped:
+			if l.PreviousAmount != nil {
+				r.Billed += *l.PreviousAmount
+			}
+		}
+	}
+}
+
+// GenerateFees works out every allocated student's transport fare for the
+// term and brings their ledger charges in line with it. Running it again
+// changes nothing unless allocations, stops or fares changed. A dry run
+// reports what would happen without changing anything.
+func (s *FeeService) GenerateFees(ctx context.Context, tenantID, termID string, dryRun bool, actor TrackingActor) (FeeRunReport, error) {
+	tid := toPgUUID(tenantID)
+	settings, err := s.GetSettings(ctx, tenantID)
+	if err != nil {
+		return FeeRunReport{}, err
+	}
+	if !settings.FeeHeadID.Valid {
+		return FeeRunReport{}, fmt.Errorf("%w: choose the fee head for transport fees in the fee settings first", ErrInvalidFees)
+	}
+	term, err := s.term(ctx, tid, termID)
+	if err != nil {
+		return FeeRunReport{}, err
+	}
+
+	table := fareTable{mode: settings.FareMode, zones: map[pgtype.UUID]db.TransportFareZone{}}
+	if settings.FareMode == fareModeZone {
+		zones, err := s.q.ListTransportFareZones(ctx, tid)
+		if err != nil {
+			return FeeRunReport{}, err
+		}
+		for _, z := range zones {
+			table.zones[z.ID] = z
+		}
+	} else {
+		if table.slabs, err = s.q.ListTransportFareSlabs(ctx, tid); err != nil {
+			return FeeRunReport{}, err
+		}
+		planning, err := s.q.GetTransportPlanningSettings(ctx, tid)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return FeeRunReport{}, err
+		}
+		if planning.SchoolLatitude.Valid && planning.SchoolLongitude.Valid {
+			table.school = &LatLng{Lat: planning.SchoolLatitude.Float64, Lng: planning.SchoolLongitude.Float64}
+		}
+	}
+
+	allocations, err := s.q.ListTransportFeeAllocations(ctx, tid, term.StartDate, term.EndDate)
+	if err != nil {
+		return FeeRunReport{}, err
+	}
+	existing, err := s.q.ListStudentFeeCharges(ctx, tid, feeChargeSource, term.ID.String())
+	if err != nil {
+		return FeeRunReport{}, err
+	}
+
+	report := FeeRunReport{Term: term, DryRun: dryRun, Lines: reconcile(termFares(term, allocations, table, settings.Proration), existing)}
+	report.count()
+	if report.Lines == nil {
+		report.Lines = []FeeReportLine{}
+	}
+	if dryRun {
+		return report, nil
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return FeeRunReport{}, err
+	}
+	defer tx.Rollback(ctx)
+	qtx := s.q.WithTx(tx)
+
+	description := fmt.Sprintf("Transport fee %s %s", term.AcademicYearName, term.Name)
+	due := term.DueDate
+	if !due.Valid {
+		due = term.StartDate
+	}
+	for _, line := range report.Lines {
+		details, err := json.Marshal(map[string]any{"term_id": term.ID.String(), "segments": line.Segments})
+		if err != nil {
+			return FeeRunReport{}, err
+		}
+		switch line.Action {
+		case feeCreated:
+			_, err = qtx.PostStudentFeeCharge(ctx, db.PostStudentFeeChargeParams{
+				TenantID:       tid,
+				StudentID:      toPgUUID(line.StudentID),
+				Source:         feeChargeSource,
+				SourceKey:      term.ID.String() + "/" + line.StudentID,
+				Period:         pgtype.Text{String: term.ID.String(), Valid: true},
+				FeeHeadID:      settings.FeeHeadID,
+				AcademicYearID: term.AcademicYearID,
+				Description:    description,
+				Amount:         line.Amount,
+				DueDate:        due,
+				Details:        details,
+			})
+		case feeUpdated:
+			_, err = qtx.UpdateStudentFeeCharge(ctx, db.UpdateStudentFeeChargeParams{
+				TenantID:    tid,
+				ID:          line.charge.ID,
+				FeeHeadID:   settings.FeeHeadID,
+				Description: description,
+				Amount:      line.Amount,
+				DueDate:     due,
+				Details:     details,
+			})
+		case feeCancelled:
+			_, err = qtx.CancelStudentFeeCharge(ctx, tid, line.charge.ID)
+		}
+		if err != nil {
+			return FeeRunReport{}, fmt.Errorf("%s %s: %w", line.Action, line.StudentName, err)
+		}
+	}
+
+	body, err := json.Marshal(report.Lines)
+	if err != nil {
+		return FeeRunReport{}, err
+	}
+	run, err := qtx.CreateTransportFeeRun(ctx, db.TransportFeeRun{
+		TenantID:       tid,
+		TermID:         term.ID,
+		CreatedCount:   int32(report.Created),
+		UpdatedCount:   int32(report.Updated),
+		UnchangedCount: int32(report.Unchanged),
+		CancelledCount: int32(report.Cancelled),
+		SkippedCount:   int32(report.Skipped),
+		Report:         body,
+		CreatedBy:      toPgUUID(actor.UserID),
+	})
+	if err != nil {
+		return FeeRunReport{}, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return FeeRunReport{}, err
+	}
+	report.RunID = run.ID.String()
+	s.log(ctx, tid, actor, "transport.fees.generate", "transport_fee_run", run.ID, map[string]any{
+		"term_id":   term.ID.String(),
+		"created":   report.Created,
+		"updated":   report.Updated,
+		"unchanged": report.Unchanged,
+		"cancelled": report.Cancelled,
+		"skipped":   report.Skipped,
+	})
+	return report, nil
+}
+
+func (s *FeeService) ListRuns(ctx context.Context, tenantID, termID string) ([]db.TransportFeeRun, error) {
+	tid := toPgUUID(tenantID)
+	term, err := s.term(ctx, tid, termID)
+	if err != nil {
+		return nil, err
+	}
+	return s.q.ListTransportFeeRuns(ctx, tid, term.ID)
+}
+
+func (s *FeeService) GetRun(ctx context.Context, tenantID, runID string) (db.TransportFeeRun, error) {
+	run, err := s.q.GetTransportFeeRun(ctx, toPgUUID(tenantID), toPgUUID(runID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return run, ErrFeeRunNotFound
+	}
+	return run, err
+}
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
@@ -0,0 +1,168 @@
+package transport
+
+import (
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/schoolerp/api/internal/db"
+	"github.com/schoolerp/api/internal/foundation/proration"
+)
+
+func km(v float64) pgtype.Float8 { return pgtype.Float8{Float64: v, Valid: true} }
+
+func date(s string) pgtype.Date { return pgtype.Date{Time: day(s), Valid: true} }
+
+func TestValidateSlabs(t *testing.T) {
+	ok := []db.TransportFareSlab{
+		{FromKm: 5, OneWayAmount: 400000, TwoWayAmount: 700000},
+		{FromKm: 0, ToKm: km(5), OneWayAmount: 300000, TwoWayAmount: 500000},
+	}
+	ok[0].ToKm = km(10)
+	ok = append(ok, db.TransportFareSlab{FromKm: 10, OneWayAmount: 500000, TwoWayAmount: 900000})
+	if err := validateSlabs(ok); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ok[0].FromKm != 0 {
+		t.Fatalf("expected slabs sorted by distance, got %+v", ok)
+	}
+
+	overlap := []db.TransportFareSlab{{FromKm: 0, ToKm: km(6)}, {FromKm: 5, ToKm: km(10)}}
+	if err := validateSlabs(overlap); err == nil {
+		t.Fatalf("expected overlapping slabs to be rejected")
+	}
+	open := []db.TransportFareSlab{{FromKm: 0}, {FromKm: 5, ToKm: km(10)}}
+	if err := validateSlabs(open); err == nil {
+		t.Fatalf("expected an open-ended slab before the last to be rejected")
+	}
+}
+
+func TestFareTable(t *testing.T) {
+	zone := pgtype.UUID{Bytes: [16]byte{9}, Valid: true}
+	stop := pgtype.UUID{Bytes: [16]byte{1}, Valid: true}
+	slabs := fareTable{mode: fareModeSlab, slabs: []db.TransportFareSlab{
+		{FromKm: 0, ToKm: km(5), OneWayAmount: 300, TwoWayAmount: 500},
+		{FromKm: 5, OneWayAmount: 400, TwoWayAmount: 700},
+	}}
+
+	a := db.TransportFeeAllocation{StopID: stop, DistanceKm: km(5), TripType: tripTwoWay}
+	if fare, _, problem := slabs.fare(a); problem != "" || fare != 700 {
+		t.Fatalf("expected the open slab two-way fare, got %d %q", fare, problem)
+	}
+	a.TripType = tripPickup
+	if fare, _, _ := slabs.fare(a); fare != 400 {
+		t.Fatalf("expected the one-way fare, got %d", fare)
+	}
+
+	// Without a recorded distance the school location is used.
+	a.DistanceKm = pgtype.Float8{}
+	a.Latitude, a.Longitude = km(school.Lat+0.01), km(school.Lng)
+	if _, _, problem := slabs.fare(a); problem == "" {
+		t.Fatalf("expected a problem without a school location")
+	}
+	slabs.school = &school
+	if fare, basis, problem := slabs.fare(a); problem != "" || fare != 300 {
+		t.Fatalf("expected the first slab from an estimated distance, got %d %q %q", fare, basis, problem)
+	}
+
+	zones := fareTable{mode: fareModeZone, zones: map[pgtype.UUID]db.TransportFareZone{
+		zone: {ID: zone, Name: "North", OneWayAmount: 250, TwoWayAmount: 450},
+	}}
+	b := db.TransportFeeAllocation{StopID: stop, TripType: tripTwoWay}
+	if _, _, problem := zones.fare(b); problem == "" {
+		t.Fatalf("expected a problem for a stop without a zone")
+	}
+	b.ZoneID = zone
+	if fare, _, _ := zones.fare(b); fare != 450 {
+		t.Fatalf("expected the zone fare, got %d", fare)
+	}
+	if _, _, problem := zones.fare(db.TransportFeeAllocation{}); problem == "" {
+		t.Fatalf("expected a problem for an allocation without a stop")
+	}
+}
+
+func TestTermFaresAndReconcile(t *testing.T) {
+	term := db.TransportFeeTerm{StartDate: date("2026-04-01"), EndDate: date("2026-09-30")}
+	stop := pgtype.UUID{Bytes: [16]byte{1}, Valid: true}
+	ann := pgtype.UUID{Bytes: [16]byte{10}, Valid: true}
+	ben := pgtype.UUID{Bytes: [16]byte{11}, Valid: true}
+	cal := pgtype.UUID{Bytes: [16]byte{12}, Valid: true}
+	dev := pgtype.UUID{Bytes: [16]byte{13}, Valid: true}
+	table := fareTable{mode: fareModeSlab, slabs: []db.TransportFareSlab{
+		{FromKm: 0, ToKm: km(5), OneWayAmount: 300000, TwoWayAmount: 600000},
+		{FromKm: 5, OneWayAmount: 450000, TwoWayAmount: 900000},
+	}}
+
+	allocations := []db.TransportFeeAllocation{
+		// Ann joins mid-term.
+		{StudentID: ann, StudentName: "Ann", StopID: stop, DistanceKm: km(2), TripType: tripTwoWay, StartDate: date("2026-07-10")},
+		// Ben moves further out in June; he pays for each part, capped
+		// at the dearer full fare.
+		{StudentID: ben, StudentName: "Ben", StopID: stop, DistanceKm: km(2), TripType: tripTwoWay, StartDate: date("2026-01-01"), EndDate: date("2026-06-14")},
+		{StudentID: ben, StudentName: "Ben", StopID: stop, DistanceKm: km(8), TripType: tripTwoWay, StartDate: date("2026-06-15")},
+		// Cal's stop has no distance.
+		{StudentID: cal, StudentName: "Cal", StopID: stop, TripType: tripTwoWay, StartDate: date("2026-01-01")},
+	}
+	fares := termFares(term, allocations, table, proration.Monthly)
+	if len(fares) != 3 {
+		t.Fatalf("expected 3 students, got %d", len(fares))
+	}
+	if fares[0].Amount != 300000 {
+		t.Fatalf("Ann: expected 3 of 6 months, got %d", fares[0].Amount)
+	}
+	if fares[1].Amount != 900000 || len(fares[1].Segments) != 2 {
+		t.Fatalf("Ben: expected the cap at the full fare, got %d", fares[1].Amount)
+	}
+	if fares[2].Problem == "" {
+		t.Fatalf("Cal: expected a problem")
+	}
+
+	existing := []db.StudentFeeCharge{
+		{StudentID: ben, StudentName: "Ben", Amount: 900000, Status: "active"},
+		{StudentID: cal, StudentName: "Cal", Amount: 600000, Status: "active"},
+		{StudentID: dev, StudentName: "Dev", Amount: 600000, Status: "active"},
+	}
+	lines := reconcile(fares, existing)
+	want := map[string]string{"Ann": feeCreated, "Ben": feeUnchanged, "Cal": feeSkipped, "Dev": feeCancelled}
+	if len(lines) != len(want) {
+		t.Fatalf("expected %d lines, got %+v", len(want), lines)
+	}
+	for _, l := range lines {
+		if l.Action != want[l.StudentName] {
+			t.Fatalf("%s: got %s, want %s", l.StudentName, l.Action, want[l.StudentName])
+		}
+	}
+
+	report := FeeRunReport{Lines: lines}
+	report.count()
+	if report.Created != 1 || report.Unchanged != 1 || report.Skipped != 1 || report.Cancelled != 1 {
+		t.Fatalf("unexpected counts %+v", report)
+	}
+	// Ann and Ben are billed; Cal keeps the charge already raised.
+	if report.Billed != 300000+900000+600000 {
+		t.Fatalf("unexpected billed total %d", report.Billed)
+	}
+
+	// A second run after applying changes nothing.
+	existing = append(existing[:2], db.StudentFeeCharge{StudentID: ann, StudentName: "Ann", Amount: 300000, Status: "active"})
+	for _, l := range reconcile(fares, existing) {
+		if l.Action != feeUnchanged && l.Action != feeSkipped {
+			t.Fatalf("%s: expected no change on a rerun, got %s", l.StudentName, l.Action)
+		}
+	}
+}
+
+func TestTermCovering(t *testing.T) {
+	terms := []db.TransportFeeTerm{
+		{Name: "Term 1", StartDate: date("2026-04-01"), EndDate: date("2026-09-30")},
+		{Name: "Term 2", StartDate: date("2026-10-01"), EndDate: date("2027-03-31")},
+	}
+	for on, want := range map[string]string{"2026-04-01": "Term 1", "2026-09-30": "Term 1", "2026-10-01": "Term 2"} {
+		got, ok := termCovering(terms, day(on))
+		if !ok || got.Name != want {
+			t.Fatalf("%s: got %q, want %q", on, got.Name, want)
+		}
+	}
+	if _, ok := termCovering(terms, day("2027-04-01")); ok {
+		t.Fatalf("expected no term after the last one ends")
+	}
+}
@@ -0,0 +1,910 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/rs/zerolog/log"
+	"github.com/schoolerp/api/internal/db"
+	"github.com/schoolerp/api/internal/foundation/audit"
+	"github.com/schoolerp/api/internal/foundation/proration"
+)
+
+var (
+	ErrInvalidFleet        = errors.New("invalid fleet input")
+	ErrDocumentNotFound    = errors.New("compliance document not found")
+	ErrScheduleNotFound    = errors.New("service schedule not found")
+	ErrScheduleExists      = errors.New("vehicle already has a service schedule with this name")
+	ErrWorkOrderNotFound   = errors.New("work order not found")
+	ErrWorkOrderClosed     = errors.New("work order is already completed or cancelled")
+	ErrVehicleNonCompliant = errors.New("vehicle is not compliant")
+)
+
+const (
+	// Expiry reminders go out when a document enters its reminder window,
+	// again in its final week and once more when it lapses.
+	reminderStageWindow    int32 = 1
+	reminderStageFinalWeek int32 = 2
+	reminderStageExpired   int32 = 3
+	finalWeekDays                = 7
+
+	// Service reminders go out when a service falls due soon and again when
+	// it is overdue.
+	serviceStageDueSoon int32 = 1
+	serviceStageOverdue int32 = 2
+
+	reminderBatch    = 500
+	reminderInterval = time.Hour
+)
+
+// requiredVehicleDocuments must all be held and in date for a vehicle to be
+// put on a route.
+var requiredVehicleDocuments = []string{"fitness", "insurance", "puc", "permit"}
+
+var workOrderStatuses = map[string]bool{"open": true, "in_progress": true, "completed": true, "cancelled": true}
+
+// FleetService tracks vehicle servicing, work orders, certificate and
+// licence expiry, and running costs from the fuel logs.
+type FleetService struct {
+	q     *db.Queries
+	audit *audit.Logger
+}
+
+func NewFleetService(q *db.Queries, audit *audit.Logger) *FleetService {
+	return &FleetService{q: q, audit: audit}
+}
+
+func (s *FleetService) log(ctx context.Context, tenantID pgtype.UUID, actor TrackingActor, action, resourceType string, resourceID pgtype.UUID, after any) {
+	if s.audit == nil {
+		return
+	}
+	_ = s.audit.Log(ctx, audit.Entry{
+		TenantID:     tenantID,
+		UserID:       toPgUUID(actor.UserID),
+		RequestID:    actor.RequestID,
+		Action:       action,
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+		After:        after,
+		IPAddress:    actor.IP,
+	})
+}
+
+// Compliance documents
+
+type DocumentInput struct {
+	VehicleID      string
+	DriverID       string
+	DocType        string
+	DocumentNumber string
+	Issuer         string
+	IssuedOn       time.Time
+	ExpiresOn      time.Time
+	// ReminderDays defaults to 30 when nil.
+	ReminderDays *int32
+	Notes        string
+}
+
+func (in DocumentInput) params(tenantID pgtype.UUID) (db.UpsertTransportComplianceDocumentParams, error) {
+	p := db.UpsertTransportComplianceDocumentParams{
+		TenantID:       tenantID,
+		VehicleID:      toPgUUID(in.VehicleID),
+		DriverID:       toPgUUID(in.DriverID),
+		DocType:        strings.ToLower(strings.TrimSpace(in.DocType)),
+		DocumentNumber: optionalText(in.DocumentNumber),
+		Issuer:         optionalText(in.Issuer),
+		Notes:          optionalText(in.Notes),
+		ReminderDays:   30,
+	}
+	if in.ExpiresOn.IsZero() {
+		return p, fmt.Errorf("%w: expires_on is required", ErrInvalidFleet)
+	}
+	p.ExpiresOn = pgtype.Date{Time: in.ExpiresOn, Valid: true}
+	if !in.IssuedOn.IsZero() {
+		if in.IssuedOn.After(in.ExpiresOn) {
+			return p, fmt.Errorf("%w: issued_on is after expires_on", ErrInvalidFleet)
+		}
+		p.IssuedOn = pgtype.Date{Time: in.IssuedOn, Valid: true}
+	}
+	if in.ReminderDays != nil {
+		if *in.ReminderDays < 0 || *in.ReminderDays > 365 {
+			return p, fmt.Errorf("%w: reminder_days must be between 0 and 365", ErrInvalidFleet)
+		}
+		p.ReminderDays = *in.ReminderDays
+	}
+	return p, nil
+}
+
+// CreateDocument records a vehicle certificate or a driver's licence. A
+// renewal is recorded as a new document; the one expiring last is current.
+func (s *FleetService) CreateDocument(ctx context.Context, tenantID string, in DocumentInput, actor TrackingActor) (db.TransportComplianceDocument, error) {
+	tid := toPgUUID(tenantID)
+	p, err := in.params(tid)
+	if err != nil {
+		return db.TransportComplianceDocument{}, err
+	}
+	switch {
+	case p.VehicleID.Valid == p.DriverID.Valid:
+		return db.TransportComplianceDocument{}, fmt.Errorf("%w: exactly one of vehicle_id and driver_id is required", ErrInvalidFleet)
+	case p.DriverID.Valid && p.DocType != "licence":
+		return db.TransportComplianceDocument{}, fmt.Errorf("%w: drivers only hold a licence", ErrInvalidFleet)
+	case p.VehicleID.Valid && !containsString(requiredVehicleDocuments, p.DocType):
+		return db.TransportComplianceDocument{}, fmt.Errorf("%w: doc_type must be one of %s", ErrInvalidFleet, strings.Join(requiredVehicleDocuments, ", "))
+	}
+	p.CreatedBy = toPgUUID(actor.UserID)
+
+	doc, err := s.q.CreateTransportComplianceDocument(ctx, p)
+	if errors.Is(err, pgx.ErrNoRows) {
+		if p.VehicleID.Valid {
+			return doc, ErrVehicleNotFound
+		}
+		return doc, fmt.Errorf("%w: driver not found", ErrInvalidFleet)
+	}
+	if err != nil {
+		return doc, err
+	}
+	s.log(ctx, tid, actor, "fleet.document.create", "transport_compliance_document", doc.ID, doc)
+	return doc, nil
+}
+
+// UpdateDocument corrects a document's details. Its vehicle or driver and
+// type cannot change.
+func (s *FleetService) UpdateDocument(ctx context.Context, tenantID, id string, in DocumentInput, actor TrackingActor) (db.TransportComplianceDocument, error) {
+	tid := toPgUUID(tenantID)
+	p, err := in.params(tid)
+	if err != nil {
+		return db.TransportComplianceDocument{}, err
+	}
+	p.ID = toPgUUID(id)
+
+	doc, err := s.q.UpdateTransportComplianceDocument(ctx, p)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return doc, ErrDocumentNotFound
+	}
+	if err != nil {
+		return doc, err
+	}
+	s.log(ctx, tid, actor, "fleet.document.update", "transport_compliance_document", doc.ID, doc)
+	return doc, nil
+}
+
+func (s *FleetService) DeleteDocument(ctx context.Context, tenantID, id string, actor TrackingActor) error {
+	tid := toPgUUID(tenantID)
+	docID := toPgUUID(id)
+	err := s.q.DeleteTransportComplianceDocument(ctx, tid, docID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrDocumentNotFound
+	}
+	if err != nil {
+		return err
+	}
+	s.log(ctx, tid, actor, "fleet.document.delete", "transport_compliance_document", docID, nil)
+	return nil
+}
+
+type ListDocumentsFilter struct {
+	VehicleID string
+	DriverID  string
+	// ExpiringWithinDays keeps documents that have lapsed or lapse within
+	// that many days.
+	ExpiringWithinDays *int
+	CurrentOnly        bool
+}
+
+func (s *FleetService) ListDocuments(ctx context.Context, tenantID string, f ListDocumentsFilter) ([]db.TransportComplianceDocument, error) {
+	p := db.ListTransportComplianceDocumentsParams{
+		TenantID:    toPgUUID(tenantID),
+		VehicleID:   toPgUUID(f.VehicleID),
+		DriverID:    toPgUUID(f.DriverID),
+		CurrentOnly: f.CurrentOnly,
+	}
+	if f.ExpiringWithinDays != nil {
+		if *f.ExpiringWithinDays < 0 {
+			return nil, fmt.Errorf("%w: expiring_within_days must not be negative", ErrInvalidFleet)
+		}
+		p.ExpiringBy = pgtype.Date{Time: today().AddDate(0, 0, *f.ExpiringWithinDays), Valid: true}
+	}
+	return s.q.ListTransportComplianceDocuments(ctx, p)
+}
+
+// Compliance
+
+// VehicleCompliance says whether a vehicle may be put on a route and why not.
+type VehicleCompliance struct {
+	VehicleID          pgtype.UUID                      `json:"vehicle_id"`
+	RegistrationNumber string                           `json:"registration_number"`
+	Compliant          bool                             `json:"compliant"`
+	Problems           []string                         `json:"problems"`
+	Documents          []db.TransportComplianceDocument `json:"documents"`
+}
+
+// DriverCompliance is the state of a driver's current licence.
+type DriverCompliance struct {
+	DriverID  pgtype.UUID `json:"driver_id"`
+	FullName  string      `json:"full_name"`
+	ExpiresOn pgtype.Date `json:"expires_on"`
+	// Status is valid, expiring (inside its reminder window), expired or missing.
+	Status string `json:"status"`
+}
+
+type ComplianceReport struct {
+	Vehicles []VehicleCompliance `json:"vehicles"`
+	Drivers  []DriverCompliance  `json:"drivers"`
+}
+
+// vehicleProblems lists the required documents a vehicle is missing or
+// holds only lapsed copies of, given its current documents.
+func vehicleProblems(current []db.TransportComplianceDocument, day time.Time) []string {
+	latest := make(map[string]db.TransportComplianceDocument, len(current))
+	for _, d := range current {
+		if prev, ok := latest[d.DocType]; !ok || d.ExpiresOn.Time.After(prev.ExpiresOn.Time) {
+			latest[d.DocType] = d
+		}
+	}
+	problems := []string{}
+	for _, docType := range requiredVehicleDocuments {
+		d, ok := latest[docType]
+		switch {
+		case !ok:
+			problems = append(problems, docType+" missing")
+		case d.ExpiresOn.Time.Before(day):
+			problems = append(problems, fmt.Sprintf("%s expired on %s", docType, d.ExpiresOn.Time.Format("2006-01-02")))
+		}
+	}
+	return problems
+}
+
+// ComplianceReport gives the compliance of every active vehicle and the
+// licence of every active driver.
+func (s *FleetService) ComplianceReport(ctx context.Context, tenantID string) (ComplianceReport, error) {
+	tid := toPgUUID(tenantID)
+	vehicles, err := s.q.ListVehicles(ctx, tid)
+	if err != nil {
+		return ComplianceReport{}, err
+	}
+	drivers, err := s.q.ListDrivers(ctx, tid)
+	if err != nil {
+		return ComplianceReport{}, err
+	}
+	docs, err := s.q.ListTransportComplianceDocuments(ctx, db.ListTransportComplianceDocumentsParams{TenantID: tid, CurrentOnly: true})
+	if err != nil {
+		return ComplianceReport{}, err
+	}
+	byVehicle := map[pgtype.UUID][]db.TransportComplianceDocument{}
+	licences := map[pgtype.UUID]db.TransportComplianceDocument{}
+	for _, d := range docs {
+		if d.VehicleID.Valid {
+			byVehicle[d.VehicleID] = append(byVehicle[d.VehicleID], d)
+		} else {
+			licences[d.DriverID] = d
+		}
+	}
+
+	day := today()
+	report := ComplianceReport{Vehicles: []VehicleCompliance{}, Drivers: []DriverCompliance{}}
+	for _, v := range vehicles {
+		if !v.IsActive {
+			continue
+		}
+		current := byVehicle[v.ID]
+		if current == nil {
+			current = []db.TransportComplianceDocument{}
+		}
+		problems := vehicleProblems(current, day)
+		report.Vehicles = append(report.Vehicles, VehicleCompliance{
+			VehicleID:          v.ID,
+			RegistrationNumber: v.RegistrationNumber,
+			Compliant:          len(problems) == 0,
+			Problems:           problems,
+			Documents:          current,
+		})
+	}
+	for _, d := range drivers {
+		if !d.IsActive {
+			continue
+		}
+		entry := DriverCompliance{DriverID: d.ID, FullName: d.FullName, Status: "missing"}
+		if lic, ok := licences[d.ID]; ok {
+			entry.ExpiresOn = lic.ExpiresOn
+			entry.Status = "valid"
+			switch left := proration.DaysBetween(day, lic.ExpiresOn.Time); {
+			case left < 0:
+				entry.Status = "expired"
+			case left <= int(lic.ReminderDays):
+				entry.Status = "expiring"
+			}
+		}
+		report.Drivers = append(report.Drivers, entry)
+	}
+	return report, nil
+}
+
+// EnsureVehicleCompliant refuses a vehicle that lacks an in-date fitness,
+// insurance, PUC or permit certificate.
+func (s *FleetService) EnsureVehicleCompliant(ctx context.Context, tenantID, vehicleID pgtype.UUID) error {
+	docs, err := s.q.ListTransportComplianceDocuments(ctx, db.ListTransportComplianceDocumentsParams{
+		TenantID:    tenantID,
+		VehicleID:   vehicleID,
+		CurrentOnly: true,
+	})
+	if err != nil {
+		return err
+	}
+	if problems := vehicleProblems(docs, today()); len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrVehicleNonCompliant, strings.Join(problems, ", "))
+	}
+	return nil
+}
+
+// EnsureRouteVehicleCompliant checks a vehicle being assigned to a route.
+// A route keeping the vehicle it already has is not re-checked, so other
+// edits to the route are not blocked by a lapsed certificate.
+func (s *FleetService) EnsureRouteVehicleCompliant(ctx context.Context, tenantID, routeID, vehicleID pgtype.UUID) error {
+	if !vehicleID.Valid {
+		return nil
+	}
+	if routeID.Valid {
+		current, err := s.q.GetTransportRouteVehicle(ctx, tenantID, routeID)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return err
+		}
+		if current == vehicleID {
+			return nil
+		}
+	}
+	return s.EnsureVehicleCompliant(ctx, tenantID, vehicleID)
+}
+
+// Service schedules
+
+type ScheduleInput struct {
+	VehicleID       string
+	Name            string
+	IntervalKm      *int32
+	IntervalDays    *int32
+	LastServiceKm   *int32
+	LastServiceDate time.Time
+	DueSoonKm       *int32
+	DueSoonDays     *int32
+	IsActive        *bool
+}
+
+func (in ScheduleInput) params(tenantID pgtype.UUID) (db.UpsertTransportServiceScheduleParams, error) {
+	p := db.UpsertTransportServiceScheduleParams{
+		TenantID:      tenantID,
+		VehicleID:     toPgUUID(in.VehicleID),
+		Name:          strings.TrimSpace(in.Name),
+		IntervalKm:    optionalInt4(in.IntervalKm),
+		IntervalDays:  optionalInt4(in.IntervalDays),
+		LastServiceKm: optionalInt4(in.LastServiceKm),
+		DueSoonKm:     500,
+		DueSoonDays:   7,
+		IsActive:      true,
+	}
+	if p.Name == "" {
+		return p, fmt.Errorf("%w: name is required", ErrInvalidFleet)
+	}
+	if !p.IntervalKm.Valid && !p.IntervalDays.Valid {
+		return p, fmt.Errorf("%w: interval_km or interval_days is required", ErrInvalidFleet)
+	}
+	if (p.IntervalKm.Valid && p.IntervalKm.Int32 <= 0) || (p.IntervalDays.Valid && p.IntervalDays.Int32 <= 0) {
+		return p, fmt.Errorf("%w: intervals must be positive", ErrInvalidFleet)
+	}
+	if p.LastServiceKm.Valid && p.LastServiceKm.Int32 < 0 {
+		return p, fmt.Errorf("%w: last_service_km must not be negative", ErrInvalidFleet)
+	}
+	if !in.LastServiceDate.IsZero() {
+		p.LastServiceDate = pgtype.Date{Time: in.LastServiceDate, Valid: true}
+	}
+	if in.DueSoonKm != nil {
+		p.DueSoonKm = *in.DueSoonKm
+	}
+	if in.DueSoonDays != nil {
+		p.DueSoonDays = *in.DueSoonDays
+	}
+	if p.DueSoonKm < 0 || p.DueSoonDays < 0 {
+		return p, fmt.Errorf("%w: due_soon_km and due_soon_days must not be negative", ErrInvalidFleet)
+	}
+	if in.IsActive != nil {
+		p.IsActive = *in.IsActive
+	}
+	return p, nil
+}
+
+// ServiceDue is a schedule with when its next service falls due.
+type ServiceDue struct {
+	db.TransportServiceSchedule
+	NextDueKm     *int32  `json:"next_due_km"`
+	NextDueDate   *string `json:"next_due_date"`
+	KmRemaining   *int32  `json:"km_remaining"`
+	DaysRemaining *int    `json:"days_remaining"`
+	// Status is ok, due_soon, overdue or inactive.
+	Status string `json:"status"`
+}
+
+// serviceDue works out when a schedule next falls due. Without a recorded
+// last service the distance is counted from zero and the time from when the
+// schedule was set up. The km leg is skipped while the odometer is unknown.
+func serviceDue(s db.TransportServiceSchedule, day time.Time) ServiceDue {
+	out := ServiceDue{TransportServiceSchedule: s, Status: "ok"}
+	overdue, soon := false, false
+
+	if s.IntervalKm.Valid {
+		next := s.LastServiceKm.Int32 + s.IntervalKm.Int32
+		out.NextDueKm = &next
+		if s.OdometerKm.Valid {
+			left := next - s.OdometerKm.Int32
+			out.KmRemaining = &left
+			overdue = overdue || left <= 0
+			soon = soon || left <= s.DueSoonKm
+		}
+	}
+	if s.IntervalDays.Valid {
+		from := s.LastServiceDate.Time
+		if !s.LastServiceDate.Valid {
+			from = s.CreatedAt.Time.UTC().Truncate(24 * time.Hour)
+		}
+		next := from.AddDate(0, 0, int(s.IntervalDays.Int32))
+		date := next.Format("2006-01-02")
+		left := proration.DaysBetween(day, next)
+		out.NextDueDate, out.DaysRemaining = &date, &left
+		overdue = overdue || left < 0
+		soon = soon || left <= int(s.DueSoonDays)
+	}
+
+	switch {
+	case !s.IsActive:
+		out.Status = "inactive"
+	case overdue:
+		out.Status = "overdue"
+	case soon:
+		out.Status = "due_soon"
+	}
+	return out
+}
+
+func (s *FleetService) CreateSchedule(ctx context.Context, tenantID string, in ScheduleInput, actor TrackingActor) (ServiceDue, error) {
+	tid := toPgUUID(tenantID)
+	p, err := in.params(tid)
+	if err != nil {
+		return ServiceDue{}, err
+	}
+	sched, err := s.q.CreateTransportServiceSchedule(ctx, p)
+	if err != nil {
+		return ServiceDue{}, scheduleError(err)
+	}
+	s.log(ctx, tid, actor, "fleet.schedule.create", "transport_service_schedule", sched.ID, sched)
+	return serviceDue(sched, today()), nil
+}
+
+func (s *FleetService) UpdateSchedule(ctx context.Context, tenantID, id string, in ScheduleInput, actor TrackingActor) (ServiceDue, error) {
+	tid := toPgUUID(tenantID)
+	p, err := in.params(tid)
+	if err != nil {
+		return ServiceDue{}, err
+	}
+	p.ID = toPgUUID(id)
+	sched, err := s.q.UpdateTransportServiceSchedule(ctx, p)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ServiceDue{}, ErrScheduleNotFound
+	}
+	if err != nil {
+		return ServiceDue{}, scheduleError(err)
+	}
+	s.log(ctx, tid, actor, "fleet.schedule.update", "transport_service_schedule", sched.ID, sched)
+	return serviceDue(sched, today()), nil
+}
+
+func scheduleError(err error) error {
+	var pgErr *pgconn.PgError
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return ErrVehicleNotFound
+	case errors.As(err, &pgErr) && pgErr.Code == "23505":
+		return ErrScheduleExists
+	}
+	return err
+}
+
+// ListSchedules returns service schedules with their due state, optionally
+// only those with the given status.
+func (s *FleetService) ListSchedules(ctx context.Context, tenantID, vehicleID, status string) ([]ServiceDue, error) {
+	schedules, err := s.q.ListTransportServiceSchedules(ctx, toPgUUID(tenantID), toPgUUID(vehicleID))
+	if err != nil {
+		return nil, err
+	}
+	day := today()
+	out := make([]ServiceDue, 0, len(schedules))
+	for _, sched := range schedules {
+		due := serviceDue(sched, day)
+		if status != "" && due.Status != status {
+			continue
+		}
+		out = append(out, due)
+	}
+	return out, nil
+}
+
+// Work orders
+
+type WorkOrderInput struct {
+	VehicleID   string
+	ScheduleID  string
+	Title       string
+	Description string
+	Vendor      string
+	Status      string
+	OdometerKm  *int32
+	LabourCost  float64
+	PartsCost   float64
+	OpenedOn    time.Time
+	CompletedOn time.Time
+}
+
+func (in WorkOrderInput) params(tenantID pgtype.UUID) (db.UpsertTransportWorkOrderParams, error) {
+	p := db.UpsertTransportWorkOrderParams{
+		TenantID:    tenantID,
+		VehicleID:   toPgUUID(in.VehicleID),
+		ScheduleID:  toPgUUID(in.ScheduleID),
+		Title:       strings.TrimSpace(in.Title),
+		Description: optionalText(in.Description),
+		Vendor:      optionalText(in.Vendor),
+		Status:      strings.ToLower(strings.TrimSpace(in.Status)),
+		OdometerKm:  optionalInt4(in.OdometerKm),
+		LabourCost:  math.Round(in.LabourCost*100) / 100,
+		PartsCost:   math.Round(in.PartsCost*100) / 100,
+	}
+	if p.Title == "" {
+		return p, fmt.Errorf("%w: title is required", ErrInvalidFleet)
+	}
+	if p.LabourCost < 0 || p.PartsCost < 0 {
+		return p, fmt.Errorf("%w: costs must not be negative", ErrInvalidFleet)
+	}
+	if p.OdometerKm.Valid && p.OdometerKm.Int32 < 0 {
+		return p, fmt.Errorf("%w: odometer_km must not be negative", ErrInvalidFleet)
+	}
+	if !in.OpenedOn.IsZero() {
+		p.OpenedOn = pgtype.Date{Time: in.OpenedOn, Valid: true}
+	}
+	if !in.CompletedOn.IsZero() {
+		p.CompletedOn = pgtype.Date{Time: in.CompletedOn, Valid: true}
+	}
+	return p, nil
+}
+
+// CreateWorkOrder opens a work order, optionally against one of the
+// vehicle's service schedules.
+func (s *FleetService) CreateWorkOrder(ctx context.Context, tenantID string, in WorkOrderInput, actor TrackingActor) (db.TransportWorkOrder, error) {
+	tid := toPgUUID(tenantID)
+	p, err := in.params(tid)
+	if err != nil {
+		return db.TransportWorkOrder{}, err
+	}
+	p.UserID = toPgUUID(actor.UserID)
+	wo, err := s.q.CreateTransportWorkOrder(ctx, p)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return wo, fmt.Errorf("%w: vehicle not found or the schedule belongs to another vehicle", ErrInvalidFleet)
+	}
+	if err != nil {
+		return wo, err
+	}
+	s.log(ctx, tid, actor, "fleet.work_order.create", "transport_work_order", wo.ID, wo)
+	return wo, nil
+}
+
+// UpdateWorkOrder edits an open work order. Completing one that belongs to a
+// service schedule restarts the schedule from its odometer reading and date.
+func (s *FleetService) UpdateWorkOrder(ctx context.Context, tenantID, id string, in WorkOrderInput, actor TrackingActor) (db.TransportWorkOrder, error) {
+	tid := toPgUUID(tenantID)
+	p, err := in.params(tid)
+	if err != nil {
+		return db.TransportWorkOrder{}, err
+	}
+	if !workOrderStatuses[p.Status] {
+		return db.TransportWorkOrder{}, fmt.Errorf("%w: status must be open, in_progress, completed or cancelled", ErrInvalidFleet)
+	}
+	p.ID = toPgUUID(id)
+	p.UserID = toPgUUID(actor.UserID)
+
+	wo, err := s.q.UpdateTransportWorkOrder(ctx, p)
+	if errors.Is(err, pgx.ErrNoRows) {
+		if _, getErr := s.q.GetTransportWorkOrder(ctx, tid, p.ID); getErr == nil {
+			return wo, ErrWorkOrderClosed
+		}
+		return wo, ErrWorkOrderNotFound
+	}
+	if err != nil {
+		return wo, err
+	}
+	s.log(ctx, tid, actor, "fleet.work_order.update", "transport_work_order", wo.ID, wo)
+	return wo, nil
+}
+
+func (s *FleetService) ListWorkOrders(ctx context.Context, tenantID, vehicleID, status string) ([]db.TransportWorkOrder, error) {
+	status = strings.ToLower(strings.TrimSpace(status))
+	if status != "" && !workOrderStatuses[status] {
+		return nil, fmt.Errorf("%w: unknown status %q", ErrInvalidFleet, status)
+	}
+	return s.q.ListTransportWorkOrders(ctx, toPgUUID(tenantID), toPgUUID(vehicleID), status)
+}
+
+// Fuel efficiency
+
+// VehicleEfficiency is a vehicle's running cost over a period. Distance runs
+// from the first to the last odometer reading at a fill. Litres and fuel
+// cost leave out the first fill, whose fuel was burnt before the period.
+type VehicleEfficiency struct {
+	VehicleID          pgtype.UUID `json:"vehicle_id"`
+	RegistrationNumber string      `json:"registration_number"`
+	Fills              int         `json:"fills"`
+	DistanceKm         float64     `json:"distance_km"`
+	Litres             float64     `json:"litres"`
+	FuelCost           float64     `json:"fuel_cost"`
+	MaintenanceCost    float64     `json:"maintenance_cost"`
+	KmPerLitre         *float64    `json:"km_per_litre"`
+	FuelCostPerKm      *float64    `json:"fuel_cost_per_km"`
+	TotalCostPerKm     *float64    `json:"total_cost_per_km"`
+}
+
+// fuelEfficiency derives per-vehicle efficiency from fills ordered by
+// vehicle and odometer, plus completed maintenance costs.
+func fuelEfficiency(points []db.TransportFuelPoint, costs []db.TransportMaintenanceCost) []VehicleEfficiency {
+	byVehicle := map[pgtype.UUID]*VehicleEfficiency{}
+	var order []pgtype.UUID
+	get := func(id pgtype.UUID, reg string) *VehicleEfficiency {
+		if e, ok := byVehicle[id]; ok {
+			return e
+		}
+		e := &VehicleEfficiency{VehicleID: id, RegistrationNumber: reg}
+		byVehicle[id] = e
+		order = append(order, id)
+		return e
+	}
+
+	var first db.TransportFuelPoint
+	for i, p := range points {
+		e := get(p.VehicleID, p.RegistrationNumber)
+		if i == 0 || points[i-1].VehicleID != p.VehicleID {
+			first = p
+		} else {
+			e.Litres += p.Litres
+			e.FuelCost += p.Cost
+			e.DistanceKm = float64(p.OdometerKm - first.OdometerKm)
+		}
+		e.Fills++
+	}
+	for _, c := range costs {
+		get(c.VehicleID, c.RegistrationNumber).MaintenanceCost += c.Cost
+	}
+
+	out := make([]VehicleEfficiency, 0, len(order))
+	for _, id := range order {
+		e := byVehicle[id]
+		e.Litres = round2(e.Litres)
+		e.FuelCost = round2(e.FuelCost)
+		e.MaintenanceCost = round2(e.MaintenanceCost)
+		if e.DistanceKm > 0 {
+			if e.Litres > 0 {
+				kmpl := round2(e.DistanceKm / e.Litres)
+				fuelPerKm := round2(e.FuelCost / e.DistanceKm)
+				e.KmPerLitre, e.FuelCostPerKm = &kmpl, &fuelPerKm
+			}
+			total := round2((e.FuelCost + e.MaintenanceCost) / e.DistanceKm)
+			e.TotalCostPerKm = &total
+		}
+		out = append(out, *e)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].RegistrationNumber < out[j].RegistrationNumber })
+	return out
+}
+
+// FuelEfficiency reports km per litre and cost per km for each vehicle
+// between two days, inclusive.
+func (s *FleetService) FuelEfficiency(ctx context.Context, tenantID, vehicleID string, from, to time.Time) ([]VehicleEfficiency, error) {
+	if from.IsZero() || to.IsZero() || to.Before(from) {
+		return nil, fmt.Errorf("%w: from and to are required and from must not be after to", ErrInvalidFleet)
+	}
+	if int(to.Sub(from).Hours()/24) > maxReportDays {
+		return nil, fmt.Errorf("%w: the range is limited to %d days", ErrInvalidFleet, maxReportDays)
+	}
+	tid, vid := toPgUUID(tenantID), toPgUUID(vehicleID)
+	f, t := pgtype.Date{Time: from, Valid: true}, pgtype.Date{Time: to, Valid: true}
+	points, err := s.q.ListTransportFuelPoints(ctx, tid, vid, f, t)
+	if err != nil {
+		return nil, err
+	}
+	costs, err := s.q.ListTransportMaintenanceCosts(ctx, tid, vid, f, t)
+	if err != nil {
+		return nil, err
+	}
+	return fuelEfficiency(points, costs), nil
+}
+
+// Reminders
+
+// documentReminderStage is the reminder a document is due given the days
+// left before it expires; 0 means none yet.
+func documentReminderStage(daysLeft int, reminderDays int32) int32 {
+	final := finalWeekDays
+	if int(reminderDays) < final {
+		final = int(reminderDays)
+	}
+	switch {
+	case daysLeft < 0:
+		return reminderStageExpired
+	case daysLeft <= final:
+		return reminderStageFinalWeek
+	case daysLeft <= int(reminderDays):
+		return reminderStageWindow
+	}
+	return 0
+}
+
+// StartReminderWorker sends expiry and service reminders every hour until
+// ctx is cancelled.
+func (s *FleetService) StartReminderWorker(ctx context.Context) {
+	ticker := time.NewTicker(reminderInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.RunReminders(ctx)
+		}
+	}
+}
+
+// RunReminders queues the reminders that have fallen due since the last
+// run. Each stage is claimed before it is sent, so concurrent workers do
+// not send it twice.
+func (s *FleetService) RunReminders(ctx context.Context) {
+	day := today()
+	recipients := map[pgtype.UUID][]string{}
+	managers := func(tenantID pgtype.UUID) []string {
+		if r, ok := recipients[tenantID]; ok {
+			return r
+		}
+		ids, err := s.q.ListUsersWithPermission(ctx, tenantID, AlertsPermission)
+		if err != nil {
+			log.Error().Err(err).Msg("failed to resolve fleet reminder recipients")
+		}
+		r := make([]string, 0, len(ids))
+		for _, id := range ids {
+			r = append(r, id.String())
+		}
+		recipients[tenantID] = r
+		return r
+	}
+
+	docs, err := s.q.ListDueTransportDocumentReminders(ctx, reminderStageExpired, reminderBatch)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to list due compliance reminders")
+	}
+	for _, d := range docs {
+		daysLeft := proration.DaysBetween(day, d.ExpiresOn.Time)
+		stage := documentReminderStage(daysLeft, d.ReminderDays)
+		if stage <= d.LastReminderStage {
+			continue
+		}
+		if claimed, err := s.q.ClaimTransportDocumentReminder(ctx, d.ID, stage); err != nil || !claimed {
+			if err != nil {
+				log.Error().Err(err).Str("document_id", d.ID.String()).Msg("failed to claim compliance reminder")
+			}
+			continue
+		}
+		to := append([]string{}, managers(d.TenantID)...)
+		if d.DriverUserID.Valid {
+			to = append(to, d.DriverUserID.String())
+		}
+		payload := map[string]any{
+			"document_id":        d.ID.String(),
+			"doc_type":           d.DocType,
+			"document_number":    d.DocumentNumber.String,
+			"subject_name":       d.SubjectName,
+			"expires_on":         d.ExpiresOn.Time.Format("2006-01-02"),
+			"days_left":          daysLeft,
+			"expired":            daysLeft < 0,
+			"recipient_user_ids": to,
+		}
+		if d.VehicleID.Valid {
+			payload["vehicle_id"] = d.VehicleID.String()
+		} else {
+			payload["driver_id"] = d.DriverID.String()
+		}
+		if err := s.emit(ctx, d.TenantID, "transport.compliance_expiring", payload); err != nil {
+			log.Error().Err(err).Msg("failed to queue compliance reminder")
+		}
+	}
+
+	schedules, err := s.q.ListActiveTransportServiceSchedules(ctx, serviceStageOverdue)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to list service schedules")
+	}
+	for _, sched := range schedules {
+		due := serviceDue(sched, day)
+		stage := int32(0)
+		switch due.Status {
+		case "overdue":
+			stage = serviceStageOverdue
+		case "due_soon":
+			stage = serviceStageDueSoon
+		}
+		if stage <= sched.LastReminderStage {
+			continue
+		}
+		if claimed, err := s.q.ClaimTransportServiceReminder(ctx, sched.ID, stage); err != nil || !claimed {
+			if err != nil {
+				log.Error().Err(err).Str("schedule_id", sched.ID.String()).Msg("failed to claim service reminder")
+			}
+			continue
+		}
+		payload := map[string]any{
+			"schedule_id":         sched.ID.String(),
+			"schedule_name":       sched.Name,
+			"vehicle_id":          sched.VehicleID.String(),
+			"registration_number": sched.RegistrationNumber,
+			"status":              due.Status,
+			"next_due_km":         due.NextDueKm,
+			"next_due_date":       due.NextDueDate,
+			"odometer_km":         sched.OdometerKm,
+			"recipient_user_ids":  managers(sched.TenantID),
+		}
+		if err := s.emit(ctx, sched.TenantID, "transport.service_due", payload); err != nil {
+			log.Error().Err(err).Msg("failed to queue service reminder")
+		}
+	}
+}
+
+func (s *FleetService) emit(ctx context.Context, tenantID pgtype.UUID, eventType string, payload map[string]any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	_, err = s.q.CreateOutboxEvent(ctx, db.CreateOutboxEventParams{
+		TenantID:  tenantID,
+		EventType: eventType,
+		Payload:   body,
+	})
+	return err
+}
+
+// today is the current UTC date, matching how DATE columns are scanned.
+func today() time.Time {
+	return time.Now().UTC().Truncate(24 * time.Hour)
+}
+
+func optionalText(v string) pgtype.Text {
+	v = strings.TrimSpace(v)
+	return pgtype.Text{String: v, Valid: v != ""}
+}
+
+func optionalInt4(v *int32) pgtype.Int4 {
+	if v == nil {
+		return pgtype.Int4{}
+	}
+	return pgtype.Int4{Int32: *v, Valid: true}
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+func containsString(list []string, v string) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,141 @@
+package transport
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/schoolerp/api/internal/db"
+)
+
+func day(s string) time.Time {
+	t, _ := time.Parse("2006-01-02", s)
+	return t
+}
+
+func TestVehicleProblems(t *testing.T) {
+	today := day("2026-06-15")
+	doc := func(docType, expires string) db.TransportComplianceDocument {
+		return db.TransportComplianceDocument{DocType: docType, ExpiresOn: pgtype.Date{Time: day(expires), Valid: true}}
+	}
+
+	all := []db.TransportComplianceDocument{
+		doc("fitness", "2027-01-01"), doc("insurance", "2026-06-15"),
+		doc("puc", "2026-12-01"), doc("permit", "2027-03-31"),
+	}
+	if got := vehicleProblems(all, today); len(got) != 0 {
+		t.Fatalf("expected a compliant vehicle, got %v", got)
+	}
+
+	got := vehicleProblems([]db.TransportComplianceDocument{
+		doc("fitness", "2027-01-01"), doc("insurance", "2026-06-14"), doc("permit", "2027-03-31"),
+	}, today)
+	want := []string{"insurance expired on 2026-06-14", "puc missing"}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestDocumentReminderStage(t *testing.T) {
+	cases := []struct {
+		daysLeft     int
+		reminderDays int32
+		want         int32
+	}{
+		{45, 30, 0},
+		{30, 30, reminderStageWindow},
+		{8, 30, reminderStageWindow},
+		{7, 30, reminderStageFinalWeek},
+		{0, 30, reminderStageFinalWeek},
+		{-1, 30, reminderStageExpired},
+		{3, 3, reminderStageFinalWeek},
+		{4, 3, 0},
+		{0, 0, reminderStageFinalWeek},
+	}
+	for _, c := range cases {
+		if got := documentReminderStage(c.daysLeft, c.reminderDays); got != c.want {
+			t.Fatalf("documentReminderStage(%d, %d) = %d, want %d", c.daysLeft, c.reminderDays, got, c.want)
+		}
+	}
+}
+
+func TestServiceDue(t *testing.T) {
+	today := day("2026-06-15")
+	base := db.TransportServiceSchedule{
+		IntervalKm:      pgtype.Int4{Int32: 10000, Valid: true},
+		IntervalDays:    pgtype.Int4{Int32: 180, Valid: true},
+		LastServiceKm:   pgtype.Int4{Int32: 40000, Valid: true},
+		LastServiceDate: pgtype.Date{Time: day("2026-03-01"), Valid: true},
+		DueSoonKm:       500,
+		DueSoonDays:     7,
+		IsActive:        true,
+	}
+
+	s := base
+	s.OdometerKm = pgtype.Int4{Int32: 45000, Valid: true}
+	due := serviceDue(s, today)
+	if due.Status != "ok" || *due.NextDueKm != 50000 || *due.KmRemaining != 5000 || *due.NextDueDate != "2026-08-28" {
+		t.Fatalf("unexpected %+v", due)
+	}
+
+	s.OdometerKm = pgtype.Int4{Int32: 49600, Valid: true}
+	if due := serviceDue(s, today); due.Status != "due_soon" {
+		t.Fatalf("expected due_soon by km, got %s", due.Status)
+	}
+
+	s.OdometerKm = pgtype.Int4{Int32: 50000, Valid: true}
+	if due := serviceDue(s, today); due.Status != "overdue" {
+		t.Fatalf("expected overdue by km, got %s", due.Status)
+	}
+
+	// Unknown odometer: only the date leg counts.
+	s.OdometerKm = pgtype.Int4{}
+	if due := serviceDue(s, day("2026-08-29")); due.Status != "overdue" || due.KmRemaining != nil {
+		t.Fatalf("expected overdue by date, got %+v", due)
+	}
+	if due := serviceDue(s, day("2026-08-22")); due.Status != "due_soon" {
+		t.Fatalf("expected due_soon by date, got %s", due.Status)
+	}
+
+	s.IsActive = false
+	if due := serviceDue(s, day("2026-08-29")); due.Status != "inactive" {
+		t.Fatalf("expected inactive, got %s", due.Status)
+	}
+}
+
+func TestFuelEfficiency(t *testing.T) {
+	busA := pgtype.UUID{Bytes: [16]byte{1}, Valid: true}
+	busB := pgtype.UUID{Bytes: [16]byte{2}, Valid: true}
+	busC := pgtype.UUID{Bytes: [16]byte{3}, Valid: true}
+	points := []db.TransportFuelPoint{
+		{VehicleID: busA, RegistrationNumber: "KA01", OdometerKm: 1000, Litres: 50, Cost: 5000},
+		{VehicleID: busA, RegistrationNumber: "KA01", OdometerKm: 1300, Litres: 60, Cost: 6000},
+		{VehicleID: busA, RegistrationNumber: "KA01", OdometerKm: 1600, Litres: 40, Cost: 4000},
+		{VehicleID: busB, RegistrationNumber: "KA02", OdometerKm: 500, Litres: 30, Cost: 3000},
+	}
+	costs := []db.TransportMaintenanceCost{
+		{VehicleID: busA, RegistrationNumber: "KA01", Cost: 3000},
+		{VehicleID: busC, RegistrationNumber: "KA03", Cost: 1200},
+	}
+
+	got := fuelEfficiency(points, costs)
+	if len(got) != 3 {
+		t.Fatalf("expected 3 vehicles, got %d", len(got))
+	}
+
+	a := got[0]
+	if a.Fills != 3 || a.DistanceKm != 600 || a.Litres != 100 || a.FuelCost != 10000 {
+		t.Fatalf("unexpected totals %+v", a)
+	}
+	if *a.KmPerLitre != 6 || *a.FuelCostPerKm != 16.67 || *a.TotalCostPerKm != 21.67 {
+		t.Fatalf("unexpected ratios %v %v %v", *a.KmPerLitre, *a.FuelCostPerKm, *a.TotalCostPerKm)
+	}
+
+	// A single fill gives no distance, so no ratios.
+	if b := got[1]; b.Fills != 1 || b.KmPerLitre != nil || b.TotalCostPerKm != nil {
+		t.Fatalf("unexpected %+v", b)
+	}
+	if c := got[2]; c.Fills != 0 || c.MaintenanceCost != 1200 {
+		t.Fatalf("unexpected %+v", c)
+	}
+}
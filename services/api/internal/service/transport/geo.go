@@ -0,0 +1,88 @@
+package transport
+
+import (
+	"math"
+	"time"
+)
+
+const earthRadiusM = 6371000.0
+
+// roadFactor converts straight-line distance between stops into an estimate
+// of the distance driven. School routes in towns run around 1.3x.
+const roadFactor = 1.3
+
+// stopDwell is the time assumed at each stop before the one being estimated.
+const stopDwell = 45 * time.Second
+
+// LatLng is a WGS84 position in degrees.
+type LatLng struct {
+	Lat float64 `json:"latitude"`
+	Lng float64 `json:"longitude"`
+}
+
+// Valid reports whether the coordinates are in range.
+func (p LatLng) Valid() bool {
+	return p.Lat >= -90 && p.Lat <= 90 && p.Lng >= -180 && p.Lng <= 180
+}
+
+// distanceMeters is the great-circle distance between two positions.
+func distanceMeters(a, b LatLng) float64 {
+	lat1, lat2 := a.Lat*math.Pi/180, b.Lat*math.Pi/180
+	dLat := lat2 - lat1
+	dLng := (b.Lng - a.Lng) * math.Pi / 180
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadiusM * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// distanceToPathMeters is the distance from p to the nearest point of the
+// polyline through path. Routes are a few kilometres long, so projecting
+// onto a plane around p is accurate enough.
+func distanceToPathMeters(p LatLng, path []LatLng) float64 {
+	if len(path) == 0 {
+		return math.Inf(1)
+	}
+	if len(path) == 1 {
+		return distanceMeters(p, path[0])
+	}
+	cosLat := math.Cos(p.Lat * math.Pi / 180)
+	project := func(q LatLng) (float64, float64) {
+		return (q.Lng - p.Lng) * math.Pi / 180 * earthRadiusM * cosLat, (q.Lat - p.Lat) * math.Pi / 180 * earthRadiusM
+	}
+	best := math.Inf(1)
+	for i := 1; i < len(path); i++ {
+		ax, ay := project(path[i-1])
+		bx, by := project(path[i])
+		dx, dy := bx-ax, by-ay
+		t := 0.0
+		if l := dx*dx + dy*dy; l > 0 {
+			t = math.Max(0, math.Min(1, -(ax*dx+ay*dy)/l))
+		}
+		cx, cy := ax+t*dx, ay+t*dy
+		best = math.Min(best, math.Hypot(cx, cy))
+	}
+	return best
+}
+
+// estimateArrivals returns the expected arrival at each of the stops ahead,
+// in visiting order, driving from pos at speedKmph. Stops without
+// coordinates get a zero time and are skipped when summing distance.
+func estimateArrivals(pos LatLng, ahead []*LatLng, speedKmph float64, now time.Time) []time.Time {
+	out := make([]time.Time, len(ahead))
+	if speedKmph <= 0 {
+		return out
+	}
+	metersPerSecond := speedKmph * 1000 / 3600
+	from := pos
+	var elapsed time.Duration
+	for i, stop := range ahead {
+		if stop == nil {
+			continue
+		}
+		meters := distanceMeters(from, *stop) * roadFactor
+		elapsed += time.Duration(meters / metersPerSecond * float64(time.Second))
+		out[i] = now.Add(elapsed)
+		elapsed += stopDwell
+		from = *stop
+	}
+	return out
+}
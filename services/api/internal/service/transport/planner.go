@@ -0,0 +1,609 @@
+package transport
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Route planning works on straight-line distances scaled by roadFactor, so
+// no map service is needed. Times are in seconds. A pickup route runs from
+// its first stop to the school; a child's ride time is from leaving their
+// stop to reaching the school, including the dwell at later stops.
+
+// PlanOptions tune the planner.
+type PlanOptions struct {
+	School         LatLng  `json:"school"`
+	MaxRideMinutes float64 `json:"max_ride_minutes"`
+	WalkRadiusM    float64 `json:"walk_radius_m"`
+	SpeedKmph      float64 `json:"speed_kmph"`
+}
+
+func (o PlanOptions) validate() error {
+	switch {
+	case o.School.Lat == 0 && o.School.Lng == 0, !o.School.Valid():
+		return fmt.Errorf("%w: the school location is not set", ErrInvalidPlan)
+	case o.MaxRideMinutes <= 0:
+		return fmt.Errorf("%w: max_ride_minutes must be positive", ErrInvalidPlan)
+	case o.WalkRadiusM < 0:
+		return fmt.Errorf("%w: walk_radius_m must not be negative", ErrInvalidPlan)
+	case o.SpeedKmph <= 0:
+		return fmt.Errorf("%w: speed_kmph must be positive", ErrInvalidPlan)
+	}
+	return nil
+}
+
+// PlanStudent is a student's geocoded pickup point.
+type PlanStudent struct {
+	StudentID string
+	Point     LatLng
+}
+
+type PlanVehicle struct {
+	VehicleID          string
+	RegistrationNumber string
+	Capacity           int
+}
+
+// PlannedStop is a stop in a proposed sequence. StopID is set for a stop
+// that already exists. StudentIDs are the students the plan puts on the
+// stop; Load also counts students already allocated to an existing stop.
+type PlannedStop struct {
+	StopID      string   `json:"stop_id,omitempty"`
+	Name        string   `json:"name"`
+	Location    LatLng   `json:"location"`
+	StudentIDs  []string `json:"student_ids"`
+	Load        int      `json:"load"`
+	RideMinutes float64  `json:"ride_minutes"`
+}
+
+// PlannedRoute is a proposed stop sequence for one vehicle. RouteID is set
+// when an existing route is being changed. A route without a vehicle could
+// not be matched to one.
+type PlannedRoute struct {
+	RouteID            string        `json:"route_id,omitempty"`
+	Name               string        `json:"name"`
+	VehicleID          string        `json:"vehicle_id,omitempty"`
+	RegistrationNumber string        `json:"registration_number,omitempty"`
+	Capacity           int           `json:"capacity"`
+	Load               int           `json:"load"`
+	Stops              []PlannedStop `json:"stops"`
+	DistanceKm         float64       `json:"distance_km"`
+	DurationMinutes    float64       `json:"duration_minutes"`
+}
+
+// StudentRide is where the plan puts a student.
+type StudentRide struct {
+	StudentID   string  `json:"student_id"`
+	RouteIndex  int     `json:"route_index"`
+	StopIndex   int     `json:"stop_index"`
+	WalkMeters  float64 `json:"walk_meters"`
+	RideMinutes float64 `json:"ride_minutes"`
+}
+
+type UnplannedStudent struct {
+	StudentID string `json:"student_id"`
+	Reason    string `json:"reason"`
+}
+
+type PlanResult struct {
+	Routes          []PlannedRoute     `json:"routes"`
+	Students        []StudentRide      `json:"students"`
+	Unplanned       []UnplannedStudent `json:"unplanned"`
+	Warnings        []string           `json:"warnings"`
+	TotalDistanceKm float64            `json:"total_distance_km"`
+	MaxRideMinutes  float64            `json:"max_ride_minutes"`
+	AvgRideMinutes  float64            `json:"avg_ride_minutes"`
+}
+
+// travel answers distance and time questions between points.
+type travel struct {
+	school        LatLng
+	metersPerSec  float64
+	dwellSeconds  float64
+	maxRideSecond float64
+	walkRadiusM   float64
+}
+
+func newTravel(o PlanOptions) travel {
+	return travel{
+		school:        o.School,
+		metersPerSec:  o.SpeedKmph * 1000 / 3600,
+		dwellSeconds:  stopDwell.Seconds(),
+		maxRideSecond: o.MaxRideMinutes * 60,
+		walkRadiusM:   o.WalkRadiusM,
+	}
+}
+
+func (t travel) meters(a, b LatLng) float64 { return distanceMeters(a, b) * roadFactor }
+
+func (t travel) seconds(a, b LatLng) float64 { return t.meters(a, b) / t.metersPerSec }
+
+// rideSeconds returns each stop's ride time to the school when the stops are
+// visited in order.
+func (t travel) rideSeconds(stops []LatLng) []float64 {
+	out := make([]float64, len(stops))
+	next, acc := t.school, 0.0
+	for i := len(stops) - 1; i >= 0; i-- {
+		if i < len(stops)-1 {
+			acc += t.dwellSeconds
+		}
+		acc += t.seconds(stops[i], next)
+		out[i] = acc
+		next = stops[i]
+	}
+	return out
+}
+
+// pathSeconds is the time from the first stop to the school.
+func (t travel) pathSeconds(stops []LatLng) float64 {
+	if len(stops) == 0 {
+		return 0
+	}
+	return t.rideSeconds(stops)[0]
+}
+
+func (t travel) pathMeters(stops []LatLng) float64 {
+	total := 0.0
+	for i := range stops {
+		next := t.school
+		if i+1 < len(stops) {
+			next = stops[i+1]
+		}
+		total += t.meters(stops[i], next)
+	}
+	return total
+}
+
+// cluster groups pickup points into stops within walking distance. The
+// farthest unassigned point seeds each stop; points within the walk radius
+// of the seed join it, and the stop sits at their centroid. Members farther
+// than the radius from the centroid go back to the pool, so nobody walks
+// further than the radius. A stop holds at most maxLoad students.
+type cluster struct {
+	location LatLng
+	members  []PlanStudent
+}
+
+func (t travel) cluster(points []PlanStudent, maxLoad int) []cluster {
+	pool := append([]PlanStudent(nil), points...)
+	sort.SliceStable(pool, func(i, j int) bool {
+		di, dj := distanceMeters(pool[i].Point, t.school), distanceMeters(pool[j].Point, t.school)
+		if di != dj {
+			return di > dj
+		}
+		return pool[i].StudentID < pool[j].StudentID
+	})
+
+	var out []cluster
+	for len(pool) > 0 {
+		seed := pool[0]
+		var near, rest []PlanStudent
+		for _, p := range pool {
+			if distanceMeters(seed.Point, p.Point) <= t.walkRadiusM {
+				near = append(near, p)
+			} else {
+				rest = append(rest, p)
+			}
+		}
+		if len(near) > maxLoad {
+			sort.SliceStable(near, func(i, j int) bool {
+				return distanceMeters(seed.Point, near[i].Point) < distanceMeters(seed.Point, near[j].Point)
+			})
+			rest = append(rest, near[maxLoad:]...)
+			near = near[:maxLoad]
+		}
+
+		centre := centroid(near)
+		var members []PlanStudent
+		for _, p := range near {
+			if distanceMeters(centre, p.Point) <= t.walkRadiusM {
+				members = append(members, p)
+			} else {
+				rest = append(rest, p)
+			}
+		}
+		out = append(out, cluster{location: centre, members: members})
+
+		// Keep the pool in its farthest-first order.
+		left := make(map[string]bool, len(rest))
+		for _, r := range rest {
+			left[r.StudentID] = true
+		}
+		keep := make([]PlanStudent, 0, len(rest))
+		for _, p := range pool {
+			if left[p.StudentID] {
+				keep = append(keep, p)
+			}
+		}
+		pool = keep
+	}
+	return out
+}
+
+func centroid(points []PlanStudent) LatLng {
+	var c LatLng
+	for _, p := range points {
+		c.Lat += p.Point.Lat
+		c.Lng += p.Point.Lng
+	}
+	n := float64(len(points))
+	return LatLng{Lat: c.Lat / n, Lng: c.Lng / n}
+}
+
+// sequence joins stops into routes with the Clarke-Wright savings heuristic
+// for open routes that end at the school. Joining a route ending at i to one
+// starting at j saves the drive from i to the school less the drive from i
+// to j. Joins that would exceed capacity or the ride limit of the first stop
+// are skipped. The result lists indexes into loads, in visiting order.
+func (t travel) sequence(locations []LatLng, loads []int, capacity int) [][]int {
+	n := len(locations)
+	routeOf := make([]int, n)
+	routes := make([][]int, n)
+	routeLoad := make([]int, n)
+	for i := range locations {
+		routeOf[i] = i
+		routes[i] = []int{i}
+		routeLoad[i] = loads[i]
+	}
+
+	type saving struct {
+		i, j  int
+		value float64
+	}
+	var savings []saving
+	for i := 0; i < n; i++ {
+		toSchool := t.seconds(locations[i], t.school)
+		for j := 0; j < n; j++ {
+			if i == j {
+				continue
+			}
+			if v := toSchool - t.seconds(locations[i], locations[j]); v > 0 {
+				savings = append(savings, saving{i, j, v})
+			}
+		}
+	}
+	sort.SliceStable(savings, func(a, b int) bool { return savings[a].value > savings[b].value })
+
+	stopsOf := func(route []int) []LatLng {
+		out := make([]LatLng, len(route))
+		for k, idx := range route {
+			out[k] = locations[idx]
+		}
+		return out
+	}
+	for _, s := range savings {
+		a, b := routeOf[s.i], routeOf[s.j]
+		if a == b || routes[a] == nil || routes[b] == nil {
+			continue
+		}
+		ra, rb := routes[a], routes[b]
+		if ra[len(ra)-1] != s.i || rb[0] != s.j {
+			continue
+		}
+		if routeLoad[a]+routeLoad[b] > capacity {
+			continue
+		}
+		merged := append(append([]int{}, ra...), rb...)
+		if t.pathSeconds(stopsOf(merged)) > t.maxRideSecond {
+			continue
+		}
+		routes[a], routes[b] = merged, nil
+		routeLoad[a] += routeLoad[b]
+		for _, idx := range rb {
+			routeOf[idx] = a
+		}
+	}
+
+	var out [][]int
+	for _, r := range routes {
+		if r != nil {
+			out = append(out, t.twoOpt(r, locations))
+		}
+	}
+	return out
+}
+
+// twoOpt reverses stretches of a route while that shortens it.
+func (t travel) twoOpt(route []int, locations []LatLng) []int {
+	best := append([]int{}, route...)
+	cost := func(r []int) float64 {
+		pts := make([]LatLng, len(r))
+		for k, idx := range r {
+			pts[k] = locations[idx]
+		}
+		return t.pathSeconds(pts)
+	}
+	bestCost := cost(best)
+	for improved := true; improved; {
+		improved = false
+		for i := 0; i < len(best)-1; i++ {
+			for j := i + 1; j < len(best); j++ {
+				candidate := append([]int{}, best...)
+				for a, b := i, j; a < b; a, b = a+1, b-1 {
+					candidate[a], candidate[b] = candidate[b], candidate[a]
+				}
+				if c := cost(candidate); c < bestCost-1e-9 {
+					best, bestCost, improved = candidate, c, true
+				}
+			}
+		}
+	}
+	return best
+}
+
+// assignVehicles gives each route, largest load first, the smallest free
+// vehicle that can carry it. It returns the vehicle index per route, -1 for
+// none.
+func assignVehicles(loads []int, vehicles []PlanVehicle) []int {
+	order := make([]int, len(loads))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return loads[order[a]] > loads[order[b]] })
+
+	used := make([]bool, len(vehicles))
+	out := make([]int, len(loads))
+	for _, r := range order {
+		out[r] = -1
+		for v := range vehicles {
+			if used[v] || vehicles[v].Capacity < loads[r] {
+				continue
+			}
+			if out[r] == -1 || vehicles[v].Capacity < vehicles[out[r]].Capacity {
+				out[r] = v
+			}
+		}
+		if out[r] >= 0 {
+			used[out[r]] = true
+		}
+	}
+	return out
+}
+
+// planRoutes proposes stops, stop sequences and vehicles for the students.
+func planRoutes(students []PlanStudent, vehicles []PlanVehicle, o PlanOptions) PlanResult {
+	t := newTravel(o)
+	res := PlanResult{Routes: []PlannedRoute{}, Students: []StudentRide{}, Unplanned: []UnplannedStudent{}, Warnings: []string{}}
+
+	capacity := 0
+	for _, v := range vehicles {
+		if v.Capacity > capacity {
+			capacity = v.Capacity
+		}
+	}
+	if capacity == 0 {
+		for _, s := range students {
+			res.Unplanned = append(res.Unplanned, UnplannedStudent{StudentID: s.StudentID, Reason: "no vehicle available"})
+		}
+		res.Warnings = append(res.Warnings, "no vehicles with capacity to plan for")
+		return res
+	}
+
+	var reachable []PlanStudent
+	for _, s := range students {
+		if t.seconds(s.Point, t.school) > t.maxRideSecond {
+			res.Unplanned = append(res.Unplanned, UnplannedStudent{StudentID: s.StudentID, Reason: "a direct ride exceeds the maximum ride time"})
+			continue
+		}
+		reachable = append(reachable, s)
+	}
+
+	clusters := t.cluster(reachable, capacity)
+	locations := make([]LatLng, len(clusters))
+	loads := make([]int, len(clusters))
+	for i, c := range clusters {
+		locations[i], loads[i] = c.location, len(c.members)
+	}
+	sequences := t.sequence(locations, loads, capacity)
+	// Longest routes first, so route numbers are stable for a given input.
+	sort.SliceStable(sequences, func(a, b int) bool {
+		return t.pathSeconds(pick(locations, sequences[a])) > t.pathSeconds(pick(locations, sequences[b]))
+	})
+
+	routeLoads := make([]int, len(sequences))
+	for r, seq := range sequences {
+		for _, idx := range seq {
+			routeLoads[r] += loads[idx]
+		}
+	}
+	vehicleOf := assignVehicles(routeLoads, vehicles)
+
+	unmatched := 0
+	for r, seq := range sequences {
+		route := PlannedRoute{Name: fmt.Sprintf("Route %d", r+1), Load: routeLoads[r]}
+		if v := vehicleOf[r]; v >= 0 {
+			route.VehicleID = vehicles[v].VehicleID
+			route.RegistrationNumber = vehicles[v].RegistrationNumber
+			route.Capacity = vehicles[v].Capacity
+		} else {
+			unmatched++
+		}
+		for k, idx := range seq {
+			stop := PlannedStop{Name: fmt.Sprintf("Route %d stop %d", r+1, k+1), Location: locations[idx], Load: loads[idx]}
+			for _, m := range clusters[idx].members {
+				stop.StudentIDs = append(stop.StudentIDs, m.StudentID)
+			}
+			route.Stops = append(route.Stops, stop)
+		}
+		res.Routes = append(res.Routes, route)
+	}
+	if unmatched > 0 {
+		res.Warnings = append(res.Warnings, fmt.Sprintf("%d route(s) have no vehicle: the fleet is too small or its vehicles too small for the proposed loads", unmatched))
+	}
+	finishPlan(&res, t, reachable)
+	return res
+}
+
+func pick(locations []LatLng, idx []int) []LatLng {
+	out := make([]LatLng, len(idx))
+	for k, i := range idx {
+		out[k] = locations[i]
+	}
+	return out
+}
+
+// finishPlan fills in ride times, distances and the per-student view of
+// the routes.
+func finishPlan(res *PlanResult, t travel, students []PlanStudent) {
+	points := make(map[string]LatLng, len(students))
+	for _, s := range students {
+		points[s.StudentID] = s.Point
+	}
+	var rideTotal float64
+	res.TotalDistanceKm, res.MaxRideMinutes, res.AvgRideMinutes = 0, 0, 0
+	res.Students = res.Students[:0]
+	for r := range res.Routes {
+		route := &res.Routes[r]
+		stops := make([]LatLng, len(route.Stops))
+		for k, s := range route.Stops {
+			stops[k] = s.Location
+		}
+		rides := t.rideSeconds(stops)
+		route.DistanceKm = round2(t.pathMeters(stops) / 1000)
+		route.DurationMinutes = 0
+		if len(rides) > 0 {
+			route.DurationMinutes = round2(rides[0] / 60)
+		}
+		res.TotalDistanceKm += route.DistanceKm
+		for k := range route.Stops {
+			stop := &route.Stops[k]
+			stop.RideMinutes = round2(rides[k] / 60)
+			for _, id := range stop.StudentIDs {
+				res.Students = append(res.Students, StudentRide{
+					StudentID:   id,
+					RouteIndex:  r,
+					StopIndex:   k,
+					WalkMeters:  math.Round(distanceMeters(points[id], stop.Location)),
+					RideMinutes: stop.RideMinutes,
+				})
+				rideTotal += stop.RideMinutes
+				res.MaxRideMinutes = math.Max(res.MaxRideMinutes, stop.RideMinutes)
+			}
+		}
+	}
+	res.TotalDistanceKm = round2(res.TotalDistanceKm)
+	if len(res.Students) > 0 {
+		res.AvgRideMinutes = round2(rideTotal / float64(len(res.Students)))
+	}
+}
+
+// ExistingRoute is a running route that new students can be fitted into.
+type ExistingRoute struct {
+	RouteID            string
+	Name               string
+	VehicleID          string
+	RegistrationNumber string
+	Capacity           int
+	Load               int
+	Stops              []ExistingStop
+}
+
+type ExistingStop struct {
+	StopID   string
+	Name     string
+	Location LatLng
+	Load     int
+}
+
+// rebalance fits students into existing routes, farthest first. A student
+// joins the nearest existing stop within walking distance on a route with a
+// free seat; otherwise a new stop goes where it adds the least time to a
+// route with a free seat. Nobody's ride may exceed the limit, unless the
+// route already did before. Only the routes that change are returned.
+func rebalance(routes []ExistingRoute, students []PlanStudent, o PlanOptions) PlanResult {
+	t := newTravel(o)
+	res := PlanResult{Routes: []PlannedRoute{}, Students: []StudentRide{}, Unplanned: []UnplannedStudent{}, Warnings: []string{}}
+
+	plan := make([]PlannedRoute, len(routes))
+	for r, er := range routes {
+		plan[r] = PlannedRoute{
+			RouteID: er.RouteID, Name: er.Name, VehicleID: er.VehicleID,
+			RegistrationNumber: er.RegistrationNumber, Capacity: er.Capacity, Load: er.Load,
+		}
+		for _, s := range er.Stops {
+			plan[r].Stops = append(plan[r].Stops, PlannedStop{StopID: s.StopID, Name: s.Name, Location: s.Location, Load: s.Load})
+		}
+	}
+	changed := make([]bool, len(routes))
+	newStops := make([]int, len(routes))
+
+	ordered := append([]PlanStudent(nil), students...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return distanceMeters(ordered[i].Point, t.school) > distanceMeters(ordered[j].Point, t.school)
+	})
+
+	for _, s := range ordered {
+		bestRoute, bestStop, bestWalk := -1, -1, math.Inf(1)
+		for r := range plan {
+			if plan[r].Load >= plan[r].Capacity {
+				continue
+			}
+			for k, stop := range plan[r].Stops {
+				if w := distanceMeters(s.Point, stop.Location); w <= t.walkRadiusM && w < bestWalk {
+					bestRoute, bestStop, bestWalk = r, k, w
+				}
+			}
+		}
+		if bestRoute >= 0 {
+			stop := &plan[bestRoute].Stops[bestStop]
+			stop.StudentIDs = append(stop.StudentIDs, s.StudentID)
+			stop.Load++
+			plan[bestRoute].Load++
+			changed[bestRoute] = true
+			continue
+		}
+
+		insRoute, insAt, insCost := -1, -1, math.Inf(1)
+		for r := range plan {
+			if plan[r].Load >= plan[r].Capacity {
+				continue
+			}
+			stops := make([]LatLng, len(plan[r].Stops))
+			for k, st := range plan[r].Stops {
+				stops[k] = st.Location
+			}
+			before := t.pathSeconds(stops)
+			limit := math.Max(t.maxRideSecond, before)
+			for at := 0; at <= len(stops); at++ {
+				candidate := make([]LatLng, 0, len(stops)+1)
+				candidate = append(candidate, stops[:at]...)
+				candidate = append(candidate, s.Point)
+				candidate = append(candidate, stops[at:]...)
+				after := t.pathSeconds(candidate)
+				if after > limit {
+					continue
+				}
+				if cost := after - before; cost < insCost {
+					insRoute, insAt, insCost = r, at, cost
+				}
+			}
+		}
+		if insRoute < 0 {
+			res.Unplanned = append(res.Unplanned, UnplannedStudent{
+				StudentID: s.StudentID,
+				Reason:    "no route has a free seat within the maximum ride time",
+			})
+			continue
+		}
+		route := &plan[insRoute]
+		newStops[insRoute]++
+		stop := PlannedStop{
+			Name:       fmt.Sprintf("%s new stop %d", route.Name, newStops[insRoute]),
+			Location:   s.Point,
+			StudentIDs: []string{s.StudentID},
+			Load:       1,
+		}
+		route.Stops = append(route.Stops[:insAt], append([]PlannedStop{stop}, route.Stops[insAt:]...)...)
+		route.Load++
+		changed[insRoute] = true
+	}
+
+	for r := range plan {
+		if changed[r] {
+			res.Routes = append(res.Routes, plan[r])
+		}
+	}
+	finishPlan(&res, t, students)
+	return res
+}
@@ -0,0 +1,155 @@
+package transport
+
+import (
+	"fmt"
+	"testing"
+)
+
+var school = LatLng{Lat: 12.9716, Lng: 77.5946}
+
+// north returns a point metres north and east of the school.
+func north(m, east float64) LatLng {
+	return LatLng{Lat: school.Lat + m/111_195, Lng: school.Lng + east/108_500}
+}
+
+func planOptions() PlanOptions {
+	return PlanOptions{School: school, MaxRideMinutes: 60, WalkRadiusM: 300, SpeedKmph: 25}
+}
+
+func TestClusterWalkRadiusAndCapacity(t *testing.T) {
+	tr := newTravel(planOptions())
+	var students []PlanStudent
+	// Five neighbours 50m apart, and one child 2km away.
+	for i := 0; i < 5; i++ {
+		students = append(students, PlanStudent{StudentID: fmt.Sprintf("s%d", i), Point: north(3000+float64(i)*50, 0)})
+	}
+	students = append(students, PlanStudent{StudentID: "far", Point: north(5000, 0)})
+
+	clusters := tr.cluster(students, 3)
+	seen := map[string]bool{}
+	for _, c := range clusters {
+		if len(c.members) > 3 {
+			t.Fatalf("cluster over capacity: %d", len(c.members))
+		}
+		for _, m := range c.members {
+			if w := distanceMeters(m.Point, c.location); w > 300 {
+				t.Fatalf("%s walks %.0fm", m.StudentID, w)
+			}
+			seen[m.StudentID] = true
+		}
+	}
+	if len(seen) != len(students) {
+		t.Fatalf("expected every student in a cluster, got %d", len(seen))
+	}
+	if len(clusters) != 3 {
+		t.Fatalf("expected 3 clusters, got %d", len(clusters))
+	}
+	if len(clusters[0].members) != 1 || clusters[0].members[0].StudentID != "far" {
+		t.Fatalf("expected the farthest child to seed the first stop, got %+v", clusters[0].members)
+	}
+}
+
+func TestSequenceCapacityAndRideLimit(t *testing.T) {
+	o := planOptions()
+	tr := newTravel(o)
+	// Stops strung out along one road north of the school.
+	locations := []LatLng{north(2000, 0), north(4000, 0), north(6000, 0), north(8000, 0)}
+	loads := []int{10, 10, 10, 10}
+
+	routes := tr.sequence(locations, loads, 40)
+	if len(routes) != 1 {
+		t.Fatalf("expected one route, got %v", routes)
+	}
+	if got := routes[0]; got[0] != 3 || got[3] != 0 {
+		t.Fatalf("expected farthest stop first and nearest last, got %v", got)
+	}
+
+	if routes := tr.sequence(locations, loads, 20); len(routes) != 2 {
+		t.Fatalf("expected capacity to split into two routes, got %v", routes)
+	}
+
+	o.MaxRideMinutes = 20
+	tr = newTravel(o)
+	for _, r := range tr.sequence(locations, loads, 40) {
+		if ride := tr.pathSeconds(pick(locations, r)); ride > 20*60 && len(r) > 1 {
+			t.Fatalf("route %v rides %.0fs", r, ride)
+		}
+	}
+}
+
+func TestAssignVehiclesBestFit(t *testing.T) {
+	vehicles := []PlanVehicle{{VehicleID: "big", Capacity: 50}, {VehicleID: "van", Capacity: 12}, {VehicleID: "mid", Capacity: 30}}
+	got := assignVehicles([]int{10, 28, 45}, vehicles)
+	if got[0] != 1 || got[1] != 2 || got[2] != 0 {
+		t.Fatalf("unexpected assignment %v", got)
+	}
+	if got := assignVehicles([]int{40, 40}, vehicles); got[0] != 0 || got[1] != -1 {
+		t.Fatalf("expected the second route to go without, got %v", got)
+	}
+}
+
+func TestPlanRoutes(t *testing.T) {
+	var students []PlanStudent
+	for i := 0; i < 30; i++ {
+		students = append(students, PlanStudent{StudentID: fmt.Sprintf("n%02d", i), Point: north(1000+float64(i)*150, 0)})
+		students = append(students, PlanStudent{StudentID: fmt.Sprintf("e%02d", i), Point: north(0, 1000+float64(i)*150)})
+	}
+	students = append(students, PlanStudent{StudentID: "remote", Point: north(40000, 0)})
+	vehicles := []PlanVehicle{{VehicleID: "v1", Capacity: 40}, {VehicleID: "v2", Capacity: 40}, {VehicleID: "v3", Capacity: 20}}
+
+	res := planRoutes(students, vehicles, planOptions())
+	if len(res.Unplanned) != 1 || res.Unplanned[0].StudentID != "remote" {
+		t.Fatalf("expected only the remote child unplanned, got %+v", res.Unplanned)
+	}
+	if len(res.Students) != 60 {
+		t.Fatalf("expected 60 rides, got %d", len(res.Students))
+	}
+	for _, r := range res.Routes {
+		if r.VehicleID == "" || r.Load > r.Capacity {
+			t.Fatalf("route %s: vehicle %q load %d capacity %d", r.Name, r.VehicleID, r.Load, r.Capacity)
+		}
+	}
+	for _, s := range res.Students {
+		if s.RideMinutes > 60 || s.WalkMeters > 300 {
+			t.Fatalf("%s rides %.1f min and walks %.0fm", s.StudentID, s.RideMinutes, s.WalkMeters)
+		}
+	}
+	if res.MaxRideMinutes <= 0 || res.AvgRideMinutes > res.MaxRideMinutes {
+		t.Fatalf("unexpected ride summary %.2f / %.2f", res.AvgRideMinutes, res.MaxRideMinutes)
+	}
+}
+
+func TestRebalance(t *testing.T) {
+	routes := []ExistingRoute{{
+		RouteID: "r1", Name: "North", VehicleID: "v1", Capacity: 3, Load: 1,
+		Stops: []ExistingStop{{StopID: "a", Name: "Far", Location: north(6000, 0), Load: 1}, {StopID: "b", Name: "Near", Location: north(2000, 0)}},
+	}, {
+		RouteID: "r2", Name: "East", VehicleID: "v2", Capacity: 10, Load: 0,
+		Stops: []ExistingStop{{StopID: "c", Name: "East", Location: north(0, 3000)}},
+	}}
+	students := []PlanStudent{
+		{StudentID: "walks", Point: north(6100, 0)},
+		{StudentID: "between", Point: north(4000, 50)},
+		{StudentID: "full", Point: north(5000, 0)},
+		{StudentID: "remote", Point: north(60000, 0)},
+	}
+
+	res := rebalance(routes, students, planOptions())
+	if len(res.Unplanned) != 1 || res.Unplanned[0].StudentID != "remote" {
+		t.Fatalf("expected only the remote child unplanned, got %+v", res.Unplanned)
+	}
+	if len(res.Routes) == 0 || res.Routes[0].RouteID != "r1" {
+		t.Fatalf("expected the north route to change, got %+v", res.Routes)
+	}
+	first := res.Routes[0]
+	if first.Load != 3 || first.Stops[0].StopID != "a" || first.Stops[0].StudentIDs[0] != "walks" {
+		t.Fatalf("expected the nearby child on the existing stop, got %+v", first)
+	}
+	if len(first.Stops) != 3 || first.Stops[1].StopID != "" || first.Stops[2].StopID != "b" {
+		t.Fatalf("expected a new stop between the existing ones, got %+v", first.Stops)
+	}
+	// The north route is then full, so the last child goes east.
+	if len(res.Routes) != 2 || res.Routes[1].RouteID != "r2" || res.Routes[1].Stops[0].StopID != "" {
+		t.Fatalf("expected the east route to take the overflow, got %+v", res.Routes)
+	}
+}
@@ -0,0 +1,786 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/schoolerp/api/internal/db"
+	"github.com/schoolerp/api/internal/foundation/audit"
+)
+
+var (
+	ErrInvalidPlan  = errors.New("invalid planning input")
+	ErrPlanNotFound = errors.New("route plan not found")
+	ErrPlanClosed   = errors.New("route plan has already been applied or discarded")
+	ErrPlanStale    = errors.New("the routes have changed since the plan was made; plan again")
+)
+
+const (
+	maxPlanStudents   = 5000
+	maxPickupBatch    = 1000
+	planKindFull      = "full"
+	planKindRebalance = "rebalance"
+	noPickupPoint     = "no pickup point"
+	alreadyHasAStop   = "already allocated to a stop"
+	routeHasNoVehicle = "the planned route has no vehicle"
+)
+
+// DefaultPlanningSettings apply to tenants that have not saved their own.
+// The school location has no default.
+var DefaultPlanningSettings = db.TransportPlanningSettings{
+	ArriveBy:       "08:00",
+	MaxRideMinutes: 60,
+	WalkRadiusM:    300,
+	SpeedKmph:      25,
+}
+
+// PlanningService proposes routes, stops and vehicle assignments from
+// students' pickup points, and applies the proposals it is asked to.
+type PlanningService struct {
+	q     *db.Queries
+	pool  *pgxpool.Pool
+	audit *audit.Logger
+	fleet *FleetService
+}
+
+// NewPlanningService builds the service. With a fleet service, vehicles
+// without in-date compliance documents are left out of plans.
+func NewPlanningService(q *db.Queries, pool *pgxpool.Pool, audit *audit.Logger, fleet *FleetService) *PlanningService {
+	return &PlanningService{q: q, pool: pool, audit: audit, fleet: fleet}
+}
+
+func (s *PlanningService) log(ctx context.Context, tenantID pgtype.UUID, actor TrackingActor, action, resourceType string, resourceID pgtype.UUID, after any) {
+	if s.audit == nil {
+		return
+	}
+	_ = s.audit.Log(ctx, audit.Entry{
+		TenantID:     tenantID,
+		UserID:       toPgUUID(actor.UserID),
+		RequestID:    actor.RequestID,
+		Action:       action,
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+		After:        after,
+		IPAddress:    actor.IP,
+	})
+}
+
+// Settings
+
+func (s *PlanningService) GetSettings(ctx context.Context, tenantID string) (db.TransportPlanningSettings, error) {
+	tid := toPgUUID(tenantID)
+	settings, err := s.q.GetTransportPlanningSettings(ctx, tid)
+	if errors.Is(err, pgx.ErrNoRows) {
+		settings = DefaultPlanningSettings
+		settings.TenantID = tid
+		return settings, nil
+	}
+	return settings, err
+}
+
+func (s *PlanningService) UpdateSettings(ctx context.Context, tenantID string, in db.TransportPlanningSettings, actor TrackingActor) (db.TransportPlanningSettings, error) {
+	if in.SchoolLatitude.Valid != in.SchoolLongitude.Valid {
+		return db.TransportPlanningSettings{}, fmt.Errorf("%w: school_latitude and school_longitude must be sent together", ErrInvalidPlan)
+	}
+	if in.SchoolLatitude.Valid && !(LatLng{Lat: in.SchoolLatitude.Float64, Lng: in.SchoolLongitude.Float64}).Valid() {
+		return db.TransportPlanningSettings{}, fmt.Errorf("%w: school location out of range", ErrInvalidPlan)
+	}
+	if _, err := time.Parse("15:04", in.ArriveBy); err != nil {
+		return db.TransportPlanningSettings{}, fmt.Errorf("%w: arrive_by must be HH:MM", ErrInvalidPlan)
+	}
+	if in.MaxRideMinutes <= 0 || in.WalkRadiusM < 0 || in.SpeedKmph <= 0 {
+		return db.TransportPlanningSettings{}, fmt.Errorf("%w: max_ride_minutes and speed_kmph must be positive and walk_radius_m not negative", ErrInvalidPlan)
+	}
+	in.TenantID = toPgUUID(tenantID)
+	in.UpdatedBy = toPgUUID(actor.UserID)
+	settings, err := s.q.UpsertTransportPlanningSettings(ctx, in)
+	if err != nil {
+		return settings, err
+	}
+	s.log(ctx, in.TenantID, actor, "transport.planning_settings.update", "transport_planning_settings", pgtype.UUID{}, settings)
+	return settings, nil
+}
+
+// Pickup points
+
+type PickupPointInput struct {
+	StudentID string  `json:"student_id"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Address   string  `json:"address"`
+}
+
+// SavePickupPoints stores geocoded pickup points in bulk and returns how
+// many were saved. Unknown students are skipped.
+func (s *PlanningService) SavePickupPoints(ctx context.Context, tenantID string, points []PickupPointInput, actor TrackingActor) (int64, error) {
+	if len(points) == 0 || len(points) > maxPickupBatch {
+		return 0, fmt.Errorf("%w: send between 1 and %d pickup points", ErrInvalidPlan, maxPickupBatch)
+	}
+	p := db.UpsertTransportPickupPointsParams{TenantID: toPgUUID(tenantID), UpdatedBy: toPgUUID(actor.UserID)}
+	seen := make(map[pgtype.UUID]bool, len(points))
+	for i, in := range points {
+		id := toPgUUID(in.StudentID)
+		if !id.Valid {
+			return 0, fmt.Errorf("%w: point %d has no valid student_id", ErrInvalidPlan, i)
+		}
+		if seen[id] {
+			return 0, fmt.Errorf("%w: student %s appears twice", ErrInvalidPlan, in.StudentID)
+		}
+		seen[id] = true
+		if pos := (LatLng{Lat: in.Latitude, Lng: in.Longitude}); !pos.Valid() || (pos.Lat == 0 && pos.Lng == 0) {
+			return 0, fmt.Errorf("%w: point %d has no valid location", ErrInvalidPlan, i)
+		}
+		p.StudentIDs = append(p.StudentIDs, id)
+		p.Latitudes = append(p.Latitudes, in.Latitude)
+		p.Longitudes = append(p.Longitudes, in.Longitude)
+		p.Addresses = append(p.Addresses, optionalText(in.Address))
+	}
+	saved, err := s.q.UpsertTransportPickupPoints(ctx, p)
+	if err != nil {
+		return 0, err
+	}
+	s.log(ctx, p.TenantID, actor, "transport.pickup_points.save", "transport_pickup_point", pgtype.UUID{}, map[string]any{
+		"received": len(points),
+		"saved":    saved,
+	})
+	return saved, nil
+}
+
+func (s *PlanningService) ListPickupPoints(ctx context.Context, tenantID string) ([]db.TransportPickupPoint, error) {
+	return s.q.ListTransportPickupPoints(ctx, toPgUUID(tenantID))
+}
+
+func (s *PlanningService) DeletePickupPoint(ctx context.Context, tenantID, studentID string, actor TrackingActor) error {
+	tid, sid := toPgUUID(tenantID), toPgUUID(studentID)
+	err := s.q.DeleteTransportPickupPoint(ctx, tid, sid)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("%w: the student has no pickup point", ErrInvalidPlan)
+	}
+	if err != nil {
+		return err
+	}
+	s.log(ctx, tid, actor, "transport.pickup_point.delete", "transport_pickup_point", sid, nil)
+	return nil
+}
+
+// Planning
+
+// PlanRequest overrides the tenant's planning settings for one plan.
+type PlanRequest struct {
+	// StudentIDs limits the plan to these students. A full plan defaults to
+	// every active student with a pickup point; a rebalance to students
+	// allocated to a route without a stop.
+	StudentIDs []string `json:"student_ids"`
+	// VehicleIDs limits a full plan to these vehicles; by default every
+	// active vehicle is used.
+	VehicleIDs []string `json:"vehicle_ids"`
+	// IncludeUnallocated adds students with a pickup point and no
+	// allocation to a rebalance.
+	IncludeUnallocated bool     `json:"include_unallocated"`
+	MaxRideMinutes     *float64 `json:"max_ride_minutes"`
+	WalkRadiusM        *float64 `json:"walk_radius_m"`
+	SpeedKmph          *float64 `json:"speed_kmph"`
+}
+
+// planRecord is what a plan was made with, kept to apply it later.
+type planRecord struct {
+	PlanOptions
+	ArriveBy string `json:"arrive_by"`
+}
+
+// RoutePlan is a stored plan with its decoded result.
+type RoutePlan struct {
+	db.TransportRoutePlan
+	Result *PlanResult `json:"result,omitempty"`
+}
+
+func (s *PlanningService) options(ctx context.Context, tenantID string, req PlanRequest) (planRecord, error) {
+	settings, err := s.GetSettings(ctx, tenantID)
+	if err != nil {
+		return planRecord{}, err
+	}
+	rec := planRecord{
+		PlanOptions: PlanOptions{
+			School:         LatLng{Lat: settings.SchoolLatitude.Float64, Lng: settings.SchoolLongitude.Float64},
+			MaxRideMinutes: float64(settings.MaxRideMinutes),
+			WalkRadiusM:    float64(settings.WalkRadiusM),
+			SpeedKmph:      float64(settings.SpeedKmph),
+		},
+		ArriveBy: settings.ArriveBy,
+	}
+	if req.MaxRideMinutes != nil {
+		rec.MaxRideMinutes = *req.MaxRideMinutes
+	}
+	if req.WalkRadiusM != nil {
+		rec.WalkRadiusM = *req.WalkRadiusM
+	}
+	if req.SpeedKmph != nil {
+		rec.SpeedKmph = *req.SpeedKmph
+	}
+	if !settings.SchoolLatitude.Valid {
+		return rec, fmt.Errorf("%w: set the school location in the planning settings first", ErrInvalidPlan)
+	}
+	return rec, rec.validate()
+}
+
+// selectStudents picks the requested students' pickup points. Requested
+// students without one are reported as unplanned.
+func selectStudents(points []db.TransportPickupPoint, ids []string, keep func(db.TransportPickupPoint) bool) ([]PlanStudent, []UnplannedStudent, error) {
+	byID := make(map[string]db.TransportPickupPoint, len(points))
+	for _, p := range points {
+		byID[p.StudentID.String()] = p
+	}
+	var (
+		students  []PlanStudent
+		unplanned []UnplannedStudent
+	)
+	add := func(p db.TransportPickupPoint) {
+		students = append(students, PlanStudent{StudentID: p.StudentID.String(), Point: LatLng{Lat: p.Latitude, Lng: p.Longitude}})
+	}
+	if len(ids) == 0 {
+		for _, p := range points {
+			if keep(p) {
+				add(p)
+			}
+		}
+	} else {
+		seen := map[string]bool{}
+		for _, raw := range ids {
+			id := toPgUUID(raw)
+			if !id.Valid {
+				return nil, nil, fmt.Errorf("%w: invalid student id %q", ErrInvalidPlan, raw)
+			}
+			key := id.String()
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			p, ok := byID[key]
+			if !ok {
+				unplanned = append(unplanned, UnplannedStudent{StudentID: key, Reason: noPickupPoint})
+				continue
+			}
+			add(p)
+		}
+	}
+	if len(students) > maxPlanStudents {
+		return nil, nil, fmt.Errorf("%w: plans are limited to %d students", ErrInvalidPlan, maxPlanStudents)
+	}
+	return students, unplanned, nil
+}
+
+// CreatePlan proposes routes from scratch for the chosen students and
+// vehicles and stores the proposal as a draft.
+func (s *PlanningService) CreatePlan(ctx context.Context, tenantID string, req PlanRequest, actor TrackingActor) (RoutePlan, error) {
+	tid := toPgUUID(tenantID)
+	rec, err := s.options(ctx, tenantID, req)
+	if err != nil {
+		return RoutePlan{}, err
+	}
+	points, err := s.q.ListTransportPickupPoints(ctx, tid)
+	if err != nil {
+		return RoutePlan{}, err
+	}
+	students, unplanned, err := selectStudents(points, req.StudentIDs, func(db.TransportPickupPoint) bool { return true })
+	if err != nil {
+		return RoutePlan{}, err
+	}
+
+	vehicles, warnings, err := s.planVehicles(ctx, tid, req.VehicleIDs)
+	if err != nil {
+		return RoutePlan{}, err
+	}
+	res := planRoutes(students, vehicles, rec.PlanOptions)
+	res.Unplanned = append(unplanned, res.Unplanned...)
+	res.Warnings = append(warnings, res.Warnings...)
+	return s.store(ctx, tid, planKindFull, rec, res, actor)
+}
+
+// planVehicles returns the active vehicles to plan with, leaving out those
+// that are not compliant.
+func (s *PlanningService) planVehicles(ctx context.Context, tenantID pgtype.UUID, ids []string) ([]PlanVehicle, []string, error) {
+	all, err := s.q.ListVehicles(ctx, tenantID)
+	if err != nil {
+		return nil, nil, err
+	}
+	wanted := map[pgtype.UUID]bool{}
+	for _, raw := range ids {
+		id := toPgUUID(raw)
+		if !id.Valid {
+			return nil, nil, fmt.Errorf("%w: invalid vehicle id %q", ErrInvalidPlan, raw)
+		}
+		wanted[id] = true
+	}
+	var (
+		out      []PlanVehicle
+		warnings = []string{}
+	)
+	for _, v := range all {
+		if !v.IsActive || (len(wanted) > 0 && !wanted[v.ID]) {
+			continue
+		}
+		if s.fleet != nil {
+			err := s.fleet.EnsureVehicleCompliant(ctx, tenantID, v.ID)
+			if errors.Is(err, ErrVehicleNonCompliant) {
+				warnings = append(warnings, fmt.Sprintf("%s left out: %v", v.RegistrationNumber, err))
+				continue
+			}
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		out = append(out, PlanVehicle{VehicleID: v.ID.String(), RegistrationNumber: v.RegistrationNumber, Capacity: int(v.Capacity)})
+	}
+	return out, warnings, nil
+}
+
+// CreateRebalance fits new students into the running routes and stores the
+// proposal as a draft.
+func (s *PlanningService) CreateRebalance(ctx context.Context, tenantID string, req PlanRequest, actor TrackingActor) (RoutePlan, error) {
+	tid := toPgUUID(tenantID)
+	rec, err := s.options(ctx, tenantID, req)
+	if err != nil {
+		return RoutePlan{}, err
+	}
+	points, err := s.q.ListTransportPickupPoints(ctx, tid)
+	if err != nil {
+		return RoutePlan{}, err
+	}
+
+	var (
+		students  []PlanStudent
+		unplanned []UnplannedStudent
+	)
+	if len(req.StudentIDs) > 0 {
+		var chosen []PlanStudent
+		chosen, unplanned, err = selectStudents(points, req.StudentIDs, nil)
+		if err != nil {
+			return RoutePlan{}, err
+		}
+		stopOf := map[string]bool{}
+		for _, p := range points {
+			stopOf[p.StudentID.String()] = p.StopID.Valid
+		}
+		for _, st := range chosen {
+			if stopOf[st.StudentID] {
+				unplanned = append(unplanned, UnplannedStudent{StudentID: st.StudentID, Reason: alreadyHasAStop})
+				continue
+			}
+			students = append(students, st)
+		}
+	} else {
+		unstopped, err := s.q.ListUnstoppedTransportStudents(ctx, tid)
+		if err != nil {
+			return RoutePlan{}, err
+		}
+		waiting := make(map[string]bool, len(unstopped))
+		for _, id := range unstopped {
+			waiting[id.String()] = true
+		}
+		students, _, err = selectStudents(points, nil, func(p db.TransportPickupPoint) bool {
+			return waiting[p.StudentID.String()] || (req.IncludeUnallocated && !p.RouteID.Valid)
+		})
+		if err != nil {
+			return RoutePlan{}, err
+		}
+		planned := make(map[string]bool, len(students))
+		for _, st := range students {
+			planned[st.StudentID] = true
+		}
+		for id := range waiting {
+			if !planned[id] {
+				unplanned = append(unplanned, UnplannedStudent{StudentID: id, Reason: noPickupPoint})
+			}
+		}
+	}
+
+	rows, err := s.q.ListTransportPlanningStops(ctx, tid)
+	if err != nil {
+		return RoutePlan{}, err
+	}
+	// Students being placed who already ride a route without a stop are
+	// counted in its load; take them out so they are not counted twice.
+	routeOf := map[string]string{}
+	for _, p := range points {
+		if p.RouteID.Valid && !p.StopID.Valid {
+			routeOf[p.StudentID.String()] = p.RouteID.String()
+		}
+	}
+	placing := map[string]int{}
+	for _, st := range students {
+		if r, ok := routeOf[st.StudentID]; ok {
+			placing[r]++
+		}
+	}
+	routes, warnings := existingRoutes(rows, placing)
+
+	res := rebalance(routes, students, rec.PlanOptions)
+	res.Unplanned = append(unplanned, res.Unplanned...)
+	res.Warnings = append(warnings, res.Warnings...)
+	return s.store(ctx, tid, planKindRebalance, rec, res, actor)
+}
+
+// existingRoutes groups the running routes' stops. Routes with a stop that
+// is not on the map cannot be timed and are left out.
+func existingRoutes(rows []db.TransportPlanningStop, placing map[string]int) ([]ExistingRoute, []string) {
+	var (
+		routes   []ExistingRoute
+		skipped  = map[string]bool{}
+		warnings = []string{}
+	)
+	for _, row := range rows {
+		id := row.RouteID.String()
+		if skipped[id] {
+			continue
+		}
+		if len(routes) == 0 || routes[len(routes)-1].RouteID != id {
+			routes = append(routes, ExistingRoute{
+				RouteID:            id,
+				Name:               row.RouteName,
+				VehicleID:          row.VehicleID.String(),
+				RegistrationNumber: row.RegistrationNumber,
+				Capacity:           int(row.Capacity),
+				Load:               int(row.RouteLoad) - placing[id],
+			})
+		}
+		if !row.StopID.Valid {
+			continue
+		}
+		if !row.Latitude.Valid || !row.Longitude.Valid {
+			skipped[id] = true
+			routes = routes[:len(routes)-1]
+			warnings = append(warnings, fmt.Sprintf("%s left out: stop %q is not on the map", row.RouteName, row.StopName.String))
+			continue
+		}
+		r := &routes[len(routes)-1]
+		r.Stops = append(r.Stops, ExistingStop{
+			StopID:   row.StopID.String(),
+			Name:     row.StopName.String,
+			Location: LatLng{Lat: row.Latitude.Float64, Lng: row.Longitude.Float64},
+			Load:     int(row.StopLoad),
+		})
+	}
+	return routes, warnings
+}
+
+func (s *PlanningService) store(ctx context.Context, tenantID pgtype.UUID, kind string, rec planRecord, res PlanResult, actor TrackingActor) (RoutePlan, error) {
+	options, err := json.Marshal(rec)
+	if err != nil {
+		return RoutePlan{}, err
+	}
+	result, err := json.Marshal(res)
+	if err != nil {
+		return RoutePlan{}, err
+	}
+	plan, err := s.q.CreateTransportRoutePlan(ctx, db.CreateTransportRoutePlanParams{
+		TenantID:       tenantID,
+		Kind:           kind,
+		Options:        options,
+		Result:         result,
+		StudentCount:   int32(len(res.Students)),
+		RouteCount:     int32(len(res.Routes)),
+		UnplannedCount: int32(len(res.Unplanned)),
+		CreatedBy:      toPgUUID(actor.UserID),
+	})
+	if err != nil {
+		return RoutePlan{}, err
+	}
+	s.log(ctx, tenantID, actor, "transport.plan.create", "transport_route_plan", plan.ID, map[string]any{
+		"kind":      kind,
+		"students":  plan.StudentCount,
+		"routes":    plan.RouteCount,
+		"unplanned": plan.UnplannedCount,
+	})
+	return decodePlan(plan)
+}
+
+func decodePlan(plan db.TransportRoutePlan) (RoutePlan, error) {
+	out := RoutePlan{TransportRoutePlan: plan}
+	if len(plan.Result) > 0 && string(plan.Result) != "null" {
+		out.Result = &PlanResult{}
+		if err := json.Unmarshal(plan.Result, out.Result); err != nil {
+			return out, err
+		}
+	}
+	out.TransportRoutePlan.Result = nil
+	return out, nil
+}
+
+func (s *PlanningService) GetPlan(ctx context.Context, tenantID, planID string) (RoutePlan, error) {
+	plan, err := s.q.GetTransportRoutePlan(ctx, toPgUUID(tenantID), toPgUUID(planID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return RoutePlan{}, ErrPlanNotFound
+	}
+	if err != nil {
+		return RoutePlan{}, err
+	}
+	return decodePlan(plan)
+}
+
+func (s *PlanningService) ListPlans(ctx context.Context, tenantID string) ([]db.TransportRoutePlan, error) {
+	return s.q.ListTransportRoutePlans(ctx, toPgUUID(tenantID))
+}
+
+func (s *PlanningService) DiscardPlan(ctx context.Context, tenantID, planID string, actor TrackingActor) (RoutePlan, error) {
+	tid, pid := toPgUUID(tenantID), toPgUUID(planID)
+	plan, err := s.q.CloseTransportRoutePlan(ctx, tid, pid, "discarded", pgtype.Date{}, toPgUUID(actor.UserID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return RoutePlan{}, s.closedOrMissing(ctx, tid, pid)
+	}
+	if err != nil {
+		return RoutePlan{}, err
+	}
+	s.log(ctx, tid, actor, "transport.plan.discard", "transport_route_plan", plan.ID, nil)
+	return decodePlan(plan)
+}
+
+func (s *PlanningService) closedOrMissing(ctx context.Context, tenantID, planID pgtype.UUID) error {
+	if _, err := s.q.GetTransportRoutePlan(ctx, tenantID, planID); err == nil {
+		return ErrPlanClosed
+	}
+	return ErrPlanNotFound
+}
+
+// Applying
+
+// ApplyResult counts what applying a plan changed.
+type ApplyResult struct {
+	Plan               RoutePlan          `json:"plan"`
+	RoutesCreated      int                `json:"routes_created"`
+	RoutesRetired      int64              `json:"routes_retired"`
+	StopsCreated       int                `json:"stops_created"`
+	StopsResequenced   int                `json:"stops_resequenced"`
+	AllocationsMoved   int                `json:"allocations_moved"`
+	AllocationsCreated int                `json:"allocations_created"`
+	Skipped            []UnplannedStudent `json:"skipped"`
+}
+
+// stopArrival is when the bus reaches a stop to arrive at the school by
+// arriveBy, given the stop's ride time.
+func stopArrival(arriveBy string, rideMinutes float64) pgtype.Time {
+	t, err := time.Parse("15:04", arriveBy)
+	if err != nil {
+		return pgtype.Time{}
+	}
+	micros := int64(t.Hour()*3600+t.Minute()*60)*1e6 - int64((rideMinutes*60+stopDwell.Seconds())*1e6)
+	if micros < 0 {
+		micros = 0
+	}
+	// Round down to the minute, as timetables are printed.
+	micros -= micros % 60e6
+	return pgtype.Time{Microseconds: micros, Valid: true}
+}
+
+// ApplyPlan carries out a draft plan from the effective date. A full plan
+// retires the routes its vehicles ran and creates the planned routes; a
+// rebalance adds and reorders stops on running routes. Planned students'
+// allocations move to their planned stop.
+func (s *PlanningService) ApplyPlan(ctx context.Context, tenantID, planID string, effective time.Time, actor TrackingActor) (ApplyResult, error) {
+	tid, pid := toPgUUID(tenantID), toPgUUID(planID)
+	if effective.IsZero() {
+		effective = today()
+	}
+	if effective.Before(today()) {
+		return ApplyResult{}, fmt.Errorf("%w: effective_date cannot be in the past", ErrInvalidPlan)
+	}
+	eff := pgtype.Date{Time: effective, Valid: true}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return ApplyResult{}, err
+	}
+	defer tx.Rollback(ctx)
+	qtx := s.q.WithTx(tx)
+
+	stored, err := qtx.CloseTransportRoutePlan(ctx, tid, pid, "applied", eff, toPgUUID(actor.UserID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ApplyResult{}, s.closedOrMissing(ctx, tid, pid)
+	}
+	if err != nil {
+		return ApplyResult{}, err
+	}
+	plan, err := decodePlan(stored)
+	if err != nil {
+		return ApplyResult{}, err
+	}
+	var rec planRecord
+	if err := json.Unmarshal(stored.Options, &rec); err != nil {
+		return ApplyResult{}, err
+	}
+
+	out := ApplyResult{Plan: plan, Skipped: []UnplannedStudent{}}
+	if plan.Result != nil {
+		if plan.Kind == planKindFull {
+			err = s.applyFull(ctx, qtx, tid, plan.Result, rec, eff, &out)
+		} else {
+			err = s.applyRebalance(ctx, qtx, tid, plan.Result, rec, eff, &out)
+		}
+		if err != nil {
+			return ApplyResult{}, err
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return ApplyResult{}, err
+	}
+	s.log(ctx, tid, actor, "transport.plan.apply", "transport_route_plan", plan.ID, map[string]any{
+		"effective_date":      effective.Format("2006-01-02"),
+		"routes_created":      out.RoutesCreated,
+		"routes_retired":      out.RoutesRetired,
+		"stops_created":       out.StopsCreated,
+		"allocations_moved":   out.AllocationsMoved,
+		"allocations_created": out.AllocationsCreated,
+	})
+	return out, nil
+}
+
+func (s *PlanningService) applyFull(ctx context.Context, qtx *db.Queries, tid pgtype.UUID, res *PlanResult, rec planRecord, eff pgtype.Date, out *ApplyResult) error {
+	var vehicles []pgtype.UUID
+	for _, r := range res.Routes {
+		if r.VehicleID == "" {
+			continue
+		}
+		vid := toPgUUID(r.VehicleID)
+		if s.fleet != nil {
+			if err := s.fleet.EnsureVehicleCompliant(ctx, tid, vid); err != nil {
+				return fmt.Errorf("%s: %w", r.RegistrationNumber, err)
+			}
+		}
+		vehicles = append(vehicles, vid)
+	}
+	retired, err := qtx.DeactivateTransportRoutesForVehicles(ctx, tid, vehicles)
+	if err != nil {
+		return err
+	}
+	out.RoutesRetired = retired
+
+	for _, r := range res.Routes {
+		if r.VehicleID == "" {
+			for _, stop := range r.Stops {
+				for _, id := range stop.StudentIDs {
+					out.Skipped = append(out.Skipped, UnplannedStudent{StudentID: id, Reason: routeHasNoVehicle})
+				}
+			}
+			continue
+		}
+		route, err := qtx.CreateRoute(ctx, db.CreateRouteParams{
+			TenantID:    tid,
+			Name:        r.Name,
+			VehicleID:   toPgUUID(r.VehicleID),
+			Description: pgtype.Text{String: "Created by the route planner", Valid: true},
+		})
+		if err != nil {
+			return err
+		}
+		out.RoutesCreated++
+		for k, stop := range r.Stops {
+			stopID, err := qtx.CreateTransportPlannedStop(ctx, db.CreateTransportPlannedStopParams{
+				RouteID:       route.ID,
+				Name:          stop.Name,
+				SequenceOrder: int32(k + 1),
+				ArrivalTime:   stopArrival(rec.ArriveBy, stop.RideMinutes),
+				Latitude:      stop.Location.Lat,
+				Longitude:     stop.Location.Lng,
+			})
+			if err != nil {
+				return err
+			}
+			out.StopsCreated++
+			for _, id := range stop.StudentIDs {
+				if err := allocate(ctx, qtx, tid, toPgUUID(id), route.ID, stopID, eff); err != nil {
+					return err
+				}
+				out.AllocationsCreated++
+			}
+		}
+	}
+	return nil
+}
+
+func (s *PlanningService) applyRebalance(ctx context.Context, qtx *db.Queries, tid pgtype.UUID, res *PlanResult, rec planRecord, eff pgtype.Date, out *ApplyResult) error {
+	for _, r := range res.Routes {
+		routeID := toPgUUID(r.RouteID)
+		current, err := qtx.ListRouteStops(ctx, routeID)
+		if err != nil {
+			return err
+		}
+		planned := map[string]bool{}
+		for _, stop := range r.Stops {
+			if stop.StopID != "" {
+				planned[stop.StopID] = true
+			}
+		}
+		if len(current) != len(planned) {
+			return ErrPlanStale
+		}
+		for _, c := range current {
+			if !planned[c.ID.String()] {
+				return ErrPlanStale
+			}
+		}
+
+		for k, stop := range r.Stops {
+			stopID := toPgUUID(stop.StopID)
+			if stop.StopID == "" {
+				if stopID, err = qtx.CreateTransportPlannedStop(ctx, db.CreateTransportPlannedStopParams{
+					RouteID:       routeID,
+					Name:          stop.Name,
+					SequenceOrder: int32(k + 1),
+					ArrivalTime:   stopArrival(rec.ArriveBy, stop.RideMinutes),
+					Latitude:      stop.Location.Lat,
+					Longitude:     stop.Location.Lng,
+				}); err != nil {
+					return err
+				}
+				out.StopsCreated++
+			} else {
+				if err := qtx.SetTransportStopSequence(ctx, routeID, stopID, int32(k+1)); err != nil {
+					return err
+				}
+				out.StopsResequenced++
+			}
+			for _, id := range stop.StudentIDs {
+				sid := toPgUUID(id)
+				moved, err := qtx.MoveTransportAllocationToStop(ctx, tid, sid, routeID, stopID)
+				if err != nil {
+					return err
+				}
+				if moved {
+					out.AllocationsMoved++
+					continue
+				}
+				if err := allocate(ctx, qtx, tid, sid, routeID, stopID, eff); err != nil {
+					return err
+				}
+				out.AllocationsCreated++
+			}
+		}
+	}
+	return nil
+}
+
+// allocate ends a student's current allocations and starts a new one on
+// the route and stop from the effective date.
+func allocate(ctx context.Context, qtx *db.Queries, tid, studentID, routeID, stopID pgtype.UUID, eff pgtype.Date) error {
+	if err := qtx.EndTransportAllocations(ctx, tid, studentID, eff); err != nil {
+		return err
+	}
+	_, err := qtx.CreateAllocation(ctx, db.CreateAllocationParams{
+		TenantID:  tid,
+		StudentID: studentID,
+		RouteID:   routeID,
+		StopID:    stopID,
+		StartDate: eff,
+		Status:    "active",
+	})
+	if err != nil && strings.Contains(err.Error(), "foreign key") {
+		return fmt.Errorf("%w: student %s no longer exists", ErrPlanStale, studentID.String())
+	}
+	return err
+}
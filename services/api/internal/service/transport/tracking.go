@@ -0,0 +1,782 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/rs/zerolog/log"
+	"github.com/schoolerp/api/internal/db"
+	"github.com/schoolerp/api/internal/foundation/audit"
+)
+
+var (
+	ErrInvalidTracking  = errors.New("invalid tracking input")
+	ErrTripNotFound     = errors.New("trip not found")
+	ErrTripConflict     = errors.New("a trip is already running on this route or vehicle")
+	ErrRouteUntrackable = errors.New("route not found, inactive or without a vehicle")
+	ErrVehicleNotFound  = errors.New("vehicle not found")
+	ErrStudentNotOnTrip = errors.New("student is not allocated to this trip's route or the trip has ended")
+	ErrAlertNotFound    = errors.New("alert not found")
+	ErrStopNotFound     = errors.New("stop not found")
+)
+
+const (
+	// AlertsPermission marks the users who receive overspeed and deviation alerts.
+	AlertsPermission = "transport:alerts"
+
+	maxPingBatch = 500
+	// Pings are accepted up to a day late (devices buffer while offline) and
+	// at most a couple of minutes early (clock skew).
+	maxPingAge    = 24 * time.Hour
+	maxPingFuture = 2 * time.Minute
+	// A position older than this is shown as stale.
+	staleAfter = 2 * time.Minute
+	// Reported speeds over this window feed the ETA.
+	etaSpeedWindow = 5 * time.Minute
+	// A stop is left once the vehicle is this many radii away, so GPS
+	// jitter at the edge of the geofence does not flap.
+	departureHysteresis = 1.5
+	replayPingLimit     = 20000
+)
+
+// DefaultTrackingSettings apply to tenants that have not saved their own.
+var DefaultTrackingSettings = db.TransportTrackingSettings{
+	SpeedLimitKmph:       50,
+	DeviationThresholdM:  300,
+	StopRadiusM:          150,
+	ArrivalNoticeMinutes: 5,
+	DefaultSpeedKmph:     25,
+	AlertCooldownMinutes: 10,
+}
+
+// TrackingService ingests GPS pings for running trips and turns them into
+// positions, ETAs, guardian notices and alerts for the transport manager.
+type TrackingService struct {
+	q     *db.Queries
+	audit *audit.Logger
+}
+
+func NewTrackingService(q *db.Queries, audit *audit.Logger) *TrackingService {
+	return &TrackingService{q: q, audit: audit}
+}
+
+// TrackingActor is who made a change, for the audit log.
+type TrackingActor struct {
+	UserID    string
+	RequestID string
+	IP        string
+}
+
+func (s *TrackingService) log(ctx context.Context, tenantID pgtype.UUID, actor TrackingActor, action string, resourceID pgtype.UUID, after any) {
+	if s.audit == nil {
+		return
+	}
+	_ = s.audit.Log(ctx, audit.Entry{
+		TenantID:     tenantID,
+		UserID:       toPgUUID(actor.UserID),
+		RequestID:    actor.RequestID,
+		Action:       action,
+		ResourceType: "transport_trip",
+		ResourceID:   resourceID,
+		After:        after,
+		IPAddress:    actor.IP,
+	})
+}
+
+// Settings
+
+func (s *TrackingService) GetSettings(ctx context.Context, tenantID string) (db.TransportTrackingSettings, error) {
+	tid := toPgUUID(tenantID)
+	settings, err := s.q.GetTransportTrackingSettings(ctx, tid)
+	if errors.Is(err, pgx.ErrNoRows) {
+		settings = DefaultTrackingSettings
+		settings.TenantID = tid
+		return settings, nil
+	}
+	return settings, err
+}
+
+func (s *TrackingService) UpdateSettings(ctx context.Context, tenantID string, in db.TransportTrackingSettings, actor TrackingActor) (db.TransportTrackingSettings, error) {
+	if in.SpeedLimitKmph <= 0 || in.DeviationThresholdM <= 0 || in.StopRadiusM <= 0 ||
+		in.ArrivalNoticeMinutes <= 0 || in.DefaultSpeedKmph <= 0 || in.AlertCooldownMinutes < 0 {
+		return db.TransportTrackingSettings{}, fmt.Errorf("%w: thresholds must be positive", ErrInvalidTracking)
+	}
+	in.TenantID = toPgUUID(tenantID)
+	in.UpdatedBy = toPgUUID(actor.UserID)
+	settings, err := s.q.UpsertTransportTrackingSettings(ctx, in)
+	if err != nil {
+		return settings, err
+	}
+	if s.audit != nil {
+		_ = s.audit.Log(ctx, audit.Entry{
+			TenantID:     in.TenantID,
+			UserID:       in.UpdatedBy,
+			RequestID:    actor.RequestID,
+			Action:       "transport.tracking_settings.update",
+			ResourceType: "transport_tracking_settings",
+			After:        settings,
+			IPAddress:    actor.IP,
+		})
+	}
+	return settings, nil
+}
+
+// SetStopLocation places a stop on the map so it gets a geofence and ETAs.
+func (s *TrackingService) SetStopLocation(ctx context.Context, tenantID, stopID string, pos LatLng) error {
+	if !pos.Valid() {
+		return fmt.Errorf("%w: latitude or longitude out of range", ErrInvalidTracking)
+	}
+	err := s.q.SetRouteStopLocation(ctx, toPgUUID(tenantID), toPgUUID(stopID),
+		pgtype.Float8{Float64: pos.Lat, Valid: true}, pgtype.Float8{Float64: pos.Lng, Valid: true})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrStopNotFound
+	}
+	return err
+}
+
+// Trips
+
+func (s *TrackingService) StartTrip(ctx context.Context, tenantID, routeID, direction string, actor TrackingActor) (db.TransportTrip, error) {
+	direction = strings.ToLower(strings.TrimSpace(direction))
+	if direction != "pickup" && direction != "drop" {
+		return db.TransportTrip{}, fmt.Errorf("%w: direction must be pickup or drop", ErrInvalidTracking)
+	}
+	tid := toPgUUID(tenantID)
+	trip, err := s.q.StartTransportTrip(ctx, tid, toPgUUID(routeID), direction, toPgUUID(actor.UserID))
+	if err != nil {
+		var pgErr *pgconn.PgError
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return trip, ErrRouteUntrackable
+		case errors.As(err, &pgErr) && pgErr.Code == "23505":
+			return trip, ErrTripConflict
+		}
+		return trip, err
+	}
+	s.log(ctx, tid, actor, "trip.start", trip.ID, trip)
+	return trip, nil
+}
+
+// EndTrip completes a trip, or cancels it when it did not run. Completing a
+// drop trip raises a missed-drop alert for each student on the route who
+// rode to school but not home.
+func (s *TrackingService) EndTrip(ctx context.Context, tenantID, tripID string, cancel bool, actor TrackingActor) (db.TransportTrip, error) {
+	status, action := "completed", "trip.complete"
+	if cancel {
+		status, action = "cancelled", "trip.cancel"
+	}
+	tid := toPgUUID(tenantID)
+	trip, err := s.q.EndTransportTrip(ctx, tid, toPgUUID(tripID), status)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return trip, ErrTripNotFound
+	}
+	if err != nil {
+		return trip, err
+	}
+	s.log(ctx, tid, actor, action, trip.ID, trip)
+	if trip.Status == "completed" && trip.Direction == "drop" {
+		s.raiseMissedDrops(ctx, trip)
+	}
+	return trip, nil
+}
+
+type ListTripsFilter struct {
+	RouteID string
+	Status  string
+	Date    time.Time
+	Limit   int32
+}
+
+var tripStatuses = map[string]bool{"": true, "scheduled": true, "in_progress": true, "completed": true, "cancelled": true}
+
+func (s *TrackingService) ListTrips(ctx context.Context, tenantID string, f ListTripsFilter) ([]db.TransportTrip, error) {
+	if !tripStatuses[f.Status] {
+		return nil, fmt.Errorf("%w: unknown status %q", ErrInvalidTracking, f.Status)
+	}
+	arg := db.ListTransportTripsParams{
+		TenantID: toPgUUID(tenantID),
+		RouteID:  toPgUUID(f.RouteID),
+		Status:   f.Status,
+		Limit:    f.Limit,
+	}
+	if arg.Limit <= 0 || arg.Limit > 200 {
+		arg.Limit = 50
+	}
+	if !f.Date.IsZero() {
+		arg.TripDate = pgtype.Date{Time: f.Date, Valid: true}
+	}
+	return s.q.ListTransportTrips(ctx, arg)
+}
+
+func (s *TrackingService) getTrip(ctx context.Context, tenantID, tripID string) (db.TransportTrip, error) {
+	trip, err := s.q.GetTransportTrip(ctx, toPgUUID(tenantID), toPgUUID(tripID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return trip, ErrTripNotFound
+	}
+	return trip, err
+}
+
+// TripStopStatus is a stop of a trip with where the trip stands against it.
+type TripStopStatus struct {
+	db.TransportTripStop
+	// Status is pending, arrived, departed or skipped (passed without
+	// entering the geofence).
+	Status string     `json:"status"`
+	ETA    *time.Time `json:"eta,omitempty"`
+}
+
+// TripLive is the current state of a trip.
+type TripLive struct {
+	Trip       db.TransportTrip `json:"trip"`
+	Position   *LatLng          `json:"position,omitempty"`
+	Stale      bool             `json:"stale"`
+	SpeedKmph  float64          `json:"eta_speed_kmph"`
+	NextStopID *string          `json:"next_stop_id,omitempty"`
+	Stops      []TripStopStatus `json:"stops"`
+}
+
+// buildTripLive lays out stop statuses and ETAs for the stops still ahead.
+func buildTripLive(trip db.TransportTrip, stops []db.TransportTripStop, speedKmph float64, now time.Time) TripLive {
+	live := TripLive{Trip: trip, SpeedKmph: speedKmph, Stops: make([]TripStopStatus, len(stops))}
+
+	reached := -1
+	for i, st := range stops {
+		live.Stops[i] = TripStopStatus{TransportTripStop: st, Status: "pending"}
+		switch {
+		case st.DepartedAt.Valid:
+			live.Stops[i].Status = "departed"
+			reached = i
+		case st.ArrivedAt.Valid:
+			live.Stops[i].Status = "arrived"
+			reached = i
+		}
+	}
+	for i := 0; i < reached; i++ {
+		if live.Stops[i].Status == "pending" {
+			live.Stops[i].Status = "skipped"
+		}
+	}
+
+	if !trip.LastLatitude.Valid || !trip.LastLongitude.Valid {
+		return live
+	}
+	pos := LatLng{Lat: trip.LastLatitude.Float64, Lng: trip.LastLongitude.Float64}
+	live.Position = &pos
+	live.Stale = trip.LastPingAt.Valid && now.Sub(trip.LastPingAt.Time) > staleAfter
+	if trip.Status != "in_progress" {
+		return live
+	}
+
+	// Stops after the last one reached are ahead; a stop the bus is still
+	// standing at is not.
+	first := reached + 1
+	if first >= len(stops) {
+		return live
+	}
+	ahead := make([]*LatLng, 0, len(stops)-first)
+	for _, st := range stops[first:] {
+		if st.Latitude.Valid && st.Longitude.Valid {
+			ahead = append(ahead, &LatLng{Lat: st.Latitude.Float64, Lng: st.Longitude.Float64})
+		} else {
+			ahead = append(ahead, nil)
+		}
+	}
+	from := now
+	if trip.LastPingAt.Valid {
+		from = trip.LastPingAt.Time
+	}
+	for i, eta := range estimateArrivals(pos, ahead, speedKmph, from) {
+		if !eta.IsZero() {
+			eta := eta
+			live.Stops[first+i].ETA = &eta
+		}
+	}
+	next := stops[first].StopID.String()
+	live.NextStopID = &next
+	return live
+}
+
+func (s *TrackingService) live(ctx context.Context, trip db.TransportTrip, settings db.TransportTrackingSettings, now time.Time) (TripLive, error) {
+	stops, err := s.q.ListTransportTripStops(ctx, trip.ID)
+	if err != nil {
+		return TripLive{}, err
+	}
+	speed := float64(settings.DefaultSpeedKmph)
+	if trip.Status == "in_progress" && trip.LastPingAt.Valid {
+		since := pgtype.Timestamptz{Time: trip.LastPingAt.Time.Add(-etaSpeedWindow), Valid: true}
+		if avg, err := s.q.AverageTransportTripSpeed(ctx, trip.ID, since); err == nil && avg.Valid {
+			speed = avg.Float64
+		}
+	}
+	return buildTripLive(trip, stops, speed, now), nil
+}
+
+func (s *TrackingService) GetTripLive(ctx context.Context, tenantID, tripID string) (TripLive, error) {
+	trip, err := s.getTrip(ctx, tenantID, tripID)
+	if err != nil {
+		return TripLive{}, err
+	}
+	settings, err := s.GetSettings(ctx, tenantID)
+	if err != nil {
+		return TripLive{}, err
+	}
+	return s.live(ctx, trip, settings, time.Now())
+}
+
+// ListLiveTrips returns every running trip of the tenant.
+func (s *TrackingService) ListLiveTrips(ctx context.Context, tenantID string) ([]TripLive, error) {
+	trips, err := s.q.ListTransportTrips(ctx, db.ListTransportTripsParams{
+		TenantID: toPgUUID(tenantID),
+		Status:   "in_progress",
+		Limit:    200,
+	})
+	if err != nil {
+		return nil, err
+	}
+	settings, err := s.GetSettings(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	out := make([]TripLive, 0, len(trips))
+	for _, trip := range trips {
+		live, err := s.live(ctx, trip, settings, now)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, live)
+	}
+	return out, nil
+}
+
+// TripReplay is everything recorded for a trip, for playing it back.
+type TripReplay struct {
+	Trip      db.TransportTrip           `json:"trip"`
+	Pings     []db.TransportGPSPing      `json:"pings"`
+	Stops     []db.TransportTripStop     `json:"stops"`
+	Boardings []db.TransportTripBoarding `json:"boardings"`
+	Alerts    []db.TransportTripAlert    `json:"alerts"`
+	Truncated bool                       `json:"truncated"`
+}
+
+func (s *TrackingService) GetTripReplay(ctx context.Context, tenantID, tripID string) (TripReplay, error) {
+	trip, err := s.getTrip(ctx, tenantID, tripID)
+	if err != nil {
+		return TripReplay{}, err
+	}
+	replay := TripReplay{Trip: trip}
+	if replay.Pings, err = s.q.ListTransportTripPings(ctx, trip.ID, replayPingLimit+1); err != nil {
+		return replay, err
+	}
+	if len(replay.Pings) > replayPingLimit {
+		replay.Pings, replay.Truncated = replay.Pings[:replayPingLimit], true
+	}
+	if replay.Stops, err = s.q.ListTransportTripStops(ctx, trip.ID); err != nil {
+		return replay, err
+	}
+	if replay.Boardings, err = s.q.ListTransportTripBoardings(ctx, trip.ID); err != nil {
+		return replay, err
+	}
+	replay.Alerts, err = s.q.ListTransportTripAlerts(ctx, trip.TenantID, trip.ID, false, 500)
+	return replay, err
+}
+
+// Ingestion
+
+type PingInput struct {
+	Latitude   float64   `json:"latitude"`
+	Longitude  float64   `json:"longitude"`
+	SpeedKmph  *float64  `json:"speed_kmph"`
+	Heading    *float64  `json:"heading"`
+	AccuracyM  *float64  `json:"accuracy_m"`
+	RecordedAt time.Time `json:"recorded_at"`
+}
+
+type IngestPingsParams struct {
+	TenantID           string
+	VehicleID          string
+	RegistrationNumber string
+	// Source is phone (driver app) or ais140 (fitted tracking device).
+	Source string
+	Pings  []PingInput
+}
+
+type IngestResult struct {
+	Accepted int     `json:"accepted"`
+	TripID   *string `json:"trip_id,omitempty"`
+}
+
+func normalizePings(in []PingInput, now time.Time) ([]db.TransportGPSPing, error) {
+	if len(in) == 0 || len(in) > maxPingBatch {
+		return nil, fmt.Errorf("%w: send between 1 and %d pings", ErrInvalidTracking, maxPingBatch)
+	}
+	out := make([]db.TransportGPSPing, 0, len(in))
+	for _, p := range in {
+		if !(LatLng{Lat: p.Latitude, Lng: p.Longitude}).Valid() {
+			return nil, fmt.Errorf("%w: latitude or longitude out of range", ErrInvalidTracking)
+		}
+		at := p.RecordedAt
+		if at.IsZero() {
+			at = now
+		}
+		if at.Before(now.Add(-maxPingAge)) || at.After(now.Add(maxPingFuture)) {
+			return nil, fmt.Errorf("%w: recorded_at %s is outside the accepted window", ErrInvalidTracking, at.Format(time.RFC3339))
+		}
+		out = append(out, db.TransportGPSPing{
+			RecordedAt: pgtype.Timestamptz{Time: at, Valid: true},
+			Latitude:   p.Latitude,
+			Longitude:  p.Longitude,
+			SpeedKmph:  optionalFloat(p.SpeedKmph),
+			Heading:    optionalFloat(p.Heading),
+			AccuracyM:  optionalFloat(p.AccuracyM),
+		})
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].RecordedAt.Time.Before(out[j].RecordedAt.Time) })
+	return out, nil
+}
+
+// IngestPings stores a batch of positions for a vehicle. When the vehicle is
+// on a trip, the newest positions advance the trip: stop geofences are
+// checked, guardians at upcoming stops are told the bus is close, and
+// overspeed or route deviation raises an alert.
+func (s *TrackingService) IngestPings(ctx context.Context, p IngestPingsParams) (IngestResult, error) {
+	source := strings.ToLower(strings.TrimSpace(p.Source))
+	if source == "" {
+		source = "phone"
+	}
+	if source != "phone" && source != "ais140" {
+		return IngestResult{}, fmt.Errorf("%w: source must be phone or ais140", ErrInvalidTracking)
+	}
+	pings, err := normalizePings(p.Pings, time.Now())
+	if err != nil {
+		return IngestResult{}, err
+	}
+
+	tid := toPgUUID(p.TenantID)
+	vehicleID, err := s.q.ResolveTransportVehicle(ctx, tid, toPgUUID(p.VehicleID), strings.TrimSpace(p.RegistrationNumber))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return IngestResult{}, ErrVehicleNotFound
+	}
+	if err != nil {
+		return IngestResult{}, err
+	}
+
+	trip, err := s.q.GetActiveTransportTripForVehicle(ctx, tid, vehicleID)
+	onTrip := err == nil
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return IngestResult{}, err
+	}
+	tripID := pgtype.UUID{}
+	if onTrip {
+		tripID = trip.ID
+	}
+	if err := s.q.InsertTransportGPSPings(ctx, tid, vehicleID, tripID, source, pings); err != nil {
+		return IngestResult{}, err
+	}
+
+	result := IngestResult{Accepted: len(pings)}
+	if !onTrip {
+		return result, nil
+	}
+	id := trip.ID.String()
+	result.TripID = &id
+
+	// Only pings newer than the trip's position move it forward; late
+	// buffered pings are kept for replay.
+	fresh := pings
+	if trip.LastPingAt.Valid {
+		fresh = fresh[:0:0]
+		for _, ping := range pings {
+			if ping.RecordedAt.Time.After(trip.LastPingAt.Time) {
+				fresh = append(fresh, ping)
+			}
+		}
+	}
+	if len(fresh) == 0 {
+		return result, nil
+	}
+	latest := fresh[len(fresh)-1]
+	applied, err := s.q.UpdateTransportTripPosition(ctx, db.UpdateTransportTripPositionParams{
+		ID:        trip.ID,
+		Latitude:  latest.Latitude,
+		Longitude: latest.Longitude,
+		SpeedKmph: latest.SpeedKmph,
+		Heading:   latest.Heading,
+		At:        latest.RecordedAt,
+	})
+	if err != nil || !applied {
+		// A concurrent batch with newer positions has already advanced the trip.
+		return result, err
+	}
+	trip.LastLatitude = pgtype.Float8{Float64: latest.Latitude, Valid: true}
+	trip.LastLongitude = pgtype.Float8{Float64: latest.Longitude, Valid: true}
+	trip.LastSpeedKmph, trip.LastHeading, trip.LastPingAt = latest.SpeedKmph, latest.Heading, latest.RecordedAt
+
+	if err := s.advanceTrip(ctx, trip, fresh); err != nil {
+		// The pings are stored; a failure here only delays notices.
+		log.Ctx(ctx).Error().Err(err).Str("trip_id", id).Msg("failed to process trip position")
+	}
+	return result, nil
+}
+
+func (s *TrackingService) advanceTrip(ctx context.Context, trip db.TransportTrip, fresh []db.TransportGPSPing) error {
+	settings, err := s.GetSettings(ctx, trip.TenantID.String())
+	if err != nil {
+		return err
+	}
+	stops, err := s.q.ListTransportTripStops(ctx, trip.ID)
+	if err != nil {
+		return err
+	}
+
+	radius := float64(settings.StopRadiusM)
+	for _, ping := range fresh {
+		pos := LatLng{Lat: ping.Latitude, Lng: ping.Longitude}
+		for i := range stops {
+			st := &stops[i]
+			if !st.Latitude.Valid || !st.Longitude.Valid {
+				continue
+			}
+			d := distanceMeters(pos, LatLng{Lat: st.Latitude.Float64, Lng: st.Longitude.Float64})
+			switch {
+			case !st.ArrivedAt.Valid && d <= radius:
+				if err := s.q.MarkTransportTripStopArrived(ctx, trip.ID, st.StopID, ping.RecordedAt); err != nil {
+					return err
+				}
+				st.ArrivedAt = ping.RecordedAt
+			case st.ArrivedAt.Valid && !st.DepartedAt.Valid && d > radius*departureHysteresis:
+				if err := s.q.MarkTransportTripStopDeparted(ctx, trip.ID, st.StopID, ping.RecordedAt); err != nil {
+					return err
+				}
+				st.DepartedAt = ping.RecordedAt
+			}
+		}
+	}
+
+	s.checkAlerts(ctx, trip, stops, fresh, settings)
+
+	speed := float64(settings.DefaultSpeedKmph)
+	since := pgtype.Timestamptz{Time: trip.LastPingAt.Time.Add(-etaSpeedWindow), Valid: true}
+	if avg, err := s.q.AverageTransportTripSpeed(ctx, trip.ID, since); err == nil && avg.Valid {
+		speed = avg.Float64
+	}
+	live := buildTripLive(trip, stops, speed, trip.LastPingAt.Time)
+	notice := time.Duration(settings.ArrivalNoticeMinutes) * time.Minute
+	for _, st := range live.Stops {
+		if st.ETA == nil || st.ArrivalNotifiedAt.Valid || st.ETA.Sub(trip.LastPingAt.Time) > notice {
+			continue
+		}
+		if err := s.notifyArriving(ctx, trip, st); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *TrackingService) notifyArriving(ctx context.Context, trip db.TransportTrip, st TripStopStatus) error {
+	claimed, err := s.q.ClaimTransportStopArrivalNotice(ctx, trip.ID, st.StopID)
+	if err != nil || !claimed {
+		return err
+	}
+	recipients, err := s.q.ListTransportStopRecipients(ctx, trip.TenantID, trip.RouteID, st.StopID)
+	if err != nil || len(recipients) == 0 {
+		return err
+	}
+	minutes := int(math.Ceil(st.ETA.Sub(trip.LastPingAt.Time).Minutes()))
+	return s.emit(ctx, trip.TenantID, "transport.bus_arriving", map[string]any{
+		"trip_id":             trip.ID.String(),
+		"route_id":            trip.RouteID.String(),
+		"route_name":          trip.RouteName,
+		"registration_number": trip.RegistrationNumber,
+		"direction":           trip.Direction,
+		"stop_id":             st.StopID.String(),
+		"stop_name":           st.Name,
+		"eta":                 st.ETA.UTC().Format(time.RFC3339),
+		"minutes_away":        max(minutes, 0),
+		"recipients":          recipients,
+	})
+}
+
+func (s *TrackingService) checkAlerts(ctx context.Context, trip db.TransportTrip, stops []db.TransportTripStop, fresh []db.TransportGPSPing, settings db.TransportTrackingSettings) {
+	var fastest *db.TransportGPSPing
+	for i := range fresh {
+		if fresh[i].SpeedKmph.Valid && fresh[i].SpeedKmph.Float64 > float64(settings.SpeedLimitKmph) &&
+			(fastest == nil || fresh[i].SpeedKmph.Float64 > fastest.SpeedKmph.Float64) {
+			fastest = &fresh[i]
+		}
+	}
+	if fastest != nil {
+		s.raiseAlert(ctx, trip, "overspeed", fastest.SpeedKmph.Float64, float64(settings.SpeedLimitKmph), *fastest, settings)
+	}
+
+	var path []LatLng
+	for _, st := range stops {
+		if st.Latitude.Valid && st.Longitude.Valid {
+			path = append(path, LatLng{Lat: st.Latitude.Float64, Lng: st.Longitude.Float64})
+		}
+	}
+	latest := fresh[len(fresh)-1]
+	threshold := float64(settings.DeviationThresholdM)
+	// A route needs two placed stops to have a path, and a fix less precise
+	// than the threshold cannot show a deviation.
+	if len(path) < 2 || (latest.AccuracyM.Valid && latest.AccuracyM.Float64 > threshold) {
+		return
+	}
+	if d := distanceToPathMeters(LatLng{Lat: latest.Latitude, Lng: latest.Longitude}, path); d > threshold {
+		s.raiseAlert(ctx, trip, "route_deviation", math.Round(d), threshold, latest, settings)
+	}
+}
+
+func (s *TrackingService) raiseAlert(ctx context.Context, trip db.TransportTrip, alertType string, observed, threshold float64, at db.TransportGPSPing, settings db.TransportTrackingSettings) {
+	alert, err := s.q.CreateTransportTripAlert(ctx, db.CreateTransportTripAlertParams{
+		TenantID:        trip.TenantID,
+		TripID:          trip.ID,
+		AlertType:       alertType,
+		ObservedValue:   observed,
+		ThresholdValue:  threshold,
+		Latitude:        at.Latitude,
+		Longitude:       at.Longitude,
+		ObservedAt:      at.RecordedAt,
+		CooldownMinutes: settings.AlertCooldownMinutes,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return
+	}
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("alert_type", alertType).Msg("failed to record transport alert")
+		return
+	}
+	managers, err := s.q.ListUsersWithPermission(ctx, trip.TenantID, AlertsPermission)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("failed to resolve transport alert recipients")
+	}
+	recipients := make([]string, 0, len(managers))
+	for _, m := range managers {
+		recipients = append(recipients, m.String())
+	}
+	if err := s.emit(ctx, trip.TenantID, "transport.alert", map[string]any{
+		"alert_id":            alert.ID.String(),
+		"alert_type":          alertType,
+		"trip_id":             trip.ID.String(),
+		"route_id":            trip.RouteID.String(),
+		"route_name":          trip.RouteName,
+		"vehicle_id":          trip.VehicleID.String(),
+		"registration_number": trip.RegistrationNumber,
+		"observed_value":      observed,
+		"threshold_value":     threshold,
+		"latitude":            at.Latitude,
+		"longitude":           at.Longitude,
+		"observed_at":         at.RecordedAt.Time.UTC().Format(time.RFC3339),
+		"recipient_user_ids":  recipients,
+	}); err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("failed to queue transport alert")
+	}
+}
+
+func (s *TrackingService) emit(ctx context.Context, tenantID pgtype.UUID, eventType string, payload map[string]any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	_, err = s.q.CreateOutboxEvent(ctx, db.CreateOutboxEventParams{
+		TenantID:  tenantID,
+		EventType: eventType,
+		Payload:   body,
+	})
+	return err
+}
+
+// Alerts
+
+func (s *TrackingService) ListAlerts(ctx context.Context, tenantID, tripID string, openOnly bool) ([]db.TransportTripAlert, error) {
+	return s.q.ListTransportTripAlerts(ctx, toPgUUID(tenantID), toPgUUID(tripID), openOnly, 200)
+}
+
+func (s *TrackingService) AcknowledgeAlert(ctx context.Context, tenantID, alertID string, actor TrackingActor) (db.TransportTripAlert, error) {
+	alert, err := s.q.AcknowledgeTransportTripAlert(ctx, toPgUUID(tenantID), toPgUUID(alertID), toPgUUID(actor.UserID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return alert, ErrAlertNotFound
+	}
+	return alert, err
+}
+
+// Guardians
+
+// ChildBus is where a parent's child's bus is.
+type ChildBus struct {
+	StudentID   string          `json:"student_id"`
+	StudentName string          `json:"student_name"`
+	RouteName   string          `json:"route_name"`
+	StopID      string          `json:"stop_id,omitempty"`
+	Running     bool            `json:"running"`
+	Direction   string          `json:"direction,omitempty"`
+	Position    *LatLng         `json:"position,omitempty"`
+	Stale       bool            `json:"stale"`
+	Stop        *TripStopStatus `json:"stop,omitempty"`
+	LastPingAt  *time.Time      `json:"last_ping_at,omitempty"`
+}
+
+// ListChildBuses returns the live bus of each child of a parent user. Only
+// the child's own stop is included, not the rest of the route.
+func (s *TrackingService) ListChildBuses(ctx context.Context, tenantID, userID string) ([]ChildBus, error) {
+	children, err := s.q.ListGuardianTransportChildren(ctx, toPgUUID(tenantID), toPgUUID(userID))
+	if err != nil {
+		return nil, err
+	}
+	settings, err := s.GetSettings(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	out := make([]ChildBus, 0, len(children))
+	for _, c := range children {
+		bus := ChildBus{StudentID: c.StudentID.String(), StudentName: c.StudentName, RouteName: c.RouteName}
+		if c.StopID.Valid {
+			bus.StopID = c.StopID.String()
+		}
+		if c.TripID.Valid {
+			trip, err := s.q.GetTransportTrip(ctx, toPgUUID(tenantID), c.TripID)
+			if err != nil {
+				return nil, err
+			}
+			live, err := s.live(ctx, trip, settings, now)
+			if err != nil {
+				return nil, err
+			}
+			bus.Running, bus.Direction, bus.Position, bus.Stale = true, trip.Direction, live.Position, live.Stale
+			if trip.LastPingAt.Valid {
+				at := trip.LastPingAt.Time
+				bus.LastPingAt = &at
+			}
+			for i := range live.Stops {
+				if live.Stops[i].StopID == c.StopID {
+					bus.Stop = &live.Stops[i]
+				}
+			}
+		}
+		out = append(out, bus)
+	}
+	return out, nil
+}
+
+func toPgUUID(id string) pgtype.UUID {
+	u := pgtype.UUID{}
+	_ = u.Scan(strings.TrimSpace(id))
+	return u
+}
+
+func optionalFloat(v *float64) pgtype.Float8 {
+	if v == nil {
+		return pgtype.Float8{}
+	}
+	return pgtype.Float8{Float64: *v, Valid: true}
+}
@@ -0,0 +1,145 @@
+package transport
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/schoolerp/api/internal/db"
+)
+
+func TestDistanceMeters(t *testing.T) {
+	// One degree of latitude is about 111.2 km everywhere.
+	d := distanceMeters(LatLng{Lat: 12, Lng: 77}, LatLng{Lat: 13, Lng: 77})
+	if math.Abs(d-111195) > 50 {
+		t.Fatalf("expected ~111195m, got %.0f", d)
+	}
+}
+
+func TestDistanceToPathMeters(t *testing.T) {
+	path := []LatLng{{Lat: 12.9000, Lng: 77.6000}, {Lat: 12.9000, Lng: 77.6100}}
+	// 0.001 degrees of latitude north of the middle of the segment is ~111m.
+	if d := distanceToPathMeters(LatLng{Lat: 12.9010, Lng: 77.6050}, path); math.Abs(d-111) > 2 {
+		t.Fatalf("expected ~111m from the segment, got %.1f", d)
+	}
+	// Beyond the end of the segment the distance is to the end point.
+	beyond := LatLng{Lat: 12.9000, Lng: 77.6200}
+	if d, want := distanceToPathMeters(beyond, path), distanceMeters(beyond, path[1]); math.Abs(d-want) > 2 {
+		t.Fatalf("expected %.1fm to the end point, got %.1f", want, d)
+	}
+}
+
+func TestEstimateArrivals(t *testing.T) {
+	now := time.Date(2026, 7, 1, 7, 0, 0, 0, time.UTC)
+	pos := LatLng{Lat: 12.9000, Lng: 77.6000}
+	first := LatLng{Lat: 12.9090, Lng: 77.6000} // ~1 km north
+	second := LatLng{Lat: 12.9180, Lng: 77.6000}
+
+	etas := estimateArrivals(pos, []*LatLng{&first, nil, &second}, 30, now)
+	// 1 km x 1.3 road factor at 30 km/h is about 2m36s.
+	if got := etas[0].Sub(now); got < 150*time.Second || got > 160*time.Second {
+		t.Fatalf("unexpected first ETA %s", got)
+	}
+	if !etas[1].IsZero() {
+		t.Fatalf("expected no ETA for a stop without coordinates")
+	}
+	if got := etas[2].Sub(etas[0]); got < 150*time.Second+stopDwell || got > 160*time.Second+stopDwell {
+		t.Fatalf("expected the next leg plus dwell, got %s", got)
+	}
+	if etas := estimateArrivals(pos, []*LatLng{&first}, 0, now); !etas[0].IsZero() {
+		t.Fatalf("expected no ETA without a speed")
+	}
+}
+
+func tripStop(order int32, lat float64, arrived, departed bool) db.TransportTripStop {
+	at := pgtype.Timestamptz{Time: time.Date(2026, 7, 1, 7, 0, 0, 0, time.UTC), Valid: true}
+	s := db.TransportTripStop{
+		StopID:     pgtype.UUID{Bytes: [16]byte{byte(order)}, Valid: true},
+		VisitOrder: order,
+		Latitude:   pgtype.Float8{Float64: lat, Valid: true},
+		Longitude:  pgtype.Float8{Float64: 77.6, Valid: true},
+	}
+	if arrived {
+		s.ArrivedAt = at
+	}
+	if departed {
+		s.DepartedAt = at
+	}
+	return s
+}
+
+func TestBuildTripLive(t *testing.T) {
+	now := time.Date(2026, 7, 1, 7, 10, 0, 0, time.UTC)
+	trip := db.TransportTrip{
+		Status:        "in_progress",
+		LastLatitude:  pgtype.Float8{Float64: 12.905, Valid: true},
+		LastLongitude: pgtype.Float8{Float64: 77.6, Valid: true},
+		LastPingAt:    pgtype.Timestamptz{Time: now.Add(-10 * time.Second), Valid: true},
+	}
+	stops := []db.TransportTripStop{
+		tripStop(1, 12.900, false, false), // passed without entering the geofence
+		tripStop(2, 12.903, true, false),  // standing here
+		tripStop(3, 12.910, false, false),
+		tripStop(4, 12.920, false, false),
+	}
+
+	live := buildTripLive(trip, stops, 25, now)
+	want := []string{"skipped", "arrived", "pending", "pending"}
+	for i, st := range live.Stops {
+		if st.Status != want[i] {
+			t.Fatalf("stop %d: expected %s, got %s", i+1, want[i], st.Status)
+		}
+	}
+	if live.Stops[1].ETA != nil || live.Stops[2].ETA == nil || live.Stops[3].ETA == nil {
+		t.Fatalf("expected ETAs only for the stops ahead")
+	}
+	if !live.Stops[3].ETA.After(*live.Stops[2].ETA) {
+		t.Fatalf("expected ETAs in visiting order")
+	}
+	if live.NextStopID == nil || *live.NextStopID != stops[2].StopID.String() {
+		t.Fatalf("expected the third stop to be next")
+	}
+	if live.Stale {
+		t.Fatalf("a ping from 10 seconds ago is not stale")
+	}
+
+	trip.LastPingAt.Time = now.Add(-time.Hour)
+	trip.Status = "completed"
+	live = buildTripLive(trip, stops, 25, now)
+	if !live.Stale || live.NextStopID != nil || live.Stops[2].ETA != nil {
+		t.Fatalf("expected a finished trip to have no ETAs and a stale position")
+	}
+}
+
+func TestNormalizePings(t *testing.T) {
+	now := time.Date(2026, 7, 1, 7, 0, 0, 0, time.UTC)
+	speed := 32.5
+	pings, err := normalizePings([]PingInput{
+		{Latitude: 12.91, Longitude: 77.6, RecordedAt: now.Add(-10 * time.Second), SpeedKmph: &speed},
+		{Latitude: 12.90, Longitude: 77.6, RecordedAt: now.Add(-20 * time.Second)},
+		{Latitude: 12.92, Longitude: 77.6},
+	}, now)
+	if err != nil {
+		t.Fatalf("expected pings to be accepted: %v", err)
+	}
+	if pings[0].Latitude != 12.90 || pings[2].Latitude != 12.92 || !pings[2].RecordedAt.Time.Equal(now) {
+		t.Fatalf("expected pings sorted by time with missing times set to now")
+	}
+	if !pings[1].SpeedKmph.Valid || pings[0].SpeedKmph.Valid {
+		t.Fatalf("expected optional speed to be carried through")
+	}
+
+	invalid := [][]PingInput{
+		nil,
+		{{Latitude: 91, Longitude: 77}},
+		{{Latitude: 12, Longitude: 77, RecordedAt: now.Add(-48 * time.Hour)}},
+		{{Latitude: 12, Longitude: 77, RecordedAt: now.Add(time.Hour)}},
+	}
+	for _, in := range invalid {
+		if _, err := normalizePings(in, now); !errors.Is(err, ErrInvalidTracking) {
+			t.Fatalf("expected %+v to be rejected, got %v", in, err)
+		}
+	}
+}
@@ -15,10 +15,13 @@ type TransportService struct {
 	q     db.Querier
 	pool  *pgxpool.Pool
 	audit *audit.Logger
+	fleet *FleetService
 }
 
-func NewTransportService(q db.Querier, pool *pgxpool.Pool, audit *audit.Logger) *TransportService {
-	return &TransportService{q: q, pool: pool, audit: audit}
+// NewTransportService builds the service. With a fleet service, vehicles
+// without in-date compliance documents cannot be assigned to routes.
+func NewTransportService(q db.Querier, pool *pgxpool.Pool, audit *audit.Logger, fleet *FleetService) *TransportService {
+	return &TransportService{q: q, pool: pool, audit: audit, fleet: fleet}
 }
 
 // Vehicles
@@ -253,6 +256,12 @@ func (s *TransportService) CreateRoute(ctx context.Context, p CreateRouteParams)
 		dUUID.Scan(p.DriverID)
 	}
 
+	if s.fleet != nil {
+		if err := s.fleet.EnsureRouteVehicleCompliant(ctx, tUUID, pgtype.UUID{}, vUUID); err != nil {
+			return db.TransportRoute{}, err
+		}
+	}
+
 	route, err := s.q.CreateRoute(ctx, db.CreateRouteParams{
 		TenantID:    tUUID,
 		Name:        p.Name,
@@ -302,6 +311,12 @@ func (s *TransportService) UpdateRoute(ctx context.Context, tenantID, routeID st
 		dUUID.Scan(p.DriverID)
 	}
 
+	if s.fleet != nil {
+		if err := s.fleet.EnsureRouteVehicleCompliant(ctx, tUUID, rUUID, vUUID); err != nil {
+			return db.TransportRoute{}, err
+		}
+	}
+
 	route, err := s.q.UpdateRoute(ctx, db.UpdateRouteParams{
 		ID:          rUUID,
 		TenantID:    tUUID,
@@ -515,56 +530,3 @@ func (s *TransportService) ListFuelLogs(ctx context.Context, tenantID, vehicleID
 	return logs, nil
 }
 
-func (s *TransportService) GenerateTransportFees(ctx context.Context, tenantID string) (int, error) {
-	tUUID := pgtype.UUID{}
-	tUUID.Scan(tenantID)
-
-	// 1. Get active academic year
-	academicYear, err := s.q.GetActiveAcademicYear(ctx, tUUID)
-	if err != nil {
-		return 0, fmt.Errorf("active academic year not found: %w", err)
-	}
-
-	// 2. Get all active transport allocations
-	allocations, err := s.q.GetActiveTransportAllocationsWithCosts(ctx, tUUID)
-	if err != nil {
-		return 0, fmt.Errorf("failed to get allocations: %w", err)
-	}
-
-	count := 0
-	for _, alloc := range allocations {
-		if !alloc.PickupCost.Valid {
-			continue
-		}
-
-		// 3. Upsert optional fee item for this stop
-		itemName := fmt.Sprintf("Transport: %s", alloc.StopName)
-		amount := pgtype.Numeric{}
-		amount.Scan(fmt.Sprintf("%d.%d", alloc.PickupCost.Int64/100, alloc.PickupCost.Int64%100))
-
-		item, err := s.q.UpsertOptionalFeeItem(ctx, db.UpsertOptionalFeeItemParams{
-			TenantID: tUUID,
-			Name:     itemName,
-			Amount:   amount,
-			Category: pgtype.Text{String: "Transport", Valid: true},
-		})
-		if err != nil {
-			continue
-		}
-
-		// 4. Link student to this item
-		_, err = s.q.UpsertStudentOptionalFee(ctx, db.UpsertStudentOptionalFeeParams{
-			TenantID:       tUUID,
-			StudentID:      alloc.StudentID,
-			ItemID:         item.ID,
-			AcademicYearID: academicYear.ID,
-			Status:         "selected",
-		})
-		if err == nil {
-			count++
-		}
-	}
-
-	return count, nil
-}
-
@@ -0,0 +1,411 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/rs/zerolog/log"
+	"github.com/schoolerp/api/internal/db"
+)
+
+var (
+	ErrCheckInRejected = errors.New("trip not found or ended, or the attendant is not an active employee")
+	ErrUnknownCard     = errors.New("no active student matches the scanned card")
+	ErrReaderInUse     = errors.New("reader is already fitted to another vehicle")
+)
+
+const (
+	// A card tapped again this soon after boarding is a double tap, not the
+	// student getting off.
+	scanDebounce = time.Minute
+	// Reports cover at most a year.
+	maxReportDays = 366
+)
+
+// Scheduling
+
+// ScheduleTrips creates the day's pickup and drop trips for every active
+// route with a vehicle. Routes that already have a trip for the day and
+// direction are left alone, so running it twice is harmless.
+func (s *TrackingService) ScheduleTrips(ctx context.Context, tenantID string, day time.Time, actor TrackingActor) (int64, error) {
+	if day.IsZero() {
+		return 0, fmt.Errorf("%w: date is required", ErrInvalidTracking)
+	}
+	tid := toPgUUID(tenantID)
+	created, err := s.q.ScheduleTransportTrips(ctx, tid, pgtype.Date{Time: day, Valid: true})
+	if err != nil {
+		return 0, err
+	}
+	s.log(ctx, tid, actor, "trip.schedule", pgtype.UUID{}, map[string]any{
+		"trip_date": day.Format("2006-01-02"),
+		"created":   created,
+	})
+	return created, nil
+}
+
+// CheckIn records the driver or attendant reporting for a trip. An attendant
+// is an employee; without an employee id the caller's own record is used.
+func (s *TrackingService) CheckIn(ctx context.Context, tenantID, tripID, role, employeeID string, actor TrackingActor) (db.TransportTrip, error) {
+	tid := toPgUUID(tenantID)
+	role = strings.ToLower(strings.TrimSpace(role))
+	var (
+		trip db.TransportTrip
+		err  error
+	)
+	switch role {
+	case "driver":
+		trip, err = s.q.CheckInTransportTripDriver(ctx, tid, toPgUUID(tripID))
+	case "attendant":
+		emp := toPgUUID(employeeID)
+		if !emp.Valid {
+			emp, err = s.q.GetActiveEmployeeIDForUser(ctx, tid, toPgUUID(actor.UserID))
+			if errors.Is(err, pgx.ErrNoRows) {
+				return trip, fmt.Errorf("%w: employee_id is required", ErrInvalidTracking)
+			}
+			if err != nil {
+				return trip, err
+			}
+		}
+		trip, err = s.q.CheckInTransportTripAttendant(ctx, tid, toPgUUID(tripID), emp)
+	default:
+		return trip, fmt.Errorf("%w: role must be driver or attendant", ErrInvalidTracking)
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		return trip, ErrCheckInRejected
+	}
+	if err != nil {
+		return trip, err
+	}
+	s.log(ctx, tid, actor, "trip.check_in."+role, trip.ID, trip)
+	return trip, nil
+}
+
+// SetVehicleReader ties a bus's RFID reader to the vehicle so taps on it
+// mark students on and off the vehicle's running trip. An empty device id
+// removes the reader.
+func (s *TrackingService) SetVehicleReader(ctx context.Context, tenantID, vehicleID, deviceID string) error {
+	err := s.q.SetTransportVehicleReader(ctx, toPgUUID(tenantID), toPgUUID(vehicleID), strings.TrimSpace(deviceID))
+	var pgErr *pgconn.PgError
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return ErrVehicleNotFound
+	case errors.As(err, &pgErr) && pgErr.Code == "23505":
+		return ErrReaderInUse
+	}
+	return err
+}
+
+// Boarding and alighting
+
+// MarkParams is a student being marked on or off a trip.
+type MarkParams struct {
+	TenantID string
+	TripID   string
+	// StudentID identifies the student for manual marks. Scans leave it
+	// empty and set Identifier instead.
+	StudentID  string
+	Identifier string
+	// Method is manual, rfid or qr.
+	Method string
+	// Action is board or alight. A scan may leave it empty to toggle.
+	Action string
+	// StopID is where the mark was made. When empty, the stop the bus is
+	// standing at is used, then the student's own stop at their end of the
+	// trip.
+	StopID string
+	At     time.Time
+	Actor  TrackingActor
+}
+
+// MarkResult is a student's ride after a mark. Changed is false when the
+// student was already marked that way.
+type MarkResult struct {
+	db.TransportTripBoarding
+	Action  string `json:"action"`
+	Changed bool   `json:"changed"`
+}
+
+// scanAction decides what a tap means. Asked for, board and alight are
+// taken as given; otherwise a student not yet on the bus boards and one on
+// it alights, unless the tap repeats a boarding within scanDebounce.
+func scanAction(existing *db.TransportTripBoarding, requested string, at time.Time) string {
+	switch requested {
+	case "board", "alight":
+		return requested
+	}
+	if existing == nil || !existing.BoardedAt.Valid || existing.AlightedAt.Valid {
+		return "board"
+	}
+	if at.Sub(existing.BoardedAt.Time) < scanDebounce {
+		return "board"
+	}
+	return "alight"
+}
+
+// currentStop is the stop whose geofence the bus is standing in, if any.
+func currentStop(stops []db.TransportTripStop) pgtype.UUID {
+	for i := len(stops) - 1; i >= 0; i-- {
+		if stops[i].ArrivedAt.Valid && !stops[i].DepartedAt.Valid {
+			return stops[i].StopID
+		}
+	}
+	return pgtype.UUID{}
+}
+
+// Mark records a student getting on or off a running trip and tells their
+// guardians. Marking a student the way they are already marked changes
+// nothing.
+func (s *TrackingService) Mark(ctx context.Context, p MarkParams) (MarkResult, error) {
+	method := strings.ToLower(strings.TrimSpace(p.Method))
+	if method == "" {
+		method = "manual"
+	}
+	if method != "manual" && method != "rfid" && method != "qr" {
+		return MarkResult{}, fmt.Errorf("%w: method must be manual, rfid or qr", ErrInvalidTracking)
+	}
+	action := strings.ToLower(strings.TrimSpace(p.Action))
+	if action != "" && action != "board" && action != "alight" {
+		return MarkResult{}, fmt.Errorf("%w: action must be board or alight", ErrInvalidTracking)
+	}
+	if action == "" && method == "manual" {
+		return MarkResult{}, fmt.Errorf("%w: action is required for manual marks", ErrInvalidTracking)
+	}
+
+	trip, err := s.getTrip(ctx, p.TenantID, p.TripID)
+	if err != nil {
+		return MarkResult{}, err
+	}
+	if trip.Status != "in_progress" {
+		return MarkResult{}, ErrStudentNotOnTrip
+	}
+
+	studentID := toPgUUID(p.StudentID)
+	if method != "manual" {
+		identifier := strings.TrimSpace(p.Identifier)
+		if identifier == "" {
+			return MarkResult{}, fmt.Errorf("%w: identifier is required for scans", ErrInvalidTracking)
+		}
+		studentID, err = s.q.ResolveTransportStudent(ctx, trip.TenantID, method, identifier)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return MarkResult{}, ErrUnknownCard
+		}
+		if err != nil {
+			return MarkResult{}, err
+		}
+	}
+	if !studentID.Valid {
+		return MarkResult{}, fmt.Errorf("%w: student_id is required", ErrInvalidTracking)
+	}
+	return s.mark(ctx, trip, studentID, method, action, p.StopID, p.At, p.Actor)
+}
+
+// GetTripBoardings lists who rode a trip and where they got on and off.
+func (s *TrackingService) GetTripBoardings(ctx context.Context, tenantID, tripID string) ([]db.TransportTripBoarding, error) {
+	trip, err := s.getTrip(ctx, tenantID, tripID)
+	if err != nil {
+		return nil, err
+	}
+	return s.q.ListTransportTripBoardings(ctx, trip.ID)
+}
+
+func (s *TrackingService) mark(ctx context.Context, trip db.TransportTrip, studentID pgtype.UUID, method, action, stopID string, at time.Time, actor TrackingActor) (MarkResult, error) {
+	if at.IsZero() {
+		at = time.Now()
+	}
+	var existing *db.TransportTripBoarding
+	if b, err := s.q.GetTransportTripBoarding(ctx, trip.ID, studentID); err == nil {
+		existing = &b
+	} else if !errors.Is(err, pgx.ErrNoRows) {
+		return MarkResult{}, err
+	}
+	action = scanAction(existing, action, at)
+
+	stop := toPgUUID(stopID)
+	if !stop.Valid {
+		stops, err := s.q.ListTransportTripStops(ctx, trip.ID)
+		if err != nil {
+			return MarkResult{}, err
+		}
+		stop = currentStop(stops)
+	}
+	arg := db.MarkTransportTripBoardingParams{
+		TenantID:   trip.TenantID,
+		TripID:     trip.ID,
+		StudentID:  studentID,
+		StopID:     stop,
+		Method:     method,
+		At:         pgtype.Timestamptz{Time: at, Valid: true},
+		RecordedBy: toPgUUID(actor.UserID),
+	}
+	var (
+		b   db.TransportTripBoarding
+		err error
+	)
+	if action == "alight" {
+		b, err = s.q.AlightTransportTrip(ctx, arg)
+	} else {
+		b, err = s.q.BoardTransportTrip(ctx, arg)
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		// Already marked this way, or not allocated to the route.
+		if existing == nil {
+			return MarkResult{}, ErrStudentNotOnTrip
+		}
+		return MarkResult{TransportTripBoarding: *existing, Action: action}, nil
+	}
+	if err != nil {
+		return MarkResult{}, err
+	}
+	s.log(ctx, trip.TenantID, actor, "trip."+action, trip.ID, b)
+	s.notifyMark(ctx, trip, b, action)
+	return MarkResult{TransportTripBoarding: b, Action: action, Changed: true}, nil
+}
+
+func (s *TrackingService) notifyMark(ctx context.Context, trip db.TransportTrip, b db.TransportTripBoarding, action string) {
+	recipients, err := s.q.ListTransportStudentRecipients(ctx, trip.TenantID, b.StudentID)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("failed to resolve boarding notice recipients")
+		return
+	}
+	if len(recipients) == 0 {
+		return
+	}
+	payload := map[string]any{
+		"trip_id":             trip.ID.String(),
+		"route_id":            trip.RouteID.String(),
+		"route_name":          trip.RouteName,
+		"registration_number": trip.RegistrationNumber,
+		"direction":           trip.Direction,
+		"student_id":          b.StudentID.String(),
+		"student_name":        b.StudentName,
+		"recipients":          recipients,
+	}
+	eventType := "transport.student_boarded"
+	if action == "alight" {
+		eventType = "transport.student_alighted"
+		payload["stop_id"] = b.AlightStopID.String()
+		payload["alighted_at"] = b.AlightedAt.Time.UTC().Format(time.RFC3339)
+		payload["method"] = b.AlightMethod.String
+	} else {
+		payload["stop_id"] = b.StopID.String()
+		payload["boarded_at"] = b.BoardedAt.Time.UTC().Format(time.RFC3339)
+		payload["method"] = b.BoardMethod.String
+	}
+	if err := s.emit(ctx, trip.TenantID, eventType, payload); err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("failed to queue boarding notice")
+	}
+}
+
+// RecordReaderScan handles a tap on an RFID reader reported through the
+// biometric pipeline. It reports false when the device is not a bus reader,
+// leaving the tap to classroom and staff attendance. On a bus, a student's
+// tap marks them on or off the running trip and an employee's tap checks
+// them in as the attendant. Direction out always alights; anything else
+// toggles.
+func (s *TrackingService) RecordReaderScan(ctx context.Context, tenantID, deviceID, entityType, entityID, direction string, at time.Time) (bool, error) {
+	tid := toPgUUID(tenantID)
+	vehicleID, trip, err := s.q.GetActiveTransportTripForReader(ctx, tid, deviceID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		if vehicleID.Valid {
+			log.Ctx(ctx).Warn().Str("device_id", deviceID).Msg("bus reader tapped while its vehicle is not on a trip")
+			return true, nil
+		}
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	actor := TrackingActor{RequestID: "rfid:" + deviceID}
+	switch entityType {
+	case "employee":
+		_, err := s.q.CheckInTransportTripAttendant(ctx, tid, trip.ID, toPgUUID(entityID))
+		if errors.Is(err, pgx.ErrNoRows) {
+			return true, ErrCheckInRejected
+		}
+		if err == nil {
+			s.log(ctx, tid, actor, "trip.check_in.attendant", trip.ID, map[string]any{"employee_id": entityID, "device_id": deviceID})
+		}
+		return true, err
+	case "student":
+		action := ""
+		if strings.EqualFold(direction, "out") {
+			action = "alight"
+		}
+		_, err := s.mark(ctx, trip, toPgUUID(entityID), "rfid", action, "", at, actor)
+		return true, err
+	}
+	return true, nil
+}
+
+// Missed drops
+
+// raiseMissedDrops alerts transport managers and guardians about students
+// who rode to school on the route of a completed drop trip but were on no
+// drop trip that day.
+func (s *TrackingService) raiseMissedDrops(ctx context.Context, trip db.TransportTrip) {
+	missed, err := s.q.CreateTransportMissedDropAlerts(ctx, trip.TenantID, trip.ID)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("trip_id", trip.ID.String()).Msg("failed to check for missed drops")
+		return
+	}
+	if len(missed) == 0 {
+		return
+	}
+	managers, err := s.q.ListUsersWithPermission(ctx, trip.TenantID, AlertsPermission)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("failed to resolve transport alert recipients")
+	}
+	managerIDs := make([]string, 0, len(managers))
+	for _, m := range managers {
+		managerIDs = append(managerIDs, m.String())
+	}
+	for _, m := range missed {
+		recipients, err := s.q.ListTransportStudentRecipients(ctx, trip.TenantID, m.StudentID)
+		if err != nil {
+			log.Ctx(ctx).Error().Err(err).Msg("failed to resolve missed drop recipients")
+		}
+		if err := s.emit(ctx, trip.TenantID, "transport.missed_drop", map[string]any{
+			"alert_id":            m.ID.String(),
+			"trip_id":             trip.ID.String(),
+			"route_id":            trip.RouteID.String(),
+			"route_name":          trip.RouteName,
+			"registration_number": trip.RegistrationNumber,
+			"trip_date":           trip.TripDate.Time.Format("2006-01-02"),
+			"student_id":          m.StudentID.String(),
+			"student_name":        m.StudentName,
+			"recipients":          recipients,
+			"recipient_user_ids":  managerIDs,
+		}); err != nil {
+			log.Ctx(ctx).Error().Err(err).Msg("failed to queue missed drop alert")
+		}
+	}
+}
+
+// Reports
+
+func (s *TrackingService) RouteSummaries(ctx context.Context, tenantID string, from, to time.Time) ([]db.TransportRouteSummary, error) {
+	if from.IsZero() || to.IsZero() || to.Before(from) {
+		return nil, fmt.Errorf("%w: from and to must be a valid date range", ErrInvalidTracking)
+	}
+	if to.Sub(from) > maxReportDays*24*time.Hour {
+		return nil, fmt.Errorf("%w: reports cover at most %d days", ErrInvalidTracking, maxReportDays)
+	}
+	return s.q.ListTransportRouteSummaries(ctx, toPgUUID(tenantID),
+		pgtype.Date{Time: from, Valid: true}, pgtype.Date{Time: to, Valid: true})
+}
+
+// RouteRoster lists the students allocated to a route on a day with their
+// pickup and drop marks.
+func (s *TrackingService) RouteRoster(ctx context.Context, tenantID, routeID string, day time.Time) ([]db.TransportRosterEntry, error) {
+	if day.IsZero() {
+		return nil, fmt.Errorf("%w: date is required", ErrInvalidTracking)
+	}
+	return s.q.ListTransportRouteRoster(ctx, toPgUUID(tenantID), toPgUUID(routeID), pgtype.Date{Time: day, Valid: true})
+}
@@ -0,0 +1,55 @@
+package transport
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/schoolerp/api/internal/db"
+)
+
+func TestScanAction(t *testing.T) {
+	now := time.Date(2026, 7, 1, 7, 30, 0, 0, time.UTC)
+	ts := func(d time.Duration) pgtype.Timestamptz {
+		return pgtype.Timestamptz{Time: now.Add(-d), Valid: true}
+	}
+	onBoard := &db.TransportTripBoarding{BoardedAt: ts(20 * time.Minute)}
+	justBoarded := &db.TransportTripBoarding{BoardedAt: ts(10 * time.Second)}
+	alightOnly := &db.TransportTripBoarding{AlightedAt: ts(time.Minute)}
+	done := &db.TransportTripBoarding{BoardedAt: ts(time.Hour), AlightedAt: ts(time.Minute)}
+
+	cases := []struct {
+		name      string
+		existing  *db.TransportTripBoarding
+		requested string
+		want      string
+	}{
+		{"first tap boards", nil, "", "board"},
+		{"tap on board alights", onBoard, "", "alight"},
+		{"double tap stays on", justBoarded, "", "board"},
+		{"tap after a ride boards again", done, "", "board"},
+		{"tap after alighting without boarding boards", alightOnly, "", "board"},
+		{"explicit alight is kept", nil, "alight", "alight"},
+		{"explicit board is kept", onBoard, "board", "board"},
+	}
+	for _, c := range cases {
+		if got := scanAction(c.existing, c.requested, now); got != c.want {
+			t.Fatalf("%s: expected %s, got %s", c.name, c.want, got)
+		}
+	}
+}
+
+func TestCurrentStop(t *testing.T) {
+	stops := []db.TransportTripStop{
+		tripStop(1, 12.900, true, true),
+		tripStop(2, 12.903, true, false),
+		tripStop(3, 12.910, false, false),
+	}
+	if got := currentStop(stops); got != stops[1].StopID {
+		t.Fatalf("expected the bus to be at the second stop, got %s", got.String())
+	}
+	stops[1].DepartedAt = stops[1].ArrivedAt
+	if got := currentStop(stops); got.Valid {
+		t.Fatalf("expected no current stop between stops, got %s", got.String())
+	}
+}
@@ -0,0 +1,192 @@
+// Package datacrypt is the data-at-rest encryption shared by the API and the
+// worker: the DATA_ENCRYPTION_KEYS master keys, AES-256-GCM sealing, and the
+// envelope format the API keyring writes for tenant data. The API owns the
+// tenant data keys; the worker only reads them to open what the API sealed.
+package datacrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"strings"
+)
+
+// EnvelopePrefix marks values encrypted under a tenant data key:
+// "ev1:<data key id>:<base64(nonce || ciphertext)>". Anything else is a
+// legacy value encrypted directly with a master key.
+const EnvelopePrefix = "ev1:"
+
+var (
+	ErrKeysNotConfigured    = errors.New("DATA_ENCRYPTION_KEY(S) is not configured")
+	ErrMasterKeyUnavailable = errors.New("master key for tenant data key is not configured")
+	ErrInvalidCiphertext    = errors.New("invalid ciphertext")
+)
+
+// ResolveKeys returns the AES-256 master keys used for data at rest.
+// Order matters: the first key encrypts, all keys are tried when decrypting.
+//
+// Supported env vars:
+// - DATA_ENCRYPTION_KEYS: comma-separated list of keys (preferred for rotation)
+// - DATA_ENCRYPTION_KEY: single key (legacy)
+//
+// Each key is either 32 raw characters or base64 for 32 bytes.
+func ResolveKeys() ([][]byte, error) {
+	raw := make([]string, 0, 3)
+	if list := strings.TrimSpace(os.Getenv("DATA_ENCRYPTION_KEYS")); list != "" {
+		for _, part := range strings.Split(list, ",") {
+			if trimmed := strings.TrimSpace(part); trimmed != "" {
+				raw = append(raw, trimmed)
+			}
+		}
+	} else if legacy := strings.TrimSpace(os.Getenv("DATA_ENCRYPTION_KEY")); legacy != "" {
+		raw = append(raw, legacy)
+	}
+	if len(raw) == 0 {
+		return nil, ErrKeysNotConfigured
+	}
+
+	keys := make([][]byte, 0, len(raw))
+	for _, key := range raw {
+		if len(key) == 32 {
+			keys = append(keys, []byte(key))
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(key)
+		if err == nil && len(decoded) == 32 {
+			keys = append(keys, decoded)
+			continue
+		}
+		return nil, errors.New("DATA_ENCRYPTION_KEY(S) must be 32 raw characters or base64 for 32 bytes")
+	}
+	return keys, nil
+}
+
+// MasterKeyID identifies a master key without revealing it: the first 16 hex
+// characters of its SHA-256 fingerprint.
+func MasterKeyID(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+// MasterKey picks the configured master key with the given id.
+func MasterKey(masters [][]byte, id string) ([]byte, error) {
+	for _, k := range masters {
+		if MasterKeyID(k) == id {
+			return k, nil
+		}
+	}
+	return nil, ErrMasterKeyUnavailable
+}
+
+// Seal encrypts plaintext with AES-256-GCM under key, authenticating
+// additionalData alongside it. The output is nonce || ciphertext.
+func Seal(key, plaintext, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// Open reverses Seal; it must be given the same additionalData.
+func Open(key, sealed, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("cipher text too short")
+	}
+	return gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], additionalData)
+}
+
+// OpenLegacy opens a base64 value sealed directly with one of the master
+// keys and no additional data, trying each key in turn.
+func OpenLegacy(masters [][]byte, value string) ([]byte, error) {
+	raw, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidCiphertext
+	}
+	if len(masters) == 0 {
+		return nil, ErrKeysNotConfigured
+	}
+	var lastErr error
+	for _, k := range masters {
+		plain, err := Open(k, raw, nil)
+		if err == nil {
+			return plain, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// IsEnvelope reports whether value is under a tenant data key.
+func IsEnvelope(value string) bool {
+	return strings.HasPrefix(value, EnvelopePrefix)
+}
+
+// FormatEnvelope encodes a value sealed under the data key keyID.
+func FormatEnvelope(keyID string, sealed []byte) string {
+	return EnvelopePrefix + keyID + ":" + base64.StdEncoding.EncodeToString(sealed)
+}
+
+// ParseEnvelope splits a value produced by FormatEnvelope into its data key
+// id and sealed bytes. The id is returned as written.
+func ParseEnvelope(value string) (string, []byte, error) {
+	rest, ok := strings.CutPrefix(value, EnvelopePrefix)
+	if !ok {
+		return "", nil, ErrInvalidCiphertext
+	}
+	keyID, payload, ok := strings.Cut(rest, ":")
+	if !ok || keyID == "" {
+		return "", nil, ErrInvalidCiphertext
+	}
+	sealed, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return "", nil, ErrInvalidCiphertext
+	}
+	return keyID, sealed, nil
+}
+
+// WrapKey seals a tenant data key under a master key.
+func WrapKey(master []byte, keyID string, plain []byte) ([]byte, error) {
+	return Seal(master, plain, wrapAAD(keyID))
+}
+
+// UnwrapKey reverses WrapKey.
+func UnwrapKey(master []byte, keyID string, wrapped []byte) ([]byte, error) {
+	return Open(master, wrapped, wrapAAD(keyID))
+}
+
+// ValueAAD is the additional data for a tenant value. Binding the key id and
+// the tenant stops a value from being replayed under another id or tenant,
+// as wrapAAD does for a wrapped key.
+func ValueAAD(tenantID, keyID string) []byte {
+	return []byte(tenantID + ":" + keyID)
+}
+
+func wrapAAD(keyID string) []byte {
+	return []byte("tdk:" + keyID)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, errors.New("key must be 32 bytes for AES-256")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
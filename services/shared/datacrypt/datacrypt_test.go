@@ -0,0 +1,77 @@
+package datacrypt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+func TestEnvelopeRoundTrip(t *testing.T) {
+	master := bytes.Repeat([]byte{1}, 32)
+	dataKey := bytes.Repeat([]byte{2}, 32)
+	const keyID, tenant = "0190c2a4-0000-7000-8000-000000000001", "0190c2a4-0000-7000-8000-0000000000aa"
+
+	wrapped, err := WrapKey(master, keyID, dataKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := UnwrapKey(master, "0190c2a4-0000-7000-8000-000000000002", wrapped); err == nil {
+		t.Fatal("expected a wrapped key to be bound to its id")
+	}
+	unwrapped, err := UnwrapKey(master, keyID, wrapped)
+	if err != nil || !bytes.Equal(unwrapped, dataKey) {
+		t.Fatalf("unwrap: %v", err)
+	}
+
+	sealed, err := Seal(unwrapped, []byte("482913"), ValueAAD(tenant, keyID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	value := FormatEnvelope(keyID, sealed)
+	if !IsEnvelope(value) {
+		t.Fatalf("expected %q to be an envelope", value)
+	}
+	gotID, gotSealed, err := ParseEnvelope(value)
+	if err != nil || gotID != keyID {
+		t.Fatalf("parse: %q %v", gotID, err)
+	}
+	if _, err := Open(dataKey, gotSealed, ValueAAD("0190c2a4-0000-7000-8000-0000000000bb", keyID)); err == nil {
+		t.Fatal("expected a value to be bound to its tenant")
+	}
+	plain, err := Open(dataKey, gotSealed, ValueAAD(tenant, keyID))
+	if err != nil || string(plain) != "482913" {
+		t.Fatalf("open: %q %v", plain, err)
+	}
+}
+
+func TestResolveKeysAndLegacyValues(t *testing.T) {
+	old, current := bytes.Repeat([]byte{3}, 32), bytes.Repeat([]byte{4}, 32)
+	t.Setenv("DATA_ENCRYPTION_KEY", "")
+	t.Setenv("DATA_ENCRYPTION_KEYS", base64.StdEncoding.EncodeToString(current)+", "+string(bytes.Repeat([]byte{'k'}, 32)))
+	keys, err := ResolveKeys()
+	if err != nil || len(keys) != 2 || !bytes.Equal(keys[0], current) {
+		t.Fatalf("resolve: %d keys, %v", len(keys), err)
+	}
+	if _, err := MasterKey(keys, MasterKeyID(old)); !errors.Is(err, ErrMasterKeyUnavailable) {
+		t.Fatalf("expected an unknown master key id to be unavailable, got %v", err)
+	}
+
+	sealed, err := Seal(current, []byte("secret"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := OpenLegacy([][]byte{old, current}, base64.StdEncoding.EncodeToString(sealed))
+	if err != nil || string(plain) != "secret" {
+		t.Fatalf("legacy: %q %v", plain, err)
+	}
+
+	t.Setenv("DATA_ENCRYPTION_KEYS", "too-short")
+	if _, err := ResolveKeys(); err == nil {
+		t.Fatal("expected a malformed key to be rejected")
+	}
+	t.Setenv("DATA_ENCRYPTION_KEYS", "")
+	if _, err := ResolveKeys(); !errors.Is(err, ErrKeysNotConfigured) {
+		t.Fatalf("expected no keys to be reported, got %v", err)
+	}
+}
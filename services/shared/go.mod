@@ -0,0 +1,3 @@
+module github.com/schoolerp/shared
+
+go 1.25.0
@@ -0,0 +1,42 @@
+package db
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// OTPDelivery is what the worker needs to send a phone OTP challenge.
+type OTPDelivery struct {
+	ID             pgtype.UUID
+	Purpose        string
+	Channel        string
+	CodeCiphertext pgtype.Text
+	ExpiresAt      pgtype.Timestamptz
+	ConsumedAt     pgtype.Timestamptz
+}
+
+// GetOTPDelivery loads a challenge within a tenant for delivery.
+func (q *Queries) GetOTPDelivery(ctx context.Context, tenantID, id pgtype.UUID) (OTPDelivery, error) {
+	const query = `
+		SELECT id, purpose, channel, code_ciphertext, expires_at, consumed_at
+		FROM auth_otp_challenges
+		WHERE id = $1 AND tenant_id = $2
+	`
+	var d OTPDelivery
+	err := q.db.QueryRow(ctx, query, id, tenantID).
+		Scan(&d.ID, &d.Purpose, &d.Channel, &d.CodeCiphertext, &d.ExpiresAt, &d.ConsumedAt)
+	return d, err
+}
+
+// ClearOTPDeliveryCode drops the encrypted code once it has been sent or can no
+// longer be used.
+func (q *Queries) ClearOTPDeliveryCode(ctx context.Context, id pgtype.UUID) error {
+	const query = `
+		UPDATE auth_otp_challenges
+		SET code_ciphertext = NULL, dispatched_at = COALESCE(dispatched_at, NOW())
+		WHERE id = $1
+	`
+	_, err := q.db.Exec(ctx, query, id)
+	return err
+}
@@ -0,0 +1,31 @@
+package db
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// TenantDataKey is a tenant data key as the API keyring stores it, wrapped
+// under one of the DATA_ENCRYPTION_KEYS master keys.
+type TenantDataKey struct {
+	ID          pgtype.UUID
+	TenantID    pgtype.UUID
+	Status      string
+	MasterKeyID pgtype.Text
+	WrappedKey  []byte
+}
+
+// GetTenantDataKey loads a data key by id. The worker never creates or
+// rotates keys; it only opens values the API sealed.
+func (q *Queries) GetTenantDataKey(ctx context.Context, id pgtype.UUID) (TenantDataKey, error) {
+	const query = `
+		SELECT id, tenant_id, status, master_key_id, wrapped_key
+		FROM tenant_data_keys
+		WHERE id = $1
+	`
+	var k TenantDataKey
+	err := q.db.QueryRow(ctx, query, id).
+		Scan(&k.ID, &k.TenantID, &k.Status, &k.MasterKeyID, &k.WrappedKey)
+	return k, err
+}
@@ -271,6 +271,18 @@ func (c *Consumer) handleEvent(ctx context.Context, event db.Outbox) error {
 		}
 		return notif.SendWhatsApp(ctx, contact, "Fee payment received. Thank you!")
 
+	case "auth.otp.requested":
+		var payload map[string]interface{}
+		_ = json.Unmarshal(event.Payload, &payload)
+		return c.deliverOTP(ctx, event, payload)
+
+	case "transport.bus_arriving", "transport.student_boarded", "transport.student_alighted",
+		"transport.missed_drop", "transport.alert", "transport.compliance_expiring", "transport.service_due":
+		return c.handleTransportEvent(ctx, event)
+
+	case "library.reservation_ready":
+		return c.handleLibraryReservation(ctx, event)
+
 	case "notice.published":
 		var payload map[string]interface{}
 		json.Unmarshal(event.Payload, &payload)
@@ -0,0 +1,63 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/schoolerp/worker/internal/db"
+	"github.com/schoolerp/worker/internal/notification"
+)
+
+// libraryReservationPayload is the library.reservation_ready outbox payload.
+// RecipientUserIDs are the member's guardians or, for staff, their own user.
+type libraryReservationPayload struct {
+	BookTitle        string   `json:"book_title"`
+	MemberName       string   `json:"member_name"`
+	AccessionNumber  string   `json:"accession_number"`
+	HoldUntil        string   `json:"hold_until"`
+	RecipientUserIDs []string `json:"recipient_user_ids"`
+}
+
+// handleLibraryReservation tells a member that a reserved book is on hold for
+// them. Recipients are never logged.
+func (c *Consumer) handleLibraryReservation(ctx context.Context, event db.Outbox) error {
+	var p libraryReservationPayload
+	if err := json.Unmarshal(event.Payload, &p); err != nil {
+		return err
+	}
+
+	msg := fmt.Sprintf("%q is ready for %s at the library.", p.BookTitle, p.MemberName)
+	if until, err := time.Parse(time.RFC3339, p.HoldUntil); err == nil {
+		msg = fmt.Sprintf("%q is ready for %s at the library and held until %s.", p.BookTitle, p.MemberName, until.Format("2 Jan 2006"))
+	}
+
+	notif := c.notif
+	if ta, ok := c.notif.(notification.TenantAwareAdapter); ok {
+		notif = ta.WithTenant(event.TenantID.String())
+	}
+
+	attempted, failed := 0, 0
+	seen := map[string]bool{}
+	for _, id := range p.RecipientUserIDs {
+		if id = strings.TrimSpace(id); id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		attempted++
+		if err := notif.SendPush(ctx, id, "Reserved book ready", msg); err != nil {
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		log.Printf("[Worker] %s event %s: %d of %d notices failed", event.EventType, event.ID, failed, attempted)
+	}
+	if attempted > 0 && failed == attempted {
+		return fmt.Errorf("failed to deliver %s notices", event.EventType)
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/schoolerp/shared/datacrypt"
+	"github.com/schoolerp/worker/internal/db"
+	"github.com/schoolerp/worker/internal/notification"
+)
+
+// otpStore is implemented by *db.Queries; the codes live on the challenge, not in
+// the outbox payload.
+type otpStore interface {
+	GetOTPDelivery(ctx context.Context, tenantID, id pgtype.UUID) (db.OTPDelivery, error)
+	ClearOTPDeliveryCode(ctx context.Context, id pgtype.UUID) error
+	GetTenantDataKey(ctx context.Context, id pgtype.UUID) (db.TenantDataKey, error)
+}
+
+// deliverOTP sends the code for an auth.otp.requested event and then clears it
+// from the challenge, so it is held only until it has been sent.
+func (c *Consumer) deliverOTP(ctx context.Context, event db.Outbox, payload map[string]interface{}) error {
+	store, ok := c.q.(otpStore)
+	if !ok {
+		return errors.New("querier cannot load OTP challenges")
+	}
+	phone := strings.TrimSpace(readString(payload, "phone"))
+	var challengeID pgtype.UUID
+	if phone == "" || challengeID.Scan(readString(payload, "challenge_id")) != nil {
+		return nil
+	}
+
+	challenge, err := store.GetOTPDelivery(ctx, event.TenantID, challengeID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
+	if !challenge.CodeCiphertext.Valid {
+		return nil
+	}
+	// A code that can no longer be used is not worth delivering late.
+	if challenge.ConsumedAt.Valid || (challenge.ExpiresAt.Valid && time.Now().After(challenge.ExpiresAt.Time)) {
+		log.Printf("[Worker] skipping expired OTP delivery for event %s", event.ID)
+		return store.ClearOTPDeliveryCode(ctx, challenge.ID)
+	}
+
+	code, err := decryptTenantString(ctx, store, event.TenantID, challenge.CodeCiphertext.String)
+	if err != nil {
+		return fmt.Errorf("decrypt OTP: %w", err)
+	}
+	message := otpMessage(code, challenge.Purpose, challenge.ExpiresAt.Time)
+
+	notif := c.notif
+	if ta, ok := c.notif.(notification.TenantAwareAdapter); ok {
+		notif = ta.WithTenant(event.TenantID.String())
+	}
+	if challenge.Channel == "whatsapp" {
+		err = notif.SendWhatsApp(ctx, phone, message)
+	} else {
+		err = notif.SendSMS(ctx, phone, message)
+	}
+	if err != nil {
+		return err
+	}
+	return store.ClearOTPDeliveryCode(ctx, challenge.ID)
+}
+
+func otpMessage(code, purpose string, expiresAt time.Time) string {
+	action := "login"
+	if purpose == "verify_phone" {
+		action = "phone verification"
+	}
+	minutes := int(time.Until(expiresAt).Round(time.Minute).Minutes())
+	if minutes < 1 {
+		minutes = 1
+	}
+	return fmt.Sprintf("%s is your SchoolERP %s code. It expires in %d minutes. Do not share it with anyone.", code, action, minutes)
+}
+
+// decryptTenantString opens a value the API sealed with its tenant keyring:
+// an envelope under one of the tenant's data keys, or a legacy value under a
+// master key.
+func decryptTenantString(ctx context.Context, store otpStore, tenantID pgtype.UUID, value string) (string, error) {
+	masters, err := datacrypt.ResolveKeys()
+	if err != nil {
+		return "", err
+	}
+	if !datacrypt.IsEnvelope(value) {
+		plain, err := datacrypt.OpenLegacy(masters, value)
+		return string(plain), err
+	}
+
+	rawID, sealed, err := datacrypt.ParseEnvelope(value)
+	if err != nil {
+		return "", err
+	}
+	var keyID pgtype.UUID
+	if keyID.Scan(rawID) != nil {
+		return "", datacrypt.ErrInvalidCiphertext
+	}
+	key, err := store.GetTenantDataKey(ctx, keyID)
+	if err != nil {
+		return "", err
+	}
+	if key.TenantID != tenantID {
+		return "", errors.New("ciphertext belongs to another tenant")
+	}
+	if key.Status == "destroyed" || len(key.WrappedKey) == 0 {
+		return "", errors.New("tenant data key has been destroyed")
+	}
+	master, err := datacrypt.MasterKey(masters, key.MasterKeyID.String)
+	if err != nil {
+		return "", err
+	}
+	dataKey, err := datacrypt.UnwrapKey(master, key.ID.String(), key.WrappedKey)
+	if err != nil {
+		return "", fmt.Errorf("unwrap tenant data key: %w", err)
+	}
+	plain, err := datacrypt.Open(dataKey, sealed, datacrypt.ValueAAD(tenantID.String(), key.ID.String()))
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
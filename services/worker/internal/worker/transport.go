@@ -0,0 +1,150 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/schoolerp/worker/internal/db"
+	"github.com/schoolerp/worker/internal/notification"
+)
+
+// transportPayload is the union of the transport.* outbox payloads. Guardian
+// notices carry resolved guardians in Recipients; staff notices carry user IDs.
+type transportPayload struct {
+	RouteName          string               `json:"route_name"`
+	RegistrationNumber string               `json:"registration_number"`
+	StopName           string               `json:"stop_name"`
+	MinutesAway        int                  `json:"minutes_away"`
+	StudentName        string               `json:"student_name"`
+	TripDate           string               `json:"trip_date"`
+	AlertType          string               `json:"alert_type"`
+	ObservedValue      float64              `json:"observed_value"`
+	ThresholdValue     float64              `json:"threshold_value"`
+	DocType            string               `json:"doc_type"`
+	SubjectName        string               `json:"subject_name"`
+	ExpiresOn          string               `json:"expires_on"`
+	DaysLeft           int                  `json:"days_left"`
+	Expired            bool                 `json:"expired"`
+	ScheduleName       string               `json:"schedule_name"`
+	Status             string               `json:"status"`
+	Recipients         []transportRecipient `json:"recipients"`
+	RecipientUserIDs   []string             `json:"recipient_user_ids"`
+}
+
+type transportRecipient struct {
+	GuardianUserID pgtype.UUID `json:"guardian_user_id"`
+	Phone          string      `json:"phone"`
+}
+
+// handleTransportEvent delivers the guardian and staff notices raised by live
+// bus tracking and fleet compliance. Guardians with an app account get a push,
+// others an SMS; staff get a push. Recipients are never logged.
+func (c *Consumer) handleTransportEvent(ctx context.Context, event db.Outbox) error {
+	if staleTransportNotice(event, time.Now()) {
+		log.Printf("[Worker] skipping stale %s event %s", event.EventType, event.ID)
+		return nil
+	}
+	var p transportPayload
+	if err := json.Unmarshal(event.Payload, &p); err != nil {
+		return err
+	}
+
+	var title, guardianMsg, staffMsg string
+	switch event.EventType {
+	case "transport.bus_arriving":
+		title = "Bus arriving"
+		guardianMsg = fmt.Sprintf("Bus %s (%s) will reach %s in about %d min.", p.RegistrationNumber, p.RouteName, p.StopName, p.MinutesAway)
+	case "transport.student_boarded":
+		title = "Boarded the bus"
+		guardianMsg = fmt.Sprintf("%s has boarded bus %s (%s).", p.StudentName, p.RegistrationNumber, p.RouteName)
+	case "transport.student_alighted":
+		title = "Got off the bus"
+		guardianMsg = fmt.Sprintf("%s has got off bus %s (%s).", p.StudentName, p.RegistrationNumber, p.RouteName)
+	case "transport.missed_drop":
+		title = "Missed drop"
+		guardianMsg = fmt.Sprintf("%s was not on the drop bus on route %s today. Please contact the school.", p.StudentName, p.RouteName)
+		staffMsg = fmt.Sprintf("%s rode route %s to school on %s but was on no drop trip.", p.StudentName, p.RouteName, p.TripDate)
+	case "transport.alert":
+		title = "Transport alert"
+		staffMsg = fmt.Sprintf("Bus %s (%s): %s, observed %.0f against a limit of %.0f.", p.RegistrationNumber, p.RouteName, strings.ReplaceAll(p.AlertType, "_", " "), p.ObservedValue, p.ThresholdValue)
+	case "transport.compliance_expiring":
+		title = "Transport document expiring"
+		when := fmt.Sprintf("expires in %d days (%s)", p.DaysLeft, p.ExpiresOn)
+		if p.Expired {
+			when = "expired on " + p.ExpiresOn
+		}
+		staffMsg = fmt.Sprintf("%s: %s %s.", p.SubjectName, strings.ReplaceAll(p.DocType, "_", " "), when)
+	case "transport.service_due":
+		title = "Vehicle service due"
+		staffMsg = fmt.Sprintf("%s for bus %s is %s.", p.ScheduleName, p.RegistrationNumber, strings.ReplaceAll(p.Status, "_", " "))
+	default:
+		return nil
+	}
+
+	notif := c.notif
+	if ta, ok := c.notif.(notification.TenantAwareAdapter); ok {
+		notif = ta.WithTenant(event.TenantID.String())
+	}
+
+	attempted, failed := 0, 0
+	send := func(err error) {
+		attempted++
+		if err != nil {
+			failed++
+		}
+	}
+	if guardianMsg != "" {
+		seen := map[string]bool{}
+		for _, r := range p.Recipients {
+			switch {
+			case r.GuardianUserID.Valid:
+				key := r.GuardianUserID.String()
+				if seen[key] {
+					continue
+				}
+				seen[key] = true
+				send(notif.SendPush(ctx, key, title, guardianMsg))
+			case strings.TrimSpace(r.Phone) != "":
+				key := strings.TrimSpace(r.Phone)
+				if seen[key] {
+					continue
+				}
+				seen[key] = true
+				send(notif.SendSMS(ctx, key, guardianMsg))
+			}
+		}
+	}
+	if staffMsg != "" {
+		seen := map[string]bool{}
+		for _, id := range p.RecipientUserIDs {
+			if id = strings.TrimSpace(id); id == "" || seen[id] {
+				continue
+			}
+			seen[id] = true
+			send(notif.SendPush(ctx, id, title, staffMsg))
+		}
+	}
+
+	if failed > 0 {
+		log.Printf("[Worker] %s event %s: %d of %d notices failed", event.EventType, event.ID, failed, attempted)
+	}
+	if attempted > 0 && failed == attempted {
+		return fmt.Errorf("failed to deliver %s notices", event.EventType)
+	}
+	return nil
+}
+
+// staleTransportNotice reports whether a live-trip notice is too old to be
+// worth sending, e.g. after the worker has been down.
+func staleTransportNotice(event db.Outbox, now time.Time) bool {
+	switch event.EventType {
+	case "transport.bus_arriving", "transport.student_boarded", "transport.student_alighted":
+		return event.CreatedAt.Valid && now.Sub(event.CreatedAt.Time) > 30*time.Minute
+	}
+	return false
+}